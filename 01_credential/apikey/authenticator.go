@@ -6,22 +6,32 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/consent"
 	"golang.org/x/crypto/sha3"
 )
 
 var (
-	ErrInvalidAPIKey    = errors.New("invalid API key")
-	ErrAPIKeyExpired    = errors.New("API key expired")
-	ErrAPIKeyRevoked    = errors.New("API key revoked")
-	ErrAPIKeyNotFound   = errors.New("API key not found")
-	ErrInvalidKeyFormat = errors.New("invalid API key format")
+	ErrInvalidAPIKey    = autherrors.New(autherrors.ErrInvalidCredentials, "invalid API key")
+	ErrAPIKeyExpired    = autherrors.New(autherrors.ErrInvalidCredentials, "API key expired")
+	ErrAPIKeyRevoked    = autherrors.New(autherrors.ErrInvalidCredentials, "API key revoked")
+	ErrAPIKeyNotFound   = autherrors.New(autherrors.ErrInvalidCredentials, "API key not found")
+	ErrInvalidKeyFormat = autherrors.New(autherrors.ErrInvalidCredentials, "invalid API key format")
+	ErrConsentRequired  = autherrors.New(autherrors.ErrPermissionDenied, "the user has not consented to the scopes of the client")
+	ErrNoConsentStore   = autherrors.New(autherrors.ErrNotImplemented, "no consent store configured")
 )
 
+// MetadataClientID is the metadata key of the third-party client an API key
+// was issued to on behalf of its user (see GenerateClientKey)
+const MetadataClientID = "client_id"
+
 // Credentials represents API key credentials
 type Credentials struct {
 	APIKey string
@@ -76,15 +86,28 @@ type KeyStore interface {
 	Delete(ctx context.Context, keyID string) error
 }
 
+// KeyLister is implemented by key stores that can list the keys of a user
+// (used by management APIs)
+type KeyLister interface {
+	// ListByUser returns the API keys of a user, oldest first
+	ListByUser(ctx context.Context, userID string) ([]*APIKey, error)
+}
+
 // Authenticator handles API key authentication
 type Authenticator struct {
 	keyStore KeyStore
+	consents consent.Store
 	hasher   *KeyHasher
 }
 
 // Config holds configuration for API key authenticator
 type Config struct {
 	KeyStore KeyStore
+
+	// Consents stores the scopes users granted to third-party clients
+	// (optional). Keys issued to a client authenticate only while the
+	// consent of their user covers their scopes.
+	Consents consent.Store
 }
 
 // NewAuthenticator creates a new API key authenticator
@@ -100,6 +123,7 @@ func NewAuthenticator(config *Config) *Authenticator {
 
 	return &Authenticator{
 		keyStore: config.KeyStore,
+		consents: config.Consents,
 		hasher:   NewKeyHasher(),
 	}
 }
@@ -149,6 +173,20 @@ func (a *Authenticator) Authenticate(ctx context.Context, creds credential.Crede
 		}, nil
 	}
 
+	// Keys of third-party clients need the consent of their user
+	if clientID, _ := apiKey.Metadata[MetadataClientID].(string); clientID != "" && a.consents != nil {
+		missing, err := consent.Missing(ctx, a.consents, apiKey.UserID, clientID, apiKey.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("consent lookup failed: %w", err)
+		}
+		if len(missing) > 0 {
+			return &credential.AuthenticationResult{
+				Success: false,
+				Error:   fmt.Errorf("%w: %s", ErrConsentRequired, strings.Join(missing, " ")),
+			}, nil
+		}
+	}
+
 	// Update last used timestamp (async, don't wait)
 	go func() {
 		_ = a.keyStore.UpdateLastUsed(context.Background(), apiKey.ID, time.Now())
@@ -182,8 +220,24 @@ func (a *Authenticator) Type() string {
 	return "apikey"
 }
 
+// ParseCredentials parses {"api_key"}
+func (a *Authenticator) ParseCredentials(payload []byte) (credential.Credentials, error) {
+	var body struct {
+		APIKey string `json:"api_key"`
+	}
+	if err := credential.DecodePayload(payload, &body); err != nil {
+		return nil, err
+	}
+	return &Credentials{APIKey: body.APIKey}, nil
+}
+
 // GenerateKey generates a new API key
 func (a *Authenticator) GenerateKey(ctx context.Context, userID, name string, scopes []string, expiresIn *time.Duration) (keyString string, apiKey *APIKey, err error) {
+	return a.generateKey(ctx, userID, name, scopes, expiresIn, make(map[string]interface{}))
+}
+
+// generateKey generates and stores an API key with metadata
+func (a *Authenticator) generateKey(ctx context.Context, userID, name string, scopes []string, expiresIn *time.Duration, metadata map[string]interface{}) (keyString string, apiKey *APIKey, err error) {
 	// Generate random key
 	keyString, err = a.hasher.Generate()
 	if err != nil {
@@ -207,7 +261,7 @@ func (a *Authenticator) GenerateKey(ctx context.Context, userID, name string, sc
 		UserID:    userID,
 		Name:      name,
 		Scopes:    scopes,
-		Metadata:  make(map[string]interface{}),
+		Metadata:  metadata,
 		CreatedAt: time.Now(),
 		Revoked:   false,
 	}
@@ -226,6 +280,27 @@ func (a *Authenticator) GenerateKey(ctx context.Context, userID, name string, sc
 	return keyString, apiKey, nil
 }
 
+// GenerateClientKey generates an API key for a third-party client acting on
+// behalf of a user. The user must have consented to the scopes for the
+// client: otherwise ErrConsentRequired names the missing scopes, which the
+// user must be prompted for (and granted in the consent store) first. The
+// key stops authenticating when the consent is revoked.
+func (a *Authenticator) GenerateClientKey(ctx context.Context, userID, clientID, name string, scopes []string, expiresIn *time.Duration) (keyString string, apiKey *APIKey, err error) {
+	if a.consents == nil {
+		return "", nil, ErrNoConsentStore
+	}
+
+	missing, err := consent.Missing(ctx, a.consents, userID, clientID, scopes)
+	if err != nil {
+		return "", nil, fmt.Errorf("consent lookup failed: %w", err)
+	}
+	if len(missing) > 0 {
+		return "", nil, fmt.Errorf("%w: %s", ErrConsentRequired, strings.Join(missing, " "))
+	}
+
+	return a.generateKey(ctx, userID, name, scopes, expiresIn, map[string]interface{}{MetadataClientID: clientID})
+}
+
 // RevokeKey revokes an API key
 func (a *Authenticator) RevokeKey(ctx context.Context, keyID string) error {
 	return a.keyStore.Revoke(ctx, keyID)
@@ -305,6 +380,22 @@ func (s *InMemoryKeyStore) GetByPrefix(ctx context.Context, prefix string) ([]*A
 	return results, nil
 }
 
+// ListByUser returns the API keys of a user, oldest first
+func (s *InMemoryKeyStore) ListByUser(ctx context.Context, userID string) ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []*APIKey
+	for _, key := range s.keys {
+		if key.UserID == userID {
+			results = append(results, key)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].CreatedAt.Before(results[j].CreatedAt) })
+
+	return results, nil
+}
+
 func (s *InMemoryKeyStore) Store(ctx context.Context, key *APIKey) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,243 @@
+// Package appkey authenticates apps with app keys: a key ID and secret
+// issued to an app of a tenant, as in the OAuth2 client credentials grant
+// with client_secret. Authenticated apps get tokens scoped to their tenant
+// and app, with the scopes they requested among those of the key.
+package appkey
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrKeyNotFound     = autherrors.New(autherrors.ErrInvalidCredentials, "app key not found")
+	ErrKeyRevoked      = autherrors.New(autherrors.ErrInvalidCredentials, "app key revoked")
+	ErrKeyExpired      = autherrors.New(autherrors.ErrInvalidCredentials, "app key expired")
+	ErrInvalidSecret   = autherrors.New(autherrors.ErrInvalidCredentials, "invalid app key secret")
+	ErrScopeNotAllowed = autherrors.New(autherrors.ErrInsufficientScope, "requested scope is not allowed")
+	ErrMissingApp      = autherrors.New(autherrors.ErrInvalidRequest, "app keys require a tenant and an app")
+)
+
+// KeyIDPrefix starts the IDs of app keys, telling them apart from the
+// client IDs of other clients
+const KeyIDPrefix = "ak_"
+
+// Credentials are the client credentials of an app
+type Credentials struct {
+	// KeyID identifies the key (client_id)
+	KeyID string
+
+	// Secret is the secret of the key (client_secret)
+	Secret string
+
+	// Scopes are the requested scopes (optional, default: those of the key)
+	Scopes []string
+}
+
+func (c *Credentials) Type() string {
+	return "app_key"
+}
+
+func (c *Credentials) Validate() error {
+	if c.KeyID == "" {
+		return errors.New("key ID is required")
+	}
+	if c.Secret == "" {
+		return errors.New("secret is required")
+	}
+	return nil
+}
+
+// Account returns the key ID, so failed logins are counted per key
+func (c *Credentials) Account() string {
+	return c.KeyID
+}
+
+// Config holds configuration for the app key authenticator
+type Config struct {
+	// KeyStore stores app keys (default: in-memory)
+	KeyStore KeyStore
+}
+
+// Authenticator authenticates apps with app keys
+type Authenticator struct {
+	keyStore KeyStore
+	hasher   *apikey.KeyHasher
+}
+
+// NewAuthenticator creates a new app key authenticator
+func NewAuthenticator(config *Config) *Authenticator {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.KeyStore == nil {
+		config.KeyStore = NewInMemoryKeyStore()
+	}
+
+	return &Authenticator{
+		keyStore: config.KeyStore,
+		hasher:   apikey.NewKeyHasher(),
+	}
+}
+
+// KeyStore returns the key store of the authenticator
+func (a *Authenticator) KeyStore() KeyStore {
+	return a.keyStore
+}
+
+// CreateKey creates a key for an app of a tenant and returns its secret,
+// which is only available now: the store keeps its hash
+func (a *Authenticator) CreateKey(ctx context.Context, tenantID, appID, name string, scopes []string, expiresIn *time.Duration) (secret string, key *Key, err error) {
+	if tenantID == "" || appID == "" {
+		return "", nil, ErrMissingApp
+	}
+
+	secret, err = a.hasher.Generate()
+	if err != nil {
+		return "", nil, err
+	}
+	keyID, err := newKeyID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key = &Key{
+		KeyID:      keyID,
+		TenantID:   tenantID,
+		AppID:      appID,
+		Name:       name,
+		SecretHash: a.hasher.Hash(secret),
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	}
+	if expiresIn != nil {
+		expiresAt := key.CreatedAt.Add(*expiresIn)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := a.keyStore.Store(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to store app key: %w", err)
+	}
+	return secret, key, nil
+}
+
+// RevokeKey revokes an app key: it no longer authenticates, and tokens
+// already issued expire normally
+func (a *Authenticator) RevokeKey(ctx context.Context, keyID string) error {
+	return a.keyStore.Revoke(ctx, keyID)
+}
+
+// Authenticate verifies the client credentials of an app
+func (a *Authenticator) Authenticate(ctx context.Context, creds credential.Credentials) (*credential.AuthenticationResult, error) {
+	appCreds, ok := creds.(*Credentials)
+	if !ok {
+		return &credential.AuthenticationResult{
+			Success: false,
+			Error:   errors.New("invalid credentials type"),
+		}, nil
+	}
+
+	if err := appCreds.Validate(); err != nil {
+		return &credential.AuthenticationResult{Success: false, Error: err}, nil
+	}
+
+	key, err := a.keyStore.Get(ctx, appCreds.KeyID)
+	if errors.Is(err, ErrKeyNotFound) {
+		return &credential.AuthenticationResult{Success: false, Error: ErrKeyNotFound}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("app key lookup failed: %w", err)
+	}
+
+	if !a.hasher.Compare(appCreds.Secret, key.SecretHash) {
+		return &credential.AuthenticationResult{Success: false, Error: ErrInvalidSecret}, nil
+	}
+	if key.Revoked {
+		return &credential.AuthenticationResult{Success: false, Error: ErrKeyRevoked}, nil
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return &credential.AuthenticationResult{Success: false, Error: ErrKeyExpired}, nil
+	}
+
+	scopes := appCreds.Scopes
+	if len(scopes) == 0 {
+		scopes = key.Scopes
+	}
+	if len(key.Scopes) > 0 {
+		for _, scope := range scopes {
+			if !slices.Contains(key.Scopes, scope) {
+				return &credential.AuthenticationResult{
+					Success: false,
+					Error:   fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope),
+				}, nil
+			}
+		}
+	}
+
+	// Update last used timestamp (async, don't wait)
+	go func() {
+		_ = a.keyStore.UpdateLastUsed(context.Background(), key.KeyID, time.Now())
+	}()
+
+	subjectID := "app:" + key.AppID
+	resultClaims := map[string]any{
+		"sub":         subjectID,
+		"type":        "app",
+		"tenant_id":   key.TenantID,
+		"app_id":      key.AppID,
+		"client_id":   key.KeyID,
+		"scopes":      scopes,
+		"auth_type":   "app_key",
+		"auth_method": "client_secret",
+	}
+	for name, value := range key.Claims {
+		if _, exists := resultClaims[name]; !exists {
+			resultClaims[name] = value
+		}
+	}
+
+	return &credential.AuthenticationResult{
+		Success: true,
+		Subject: subjectID,
+		Claims:  resultClaims,
+	}, nil
+}
+
+// Type returns the authenticator type
+func (a *Authenticator) Type() string {
+	return "app_key"
+}
+
+// ParseCredentials parses {"client_id", "client_secret", "scope"}
+// (space-separated scopes, as in the client credentials grant)
+func (a *Authenticator) ParseCredentials(payload []byte) (credential.Credentials, error) {
+	var body struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		Scope        string `json:"scope"`
+	}
+	if err := credential.DecodePayload(payload, &body); err != nil {
+		return nil, err
+	}
+	return &Credentials{KeyID: body.ClientID, Secret: body.ClientSecret, Scopes: strings.Fields(body.Scope)}, nil
+}
+
+// newKeyID generates a key ID ("ak_" and 24 hex characters)
+func newKeyID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	return KeyIDPrefix + hex.EncodeToString(buf), nil
+}
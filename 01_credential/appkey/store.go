@@ -0,0 +1,155 @@
+package appkey
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Key is an app key: the client credentials of an app of a tenant
+type Key struct {
+	// KeyID identifies the key (the client_id of the client credentials grant)
+	KeyID string
+
+	// TenantID and AppID are the tenant and app the key authenticates as
+	TenantID string
+	AppID    string
+
+	// Name describes the key (e.g., "billing sync")
+	Name string
+
+	// SecretHash is the hash of the secret; the secret itself is never stored
+	SecretHash string
+
+	// Scopes are the scopes the app may request (empty = any requested scope
+	// is granted)
+	Scopes []string
+
+	// Claims are added to the authentication result
+	Claims map[string]any
+
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // nil = never expires
+	LastUsedAt *time.Time
+	Revoked    bool
+}
+
+// KeyStore stores app keys
+type KeyStore interface {
+	// Store saves a key
+	Store(ctx context.Context, key *Key) error
+
+	// Get retrieves a key by ID
+	Get(ctx context.Context, keyID string) (*Key, error)
+
+	// ListByApp returns all keys of an app of a tenant
+	ListByApp(ctx context.Context, tenantID, appID string) ([]*Key, error)
+
+	// UpdateLastUsed records when a key was last used
+	UpdateLastUsed(ctx context.Context, keyID string, timestamp time.Time) error
+
+	// Revoke marks a key as revoked
+	Revoke(ctx context.Context, keyID string) error
+
+	// Delete removes a key
+	Delete(ctx context.Context, keyID string) error
+}
+
+// InMemoryKeyStore is an in-memory implementation of KeyStore
+type InMemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*Key // keyID -> key
+}
+
+// NewInMemoryKeyStore creates a new in-memory app key store
+func NewInMemoryKeyStore() *InMemoryKeyStore {
+	return &InMemoryKeyStore{
+		keys: make(map[string]*Key),
+	}
+}
+
+// Store saves a key
+func (s *InMemoryKeyStore) Store(ctx context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *key
+	s.keys[key.KeyID] = &copied
+	return nil
+}
+
+// Get retrieves a key by ID
+func (s *InMemoryKeyStore) Get(ctx context.Context, keyID string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	copied := *key
+	return &copied, nil
+}
+
+// ListByApp returns all keys of an app of a tenant (oldest first)
+func (s *InMemoryKeyStore) ListByApp(ctx context.Context, tenantID, appID string) ([]*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*Key, 0)
+	for _, key := range s.keys {
+		if key.TenantID == tenantID && key.AppID == appID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// UpdateLastUsed records when a key was last used
+func (s *InMemoryKeyStore) UpdateLastUsed(ctx context.Context, keyID string, timestamp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	key.LastUsedAt = &timestamp
+	return nil
+}
+
+// Revoke marks a key as revoked
+func (s *InMemoryKeyStore) Revoke(ctx context.Context, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	key.Revoked = true
+	return nil
+}
+
+// Delete removes a key
+func (s *InMemoryKeyStore) Delete(ctx context.Context, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[keyID]; !ok {
+		return ErrKeyNotFound
+	}
+
+	delete(s.keys, keyID)
+	return nil
+}
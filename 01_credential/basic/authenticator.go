@@ -7,12 +7,13 @@ import (
 	"maps"
 
 	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/autherrors"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrAuthenticationFailed = errors.New("authentication failed")
-	ErrUserNotFound         = errors.New("user not found")
+	ErrAuthenticationFailed = autherrors.New(autherrors.ErrInvalidCredentials, "authentication failed")
+	ErrUserNotFound         = autherrors.New(autherrors.ErrInvalidCredentials, "user not found")
 )
 
 // UserProvider defines the interface for retrieving user credentials
@@ -119,6 +120,18 @@ func (a *Authenticator) Type() string {
 	return "basic"
 }
 
+// ParseCredentials parses {"username", "password"}
+func (a *Authenticator) ParseCredentials(payload []byte) (credential.Credentials, error) {
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := credential.DecodePayload(payload, &body); err != nil {
+		return nil, err
+	}
+	return &BasicCredentials{Username: body.Username, Password: body.Password}, nil
+}
+
 // verifyPassword compares a hashed password with a plaintext password
 func (a *Authenticator) verifyPassword(hashedPassword, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
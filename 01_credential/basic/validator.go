@@ -2,23 +2,23 @@ package basic
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 	"unicode"
 
 	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/autherrors"
 )
 
 var (
-	ErrInvalidCredentials    = errors.New("invalid credentials")
-	ErrEmptyUsername         = errors.New("username cannot be empty")
-	ErrEmptyPassword         = errors.New("password cannot be empty")
-	ErrUsernameTooShort      = errors.New("username is too short")
-	ErrPasswordTooShort      = errors.New("password is too short")
-	ErrPasswordTooWeak       = errors.New("password does not meet complexity requirements")
-	ErrInvalidUsernameFormat = errors.New("username contains invalid characters")
+	ErrInvalidCredentials    = autherrors.New(autherrors.ErrInvalidCredentials, "invalid credentials")
+	ErrEmptyUsername         = autherrors.New(autherrors.ErrInvalidRequest, "username cannot be empty")
+	ErrEmptyPassword         = autherrors.New(autherrors.ErrInvalidRequest, "password cannot be empty")
+	ErrUsernameTooShort      = autherrors.New(autherrors.ErrInvalidRequest, "username is too short")
+	ErrPasswordTooShort      = autherrors.New(autherrors.ErrInvalidRequest, "password is too short")
+	ErrPasswordTooWeak       = autherrors.New(autherrors.ErrInvalidRequest, "password does not meet complexity requirements")
+	ErrInvalidUsernameFormat = autherrors.New(autherrors.ErrInvalidRequest, "username contains invalid characters")
 )
 
 // BasicCredentials represents username/password credentials
@@ -32,6 +32,11 @@ func (c *BasicCredentials) Type() string {
 	return "basic"
 }
 
+// Account returns the username
+func (c *BasicCredentials) Account() string {
+	return c.Username
+}
+
 // Validate checks if the credentials are well-formed
 func (c *BasicCredentials) Validate() error {
 	if strings.TrimSpace(c.Username) == "" {
@@ -13,6 +13,15 @@ type Credentials interface {
 	Validate() error
 }
 
+// AccountCredentials are credentials naming the account they log in to
+// (e.g., a username), so failed logins can be counted per account
+type AccountCredentials interface {
+	Credentials
+
+	// Account returns the account the credentials log in to
+	Account() string
+}
+
 // AuthenticationResult represents the result of an authentication attempt
 type AuthenticationResult struct {
 	// Success indicates whether authentication was successful
@@ -40,6 +49,15 @@ type Authenticator interface {
 	Type() string
 }
 
+// AuthenticatorResolver resolves authenticators at login time, e.g. from the
+// credential provider configuration of the tenant in the context. Resolvers
+// are consulted before the statically registered authenticators.
+type AuthenticatorResolver interface {
+	// ResolveAuthenticator returns the authenticator for a credential type,
+	// or nil when the resolver has none (the static authenticator is used)
+	ResolveAuthenticator(ctx context.Context, authType string) (Authenticator, error)
+}
+
 // CredentialValidator validates credentials format and basic rules
 type CredentialValidator interface {
 	// Validate checks if the credentials meet the required format and rules
@@ -0,0 +1,135 @@
+package failover
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/01_credential/basic"
+)
+
+// CacheKeyFunc extracts the cache key and secret of credentials.
+// It returns ok=false for credentials that cannot be cached.
+type CacheKeyFunc func(creds credential.Credentials) (key, secret string, ok bool)
+
+// BasicCacheKey caches basic credentials by username
+func BasicCacheKey(creds credential.Credentials) (string, string, bool) {
+	basicCreds, ok := creds.(*basic.BasicCredentials)
+	if !ok || basicCreds.Username == "" || basicCreds.Password == "" {
+		return "", "", false
+	}
+	return basicCreds.Username, basicCreds.Password, true
+}
+
+// CredentialCache remembers successful logins (bcrypt hash of the secret and
+// the authentication result) so users can still log in while every identity
+// provider of a chain is unavailable
+type CredentialCache struct {
+	ttl     time.Duration
+	keyFunc CacheKeyFunc
+	mu      sync.RWMutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	secretHash []byte
+	subject    string
+	claims     map[string]any
+	expiresAt  time.Time
+}
+
+// NewCredentialCache creates a credential cache. ttl bounds how long a
+// login can be served from the cache (default: 24h); keyFunc defaults to
+// BasicCacheKey.
+func NewCredentialCache(ttl time.Duration, keyFunc CacheKeyFunc) *CredentialCache {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	if keyFunc == nil {
+		keyFunc = BasicCacheKey
+	}
+
+	return &CredentialCache{
+		ttl:     ttl,
+		keyFunc: keyFunc,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Store remembers a successful authentication
+func (c *CredentialCache) Store(creds credential.Credentials, result *credential.AuthenticationResult) error {
+	if result == nil || !result.Success {
+		return nil
+	}
+
+	key, secret, ok := c.keyFunc(creds)
+	if !ok {
+		return nil
+	}
+
+	// Skip re-hashing when the cached secret is unchanged
+	c.mu.RLock()
+	entry := c.entries[key]
+	c.mu.RUnlock()
+
+	var secretHash []byte
+	if entry != nil && bcrypt.CompareHashAndPassword(entry.secretHash, []byte(secret)) == nil {
+		secretHash = entry.secretHash
+	} else {
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		secretHash = hash
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = &cacheEntry{
+		secretHash: secretHash,
+		subject:    result.Subject,
+		claims:     maps.Clone(result.Claims),
+		expiresAt:  time.Now().Add(c.ttl),
+	}
+
+	return nil
+}
+
+// Authenticate verifies credentials against the cache. Unknown or expired
+// entries and wrong secrets are rejected (Success=false).
+func (c *CredentialCache) Authenticate(ctx context.Context, creds credential.Credentials) (*credential.AuthenticationResult, error) {
+	key, secret, ok := c.keyFunc(creds)
+	if !ok {
+		return &credential.AuthenticationResult{Success: false, Error: ErrNotCached}, nil
+	}
+
+	c.mu.RLock()
+	entry := c.entries[key]
+	c.mu.RUnlock()
+
+	if entry == nil || time.Now().After(entry.expiresAt) {
+		return &credential.AuthenticationResult{Success: false, Error: ErrNotCached}, nil
+	}
+
+	if bcrypt.CompareHashAndPassword(entry.secretHash, []byte(secret)) != nil {
+		return &credential.AuthenticationResult{Success: false, Error: basic.ErrAuthenticationFailed}, nil
+	}
+
+	return &credential.AuthenticationResult{
+		Success: true,
+		Subject: entry.subject,
+		Claims:  maps.Clone(entry.claims),
+	}, nil
+}
+
+// Invalidate removes the cached login of a key (e.g., after a password change)
+func (c *CredentialCache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
@@ -0,0 +1,366 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrNoMembers           = errors.New("failover chain has no members")
+	ErrAllUnavailable      = autherrors.New(autherrors.ErrUnavailable, "all identity providers are unavailable")
+	ErrNotCached           = errors.New("credentials not in cache")
+	ErrChainAlreadyRunning = errors.New("failover health checks already running")
+)
+
+// HealthChecker is implemented by authenticators that can probe their
+// backend (e.g., an LDAP bind with a service account)
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Member is an authenticator in a failover chain
+type Member struct {
+	// Name identifies the member (e.g., "ldap-primary")
+	Name string
+
+	// Authenticator authenticates credentials
+	Authenticator credential.Authenticator
+
+	// HealthCheck probes the member's backend (optional, defaults to the
+	// authenticator's HealthCheck when it implements HealthChecker)
+	HealthCheck func(ctx context.Context) error
+}
+
+// Config holds failover chain configuration
+type Config struct {
+	// FailureThreshold is the number of consecutive failures after which a
+	// member is marked unhealthy (default: 3)
+	FailureThreshold int
+
+	// Cooldown is how long an unhealthy member is skipped before it is
+	// retried by a login (default: 30s)
+	Cooldown time.Duration
+
+	// HealthCheckInterval is how often Start probes unhealthy members to fail
+	// back before the cooldown ends (default: 10s)
+	HealthCheckInterval time.Duration
+
+	// Cache serves logins from cached credentials when every member is
+	// unavailable (optional)
+	Cache *CredentialCache
+
+	// IsUnavailable reports whether an Authenticate error means the member
+	// is unavailable (default: any error). Rejected credentials are never
+	// failed over: they are returned as a result with Success=false.
+	IsUnavailable func(err error) bool
+
+	// OnStateChange is called when a member becomes healthy or unhealthy (optional)
+	OnStateChange func(member string, healthy bool, cause error)
+}
+
+// DefaultConfig returns a default failover configuration
+func DefaultConfig() *Config {
+	return &Config{
+		FailureThreshold:    3,
+		Cooldown:            30 * time.Second,
+		HealthCheckInterval: 10 * time.Second,
+	}
+}
+
+// MemberStatus is the health of a chain member
+type MemberStatus struct {
+	Name                string
+	Healthy             bool
+	ConsecutiveFailures int
+	LastError           error
+	LastFailureAt       time.Time
+	LastSuccessAt       time.Time
+}
+
+// member is a chain member with its health state
+type member struct {
+	Member
+	status         MemberStatus
+	unhealthyUntil time.Time
+}
+
+// Chain is an authenticator that tries its members in order, skipping
+// unavailable ones (e.g., primary LDAP → secondary LDAP → cached credentials).
+// Unhealthy members are retried after a cooldown or when a background health
+// check succeeds, so the chain automatically fails back to the primary.
+type Chain struct {
+	authType string
+	config   *Config
+	members  []*member
+	mu       sync.Mutex
+	stop     chan struct{}
+}
+
+// NewChain creates a failover chain. Members are tried in order and must
+// share the same credential type.
+func NewChain(config *Config, members ...Member) (*Chain, error) {
+	if len(members) == 0 {
+		return nil, ErrNoMembers
+	}
+
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	defaults := DefaultConfig()
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaults.FailureThreshold
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = defaults.Cooldown
+	}
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = defaults.HealthCheckInterval
+	}
+	if config.IsUnavailable == nil {
+		config.IsUnavailable = func(err error) bool { return err != nil }
+	}
+
+	c := &Chain{
+		authType: members[0].Authenticator.Type(),
+		config:   config,
+	}
+
+	for i, m := range members {
+		if m.Authenticator.Type() != c.authType {
+			return nil, fmt.Errorf("member %q has type %q, expected %q", m.Name, m.Authenticator.Type(), c.authType)
+		}
+		if m.Name == "" {
+			m.Name = fmt.Sprintf("%s-%d", c.authType, i)
+		}
+		if m.HealthCheck == nil {
+			if checker, ok := m.Authenticator.(HealthChecker); ok {
+				m.HealthCheck = checker.HealthCheck
+			}
+		}
+		c.members = append(c.members, &member{
+			Member: m,
+			status: MemberStatus{Name: m.Name, Healthy: true},
+		})
+	}
+
+	return c, nil
+}
+
+// Authenticate tries the members in order and falls back to the credential
+// cache when all of them are unavailable
+func (c *Chain) Authenticate(ctx context.Context, creds credential.Credentials) (*credential.AuthenticationResult, error) {
+	candidates := c.candidates(time.Now())
+
+	var lastErr error
+	for _, m := range candidates {
+		result, err := m.Authenticator.Authenticate(ctx, creds)
+		if (err != nil || result == nil) && c.config.IsUnavailable(err) {
+			if err == nil {
+				err = fmt.Errorf("member %q returned no result", m.Name)
+			}
+			c.recordFailure(m, err)
+			lastErr = err
+			continue
+		}
+
+		c.recordSuccess(m)
+		if err != nil {
+			return result, err
+		}
+
+		if result.Success && c.config.Cache != nil {
+			_ = c.config.Cache.Store(creds, result)
+		}
+
+		return annotate(result, m.Name, false), nil
+	}
+
+	// Every member is unavailable: serve from cached credentials
+	if c.config.Cache != nil {
+		result, err := c.config.Cache.Authenticate(ctx, creds)
+		if err == nil && !errors.Is(result.Error, ErrNotCached) {
+			return annotate(result, "cache", true), nil
+		}
+	}
+
+	if lastErr == nil {
+		return nil, ErrAllUnavailable
+	}
+	return nil, fmt.Errorf("%w: %v", ErrAllUnavailable, lastErr)
+}
+
+// Type returns the credential type of the chain members
+func (c *Chain) Type() string {
+	return c.authType
+}
+
+// ParseCredentials parses credentials with the first member that is a
+// credential.CredentialParser
+func (c *Chain) ParseCredentials(payload []byte) (credential.Credentials, error) {
+	for _, m := range c.members {
+		if parser, ok := m.Authenticator.(credential.CredentialParser); ok {
+			return parser.ParseCredentials(payload)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", credential.ErrUnknownCredentialType, c.authType)
+}
+
+// Status returns the health of every member, in chain order
+func (c *Chain) Status() []MemberStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]MemberStatus, len(c.members))
+	for i, m := range c.members {
+		statuses[i] = m.status
+	}
+	return statuses
+}
+
+// Start probes unhealthy members in the background until ctx is cancelled
+// or Stop is called. Members without a health check are retried by logins
+// after the cooldown.
+func (c *Chain) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return ErrChainAlreadyRunning
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(c.config.HealthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.probe(ctx)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops background health checks
+func (c *Chain) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// probe runs the health checks of unhealthy members
+func (c *Chain) probe(ctx context.Context) {
+	c.mu.Lock()
+	var unhealthy []*member
+	for _, m := range c.members {
+		if !m.status.Healthy && m.HealthCheck != nil {
+			unhealthy = append(unhealthy, m)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, m := range unhealthy {
+		if err := m.HealthCheck(ctx); err != nil {
+			c.recordFailure(m, err)
+			continue
+		}
+		c.recordSuccess(m)
+	}
+}
+
+// candidates returns the members to try: healthy members and unhealthy
+// members past their cooldown, in chain order. When every member is cooling
+// down, all of them are tried rather than failing the login outright
+// (unless a credential cache can serve it).
+func (c *Chain) candidates(now time.Time) []*member {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	candidates := make([]*member, 0, len(c.members))
+	for _, m := range c.members {
+		if m.status.Healthy || now.After(m.unhealthyUntil) {
+			candidates = append(candidates, m)
+		}
+	}
+
+	if len(candidates) == 0 && c.config.Cache == nil {
+		candidates = append(candidates, c.members...)
+	}
+
+	return candidates
+}
+
+// recordFailure counts a failure and marks the member unhealthy at the threshold
+func (c *Chain) recordFailure(m *member, err error) {
+	c.mu.Lock()
+
+	now := time.Now()
+	m.status.ConsecutiveFailures++
+	m.status.LastError = err
+	m.status.LastFailureAt = now
+
+	becameUnhealthy := false
+	if m.status.ConsecutiveFailures >= c.config.FailureThreshold {
+		becameUnhealthy = m.status.Healthy
+		m.status.Healthy = false
+		m.unhealthyUntil = now.Add(c.config.Cooldown)
+	}
+	c.mu.Unlock()
+
+	if becameUnhealthy && c.config.OnStateChange != nil {
+		c.config.OnStateChange(m.Name, false, err)
+	}
+}
+
+// recordSuccess resets the failure count and marks the member healthy
+func (c *Chain) recordSuccess(m *member) {
+	c.mu.Lock()
+
+	recovered := !m.status.Healthy
+	m.status.Healthy = true
+	m.status.ConsecutiveFailures = 0
+	m.status.LastError = nil
+	m.status.LastSuccessAt = time.Now()
+	m.unhealthyUntil = time.Time{}
+	c.mu.Unlock()
+
+	if recovered && c.config.OnStateChange != nil {
+		c.config.OnStateChange(m.Name, true, nil)
+	}
+}
+
+// annotate records which member authenticated the credentials
+func annotate(result *credential.AuthenticationResult, memberName string, degraded bool) *credential.AuthenticationResult {
+	metadata := maps.Clone(result.Metadata)
+	if metadata == nil {
+		metadata = make(map[string]any)
+	}
+	metadata["authenticated_by"] = memberName
+	if degraded {
+		metadata["degraded"] = true
+	}
+
+	annotated := *result
+	annotated.Metadata = metadata
+	return &annotated
+}
@@ -7,16 +7,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"time"
 
 	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/autherrors"
 )
 
 var (
-	ErrInvalidToken    = errors.New("invalid OAuth2 token")
-	ErrTokenExpired    = errors.New("OAuth2 token expired")
-	ErrInvalidProvider = errors.New("invalid OAuth2 provider")
-	ErrUserInfoFailed  = errors.New("failed to fetch user info")
+	ErrInvalidToken    = autherrors.New(autherrors.ErrInvalidCredentials, "invalid OAuth2 token")
+	ErrTokenExpired    = autherrors.New(autherrors.ErrInvalidCredentials, "OAuth2 token expired")
+	ErrInvalidProvider = autherrors.New(autherrors.ErrInvalidRequest, "invalid OAuth2 provider")
+	ErrUserInfoFailed  = autherrors.New(autherrors.ErrUnavailable, "failed to fetch user info")
 )
 
 // Provider represents an OAuth2 provider (Google, GitHub, Facebook, etc.)
@@ -84,6 +86,10 @@ type Config struct {
 
 	// Custom provider configurations
 	CustomProviders map[Provider]*ProviderConfig
+
+	// Providers restricts the built-in providers that are accepted
+	// (empty: all built-in providers)
+	Providers []Provider
 }
 
 // DefaultConfig returns default OAuth2 configuration
@@ -115,6 +121,13 @@ func NewAuthenticator(config *Config) *Authenticator {
 
 	// Register built-in providers
 	auth.registerBuiltinProviders()
+	if len(config.Providers) > 0 {
+		for provider := range auth.providers {
+			if !slices.Contains(config.Providers, provider) {
+				delete(auth.providers, provider)
+			}
+		}
+	}
 
 	// Register custom providers
 	if config.CustomProviders != nil {
@@ -220,6 +233,19 @@ func (a *Authenticator) Type() string {
 	return "oauth2"
 }
 
+// ParseCredentials parses {"provider", "access_token", "id_token"}
+func (a *Authenticator) ParseCredentials(payload []byte) (credential.Credentials, error) {
+	var body struct {
+		Provider    Provider `json:"provider"`
+		AccessToken string   `json:"access_token"`
+		IDToken     string   `json:"id_token"`
+	}
+	if err := credential.DecodePayload(payload, &body); err != nil {
+		return nil, err
+	}
+	return &Credentials{Provider: body.Provider, AccessToken: body.AccessToken, IDToken: body.IDToken}, nil
+}
+
 // fetchGoogleUserInfo fetches user info from Google
 func (a *Authenticator) fetchGoogleUserInfo(ctx context.Context, token string) (*UserInfo, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
@@ -11,20 +11,21 @@ import (
 
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/primadi/lokstra-auth/autherrors"
 )
 
 var (
 	// ErrInvalidCredential indicates invalid passkey credential
-	ErrInvalidCredential = errors.New("invalid passkey credential")
+	ErrInvalidCredential = autherrors.New(autherrors.ErrInvalidCredentials, "invalid passkey credential")
 
 	// ErrCredentialNotFound indicates credential not found in store
-	ErrCredentialNotFound = errors.New("credential not found")
+	ErrCredentialNotFound = autherrors.New(autherrors.ErrInvalidCredentials, "credential not found")
 
 	// ErrRegistrationFailed indicates passkey registration failed
-	ErrRegistrationFailed = errors.New("passkey registration failed")
+	ErrRegistrationFailed = autherrors.New(autherrors.ErrInvalidRequest, "passkey registration failed")
 
 	// ErrAuthenticationFailed indicates passkey authentication failed
-	ErrAuthenticationFailed = errors.New("passkey authentication failed")
+	ErrAuthenticationFailed = autherrors.New(autherrors.ErrInvalidCredentials, "passkey authentication failed")
 )
 
 // Config holds configuration for Passkey authenticator
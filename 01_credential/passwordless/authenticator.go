@@ -3,6 +3,7 @@ package passwordless
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,14 +11,19 @@ import (
 	"time"
 
 	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/autherrors"
 )
 
 var (
-	ErrInvalidToken  = errors.New("invalid passwordless token")
-	ErrTokenExpired  = errors.New("passwordless token expired")
-	ErrTokenNotFound = errors.New("token not found")
-	ErrUserNotFound  = errors.New("user not found")
-	ErrInvalidEmail  = errors.New("invalid email address")
+	ErrInvalidToken  = autherrors.New(autherrors.ErrInvalidCredentials, "invalid passwordless token")
+	ErrTokenExpired  = autherrors.New(autherrors.ErrInvalidCredentials, "passwordless token expired")
+	ErrTokenNotFound = autherrors.New(autherrors.ErrInvalidCredentials, "token not found")
+	ErrTokenUsed     = autherrors.New(autherrors.ErrInvalidCredentials, "passwordless token already used")
+	ErrUserNotFound  = autherrors.New(autherrors.ErrInvalidCredentials, "user not found")
+	ErrInvalidEmail  = autherrors.New(autherrors.ErrInvalidRequest, "invalid email address")
+
+	ErrTokenInvalidated = autherrors.New(autherrors.ErrInvalidCredentials, "passwordless token invalidated after too many attempts")
+	ErrTooManyAttempts  = autherrors.New(autherrors.ErrRateLimited, "too many passwordless verification attempts")
 )
 
 // TokenType represents the type of passwordless token
@@ -58,9 +64,16 @@ type TokenData struct {
 	CreatedAt time.Time
 	ExpiresAt time.Time
 	Used      bool
+
+	// Attempts counts the failed verifications of the email of the token
+	// since it was issued
+	Attempts int
 }
 
-// TokenStore manages passwordless tokens
+// TokenStore manages passwordless tokens. InMemoryTokenStore is the only
+// implementation in this module (the SQLite and MongoDB repositories do not
+// store passwordless tokens); stores shared by several instances must make
+// MarkUsed and IncrementAttempts atomic, e.g., with conditional updates.
 type TokenStore interface {
 	// Store saves a token
 	Store(ctx context.Context, token *TokenData) error
@@ -68,7 +81,9 @@ type TokenStore interface {
 	// Get retrieves a token
 	Get(ctx context.Context, token string) (*TokenData, error)
 
-	// MarkUsed marks a token as used
+	// MarkUsed marks an unused token as used, atomically: a token is used
+	// once, even by concurrent calls (ErrTokenUsed for the others,
+	// ErrTokenNotFound if it was deleted)
 	MarkUsed(ctx context.Context, token string) error
 
 	// Delete removes a token
@@ -76,6 +91,26 @@ type TokenStore interface {
 
 	// Cleanup removes expired tokens
 	Cleanup(ctx context.Context) error
+
+	// FindByEmail returns the unused tokens of an email of a type ("" for
+	// any type), expired or not
+	FindByEmail(ctx context.Context, email string, tokenType TokenType) ([]*TokenData, error)
+
+	// IncrementAttempts increments the failed verification attempts of a
+	// token and returns them
+	IncrementAttempts(ctx context.Context, token string) (int, error)
+}
+
+// FailureCounter counts failed verifications by key (the client IP
+// address) over a sliding window. Token stores shared across instances
+// implement it so IP velocity limits hold across instances.
+type FailureCounter interface {
+	// RecordFailure records a failure of key and returns the failures of
+	// key within window
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+
+	// Failures returns the failures of key within window
+	Failures(ctx context.Context, key string, window time.Duration) (int, error)
 }
 
 // UserResolver resolves user information by email
@@ -111,6 +146,17 @@ type Authenticator struct {
 	otpExpiry     time.Duration
 	magicExpiry   time.Duration
 	allowedEmails map[string]bool // Optional: whitelist of allowed emails
+	tenant        func(ctx context.Context) string
+	channel       string
+
+	maxAttempts   int
+	maxIPFailures int
+	ipWindow      time.Duration
+	clientIP      func(ctx context.Context) string
+	ipFailures    FailureCounter
+
+	deliveryMu        sync.RWMutex
+	deliveryObservers []DeliveryObserver
 }
 
 // Config holds configuration for passwordless authenticator
@@ -128,6 +174,30 @@ type Config struct {
 
 	// AllowedEmails is an optional whitelist of allowed email addresses
 	AllowedEmails []string
+
+	// DeliveryObservers receive the delivery status of every magic link and
+	// OTP message (e.g., DeliveryMetrics)
+	DeliveryObservers []DeliveryObserver
+
+	// Tenant returns the tenant of a request for delivery events
+	// (e.g., authz.TenantFromContext)
+	Tenant func(ctx context.Context) string
+
+	// MaxAttempts is the number of wrong codes or links submitted for an
+	// email before its pending tokens are invalidated (default: 5)
+	MaxAttempts int
+
+	// MaxIPFailures limits the failed verifications from a client IP
+	// address within IPFailureWindow, across emails (0 disables; requires
+	// ClientIP)
+	MaxIPFailures int
+
+	// IPFailureWindow is the window of MaxIPFailures (default: 15 minutes)
+	IPFailureWindow time.Duration
+
+	// ClientIP returns the client IP address of a request
+	// (e.g., subject.ClientIPFromContext)
+	ClientIP func(ctx context.Context) string
 }
 
 // DefaultConfig returns default passwordless configuration
@@ -135,6 +205,7 @@ func DefaultConfig() *Config {
 	return &Config{
 		OTPExpiry:       5 * time.Minute,
 		MagicLinkExpiry: 15 * time.Minute,
+		MaxAttempts:     5,
 	}
 }
 
@@ -152,6 +223,14 @@ func NewAuthenticator(config *Config) *Authenticator {
 		config.MagicLinkExpiry = 15 * time.Minute
 	}
 
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+
+	if config.IPFailureWindow <= 0 {
+		config.IPFailureWindow = 15 * time.Minute
+	}
+
 	// Use in-memory store if not provided
 	if config.TokenStore == nil {
 		config.TokenStore = NewInMemoryTokenStore()
@@ -163,12 +242,33 @@ func NewAuthenticator(config *Config) *Authenticator {
 	}
 
 	auth := &Authenticator{
-		tokenStore:   config.TokenStore,
-		userResolver: config.UserResolver,
-		tokenGen:     config.TokenGenerator,
-		tokenSender:  config.TokenSender,
-		otpExpiry:    config.OTPExpiry,
-		magicExpiry:  config.MagicLinkExpiry,
+		tokenStore:    config.TokenStore,
+		userResolver:  config.UserResolver,
+		tokenGen:      config.TokenGenerator,
+		tokenSender:   config.TokenSender,
+		otpExpiry:     config.OTPExpiry,
+		magicExpiry:   config.MagicLinkExpiry,
+		tenant:        config.Tenant,
+		maxAttempts:   config.MaxAttempts,
+		maxIPFailures: config.MaxIPFailures,
+		ipWindow:      config.IPFailureWindow,
+		clientIP:      config.ClientIP,
+	}
+
+	// Count IP failures in the token store when it can, so the limits hold
+	// across instances sharing it
+	if counter, ok := config.TokenStore.(FailureCounter); ok {
+		auth.ipFailures = counter
+	} else {
+		auth.ipFailures = &failureCounter{}
+	}
+
+	auth.deliveryObservers = append(auth.deliveryObservers, config.DeliveryObservers...)
+	if sender, ok := config.TokenSender.(ChannelSender); ok {
+		auth.channel = sender.Channel()
+	}
+	if reporter, ok := config.TokenSender.(DeliveryReporter); ok {
+		reporter.SetDeliveryCallback(auth.ReportDelivery)
 	}
 
 	// Build allowed emails map
@@ -207,20 +307,44 @@ func (a *Authenticator) Authenticate(ctx context.Context, creds credential.Crede
 		}, nil
 	}
 
-	// Get token from store
-	tokenData, err := a.tokenStore.Get(ctx, pwdlessCreds.Token)
-	if err != nil {
-		return &credential.AuthenticationResult{
-			Success: false,
-			Error:   ErrTokenNotFound,
-		}, nil
+	// Refuse clients over the IP velocity limit before any token lookup
+	ip := ""
+	if a.clientIP != nil {
+		ip = a.clientIP(ctx)
+	}
+	if a.maxIPFailures > 0 && ip != "" {
+		failures, err := a.ipFailures.Failures(ctx, ip, a.ipWindow)
+		if err != nil {
+			return nil, err
+		}
+		if failures >= a.maxIPFailures {
+			return nil, ErrTooManyAttempts
+		}
 	}
 
-	// Verify token matches email
-	if tokenData.Email != pwdlessCreds.Email {
+	// Find the token among the pending tokens of the email, comparing in
+	// constant time
+	pending, err := a.tokenStore.FindByEmail(ctx, pwdlessCreds.Email, pwdlessCreds.TokenType)
+	if err != nil {
+		return nil, err
+	}
+	var tokenData *TokenData
+	for _, candidate := range pending {
+		if subtle.ConstantTimeCompare([]byte(candidate.Token), []byte(pwdlessCreds.Token)) == 1 {
+			tokenData = candidate
+		}
+	}
+	if tokenData == nil {
+		err := a.verificationFailed(ctx, ip, pending)
+		if err != nil && !errors.Is(err, ErrTokenInvalidated) {
+			return nil, err
+		}
+		if err == nil {
+			err = ErrInvalidToken
+		}
 		return &credential.AuthenticationResult{
 			Success: false,
-			Error:   ErrInvalidToken,
+			Error:   err,
 		}, nil
 	}
 
@@ -232,16 +356,15 @@ func (a *Authenticator) Authenticate(ctx context.Context, creds credential.Crede
 		}, nil
 	}
 
-	// Check if token was already used
-	if tokenData.Used {
-		return &credential.AuthenticationResult{
-			Success: false,
-			Error:   errors.New("token already used"),
-		}, nil
-	}
-
-	// Mark token as used
+	// Mark token as used; a concurrent verification that used or
+	// invalidated it first wins
 	if err := a.tokenStore.MarkUsed(ctx, pwdlessCreds.Token); err != nil {
+		if errors.Is(err, ErrTokenUsed) || errors.Is(err, ErrTokenNotFound) {
+			return &credential.AuthenticationResult{
+				Success: false,
+				Error:   ErrInvalidToken,
+			}, nil
+		}
 		return nil, err
 	}
 
@@ -282,11 +405,62 @@ func (a *Authenticator) Authenticate(ctx context.Context, creds credential.Crede
 	}, nil
 }
 
+// verificationFailed counts a wrong token submitted for an email against
+// the unexpired pending tokens of the email, invalidating those reaching
+// the maximum attempts (it then returns ErrTokenInvalidated), and against
+// the client IP address
+func (a *Authenticator) verificationFailed(ctx context.Context, ip string, pending []*TokenData) error {
+	if a.maxIPFailures > 0 && ip != "" {
+		if _, err := a.ipFailures.RecordFailure(ctx, ip, a.ipWindow); err != nil {
+			return err
+		}
+	}
+
+	invalidated := false
+	now := time.Now()
+	for _, tokenData := range pending {
+		if now.After(tokenData.ExpiresAt) {
+			continue
+		}
+		attempts, err := a.tokenStore.IncrementAttempts(ctx, tokenData.Token)
+		if err != nil {
+			return err
+		}
+		if attempts >= a.maxAttempts {
+			if err := a.tokenStore.Delete(ctx, tokenData.Token); err != nil {
+				return err
+			}
+			invalidated = true
+		}
+	}
+	if invalidated {
+		return ErrTokenInvalidated
+	}
+	return nil
+}
+
 // Type returns the authenticator type
 func (a *Authenticator) Type() string {
 	return "passwordless"
 }
 
+// ParseCredentials parses {"email", "token", "token_type"} (token_type
+// defaults to "otp")
+func (a *Authenticator) ParseCredentials(payload []byte) (credential.Credentials, error) {
+	var body struct {
+		Email     string    `json:"email"`
+		Token     string    `json:"token"`
+		TokenType TokenType `json:"token_type"`
+	}
+	if err := credential.DecodePayload(payload, &body); err != nil {
+		return nil, err
+	}
+	if body.TokenType == "" {
+		body.TokenType = TokenTypeOTP
+	}
+	return &Credentials{Email: body.Email, Token: body.Token, TokenType: body.TokenType}, nil
+}
+
 // InitiateMagicLink creates and sends a magic link token
 func (a *Authenticator) InitiateMagicLink(ctx context.Context, email, userID, baseURL string) error {
 	// Generate token
@@ -313,7 +487,9 @@ func (a *Authenticator) InitiateMagicLink(ctx context.Context, email, userID, ba
 	// Send email
 	if a.tokenSender != nil {
 		link := fmt.Sprintf("%s/auth/verify?token=%s&email=%s", baseURL, token, email)
-		return a.tokenSender.SendMagicLink(ctx, email, token, link)
+		err := a.tokenSender.SendMagicLink(ctx, email, token, link)
+		a.reportSend(ctx, TokenTypeMagicLink, email, err)
+		return err
 	}
 
 	return nil
@@ -327,6 +503,18 @@ func (a *Authenticator) InitiateOTP(ctx context.Context, email, userID string) e
 		return err
 	}
 
+	// Invalidate the pending codes of the email: only the latest code can
+	// be guessed
+	pending, err := a.tokenStore.FindByEmail(ctx, email, TokenTypeOTP)
+	if err != nil {
+		return err
+	}
+	for _, tokenData := range pending {
+		if err := a.tokenStore.Delete(ctx, tokenData.Token); err != nil {
+			return err
+		}
+	}
+
 	// Store token
 	tokenData := &TokenData{
 		Token:     code,
@@ -344,16 +532,21 @@ func (a *Authenticator) InitiateOTP(ctx context.Context, email, userID string) e
 
 	// Send OTP
 	if a.tokenSender != nil {
-		return a.tokenSender.SendOTP(ctx, email, code)
+		err := a.tokenSender.SendOTP(ctx, email, code)
+		a.reportSend(ctx, TokenTypeOTP, email, err)
+		return err
 	}
 
 	return nil
 }
 
-// InMemoryTokenStore is an in-memory implementation of TokenStore
+// InMemoryTokenStore is an in-memory implementation of TokenStore and
+// FailureCounter
 type InMemoryTokenStore struct {
 	mu     sync.RWMutex
 	tokens map[string]*TokenData
+
+	failureCounter
 }
 
 // NewInMemoryTokenStore creates a new in-memory token store
@@ -390,6 +583,9 @@ func (s *InMemoryTokenStore) MarkUsed(ctx context.Context, token string) error {
 	if !ok {
 		return ErrTokenNotFound
 	}
+	if data.Used {
+		return ErrTokenUsed
+	}
 
 	data.Used = true
 	return nil
@@ -402,6 +598,34 @@ func (s *InMemoryTokenStore) Delete(ctx context.Context, token string) error {
 	return nil
 }
 
+func (s *InMemoryTokenStore) FindByEmail(ctx context.Context, email string, tokenType TokenType) ([]*TokenData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tokens []*TokenData
+	for _, data := range s.tokens {
+		if data.Email != email || data.Used || tokenType != "" && data.Type != tokenType {
+			continue
+		}
+		copied := *data
+		tokens = append(tokens, &copied)
+	}
+	return tokens, nil
+}
+
+func (s *InMemoryTokenStore) IncrementAttempts(ctx context.Context, token string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.tokens[token]
+	if !ok {
+		return 0, ErrTokenNotFound
+	}
+
+	data.Attempts++
+	return data.Attempts, nil
+}
+
 func (s *InMemoryTokenStore) Cleanup(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -416,6 +640,50 @@ func (s *InMemoryTokenStore) Cleanup(ctx context.Context) error {
 	return nil
 }
 
+// failureCounter is an in-memory FailureCounter
+type failureCounter struct {
+	failuresMu sync.Mutex
+	failures   map[string][]time.Time // key -> failure times, oldest first
+}
+
+// RecordFailure records a failure of key and returns the failures of key
+// within window
+func (c *failureCounter) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	c.failuresMu.Lock()
+	defer c.failuresMu.Unlock()
+
+	if c.failures == nil {
+		c.failures = make(map[string][]time.Time)
+	}
+	now := time.Now()
+	c.failures[key] = append(c.prune(key, now.Add(-window)), now)
+	return len(c.failures[key]), nil
+}
+
+// Failures returns the failures of key within window
+func (c *failureCounter) Failures(ctx context.Context, key string, window time.Duration) (int, error) {
+	c.failuresMu.Lock()
+	defer c.failuresMu.Unlock()
+
+	return len(c.prune(key, time.Now().Add(-window))), nil
+}
+
+// prune drops the failures of key before since
+func (c *failureCounter) prune(key string, since time.Time) []time.Time {
+	failures := c.failures[key]
+	i := 0
+	for i < len(failures) && failures[i].Before(since) {
+		i++
+	}
+	failures = failures[i:]
+	if len(failures) == 0 {
+		delete(c.failures, key)
+	} else {
+		c.failures[key] = failures
+	}
+	return failures
+}
+
 // DefaultTokenGenerator implements TokenGenerator
 type DefaultTokenGenerator struct{}
 
@@ -0,0 +1,324 @@
+package passwordless
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeliveryStatus is the delivery state of a magic link or OTP message
+type DeliveryStatus string
+
+const (
+	// DeliverySent: the sender accepted the message
+	DeliverySent DeliveryStatus = "sent"
+
+	// DeliveryFailed: the sender returned an error
+	DeliveryFailed DeliveryStatus = "failed"
+
+	// DeliveryDelivered: the provider confirmed delivery (e.g., webhook)
+	DeliveryDelivered DeliveryStatus = "delivered"
+
+	// DeliveryBounced: the provider reported the message undeliverable
+	DeliveryBounced DeliveryStatus = "bounced"
+)
+
+// DeliveryEvent reports the delivery status of a magic link or OTP message
+type DeliveryEvent struct {
+	// TenantID is the tenant of the login (see Config.Tenant)
+	TenantID string
+
+	// TokenType is magic_link or otp
+	TokenType TokenType
+
+	// Channel is the delivery channel, e.g., "email", "sms" (optional)
+	Channel string
+
+	// Recipient is the email address or phone number
+	Recipient string
+
+	// MessageID is the provider message ID (optional), used to correlate
+	// delivered/bounced callbacks
+	MessageID string
+
+	// Status is the delivery status
+	Status DeliveryStatus
+
+	// Error is the send error or bounce reason (failed and bounced only)
+	Error error
+
+	// Timestamp is when the status was reported
+	Timestamp time.Time
+}
+
+// DeliveryObserver receives delivery events (e.g., to export metrics)
+type DeliveryObserver interface {
+	// OnDelivery is called for every delivery event.
+	// Observers must not modify the event.
+	OnDelivery(ctx context.Context, event *DeliveryEvent)
+}
+
+// DeliveryObserverFunc adapts a function to a DeliveryObserver
+type DeliveryObserverFunc func(ctx context.Context, event *DeliveryEvent)
+
+// OnDelivery calls f(ctx, event)
+func (f DeliveryObserverFunc) OnDelivery(ctx context.Context, event *DeliveryEvent) {
+	f(ctx, event)
+}
+
+// DeliveryCallback reports a delivery status to the authenticator
+type DeliveryCallback func(ctx context.Context, event *DeliveryEvent)
+
+// DeliveryReporter is implemented by TokenSenders that learn the final
+// delivery status later (e.g., from provider webhooks). The authenticator
+// registers its callback when it is created; the sender calls it with
+// delivered and bounced events.
+type DeliveryReporter interface {
+	SetDeliveryCallback(callback DeliveryCallback)
+}
+
+// ChannelSender is implemented by TokenSenders that report their delivery
+// channel (e.g., "email", "sms")
+type ChannelSender interface {
+	Channel() string
+}
+
+// OnDelivery adds a delivery observer
+func (a *Authenticator) OnDelivery(observer DeliveryObserver) {
+	a.deliveryMu.Lock()
+	defer a.deliveryMu.Unlock()
+	a.deliveryObservers = append(a.deliveryObservers, observer)
+}
+
+// ReportDelivery reports a delivery status, e.g., from a provider webhook
+// handler. The tenant is taken from ctx when the event has none.
+func (a *Authenticator) ReportDelivery(ctx context.Context, event *DeliveryEvent) {
+	if event.TenantID == "" && a.tenant != nil {
+		event.TenantID = a.tenant(ctx)
+	}
+	if event.Channel == "" {
+		event.Channel = a.channel
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	a.deliveryMu.RLock()
+	observers := append([]DeliveryObserver{}, a.deliveryObservers...)
+	a.deliveryMu.RUnlock()
+
+	for _, observer := range observers {
+		func() {
+			defer func() { _ = recover() }()
+			observer.OnDelivery(ctx, event)
+		}()
+	}
+}
+
+// reportSend reports the result of a TokenSender call
+func (a *Authenticator) reportSend(ctx context.Context, tokenType TokenType, recipient string, err error) {
+	event := &DeliveryEvent{
+		TokenType: tokenType,
+		Recipient: recipient,
+		Status:    DeliverySent,
+	}
+	if err != nil {
+		event.Status = DeliveryFailed
+		event.Error = err
+	}
+	a.ReportDelivery(ctx, event)
+}
+
+// DeliveryStats are the delivery counters of a tenant
+type DeliveryStats struct {
+	TenantID  string
+	Sent      int64
+	Failed    int64
+	Delivered int64
+	Bounced   int64
+}
+
+// Attempted is the number of send attempts
+func (s DeliveryStats) Attempted() int64 {
+	return s.Sent + s.Failed
+}
+
+// SuccessRate is the share of attempts that were neither failed nor bounced
+// (1 when there were no attempts)
+func (s DeliveryStats) SuccessRate() float64 {
+	attempted := s.Attempted()
+	if attempted == 0 {
+		return 1
+	}
+	succeeded := max(s.Sent-s.Bounced, 0)
+	return float64(succeeded) / float64(attempted)
+}
+
+// DeliveryMetricsConfig holds delivery metrics configuration
+type DeliveryMetricsConfig struct {
+	// Window is the period stats are computed over (default: 15 minutes)
+	Window time.Duration
+
+	// Threshold is the success rate below which a tenant is unhealthy
+	// (default: 0.8)
+	Threshold float64
+
+	// MinAttempts is the number of attempts in the window before a tenant
+	// can be reported unhealthy (default: 10)
+	MinAttempts int64
+
+	// OnUnhealthy is called when the success rate of a tenant drops below
+	// the threshold, once until it recovers (optional)
+	OnUnhealthy func(ctx context.Context, stats DeliveryStats)
+}
+
+// DeliveryMetrics is a DeliveryObserver computing per-tenant success rates
+// over a sliding window, so broken email or SMS configuration shows up
+// within minutes
+type DeliveryMetrics struct {
+	config *DeliveryMetricsConfig
+
+	mu        sync.Mutex
+	buckets   map[string][]deliveryBucket // tenant -> per-minute counters, oldest first
+	unhealthy map[string]bool
+}
+
+type deliveryBucket struct {
+	start time.Time
+	stats DeliveryStats
+}
+
+// bucketSize is the resolution of the sliding window
+const bucketSize = time.Minute
+
+// NewDeliveryMetrics creates new delivery metrics
+func NewDeliveryMetrics(config *DeliveryMetricsConfig) *DeliveryMetrics {
+	if config == nil {
+		config = &DeliveryMetricsConfig{}
+	}
+	if config.Window <= 0 {
+		config.Window = 15 * time.Minute
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 0.8
+	}
+	if config.MinAttempts <= 0 {
+		config.MinAttempts = 10
+	}
+
+	return &DeliveryMetrics{
+		config:    config,
+		buckets:   make(map[string][]deliveryBucket),
+		unhealthy: make(map[string]bool),
+	}
+}
+
+// OnDelivery counts a delivery event
+func (m *DeliveryMetrics) OnDelivery(ctx context.Context, event *DeliveryEvent) {
+	m.mu.Lock()
+
+	start := event.Timestamp.Truncate(bucketSize)
+	buckets := m.prune(event.TenantID, event.Timestamp)
+	if len(buckets) == 0 || buckets[len(buckets)-1].start.Before(start) {
+		buckets = append(buckets, deliveryBucket{start: start})
+	}
+	stats := &buckets[len(buckets)-1].stats
+
+	switch event.Status {
+	case DeliverySent:
+		stats.Sent++
+	case DeliveryFailed:
+		stats.Failed++
+	case DeliveryDelivered:
+		stats.Delivered++
+	case DeliveryBounced:
+		stats.Bounced++
+	}
+	m.buckets[event.TenantID] = buckets
+
+	current := m.sum(event.TenantID, buckets)
+	notify := false
+	if current.Attempted() >= m.config.MinAttempts {
+		below := current.SuccessRate() < m.config.Threshold
+		notify = below && !m.unhealthy[event.TenantID]
+		m.unhealthy[event.TenantID] = below
+	}
+	m.mu.Unlock()
+
+	if notify && m.config.OnUnhealthy != nil {
+		m.config.OnUnhealthy(ctx, current)
+	}
+}
+
+// Stats returns the stats of a tenant over the window
+func (m *DeliveryMetrics) Stats(tenantID string) DeliveryStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sum(tenantID, m.prune(tenantID, time.Now()))
+}
+
+// All returns the stats of every tenant with events in the window,
+// ordered by tenant ID
+func (m *DeliveryMetrics) All() []DeliveryStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	all := make([]DeliveryStats, 0, len(m.buckets))
+	for tenantID := range m.buckets {
+		if buckets := m.prune(tenantID, now); len(buckets) > 0 {
+			all = append(all, m.sum(tenantID, buckets))
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].TenantID < all[j].TenantID
+	})
+	return all
+}
+
+// Unhealthy returns the stats of tenants whose success rate is below the
+// threshold
+func (m *DeliveryMetrics) Unhealthy() []DeliveryStats {
+	unhealthy := make([]DeliveryStats, 0)
+	for _, stats := range m.All() {
+		if stats.Attempted() >= m.config.MinAttempts && stats.SuccessRate() < m.config.Threshold {
+			unhealthy = append(unhealthy, stats)
+		}
+	}
+	return unhealthy
+}
+
+// prune drops the buckets of a tenant that left the window (must hold mu)
+func (m *DeliveryMetrics) prune(tenantID string, now time.Time) []deliveryBucket {
+	buckets := m.buckets[tenantID]
+	cutoff := now.Add(-m.config.Window)
+
+	i := 0
+	for i < len(buckets) && !buckets[i].start.Add(bucketSize).After(cutoff) {
+		i++
+	}
+	if i == len(buckets) {
+		delete(m.buckets, tenantID)
+		delete(m.unhealthy, tenantID)
+		return nil
+	}
+
+	buckets = buckets[i:]
+	m.buckets[tenantID] = buckets
+	return buckets
+}
+
+// sum adds up the buckets of a tenant
+func (m *DeliveryMetrics) sum(tenantID string, buckets []deliveryBucket) DeliveryStats {
+	total := DeliveryStats{TenantID: tenantID}
+	for _, bucket := range buckets {
+		total.Sent += bucket.stats.Sent
+		total.Failed += bucket.stats.Failed
+		total.Delivered += bucket.stats.Delivered
+		total.Bounced += bucket.stats.Bounced
+	}
+	return total
+}
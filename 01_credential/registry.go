@@ -0,0 +1,114 @@
+package credential
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrUnknownCredentialType = autherrors.New(autherrors.ErrInvalidRequest, "unknown credential type")
+	ErrInvalidPayload        = autherrors.New(autherrors.ErrInvalidRequest, "invalid credential payload")
+)
+
+// CredentialParser parses credentials from a JSON payload. Authenticators
+// implement it so a generic login endpoint can accept their credentials,
+// e.g. {"type": "basic", "username": "alice", "password": "..."}.
+type CredentialParser interface {
+	// ParseCredentials parses the credentials of a JSON object. Members the
+	// parser does not know (including "type") are ignored.
+	ParseCredentials(payload []byte) (Credentials, error)
+}
+
+// ParserFunc adapts a function to CredentialParser
+type ParserFunc func(payload []byte) (Credentials, error)
+
+// ParseCredentials calls f
+func (f ParserFunc) ParseCredentials(payload []byte) (Credentials, error) {
+	return f(payload)
+}
+
+// DecodePayload decodes a JSON payload into v, for CredentialParser
+// implementations
+func DecodePayload(payload []byte, v any) error {
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return nil
+}
+
+// PayloadType returns the "type" discriminator of a JSON payload ("" when
+// absent)
+func PayloadType(payload []byte) (string, error) {
+	var discriminator struct {
+		Type string `json:"type"`
+	}
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return "", fmt.Errorf("%w: empty", ErrInvalidPayload)
+	}
+	if err := DecodePayload(payload, &discriminator); err != nil {
+		return "", err
+	}
+	return discriminator.Type, nil
+}
+
+// Registry maps credential types to parsers. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	parsers map[string]CredentialParser
+}
+
+// NewRegistry creates an empty parser registry
+func NewRegistry() *Registry {
+	return &Registry{parsers: make(map[string]CredentialParser)}
+}
+
+// Register sets the parser of a credential type
+func (r *Registry) Register(credType string, parser CredentialParser) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parsers[credType] = parser
+}
+
+// Parser returns the parser of a credential type
+func (r *Registry) Parser(credType string) (CredentialParser, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	parser, ok := r.parsers[credType]
+	return parser, ok
+}
+
+// Types returns the registered credential types, sorted
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.parsers))
+	for credType := range r.parsers {
+		types = append(types, credType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Parse parses a payload with the parser selected by its "type"
+// discriminator (defaultType when absent)
+func (r *Registry) Parse(payload []byte, defaultType string) (Credentials, error) {
+	credType, err := PayloadType(payload)
+	if err != nil {
+		return nil, err
+	}
+	if credType == "" {
+		credType = defaultType
+	}
+
+	parser, ok := r.Parser(credType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCredentialType, credType)
+	}
+	return parser.ParseCredentials(payload)
+}
@@ -0,0 +1,157 @@
+package serviceaccount
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrAccountNotFound  = autherrors.New(autherrors.ErrNotFound, "service account not found")
+	ErrAccountExists    = autherrors.New(autherrors.ErrConflict, "service account already exists")
+	ErrAccountDisabled  = autherrors.New(autherrors.ErrInvalidCredentials, "service account is disabled")
+	ErrNoAccountStore   = autherrors.New(autherrors.ErrNotImplemented, "no service account store configured")
+	ErrMissingAccountID = autherrors.New(autherrors.ErrInvalidRequest, "service account client ID is required")
+)
+
+// Account is a service account: a non-human subject (subject type
+// "service") authenticating with its own keys or secrets, rather than a
+// user with a static role map
+type Account struct {
+	// ClientID identifies the service account (generated if empty)
+	ClientID string
+
+	// TenantID is the tenant the service account belongs to (optional);
+	// its tokens are scoped to the tenant
+	TenantID string
+
+	// Name is a display name (e.g., "report exporter")
+	Name string
+
+	// Description describes what the service account is used for
+	Description string
+
+	// Scopes are the scopes keys of the service account may be granted
+	// (empty = keys are not restricted by the account)
+	Scopes []string
+
+	// Claims are added to the authentication result of every key
+	Claims map[string]any
+
+	// Disabled service accounts do not authenticate
+	Disabled bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// AccountStore stores service accounts
+type AccountStore interface {
+	// Create saves a new service account (ErrAccountExists if the client ID
+	// is taken)
+	Create(ctx context.Context, account *Account) error
+
+	// Get retrieves a service account
+	Get(ctx context.Context, clientID string) (*Account, error)
+
+	// ListByTenant returns the service accounts of a tenant (empty tenantID:
+	// the service accounts of no tenant)
+	ListByTenant(ctx context.Context, tenantID string) ([]*Account, error)
+
+	// Update replaces a service account
+	Update(ctx context.Context, account *Account) error
+
+	// Delete removes a service account
+	Delete(ctx context.Context, clientID string) error
+}
+
+// InMemoryAccountStore is an in-memory implementation of AccountStore
+type InMemoryAccountStore struct {
+	mu       sync.RWMutex
+	accounts map[string]*Account // clientID -> account
+}
+
+// NewInMemoryAccountStore creates a new in-memory service account store
+func NewInMemoryAccountStore() *InMemoryAccountStore {
+	return &InMemoryAccountStore{
+		accounts: make(map[string]*Account),
+	}
+}
+
+// Create saves a new service account
+func (s *InMemoryAccountStore) Create(ctx context.Context, account *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[account.ClientID]; ok {
+		return ErrAccountExists
+	}
+
+	copied := *account
+	s.accounts[account.ClientID] = &copied
+	return nil
+}
+
+// Get retrieves a service account
+func (s *InMemoryAccountStore) Get(ctx context.Context, clientID string) (*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, ok := s.accounts[clientID]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	copied := *account
+	return &copied, nil
+}
+
+// ListByTenant returns the service accounts of a tenant (oldest first)
+func (s *InMemoryAccountStore) ListByTenant(ctx context.Context, tenantID string) ([]*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accounts := make([]*Account, 0)
+	for _, account := range s.accounts {
+		if account.TenantID == tenantID {
+			copied := *account
+			accounts = append(accounts, &copied)
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+	})
+
+	return accounts, nil
+}
+
+// Update replaces a service account
+func (s *InMemoryAccountStore) Update(ctx context.Context, account *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[account.ClientID]; !ok {
+		return ErrAccountNotFound
+	}
+
+	copied := *account
+	s.accounts[account.ClientID] = &copied
+	return nil
+}
+
+// Delete removes a service account
+func (s *InMemoryAccountStore) Delete(ctx context.Context, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[clientID]; !ok {
+		return ErrAccountNotFound
+	}
+
+	delete(s.accounts, clientID)
+	return nil
+}
@@ -0,0 +1,575 @@
+package serviceaccount
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrInvalidAssertion = autherrors.New(autherrors.ErrInvalidCredentials, "invalid client assertion")
+	ErrAssertionReplay  = autherrors.New(autherrors.ErrInvalidCredentials, "client assertion has already been used")
+	ErrKeyNotFound      = autherrors.New(autherrors.ErrInvalidCredentials, "service account key not found")
+	ErrKeyRevoked       = autherrors.New(autherrors.ErrInvalidCredentials, "service account key revoked")
+	ErrKeyExpired       = autherrors.New(autherrors.ErrInvalidCredentials, "service account key expired")
+	ErrInvalidSecret    = autherrors.New(autherrors.ErrInvalidCredentials, "invalid service account secret")
+	ErrScopeNotAllowed  = autherrors.New(autherrors.ErrInsufficientScope, "requested scope is not allowed")
+)
+
+// Credentials are the client credentials of a service account: a
+// private_key_jwt client assertion, or a client ID and secret
+type Credentials struct {
+	// ClientID of the service account (required with Secret; optional with
+	// Assertion, where it must match the assertion issuer)
+	ClientID string
+
+	// Assertion is the signed client assertion JWT
+	Assertion string
+
+	// Secret is a client secret issued with IssueSecret (instead of Assertion)
+	Secret string
+
+	// Scopes are the requested scopes (optional)
+	Scopes []string
+}
+
+func (c *Credentials) Type() string {
+	return "service_account"
+}
+
+func (c *Credentials) Validate() error {
+	if c.Assertion != "" {
+		return nil
+	}
+	if c.Secret == "" {
+		return errors.New("client assertion or secret is required")
+	}
+	if c.ClientID == "" {
+		return errors.New("client ID is required")
+	}
+	return nil
+}
+
+// Account returns the client ID, so failed logins are counted per service
+// account
+func (c *Credentials) Account() string {
+	return c.ClientID
+}
+
+// Config holds configuration for the service account authenticator
+type Config struct {
+	// KeyStore stores service account keys (default: in-memory)
+	KeyStore KeyStore
+
+	// Accounts stores service accounts (optional). When set, keys can only
+	// be registered for existing accounts, and keys of missing or disabled
+	// accounts do not authenticate.
+	Accounts AccountStore
+
+	// Audience lists the accepted assertion audiences, normally the token
+	// endpoint URL (required: assertions for other audiences are rejected)
+	Audience []string
+
+	// MaxAssertionLifetime bounds exp - iat of assertions (default: 5 minutes)
+	MaxAssertionLifetime time.Duration
+
+	// ClockSkew is the tolerated clock difference (default: 30s)
+	ClockSkew time.Duration
+}
+
+// Authenticator authenticates service accounts with private_key_jwt client
+// assertions (RFC 7523) signed by the key of a service account key file, or
+// with client secrets. Service accounts authenticate as subjects of type
+// "service" (subject.SubjectTypeService).
+type Authenticator struct {
+	config   *Config
+	keyStore KeyStore
+	accounts AccountStore
+	hasher   *apikey.KeyHasher
+
+	mu       sync.Mutex
+	usedJTIs map[string]time.Time // assertion ID -> expiry
+}
+
+// NewAuthenticator creates a new service account authenticator
+func NewAuthenticator(config *Config) *Authenticator {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.KeyStore == nil {
+		config.KeyStore = NewInMemoryKeyStore()
+	}
+	if config.MaxAssertionLifetime <= 0 {
+		config.MaxAssertionLifetime = 5 * time.Minute
+	}
+	if config.ClockSkew <= 0 {
+		config.ClockSkew = 30 * time.Second
+	}
+
+	return &Authenticator{
+		config:   config,
+		keyStore: config.KeyStore,
+		accounts: config.Accounts,
+		hasher:   apikey.NewKeyHasher(),
+		usedJTIs: make(map[string]time.Time),
+	}
+}
+
+// KeyStore returns the key store of the authenticator
+func (a *Authenticator) KeyStore() KeyStore {
+	return a.keyStore
+}
+
+// Accounts returns the service account store of the authenticator (nil if
+// not configured)
+func (a *Authenticator) Accounts() AccountStore {
+	return a.accounts
+}
+
+// CreateAccount creates a service account, generating its client ID if
+// empty ("sa_" and 24 hex characters)
+func (a *Authenticator) CreateAccount(ctx context.Context, account *Account) (*Account, error) {
+	if a.accounts == nil {
+		return nil, ErrNoAccountStore
+	}
+
+	created := *account
+	if created.ClientID == "" {
+		clientID, err := newClientID()
+		if err != nil {
+			return nil, err
+		}
+		created.ClientID = clientID
+	}
+	created.CreatedAt = time.Now()
+	created.UpdatedAt = created.CreatedAt
+
+	if err := a.accounts.Create(ctx, &created); err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+	return &created, nil
+}
+
+// SetAccountDisabled disables a service account, or enables it again. Keys
+// of a disabled account do not authenticate; tokens already issued expire
+// normally.
+func (a *Authenticator) SetAccountDisabled(ctx context.Context, clientID string, disabled bool) error {
+	if a.accounts == nil {
+		return ErrNoAccountStore
+	}
+
+	account, err := a.accounts.Get(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	account.Disabled = disabled
+	account.UpdatedAt = time.Now()
+	return a.accounts.Update(ctx, account)
+}
+
+// DeleteAccount deletes a service account and its keys
+func (a *Authenticator) DeleteAccount(ctx context.Context, clientID string) error {
+	if a.accounts == nil {
+		return ErrNoAccountStore
+	}
+
+	keys, err := a.keyStore.ListByClient(ctx, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to list service account keys: %w", err)
+	}
+	for _, key := range keys {
+		if err := a.keyStore.Delete(ctx, clientID, key.KeyID); err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return fmt.Errorf("failed to delete service account key: %w", err)
+		}
+	}
+	return a.accounts.Delete(ctx, clientID)
+}
+
+// checkAccount returns the account of a client ID, which must exist and be
+// enabled (nil without an account store)
+func (a *Authenticator) checkAccount(ctx context.Context, clientID string) (*Account, error) {
+	if a.accounts == nil {
+		return nil, nil
+	}
+	if clientID == "" {
+		return nil, ErrMissingAccountID
+	}
+
+	account, err := a.accounts.Get(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if account.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	return account, nil
+}
+
+// RegisterKey generates a key pair for a service account, stores the public
+// key and returns the key file for the client
+func (a *Authenticator) RegisterKey(ctx context.Context, clientID, tokenURI string, scopes []string) (*KeyFile, *Key, error) {
+	if _, err := a.checkAccount(ctx, clientID); err != nil {
+		return nil, nil, err
+	}
+
+	keyFile, key, err := GenerateKey(clientID, tokenURI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key.Scopes = scopes
+	if err := a.keyStore.Store(ctx, key); err != nil {
+		return nil, nil, fmt.Errorf("failed to store service account key: %w", err)
+	}
+
+	keyFile.Scopes = scopes
+	return keyFile, key, nil
+}
+
+// IssueSecret issues a client secret for a service account and returns it,
+// as it is only available now: the store keeps its hash. Secrets suit
+// clients that cannot hold a key file; prefer RegisterKey otherwise.
+func (a *Authenticator) IssueSecret(ctx context.Context, clientID string, scopes []string, expiresIn *time.Duration) (secret string, key *Key, err error) {
+	if clientID == "" {
+		return "", nil, ErrMissingAccountID
+	}
+	if _, err := a.checkAccount(ctx, clientID); err != nil {
+		return "", nil, err
+	}
+
+	secret, err = a.hasher.Generate()
+	if err != nil {
+		return "", nil, err
+	}
+	keyID, err := randomID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key = &Key{
+		ClientID:   clientID,
+		KeyID:      keyID,
+		SecretHash: a.hasher.Hash(secret),
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	}
+	if expiresIn != nil {
+		expiresAt := key.CreatedAt.Add(*expiresIn)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := a.keyStore.Store(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to store service account secret: %w", err)
+	}
+	return secret, key, nil
+}
+
+// Authenticate verifies a client assertion
+func (a *Authenticator) Authenticate(ctx context.Context, creds credential.Credentials) (*credential.AuthenticationResult, error) {
+	saCreds, ok := creds.(*Credentials)
+	if !ok {
+		return &credential.AuthenticationResult{
+			Success: false,
+			Error:   errors.New("invalid credentials type"),
+		}, nil
+	}
+
+	if err := saCreds.Validate(); err != nil {
+		return &credential.AuthenticationResult{Success: false, Error: err}, nil
+	}
+
+	var (
+		key        *Key
+		claims     *jwt.RegisteredClaims
+		authMethod = "private_key_jwt"
+		err        error
+	)
+	if saCreds.Assertion != "" {
+		key, claims, err = a.verifyAssertion(ctx, saCreds)
+	} else {
+		key, err = a.verifySecret(ctx, saCreds)
+		authMethod = "client_secret"
+	}
+	if err != nil {
+		if errors.Is(err, errKeyLookup) {
+			return nil, err
+		}
+		return &credential.AuthenticationResult{Success: false, Error: err}, nil
+	}
+
+	account, err := a.checkAccount(ctx, key.ClientID)
+	if errors.Is(err, ErrAccountNotFound) || errors.Is(err, ErrAccountDisabled) {
+		return &credential.AuthenticationResult{Success: false, Error: err}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("service account lookup failed: %w", err)
+	}
+
+	scopes, err := grantedScopes(saCreds.Scopes, key, account)
+	if err != nil {
+		return &credential.AuthenticationResult{Success: false, Error: err}, nil
+	}
+
+	if claims != nil && !a.markUsed(claims.ID, claims.ExpiresAt.Time) {
+		return &credential.AuthenticationResult{Success: false, Error: ErrAssertionReplay}, nil
+	}
+
+	subjectID := key.Subject
+	if subjectID == "" {
+		subjectID = "service:" + key.ClientID
+	}
+
+	resultClaims := map[string]any{
+		"sub":             subjectID,
+		"type":            "service",
+		"client_id":       key.ClientID,
+		"key_id":          key.KeyID,
+		"scopes":          scopes,
+		"auth_type":       "service_account",
+		"auth_method":     authMethod,
+		"service_account": true,
+	}
+	if account != nil {
+		if account.TenantID != "" {
+			resultClaims["tenant_id"] = account.TenantID
+		}
+		if account.Name != "" {
+			resultClaims["name"] = account.Name
+		}
+	}
+	for name, value := range key.Claims {
+		if _, exists := resultClaims[name]; !exists {
+			resultClaims[name] = value
+		}
+	}
+	if account != nil {
+		for name, value := range account.Claims {
+			if _, exists := resultClaims[name]; !exists {
+				resultClaims[name] = value
+			}
+		}
+	}
+
+	return &credential.AuthenticationResult{
+		Success: true,
+		Subject: subjectID,
+		Claims:  resultClaims,
+	}, nil
+}
+
+// Type returns the authenticator type
+func (a *Authenticator) Type() string {
+	return "service_account"
+}
+
+// ParseCredentials parses {"client_id", "client_assertion" |
+// "client_secret", "scope"} (space-separated scopes, as in the client
+// credentials grant)
+func (a *Authenticator) ParseCredentials(payload []byte) (credential.Credentials, error) {
+	var body struct {
+		ClientID  string `json:"client_id"`
+		Assertion string `json:"client_assertion"`
+		Secret    string `json:"client_secret"`
+		Scope     string `json:"scope"`
+	}
+	if err := credential.DecodePayload(payload, &body); err != nil {
+		return nil, err
+	}
+	return &Credentials{
+		ClientID:  body.ClientID,
+		Assertion: body.Assertion,
+		Secret:    body.Secret,
+		Scopes:    strings.Fields(body.Scope),
+	}, nil
+}
+
+// grantedScopes returns the requested scopes (default: those of the key,
+// else of the account), which the key and the account must both allow
+func grantedScopes(requested []string, key *Key, account *Account) ([]string, error) {
+	scopes := requested
+	if len(scopes) == 0 {
+		scopes = key.Scopes
+	}
+	if len(scopes) == 0 && account != nil {
+		scopes = account.Scopes
+	}
+
+	for _, scope := range scopes {
+		if len(key.Scopes) > 0 && !slices.Contains(key.Scopes, scope) ||
+			account != nil && len(account.Scopes) > 0 && !slices.Contains(account.Scopes, scope) {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// errKeyLookup marks key store failures (infrastructure errors)
+var errKeyLookup = errors.New("service account key lookup failed")
+
+// verifyAssertion verifies the signature and claims of a client assertion
+func (a *Authenticator) verifyAssertion(ctx context.Context, creds *Credentials) (*Key, *jwt.RegisteredClaims, error) {
+	if len(a.config.Audience) == 0 {
+		return nil, nil, fmt.Errorf("%w: no audience configured", ErrInvalidAssertion)
+	}
+
+	var key *Key
+	claims := &jwt.RegisteredClaims{}
+
+	_, err := jwt.ParseWithClaims(creds.Assertion, claims, func(t *jwt.Token) (any, error) {
+		keyID, _ := t.Header["kid"].(string)
+		clientID, err := claims.GetIssuer()
+		if err != nil || clientID == "" || keyID == "" {
+			return nil, errors.New("missing iss or kid")
+		}
+		if claims.Subject != clientID {
+			return nil, errors.New("sub must equal iss")
+		}
+		if creds.ClientID != "" && creds.ClientID != clientID {
+			return nil, errors.New("client_id does not match assertion issuer")
+		}
+
+		key, err = a.keyStore.Get(ctx, clientID, keyID)
+		if err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				return nil, ErrKeyNotFound
+			}
+			return nil, fmt.Errorf("%w: %v", errKeyLookup, err)
+		}
+		if key.Revoked {
+			return nil, ErrKeyRevoked
+		}
+		if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+			return nil, ErrKeyExpired
+		}
+
+		publicKey, err := parsePublicKey(key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != signingMethod(publicKey).Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return publicKey, nil
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(a.config.ClockSkew),
+	)
+	if err != nil {
+		if errors.Is(err, errKeyLookup) {
+			return nil, nil, err
+		}
+		for _, cause := range []error{ErrKeyNotFound, ErrKeyRevoked, ErrKeyExpired} {
+			if errors.Is(err, cause) {
+				return nil, nil, cause
+			}
+		}
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidAssertion, err)
+	}
+
+	if !a.matchesAudience(claims.Audience) {
+		return nil, nil, fmt.Errorf("%w: audience not accepted", ErrInvalidAssertion)
+	}
+
+	if claims.ID == "" {
+		return nil, nil, fmt.Errorf("%w: jti is required", ErrInvalidAssertion)
+	}
+	if claims.IssuedAt == nil || claims.ExpiresAt.Sub(claims.IssuedAt.Time) > a.config.MaxAssertionLifetime {
+		return nil, nil, fmt.Errorf("%w: lifetime exceeds %s", ErrInvalidAssertion, a.config.MaxAssertionLifetime)
+	}
+
+	return key, claims, nil
+}
+
+// verifySecret returns the key of a service account whose secret matches
+func (a *Authenticator) verifySecret(ctx context.Context, creds *Credentials) (*Key, error) {
+	keys, err := a.keyStore.ListByClient(ctx, creds.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errKeyLookup, err)
+	}
+
+	for _, key := range keys {
+		if key.SecretHash == "" || !a.hasher.Compare(creds.Secret, key.SecretHash) {
+			continue
+		}
+		if key.Revoked {
+			return nil, ErrKeyRevoked
+		}
+		if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+			return nil, ErrKeyExpired
+		}
+		return key, nil
+	}
+	return nil, ErrInvalidSecret
+}
+
+// matchesAudience reports whether any assertion audience is accepted
+func (a *Authenticator) matchesAudience(audience jwt.ClaimStrings) bool {
+	for _, aud := range audience {
+		for _, accepted := range a.config.Audience {
+			if strings.TrimRight(aud, "/") == strings.TrimRight(accepted, "/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markUsed records an assertion ID, returning false if it was already used
+func (a *Authenticator) markUsed(jti string, expiresAt time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range a.usedJTIs {
+		if now.After(exp.Add(a.config.ClockSkew)) {
+			delete(a.usedJTIs, id)
+		}
+	}
+
+	if _, used := a.usedJTIs[jti]; used {
+		return false
+	}
+	a.usedJTIs[jti] = expiresAt
+	return true
+}
+
+// newClientID generates a service account client ID ("sa_" and 24 hex
+// characters)
+func newClientID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate client ID: %w", err)
+	}
+	return "sa_" + hex.EncodeToString(buf), nil
+}
+
+// parsePublicKey parses a PEM public key
+func parsePublicKey(data string) (any, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("%w: public key is not PEM encoded", ErrInvalidKeyFile)
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
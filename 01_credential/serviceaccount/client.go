@@ -0,0 +1,168 @@
+package serviceaccount
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTokenRequestFailed = errors.New("service account token request failed")
+
+// Token is an access token obtained with a key file
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int64     `json:"expires_in"`
+	ExpiresAt   time.Time `json:"-"`
+}
+
+// TokenSource exchanges a key file for short-lived access tokens with the
+// private_key_jwt flow (grant_type=client_credentials) and caches them until
+// shortly before they expire. It is safe for concurrent use.
+//
+//	keyFile, _ := serviceaccount.LoadKeyFile(os.Getenv("LOKSTRA_KEY_FILE"))
+//	client := serviceaccount.NewTokenSource(keyFile, nil).Client()
+//	resp, err := client.Get("https://api.example.com/reports")
+type TokenSource struct {
+	keyFile    *KeyFile
+	httpClient *http.Client
+	scopes     []string
+
+	// RefreshBefore renews tokens this long before they expire (default: 30s)
+	RefreshBefore time.Duration
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewTokenSource creates a token source for a key file. httpClient defaults
+// to http.DefaultClient; scopes default to the scopes of the key file.
+func NewTokenSource(keyFile *KeyFile, httpClient *http.Client, scopes ...string) *TokenSource {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if len(scopes) == 0 {
+		scopes = keyFile.Scopes
+	}
+
+	return &TokenSource{
+		keyFile:       keyFile,
+		httpClient:    httpClient,
+		scopes:        scopes,
+		RefreshBefore: 30 * time.Second,
+	}
+}
+
+// Token returns a valid access token, requesting a new one when needed
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && (s.token.ExpiresAt.IsZero() || time.Until(s.token.ExpiresAt) > s.RefreshBefore) {
+		return s.token, nil
+	}
+
+	tok, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = tok
+	return tok, nil
+}
+
+// fetch exchanges a fresh client assertion for an access token
+func (s *TokenSource) fetch(ctx context.Context) (*Token, error) {
+	if s.keyFile.TokenURI == "" {
+		return nil, fmt.Errorf("%w: key file has no token_uri", ErrInvalidKeyFile)
+	}
+
+	assertion, err := s.keyFile.Assertion(s.keyFile.TokenURI, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {s.keyFile.ClientID},
+		"client_assertion_type": {ClientAssertionType},
+		"client_assertion":      {assertion},
+	}
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.keyFile.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenRequestFailed, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenRequestFailed, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s: %s", ErrTokenRequestFailed, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tok Token
+	if err := json.Unmarshal(body, &tok); err != nil || tok.AccessToken == "" {
+		return nil, fmt.Errorf("%w: invalid token response", ErrTokenRequestFailed)
+	}
+	if tok.ExpiresIn > 0 {
+		tok.ExpiresAt = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+
+	return &tok, nil
+}
+
+// Client returns an HTTP client that authenticates every request with an
+// access token from the token source
+func (s *TokenSource) Client() *http.Client {
+	base := s.httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &http.Client{
+		Transport: &transport{source: s, base: base},
+		Timeout:   s.httpClient.Timeout,
+	}
+}
+
+// transport adds the Authorization header to requests
+type transport struct {
+	source *TokenSource
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	tokenType := tok.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", tokenType+" "+tok.AccessToken)
+	return t.base.RoundTrip(authorized)
+}
@@ -0,0 +1,147 @@
+package serviceaccount
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Key is a registered key of a service account: a public key verifying its
+// client assertions, or the hash of a client secret
+type Key struct {
+	// ClientID identifies the service account
+	ClientID string
+
+	// KeyID identifies the key (the "kid" of client assertions)
+	KeyID string
+
+	// PublicKey is the PEM encoded public key (keys authenticating with
+	// client assertions)
+	PublicKey string
+
+	// SecretHash is the hash of the client secret (keys authenticating with
+	// client_secret); the secret itself is never stored
+	SecretHash string
+
+	// Subject is the subject the service account authenticates as
+	// (default: "service:<client_id>")
+	Subject string
+
+	// Scopes are the scopes the service account may request
+	// (empty = any requested scope is granted)
+	Scopes []string
+
+	// Claims are added to the authentication result
+	Claims map[string]any
+
+	CreatedAt time.Time
+	ExpiresAt *time.Time // nil = never expires
+	Revoked   bool
+}
+
+// KeyStore stores service account keys
+type KeyStore interface {
+	// Store saves a key
+	Store(ctx context.Context, key *Key) error
+
+	// Get retrieves a key of a service account
+	Get(ctx context.Context, clientID, keyID string) (*Key, error)
+
+	// ListByClient returns all keys of a service account
+	ListByClient(ctx context.Context, clientID string) ([]*Key, error)
+
+	// Revoke marks a key as revoked
+	Revoke(ctx context.Context, clientID, keyID string) error
+
+	// Delete removes a key
+	Delete(ctx context.Context, clientID, keyID string) error
+}
+
+// InMemoryKeyStore is an in-memory implementation of KeyStore
+type InMemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*Key // clientID + "/" + keyID -> key
+}
+
+// NewInMemoryKeyStore creates a new in-memory service account key store
+func NewInMemoryKeyStore() *InMemoryKeyStore {
+	return &InMemoryKeyStore{
+		keys: make(map[string]*Key),
+	}
+}
+
+func storeKey(clientID, keyID string) string {
+	return clientID + "/" + keyID
+}
+
+// Store saves a key
+func (s *InMemoryKeyStore) Store(ctx context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *key
+	s.keys[storeKey(key.ClientID, key.KeyID)] = &copied
+	return nil
+}
+
+// Get retrieves a key of a service account
+func (s *InMemoryKeyStore) Get(ctx context.Context, clientID, keyID string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[storeKey(clientID, keyID)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	copied := *key
+	return &copied, nil
+}
+
+// ListByClient returns all keys of a service account (oldest first)
+func (s *InMemoryKeyStore) ListByClient(ctx context.Context, clientID string) ([]*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*Key, 0)
+	for _, key := range s.keys {
+		if key.ClientID == clientID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// Revoke marks a key as revoked
+func (s *InMemoryKeyStore) Revoke(ctx context.Context, clientID, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[storeKey(clientID, keyID)]
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	key.Revoked = true
+	return nil
+}
+
+// Delete removes a key
+func (s *InMemoryKeyStore) Delete(ctx context.Context, clientID, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[storeKey(clientID, keyID)]; !ok {
+		return ErrKeyNotFound
+	}
+
+	delete(s.keys, storeKey(clientID, keyID))
+	return nil
+}
@@ -0,0 +1,69 @@
+package token
+
+import (
+	"slices"
+	"time"
+)
+
+// Claims recording how and when the subject of a token authenticated, used
+// to require recent or stronger authentication (step-up)
+const (
+	// ClaimAuthTime is when the subject authenticated, in Unix seconds
+	ClaimAuthTime = "auth_time"
+
+	// ClaimACR is the authentication context class: the assurance level of
+	// the authentication (ACRSingleFactor, ACRMultiFactor)
+	ClaimACR = "acr"
+
+	// ClaimAMR lists the authentication methods used ("password", "otp",
+	// "passkey", ...)
+	ClaimAMR = "amr"
+)
+
+// Authentication context classes (NIST authenticator assurance levels)
+const (
+	ACRSingleFactor = "aal1"
+	ACRMultiFactor  = "aal2"
+)
+
+// AuthTime returns when the subject of the token authenticated
+func (c Claims) AuthTime() (time.Time, bool) {
+	seconds, ok := c.GetInt64(ClaimAuthTime)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// ACR returns the authentication context class of the token
+func (c Claims) ACR() string {
+	acr, _ := c.GetString(ClaimACR)
+	return acr
+}
+
+// AuthMethods returns the authentication methods of the token
+func (c Claims) AuthMethods() []string {
+	amr, _ := c.GetStringSlice(ClaimAMR)
+	return amr
+}
+
+// StampAuthentication records an authentication at a time with a method in
+// claims: the auth time is set, the method is added to the methods, and the
+// class becomes multi-factor once two methods were used
+func StampAuthentication(claims map[string]any, at time.Time, method string) {
+	methods := Claims(claims).AuthMethods()
+	if method != "" && !slices.Contains(methods, method) {
+		methods = append(slices.Clone(methods), method)
+	}
+
+	claims[ClaimAuthTime] = at.Unix()
+	if len(methods) > 0 {
+		claims[ClaimAMR] = methods
+	}
+	// Authenticators may set a class of their own (e.g., for passkeys)
+	if len(methods) > 1 {
+		claims[ClaimACR] = ACRMultiFactor
+	} else if Claims(claims).ACR() == "" {
+		claims[ClaimACR] = ACRSingleFactor
+	}
+}
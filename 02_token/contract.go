@@ -180,3 +180,25 @@ type TokenRevocationList interface {
 	// Cleanup removes expired tokens from the revocation list
 	Cleanup(ctx context.Context) error
 }
+
+// SubjectRevoker revokes every token issued to a subject of a tenant (e.g.,
+// global logout). Tokens of the same subject ID in other tenants stay valid.
+type SubjectRevoker interface {
+	// RevokeAllForSubject invalidates all tokens issued to the subject of
+	// the tenant so far
+	RevokeAllForSubject(ctx context.Context, tenantID, subject string) error
+}
+
+// WatermarkStore stores per-subject "not valid before" watermarks, by tenant.
+// Tokens issued to a subject at or before its watermark are considered revoked.
+type WatermarkStore interface {
+	// SetNotBefore sets the watermark for a subject of a tenant
+	SetNotBefore(ctx context.Context, tenantID, subject string, notBefore time.Time) error
+
+	// GetNotBefore retrieves the watermark for a subject of a tenant (ok is
+	// false if none is set)
+	GetNotBefore(ctx context.Context, tenantID, subject string) (notBefore time.Time, ok bool, err error)
+
+	// Delete removes the watermark for a subject of a tenant
+	Delete(ctx context.Context, tenantID, subject string) error
+}
@@ -0,0 +1,313 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrInvalidDeviceToken  = autherrors.New(autherrors.ErrTokenInvalid, "invalid device token")
+	ErrExpiredDeviceToken  = autherrors.New(autherrors.ErrTokenExpired, "device token has expired")
+	ErrDeviceNotFound      = autherrors.New(autherrors.ErrNotFound, "device not found")
+	ErrFingerprintMismatch = autherrors.New(autherrors.ErrTokenInvalid, "device fingerprint mismatch")
+	ErrTokenReuse          = autherrors.New(autherrors.ErrTokenRevoked, "device token reuse detected, all devices revoked")
+)
+
+// TokenType is the token type of device tokens
+const TokenType = "Device"
+
+// Device is a remembered device holding one rotating token series
+type Device struct {
+	// SeriesID identifies the device (stable across rotations)
+	SeriesID string
+
+	// SubjectID is the subject the device re-authenticates
+	SubjectID string
+
+	// Name is a display name (e.g., "Chrome on macOS")
+	Name string
+
+	// FingerprintHash is the SHA-256 hash of the device fingerprint
+	FingerprintHash string
+
+	// TokenHash is the SHA-256 hash of the current token secret
+	TokenHash string
+
+	// Claims are the claims used to re-issue access tokens
+	Claims token.Claims
+
+	// IPAddress and UserAgent of the last use
+	IPAddress string
+	UserAgent string
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// Info describes the device a token is issued to
+type Info struct {
+	// Fingerprint identifies the device (e.g., a client-generated device ID
+	// combined with the user agent). Only its hash is stored.
+	Fingerprint string
+
+	// Name is a display name for the devices list (optional)
+	Name string
+
+	// IPAddress and UserAgent of the request (optional)
+	IPAddress string
+	UserAgent string
+}
+
+// Config holds device token manager configuration
+type Config struct {
+	// TokenDuration is how long a device is remembered (default: 30 days)
+	TokenDuration time.Duration
+
+	// SlidingExpiration extends the expiry on every rotation (default: false)
+	SlidingExpiration bool
+
+	// Store persists devices (default: in-memory)
+	Store Store
+}
+
+// DefaultConfig returns a default device token configuration
+func DefaultConfig() *Config {
+	return &Config{
+		TokenDuration: 30 * 24 * time.Hour,
+	}
+}
+
+// Manager issues and rotates long-lived "remember this device" tokens.
+//
+// A device token is "<series>.<secret>". The series is stable per device and
+// the secret rotates on every use; presenting an old secret for a live
+// series means the token was stolen, so all devices of the subject are revoked.
+type Manager struct {
+	config *Config
+	store  Store
+	mu     sync.Mutex // serializes rotations
+}
+
+// NewManager creates a new device token manager
+func NewManager(config *Config) *Manager {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	if config.TokenDuration == 0 {
+		config.TokenDuration = 30 * 24 * time.Hour
+	}
+
+	if config.Store == nil {
+		config.Store = NewInMemoryStore()
+	}
+
+	return &Manager{
+		config: config,
+		store:  config.Store,
+	}
+}
+
+// Issue remembers a device for a subject and returns its first device token
+func (m *Manager) Issue(ctx context.Context, subjectID string, claims token.Claims, info *Info) (*token.Token, *Device, error) {
+	if info == nil || info.Fingerprint == "" {
+		return nil, nil, fmt.Errorf("%w: fingerprint is required", ErrInvalidDeviceToken)
+	}
+
+	seriesID, err := randomString(16)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	device := &Device{
+		SeriesID:        seriesID,
+		SubjectID:       subjectID,
+		Name:            info.Name,
+		FingerprintHash: HashFingerprint(info.Fingerprint),
+		Claims:          claims,
+		IPAddress:       info.IPAddress,
+		UserAgent:       info.UserAgent,
+		CreatedAt:       now,
+		LastUsedAt:      now,
+		ExpiresAt:       now.Add(m.config.TokenDuration),
+	}
+
+	tok, err := m.rotate(ctx, device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tok, device, nil
+}
+
+// Rotate validates a device token and returns the device with a new token.
+// The presented token can no longer be used.
+func (m *Manager) Rotate(ctx context.Context, tokenValue string, info *Info) (*token.Token, *Device, error) {
+	seriesID, secret, ok := strings.Cut(tokenValue, ".")
+	if !ok || seriesID == "" || secret == "" {
+		return nil, nil, ErrInvalidDeviceToken
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, err := m.store.Get(ctx, seriesID)
+	if err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			return nil, nil, ErrInvalidDeviceToken
+		}
+		return nil, nil, err
+	}
+
+	if time.Now().After(device.ExpiresAt) {
+		_ = m.store.Delete(ctx, seriesID)
+		return nil, nil, ErrExpiredDeviceToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(device.TokenHash)) != 1 {
+		// Old secret of a live series: the token was copied and used elsewhere
+		if err := m.store.DeleteBySubject(ctx, device.SubjectID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReuse
+	}
+
+	if info == nil || subtle.ConstantTimeCompare([]byte(HashFingerprint(info.Fingerprint)), []byte(device.FingerprintHash)) != 1 {
+		return nil, nil, ErrFingerprintMismatch
+	}
+
+	now := time.Now()
+	device.LastUsedAt = now
+	if info.IPAddress != "" {
+		device.IPAddress = info.IPAddress
+	}
+	if info.UserAgent != "" {
+		device.UserAgent = info.UserAgent
+	}
+	if m.config.SlidingExpiration {
+		device.ExpiresAt = now.Add(m.config.TokenDuration)
+	}
+
+	tok, err := m.rotate(ctx, device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tok, device, nil
+}
+
+// List returns the remembered devices of a subject
+func (m *Manager) List(ctx context.Context, subjectID string) ([]*Device, error) {
+	return m.store.ListBySubject(ctx, subjectID)
+}
+
+// Revoke forgets one device of a subject
+func (m *Manager) Revoke(ctx context.Context, subjectID, seriesID string) error {
+	device, err := m.store.Get(ctx, seriesID)
+	if err != nil {
+		return err
+	}
+
+	if device.SubjectID != subjectID {
+		return ErrDeviceNotFound
+	}
+
+	return m.store.Delete(ctx, seriesID)
+}
+
+// RevokeByFingerprint forgets the devices of a subject with a fingerprint hash
+func (m *Manager) RevokeByFingerprint(ctx context.Context, subjectID, fingerprintHash string) error {
+	devices, err := m.store.ListBySubject(ctx, subjectID)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		if device.FingerprintHash == fingerprintHash {
+			if err := m.store.Delete(ctx, device.SeriesID); err != nil && !errors.Is(err, ErrDeviceNotFound) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// RevokeAllForSubject forgets all devices of a subject of a tenant (the
+// tenant of the claims the device re-issues; devices without one cannot be
+// told apart and are forgotten too)
+func (m *Manager) RevokeAllForSubject(ctx context.Context, tenantID, subjectID string) error {
+	devices, err := m.store.ListBySubject(ctx, subjectID)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		if deviceTenant, _ := device.Claims.Tenant(); deviceTenant != "" && deviceTenant != tenantID {
+			continue
+		}
+		if err := m.store.Delete(ctx, device.SeriesID); err != nil && !errors.Is(err, ErrDeviceNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotate sets a new secret on the device, saves it and returns the token
+func (m *Manager) rotate(ctx context.Context, device *Device) (*token.Token, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	device.TokenHash = hash(secret)
+	if err := m.store.Save(ctx, device); err != nil {
+		return nil, fmt.Errorf("failed to save device: %w", err)
+	}
+
+	return &token.Token{
+		Value:     device.SeriesID + "." + secret,
+		Type:      TokenType,
+		IssuedAt:  device.LastUsedAt,
+		ExpiresAt: device.ExpiresAt,
+		Metadata: map[string]any{
+			"token_id":  device.SeriesID,
+			"series_id": device.SeriesID,
+		},
+	}, nil
+}
+
+// randomString returns n random bytes, base64url encoded
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate device token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashFingerprint returns the stored form of a device fingerprint
+// (hex SHA-256), shared with subject.DeviceInfo.FingerprintHash
+func HashFingerprint(fingerprint string) string {
+	return hash(fingerprint)
+}
+
+// hash returns the hex SHA-256 hash of a value
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+package device
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Store persists remembered devices (one token series per device)
+type Store interface {
+	// Save creates or replaces a device
+	Save(ctx context.Context, device *Device) error
+
+	// Get retrieves a device by series ID
+	Get(ctx context.Context, seriesID string) (*Device, error)
+
+	// Delete removes a device
+	Delete(ctx context.Context, seriesID string) error
+
+	// ListBySubject returns all devices of a subject
+	ListBySubject(ctx context.Context, subjectID string) ([]*Device, error)
+
+	// DeleteBySubject removes all devices of a subject
+	DeleteBySubject(ctx context.Context, subjectID string) error
+}
+
+// InMemoryStore is an in-memory implementation of Store
+type InMemoryStore struct {
+	mu      sync.RWMutex
+	devices map[string]*Device // seriesID -> device
+}
+
+// NewInMemoryStore creates a new in-memory device store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		devices: make(map[string]*Device),
+	}
+}
+
+// Save creates or replaces a device
+func (s *InMemoryStore) Save(ctx context.Context, device *Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *device
+	s.devices[device.SeriesID] = &copied
+	return nil
+}
+
+// Get retrieves a device by series ID
+func (s *InMemoryStore) Get(ctx context.Context, seriesID string) (*Device, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	device, ok := s.devices[seriesID]
+	if !ok {
+		return nil, ErrDeviceNotFound
+	}
+
+	copied := *device
+	return &copied, nil
+}
+
+// Delete removes a device
+func (s *InMemoryStore) Delete(ctx context.Context, seriesID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.devices[seriesID]; !ok {
+		return ErrDeviceNotFound
+	}
+
+	delete(s.devices, seriesID)
+	return nil
+}
+
+// ListBySubject returns all devices of a subject (most recently used first)
+func (s *InMemoryStore) ListBySubject(ctx context.Context, subjectID string) ([]*Device, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	devices := make([]*Device, 0)
+	for _, device := range s.devices {
+		if device.SubjectID == subjectID {
+			copied := *device
+			devices = append(devices, &copied)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].LastUsedAt.After(devices[j].LastUsedAt)
+	})
+
+	return devices, nil
+}
+
+// DeleteBySubject removes all devices of a subject
+func (s *InMemoryStore) DeleteBySubject(ctx context.Context, subjectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for seriesID, device := range s.devices {
+		if device.SubjectID == subjectID {
+			delete(s.devices, seriesID)
+		}
+	}
+
+	return nil
+}
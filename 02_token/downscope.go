@@ -0,0 +1,20 @@
+package token
+
+// Claims of down-scoped tokens: derivative tokens restricted to a subset of
+// the permissions of the token they were derived from
+const (
+	// ClaimAllowedPermissions lists the permissions a down-scoped token is
+	// restricted to; authorizers deny anything else (see
+	// authz.RestrictedAuthorizer)
+	ClaimAllowedPermissions = "allowed_permissions"
+
+	// ClaimDownscopedFrom is the ID (jti) of the token a down-scoped token
+	// was derived from, when it had one
+	ClaimDownscopedFrom = "downscoped_from"
+)
+
+// AllowedPermissions returns the permissions a down-scoped token is
+// restricted to (false if the token is not restricted)
+func (c Claims) AllowedPermissions() ([]string, bool) {
+	return c.GetStringSlice(ClaimAllowedPermissions)
+}
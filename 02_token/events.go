@@ -0,0 +1,203 @@
+package token
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventType identifies a token lifecycle event
+type EventType string
+
+const (
+	// EventIssued is emitted when an access or refresh token is generated
+	EventIssued EventType = "token.issued"
+
+	// EventRefreshed is emitted when an access token is issued from a refresh token
+	EventRefreshed EventType = "token.refreshed"
+
+	// EventRevoked is emitted when a token (or every token of a subject) is revoked
+	EventRevoked EventType = "token.revoked"
+
+	// EventVerificationFailed is emitted when a token fails verification
+	EventVerificationFailed EventType = "token.verification_failed"
+)
+
+// TokenEvent describes a token lifecycle event
+type TokenEvent struct {
+	// Type is the event type
+	Type EventType
+
+	// Subject is the subject the token belongs to (if known)
+	Subject string
+
+	// TokenType is "access" or "refresh" (if known)
+	TokenType string
+
+	// Manager is the type of the token manager that emitted the event
+	Manager string
+
+	// ExpiresAt is the token expiry (if known)
+	ExpiresAt time.Time
+
+	// Error is the verification error (EventVerificationFailed only)
+	Error error
+
+	// Timestamp is when the event occurred
+	Timestamp time.Time
+
+	// Metadata contains additional event data
+	Metadata map[string]any
+}
+
+// TokenObserver receives token lifecycle events
+type TokenObserver interface {
+	// OnTokenEvent is called for every dispatched event.
+	// Observers must not modify the event.
+	OnTokenEvent(ctx context.Context, event *TokenEvent)
+}
+
+// ObserverFunc adapts a function to a TokenObserver
+type ObserverFunc func(ctx context.Context, event *TokenEvent)
+
+// OnTokenEvent calls f(ctx, event)
+func (f ObserverFunc) OnTokenEvent(ctx context.Context, event *TokenEvent) {
+	f(ctx, event)
+}
+
+// EventDispatcher fans token events out to subscribed observers.
+// A nil *EventDispatcher is valid and drops every event.
+//
+// Synchronous dispatchers call observers inline on the caller's goroutine.
+// Asynchronous dispatchers queue events and deliver them from a background
+// goroutine; when the queue is full, events are dropped (and counted) rather
+// than blocking token operations.
+type EventDispatcher struct {
+	mu        sync.RWMutex
+	observers []TokenObserver
+
+	queue   chan queuedEvent
+	done    chan struct{}
+	closed  bool
+	dropped uint64
+}
+
+type queuedEvent struct {
+	ctx   context.Context
+	event *TokenEvent
+}
+
+// NewEventDispatcher creates a synchronous event dispatcher
+func NewEventDispatcher(observers ...TokenObserver) *EventDispatcher {
+	return &EventDispatcher{
+		observers: observers,
+	}
+}
+
+// NewAsyncEventDispatcher creates an asynchronous event dispatcher with a
+// queue of the given size (default: 1024)
+func NewAsyncEventDispatcher(bufferSize int, observers ...TokenObserver) *EventDispatcher {
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+
+	d := &EventDispatcher{
+		observers: observers,
+		queue:     make(chan queuedEvent, bufferSize),
+		done:      make(chan struct{}),
+	}
+
+	go d.run()
+
+	return d
+}
+
+// Subscribe adds an observer
+func (d *EventDispatcher) Subscribe(observer TokenObserver) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.observers = append(d.observers, observer)
+}
+
+// Dispatch delivers an event to all observers
+func (d *EventDispatcher) Dispatch(ctx context.Context, event *TokenEvent) {
+	if d == nil {
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	if d.queue == nil {
+		d.deliver(ctx, event)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		d.dropped++
+		return
+	}
+
+	// Detach from request cancellation; the event outlives the call
+	select {
+	case d.queue <- queuedEvent{ctx: context.WithoutCancel(ctx), event: event}:
+	default:
+		d.dropped++
+	}
+}
+
+// Dropped returns the number of events dropped by an async dispatcher
+func (d *EventDispatcher) Dropped() uint64 {
+	if d == nil {
+		return 0
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.dropped
+}
+
+// Close stops an async dispatcher after delivering queued events
+func (d *EventDispatcher) Close() {
+	if d == nil || d.queue == nil {
+		return
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	<-d.done
+}
+
+// run delivers queued events (async dispatchers only)
+func (d *EventDispatcher) run() {
+	defer close(d.done)
+
+	for item := range d.queue {
+		d.deliver(item.ctx, item.event)
+	}
+}
+
+// deliver calls every observer, isolating observer panics
+func (d *EventDispatcher) deliver(ctx context.Context, event *TokenEvent) {
+	d.mu.RLock()
+	observers := append([]TokenObserver{}, d.observers...)
+	d.mu.RUnlock()
+
+	for _, observer := range observers {
+		func() {
+			defer func() { _ = recover() }()
+			observer.OnTokenEvent(ctx, event)
+		}()
+	}
+}
@@ -2,19 +2,28 @@ package jwt
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/secrets"
 )
 
 var (
-	ErrInvalidToken     = errors.New("invalid token")
-	ErrExpiredToken     = errors.New("token has expired")
-	ErrInvalidSignature = errors.New("invalid token signature")
-	ErrMissingClaims    = errors.New("missing required claims")
+	ErrInvalidToken     = autherrors.New(autherrors.ErrTokenInvalid, "invalid token")
+	ErrExpiredToken     = autherrors.New(autherrors.ErrTokenExpired, "token has expired")
+	ErrInvalidSignature = autherrors.New(autherrors.ErrTokenInvalid, "invalid token signature")
+	ErrMissingClaims    = autherrors.New(autherrors.ErrTokenInvalid, "missing required claims")
+	ErrTokenRevoked     = autherrors.New(autherrors.ErrTokenRevoked, "token has been revoked")
+	ErrTokenNotValidYet = autherrors.New(autherrors.ErrTokenInvalid, "token is not valid yet")
+	ErrTokenTooOld      = autherrors.New(autherrors.ErrTokenExpired, "token exceeds maximum age")
 )
 
 // Config holds JWT configuration
@@ -40,11 +49,49 @@ type Config struct {
 	// RefreshTokenDuration is how long refresh tokens are valid
 	RefreshTokenDuration time.Duration
 
+	// Leeway is the allowed clock skew when validating exp, nbf and iat
+	Leeway time.Duration
+
+	// RequireIssuedAt rejects tokens without an iat claim (or issued in the future)
+	RequireIssuedAt bool
+
+	// RequireNotBefore rejects tokens without an nbf claim.
+	// Generated tokens always carry nbf when this is enabled.
+	RequireNotBefore bool
+
+	// MaxTokenAge rejects tokens issued longer ago than this, even if not yet
+	// expired (0 = no limit). Implies RequireIssuedAt.
+	MaxTokenAge time.Duration
+
+	// ClaimsSchema validates access token claims on Generate and Verify (optional)
+	ClaimsSchema *token.ClaimsSchema
+
+	// SingleTenant injects a default tenant_id/app_id into access tokens on
+	// Generate and Verify, and rejects tokens of other tenants (optional)
+	SingleTenant *token.SingleTenant
+
+	// TenantKeys provides per-tenant signing keys and token settings
+	// (optional). Tokens of a tenant with a key are signed with it and
+	// rejected when signed with any other key.
+	TenantKeys TenantKeyProvider
+
+	// Signer signs tokens with an external key service (KMS, HSM, Vault
+	// Transit) instead of SigningKey (optional). Tokens are verified locally
+	// with the cached public key of the version named by their "kid".
+	Signer Signer
+
 	// EnableRevocation enables token revocation support
 	EnableRevocation bool
 
 	// RevocationList is the revocation list (optional)
 	RevocationList token.TokenRevocationList
+
+	// WatermarkStore holds per-subject "not valid before" watermarks used by
+	// RevokeAllForSubject (optional, uses in-memory if revocation is enabled)
+	WatermarkStore token.WatermarkStore
+
+	// Events receives token lifecycle events (optional)
+	Events *token.EventDispatcher
 }
 
 // DefaultConfig returns a default JWT configuration
@@ -60,16 +107,46 @@ func DefaultConfig(secret string) *Config {
 	}
 }
 
+// DefaultConfigFromSecret returns a default JWT configuration whose HMAC secret
+// is resolved from a secret reference (e.g., "env:JWT_SECRET", "vault:secret/data/auth#jwt")
+func DefaultConfigFromSecret(ctx context.Context, resolver secrets.SecretResolver, ref secrets.Ref) (*Config, error) {
+	if resolver == nil {
+		return nil, secrets.ErrResolverNotConfigured
+	}
+
+	secret, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve signing key: %w", err)
+	}
+
+	if secret == "" {
+		return nil, errors.New("signing key secret is empty")
+	}
+
+	return DefaultConfig(secret), nil
+}
+
 // Manager handles JWT token generation and verification
 type Manager struct {
 	config         *Config
 	revocationList token.TokenRevocationList
+	watermarkStore token.WatermarkStore
+	publicKeys     sync.Map // signer key ID -> crypto.PublicKey
+
+	// Current keys (rotated with RotateKey)
+	keyMu         sync.RWMutex
+	signingKey    any
+	verifyingKey  any
+	previousKey   any // verifying key before the last rotation
+	previousUntil time.Time
 }
 
 // NewManager creates a new JWT manager
 func NewManager(config *Config) *Manager {
 	m := &Manager{
-		config: config,
+		config:       config,
+		signingKey:   config.SigningKey,
+		verifyingKey: config.VerifyingKey,
 	}
 
 	if config.EnableRevocation {
@@ -78,22 +155,70 @@ func NewManager(config *Config) *Manager {
 		} else {
 			m.revocationList = NewInMemoryRevocationList()
 		}
+
+		if config.WatermarkStore != nil {
+			m.watermarkStore = config.WatermarkStore
+		} else {
+			m.watermarkStore = token.NewInMemoryWatermarkStore()
+		}
 	}
 
 	return m
 }
 
+// RotateKey replaces the signing and verifying keys, e.g. from a
+// secrets.Watcher callback when the HMAC secret is rotated. Tokens signed
+// with the previous key keep verifying until they expire (for the longest
+// token duration).
+func (m *Manager) RotateKey(signingKey, verifyingKey any) {
+	if verifyingKey == nil {
+		verifyingKey = signingKey
+	}
+
+	m.keyMu.Lock()
+	defer m.keyMu.Unlock()
+
+	m.previousKey = m.verifyingKey
+	m.previousUntil = time.Now().Add(max(m.config.AccessTokenDuration, m.config.RefreshTokenDuration))
+	m.signingKey, m.verifyingKey = signingKey, verifyingKey
+}
+
 // Generate creates a new JWT token from the provided claims
 func (m *Manager) Generate(ctx context.Context, claims token.Claims) (*token.Token, error) {
+	tok, err := m.generate(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	m.emit(ctx, token.EventIssued, claims, token.TokenTypeAccess, tok.ExpiresAt)
+	return tok, nil
+}
+
+// generate creates a new JWT token without emitting events
+func (m *Manager) generate(ctx context.Context, claims token.Claims) (*token.Token, error) {
+	tenantID, _ := m.config.SingleTenant.Apply(claims).Tenant()
+	settings, err := m.signingSettings(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := settings.accessTokenDuration
+	if lifetime := token.LifetimesFromContext(ctx).Access; lifetime > 0 {
+		duration = lifetime
+	}
+
 	now := time.Now()
-	expiresAt := now.Add(m.config.AccessTokenDuration)
+	expiresAt := now.Add(duration)
 
 	// Build JWT claims
 	jwtClaims := jwt.MapClaims{
-		"iat": now.Unix(),
+		"iat": issuedAt(now),
 		"exp": expiresAt.Unix(),
-		"iss": m.config.Issuer,
-		"aud": m.config.Audience,
+		"iss": settings.issuer,
+		"aud": settings.audience,
+	}
+	if m.config.RequireNotBefore {
+		jwtClaims["nbf"] = now.Unix()
 	}
 
 	// Add custom claims
@@ -101,11 +226,19 @@ func (m *Manager) Generate(ctx context.Context, claims token.Claims) (*token.Tok
 		jwtClaims[k] = v
 	}
 
-	// Create token
-	jwtToken := jwt.NewWithClaims(m.config.SigningMethod, jwtClaims)
+	// Single-tenant mode: default tenant/app
+	if err := m.config.SingleTenant.Check(token.Claims(jwtClaims)); err != nil {
+		return nil, err
+	}
+	jwtClaims = jwt.MapClaims(m.config.SingleTenant.Apply(token.Claims(jwtClaims)))
+
+	// Validate claims schema
+	if err := m.config.ClaimsSchema.Validate(token.Claims(jwtClaims)); err != nil {
+		return nil, err
+	}
 
 	// Sign token
-	tokenString, err := jwtToken.SignedString(m.config.SigningKey)
+	tokenString, err := sign(settings, jwtClaims)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -116,21 +249,36 @@ func (m *Manager) Generate(ctx context.Context, claims token.Claims) (*token.Tok
 		ExpiresAt: expiresAt,
 		IssuedAt:  now,
 		Metadata: map[string]any{
-			"algorithm": m.config.SigningMethod.Alg(),
+			"algorithm": settings.method.Alg(),
 		},
 	}, nil
 }
 
 // Verify validates a JWT token and extracts its claims
 func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.VerificationResult, error) {
+	result, err := m.verify(ctx, tokenValue)
+	if err == nil && !result.Valid {
+		m.emitVerificationFailed(ctx, result)
+	}
+	return result, err
+}
+
+// verify validates a JWT token without emitting events
+func (m *Manager) verify(ctx context.Context, tokenValue string) (*token.VerificationResult, error) {
 	// Parse and verify token
+	var settings *keySettings
 	jwtToken, err := jwt.Parse(tokenValue, func(t *jwt.Token) (any, error) {
+		var err error
+		if settings, err = m.verifyingSettings(ctx, t); err != nil {
+			return nil, err
+		}
+
 		// Verify signing method
-		if t.Method.Alg() != m.config.SigningMethod.Alg() {
+		if t.Method.Alg() != settings.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return m.config.VerifyingKey, nil
-	})
+		return settings.verifyingKey, nil
+	}, m.parserOptions()...)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -139,6 +287,12 @@ func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.Verific
 				Error: ErrExpiredToken,
 			}, nil
 		}
+		if errors.Is(err, jwt.ErrTokenNotValidYet) || errors.Is(err, jwt.ErrTokenUsedBeforeIssued) {
+			return &token.VerificationResult{
+				Valid: false,
+				Error: ErrTokenNotValidYet,
+			}, nil
+		}
 		if errors.Is(err, jwt.ErrSignatureInvalid) {
 			return &token.VerificationResult{
 				Valid: false,
@@ -160,6 +314,22 @@ func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.Verific
 		}, nil
 	}
 
+	// Check the key belongs to the token tenant
+	if err := m.checkTenantKey(ctx, settings, jwtClaims); err != nil {
+		return &token.VerificationResult{
+			Valid: false,
+			Error: err,
+		}, nil
+	}
+
+	// Check temporal claims
+	if err := m.validateTemporalClaims(jwtClaims); err != nil {
+		return &token.VerificationResult{
+			Valid: false,
+			Error: err,
+		}, nil
+	}
+
 	// Check revocation
 	if m.config.EnableRevocation && m.revocationList != nil {
 		// Try to get JTI (JWT ID) from claims
@@ -173,16 +343,24 @@ func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.Verific
 			if err == nil && revoked {
 				return &token.VerificationResult{
 					Valid: false,
-					Error: errors.New("token has been revoked"),
+					Error: ErrTokenRevoked,
 				}, nil
 			}
 		}
 	}
 
+	// Check subject watermark (global logout)
+	if m.isBeforeWatermark(ctx, jwtClaims) {
+		return &token.VerificationResult{
+			Valid: false,
+			Error: ErrTokenRevoked,
+		}, nil
+	}
+
 	// Verify issuer
-	if m.config.Issuer != "" {
+	if settings.issuer != "" {
 		iss, err := jwtClaims.GetIssuer()
-		if err != nil || iss != m.config.Issuer {
+		if err != nil || iss != settings.issuer {
 			return &token.VerificationResult{
 				Valid: false,
 				Error: fmt.Errorf("invalid issuer"),
@@ -196,6 +374,26 @@ func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.Verific
 		claims[k] = v
 	}
 
+	// Validate claims schema (refresh tokens carry only limited claims)
+	if claims["type"] != "refresh" {
+		// Single-tenant mode: tokens without tenant_id/app_id belong to the
+		// default tenant/app
+		if err := m.config.SingleTenant.Check(claims); err != nil {
+			return &token.VerificationResult{
+				Valid: false,
+				Error: err,
+			}, nil
+		}
+		claims = m.config.SingleTenant.Apply(claims)
+
+		if err := m.config.ClaimsSchema.Validate(claims); err != nil {
+			return &token.VerificationResult{
+				Valid: false,
+				Error: err,
+			}, nil
+		}
+	}
+
 	return &token.VerificationResult{
 		Valid:  true,
 		Claims: claims,
@@ -205,6 +403,77 @@ func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.Verific
 	}, nil
 }
 
+// sign signs claims with the key of the settings
+func sign(settings *keySettings, claims jwt.MapClaims) (string, error) {
+	jwtToken := jwt.NewWithClaims(settings.method, claims)
+	if settings.keyID != "" {
+		jwtToken.Header["kid"] = settings.keyID
+	}
+	return jwtToken.SignedString(settings.signingKey)
+}
+
+// parserOptions builds JWT parser options from the configuration
+func (m *Manager) parserOptions() []jwt.ParserOption {
+	var opts []jwt.ParserOption
+
+	if m.config.Leeway > 0 {
+		opts = append(opts, jwt.WithLeeway(m.config.Leeway))
+	}
+
+	if m.config.RequireIssuedAt || m.config.MaxTokenAge > 0 {
+		// Rejects tokens whose iat lies in the future (beyond leeway)
+		opts = append(opts, jwt.WithIssuedAt())
+	}
+
+	return opts
+}
+
+// validateTemporalClaims enforces claim presence and maximum token age
+func (m *Manager) validateTemporalClaims(claims jwt.MapClaims) error {
+	if m.config.RequireNotBefore {
+		nbf, err := claims.GetNotBefore()
+		if err != nil || nbf == nil {
+			return fmt.Errorf("%w: nbf", ErrMissingClaims)
+		}
+	}
+
+	if !m.config.RequireIssuedAt && m.config.MaxTokenAge <= 0 {
+		return nil
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return fmt.Errorf("%w: iat", ErrMissingClaims)
+	}
+
+	if m.config.MaxTokenAge > 0 && time.Since(iat.Time) > m.config.MaxTokenAge+m.config.Leeway {
+		return ErrTokenTooOld
+	}
+
+	return nil
+}
+
+// VerifyWithOptions validates a token and enforces per-call options
+// (expected audience, required scopes, required token type)
+func (m *Manager) VerifyWithOptions(ctx context.Context, tokenValue string, opts *token.VerifyOptions) (*token.VerificationResult, error) {
+	result, err := m.Verify(ctx, tokenValue)
+	if err != nil || !result.Valid {
+		return result, err
+	}
+
+	if err := opts.Check(result.Claims); err != nil {
+		failed := &token.VerificationResult{
+			Valid:  false,
+			Claims: result.Claims,
+			Error:  err,
+		}
+		m.emitVerificationFailed(ctx, failed)
+		return failed, nil
+	}
+
+	return result, nil
+}
+
 // Type returns the type of tokens this manager handles
 func (m *Manager) Type() string {
 	return "jwt"
@@ -212,39 +481,56 @@ func (m *Manager) Type() string {
 
 // GenerateRefreshToken generates a refresh token
 func (m *Manager) GenerateRefreshToken(ctx context.Context, claims token.Claims) (*token.Token, error) {
+	tenantID, _ := m.config.SingleTenant.Apply(claims).Tenant()
+	settings, err := m.signingSettings(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := settings.refreshTokenDuration
+	if lifetime := token.LifetimesFromContext(ctx).Refresh; lifetime > 0 {
+		duration = lifetime
+	}
+
 	now := time.Now()
-	expiresAt := now.Add(m.config.RefreshTokenDuration)
+	expiresAt := now.Add(duration)
 
 	// Build JWT claims for refresh token
 	jwtClaims := jwt.MapClaims{
-		"iat":  now.Unix(),
+		"iat":  issuedAt(now),
 		"exp":  expiresAt.Unix(),
-		"iss":  m.config.Issuer,
-		"aud":  m.config.Audience,
+		"iss":  settings.issuer,
+		"aud":  settings.audience,
 		"type": "refresh",
 	}
+	if m.config.RequireNotBefore {
+		jwtClaims["nbf"] = now.Unix()
+	}
 
-	// Add limited custom claims (typically just subject)
+	// Add limited custom claims (subject, and its tenant: the one whose key
+	// signs it and whose watermark revokes it)
 	if sub, ok := claims["sub"]; ok {
 		jwtClaims["sub"] = sub
 	}
-
-	// Create token
-	jwtToken := jwt.NewWithClaims(m.config.SigningMethod, jwtClaims)
+	if tenantID != "" {
+		jwtClaims[token.ClaimTenantID] = tenantID
+	}
 
 	// Sign token
-	tokenString, err := jwtToken.SignedString(m.config.SigningKey)
+	tokenString, err := sign(settings, jwtClaims)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
 
+	m.emit(ctx, token.EventIssued, claims, token.TokenTypeRefresh, expiresAt)
+
 	return &token.Token{
 		Value:     tokenString,
 		Type:      "Bearer",
 		ExpiresAt: expiresAt,
 		IssuedAt:  now,
 		Metadata: map[string]any{
-			"algorithm": m.config.SigningMethod.Alg(),
+			"algorithm": settings.method.Alg(),
 			"type":      "refresh",
 		},
 	}, nil
@@ -258,7 +544,11 @@ func (m *Manager) Revoke(ctx context.Context, tokenValue string) error {
 
 	// Parse token to get JTI and expiry
 	jwtToken, err := jwt.Parse(tokenValue, func(t *jwt.Token) (any, error) {
-		return m.config.VerifyingKey, nil
+		settings, err := m.verifyingSettings(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		return settings.verifyingKey, nil
 	})
 
 	if err != nil {
@@ -286,7 +576,87 @@ func (m *Manager) Revoke(ctx context.Context, tokenValue string) error {
 		return err
 	}
 
-	return m.revocationList.Add(ctx, tokenID, exp.Time)
+	if err := m.revocationList.Add(ctx, tokenID, exp.Time); err != nil {
+		return err
+	}
+
+	m.emit(ctx, token.EventRevoked, token.Claims(claims), token.Claims(claims).TokenType(), exp.Time)
+	return nil
+}
+
+// RevokeAllForSubject revokes every access and refresh token issued to a
+// subject of a tenant so far by moving the subject's "not valid before"
+// watermark to now. The watermark and iat have millisecond precision, so
+// tokens issued right after the call (e.g., on the next login) stay valid.
+func (m *Manager) RevokeAllForSubject(ctx context.Context, tenantID, subject string) error {
+	if !m.config.EnableRevocation || m.watermarkStore == nil {
+		return errors.New("revocation not enabled")
+	}
+
+	if subject == "" {
+		return errors.New("subject is required")
+	}
+	// Single-tenant mode: tokens without tenant_id belong to the default tenant
+	tenantID, _ = m.config.SingleTenant.Apply(token.Claims{token.ClaimTenantID: tenantID}).Tenant()
+
+	if err := m.watermarkStore.SetNotBefore(ctx, tenantID, subject, time.Now().Truncate(time.Millisecond)); err != nil {
+		return err
+	}
+
+	m.emit(ctx, token.EventRevoked, token.Claims{"sub": subject, token.ClaimTenantID: tenantID}, "", time.Time{})
+	return nil
+}
+
+// isBeforeWatermark checks if a token was issued at or before the watermark
+// of its subject in its tenant
+func (m *Manager) isBeforeWatermark(ctx context.Context, claims jwt.MapClaims) bool {
+	if !m.config.EnableRevocation || m.watermarkStore == nil {
+		return false
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return false
+	}
+
+	tenantID, _ := m.config.SingleTenant.Apply(token.Claims(claims)).Tenant()
+	notBefore, ok, err := m.watermarkStore.GetNotBefore(ctx, tenantID, sub)
+	if err != nil || !ok {
+		return false
+	}
+
+	iat, ok := issuedAtOf(claims)
+	if !ok {
+		// Without issued-at the token cannot prove it is newer than the watermark
+		return true
+	}
+
+	return !iat.After(notBefore)
+}
+
+// issuedAt returns the iat claim of a token issued at t: seconds with
+// millisecond precision (a NumericDate may be fractional)
+func issuedAt(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+// issuedAtOf returns the iat claim of a token with millisecond precision
+// (claims.GetIssuedAt truncates it to seconds)
+func issuedAtOf(claims jwt.MapClaims) (time.Time, bool) {
+	var seconds float64
+	switch iat := claims["iat"].(type) {
+	case float64:
+		seconds = iat
+	case json.Number:
+		value, err := iat.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = value
+	default:
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(math.Round(seconds * 1000))), true
 }
 
 // Refresh generates a new access token from a refresh token
@@ -307,8 +677,56 @@ func (m *Manager) Refresh(ctx context.Context, refreshToken string) (*token.Toke
 		return nil, errors.New("not a refresh token")
 	}
 
-	// Generate new access token with same subject
-	return m.Generate(ctx, result.Claims)
+	// Generate new access token with same subject. The registered claims and
+	// type of the refresh token are dropped: the access token gets its own
+	// times, issuer and audience, and verifies as an access token.
+	claims := make(token.Claims, len(result.Claims))
+	maps.Copy(claims, result.Claims)
+	for _, claim := range []string{"iss", "aud", "exp", "nbf", "iat", "jti", "type"} {
+		delete(claims, claim)
+	}
+	accessToken, err := m.generate(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	m.emit(ctx, token.EventRefreshed, result.Claims, token.TokenTypeAccess, accessToken.ExpiresAt)
+	return accessToken, nil
+}
+
+// emit dispatches a token event (no-op without a dispatcher)
+func (m *Manager) emit(ctx context.Context, eventType token.EventType, claims token.Claims, tokenType string, expiresAt time.Time) {
+	if m.config.Events == nil {
+		return
+	}
+
+	sub, _ := claims.GetString("sub")
+	m.config.Events.Dispatch(ctx, &token.TokenEvent{
+		Type:      eventType,
+		Subject:   sub,
+		TokenType: tokenType,
+		Manager:   m.Type(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// emitVerificationFailed dispatches a verification failure event
+func (m *Manager) emitVerificationFailed(ctx context.Context, result *token.VerificationResult) {
+	if m.config.Events == nil {
+		return
+	}
+
+	event := &token.TokenEvent{
+		Type:    token.EventVerificationFailed,
+		Manager: m.Type(),
+		Error:   result.Error,
+	}
+	if result.Claims != nil {
+		event.Subject, _ = result.Claims.GetString("sub")
+		event.TokenType = result.Claims.TokenType()
+	}
+
+	m.config.Events.Dispatch(ctx, event)
 }
 
 // InMemoryRevocationList is an in-memory implementation of TokenRevocationList
@@ -0,0 +1,115 @@
+package jwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+)
+
+func TestRefreshIssuesAccessToken(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(DefaultConfig("test-secret-test-secret-test-secret"))
+	claims := token.Claims{"sub": "user-1", token.ClaimTenantID: "acme"}
+
+	refreshToken, err := manager.GenerateRefreshToken(ctx, claims)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	refreshed, err := manager.Refresh(ctx, refreshToken.Value)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	result, err := manager.VerifyWithOptions(ctx, refreshed.Value, &token.VerifyOptions{TokenType: token.TokenTypeAccess})
+	if err != nil {
+		t.Fatalf("VerifyWithOptions: %v", err)
+	}
+	if !result.Valid {
+		t.Fatalf("refreshed token is not a valid access token: %v", result.Error)
+	}
+
+	if tokenType := result.Claims.TokenType(); tokenType != token.TokenTypeAccess {
+		t.Errorf("type = %q, want %q", tokenType, token.TokenTypeAccess)
+	}
+	if sub, _ := result.Claims.GetString("sub"); sub != "user-1" {
+		t.Errorf("sub = %q, want user-1", sub)
+	}
+	if tenantID, _ := result.Claims.Tenant(); tenantID != "acme" {
+		t.Errorf("tenant = %q, want acme", tenantID)
+	}
+
+	exp, ok := result.Claims.GetInt64("exp")
+	if !ok {
+		t.Fatal("refreshed token has no exp")
+	}
+	if exp != refreshed.ExpiresAt.Unix() {
+		t.Errorf("exp = %d, want the reported expiry %d", exp, refreshed.ExpiresAt.Unix())
+	}
+	if lifetime := time.Until(time.Unix(exp, 0)); lifetime > 15*time.Minute {
+		t.Errorf("refreshed token lives %s, want at most the access token duration", lifetime)
+	}
+}
+
+func TestRefreshRejectsAccessToken(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(DefaultConfig("test-secret-test-secret-test-secret"))
+
+	accessToken, err := manager.Generate(ctx, token.Claims{"sub": "user-1"})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if _, err := manager.Refresh(ctx, accessToken.Value); err == nil {
+		t.Error("Refresh accepted an access token")
+	}
+
+	result, err := manager.VerifyWithOptions(ctx, accessToken.Value, &token.VerifyOptions{TokenType: token.TokenTypeRefresh})
+	if err != nil {
+		t.Fatalf("VerifyWithOptions: %v", err)
+	}
+	if result.Valid {
+		t.Error("an access token verified as a refresh token")
+	}
+}
+
+func TestVerifyBearerTokenType(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(DefaultConfig("test-secret-test-secret-test-secret"))
+	bearer := &token.VerifyOptions{TokenType: token.TokenTypeBearer}
+
+	tests := []struct {
+		name   string
+		claims token.Claims
+	}{
+		{"untyped", token.Claims{"sub": "user-1"}},
+		{"access", token.Claims{"sub": "user-1", "type": token.TokenTypeAccess}},
+		{"service", token.Claims{"sub": "sa-1", "type": "service"}},
+		{"system", token.Claims{"sub": "worker", "type": token.TokenTypeSystem}},
+	}
+	for _, tt := range tests {
+		tok, err := manager.Generate(ctx, tt.claims)
+		if err != nil {
+			t.Fatalf("%s: Generate: %v", tt.name, err)
+		}
+		result, err := manager.VerifyWithOptions(ctx, tok.Value, bearer)
+		if err != nil {
+			t.Fatalf("%s: VerifyWithOptions: %v", tt.name, err)
+		}
+		if !result.Valid {
+			t.Errorf("%s: not a valid bearer token: %v", tt.name, result.Error)
+		}
+	}
+
+	refreshToken, err := manager.GenerateRefreshToken(ctx, token.Claims{"sub": "user-1"})
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	result, err := manager.VerifyWithOptions(ctx, refreshToken.Value, bearer)
+	if err != nil {
+		t.Fatalf("VerifyWithOptions: %v", err)
+	}
+	if result.Valid {
+		t.Error("a refresh token verified as a bearer token")
+	}
+}
@@ -0,0 +1,288 @@
+package jwt
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/primadi/lokstra-auth/dbpool"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// PostgresTenantKeys stores the signing keys of tenants in a PostgreSQL
+// table (TenantKeyProvider). Private keys are stored as PKCS #8 and public
+// keys as PKIX (DER); HMAC secrets as is. Protect the table accordingly
+// (column encryption, restricted grants), or store verifying keys only and
+// sign with a key service (see SetSignerResolver). It works with any
+// database/sql PostgreSQL driver (pgx stdlib, lib/pq).
+type PostgresTenantKeys struct {
+	db      *dbpool.Pool
+	table   string
+	signers SignerResolver
+}
+
+// SignerResolver returns the signer of a stored tenant key that has no
+// signing key, e.g. the KMS key named after the key ID
+type SignerResolver func(ctx context.Context, tenantID string, key *TenantKey) (Signer, error)
+
+// NewPostgresTenantKeys creates a tenant key provider on a table (default:
+// "jwt_tenant_keys"). Call Migrate to create the table.
+func NewPostgresTenantKeys(db *sql.DB, table string) (*PostgresTenantKeys, error) {
+	return NewPostgresTenantKeysOnPool(dbpool.New(db, nil), table)
+}
+
+// NewPostgresTenantKeysOnPool creates a tenant key provider whose key
+// lookups go to the read replicas of a pool. A key set on the primary signs
+// and verifies once the replicas have applied it.
+func NewPostgresTenantKeysOnPool(db *dbpool.Pool, table string) (*PostgresTenantKeys, error) {
+	if table == "" {
+		table = "jwt_tenant_keys"
+	}
+	if !tableNamePattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %q", table)
+	}
+	return &PostgresTenantKeys{db: db, table: table}, nil
+}
+
+// Migrate creates the key table if it does not exist
+func (p *PostgresTenantKeys) Migrate(ctx context.Context) error {
+	statement := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id              TEXT NOT NULL,
+	key_id                 TEXT NOT NULL,
+	algorithm              TEXT NOT NULL DEFAULT '',
+	signing_key            BYTEA,
+	verifying_key          BYTEA,
+	issuer                 TEXT NOT NULL DEFAULT '',
+	audience               TEXT NOT NULL DEFAULT '[]',
+	access_token_duration  BIGINT NOT NULL DEFAULT 0,
+	refresh_token_duration BIGINT NOT NULL DEFAULT 0,
+	active                 BOOLEAN NOT NULL DEFAULT false,
+	created_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, key_id)
+)`, p.table)
+
+	if _, err := p.db.Primary().ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", p.table, err)
+	}
+	return nil
+}
+
+// SetSignerResolver sets the resolver of the signers of keys stored without
+// a signing key
+func (p *PostgresTenantKeys) SetSignerResolver(resolver SignerResolver) {
+	p.signers = resolver
+}
+
+// SetKey stores a key of a tenant and makes it the signing key. Previous
+// keys keep verifying their tokens until removed.
+func (p *PostgresTenantKeys) SetKey(ctx context.Context, tenantID string, key *TenantKey) error {
+	if tenantID == "" || key.KeyID == "" {
+		return errors.New("tenant ID and key ID are required")
+	}
+
+	signingKey, err := marshalKey(key.SigningKey, x509.MarshalPKCS8PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	verifyingKey, err := marshalKey(key.VerifyingKey, x509.MarshalPKIXPublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to encode verifying key: %w", err)
+	}
+	if signingKey == nil && verifyingKey == nil && key.Signer == nil {
+		return errors.New("signing key, verifying key or signer is required")
+	}
+
+	algorithm := ""
+	if key.SigningMethod != nil {
+		algorithm = key.SigningMethod.Alg()
+	}
+	audience, err := json.Marshal(key.Audience)
+	if err != nil {
+		return err
+	}
+
+	return p.db.Tx(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET active = false WHERE tenant_id = $1`, p.table), tenantID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+	(tenant_id, key_id, algorithm, signing_key, verifying_key, issuer, audience,
+	 access_token_duration, refresh_token_duration, active)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, true)
+	ON CONFLICT (tenant_id, key_id) DO UPDATE SET
+	algorithm = EXCLUDED.algorithm, signing_key = EXCLUDED.signing_key,
+	verifying_key = EXCLUDED.verifying_key, issuer = EXCLUDED.issuer,
+	audience = EXCLUDED.audience, access_token_duration = EXCLUDED.access_token_duration,
+	refresh_token_duration = EXCLUDED.refresh_token_duration, active = true,
+	created_at = now()`, p.table),
+			tenantID, key.KeyID, algorithm, signingKey, verifyingKey, key.Issuer, string(audience),
+			int64(key.AccessTokenDuration), int64(key.RefreshTokenDuration))
+		return err
+	})
+}
+
+// RemoveKey removes a key of a tenant. Removing the current key reverts the
+// tenant to its newest remaining key, or to the manager's key.
+func (p *PostgresTenantKeys) RemoveKey(ctx context.Context, tenantID, keyID string) error {
+	return p.db.Tx(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var active bool
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND key_id = $2 RETURNING active`, p.table),
+			tenantID, keyID).Scan(&active)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s/%s", ErrTenantKeyNotFound, tenantID, keyID)
+		}
+		if err != nil {
+			return err
+		}
+
+		if active {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %[1]s SET active = true
+		WHERE tenant_id = $1 AND key_id = (
+			SELECT key_id FROM %[1]s WHERE tenant_id = $1 ORDER BY created_at DESC LIMIT 1
+		)`, p.table), tenantID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SigningKey returns the current key of a tenant
+func (p *PostgresTenantKeys) SigningKey(ctx context.Context, tenantID string) (*TenantKey, error) {
+	key, err := p.queryKey(ctx, fmt.Sprintf(`SELECT %s FROM %s
+	WHERE tenant_id = $1 AND active`, keyColumns, p.table), tenantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrTenantKeyNotFound, tenantID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := p.resolveSigner(ctx, tenantID, key); err != nil {
+		return nil, err
+	}
+	if key.SigningKey == nil && key.Signer == nil {
+		return nil, fmt.Errorf("key %s/%s has no signing key", tenantID, key.KeyID)
+	}
+	return key, nil
+}
+
+// VerifyingKey returns a key of a tenant by ID
+func (p *PostgresTenantKeys) VerifyingKey(ctx context.Context, tenantID, keyID string) (*TenantKey, error) {
+	key, err := p.queryKey(ctx, fmt.Sprintf(`SELECT %s FROM %s
+	WHERE tenant_id = $1 AND key_id = $2`, keyColumns, p.table), tenantID, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrTenantKeyNotFound, tenantID, keyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.VerifyingKey == nil {
+		if err := p.resolveSigner(ctx, tenantID, key); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// queryKey reads one key row from a replica
+func (p *PostgresTenantKeys) queryKey(ctx context.Context, query string, args ...any) (*TenantKey, error) {
+	var key *TenantKey
+	err := p.db.Read(ctx, func(ctx context.Context, db *sql.DB) (err error) {
+		key, err = scanKey(db.QueryRowContext(ctx, query, args...))
+		return err
+	})
+	return key, err
+}
+
+// resolveSigner sets the signer of a key stored without a signing key
+func (p *PostgresTenantKeys) resolveSigner(ctx context.Context, tenantID string, key *TenantKey) error {
+	if key.SigningKey != nil || p.signers == nil {
+		return nil
+	}
+	signer, err := p.signers(ctx, tenantID, key)
+	if err != nil {
+		return fmt.Errorf("failed to resolve signer of key %s/%s: %w", tenantID, key.KeyID, err)
+	}
+	key.Signer = signer
+	return nil
+}
+
+const keyColumns = `key_id, algorithm, signing_key, verifying_key, issuer, audience,
+	access_token_duration, refresh_token_duration`
+
+// scanKey decodes a key row
+func scanKey(row *sql.Row) (*TenantKey, error) {
+	var (
+		key                   TenantKey
+		algorithm, audience   string
+		signingKey, verifying []byte
+		accessTTL, refreshTTL int64
+	)
+	if err := row.Scan(&key.KeyID, &algorithm, &signingKey, &verifying, &key.Issuer, &audience,
+		&accessTTL, &refreshTTL); err != nil {
+		return nil, err
+	}
+
+	if algorithm != "" {
+		if key.SigningMethod = jwt.GetSigningMethod(algorithm); key.SigningMethod == nil {
+			return nil, fmt.Errorf("key %s: unknown algorithm %q", key.KeyID, algorithm)
+		}
+	}
+	if err := json.Unmarshal([]byte(audience), &key.Audience); err != nil {
+		return nil, fmt.Errorf("key %s: invalid audience: %w", key.KeyID, err)
+	}
+	key.AccessTokenDuration = time.Duration(accessTTL)
+	key.RefreshTokenDuration = time.Duration(refreshTTL)
+
+	var err error
+	if key.SigningKey, err = unmarshalKey(signingKey, x509.ParsePKCS8PrivateKey); err != nil {
+		return nil, fmt.Errorf("key %s: invalid signing key: %w", key.KeyID, err)
+	}
+	if key.VerifyingKey, err = unmarshalKey(verifying, x509.ParsePKIXPublicKey); err != nil {
+		return nil, fmt.Errorf("key %s: invalid verifying key: %w", key.KeyID, err)
+	}
+	return &key, nil
+}
+
+// Stored keys are prefixed with their format
+const (
+	keyFormatSecret byte = 0
+	keyFormatDER    byte = 1
+)
+
+// marshalKey encodes a key: HMAC secrets as is, other keys with marshal
+func marshalKey(key any, marshal func(any) ([]byte, error)) ([]byte, error) {
+	switch key := key.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return append([]byte{keyFormatSecret}, key...), nil
+	default:
+		der, err := marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{keyFormatDER}, der...), nil
+	}
+}
+
+// unmarshalKey decodes a key encoded by marshalKey
+func unmarshalKey(data []byte, parse func([]byte) (any, error)) (any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	switch data[0] {
+	case keyFormatSecret:
+		return data[1:], nil
+	case keyFormatDER:
+		return parse(data[1:])
+	}
+	return nil, errors.New("unknown key format")
+}
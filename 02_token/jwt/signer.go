@@ -0,0 +1,286 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// Signer signs tokens with a key held outside the process (KMS, HSM, Vault
+// Transit), so the private key never lives in process memory. Tokens carry
+// the key version as "kid"; the manager verifies them locally with the
+// public key of that version, fetched once and cached.
+type Signer interface {
+	// Algorithm returns the JWT algorithm (e.g., "RS256", "PS256", "ES256")
+	Algorithm() string
+
+	// KeyID returns the ID of the key version that signs new tokens
+	KeyID(ctx context.Context) (string, error)
+
+	// Sign signs data (the JWS signing input) with a key version and returns
+	// the JWS signature (r || s for ECDSA)
+	Sign(ctx context.Context, keyID string, data []byte) ([]byte, error)
+
+	// PublicKey returns the public key of a key version
+	PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error)
+}
+
+// KMSClient signs digests with a cloud key service. It is satisfied by a
+// thin adapter over the AWS KMS Sign (MessageType DIGEST) and GetPublicKey
+// calls, or the GCP KMS AsymmetricSign and GetPublicKey calls, keeping the
+// SDKs out of this module's dependencies.
+type KMSClient interface {
+	// SignDigest signs a digest with a key (version) and returns the
+	// signature (PKCS #1 v1.5 or PSS, or ASN.1 DER for ECDSA)
+	SignDigest(ctx context.Context, keyID string, digest []byte) ([]byte, error)
+
+	// PublicKey returns the public key of a key (version) in PKIX DER form
+	PublicKey(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// KMSSigner signs tokens with a cloud KMS key (see KMSClient)
+type KMSSigner struct {
+	client    KMSClient
+	algorithm string
+	keyID     string
+}
+
+// NewKMSSigner creates a signer for a KMS key (version): an AWS KMS key ID
+// or ARN, or a GCP cryptoKeyVersion resource name
+func NewKMSSigner(client KMSClient, algorithm, keyID string) (*KMSSigner, error) {
+	if _, _, err := signatureHash(algorithm); err != nil {
+		return nil, err
+	}
+	return &KMSSigner{client: client, algorithm: algorithm, keyID: keyID}, nil
+}
+
+// Algorithm returns the JWT algorithm
+func (s *KMSSigner) Algorithm() string {
+	return s.algorithm
+}
+
+// KeyID returns the KMS key ID
+func (s *KMSSigner) KeyID(ctx context.Context) (string, error) {
+	return s.keyID, nil
+}
+
+// Sign signs data with the KMS key
+func (s *KMSSigner) Sign(ctx context.Context, keyID string, data []byte) ([]byte, error) {
+	hash, _, err := signatureHash(s.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(data)
+
+	signature, err := s.client.SignDigest(ctx, keyID, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return jwsSignature(s.algorithm, signature)
+}
+
+// PublicKey returns the public key of the KMS key
+func (s *KMSSigner) PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	der, err := s.client.PublicKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKIXPublicKey(der)
+}
+
+// CryptoSigner signs tokens with a crypto.Signer, e.g. an HSM key exposed
+// through a PKCS #11 library
+type CryptoSigner struct {
+	signer    crypto.Signer
+	algorithm string
+	keyID     string
+}
+
+// NewCryptoSigner creates a signer for a crypto.Signer
+func NewCryptoSigner(signer crypto.Signer, algorithm, keyID string) (*CryptoSigner, error) {
+	if _, _, err := signatureHash(algorithm); err != nil {
+		return nil, err
+	}
+	return &CryptoSigner{signer: signer, algorithm: algorithm, keyID: keyID}, nil
+}
+
+// Algorithm returns the JWT algorithm
+func (s *CryptoSigner) Algorithm() string {
+	return s.algorithm
+}
+
+// KeyID returns the key ID
+func (s *CryptoSigner) KeyID(ctx context.Context) (string, error) {
+	return s.keyID, nil
+}
+
+// Sign signs data with the crypto.Signer
+func (s *CryptoSigner) Sign(ctx context.Context, keyID string, data []byte) ([]byte, error) {
+	hash, opts, err := signatureHash(s.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := data // Ed25519 signs the message itself
+	if hash != 0 {
+		h := hash.New()
+		h.Write(data)
+		digest = h.Sum(nil)
+	}
+
+	signature, err := s.signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	return jwsSignature(s.algorithm, signature)
+}
+
+// PublicKey returns the public key of the crypto.Signer
+func (s *CryptoSigner) PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	if keyID != s.keyID {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	return s.signer.Public(), nil
+}
+
+// signatureHash returns the hash and signer options of an algorithm
+func signatureHash(algorithm string) (crypto.Hash, crypto.SignerOpts, error) {
+	switch algorithm {
+	case "RS256", "ES256":
+		return crypto.SHA256, crypto.SHA256, nil
+	case "RS384", "ES384":
+		return crypto.SHA384, crypto.SHA384, nil
+	case "RS512", "ES512":
+		return crypto.SHA512, crypto.SHA512, nil
+	case "PS256":
+		return crypto.SHA256, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}, nil
+	case "PS384":
+		return crypto.SHA384, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}, nil
+	case "PS512":
+		return crypto.SHA512, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512}, nil
+	case "EdDSA":
+		return 0, crypto.Hash(0), nil
+	}
+	return 0, nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, algorithm)
+}
+
+// jwsSignature converts an ASN.1 DER ECDSA signature to the JWS form
+// (r || s); other signatures are returned as is
+func jwsSignature(algorithm string, signature []byte) ([]byte, error) {
+	var size int
+	switch algorithm {
+	case "ES256":
+		size = 32
+	case "ES384":
+		size = 48
+	case "ES512":
+		size = 66
+	default:
+		return signature, nil
+	}
+
+	var parsed struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(signature, &parsed); err != nil || len(rest) > 0 {
+		if len(signature) == 2*size {
+			return signature, nil // already r || s
+		}
+		return nil, errors.New("invalid ECDSA signature")
+	}
+	out := make([]byte, 2*size)
+	parsed.R.FillBytes(out[:size])
+	parsed.S.FillBytes(out[size:])
+	return out, nil
+}
+
+// signerMethod signs tokens with a Signer. The signing key passed to
+// jwt.Token.SignedString is a *signerKey.
+type signerMethod struct {
+	algorithm string
+}
+
+// signerKey is the signer and key version of one signature
+type signerKey struct {
+	ctx    context.Context
+	signer Signer
+	keyID  string
+}
+
+func (m *signerMethod) Alg() string {
+	return m.algorithm
+}
+
+func (m *signerMethod) Sign(signingString string, key any) ([]byte, error) {
+	k, ok := key.(*signerKey)
+	if !ok {
+		return nil, jwt.ErrInvalidKeyType
+	}
+	return k.signer.Sign(k.ctx, k.keyID, []byte(signingString))
+}
+
+func (m *signerMethod) Verify(signingString string, sig []byte, key any) error {
+	method := jwt.GetSigningMethod(m.algorithm)
+	if method == nil {
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, m.algorithm)
+	}
+	return method.Verify(signingString, sig, key)
+}
+
+// withSigner returns the settings signing with a Signer, under a key ID
+// (the signer's key version when empty)
+func (m *Manager) withSigner(ctx context.Context, settings *keySettings, signer Signer, keyID string) (*keySettings, error) {
+	version, err := signer.KeyID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signer key: %w", err)
+	}
+	if keyID == "" {
+		keyID = version
+	}
+
+	settings.keyID = keyID
+	settings.method = &signerMethod{algorithm: signer.Algorithm()}
+	settings.signingKey = &signerKey{ctx: ctx, signer: signer, keyID: version}
+	return settings, nil
+}
+
+// signerPublicKey returns the public key of a signer key version, cached
+// under a cache key (key versions never change)
+func (m *Manager) signerPublicKey(ctx context.Context, signer Signer, cacheKey, keyID string) (crypto.PublicKey, error) {
+	if cached, ok := m.publicKeys.Load(cacheKey); ok {
+		return cached, nil
+	}
+
+	publicKey, err := signer.PublicKey(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key %s: %w", keyID, err)
+	}
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	m.publicKeys.Store(cacheKey, publicKey)
+	return publicKey, nil
+}
+
+// ed25519PublicKey returns a raw Ed25519 public key
+func ed25519PublicKey(raw []byte) (crypto.PublicKey, error) {
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
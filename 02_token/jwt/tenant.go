@@ -0,0 +1,309 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrTenantKeyNotFound = errors.New("tenant key not found")
+)
+
+// TenantKey is a signing key of a tenant with the token settings of the
+// tenant. Zero settings fall back to the manager configuration.
+type TenantKey struct {
+	// KeyID identifies the key within the tenant (required). Tokens carry
+	// "<tenant ID>/<key ID>" as their "kid" header.
+	KeyID string
+
+	// SigningMethod is the signing algorithm (default: the manager's)
+	SigningMethod jwt.SigningMethod
+
+	// SigningKey signs tokens (private key or HMAC secret)
+	SigningKey any
+
+	// VerifyingKey verifies tokens (public key, or the HMAC secret;
+	// default: SigningKey, or the public key of Signer)
+	VerifyingKey any
+
+	// Signer signs tokens with a key service instead of SigningKey
+	// (optional). Pin a key version: rotate by adding a new tenant key.
+	Signer Signer
+
+	// Issuer is the issuer of the tenant's tokens
+	Issuer string
+
+	// Audience is the audience of the tenant's tokens
+	Audience []string
+
+	// AccessTokenDuration is how long the tenant's access tokens are valid
+	AccessTokenDuration time.Duration
+
+	// RefreshTokenDuration is how long the tenant's refresh tokens are valid
+	RefreshTokenDuration time.Duration
+}
+
+// TenantKeyProvider provides the signing keys of tenants. The manager signs
+// the tokens of a tenant (tenant_id claim) with its current key, and
+// verifies tokens with the key named by their "kid" header.
+type TenantKeyProvider interface {
+	// SigningKey returns the current key of a tenant (ErrTenantKeyNotFound
+	// if the tenant uses the manager's key)
+	SigningKey(ctx context.Context, tenantID string) (*TenantKey, error)
+
+	// VerifyingKey returns a key of a tenant by ID, including keys rotated
+	// out but still verifying the tokens they signed
+	VerifyingKey(ctx context.Context, tenantID, keyID string) (*TenantKey, error)
+}
+
+// keySettings are the key and token settings used for one token
+type keySettings struct {
+	tenantID             string // "" for the manager's key
+	keyID                string // "kid" header ("" for the manager's key)
+	method               jwt.SigningMethod
+	signingKey           any
+	verifyingKey         any
+	issuer               string
+	audience             []string
+	accessTokenDuration  time.Duration
+	refreshTokenDuration time.Duration
+}
+
+// defaultSettings returns the settings of the manager's key
+func (m *Manager) defaultSettings() *keySettings {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+
+	verifyingKey := m.verifyingKey
+	if m.previousKey != nil && time.Now().Before(m.previousUntil) {
+		verifyingKey = jwt.VerificationKeySet{Keys: []jwt.VerificationKey{m.verifyingKey, m.previousKey}}
+	}
+
+	return &keySettings{
+		method:               m.config.SigningMethod,
+		signingKey:           m.signingKey,
+		verifyingKey:         verifyingKey,
+		issuer:               m.config.Issuer,
+		audience:             m.config.Audience,
+		accessTokenDuration:  m.config.AccessTokenDuration,
+		refreshTokenDuration: m.config.RefreshTokenDuration,
+	}
+}
+
+// tenantSettings returns the settings of a tenant key on top of the
+// manager's
+func (m *Manager) tenantSettings(tenantID string, key *TenantKey) *keySettings {
+	settings := m.defaultSettings()
+	settings.tenantID = tenantID
+	settings.keyID = tenantID + "/" + key.KeyID
+	settings.signingKey = key.SigningKey
+	settings.verifyingKey = key.VerifyingKey
+	if settings.verifyingKey == nil {
+		settings.verifyingKey = key.SigningKey
+	}
+	if key.SigningMethod != nil {
+		settings.method = key.SigningMethod
+	}
+	if key.Signer != nil {
+		settings.method = jwt.GetSigningMethod(key.Signer.Algorithm())
+	}
+	if key.Issuer != "" {
+		settings.issuer = key.Issuer
+	}
+	if len(key.Audience) > 0 {
+		settings.audience = key.Audience
+	}
+	if key.AccessTokenDuration > 0 {
+		settings.accessTokenDuration = key.AccessTokenDuration
+	}
+	if key.RefreshTokenDuration > 0 {
+		settings.refreshTokenDuration = key.RefreshTokenDuration
+	}
+	return settings
+}
+
+// signingSettings returns the settings that sign the tokens of a tenant
+func (m *Manager) signingSettings(ctx context.Context, tenantID string) (*keySettings, error) {
+	if m.config.TenantKeys != nil && tenantID != "" {
+		key, err := m.config.TenantKeys.SigningKey(ctx, tenantID)
+		switch {
+		case err == nil:
+			settings := m.tenantSettings(tenantID, key)
+			if key.Signer != nil {
+				return m.withSigner(ctx, settings, key.Signer, settings.keyID)
+			}
+			return settings, nil
+		case !errors.Is(err, ErrTenantKeyNotFound):
+			return nil, fmt.Errorf("failed to get signing key of tenant %s: %w", tenantID, err)
+		}
+	}
+
+	if m.config.Signer != nil {
+		return m.withSigner(ctx, m.defaultSettings(), m.config.Signer, "")
+	}
+	return m.defaultSettings(), nil
+}
+
+// verifyingSettings returns the settings that verify a token, from its
+// "kid" header
+func (m *Manager) verifyingSettings(ctx context.Context, t *jwt.Token) (*keySettings, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return m.defaultSettings(), nil
+	}
+
+	if tenantID, keyID, ok := strings.Cut(kid, "/"); ok && m.config.TenantKeys != nil {
+		key, err := m.config.TenantKeys.VerifyingKey(ctx, tenantID, keyID)
+		switch {
+		case err == nil:
+			settings := m.tenantSettings(tenantID, key)
+			if key.Signer != nil && key.VerifyingKey == nil {
+				version, err := key.Signer.KeyID(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if settings.verifyingKey, err = m.signerPublicKey(ctx, key.Signer, kid, version); err != nil {
+					return nil, err
+				}
+			}
+			return settings, nil
+		case m.config.Signer == nil || !errors.Is(err, ErrTenantKeyNotFound):
+			return nil, err
+		}
+	}
+
+	if m.config.Signer != nil {
+		publicKey, err := m.signerPublicKey(ctx, m.config.Signer, "signer:"+kid, kid)
+		if err != nil {
+			return nil, err
+		}
+		settings := m.defaultSettings()
+		settings.method = jwt.GetSigningMethod(m.config.Signer.Algorithm())
+		settings.verifyingKey = publicKey
+		return settings, nil
+	}
+	return m.defaultSettings(), nil
+}
+
+// checkTenantKey rejects tokens signed with the key of another tenant, and
+// tokens of a tenant with its own key signed with the manager's key
+func (m *Manager) checkTenantKey(ctx context.Context, settings *keySettings, claims jwt.MapClaims) error {
+	if m.config.TenantKeys == nil {
+		return nil
+	}
+
+	tenantID, _ := claims["tenant_id"].(string)
+	if settings.tenantID != "" {
+		if tenantID != settings.tenantID {
+			return fmt.Errorf("%w: signed with the key of tenant %q", ErrInvalidSignature, settings.tenantID)
+		}
+		return nil
+	}
+
+	if tenantID == "" {
+		return nil
+	}
+	_, err := m.config.TenantKeys.SigningKey(ctx, tenantID)
+	switch {
+	case errors.Is(err, ErrTenantKeyNotFound):
+		return nil
+	case err != nil:
+		return err
+	}
+	return fmt.Errorf("%w: tenant %q requires its own key", ErrInvalidSignature, tenantID)
+}
+
+// InMemoryTenantKeys is an in-memory implementation of TenantKeyProvider
+type InMemoryTenantKeys struct {
+	mu      sync.RWMutex
+	keys    map[string][]*TenantKey // tenantID -> keys, the current key last
+	current map[string]string       // tenantID -> current key ID
+}
+
+// NewInMemoryTenantKeys creates a new in-memory tenant key provider
+func NewInMemoryTenantKeys() *InMemoryTenantKeys {
+	return &InMemoryTenantKeys{
+		keys:    make(map[string][]*TenantKey),
+		current: make(map[string]string),
+	}
+}
+
+// SetKey adds a key to a tenant and makes it the signing key. Previous keys
+// keep verifying their tokens until removed.
+func (p *InMemoryTenantKeys) SetKey(ctx context.Context, tenantID string, key *TenantKey) error {
+	if tenantID == "" || key.KeyID == "" {
+		return errors.New("tenant ID and key ID are required")
+	}
+	if key.SigningKey == nil && key.Signer == nil {
+		return errors.New("signing key or signer is required")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	copied := *key
+	copied.Audience = slices.Clone(key.Audience)
+	keys := slices.DeleteFunc(p.keys[tenantID], func(k *TenantKey) bool { return k.KeyID == key.KeyID })
+	p.keys[tenantID] = append(keys, &copied)
+	p.current[tenantID] = key.KeyID
+	return nil
+}
+
+// RemoveKey removes a key of a tenant. Removing the current key reverts the
+// tenant to the previous key, or to the manager's key.
+func (p *InMemoryTenantKeys) RemoveKey(ctx context.Context, tenantID, keyID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := p.keys[tenantID]
+	index := slices.IndexFunc(keys, func(k *TenantKey) bool { return k.KeyID == keyID })
+	if index < 0 {
+		return fmt.Errorf("%w: %s/%s", ErrTenantKeyNotFound, tenantID, keyID)
+	}
+	keys = slices.Delete(keys, index, index+1)
+	if len(keys) == 0 {
+		delete(p.keys, tenantID)
+		delete(p.current, tenantID)
+		return nil
+	}
+	p.keys[tenantID] = keys
+	p.current[tenantID] = keys[len(keys)-1].KeyID
+	return nil
+}
+
+// SigningKey returns the current key of a tenant
+func (p *InMemoryTenantKeys) SigningKey(ctx context.Context, tenantID string) (*TenantKey, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	keyID, ok := p.current[tenantID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTenantKeyNotFound, tenantID)
+	}
+	return p.find(tenantID, keyID)
+}
+
+// VerifyingKey returns a key of a tenant by ID
+func (p *InMemoryTenantKeys) VerifyingKey(ctx context.Context, tenantID, keyID string) (*TenantKey, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.find(tenantID, keyID)
+}
+
+// find returns a key of a tenant. Caller must hold the lock.
+func (p *InMemoryTenantKeys) find(tenantID, keyID string) (*TenantKey, error) {
+	for _, key := range p.keys[tenantID] {
+		if key.KeyID == keyID {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s/%s", ErrTenantKeyNotFound, tenantID, keyID)
+}
@@ -0,0 +1,241 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultTransitConfig holds configuration for the Vault Transit signer
+type VaultTransitConfig struct {
+	// Address is the Vault server address (e.g., "https://vault:8200")
+	Address string
+
+	// Token is the Vault token used for requests
+	Token string
+
+	// Namespace is the Vault Enterprise namespace (optional)
+	Namespace string
+
+	// Mount is the mount path of the transit engine (default: "transit")
+	Mount string
+
+	// Key is the name of the transit key (RSA, ECDSA or Ed25519)
+	Key string
+
+	// Algorithm is the JWT algorithm matching the key type (e.g., "RS256",
+	// "PS256", "ES256", "EdDSA")
+	Algorithm string
+
+	// Version pins the key version that signs new tokens
+	// (default: the latest version, refreshed every minute)
+	Version int
+
+	// HTTPClient is the HTTP client (default: 10 second timeout)
+	HTTPClient *http.Client
+}
+
+// VaultTransitSigner signs tokens with a HashiCorp Vault Transit key using
+// the HTTP API. Key IDs are "<key>:v<version>".
+type VaultTransitSigner struct {
+	config *VaultTransitConfig
+
+	mu       sync.Mutex
+	latest   int
+	loadedAt time.Time
+}
+
+// NewVaultTransitSigner creates a Vault Transit signer
+func NewVaultTransitSigner(config *VaultTransitConfig) (*VaultTransitSigner, error) {
+	if config.Address == "" || config.Key == "" {
+		return nil, errors.New("vault address and key are required")
+	}
+	if _, _, err := signatureHash(config.Algorithm); err != nil {
+		return nil, err
+	}
+	if config.Mount == "" {
+		config.Mount = "transit"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &VaultTransitSigner{config: config}, nil
+}
+
+// Algorithm returns the JWT algorithm
+func (s *VaultTransitSigner) Algorithm() string {
+	return s.config.Algorithm
+}
+
+// KeyID returns the ID of the pinned or latest key version
+func (s *VaultTransitSigner) KeyID(ctx context.Context) (string, error) {
+	if s.config.Version > 0 {
+		return s.keyID(s.config.Version), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latest == 0 || time.Since(s.loadedAt) > time.Minute {
+		key, err := s.readKey(ctx)
+		if err != nil {
+			return "", err
+		}
+		s.latest, s.loadedAt = key.LatestVersion, time.Now()
+	}
+	return s.keyID(s.latest), nil
+}
+
+// Sign signs data with a key version
+func (s *VaultTransitSigner) Sign(ctx context.Context, keyID string, data []byte) ([]byte, error) {
+	version, err := s.version(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]any{
+		"input":       base64.StdEncoding.EncodeToString(data),
+		"key_version": version,
+	}
+	switch alg := s.config.Algorithm; {
+	case alg == "EdDSA":
+	case strings.HasPrefix(alg, "PS"):
+		request["hash_algorithm"] = "sha2-" + alg[2:]
+		request["signature_algorithm"] = "pss"
+	case strings.HasPrefix(alg, "RS"):
+		request["hash_algorithm"] = "sha2-" + alg[2:]
+		request["signature_algorithm"] = "pkcs1v15"
+	case strings.HasPrefix(alg, "ES"):
+		request["hash_algorithm"] = "sha2-" + alg[2:]
+		request["marshaling_algorithm"] = "jws"
+	}
+
+	var response struct {
+		Signature string `json:"signature"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/sign/"+s.config.Key, request, &response); err != nil {
+		return nil, err
+	}
+
+	// "vault:v<version>:<signature>"
+	parts := strings.SplitN(response.Signature, ":", 3)
+	if len(parts) != 3 {
+		return nil, errors.New("vault returned an invalid signature")
+	}
+	if strings.HasPrefix(s.config.Algorithm, "ES") {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+// PublicKey returns the public key of a key version
+func (s *VaultTransitSigner) PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	version, err := s.version(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.readKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := key.Keys[strconv.Itoa(version)]
+	if !ok || entry.PublicKey == "" {
+		return nil, fmt.Errorf("vault key %s has no public key", keyID)
+	}
+
+	if block, _ := pem.Decode([]byte(entry.PublicKey)); block != nil {
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	// Ed25519 public keys are returned base64 encoded
+	raw, err := base64.StdEncoding.DecodeString(entry.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("vault key %s has an invalid public key", keyID)
+	}
+	return ed25519PublicKey(raw)
+}
+
+// vaultKey is the transit key read endpoint response
+type vaultKey struct {
+	LatestVersion int `json:"latest_version"`
+	Keys          map[string]struct {
+		PublicKey string `json:"public_key"`
+	} `json:"keys"`
+}
+
+// readKey reads the transit key
+func (s *VaultTransitSigner) readKey(ctx context.Context) (*vaultKey, error) {
+	var key vaultKey
+	if err := s.do(ctx, http.MethodGet, "/keys/"+s.config.Key, nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// do calls the transit engine and decodes the "data" of the response
+func (s *VaultTransitSigner) do(ctx context.Context, method, path string, request, data any) error {
+	body := io.Reader(http.NoBody)
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	url := strings.TrimRight(s.config.Address, "/") + "/v1/" + strings.Trim(s.config.Mount, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", s.config.Token)
+	if s.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.config.Namespace)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return err
+	}
+	return json.Unmarshal(envelope.Data, data)
+}
+
+func (s *VaultTransitSigner) keyID(version int) string {
+	return s.config.Key + ":v" + strconv.Itoa(version)
+}
+
+// version parses the version of a key ID
+func (s *VaultTransitSigner) version(keyID string) (int, error) {
+	version, err := strconv.Atoi(strings.TrimPrefix(keyID, s.config.Key+":v"))
+	if err != nil || !strings.HasPrefix(keyID, s.config.Key+":v") || version <= 0 {
+		return 0, fmt.Errorf("unknown key %q", keyID)
+	}
+	return version, nil
+}
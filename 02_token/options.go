@@ -0,0 +1,161 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/permission"
+)
+
+var (
+	ErrAudienceMismatch  = autherrors.New(autherrors.ErrPermissionDenied, "token audience mismatch")
+	ErrInsufficientScope = autherrors.New(autherrors.ErrInsufficientScope, "token is missing required scopes")
+	ErrTokenTypeMismatch = autherrors.New(autherrors.ErrPermissionDenied, "token type mismatch")
+)
+
+// Token types carried in the "type" claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	TokenTypeSystem  = "system"
+
+	// TokenTypeMFAPending is the type of the tokens of logins awaiting the
+	// second factor their auth settings require: they are exchanged for
+	// access tokens once it is verified, and are no bearer credentials
+	TokenTypeMFAPending = "mfa_pending"
+)
+
+// TokenTypeBearer requires, as VerifyOptions.TokenType, a token presented as
+// a bearer credential: a token of any type but refresh and MFA-pending
+// tokens, so access tokens of users as well as service, app and system tokens
+const TokenTypeBearer = "bearer"
+
+// VerifyOptions are per-call verification requirements, allowing the same
+// token manager to protect multiple APIs with different audiences and scopes
+type VerifyOptions struct {
+	// Audience requires the token's aud claim to contain at least one of these values
+	Audience []string
+
+	// RequiredScopes requires the token to carry all of these scopes
+	// (from the "scopes" array claim or the space-delimited "scope" claim).
+	// Token scopes may be wildcard patterns (see package permission):
+	// "document:*" satisfies "document:read" but not "document", and a "*"
+	// scope satisfies any required scope.
+	RequiredScopes []string
+
+	// TokenType requires the token type ("access" or "refresh", or
+	// TokenTypeBearer for any bearer credential). Tokens without a "type"
+	// claim are access tokens.
+	TokenType string
+}
+
+// OptionsVerifier verifies tokens with per-call options
+type OptionsVerifier interface {
+	// VerifyWithOptions validates a token and enforces the options
+	VerifyWithOptions(ctx context.Context, tokenValue string, opts *VerifyOptions) (*VerificationResult, error)
+}
+
+// Check enforces the options against verified claims
+func (o *VerifyOptions) Check(claims Claims) error {
+	if o == nil {
+		return nil
+	}
+
+	if len(o.Audience) > 0 {
+		audiences := claims.Audience()
+		if !containsAny(audiences, o.Audience) {
+			return fmt.Errorf("%w: expected one of %v", ErrAudienceMismatch, o.Audience)
+		}
+	}
+
+	if len(o.RequiredScopes) > 0 {
+		scopes := claims.Scopes()
+		for _, required := range o.RequiredScopes {
+			if !permission.MatchAny(scopes, required) {
+				return fmt.Errorf("%w: %s", ErrInsufficientScope, required)
+			}
+		}
+	}
+
+	switch o.TokenType {
+	case "":
+	case TokenTypeBearer:
+		if tokenType := claims.TokenType(); tokenType == TokenTypeRefresh || tokenType == TokenTypeMFAPending {
+			return fmt.Errorf("%w: expected a bearer token", ErrTokenTypeMismatch)
+		}
+	default:
+		if claims.TokenType() != o.TokenType {
+			return fmt.Errorf("%w: expected %s", ErrTokenTypeMismatch, o.TokenType)
+		}
+	}
+
+	return nil
+}
+
+// Audience returns the aud claim as a slice (accepts a string or an array)
+func (c Claims) Audience() []string {
+	if aud, ok := c.GetString("aud"); ok {
+		return []string{aud}
+	}
+	aud, _ := c.GetStringSlice("aud")
+	return aud
+}
+
+// Scopes returns the token scopes from the "scopes" array or the
+// space-delimited OAuth2 "scope" claim
+func (c Claims) Scopes() []string {
+	if scopes, ok := c.GetStringSlice("scopes"); ok {
+		return scopes
+	}
+	if scope, ok := c.GetString("scope"); ok {
+		return strings.Fields(scope)
+	}
+	return nil
+}
+
+// TokenType returns the token type ("access" when no type claim is present)
+func (c Claims) TokenType() string {
+	if tokenType, ok := c.GetString("type"); ok && tokenType != "" {
+		return tokenType
+	}
+	return TokenTypeAccess
+}
+
+// Lifetimes override the token lifetimes of a token manager for the tokens
+// generated with a context (see WithLifetimes), e.g., from the auth settings
+// of a tenant. Zero durations keep the lifetimes of the manager.
+type Lifetimes struct {
+	// Access is how long access tokens are valid
+	Access time.Duration
+
+	// Refresh is how long refresh tokens are valid
+	Refresh time.Duration
+}
+
+type lifetimesContextKey struct{}
+
+// WithLifetimes returns a context whose generated tokens get the lifetimes
+func WithLifetimes(ctx context.Context, lifetimes Lifetimes) context.Context {
+	return context.WithValue(ctx, lifetimesContextKey{}, lifetimes)
+}
+
+// LifetimesFromContext returns the lifetimes of a context (zero if none)
+func LifetimesFromContext(ctx context.Context) Lifetimes {
+	lifetimes, _ := ctx.Value(lifetimesContextKey{}).(Lifetimes)
+	return lifetimes
+}
+
+// containsAny checks if any of the wanted values is in the slice
+func containsAny(values []string, wanted []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
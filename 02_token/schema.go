@@ -0,0 +1,244 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrClaimsSchema = autherrors.New(autherrors.ErrTokenInvalid, "claims do not match schema")
+)
+
+// ClaimType is the expected type of a claim value
+type ClaimType string
+
+const (
+	ClaimTypeString      ClaimType = "string"
+	ClaimTypeNumber      ClaimType = "number"
+	ClaimTypeBool        ClaimType = "bool"
+	ClaimTypeStringSlice ClaimType = "string_slice"
+	ClaimTypeObject      ClaimType = "object"
+	ClaimTypeAny         ClaimType = "any"
+)
+
+// ClaimField declares a claim in a schema
+type ClaimField struct {
+	// Name is the claim key
+	Name string
+
+	// Type is the expected value type
+	Type ClaimType
+
+	// Required indicates the claim must be present
+	Required bool
+}
+
+// ClaimsSchema declares the claims an application expects in its tokens.
+// Token managers validate claims against it on Generate and Verify.
+type ClaimsSchema struct {
+	Fields []ClaimField
+
+	// AllowUnknown permits claims not declared in the schema (default: true via NewClaimsSchema)
+	AllowUnknown bool
+}
+
+// registeredClaims are standard JWT claims that never count as unknown
+var registeredClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true,
+	"nbf": true, "iat": true, "jti": true, "type": true,
+}
+
+// NewClaimsSchema creates a schema from fields, allowing undeclared claims
+func NewClaimsSchema(fields ...ClaimField) *ClaimsSchema {
+	return &ClaimsSchema{
+		Fields:       fields,
+		AllowUnknown: true,
+	}
+}
+
+// Required adds a required claim to the schema
+func (s *ClaimsSchema) Required(name string, claimType ClaimType) *ClaimsSchema {
+	s.Fields = append(s.Fields, ClaimField{Name: name, Type: claimType, Required: true})
+	return s
+}
+
+// Optional adds an optional claim to the schema
+func (s *ClaimsSchema) Optional(name string, claimType ClaimType) *ClaimsSchema {
+	s.Fields = append(s.Fields, ClaimField{Name: name, Type: claimType})
+	return s
+}
+
+// Validate checks claims against the schema
+func (s *ClaimsSchema) Validate(claims Claims) error {
+	if s == nil {
+		return nil
+	}
+
+	declared := make(map[string]bool, len(s.Fields))
+	for _, field := range s.Fields {
+		declared[field.Name] = true
+
+		value, ok := claims[field.Name]
+		if !ok || value == nil {
+			if field.Required {
+				return fmt.Errorf("%w: missing required claim %q", ErrClaimsSchema, field.Name)
+			}
+			continue
+		}
+
+		if !matchesClaimType(value, field.Type) {
+			return fmt.Errorf("%w: claim %q must be %s, got %T", ErrClaimsSchema, field.Name, field.Type, value)
+		}
+	}
+
+	if !s.AllowUnknown {
+		for key := range claims {
+			if !declared[key] && !registeredClaims[key] {
+				return fmt.Errorf("%w: unknown claim %q", ErrClaimsSchema, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchesClaimType checks a claim value against a claim type.
+// Values decoded from JSON (float64, []any, map[string]any) are accepted.
+func matchesClaimType(value any, claimType ClaimType) bool {
+	switch claimType {
+	case ClaimTypeString:
+		_, ok := value.(string)
+		return ok
+	case ClaimTypeNumber:
+		switch value.(type) {
+		case int, int32, int64, float32, float64, json.Number:
+			return true
+		}
+		return false
+	case ClaimTypeBool:
+		_, ok := value.(bool)
+		return ok
+	case ClaimTypeStringSlice:
+		switch v := value.(type) {
+		case []string:
+			return true
+		case []any:
+			for _, item := range v {
+				if _, ok := item.(string); !ok {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case ClaimTypeObject:
+		switch value.(type) {
+		case map[string]any, Claims:
+			return true
+		}
+		return false
+	case ClaimTypeAny, "":
+		return true
+	default:
+		return false
+	}
+}
+
+// DecodeInto decodes claims into a user-defined struct using its json tags
+func (c Claims) DecodeInto(dst any) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode claims: %w", err)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("failed to decode claims: %w", err)
+	}
+	return nil
+}
+
+// DecodeClaims decodes claims into a new value of type T
+func DecodeClaims[T any](claims Claims) (*T, error) {
+	var result T
+	if err := claims.DecodeInto(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SchemaFor derives a claims schema from the json tags of struct type T.
+// Fields tagged `claims:"required"` are required; others are optional.
+//
+//	type MyClaims struct {
+//	    Subject  string   `json:"sub" claims:"required"`
+//	    TenantID string   `json:"tenant_id" claims:"required"`
+//	    Scopes   []string `json:"scopes"`
+//	}
+//	schema := token.SchemaFor[MyClaims]()
+func SchemaFor[T any]() *ClaimsSchema {
+	schema := NewClaimsSchema()
+
+	t := reflect.TypeFor[T]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return schema
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+
+		schema.Fields = append(schema.Fields, ClaimField{
+			Name:     name,
+			Type:     claimTypeOf(field.Type),
+			Required: field.Tag.Get("claims") == "required",
+		})
+	}
+
+	return schema
+}
+
+// claimTypeOf maps a Go type to a claim type
+func claimTypeOf(t reflect.Type) ClaimType {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return ClaimTypeString
+	case reflect.Bool:
+		return ClaimTypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return ClaimTypeNumber
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.String {
+			return ClaimTypeStringSlice
+		}
+		return ClaimTypeAny
+	case reflect.Map, reflect.Struct:
+		return ClaimTypeObject
+	default:
+		return ClaimTypeAny
+	}
+}
@@ -9,12 +9,13 @@ import (
 	"time"
 
 	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/autherrors"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token has expired")
-	ErrTokenRevoked = errors.New("token has been revoked")
+	ErrInvalidToken = autherrors.New(autherrors.ErrTokenInvalid, "invalid token")
+	ErrExpiredToken = autherrors.New(autherrors.ErrTokenExpired, "token has expired")
+	ErrTokenRevoked = autherrors.New(autherrors.ErrTokenRevoked, "token has been revoked")
 )
 
 // Config holds simple token manager configuration
@@ -30,6 +31,12 @@ type Config struct {
 
 	// EnableRevocation enables token revocation support
 	EnableRevocation bool
+
+	// ClaimsSchema validates claims on Generate and Verify (optional)
+	ClaimsSchema *token.ClaimsSchema
+
+	// Events receives token lifecycle events (optional)
+	Events *token.EventDispatcher
 }
 
 // DefaultConfig returns a default simple token configuration
@@ -84,6 +91,11 @@ func NewManager(config *Config) *Manager {
 
 // Generate creates a new opaque token from the provided claims
 func (m *Manager) Generate(ctx context.Context, claims token.Claims) (*token.Token, error) {
+	// Validate claims schema
+	if err := m.config.ClaimsSchema.Validate(claims); err != nil {
+		return nil, err
+	}
+
 	// Generate random token
 	tokenBytes := make([]byte, m.config.TokenLength)
 	if _, err := rand.Read(tokenBytes); err != nil {
@@ -91,8 +103,13 @@ func (m *Manager) Generate(ctx context.Context, claims token.Claims) (*token.Tok
 	}
 
 	tokenValue := base64.URLEncoding.EncodeToString(tokenBytes)
+	duration := m.config.TokenDuration
+	if lifetime := token.LifetimesFromContext(ctx).Access; lifetime > 0 {
+		duration = lifetime
+	}
+
 	now := time.Now()
-	expiresAt := now.Add(m.config.TokenDuration)
+	expiresAt := now.Add(duration)
 
 	// Store token and claims
 	m.mu.Lock()
@@ -100,6 +117,8 @@ func (m *Manager) Generate(ctx context.Context, claims token.Claims) (*token.Tok
 	m.tokenToExpiry[tokenValue] = expiresAt
 	m.mu.Unlock()
 
+	m.emit(ctx, token.EventIssued, claims, expiresAt)
+
 	return &token.Token{
 		Value:     tokenValue,
 		Type:      "Bearer",
@@ -113,6 +132,15 @@ func (m *Manager) Generate(ctx context.Context, claims token.Claims) (*token.Tok
 
 // Verify validates a token and extracts its claims
 func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.VerificationResult, error) {
+	result, err := m.verify(ctx, tokenValue)
+	if err == nil && !result.Valid {
+		m.emitVerificationFailed(ctx, result)
+	}
+	return result, err
+}
+
+// verify validates a token without emitting events
+func (m *Manager) verify(ctx context.Context, tokenValue string) (*token.VerificationResult, error) {
 	m.mu.RLock()
 	claims, ok := m.tokenToClaims[tokenValue]
 	expiresAt, expiryOk := m.tokenToExpiry[tokenValue]
@@ -156,6 +184,14 @@ func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.Verific
 		}
 	}
 
+	// Validate claims schema
+	if err := m.config.ClaimsSchema.Validate(claims); err != nil {
+		return &token.VerificationResult{
+			Valid: false,
+			Error: err,
+		}, nil
+	}
+
 	return &token.VerificationResult{
 		Valid:  true,
 		Claims: claims,
@@ -165,6 +201,27 @@ func (m *Manager) Verify(ctx context.Context, tokenValue string) (*token.Verific
 	}, nil
 }
 
+// VerifyWithOptions validates a token and enforces per-call options
+// (expected audience, required scopes, required token type)
+func (m *Manager) VerifyWithOptions(ctx context.Context, tokenValue string, opts *token.VerifyOptions) (*token.VerificationResult, error) {
+	result, err := m.Verify(ctx, tokenValue)
+	if err != nil || !result.Valid {
+		return result, err
+	}
+
+	if err := opts.Check(result.Claims); err != nil {
+		failed := &token.VerificationResult{
+			Valid:  false,
+			Claims: result.Claims,
+			Error:  err,
+		}
+		m.emitVerificationFailed(ctx, failed)
+		return failed, nil
+	}
+
+	return result, nil
+}
+
 // Type returns the type of tokens this manager handles
 func (m *Manager) Type() string {
 	return "simple"
@@ -178,13 +235,82 @@ func (m *Manager) Revoke(ctx context.Context, tokenValue string) error {
 
 	m.mu.RLock()
 	expiresAt, ok := m.tokenToExpiry[tokenValue]
+	claims := m.tokenToClaims[tokenValue]
 	m.mu.RUnlock()
 
 	if !ok {
 		return ErrInvalidToken
 	}
 
-	return m.revocationList.Add(ctx, tokenValue, expiresAt)
+	if err := m.revocationList.Add(ctx, tokenValue, expiresAt); err != nil {
+		return err
+	}
+
+	m.emit(ctx, token.EventRevoked, claims, expiresAt)
+	return nil
+}
+
+// RevokeAllForSubject revokes every token issued to a subject of a tenant
+// (and its tokens without a tenant, which cannot be told apart)
+func (m *Manager) RevokeAllForSubject(ctx context.Context, tenantID, subject string) error {
+	if !m.config.EnableRevocation {
+		return errors.New("revocation not enabled")
+	}
+
+	m.mu.RLock()
+	tokens := make(map[string]time.Time)
+	for tokenValue, claims := range m.tokenToClaims {
+		sub, _ := claims.GetString("sub")
+		tokenTenant, _ := claims.Tenant()
+		if sub == subject && (tokenTenant == tenantID || tokenTenant == "") {
+			tokens[tokenValue] = m.tokenToExpiry[tokenValue]
+		}
+	}
+	m.mu.RUnlock()
+
+	for tokenValue, expiresAt := range tokens {
+		if err := m.revocationList.Add(ctx, tokenValue, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	m.emit(ctx, token.EventRevoked, token.Claims{"sub": subject, token.ClaimTenantID: tenantID}, time.Time{})
+	return nil
+}
+
+// emit dispatches a token event (no-op without a dispatcher)
+func (m *Manager) emit(ctx context.Context, eventType token.EventType, claims token.Claims, expiresAt time.Time) {
+	if m.config.Events == nil {
+		return
+	}
+
+	sub, _ := claims.GetString("sub")
+	m.config.Events.Dispatch(ctx, &token.TokenEvent{
+		Type:      eventType,
+		Subject:   sub,
+		TokenType: token.TokenTypeAccess,
+		Manager:   m.Type(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// emitVerificationFailed dispatches a verification failure event
+func (m *Manager) emitVerificationFailed(ctx context.Context, result *token.VerificationResult) {
+	if m.config.Events == nil {
+		return
+	}
+
+	event := &token.TokenEvent{
+		Type:      token.EventVerificationFailed,
+		TokenType: token.TokenTypeAccess,
+		Manager:   m.Type(),
+		Error:     result.Error,
+	}
+	if result.Claims != nil {
+		event.Subject, _ = result.Claims.GetString("sub")
+	}
+
+	m.config.Events.Dispatch(ctx, event)
 }
 
 // cleanup removes expired tokens periodically
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
 )
 
 var (
-	ErrTokenNotFound = errors.New("token not found")
-	ErrTokenExists   = errors.New("token already exists")
+	ErrTokenNotFound = autherrors.New(autherrors.ErrNotFound, "token not found")
+	ErrTokenExists   = autherrors.New(autherrors.ErrConflict, "token already exists")
 )
 
 // InMemoryTokenStore is an in-memory implementation of TokenStore
@@ -130,6 +132,23 @@ func (s *InMemoryTokenStore) IsRevoked(ctx context.Context, tokenID string) (boo
 	return s.revoked[tokenID], nil
 }
 
+// RevokeAllForSubject revokes every token stored for a subject of a tenant.
+// Tokens without a tenant_id in their metadata cannot be told apart and are
+// revoked as well.
+func (s *InMemoryTokenStore) RevokeAllForSubject(ctx context.Context, tenantID, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenID, token := range s.tokens[subject] {
+		if tokenTenant, ok := token.Metadata[ClaimTenantID].(string); ok && tokenTenant != tenantID {
+			continue
+		}
+		s.revoked[tokenID] = true
+	}
+
+	return nil
+}
+
 // Cleanup removes expired tokens
 func (s *InMemoryTokenStore) Cleanup(ctx context.Context) error {
 	s.mu.Lock()
@@ -153,3 +172,47 @@ func (s *InMemoryTokenStore) Cleanup(ctx context.Context) error {
 
 	return nil
 }
+
+// InMemoryWatermarkStore is an in-memory implementation of WatermarkStore
+type InMemoryWatermarkStore struct {
+	mu         sync.RWMutex
+	watermarks map[string]time.Time // tenant + subject -> not valid before
+}
+
+// NewInMemoryWatermarkStore creates a new in-memory watermark store
+func NewInMemoryWatermarkStore() *InMemoryWatermarkStore {
+	return &InMemoryWatermarkStore{
+		watermarks: make(map[string]time.Time),
+	}
+}
+
+// SetNotBefore sets the watermark for a subject of a tenant
+func (s *InMemoryWatermarkStore) SetNotBefore(ctx context.Context, tenantID, subject string, notBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watermarks[watermarkKey(tenantID, subject)] = notBefore
+	return nil
+}
+
+// GetNotBefore retrieves the watermark for a subject of a tenant
+func (s *InMemoryWatermarkStore) GetNotBefore(ctx context.Context, tenantID, subject string) (time.Time, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notBefore, ok := s.watermarks[watermarkKey(tenantID, subject)]
+	return notBefore, ok, nil
+}
+
+// Delete removes the watermark for a subject of a tenant
+func (s *InMemoryWatermarkStore) Delete(ctx context.Context, tenantID, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.watermarks, watermarkKey(tenantID, subject))
+	return nil
+}
+
+func watermarkKey(tenantID, subject string) string {
+	return tenantID + "\x00" + subject
+}
@@ -0,0 +1,98 @@
+package token
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrTenantMismatch = autherrors.New(autherrors.ErrTenantMismatch, "token tenant mismatch")
+)
+
+// Tenant and app claims of multi-tenant tokens
+const (
+	ClaimTenantID = "tenant_id"
+	ClaimAppID    = "app_id"
+
+	// ClaimAllowedTenants lists the tenants a system token may act in
+	// ("*": every tenant)
+	ClaimAllowedTenants = "allowed_tenants"
+)
+
+// Tenant returns the tenant and app the claims were issued for ("" if absent)
+func (c Claims) Tenant() (tenantID, appID string) {
+	tenantID, _ = c.GetString(ClaimTenantID)
+	appID, _ = c.GetString(ClaimAppID)
+	return tenantID, appID
+}
+
+// IsSystem reports whether the claims are of a system token: a platform
+// service acting across tenants rather than a subject of one tenant
+func (c Claims) IsSystem() bool {
+	return c.TokenType() == TokenTypeSystem
+}
+
+// AllowedTenants returns the tenants a system token may act in (nil for
+// other tokens)
+func (c Claims) AllowedTenants() []string {
+	if !c.IsSystem() {
+		return nil
+	}
+	tenants, _ := c.GetStringSlice(ClaimAllowedTenants)
+	return tenants
+}
+
+// SingleTenant configures single-tenant mode: tokens without tenant_id /
+// app_id claims belong to a fixed default tenant and app, so applications
+// with one tenant never have to set them. Token managers inject the defaults
+// on Generate and Verify, and reject tokens of any other tenant or app.
+type SingleTenant struct {
+	// TenantID is the default tenant (e.g., "default")
+	TenantID string
+
+	// AppID is the default app (optional)
+	AppID string
+}
+
+// Check rejects claims issued for another tenant or app than the default
+func (s *SingleTenant) Check(claims Claims) error {
+	if s == nil {
+		return nil
+	}
+
+	tenantID, appID := claims.Tenant()
+	if tenantID != "" && s.TenantID != "" && tenantID != s.TenantID {
+		return fmt.Errorf("%w: tenant %q", ErrTenantMismatch, tenantID)
+	}
+	if appID != "" && s.AppID != "" && appID != s.AppID {
+		return fmt.Errorf("%w: app %q", ErrTenantMismatch, appID)
+	}
+	return nil
+}
+
+// Apply returns the claims with the default tenant and app injected where
+// missing. The claims are copied when changed.
+func (s *SingleTenant) Apply(claims Claims) Claims {
+	if s == nil {
+		return claims
+	}
+
+	tenantID, appID := claims.Tenant()
+	missingTenant := tenantID == "" && s.TenantID != ""
+	missingApp := appID == "" && s.AppID != ""
+	if !missingTenant && !missingApp {
+		return claims
+	}
+
+	applied := make(Claims, len(claims)+2)
+	maps.Copy(applied, claims)
+	if missingTenant {
+		applied[ClaimTenantID] = s.TenantID
+	}
+	if missingApp {
+		applied[ClaimAppID] = s.AppID
+	}
+	return applied
+}
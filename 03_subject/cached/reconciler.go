@@ -0,0 +1,277 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+var (
+	ErrReconcilerStopped = errors.New("reconciler is stopped")
+	ErrReconcilerBusy    = errors.New("reconciler queue is full")
+)
+
+// SubjectLoader loads the subject to rebuild an identity for
+type SubjectLoader func(ctx context.Context, subjectID string) (*subject.Subject, error)
+
+// ReconcilerConfig holds identity reconciler configuration
+type ReconcilerConfig struct {
+	// RoleStore finds the subjects impacted by a role change (required)
+	RoleStore subject.UserRoleStore
+
+	// Builder is the cached context builder to invalidate and rebuild (required)
+	Builder *ContextBuilder
+
+	// RebuildHot proactively rebuilds identities that were cached when the
+	// role changed (hot identities), instead of only invalidating them
+	RebuildHot bool
+
+	// SubjectLoader loads subjects for rebuilds
+	// (default: a user subject with only the ID set)
+	SubjectLoader SubjectLoader
+
+	// Workers is the number of concurrent subject workers (default: 4)
+	Workers int
+
+	// QueueSize is the number of pending role changes (default: 256)
+	QueueSize int
+
+	// OnProgress is called after each role is reconciled (optional)
+	OnProgress func(role string, stats ReconcilerStats)
+}
+
+// ReconcilerStats are progress metrics of a reconciler
+type ReconcilerStats struct {
+	RolesQueued         int64
+	RolesProcessed      int64
+	SubjectsInvalidated int64
+	SubjectsRebuilt     int64
+	Errors              int64
+	Pending             int
+	LastRun             time.Time
+}
+
+// Reconciler invalidates (and optionally rebuilds) the cached identities of
+// subjects impacted by role changes, in the background
+type Reconciler struct {
+	config *ReconcilerConfig
+
+	queue   chan string
+	mu      sync.Mutex
+	pending map[string]bool
+	started bool
+	stopped bool
+	done    chan struct{}
+
+	rolesQueued         atomic.Int64
+	rolesProcessed      atomic.Int64
+	subjectsInvalidated atomic.Int64
+	subjectsRebuilt     atomic.Int64
+	errors              atomic.Int64
+	lastRun             atomic.Int64
+}
+
+// NewReconciler creates a new identity reconciler. Call Start to run it.
+func NewReconciler(config *ReconcilerConfig) *Reconciler {
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 256
+	}
+	if config.SubjectLoader == nil {
+		config.SubjectLoader = func(ctx context.Context, subjectID string) (*subject.Subject, error) {
+			return &subject.Subject{ID: subjectID, Type: "user"}, nil
+		}
+	}
+
+	return &Reconciler{
+		config:  config,
+		queue:   make(chan string, config.QueueSize),
+		pending: make(map[string]bool),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start processes queued role changes until ctx is cancelled or Stop is called
+func (r *Reconciler) Start(ctx context.Context) {
+	r.mu.Lock()
+	if r.started || r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	r.started = true
+	r.mu.Unlock()
+
+	go func() {
+		defer close(r.done)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case role, ok := <-r.queue:
+				if !ok {
+					return
+				}
+
+				r.mu.Lock()
+				delete(r.pending, role)
+				r.mu.Unlock()
+
+				_ = r.ReconcileRole(ctx, role)
+			}
+		}
+	}()
+}
+
+// Stop stops accepting role changes and waits for queued changes to finish
+func (r *Reconciler) Stop() {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	r.stopped = true
+	started := r.started
+	close(r.queue)
+	r.mu.Unlock()
+
+	if started {
+		<-r.done
+	}
+}
+
+// NotifyRoleChanged queues a role for reconciliation without blocking.
+// Changes to a role that is already queued are coalesced.
+func (r *Reconciler) NotifyRoleChanged(role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return ErrReconcilerStopped
+	}
+	if r.pending[role] {
+		return nil
+	}
+
+	select {
+	case r.queue <- role:
+		r.pending[role] = true
+		r.rolesQueued.Add(1)
+		return nil
+	default:
+		return ErrReconcilerBusy
+	}
+}
+
+// Subscribe queues every RoleChanged event of the bus for reconciliation.
+// Call the returned function to unsubscribe.
+func (r *Reconciler) Subscribe(bus subject.InvalidationBus) func() {
+	return bus.Subscribe(func(ctx context.Context, event subject.ChangeEvent) {
+		if event.Kind == subject.RoleChanged && event.Role != "" {
+			_ = r.NotifyRoleChanged(event.Role)
+		}
+	})
+}
+
+// ReconcileRole synchronously invalidates (and optionally rebuilds) the
+// identities of all subjects that have the role
+func (r *Reconciler) ReconcileRole(ctx context.Context, role string) error {
+	defer func() {
+		r.rolesProcessed.Add(1)
+		r.lastRun.Store(time.Now().UnixNano())
+		if r.config.OnProgress != nil {
+			r.config.OnProgress(role, r.Stats())
+		}
+	}()
+
+	subjectIDs, err := r.config.RoleStore.ListSubjectsByRole(ctx, role)
+	if err != nil {
+		r.errors.Add(1)
+		return err
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	var firstErr error
+	var errOnce sync.Once
+
+	for i := 0; i < r.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for subjectID := range jobs {
+				if err := r.reconcileSubject(ctx, subjectID); err != nil {
+					r.errors.Add(1)
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+
+	for _, subjectID := range subjectIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- subjectID
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// reconcileSubject invalidates one subject's identity and rebuilds it if hot
+func (r *Reconciler) reconcileSubject(ctx context.Context, subjectID string) error {
+	hot := r.config.RebuildHot && r.config.Builder.IsCached(ctx, subjectID)
+
+	if err := r.config.Builder.Invalidate(ctx, subjectID); err != nil {
+		return err
+	}
+	r.subjectsInvalidated.Add(1)
+
+	if !hot {
+		return nil
+	}
+
+	sub, err := r.config.SubjectLoader(ctx, subjectID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.config.Builder.Build(ctx, sub); err != nil {
+		return err
+	}
+	r.subjectsRebuilt.Add(1)
+
+	return nil
+}
+
+// Stats returns progress metrics
+func (r *Reconciler) Stats() ReconcilerStats {
+	r.mu.Lock()
+	pending := len(r.pending)
+	r.mu.Unlock()
+
+	stats := ReconcilerStats{
+		RolesQueued:         r.rolesQueued.Load(),
+		RolesProcessed:      r.rolesProcessed.Load(),
+		SubjectsInvalidated: r.subjectsInvalidated.Load(),
+		SubjectsRebuilt:     r.subjectsRebuilt.Load(),
+		Errors:              r.errors.Load(),
+		Pending:             pending,
+	}
+	if last := r.lastRun.Load(); last > 0 {
+		stats.LastRun = time.Unix(0, last)
+	}
+
+	return stats
+}
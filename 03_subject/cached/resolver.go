@@ -12,8 +12,7 @@ import (
 // Resolver wraps a subject resolver with caching
 type Resolver struct {
 	baseResolver subject.SubjectResolver
-	cache        subject.IdentityCache
-	ttl          time.Duration
+	loader       *loader
 }
 
 // NewResolver creates a new cached subject resolver
@@ -27,11 +26,16 @@ func NewResolver(baseResolver subject.SubjectResolver, cache subject.IdentityCac
 
 	return &Resolver{
 		baseResolver: baseResolver,
-		cache:        cache,
-		ttl:          ttl,
+		loader:       newLoader(cache, ttl),
 	}
 }
 
+// SetOptions enables request coalescing, stale-while-revalidate and negative
+// caching. Call it before the resolver is used.
+func (r *Resolver) SetOptions(options *Options) {
+	r.loader.setOptions(options)
+}
+
 // Resolve creates a Subject from claims with caching
 func (r *Resolver) Resolve(ctx context.Context, claims map[string]any) (*subject.Subject, error) {
 	// Generate cache key from subject ID
@@ -43,31 +47,28 @@ func (r *Resolver) Resolve(ctx context.Context, claims map[string]any) (*subject
 
 	cacheKey := fmt.Sprintf("subject:%s", subID)
 
-	// Try to get from cache
-	if cached, err := r.cache.Get(ctx, cacheKey); err == nil && cached != nil && cached.Subject != nil {
-		return cached.Subject, nil
-	}
-
-	// Cache miss, resolve from base resolver
-	sub, err := r.baseResolver.Resolve(ctx, claims)
+	identity, err := r.loader.get(ctx, cacheKey, func(ctx context.Context) (*subject.IdentityContext, error) {
+		sub, err := r.baseResolver.Resolve(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		return &subject.IdentityContext{Subject: sub}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	// Cache the result
-	identity := &subject.IdentityContext{
-		Subject: sub,
+	if identity.Subject == nil {
+		return r.baseResolver.Resolve(ctx, claims)
 	}
-	_ = r.cache.Set(ctx, cacheKey, identity, int64(r.ttl.Seconds()))
 
-	return sub, nil
+	return identity.Subject, nil
 }
 
 // ContextBuilder wraps an identity context builder with caching
 type ContextBuilder struct {
 	baseBuilder subject.IdentityContextBuilder
 	cache       subject.IdentityCache
-	ttl         time.Duration
+	loader      *loader
 }
 
 // NewContextBuilder creates a new cached identity context builder
@@ -82,35 +83,48 @@ func NewContextBuilder(baseBuilder subject.IdentityContextBuilder, cache subject
 	return &ContextBuilder{
 		baseBuilder: baseBuilder,
 		cache:       cache,
-		ttl:         ttl,
+		loader:      newLoader(cache, ttl),
 	}
 }
 
+// SetOptions enables request coalescing, stale-while-revalidate and negative
+// caching. Call it before the builder is used.
+func (b *ContextBuilder) SetOptions(options *Options) {
+	b.loader.setOptions(options)
+}
+
 // Build creates an IdentityContext with caching
 func (b *ContextBuilder) Build(ctx context.Context, sub *subject.Subject) (*subject.IdentityContext, error) {
 	cacheKey := fmt.Sprintf("identity:%s", sub.ID)
 
-	// Try to get from cache
-	if cached, err := b.cache.Get(ctx, cacheKey); err == nil && cached != nil {
-		return cached, nil
-	}
-
-	// Cache miss, build from base builder
-	identity, err := b.baseBuilder.Build(ctx, sub)
-	if err != nil {
-		return nil, err
-	}
+	return b.loader.get(ctx, cacheKey, func(ctx context.Context) (*subject.IdentityContext, error) {
+		return b.baseBuilder.Build(ctx, sub)
+	})
+}
 
-	// Cache the result
-	_ = b.cache.Set(ctx, cacheKey, identity, int64(b.ttl.Seconds()))
+// Invalidate invalidates cached identity for a subject, including a cached
+// build failure
+func (b *ContextBuilder) Invalidate(ctx context.Context, subjectID string) error {
+	cacheKey := fmt.Sprintf("identity:%s", subjectID)
+	return b.loader.forget(ctx, cacheKey)
+}
 
-	return identity, nil
+// Subscribe purges the cached identity of a subject on every SubjectChanged
+// event of the bus. Role changes are handled by a Reconciler, which finds the
+// subjects of the role. Call the returned function to unsubscribe.
+func (b *ContextBuilder) Subscribe(bus subject.InvalidationBus) func() {
+	return bus.Subscribe(func(ctx context.Context, event subject.ChangeEvent) {
+		if event.Kind == subject.SubjectChanged && event.SubjectID != "" {
+			_ = b.Invalidate(ctx, event.SubjectID)
+		}
+	})
 }
 
-// Invalidate invalidates cached identity for a subject
-func (b *ContextBuilder) Invalidate(ctx context.Context, subjectID string) error {
+// IsCached checks if an identity is currently cached for a subject
+func (b *ContextBuilder) IsCached(ctx context.Context, subjectID string) bool {
 	cacheKey := fmt.Sprintf("identity:%s", subjectID)
-	return b.cache.Delete(ctx, cacheKey)
+	cached, err := b.cache.Get(ctx, cacheKey)
+	return err == nil && cached != nil
 }
 
 // InMemoryCache is an in-memory implementation of IdentityCache
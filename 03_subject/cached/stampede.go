@@ -0,0 +1,222 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/metrics"
+)
+
+// Options enables stampede protection for the cached resolver and builder
+type Options struct {
+	// Coalesce shares one load between concurrent misses of the same key
+	// (singleflight), so a hot subject is built once instead of N times
+	Coalesce bool
+
+	// StaleWhileRevalidate keeps serving an entry for this long after its
+	// TTL while one background load refreshes it (0: disabled)
+	StaleWhileRevalidate time.Duration
+
+	// RefreshTimeout bounds background refreshes (default: 10s)
+	RefreshTimeout time.Duration
+
+	// NegativeTTL caches failed loads for this long, so a missing or broken
+	// subject does not hit the providers on every request (0: disabled).
+	// Negative entries are kept per node.
+	NegativeTTL time.Duration
+
+	// IsNegative selects the errors to cache (default: every error except
+	// context cancellation and deadlines)
+	IsNegative func(err error) bool
+
+	// Metrics records lookups by key prefix, i.e. cache "subject" or
+	// "identity" (optional)
+	Metrics metrics.Recorder
+}
+
+// loadFunc loads an identity on a cache miss
+type loadFunc func(ctx context.Context) (*subject.IdentityContext, error)
+
+// negativeEntry is a cached load failure
+type negativeEntry struct {
+	err       error
+	expiresAt time.Time
+}
+
+// loader reads through an identity cache with the configured protections
+type loader struct {
+	cache   subject.IdentityCache
+	ttl     time.Duration
+	options *Options
+
+	group singleflight.Group
+
+	mu       sync.Mutex
+	negative map[string]negativeEntry
+}
+
+func newLoader(cache subject.IdentityCache, ttl time.Duration) *loader {
+	return &loader{
+		cache:    cache,
+		ttl:      ttl,
+		options:  &Options{},
+		negative: make(map[string]negativeEntry),
+	}
+}
+
+// setOptions applies option defaults and replaces the options
+func (l *loader) setOptions(options *Options) {
+	if options == nil {
+		options = &Options{}
+	}
+	if options.RefreshTimeout <= 0 {
+		options.RefreshTimeout = 10 * time.Second
+	}
+	if options.IsNegative == nil {
+		options.IsNegative = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	l.options = options
+}
+
+// get returns the cached identity of key, loading it on a miss
+func (l *loader) get(ctx context.Context, key string, load loadFunc) (*subject.IdentityContext, error) {
+	if err := l.negativeHit(key); err != nil {
+		l.observe(key, true)
+		return nil, err
+	}
+
+	cached, err := l.cache.Get(ctx, key)
+	hit := err == nil && cached != nil
+	l.observe(key, hit)
+	if hit {
+		if l.options.StaleWhileRevalidate > 0 && !l.isFresh(ctx, key) {
+			l.revalidate(ctx, key, load)
+		}
+		return cached, nil
+	}
+
+	if !l.options.Coalesce {
+		return l.fill(ctx, key, load)
+	}
+
+	result := l.group.DoChan(key, func() (any, error) {
+		return l.fill(ctx, key, load)
+	})
+
+	select {
+	case res := <-result:
+		// The shared load was cancelled with the context of another caller
+		if res.Err != nil && res.Shared && isContextError(res.Err) && ctx.Err() == nil {
+			return l.fill(ctx, key, load)
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*subject.IdentityContext), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// observe records a lookup of key, labeled by its prefix
+func (l *loader) observe(key string, hit bool) {
+	if l.options.Metrics != nil {
+		cache, _, _ := strings.Cut(key, ":")
+		l.options.Metrics.ObserveCache(cache, hit)
+	}
+}
+
+// fill loads an identity and caches the result (or the failure)
+func (l *loader) fill(ctx context.Context, key string, load loadFunc) (*subject.IdentityContext, error) {
+	identity, err := load(ctx)
+	if err != nil {
+		if l.options.NegativeTTL > 0 && l.options.IsNegative(err) {
+			l.mu.Lock()
+			l.negative[key] = negativeEntry{err: err, expiresAt: time.Now().Add(l.options.NegativeTTL)}
+			l.mu.Unlock()
+		}
+		return nil, err
+	}
+
+	ttl := l.ttl + l.options.StaleWhileRevalidate
+	_ = l.cache.Set(ctx, key, identity, int64(ttl.Seconds()))
+	if l.options.StaleWhileRevalidate > 0 {
+		// The marker expires with the TTL: without it the entry is stale
+		_ = l.cache.Set(ctx, freshKey(key), &subject.IdentityContext{}, int64(l.ttl.Seconds()))
+	}
+
+	return identity, nil
+}
+
+// revalidate refreshes a stale entry in the background, once per key
+func (l *loader) revalidate(ctx context.Context, key string, load loadFunc) {
+	refreshCtx := context.WithoutCancel(ctx)
+
+	go func() {
+		_, _, _ = l.group.Do("refresh:"+key, func() (any, error) {
+			ctx, cancel := context.WithTimeout(refreshCtx, l.options.RefreshTimeout)
+			defer cancel()
+
+			// Another node may have refreshed the entry already
+			if l.isFresh(ctx, key) {
+				return nil, nil
+			}
+			return l.fill(ctx, key, load)
+		})
+	}()
+}
+
+// isFresh reports whether the entry of key is within its TTL
+func (l *loader) isFresh(ctx context.Context, key string) bool {
+	marker, err := l.cache.Get(ctx, freshKey(key))
+	return err == nil && marker != nil
+}
+
+// negativeHit returns the cached failure of key, if any
+func (l *loader) negativeHit(key string) error {
+	if l.options.NegativeTTL <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.negative[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(l.negative, key)
+		return nil
+	}
+	return entry.err
+}
+
+// forget removes the entry of key, its freshness marker and cached failure
+func (l *loader) forget(ctx context.Context, key string) error {
+	l.mu.Lock()
+	delete(l.negative, key)
+	l.mu.Unlock()
+
+	if l.options.StaleWhileRevalidate > 0 {
+		_ = l.cache.Delete(ctx, freshKey(key))
+	}
+	return l.cache.Delete(ctx, key)
+}
+
+// freshKey is the cache key of the freshness marker of key
+func freshKey(key string) string {
+	return key + ":fresh"
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
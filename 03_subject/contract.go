@@ -2,6 +2,24 @@ package subject
 
 import (
 	"context"
+
+	"github.com/primadi/lokstra-auth/permission"
+)
+
+// Subject types
+const (
+	// SubjectTypeUser is a human user (the default subject type)
+	SubjectTypeUser = "user"
+
+	// SubjectTypeService is a service account, a machine identity
+	// authenticating with its own keys or secrets
+	SubjectTypeService = "service"
+
+	// SubjectTypeApp is an app of a tenant authenticating with an app key
+	SubjectTypeApp = "app"
+
+	// SubjectTypeSystem is a platform service holding a system token
+	SubjectTypeSystem = "system"
 )
 
 // Subject represents an authenticated entity
@@ -9,7 +27,8 @@ type Subject struct {
 	// ID is the unique identifier for the subject
 	ID string
 
-	// Type indicates the subject type (e.g., "user", "service", "device")
+	// Type indicates the subject type (e.g., SubjectTypeUser,
+	// SubjectTypeService, "device")
 	Type string
 
 	// Principal is the primary identifier (e.g., username, email, service name)
@@ -19,6 +38,19 @@ type Subject struct {
 	Attributes map[string]any
 }
 
+// IsMachine reports whether the subject is a non-human identity: a service
+// account, an app or a system service
+func (s *Subject) IsMachine() bool {
+	if s == nil {
+		return false
+	}
+	switch s.Type {
+	case SubjectTypeService, SubjectTypeApp, SubjectTypeSystem:
+		return true
+	}
+	return false
+}
+
 // IdentityContext represents the complete identity context
 type IdentityContext struct {
 	// Subject is the authenticated subject
@@ -60,10 +92,61 @@ type SessionInfo struct {
 	// UserAgent is the client user agent
 	UserAgent string
 
+	// LastActivityAt is when the session was last used (for idle timeouts)
+	LastActivityAt int64
+
+	// Device is the registered device the session was created from (optional)
+	Device *DeviceInfo
+
+	// Location is the resolved location of IPAddress (see enriched.GeoIPEnricher)
+	Location *GeoLocation
+
+	// IPReputation is the reputation of IPAddress (see enriched.GeoIPEnricher)
+	IPReputation *IPReputation
+
 	// Metadata contains additional session metadata
 	Metadata map[string]any
 }
 
+// DeviceInfo describes a device registered by a subject
+type DeviceInfo struct {
+	// ID is the device identifier
+	ID string
+
+	// SubjectID is the owner of the device
+	SubjectID string
+
+	// FingerprintHash is the SHA-256 hash of the device fingerprint
+	FingerprintHash string
+
+	// Platform is the device platform (e.g., "ios", "android", "web")
+	Platform string
+
+	// Name is a display name (e.g., "Chrome on macOS")
+	Name string
+
+	// Trusted devices may skip MFA
+	Trusted bool
+
+	// TrustedAt is when the device was marked as trusted (0 = never)
+	TrustedAt int64
+
+	// FirstSeenAt is when the device was registered
+	FirstSeenAt int64
+
+	// LastSeenAt is when the device was last used to log in
+	LastSeenAt int64
+
+	// LastIPAddress is the client IP address of the last login
+	LastIPAddress string
+
+	// LastUserAgent is the client user agent of the last login
+	LastUserAgent string
+
+	// Metadata contains additional device metadata
+	Metadata map[string]any
+}
+
 // HasRole checks if the identity has a specific role
 func (ic *IdentityContext) HasRole(role string) bool {
 	for _, r := range ic.Roles {
@@ -74,14 +157,10 @@ func (ic *IdentityContext) HasRole(role string) bool {
 	return false
 }
 
-// HasPermission checks if the identity has a specific permission
-func (ic *IdentityContext) HasPermission(permission string) bool {
-	for _, p := range ic.Permissions {
-		if p == permission {
-			return true
-		}
-	}
-	return false
+// HasPermission checks if the identity has a specific permission; granted
+// permissions may be wildcard patterns (see package permission)
+func (ic *IdentityContext) HasPermission(required string) bool {
+	return permission.MatchAny(ic.Permissions, required)
 }
 
 // HasAnyRole checks if the identity has any of the specified roles
@@ -122,6 +201,13 @@ type RoleProvider interface {
 	GetRoles(ctx context.Context, subject *Subject) ([]string, error)
 }
 
+// UserRoleStore looks up the subjects assigned to a role
+// (reverse of RoleProvider, used to find subjects impacted by role changes)
+type UserRoleStore interface {
+	// ListSubjectsByRole returns the IDs of subjects that have the role
+	ListSubjectsByRole(ctx context.Context, role string) ([]string, error)
+}
+
 // PermissionProvider provides permissions for a subject
 type PermissionProvider interface {
 	// GetPermissions retrieves permissions for a subject
@@ -140,6 +226,16 @@ type ProfileProvider interface {
 	GetProfile(ctx context.Context, subject *Subject) (map[string]any, error)
 }
 
+// ProfileStore is a ProfileProvider whose profiles can be changed, e.g., by
+// users managing their own profile
+type ProfileStore interface {
+	ProfileProvider
+
+	// UpdateProfile sets the attributes of the profile of a subject; nil
+	// values remove attributes, other attributes are kept
+	UpdateProfile(ctx context.Context, subject *Subject, changes map[string]any) error
+}
+
 // DataEnricher enriches identity context with additional data
 type DataEnricher interface {
 	// Enrich adds additional data to the identity context
@@ -161,6 +257,36 @@ type IdentityStore interface {
 	Update(ctx context.Context, sessionID string, identity *IdentityContext) error
 }
 
+// SubjectSessionStore is an IdentityStore that can list and delete the
+// sessions of a subject
+type SubjectSessionStore interface {
+	IdentityStore
+
+	// ListBySubject lists all active sessions of a subject
+	ListBySubject(ctx context.Context, subjectID string) ([]*IdentityContext, error)
+
+	// DeleteBySubject deletes all sessions of a subject
+	DeleteBySubject(ctx context.Context, subjectID string) error
+}
+
+// DeviceStore stores the devices registered by subjects
+type DeviceStore interface {
+	// SaveDevice creates or replaces a device
+	SaveDevice(ctx context.Context, device *DeviceInfo) error
+
+	// GetDevice retrieves a device of a subject
+	GetDevice(ctx context.Context, subjectID, deviceID string) (*DeviceInfo, error)
+
+	// FindDevice retrieves a device of a subject by fingerprint hash
+	FindDevice(ctx context.Context, subjectID, fingerprintHash string) (*DeviceInfo, error)
+
+	// ListDevices lists the devices of a subject
+	ListDevices(ctx context.Context, subjectID string) ([]*DeviceInfo, error)
+
+	// DeleteDevice removes a device of a subject
+	DeleteDevice(ctx context.Context, subjectID, deviceID string) error
+}
+
 // IdentityCache caches identity contexts for performance
 type IdentityCache interface {
 	// Set caches an identity context
@@ -0,0 +1,104 @@
+package subject
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrDeviceNotFound = autherrors.New(autherrors.ErrNotFound, "device not found")
+)
+
+// InMemoryDeviceStore is an in-memory implementation of DeviceStore
+type InMemoryDeviceStore struct {
+	mu      sync.RWMutex
+	devices map[string]map[string]*DeviceInfo // subjectID -> deviceID -> device
+}
+
+// NewInMemoryDeviceStore creates a new in-memory device store
+func NewInMemoryDeviceStore() *InMemoryDeviceStore {
+	return &InMemoryDeviceStore{
+		devices: make(map[string]map[string]*DeviceInfo),
+	}
+}
+
+// SaveDevice creates or replaces a device
+func (s *InMemoryDeviceStore) SaveDevice(ctx context.Context, device *DeviceInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.devices[device.SubjectID]; !ok {
+		s.devices[device.SubjectID] = make(map[string]*DeviceInfo)
+	}
+
+	copied := *device
+	s.devices[device.SubjectID][device.ID] = &copied
+	return nil
+}
+
+// GetDevice retrieves a device of a subject
+func (s *InMemoryDeviceStore) GetDevice(ctx context.Context, subjectID, deviceID string) (*DeviceInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	device, ok := s.devices[subjectID][deviceID]
+	if !ok {
+		return nil, ErrDeviceNotFound
+	}
+
+	copied := *device
+	return &copied, nil
+}
+
+// FindDevice retrieves a device of a subject by fingerprint hash
+func (s *InMemoryDeviceStore) FindDevice(ctx context.Context, subjectID, fingerprintHash string) (*DeviceInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, device := range s.devices[subjectID] {
+		if device.FingerprintHash == fingerprintHash {
+			copied := *device
+			return &copied, nil
+		}
+	}
+
+	return nil, ErrDeviceNotFound
+}
+
+// ListDevices lists the devices of a subject (most recently seen first)
+func (s *InMemoryDeviceStore) ListDevices(ctx context.Context, subjectID string) ([]*DeviceInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	devices := make([]*DeviceInfo, 0, len(s.devices[subjectID]))
+	for _, device := range s.devices[subjectID] {
+		copied := *device
+		devices = append(devices, &copied)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].LastSeenAt > devices[j].LastSeenAt
+	})
+
+	return devices, nil
+}
+
+// DeleteDevice removes a device of a subject
+func (s *InMemoryDeviceStore) DeleteDevice(ctx context.Context, subjectID, deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.devices[subjectID][deviceID]; !ok {
+		return ErrDeviceNotFound
+	}
+
+	delete(s.devices[subjectID], deviceID)
+	if len(s.devices[subjectID]) == 0 {
+		delete(s.devices, subjectID)
+	}
+
+	return nil
+}
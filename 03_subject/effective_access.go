@@ -0,0 +1,42 @@
+package subject
+
+import (
+	"context"
+	"time"
+)
+
+// EffectiveAccess is everything identity building needs about a user in an
+// app of a tenant, as resolved by an EffectiveAccessStore
+type EffectiveAccess struct {
+	// Roles are the assigned roles, sorted
+	Roles []string
+
+	// DirectPermissions are the permissions granted to the user itself,
+	// sorted
+	DirectPermissions []string
+
+	// Permissions are the direct permissions and the permissions of the
+	// roles, sorted and without duplicates
+	Permissions []string
+
+	// Groups are the group memberships, sorted
+	Groups []string
+
+	// RoleExpiries are the expiries of time-bound roles (optional, see
+	// RoleExpiryKey)
+	RoleExpiries map[string]time.Time
+}
+
+// EffectiveAccessStore resolves the roles, permissions and groups of a user
+// at once, e.g., in one database round-trip, instead of one call per
+// provider. Context builders use it in place of the role, permission and
+// group providers (see simple.ContextBuilder.SetEffectiveAccessStore).
+type EffectiveAccessStore interface {
+	// GetEffectiveAccess returns the access of a user in an app of a tenant
+	// (a user without access is not an error)
+	GetEffectiveAccess(ctx context.Context, tenantID, appID, userID string) (*EffectiveAccess, error)
+}
+
+// AccessScopeFunc returns the tenant and app of a request (e.g.,
+// rbac.AccessScope)
+type AccessScopeFunc func(ctx context.Context) (tenantID, appID string)
@@ -0,0 +1,226 @@
+package enriched
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sort"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+// GeoIPReader resolves IP addresses to locations
+type GeoIPReader interface {
+	// LookupIP returns the location of an IP address (nil if unknown)
+	LookupIP(ip net.IP) (*subject.GeoLocation, error)
+}
+
+// GeoIPReaderFunc adapts a function to GeoIPReader
+type GeoIPReaderFunc func(ip net.IP) (*subject.GeoLocation, error)
+
+// LookupIP calls f(ip)
+func (f GeoIPReaderFunc) LookupIP(ip net.IP) (*subject.GeoLocation, error) {
+	return f(ip)
+}
+
+// IPReputationProvider scores IP addresses (e.g., a threat intelligence feed)
+type IPReputationProvider interface {
+	// Reputation returns the reputation of an IP address (nil if unknown)
+	Reputation(ctx context.Context, ip net.IP) (*subject.IPReputation, error)
+}
+
+// GeoIPEnricher resolves the client IP address of the identity into country,
+// city and ASN attributes (and optionally its reputation) on
+// IdentityContext.Session. The attributes are exposed to ABAC "environment"
+// conditions through SessionInfo.EnvironmentAttributes.
+//
+// The IP address is taken from Session.IPAddress, or from the request context
+// (subject.WithClientIP). Lookup failures never fail identity building: the
+// session is simply left without location.
+type GeoIPEnricher struct {
+	reader     GeoIPReader
+	reputation IPReputationProvider
+}
+
+// NewGeoIPEnricher creates a new GeoIP enricher. reader or reputation may be nil.
+func NewGeoIPEnricher(reader GeoIPReader, reputation IPReputationProvider) *GeoIPEnricher {
+	return &GeoIPEnricher{
+		reader:     reader,
+		reputation: reputation,
+	}
+}
+
+// Enrich adds location and IP reputation to the identity session
+func (e *GeoIPEnricher) Enrich(ctx context.Context, identity *subject.IdentityContext) error {
+	ipAddress := ""
+	if identity.Session != nil {
+		ipAddress = identity.Session.IPAddress
+	}
+	if ipAddress == "" {
+		ipAddress = subject.ClientIPFromContext(ctx)
+	}
+
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return nil
+	}
+
+	var location *subject.GeoLocation
+	if e.reader != nil {
+		location, _ = e.reader.LookupIP(ip)
+	}
+
+	var reputation *subject.IPReputation
+	if e.reputation != nil {
+		reputation, _ = e.reputation.Reputation(ctx, ip)
+	}
+
+	if location == nil && reputation == nil {
+		return nil
+	}
+
+	if identity.Session == nil {
+		identity.Session = &subject.SessionInfo{}
+	}
+	identity.Session.IPAddress = ipAddress
+	identity.Session.Location = location
+	identity.Session.IPReputation = reputation
+
+	return nil
+}
+
+// MaxMindDB is a MaxMind DB reader (e.g., *maxminddb.Reader of
+// github.com/oschwald/maxminddb-golang opened on a GeoIP2/GeoLite2 file)
+type MaxMindDB interface {
+	Lookup(ip net.IP, result any) error
+}
+
+// maxMindCity is the subset of a GeoIP2/GeoLite2 City record used here
+type maxMindCity struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+}
+
+// maxMindASN is a GeoIP2/GeoLite2 ASN record
+type maxMindASN struct {
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// MaxMindReader is a GeoIPReader over MaxMind City and ASN databases
+type MaxMindReader struct {
+	cityDB MaxMindDB
+	asnDB  MaxMindDB
+}
+
+// NewMaxMindReader creates a GeoIPReader from a City database and an ASN
+// database (either may be nil)
+func NewMaxMindReader(cityDB, asnDB MaxMindDB) *MaxMindReader {
+	return &MaxMindReader{
+		cityDB: cityDB,
+		asnDB:  asnDB,
+	}
+}
+
+// LookupIP returns the location of an IP address
+func (r *MaxMindReader) LookupIP(ip net.IP) (*subject.GeoLocation, error) {
+	location := &subject.GeoLocation{}
+	found := false
+
+	if r.cityDB != nil {
+		var city maxMindCity
+		if err := r.cityDB.Lookup(ip, &city); err != nil {
+			return nil, err
+		}
+		if city.Country.ISOCode != "" {
+			found = true
+			location.CountryCode = city.Country.ISOCode
+			location.CountryName = city.Country.Names["en"]
+			location.City = city.City.Names["en"]
+			location.TimeZone = city.Location.TimeZone
+			location.Latitude = city.Location.Latitude
+			location.Longitude = city.Location.Longitude
+			if len(city.Subdivisions) > 0 {
+				location.Region = city.Subdivisions[0].Names["en"]
+			}
+		}
+	}
+
+	if r.asnDB != nil {
+		var asn maxMindASN
+		if err := r.asnDB.Lookup(ip, &asn); err != nil {
+			return nil, err
+		}
+		if asn.AutonomousSystemNumber != 0 {
+			found = true
+			location.ASN = asn.AutonomousSystemNumber
+			location.ASOrganization = asn.AutonomousSystemOrganization
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return location, nil
+}
+
+// CIDRGeoIPReader resolves IP addresses from a static table of network
+// prefixes (e.g., office and VPN ranges, or fixtures for development)
+type CIDRGeoIPReader struct {
+	entries []cidrEntry
+}
+
+type cidrEntry struct {
+	prefix   netip.Prefix
+	location *subject.GeoLocation
+}
+
+// NewCIDRGeoIPReader creates a reader from CIDR -> location entries.
+// The most specific matching prefix wins.
+func NewCIDRGeoIPReader(table map[string]*subject.GeoLocation) (*CIDRGeoIPReader, error) {
+	reader := &CIDRGeoIPReader{}
+	for cidr, location := range table {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		reader.entries = append(reader.entries, cidrEntry{prefix: prefix.Masked(), location: location})
+	}
+
+	sort.Slice(reader.entries, func(i, j int) bool {
+		return reader.entries[i].prefix.Bits() > reader.entries[j].prefix.Bits()
+	})
+
+	return reader, nil
+}
+
+// LookupIP returns the location of the most specific matching prefix
+func (r *CIDRGeoIPReader) LookupIP(ip net.IP) (*subject.GeoLocation, error) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return nil, nil
+	}
+	addr = addr.Unmap()
+
+	for _, entry := range r.entries {
+		if entry.prefix.Contains(addr) {
+			location := *entry.location
+			return &location, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,94 @@
+package subject
+
+import (
+	"context"
+)
+
+// GeoLocation is the resolved location of a client IP address
+type GeoLocation struct {
+	// CountryCode is the ISO 3166-1 alpha-2 country code (e.g., "ID", "US")
+	CountryCode string
+
+	// CountryName is the English country name
+	CountryName string
+
+	// Region is the first-level subdivision (e.g., province or state)
+	Region string
+
+	// City is the city name
+	City string
+
+	// TimeZone is the IANA time zone (e.g., "Asia/Jakarta")
+	TimeZone string
+
+	// Latitude and Longitude are approximate coordinates
+	Latitude  float64
+	Longitude float64
+
+	// ASN is the autonomous system number of the network
+	ASN uint
+
+	// ASOrganization is the organization owning the ASN
+	ASOrganization string
+}
+
+// IPReputation is the reputation of a client IP address
+type IPReputation struct {
+	// Score is the risk score from 0 (clean) to 100 (malicious)
+	Score float64
+
+	// Tags classify the address (e.g., "tor", "proxy", "vpn", "hosting")
+	Tags []string
+
+	// Malicious reports whether the address is known to be malicious
+	Malicious bool
+}
+
+// EnvironmentAttributes returns the session attributes exposed to ABAC
+// "environment" conditions (e.g., environment.country in ["ID", "SG"])
+func (s *SessionInfo) EnvironmentAttributes() map[string]any {
+	attrs := make(map[string]any)
+	if s == nil {
+		return attrs
+	}
+
+	if s.IPAddress != "" {
+		attrs["ip_address"] = s.IPAddress
+	}
+
+	if loc := s.Location; loc != nil {
+		attrs["country"] = loc.CountryCode
+		attrs["country_name"] = loc.CountryName
+		attrs["region"] = loc.Region
+		attrs["city"] = loc.City
+		attrs["time_zone"] = loc.TimeZone
+		attrs["asn"] = loc.ASN
+		attrs["as_organization"] = loc.ASOrganization
+	}
+
+	if rep := s.IPReputation; rep != nil {
+		attrs["ip_reputation_score"] = rep.Score
+		attrs["ip_tags"] = rep.Tags
+		attrs["ip_malicious"] = rep.Malicious
+	}
+
+	return attrs
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a context carrying the client IP address of the
+// request, read by enrichers while building the identity context
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client IP address of the request
+// (set by WithClientIP, or the legacy "ip_address" context value)
+func ClientIPFromContext(ctx context.Context) string {
+	if ip, ok := ctx.Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	ip, _ := ctx.Value("ip_address").(string)
+	return ip
+}
@@ -0,0 +1,277 @@
+package subject
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrGroupCycle = autherrors.New(autherrors.ErrInvalidRequest, "group hierarchy cycle")
+)
+
+// GroupHierarchyProvider expands the direct group memberships of a subject
+// into its effective memberships: a member of "backend-team" under
+// "engineering" is a member of both. Roles and permissions attached to a
+// group flow to the members of all its descendant groups.
+//
+// A group can have several parents; cycles are rejected when they are added.
+// It implements GroupProvider, RoleProvider and PermissionProvider.
+type GroupHierarchyProvider struct {
+	mu          sync.RWMutex
+	groups      GroupProvider
+	roles       RoleProvider
+	permissions PermissionProvider
+	parents     map[string][]string // group -> parent groups
+	groupRoles  map[string][]string // group -> roles
+	groupPerms  map[string][]string // group -> permissions
+}
+
+// NewGroupHierarchyProvider creates a hierarchy over the direct group
+// memberships of groups
+func NewGroupHierarchyProvider(groups GroupProvider) *GroupHierarchyProvider {
+	return &GroupHierarchyProvider{
+		groups:     groups,
+		parents:    make(map[string][]string),
+		groupRoles: make(map[string][]string),
+		groupPerms: make(map[string][]string),
+	}
+}
+
+// SetRoleProvider sets the provider of the direct roles of subjects, merged
+// with the roles of their groups by GetRoles (optional)
+func (p *GroupHierarchyProvider) SetRoleProvider(roles RoleProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.roles = roles
+}
+
+// SetPermissionProvider sets the provider of the direct permissions of
+// subjects, merged with the permissions of their groups by GetPermissions
+// (optional)
+func (p *GroupHierarchyProvider) SetPermissionProvider(permissions PermissionProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.permissions = permissions
+}
+
+// AddParent nests group under parent. It fails with ErrGroupCycle when
+// parent is group itself or one of its descendants.
+func (p *GroupHierarchyProvider) AddParent(group, parent string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if group == parent || slices.Contains(p.ancestors(parent), group) {
+		return fmt.Errorf("%w: %s > %s", ErrGroupCycle, parent, group)
+	}
+	if !slices.Contains(p.parents[group], parent) {
+		p.parents[group] = append(p.parents[group], parent)
+	}
+	return nil
+}
+
+// RemoveParent removes parent from the parents of group
+func (p *GroupHierarchyProvider) RemoveParent(group, parent string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	parents := slices.DeleteFunc(slices.Clone(p.parents[group]), func(g string) bool {
+		return g == parent
+	})
+	if len(parents) == 0 {
+		delete(p.parents, group)
+		return
+	}
+	p.parents[group] = parents
+}
+
+// Parents returns the direct parents of a group
+func (p *GroupHierarchyProvider) Parents(group string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.parents[group])
+}
+
+// Ancestors returns every group a group is nested in, nearest first
+func (p *GroupHierarchyProvider) Ancestors(group string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.ancestors(group)
+}
+
+// Descendants returns every group nested in a group, nearest first (e.g., to
+// find the members impacted by a change of its permissions)
+func (p *GroupHierarchyProvider) Descendants(group string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	children := make(map[string][]string)
+	for child, parents := range p.parents {
+		for _, parent := range parents {
+			children[parent] = append(children[parent], child)
+		}
+	}
+	for _, list := range children {
+		slices.Sort(list)
+	}
+
+	return walkGroups(group, func(g string) []string { return children[g] })
+}
+
+// EffectiveGroups expands direct groups with all their ancestors
+func (p *GroupHierarchyProvider) EffectiveGroups(groups []string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.effectiveGroups(groups)
+}
+
+// GrantGroupPermission attaches a permission to a group and its descendants
+func (p *GroupHierarchyProvider) GrantGroupPermission(group, permission string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !slices.Contains(p.groupPerms[group], permission) {
+		p.groupPerms[group] = append(p.groupPerms[group], permission)
+	}
+}
+
+// RevokeGroupPermission removes a permission of a group
+func (p *GroupHierarchyProvider) RevokeGroupPermission(group, permission string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.groupPerms[group] = slices.DeleteFunc(slices.Clone(p.groupPerms[group]), func(v string) bool {
+		return v == permission
+	})
+}
+
+// AssignGroupRole attaches a role to a group and its descendants
+func (p *GroupHierarchyProvider) AssignGroupRole(group, role string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !slices.Contains(p.groupRoles[group], role) {
+		p.groupRoles[group] = append(p.groupRoles[group], role)
+	}
+}
+
+// UnassignGroupRole removes a role of a group
+func (p *GroupHierarchyProvider) UnassignGroupRole(group, role string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.groupRoles[group] = slices.DeleteFunc(slices.Clone(p.groupRoles[group]), func(v string) bool {
+		return v == role
+	})
+}
+
+// GetGroups returns the effective groups of a subject: its direct groups
+// followed by their ancestors
+func (p *GroupHierarchyProvider) GetGroups(ctx context.Context, sub *Subject) ([]string, error) {
+	direct, err := p.groups.GetGroups(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+	return p.EffectiveGroups(direct), nil
+}
+
+// GetRoles returns the direct roles of a subject and the roles of its
+// effective groups
+func (p *GroupHierarchyProvider) GetRoles(ctx context.Context, sub *Subject) ([]string, error) {
+	p.mu.RLock()
+	roles := p.roles
+	p.mu.RUnlock()
+
+	var direct []string
+	if roles != nil {
+		var err error
+		if direct, err = roles.GetRoles(ctx, sub); err != nil {
+			return nil, err
+		}
+	}
+	return p.inherited(ctx, sub, direct, p.groupRoles)
+}
+
+// GetPermissions returns the direct permissions of a subject and the
+// permissions of its effective groups
+func (p *GroupHierarchyProvider) GetPermissions(ctx context.Context, sub *Subject) ([]string, error) {
+	p.mu.RLock()
+	permissions := p.permissions
+	p.mu.RUnlock()
+
+	var direct []string
+	if permissions != nil {
+		var err error
+		if direct, err = permissions.GetPermissions(ctx, sub); err != nil {
+			return nil, err
+		}
+	}
+	return p.inherited(ctx, sub, direct, p.groupPerms)
+}
+
+// inherited merges direct values with the values attached to the effective
+// groups of a subject
+func (p *GroupHierarchyProvider) inherited(ctx context.Context, sub *Subject, direct []string, attached map[string][]string) ([]string, error) {
+	groups, err := p.groups.GetGroups(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	values := slices.Clone(direct)
+	for _, group := range p.effectiveGroups(groups) {
+		for _, value := range attached[group] {
+			if !slices.Contains(values, value) {
+				values = append(values, value)
+			}
+		}
+	}
+	if values == nil {
+		values = []string{}
+	}
+	return values, nil
+}
+
+func (p *GroupHierarchyProvider) ancestors(group string) []string {
+	return walkGroups(group, func(g string) []string { return p.parents[g] })
+}
+
+func (p *GroupHierarchyProvider) effectiveGroups(groups []string) []string {
+	effective := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if !slices.Contains(effective, group) {
+			effective = append(effective, group)
+		}
+	}
+	for _, group := range groups {
+		for _, ancestor := range p.ancestors(group) {
+			if !slices.Contains(effective, ancestor) {
+				effective = append(effective, ancestor)
+			}
+		}
+	}
+	return effective
+}
+
+// walkGroups visits the groups reachable from start breadth-first, each once
+// (start excluded)
+func walkGroups(start string, next func(group string) []string) []string {
+	visited := map[string]bool{start: true}
+	result := make([]string, 0)
+	queue := []string{start}
+
+	for len(queue) > 0 {
+		group := queue[0]
+		queue = queue[1:]
+		for _, neighbour := range next(group) {
+			if visited[neighbour] {
+				continue
+			}
+			visited[neighbour] = true
+			result = append(result, neighbour)
+			queue = append(queue, neighbour)
+		}
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package subject
+
+import (
+	"context"
+	"sync"
+)
+
+// ChangeKind is the kind of a subject change event
+type ChangeKind string
+
+const (
+	// SubjectChanged: the roles, permissions or groups of one subject changed
+	SubjectChanged ChangeKind = "subject.changed"
+
+	// RoleChanged: the permissions of a role changed, impacting every subject
+	// that has the role
+	RoleChanged ChangeKind = "role.changed"
+)
+
+// ChangeEvent is published when data that identity contexts are built from
+// changes, so cached identities can be purged before their TTL
+type ChangeEvent struct {
+	Kind      ChangeKind
+	SubjectID string // for SubjectChanged
+	Role      string // for RoleChanged
+	Reason    string // e.g., "role_assigned", "permission_revoked"
+}
+
+// ChangeHandler handles change events. ctx is the context of the publisher
+// (carrying, e.g., its tenant).
+type ChangeHandler func(ctx context.Context, event ChangeEvent)
+
+// InvalidationBus delivers change events from stores to caches
+type InvalidationBus interface {
+	// Publish delivers an event to every subscriber
+	Publish(ctx context.Context, event ChangeEvent)
+
+	// Subscribe registers a handler and returns a function that removes it
+	Subscribe(handler ChangeHandler) (unsubscribe func())
+}
+
+// InMemoryInvalidationBus is an in-process InvalidationBus. Handlers run
+// synchronously in Publish, so a cache is purged before the store mutation
+// returns.
+type InMemoryInvalidationBus struct {
+	mu       sync.RWMutex
+	handlers map[int]ChangeHandler
+	nextID   int
+}
+
+// NewInMemoryInvalidationBus creates a new in-process invalidation bus
+func NewInMemoryInvalidationBus() *InMemoryInvalidationBus {
+	return &InMemoryInvalidationBus{
+		handlers: make(map[int]ChangeHandler),
+	}
+}
+
+// Publish delivers an event to every subscriber
+func (b *InMemoryInvalidationBus) Publish(ctx context.Context, event ChangeEvent) {
+	b.mu.RLock()
+	handlers := make([]ChangeHandler, 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(ctx, event)
+	}
+}
+
+// Subscribe registers a handler
+func (b *InMemoryInvalidationBus) Subscribe(handler ChangeHandler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
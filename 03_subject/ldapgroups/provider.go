@@ -0,0 +1,468 @@
+package ldapgroups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+var (
+	ErrNoDirectory  = errors.New("ldap directory is not configured")
+	ErrUserNotFound = errors.New("ldap user entry not found")
+	ErrAmbiguous    = errors.New("ldap user filter matched more than one entry")
+)
+
+// Scope is the depth of an LDAP search
+type Scope int
+
+const (
+	ScopeBaseObject   Scope = 0 // the base DN entry only
+	ScopeSingleLevel  Scope = 1 // direct children of the base DN
+	ScopeWholeSubtree Scope = 2 // the base DN and all its descendants
+)
+
+// SearchRequest is an LDAP search
+type SearchRequest struct {
+	BaseDN     string
+	Scope      Scope
+	Filter     string
+	Attributes []string
+}
+
+// Entry is an LDAP search result entry
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the first value of an attribute (case-insensitive name)
+func (e *Entry) Get(name string) string {
+	if values := e.Values(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns the values of an attribute (case-insensitive name)
+func (e *Entry) Values(name string) []string {
+	if values, ok := e.Attributes[name]; ok {
+		return values
+	}
+	for attribute, values := range e.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Directory runs LDAP searches, e.g., an adapter over a
+// github.com/go-ldap/ldap/v3 connection pool bound with a service account
+type Directory interface {
+	Search(ctx context.Context, request *SearchRequest) ([]*Entry, error)
+}
+
+// DirectoryFunc adapts a function to Directory
+type DirectoryFunc func(ctx context.Context, request *SearchRequest) ([]*Entry, error)
+
+// Search calls f(ctx, request)
+func (f DirectoryFunc) Search(ctx context.Context, request *SearchRequest) ([]*Entry, error) {
+	return f(ctx, request)
+}
+
+// Config holds LDAP group provider configuration
+type Config struct {
+	// Directory runs the searches (required)
+	Directory Directory
+
+	// UserBaseDN is the base of user searches, e.g., "ou=people,dc=acme,dc=com"
+	UserBaseDN string
+
+	// UserFilter finds the entry of a subject; %s is replaced with the
+	// escaped subject principal (default: "(sAMAccountName=%s)")
+	UserFilter string
+
+	// UserKey selects the subject value used in UserFilter (default:
+	// Subject.Principal, falling back to Subject.ID)
+	UserKey func(sub *subject.Subject) string
+
+	// GroupBaseDN is the base of group searches (default: UserBaseDN)
+	GroupBaseDN string
+
+	// MemberOfAttribute lists the groups of an entry (default: "memberOf").
+	// Set to "-" for directories without it; groups are then found with
+	// GroupFilter.
+	MemberOfAttribute string
+
+	// GroupFilter finds the groups that have an entry as member; %s is
+	// replaced with the escaped member DN (default:
+	// "(&(objectClass=group)(member=%s))")
+	GroupFilter string
+
+	// GroupNameAttribute names a group (default: "cn"). Names of groups from
+	// MemberOfAttribute are taken from the first RDN of their DN.
+	GroupNameAttribute string
+
+	// Nested expands nested groups: the subject gets every group its groups
+	// are (transitively) members of
+	Nested bool
+
+	// MatchingRuleInChain expands nested groups with a single Active
+	// Directory LDAP_MATCHING_RULE_IN_CHAIN search instead of one search per
+	// level (requires Nested)
+	MatchingRuleInChain bool
+
+	// MaxDepth limits nested group expansion (default: 10)
+	MaxDepth int
+
+	// RoleMapping maps group names (or DNs) to roles. Groups without a
+	// mapping grant no role unless GroupsAsRoles is set.
+	RoleMapping map[string][]string
+
+	// GroupsAsRoles also returns unmapped group names as roles
+	GroupsAsRoles bool
+
+	// CacheTTL caches the groups of a subject, so GetGroups and GetRoles of
+	// one identity build share the searches (default: 30s; negative: disabled)
+	CacheTTL time.Duration
+}
+
+// Provider resolves the AD/LDAP groups of a subject at identity build time,
+// so directory-managed membership drives RBAC without syncing. It is both a
+// subject.GroupProvider and a subject.RoleProvider (groups mapped to roles).
+type Provider struct {
+	config *Config
+
+	mu    sync.Mutex
+	cache map[string]cachedGroups
+}
+
+type cachedGroups struct {
+	groups    []Group
+	expiresAt time.Time
+}
+
+// Group is a directory group of a subject
+type Group struct {
+	DN   string
+	Name string
+}
+
+// NewProvider creates a new LDAP group provider
+func NewProvider(config *Config) *Provider {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(sAMAccountName=%s)"
+	}
+	if config.UserKey == nil {
+		config.UserKey = func(sub *subject.Subject) string {
+			if sub.Principal != "" {
+				return sub.Principal
+			}
+			return sub.ID
+		}
+	}
+	if config.GroupBaseDN == "" {
+		config.GroupBaseDN = config.UserBaseDN
+	}
+	if config.MemberOfAttribute == "" {
+		config.MemberOfAttribute = "memberOf"
+	}
+	if config.GroupFilter == "" {
+		config.GroupFilter = "(&(objectClass=group)(member=%s))"
+	}
+	if config.GroupNameAttribute == "" {
+		config.GroupNameAttribute = "cn"
+	}
+	if config.MaxDepth <= 0 {
+		config.MaxDepth = 10
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = 30 * time.Second
+	}
+
+	return &Provider{
+		config: config,
+		cache:  make(map[string]cachedGroups),
+	}
+}
+
+// GetGroups returns the group names of a subject
+func (p *Provider) GetGroups(ctx context.Context, sub *subject.Subject) ([]string, error) {
+	groups, err := p.Groups(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return names, nil
+}
+
+// GetRoles returns the roles mapped from the groups of a subject
+func (p *Provider) GetRoles(ctx context.Context, sub *subject.Subject) ([]string, error) {
+	groups, err := p.Groups(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]string, 0)
+	for _, group := range groups {
+		mapped, ok := p.config.RoleMapping[group.Name]
+		if !ok {
+			mapped, ok = p.config.RoleMapping[group.DN]
+		}
+		if ok {
+			roles = append(roles, mapped...)
+		} else if p.config.GroupsAsRoles {
+			roles = append(roles, group.Name)
+		}
+	}
+
+	slices.Sort(roles)
+	return slices.Compact(roles), nil
+}
+
+// Groups returns the groups of a subject, including nested groups when
+// enabled
+func (p *Provider) Groups(ctx context.Context, sub *subject.Subject) ([]Group, error) {
+	if p.config.Directory == nil {
+		return nil, ErrNoDirectory
+	}
+
+	key := p.config.UserKey(sub)
+	if groups, ok := p.cached(key); ok {
+		return groups, nil
+	}
+
+	user, err := p.findUser(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := p.directGroups(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.config.Nested {
+		if p.config.MatchingRuleInChain {
+			groups, err = p.chainGroups(ctx, user.DN)
+		} else {
+			groups, err = p.expand(ctx, groups)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortFunc(groups, func(a, b Group) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	if p.config.CacheTTL > 0 {
+		p.mu.Lock()
+		p.cache[key] = cachedGroups{groups: groups, expiresAt: time.Now().Add(p.config.CacheTTL)}
+		p.mu.Unlock()
+	}
+	return slices.Clone(groups), nil
+}
+
+// Invalidate drops the cached groups of a subject
+func (p *Provider) Invalidate(sub *subject.Subject) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cache, p.config.UserKey(sub))
+}
+
+// cached returns the unexpired cached groups of a user key
+func (p *Provider) cached(key string) ([]Group, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(p.cache, key)
+		return nil, false
+	}
+	return slices.Clone(entry.groups), true
+}
+
+// findUser returns the directory entry of a subject
+func (p *Provider) findUser(ctx context.Context, key string) (*Entry, error) {
+	attributes := []string{p.config.MemberOfAttribute}
+	if p.config.MemberOfAttribute == "-" {
+		attributes = []string{"1.1"} // no attributes
+	}
+
+	entries, err := p.config.Directory.Search(ctx, &SearchRequest{
+		BaseDN:     p.config.UserBaseDN,
+		Scope:      ScopeWholeSubtree,
+		Filter:     fmt.Sprintf(p.config.UserFilter, EscapeFilter(key)),
+		Attributes: attributes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ldap user search failed: %w", err)
+	}
+
+	switch len(entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+		return entries[0], nil
+	default:
+		return nil, ErrAmbiguous
+	}
+}
+
+// directGroups returns the groups an entry is a direct member of
+func (p *Provider) directGroups(ctx context.Context, entry *Entry) ([]Group, error) {
+	if p.config.MemberOfAttribute != "-" {
+		dns := entry.Values(p.config.MemberOfAttribute)
+		groups := make([]Group, 0, len(dns))
+		for _, dn := range dns {
+			groups = append(groups, Group{DN: dn, Name: firstRDNValue(dn)})
+		}
+		return groups, nil
+	}
+
+	return p.searchGroups(ctx, fmt.Sprintf(p.config.GroupFilter, EscapeFilter(entry.DN)))
+}
+
+// expand adds the groups of groups, level by level, up to MaxDepth
+func (p *Provider) expand(ctx context.Context, groups []Group) ([]Group, error) {
+	seen := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		seen[normalizeDN(group.DN)] = true
+	}
+
+	all := slices.Clone(groups)
+	level := groups
+	for depth := 1; depth < p.config.MaxDepth && len(level) > 0; depth++ {
+		var next []Group
+		for _, group := range level {
+			parents, err := p.parentGroups(ctx, group)
+			if err != nil {
+				return nil, err
+			}
+			for _, parent := range parents {
+				// Membership cycles are common in AD; visit each group once
+				if dn := normalizeDN(parent.DN); !seen[dn] {
+					seen[dn] = true
+					next = append(next, parent)
+				}
+			}
+		}
+		all = append(all, next...)
+		level = next
+	}
+	return all, nil
+}
+
+// parentGroups returns the groups a group is a direct member of
+func (p *Provider) parentGroups(ctx context.Context, group Group) ([]Group, error) {
+	if p.config.MemberOfAttribute == "-" {
+		return p.searchGroups(ctx, fmt.Sprintf(p.config.GroupFilter, EscapeFilter(group.DN)))
+	}
+
+	entries, err := p.config.Directory.Search(ctx, &SearchRequest{
+		BaseDN:     group.DN,
+		Scope:      ScopeBaseObject,
+		Filter:     "(objectClass=*)",
+		Attributes: []string{p.config.MemberOfAttribute},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ldap group lookup failed: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return p.directGroups(ctx, entries[0])
+}
+
+// chainGroups returns every (transitive) group of a DN with one search
+func (p *Provider) chainGroups(ctx context.Context, dn string) ([]Group, error) {
+	filter := fmt.Sprintf("(member:1.2.840.113556.1.4.1941:=%s)", EscapeFilter(dn))
+	return p.searchGroups(ctx, filter)
+}
+
+// searchGroups returns the groups matching a filter
+func (p *Provider) searchGroups(ctx context.Context, filter string) ([]Group, error) {
+	entries, err := p.config.Directory.Search(ctx, &SearchRequest{
+		BaseDN:     p.config.GroupBaseDN,
+		Scope:      ScopeWholeSubtree,
+		Filter:     filter,
+		Attributes: []string{p.config.GroupNameAttribute},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search failed: %w", err)
+	}
+
+	groups := make([]Group, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Get(p.config.GroupNameAttribute)
+		if name == "" {
+			name = firstRDNValue(entry.DN)
+		}
+		groups = append(groups, Group{DN: entry.DN, Name: name})
+	}
+	return groups, nil
+}
+
+// EscapeFilter escapes a value for use in an LDAP filter (RFC 4515)
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// firstRDNValue returns the value of the first RDN of a DN,
+// e.g., "Admins" for "CN=Admins,OU=Groups,DC=acme,DC=com"
+func firstRDNValue(dn string) string {
+	rdn := dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+			continue
+		}
+		if dn[i] == ',' {
+			rdn = dn[:i]
+			break
+		}
+	}
+
+	_, value, ok := strings.Cut(rdn, "=")
+	if !ok {
+		return strings.TrimSpace(rdn)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(value, `\`, ""))
+}
+
+// normalizeDN folds case and spaces around separators for DN comparison
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
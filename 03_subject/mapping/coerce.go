@@ -0,0 +1,129 @@
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// coerce converts a claim value to a mapping type. JSON numbers arrive as
+// float64 and IdPs often send numbers and booleans as strings, so both are
+// accepted.
+func coerce(value any, typ string) (any, error) {
+	switch typ {
+	case TypeString:
+		return toString(value)
+	case TypeInt:
+		return toInt(value)
+	case TypeFloat:
+		return toFloat(value)
+	case TypeBool:
+		return toBool(value)
+	case TypeStringSlice:
+		items, ok := toStringSlice(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T to %s", ErrCoercionFailed, value, typ)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidRule, typ)
+	}
+}
+
+func toString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case json.Number:
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("%w: %T to %s", ErrCoercionFailed, value, TypeString)
+}
+
+func toInt(value any) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case json.Number:
+		return v.Int64()
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %v to %s", ErrCoercionFailed, value, TypeInt)
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %v to %s", ErrCoercionFailed, value, TypeFloat)
+}
+
+func toBool(value any) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return b, nil
+		}
+	case float64:
+		return v != 0, nil
+	case int:
+		return v != 0, nil
+	}
+	return false, fmt.Errorf("%w: %v to %s", ErrCoercionFailed, value, TypeBool)
+}
+
+// toStringSlice converts a list, or a single space/comma separated string
+// (e.g., an OAuth2 "scope" claim), to a string slice
+func toStringSlice(value any) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := toString(item)
+			if err != nil {
+				return nil, false
+			}
+			items = append(items, s)
+		}
+		return items, true
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool {
+			return r == ' ' || r == ','
+		}), true
+	}
+	return nil, false
+}
@@ -0,0 +1,398 @@
+package mapping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"text/template"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidRule     = errors.New("invalid mapping rule")
+	ErrMissingClaim    = autherrors.New(autherrors.ErrInvalidCredentials, "required claim is missing")
+	ErrCoercionFailed  = errors.New("claim cannot be converted")
+	ErrUnknownOperator = errors.New("unknown mapping operator")
+)
+
+// Op is a mapping operator
+type Op string
+
+const (
+	// OpRename copies claim From to attribute To (and removes From when
+	// unmapped claims pass through)
+	OpRename Op = "rename"
+
+	// OpConstant sets attribute To to Value
+	OpConstant Op = "constant"
+
+	// OpTemplate renders Template (text/template over the claims) into To
+	OpTemplate Op = "template"
+
+	// OpCoerce converts From (or To) to Type and stores it in To (or From)
+	OpCoerce Op = "coerce"
+
+	// OpDrop removes attribute From
+	OpDrop Op = "drop"
+)
+
+// Types supported by OpCoerce
+const (
+	TypeString      = "string"
+	TypeInt         = "int"
+	TypeFloat       = "float"
+	TypeBool        = "bool"
+	TypeStringSlice = "string_slice"
+)
+
+// Rule is a mapping step. Rules run in order; each one sees the attributes
+// produced by the rules before it, falling back to the original claims.
+type Rule struct {
+	// Op is the operator
+	Op Op `yaml:"op" json:"op"`
+
+	// From is the source claim or attribute. Dots address nested claims,
+	// e.g., "realm_access.roles".
+	From string `yaml:"from,omitempty" json:"from,omitempty"`
+
+	// To is the target attribute
+	To string `yaml:"to,omitempty" json:"to,omitempty"`
+
+	// Value is the constant of OpConstant
+	Value any `yaml:"value,omitempty" json:"value,omitempty"`
+
+	// Template is the text/template of OpTemplate, e.g.,
+	// "{{.given_name}} {{.family_name}}"
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+
+	// Type is the target type of OpCoerce
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+
+	// Default is used when the source is missing (optional)
+	Default any `yaml:"default,omitempty" json:"default,omitempty"`
+
+	// Required fails the mapping when the source is missing and there is no
+	// default
+	Required bool `yaml:"required,omitempty" json:"required,omitempty"`
+}
+
+// Config is a declarative claims mapping
+type Config struct {
+	// Rules are the mapping steps, applied in order
+	Rules []Rule `yaml:"rules" json:"rules"`
+
+	// PassThrough keeps claims no rule touched (default: only mapped
+	// attributes are kept)
+	PassThrough bool `yaml:"pass_through,omitempty" json:"pass_through,omitempty"`
+}
+
+// ParseYAML parses a mapping configuration from YAML:
+//
+//	pass_through: true
+//	rules:
+//	  - {op: rename, from: preferred_username, to: username}
+//	  - {op: template, to: display_name, template: "{{.given_name}} {{.family_name}}"}
+//	  - {op: coerce, from: employee_no, type: int}
+//	  - {op: constant, to: idp, value: keycloak}
+//	  - {op: drop, from: session_state}
+func ParseYAML(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping: %w", err)
+	}
+	return &config, nil
+}
+
+// LoadFile loads a YAML mapping configuration file
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseYAML(data)
+}
+
+// Mapper transforms claims into normalized attributes
+type Mapper struct {
+	config    *Config
+	templates []*template.Template // by rule index (nil for other operators)
+}
+
+// NewMapper validates a mapping configuration and compiles its templates
+func NewMapper(config *Config) (*Mapper, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	m := &Mapper{
+		config:    config,
+		templates: make([]*template.Template, len(config.Rules)),
+	}
+
+	for i, rule := range config.Rules {
+		if err := validateRule(rule); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if rule.Op != OpTemplate {
+			continue
+		}
+
+		tmpl, err := template.New(rule.To).Option("missingkey=error").Funcs(templateFuncs).Parse(rule.Template)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w: %v", i, ErrInvalidRule, err)
+		}
+		m.templates[i] = tmpl
+	}
+
+	return m, nil
+}
+
+// MustNewMapper is like NewMapper but panics on an invalid configuration
+func MustNewMapper(config *Config) *Mapper {
+	m, err := NewMapper(config)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"join": func(sep string, values any) string {
+		items, _ := toStringSlice(values)
+		return strings.Join(items, sep)
+	},
+}
+
+func validateRule(rule Rule) error {
+	switch rule.Op {
+	case OpRename:
+		if rule.From == "" || rule.To == "" {
+			return fmt.Errorf("%w: rename needs from and to", ErrInvalidRule)
+		}
+	case OpConstant:
+		if rule.To == "" {
+			return fmt.Errorf("%w: constant needs to", ErrInvalidRule)
+		}
+	case OpTemplate:
+		if rule.To == "" || rule.Template == "" {
+			return fmt.Errorf("%w: template needs to and template", ErrInvalidRule)
+		}
+	case OpCoerce:
+		if rule.From == "" && rule.To == "" {
+			return fmt.Errorf("%w: coerce needs from or to", ErrInvalidRule)
+		}
+		if _, err := coerce("", rule.Type); errors.Is(err, ErrInvalidRule) {
+			return err
+		}
+	case OpDrop:
+		if rule.From == "" {
+			return fmt.Errorf("%w: drop needs from", ErrInvalidRule)
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownOperator, rule.Op)
+	}
+	return nil
+}
+
+// Map applies the rules to claims and returns the resulting attributes. The
+// claims are not modified.
+func (m *Mapper) Map(claims map[string]any) (map[string]any, error) {
+	state := &mapState{
+		claims:  claims,
+		out:     make(map[string]any),
+		dropped: make(map[string]bool),
+	}
+	if m.config.PassThrough {
+		maps.Copy(state.out, claims)
+	}
+
+	for i, rule := range m.config.Rules {
+		if err := m.apply(state, i, rule); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, rule.Op, err)
+		}
+	}
+
+	return state.out, nil
+}
+
+func (m *Mapper) apply(state *mapState, index int, rule Rule) error {
+	switch rule.Op {
+	case OpRename:
+		value, ok := state.lookup(rule.From)
+		if !ok {
+			return state.missing(rule)
+		}
+		state.set(rule.To, value)
+		if rule.From != rule.To {
+			state.drop(rule.From)
+		}
+
+	case OpConstant:
+		state.set(rule.To, rule.Value)
+
+	case OpTemplate:
+		var out strings.Builder
+		if err := m.templates[index].Execute(&out, state.view()); err != nil {
+			// Templates referencing absent claims count as missing
+			return state.missing(rule)
+		}
+		state.set(rule.To, out.String())
+
+	case OpCoerce:
+		from, to := rule.From, rule.To
+		if from == "" {
+			from = to
+		}
+		if to == "" {
+			to = from
+		}
+
+		value, ok := state.lookup(from)
+		if !ok {
+			return state.missing(rule)
+		}
+		converted, err := coerce(value, rule.Type)
+		if err != nil {
+			return fmt.Errorf("%s: %w", from, err)
+		}
+		state.set(to, converted)
+
+	case OpDrop:
+		state.drop(rule.From)
+	}
+
+	return nil
+}
+
+// mapState is the working state of a Map call
+type mapState struct {
+	claims  map[string]any
+	out     map[string]any
+	dropped map[string]bool
+}
+
+// lookup resolves a key against the mapped attributes, then the claims
+func (s *mapState) lookup(key string) (any, bool) {
+	if value, ok := s.out[key]; ok {
+		return value, true
+	}
+	if s.dropped[key] {
+		return nil, false
+	}
+	return lookupPath(s.claims, key)
+}
+
+func (s *mapState) set(key string, value any) {
+	s.out[key] = value
+	delete(s.dropped, key)
+}
+
+func (s *mapState) drop(key string) {
+	delete(s.out, key)
+	s.dropped[key] = true
+}
+
+// missing applies the default of a rule whose source is missing
+func (s *mapState) missing(rule Rule) error {
+	target := rule.To
+	if target == "" {
+		target = rule.From
+	}
+
+	if rule.Default != nil {
+		s.set(target, rule.Default)
+		return nil
+	}
+	if rule.Required {
+		source := rule.From
+		if source == "" {
+			source = target
+		}
+		return fmt.Errorf("%w: %s", ErrMissingClaim, source)
+	}
+	return nil
+}
+
+// view returns the template data: claims overlaid with mapped attributes
+func (s *mapState) view() map[string]any {
+	data := make(map[string]any, len(s.claims)+len(s.out))
+	for key, value := range s.claims {
+		if !s.dropped[key] {
+			data[key] = value
+		}
+	}
+	maps.Copy(data, s.out)
+	return data
+}
+
+// lookupPath resolves a dotted path in nested claims. A key containing dots
+// is matched as a whole first.
+func lookupPath(claims map[string]any, path string) (any, bool) {
+	if value, ok := claims[path]; ok {
+		return value, true
+	}
+
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := claims[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(nested, rest)
+}
+
+// Resolver maps claims before resolving the subject, so the subject is built
+// from normalized attributes
+type Resolver struct {
+	inner  subject.SubjectResolver
+	mapper *Mapper
+}
+
+// NewResolver wraps a subject resolver with a claims mapping
+func NewResolver(inner subject.SubjectResolver, mapper *Mapper) *Resolver {
+	return &Resolver{inner: inner, mapper: mapper}
+}
+
+// Resolve maps the claims and resolves the subject from the result
+func (r *Resolver) Resolve(ctx context.Context, claims map[string]any) (*subject.Subject, error) {
+	mapped, err := r.mapper.Map(claims)
+	if err != nil {
+		return nil, fmt.Errorf("claims mapping failed: %w", err)
+	}
+	return r.inner.Resolve(ctx, mapped)
+}
+
+// Enricher maps the attributes of an already resolved subject
+type Enricher struct {
+	mapper *Mapper
+}
+
+// NewEnricher creates an enricher that maps subject attributes
+func NewEnricher(mapper *Mapper) *Enricher {
+	return &Enricher{mapper: mapper}
+}
+
+// Enrich replaces the subject attributes with their mapping
+func (e *Enricher) Enrich(ctx context.Context, identity *subject.IdentityContext) error {
+	if identity.Subject == nil {
+		return nil
+	}
+
+	mapped, err := e.mapper.Map(identity.Subject.Attributes)
+	if err != nil {
+		return fmt.Errorf("attribute mapping failed: %w", err)
+	}
+	identity.Subject.Attributes = mapped
+	return nil
+}
@@ -0,0 +1,290 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+var (
+	ErrCacheMiss      = errors.New("cache miss")
+	ErrAlreadyStarted = errors.New("invalidation listener already started")
+)
+
+// CacheConfig holds Redis identity cache configuration
+type CacheConfig struct {
+	Config
+
+	// LocalTTL keeps a per-node in-process copy of cached identities for this
+	// long (default: 0, disabled). Copies are dropped on every node when an
+	// entry is changed or deleted, through pub/sub invalidation.
+	LocalTTL time.Duration
+
+	// Channel is the pub/sub channel of invalidations (default: Prefix + "invalidate")
+	Channel string
+
+	// OnInvalidate is called for invalidations published by other nodes,
+	// e.g., to drop entries of other node-local caches (optional).
+	// key is the cache key ("*" when the cache was cleared).
+	OnInvalidate func(key string)
+}
+
+// Cache is a Redis implementation of subject.IdentityCache, shared by all
+// nodes (for cached.NewResolver and cached.NewContextBuilder)
+type Cache struct {
+	config *CacheConfig
+	client goredis.UniversalClient
+	nodeID string
+
+	mu    sync.RWMutex
+	local map[string]localItem
+
+	subMu  sync.Mutex
+	pubsub *goredis.PubSub
+}
+
+type localItem struct {
+	identity  *subject.IdentityContext
+	expiresAt time.Time
+}
+
+// invalidation is a pub/sub invalidation message
+type invalidation struct {
+	Node   string `json:"node"`
+	Key    string `json:"key"`    // cache key, "*" for clear
+	Prefix string `json:"prefix"` // tenant key prefix
+}
+
+// NewCache creates a Redis identity cache. Call Start to receive
+// invalidations from other nodes when LocalTTL or OnInvalidate is used.
+func NewCache(config *CacheConfig) *Cache {
+	config.normalize()
+	if config.Channel == "" {
+		config.Channel = config.Prefix + "invalidate"
+	}
+
+	return &Cache{
+		config: config,
+		client: config.Client,
+		nodeID: randomNodeID(),
+		local:  make(map[string]localItem),
+	}
+}
+
+// Set caches an identity context
+func (c *Cache) Set(ctx context.Context, key string, identity *subject.IdentityContext, ttl int64) error {
+	data, err := c.config.Codec.Marshal(identity)
+	if err != nil {
+		return fmt.Errorf("failed to encode identity: %w", err)
+	}
+
+	fullKey := c.config.key(ctx, "cache", key)
+	if err := c.client.Set(ctx, fullKey, data, time.Duration(ttl)*time.Second).Err(); err != nil {
+		return err
+	}
+
+	c.storeLocal(fullKey, identity, time.Duration(ttl)*time.Second)
+	return c.publish(ctx, key)
+}
+
+// Get retrieves a cached identity context
+func (c *Cache) Get(ctx context.Context, key string) (*subject.IdentityContext, error) {
+	fullKey := c.config.key(ctx, "cache", key)
+
+	if identity := c.getLocal(fullKey); identity != nil {
+		return identity, nil
+	}
+
+	data, err := c.client.Get(ctx, fullKey).Bytes()
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+
+	var identity subject.IdentityContext
+	if err := c.config.Codec.Unmarshal(data, &identity); err != nil {
+		return nil, fmt.Errorf("failed to decode identity: %w", err)
+	}
+
+	if c.config.LocalTTL > 0 {
+		ttl, err := c.client.PTTL(ctx, fullKey).Result()
+		if err == nil && ttl > 0 {
+			c.storeLocal(fullKey, &identity, ttl)
+		}
+	}
+
+	return &identity, nil
+}
+
+// Delete removes a cached identity context on every node
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	fullKey := c.config.key(ctx, "cache", key)
+	if err := c.client.Del(ctx, fullKey).Err(); err != nil {
+		return err
+	}
+
+	c.dropLocal(fullKey)
+	return c.publish(ctx, key)
+}
+
+// Clear removes all cached identity contexts of the request tenant
+func (c *Cache) Clear(ctx context.Context) error {
+	pattern := c.config.key(ctx, "cache", "*")
+
+	iter := c.client.Scan(ctx, 0, pattern, 500).Iterator()
+	batch := make([]string, 0, 500)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := c.client.Unlink(ctx, batch...).Err(); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		if err := c.client.Unlink(ctx, batch...).Err(); err != nil {
+			return err
+		}
+	}
+
+	c.dropLocalPrefix(c.config.key(ctx, "cache", ""))
+	return c.publish(ctx, "*")
+}
+
+// Start subscribes to invalidations published by other nodes until ctx is
+// cancelled or Close is called
+func (c *Cache) Start(ctx context.Context) error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	if c.pubsub != nil {
+		return ErrAlreadyStarted
+	}
+
+	pubsub := c.client.Subscribe(ctx, c.config.Channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return fmt.Errorf("failed to subscribe to %s: %w", c.config.Channel, err)
+	}
+	c.pubsub = pubsub
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			var inv invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil || inv.Node == c.nodeID {
+				continue
+			}
+
+			if inv.Key == "*" {
+				c.dropLocalPrefix(inv.Prefix + "cache:")
+			} else {
+				c.dropLocal(inv.Prefix + "cache:" + inv.Key)
+			}
+
+			if c.config.OnInvalidate != nil {
+				c.config.OnInvalidate(inv.Key)
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		_ = c.Close()
+	}()
+
+	return nil
+}
+
+// Close stops receiving invalidations
+func (c *Cache) Close() error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	if c.pubsub == nil {
+		return nil
+	}
+	err := c.pubsub.Close()
+	c.pubsub = nil
+	return err
+}
+
+// publish notifies other nodes that a key changed
+func (c *Cache) publish(ctx context.Context, key string) error {
+	payload, err := json.Marshal(invalidation{
+		Node:   c.nodeID,
+		Key:    key,
+		Prefix: c.config.tenantPrefix(ctx),
+	})
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, c.config.Channel, payload).Err()
+}
+
+func (c *Cache) storeLocal(fullKey string, identity *subject.IdentityContext, ttl time.Duration) {
+	if c.config.LocalTTL <= 0 {
+		return
+	}
+	if ttl <= 0 || ttl > c.config.LocalTTL {
+		ttl = c.config.LocalTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.local[fullKey] = localItem{identity: identity, expiresAt: time.Now().Add(ttl)}
+}
+
+func (c *Cache) getLocal(fullKey string) *subject.IdentityContext {
+	if c.config.LocalTTL <= 0 {
+		return nil
+	}
+
+	c.mu.RLock()
+	item, ok := c.local[fullKey]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(item.expiresAt) {
+		return nil
+	}
+	return item.identity
+}
+
+func (c *Cache) dropLocal(fullKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.local, fullKey)
+}
+
+func (c *Cache) dropLocalPrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.local {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.local, key)
+		}
+	}
+}
+
+// randomNodeID identifies this process in invalidation messages
+func randomNodeID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
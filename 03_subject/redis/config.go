@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// TenantFunc returns the tenant of a request (e.g., authz.TenantFromContext)
+type TenantFunc func(ctx context.Context) string
+
+// Config holds configuration shared by the Redis cache and identity store
+type Config struct {
+	// Client is the Redis client (required). A *goredis.Client,
+	// *goredis.ClusterClient or *goredis.Ring can be used.
+	Client goredis.UniversalClient
+
+	// Prefix is prepended to every key (default: "lokstra:")
+	Prefix string
+
+	// Codec serializes identities (default: JSONCodec)
+	Codec Codec
+
+	// Tenant returns the tenant of a request; keys of a tenant are prefixed
+	// with "t:<tenant>:" so tenants never share entries (optional)
+	Tenant TenantFunc
+}
+
+// normalize applies defaults
+func (c *Config) normalize() {
+	if c.Prefix == "" {
+		c.Prefix = "lokstra:"
+	}
+	if c.Codec == nil {
+		c.Codec = JSONCodec{}
+	}
+}
+
+// key builds the full Redis key of a kind ("cache", "session", ...) and id
+func (c *Config) key(ctx context.Context, kind, id string) string {
+	return c.tenantPrefix(ctx) + kind + ":" + id
+}
+
+// tenantPrefix returns the key prefix of the request tenant
+func (c *Config) tenantPrefix(ctx context.Context) string {
+	var b strings.Builder
+	b.WriteString(c.Prefix)
+	if c.Tenant != nil {
+		if tenant := c.Tenant(ctx); tenant != "" {
+			b.WriteString("t:")
+			b.WriteString(tenant)
+			b.WriteString(":")
+		}
+	}
+	return b.String()
+}
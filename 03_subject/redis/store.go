@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+// IdentityStore is a Redis implementation of subject.SubjectSessionStore,
+// so server-side sessions are shared by all nodes. Sessions expire with
+// Session.ExpiresAt (default: 24 hours); each subject has a set of its
+// session IDs for ListBySubject and DeleteBySubject.
+type IdentityStore struct {
+	config *Config
+	client goredis.UniversalClient
+}
+
+// NewIdentityStore creates a Redis identity store
+func NewIdentityStore(config *Config) *IdentityStore {
+	config.normalize()
+
+	return &IdentityStore{
+		config: config,
+		client: config.Client,
+	}
+}
+
+// Store saves an identity context
+func (s *IdentityStore) Store(ctx context.Context, sessionID string, identity *subject.IdentityContext) error {
+	data, err := s.config.Codec.Marshal(identity)
+	if err != nil {
+		return fmt.Errorf("failed to encode identity: %w", err)
+	}
+
+	ttl := 24 * time.Hour
+	if identity.Session != nil && identity.Session.ExpiresAt > 0 {
+		ttl = time.Until(time.Unix(identity.Session.ExpiresAt, 0))
+		if ttl <= 0 {
+			return nil
+		}
+	}
+
+	if err := s.client.Set(ctx, s.sessionKey(ctx, sessionID), data, ttl).Err(); err != nil {
+		return err
+	}
+
+	if identity.Subject == nil || identity.Subject.ID == "" {
+		return nil
+	}
+
+	// Index the session by subject; the index lives as long as its longest session
+	indexKey := s.subjectKey(ctx, identity.Subject.ID)
+	if err := s.client.SAdd(ctx, indexKey, sessionID).Err(); err != nil {
+		return err
+	}
+	current, err := s.client.PTTL(ctx, indexKey).Result()
+	if err != nil {
+		return err
+	}
+	if current < ttl {
+		return s.client.PExpire(ctx, indexKey, ttl).Err()
+	}
+	return nil
+}
+
+// Get retrieves an identity context
+func (s *IdentityStore) Get(ctx context.Context, sessionID string) (*subject.IdentityContext, error) {
+	data, err := s.client.Get(ctx, s.sessionKey(ctx, sessionID)).Bytes()
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil, fmt.Errorf("identity not found for session: %s", sessionID)
+		}
+		return nil, err
+	}
+
+	return s.decode(data)
+}
+
+// Delete removes an identity context
+func (s *IdentityStore) Delete(ctx context.Context, sessionID string) error {
+	identity, err := s.Get(ctx, sessionID)
+	if err == nil && identity.Subject != nil {
+		_ = s.client.SRem(ctx, s.subjectKey(ctx, identity.Subject.ID), sessionID).Err()
+	}
+
+	return s.client.Del(ctx, s.sessionKey(ctx, sessionID)).Err()
+}
+
+// Update updates an existing identity context, keeping its expiry
+func (s *IdentityStore) Update(ctx context.Context, sessionID string, identity *subject.IdentityContext) error {
+	data, err := s.config.Codec.Marshal(identity)
+	if err != nil {
+		return fmt.Errorf("failed to encode identity: %w", err)
+	}
+
+	err = s.client.SetArgs(ctx, s.sessionKey(ctx, sessionID), data, goredis.SetArgs{
+		Mode:    "XX",
+		KeepTTL: true,
+	}).Err()
+	if errors.Is(err, goredis.Nil) {
+		return fmt.Errorf("identity not found for session: %s", sessionID)
+	}
+	return err
+}
+
+// ListBySubject lists all active sessions of a subject
+func (s *IdentityStore) ListBySubject(ctx context.Context, subjectID string) ([]*subject.IdentityContext, error) {
+	indexKey := s.subjectKey(ctx, subjectID)
+
+	sessionIDs, err := s.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	identities := make([]*subject.IdentityContext, 0, len(sessionIDs))
+	if len(sessionIDs) == 0 {
+		return identities, nil
+	}
+
+	keys := make([]string, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		keys[i] = s.sessionKey(ctx, sessionID)
+	}
+
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make([]any, 0)
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// Expired session: drop it from the index
+			stale = append(stale, sessionIDs[i])
+			continue
+		}
+
+		identity, err := s.decode([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	if len(stale) > 0 {
+		_ = s.client.SRem(ctx, indexKey, stale...).Err()
+	}
+
+	return identities, nil
+}
+
+// DeleteBySubject deletes all sessions of a subject
+func (s *IdentityStore) DeleteBySubject(ctx context.Context, subjectID string) error {
+	indexKey := s.subjectKey(ctx, subjectID)
+
+	sessionIDs, err := s.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(sessionIDs)+1)
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, s.sessionKey(ctx, sessionID))
+	}
+	keys = append(keys, indexKey)
+
+	return s.client.Del(ctx, keys...).Err()
+}
+
+func (s *IdentityStore) decode(data []byte) (*subject.IdentityContext, error) {
+	var identity subject.IdentityContext
+	if err := s.config.Codec.Unmarshal(data, &identity); err != nil {
+		return nil, fmt.Errorf("failed to decode identity: %w", err)
+	}
+	return &identity, nil
+}
+
+func (s *IdentityStore) sessionKey(ctx context.Context, sessionID string) string {
+	return s.config.key(ctx, "session", sessionID)
+}
+
+func (s *IdentityStore) subjectKey(ctx context.Context, subjectID string) string {
+	return s.config.key(ctx, "subject-sessions", subjectID)
+}
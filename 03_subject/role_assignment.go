@@ -0,0 +1,235 @@
+package subject
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RoleExpiryKey is the identity metadata key holding the expiry (unix
+// seconds) of time-bound roles, so authorizers can drop a role that expired
+// after the identity was built (e.g., while it was cached)
+const RoleExpiryKey = "role_expires_at"
+
+// RoleAssignment is a role of a subject, optionally bound to a validity
+// window (break-glass or contractor access)
+type RoleAssignment struct {
+	SubjectID string
+	Role      string
+
+	// ValidFrom is when the role becomes active (zero: immediately)
+	ValidFrom time.Time
+
+	// ValidUntil is when the role expires (zero: never)
+	ValidUntil time.Time
+
+	// Reason documents why the role was granted (e.g., an incident ticket)
+	Reason string
+}
+
+// ActiveAt reports whether the assignment is active at t
+func (a *RoleAssignment) ActiveAt(t time.Time) bool {
+	if !a.ValidFrom.IsZero() && t.Before(a.ValidFrom) {
+		return false
+	}
+	return a.ValidUntil.IsZero() || t.Before(a.ValidUntil)
+}
+
+// ExpiredAt reports whether the assignment has expired at t
+func (a *RoleAssignment) ExpiredAt(t time.Time) bool {
+	return !a.ValidUntil.IsZero() && !t.Before(a.ValidUntil)
+}
+
+// RoleExpiryProvider is implemented by role providers with time-bound roles.
+// Context builders record the expiries under RoleExpiryKey.
+type RoleExpiryProvider interface {
+	// GetRoleExpiries returns the expiry of the active time-bound roles of
+	// a subject
+	GetRoleExpiries(ctx context.Context, subject *Subject) (map[string]time.Time, error)
+}
+
+// RoleAssignmentStore stores time-bound role assignments
+type RoleAssignmentStore interface {
+	// ListRoleAssignments returns the assignments of a subject, including
+	// scheduled and expired ones
+	ListRoleAssignments(ctx context.Context, subjectID string) ([]*RoleAssignment, error)
+
+	// SweepRoleAssignments removes the assignments expired at now and returns
+	// them, together with the scheduled assignments that became active since
+	// the previous sweep
+	SweepRoleAssignments(ctx context.Context, now time.Time) (activated, expired []*RoleAssignment, err error)
+}
+
+// ActiveRoles returns the roles of the identity that have not expired at
+// now (see RoleExpiryKey)
+func (ic *IdentityContext) ActiveRoles(now time.Time) []string {
+	expiries, ok := ic.Metadata[RoleExpiryKey]
+	if !ok {
+		return ic.Roles
+	}
+
+	active := make([]string, 0, len(ic.Roles))
+	for _, role := range ic.Roles {
+		if expiresAt, ok := roleExpiry(expiries, role); ok && !now.Before(expiresAt) {
+			continue
+		}
+		active = append(active, role)
+	}
+	return active
+}
+
+// roleExpiry reads the expiry of a role from identity metadata, as stored by
+// a context builder or decoded from a cache
+func roleExpiry(expiries any, role string) (time.Time, bool) {
+	var value any
+	switch m := expiries.(type) {
+	case map[string]int64:
+		unix, ok := m[role]
+		return time.Unix(unix, 0), ok
+	case map[string]any:
+		value = m[role]
+	default:
+		return time.Time{}, false
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return time.Unix(v, 0), true
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	case uint64:
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+// RoleSweeperConfig holds role expiry sweeper configuration
+type RoleSweeperConfig struct {
+	// Store holds the role assignments (required)
+	Store RoleAssignmentStore
+
+	// Interval is how often assignments are swept (default: 1 minute)
+	Interval time.Duration
+
+	// Bus receives a SubjectChanged event for every subject whose role
+	// expired or became active, so cached identities are rebuilt (optional)
+	Bus InvalidationBus
+
+	// OnExpired is called for each expired assignment, e.g., to audit the end
+	// of break-glass access (optional)
+	OnExpired func(ctx context.Context, assignment *RoleAssignment)
+
+	// OnActivated is called for each scheduled assignment that became active
+	// (optional)
+	OnActivated func(ctx context.Context, assignment *RoleAssignment)
+
+	// OnError is called when a sweep fails (optional)
+	OnError func(err error)
+}
+
+// RoleSweeper removes expired role assignments in the background and
+// announces scheduled ones when they start
+type RoleSweeper struct {
+	config *RoleSweeperConfig
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewRoleSweeper creates a new role expiry sweeper. Call Start to run it.
+func NewRoleSweeper(config *RoleSweeperConfig) *RoleSweeper {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	return &RoleSweeper{
+		config: config,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start sweeps every Interval until ctx is cancelled or Stop is called
+func (s *RoleSweeper) Start(ctx context.Context) {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.stop:
+				return
+			case now := <-ticker.C:
+				if err := s.Sweep(ctx, now); err != nil && s.config.OnError != nil {
+					s.config.OnError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the sweeper and waits for a running sweep to finish
+func (s *RoleSweeper) Stop() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+}
+
+// Sweep removes the assignments expired at now and announces the ones that
+// became active
+func (s *RoleSweeper) Sweep(ctx context.Context, now time.Time) error {
+	activated, expired, err := s.config.Store.SweepRoleAssignments(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, assignment := range expired {
+		s.publish(ctx, assignment.SubjectID, "role_expired")
+		if s.config.OnExpired != nil {
+			s.config.OnExpired(ctx, assignment)
+		}
+	}
+	for _, assignment := range activated {
+		s.publish(ctx, assignment.SubjectID, "role_activated")
+		if s.config.OnActivated != nil {
+			s.config.OnActivated(ctx, assignment)
+		}
+	}
+	return nil
+}
+
+func (s *RoleSweeper) publish(ctx context.Context, subjectID, reason string) {
+	if s.config.Bus == nil {
+		return
+	}
+	s.config.Bus.Publish(ctx, ChangeEvent{
+		Kind:      SubjectChanged,
+		SubjectID: subjectID,
+		Reason:    reason,
+	})
+}
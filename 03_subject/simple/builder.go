@@ -2,6 +2,9 @@ package simple
 
 import (
 	"context"
+	"slices"
+	"sync"
+	"time"
 
 	subject "github.com/primadi/lokstra-auth/03_subject"
 )
@@ -12,6 +15,8 @@ type ContextBuilder struct {
 	permissionProvider subject.PermissionProvider
 	groupProvider      subject.GroupProvider
 	profileProvider    subject.ProfileProvider
+	access             subject.EffectiveAccessStore
+	scope              subject.AccessScopeFunc
 }
 
 // NewContextBuilder creates a new simple identity context builder
@@ -29,6 +34,15 @@ func NewContextBuilder(
 	}
 }
 
+// SetEffectiveAccessStore loads roles, permissions and groups with one call
+// to a store (e.g., rbac.PostgresStore) instead of the role, permission and
+// group providers. scope returns the tenant and app of the request (nil:
+// none).
+func (b *ContextBuilder) SetEffectiveAccessStore(store subject.EffectiveAccessStore, scope subject.AccessScopeFunc) {
+	b.access = store
+	b.scope = scope
+}
+
 // Build creates an IdentityContext from a subject
 func (b *ContextBuilder) Build(ctx context.Context, sub *subject.Subject) (*subject.IdentityContext, error) {
 	identity := &subject.IdentityContext{
@@ -36,20 +50,48 @@ func (b *ContextBuilder) Build(ctx context.Context, sub *subject.Subject) (*subj
 		Metadata: make(map[string]any),
 	}
 
+	if b.access != nil {
+		if err := b.loadEffectiveAccess(ctx, identity); err != nil {
+			return nil, err
+		}
+	} else if err := b.loadProviders(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	if err := b.loadProfile(ctx, identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// loadProviders loads roles, permissions and groups from the providers
+func (b *ContextBuilder) loadProviders(ctx context.Context, identity *subject.IdentityContext) error {
+	sub := identity.Subject
+
 	// Load roles
 	if b.roleProvider != nil {
 		roles, err := b.roleProvider.GetRoles(ctx, sub)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		identity.Roles = roles
+
+		// Time-bound roles stop counting when they expire, even in a
+		// cached identity
+		if expiryProvider, ok := b.roleProvider.(subject.RoleExpiryProvider); ok {
+			expiries, err := expiryProvider.GetRoleExpiries(ctx, sub)
+			if err != nil {
+				return err
+			}
+			setRoleExpiries(identity, expiries)
+		}
 	}
 
 	// Load permissions
 	if b.permissionProvider != nil {
 		permissions, err := b.permissionProvider.GetPermissions(ctx, sub)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		identity.Permissions = permissions
 	}
@@ -58,63 +100,354 @@ func (b *ContextBuilder) Build(ctx context.Context, sub *subject.Subject) (*subj
 	if b.groupProvider != nil {
 		groups, err := b.groupProvider.GetGroups(ctx, sub)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		identity.Groups = groups
 	}
 
-	// Load profile
-	if b.profileProvider != nil {
-		profile, err := b.profileProvider.GetProfile(ctx, sub)
-		if err != nil {
-			return nil, err
-		}
-		identity.Profile = profile
+	return nil
+}
+
+// loadEffectiveAccess loads roles, permissions and groups from the effective
+// access store
+func (b *ContextBuilder) loadEffectiveAccess(ctx context.Context, identity *subject.IdentityContext) error {
+	var tenantID, appID string
+	if b.scope != nil {
+		tenantID, appID = b.scope(ctx)
+	}
+	access, err := b.access.GetEffectiveAccess(ctx, tenantID, appID, identity.Subject.ID)
+	if err != nil {
+		return err
 	}
 
-	return identity, nil
+	identity.Roles = access.Roles
+	identity.Permissions = access.Permissions
+	identity.Groups = access.Groups
+	setRoleExpiries(identity, access.RoleExpiries)
+	return nil
 }
 
-// StaticRoleProvider provides a static list of roles
+// setRoleExpiries records the expiries of time-bound roles under
+// subject.RoleExpiryKey
+func setRoleExpiries(identity *subject.IdentityContext, expiries map[string]time.Time) {
+	if len(expiries) == 0 {
+		return
+	}
+	unix := make(map[string]int64, len(expiries))
+	for role, expiresAt := range expiries {
+		unix[role] = expiresAt.Unix()
+	}
+	identity.Metadata[subject.RoleExpiryKey] = unix
+}
+
+// loadProfile loads the profile from the profile provider
+func (b *ContextBuilder) loadProfile(ctx context.Context, identity *subject.IdentityContext) error {
+	if b.profileProvider == nil {
+		return nil
+	}
+	profile, err := b.profileProvider.GetProfile(ctx, identity.Subject)
+	if err != nil {
+		return err
+	}
+	identity.Profile = profile
+	return nil
+}
+
+// StaticRoleProvider provides a static list of roles.
+// Assignments can be changed at runtime with AssignRole, RevokeRole and SetRoles,
+// and bound to a validity window with AssignTimeBoundRole.
 type StaticRoleProvider struct {
-	roles map[string][]string
+	mu        sync.RWMutex
+	roles     map[string][]string
+	timeBound map[string]map[string]*timeBoundRole // subjectID -> role -> window
+	bus       subject.InvalidationBus
+}
+
+// timeBoundRole is the validity window of an assigned role
+type timeBoundRole struct {
+	assignment subject.RoleAssignment
+	announced  bool // active and reported by SweepRoleAssignments
 }
 
 // NewStaticRoleProvider creates a new static role provider
 func NewStaticRoleProvider(roles map[string][]string) *StaticRoleProvider {
+	if roles == nil {
+		roles = make(map[string][]string)
+	}
 	return &StaticRoleProvider{
-		roles: roles,
+		roles:     roles,
+		timeBound: make(map[string]map[string]*timeBoundRole),
 	}
 }
 
+// SetInvalidationBus publishes a SubjectChanged event on every assignment
+// change, so cached identities of the subject are purged
+func (p *StaticRoleProvider) SetInvalidationBus(bus subject.InvalidationBus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bus = bus
+}
+
 // GetRoles retrieves roles for a subject
 func (p *StaticRoleProvider) GetRoles(ctx context.Context, sub *subject.Subject) ([]string, error) {
-	if roles, ok := p.roles[sub.ID]; ok {
-		return roles, nil
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	active := make([]string, 0, len(p.roles[sub.ID]))
+	for _, role := range p.roles[sub.ID] {
+		if p.activeAt(sub.ID, role, now) {
+			active = append(active, role)
+		}
 	}
-	return []string{}, nil
+	return active, nil
+}
+
+// GetRoleExpiries returns the expiry of the active time-bound roles of a
+// subject
+func (p *StaticRoleProvider) GetRoleExpiries(ctx context.Context, sub *subject.Subject) (map[string]time.Time, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	expiries := make(map[string]time.Time)
+	for role, window := range p.timeBound[sub.ID] {
+		if window.assignment.ActiveAt(now) && !window.assignment.ValidUntil.IsZero() {
+			expiries[role] = window.assignment.ValidUntil
+		}
+	}
+	return expiries, nil
+}
+
+// AssignTimeBoundRole assigns a role that is only active between
+// ValidFrom and ValidUntil (zero: unbounded), e.g., break-glass access.
+// Assigning the role again replaces its window.
+func (p *StaticRoleProvider) AssignTimeBoundRole(ctx context.Context, assignment subject.RoleAssignment) {
+	p.mu.Lock()
+	if !slices.Contains(p.roles[assignment.SubjectID], assignment.Role) {
+		p.roles[assignment.SubjectID] = append(p.roles[assignment.SubjectID], assignment.Role)
+	}
+	if p.timeBound == nil {
+		p.timeBound = make(map[string]map[string]*timeBoundRole)
+	}
+	if p.timeBound[assignment.SubjectID] == nil {
+		p.timeBound[assignment.SubjectID] = make(map[string]*timeBoundRole)
+	}
+	p.timeBound[assignment.SubjectID][assignment.Role] = &timeBoundRole{
+		assignment: assignment,
+		announced:  assignment.ActiveAt(time.Now()),
+	}
+	bus := p.bus
+	p.mu.Unlock()
+
+	publishSubjectChanged(ctx, bus, assignment.SubjectID, "role_assigned")
+}
+
+// ListRoleAssignments returns the role assignments of a subject, including
+// scheduled ones
+func (p *StaticRoleProvider) ListRoleAssignments(ctx context.Context, subjectID string) ([]*subject.RoleAssignment, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	assignments := make([]*subject.RoleAssignment, 0, len(p.roles[subjectID]))
+	for _, role := range p.roles[subjectID] {
+		if window, ok := p.timeBound[subjectID][role]; ok {
+			assignment := window.assignment
+			assignments = append(assignments, &assignment)
+			continue
+		}
+		assignments = append(assignments, &subject.RoleAssignment{SubjectID: subjectID, Role: role})
+	}
+	return assignments, nil
+}
+
+// SweepRoleAssignments removes the roles expired at now and returns them,
+// together with the scheduled roles that became active since the last sweep
+func (p *StaticRoleProvider) SweepRoleAssignments(ctx context.Context, now time.Time) (activated, expired []*subject.RoleAssignment, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for subjectID, windows := range p.timeBound {
+		for role, window := range windows {
+			switch {
+			case window.assignment.ExpiredAt(now):
+				assignment := window.assignment
+				expired = append(expired, &assignment)
+				delete(windows, role)
+				p.roles[subjectID] = slices.DeleteFunc(slices.Clone(p.roles[subjectID]), func(r string) bool {
+					return r == role
+				})
+			case !window.announced && window.assignment.ActiveAt(now):
+				window.announced = true
+				assignment := window.assignment
+				activated = append(activated, &assignment)
+			}
+		}
+		if len(windows) == 0 {
+			delete(p.timeBound, subjectID)
+		}
+	}
+	return activated, expired, nil
+}
+
+// activeAt reports whether a role of a subject is active at now (caller
+// holds the lock)
+func (p *StaticRoleProvider) activeAt(subjectID, role string, now time.Time) bool {
+	window, ok := p.timeBound[subjectID][role]
+	return !ok || window.assignment.ActiveAt(now)
+}
+
+// AssignRole assigns a role to a subject
+func (p *StaticRoleProvider) AssignRole(ctx context.Context, subjectID, role string) {
+	p.mu.Lock()
+	if slices.Contains(p.roles[subjectID], role) {
+		p.mu.Unlock()
+		return
+	}
+	p.roles[subjectID] = append(p.roles[subjectID], role)
+	bus := p.bus
+	p.mu.Unlock()
+
+	publishSubjectChanged(ctx, bus, subjectID, "role_assigned")
+}
+
+// RevokeRole removes a role from a subject
+func (p *StaticRoleProvider) RevokeRole(ctx context.Context, subjectID, role string) {
+	p.mu.Lock()
+	roles := p.roles[subjectID]
+	i := slices.Index(roles, role)
+	if i < 0 {
+		p.mu.Unlock()
+		return
+	}
+	p.roles[subjectID] = slices.Delete(slices.Clone(roles), i, i+1)
+	delete(p.timeBound[subjectID], role)
+	bus := p.bus
+	p.mu.Unlock()
+
+	publishSubjectChanged(ctx, bus, subjectID, "role_revoked")
+}
+
+// SetRoles replaces the roles of a subject
+func (p *StaticRoleProvider) SetRoles(ctx context.Context, subjectID string, roles []string) {
+	p.mu.Lock()
+	p.roles[subjectID] = append([]string{}, roles...)
+	delete(p.timeBound, subjectID)
+	bus := p.bus
+	p.mu.Unlock()
+
+	publishSubjectChanged(ctx, bus, subjectID, "roles_replaced")
+}
+
+// Assignments returns a copy of all user → role assignments
+func (p *StaticRoleProvider) Assignments() map[string][]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make(map[string][]string, len(p.roles))
+	for subjectID, roles := range p.roles {
+		result[subjectID] = append([]string{}, roles...)
+	}
+	return result
 }
 
-// StaticPermissionProvider provides a static list of permissions
+// ListSubjectsByRole returns the IDs of subjects that have the role
+func (p *StaticRoleProvider) ListSubjectsByRole(ctx context.Context, role string) ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	subjects := make([]string, 0)
+	for subjectID, roles := range p.roles {
+		for _, r := range roles {
+			if r == role && p.activeAt(subjectID, role, now) {
+				subjects = append(subjects, subjectID)
+				break
+			}
+		}
+	}
+	return subjects, nil
+}
+
+// StaticPermissionProvider provides a static list of permissions.
+// Direct grants can be changed at runtime with GrantPermission and RevokePermission.
 type StaticPermissionProvider struct {
+	mu          sync.RWMutex
 	permissions map[string][]string
+	bus         subject.InvalidationBus
 }
 
 // NewStaticPermissionProvider creates a new static permission provider
 func NewStaticPermissionProvider(permissions map[string][]string) *StaticPermissionProvider {
+	if permissions == nil {
+		permissions = make(map[string][]string)
+	}
 	return &StaticPermissionProvider{
 		permissions: permissions,
 	}
 }
 
+// SetInvalidationBus publishes a SubjectChanged event on every grant
+// change, so cached identities of the subject are purged
+func (p *StaticPermissionProvider) SetInvalidationBus(bus subject.InvalidationBus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bus = bus
+}
+
 // GetPermissions retrieves permissions for a subject
 func (p *StaticPermissionProvider) GetPermissions(ctx context.Context, sub *subject.Subject) ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if permissions, ok := p.permissions[sub.ID]; ok {
-		return permissions, nil
+		return append([]string{}, permissions...), nil
 	}
 	return []string{}, nil
 }
 
+// GrantPermission grants a permission directly to a subject
+func (p *StaticPermissionProvider) GrantPermission(ctx context.Context, subjectID, permission string) {
+	p.mu.Lock()
+	if slices.Contains(p.permissions[subjectID], permission) {
+		p.mu.Unlock()
+		return
+	}
+	p.permissions[subjectID] = append(p.permissions[subjectID], permission)
+	bus := p.bus
+	p.mu.Unlock()
+
+	publishSubjectChanged(ctx, bus, subjectID, "permission_granted")
+}
+
+// RevokePermission revokes a direct permission of a subject
+func (p *StaticPermissionProvider) RevokePermission(ctx context.Context, subjectID, permission string) {
+	p.mu.Lock()
+	permissions := p.permissions[subjectID]
+	i := slices.Index(permissions, permission)
+	if i < 0 {
+		p.mu.Unlock()
+		return
+	}
+	p.permissions[subjectID] = slices.Delete(slices.Clone(permissions), i, i+1)
+	bus := p.bus
+	p.mu.Unlock()
+
+	publishSubjectChanged(ctx, bus, subjectID, "permission_revoked")
+}
+
+// publishSubjectChanged publishes a SubjectChanged event when a bus is set
+func publishSubjectChanged(ctx context.Context, bus subject.InvalidationBus, subjectID, reason string) {
+	if bus == nil {
+		return
+	}
+	bus.Publish(ctx, subject.ChangeEvent{
+		Kind:      subject.SubjectChanged,
+		SubjectID: subjectID,
+		Reason:    reason,
+	})
+}
+
 // StaticGroupProvider provides a static list of groups
 type StaticGroupProvider struct {
 	groups map[string][]string
@@ -135,22 +468,65 @@ func (p *StaticGroupProvider) GetGroups(ctx context.Context, sub *subject.Subjec
 	return []string{}, nil
 }
 
-// StaticProfileProvider provides a static profile
+// StaticProfileProvider provides in-memory profiles, seeded from a map.
+// Profiles can be changed at runtime with UpdateProfile.
 type StaticProfileProvider struct {
+	mu       sync.RWMutex
 	profiles map[string]map[string]any
+	bus      subject.InvalidationBus
 }
 
+var _ subject.ProfileStore = (*StaticProfileProvider)(nil)
+
 // NewStaticProfileProvider creates a new static profile provider
 func NewStaticProfileProvider(profiles map[string]map[string]any) *StaticProfileProvider {
+	if profiles == nil {
+		profiles = make(map[string]map[string]any)
+	}
 	return &StaticProfileProvider{
 		profiles: profiles,
 	}
 }
 
+// SetInvalidationBus publishes a SubjectChanged event on every profile
+// change, so cached identities of the subject are purged
+func (p *StaticProfileProvider) SetInvalidationBus(bus subject.InvalidationBus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bus = bus
+}
+
 // GetProfile retrieves profile information for a subject
 func (p *StaticProfileProvider) GetProfile(ctx context.Context, sub *subject.Subject) (map[string]any, error) {
-	if profile, ok := p.profiles[sub.ID]; ok {
-		return profile, nil
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	profile := make(map[string]any, len(p.profiles[sub.ID]))
+	for k, v := range p.profiles[sub.ID] {
+		profile[k] = v
 	}
-	return make(map[string]any), nil
+	return profile, nil
+}
+
+// UpdateProfile sets the attributes of the profile of a subject; nil values
+// remove attributes
+func (p *StaticProfileProvider) UpdateProfile(ctx context.Context, sub *subject.Subject, changes map[string]any) error {
+	p.mu.Lock()
+	profile := make(map[string]any, len(p.profiles[sub.ID])+len(changes))
+	for k, v := range p.profiles[sub.ID] {
+		profile[k] = v
+	}
+	for k, v := range changes {
+		if v == nil {
+			delete(profile, k)
+		} else {
+			profile[k] = v
+		}
+	}
+	p.profiles[sub.ID] = profile
+	bus := p.bus
+	p.mu.Unlock()
+
+	publishSubjectChanged(ctx, bus, sub.ID, "profile_updated")
+	return nil
 }
@@ -28,7 +28,7 @@ func NewResolver() *Resolver {
 		SubjectIDClaim:     "sub",
 		SubjectTypeClaim:   "type",
 		PrincipalClaim:     "username",
-		DefaultSubjectType: "user",
+		DefaultSubjectType: subject.SubjectTypeUser,
 	}
 }
 
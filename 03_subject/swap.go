@@ -0,0 +1,43 @@
+package subject
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// SwappableContextBuilder delegates to an identity context builder that can
+// be replaced at runtime (e.g., on configuration reload). In-flight builds
+// finish with the builder current when they started.
+type SwappableContextBuilder struct {
+	current atomic.Pointer[contextBuilderHolder]
+}
+
+type contextBuilderHolder struct {
+	builder IdentityContextBuilder
+}
+
+// NewSwappableContextBuilder creates a swappable identity context builder
+func NewSwappableContextBuilder(builder IdentityContextBuilder) *SwappableContextBuilder {
+	s := &SwappableContextBuilder{}
+	s.Swap(builder)
+	return s
+}
+
+// Swap replaces the builder and returns the previous one
+func (s *SwappableContextBuilder) Swap(builder IdentityContextBuilder) IdentityContextBuilder {
+	previous := s.current.Swap(&contextBuilderHolder{builder: builder})
+	if previous == nil {
+		return nil
+	}
+	return previous.builder
+}
+
+// Current returns the current builder
+func (s *SwappableContextBuilder) Current() IdentityContextBuilder {
+	return s.current.Load().builder
+}
+
+// Build builds the identity context with the current builder
+func (s *SwappableContextBuilder) Build(ctx context.Context, sub *Subject) (*IdentityContext, error) {
+	return s.Current().Build(ctx, sub)
+}
@@ -0,0 +1,172 @@
+package subject
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrUserIdentityNotFound = autherrors.New(autherrors.ErrNotFound, "linked identity not found")
+	ErrIdentityLinked       = autherrors.New(autherrors.ErrConflict, "identity is already linked to another user")
+)
+
+// UserIdentity links an identity of a provider (a Google account, a
+// username/password, an API client, ...) to a user of a tenant, so one user
+// can log in with several providers. Identities never cross tenants: the
+// same provider subject can be linked to a user in each tenant.
+type UserIdentity struct {
+	// TenantID is the tenant of the user (empty for single-tenant setups)
+	TenantID string
+
+	// UserID is the user the identity belongs to
+	UserID string
+
+	// Provider identifies the identity provider, e.g., "basic", "oauth2:google"
+	Provider string
+
+	// ProviderSubject is the subject of the identity at the provider
+	ProviderSubject string
+
+	// Email is the email address reported by the provider (optional)
+	Email string
+
+	// EmailVerified indicates the provider verified the email address
+	EmailVerified bool
+
+	// LinkedAt is when the identity was linked
+	LinkedAt time.Time
+
+	// Metadata contains additional identity data
+	Metadata map[string]any
+}
+
+func (i *UserIdentity) clone() *UserIdentity {
+	copied := *i
+	copied.Metadata = maps.Clone(i.Metadata)
+	return &copied
+}
+
+// UserIdentityStore persists the identities linked to users. Every lookup
+// is scoped to a tenant.
+type UserIdentityStore interface {
+	// Link stores an identity in its tenant. It fails with
+	// ErrIdentityLinked when the provider subject is linked to another user
+	// of the tenant.
+	Link(ctx context.Context, identity *UserIdentity) error
+
+	// Unlink removes an identity of a user of a tenant
+	Unlink(ctx context.Context, tenantID, userID, provider, providerSubject string) error
+
+	// Find returns the identity of a provider subject in a tenant
+	Find(ctx context.Context, tenantID, provider, providerSubject string) (*UserIdentity, error)
+
+	// ListByUser returns the identities of a user of a tenant, oldest first
+	ListByUser(ctx context.Context, tenantID, userID string) ([]*UserIdentity, error)
+
+	// FindByVerifiedEmail returns the identities of a tenant whose provider
+	// verified the email address (case-insensitive)
+	FindByVerifiedEmail(ctx context.Context, tenantID, email string) ([]*UserIdentity, error)
+}
+
+// InMemoryUserIdentityStore is an in-memory implementation of UserIdentityStore
+type InMemoryUserIdentityStore struct {
+	mu         sync.RWMutex
+	identities map[string]*UserIdentity // tenantID + "\x00" + provider + "\x00" + providerSubject -> identity
+}
+
+// NewInMemoryUserIdentityStore creates a new in-memory user identity store
+func NewInMemoryUserIdentityStore() *InMemoryUserIdentityStore {
+	return &InMemoryUserIdentityStore{
+		identities: make(map[string]*UserIdentity),
+	}
+}
+
+// Link stores an identity
+func (s *InMemoryUserIdentityStore) Link(ctx context.Context, identity *UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey(identity.TenantID, identity.Provider, identity.ProviderSubject)
+	if existing, ok := s.identities[key]; ok && existing.UserID != identity.UserID {
+		return ErrIdentityLinked
+	}
+
+	s.identities[key] = identity.clone()
+	return nil
+}
+
+// Unlink removes an identity of a user of a tenant
+func (s *InMemoryUserIdentityStore) Unlink(ctx context.Context, tenantID, userID, provider, providerSubject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey(tenantID, provider, providerSubject)
+	existing, ok := s.identities[key]
+	if !ok || existing.UserID != userID {
+		return ErrUserIdentityNotFound
+	}
+
+	delete(s.identities, key)
+	return nil
+}
+
+// Find returns the identity of a provider subject in a tenant
+func (s *InMemoryUserIdentityStore) Find(ctx context.Context, tenantID, provider, providerSubject string) (*UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, ok := s.identities[identityKey(tenantID, provider, providerSubject)]
+	if !ok {
+		return nil, ErrUserIdentityNotFound
+	}
+	return identity.clone(), nil
+}
+
+// ListByUser returns the identities of a user of a tenant, oldest first
+func (s *InMemoryUserIdentityStore) ListByUser(ctx context.Context, tenantID, userID string) ([]*UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identities := make([]*UserIdentity, 0)
+	for _, identity := range s.identities {
+		if identity.TenantID == tenantID && identity.UserID == userID {
+			identities = append(identities, identity.clone())
+		}
+	}
+
+	sortIdentities(identities)
+	return identities, nil
+}
+
+// FindByVerifiedEmail returns the identities of a tenant with a verified
+// email address
+func (s *InMemoryUserIdentityStore) FindByVerifiedEmail(ctx context.Context, tenantID, email string) ([]*UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identities := make([]*UserIdentity, 0)
+	for _, identity := range s.identities {
+		if identity.TenantID == tenantID && identity.EmailVerified && strings.EqualFold(identity.Email, email) {
+			identities = append(identities, identity.clone())
+		}
+	}
+
+	sortIdentities(identities)
+	return identities, nil
+}
+
+func identityKey(tenantID, provider, providerSubject string) string {
+	return tenantID + "\x00" + provider + "\x00" + providerSubject
+}
+
+func sortIdentities(identities []*UserIdentity) {
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].LinkedAt.Before(identities[j].LinkedAt)
+	})
+}
@@ -2,20 +2,39 @@ package abac
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	subject "github.com/primadi/lokstra-auth/03_subject"
 	authz "github.com/primadi/lokstra-auth/04_authz"
 )
 
-// Evaluator is an ABAC (Attribute-Based Access Control) policy evaluator
+// Evaluator is an ABAC (Attribute-Based Access Control) policy evaluator.
+// Rules are partitioned per tenant (see authz.WithTenant); each partition has
+// its own lock and memory accounting, and requests only see the rules of
+// their tenant (see authz.RequestPartition).
 type Evaluator struct {
-	rules             []*Rule
+	partitions        map[string]*partition // tenantID -> partition
+	mu                sync.RWMutex
+	quota             int64
 	attributeProvider authz.AttributeProvider
+	environment       authz.AttributeProvider
 	defaultDecision   bool
 }
 
+// partition holds the rules of one tenant
+type partition struct {
+	rules []*Rule
+	bytes int64
+	mu    sync.RWMutex
+}
+
 // Rule represents an ABAC rule
 type Rule struct {
 	ID          string
@@ -23,39 +42,92 @@ type Rule struct {
 	Effect      string // "allow" or "deny"
 	Conditions  []Condition
 	Priority    int // Higher priority rules evaluated first
+
+	// Obligations and Advice are attached to the decision when the rule
+	// matches (see authz.Obligation)
+	Obligations []authz.Obligation
+	Advice      []authz.Obligation
 }
 
 // Condition represents a condition in an ABAC rule
 type Condition struct {
 	Type     string // "subject", "resource", "environment", "action"
 	Key      string
-	Operator string // "eq", "ne", "in", "not_in", "gt", "lt", "contains", "matches"
-	Value    any
+	Operator string // "eq", "ne", "in", "not_in", "gt", "lt", "contains", "matches",
+	// "cidr_contains", "between_time", "day_of_week", "semver_gte", "intersects"
+	Value any
 }
 
 // NewEvaluator creates a new ABAC evaluator
 func NewEvaluator(attributeProvider authz.AttributeProvider, defaultDecision bool) *Evaluator {
 	return &Evaluator{
-		rules:             make([]*Rule, 0),
+		partitions:        make(map[string]*partition),
 		attributeProvider: attributeProvider,
+		environment:       authz.NewEnvironmentAttributeProvider(nil),
 		defaultDecision:   defaultDecision,
 	}
 }
 
-// AddRule adds a rule to the evaluator
+// SetEnvironmentProvider sets the provider of the built-in environment
+// attributes (default: authz.NewEnvironmentAttributeProvider(nil); nil
+// disables them)
+func (e *Evaluator) SetEnvironmentProvider(provider authz.AttributeProvider) {
+	e.environment = provider
+}
+
+// AddRule adds a rule to the default tenant
 func (e *Evaluator) AddRule(rule *Rule) {
-	e.rules = append(e.rules, rule)
+	p := e.partition(authz.DefaultTenant, true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.add(rule)
+}
+
+// AddTenantRule adds a rule to a tenant, enforcing the tenant memory quota
+func (e *Evaluator) AddTenantRule(tenantID string, rule *Rule) error {
+	quota := e.tenantQuota()
+
+	p := e.partition(tenantID, true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if quota > 0 && p.bytes+ruleSize(rule) > quota {
+		return authz.ErrTenantQuotaExceeded
+	}
+
+	p.add(rule)
+	return nil
+}
+
+// SetTenantQuota limits the estimated memory of each tenant partition
+// (0 = unlimited). AddTenantRule fails with authz.ErrTenantQuotaExceeded beyond it.
+func (e *Evaluator) SetTenantQuota(maxBytes int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.quota = maxBytes
+}
+
+// add adds a rule keeping priority order. Caller must hold p.mu.
+func (p *partition) add(rule *Rule) {
+	rules := make([]*Rule, len(p.rules), len(p.rules)+1)
+	copy(rules, p.rules)
+	rules = append(rules, rule)
+
 	// Sort by priority (higher first)
-	e.sortRules()
+	sortRules(rules)
+
+	p.rules = rules
+	p.bytes += ruleSize(rule)
 }
 
 // sortRules sorts rules by priority
-func (e *Evaluator) sortRules() {
+func sortRules(rules []*Rule) {
 	// Simple bubble sort (fine for small rule sets)
-	for i := 0; i < len(e.rules); i++ {
-		for j := i + 1; j < len(e.rules); j++ {
-			if e.rules[j].Priority > e.rules[i].Priority {
-				e.rules[i], e.rules[j] = e.rules[j], e.rules[i]
+	for i := 0; i < len(rules); i++ {
+		for j := i + 1; j < len(rules); j++ {
+			if rules[j].Priority > rules[i].Priority {
+				rules[i], rules[j] = rules[j], rules[i]
 			}
 		}
 	}
@@ -74,14 +146,22 @@ func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRe
 	resourceAttrs["type"] = request.Resource.Type
 	resourceAttrs["id"] = request.Resource.ID
 
-	envAttrs := request.Context
-	if envAttrs == nil {
-		envAttrs = make(map[string]any)
+	envAttrs, err := e.environmentAttributes(ctx, request.Subject, request.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	partition, err := authz.RequestPartition(ctx, request.Subject)
+	if err != nil {
+		return nil, err
 	}
 
-	// Evaluate rules in priority order
-	for _, rule := range e.rules {
+	// Evaluate rules of the tenant (or its sandbox) in priority order
+	for _, rule := range e.tenantRules(partition) {
 		matches, err := e.evaluateRule(rule, request.Action, subjectAttrs, resourceAttrs, envAttrs)
+		if authz.Explaining(ctx) {
+			authz.RecordTrace(ctx, e.traceRule(rule, matches, err, request.Action, subjectAttrs, resourceAttrs, envAttrs))
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -89,8 +169,10 @@ func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRe
 		if matches {
 			allowed := rule.Effect == "allow"
 			return &authz.AuthorizationDecision{
-				Allowed: allowed,
-				Reason:  fmt.Sprintf("rule '%s' matched (%s)", rule.ID, rule.Effect),
+				Allowed:     allowed,
+				Reason:      fmt.Sprintf("rule '%s' matched (%s)", rule.ID, rule.Effect),
+				Obligations: slices.Clone(rule.Obligations),
+				Advice:      slices.Clone(rule.Advice),
 				Metadata: map[string]any{
 					"rule_id": rule.ID,
 					"effect":  rule.Effect,
@@ -100,12 +182,36 @@ func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRe
 	}
 
 	// No rules matched, return default decision
+	authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "abac", Kind: "default", Result: authz.MatchResult(e.defaultDecision), Detail: "no rule matched"})
 	return &authz.AuthorizationDecision{
 		Allowed: e.defaultDecision,
 		Reason:  "no matching rules, using default decision",
 	}, nil
 }
 
+// environmentAttributes merges the environment attributes of an evaluation,
+// later sources winning: the built-in attributes (time, request), the
+// attribute provider, the session of the subject (IP, location, reputation)
+// and the request context
+func (e *Evaluator) environmentAttributes(ctx context.Context, identity *subject.IdentityContext, requestContext map[string]any) (map[string]any, error) {
+	envAttrs := make(map[string]any)
+	for _, provider := range []authz.AttributeProvider{e.environment, e.attributeProvider} {
+		if provider == nil {
+			continue
+		}
+		attrs, err := provider.GetEnvironmentAttributes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get environment attributes: %w", err)
+		}
+		maps.Copy(envAttrs, attrs)
+	}
+	if identity != nil && identity.Session != nil {
+		maps.Copy(envAttrs, identity.Session.EnvironmentAttributes())
+	}
+	maps.Copy(envAttrs, requestContext)
+	return envAttrs, nil
+}
+
 // evaluateRule checks if all conditions in a rule match
 func (e *Evaluator) evaluateRule(rule *Rule, action authz.Action, subjectAttrs, resourceAttrs, envAttrs map[string]any) (bool, error) {
 	for _, condition := range rule.Conditions {
@@ -120,6 +226,43 @@ func (e *Evaluator) evaluateRule(rule *Rule, action authz.Action, subjectAttrs,
 	return true, nil
 }
 
+// traceRule records the outcome of every condition of an evaluated rule
+func (e *Evaluator) traceRule(rule *Rule, matches bool, err error, action authz.Action, subjectAttrs, resourceAttrs, envAttrs map[string]any) authz.TraceStep {
+	step := authz.TraceStep{
+		Evaluator:  "abac",
+		Kind:       "rule",
+		ID:         rule.ID,
+		Result:     authz.MatchResult(matches),
+		Detail:     "effect " + rule.Effect,
+		Conditions: make([]authz.ConditionTrace, 0, len(rule.Conditions)),
+	}
+	if err != nil {
+		step.Result, step.Detail = authz.TraceError, err.Error()
+	}
+
+	for _, condition := range rule.Conditions {
+		trace := authz.ConditionTrace{Condition: fmt.Sprintf("%s.%s %s %v", condition.Type, condition.Key, condition.Operator, condition.Value)}
+		switch condition.Type {
+		case "action":
+			trace.Condition = fmt.Sprintf("action %s %v", condition.Operator, condition.Value)
+			trace.Actual = string(action)
+		case "subject":
+			trace.Actual = subjectAttrs[condition.Key]
+		case "resource":
+			trace.Actual = resourceAttrs[condition.Key]
+		case "environment":
+			trace.Actual = envAttrs[condition.Key]
+		}
+		matched, condErr := e.evaluateCondition(condition, action, subjectAttrs, resourceAttrs, envAttrs)
+		trace.Matched = matched
+		if condErr != nil {
+			trace.Error = condErr.Error()
+		}
+		step.Conditions = append(step.Conditions, trace)
+	}
+	return step
+}
+
 // evaluateCondition evaluates a single condition
 func (e *Evaluator) evaluateCondition(condition Condition, action authz.Action, subjectAttrs, resourceAttrs, envAttrs map[string]any) (bool, error) {
 	var actualValue any
@@ -137,11 +280,18 @@ func (e *Evaluator) evaluateCondition(condition Condition, action authz.Action,
 		return false, fmt.Errorf("unknown condition type: %s", condition.Type)
 	}
 
-	return e.compareValues(actualValue, condition.Operator, condition.Value)
+	return Compare(actualValue, condition.Operator, condition.Value)
+}
+
+// Operators are the condition operators understood by Compare
+var Operators = []string{
+	"eq", "ne", "in", "not_in", "contains", "gt", "lt", "matches",
+	"cidr_contains", "between_time", "day_of_week", "semver_gte", "intersects",
 }
 
-// compareValues compares two values using an operator
-func (e *Evaluator) compareValues(actual any, operator string, expected any) (bool, error) {
+// Compare compares an attribute value with the value of a condition using an
+// operator
+func Compare(actual any, operator string, expected any) (bool, error) {
 	switch operator {
 	case "eq":
 		return actual == expected, nil
@@ -202,6 +352,24 @@ func (e *Evaluator) compareValues(actual any, operator string, expected any) (bo
 		}
 		return actualNum < expectedNum, nil
 
+	case "matches":
+		return matchesRegexp(actual, expected)
+
+	case "cidr_contains":
+		return cidrContains(actual, expected)
+
+	case "between_time":
+		return betweenTime(actual, expected, time.Now())
+
+	case "day_of_week":
+		return dayOfWeek(actual, expected, time.Now())
+
+	case "semver_gte":
+		return semverGTE(actual, expected)
+
+	case "intersects":
+		return intersects(actual, expected)
+
 	default:
 		return false, fmt.Errorf("unknown operator: %s", operator)
 	}
@@ -220,6 +388,23 @@ func toFloat64(v any) (float64, bool) {
 		return float64(val), true
 	case int32:
 		return float64(val), true
+	case int16:
+		return float64(val), true
+	case int8:
+		return float64(val), true
+	case uint:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case uint32:
+		return float64(val), true
+	case uint16:
+		return float64(val), true
+	case uint8:
+		return float64(val), true
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
 	default:
 		return 0, false
 	}
@@ -294,20 +479,132 @@ func (e *Evaluator) HasAllRoles(ctx context.Context, identity *subject.IdentityC
 	return identity.HasAllRoles(roles...), nil
 }
 
-// RemoveRule removes a rule by ID
+// RemoveRule removes a rule by ID from the default tenant
 func (e *Evaluator) RemoveRule(ruleID string) bool {
-	for i, rule := range e.rules {
+	return e.RemoveTenantRule(authz.DefaultTenant, ruleID)
+}
+
+// RemoveTenantRule removes a rule by ID from a tenant
+func (e *Evaluator) RemoveTenantRule(tenantID, ruleID string) bool {
+	p := e.partition(tenantID, false)
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, rule := range p.rules {
 		if rule.ID == ruleID {
-			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			rules := make([]*Rule, 0, len(p.rules)-1)
+			rules = append(rules, p.rules[:i]...)
+			p.rules = append(rules, p.rules[i+1:]...)
+			p.bytes -= ruleSize(rule)
 			return true
 		}
 	}
 	return false
 }
 
-// GetRules returns all rules
+// GetRules returns all rules of the default tenant
 func (e *Evaluator) GetRules() []*Rule {
-	result := make([]*Rule, len(e.rules))
-	copy(result, e.rules)
+	return e.GetTenantRules(authz.DefaultTenant)
+}
+
+// GetTenantRules returns all rules of a tenant
+func (e *Evaluator) GetTenantRules(tenantID string) []*Rule {
+	rules := e.tenantRules(tenantID)
+	result := make([]*Rule, len(rules))
+	copy(result, rules)
 	return result
 }
+
+// DeleteTenant removes all rules of a tenant
+func (e *Evaluator) DeleteTenant(tenantID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.partitions, tenantID)
+}
+
+// Tenants returns the IDs of tenants that have rules
+func (e *Evaluator) Tenants() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	tenants := make([]string, 0, len(e.partitions))
+	for tenantID := range e.partitions {
+		tenants = append(tenants, tenantID)
+	}
+	sort.Strings(tenants)
+
+	return tenants
+}
+
+// TenantStats returns the memory accounting metrics of a tenant
+func (e *Evaluator) TenantStats(tenantID string) authz.TenantStats {
+	stats := authz.TenantStats{TenantID: tenantID}
+
+	p := e.partition(tenantID, false)
+	if p == nil {
+		return stats
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats.Keys = len(p.rules)
+	for _, rule := range p.rules {
+		stats.Entries += len(rule.Conditions)
+	}
+	stats.Bytes = p.bytes
+
+	return stats
+}
+
+// tenantRules returns the rule snapshot of a tenant.
+// Rule slices are copy-on-write, so the snapshot is safe to iterate unlocked.
+func (e *Evaluator) tenantRules(tenantID string) []*Rule {
+	p := e.partition(tenantID, false)
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.rules
+}
+
+// partition returns the partition of a tenant, creating it if requested
+func (e *Evaluator) partition(tenantID string, create bool) *partition {
+	e.mu.RLock()
+	p := e.partitions[tenantID]
+	e.mu.RUnlock()
+	if p != nil || !create {
+		return p
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if p = e.partitions[tenantID]; p == nil {
+		p = &partition{}
+		e.partitions[tenantID] = p
+	}
+
+	return p
+}
+
+// tenantQuota returns the per-tenant memory quota
+func (e *Evaluator) tenantQuota() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.quota
+}
+
+// ruleSize estimates the memory used by a rule
+func ruleSize(rule *Rule) int64 {
+	// pointer + struct headers
+	size := int64(len(rule.ID)+len(rule.Description)+len(rule.Effect)) + 96
+	for _, condition := range rule.Conditions {
+		size += int64(len(condition.Type)+len(condition.Key)+len(condition.Operator)) + 64
+		size += int64(len(fmt.Sprint(condition.Value)))
+	}
+	return size
+}
@@ -0,0 +1,85 @@
+package abac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// readRule allows reading
+var readRule = &Rule{
+	ID:         "allow-read",
+	Effect:     "allow",
+	Conditions: []Condition{{Type: "action", Operator: "eq", Value: "read"}},
+}
+
+// tenantRequest returns a read request of a user of a tenant
+func tenantRequest(tenantID string) *authz.AuthorizationRequest {
+	return &authz.AuthorizationRequest{
+		Subject: &subject.IdentityContext{Subject: &subject.Subject{
+			ID:         "user-1",
+			Type:       subject.SubjectTypeUser,
+			Attributes: map[string]any{authz.SubjectTenantAttribute: tenantID},
+		}},
+		Resource: &authz.Resource{Type: "document", ID: "doc-1"},
+		Action:   authz.ActionRead,
+	}
+}
+
+func TestEvaluateSubjectTenant(t *testing.T) {
+	evaluator := NewEvaluator(nil, false)
+	if err := evaluator.AddTenantRule("acme", readRule); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a context tenant, the subject's tenant is evaluated
+	ctx := context.Background()
+	for tenantID, want := range map[string]bool{"acme": true, "globex": false} {
+		decision, err := evaluator.Evaluate(ctx, tenantRequest(tenantID))
+		if err != nil {
+			t.Fatalf("%s: Evaluate: %v", tenantID, err)
+		}
+		if decision.Allowed != want {
+			t.Errorf("%s: allowed = %v, want %v", tenantID, decision.Allowed, want)
+		}
+	}
+
+	// A subject of another tenant never reads the context tenant's rules
+	decision, err := evaluator.Evaluate(authz.WithTenant(ctx, "acme"), tenantRequest("globex"))
+	if !errors.Is(err, authz.ErrSubjectTenantMismatch) {
+		t.Errorf("Evaluate = %+v, %v; want ErrSubjectTenantMismatch", decision, err)
+	}
+}
+
+func BenchmarkEvaluateParallelTenants(b *testing.B) {
+	const tenantCount = 200
+
+	evaluator := NewEvaluator(nil, false)
+	requests := make([]*authz.AuthorizationRequest, tenantCount)
+	for t := range requests {
+		tenantID := fmt.Sprintf("tenant-%d", t)
+		if err := evaluator.AddTenantRule(tenantID, readRule); err != nil {
+			b.Fatal(err)
+		}
+		requests[t] = tenantRequest(tenantID)
+	}
+
+	ctx := context.Background()
+	var counter atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			request := requests[counter.Add(1)%tenantCount]
+			if _, err := evaluator.Evaluate(ctx, request); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
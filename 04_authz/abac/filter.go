@@ -0,0 +1,118 @@
+package abac
+
+import (
+	"context"
+	"fmt"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// residual is a partially evaluated condition: a known value, or a predicate
+// over resource attributes
+type residual struct {
+	known bool
+	value bool
+	cond  *authz.FilterCondition
+}
+
+var (
+	residualTrue  = residual{known: true, value: true}
+	residualFalse = residual{known: true, value: false}
+)
+
+func (r residual) or(other residual) residual {
+	switch {
+	case r.known && r.value, other.known && !other.value:
+		return r
+	case r.known, other.known && other.value:
+		return other
+	}
+	return residual{cond: authz.Or(r.cond, other.cond)}
+}
+
+func (r residual) and(other residual) residual {
+	switch {
+	case r.known && !r.value, other.known && other.value:
+		return r
+	case r.known, other.known && !other.value:
+		return other
+	}
+	return residual{cond: authz.And(r.cond, other.cond)}
+}
+
+func (r residual) not() residual {
+	if r.known {
+		return residual{known: true, value: !r.value}
+	}
+	return residual{cond: authz.Not(r.cond)}
+}
+
+// ListAuthorizedResources partially evaluates the rules for a subject, action
+// and resource type: subject, action and environment conditions are decided
+// now, and the resource attribute conditions that remain become the filter
+// condition, preserving rule priority and the default decision.
+func (e *Evaluator) ListAuthorizedResources(ctx context.Context, identity *subject.IdentityContext, action authz.Action, resourceType string) (*authz.ResourceFilter, error) {
+	subjectAttrs := make(map[string]any)
+	if identity != nil {
+		subjectAttrs = e.getSubjectAttributes(identity)
+	}
+	envAttrs, err := e.environmentAttributes(ctx, identity, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first matching rule decides, so build the decision from the
+	// lowest priority rule up: allow ⇒ c ∨ next, deny ⇒ ¬c ∧ next
+	rules := e.tenantRules(authz.PartitionFromContext(ctx))
+	result := residualFalse
+	if e.defaultDecision {
+		result = residualTrue
+	}
+	for i := len(rules) - 1; i >= 0; i-- {
+		matches, err := e.partialRule(rules[i], action, resourceType, subjectAttrs, envAttrs)
+		if err != nil {
+			return nil, err
+		}
+		if rules[i].Effect == "allow" {
+			result = matches.or(result)
+		} else {
+			result = matches.not().and(result)
+		}
+	}
+
+	switch {
+	case !result.known:
+		return &authz.ResourceFilter{ResourceType: resourceType, Condition: result.cond}, nil
+	case result.value:
+		return authz.AllResources(resourceType), nil
+	}
+	return authz.NoResources(resourceType), nil
+}
+
+// partialRule partially evaluates the conditions of a rule
+func (e *Evaluator) partialRule(rule *Rule, action authz.Action, resourceType string, subjectAttrs, envAttrs map[string]any) (residual, error) {
+	result := residualTrue
+	for _, condition := range rule.Conditions {
+		if condition.Type == "resource" && condition.Key != "type" {
+			op := authz.FilterOp(condition.Operator)
+			switch op {
+			case authz.OpEq, authz.OpNe, authz.OpIn, authz.OpNotIn, authz.OpGt, authz.OpLt, authz.OpContains:
+			default:
+				return residual{}, fmt.Errorf("%w: rule '%s': operator %s", authz.ErrFilterNotSupported, rule.ID, condition.Operator)
+			}
+			result = result.and(residual{cond: authz.Compare(condition.Key, op, condition.Value)})
+			continue
+		}
+
+		resourceAttrs := map[string]any{"type": resourceType}
+		matches, err := e.evaluateCondition(condition, action, subjectAttrs, resourceAttrs, envAttrs)
+		if err != nil {
+			return residual{}, err
+		}
+		if !matches {
+			return residualFalse, nil
+		}
+	}
+	return result, nil
+}
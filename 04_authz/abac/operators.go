@@ -0,0 +1,430 @@
+package abac
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operators beyond eq/ne/in/not_in/gt/lt/contains. An absent attribute (nil)
+// never matches, except for the time operators, which then use the
+// evaluation time. A value of the wrong type, or a malformed condition value,
+// is an error naming the operator.
+
+// patterns caches compiled regular expressions by source
+var patterns sync.Map // string -> *regexp.Regexp
+
+// matchesRegexp reports whether actual matches the regular expression expected
+func matchesRegexp(actual, expected any) (bool, error) {
+	pattern, ok := expected.(string)
+	if !ok {
+		return false, fmt.Errorf("'matches' operator requires a string pattern, got %T", expected)
+	}
+	if actual == nil {
+		return false, nil
+	}
+	value, ok := toString(actual)
+	if !ok {
+		return false, fmt.Errorf("'matches' operator requires a string attribute, got %T", actual)
+	}
+
+	re, ok := patterns.Load(pattern)
+	if !ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("'matches' operator: invalid pattern %q: %w", pattern, err)
+		}
+		re, _ = patterns.LoadOrStore(pattern, compiled)
+	}
+	return re.(*regexp.Regexp).MatchString(value), nil
+}
+
+// cidrContains reports whether the IP address actual is in the network (or
+// any of the networks) expected
+func cidrContains(actual, expected any) (bool, error) {
+	cidrs, ok := toStrings(expected)
+	if !ok {
+		return false, fmt.Errorf("'cidr_contains' operator requires a CIDR or a list of CIDRs, got %T", expected)
+	}
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return false, fmt.Errorf("'cidr_contains' operator: invalid CIDR %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	if actual == nil {
+		return false, nil
+	}
+	var addr netip.Addr
+	switch ip := actual.(type) {
+	case netip.Addr:
+		addr = ip
+	case net.IP:
+		parsed, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			return false, fmt.Errorf("'cidr_contains' operator: invalid IP address %v", ip)
+		}
+		addr = parsed
+	case string:
+		parsed, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false, fmt.Errorf("'cidr_contains' operator: invalid IP address %q: %w", ip, err)
+		}
+		addr = parsed
+	default:
+		return false, fmt.Errorf("'cidr_contains' operator requires an IP address attribute, got %T", actual)
+	}
+
+	// IPv4-mapped IPv6 addresses (::ffff:10.0.0.1) match IPv4 networks
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// betweenTime reports whether the time of day of actual is within the window
+// expected: "HH:MM-HH:MM" or ["HH:MM", "HH:MM"], optionally with a time zone
+// as third element (default: the zone of the time). A window whose end is
+// before its start spans midnight. The start is inclusive, the end exclusive.
+func betweenTime(actual, expected any, now time.Time) (bool, error) {
+	bounds, ok := toStrings(expected)
+	if ok && len(bounds) == 1 {
+		bounds = strings.SplitN(bounds[0], "-", 2)
+	}
+	if !ok || len(bounds) < 2 || len(bounds) > 3 {
+		return false, fmt.Errorf("'between_time' operator requires [start, end] or [start, end, time zone], got %v", expected)
+	}
+
+	start, err := parseClock(bounds[0])
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(bounds[1])
+	if err != nil {
+		return false, err
+	}
+
+	t, err := toTime("between_time", actual, now)
+	if err != nil {
+		return false, err
+	}
+	if len(bounds) == 3 {
+		location, err := time.LoadLocation(strings.TrimSpace(bounds[2]))
+		if err != nil {
+			return false, fmt.Errorf("'between_time' operator: invalid time zone %q: %w", bounds[2], err)
+		}
+		t = t.In(location)
+	}
+
+	clock := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return clock >= start && clock < end, nil
+	}
+	return clock >= start || clock < end, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("'between_time' operator: invalid time of day %q (want HH:MM)", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// dayOfWeek reports whether the weekday of actual is one of expected: day
+// names ("mon", "Monday") or numbers (0 = Sunday), optionally followed by a
+// time zone ("tz:Asia/Jakarta")
+func dayOfWeek(actual, expected any, now time.Time) (bool, error) {
+	var values []any
+	switch v := expected.(type) {
+	case []any:
+		values = v
+	case []string:
+		for _, s := range v {
+			values = append(values, s)
+		}
+	default:
+		values = []any{v}
+	}
+
+	var location *time.Location
+	days := make(map[time.Weekday]bool, len(values))
+	for _, value := range values {
+		if name, ok := value.(string); ok {
+			if zone, ok := strings.CutPrefix(name, "tz:"); ok {
+				loc, err := time.LoadLocation(zone)
+				if err != nil {
+					return false, fmt.Errorf("'day_of_week' operator: invalid time zone %q: %w", zone, err)
+				}
+				location = loc
+				continue
+			}
+		}
+		day, err := parseWeekday(value)
+		if err != nil {
+			return false, err
+		}
+		days[day] = true
+	}
+
+	// A weekday attribute ("mon", time.Weekday) is compared directly
+	if weekday, ok := actual.(time.Weekday); ok {
+		return days[weekday], nil
+	}
+	if name, ok := actual.(string); ok {
+		if weekday, err := parseWeekday(name); err == nil {
+			return days[weekday], nil
+		}
+	}
+
+	t, err := toTime("day_of_week", actual, now)
+	if err != nil {
+		return false, err
+	}
+	if location != nil {
+		t = t.In(location)
+	}
+	return days[t.Weekday()], nil
+}
+
+// parseWeekday parses a day name or number (0 = Sunday)
+func parseWeekday(value any) (time.Weekday, error) {
+	if n, ok := toFloat64(value); ok {
+		if n < 0 || n > 6 || n != float64(int(n)) {
+			return 0, fmt.Errorf("'day_of_week' operator: invalid day number %v (want 0-6)", value)
+		}
+		return time.Weekday(n), nil
+	}
+	if name, ok := value.(string); ok {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) >= 3 {
+			if day, ok := weekdays[name[:3]]; ok && strings.HasPrefix(strings.ToLower(day.String()), name) {
+				return day, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("'day_of_week' operator: invalid day %v", value)
+}
+
+// toTime converts a time attribute: a time.Time, an RFC 3339 string or Unix
+// seconds. An absent attribute is the evaluation time.
+func toTime(operator string, value any, now time.Time) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return now, nil
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("'%s' operator: invalid time %q (want RFC 3339)", operator, v)
+		}
+		return t, nil
+	}
+	if seconds, ok := toFloat64(value); ok {
+		return time.Unix(int64(seconds), 0), nil
+	}
+	return time.Time{}, fmt.Errorf("'%s' operator requires a time attribute, got %T", operator, value)
+}
+
+// semverGTE reports whether the version actual is greater than or equal to
+// the version expected. Versions are MAJOR[.MINOR[.PATCH]][-PRERELEASE], with
+// an optional "v" prefix; build metadata is ignored.
+func semverGTE(actual, expected any) (bool, error) {
+	want, ok := toString(expected)
+	if !ok {
+		return false, fmt.Errorf("'semver_gte' operator requires a version string, got %T", expected)
+	}
+	minimum, err := parseSemver(want)
+	if err != nil {
+		return false, err
+	}
+	if actual == nil {
+		return false, nil
+	}
+	have, ok := toString(actual)
+	if !ok {
+		return false, fmt.Errorf("'semver_gte' operator requires a version attribute, got %T", actual)
+	}
+	version, err := parseSemver(have)
+	if err != nil {
+		return false, err
+	}
+	return version.compare(minimum) >= 0, nil
+}
+
+type semver struct {
+	core       [3]int
+	prerelease []string
+}
+
+func parseSemver(value string) (semver, error) {
+	var v semver
+	s := strings.TrimPrefix(strings.TrimSpace(value), "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, prerelease, hasPrerelease := strings.Cut(s, "-")
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("'semver_gte' operator: invalid version %q", value)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("'semver_gte' operator: invalid version %q", value)
+		}
+		v.core[i] = n
+	}
+	if hasPrerelease {
+		if prerelease == "" {
+			return v, fmt.Errorf("'semver_gte' operator: invalid version %q", value)
+		}
+		v.prerelease = strings.Split(prerelease, ".")
+	}
+	return v, nil
+}
+
+// compare orders versions by semantic versioning precedence
+func (v semver) compare(other semver) int {
+	for i := range v.core {
+		if v.core[i] != other.core[i] {
+			if v.core[i] < other.core[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A pre-release precedes its release
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		a, b := v.prerelease[i], other.prerelease[i]
+		if a == b {
+			continue
+		}
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil: // numeric identifiers precede alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		}
+		return strings.Compare(a, b)
+	}
+	return len(v.prerelease) - len(other.prerelease)
+}
+
+// intersects reports whether the slice attribute actual shares an element
+// with the slice expected. Scalars count as one-element slices; numbers
+// compare by value (1 matches 1.0).
+func intersects(actual, expected any) (bool, error) {
+	want, ok := toSlice(expected)
+	if !ok {
+		return false, fmt.Errorf("'intersects' operator requires a list value, got %T", expected)
+	}
+	if actual == nil {
+		return false, nil
+	}
+	have, ok := toSlice(actual)
+	if !ok {
+		have = []any{actual}
+	}
+
+	for _, a := range have {
+		for _, b := range want {
+			if looselyEqual(a, b) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// looselyEqual compares values, numbers by value
+func looselyEqual(a, b any) bool {
+	if an, ok := toFloat64(a); ok {
+		bn, ok := toFloat64(b)
+		return ok && an == bn
+	}
+	return a == b
+}
+
+// toSlice converts any slice or array to []any
+func toSlice(value any) ([]any, bool) {
+	if values, ok := value.([]any); ok {
+		return values, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	values := make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, true
+}
+
+// toStrings converts a string or a list of strings
+func toStrings(value any) ([]string, bool) {
+	if s, ok := value.(string); ok {
+		return []string{s}, true
+	}
+	values, ok := toSlice(value)
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		strs = append(strs, s)
+	}
+	return strs, true
+}
+
+// toString converts string-like values
+func toString(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,261 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrTemplateNotFound  = errors.New("ACL template not found")
+	ErrInvalidTemplate   = errors.New("invalid ACL template")
+	ErrTemplateVariable  = errors.New("ACL template variable not provided")
+	ErrInvalidBatchEntry = errors.New("invalid ACL batch operation")
+)
+
+// SubjectRef identifies the subject of an ACL entry
+type SubjectRef struct {
+	ID   string
+	Type string // "user" or "role"
+}
+
+// User refers to a user subject
+func User(id string) SubjectRef {
+	return SubjectRef{ID: id, Type: "user"}
+}
+
+// Role refers to a role subject
+func Role(id string) SubjectRef {
+	return SubjectRef{ID: id, Type: "role"}
+}
+
+// BatchOp is one operation of a batch: grant (or revoke) every permission to
+// every subject on a resource
+type BatchOp struct {
+	Revoke       bool
+	ResourceType string
+	ResourceID   string
+	Subjects     []SubjectRef
+	Permissions  []string
+}
+
+// GrantBatch grants every permission to every subject on a resource
+func (m *Manager) GrantBatch(ctx context.Context, resourceType, resourceID string, subjects []SubjectRef, permissions ...string) error {
+	return m.ApplyBatch(ctx, []BatchOp{{
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Subjects:     subjects,
+		Permissions:  permissions,
+	}})
+}
+
+// RevokeBatch revokes every permission from every subject on a resource
+func (m *Manager) RevokeBatch(ctx context.Context, resourceType, resourceID string, subjects []SubjectRef, permissions ...string) error {
+	return m.ApplyBatch(ctx, []BatchOp{{
+		Revoke:       true,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Subjects:     subjects,
+		Permissions:  permissions,
+	}})
+}
+
+// ApplyBatch applies grants and revokes across resources, in order, under a
+// single lock. The batch is atomic: when the tenant quota is exceeded no ACL
+// is changed.
+func (m *Manager) ApplyBatch(ctx context.Context, ops []BatchOp) error {
+	for i, op := range ops {
+		if op.ResourceType == "" || op.ResourceID == "" {
+			return fmt.Errorf("%w: operation %d has no resource", ErrInvalidBatchEntry, i)
+		}
+		for _, ref := range op.Subjects {
+			if ref.ID == "" || ref.Type == "" {
+				return fmt.Errorf("%w: operation %d has a subject without ID or type", ErrInvalidBatchEntry, i)
+			}
+		}
+	}
+
+	// Notify once per resource, after the lock is released
+	var resources []string
+	defer func() {
+		for _, key := range resources {
+			resourceType, resourceID, _ := strings.Cut(key, ":")
+			m.changed(ctx, resourceType, resourceID)
+		}
+	}()
+
+	p := m.partition(ctx, true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Build the new ACLs on copies
+	updated := make(map[string][]*ACLEntry)
+	for _, op := range ops {
+		key := m.resourceKey(op.ResourceType, op.ResourceID)
+		entries, ok := updated[key]
+		if !ok {
+			entries = cloneEntries(p.acls[key])
+			resources = append(resources, op.ResourceType+":"+op.ResourceID)
+		}
+		for _, ref := range op.Subjects {
+			if op.Revoke {
+				entries = revokeEntries(entries, ref.ID, ref.Type, op.Permissions)
+			} else {
+				entries = grantEntries(entries, ref.ID, ref.Type, op.Permissions)
+			}
+		}
+		updated[key] = entries
+	}
+
+	return p.setAll(updated, m.tenantQuota())
+}
+
+// setAll replaces the ACLs of several resources, all or nothing. Caller must
+// hold p.mu.
+func (p *partition) setAll(updated map[string][]*ACLEntry, quota int64) error {
+	previous := make(map[string][]*ACLEntry, len(updated))
+	for key, entries := range updated {
+		previous[key] = p.acls[key]
+		if err := p.set(key, entries, quota); err != nil {
+			// Roll back the resources already set
+			for done, old := range previous {
+				if done != key {
+					_ = p.set(done, old, 0)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Template is a named set of ACL entries applied to new resources (e.g.,
+// "project-default"). A subject ID may be a {variable} placeholder, e.g.,
+// {SubjectID: "{owner}", SubjectType: "user"}, filled by ApplyTemplate.
+type Template struct {
+	Name        string
+	Description string
+	Entries     []*ACLEntry
+}
+
+// SaveTemplate creates or replaces a template of the context tenant
+func (m *Manager) SaveTemplate(ctx context.Context, template *Template) error {
+	if template == nil || template.Name == "" {
+		return fmt.Errorf("%w: template has no name", ErrInvalidTemplate)
+	}
+	for _, entry := range template.Entries {
+		if entry.SubjectID == "" || entry.SubjectType == "" {
+			return fmt.Errorf("%w: %s: entry without subject ID or type", ErrInvalidTemplate, template.Name)
+		}
+	}
+
+	p := m.partition(ctx, true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.templates == nil {
+		p.templates = make(map[string]*Template)
+	}
+	p.templates[template.Name] = template.clone()
+	return nil
+}
+
+// GetTemplate returns a template of the context tenant
+func (m *Manager) GetTemplate(ctx context.Context, name string) (*Template, error) {
+	p := m.partition(ctx, false)
+	if p == nil {
+		return nil, ErrTemplateNotFound
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	template, ok := p.templates[name]
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+	return template.clone(), nil
+}
+
+// ListTemplates returns the templates of the context tenant, sorted by name
+func (m *Manager) ListTemplates(ctx context.Context) ([]*Template, error) {
+	p := m.partition(ctx, false)
+	if p == nil {
+		return []*Template{}, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	templates := make([]*Template, 0, len(p.templates))
+	for _, template := range p.templates {
+		templates = append(templates, template.clone())
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// DeleteTemplate deletes a template of the context tenant. ACLs the template
+// was applied to are not changed.
+func (m *Manager) DeleteTemplate(ctx context.Context, name string) error {
+	p := m.partition(ctx, false)
+	if p == nil {
+		return ErrTemplateNotFound
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.templates[name]; !ok {
+		return ErrTemplateNotFound
+	}
+	delete(p.templates, name)
+	return nil
+}
+
+// ApplyTemplate grants the entries of a template on a resource, filling the
+// {variable} placeholders of subject IDs from vars. Existing entries of the
+// resource are kept (use SetACL to replace them).
+func (m *Manager) ApplyTemplate(ctx context.Context, name, resourceType, resourceID string, vars map[string]string) error {
+	template, err := m.GetTemplate(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	ops := make([]BatchOp, 0, len(template.Entries))
+	for _, entry := range template.Entries {
+		subjectID, err := expandVariable(entry.SubjectID, vars)
+		if err != nil {
+			return fmt.Errorf("template %s: %w", name, err)
+		}
+		ops = append(ops, BatchOp{
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			Subjects:     []SubjectRef{{ID: subjectID, Type: entry.SubjectType}},
+			Permissions:  entry.Permissions,
+		})
+	}
+	return m.ApplyBatch(ctx, ops)
+}
+
+// expandVariable fills a {variable} subject ID
+func expandVariable(subjectID string, vars map[string]string) (string, error) {
+	name, ok := strings.CutPrefix(subjectID, "{")
+	if !ok {
+		return subjectID, nil
+	}
+	name, ok = strings.CutSuffix(name, "}")
+	if !ok {
+		return subjectID, nil
+	}
+	value := vars[name]
+	if value == "" {
+		return "", fmt.Errorf("%w: %s", ErrTemplateVariable, name)
+	}
+	return value, nil
+}
+
+func (t *Template) clone() *Template {
+	clone := *t
+	clone.Entries = cloneEntries(t.Entries)
+	return &clone
+}
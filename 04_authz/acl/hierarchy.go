@@ -0,0 +1,156 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+var (
+	ErrResourceCycle = errors.New("resource hierarchy cycle")
+)
+
+// SetParent makes a resource the child of another (document → folder), so
+// grants on the parent and its ancestors cascade to the child during Check
+// and Evaluate. It fails with ErrResourceCycle when the parent is a
+// descendant of the child.
+func (m *Manager) SetParent(ctx context.Context, childType, childID, parentType, parentID string) error {
+	defer m.changed(ctx, childType, childID)
+
+	p := m.partition(ctx, true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	child := m.resourceKey(childType, childID)
+	parent := m.resourceKey(parentType, parentID)
+
+	for key := parent; key != ""; key = p.parents[key] {
+		if key == child {
+			return fmt.Errorf("%w: %s → %s", ErrResourceCycle, child, parent)
+		}
+	}
+
+	if p.parents == nil {
+		p.parents = make(map[string]string)
+	}
+	size := linkSize(child, parent)
+	if old, ok := p.parents[child]; ok {
+		size -= linkSize(child, old)
+	}
+	if quota := m.tenantQuota(); quota > 0 && size > 0 && p.bytes+size > quota {
+		return authz.ErrTenantQuotaExceeded
+	}
+
+	p.parents[child] = parent
+	p.bytes += size
+	return nil
+}
+
+// RemoveParent detaches a resource from its parent
+func (m *Manager) RemoveParent(ctx context.Context, childType, childID string) error {
+	defer m.changed(ctx, childType, childID)
+
+	p := m.partition(ctx, false)
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	child := m.resourceKey(childType, childID)
+	if parent, ok := p.parents[child]; ok {
+		p.bytes -= linkSize(child, parent)
+		delete(p.parents, child)
+	}
+	return nil
+}
+
+// GetParent returns the parent of a resource
+func (m *Manager) GetParent(ctx context.Context, resourceType, resourceID string) (parentType, parentID string, ok bool) {
+	p := m.partition(ctx, false)
+	if p == nil {
+		return "", "", false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	parent, ok := p.parents[m.resourceKey(resourceType, resourceID)]
+	if !ok {
+		return "", "", false
+	}
+	parentType, parentID, _ = strings.Cut(parent, ":")
+	return parentType, parentID, true
+}
+
+// SetInheritance enables or disables inheritance for a resource. A resource
+// with inheritance disabled only honours its own ACL (e.g., a private
+// document in a shared folder); its own children still inherit from it.
+func (m *Manager) SetInheritance(ctx context.Context, resourceType, resourceID string, inherit bool) error {
+	defer m.changed(ctx, resourceType, resourceID)
+
+	p := m.partition(ctx, !inherit)
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := m.resourceKey(resourceType, resourceID)
+	if inherit {
+		delete(p.noInherit, key)
+		return nil
+	}
+	if p.noInherit == nil {
+		p.noInherit = make(map[string]bool)
+	}
+	p.noInherit[key] = true
+	return nil
+}
+
+// InheritsFrom reports whether a resource inherits the ACL of its parent
+func (m *Manager) InheritsFrom(ctx context.Context, resourceType, resourceID string) bool {
+	p := m.partition(ctx, false)
+	if p == nil {
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return !p.noInherit[m.resourceKey(resourceType, resourceID)]
+}
+
+// Ancestors returns the resources whose ACLs cascade to a resource, nearest
+// first ("type:id"), stopping at a resource with inheritance disabled
+func (m *Manager) Ancestors(ctx context.Context, resourceType, resourceID string) []string {
+	p := m.partition(ctx, false)
+	if p == nil {
+		return []string{}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	chain := p.chain(m.resourceKey(resourceType, resourceID))
+	return chain[1:]
+}
+
+// chain returns a resource followed by the ancestors it inherits from.
+// Caller must hold p.mu.
+func (p *partition) chain(key string) []string {
+	chain := []string{key}
+	for !p.noInherit[key] {
+		parent, ok := p.parents[key]
+		if !ok {
+			break
+		}
+		key = parent
+		chain = append(chain, key)
+	}
+	return chain
+}
+
+// linkSize estimates the memory used by a parent link
+func linkSize(child, parent string) int64 {
+	return int64(len(child)+len(parent)) + 32
+}
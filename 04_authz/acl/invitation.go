@@ -0,0 +1,316 @@
+package acl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrInvitationNotFound      = autherrors.New(autherrors.ErrNotFound, "invitation not found")
+	ErrInvitationExpired       = autherrors.New(autherrors.ErrConflict, "invitation has expired")
+	ErrInvitationNotPending    = autherrors.New(autherrors.ErrConflict, "invitation is no longer pending")
+	ErrInvitationEmailMismatch = autherrors.New(autherrors.ErrPermissionDenied, "invitation was sent to a different email")
+	ErrInvalidInvitation       = autherrors.New(autherrors.ErrInvalidRequest, "invalid invitation")
+)
+
+// InvitationStatus is the state of an invitation
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationRevoked  InvitationStatus = "revoked"
+)
+
+// Invitation is a pending grant: permissions on a resource shared with an
+// email address that has no account yet. The ACL entry is created when the
+// invitation is accepted.
+type Invitation struct {
+	ID           string
+	TokenHash    string // SHA-256 of the invitation token
+	Email        string // normalized (lowercase)
+	TenantID     string
+	ResourceType string
+	ResourceID   string
+	Permissions  []string
+	InvitedBy    string
+	Status       InvitationStatus
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	AcceptedBy   string // subject ID the ACL entry was granted to
+	AcceptedAt   time.Time
+}
+
+func (i *Invitation) clone() *Invitation {
+	copied := *i
+	copied.Permissions = append([]string(nil), i.Permissions...)
+	return &copied
+}
+
+// ShareRequest shares a resource with an email address
+type ShareRequest struct {
+	ResourceType string
+	ResourceID   string
+	Email        string
+	Permissions  []string
+	InvitedBy    string
+}
+
+// ShareResult is the outcome of a share
+type ShareResult struct {
+	// Granted is true when the email belongs to an existing account and the
+	// ACL entry was granted immediately
+	Granted bool
+
+	// SubjectID is the subject the permissions were granted to (if Granted)
+	SubjectID string
+
+	// Invitation is the pending invitation (if not Granted)
+	Invitation *Invitation
+
+	// Token is the invitation token to deliver to the invitee (if not Granted).
+	// Only its hash is stored.
+	Token string
+}
+
+// SubjectLookup resolves the subject ID of an email address.
+// It returns an empty ID when no account exists.
+type SubjectLookup func(ctx context.Context, email string) (subjectID string, err error)
+
+// InvitationNotifier delivers an invitation token (e.g., by email)
+type InvitationNotifier func(ctx context.Context, invitation *Invitation, token string) error
+
+// InvitationConfig holds invitation configuration
+type InvitationConfig struct {
+	// Store persists invitations (default: in-memory)
+	Store InvitationStore
+
+	// TTL is how long an invitation can be accepted (default: 7 days)
+	TTL time.Duration
+
+	// LookupSubject resolves existing accounts, so sharing with a known
+	// email grants immediately (optional: without it every share is an invitation)
+	LookupSubject SubjectLookup
+
+	// Notify delivers invitation tokens (optional)
+	Notify InvitationNotifier
+}
+
+// Invitations shares resources with email addresses, creating pending
+// grants for addresses without an account that are activated on signup
+// (ActivateForEmail) or when the invitation is accepted (Accept)
+type Invitations struct {
+	acl    *Manager
+	config *InvitationConfig
+	store  InvitationStore
+}
+
+// NewInvitations creates an invitation flow on top of an ACL manager
+func NewInvitations(acl *Manager, config *InvitationConfig) *Invitations {
+	if config == nil {
+		config = &InvitationConfig{}
+	}
+	if config.Store == nil {
+		config.Store = NewInMemoryInvitationStore()
+	}
+	if config.TTL <= 0 {
+		config.TTL = 7 * 24 * time.Hour
+	}
+
+	return &Invitations{
+		acl:    acl,
+		config: config,
+		store:  config.Store,
+	}
+}
+
+// Share shares a resource with an email address in the context tenant.
+// Existing accounts are granted immediately; otherwise a pending invitation
+// is created and delivered with the configured notifier.
+func (i *Invitations) Share(ctx context.Context, request *ShareRequest) (*ShareResult, error) {
+	email := normalizeEmail(request.Email)
+	if email == "" || request.ResourceType == "" || request.ResourceID == "" || len(request.Permissions) == 0 {
+		return nil, fmt.Errorf("%w: email, resource and permissions are required", ErrInvalidInvitation)
+	}
+
+	if i.config.LookupSubject != nil {
+		subjectID, err := i.config.LookupSubject(ctx, email)
+		if err != nil {
+			return nil, err
+		}
+		if subjectID != "" {
+			if err := i.acl.Grant(ctx, request.ResourceType, request.ResourceID, subjectID, "user", request.Permissions...); err != nil {
+				return nil, err
+			}
+			return &ShareResult{Granted: true, SubjectID: subjectID}, nil
+		}
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invitation := &Invitation{
+		ID:           id,
+		TokenHash:    hashToken(token),
+		Email:        email,
+		TenantID:     authz.TenantFromContext(ctx),
+		ResourceType: request.ResourceType,
+		ResourceID:   request.ResourceID,
+		Permissions:  append([]string(nil), request.Permissions...),
+		InvitedBy:    request.InvitedBy,
+		Status:       InvitationPending,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(i.config.TTL),
+	}
+
+	if err := i.store.Save(ctx, invitation); err != nil {
+		return nil, fmt.Errorf("failed to save invitation: %w", err)
+	}
+
+	if i.config.Notify != nil {
+		if err := i.config.Notify(ctx, invitation, token); err != nil {
+			return nil, fmt.Errorf("failed to deliver invitation: %w", err)
+		}
+	}
+
+	return &ShareResult{Invitation: invitation, Token: token}, nil
+}
+
+// Accept accepts an invitation with its token and activates the ACL entry
+// for subjectID. When email is not empty it must match the invited address.
+func (i *Invitations) Accept(ctx context.Context, token, subjectID, email string) (*Invitation, error) {
+	if token == "" || subjectID == "" {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitation, err := i.store.GetByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if email != "" && normalizeEmail(email) != invitation.Email {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	if err := i.activate(ctx, invitation, subjectID); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// ActivateForEmail activates every pending invitation of a (verified) email
+// address for a subject, e.g., right after signup. Expired invitations are
+// skipped.
+func (i *Invitations) ActivateForEmail(ctx context.Context, email, subjectID string) ([]*Invitation, error) {
+	if subjectID == "" {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitations, err := i.store.ListByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+
+	activated := make([]*Invitation, 0, len(invitations))
+	for _, invitation := range invitations {
+		if invitation.Status != InvitationPending || time.Now().After(invitation.ExpiresAt) {
+			continue
+		}
+		if err := i.activate(ctx, invitation, subjectID); err != nil {
+			return activated, err
+		}
+		activated = append(activated, invitation)
+	}
+
+	return activated, nil
+}
+
+// Pending returns the pending invitations of a resource in the context tenant
+func (i *Invitations) Pending(ctx context.Context, resourceType, resourceID string) ([]*Invitation, error) {
+	invitations, err := i.store.ListByResource(ctx, authz.TenantFromContext(ctx), resourceType, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]*Invitation, 0, len(invitations))
+	for _, invitation := range invitations {
+		if invitation.Status == InvitationPending && time.Now().Before(invitation.ExpiresAt) {
+			pending = append(pending, invitation)
+		}
+	}
+	return pending, nil
+}
+
+// Revoke cancels a pending invitation
+func (i *Invitations) Revoke(ctx context.Context, invitationID string) error {
+	invitation, err := i.store.Get(ctx, invitationID)
+	if err != nil {
+		return err
+	}
+	if invitation.Status != InvitationPending {
+		return ErrInvitationNotPending
+	}
+
+	invitation.Status = InvitationRevoked
+	return i.store.Save(ctx, invitation)
+}
+
+// activate grants the invitation permissions in its tenant and marks it accepted
+func (i *Invitations) activate(ctx context.Context, invitation *Invitation, subjectID string) error {
+	if invitation.Status != InvitationPending {
+		return ErrInvitationNotPending
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return ErrInvitationExpired
+	}
+
+	tenantCtx := authz.WithTenant(ctx, invitation.TenantID)
+	if err := i.acl.Grant(tenantCtx, invitation.ResourceType, invitation.ResourceID, subjectID, "user", invitation.Permissions...); err != nil {
+		return err
+	}
+
+	invitation.Status = InvitationAccepted
+	invitation.AcceptedBy = subjectID
+	invitation.AcceptedAt = time.Now()
+
+	if err := i.store.Save(ctx, invitation); err != nil {
+		return fmt.Errorf("failed to save invitation: %w", err)
+	}
+	return nil
+}
+
+// normalizeEmail lowercases and trims an email address
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// randomToken returns n random bytes, base64url encoded
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex SHA-256 hash of an invitation token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
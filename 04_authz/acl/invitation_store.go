@@ -0,0 +1,119 @@
+package acl
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// InvitationStore persists resource sharing invitations
+type InvitationStore interface {
+	// Save creates or replaces an invitation
+	Save(ctx context.Context, invitation *Invitation) error
+
+	// Get retrieves an invitation by ID
+	Get(ctx context.Context, id string) (*Invitation, error)
+
+	// GetByTokenHash retrieves an invitation by the hash of its token
+	GetByTokenHash(ctx context.Context, tokenHash string) (*Invitation, error)
+
+	// ListByEmail returns the invitations sent to an email address
+	ListByEmail(ctx context.Context, email string) ([]*Invitation, error)
+
+	// ListByResource returns the invitations of a resource in a tenant
+	ListByResource(ctx context.Context, tenantID, resourceType, resourceID string) ([]*Invitation, error)
+
+	// Delete removes an invitation
+	Delete(ctx context.Context, id string) error
+}
+
+// InMemoryInvitationStore is an in-memory implementation of InvitationStore
+type InMemoryInvitationStore struct {
+	mu          sync.RWMutex
+	invitations map[string]*Invitation // ID -> invitation
+}
+
+// NewInMemoryInvitationStore creates a new in-memory invitation store
+func NewInMemoryInvitationStore() *InMemoryInvitationStore {
+	return &InMemoryInvitationStore{
+		invitations: make(map[string]*Invitation),
+	}
+}
+
+// Save creates or replaces an invitation
+func (s *InMemoryInvitationStore) Save(ctx context.Context, invitation *Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invitations[invitation.ID] = invitation.clone()
+	return nil
+}
+
+// Get retrieves an invitation by ID
+func (s *InMemoryInvitationStore) Get(ctx context.Context, id string) (*Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitation, ok := s.invitations[id]
+	if !ok {
+		return nil, ErrInvitationNotFound
+	}
+	return invitation.clone(), nil
+}
+
+// GetByTokenHash retrieves an invitation by the hash of its token
+func (s *InMemoryInvitationStore) GetByTokenHash(ctx context.Context, tokenHash string) (*Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, invitation := range s.invitations {
+		if invitation.TokenHash == tokenHash {
+			return invitation.clone(), nil
+		}
+	}
+	return nil, ErrInvitationNotFound
+}
+
+// ListByEmail returns the invitations sent to an email address (oldest first)
+func (s *InMemoryInvitationStore) ListByEmail(ctx context.Context, email string) ([]*Invitation, error) {
+	return s.list(func(inv *Invitation) bool {
+		return inv.Email == email
+	}), nil
+}
+
+// ListByResource returns the invitations of a resource in a tenant (oldest first)
+func (s *InMemoryInvitationStore) ListByResource(ctx context.Context, tenantID, resourceType, resourceID string) ([]*Invitation, error) {
+	return s.list(func(inv *Invitation) bool {
+		return inv.TenantID == tenantID && inv.ResourceType == resourceType && inv.ResourceID == resourceID
+	}), nil
+}
+
+// Delete removes an invitation
+func (s *InMemoryInvitationStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invitations[id]; !ok {
+		return ErrInvitationNotFound
+	}
+	delete(s.invitations, id)
+	return nil
+}
+
+func (s *InMemoryInvitationStore) list(match func(*Invitation) bool) []*Invitation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitations := make([]*Invitation, 0)
+	for _, invitation := range s.invitations {
+		if match(invitation) {
+			invitations = append(invitations, invitation.clone())
+		}
+	}
+
+	sort.Slice(invitations, func(i, j int) bool {
+		return invitations[i].CreatedAt.Before(invitations[j].CreatedAt)
+	})
+
+	return invitations
+}
@@ -3,11 +3,14 @@ package acl
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 
 	subject "github.com/primadi/lokstra-auth/03_subject"
 	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/permission"
 )
 
 // ACLEntry represents a single access control entry
@@ -17,29 +20,100 @@ type ACLEntry struct {
 	Permissions []string // List of allowed permissions
 }
 
-// Manager manages access control lists for resources
+// Manager manages access control lists for resources.
+// ACLs are partitioned per tenant (see authz.WithTenant); each partition has
+// its own lock and memory accounting, so tenants do not contend or share data.
+// Checks read the partition of the subject's tenant (see
+// authz.RequestPartition).
 type Manager struct {
-	acls map[string][]*ACLEntry // resourceKey -> ACL entries
-	mu   sync.RWMutex
+	partitions map[string]*partition // tenantID -> partition
+	mu         sync.RWMutex
+	quota      int64
+	onChange   func(ctx context.Context, resourceType, resourceID string)
+}
+
+// partition holds the ACLs of one tenant
+type partition struct {
+	acls      map[string][]*ACLEntry // resourceKey -> ACL entries
+	parents   map[string]string      // resourceKey -> parent resourceKey
+	noInherit map[string]bool        // resources with inheritance disabled
+	templates map[string]*Template   // template name -> template
+	entries   int
+	bytes     int64
+	mu        sync.RWMutex
 }
 
 // NewManager creates a new ACL manager
 func NewManager() *Manager {
 	return &Manager{
-		acls: make(map[string][]*ACLEntry),
+		partitions: make(map[string]*partition),
 	}
 }
 
-// Grant grants permissions to a subject for a resource
-func (m *Manager) Grant(ctx context.Context, resourceType, resourceID, subjectID, subjectType string, permissions ...string) error {
+// SetTenantQuota limits the estimated memory of each tenant partition
+// (0 = unlimited). Writes that would exceed it fail with authz.ErrTenantQuotaExceeded.
+func (m *Manager) SetTenantQuota(maxBytes int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.quota = maxBytes
+}
+
+// OnChange registers a callback invoked after the ACL or the parent of a
+// resource changes, once for the resource and once for every descendant
+// inheriting from it (e.g., to invalidate cached decisions)
+func (m *Manager) OnChange(callback func(ctx context.Context, resourceType, resourceID string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = callback
+}
+
+// changed invokes the change callback for a resource and its descendants.
+// Deferred before the partition lock is taken, so it runs after release.
+func (m *Manager) changed(ctx context.Context, resourceType, resourceID string) {
+	m.mu.RLock()
+	callback := m.onChange
+	m.mu.RUnlock()
+	if callback == nil {
+		return
+	}
+
+	key := m.resourceKey(resourceType, resourceID)
+	affected := []string{key}
+	if p := m.partition(ctx, false); p != nil {
+		p.mu.RLock()
+		for child := range p.parents {
+			if child != key && slices.Contains(p.chain(child), key) {
+				affected = append(affected, child)
+			}
+		}
+		p.mu.RUnlock()
+	}
+
+	for _, k := range affected {
+		resourceType, resourceID, _ := strings.Cut(k, ":")
+		callback(ctx, resourceType, resourceID)
+	}
+}
+
+// Grant grants permissions to a subject for a resource
+func (m *Manager) Grant(ctx context.Context, resourceType, resourceID, subjectID, subjectType string, permissions ...string) error {
+	defer m.changed(ctx, resourceType, resourceID)
+
+	p := m.partition(ctx, true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
 	key := m.resourceKey(resourceType, resourceID)
+	entries := grantEntries(cloneEntries(p.acls[key]), subjectID, subjectType, permissions)
+	return p.set(key, entries, m.tenantQuota())
+}
 
+// grantEntries adds permissions to the entry of a subject, creating it if
+// needed. entries must be a copy owned by the caller.
+func grantEntries(entries []*ACLEntry, subjectID, subjectType string, permissions []string) []*ACLEntry {
 	// Find or create ACL entry
 	var entry *ACLEntry
-	for _, e := range m.acls[key] {
+	for _, e := range entries {
 		if e.SubjectID == subjectID && e.SubjectType == subjectType {
 			entry = e
 			break
@@ -52,7 +126,7 @@ func (m *Manager) Grant(ctx context.Context, resourceType, resourceID, subjectID
 			SubjectType: subjectType,
 			Permissions: []string{},
 		}
-		m.acls[key] = append(m.acls[key], entry)
+		entries = append(entries, entry)
 	}
 
 	// Add permissions (avoid duplicates)
@@ -62,18 +136,30 @@ func (m *Manager) Grant(ctx context.Context, resourceType, resourceID, subjectID
 		}
 	}
 
-	return nil
+	return entries
 }
 
 // Revoke removes permissions from a subject for a resource
 func (m *Manager) Revoke(ctx context.Context, resourceType, resourceID, subjectID, subjectType string, permissions ...string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.changed(ctx, resourceType, resourceID)
+
+	p := m.partition(ctx, false)
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
 	key := m.resourceKey(resourceType, resourceID)
+	entries := revokeEntries(cloneEntries(p.acls[key]), subjectID, subjectType, permissions)
+	return p.set(key, entries, 0)
+}
 
+// revokeEntries removes permissions from the entry of a subject. entries
+// must be a copy owned by the caller.
+func revokeEntries(entries []*ACLEntry, subjectID, subjectType string, permissions []string) []*ACLEntry {
 	// Find ACL entry
-	for _, entry := range m.acls[key] {
+	for _, entry := range entries {
 		if entry.SubjectID == subjectID && entry.SubjectType == subjectType {
 			// Remove permissions
 			newPerms := []string{}
@@ -87,41 +173,65 @@ func (m *Manager) Revoke(ctx context.Context, resourceType, resourceID, subjectI
 		}
 	}
 
-	return nil
+	return entries
 }
 
 // RevokeAll removes all permissions from a subject for a resource
 func (m *Manager) RevokeAll(ctx context.Context, resourceType, resourceID, subjectID, subjectType string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.changed(ctx, resourceType, resourceID)
+
+	p := m.partition(ctx, false)
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
 	key := m.resourceKey(resourceType, resourceID)
 
 	// Remove entry
 	newACL := []*ACLEntry{}
-	for _, entry := range m.acls[key] {
+	for _, entry := range p.acls[key] {
 		if entry.SubjectID != subjectID || entry.SubjectType != subjectType {
 			newACL = append(newACL, entry)
 		}
 	}
-	m.acls[key] = newACL
 
-	return nil
+	return p.set(key, newACL, 0)
 }
 
-// Check checks if a subject has permission on a resource
+// Check checks if a subject has permission on a resource, or on an ancestor
+// the resource inherits from (see SetParent)
 func (m *Manager) Check(ctx context.Context, resourceType, resourceID, subjectID string, permission string, identity *subject.IdentityContext) (bool, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	_, allowed, err := m.check(ctx, resourceType, resourceID, subjectID, permission, identity)
+	return allowed, err
+}
 
-	key := m.resourceKey(resourceType, resourceID)
-	entries := m.acls[key]
+// check returns the resource whose ACL grants a permission
+func (m *Manager) check(ctx context.Context, resourceType, resourceID, subjectID string, permission string, identity *subject.IdentityContext) (string, bool, error) {
+	p, err := m.subjectPartition(ctx, identity)
+	if p == nil || err != nil {
+		return "", false, err
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, key := range p.chain(m.resourceKey(resourceType, resourceID)) {
+		if grants(p.acls[key], subjectID, permission, identity) {
+			return key, true, nil
+		}
+	}
 
+	return "", false, nil
+}
+
+// grants reports whether ACL entries grant a permission to a subject
+func grants(entries []*ACLEntry, subjectID, required string, identity *subject.IdentityContext) bool {
 	// Check user-specific permissions
 	for _, entry := range entries {
 		if entry.SubjectType == "user" && entry.SubjectID == subjectID {
-			if contains(entry.Permissions, permission) || contains(entry.Permissions, "*") {
-				return true, nil
+			if permission.MatchAny(entry.Permissions, required) {
+				return true
 			}
 		}
 	}
@@ -131,43 +241,52 @@ func (m *Manager) Check(ctx context.Context, resourceType, resourceID, subjectID
 		for _, role := range identity.Roles {
 			for _, entry := range entries {
 				if entry.SubjectType == "role" && entry.SubjectID == role {
-					if contains(entry.Permissions, permission) || contains(entry.Permissions, "*") {
-						return true, nil
+					if permission.MatchAny(entry.Permissions, required) {
+						return true
 					}
 				}
 			}
 		}
 	}
 
-	return false, nil
+	return false
 }
 
-// GetPermissions gets all permissions for a subject on a resource
+// GetPermissions gets all permissions for a subject on a resource, including
+// the permissions inherited from its ancestors
 func (m *Manager) GetPermissions(ctx context.Context, resourceType, resourceID, subjectID string, identity *subject.IdentityContext) ([]string, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	key := m.resourceKey(resourceType, resourceID)
-	entries := m.acls[key]
+	p, err := m.subjectPartition(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return []string{}, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
 	permSet := make(map[string]bool)
 
-	// Get user-specific permissions
-	for _, entry := range entries {
-		if entry.SubjectType == "user" && entry.SubjectID == subjectID {
-			for _, perm := range entry.Permissions {
-				permSet[perm] = true
+	for _, key := range p.chain(m.resourceKey(resourceType, resourceID)) {
+		entries := p.acls[key]
+
+		// Get user-specific permissions
+		for _, entry := range entries {
+			if entry.SubjectType == "user" && entry.SubjectID == subjectID {
+				for _, perm := range entry.Permissions {
+					permSet[perm] = true
+				}
 			}
 		}
-	}
 
-	// Get role-based permissions
-	if identity != nil {
-		for _, role := range identity.Roles {
-			for _, entry := range entries {
-				if entry.SubjectType == "role" && entry.SubjectID == role {
-					for _, perm := range entry.Permissions {
-						permSet[perm] = true
+		// Get role-based permissions
+		if identity != nil {
+			for _, role := range identity.Roles {
+				for _, entry := range entries {
+					if entry.SubjectType == "role" && entry.SubjectID == role {
+						for _, perm := range entry.Permissions {
+							permSet[perm] = true
+						}
 					}
 				}
 			}
@@ -185,11 +304,15 @@ func (m *Manager) GetPermissions(ctx context.Context, resourceType, resourceID,
 
 // GetSubjects gets all subjects with permissions on a resource
 func (m *Manager) GetSubjects(ctx context.Context, resourceType, resourceID string) ([]string, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	p := m.partition(ctx, false)
+	if p == nil {
+		return []string{}, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
 	key := m.resourceKey(resourceType, resourceID)
-	entries := m.acls[key]
+	entries := p.acls[key]
 
 	subjects := make([]string, 0, len(entries))
 	for _, entry := range entries {
@@ -201,75 +324,106 @@ func (m *Manager) GetSubjects(ctx context.Context, resourceType, resourceID stri
 
 // GetACL gets the full ACL for a resource
 func (m *Manager) GetACL(ctx context.Context, resourceType, resourceID string) ([]*ACLEntry, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	p := m.partition(ctx, false)
+	if p == nil {
+		return []*ACLEntry{}, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
 	key := m.resourceKey(resourceType, resourceID)
-	entries := m.acls[key]
 
 	// Return a copy
-	result := make([]*ACLEntry, len(entries))
-	for i, entry := range entries {
-		result[i] = &ACLEntry{
-			SubjectID:   entry.SubjectID,
-			SubjectType: entry.SubjectType,
-			Permissions: append([]string{}, entry.Permissions...),
-		}
-	}
-
-	return result, nil
+	return cloneEntries(p.acls[key]), nil
 }
 
 // SetACL sets the full ACL for a resource (replaces existing)
 func (m *Manager) SetACL(ctx context.Context, resourceType, resourceID string, entries []*ACLEntry) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.changed(ctx, resourceType, resourceID)
 
-	key := m.resourceKey(resourceType, resourceID)
-	m.acls[key] = entries
+	p := m.partition(ctx, true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	return nil
+	key := m.resourceKey(resourceType, resourceID)
+	return p.set(key, cloneEntries(entries), m.tenantQuota())
 }
 
 // DeleteACL deletes the entire ACL for a resource
 func (m *Manager) DeleteACL(ctx context.Context, resourceType, resourceID string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.changed(ctx, resourceType, resourceID)
 
-	key := m.resourceKey(resourceType, resourceID)
-	delete(m.acls, key)
+	p := m.partition(ctx, false)
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	return nil
+	key := m.resourceKey(resourceType, resourceID)
+	return p.set(key, nil, 0)
 }
 
-// CopyACL copies ACL from one resource to another
+// CopyACL copies ACL from one resource to another (within the context tenant)
 func (m *Manager) CopyACL(ctx context.Context, srcType, srcID, dstType, dstID string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.changed(ctx, dstType, dstID)
+
+	p := m.partition(ctx, true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
 	srcKey := m.resourceKey(srcType, srcID)
 	dstKey := m.resourceKey(dstType, dstID)
 
-	srcEntries := m.acls[srcKey]
-
 	// Deep copy entries
-	dstEntries := make([]*ACLEntry, len(srcEntries))
-	for i, entry := range srcEntries {
-		dstEntries[i] = &ACLEntry{
-			SubjectID:   entry.SubjectID,
-			SubjectType: entry.SubjectType,
-			Permissions: append([]string{}, entry.Permissions...),
-		}
+	return p.set(dstKey, cloneEntries(p.acls[srcKey]), m.tenantQuota())
+}
+
+// DeleteTenant removes all ACLs of a tenant
+func (m *Manager) DeleteTenant(tenantID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.partitions, tenantID)
+}
+
+// Tenants returns the IDs of tenants that have ACLs
+func (m *Manager) Tenants() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenants := make([]string, 0, len(m.partitions))
+	for tenantID := range m.partitions {
+		tenants = append(tenants, tenantID)
 	}
+	sort.Strings(tenants)
 
-	m.acls[dstKey] = dstEntries
+	return tenants
+}
 
-	return nil
+// TenantStats returns the memory accounting metrics of a tenant
+func (m *Manager) TenantStats(tenantID string) authz.TenantStats {
+	stats := authz.TenantStats{TenantID: tenantID}
+
+	m.mu.RLock()
+	p := m.partitions[tenantID]
+	m.mu.RUnlock()
+	if p == nil {
+		return stats
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats.Keys = len(p.acls)
+	stats.Entries = p.entries
+	stats.Bytes = p.bytes
+
+	return stats
 }
 
 // Evaluate evaluates an authorization request using ACL
 func (m *Manager) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
-	allowed, err := m.Check(
+	source, allowed, err := m.check(
 		ctx,
 		request.Resource.Type,
 		request.Resource.ID,
@@ -277,26 +431,239 @@ func (m *Manager) Evaluate(ctx context.Context, request *authz.AuthorizationRequ
 		string(request.Action),
 		request.Subject,
 	)
-
 	if err != nil {
 		return nil, err
 	}
 
+	resource := m.resourceKey(request.Resource.Type, request.Resource.ID)
+	if authz.Explaining(ctx) {
+		m.traceChain(ctx, resource, source, string(request.Action))
+	}
+
+	metadata := map[string]any{
+		"resource": fmt.Sprintf("%s:%s", request.Resource.Type, request.Resource.ID),
+		"action":   request.Action,
+	}
+
 	reason := "access denied by ACL"
 	if allowed {
 		reason = "access granted by ACL"
+		if source != resource {
+			reason = fmt.Sprintf("access granted by ACL inherited from %s", source)
+			metadata["inherited_from"] = source
+		}
 	}
 
 	return &authz.AuthorizationDecision{
-		Allowed: allowed,
-		Reason:  reason,
-		Metadata: map[string]any{
-			"resource": fmt.Sprintf("%s:%s", request.Resource.Type, request.Resource.ID),
-			"action":   request.Action,
-		},
+		Allowed:  allowed,
+		Reason:   reason,
+		Metadata: metadata,
 	}, nil
 }
 
+// ListAuthorizedResources returns the IDs of the resources of a type on
+// which the subject is granted the action, directly or inherited from an
+// ancestor
+func (m *Manager) ListAuthorizedResources(ctx context.Context, identity *subject.IdentityContext, action authz.Action, resourceType string) (*authz.ResourceFilter, error) {
+	filter := authz.NoResources(resourceType)
+	p, err := m.subjectPartition(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || identity == nil || identity.Subject == nil {
+		return filter, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// Resources with an ACL or a parent link; others have no grants
+	prefix := m.resourceKey(resourceType, "")
+	candidates := make(map[string]bool)
+	for key := range p.acls {
+		candidates[key] = true
+	}
+	for key := range p.parents {
+		candidates[key] = true
+	}
+
+	for key := range candidates {
+		id, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		for _, source := range p.chain(key) {
+			if grants(p.acls[source], identity.Subject.ID, string(action), identity) {
+				filter.IDs = append(filter.IDs, id)
+				break
+			}
+		}
+	}
+
+	sort.Strings(filter.IDs)
+	return filter, nil
+}
+
+// traceChain records the ACLs consulted for a resource, up to the one that
+// granted the permission (source) or the end of the inheritance chain
+func (m *Manager) traceChain(ctx context.Context, resource, source, permission string) {
+	p := m.partition(ctx, false)
+	if p == nil {
+		authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "acl", Kind: "acl", ID: resource, Result: authz.TraceNotMatched, Detail: "no ACLs in tenant"})
+		return
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	chain := p.chain(resource)
+	for i, key := range chain {
+		detail := fmt.Sprintf("%d entries", len(p.acls[key]))
+		if i > 0 {
+			detail = "inherited, " + detail
+		}
+		if key == source {
+			authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "acl", Kind: "acl", ID: key, Result: authz.TraceMatched, Detail: detail + ", grants " + permission})
+			return
+		}
+		authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "acl", Kind: "acl", ID: key, Result: authz.TraceNotMatched, Detail: detail + ", no grant of " + permission})
+	}
+	last := chain[len(chain)-1]
+	if parent, ok := p.parents[last]; ok && p.noInherit[last] {
+		authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "acl", Kind: "inheritance", ID: last, Result: authz.TraceSkipped, Detail: "inheritance from " + parent + " disabled"})
+	}
+}
+
+// ContributeGraph adds subject → resource edges for every ACL entry of the context tenant
+func (m *Manager) ContributeGraph(ctx context.Context, graph *authz.AccessGraph) error {
+	p := m.partition(ctx, false)
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for key, entries := range p.acls {
+		resourceNode := graph.AddNode(authz.NodeKindResource, key)
+		for _, entry := range entries {
+			kind := authz.NodeKindUser
+			if entry.SubjectType == "role" {
+				kind = authz.NodeKindRole
+			}
+			subjectNode := graph.AddNode(kind, entry.SubjectID)
+			graph.AddEdge(subjectNode, resourceNode, fmt.Sprintf("acl [%s]", strings.Join(entry.Permissions, ",")))
+		}
+	}
+
+	for child, parent := range p.parents {
+		if p.noInherit[child] {
+			continue
+		}
+		parentNode := graph.AddNode(authz.NodeKindResource, parent)
+		graph.AddEdge(parentNode, graph.AddNode(authz.NodeKindResource, child), "inherits")
+	}
+
+	return nil
+}
+
+// partition returns the partition of the context tenant (or of its sandbox),
+// creating it if requested
+func (m *Manager) partition(ctx context.Context, create bool) *partition {
+	tenantID := authz.PartitionFromContext(ctx)
+
+	m.mu.RLock()
+	p := m.partitions[tenantID]
+	m.mu.RUnlock()
+	if p != nil || !create {
+		return p
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p = m.partitions[tenantID]; p == nil {
+		p = &partition{acls: make(map[string][]*ACLEntry)}
+		m.partitions[tenantID] = p
+	}
+
+	return p
+}
+
+// subjectPartition returns the partition an identity is authorized in (see
+// authz.RequestPartition), nil if it has no ACLs
+func (m *Manager) subjectPartition(ctx context.Context, identity *subject.IdentityContext) (*partition, error) {
+	tenantID, err := authz.RequestPartition(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.partitions[tenantID], nil
+}
+
+// tenantQuota returns the per-tenant memory quota
+func (m *Manager) tenantQuota() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.quota
+}
+
+// set replaces the ACL of a resource, updating the memory accounting.
+// Growth beyond quota (0 = unlimited) is rejected. Caller must hold p.mu.
+func (p *partition) set(key string, entries []*ACLEntry, quota int64) error {
+	oldBytes := aclSize(key, p.acls[key])
+	newBytes := int64(0)
+	if len(entries) > 0 {
+		newBytes = aclSize(key, entries)
+	}
+
+	if quota > 0 && newBytes > oldBytes && p.bytes-oldBytes+newBytes > quota {
+		return authz.ErrTenantQuotaExceeded
+	}
+
+	p.entries += len(entries) - len(p.acls[key])
+	p.bytes += newBytes - oldBytes
+
+	if len(entries) == 0 {
+		delete(p.acls, key)
+	} else {
+		p.acls[key] = entries
+	}
+
+	return nil
+}
+
+// aclSize estimates the memory used by the ACL of a resource
+func aclSize(key string, entries []*ACLEntry) int64 {
+	if entries == nil {
+		return 0
+	}
+
+	// map entry + slice header
+	size := int64(len(key)) + 64
+	for _, entry := range entries {
+		// pointer + struct headers
+		size += int64(len(entry.SubjectID)+len(entry.SubjectType)) + 72
+		for _, perm := range entry.Permissions {
+			size += int64(len(perm)) + 16
+		}
+	}
+
+	return size
+}
+
+// cloneEntries deep copies ACL entries
+func cloneEntries(entries []*ACLEntry) []*ACLEntry {
+	result := make([]*ACLEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = &ACLEntry{
+			SubjectID:   entry.SubjectID,
+			SubjectType: entry.SubjectType,
+			Permissions: append([]string{}, entry.Permissions...),
+		}
+	}
+	return result
+}
+
 // resourceKey creates a unique key for a resource
 func (m *Manager) resourceKey(resourceType, resourceID string) string {
 	return fmt.Sprintf("%s:%s", strings.ToLower(resourceType), resourceID)
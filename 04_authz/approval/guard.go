@@ -0,0 +1,378 @@
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrApprovalRequired  = autherrors.New(autherrors.ErrPermissionDenied, "operation requires approval by a second administrator")
+	ErrOperationNotFound = autherrors.New(autherrors.ErrNotFound, "pending operation not found")
+	ErrOperationExpired  = autherrors.New(autherrors.ErrConflict, "pending operation has expired")
+	ErrNotPending        = autherrors.New(autherrors.ErrConflict, "operation is no longer pending")
+	ErrSelfApproval      = autherrors.New(autherrors.ErrPermissionDenied, "operation cannot be approved by its requester")
+	ErrNotApprover       = autherrors.New(autherrors.ErrPermissionDenied, "subject is not allowed to approve operations")
+	ErrInvalidApproval   = autherrors.New(autherrors.ErrPermissionDenied, "invalid approval token")
+	ErrStatusConflict    = autherrors.New(autherrors.ErrConflict, "operation status changed concurrently")
+)
+
+// TokenHeader is the HTTP header carrying an approval token
+const TokenHeader = "X-Approval-Token"
+
+// DefaultApprovePermission is the permission approvers need by default
+const DefaultApprovePermission = "admin:approve"
+
+// Status is the state of a pending operation
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusRejected Status = "rejected"
+	StatusExecuted Status = "executed"
+)
+
+// Operation describes a destructive operation, e.g.,
+// {Kind: "tenant.delete", Target: "acme"}
+type Operation struct {
+	Kind   string
+	Target string
+	Params map[string]any // must be JSON-serializable
+}
+
+// digest identifies the exact operation an approval is valid for
+func (o *Operation) digest() (string, error) {
+	data, err := json.Marshal(struct {
+		Kind   string         `json:"kind"`
+		Target string         `json:"target"`
+		Params map[string]any `json:"params,omitempty"`
+	}{o.Kind, o.Target, o.Params})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode operation: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// PendingOperation is a guarded operation waiting for (or having received)
+// the approval of a second administrator
+type PendingOperation struct {
+	ID          string
+	TenantID    string
+	Kind        string
+	Target      string
+	Params      map[string]any
+	Digest      string // SHA-256 of kind, target and params
+	RequestedBy string
+	Status      Status
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+
+	ApprovedBy        string
+	ApprovedAt        time.Time
+	ApprovalTokenHash string    // SHA-256 of the approval token
+	TokenExpiresAt    time.Time // the approval token must be used before this time
+
+	RejectedBy   string
+	RejectReason string
+	ExecutedAt   time.Time
+}
+
+func (p *PendingOperation) clone() *PendingOperation {
+	copied := *p
+	copied.Params = maps.Clone(p.Params)
+	return &copied
+}
+
+// ApprovalRequiredError is returned by Authorize when an operation was
+// recorded for approval. errors.Is(err, ErrApprovalRequired) is true.
+type ApprovalRequiredError struct {
+	Operation *PendingOperation
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return fmt.Sprintf("%s: %s %s (pending operation %s)", ErrApprovalRequired, e.Operation.Kind, e.Operation.Target, e.Operation.ID)
+}
+
+func (e *ApprovalRequiredError) Unwrap() error {
+	return ErrApprovalRequired
+}
+
+// ApproverFunc decides whether an identity may approve an operation
+type ApproverFunc func(ctx context.Context, approver *subject.IdentityContext, operation *PendingOperation) bool
+
+// Notifier is called when an operation is waiting for approval (e.g., to
+// page the other administrators)
+type Notifier func(ctx context.Context, operation *PendingOperation) error
+
+// Config holds approval guard configuration
+type Config struct {
+	// Store persists pending operations (default: in-memory)
+	Store Store
+
+	// TTL is how long an operation can be approved (default: 24 hours)
+	TTL time.Duration
+
+	// TokenTTL is how long an approval token can be used (default: 15 minutes)
+	TokenTTL time.Duration
+
+	// CanApprove decides who may approve (default: identities with the
+	// DefaultApprovePermission permission). The requester can never approve.
+	CanApprove ApproverFunc
+
+	// Notify is called for new pending operations (optional)
+	Notify Notifier
+}
+
+// Guard requires the approval of a second administrator for destructive
+// operations. Service methods call Authorize before acting: the first call
+// records a pending operation and returns ErrApprovalRequired; once another
+// administrator approved it, the requester repeats the call with the approval
+// token in the context (WithToken) and the operation proceeds, exactly once.
+type Guard struct {
+	config *Config
+	store  Store
+}
+
+// NewGuard creates a new approval guard
+func NewGuard(config *Config) *Guard {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.Store == nil {
+		config.Store = NewInMemoryStore()
+	}
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.TokenTTL <= 0 {
+		config.TokenTTL = 15 * time.Minute
+	}
+	if config.CanApprove == nil {
+		config.CanApprove = func(ctx context.Context, approver *subject.IdentityContext, operation *PendingOperation) bool {
+			return approver.HasPermission(DefaultApprovePermission)
+		}
+	}
+
+	return &Guard{
+		config: config,
+		store:  config.Store,
+	}
+}
+
+// Authorize lets a guarded operation proceed when the context carries a
+// valid approval token for it; otherwise the operation is recorded for
+// approval and an *ApprovalRequiredError is returned
+func (g *Guard) Authorize(ctx context.Context, requester *subject.IdentityContext, operation *Operation) error {
+	requesterID := subjectID(requester)
+	if requesterID == "" {
+		return ErrNotApprover
+	}
+
+	digest, err := operation.digest()
+	if err != nil {
+		return err
+	}
+
+	if token := TokenFromContext(ctx); token != "" {
+		return g.consume(ctx, token, requesterID, digest)
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	pending := &PendingOperation{
+		ID:          id,
+		TenantID:    authz.TenantFromContext(ctx),
+		Kind:        operation.Kind,
+		Target:      operation.Target,
+		Params:      operation.Params,
+		Digest:      digest,
+		RequestedBy: requesterID,
+		Status:      StatusPending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(g.config.TTL),
+	}
+	if err := g.store.Create(ctx, pending); err != nil {
+		return fmt.Errorf("failed to save pending operation: %w", err)
+	}
+
+	if g.config.Notify != nil {
+		if err := g.config.Notify(ctx, pending); err != nil {
+			return fmt.Errorf("failed to notify approvers: %w", err)
+		}
+	}
+
+	return &ApprovalRequiredError{Operation: pending.clone()}
+}
+
+// Approve approves a pending operation and returns the approval token the
+// requester uses to execute it
+func (g *Guard) Approve(ctx context.Context, operationID string, approver *subject.IdentityContext) (string, error) {
+	pending, err := g.pending(ctx, operationID, approver)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	pending.Status = StatusApproved
+	pending.ApprovedBy = subjectID(approver)
+	pending.ApprovedAt = now
+	pending.ApprovalTokenHash = hashToken(token)
+	pending.TokenExpiresAt = now.Add(g.config.TokenTTL)
+
+	if err := g.store.Update(ctx, pending, StatusPending); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Reject rejects a pending operation
+func (g *Guard) Reject(ctx context.Context, operationID string, approver *subject.IdentityContext, reason string) error {
+	pending, err := g.pending(ctx, operationID, approver)
+	if err != nil {
+		return err
+	}
+
+	pending.Status = StatusRejected
+	pending.RejectedBy = subjectID(approver)
+	pending.RejectReason = reason
+
+	return g.store.Update(ctx, pending, StatusPending)
+}
+
+// Get returns a guarded operation
+func (g *Guard) Get(ctx context.Context, operationID string) (*PendingOperation, error) {
+	return g.store.Get(ctx, operationID)
+}
+
+// Pending returns the operations of the context tenant waiting for approval
+func (g *Guard) Pending(ctx context.Context) ([]*PendingOperation, error) {
+	operations, err := g.store.List(ctx, authz.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pending := make([]*PendingOperation, 0, len(operations))
+	for _, operation := range operations {
+		if operation.Status == StatusPending && now.Before(operation.ExpiresAt) {
+			pending = append(pending, operation)
+		}
+	}
+	return pending, nil
+}
+
+// pending loads an operation that approver may decide on
+func (g *Guard) pending(ctx context.Context, operationID string, approver *subject.IdentityContext) (*PendingOperation, error) {
+	pending, err := g.store.Get(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+	if pending.Status != StatusPending {
+		return nil, ErrNotPending
+	}
+	if time.Now().After(pending.ExpiresAt) {
+		return nil, ErrOperationExpired
+	}
+
+	approverID := subjectID(approver)
+	if approverID == "" {
+		return nil, ErrNotApprover
+	}
+	if approverID == pending.RequestedBy {
+		return nil, ErrSelfApproval
+	}
+	if !g.config.CanApprove(ctx, approver, pending) {
+		return nil, ErrNotApprover
+	}
+
+	return pending, nil
+}
+
+// consume marks the approved operation of a token as executed
+func (g *Guard) consume(ctx context.Context, token, requesterID, digest string) error {
+	pending, err := g.store.GetByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrOperationNotFound) {
+			return ErrInvalidApproval
+		}
+		return err
+	}
+
+	if pending.Status != StatusApproved ||
+		pending.Digest != digest ||
+		pending.TenantID != authz.TenantFromContext(ctx) ||
+		pending.RequestedBy != requesterID ||
+		time.Now().After(pending.TokenExpiresAt) {
+		return ErrInvalidApproval
+	}
+
+	pending.Status = StatusExecuted
+	pending.ExecutedAt = time.Now()
+
+	if err := g.store.Update(ctx, pending, StatusApproved); err != nil {
+		if errors.Is(err, ErrStatusConflict) {
+			// The token was used concurrently
+			return ErrInvalidApproval
+		}
+		return err
+	}
+	return nil
+}
+
+type tokenContextKey struct{}
+
+// WithToken returns a context carrying an approval token
+// (e.g., from the TokenHeader of a request)
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
+
+// TokenFromContext returns the approval token of the context, if any
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenContextKey{}).(string)
+	return token
+}
+
+func subjectID(identity *subject.IdentityContext) string {
+	if identity == nil || identity.Subject == nil {
+		return ""
+	}
+	return identity.Subject.ID
+}
+
+// randomToken returns n random bytes, base64url encoded
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate approval token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex SHA-256 hash of an approval token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
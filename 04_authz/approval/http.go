@@ -0,0 +1,14 @@
+package approval
+
+import "net/http"
+
+// Middleware copies the approval token of the TokenHeader into the request
+// context, for guarded service methods called by the handler
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get(TokenHeader); token != "" {
+			r = r.WithContext(WithToken(r.Context(), token))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
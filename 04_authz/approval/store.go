@@ -0,0 +1,109 @@
+package approval
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Store persists guarded operations
+type Store interface {
+	// Create stores a new pending operation
+	Create(ctx context.Context, operation *PendingOperation) error
+
+	// Update replaces an operation if its stored status is still expected,
+	// otherwise it returns ErrStatusConflict (so an approval token cannot be
+	// used twice, even by concurrent requests on different nodes)
+	Update(ctx context.Context, operation *PendingOperation, expected Status) error
+
+	// Get retrieves an operation by ID
+	Get(ctx context.Context, id string) (*PendingOperation, error)
+
+	// GetByTokenHash retrieves an operation by the hash of its approval token
+	GetByTokenHash(ctx context.Context, tokenHash string) (*PendingOperation, error)
+
+	// List returns the operations of a tenant, oldest first
+	List(ctx context.Context, tenantID string) ([]*PendingOperation, error)
+}
+
+// InMemoryStore is an in-memory implementation of Store
+type InMemoryStore struct {
+	mu         sync.RWMutex
+	operations map[string]*PendingOperation // ID -> operation
+}
+
+// NewInMemoryStore creates a new in-memory operation store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		operations: make(map[string]*PendingOperation),
+	}
+}
+
+// Create stores a new pending operation
+func (s *InMemoryStore) Create(ctx context.Context, operation *PendingOperation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.operations[operation.ID] = operation.clone()
+	return nil
+}
+
+// Update replaces an operation if its stored status is still expected
+func (s *InMemoryStore) Update(ctx context.Context, operation *PendingOperation, expected Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.operations[operation.ID]
+	if !ok {
+		return ErrOperationNotFound
+	}
+	if stored.Status != expected {
+		return ErrStatusConflict
+	}
+
+	s.operations[operation.ID] = operation.clone()
+	return nil
+}
+
+// Get retrieves an operation by ID
+func (s *InMemoryStore) Get(ctx context.Context, id string) (*PendingOperation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	operation, ok := s.operations[id]
+	if !ok {
+		return nil, ErrOperationNotFound
+	}
+	return operation.clone(), nil
+}
+
+// GetByTokenHash retrieves an operation by the hash of its approval token
+func (s *InMemoryStore) GetByTokenHash(ctx context.Context, tokenHash string) (*PendingOperation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, operation := range s.operations {
+		if operation.ApprovalTokenHash != "" && operation.ApprovalTokenHash == tokenHash {
+			return operation.clone(), nil
+		}
+	}
+	return nil, ErrOperationNotFound
+}
+
+// List returns the operations of a tenant, oldest first
+func (s *InMemoryStore) List(ctx context.Context, tenantID string) ([]*PendingOperation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	operations := make([]*PendingOperation, 0)
+	for _, operation := range s.operations {
+		if operation.TenantID == tenantID {
+			operations = append(operations, operation.clone())
+		}
+	}
+
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].CreatedAt.Before(operations[j].CreatedAt)
+	})
+	return operations, nil
+}
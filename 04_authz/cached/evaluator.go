@@ -0,0 +1,461 @@
+package cached
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/metrics"
+)
+
+// Config holds decision cache configuration
+type Config struct {
+	// TTL is how long a decision is cached (default: 1 minute)
+	TTL time.Duration
+
+	// MaxEntries bounds the cache; the least recently used decision is
+	// evicted beyond it (default: 10000)
+	MaxEntries int
+
+	// SkipDenials caches only allowed decisions
+	SkipDenials bool
+
+	// Attributes returns the attributes a decision depends on; they are
+	// hashed into the cache key, so a change of any of them is a miss
+	// (default: the subject's roles, groups, permissions and attributes, the
+	// resource attributes, the session environment and the request context).
+	// Narrowing it to the attributes policies actually read raises the hit
+	// rate.
+	Attributes func(request *authz.AuthorizationRequest) any
+
+	// Now returns the current time (default: time.Now)
+	Now func() time.Time
+
+	// Metrics records lookups as cache "decision" (optional)
+	Metrics metrics.Recorder
+}
+
+// Stats holds cache counters
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Entries   int
+	Evictions int64
+}
+
+// Evaluator wraps a policy evaluator with a decision cache keyed by tenant,
+// subject, resource, action and a hash of the relevant attributes. Cached
+// decisions are dropped when their TTL expires or when an invalidation hook
+// reports a change to the subject, role, resource or policies they depend on.
+type Evaluator struct {
+	base   authz.PolicyEvaluator
+	config *Config
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	bySubject  map[string]map[string]bool // tenant|subject -> cache keys
+	byRole     map[string]map[string]bool // role -> cache keys
+	byResource map[string]map[string]bool // tenant|type:id -> cache keys
+	stats      Stats
+}
+
+// entry is a cached decision with its index keys
+type entry struct {
+	key       string
+	decision  *authz.AuthorizationDecision
+	expiresAt time.Time
+	tenant    string
+	subject   string
+	roles     []string
+	resource  string
+}
+
+// NewEvaluator wraps a policy evaluator with a decision cache
+func NewEvaluator(base authz.PolicyEvaluator, config *Config) *Evaluator {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Minute
+	}
+	if config.MaxEntries == 0 {
+		config.MaxEntries = 10000
+	}
+	if config.Attributes == nil {
+		config.Attributes = defaultAttributes
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	return &Evaluator{
+		base:       base,
+		config:     config,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		bySubject:  make(map[string]map[string]bool),
+		byRole:     make(map[string]map[string]bool),
+		byResource: make(map[string]map[string]bool),
+	}
+}
+
+// Evaluate returns the cached decision of a request, or evaluates and caches
+// it. Errors are not cached. Cached decisions carry Metadata["cached"] = true.
+// In explain mode (see authz.Explain) the cache is bypassed.
+func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
+	// Explain mode needs the wrapped evaluator's trace, so bypass the cache
+	if authz.Explaining(ctx) {
+		authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "cache", Kind: "cache", Result: authz.TraceSkipped, Detail: "explain mode bypasses the decision cache"})
+		return e.base.Evaluate(ctx, request)
+	}
+
+	key, ok := e.cacheKey(ctx, request)
+	if !ok {
+		return e.base.Evaluate(ctx, request)
+	}
+
+	decision := e.get(key)
+	if e.config.Metrics != nil {
+		e.config.Metrics.ObserveCache("decision", decision != nil)
+	}
+	if decision != nil {
+		return decision, nil
+	}
+
+	decision, err := e.base.Evaluate(ctx, request)
+	if err != nil || decision == nil {
+		return decision, err
+	}
+	if decision.Allowed || !e.config.SkipDenials {
+		e.put(key, e.newEntry(ctx, key, request, decision))
+	}
+	return decision, nil
+}
+
+// cacheKey derives the cache key of a request; requests whose attributes
+// cannot be hashed are not cached
+func (e *Evaluator) cacheKey(ctx context.Context, request *authz.AuthorizationRequest) (string, bool) {
+	if request == nil || request.Resource == nil {
+		return "", false
+	}
+
+	data, err := json.Marshal(e.config.Attributes(request))
+	if err != nil {
+		return "", false
+	}
+	hash := sha256.Sum256(data)
+
+	return strings.Join([]string{
+		authz.PartitionFromContext(ctx),
+		subjectID(request.Subject),
+		resourceKey(request.Resource.Type, request.Resource.ID),
+		string(request.Action),
+		hex.EncodeToString(hash[:16]),
+	}, "|"), true
+}
+
+func (e *Evaluator) newEntry(ctx context.Context, key string, request *authz.AuthorizationRequest, decision *authz.AuthorizationDecision) *entry {
+	var roles []string
+	if request.Subject != nil {
+		roles = append(roles, request.Subject.Roles...)
+	}
+
+	// Keep a copy, so callers mutating the returned decision do not alter
+	// the cache
+	stored := *decision
+	stored.Metadata = maps.Clone(decision.Metadata)
+	stored.Obligations = slices.Clone(decision.Obligations)
+	stored.Advice = slices.Clone(decision.Advice)
+
+	return &entry{
+		key:       key,
+		decision:  &stored,
+		expiresAt: e.config.Now().Add(e.config.TTL),
+		tenant:    authz.PartitionFromContext(ctx),
+		subject:   subjectID(request.Subject),
+		roles:     roles,
+		resource:  resourceKey(request.Resource.Type, request.Resource.ID),
+	}
+}
+
+// get returns a copy of a live cached decision
+func (e *Evaluator) get(key string) *authz.AuthorizationDecision {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	element, ok := e.entries[key]
+	if !ok {
+		e.stats.Misses++
+		return nil
+	}
+	cached := element.Value.(*entry)
+	if !e.config.Now().Before(cached.expiresAt) {
+		e.remove(element)
+		e.stats.Misses++
+		return nil
+	}
+
+	e.lru.MoveToFront(element)
+	e.stats.Hits++
+
+	decision := *cached.decision
+	decision.Metadata = make(map[string]any, len(cached.decision.Metadata)+1)
+	maps.Copy(decision.Metadata, cached.decision.Metadata)
+	decision.Metadata["cached"] = true
+	return &decision
+}
+
+// put caches an entry, evicting the least recently used beyond MaxEntries
+func (e *Evaluator) put(key string, cached *entry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if element, ok := e.entries[key]; ok {
+		e.remove(element)
+	}
+	e.entries[key] = e.lru.PushFront(cached)
+	index(e.bySubject, cached.tenant+"|"+cached.subject, key)
+	index(e.byResource, cached.tenant+"|"+cached.resource, key)
+	for _, role := range cached.roles {
+		index(e.byRole, role, key)
+	}
+
+	for e.lru.Len() > e.config.MaxEntries {
+		e.remove(e.lru.Back())
+		e.stats.Evictions++
+	}
+}
+
+// remove drops an entry and its index keys. Caller must hold e.mu.
+func (e *Evaluator) remove(element *list.Element) {
+	cached := element.Value.(*entry)
+	e.lru.Remove(element)
+	delete(e.entries, cached.key)
+	unindex(e.bySubject, cached.tenant+"|"+cached.subject, cached.key)
+	unindex(e.byResource, cached.tenant+"|"+cached.resource, cached.key)
+	for _, role := range cached.roles {
+		unindex(e.byRole, role, cached.key)
+	}
+}
+
+// invalidate drops the entries of an index key
+func (e *Evaluator) invalidate(idx map[string]map[string]bool, indexKey string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for key := range idx[indexKey] {
+		if element, ok := e.entries[key]; ok {
+			e.remove(element)
+		}
+	}
+}
+
+// InvalidateSubject drops the cached decisions of a subject in the context
+// tenant
+func (e *Evaluator) InvalidateSubject(ctx context.Context, subjectID string) {
+	e.invalidate(e.bySubject, authz.PartitionFromContext(ctx)+"|"+subjectID)
+}
+
+// InvalidateRole drops the cached decisions of subjects that had a role, in
+// every tenant since role permissions are shared. It fits
+// rbac.Evaluator.OnRoleChange.
+func (e *Evaluator) InvalidateRole(role string) {
+	e.invalidate(e.byRole, role)
+}
+
+// InvalidateResource drops the cached decisions on a resource in the context
+// tenant
+func (e *Evaluator) InvalidateResource(ctx context.Context, resourceType, resourceID string) {
+	e.invalidate(e.byResource, authz.PartitionFromContext(ctx)+"|"+resourceKey(resourceType, resourceID))
+}
+
+// InvalidateTenant drops the cached decisions of the context tenant, e.g.,
+// after a policy or rule change
+func (e *Evaluator) InvalidateTenant(ctx context.Context) {
+	prefix := authz.PartitionFromContext(ctx) + "|"
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, element := range e.entries {
+		if strings.HasPrefix(key, prefix) {
+			e.remove(element)
+		}
+	}
+}
+
+// InvalidateAll drops every cached decision
+func (e *Evaluator) InvalidateAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.entries = make(map[string]*list.Element)
+	e.lru.Init()
+	e.bySubject = make(map[string]map[string]bool)
+	e.byRole = make(map[string]map[string]bool)
+	e.byResource = make(map[string]map[string]bool)
+}
+
+// Subscribe drops the decisions of a subject on SubjectChanged and of a
+// role's subjects on RoleChanged events of the bus (e.g., published by
+// rbac.Evaluator.SetInvalidationBus). Call the returned function to
+// unsubscribe.
+func (e *Evaluator) Subscribe(bus subject.InvalidationBus) func() {
+	return bus.Subscribe(func(ctx context.Context, event subject.ChangeEvent) {
+		switch event.Kind {
+		case subject.SubjectChanged:
+			e.InvalidateSubject(ctx, event.SubjectID)
+		case subject.RoleChanged:
+			e.InvalidateRole(event.Role)
+		}
+	})
+}
+
+// Stats returns the cache counters
+func (e *Evaluator) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stats := e.stats
+	stats.Entries = e.lru.Len()
+	return stats
+}
+
+// HasPermission forwards to the wrapped evaluator when it is a
+// PermissionChecker, otherwise checks the identity's permissions
+func (e *Evaluator) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	if checker, ok := e.base.(authz.PermissionChecker); ok {
+		return checker.HasPermission(ctx, identity, permission)
+	}
+	return identity.HasPermission(permission), nil
+}
+
+// HasAnyPermission checks if the subject has any of the specified permissions
+func (e *Evaluator) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	if checker, ok := e.base.(authz.PermissionChecker); ok {
+		return checker.HasAnyPermission(ctx, identity, permissions...)
+	}
+	for _, perm := range permissions {
+		if identity.HasPermission(perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasAllPermissions checks if the subject has all of the specified permissions
+func (e *Evaluator) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	if checker, ok := e.base.(authz.PermissionChecker); ok {
+		return checker.HasAllPermissions(ctx, identity, permissions...)
+	}
+	for _, perm := range permissions {
+		if !identity.HasPermission(perm) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HasRole forwards to the wrapped evaluator when it is a RoleChecker,
+// otherwise checks the identity's roles
+func (e *Evaluator) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	if checker, ok := e.base.(authz.RoleChecker); ok {
+		return checker.HasRole(ctx, identity, role)
+	}
+	return identity.HasRole(role), nil
+}
+
+// HasAnyRole checks if the subject has any of the specified roles
+func (e *Evaluator) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	if checker, ok := e.base.(authz.RoleChecker); ok {
+		return checker.HasAnyRole(ctx, identity, roles...)
+	}
+	return identity.HasAnyRole(roles...), nil
+}
+
+// HasAllRoles checks if the subject has all of the specified roles
+func (e *Evaluator) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	if checker, ok := e.base.(authz.RoleChecker); ok {
+		return checker.HasAllRoles(ctx, identity, roles...)
+	}
+	return identity.HasAllRoles(roles...), nil
+}
+
+// ListAuthorizedResources forwards to the wrapped evaluator (uncached)
+func (e *Evaluator) ListAuthorizedResources(ctx context.Context, identity *subject.IdentityContext, action authz.Action, resourceType string) (*authz.ResourceFilter, error) {
+	lister, ok := e.base.(authz.ResourceLister)
+	if !ok {
+		return nil, fmt.Errorf("%w: evaluator is not a ResourceLister", authz.ErrFilterNotSupported)
+	}
+	return lister.ListAuthorizedResources(ctx, identity, action, resourceType)
+}
+
+// ContributeGraph forwards to the wrapped evaluator
+func (e *Evaluator) ContributeGraph(ctx context.Context, graph *authz.AccessGraph) error {
+	if contributor, ok := e.base.(authz.GraphContributor); ok {
+		return contributor.ContributeGraph(ctx, graph)
+	}
+	return nil
+}
+
+// defaultAttributes returns every attribute a built-in evaluator reads
+func defaultAttributes(request *authz.AuthorizationRequest) any {
+	attributes := map[string]any{
+		"resource": request.Resource.Attributes,
+		"context":  request.Context,
+	}
+	if identity := request.Subject; identity != nil {
+		attributes["roles"] = identity.Roles
+		attributes["groups"] = identity.Groups
+		attributes["permissions"] = identity.Permissions
+		attributes["metadata"] = identity.Metadata
+		attributes["profile"] = identity.Profile
+		if identity.Subject != nil {
+			attributes["subject"] = identity.Subject.Attributes
+		}
+		if identity.Session != nil {
+			attributes["environment"] = identity.Session.EnvironmentAttributes()
+		}
+	}
+	return attributes
+}
+
+func subjectID(identity *subject.IdentityContext) string {
+	if identity == nil || identity.Subject == nil {
+		return ""
+	}
+	return identity.Subject.ID
+}
+
+// resourceKey matches the resource keys reported by acl.Manager.OnChange
+func resourceKey(resourceType, resourceID string) string {
+	return strings.ToLower(resourceType) + ":" + resourceID
+}
+
+func index(idx map[string]map[string]bool, indexKey, key string) {
+	keys, ok := idx[indexKey]
+	if !ok {
+		keys = make(map[string]bool)
+		idx[indexKey] = keys
+	}
+	keys[key] = true
+}
+
+func unindex(idx map[string]map[string]bool, indexKey, key string) {
+	if keys, ok := idx[indexKey]; ok {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(idx, indexKey)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package cached
+
+import (
+	"context"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// PolicyStore wraps a policy store with a cache of its reads. Since a policy
+// change may affect any lookup by subject or resource, writes through the
+// store invalidate every cached read of the context tenant.
+type PolicyStore struct {
+	base  authz.PolicyStore
+	cache *storeCache
+}
+
+var _ authz.PolicyStore = (*PolicyStore)(nil)
+
+// NewPolicyStore wraps a policy store with a cache. Use
+// NewVersionedPolicyStore to keep the version history API of the store.
+func NewPolicyStore(base authz.PolicyStore, config *StoreConfig) *PolicyStore {
+	if config == nil {
+		config = &StoreConfig{}
+	}
+	config.normalize()
+	return &PolicyStore{base: base, cache: &storeCache{config: config, kind: "policy"}}
+}
+
+// Create creates a policy and invalidates the tenant's reads
+func (s *PolicyStore) Create(ctx context.Context, policy *authz.Policy) error {
+	if err := s.base.Create(ctx, policy); err != nil {
+		return err
+	}
+	s.Invalidate(ctx)
+	return nil
+}
+
+// Get retrieves a policy by ID (cached)
+func (s *PolicyStore) Get(ctx context.Context, policyID string) (*authz.Policy, error) {
+	return readThrough(ctx, s.cache, s.cache.key(ctx, "policy", policyID), func() (*authz.Policy, error) {
+		return s.base.Get(ctx, policyID)
+	})
+}
+
+// Update updates a policy and invalidates the tenant's reads
+func (s *PolicyStore) Update(ctx context.Context, policy *authz.Policy) error {
+	if err := s.base.Update(ctx, policy); err != nil {
+		return err
+	}
+	s.Invalidate(ctx)
+	return nil
+}
+
+// Delete deletes a policy and invalidates the tenant's reads
+func (s *PolicyStore) Delete(ctx context.Context, policyID string) error {
+	if err := s.base.Delete(ctx, policyID); err != nil {
+		return err
+	}
+	s.Invalidate(ctx)
+	return nil
+}
+
+// List lists all policies (cached)
+func (s *PolicyStore) List(ctx context.Context) ([]*authz.Policy, error) {
+	return readThrough(ctx, s.cache, s.cache.key(ctx, "list"), func() ([]*authz.Policy, error) {
+		return s.base.List(ctx)
+	})
+}
+
+// FindBySubject finds policies for a subject (cached)
+func (s *PolicyStore) FindBySubject(ctx context.Context, subjectID string) ([]*authz.Policy, error) {
+	return readThrough(ctx, s.cache, s.cache.key(ctx, "subject", subjectID), func() ([]*authz.Policy, error) {
+		return s.base.FindBySubject(ctx, subjectID)
+	})
+}
+
+// FindByResource finds policies for a resource (cached)
+func (s *PolicyStore) FindByResource(ctx context.Context, resourceType string, resourceID string) ([]*authz.Policy, error) {
+	return readThrough(ctx, s.cache, s.cache.key(ctx, "resource", resourceType, resourceID), func() ([]*authz.Policy, error) {
+		return s.base.FindByResource(ctx, resourceType, resourceID)
+	})
+}
+
+// Invalidate drops every cached read of the context tenant, e.g., after
+// changes made directly in the database
+func (s *PolicyStore) Invalidate(ctx context.Context) {
+	s.cache.invalidatePrefix(ctx, "")
+}
+
+// VersionedPolicyStore is a PolicyStore cache that keeps the version history
+// API of the wrapped store. Versions are read uncached.
+type VersionedPolicyStore struct {
+	*PolicyStore
+	base authz.VersionedPolicyStore
+}
+
+var _ authz.VersionedPolicyStore = (*VersionedPolicyStore)(nil)
+
+// NewVersionedPolicyStore wraps a versioned policy store with a cache
+func NewVersionedPolicyStore(base authz.VersionedPolicyStore, config *StoreConfig) *VersionedPolicyStore {
+	return &VersionedPolicyStore{PolicyStore: NewPolicyStore(base, config), base: base}
+}
+
+// ListVersions returns the versions of a policy
+func (s *VersionedPolicyStore) ListVersions(ctx context.Context, policyID string) ([]*authz.PolicyVersion, error) {
+	return s.base.ListVersions(ctx, policyID)
+}
+
+// GetVersion returns one version of a policy
+func (s *VersionedPolicyStore) GetVersion(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	return s.base.GetVersion(ctx, policyID, version)
+}
+
+// Rollback restores a prior version and invalidates the tenant's reads
+func (s *VersionedPolicyStore) Rollback(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	restored, err := s.base.Rollback(ctx, policyID, version)
+	if err != nil {
+		return nil, err
+	}
+	s.Invalidate(ctx)
+	return restored, nil
+}
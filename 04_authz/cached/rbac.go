@@ -0,0 +1,164 @@
+package cached
+
+import (
+	"context"
+
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+)
+
+// RBACStore wraps an RBAC store with a cache of the reads of identity
+// building and evaluation: roles, permissions, role permissions and subject
+// roles. Writes through the store invalidate the reads they change
+// (write-through invalidation). Lists of the management APIs are not cached.
+type RBACStore struct {
+	base  rbac.Store
+	cache *storeCache
+}
+
+var _ rbac.Store = (*RBACStore)(nil)
+
+// NewRBACStore wraps an RBAC store with a cache
+func NewRBACStore(base rbac.Store, config *StoreConfig) *RBACStore {
+	if config == nil {
+		config = &StoreConfig{}
+	}
+	config.normalize()
+	return &RBACStore{base: base, cache: &storeCache{config: config, kind: "rbac"}}
+}
+
+// CreateRole creates a role and invalidates the role permissions
+func (s *RBACStore) CreateRole(ctx context.Context, role *rbac.Role) error {
+	if err := s.base.CreateRole(ctx, role); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "role:"+role.Name, "role_permissions")
+	return nil
+}
+
+// GetRole returns a role with its permissions (cached)
+func (s *RBACStore) GetRole(ctx context.Context, name string) (*rbac.Role, error) {
+	return readThrough(ctx, s.cache, s.cache.key(ctx, "role", name), func() (*rbac.Role, error) {
+		return s.base.GetRole(ctx, name)
+	})
+}
+
+// UpdateRole updates the description of a role and invalidates it
+func (s *RBACStore) UpdateRole(ctx context.Context, role *rbac.Role) error {
+	if err := s.base.UpdateRole(ctx, role); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "role:"+role.Name)
+	return nil
+}
+
+// DeleteRole deletes a role and invalidates it, the role permissions and
+// the roles of every subject
+func (s *RBACStore) DeleteRole(ctx context.Context, name string) error {
+	if err := s.base.DeleteRole(ctx, name); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "role:"+name, "role_permissions")
+	s.cache.invalidatePrefix(ctx, "subject:")
+	return nil
+}
+
+// ListRoles returns a page of roles (uncached)
+func (s *RBACStore) ListRoles(ctx context.Context, opts rbac.ListOptions) ([]*rbac.Role, int, error) {
+	return s.base.ListRoles(ctx, opts)
+}
+
+// CreatePermission adds a permission to the catalog and invalidates it
+func (s *RBACStore) CreatePermission(ctx context.Context, permission *rbac.Permission) error {
+	if err := s.base.CreatePermission(ctx, permission); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "permission:"+permission.Name)
+	return nil
+}
+
+// GetPermission returns a permission of the catalog (cached)
+func (s *RBACStore) GetPermission(ctx context.Context, name string) (*rbac.Permission, error) {
+	return readThrough(ctx, s.cache, s.cache.key(ctx, "permission", name), func() (*rbac.Permission, error) {
+		return s.base.GetPermission(ctx, name)
+	})
+}
+
+// DeletePermission removes a permission from the catalog and every role, and
+// invalidates it, every role and the role permissions
+func (s *RBACStore) DeletePermission(ctx context.Context, name string) error {
+	if err := s.base.DeletePermission(ctx, name); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "permission:"+name, "role_permissions")
+	s.cache.invalidatePrefix(ctx, "role:")
+	return nil
+}
+
+// ListPermissions returns a page of the catalog (uncached)
+func (s *RBACStore) ListPermissions(ctx context.Context, opts rbac.ListOptions) ([]*rbac.Permission, int, error) {
+	return s.base.ListPermissions(ctx, opts)
+}
+
+// GrantPermission grants a permission to a role and invalidates the role and
+// the role permissions
+func (s *RBACStore) GrantPermission(ctx context.Context, role, permission string) error {
+	if err := s.base.GrantPermission(ctx, role, permission); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "role:"+role, "role_permissions")
+	return nil
+}
+
+// RevokePermission revokes a permission from a role and invalidates the
+// role and the role permissions
+func (s *RBACStore) RevokePermission(ctx context.Context, role, permission string) error {
+	if err := s.base.RevokePermission(ctx, role, permission); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "role:"+role, "role_permissions")
+	return nil
+}
+
+// RolePermissions returns the permissions of every role (cached)
+func (s *RBACStore) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	return readThrough(ctx, s.cache, s.cache.key(ctx, "role_permissions"), func() (map[string][]string, error) {
+		return s.base.RolePermissions(ctx)
+	})
+}
+
+// AssignRole assigns a role to a subject and invalidates the subject roles
+func (s *RBACStore) AssignRole(ctx context.Context, subjectID, role string) error {
+	if err := s.base.AssignRole(ctx, subjectID, role); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "subject:"+subjectID)
+	return nil
+}
+
+// UnassignRole removes a role from a subject and invalidates the subject
+// roles
+func (s *RBACStore) UnassignRole(ctx context.Context, subjectID, role string) error {
+	if err := s.base.UnassignRole(ctx, subjectID, role); err != nil {
+		return err
+	}
+	s.cache.invalidate(ctx, "subject:"+subjectID)
+	return nil
+}
+
+// ListSubjectRoles returns the roles of a subject (cached)
+func (s *RBACStore) ListSubjectRoles(ctx context.Context, subjectID string) ([]string, error) {
+	return readThrough(ctx, s.cache, s.cache.key(ctx, "subject", subjectID), func() ([]string, error) {
+		return s.base.ListSubjectRoles(ctx, subjectID)
+	})
+}
+
+// ListRoleSubjects returns a page of the subjects of a role (uncached)
+func (s *RBACStore) ListRoleSubjects(ctx context.Context, role string, opts rbac.ListOptions) ([]string, int, error) {
+	return s.base.ListRoleSubjects(ctx, role, opts)
+}
+
+// Invalidate drops every cached read of the context tenant, e.g., after
+// changes made directly in the database
+func (s *RBACStore) Invalidate(ctx context.Context) {
+	s.cache.invalidatePrefix(ctx, "")
+}
@@ -0,0 +1,111 @@
+// Package redis provides a Redis StoreCache for the caching store decorators
+// of package cached, so every node of a cluster shares the cached reads and
+// sees the invalidations of the others at once.
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/primadi/lokstra-auth/04_authz/cached"
+)
+
+// StoreCache is a Redis implementation of cached.StoreCache
+type StoreCache struct {
+	client goredis.UniversalClient
+}
+
+var _ cached.StoreCache = (*StoreCache)(nil)
+
+// NewStoreCache creates a Redis store cache. A *goredis.Client,
+// *goredis.ClusterClient or *goredis.Ring can be used. Key prefixes are set
+// by cached.StoreConfig.Prefix.
+//
+//	store := cached.NewRBACStore(base, &cached.StoreConfig{Cache: redis.NewStoreCache(client)})
+func NewStoreCache(client goredis.UniversalClient) *StoreCache {
+	return &StoreCache{client: client}
+}
+
+// Get returns a cached value
+func (c *StoreCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Set caches a value for ttl
+func (c *StoreCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Delete removes cached values
+func (c *StoreCache) Delete(ctx context.Context, keys ...string) error {
+	return unlink(ctx, c.client, keys)
+}
+
+// DeletePrefix removes the cached values whose key starts with prefix,
+// scanning the keyspace (of every master of a cluster) in batches
+func (c *StoreCache) DeletePrefix(ctx context.Context, prefix string) error {
+	pattern := escapePattern(prefix) + "*"
+	if cluster, ok := c.client.(*goredis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *goredis.Client) error {
+			return deleteMatching(ctx, node, pattern)
+		})
+	}
+	return deleteMatching(ctx, c.client, pattern)
+}
+
+// deleteMatching removes the keys of a node matching a SCAN pattern
+func deleteMatching(ctx context.Context, client goredis.UniversalClient, pattern string) error {
+	iter := client.Scan(ctx, 0, pattern, 500).Iterator()
+	batch := make([]string, 0, 500)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := unlink(ctx, client, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	return unlink(ctx, client, batch)
+}
+
+// unlink removes keys in one pipeline of single-key commands, so keys of
+// different cluster slots can be removed together
+func unlink(ctx context.Context, client goredis.UniversalClient, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Unlink(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// escapePattern escapes the glob characters of a SCAN pattern
+func escapePattern(s string) string {
+	escaped := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, s[i])
+	}
+	return string(escaped)
+}
@@ -0,0 +1,47 @@
+package cached
+
+import (
+	"context"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// InvalidatingStore wraps a policy store and drops the cached decisions of
+// the context tenant after every policy change, since a policy may affect
+// any decision
+type InvalidatingStore struct {
+	authz.PolicyStore
+	cache *Evaluator
+}
+
+// NewInvalidatingStore wraps a policy store with cache invalidation
+func NewInvalidatingStore(store authz.PolicyStore, cache *Evaluator) *InvalidatingStore {
+	return &InvalidatingStore{PolicyStore: store, cache: cache}
+}
+
+// Create creates a policy and invalidates the tenant's decisions
+func (s *InvalidatingStore) Create(ctx context.Context, policy *authz.Policy) error {
+	if err := s.PolicyStore.Create(ctx, policy); err != nil {
+		return err
+	}
+	s.cache.InvalidateTenant(ctx)
+	return nil
+}
+
+// Update updates a policy and invalidates the tenant's decisions
+func (s *InvalidatingStore) Update(ctx context.Context, policy *authz.Policy) error {
+	if err := s.PolicyStore.Update(ctx, policy); err != nil {
+		return err
+	}
+	s.cache.InvalidateTenant(ctx)
+	return nil
+}
+
+// Delete deletes a policy and invalidates the tenant's decisions
+func (s *InvalidatingStore) Delete(ctx context.Context, policyID string) error {
+	if err := s.PolicyStore.Delete(ctx, policyID); err != nil {
+		return err
+	}
+	s.cache.InvalidateTenant(ctx)
+	return nil
+}
@@ -0,0 +1,229 @@
+package cached
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/metrics"
+)
+
+// StoreCache holds encoded store reads for the caching store decorators
+// (NewRBACStore, NewPolicyStore). NewLRU keeps them in process; a shared
+// cache (e.g., cached/redis) keeps the nodes of a cluster consistent.
+type StoreCache interface {
+	// Get returns a cached value; ok is false on a miss
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+
+	// Set caches a value for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes cached values
+	Delete(ctx context.Context, keys ...string) error
+
+	// DeletePrefix removes the cached values whose key starts with prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// StoreConfig holds store cache configuration
+type StoreConfig struct {
+	// Cache holds the cached reads (default: NewLRU(10000))
+	Cache StoreCache
+
+	// TTL is how long a read is cached. Writes through the decorator
+	// invalidate the reads they change at once; TTL bounds the staleness of
+	// writes made around it, e.g., directly in the database (default: 1
+	// minute).
+	TTL time.Duration
+
+	// Prefix is prepended to every key (default: "lokstra:store:")
+	Prefix string
+
+	// Metrics records lookups as cache "rbac_store" or "policy_store"
+	// (optional)
+	Metrics metrics.Recorder
+}
+
+// normalize applies defaults
+func (c *StoreConfig) normalize() {
+	if c.Cache == nil {
+		c.Cache = NewLRU(10000)
+	}
+	if c.TTL == 0 {
+		c.TTL = time.Minute
+	}
+	if c.Prefix == "" {
+		c.Prefix = "lokstra:store:"
+	}
+}
+
+// storeCache reads through and invalidates the keys of one store kind
+// ("rbac", "policy") in the partition of the context tenant
+type storeCache struct {
+	config *StoreConfig
+	kind   string
+}
+
+// prefix returns the key prefix of the context tenant. The tenant is
+// escaped, so a tenant prefix never matches the keys of another tenant.
+func (c *storeCache) prefix(ctx context.Context) string {
+	return c.config.Prefix + c.kind + ":" + url.PathEscape(authz.PartitionFromContext(ctx)) + ":"
+}
+
+// key returns the key of a read in the context tenant
+func (c *storeCache) key(ctx context.Context, parts ...string) string {
+	return c.prefix(ctx) + strings.Join(parts, ":")
+}
+
+// invalidate drops reads of the context tenant by key
+func (c *storeCache) invalidate(ctx context.Context, keys ...string) {
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = c.prefix(ctx) + key
+	}
+	_ = c.config.Cache.Delete(ctx, full...)
+}
+
+// invalidatePrefix drops reads of the context tenant whose key starts with
+// prefix ("": every read of the tenant)
+func (c *storeCache) invalidatePrefix(ctx context.Context, prefix string) {
+	_ = c.config.Cache.DeletePrefix(ctx, c.prefix(ctx)+prefix)
+}
+
+// readThrough returns the cached value of a key, or loads and caches it.
+// Errors of load are not cached; cache failures fall back to load.
+func readThrough[T any](ctx context.Context, c *storeCache, key string, load func() (T, error)) (T, error) {
+	if data, ok, err := c.config.Cache.Get(ctx, key); err == nil && ok {
+		var value T
+		if json.Unmarshal(data, &value) == nil {
+			c.observe(true)
+			return value, nil
+		}
+	}
+	c.observe(false)
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	if data, err := json.Marshal(value); err == nil {
+		_ = c.config.Cache.Set(ctx, key, data, c.config.TTL)
+	}
+	return value, nil
+}
+
+func (c *storeCache) observe(hit bool) {
+	if c.config.Metrics != nil {
+		c.config.Metrics.ObserveCache(c.kind+"_store", hit)
+	}
+}
+
+// LRU is an in-process StoreCache that evicts the least recently used value
+// beyond a bound. Invalidations reach only the process: on a cluster, use a
+// shared cache or a short TTL.
+type LRU struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	now        func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+var _ StoreCache = (*LRU)(nil)
+
+// NewLRU creates an in-process store cache of at most maxEntries values
+// (default: 10000)
+func NewLRU(maxEntries int) *LRU {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &LRU{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get returns a cached value that has not expired
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	cached := element.Value.(*lruEntry)
+	if !c.now().Before(cached.expiresAt) {
+		c.remove(element)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(element)
+	return cached.value, true, nil
+}
+
+// Set caches a value, evicting the least recently used beyond the bound
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.lru.PushFront(&lruEntry{key: key, value: value, expiresAt: c.now().Add(ttl)})
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+// Delete removes cached values
+func (c *LRU) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+	}
+	return nil
+}
+
+// DeletePrefix removes the cached values whose key starts with prefix
+func (c *LRU) DeletePrefix(ctx context.Context, prefix string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(element)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of cached values
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// remove drops an entry. Caller must hold c.mu.
+func (c *LRU) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,222 @@
+package cedar
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EntityUID identifies an entity, e.g., User::"alice"
+type EntityUID struct {
+	Type string
+	ID   string
+}
+
+// String formats the UID in Cedar syntax
+func (u EntityUID) String() string {
+	return u.Type + "::" + strconv.Quote(u.ID)
+}
+
+// Entity is a principal, action or resource with attributes and parents
+// (e.g., the groups of a user, the folder of a document)
+type Entity struct {
+	UID        EntityUID
+	Attributes map[string]any
+	Parents    []EntityUID
+}
+
+// Entities is the entity store of an evaluation
+type Entities map[EntityUID]*Entity
+
+// Add adds an entity, merging attributes and parents with an existing one
+func (es Entities) Add(entity *Entity) {
+	existing, ok := es[entity.UID]
+	if !ok {
+		es[entity.UID] = entity
+		return
+	}
+	if existing.Attributes == nil {
+		existing.Attributes = make(map[string]any)
+	}
+	for k, v := range entity.Attributes {
+		existing.Attributes[k] = v
+	}
+	for _, parent := range entity.Parents {
+		if !slices.Contains(existing.Parents, parent) {
+			existing.Parents = append(existing.Parents, parent)
+		}
+	}
+}
+
+// In reports whether uid is ancestor or uid itself (the Cedar "in" operator)
+func (es Entities) In(uid, ancestor EntityUID) bool {
+	if uid == ancestor {
+		return true
+	}
+
+	visited := map[EntityUID]bool{uid: true}
+	queue := []EntityUID{uid}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		entity, ok := es[current]
+		if !ok {
+			continue
+		}
+		for _, parent := range entity.Parents {
+			if parent == ancestor {
+				return true
+			}
+			if !visited[parent] {
+				visited[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return false
+}
+
+// Cedar values are represented as bool, int64 (Long), string, EntityUID,
+// Set and Record
+type (
+	Set    []any
+	Record map[string]any
+)
+
+// ToValue converts a Go attribute to a Cedar value; unsupported values
+// (e.g., fractional numbers) are reported with ok = false
+func ToValue(v any) (any, bool) {
+	switch value := v.(type) {
+	case bool, int64, string, EntityUID:
+		return value, true
+	case int:
+		return int64(value), true
+	case int32:
+		return int64(value), true
+	case uint32:
+		return int64(value), true
+	case float64:
+		if value != math.Trunc(value) || math.Abs(value) > math.MaxInt64 {
+			return nil, false
+		}
+		return int64(value), true
+	case []string:
+		set := make(Set, len(value))
+		for i, s := range value {
+			set[i] = s
+		}
+		return set, true
+	case []any:
+		set := make(Set, 0, len(value))
+		for _, item := range value {
+			if converted, ok := ToValue(item); ok {
+				set = append(set, converted)
+			}
+		}
+		return set, true
+	case Set:
+		return value, true
+	case map[string]any:
+		return toRecord(value), true
+	case Record:
+		return value, true
+	}
+	return nil, false
+}
+
+// toRecord converts attributes to a record, dropping unsupported values
+func toRecord(attributes map[string]any) Record {
+	record := make(Record, len(attributes))
+	for k, v := range attributes {
+		if converted, ok := ToValue(v); ok {
+			record[k] = converted
+		}
+	}
+	return record
+}
+
+// equal compares two Cedar values
+func equal(a, b any) bool {
+	switch x := a.(type) {
+	case Set:
+		y, ok := b.(Set)
+		if !ok {
+			return false
+		}
+		return subset(x, y) && subset(y, x)
+	case Record:
+		y, ok := b.(Record)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// subset reports whether every element of a is in b
+func subset(a, b Set) bool {
+	for _, x := range a {
+		if !contains(b, x) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(set Set, value any) bool {
+	for _, item := range set {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the Cedar type of a value, for error messages
+func typeName(v any) string {
+	switch v.(type) {
+	case bool:
+		return "Bool"
+	case int64:
+		return "Long"
+	case string:
+		return "String"
+	case EntityUID:
+		return "Entity"
+	case Set:
+		return "Set"
+	case Record:
+		return "Record"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// titleCase maps a resource or subject type to a Cedar entity type
+// ("document" -> "Document", "api_key" -> "ApiKey")
+func titleCase(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if r == '_' || r == '-' || r == ' ' {
+			upper = true
+			continue
+		}
+		if upper {
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
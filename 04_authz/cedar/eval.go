@@ -0,0 +1,429 @@
+package cedar
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrEvaluation = errors.New("cedar evaluation error")
+)
+
+// request is the evaluation input of a policy
+type request struct {
+	principal EntityUID
+	action    EntityUID
+	resource  EntityUID
+	context   Record
+	entities  Entities
+}
+
+// expr is a node of a condition expression
+type expr interface {
+	eval(r *request) (any, error)
+}
+
+func evalErrorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrEvaluation, fmt.Sprintf(format, args...))
+}
+
+type literal struct{ value any }
+
+func (e *literal) eval(*request) (any, error) { return e.value, nil }
+
+type variable struct{ name string }
+
+func (e *variable) eval(r *request) (any, error) {
+	switch e.name {
+	case "principal":
+		return r.principal, nil
+	case "action":
+		return r.action, nil
+	case "resource":
+		return r.resource, nil
+	}
+	return r.context, nil
+}
+
+type setExpr struct{ items []expr }
+
+func (e *setExpr) eval(r *request) (any, error) {
+	set := make(Set, 0, len(e.items))
+	for _, item := range e.items {
+		value, err := item.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, value)
+	}
+	return set, nil
+}
+
+type recordExpr struct{ fields map[string]expr }
+
+func (e *recordExpr) eval(r *request) (any, error) {
+	record := make(Record, len(e.fields))
+	for name, field := range e.fields {
+		value, err := field.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		record[name] = value
+	}
+	return record, nil
+}
+
+type ifExpr struct{ cond, then, otherwise expr }
+
+func (e *ifExpr) eval(r *request) (any, error) {
+	cond, err := evalBool(e.cond, r)
+	if err != nil {
+		return nil, err
+	}
+	if cond {
+		return e.then.eval(r)
+	}
+	return e.otherwise.eval(r)
+}
+
+type orExpr struct{ left, right expr }
+
+func (e *orExpr) eval(r *request) (any, error) {
+	left, err := evalBool(e.left, r)
+	if err != nil || left {
+		return left, err
+	}
+	return evalBool(e.right, r)
+}
+
+type andExpr struct{ left, right expr }
+
+func (e *andExpr) eval(r *request) (any, error) {
+	left, err := evalBool(e.left, r)
+	if err != nil || !left {
+		return left, err
+	}
+	return evalBool(e.right, r)
+}
+
+type unaryExpr struct {
+	op      string
+	operand expr
+}
+
+func (e *unaryExpr) eval(r *request) (any, error) {
+	if e.op == "!" {
+		value, err := evalBool(e.operand, r)
+		return !value, err
+	}
+	value, err := evalLong(e.operand, r)
+	if err != nil {
+		return nil, err
+	}
+	if value == math.MinInt64 {
+		return nil, evalErrorf("overflow")
+	}
+	return -value, nil
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *binaryExpr) eval(r *request) (any, error) {
+	left, err := e.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return evalIn(left, right, r.entities)
+	}
+
+	a, ok := left.(int64)
+	if !ok {
+		return nil, evalErrorf("%s expects Long, got %s", e.op, typeName(left))
+	}
+	b, ok := right.(int64)
+	if !ok {
+		return nil, evalErrorf("%s expects Long, got %s", e.op, typeName(right))
+	}
+
+	switch e.op {
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	case "+":
+		if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+			return nil, evalErrorf("overflow")
+		}
+		return a + b, nil
+	case "-":
+		if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+			return nil, evalErrorf("overflow")
+		}
+		return a - b, nil
+	case "*":
+		if a != 0 && b != 0 && (a*b)/b != a {
+			return nil, evalErrorf("overflow")
+		}
+		return a * b, nil
+	}
+	return nil, evalErrorf("unknown operator %s", e.op)
+}
+
+// evalIn evaluates "entity in entity" and "entity in set of entities"
+func evalIn(left, right any, entities Entities) (bool, error) {
+	uid, ok := left.(EntityUID)
+	if !ok {
+		return false, evalErrorf("in expects Entity, got %s", typeName(left))
+	}
+
+	switch ancestor := right.(type) {
+	case EntityUID:
+		return entities.In(uid, ancestor), nil
+	case Set:
+		for _, item := range ancestor {
+			a, ok := item.(EntityUID)
+			if !ok {
+				return false, evalErrorf("in expects a set of Entity, got %s", typeName(item))
+			}
+			if entities.In(uid, a) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, evalErrorf("in expects Entity or Set, got %s", typeName(right))
+}
+
+type hasExpr struct {
+	target    expr
+	attribute string
+}
+
+func (e *hasExpr) eval(r *request) (any, error) {
+	target, err := e.target.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	switch value := target.(type) {
+	case Record:
+		_, ok := value[e.attribute]
+		return ok, nil
+	case EntityUID:
+		entity, ok := r.entities[value]
+		if !ok {
+			return false, nil
+		}
+		_, ok = entity.Attributes[e.attribute]
+		return ok, nil
+	}
+	return nil, evalErrorf("has expects Entity or Record, got %s", typeName(target))
+}
+
+type attributeExpr struct {
+	target    expr
+	attribute string
+}
+
+func (e *attributeExpr) eval(r *request) (any, error) {
+	target, err := e.target.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes map[string]any
+	switch value := target.(type) {
+	case Record:
+		attributes = value
+	case EntityUID:
+		entity, ok := r.entities[value]
+		if !ok {
+			return nil, evalErrorf("entity %s does not exist", value)
+		}
+		attributes = entity.Attributes
+	default:
+		return nil, evalErrorf("attribute access expects Entity or Record, got %s", typeName(target))
+	}
+
+	value, ok := attributes[e.attribute]
+	if !ok {
+		return nil, evalErrorf("%s does not have attribute %q", typeName(target), e.attribute)
+	}
+	converted, ok := ToValue(value)
+	if !ok {
+		return nil, evalErrorf("attribute %q has unsupported type %T", e.attribute, value)
+	}
+	return converted, nil
+}
+
+type methodExpr struct {
+	target expr
+	method string
+	args   []expr
+}
+
+func (e *methodExpr) eval(r *request) (any, error) {
+	target, err := e.target.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	set, ok := target.(Set)
+	if !ok {
+		return nil, evalErrorf("%s expects Set, got %s", e.method, typeName(target))
+	}
+
+	if e.method == "isEmpty" && len(e.args) == 0 {
+		return len(set) == 0, nil
+	}
+	if len(e.args) != 1 {
+		return nil, evalErrorf("%s expects one argument", e.method)
+	}
+	arg, err := e.args[0].eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.method {
+	case "contains":
+		return contains(set, arg), nil
+	case "containsAll", "containsAny":
+		other, ok := arg.(Set)
+		if !ok {
+			return nil, evalErrorf("%s expects Set, got %s", e.method, typeName(arg))
+		}
+		if e.method == "containsAll" {
+			return subset(other, set), nil
+		}
+		for _, item := range other {
+			if contains(set, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return nil, evalErrorf("unknown method %s", e.method)
+}
+
+type likeExpr struct {
+	target  expr
+	pattern string
+}
+
+func (e *likeExpr) eval(r *request) (any, error) {
+	target, err := e.target.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := target.(string)
+	if !ok {
+		return nil, evalErrorf("like expects String, got %s", typeName(target))
+	}
+	return matchLike(e.pattern, s), nil
+}
+
+// matchLike matches a Cedar like pattern: * matches any characters, \* a
+// literal star
+func matchLike(pattern, s string) bool {
+	parts := make([]string, 0)
+	var current strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern) && pattern[i+1] == '*':
+			current.WriteByte('*')
+			i++
+		case pattern[i] == '*':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(pattern[i])
+		}
+	}
+	parts = append(parts, current.String())
+
+	if len(parts) == 1 {
+		return s == parts[0]
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+type isExpr struct {
+	target     expr
+	entityType string
+	in         expr
+}
+
+func (e *isExpr) eval(r *request) (any, error) {
+	target, err := e.target.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	uid, ok := target.(EntityUID)
+	if !ok {
+		return nil, evalErrorf("is expects Entity, got %s", typeName(target))
+	}
+	if uid.Type != e.entityType {
+		return false, nil
+	}
+	if e.in == nil {
+		return true, nil
+	}
+	ancestor, err := e.in.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	return evalIn(uid, ancestor, r.entities)
+}
+
+func evalBool(e expr, r *request) (bool, error) {
+	value, err := e.eval(r)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, evalErrorf("expected Bool, got %s", typeName(value))
+	}
+	return b, nil
+}
+
+func evalLong(e expr, r *request) (int64, error) {
+	value, err := e.eval(r)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := value.(int64)
+	if !ok {
+		return 0, evalErrorf("expected Long, got %s", typeName(value))
+	}
+	return n, nil
+}
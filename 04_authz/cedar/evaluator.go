@@ -0,0 +1,261 @@
+package cedar
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// ConditionKey is the key of authz.Policy.Conditions holding the Cedar
+// source of a stored policy
+const ConditionKey = "cedar"
+
+// Config holds Cedar evaluator configuration
+type Config struct {
+	// EntityType maps a subject or resource type to a Cedar entity type
+	// (default: title case, "document" -> "Document"; subjects without a
+	// type are "User")
+	EntityType func(kind string) string
+
+	// Entities supplies additional entities for a request, e.g., the parent
+	// folder of a document or the action groups (optional)
+	Entities func(ctx context.Context, request *authz.AuthorizationRequest) (Entities, error)
+}
+
+// Evaluator authorizes requests with Cedar policies. The principal is the
+// subject entity (User::"<id>") with its roles (Role::"<role>") and groups
+// (Group::"<group>") as parents; the resource is <Type>::"<id>" with the
+// resource attributes; the action is Action::"<action>"; the context holds
+// the session environment and the request context.
+type Evaluator struct {
+	config *Config
+
+	mu     sync.RWMutex
+	policy *PolicySet
+}
+
+// NewEvaluator creates a new Cedar evaluator with a policy set (nil: empty)
+func NewEvaluator(policies *PolicySet, config *Config) *Evaluator {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.EntityType == nil {
+		config.EntityType = defaultEntityType
+	}
+	if policies == nil {
+		policies = NewPolicySet()
+	}
+	return &Evaluator{config: config, policy: policies}
+}
+
+// SetPolicies replaces the policy set
+func (e *Evaluator) SetPolicies(policies *PolicySet) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policy = policies
+}
+
+// Policies returns the policy set
+func (e *Evaluator) Policies() *PolicySet {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.policy
+}
+
+// LoadFromStore replaces the policy set with the policies of a PolicyStore
+// that hold Cedar source in Conditions["cedar"]. Other policies are
+// ignored. Nothing is replaced if a policy fails to parse.
+func (e *Evaluator) LoadFromStore(ctx context.Context, store authz.PolicyStore) error {
+	stored, err := store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list policies: %w", err)
+	}
+
+	set := NewPolicySet()
+	for _, p := range stored {
+		src, ok := p.Conditions[ConditionKey].(string)
+		if !ok {
+			continue
+		}
+		policy, err := ParsePolicy(p.ID, src)
+		if err != nil {
+			return fmt.Errorf("policy '%s': %w", p.ID, err)
+		}
+		if err := set.Add(policy); err != nil {
+			return err
+		}
+	}
+
+	e.SetPolicies(set)
+	return nil
+}
+
+// Authorize evaluates the policy set for a principal, action and resource
+func (e *Evaluator) Authorize(principal, action, resource EntityUID, context Record, entities Entities) *Decision {
+	if entities == nil {
+		entities = make(Entities)
+	}
+	if context == nil {
+		context = make(Record)
+	}
+	return e.Policies().authorize(&request{
+		principal: principal,
+		action:    action,
+		resource:  resource,
+		context:   context,
+		entities:  entities,
+	})
+}
+
+// Evaluate evaluates an authorization request
+func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
+	entities := make(Entities)
+	if e.config.Entities != nil {
+		loaded, err := e.config.Entities(ctx, request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load entities: %w", err)
+		}
+		maps.Copy(entities, loaded)
+	}
+
+	principal := e.principal(request.Subject, entities)
+	resource := EntityUID{Type: e.config.EntityType(request.Resource.Type), ID: request.Resource.ID}
+	entities.Add(&Entity{UID: resource, Attributes: request.Resource.Attributes})
+	action := EntityUID{Type: "Action", ID: string(request.Action)}
+
+	env := make(map[string]any)
+	if request.Subject != nil && request.Subject.Session != nil {
+		env = request.Subject.Session.EnvironmentAttributes()
+	}
+	maps.Copy(env, request.Context)
+
+	decision := e.Authorize(principal, action, resource, toRecord(env), entities)
+	if authz.Explaining(ctx) {
+		traceDecision(ctx, decision)
+	}
+
+	result := &authz.AuthorizationDecision{
+		Allowed: decision.Allowed,
+		Metadata: map[string]any{
+			"determining_policies": decision.Determining,
+		},
+	}
+	switch {
+	case decision.Allowed:
+		result.Reason = fmt.Sprintf("permitted by policy %s", strings.Join(decision.Determining, ", "))
+	case len(decision.Determining) > 0:
+		result.Reason = fmt.Sprintf("forbidden by policy %s", strings.Join(decision.Determining, ", "))
+		result.Metadata["effect"] = authz.EffectDeny
+	default:
+		result.Reason = "no permit policy satisfied"
+	}
+	if len(decision.Errors) > 0 {
+		errs := make(map[string]string, len(decision.Errors))
+		for id, err := range decision.Errors {
+			errs[id] = err.Error()
+		}
+		result.Metadata["errors"] = errs
+	}
+	return result, nil
+}
+
+// traceDecision records the determining and failed policies
+func traceDecision(ctx context.Context, decision *Decision) {
+	effect := "permit"
+	if !decision.Allowed {
+		effect = "forbid"
+	}
+	for _, id := range decision.Determining {
+		authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "cedar", Kind: "policy", ID: id, Result: authz.TraceMatched, Detail: "determining " + effect})
+	}
+	for _, id := range slices.Sorted(maps.Keys(decision.Errors)) {
+		authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "cedar", Kind: "policy", ID: id, Result: authz.TraceError, Detail: decision.Errors[id].Error()})
+	}
+	if len(decision.Determining) == 0 {
+		authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "cedar", Kind: "default", Result: authz.TraceNotMatched, Detail: "no permit policy satisfied"})
+	}
+}
+
+// principal adds the subject entity, with roles and groups as parents
+func (e *Evaluator) principal(identity *subject.IdentityContext, entities Entities) EntityUID {
+	if identity == nil || identity.Subject == nil {
+		return EntityUID{Type: "Unauthenticated", ID: ""}
+	}
+
+	uid := EntityUID{Type: e.config.EntityType(identity.Subject.Type), ID: identity.Subject.ID}
+	if identity.Subject.Type == "" {
+		uid.Type = e.config.EntityType("user")
+	}
+
+	attributes := make(map[string]any)
+	maps.Copy(attributes, identity.Profile)
+	maps.Copy(attributes, identity.Subject.Attributes)
+	attributes["id"] = identity.Subject.ID
+	attributes["roles"] = identity.Roles
+	attributes["groups"] = identity.Groups
+	attributes["permissions"] = identity.Permissions
+
+	parents := make([]EntityUID, 0, len(identity.Roles)+len(identity.Groups))
+	for _, role := range identity.Roles {
+		parents = append(parents, EntityUID{Type: "Role", ID: role})
+	}
+	for _, group := range identity.Groups {
+		parents = append(parents, EntityUID{Type: "Group", ID: group})
+	}
+
+	entities.Add(&Entity{UID: uid, Attributes: attributes, Parents: parents})
+	return uid
+}
+
+func defaultEntityType(kind string) string {
+	if kind == "" {
+		return "User"
+	}
+	return titleCase(kind)
+}
+
+// HasPermission checks if the subject has a specific permission
+func (e *Evaluator) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	return identity.HasPermission(permission), nil
+}
+
+// HasAnyPermission checks if the subject has any of the specified permissions
+func (e *Evaluator) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, perm := range permissions {
+		if identity.HasPermission(perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasAllPermissions checks if the subject has all of the specified permissions
+func (e *Evaluator) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, perm := range permissions {
+		if !identity.HasPermission(perm) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HasRole checks if the subject has a specific role
+func (e *Evaluator) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return identity.HasRole(role), nil
+}
+
+// HasAnyRole checks if the subject has any of the specified roles
+func (e *Evaluator) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return identity.HasAnyRole(roles...), nil
+}
+
+// HasAllRoles checks if the subject has all of the specified roles
+func (e *Evaluator) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return identity.HasAllRoles(roles...), nil
+}
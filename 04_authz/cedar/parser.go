@@ -0,0 +1,629 @@
+package cedar
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrParse = errors.New("cedar parse error")
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenInt
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+	col  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of input"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lex splits Cedar source into tokens
+func lex(src string) ([]token, error) {
+	tokens := make([]token, 0)
+	line, col := 1, 1
+	runes := []rune(src)
+
+	advance := func(n int) {
+		for i := 0; i < n; i++ {
+			if runes[0] == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+			runes = runes[1:]
+		}
+	}
+
+	for len(runes) > 0 {
+		r := runes[0]
+		switch {
+		case unicode.IsSpace(r):
+			advance(1)
+
+		case r == '/' && len(runes) > 1 && runes[1] == '/':
+			for len(runes) > 0 && runes[0] != '\n' {
+				advance(1)
+			}
+
+		case unicode.IsLetter(r) || r == '_':
+			n := 0
+			for n < len(runes) && (unicode.IsLetter(runes[n]) || unicode.IsDigit(runes[n]) || runes[n] == '_') {
+				n++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[:n]), line: line, col: col})
+			advance(n)
+
+		case unicode.IsDigit(r):
+			n := 0
+			for n < len(runes) && unicode.IsDigit(runes[n]) {
+				n++
+			}
+			tokens = append(tokens, token{kind: tokenInt, text: string(runes[:n]), line: line, col: col})
+			advance(n)
+
+		case r == '"':
+			startLine, startCol := line, col
+			var b strings.Builder
+			n := 1
+			closed := false
+			for n < len(runes) {
+				c := runes[n]
+				if c == '\\' && n+1 < len(runes) {
+					switch runes[n+1] {
+					case 'n':
+						b.WriteRune('\n')
+					case 't':
+						b.WriteRune('\t')
+					case '*':
+						// kept escaped for like patterns
+						b.WriteString(`\*`)
+					default:
+						b.WriteRune(runes[n+1])
+					}
+					n += 2
+					continue
+				}
+				if c == '"' {
+					closed = true
+					n++
+					break
+				}
+				b.WriteRune(c)
+				n++
+			}
+			if !closed {
+				return nil, fmt.Errorf("%w: %d:%d: unterminated string", ErrParse, startLine, startCol)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: b.String(), line: startLine, col: startCol})
+			advance(n)
+
+		default:
+			symbol := string(r)
+			if len(runes) > 1 {
+				switch pair := string(runes[:2]); pair {
+				case "==", "!=", "<=", ">=", "&&", "||", "::":
+					symbol = pair
+				}
+			}
+			if len(symbol) == 1 && !strings.ContainsRune("()[]{},;.:@!<>+-*", r) {
+				return nil, fmt.Errorf("%w: %d:%d: unexpected character %q", ErrParse, line, col, r)
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: symbol, line: line, col: col})
+			advance(len([]rune(symbol)))
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, line: line, col: col}), nil
+}
+
+// parser is a recursive descent parser of Cedar policies
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokenSymbol || t.kind == tokenIdent) && t.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q, found %s", text, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	t := p.peek()
+	return fmt.Errorf("%w: %d:%d: %s", ErrParse, t.line, t.col, fmt.Sprintf(format, args...))
+}
+
+// policies parses a policy set
+func (p *parser) policies() ([]*Policy, error) {
+	policies := make([]*Policy, 0)
+	for p.peek().kind != tokenEOF {
+		policy, err := p.policy()
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// policy := annotation* ("permit" | "forbid") "(" scope ")" condition* ";"
+func (p *parser) policy() (*Policy, error) {
+	policy := &Policy{Annotations: make(map[string]string)}
+
+	for p.accept("@") {
+		name := p.next()
+		if name.kind != tokenIdent {
+			return nil, p.errorf("expected annotation name")
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		value := p.next()
+		if value.kind != tokenString {
+			return nil, p.errorf("expected annotation value string")
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		policy.Annotations[name.text] = value.text
+	}
+
+	switch effect := p.next(); effect.text {
+	case "permit":
+		policy.Effect = Permit
+	case "forbid":
+		policy.Effect = Forbid
+	default:
+		return nil, fmt.Errorf("%w: %d:%d: expected permit or forbid, found %s", ErrParse, effect.line, effect.col, effect)
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var err error
+	if policy.Principal, err = p.scope("principal"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	if policy.Action, err = p.scope("action"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	if policy.Resource, err = p.scope("resource"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	for p.is("when") || p.is("unless") {
+		condition := Condition{Unless: p.next().text == "unless"}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		if condition.expr, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+		policy.Conditions = append(policy.Conditions, condition)
+	}
+
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// scope := var [("==" | "in") entity | "in" "[" entities "]" | "is" path ["in" entity]]
+func (p *parser) scope(variable string) (Scope, error) {
+	if err := p.expect(variable); err != nil {
+		return Scope{}, err
+	}
+
+	switch {
+	case p.accept("=="):
+		uid, err := p.entityUID()
+		return Scope{Op: ScopeEq, Entities: []EntityUID{uid}}, err
+
+	case p.accept("in"):
+		if variable == "action" && p.accept("[") {
+			scope := Scope{Op: ScopeIn}
+			for !p.accept("]") {
+				uid, err := p.entityUID()
+				if err != nil {
+					return Scope{}, err
+				}
+				scope.Entities = append(scope.Entities, uid)
+				if !p.is("]") {
+					if err := p.expect(","); err != nil {
+						return Scope{}, err
+					}
+				}
+			}
+			return scope, nil
+		}
+		uid, err := p.entityUID()
+		return Scope{Op: ScopeIn, Entities: []EntityUID{uid}}, err
+
+	case variable != "action" && p.accept("is"):
+		entityType, err := p.path()
+		if err != nil {
+			return Scope{}, err
+		}
+		scope := Scope{Op: ScopeIs, Type: entityType}
+		if p.accept("in") {
+			uid, err := p.entityUID()
+			if err != nil {
+				return Scope{}, err
+			}
+			scope.Entities = []EntityUID{uid}
+		}
+		return scope, nil
+	}
+	return Scope{Op: ScopeAll}, nil
+}
+
+// path := ident ("::" ident)*
+func (p *parser) path() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return "", fmt.Errorf("%w: %d:%d: expected entity type, found %s", ErrParse, t.line, t.col, t)
+	}
+	parts := []string{t.text}
+	for p.is("::") && p.tokens[p.pos+1].kind == tokenIdent {
+		p.next()
+		parts = append(parts, p.next().text)
+	}
+	return strings.Join(parts, "::"), nil
+}
+
+// entityUID := path "::" string
+func (p *parser) entityUID() (EntityUID, error) {
+	entityType, err := p.path()
+	if err != nil {
+		return EntityUID{}, err
+	}
+	if err := p.expect("::"); err != nil {
+		return EntityUID{}, err
+	}
+	id := p.next()
+	if id.kind != tokenString {
+		return EntityUID{}, fmt.Errorf("%w: %d:%d: expected entity id string, found %s", ErrParse, id.line, id.col, id)
+	}
+	return EntityUID{Type: entityType, ID: id.text}, nil
+}
+
+// expr := "if" expr "then" expr "else" expr | or
+func (p *parser) expr() (expr, error) {
+	if p.accept("if") {
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		then, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("else"); err != nil {
+			return nil, err
+		}
+		otherwise, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &ifExpr{cond: cond, then: then, otherwise: otherwise}, nil
+	}
+	return p.or()
+}
+
+func (p *parser) or() (expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (expr, error) {
+	left, err := p.relation()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.relation()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// relation := add [relop add | "has" name | "like" pattern | "is" path ["in" add]]
+func (p *parser) relation() (expr, error) {
+	left, err := p.add()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.add()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+
+	switch {
+	case p.accept("has"):
+		name := p.next()
+		if name.kind != tokenIdent && name.kind != tokenString {
+			return nil, p.errorf("expected attribute name after has")
+		}
+		return &hasExpr{target: left, attribute: name.text}, nil
+
+	case p.accept("like"):
+		pattern := p.next()
+		if pattern.kind != tokenString {
+			return nil, p.errorf("expected pattern string after like")
+		}
+		return &likeExpr{target: left, pattern: pattern.text}, nil
+
+	case p.accept("is"):
+		entityType, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		is := &isExpr{target: left, entityType: entityType}
+		if p.accept("in") {
+			if is.in, err = p.add(); err != nil {
+				return nil, err
+			}
+		}
+		return is, nil
+	}
+	return left, nil
+}
+
+func (p *parser) add() (expr, error) {
+	left, err := p.mult()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+") || p.is("-") {
+		op := p.next().text
+		right, err := p.mult()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) mult() (expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("*") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "*", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.is("!") || p.is("-") {
+		op := p.next().text
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: op, operand: operand}, nil
+	}
+	return p.member()
+}
+
+// member := primary ("." ident ["(" args ")"] | "[" string "]")*
+func (p *parser) member() (expr, error) {
+	target, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.accept("."):
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, p.errorf("expected attribute or method name")
+			}
+			if p.accept("(") {
+				args, err := p.list(")")
+				if err != nil {
+					return nil, err
+				}
+				target = &methodExpr{target: target, method: name.text, args: args}
+			} else {
+				target = &attributeExpr{target: target, attribute: name.text}
+			}
+
+		case p.is("["):
+			p.next()
+			name := p.next()
+			if name.kind != tokenString {
+				return nil, p.errorf("expected attribute name string")
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			target = &attributeExpr{target: target, attribute: name.text}
+
+		default:
+			return target, nil
+		}
+	}
+}
+
+// list parses expressions separated by commas until the closing symbol
+func (p *parser) list(closing string) ([]expr, error) {
+	items := make([]expr, 0)
+	for !p.accept(closing) {
+		item, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if !p.is(closing) {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return items, nil
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.peek()
+
+	switch t.kind {
+	case tokenString:
+		p.next()
+		return &literal{value: t.text}, nil
+
+	case tokenInt:
+		p.next()
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %d:%d: %v", ErrParse, t.line, t.col, err)
+		}
+		return &literal{value: n}, nil
+
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			p.next()
+			return &literal{value: t.text == "true"}, nil
+		case "principal", "action", "resource", "context":
+			p.next()
+			return &variable{name: t.text}, nil
+		}
+		uid, err := p.entityUID()
+		if err != nil {
+			return nil, err
+		}
+		return &literal{value: uid}, nil
+
+	case tokenSymbol:
+		switch t.text {
+		case "(":
+			p.next()
+			inner, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+
+		case "[":
+			p.next()
+			items, err := p.list("]")
+			if err != nil {
+				return nil, err
+			}
+			return &setExpr{items: items}, nil
+
+		case "{":
+			p.next()
+			record := &recordExpr{fields: make(map[string]expr)}
+			for !p.accept("}") {
+				name := p.next()
+				if name.kind != tokenIdent && name.kind != tokenString {
+					return nil, p.errorf("expected record field name")
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				value, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				record.fields[name.text] = value
+				if !p.is("}") {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return record, nil
+		}
+	}
+	return nil, p.errorf("unexpected %s", t)
+}
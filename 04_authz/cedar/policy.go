@@ -0,0 +1,231 @@
+package cedar
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Effect is the effect of a policy
+type Effect string
+
+const (
+	Permit Effect = "permit"
+	Forbid Effect = "forbid"
+)
+
+// ScopeOp is the constraint of a policy scope
+type ScopeOp int
+
+const (
+	// ScopeAll matches any entity (principal)
+	ScopeAll ScopeOp = iota
+	// ScopeEq matches one entity (principal == User::"alice")
+	ScopeEq
+	// ScopeIn matches an entity and its descendants (principal in Group::"eng")
+	ScopeIn
+	// ScopeIs matches an entity type, optionally within an entity
+	// (resource is Document in Folder::"f1")
+	ScopeIs
+)
+
+// Scope constrains the principal, action or resource of a policy
+type Scope struct {
+	Op       ScopeOp
+	Type     string      // ScopeIs
+	Entities []EntityUID // ScopeEq, ScopeIn (and optional for ScopeIs)
+}
+
+// matches reports whether an entity satisfies the scope
+func (s Scope) matches(uid EntityUID, entities Entities) bool {
+	switch s.Op {
+	case ScopeEq:
+		return uid == s.Entities[0]
+	case ScopeIn:
+		for _, ancestor := range s.Entities {
+			if entities.In(uid, ancestor) {
+				return true
+			}
+		}
+		return false
+	case ScopeIs:
+		if uid.Type != s.Type {
+			return false
+		}
+		return len(s.Entities) == 0 || entities.In(uid, s.Entities[0])
+	}
+	return true
+}
+
+// Condition is a when or unless clause
+type Condition struct {
+	Unless bool
+	expr   expr
+}
+
+// Policy is a parsed Cedar policy
+type Policy struct {
+	// ID identifies the policy (the @id annotation, the PolicyStore ID, or
+	// "policy<N>" by position)
+	ID          string
+	Effect      Effect
+	Principal   Scope
+	Action      Scope
+	Resource    Scope
+	Conditions  []Condition
+	Annotations map[string]string
+}
+
+// evaluate reports whether the policy is satisfied by a request. Errors
+// (e.g., a missing attribute) make the policy not apply, as in Cedar.
+func (p *Policy) evaluate(r *request) (bool, error) {
+	if !p.Principal.matches(r.principal, r.entities) ||
+		!p.Action.matches(r.action, r.entities) ||
+		!p.Resource.matches(r.resource, r.entities) {
+		return false, nil
+	}
+
+	for _, condition := range p.Conditions {
+		satisfied, err := evalBool(condition.expr, r)
+		if err != nil {
+			return false, err
+		}
+		if satisfied == condition.Unless {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// PolicySet is a set of Cedar policies
+type PolicySet struct {
+	policies map[string]*Policy
+}
+
+// NewPolicySet creates an empty policy set
+func NewPolicySet() *PolicySet {
+	return &PolicySet{policies: make(map[string]*Policy)}
+}
+
+// ParsePolicySet parses Cedar source with one or more policies. Policies are
+// identified by their @id annotation or by position ("policy0", ...).
+func ParsePolicySet(src string) (*PolicySet, error) {
+	policies, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	set := NewPolicySet()
+	for i, policy := range policies {
+		policy.ID = policy.Annotations["id"]
+		if policy.ID == "" {
+			policy.ID = fmt.Sprintf("policy%d", i)
+		}
+		if err := set.Add(policy); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// ParsePolicy parses the source of exactly one policy
+func ParsePolicy(id, src string) (*Policy, error) {
+	policies, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) != 1 {
+		return nil, fmt.Errorf("%w: policy '%s' has %d policies, expected 1", ErrParse, id, len(policies))
+	}
+	policies[0].ID = id
+	return policies[0], nil
+}
+
+func parse(src string) ([]*Policy, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	return p.policies()
+}
+
+// Add adds a policy; IDs must be unique
+func (s *PolicySet) Add(policy *Policy) error {
+	if _, ok := s.policies[policy.ID]; ok {
+		return fmt.Errorf("duplicate policy id '%s'", policy.ID)
+	}
+	s.policies[policy.ID] = policy
+	return nil
+}
+
+// Remove removes a policy
+func (s *PolicySet) Remove(id string) {
+	delete(s.policies, id)
+}
+
+// Get returns a policy by ID
+func (s *PolicySet) Get(id string) (*Policy, bool) {
+	policy, ok := s.policies[id]
+	return policy, ok
+}
+
+// Policies returns the policies sorted by ID
+func (s *PolicySet) Policies() []*Policy {
+	policies := make([]*Policy, 0, len(s.policies))
+	for _, policy := range s.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ID < policies[j].ID
+	})
+	return policies
+}
+
+// Len returns the number of policies
+func (s *PolicySet) Len() int {
+	return len(s.policies)
+}
+
+// Decision is the result of authorizing a request against a policy set
+type Decision struct {
+	Allowed bool
+
+	// Determining are the policies that decided: the satisfied forbid
+	// policies when denied, the satisfied permit policies when allowed
+	Determining []string
+
+	// Errors are the policies that failed to evaluate (and were skipped)
+	Errors map[string]error
+}
+
+// authorize evaluates the set: allowed when a permit policy is satisfied and
+// no forbid policy is
+func (s *PolicySet) authorize(r *request) *Decision {
+	decision := &Decision{Determining: make([]string, 0), Errors: make(map[string]error)}
+	permits := make([]string, 0)
+	forbids := make([]string, 0)
+
+	for _, policy := range s.Policies() {
+		satisfied, err := policy.evaluate(r)
+		if err != nil {
+			decision.Errors[policy.ID] = err
+			continue
+		}
+		if !satisfied {
+			continue
+		}
+		if policy.Effect == Forbid {
+			forbids = append(forbids, policy.ID)
+		} else {
+			permits = append(permits, policy.ID)
+		}
+	}
+
+	if len(forbids) > 0 {
+		decision.Determining = forbids
+		return decision
+	}
+	decision.Allowed = len(permits) > 0
+	decision.Determining = permits
+	return decision
+}
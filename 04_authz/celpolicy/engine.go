@@ -0,0 +1,272 @@
+package celpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/policy"
+)
+
+var (
+	ErrInvalidExpression = errors.New("invalid CEL expression")
+	ErrEvaluation        = errors.New("CEL evaluation failed")
+)
+
+// ConditionKey is the key of authz.Policy.Conditions holding a CEL
+// expression, e.g., Conditions: {"cel": "resource.attributes.owner == subject.id"}
+const ConditionKey = "cel"
+
+// Config holds CEL engine configuration
+type Config struct {
+	// MaxPrograms is the number of compiled programs kept in the cache
+	// (default: 1024)
+	MaxPrograms int
+
+	// CostLimit aborts evaluations whose runtime cost exceeds it
+	// (default: 1,000,000)
+	CostLimit uint64
+
+	// Now returns the value of the "now" variable (default: time.Now)
+	Now func() time.Time
+}
+
+// Engine compiles and evaluates CEL conditions over the variables:
+//
+//	subject     map: id, type, principal, roles, permissions, groups,
+//	            attributes, profile, metadata
+//	resource    map: type, id, attributes
+//	action      string
+//	environment map: session attributes (ip_address, country, ...) and the
+//	            request context
+//	now         timestamp
+//
+// Compiled programs are cached by expression. Engine implements
+// policy.ConditionEvaluator.
+type Engine struct {
+	config *Config
+	env    *cel.Env
+
+	mu       sync.RWMutex
+	programs map[string]cel.Program
+}
+
+// NewEngine creates a new CEL engine
+func NewEngine(config *Config) (*Engine, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.MaxPrograms <= 0 {
+		config.MaxPrograms = 1024
+	}
+	if config.CostLimit == 0 {
+		config.CostLimit = 1_000_000
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("subject", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("action", cel.StringType),
+		cel.Variable("environment", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("now", cel.TimestampType),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	return &Engine{
+		config:   config,
+		env:      env,
+		programs: make(map[string]cel.Program),
+	}, nil
+}
+
+// MustNewEngine is like NewEngine but panics on error
+func MustNewEngine(config *Config) *Engine {
+	engine, err := NewEngine(config)
+	if err != nil {
+		panic(err)
+	}
+	return engine
+}
+
+// Validate compiles an expression and checks that it returns a bool
+func (e *Engine) Validate(expression string) error {
+	_, err := e.program(expression)
+	return err
+}
+
+// ValidatePolicy validates the CEL condition of a policy, if any
+func (e *Engine) ValidatePolicy(p *authz.Policy) error {
+	expression, ok, err := Expression(p)
+	if err != nil || !ok {
+		return err
+	}
+	if err := e.Validate(expression); err != nil {
+		return fmt.Errorf("policy '%s': %w", p.ID, err)
+	}
+	return nil
+}
+
+// Eval evaluates an expression for an authorization request
+func (e *Engine) Eval(ctx context.Context, expression string, request *authz.AuthorizationRequest) (bool, error) {
+	program, err := e.program(expression)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := program.ContextEval(ctx, e.activation(request))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrEvaluation, err)
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: result is %s, not bool", ErrEvaluation, out.Type().TypeName())
+	}
+	return result, nil
+}
+
+// EvaluateConditions evaluates the CEL expression of a policy; the other
+// condition keys must match as with policy.AttributeConditions
+func (e *Engine) EvaluateConditions(ctx context.Context, p *authz.Policy, request *authz.AuthorizationRequest) (bool, error) {
+	expression, ok, err := Expression(p)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return policy.MatchAttributes(p.Conditions, request), nil
+	}
+
+	others := maps.Clone(p.Conditions)
+	delete(others, ConditionKey)
+	if !policy.MatchAttributes(others, request) {
+		return false, nil
+	}
+	return e.Eval(ctx, expression, request)
+}
+
+// CachedPrograms returns the number of compiled programs in the cache
+func (e *Engine) CachedPrograms() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.programs)
+}
+
+// Expression returns the CEL expression of a policy
+func Expression(p *authz.Policy) (string, bool, error) {
+	value, ok := p.Conditions[ConditionKey]
+	if !ok {
+		return "", false, nil
+	}
+	expression, ok := value.(string)
+	if !ok {
+		return "", false, fmt.Errorf("%w: policy '%s': condition %q is %T, not a string",
+			ErrInvalidExpression, p.ID, ConditionKey, value)
+	}
+	return expression, true, nil
+}
+
+// program returns the compiled program of an expression, compiling and
+// caching it on first use
+func (e *Engine) program(expression string) (cel.Program, error) {
+	e.mu.RLock()
+	program, ok := e.programs[expression]
+	e.mu.RUnlock()
+	if ok {
+		return program, nil
+	}
+
+	ast, issues := e.env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("%w: %q returns %s, not bool", ErrInvalidExpression, expression, ast.OutputType())
+	}
+
+	program, err := e.env.Program(ast, cel.CostLimit(e.config.CostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.programs) >= e.config.MaxPrograms {
+		// Evict an arbitrary program; policies rarely exceed the cache
+		for key := range e.programs {
+			delete(e.programs, key)
+			break
+		}
+	}
+	e.programs[expression] = program
+	return program, nil
+}
+
+// activation builds the variables of an authorization request
+func (e *Engine) activation(request *authz.AuthorizationRequest) map[string]any {
+	sub := map[string]any{
+		"roles":       []string{},
+		"permissions": []string{},
+		"groups":      []string{},
+		"attributes":  map[string]any{},
+		"profile":     map[string]any{},
+		"metadata":    map[string]any{},
+	}
+	environment := make(map[string]any)
+
+	if identity := request.Subject; identity != nil {
+		if identity.Subject != nil {
+			sub["id"] = identity.Subject.ID
+			sub["type"] = identity.Subject.Type
+			sub["principal"] = identity.Subject.Principal
+			sub["attributes"] = orEmpty(identity.Subject.Attributes)
+		}
+		sub["roles"] = orEmptySlice(identity.Roles)
+		sub["permissions"] = orEmptySlice(identity.Permissions)
+		sub["groups"] = orEmptySlice(identity.Groups)
+		sub["profile"] = orEmpty(identity.Profile)
+		sub["metadata"] = orEmpty(identity.Metadata)
+		if identity.Session != nil {
+			environment = identity.Session.EnvironmentAttributes()
+		}
+	}
+	maps.Copy(environment, request.Context)
+
+	resource := map[string]any{"attributes": map[string]any{}}
+	if request.Resource != nil {
+		resource["type"] = request.Resource.Type
+		resource["id"] = request.Resource.ID
+		resource["attributes"] = orEmpty(request.Resource.Attributes)
+	}
+
+	return map[string]any{
+		"subject":     sub,
+		"resource":    resource,
+		"action":      string(request.Action),
+		"environment": environment,
+		"now":         e.config.Now(),
+	}
+}
+
+func orEmpty(m map[string]any) map[string]any {
+	if m == nil {
+		return map[string]any{}
+	}
+	return m
+}
+
+func orEmptySlice(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
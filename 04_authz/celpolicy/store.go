@@ -0,0 +1,36 @@
+package celpolicy
+
+import (
+	"context"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// ValidatingStore wraps a policy store and rejects policies whose CEL
+// condition does not compile, so broken expressions fail when they are
+// written instead of when they are evaluated
+type ValidatingStore struct {
+	authz.PolicyStore
+	engine *Engine
+}
+
+// NewValidatingStore wraps a policy store with CEL validation
+func NewValidatingStore(store authz.PolicyStore, engine *Engine) *ValidatingStore {
+	return &ValidatingStore{PolicyStore: store, engine: engine}
+}
+
+// Create validates and creates a policy
+func (s *ValidatingStore) Create(ctx context.Context, policy *authz.Policy) error {
+	if err := s.engine.ValidatePolicy(policy); err != nil {
+		return err
+	}
+	return s.PolicyStore.Create(ctx, policy)
+}
+
+// Update validates and updates a policy
+func (s *ValidatingStore) Update(ctx context.Context, policy *authz.Policy) error {
+	if err := s.engine.ValidatePolicy(policy); err != nil {
+		return err
+	}
+	return s.PolicyStore.Update(ctx, policy)
+}
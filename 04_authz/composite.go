@@ -0,0 +1,363 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+var (
+	ErrUnknownCombiningAlgorithm = errors.New("unknown combining algorithm")
+)
+
+// CombiningAlgorithm combines the decisions of the members of a
+// CompositeEvaluator
+type CombiningAlgorithm string
+
+const (
+	// DenyOverrides denies if any member explicitly denies, otherwise allows
+	// if any member allows
+	DenyOverrides CombiningAlgorithm = "deny-overrides"
+
+	// PermitOverrides allows if any member allows
+	PermitOverrides CombiningAlgorithm = "permit-overrides"
+
+	// FirstApplicable takes the decision of the first member that allows or
+	// explicitly denies
+	FirstApplicable CombiningAlgorithm = "first-applicable"
+
+	// Unanimous allows only if every applicable member allows
+	Unanimous CombiningAlgorithm = "unanimous"
+)
+
+// EffectDeny is the value of Metadata["effect"] marking an explicit deny
+// (a deny rule or forbid policy matched), as opposed to a decision that
+// merely found no grant
+const EffectDeny = "deny"
+
+// IsExplicitDeny reports whether the decision is an explicit deny
+func (d *AuthorizationDecision) IsExplicitDeny() bool {
+	return d != nil && !d.Allowed && d.Metadata["effect"] == EffectDeny
+}
+
+// CompositeMember is an evaluator of a CompositeEvaluator
+type CompositeMember struct {
+	// Name identifies the member in decisions (e.g., "rbac")
+	Name string
+
+	// Evaluator makes the member's decision
+	Evaluator PolicyEvaluator
+
+	// Filter restricts the requests the member applies to (optional, nil:
+	// every request)
+	Filter func(ctx context.Context, request *AuthorizationRequest) bool
+}
+
+// CompositeEvaluator chains evaluators (RBAC, ABAC, ACL, policies, ...) and
+// combines their decisions with a combining algorithm. Members are
+// evaluated in order; a member error fails the evaluation.
+type CompositeEvaluator struct {
+	mu        sync.RWMutex
+	algorithm CombiningAlgorithm
+	members   []CompositeMember
+}
+
+// NewCompositeEvaluator creates a composite evaluator
+func NewCompositeEvaluator(algorithm CombiningAlgorithm, members ...CompositeMember) (*CompositeEvaluator, error) {
+	switch algorithm {
+	case "":
+		algorithm = DenyOverrides
+	case DenyOverrides, PermitOverrides, FirstApplicable, Unanimous:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCombiningAlgorithm, algorithm)
+	}
+	return &CompositeEvaluator{algorithm: algorithm, members: slices.Clone(members)}, nil
+}
+
+// Add appends a member
+func (c *CompositeEvaluator) Add(name string, evaluator PolicyEvaluator, filter func(ctx context.Context, request *AuthorizationRequest) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.members = append(c.members, CompositeMember{Name: name, Evaluator: evaluator, Filter: filter})
+}
+
+// Members returns the members
+func (c *CompositeEvaluator) Members() []CompositeMember {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.members)
+}
+
+// Algorithm returns the combining algorithm
+func (c *CompositeEvaluator) Algorithm() CombiningAlgorithm {
+	return c.algorithm
+}
+
+// Evaluate evaluates the applicable members and combines their decisions
+func (c *CompositeEvaluator) Evaluate(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	decisions := make(map[string]bool)
+	var allowedBy, deniedBy string
+	var allowed, denied *AuthorizationDecision
+	applicable := 0
+
+	for _, member := range c.Members() {
+		if member.Filter != nil && !member.Filter(ctx, request) {
+			RecordTrace(ctx, TraceStep{Evaluator: "composite", Kind: "member", ID: member.Name, Result: TraceSkipped, Detail: "filter does not match"})
+			continue
+		}
+		applicable++
+
+		decision, err := c.evaluateMember(ctx, member, request)
+		if err != nil {
+			return nil, fmt.Errorf("evaluator %s: %w", member.Name, err)
+		}
+		decisions[member.Name] = decision.Allowed
+
+		switch {
+		case decision.Allowed:
+			if allowed == nil {
+				allowed, allowedBy = decision, member.Name
+			}
+			if c.algorithm == PermitOverrides || c.algorithm == FirstApplicable {
+				return c.result(true, member.Name, decision, decisions), nil
+			}
+
+		case decision.IsExplicitDeny():
+			if denied == nil {
+				denied, deniedBy = decision, member.Name
+			}
+			if c.algorithm != PermitOverrides {
+				return c.result(false, member.Name, decision, decisions), nil
+			}
+
+		default:
+			// No grant: decisive only when every member must agree
+			if c.algorithm == Unanimous {
+				return c.result(false, member.Name, decision, decisions), nil
+			}
+		}
+	}
+
+	if applicable == 0 {
+		return &AuthorizationDecision{
+			Allowed:  false,
+			Reason:   "no applicable evaluator",
+			Metadata: map[string]any{"algorithm": string(c.algorithm)},
+		}, nil
+	}
+	if allowed != nil && c.algorithm != PermitOverrides {
+		return c.result(true, allowedBy, allowed, decisions), nil
+	}
+	if denied != nil {
+		return c.result(false, deniedBy, denied, decisions), nil
+	}
+
+	return &AuthorizationDecision{
+		Allowed: false,
+		Reason:  fmt.Sprintf("%s: no evaluator allowed access", c.algorithm),
+		Metadata: map[string]any{
+			"algorithm": string(c.algorithm),
+			"decisions": decisions,
+		},
+	}, nil
+}
+
+// evaluateMember evaluates a member; in explain mode its steps are nested
+// under a member step
+func (c *CompositeEvaluator) evaluateMember(ctx context.Context, member CompositeMember, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	if !Explaining(ctx) {
+		return member.Evaluator.Evaluate(ctx, request)
+	}
+
+	memberCtx, recorder := nestedTrace(ctx)
+	decision, err := member.Evaluator.Evaluate(memberCtx, request)
+	step := TraceStep{Evaluator: "composite", Kind: "member", ID: member.Name, Steps: recorder.collected()}
+	switch {
+	case err != nil:
+		step.Result, step.Detail = TraceError, err.Error()
+	case decision.IsExplicitDeny():
+		step.Result, step.Detail = TraceMatched, "explicit deny: "+decision.Reason
+	default:
+		step.Result, step.Detail = MatchResult(decision.Allowed), decision.Reason
+	}
+	RecordTrace(ctx, step)
+	return decision, err
+}
+
+// result builds the combined decision from the deciding member's decision
+func (c *CompositeEvaluator) result(allowed bool, member string, decision *AuthorizationDecision, decisions map[string]bool) *AuthorizationDecision {
+	metadata := make(map[string]any, len(decision.Metadata)+3)
+	for k, v := range decision.Metadata {
+		metadata[k] = v
+	}
+	metadata["algorithm"] = string(c.algorithm)
+	metadata["decided_by"] = member
+	metadata["decisions"] = decisions
+
+	return &AuthorizationDecision{
+		Allowed:     allowed,
+		Reason:      fmt.Sprintf("%s: %s: %s", c.algorithm, member, decision.Reason),
+		Obligations: decision.Obligations,
+		Advice:      decision.Advice,
+		Metadata:    metadata,
+	}
+}
+
+// HasPermission checks the permission with every member that is a
+// PermissionChecker; any member granting it is enough. Members that do not
+// support permissions (e.g., ABAC) are skipped.
+func (c *CompositeEvaluator) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	return c.anyChecker(func(checker PermissionChecker) (bool, error) {
+		return checker.HasPermission(ctx, identity, permission)
+	})
+}
+
+// HasAnyPermission checks if any member grants any of the permissions
+func (c *CompositeEvaluator) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return c.anyChecker(func(checker PermissionChecker) (bool, error) {
+		return checker.HasAnyPermission(ctx, identity, permissions...)
+	})
+}
+
+// HasAllPermissions checks if every permission is granted by some member
+func (c *CompositeEvaluator) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, permission := range permissions {
+		ok, err := c.HasPermission(ctx, identity, permission)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// HasRole checks the role with every member that is a RoleChecker
+func (c *CompositeEvaluator) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return c.anyRoleChecker(func(checker RoleChecker) (bool, error) {
+		return checker.HasRole(ctx, identity, role)
+	}, identity.HasRole(role))
+}
+
+// HasAnyRole checks if any member grants any of the roles
+func (c *CompositeEvaluator) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return c.anyRoleChecker(func(checker RoleChecker) (bool, error) {
+		return checker.HasAnyRole(ctx, identity, roles...)
+	}, identity.HasAnyRole(roles...))
+}
+
+// HasAllRoles checks if every role is granted by some member
+func (c *CompositeEvaluator) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	for _, role := range roles {
+		ok, err := c.HasRole(ctx, identity, role)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// anyChecker returns true if a permission checker member grants; errors are
+// returned only when no member could answer
+func (c *CompositeEvaluator) anyChecker(check func(PermissionChecker) (bool, error)) (bool, error) {
+	var firstErr error
+	answered := false
+	for _, member := range c.Members() {
+		checker, ok := member.Evaluator.(PermissionChecker)
+		if !ok {
+			continue
+		}
+		granted, err := check(checker)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("evaluator %s: %w", member.Name, err)
+			}
+			continue
+		}
+		answered = true
+		if granted {
+			return true, nil
+		}
+	}
+	if !answered && firstErr != nil {
+		return false, firstErr
+	}
+	return false, nil
+}
+
+// anyRoleChecker returns true if a role checker member grants; without
+// role checker members the identity's own roles decide
+func (c *CompositeEvaluator) anyRoleChecker(check func(RoleChecker) (bool, error), fallback bool) (bool, error) {
+	checked := false
+	for _, member := range c.Members() {
+		checker, ok := member.Evaluator.(RoleChecker)
+		if !ok {
+			continue
+		}
+		checked = true
+		granted, err := check(checker)
+		if err != nil {
+			return false, fmt.Errorf("evaluator %s: %w", member.Name, err)
+		}
+		if granted {
+			return true, nil
+		}
+	}
+	if !checked {
+		return fallback, nil
+	}
+	return false, nil
+}
+
+// ContributeGraph forwards to the members that are GraphContributors
+func (c *CompositeEvaluator) ContributeGraph(ctx context.Context, graph *AccessGraph) error {
+	for _, member := range c.Members() {
+		if contributor, ok := member.Evaluator.(GraphContributor); ok {
+			if err := contributor.ContributeGraph(ctx, graph); err != nil {
+				return fmt.Errorf("evaluator %s: %w", member.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ForResourceTypes returns a member filter matching resource types
+func ForResourceTypes(types ...string) func(ctx context.Context, request *AuthorizationRequest) bool {
+	return func(ctx context.Context, request *AuthorizationRequest) bool {
+		return request.Resource != nil && slices.Contains(types, request.Resource.Type)
+	}
+}
+
+// ForActions returns a member filter matching actions
+func ForActions(actions ...Action) func(ctx context.Context, request *AuthorizationRequest) bool {
+	return func(ctx context.Context, request *AuthorizationRequest) bool {
+		return slices.Contains(actions, request.Action)
+	}
+}
+
+// ListAuthorizedResources unions the filters of the applicable members that
+// are ResourceListers. Only PermitOverrides composes this way; with the other
+// algorithms a member may deny what another allows, which a filter of
+// allowed resources cannot express.
+func (c *CompositeEvaluator) ListAuthorizedResources(ctx context.Context, identity *subject.IdentityContext, action Action, resourceType string) (*ResourceFilter, error) {
+	if c.algorithm != PermitOverrides {
+		return nil, fmt.Errorf("%w: %s composite", ErrFilterNotSupported, c.algorithm)
+	}
+
+	request := &AuthorizationRequest{Subject: identity, Resource: &Resource{Type: resourceType}, Action: action}
+	filters := make([]*ResourceFilter, 0)
+	for _, member := range c.Members() {
+		lister, ok := member.Evaluator.(ResourceLister)
+		if !ok || (member.Filter != nil && !member.Filter(ctx, request)) {
+			continue
+		}
+		filter, err := lister.ListAuthorizedResources(ctx, identity, action, resourceType)
+		if err != nil {
+			return nil, fmt.Errorf("evaluator %s: %w", member.Name, err)
+		}
+		filters = append(filters, filter)
+	}
+	return Union(resourceType, filters...), nil
+}
@@ -41,6 +41,11 @@ type AuthorizationRequest struct {
 	// Action is the action being performed
 	Action Action
 
+	// TenantID evaluates the request in another tenant than the one of the
+	// context (optional). Only system subjects allowed in the tenant may set
+	// it (see WithSystemScope); lokstraauth.Auth.Authorize enforces this.
+	TenantID string
+
 	// Context contains additional context for the request
 	Context map[string]any
 }
@@ -53,11 +58,19 @@ type AuthorizationDecision struct {
 	// Reason provides the reason for the decision
 	Reason string
 
-	// Obligations are actions that must be performed if access is granted
-	Obligations []string
+	// Obligations must be fulfilled by the enforcement point, which refuses
+	// access when it cannot fulfil one (see Obligation)
+	Obligations []Obligation
+
+	// Advice are optional obligations; enforcement points ignore advice
+	// they do not understand
+	Advice []Obligation
 
 	// Metadata contains additional decision metadata
 	Metadata map[string]any
+
+	// Trace is the evaluation trace, set in explain mode (see Explain)
+	Trace []TraceStep
 }
 
 // PolicyEvaluator evaluates policies to make authorization decisions
@@ -130,6 +143,11 @@ type Policy struct {
 
 	// Conditions are additional conditions for the policy
 	Conditions map[string]any
+
+	// Obligations and Advice are attached to the decisions the policy
+	// determines (see Obligation)
+	Obligations []Obligation
+	Advice      []Obligation
 }
 
 // PolicyStore stores and retrieves policies
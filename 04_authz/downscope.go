@@ -0,0 +1,132 @@
+package authz
+
+import (
+	"context"
+	"strings"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/permission"
+)
+
+// AllowedPermissionsAttribute is the subject attribute restricting a
+// down-scoped identity to a subset of its permissions (the
+// "allowed_permissions" claim of down-scoped tokens)
+const AllowedPermissionsAttribute = "allowed_permissions"
+
+// AllowedPermissions returns the permissions a down-scoped identity is
+// restricted to (false if the identity is not restricted)
+func AllowedPermissions(identity *subject.IdentityContext) ([]string, bool) {
+	if identity == nil || identity.Subject == nil {
+		return nil, false
+	}
+	return stringList(identity.Subject.Attributes[AllowedPermissionsAttribute])
+}
+
+// RestrictedAuthorizer enforces the restriction of down-scoped identities
+// on top of an authorizer: they are allowed what the authorizer allows and
+// their allowed permissions grant, and hold no roles. Other identities are
+// authorized by the authorizer alone.
+type RestrictedAuthorizer struct {
+	inner Authorizer
+}
+
+// NewRestrictedAuthorizer wraps an authorizer with the restriction of
+// down-scoped identities
+func NewRestrictedAuthorizer(inner Authorizer) *RestrictedAuthorizer {
+	return &RestrictedAuthorizer{inner: inner}
+}
+
+// Restrict returns the authorizer wrapped with the restriction of
+// down-scoped identities (nil for a nil authorizer)
+func Restrict(authorizer Authorizer) Authorizer {
+	switch authorizer.(type) {
+	case nil, *RestrictedAuthorizer:
+		return authorizer
+	}
+	return NewRestrictedAuthorizer(authorizer)
+}
+
+// Unwrap returns the wrapped authorizer
+func (r *RestrictedAuthorizer) Unwrap() Authorizer {
+	return r.inner
+}
+
+// Evaluate denies requests of down-scoped identities their allowed
+// permissions do not grant, and evaluates the others
+func (r *RestrictedAuthorizer) Evaluate(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	allowed, restricted := AllowedPermissions(request.Subject)
+	if restricted && (request.Resource == nil || !grantsAny(allowed, requestPermissions(request))) {
+		RecordTrace(ctx, TraceStep{Evaluator: "downscope", Kind: "restriction", Result: TraceNotMatched, Detail: "allowed permissions: " + strings.Join(allowed, " ")})
+		return &AuthorizationDecision{
+			Allowed:  false,
+			Reason:   "outside the permissions of the down-scoped token",
+			Metadata: map[string]any{"effect": EffectDeny},
+		}, nil
+	}
+	return r.inner.Evaluate(ctx, request)
+}
+
+// HasPermission checks a permission, which down-scoped identities must be
+// allowed
+func (r *RestrictedAuthorizer) HasPermission(ctx context.Context, identity *subject.IdentityContext, required string) (bool, error) {
+	if allowed, restricted := AllowedPermissions(identity); restricted && !permission.MatchAny(allowed, required) {
+		return false, nil
+	}
+	return r.inner.HasPermission(ctx, identity, required)
+}
+
+// HasAnyPermission checks if the identity has any of the permissions
+func (r *RestrictedAuthorizer) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, permission := range permissions {
+		has, err := r.HasPermission(ctx, identity, permission)
+		if err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
+}
+
+// HasAllPermissions checks if the identity has all of the permissions
+func (r *RestrictedAuthorizer) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, permission := range permissions {
+		has, err := r.HasPermission(ctx, identity, permission)
+		if err != nil || !has {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// HasRole checks a role; down-scoped identities hold no roles
+func (r *RestrictedAuthorizer) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	if _, restricted := AllowedPermissions(identity); restricted {
+		return false, nil
+	}
+	return r.inner.HasRole(ctx, identity, role)
+}
+
+// HasAnyRole checks roles; down-scoped identities hold no roles
+func (r *RestrictedAuthorizer) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	if _, restricted := AllowedPermissions(identity); restricted {
+		return false, nil
+	}
+	return r.inner.HasAnyRole(ctx, identity, roles...)
+}
+
+// HasAllRoles checks roles; down-scoped identities hold no roles
+func (r *RestrictedAuthorizer) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	if _, restricted := AllowedPermissions(identity); restricted {
+		return false, nil
+	}
+	return r.inner.HasAllRoles(ctx, identity, roles...)
+}
+
+// grantsAny reports whether granted permissions match any required one
+func grantsAny(granted, required []string) bool {
+	for _, candidate := range required {
+		if permission.MatchAny(granted, candidate) {
+			return true
+		}
+	}
+	return false
+}
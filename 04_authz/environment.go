@@ -0,0 +1,126 @@
+package authz
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"time"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+// RequestInfo describes the request being authorized
+type RequestInfo struct {
+	IPAddress string
+	UserAgent string
+	Method    string
+	Path      string
+	RequestID string
+}
+
+type requestInfoContextKey struct{}
+
+// WithRequestInfo returns a context carrying the request being authorized
+// (set by the auth middleware)
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoContextKey{}, info)
+}
+
+// RequestInfoFromContext returns the request of the context (nil if none)
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	if ctx == nil {
+		return nil
+	}
+	info, _ := ctx.Value(requestInfoContextKey{}).(*RequestInfo)
+	return info
+}
+
+// EnvironmentConfig configures the built-in environment attributes
+type EnvironmentConfig struct {
+	// Location is the time zone of the time attributes (default: time.Local)
+	Location *time.Location
+
+	// Static attributes are added to every evaluation (e.g., "deployment":
+	// "production"); computed attributes take precedence
+	Static map[string]any
+
+	// Now returns the evaluation time (default: time.Now)
+	Now func() time.Time
+}
+
+// EnvironmentAttributeProvider provides the environment attributes of every
+// evaluation, so callers do not populate them by hand:
+//
+//	time            time.Time of the evaluation
+//	time_of_day     hour (0-23), as is hour; minute (0-59)
+//	weekday         "monday" ... "sunday"; is_weekend (bool)
+//	date            "2006-01-02"
+//	timestamp       Unix seconds
+//	ip_address      client IP (RequestInfo or subject.WithClientIP)
+//	user_agent, request_method, request_path, request_id (RequestInfo)
+//
+// It implements AttributeProvider; subject and resource attributes are nil.
+type EnvironmentAttributeProvider struct {
+	config *EnvironmentConfig
+}
+
+// NewEnvironmentAttributeProvider creates an environment attribute provider
+func NewEnvironmentAttributeProvider(config *EnvironmentConfig) *EnvironmentAttributeProvider {
+	if config == nil {
+		config = &EnvironmentConfig{}
+	}
+	if config.Location == nil {
+		config.Location = time.Local
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &EnvironmentAttributeProvider{config: config}
+}
+
+// GetEnvironmentAttributes returns the time, request and static attributes
+func (p *EnvironmentAttributeProvider) GetEnvironmentAttributes(ctx context.Context) (map[string]any, error) {
+	attrs := maps.Clone(p.config.Static)
+	if attrs == nil {
+		attrs = make(map[string]any)
+	}
+
+	now := p.config.Now().In(p.config.Location)
+	attrs["time"] = now
+	attrs["time_of_day"] = now.Hour()
+	attrs["hour"] = now.Hour()
+	attrs["minute"] = now.Minute()
+	attrs["weekday"] = strings.ToLower(now.Weekday().String())
+	attrs["is_weekend"] = now.Weekday() == time.Saturday || now.Weekday() == time.Sunday
+	attrs["date"] = now.Format(time.DateOnly)
+	attrs["timestamp"] = now.Unix()
+
+	if ip := subject.ClientIPFromContext(ctx); ip != "" {
+		attrs["ip_address"] = ip
+	}
+	if info := RequestInfoFromContext(ctx); info != nil {
+		setIfNotEmpty(attrs, "ip_address", info.IPAddress)
+		setIfNotEmpty(attrs, "user_agent", info.UserAgent)
+		setIfNotEmpty(attrs, "request_method", info.Method)
+		setIfNotEmpty(attrs, "request_path", info.Path)
+		setIfNotEmpty(attrs, "request_id", info.RequestID)
+	}
+
+	return attrs, nil
+}
+
+// GetSubjectAttributes returns nil (environment attributes only)
+func (p *EnvironmentAttributeProvider) GetSubjectAttributes(ctx context.Context, subjectID string) (map[string]any, error) {
+	return nil, nil
+}
+
+// GetResourceAttributes returns nil (environment attributes only)
+func (p *EnvironmentAttributeProvider) GetResourceAttributes(ctx context.Context, resource *Resource) (map[string]any, error) {
+	return nil, nil
+}
+
+func setIfNotEmpty(attrs map[string]any, key, value string) {
+	if value != "" {
+		attrs[key] = value
+	}
+}
@@ -0,0 +1,171 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TraceResult is the outcome of a trace step
+type TraceResult string
+
+const (
+	TraceMatched    TraceResult = "matched"
+	TraceNotMatched TraceResult = "not_matched"
+	TraceSkipped    TraceResult = "skipped"
+	TraceError      TraceResult = "error"
+)
+
+// TraceStep is one step of a decision trace: a rule, policy, role, ACL or
+// relation that was consulted, and nested steps for composite evaluators
+type TraceStep struct {
+	// Evaluator is the evaluator that took the step (e.g., "abac")
+	Evaluator string `json:"evaluator,omitempty"`
+
+	// Kind is what was consulted: "rule", "policy", "role", "acl",
+	// "relation", "member", "default", ...
+	Kind string `json:"kind"`
+
+	// ID identifies the rule, policy, role or resource
+	ID string `json:"id,omitempty"`
+
+	Result TraceResult `json:"result"`
+	Detail string      `json:"detail,omitempty"`
+
+	// Conditions are the conditions of a rule or policy and their outcome
+	Conditions []ConditionTrace `json:"conditions,omitempty"`
+
+	// Steps are nested steps, e.g., of a composite member
+	Steps []TraceStep `json:"steps,omitempty"`
+}
+
+// ConditionTrace is the outcome of one condition
+type ConditionTrace struct {
+	// Condition describes the condition, e.g., "subject.department eq eng"
+	Condition string `json:"condition"`
+
+	// Actual is the value the condition was evaluated against
+	Actual any `json:"actual,omitempty"`
+
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+type traceKey struct{}
+
+// traceRecorder collects the steps of one evaluation
+type traceRecorder struct {
+	mu    sync.Mutex
+	steps []TraceStep
+}
+
+func (r *traceRecorder) record(step TraceStep) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func (r *traceRecorder) collected() []TraceStep {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TraceStep(nil), r.steps...)
+}
+
+// WithExplain enables explain mode: evaluators called with the returned
+// context record the steps of their evaluation (see TraceFromContext)
+func WithExplain(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceKey{}, &traceRecorder{})
+}
+
+// Explaining reports whether explain mode is enabled, so evaluators only
+// build trace steps when they are wanted
+func Explaining(ctx context.Context) bool {
+	_, ok := ctx.Value(traceKey{}).(*traceRecorder)
+	return ok
+}
+
+// RecordTrace records a step in explain mode; it is a no-op otherwise
+func RecordTrace(ctx context.Context, step TraceStep) {
+	if recorder, ok := ctx.Value(traceKey{}).(*traceRecorder); ok {
+		recorder.record(step)
+	}
+}
+
+// TraceFromContext returns the steps recorded in explain mode
+func TraceFromContext(ctx context.Context) []TraceStep {
+	if recorder, ok := ctx.Value(traceKey{}).(*traceRecorder); ok {
+		return recorder.collected()
+	}
+	return nil
+}
+
+// nestedTrace returns a context recording into a fresh recorder, so the
+// steps of a nested evaluation can be attached to a parent step
+func nestedTrace(ctx context.Context) (context.Context, *traceRecorder) {
+	recorder := &traceRecorder{}
+	return context.WithValue(ctx, traceKey{}, recorder), recorder
+}
+
+// Explain evaluates a request in explain mode and returns the decision with
+// its Trace: the rules, policies and grants consulted and which conditions
+// matched or failed
+func Explain(ctx context.Context, evaluator PolicyEvaluator, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	ctx = WithExplain(ctx)
+	decision, err := evaluator.Evaluate(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	decision.Trace = TraceFromContext(ctx)
+	return decision, nil
+}
+
+// FormatTrace renders a trace as indented text, one step per line
+func FormatTrace(steps []TraceStep) string {
+	var b strings.Builder
+	formatSteps(&b, steps, 0)
+	return b.String()
+}
+
+func formatSteps(b *strings.Builder, steps []TraceStep, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, step := range steps {
+		b.WriteString(indent)
+		if step.Evaluator != "" {
+			fmt.Fprintf(b, "[%s] ", step.Evaluator)
+		}
+		b.WriteString(step.Kind)
+		if step.ID != "" {
+			fmt.Fprintf(b, " %s", step.ID)
+		}
+		fmt.Fprintf(b, ": %s", step.Result)
+		if step.Detail != "" {
+			fmt.Fprintf(b, " (%s)", step.Detail)
+		}
+		b.WriteString("\n")
+
+		for _, condition := range step.Conditions {
+			mark := "✗"
+			if condition.Matched {
+				mark = "✓"
+			}
+			fmt.Fprintf(b, "%s  %s %s", indent, mark, condition.Condition)
+			if condition.Actual != nil {
+				fmt.Fprintf(b, " (actual: %v)", condition.Actual)
+			}
+			if condition.Error != "" {
+				fmt.Fprintf(b, " error: %s", condition.Error)
+			}
+			b.WriteString("\n")
+		}
+		formatSteps(b, step.Steps, depth+1)
+	}
+}
+
+// MatchResult maps a boolean outcome to TraceMatched or TraceNotMatched
+func MatchResult(matched bool) TraceResult {
+	if matched {
+		return TraceMatched
+	}
+	return TraceNotMatched
+}
@@ -0,0 +1,395 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrFilterNotSupported = autherrors.New(autherrors.ErrNotImplemented, "resource filter not supported")
+	ErrUnmappedField      = errors.New("filter field has no column")
+)
+
+// ResourceLister lists the resources of a type a subject may access for an
+// action, so data layers can pre-filter list queries instead of authorizing
+// every row
+type ResourceLister interface {
+	ListAuthorizedResources(ctx context.Context, identity *subject.IdentityContext, action Action, resourceType string) (*ResourceFilter, error)
+}
+
+// ResourceFilter describes the authorized resources of one type: a resource
+// is authorized when All is set, its ID is in IDs, or it satisfies
+// Condition. A filter with none of them authorizes nothing.
+type ResourceFilter struct {
+	ResourceType string
+
+	// All authorizes every resource of the type
+	All bool
+
+	// IDs are the authorized resource IDs (ACL, ReBAC)
+	IDs []string
+
+	// Condition is a predicate over resource attributes (ABAC)
+	Condition *FilterCondition
+}
+
+// FilterOp is the operator of a FilterCondition
+type FilterOp string
+
+const (
+	OpAnd      FilterOp = "and"
+	OpOr       FilterOp = "or"
+	OpNot      FilterOp = "not"
+	OpEq       FilterOp = "eq"
+	OpNe       FilterOp = "ne"
+	OpIn       FilterOp = "in"
+	OpNotIn    FilterOp = "not_in"
+	OpGt       FilterOp = "gt"
+	OpLt       FilterOp = "lt"
+	OpContains FilterOp = "contains"
+)
+
+// FilterCondition is a predicate over resource attributes: a comparison of
+// Field with Value, or a combination (and, or, not) of Operands. The "id"
+// field is the resource ID.
+type FilterCondition struct {
+	Op       FilterOp
+	Field    string
+	Value    any
+	Operands []*FilterCondition
+}
+
+// Compare creates a comparison condition
+func Compare(field string, op FilterOp, value any) *FilterCondition {
+	return &FilterCondition{Op: op, Field: field, Value: value}
+}
+
+// And creates a condition satisfied when every operand is
+func And(operands ...*FilterCondition) *FilterCondition {
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return &FilterCondition{Op: OpAnd, Operands: operands}
+}
+
+// Or creates a condition satisfied when any operand is
+func Or(operands ...*FilterCondition) *FilterCondition {
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return &FilterCondition{Op: OpOr, Operands: operands}
+}
+
+// Not negates a condition
+func Not(operand *FilterCondition) *FilterCondition {
+	return &FilterCondition{Op: OpNot, Operands: []*FilterCondition{operand}}
+}
+
+// NoResources returns a filter authorizing nothing
+func NoResources(resourceType string) *ResourceFilter {
+	return &ResourceFilter{ResourceType: resourceType}
+}
+
+// AllResources returns a filter authorizing every resource of a type
+func AllResources(resourceType string) *ResourceFilter {
+	return &ResourceFilter{ResourceType: resourceType, All: true}
+}
+
+// ResourceIDs returns a filter authorizing resources by ID
+func ResourceIDs(resourceType string, ids ...string) *ResourceFilter {
+	return &ResourceFilter{ResourceType: resourceType, IDs: ids}
+}
+
+// Empty reports whether the filter authorizes nothing
+func (f *ResourceFilter) Empty() bool {
+	return f == nil || (!f.All && len(f.IDs) == 0 && f.Condition == nil)
+}
+
+// Allows reports whether a resource passes the filter
+func (f *ResourceFilter) Allows(resource *Resource) bool {
+	if f.Empty() || resource == nil {
+		return false
+	}
+	if f.All || slices.Contains(f.IDs, resource.ID) {
+		return true
+	}
+	if f.Condition == nil {
+		return false
+	}
+
+	attributes := make(map[string]any, len(resource.Attributes)+1)
+	for k, v := range resource.Attributes {
+		attributes[k] = v
+	}
+	attributes["id"] = resource.ID
+	return f.Condition.Matches(attributes)
+}
+
+// Union combines filters of the same resource type: a resource is authorized
+// when any filter authorizes it
+func Union(resourceType string, filters ...*ResourceFilter) *ResourceFilter {
+	result := NoResources(resourceType)
+	seen := make(map[string]bool)
+	conditions := make([]*FilterCondition, 0)
+
+	for _, f := range filters {
+		if f.Empty() {
+			continue
+		}
+		if f.All {
+			return AllResources(resourceType)
+		}
+		for _, id := range f.IDs {
+			if !seen[id] {
+				seen[id] = true
+				result.IDs = append(result.IDs, id)
+			}
+		}
+		if f.Condition != nil {
+			conditions = append(conditions, f.Condition)
+		}
+	}
+
+	sort.Strings(result.IDs)
+	if len(conditions) > 0 {
+		result.Condition = Or(conditions...)
+	}
+	return result
+}
+
+// Matches evaluates the condition against resource attributes
+func (c *FilterCondition) Matches(attributes map[string]any) bool {
+	switch c.Op {
+	case OpAnd:
+		for _, operand := range c.Operands {
+			if !operand.Matches(attributes) {
+				return false
+			}
+		}
+		return true
+	case OpOr:
+		for _, operand := range c.Operands {
+			if operand.Matches(attributes) {
+				return true
+			}
+		}
+		return false
+	case OpNot:
+		return len(c.Operands) == 1 && !c.Operands[0].Matches(attributes)
+	}
+
+	actual := attributes[c.Field]
+	switch c.Op {
+	case OpEq:
+		return actual == c.Value
+	case OpNe:
+		return actual != c.Value
+	case OpIn, OpNotIn:
+		values, _ := c.Value.([]any)
+		return slices.Contains(values, actual) == (c.Op == OpIn)
+	case OpGt, OpLt:
+		a, ok1 := toFloat64(actual)
+		b, ok2 := toFloat64(c.Value)
+		if !ok1 || !ok2 {
+			return false
+		}
+		if c.Op == OpGt {
+			return a > b
+		}
+		return a < b
+	case OpContains:
+		s, ok1 := actual.(string)
+		sub, ok2 := c.Value.(string)
+		return ok1 && ok2 && strings.Contains(s, sub)
+	}
+	return false
+}
+
+// SQLOptions configures the translation of a filter to SQL
+type SQLOptions struct {
+	// IDColumn is the column of the resource ID (default: "id")
+	IDColumn string
+
+	// Columns maps resource attributes to columns. Attributes without a
+	// mapping are used as column names when they are plain identifiers.
+	Columns map[string]string
+
+	// Placeholder formats the nth (1-based) argument placeholder
+	// (default: PostgreSQL "$n")
+	Placeholder func(n int) string
+
+	// ArgOffset is the number of arguments already in the query, so
+	// placeholders continue after them
+	ArgOffset int
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ToSQL translates the filter to a WHERE fragment with its arguments, e.g.,
+// `(id IN ($1, $2) OR department = $3)`. An empty filter is "1 = 0". SQL
+// NULL semantics apply: a row with a NULL column fails both a comparison
+// and its negation.
+func (f *ResourceFilter) ToSQL(options SQLOptions) (string, []any, error) {
+	if options.IDColumn == "" {
+		options.IDColumn = "id"
+	}
+	if options.Placeholder == nil {
+		options.Placeholder = func(n int) string { return fmt.Sprintf("$%d", n) }
+	}
+	w := &sqlWriter{options: options}
+
+	switch {
+	case f.Empty():
+		return "1 = 0", nil, nil
+	case f.All:
+		return "1 = 1", nil, nil
+	}
+
+	parts := make([]string, 0, 2)
+	if len(f.IDs) > 0 {
+		ids := make([]any, len(f.IDs))
+		for i, id := range f.IDs {
+			ids[i] = id
+		}
+		parts = append(parts, w.in(options.IDColumn, ids, false))
+	}
+	if f.Condition != nil {
+		sql, err := w.condition(f.Condition)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+	}
+
+	if len(parts) == 1 {
+		return parts[0], w.args, nil
+	}
+	return "(" + strings.Join(parts, " OR ") + ")", w.args, nil
+}
+
+// sqlWriter accumulates the arguments of a SQL fragment
+type sqlWriter struct {
+	options SQLOptions
+	args    []any
+}
+
+func (w *sqlWriter) arg(value any) string {
+	w.args = append(w.args, value)
+	return w.options.Placeholder(w.options.ArgOffset + len(w.args))
+}
+
+func (w *sqlWriter) column(field string) (string, error) {
+	if field == "id" {
+		return w.options.IDColumn, nil
+	}
+	if column, ok := w.options.Columns[field]; ok {
+		return column, nil
+	}
+	if identifierPattern.MatchString(field) {
+		return field, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnmappedField, field)
+}
+
+func (w *sqlWriter) in(column string, values []any, negate bool) string {
+	if len(values) == 0 {
+		if negate {
+			return "1 = 1"
+		}
+		return "1 = 0"
+	}
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = w.arg(value)
+	}
+	op := "IN"
+	if negate {
+		op = "NOT IN"
+	}
+	return fmt.Sprintf("%s %s (%s)", column, op, strings.Join(placeholders, ", "))
+}
+
+func (w *sqlWriter) condition(c *FilterCondition) (string, error) {
+	switch c.Op {
+	case OpAnd, OpOr:
+		parts := make([]string, len(c.Operands))
+		for i, operand := range c.Operands {
+			sql, err := w.condition(operand)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = sql
+		}
+		return "(" + strings.Join(parts, " "+strings.ToUpper(string(c.Op))+" ") + ")", nil
+	case OpNot:
+		if len(c.Operands) != 1 {
+			return "", fmt.Errorf("%w: not expects one operand", ErrFilterNotSupported)
+		}
+		sql, err := w.condition(c.Operands[0])
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + sql + ")", nil
+	}
+
+	column, err := w.column(c.Field)
+	if err != nil {
+		return "", err
+	}
+
+	switch c.Op {
+	case OpEq:
+		if c.Value == nil {
+			return column + " IS NULL", nil
+		}
+		return column + " = " + w.arg(c.Value), nil
+	case OpNe:
+		if c.Value == nil {
+			return column + " IS NOT NULL", nil
+		}
+		return column + " <> " + w.arg(c.Value), nil
+	case OpIn, OpNotIn:
+		values, ok := c.Value.([]any)
+		if !ok {
+			return "", fmt.Errorf("%w: %s requires a slice value", ErrFilterNotSupported, c.Op)
+		}
+		return w.in(column, values, c.Op == OpNotIn), nil
+	case OpGt:
+		return column + " > " + w.arg(c.Value), nil
+	case OpLt:
+		return column + " < " + w.arg(c.Value), nil
+	case OpContains:
+		s, ok := c.Value.(string)
+		if !ok {
+			return "", fmt.Errorf("%w: contains requires a string value", ErrFilterNotSupported)
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+		return column + " LIKE " + w.arg("%"+escaped+"%") + ` ESCAPE '\'`, nil
+	}
+	return "", fmt.Errorf("%w: operator %s", ErrFilterNotSupported, c.Op)
+}
+
+// toFloat64 converts a numeric value to float64
+func toFloat64(v any) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	}
+	return 0, false
+}
@@ -0,0 +1,214 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph node kinds
+const (
+	NodeKindUser       = "user"
+	NodeKindRole       = "role"
+	NodeKindPermission = "permission"
+	NodeKindPolicy     = "policy"
+	NodeKindResource   = "resource"
+)
+
+// GraphNode is a node in the access model graph
+type GraphNode struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+}
+
+// GraphEdge is a directed relationship between two nodes
+type GraphEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+}
+
+// AccessGraph is the effective access model as a directed graph
+// (users → roles → permissions, policies → resources, ACL grants)
+type AccessGraph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+
+	nodeIndex map[string]*GraphNode
+	edgeIndex map[string]bool
+}
+
+// NewAccessGraph creates an empty access graph
+func NewAccessGraph() *AccessGraph {
+	return &AccessGraph{
+		Nodes:     make([]*GraphNode, 0),
+		Edges:     make([]*GraphEdge, 0),
+		nodeIndex: make(map[string]*GraphNode),
+		edgeIndex: make(map[string]bool),
+	}
+}
+
+// NodeID builds a graph node ID from a kind and a name
+func NodeID(kind, name string) string {
+	return kind + ":" + name
+}
+
+// AddNode adds a node (if not present) and returns its ID
+func (g *AccessGraph) AddNode(kind, name string) string {
+	id := NodeID(kind, name)
+	if _, exists := g.nodeIndex[id]; !exists {
+		node := &GraphNode{ID: id, Kind: kind, Label: name}
+		g.nodeIndex[id] = node
+		g.Nodes = append(g.Nodes, node)
+	}
+	return id
+}
+
+// AddEdge adds a directed edge (duplicates are ignored)
+func (g *AccessGraph) AddEdge(from, to, relation string) {
+	key := from + "\x00" + to + "\x00" + relation
+	if g.edgeIndex[key] {
+		return
+	}
+	g.edgeIndex[key] = true
+	g.Edges = append(g.Edges, &GraphEdge{From: from, To: to, Relation: relation})
+}
+
+// ToJSON renders the graph as JSON
+func (g *AccessGraph) ToJSON() ([]byte, error) {
+	g.sort()
+	return json.MarshalIndent(g, "", "  ")
+}
+
+// ToDOT renders the graph in Graphviz DOT format
+func (g *AccessGraph) ToDOT() string {
+	g.sort()
+
+	var b strings.Builder
+	b.WriteString("digraph access_model {\n")
+	b.WriteString("  rankdir=LR;\n")
+
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  %q [label=%q, shape=%s];\n", node.ID, node.Label, dotShape(node.Kind))
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", edge.From, edge.To, edge.Relation)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// sort orders nodes and edges for deterministic output
+func (g *AccessGraph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		if g.Edges[i].To != g.Edges[j].To {
+			return g.Edges[i].To < g.Edges[j].To
+		}
+		return g.Edges[i].Relation < g.Edges[j].Relation
+	})
+}
+
+// dotShape returns the DOT node shape for a node kind
+func dotShape(kind string) string {
+	switch kind {
+	case NodeKindUser:
+		return "ellipse"
+	case NodeKindRole:
+		return "box"
+	case NodeKindPermission:
+		return "note"
+	case NodeKindPolicy:
+		return "hexagon"
+	case NodeKindResource:
+		return "folder"
+	default:
+		return "plaintext"
+	}
+}
+
+// GraphContributor contributes nodes and edges to an access graph
+type GraphContributor interface {
+	// ContributeGraph adds the contributor's part of the access model to the graph
+	ContributeGraph(ctx context.Context, graph *AccessGraph) error
+}
+
+// ExportGraph builds the effective access model graph from the given contributors
+// (e.g., RBAC evaluator, role assignments, policy store, ACL manager)
+func ExportGraph(ctx context.Context, contributors ...GraphContributor) (*AccessGraph, error) {
+	graph := NewAccessGraph()
+
+	for i, contributor := range contributors {
+		if contributor == nil {
+			continue
+		}
+		if err := contributor.ContributeGraph(ctx, graph); err != nil {
+			return nil, fmt.Errorf("graph contributor %d failed: %w", i, err)
+		}
+	}
+
+	return graph, nil
+}
+
+// RoleAssignments maps user IDs to role names and contributes user → role edges
+type RoleAssignments map[string][]string
+
+// ContributeGraph adds user → role edges
+func (r RoleAssignments) ContributeGraph(ctx context.Context, graph *AccessGraph) error {
+	for userID, roles := range r {
+		userNode := graph.AddNode(NodeKindUser, userID)
+		for _, role := range roles {
+			graph.AddEdge(userNode, graph.AddNode(NodeKindRole, role), "has_role")
+		}
+	}
+	return nil
+}
+
+// PolicyGraph contributes policy → subject/resource edges from a PolicyStore
+type PolicyGraph struct {
+	Store PolicyStore
+}
+
+// ContributeGraph adds policy nodes with their subjects and resources
+func (p *PolicyGraph) ContributeGraph(ctx context.Context, graph *AccessGraph) error {
+	policies, err := p.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		policyNode := graph.AddNode(NodeKindPolicy, policy.ID)
+
+		actions := make([]string, 0, len(policy.Actions))
+		for _, action := range policy.Actions {
+			actions = append(actions, string(action))
+		}
+		relation := fmt.Sprintf("%s [%s]", strings.ToLower(policy.Effect), strings.Join(actions, ","))
+
+		for _, sub := range policy.Subjects {
+			var subNode string
+			if role, ok := strings.CutPrefix(sub, "role:"); ok {
+				subNode = graph.AddNode(NodeKindRole, role)
+			} else {
+				subNode = graph.AddNode(NodeKindUser, sub)
+			}
+			graph.AddEdge(subNode, policyNode, "subject_of")
+		}
+
+		for _, res := range policy.Resources {
+			graph.AddEdge(policyNode, graph.AddNode(NodeKindResource, res), relation)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrObligationUnfulfilled = autherrors.New(autherrors.ErrPermissionDenied, "obligation cannot be fulfilled")
+	ErrRecentAuthRequired    = autherrors.New(autherrors.ErrReauthenticationNeeded, "recent authentication required")
+)
+
+// Obligation types fulfilled by the authorization middleware
+const (
+	// ObligationMaskFields masks fields of the response. Params: "fields"
+	// (field names, matched at any depth, or dotted paths from the root)
+	// and "replacement" (default: "***").
+	ObligationMaskFields = "mask_fields"
+
+	// ObligationRequireRecentAuth requires the session to have been
+	// authenticated recently, or with specific methods (step-up). Params:
+	// "max_age" (seconds or a duration string such as "5m") and "methods"
+	// (authentication methods such as "otp", or classes such as "aal2", any
+	// of which satisfies the obligation).
+	ObligationRequireRecentAuth = "require_recent_auth"
+
+	// ObligationAudit records an audit entry for the access. Params:
+	// "detail" (extra audit metadata).
+	ObligationAudit = "audit"
+)
+
+// Obligation is a duty attached to a decision. The enforcement point must
+// fulfil the obligations of a decision and refuse access when it cannot;
+// advice (AuthorizationDecision.Advice) is optional and may be ignored.
+type Obligation struct {
+	Type   string         `json:"type"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// MaskFields is an obligation to mask fields of the response
+func MaskFields(fields ...string) Obligation {
+	return Obligation{Type: ObligationMaskFields, Params: map[string]any{"fields": fields}}
+}
+
+// RequireRecentAuth is an obligation to require authentication within
+// maxAge (0 for any time), with one of the methods when given
+func RequireRecentAuth(maxAge time.Duration, methods ...string) Obligation {
+	params := map[string]any{"max_age": maxAge.Seconds()}
+	if len(methods) > 0 {
+		params["methods"] = methods
+	}
+	return Obligation{Type: ObligationRequireRecentAuth, Params: params}
+}
+
+// AuditDetail is an obligation to audit the access with extra detail
+func AuditDetail(detail map[string]any) Obligation {
+	return Obligation{Type: ObligationAudit, Params: map[string]any{"detail": detail}}
+}
+
+// String returns the obligation parameter key as a string
+func (o Obligation) String(key string) string {
+	s, _ := o.Params[key].(string)
+	return s
+}
+
+// Strings returns the obligation parameter key as a list of strings
+func (o Obligation) Strings(key string) []string {
+	switch v := o.Params[key].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Duration returns the obligation parameter key as a duration: seconds, or
+// a duration string ("5m")
+func (o Obligation) Duration(key string) (time.Duration, error) {
+	switch v := o.Params[key].(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(v)
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case json.Number:
+		seconds, err := v.Float64()
+		return time.Duration(seconds * float64(time.Second)), err
+	case nil:
+		return 0, fmt.Errorf("obligation %s: missing %s", o.Type, key)
+	}
+	return 0, fmt.Errorf("obligation %s: %s is %T, not a duration", o.Type, key, o.Params[key])
+}
+
+// ParseObligations converts a decoded JSON list of obligations: type names
+// ("log_access") or objects ({"type": "mask_fields", "params": {...}})
+func ParseObligations(value any) ([]Obligation, error) {
+	list, ok := value.([]any)
+	if !ok {
+		if names, ok := value.([]string); ok {
+			obligations := make([]Obligation, 0, len(names))
+			for _, name := range names {
+				obligations = append(obligations, Obligation{Type: name})
+			}
+			return obligations, nil
+		}
+		return nil, fmt.Errorf("%T is not an array", value)
+	}
+
+	obligations := make([]Obligation, 0, len(list))
+	for _, item := range list {
+		switch v := item.(type) {
+		case string:
+			obligations = append(obligations, Obligation{Type: v})
+		case map[string]any:
+			typ, _ := v["type"].(string)
+			if typ == "" {
+				return nil, fmt.Errorf("obligation has no type")
+			}
+			params, _ := v["params"].(map[string]any)
+			obligations = append(obligations, Obligation{Type: typ, Params: params})
+		default:
+			return nil, fmt.Errorf("%T is not an obligation", item)
+		}
+	}
+	return obligations, nil
+}
+
+// HasObligation reports whether the decision carries an obligation of a type
+func (d *AuthorizationDecision) HasObligation(obligationType string) bool {
+	for _, obligation := range d.Obligations {
+		if obligation.Type == obligationType {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyMask masks fields of JSON-serializable data, returning the masked
+// data as decoded JSON. A field name matches at any depth; a dotted path
+// ("employee.salary") matches from the root, through arrays.
+func ApplyMask(data any, fields []string, replacement any) (any, error) {
+	if len(fields) == 0 {
+		return data, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mask fields: %w", err)
+	}
+	var decoded any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to mask fields: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for _, field := range fields {
+		if path := strings.Split(field, "."); len(path) > 1 {
+			maskPath(decoded, path, replacement)
+		} else {
+			names[field] = true
+		}
+	}
+	if len(names) > 0 {
+		maskNames(decoded, names, replacement)
+	}
+	return decoded, nil
+}
+
+// maskNames masks the keys named in names at any depth
+func maskNames(value any, names map[string]bool, replacement any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if names[key] {
+				v[key] = replacement
+				continue
+			}
+			maskNames(item, names, replacement)
+		}
+	case []any:
+		for _, item := range v {
+			maskNames(item, names, replacement)
+		}
+	}
+}
+
+// maskPath masks the key at path
+func maskPath(value any, path []string, replacement any) {
+	switch v := value.(type) {
+	case map[string]any:
+		item, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			v[path[0]] = replacement
+			return
+		}
+		maskPath(item, path[1:], replacement)
+	case []any:
+		for _, item := range v {
+			maskPath(item, path, replacement)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+var (
+	ErrInvalidDecision = errors.New("invalid OPA decision")
+)
+
+// Engine evaluates a Rego decision for an input document and returns the
+// decision (the value of the queried rule; nil when it is undefined)
+type Engine interface {
+	Eval(ctx context.Context, input map[string]any) (any, error)
+}
+
+// EngineFunc adapts a function to Engine, e.g., to embed a prepared query of
+// github.com/open-policy-agent/opa/v1/rego:
+//
+//	query, _ := rego.New(rego.Query("data.authz.decision"), rego.Load(paths, nil)).PrepareForEval(ctx)
+//	engine := opa.EngineFunc(func(ctx context.Context, input map[string]any) (any, error) {
+//		rs, err := query.Eval(ctx, rego.EvalInput(input))
+//		if err != nil || len(rs) == 0 {
+//			return nil, err
+//		}
+//		return rs[0].Expressions[0].Value, nil
+//	})
+type EngineFunc func(ctx context.Context, input map[string]any) (any, error)
+
+// Eval calls f
+func (f EngineFunc) Eval(ctx context.Context, input map[string]any) (any, error) {
+	return f(ctx, input)
+}
+
+// Config holds OPA evaluator configuration
+type Config struct {
+	// Engine evaluates decisions: an embedded Rego query (EngineFunc) or a
+	// remote OPA (NewRemoteEngine) (required)
+	Engine Engine
+
+	// Input maps a request into the OPA input document (default: BuildInput)
+	Input func(ctx context.Context, request *authz.AuthorizationRequest) map[string]any
+
+	// DefaultDecision is used when the decision is undefined (default: deny)
+	DefaultDecision bool
+}
+
+// Evaluator is a PolicyEvaluator that delegates decisions to Open Policy
+// Agent. The decision may be a bool (allow) or an object:
+//
+//	{"allow": true, "reason": "...", "obligations": ["log_access"], "advice": [...], ...}
+//
+// Obligations and advice are type names or {"type": ..., "params": {...}}
+// objects (see authz.ParseObligations).
+// Other fields of the object are returned as decision metadata.
+type Evaluator struct {
+	config *Config
+}
+
+// NewEvaluator creates a new OPA evaluator
+func NewEvaluator(config *Config) *Evaluator {
+	if config.Input == nil {
+		config.Input = BuildInput
+	}
+	return &Evaluator{config: config}
+}
+
+// Evaluate evaluates the OPA decision for an authorization request
+func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
+	input := e.config.Input(ctx, request)
+	result, err := e.config.Engine.Eval(ctx, input)
+	if err != nil {
+		authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "opa", Kind: "query", Result: authz.TraceError, Detail: err.Error()})
+		return nil, fmt.Errorf("opa evaluation failed: %w", err)
+	}
+	if authz.Explaining(ctx) {
+		authz.RecordTrace(ctx, authz.TraceStep{
+			Evaluator: "opa",
+			Kind:      "query",
+			Result:    authz.MatchResult(result != nil),
+			Detail:    fmt.Sprintf("input %v returned %v", input, result),
+		})
+	}
+	return e.decision(result)
+}
+
+// decision maps an OPA result to an authorization decision
+func (e *Evaluator) decision(result any) (*authz.AuthorizationDecision, error) {
+	switch value := result.(type) {
+	case nil:
+		return &authz.AuthorizationDecision{
+			Allowed: e.config.DefaultDecision,
+			Reason:  "OPA decision undefined, using default decision",
+		}, nil
+
+	case bool:
+		reason := "denied by OPA policy"
+		if value {
+			reason = "allowed by OPA policy"
+		}
+		return &authz.AuthorizationDecision{Allowed: value, Reason: reason}, nil
+
+	case map[string]any:
+		return objectDecision(value)
+	}
+
+	return nil, fmt.Errorf("%w: %T is neither a bool nor an object", ErrInvalidDecision, result)
+}
+
+// objectDecision maps an OPA decision object
+func objectDecision(object map[string]any) (*authz.AuthorizationDecision, error) {
+	fields := maps.Clone(object)
+	decision := &authz.AuthorizationDecision{Metadata: make(map[string]any)}
+
+	allow, ok := fields["allow"]
+	if !ok {
+		allow, ok = fields["allowed"]
+	}
+	delete(fields, "allow")
+	delete(fields, "allowed")
+	if !ok {
+		return nil, fmt.Errorf("%w: object has no allow field", ErrInvalidDecision)
+	}
+	if decision.Allowed, ok = allow.(bool); !ok {
+		return nil, fmt.Errorf("%w: allow is %T, not a bool", ErrInvalidDecision, allow)
+	}
+
+	if reason, ok := fields["reason"].(string); ok {
+		decision.Reason = reason
+		delete(fields, "reason")
+	} else if decision.Allowed {
+		decision.Reason = "allowed by OPA policy"
+	} else {
+		decision.Reason = "denied by OPA policy"
+	}
+
+	if obligations, ok := fields["obligations"]; ok {
+		list, err := authz.ParseObligations(obligations)
+		if err != nil {
+			return nil, fmt.Errorf("%w: obligations: %v", ErrInvalidDecision, err)
+		}
+		decision.Obligations = list
+		delete(fields, "obligations")
+	}
+	if advice, ok := fields["advice"]; ok {
+		list, err := authz.ParseObligations(advice)
+		if err != nil {
+			return nil, fmt.Errorf("%w: advice: %v", ErrInvalidDecision, err)
+		}
+		decision.Advice = list
+		delete(fields, "advice")
+	}
+
+	if metadata, ok := fields["metadata"].(map[string]any); ok {
+		maps.Copy(decision.Metadata, metadata)
+		delete(fields, "metadata")
+	}
+	maps.Copy(decision.Metadata, fields)
+	return decision, nil
+}
+
+// BuildInput maps an authorization request into the OPA input document:
+//
+//	{
+//	  "subject":     {"id", "type", "principal", "roles", "permissions", "groups", "attributes"},
+//	  "resource":    {"type", "id", "attributes"},
+//	  "action":      "read",
+//	  "context":     {...request context},
+//	  "environment": {...session attributes},
+//	  "tenant_id":   "acme",
+//	  "app_id":      "portal"
+//	}
+func BuildInput(ctx context.Context, request *authz.AuthorizationRequest) map[string]any {
+	input := map[string]any{
+		"action":      string(request.Action),
+		"context":     orEmpty(request.Context),
+		"environment": map[string]any{},
+		"tenant_id":   authz.TenantFromContext(ctx),
+		"app_id":      authz.AppFromContext(ctx),
+	}
+
+	sub := map[string]any{
+		"roles":       []string{},
+		"permissions": []string{},
+		"groups":      []string{},
+		"attributes":  map[string]any{},
+	}
+	if identity := request.Subject; identity != nil {
+		if identity.Subject != nil {
+			sub["id"] = identity.Subject.ID
+			sub["type"] = identity.Subject.Type
+			sub["principal"] = identity.Subject.Principal
+			sub["attributes"] = orEmpty(identity.Subject.Attributes)
+		}
+		sub["roles"] = orEmptySlice(identity.Roles)
+		sub["permissions"] = orEmptySlice(identity.Permissions)
+		sub["groups"] = orEmptySlice(identity.Groups)
+		if identity.Session != nil {
+			input["environment"] = identity.Session.EnvironmentAttributes()
+		}
+	}
+	input["subject"] = sub
+
+	if request.Resource != nil {
+		input["resource"] = map[string]any{
+			"type":       request.Resource.Type,
+			"id":         request.Resource.ID,
+			"attributes": orEmpty(request.Resource.Attributes),
+		}
+	}
+	return input
+}
+
+// HasPermission checks if the subject has a specific permission
+func (e *Evaluator) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	return identity.HasPermission(permission), nil
+}
+
+// HasAnyPermission checks if the subject has any of the specified permissions
+func (e *Evaluator) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, perm := range permissions {
+		if identity.HasPermission(perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasAllPermissions checks if the subject has all of the specified permissions
+func (e *Evaluator) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, perm := range permissions {
+		if !identity.HasPermission(perm) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HasRole checks if the subject has a specific role
+func (e *Evaluator) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return identity.HasRole(role), nil
+}
+
+// HasAnyRole checks if the subject has any of the specified roles
+func (e *Evaluator) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return identity.HasAnyRole(roles...), nil
+}
+
+// HasAllRoles checks if the subject has all of the specified roles
+func (e *Evaluator) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return identity.HasAllRoles(roles...), nil
+}
+
+func orEmpty(m map[string]any) map[string]any {
+	if m == nil {
+		return map[string]any{}
+	}
+	return m
+}
+
+func orEmptySlice(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
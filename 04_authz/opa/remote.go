@@ -0,0 +1,84 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RemoteConfig holds configuration for a remote OPA (e.g., a sidecar)
+type RemoteConfig struct {
+	// Address is the OPA server address (default: "http://localhost:8181")
+	Address string
+
+	// Path is the decision path under /v1/data, e.g., "authz/decision"
+	// (required)
+	Path string
+
+	// Token is sent as a bearer token when OPA requires authentication
+	// (optional)
+	Token string
+
+	// HTTPClient is the HTTP client (default: 2 second timeout)
+	HTTPClient *http.Client
+}
+
+// RemoteEngine evaluates decisions with the OPA REST Data API
+// (POST /v1/data/<path>)
+type RemoteEngine struct {
+	config *RemoteConfig
+	url    string
+}
+
+// NewRemoteEngine creates a new remote OPA engine
+func NewRemoteEngine(config *RemoteConfig) *RemoteEngine {
+	if config.Address == "" {
+		config.Address = "http://localhost:8181"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+	}
+	return &RemoteEngine{
+		config: config,
+		url:    strings.TrimRight(config.Address, "/") + "/v1/data/" + strings.Trim(config.Path, "/"),
+	}
+}
+
+// Eval posts the input to OPA and returns the decision (nil if undefined)
+func (r *RemoteEngine) Eval(ctx context.Context, input map[string]any) (any, error) {
+	body, err := json.Marshal(map[string]any{"input": input})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.Token)
+	}
+
+	resp, err := r.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("opa returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result any `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Result, nil
+}
@@ -0,0 +1,236 @@
+package authz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrInvalidPermission = autherrors.New(autherrors.ErrInvalidRequest, "invalid permission")
+)
+
+// PermissionStyle is the segment order of a permission string
+type PermissionStyle string
+
+const (
+	// StyleResourceAction orders permissions as "resource:action" (e.g., "document:read")
+	StyleResourceAction PermissionStyle = "resource:action"
+
+	// StyleActionResource orders permissions as "action:resource" (e.g., "read:document")
+	StyleActionResource PermissionStyle = "action:resource"
+)
+
+// DefaultKnownActions are the actions used to detect the orientation of a permission
+var DefaultKnownActions = []string{
+	"read", "write", "create", "update", "delete", "list",
+	"manage", "execute", "approve", "publish", "admin",
+}
+
+// PermissionSyntax describes the permission naming convention of an
+// application and normalizes permissions to it.
+//
+// Permissions have two segments ("resource:action") or three when scoped to
+// a resource ID ("resource:id:action"). "*" is accepted as a full wildcard
+// and as any segment.
+type PermissionSyntax struct {
+	// Style is the canonical segment order (default: StyleResourceAction)
+	Style PermissionStyle
+
+	// Separator separates segments (default: ":")
+	Separator string
+
+	// CaseSensitive keeps segment case (default: lowercased)
+	CaseSensitive bool
+
+	// KnownActions are used to detect permissions written in the other
+	// orientation (default: DefaultKnownActions)
+	KnownActions []string
+}
+
+// DefaultPermissionSyntax returns the "resource:action" syntax
+func DefaultPermissionSyntax() *PermissionSyntax {
+	return &PermissionSyntax{
+		Style:        StyleResourceAction,
+		Separator:    ":",
+		KnownActions: DefaultKnownActions,
+	}
+}
+
+// Validate checks that a permission is well-formed and in canonical order
+func (s *PermissionSyntax) Validate(permission string) error {
+	normalized, err := s.Normalize(permission)
+	if err != nil {
+		return err
+	}
+
+	if normalized != permission {
+		return fmt.Errorf("%w: %q should be written as %q", ErrInvalidPermission, permission, normalized)
+	}
+
+	return nil
+}
+
+// Normalize converts a permission to the canonical form: trimmed, lowercased
+// (unless CaseSensitive), and reordered when written in the other orientation.
+// A nil syntax returns the permission unchanged.
+func (s *PermissionSyntax) Normalize(permission string) (string, error) {
+	if s == nil {
+		return permission, nil
+	}
+
+	permission = strings.TrimSpace(permission)
+	if permission == "*" {
+		return permission, nil
+	}
+
+	sep := s.separator()
+	parts := strings.Split(permission, sep)
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("%w: %q must have 2 or 3 segments separated by %q", ErrInvalidPermission, permission, sep)
+	}
+
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return "", fmt.Errorf("%w: %q has an empty segment", ErrInvalidPermission, permission)
+		}
+		if strings.ContainsAny(part, " \t") {
+			return "", fmt.Errorf("%w: %q contains whitespace", ErrInvalidPermission, permission)
+		}
+		if !s.CaseSensitive {
+			part = strings.ToLower(part)
+		}
+		parts[i] = part
+	}
+
+	// Detect orientation from the action segment
+	first, last := parts[0], parts[len(parts)-1]
+	actionFirst := s.isAction(first) && !s.isAction(last)
+	actionLast := s.isAction(last) && !s.isAction(first)
+
+	switch s.style() {
+	case StyleResourceAction:
+		if actionFirst {
+			parts[0], parts[len(parts)-1] = last, first
+		}
+	case StyleActionResource:
+		if actionLast {
+			parts[0], parts[len(parts)-1] = last, first
+		}
+	}
+
+	return strings.Join(parts, sep), nil
+}
+
+// Canonical normalizes a permission, returning it unchanged when it is invalid
+func (s *PermissionSyntax) Canonical(permission string) string {
+	normalized, err := s.Normalize(permission)
+	if err != nil {
+		return permission
+	}
+	return normalized
+}
+
+// NormalizeAll normalizes a list of permissions, removing duplicates
+func (s *PermissionSyntax) NormalizeAll(permissions []string) ([]string, error) {
+	result := make([]string, 0, len(permissions))
+	seen := make(map[string]bool, len(permissions))
+
+	for _, permission := range permissions {
+		normalized, err := s.Normalize(permission)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			result = append(result, normalized)
+		}
+	}
+
+	return result, nil
+}
+
+// PermissionChange records a permission rewritten by a migration
+type PermissionChange struct {
+	Owner string // Role (or other owner) the permission belongs to
+	From  string
+	To    string
+}
+
+// MigrationReport summarizes a permission migration
+type MigrationReport struct {
+	Changes []PermissionChange
+	Invalid []PermissionChange // To is empty; From could not be normalized
+}
+
+// MigratePermissions converts an owner → permissions map (e.g., role
+// permissions) to the canonical syntax. The input is not modified.
+// Invalid permissions are kept as-is and listed in the report.
+func (s *PermissionSyntax) MigratePermissions(permissions map[string][]string) (map[string][]string, *MigrationReport) {
+	result := make(map[string][]string, len(permissions))
+	report := &MigrationReport{}
+
+	owners := make([]string, 0, len(permissions))
+	for owner := range permissions {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	for _, owner := range owners {
+		seen := make(map[string]bool)
+		migrated := make([]string, 0, len(permissions[owner]))
+
+		for _, permission := range permissions[owner] {
+			normalized, err := s.Normalize(permission)
+			if err != nil {
+				report.Invalid = append(report.Invalid, PermissionChange{Owner: owner, From: permission})
+				normalized = permission
+			} else if normalized != permission {
+				report.Changes = append(report.Changes, PermissionChange{Owner: owner, From: permission, To: normalized})
+			}
+
+			if !seen[normalized] {
+				seen[normalized] = true
+				migrated = append(migrated, normalized)
+			}
+		}
+
+		result[owner] = migrated
+	}
+
+	return result, report
+}
+
+// isAction checks if a segment is a known action
+func (s *PermissionSyntax) isAction(segment string) bool {
+	actions := s.KnownActions
+	if actions == nil {
+		actions = DefaultKnownActions
+	}
+
+	for _, action := range actions {
+		if strings.EqualFold(action, segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// separator returns the configured separator
+func (s *PermissionSyntax) separator() string {
+	if s.Separator == "" {
+		return ":"
+	}
+	return s.Separator
+}
+
+// style returns the configured style
+func (s *PermissionSyntax) style() PermissionStyle {
+	if s.Style == "" {
+		return StyleResourceAction
+	}
+	return s.Style
+}
@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/abac"
+)
+
+// ConditionEvaluator evaluates the Conditions of a policy that matches a
+// request's subject, resource and action. A policy applies only if its
+// conditions hold.
+type ConditionEvaluator interface {
+	EvaluateConditions(ctx context.Context, policy *authz.Policy, request *authz.AuthorizationRequest) (bool, error)
+}
+
+// ConditionEvaluatorFunc adapts a function to ConditionEvaluator
+type ConditionEvaluatorFunc func(ctx context.Context, policy *authz.Policy, request *authz.AuthorizationRequest) (bool, error)
+
+// EvaluateConditions calls f
+func (f ConditionEvaluatorFunc) EvaluateConditions(ctx context.Context, policy *authz.Policy, request *authz.AuthorizationRequest) (bool, error) {
+	return f(ctx, policy, request)
+}
+
+// AttributeConditions is the default ConditionEvaluator: every condition is
+// a key whose value is compared with the value in the request context or, if
+// absent there, in the resource attributes. A condition value is either
+// expected to be equal, or an operator object {"operator": "gt", "value": 18}
+// using the operators of abac.Compare.
+var AttributeConditions ConditionEvaluator = ConditionEvaluatorFunc(
+	func(ctx context.Context, policy *authz.Policy, request *authz.AuthorizationRequest) (bool, error) {
+		return matchConditions(policy.Conditions, request)
+	},
+)
+
+// MatchAttributes reports whether every condition holds for the value in the
+// request context or, if absent there, in the resource attributes. A
+// malformed operator condition does not hold.
+func MatchAttributes(conditions map[string]any, request *authz.AuthorizationRequest) bool {
+	matches, err := matchConditions(conditions, request)
+	return err == nil && matches
+}
+
+// matchConditions reports whether every condition holds
+func matchConditions(conditions map[string]any, request *authz.AuthorizationRequest) (bool, error) {
+	for key, expectedValue := range conditions {
+		actualValue, ok := request.Context[key]
+		if !ok && request.Resource != nil {
+			actualValue, ok = request.Resource.Attributes[key]
+		}
+
+		operator, operand, isOperator := operatorCondition(expectedValue)
+		if !isOperator {
+			if !ok || actualValue != expectedValue {
+				return false, nil
+			}
+			continue
+		}
+		if !ok {
+			actualValue = nil
+		}
+		matches, err := abac.Compare(actualValue, operator, operand)
+		if err != nil {
+			return false, fmt.Errorf("condition %s: %w", key, err)
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// operatorCondition returns the operator and operand of an operator
+// condition {"operator": ..., "value": ...}
+func operatorCondition(value any) (string, any, bool) {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return "", nil, false
+	}
+	operator, ok := object["operator"].(string)
+	if !ok {
+		return "", nil, false
+	}
+	return operator, object["value"], true
+}
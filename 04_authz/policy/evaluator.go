@@ -3,16 +3,19 @@ package policy
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	subject "github.com/primadi/lokstra-auth/03_subject"
 	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/permission"
 )
 
 // Evaluator is a policy-based authorization evaluator
 type Evaluator struct {
 	store            authz.PolicyStore
 	combineAlgorithm string // "deny-overrides", "allow-overrides", "first-applicable"
+	conditions       ConditionEvaluator
 }
 
 // NewEvaluator creates a new policy evaluator
@@ -24,9 +27,19 @@ func NewEvaluator(store authz.PolicyStore, combineAlgorithm string) *Evaluator {
 	return &Evaluator{
 		store:            store,
 		combineAlgorithm: combineAlgorithm,
+		conditions:       AttributeConditions,
 	}
 }
 
+// SetConditionEvaluator sets how policy Conditions are evaluated (default:
+// AttributeConditions)
+func (e *Evaluator) SetConditionEvaluator(conditions ConditionEvaluator) {
+	if conditions == nil {
+		conditions = AttributeConditions
+	}
+	e.conditions = conditions
+}
+
 // Evaluate evaluates policies for an authorization request
 func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
 	// Find applicable policies
@@ -62,32 +75,64 @@ func (e *Evaluator) findApplicablePolicies(ctx context.Context, request *authz.A
 		return nil, err
 	}
 
-	// Combine and filter applicable policies
-	policyMap := make(map[string]*authz.Policy)
+	// Combine and filter applicable policies; the subject and resource
+	// lookups overlap, so each policy is considered once
+	seen := make(map[string]bool)
+	applicable := make([]*authz.Policy, 0)
 
-	for _, policy := range subjectPolicies {
-		if e.policyApplies(policy, request) {
-			policyMap[policy.ID] = policy
+	for _, policy := range append(subjectPolicies, resourcePolicies...) {
+		if seen[policy.ID] {
+			continue
 		}
-	}
+		seen[policy.ID] = true
 
-	for _, policy := range resourcePolicies {
-		if e.policyApplies(policy, request) {
-			policyMap[policy.ID] = policy
+		if effectOf(policy) == "" {
+			// A policy neither allowing nor denying takes no part in the decision
+			authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "policy", Kind: "policy", ID: policy.ID, Result: authz.TraceSkipped, Detail: fmt.Sprintf("unknown effect '%s'", policy.Effect)})
+			continue
 		}
-	}
 
-	// Convert map to slice
-	applicable := make([]*authz.Policy, 0, len(policyMap))
-	for _, policy := range policyMap {
-		applicable = append(applicable, policy)
+		applies, mismatch, err := e.policyApplies(ctx, policy, request)
+		if authz.Explaining(ctx) {
+			step := authz.TraceStep{Evaluator: "policy", Kind: "policy", ID: policy.ID, Result: authz.MatchResult(applies), Detail: "effect " + policy.Effect}
+			switch {
+			case err != nil:
+				step.Result, step.Detail = authz.TraceError, err.Error()
+			case !applies:
+				step.Detail = mismatch
+			}
+			authz.RecordTrace(ctx, step)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("policy '%s': %w", policy.ID, err)
+		}
+		if applies {
+			applicable = append(applicable, policy)
+		}
 	}
 
+	// Order by ID, so first-applicable and the reported policy IDs do not
+	// depend on the order of the store
+	slices.SortFunc(applicable, func(a, b *authz.Policy) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
 	return applicable, nil
 }
 
-// policyApplies checks if a policy applies to the request
-func (e *Evaluator) policyApplies(policy *authz.Policy, request *authz.AuthorizationRequest) bool {
+// effectOf returns the normalized effect of a policy ("allow", "deny", or ""
+// if the effect is unknown)
+func effectOf(policy *authz.Policy) string {
+	switch effect := strings.ToLower(strings.TrimSpace(policy.Effect)); effect {
+	case "allow", authz.EffectDeny:
+		return effect
+	}
+	return ""
+}
+
+// policyApplies checks if a policy applies to the request, and otherwise
+// which part of it did not match
+func (e *Evaluator) policyApplies(ctx context.Context, policy *authz.Policy, request *authz.AuthorizationRequest) (bool, string, error) {
 	// Check subject
 	subjectMatches := false
 	for _, sub := range policy.Subjects {
@@ -105,7 +150,7 @@ func (e *Evaluator) policyApplies(policy *authz.Policy, request *authz.Authoriza
 	}
 
 	if !subjectMatches {
-		return false
+		return false, "subject does not match", nil
 	}
 
 	// Check resource
@@ -119,169 +164,119 @@ func (e *Evaluator) policyApplies(policy *authz.Policy, request *authz.Authoriza
 	}
 
 	if !resourceMatches {
-		return false
+		return false, "resource does not match", nil
 	}
 
 	// Check action
 	actionMatches := false
 	for _, action := range policy.Actions {
-		if action == "*" || action == request.Action {
+		if permission.Match(string(action), string(request.Action)) {
 			actionMatches = true
 			break
 		}
 	}
 
 	if !actionMatches {
-		return false
+		return false, "action does not match", nil
 	}
 
 	// Check conditions (if any)
 	if len(policy.Conditions) > 0 {
-		return e.evaluateConditions(policy.Conditions, request)
+		matches, err := e.conditions.EvaluateConditions(ctx, policy, request)
+		return matches, "conditions not satisfied", err
 	}
 
-	return true
+	return true, "", nil
 }
 
-// evaluateConditions evaluates policy conditions
-func (e *Evaluator) evaluateConditions(conditions map[string]any, request *authz.AuthorizationRequest) bool {
-	// Simple condition evaluation
-	for key, expectedValue := range conditions {
-		// Check in request context
-		if actualValue, ok := request.Context[key]; ok {
-			if actualValue != expectedValue {
-				return false
-			}
+// combinePolicies combines multiple policy decisions. The decision metadata
+// holds the determining policy ("policy_id"), every applicable policy
+// ("matched_policies") and the applicable policies of each effect
+// ("allow_policies", "deny_policies").
+func (e *Evaluator) combinePolicies(policies []*authz.Policy, _ *authz.AuthorizationRequest) *authz.AuthorizationDecision {
+	var allows, denies []string
+	for _, policy := range policies {
+		if effectOf(policy) == authz.EffectDeny {
+			denies = append(denies, policy.ID)
 		} else {
-			// Check in resource attributes
-			if request.Resource.Attributes != nil {
-				if actualValue, ok := request.Resource.Attributes[key]; ok {
-					if actualValue != expectedValue {
-						return false
-					}
-				} else {
-					return false
-				}
-			} else {
-				return false
-			}
+			allows = append(allows, policy.ID)
 		}
 	}
 
-	return true
-}
-
-// combinePolicies combines multiple policy decisions
-func (e *Evaluator) combinePolicies(policies []*authz.Policy, _ *authz.AuthorizationRequest) *authz.AuthorizationDecision {
+	var decision *authz.AuthorizationDecision
 	switch e.combineAlgorithm {
-	case "deny-overrides":
-		return e.denyOverrides(policies)
 	case "allow-overrides":
-		return e.allowOverrides(policies)
+		decision = e.allowOverrides(allows, denies)
 	case "first-applicable":
-		return e.firstApplicable(policies)
+		decision = e.firstApplicable(policies)
 	default:
-		return e.denyOverrides(policies)
+		decision = e.denyOverrides(allows, denies)
 	}
-}
-
-// denyOverrides: if any policy denies, result is deny
-func (e *Evaluator) denyOverrides(policies []*authz.Policy) *authz.AuthorizationDecision {
-	hasAllow := false
-	var allowPolicy *authz.Policy
 
+	matched := make([]string, 0, len(policies))
 	for _, policy := range policies {
-		if strings.ToLower(policy.Effect) == "deny" {
-			return &authz.AuthorizationDecision{
-				Allowed: false,
-				Reason:  fmt.Sprintf("policy '%s' denies access", policy.ID),
-				Metadata: map[string]any{
-					"policy_id": policy.ID,
-					"algorithm": "deny-overrides",
-				},
-			}
-		}
-		if strings.ToLower(policy.Effect) == "allow" {
-			hasAllow = true
-			allowPolicy = policy
-		}
+		matched = append(matched, policy.ID)
 	}
+	decision.Metadata["matched_policies"] = matched
+	decision.Metadata["allow_policies"] = allows
+	decision.Metadata["deny_policies"] = denies
 
-	if hasAllow {
-		return &authz.AuthorizationDecision{
-			Allowed: true,
-			Reason:  fmt.Sprintf("policy '%s' allows access", allowPolicy.ID),
-			Metadata: map[string]any{
-				"policy_id": allowPolicy.ID,
-				"algorithm": "deny-overrides",
-			},
-		}
-	}
-
-	return &authz.AuthorizationDecision{
-		Allowed: false,
-		Reason:  "no explicit allow policy found",
-	}
-}
-
-// allowOverrides: if any policy allows, result is allow
-func (e *Evaluator) allowOverrides(policies []*authz.Policy) *authz.AuthorizationDecision {
-	hasDeny := false
-	var denyPolicy *authz.Policy
-
+	// The obligations and advice of the policies that agree with the
+	// decision apply (only the determining one under first-applicable)
 	for _, policy := range policies {
-		if strings.ToLower(policy.Effect) == "allow" {
-			return &authz.AuthorizationDecision{
-				Allowed: true,
-				Reason:  fmt.Sprintf("policy '%s' allows access", policy.ID),
-				Metadata: map[string]any{
-					"policy_id": policy.ID,
-					"algorithm": "allow-overrides",
-				},
-			}
+		if (effectOf(policy) == "allow") != decision.Allowed {
+			continue
 		}
-		if strings.ToLower(policy.Effect) == "deny" {
-			hasDeny = true
-			denyPolicy = policy
+		if e.combineAlgorithm == "first-applicable" && policy.ID != decision.Metadata["policy_id"] {
+			continue
 		}
+		decision.Obligations = append(decision.Obligations, policy.Obligations...)
+		decision.Advice = append(decision.Advice, policy.Advice...)
 	}
+	return decision
+}
 
-	if hasDeny {
-		return &authz.AuthorizationDecision{
-			Allowed: false,
-			Reason:  fmt.Sprintf("policy '%s' denies access", denyPolicy.ID),
-			Metadata: map[string]any{
-				"policy_id": denyPolicy.ID,
-				"algorithm": "allow-overrides",
-			},
-		}
+// denyOverrides: if any policy denies, result is deny
+func (e *Evaluator) denyOverrides(allows, denies []string) *authz.AuthorizationDecision {
+	if len(denies) > 0 {
+		return policyDecision(false, denies[0], "deny-overrides",
+			fmt.Sprintf("policy '%s' denies access", denies[0]))
 	}
+	return policyDecision(true, allows[0], "deny-overrides",
+		fmt.Sprintf("policy '%s' allows access", allows[0]))
+}
 
-	return &authz.AuthorizationDecision{
-		Allowed: false,
-		Reason:  "no applicable policies found",
+// allowOverrides: if any policy allows, result is allow
+func (e *Evaluator) allowOverrides(allows, denies []string) *authz.AuthorizationDecision {
+	if len(allows) > 0 {
+		return policyDecision(true, allows[0], "allow-overrides",
+			fmt.Sprintf("policy '%s' allows access", allows[0]))
 	}
+	return policyDecision(false, denies[0], "allow-overrides",
+		fmt.Sprintf("policy '%s' denies access", denies[0]))
 }
 
-// firstApplicable: first policy that applies wins
+// firstApplicable: first policy (in ID order) that applies wins
 func (e *Evaluator) firstApplicable(policies []*authz.Policy) *authz.AuthorizationDecision {
-	if len(policies) == 0 {
-		return &authz.AuthorizationDecision{
-			Allowed: false,
-			Reason:  "no applicable policies found",
-		}
-	}
-
 	policy := policies[0]
-	allowed := strings.ToLower(policy.Effect) == "allow"
+	return policyDecision(effectOf(policy) == "allow", policy.ID, "first-applicable",
+		fmt.Sprintf("first applicable policy '%s' %s access", policy.ID, effectOf(policy)))
+}
 
+// policyDecision builds the decision of a determining policy; a deny is
+// marked as explicit
+func policyDecision(allowed bool, policyID, algorithm, reason string) *authz.AuthorizationDecision {
+	metadata := map[string]any{
+		"policy_id": policyID,
+		"algorithm": algorithm,
+	}
+	if !allowed {
+		metadata["effect"] = authz.EffectDeny
+	}
 	return &authz.AuthorizationDecision{
-		Allowed: allowed,
-		Reason:  fmt.Sprintf("first applicable policy '%s' %s access", policy.ID, policy.Effect),
-		Metadata: map[string]any{
-			"policy_id": policy.ID,
-			"algorithm": "first-applicable",
-		},
+		Allowed:  allowed,
+		Reason:   reason,
+		Metadata: metadata,
 	}
 }
 
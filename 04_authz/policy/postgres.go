@@ -0,0 +1,360 @@
+package policy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/dbpool"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// PostgresStore stores policies in PostgreSQL with their version history
+// (authz.VersionedPolicyStore). Policies are partitioned per tenant (see
+// authz.WithTenant). It works with any database/sql PostgreSQL driver (pgx
+// stdlib, lib/pq).
+type PostgresStore struct {
+	db       *dbpool.Pool
+	table    string
+	versions string
+}
+
+// NewPostgresStore creates a policy store on a table (default:
+// "authz_policies"); versions are kept in "<table>_versions". Call Migrate to
+// create the tables.
+func NewPostgresStore(db *sql.DB, table string) (*PostgresStore, error) {
+	return NewPostgresStoreOnPool(dbpool.New(db, nil), table)
+}
+
+// NewPostgresStoreOnPool creates a policy store whose lookups go to the read
+// replicas of a pool
+func NewPostgresStoreOnPool(db *dbpool.Pool, table string) (*PostgresStore, error) {
+	if table == "" {
+		table = "authz_policies"
+	}
+	if !tableNamePattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %q", table)
+	}
+	return &PostgresStore{db: db, table: table, versions: table + "_versions"}, nil
+}
+
+// Migrate creates the policy and version tables if they do not exist
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	index := strings.ReplaceAll(s.table, ".", "_")
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	id          TEXT NOT NULL,
+	policy      JSONB NOT NULL,
+	version     INTEGER NOT NULL,
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_by  TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (tenant_id, id)
+)`, s.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_subjects_idx ON %s USING GIN ((policy->'Subjects'))`, index, s.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_resources_idx ON %s USING GIN ((policy->'Resources'))`, index, s.table),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	policy_id   TEXT NOT NULL,
+	version     INTEGER NOT NULL,
+	operation   TEXT NOT NULL,
+	policy      JSONB NOT NULL,
+	author      TEXT NOT NULL DEFAULT '',
+	rollback_of INTEGER NOT NULL DEFAULT 0,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, policy_id, version)
+)`, s.versions),
+	}
+
+	for _, statement := range statements {
+		if _, err := s.db.Primary().ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", s.table, err)
+		}
+	}
+	return nil
+}
+
+// Create creates a new policy (version 1)
+func (s *PostgresStore) Create(ctx context.Context, policy *authz.Policy) error {
+	_, err := s.change(ctx, policy.ID, func(ctx context.Context, tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current != nil {
+			return nil, fmt.Errorf("%w: %s", ErrPolicyExists, policy.ID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyCreated, Policy: policy}, nil
+	})
+	return err
+}
+
+// Get retrieves a policy by ID
+func (s *PostgresStore) Get(ctx context.Context, policyID string) (*authz.Policy, error) {
+	var data []byte
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		return db.QueryRowContext(ctx, fmt.Sprintf(`SELECT policy FROM %s WHERE tenant_id = $1 AND id = $2`, s.table),
+			authz.PartitionFromContext(ctx), policyID).Scan(&data)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, policyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodePolicy(data)
+}
+
+// Update updates an existing policy, recording a new version
+func (s *PostgresStore) Update(ctx context.Context, policy *authz.Policy) error {
+	_, err := s.change(ctx, policy.ID, func(ctx context.Context, tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current == nil {
+			return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, policy.ID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyUpdated, Policy: policy}, nil
+	})
+	return err
+}
+
+// Delete deletes a policy; its history is kept
+func (s *PostgresStore) Delete(ctx context.Context, policyID string) error {
+	_, err := s.change(ctx, policyID, func(ctx context.Context, tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current == nil {
+			return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, policyID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyDeleted, Policy: current}, nil
+	})
+	return err
+}
+
+// List lists all policies of the context tenant
+func (s *PostgresStore) List(ctx context.Context) ([]*authz.Policy, error) {
+	return s.query(ctx, `TRUE`)
+}
+
+// FindBySubject finds policies for a subject
+func (s *PostgresStore) FindBySubject(ctx context.Context, subjectID string) ([]*authz.Policy, error) {
+	return s.query(ctx, `(policy->'Subjects' @> jsonb_build_array($2::text) OR policy->'Subjects' @> '["*"]')`, subjectID)
+}
+
+// FindByResource finds policies for a resource
+func (s *PostgresStore) FindByResource(ctx context.Context, resourceType string, resourceID string) ([]*authz.Policy, error) {
+	return s.query(ctx, `(policy->'Resources' @> jsonb_build_array($2::text)
+	OR policy->'Resources' @> jsonb_build_array($3::text) OR policy->'Resources' @> '["*"]')`,
+		fmt.Sprintf("%s:%s", resourceType, resourceID), fmt.Sprintf("%s:*", resourceType))
+}
+
+// ListVersions returns the versions of a policy, oldest first
+func (s *PostgresStore) ListVersions(ctx context.Context, policyID string) ([]*authz.PolicyVersion, error) {
+	var versions []*authz.PolicyVersion
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT version, operation, policy, author, rollback_of, created_at
+	FROM %s WHERE tenant_id = $1 AND policy_id = $2 ORDER BY version`, s.versions),
+			authz.PartitionFromContext(ctx), policyID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		versions = make([]*authz.PolicyVersion, 0)
+		for rows.Next() {
+			version, err := scanVersion(rows, policyID)
+			if err != nil {
+				return err
+			}
+			versions = append(versions, version)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, policyID)
+	}
+	return versions, nil
+}
+
+// GetVersion returns one version of a policy
+func (s *PostgresStore) GetVersion(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	var result *authz.PolicyVersion
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) (err error) {
+		row := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT version, operation, policy, author, rollback_of, created_at
+	FROM %s WHERE tenant_id = $1 AND policy_id = $2 AND version = $3`, s.versions),
+			authz.PartitionFromContext(ctx), policyID, version)
+		result, err = scanVersion(row, policyID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s v%d", authz.ErrVersionNotFound, policyID, version)
+	}
+	return result, err
+}
+
+// Rollback restores the content of a prior version as a new version, in one
+// transaction
+func (s *PostgresStore) Rollback(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	return s.change(ctx, policyID, func(ctx context.Context, tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error) {
+		var data []byte
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT policy FROM %s WHERE tenant_id = $1 AND policy_id = $2 AND version = $3`, s.versions),
+			authz.PartitionFromContext(ctx), policyID, version).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s v%d", authz.ErrVersionNotFound, policyID, version)
+		}
+		if err != nil {
+			return nil, err
+		}
+		policy, err := decodePolicy(data)
+		if err != nil {
+			return nil, err
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyRolledBack, Policy: policy, RollbackOf: version}, nil
+	})
+}
+
+// mutation decides the change of a policy given its current content (nil if
+// absent), as a version draft with Operation, Policy and RollbackOf
+type mutation func(ctx context.Context, tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error)
+
+// change applies a mutation and records its version in one transaction on
+// the primary. The policy row is locked, so concurrent changes are
+// serialized.
+func (s *PostgresStore) change(ctx context.Context, policyID string, mutate mutation) (*authz.PolicyVersion, error) {
+	var version *authz.PolicyVersion
+	err := s.db.Tx(ctx, nil, func(ctx context.Context, tx *sql.Tx) (err error) {
+		version, err = s.changeTx(ctx, tx, policyID, mutate)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// changeTx runs change in a transaction
+func (s *PostgresStore) changeTx(ctx context.Context, tx *sql.Tx, policyID string, mutate mutation) (*authz.PolicyVersion, error) {
+	tenant := authz.PartitionFromContext(ctx)
+
+	var current *authz.Policy
+	var data []byte
+	err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT policy FROM %s WHERE tenant_id = $1 AND id = $2 FOR UPDATE`, s.table),
+		tenant, policyID).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, err
+	default:
+		if current, err = decodePolicy(data); err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := mutate(ctx, tx, current)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(version), 0) + 1 FROM %s WHERE tenant_id = $1 AND policy_id = $2`, s.versions),
+		tenant, policyID).Scan(&version.Version); err != nil {
+		return nil, err
+	}
+	version.PolicyID = policyID
+	version.Author = authz.ActorFromContext(ctx)
+	version.CreatedAt = time.Now()
+
+	data, err = json.Marshal(version.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy: %w", err)
+	}
+
+	if version.Operation == authz.PolicyDeleted {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND id = $2`, s.table), tenant, policyID)
+	} else {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, id, policy, version, updated_at, updated_by)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (tenant_id, id) DO UPDATE SET policy = EXCLUDED.policy, version = EXCLUDED.version,
+		updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by`, s.table),
+			tenant, policyID, data, version.Version, version.CreatedAt, version.Author)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, policy_id, version, operation, policy, author, rollback_of, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`, s.versions),
+		tenant, policyID, version.Version, string(version.Operation), data, version.Author, version.RollbackOf, version.CreatedAt); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// query returns the policies of the context tenant matching a condition
+// whose arguments start at $2
+func (s *PostgresStore) query(ctx context.Context, condition string, args ...any) ([]*authz.Policy, error) {
+	var policies []*authz.Policy
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT policy FROM %s WHERE tenant_id = $1 AND %s ORDER BY id`, s.table, condition),
+			append([]any{authz.PartitionFromContext(ctx)}, args...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		policies = make([]*authz.Policy, 0)
+		for rows.Next() {
+			var data []byte
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+			policy, err := decodePolicy(data)
+			if err != nil {
+				return err
+			}
+			policies = append(policies, policy)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// DeleteTenant removes every policy and version of a tenant
+func (s *PostgresStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	return s.db.Tx(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		for _, table := range []string{s.table, s.versions} {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1`, table), tenantID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func decodePolicy(data []byte) (*authz.Policy, error) {
+	policy := &authz.Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %w", err)
+	}
+	return policy, nil
+}
+
+func scanVersion(row interface{ Scan(...any) error }, policyID string) (*authz.PolicyVersion, error) {
+	version := &authz.PolicyVersion{PolicyID: policyID}
+	var operation string
+	var data []byte
+	if err := row.Scan(&version.Version, &operation, &data, &version.Author, &version.RollbackOf, &version.CreatedAt); err != nil {
+		return nil, err
+	}
+	version.Operation = authz.PolicyOperation(operation)
+
+	policy, err := decodePolicy(data)
+	if err != nil {
+		return nil, err
+	}
+	version.Policy = policy
+	return version, nil
+}
@@ -0,0 +1,235 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var (
+	ErrInvalidPolicy = autherrors.New(autherrors.ErrInvalidRequest, "invalid policy")
+)
+
+// RootField is the Field of a FieldError about the whole document
+const RootField = "(root)"
+
+// Schema is the JSON schema of a policy Document: the effect, subject,
+// resource and action patterns, conditions (equality values, CEL or Cedar
+// source, or abac operator objects) and obligations
+const Schema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Policy",
+  "type": "object",
+  "required": ["id", "effect", "subjects", "resources", "actions"],
+  "additionalProperties": false,
+  "properties": {
+    "id": {"type": "string", "pattern": "^[A-Za-z0-9._:-]{1,128}$"},
+    "name": {"type": "string", "maxLength": 256},
+    "description": {"type": "string", "maxLength": 1024},
+    "effect": {"enum": ["allow", "deny"]},
+    "subjects": {
+      "type": "array",
+      "minItems": 1,
+      "items": {"type": "string", "pattern": "^(\\*|role:\\S+|[^\\s:]\\S*)$"}
+    },
+    "resources": {
+      "type": "array",
+      "minItems": 1,
+      "items": {"type": "string", "pattern": "^(\\*|[^\\s:*]+:\\S+)$"}
+    },
+    "actions": {
+      "type": "array",
+      "minItems": 1,
+      "items": {"type": "string", "pattern": "^\\S+$"}
+    },
+    "conditions": {
+      "type": "object",
+      "propertyNames": {"pattern": "^\\S+$"},
+      "additionalProperties": {"$ref": "#/definitions/condition"}
+    },
+    "obligations": {"type": "array", "items": {"$ref": "#/definitions/obligation"}},
+    "advice": {"type": "array", "items": {"$ref": "#/definitions/obligation"}}
+  },
+  "definitions": {
+    "condition": {
+      "oneOf": [
+        {"type": ["string", "number", "boolean"]},
+        {
+          "type": "object",
+          "required": ["operator", "value"],
+          "additionalProperties": false,
+          "properties": {
+            "operator": {"enum": ["eq", "ne", "in", "not_in", "contains", "gt", "lt", "matches", "cidr_contains", "between_time", "day_of_week", "semver_gte", "intersects"]},
+            "value": {}
+          },
+          "allOf": [
+            {
+              "if": {"properties": {"operator": {"enum": ["in", "not_in"]}}},
+              "then": {"properties": {"value": {"type": "array"}}}
+            },
+            {
+              "if": {"properties": {"operator": {"enum": ["gt", "lt"]}}},
+              "then": {"properties": {"value": {"type": "number"}}}
+            },
+            {
+              "if": {"properties": {"operator": {"enum": ["contains", "matches", "semver_gte"]}}},
+              "then": {"properties": {"value": {"type": "string"}}}
+            }
+          ]
+        }
+      ]
+    },
+    "obligation": {
+      "type": "object",
+      "required": ["type"],
+      "additionalProperties": false,
+      "properties": {
+        "type": {"type": "string", "minLength": 1},
+        "params": {"type": "object"}
+      }
+    }
+  }
+}`
+
+// Document is the JSON representation of a policy, validated by Schema
+type Document struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Effect      string             `json:"effect"`
+	Subjects    []string           `json:"subjects"`
+	Resources   []string           `json:"resources"`
+	Actions     []string           `json:"actions"`
+	Conditions  map[string]any     `json:"conditions,omitempty"`
+	Obligations []authz.Obligation `json:"obligations,omitempty"`
+	Advice      []authz.Obligation `json:"advice,omitempty"`
+}
+
+// DocumentOf returns the document of a policy
+func DocumentOf(policy *authz.Policy) *Document {
+	actions := make([]string, len(policy.Actions))
+	for i, action := range policy.Actions {
+		actions[i] = string(action)
+	}
+	return &Document{
+		ID:          policy.ID,
+		Name:        policy.Name,
+		Description: policy.Description,
+		Effect:      policy.Effect,
+		Subjects:    policy.Subjects,
+		Resources:   policy.Resources,
+		Actions:     actions,
+		Conditions:  policy.Conditions,
+		Obligations: policy.Obligations,
+		Advice:      policy.Advice,
+	}
+}
+
+// Policy returns the policy of the document
+func (d *Document) Policy() *authz.Policy {
+	actions := make([]authz.Action, len(d.Actions))
+	for i, action := range d.Actions {
+		actions[i] = authz.Action(action)
+	}
+	return &authz.Policy{
+		ID:          d.ID,
+		Name:        d.Name,
+		Description: d.Description,
+		Effect:      d.Effect,
+		Subjects:    d.Subjects,
+		Resources:   d.Resources,
+		Actions:     actions,
+		Conditions:  d.Conditions,
+		Obligations: d.Obligations,
+		Advice:      d.Advice,
+	}
+}
+
+// FieldError is a violation of the policy schema
+type FieldError struct {
+	// Field is the path of the invalid field ("(root)", "effect",
+	// "subjects.0", "conditions.age.operator")
+	Field string `json:"field"`
+
+	// Code is the kind of violation ("required", "enum", "pattern"...)
+	Code string `json:"code"`
+
+	// Message describes the violation
+	Message string `json:"message"`
+}
+
+// ValidationError lists the schema violations of a policy document. It
+// matches ErrInvalidPolicy with errors.Is.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+// Error returns the violations
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldError := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", fieldError.Field, fieldError.Message)
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidPolicy, strings.Join(messages, "; "))
+}
+
+// Unwrap returns ErrInvalidPolicy
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidPolicy
+}
+
+// compiledSchema is Schema, compiled on first use
+var compiledSchema = sync.OnceValues(func() (*gojsonschema.Schema, error) {
+	return gojsonschema.NewSchema(gojsonschema.NewStringLoader(Schema))
+})
+
+// ParseDocument validates a JSON policy document against Schema and returns
+// its policy. Schema violations are returned as a *ValidationError.
+func ParseDocument(data []byte) (*authz.Policy, error) {
+	schema, err := compiledSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile policy schema: %w", err)
+	}
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, &ValidationError{Errors: []FieldError{{Field: RootField, Code: "invalid_json", Message: err.Error()}}}
+	}
+	if !result.Valid() {
+		violations := &ValidationError{}
+		for _, resultError := range result.Errors() {
+			field := resultError.Field()
+			if property, ok := resultError.Details()["property"].(string); ok && resultError.Type() == "required" {
+				// Report a missing property as the field itself
+				field = strings.TrimPrefix(field+"."+property, RootField+".")
+			}
+			violations.Errors = append(violations.Errors, FieldError{
+				Field:   field,
+				Code:    resultError.Type(),
+				Message: resultError.Description(),
+			})
+		}
+		return nil, violations
+	}
+
+	var document Document
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	return document.Policy(), nil
+}
+
+// ValidatePolicy validates a policy against Schema
+func ValidatePolicy(policy *authz.Policy) error {
+	data, err := json.Marshal(DocumentOf(policy))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	_, err = ParseDocument(data)
+	return err
+}
@@ -0,0 +1,250 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// ChangeOp is the operation of a proposed policy change
+type ChangeOp string
+
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// Change is a proposed policy change
+type Change struct {
+	Op     ChangeOp
+	Policy *authz.Policy // create, update
+	ID     string        // delete
+}
+
+// CreatePolicy proposes creating a policy
+func CreatePolicy(policy *authz.Policy) Change {
+	return Change{Op: ChangeCreate, Policy: policy}
+}
+
+// UpdatePolicy proposes replacing a policy
+func UpdatePolicy(policy *authz.Policy) Change {
+	return Change{Op: ChangeUpdate, Policy: policy}
+}
+
+// DeletePolicy proposes deleting a policy
+func DeletePolicy(policyID string) Change {
+	return Change{Op: ChangeDelete, ID: policyID}
+}
+
+// apply applies the change to a store
+func (c Change) apply(ctx context.Context, store authz.PolicyStore) error {
+	switch c.Op {
+	case ChangeCreate:
+		return store.Create(ctx, c.Policy)
+	case ChangeUpdate:
+		return store.Update(ctx, c.Policy)
+	case ChangeDelete:
+		return store.Delete(ctx, c.ID)
+	}
+	return fmt.Errorf("unknown policy change: %s", c.Op)
+}
+
+// EvaluatorFactory builds the evaluator used by a simulation over a policy
+// store, e.g., a policy Evaluator or a Cedar evaluator loaded from the store
+type EvaluatorFactory func(ctx context.Context, store authz.PolicyStore) (authz.PolicyEvaluator, error)
+
+// DecisionDiff is a request whose decision changes
+type DecisionDiff struct {
+	Request *authz.AuthorizationRequest
+	Before  *authz.AuthorizationDecision
+	After   *authz.AuthorizationDecision
+}
+
+// SimulationError is a request that failed to evaluate
+type SimulationError struct {
+	Request *authz.AuthorizationRequest
+	Err     error
+}
+
+// SimulationReport holds the outcome of a simulation
+type SimulationReport struct {
+	Total        int
+	Unchanged    int
+	NewlyAllowed []DecisionDiff
+	NewlyDenied  []DecisionDiff
+	Errors       []SimulationError
+}
+
+// HasChanges reports whether any decision changes
+func (r *SimulationReport) HasChanges() bool {
+	return len(r.NewlyAllowed) > 0 || len(r.NewlyDenied) > 0
+}
+
+// Simulator evaluates proposed policy changes against a corpus of
+// authorization requests and reports the decisions that change, before the
+// changes are activated in the policy store
+type Simulator struct {
+	store   authz.PolicyStore
+	factory EvaluatorFactory
+}
+
+// NewSimulator creates a simulator for a policy store. factory may be nil
+// (a deny-overrides policy Evaluator).
+func NewSimulator(store authz.PolicyStore, factory EvaluatorFactory) *Simulator {
+	if factory == nil {
+		factory = func(ctx context.Context, store authz.PolicyStore) (authz.PolicyEvaluator, error) {
+			return NewEvaluator(store, "deny-overrides"), nil
+		}
+	}
+	return &Simulator{store: store, factory: factory}
+}
+
+// Simulate evaluates every request against the current policies and against
+// the policies with the changes applied. The store is not modified.
+func (s *Simulator) Simulate(ctx context.Context, changes []Change, requests []*authz.AuthorizationRequest) (*SimulationReport, error) {
+	current, err := s.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	proposed, err := s.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if err := change.apply(ctx, proposed); err != nil {
+			return nil, fmt.Errorf("invalid change: %w", err)
+		}
+	}
+
+	before, err := s.factory(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.factory(ctx, proposed)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SimulationReport{Total: len(requests)}
+	for _, request := range requests {
+		beforeDecision, err := before.Evaluate(ctx, request)
+		if err == nil {
+			var afterDecision *authz.AuthorizationDecision
+			afterDecision, err = after.Evaluate(ctx, request)
+			if err == nil {
+				report.add(request, beforeDecision, afterDecision)
+				continue
+			}
+		}
+		report.Errors = append(report.Errors, SimulationError{Request: request, Err: err})
+	}
+	return report, nil
+}
+
+func (r *SimulationReport) add(request *authz.AuthorizationRequest, before, after *authz.AuthorizationDecision) {
+	diff := DecisionDiff{Request: request, Before: before, After: after}
+	switch {
+	case before.Allowed == after.Allowed:
+		r.Unchanged++
+	case after.Allowed:
+		r.NewlyAllowed = append(r.NewlyAllowed, diff)
+	default:
+		r.NewlyDenied = append(r.NewlyDenied, diff)
+	}
+}
+
+// Apply activates the changes in the policy store, in order
+func (s *Simulator) Apply(ctx context.Context, changes []Change) error {
+	for _, change := range changes {
+		if err := change.apply(ctx, s.store); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot copies the policies of the store into an in-memory store
+func (s *Simulator) snapshot(ctx context.Context) (*InMemoryStore, error) {
+	policies, err := s.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies: %w", err)
+	}
+
+	snapshot := NewInMemoryStore()
+	for _, policy := range policies {
+		if err := snapshot.Create(ctx, policy.Clone()); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// RequestRecorder wraps an evaluator and keeps the most recent requests it
+// evaluated, as a corpus of real traffic for simulations
+type RequestRecorder struct {
+	authz.PolicyEvaluator
+
+	mu       sync.Mutex
+	requests []*authz.AuthorizationRequest
+	next     int
+	full     bool
+}
+
+// NewRequestRecorder wraps an evaluator, keeping up to capacity requests
+// (default: 10000)
+func NewRequestRecorder(evaluator authz.PolicyEvaluator, capacity int) *RequestRecorder {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &RequestRecorder{
+		PolicyEvaluator: evaluator,
+		requests:        make([]*authz.AuthorizationRequest, capacity),
+	}
+}
+
+// Evaluate records the request and evaluates it
+func (r *RequestRecorder) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
+	r.mu.Lock()
+	r.requests[r.next] = request
+	r.next = (r.next + 1) % len(r.requests)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.mu.Unlock()
+
+	return r.PolicyEvaluator.Evaluate(ctx, request)
+}
+
+// Requests returns the recorded requests, oldest first
+func (r *RequestRecorder) Requests() []*authz.AuthorizationRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return slices.Clone(r.requests[:r.next])
+	}
+	return append(slices.Clone(r.requests[r.next:]), r.requests[:r.next]...)
+}
+
+// SyntheticRequests builds a corpus of every combination of subjects,
+// resources and actions
+func SyntheticRequests(subjects []*subject.IdentityContext, resources []*authz.Resource, actions []authz.Action) []*authz.AuthorizationRequest {
+	requests := make([]*authz.AuthorizationRequest, 0, len(subjects)*len(resources)*len(actions))
+	for _, identity := range subjects {
+		for _, resource := range resources {
+			for _, action := range actions {
+				requests = append(requests, &authz.AuthorizationRequest{
+					Subject:  identity,
+					Resource: resource,
+					Action:   action,
+				})
+			}
+		}
+	}
+	return requests
+}
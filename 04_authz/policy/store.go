@@ -3,21 +3,32 @@ package policy
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
 )
 
-// InMemoryStore is an in-memory implementation of PolicyStore
+var (
+	ErrPolicyNotFound = autherrors.New(autherrors.ErrNotFound, "policy not found")
+	ErrPolicyExists   = autherrors.New(autherrors.ErrConflict, "policy already exists")
+)
+
+// InMemoryStore is an in-memory implementation of PolicyStore. It keeps the
+// version history of every policy (authz.VersionedPolicyStore).
 type InMemoryStore struct {
 	mu       sync.RWMutex
 	policies map[string]*authz.Policy
+	history  map[string][]*authz.PolicyVersion
 }
 
 // NewInMemoryStore creates a new in-memory policy store
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
 		policies: make(map[string]*authz.Policy),
+		history:  make(map[string][]*authz.PolicyVersion),
 	}
 }
 
@@ -27,10 +38,11 @@ func (s *InMemoryStore) Create(ctx context.Context, policy *authz.Policy) error
 	defer s.mu.Unlock()
 
 	if _, exists := s.policies[policy.ID]; exists {
-		return fmt.Errorf("policy already exists: %s", policy.ID)
+		return fmt.Errorf("%w: %s", ErrPolicyExists, policy.ID)
 	}
 
 	s.policies[policy.ID] = policy
+	s.record(ctx, policy.ID, authz.PolicyCreated, policy, 0)
 	return nil
 }
 
@@ -41,7 +53,7 @@ func (s *InMemoryStore) Get(ctx context.Context, policyID string) (*authz.Policy
 
 	policy, exists := s.policies[policyID]
 	if !exists {
-		return nil, fmt.Errorf("policy not found: %s", policyID)
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, policyID)
 	}
 
 	return policy, nil
@@ -53,10 +65,11 @@ func (s *InMemoryStore) Update(ctx context.Context, policy *authz.Policy) error
 	defer s.mu.Unlock()
 
 	if _, exists := s.policies[policy.ID]; !exists {
-		return fmt.Errorf("policy not found: %s", policy.ID)
+		return fmt.Errorf("%w: %s", ErrPolicyNotFound, policy.ID)
 	}
 
 	s.policies[policy.ID] = policy
+	s.record(ctx, policy.ID, authz.PolicyUpdated, policy, 0)
 	return nil
 }
 
@@ -65,14 +78,74 @@ func (s *InMemoryStore) Delete(ctx context.Context, policyID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.policies[policyID]; !exists {
-		return fmt.Errorf("policy not found: %s", policyID)
+	policy, exists := s.policies[policyID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrPolicyNotFound, policyID)
 	}
 
 	delete(s.policies, policyID)
+	s.record(ctx, policyID, authz.PolicyDeleted, policy, 0)
 	return nil
 }
 
+// ListVersions returns the versions of a policy, oldest first
+func (s *InMemoryStore) ListVersions(ctx context.Context, policyID string) ([]*authz.PolicyVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions, ok := s.history[policyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, policyID)
+	}
+	return slices.Clone(versions), nil
+}
+
+// GetVersion returns one version of a policy
+func (s *InMemoryStore) GetVersion(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version(policyID, version)
+}
+
+// Rollback restores the content of a prior version as a new version
+func (s *InMemoryStore) Rollback(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target, err := s.version(policyID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := target.Policy.Clone()
+	s.policies[policyID] = policy
+	return s.record(ctx, policyID, authz.PolicyRolledBack, policy, version), nil
+}
+
+// version returns a version of a policy. Caller must hold s.mu.
+func (s *InMemoryStore) version(policyID string, version int) (*authz.PolicyVersion, error) {
+	versions := s.history[policyID]
+	if version < 1 || version > len(versions) {
+		return nil, fmt.Errorf("%w: %s v%d", authz.ErrVersionNotFound, policyID, version)
+	}
+	return versions[version-1], nil
+}
+
+// record appends a version to the history of a policy. Caller must hold s.mu.
+func (s *InMemoryStore) record(ctx context.Context, policyID string, operation authz.PolicyOperation, policy *authz.Policy, rollbackOf int) *authz.PolicyVersion {
+	version := &authz.PolicyVersion{
+		PolicyID:   policyID,
+		Version:    len(s.history[policyID]) + 1,
+		Operation:  operation,
+		Policy:     policy.Clone(),
+		Author:     authz.ActorFromContext(ctx),
+		RollbackOf: rollbackOf,
+		CreatedAt:  time.Now(),
+	}
+	s.history[policyID] = append(s.history[policyID], version)
+	return version
+}
+
 // List lists all policies
 func (s *InMemoryStore) List(ctx context.Context) ([]*authz.Policy, error) {
 	s.mu.RLock()
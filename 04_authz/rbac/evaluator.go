@@ -3,15 +3,22 @@ package rbac
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	subject "github.com/primadi/lokstra-auth/03_subject"
 	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/permission"
 )
 
 // Evaluator is an RBAC policy evaluator
 type Evaluator struct {
 	rolePermissions map[string][]string
+	syntax          *authz.PermissionSyntax
+	onRoleChange    func(role string)
+	bus             subject.InvalidationBus
+	hierarchy       roleHierarchy
 }
 
 // NewEvaluator creates a new RBAC evaluator
@@ -21,6 +28,50 @@ func NewEvaluator(rolePermissions map[string][]string) *Evaluator {
 	}
 }
 
+// SetPermissionSyntax enables permission normalization: existing and newly
+// added role permissions, as well as checked permissions, are converted to the
+// syntax's canonical form. Permissions that cannot be normalized are kept as-is
+// and returned in the migration report.
+func (e *Evaluator) SetPermissionSyntax(syntax *authz.PermissionSyntax) *authz.MigrationReport {
+	e.syntax = syntax
+	if syntax == nil {
+		return &authz.MigrationReport{}
+	}
+
+	migrated, report := syntax.MigratePermissions(e.rolePermissions)
+	e.rolePermissions = migrated
+	return report
+}
+
+// OnRoleChange registers a callback invoked after a role's permissions change
+// (e.g., to notify an identity reconciler)
+func (e *Evaluator) OnRoleChange(callback func(role string)) {
+	e.onRoleChange = callback
+}
+
+// SetInvalidationBus publishes a RoleChanged event after a role's
+// permissions change, so cached identities of its subjects are purged
+func (e *Evaluator) SetInvalidationBus(bus subject.InvalidationBus) {
+	e.bus = bus
+}
+
+// notifyRoleChange invokes the role change callback and publishes the change
+// for the role and every role inheriting it
+func (e *Evaluator) notifyRoleChange(role string) {
+	for _, changed := range append([]string{role}, e.seniorRoles(role)...) {
+		if e.onRoleChange != nil {
+			e.onRoleChange(changed)
+		}
+		if e.bus != nil {
+			e.bus.Publish(context.Background(), subject.ChangeEvent{
+				Kind:   subject.RoleChanged,
+				Role:   changed,
+				Reason: "role_permissions_changed",
+			})
+		}
+	}
+}
+
 // Evaluate evaluates policies for an authorization request
 func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
 	// Build required permission from resource and action
@@ -32,22 +83,40 @@ func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRe
 	// Also check simple permission format (action:type)
 	simplePermission := fmt.Sprintf("%s:%s", string(request.Action), request.Resource.Type)
 
-	// Check if any of the subject's roles have the required permission
-	for _, role := range request.Subject.Roles {
+	// Role permissions are stored in canonical form when a syntax is set
+	if e.syntax != nil {
+		simplePermission = e.syntax.Canonical(simplePermission)
+	}
+
+	// Check if any of the subject's roles (or the roles they inherit) have
+	// the required permission
+	for _, role := range e.EffectiveRoles(request.Subject.ActiveRoles(time.Now())) {
 		permissions, ok := e.rolePermissions[role]
 		if !ok {
+			authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "rbac", Kind: "role", ID: role, Result: authz.TraceSkipped, Detail: "role has no permissions"})
 			continue
 		}
 
-		for _, permission := range permissions {
-			if e.matchPermission(permission, requiredPermission) ||
-				e.matchPermission(permission, simplePermission) {
+		for _, granted := range permissions {
+			if permission.Match(granted, requiredPermission) ||
+				permission.Match(granted, simplePermission) {
+				authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "rbac", Kind: "role", ID: role, Result: authz.TraceMatched, Detail: fmt.Sprintf("permission %s", granted)})
 				return &authz.AuthorizationDecision{
 					Allowed: true,
-					Reason:  fmt.Sprintf("role %s has permission %s", role, permission),
+					Reason:  fmt.Sprintf("role %s has permission %s", role, granted),
 				}, nil
 			}
 		}
+
+		if authz.Explaining(ctx) {
+			authz.RecordTrace(ctx, authz.TraceStep{
+				Evaluator: "rbac",
+				Kind:      "role",
+				ID:        role,
+				Result:    authz.TraceNotMatched,
+				Detail:    fmt.Sprintf("none of %d permissions match %s or %s", len(permissions), requiredPermission, simplePermission),
+			})
+		}
 	}
 
 	return &authz.AuthorizationDecision{
@@ -56,61 +125,55 @@ func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRe
 	}, nil
 }
 
-// matchPermission checks if a permission pattern matches a required permission
-// Supports wildcard matching (e.g., "document:*" matches "document:read", "document:write")
-func (e *Evaluator) matchPermission(pattern, required string) bool {
-	// Exact match
-	if pattern == required {
-		return true
+// ListAuthorizedResources returns every resource of the type when a role
+// grants the action on the type ("read:document", "document:*:read"), or the
+// IDs named by resource-specific permissions ("document:doc1:read")
+func (e *Evaluator) ListAuthorizedResources(ctx context.Context, identity *subject.IdentityContext, action authz.Action, resourceType string) (*authz.ResourceFilter, error) {
+	filter := authz.NoResources(resourceType)
+	if identity == nil {
+		return filter, nil
 	}
 
-	// Wildcard match - full wildcard
-	if pattern == "*" {
-		return true
-	}
-
-	// Wildcard match - prefix matching (e.g., "document:*" matches "document:read")
-	if strings.HasSuffix(pattern, ":*") {
-		prefix := strings.TrimSuffix(pattern, ":*")
-		if strings.HasPrefix(required, prefix+":") || required == prefix {
-			return true
-		}
+	simplePermission := fmt.Sprintf("%s:%s", string(action), resourceType)
+	if e.syntax != nil {
+		simplePermission = e.syntax.Canonical(simplePermission)
 	}
+	anyResource := fmt.Sprintf("%s:*:%s", resourceType, action)
 
-	// Wildcard match - pattern with wildcards in segments
-	patternParts := strings.Split(pattern, ":")
-	requiredParts := strings.Split(required, ":")
-
-	// If pattern has more parts than required, can't match
-	if len(patternParts) > len(requiredParts) {
-		return false
-	}
+	seen := make(map[string]bool)
+	for _, role := range e.EffectiveRoles(identity.ActiveRoles(time.Now())) {
+		for _, granted := range e.rolePermissions[role] {
+			if permission.Match(granted, simplePermission) || permission.Match(granted, anyResource) {
+				return authz.AllResources(resourceType), nil
+			}
 
-	// Check each part
-	for i, part := range patternParts {
-		if part == "*" {
-			continue // Wildcard matches anything
-		}
-		if i >= len(requiredParts) || part != requiredParts[i] {
-			return false
+			parts := strings.Split(granted, ":")
+			if len(parts) != 3 || parts[1] == "*" || seen[parts[1]] {
+				continue
+			}
+			if permission.Match(granted, fmt.Sprintf("%s:%s:%s", resourceType, parts[1], action)) {
+				seen[parts[1]] = true
+				filter.IDs = append(filter.IDs, parts[1])
+			}
 		}
 	}
 
-	return true
+	slices.Sort(filter.IDs)
+	return filter, nil
 }
 
 // HasPermission checks if the subject has a specific permission
-func (e *Evaluator) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
-	for _, role := range identity.Roles {
+func (e *Evaluator) HasPermission(ctx context.Context, identity *subject.IdentityContext, required string) (bool, error) {
+	required = e.syntax.Canonical(required)
+
+	for _, role := range e.EffectiveRoles(identity.ActiveRoles(time.Now())) {
 		permissions, ok := e.rolePermissions[role]
 		if !ok {
 			continue
 		}
 
-		for _, p := range permissions {
-			if p == permission || p == "*" {
-				return true, nil
-			}
+		if permission.MatchAny(permissions, required) {
+			return true, nil
 		}
 	}
 
@@ -145,23 +208,35 @@ func (e *Evaluator) HasAllPermissions(ctx context.Context, identity *subject.Ide
 	return true, nil
 }
 
-// HasRole checks if the subject has a specific role
+// HasRole checks if the subject has a specific role, directly or through
+// the role hierarchy
 func (e *Evaluator) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
-	return identity.HasRole(role), nil
+	return slices.Contains(e.EffectiveRoles(identity.ActiveRoles(time.Now())), role), nil
 }
 
 // HasAnyRole checks if the subject has any of the specified roles
 func (e *Evaluator) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
-	return identity.HasAnyRole(roles...), nil
+	effective := e.EffectiveRoles(identity.ActiveRoles(time.Now()))
+	return slices.ContainsFunc(roles, func(role string) bool {
+		return slices.Contains(effective, role)
+	}), nil
 }
 
 // HasAllRoles checks if the subject has all of the specified roles
 func (e *Evaluator) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
-	return identity.HasAllRoles(roles...), nil
+	effective := e.EffectiveRoles(identity.ActiveRoles(time.Now()))
+	for _, role := range roles {
+		if !slices.Contains(effective, role) {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 // AddRolePermission adds a permission to a role
 func (e *Evaluator) AddRolePermission(role string, permission string) {
+	permission = e.syntax.Canonical(permission)
+
 	if e.rolePermissions == nil {
 		e.rolePermissions = make(map[string][]string)
 	}
@@ -169,6 +244,7 @@ func (e *Evaluator) AddRolePermission(role string, permission string) {
 	permissions, ok := e.rolePermissions[role]
 	if !ok {
 		e.rolePermissions[role] = []string{permission}
+		e.notifyRoleChange(role)
 		return
 	}
 
@@ -180,10 +256,13 @@ func (e *Evaluator) AddRolePermission(role string, permission string) {
 	}
 
 	e.rolePermissions[role] = append(permissions, permission)
+	e.notifyRoleChange(role)
 }
 
 // RemoveRolePermission removes a permission from a role
 func (e *Evaluator) RemoveRolePermission(role string, permission string) {
+	permission = e.syntax.Canonical(permission)
+
 	permissions, ok := e.rolePermissions[role]
 	if !ok {
 		return
@@ -192,6 +271,7 @@ func (e *Evaluator) RemoveRolePermission(role string, permission string) {
 	for i, p := range permissions {
 		if p == permission {
 			e.rolePermissions[role] = append(permissions[:i], permissions[i+1:]...)
+			e.notifyRoleChange(role)
 			return
 		}
 	}
@@ -209,3 +289,17 @@ func (e *Evaluator) GetRolePermissions(role string) []string {
 	copy(result, permissions)
 	return result
 }
+
+// ContributeGraph adds role → permission and role → inherited role edges to
+// an access graph
+func (e *Evaluator) ContributeGraph(ctx context.Context, graph *authz.AccessGraph) error {
+	e.contributeHierarchy(graph)
+
+	for role, permissions := range e.rolePermissions {
+		roleNode := graph.AddNode(authz.NodeKindRole, role)
+		for _, permission := range permissions {
+			graph.AddEdge(roleNode, graph.AddNode(authz.NodeKindPermission, permission), "grants")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrRoleCycle = autherrors.New(autherrors.ErrInvalidRequest, "role hierarchy cycle")
+)
+
+// RoleHierarchyStore persists role inheritance: a senior role inherits the
+// permissions of its junior roles (admin ⊃ team-lead ⊃ developer)
+type RoleHierarchyStore interface {
+	// AddInheritance records that role inherits the permissions of inherited
+	AddInheritance(ctx context.Context, role, inherited string) error
+
+	// RemoveInheritance removes an inheritance
+	RemoveInheritance(ctx context.Context, role, inherited string) error
+
+	// ListInheritance returns the hierarchy (role -> inherited roles)
+	ListInheritance(ctx context.Context) (map[string][]string, error)
+}
+
+// InMemoryRoleHierarchyStore is an in-memory implementation of RoleHierarchyStore
+type InMemoryRoleHierarchyStore struct {
+	mu       sync.RWMutex
+	inherits map[string][]string
+}
+
+// NewInMemoryRoleHierarchyStore creates a new in-memory role hierarchy store
+func NewInMemoryRoleHierarchyStore() *InMemoryRoleHierarchyStore {
+	return &InMemoryRoleHierarchyStore{
+		inherits: make(map[string][]string),
+	}
+}
+
+// AddInheritance records that role inherits the permissions of inherited
+func (s *InMemoryRoleHierarchyStore) AddInheritance(ctx context.Context, role, inherited string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Contains(s.inherits[role], inherited) {
+		s.inherits[role] = append(s.inherits[role], inherited)
+	}
+	return nil
+}
+
+// RemoveInheritance removes an inheritance
+func (s *InMemoryRoleHierarchyStore) RemoveInheritance(ctx context.Context, role, inherited string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inherits[role] = slices.DeleteFunc(slices.Clone(s.inherits[role]), func(r string) bool {
+		return r == inherited
+	})
+	if len(s.inherits[role]) == 0 {
+		delete(s.inherits, role)
+	}
+	return nil
+}
+
+// ListInheritance returns the hierarchy (role -> inherited roles)
+func (s *InMemoryRoleHierarchyStore) ListInheritance(ctx context.Context) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hierarchy := make(map[string][]string, len(s.inherits))
+	for role, inherited := range s.inherits {
+		hierarchy[role] = slices.Clone(inherited)
+	}
+	return hierarchy, nil
+}
+
+// roleHierarchy is the role inheritance of an evaluator
+type roleHierarchy struct {
+	mu       sync.RWMutex
+	inherits map[string][]string // role -> inherited (junior) roles
+	store    RoleHierarchyStore
+}
+
+// SetRoleHierarchy replaces the role hierarchy (role -> inherited roles),
+// e.g., {"admin": {"team-lead"}, "team-lead": {"developer"}}. Permissions
+// are then resolved transitively: admin has every permission of team-lead
+// and developer. A hierarchy with a cycle is rejected with ErrRoleCycle.
+func (e *Evaluator) SetRoleHierarchy(hierarchy map[string][]string) error {
+	inherits := make(map[string][]string, len(hierarchy))
+	for role, inherited := range hierarchy {
+		inherits[role] = slices.Clone(inherited)
+	}
+	if role, ok := findCycle(inherits); ok {
+		return fmt.Errorf("%w: %s", ErrRoleCycle, role)
+	}
+
+	e.hierarchy.mu.Lock()
+	previous := e.hierarchy.inherits
+	e.hierarchy.inherits = inherits
+	e.hierarchy.mu.Unlock()
+
+	// Subjects of every role whose inheritance changed are impacted
+	for _, role := range changedRoles(previous, inherits) {
+		e.notifyRoleChange(role)
+	}
+	return nil
+}
+
+// SetRoleHierarchyStore loads the role hierarchy from a store; later
+// AddRoleInheritance and RemoveRoleInheritance calls are persisted to it
+func (e *Evaluator) SetRoleHierarchyStore(ctx context.Context, store RoleHierarchyStore) error {
+	hierarchy, err := store.ListInheritance(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load role hierarchy: %w", err)
+	}
+	if err := e.SetRoleHierarchy(hierarchy); err != nil {
+		return err
+	}
+
+	e.hierarchy.mu.Lock()
+	e.hierarchy.store = store
+	e.hierarchy.mu.Unlock()
+	return nil
+}
+
+// AddRoleInheritance makes role inherit the permissions of inherited. It
+// fails with ErrRoleCycle when inherited already inherits role.
+func (e *Evaluator) AddRoleInheritance(ctx context.Context, role, inherited string) error {
+	e.hierarchy.mu.Lock()
+	if role == inherited || slices.Contains(e.hierarchy.juniors(inherited), role) {
+		e.hierarchy.mu.Unlock()
+		return fmt.Errorf("%w: %s ⊃ %s", ErrRoleCycle, role, inherited)
+	}
+	if slices.Contains(e.hierarchy.inherits[role], inherited) {
+		e.hierarchy.mu.Unlock()
+		return nil
+	}
+	if store := e.hierarchy.store; store != nil {
+		if err := store.AddInheritance(ctx, role, inherited); err != nil {
+			e.hierarchy.mu.Unlock()
+			return err
+		}
+	}
+	if e.hierarchy.inherits == nil {
+		e.hierarchy.inherits = make(map[string][]string)
+	}
+	e.hierarchy.inherits[role] = append(slices.Clone(e.hierarchy.inherits[role]), inherited)
+	e.hierarchy.mu.Unlock()
+
+	e.notifyRoleChange(role)
+	return nil
+}
+
+// RemoveRoleInheritance removes an inheritance between two roles
+func (e *Evaluator) RemoveRoleInheritance(ctx context.Context, role, inherited string) error {
+	e.hierarchy.mu.Lock()
+	if !slices.Contains(e.hierarchy.inherits[role], inherited) {
+		e.hierarchy.mu.Unlock()
+		return nil
+	}
+	if store := e.hierarchy.store; store != nil {
+		if err := store.RemoveInheritance(ctx, role, inherited); err != nil {
+			e.hierarchy.mu.Unlock()
+			return err
+		}
+	}
+	remaining := slices.DeleteFunc(slices.Clone(e.hierarchy.inherits[role]), func(r string) bool {
+		return r == inherited
+	})
+	if len(remaining) == 0 {
+		delete(e.hierarchy.inherits, role)
+	} else {
+		e.hierarchy.inherits[role] = remaining
+	}
+	e.hierarchy.mu.Unlock()
+
+	e.notifyRoleChange(role)
+	return nil
+}
+
+// GetRoleHierarchy returns a copy of the role hierarchy
+func (e *Evaluator) GetRoleHierarchy() map[string][]string {
+	e.hierarchy.mu.RLock()
+	defer e.hierarchy.mu.RUnlock()
+
+	hierarchy := make(map[string][]string, len(e.hierarchy.inherits))
+	for role, inherited := range e.hierarchy.inherits {
+		hierarchy[role] = slices.Clone(inherited)
+	}
+	return hierarchy
+}
+
+// InheritedRoles returns the roles a role inherits, directly or transitively
+func (e *Evaluator) InheritedRoles(role string) []string {
+	e.hierarchy.mu.RLock()
+	defer e.hierarchy.mu.RUnlock()
+	return e.hierarchy.juniors(role)
+}
+
+// EffectiveRoles expands roles with every role they inherit
+func (e *Evaluator) EffectiveRoles(roles []string) []string {
+	e.hierarchy.mu.RLock()
+	defer e.hierarchy.mu.RUnlock()
+
+	if len(e.hierarchy.inherits) == 0 {
+		return roles
+	}
+
+	effective := slices.Clone(roles)
+	for _, role := range roles {
+		for _, junior := range e.hierarchy.juniors(role) {
+			if !slices.Contains(effective, junior) {
+				effective = append(effective, junior)
+			}
+		}
+	}
+	return effective
+}
+
+// GetEffectivePermissions returns the permissions of a role, including the
+// permissions of the roles it inherits
+func (e *Evaluator) GetEffectivePermissions(role string) []string {
+	permissions := e.GetRolePermissions(role)
+	for _, junior := range e.InheritedRoles(role) {
+		for _, permission := range e.rolePermissions[junior] {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions
+}
+
+// seniorRoles returns the roles that inherit a role, directly or transitively
+func (e *Evaluator) seniorRoles(role string) []string {
+	e.hierarchy.mu.RLock()
+	defer e.hierarchy.mu.RUnlock()
+
+	seniors := make(map[string][]string)
+	for senior, juniors := range e.hierarchy.inherits {
+		for _, junior := range juniors {
+			seniors[junior] = append(seniors[junior], senior)
+		}
+	}
+	return walkRoles(role, func(r string) []string { return seniors[r] })
+}
+
+// contributeHierarchy adds role → role inheritance edges to an access graph
+func (e *Evaluator) contributeHierarchy(graph *authz.AccessGraph) {
+	for role, inherited := range e.GetRoleHierarchy() {
+		roleNode := graph.AddNode(authz.NodeKindRole, role)
+		for _, junior := range inherited {
+			graph.AddEdge(roleNode, graph.AddNode(authz.NodeKindRole, junior), "inherits")
+		}
+	}
+}
+
+// juniors returns the roles inherited by role (caller holds the lock)
+func (h *roleHierarchy) juniors(role string) []string {
+	return walkRoles(role, func(r string) []string { return h.inherits[r] })
+}
+
+// walkRoles visits the roles reachable from start breadth-first, each once
+// (start excluded)
+func walkRoles(start string, next func(role string) []string) []string {
+	visited := map[string]bool{start: true}
+	result := make([]string, 0)
+	queue := []string{start}
+
+	for len(queue) > 0 {
+		role := queue[0]
+		queue = queue[1:]
+		for _, neighbour := range next(role) {
+			if visited[neighbour] {
+				continue
+			}
+			visited[neighbour] = true
+			result = append(result, neighbour)
+			queue = append(queue, neighbour)
+		}
+	}
+	return result
+}
+
+// findCycle returns a role on a cycle of the hierarchy
+func findCycle(inherits map[string][]string) (string, bool) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+
+	var visit func(role string) bool
+	visit = func(role string) bool {
+		switch state[role] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[role] = visiting
+		for _, junior := range inherits[role] {
+			if visit(junior) {
+				return true
+			}
+		}
+		state[role] = done
+		return false
+	}
+
+	roles := make([]string, 0, len(inherits))
+	for role := range inherits {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		if state[role] == unvisited && visit(role) {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// changedRoles returns the roles whose inherited roles differ between two
+// hierarchies
+func changedRoles(previous, current map[string][]string) []string {
+	changed := make([]string, 0)
+	for role, inherited := range current {
+		if !slices.Equal(previous[role], inherited) {
+			changed = append(changed, role)
+		}
+	}
+	for role := range previous {
+		if _, ok := current[role]; !ok {
+			changed = append(changed, role)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,635 @@
+package rbac
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/dbpool"
+)
+
+var tablePrefixPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// PostgresStore stores roles, the permission catalog and role assignments in
+// PostgreSQL (Store), with the direct permissions and groups of subjects
+// (subject.EffectiveAccessStore). Data is partitioned per tenant (see
+// authz.WithTenant). It works with any database/sql PostgreSQL driver (pgx
+// stdlib, lib/pq).
+type PostgresStore struct {
+	db                 *dbpool.Pool
+	roles              string
+	permissions        string
+	rolePermissions    string
+	subjectRoles       string
+	subjectPermissions string
+	subjectGroups      string
+}
+
+var _ subject.EffectiveAccessStore = (*PostgresStore)(nil)
+
+// NewPostgresStore creates an RBAC store on tables named after a prefix
+// (default: "rbac"): <prefix>_roles, <prefix>_permissions,
+// <prefix>_role_permissions, <prefix>_subject_roles,
+// <prefix>_subject_permissions and <prefix>_subject_groups. Call Migrate to
+// create the tables.
+func NewPostgresStore(db *sql.DB, prefix string) (*PostgresStore, error) {
+	return NewPostgresStoreOnPool(dbpool.New(db, nil), prefix)
+}
+
+// NewPostgresStoreOnPool creates an RBAC store whose reads (identity
+// building, evaluation, lists) go to the read replicas of a pool
+func NewPostgresStoreOnPool(db *dbpool.Pool, prefix string) (*PostgresStore, error) {
+	if prefix == "" {
+		prefix = "rbac"
+	}
+	if !tablePrefixPattern.MatchString(prefix) {
+		return nil, fmt.Errorf("invalid table prefix: %q", prefix)
+	}
+	return &PostgresStore{
+		db:                 db,
+		roles:              prefix + "_roles",
+		permissions:        prefix + "_permissions",
+		rolePermissions:    prefix + "_role_permissions",
+		subjectRoles:       prefix + "_subject_roles",
+		subjectPermissions: prefix + "_subject_permissions",
+		subjectGroups:      prefix + "_subject_groups",
+	}, nil
+}
+
+// Migrate creates the RBAC tables if they do not exist
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	index := strings.ReplaceAll(s.subjectRoles, ".", "_")
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, name)
+)`, s.roles),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, name)
+)`, s.permissions),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	role       TEXT NOT NULL,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (tenant_id, role, permission),
+	FOREIGN KEY (tenant_id, role) REFERENCES %s (tenant_id, name) ON DELETE CASCADE
+)`, s.rolePermissions, s.roles),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	subject_id TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, subject_id, role),
+	FOREIGN KEY (tenant_id, role) REFERENCES %s (tenant_id, name) ON DELETE CASCADE
+)`, s.subjectRoles, s.roles),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_role_idx ON %s (tenant_id, role)`, index, s.subjectRoles),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	subject_id TEXT NOT NULL,
+	app_id     TEXT NOT NULL DEFAULT '',
+	permission TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, subject_id, app_id, permission)
+)`, s.subjectPermissions),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	subject_id TEXT NOT NULL,
+	group_name TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, subject_id, group_name)
+)`, s.subjectGroups),
+	}
+
+	for _, statement := range statements {
+		if _, err := s.db.Primary().ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", s.roles, err)
+		}
+	}
+	return nil
+}
+
+// CreateRole creates a role
+func (s *PostgresStore) CreateRole(ctx context.Context, role *Role) error {
+	if err := ValidateName(role.Name); err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, func(ctx context.Context, tx *sql.Tx, tenant string) error {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, name, description) VALUES ($1, $2, $3)
+ON CONFLICT (tenant_id, name) DO NOTHING`, s.roles), tenant, role.Name, role.Description)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("%w: %s", ErrRoleExists, role.Name)
+		}
+		for _, perm := range uniqueSorted(role.Permissions) {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, role, permission) VALUES ($1, $2, $3)`,
+				s.rolePermissions), tenant, role.Name, perm); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRole returns a role with its permissions
+func (s *PostgresStore) GetRole(ctx context.Context, name string) (*Role, error) {
+	tenant := authz.PartitionFromContext(ctx)
+
+	role := &Role{Name: name}
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT description, created_at, updated_at FROM %s WHERE tenant_id = $1 AND name = $2`, s.roles),
+			tenant, name).Scan(&role.Description, &role.CreatedAt, &role.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		role.Permissions, err = queryStrings(ctx, db, fmt.Sprintf(`SELECT permission FROM %s WHERE tenant_id = $1 AND role = $2 ORDER BY permission`,
+			s.rolePermissions), tenant, name)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRole updates the description of a role
+func (s *PostgresStore) UpdateRole(ctx context.Context, role *Role) error {
+	return s.exec(ctx, ErrRoleNotFound, role.Name, fmt.Sprintf(`UPDATE %s SET description = $3, updated_at = now() WHERE tenant_id = $1 AND name = $2`, s.roles),
+		authz.PartitionFromContext(ctx), role.Name, role.Description)
+}
+
+// DeleteRole deletes a role, its permissions and its assignments
+func (s *PostgresStore) DeleteRole(ctx context.Context, name string) error {
+	return s.exec(ctx, ErrRoleNotFound, name, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND name = $2`, s.roles),
+		authz.PartitionFromContext(ctx), name)
+}
+
+// ListRoles returns a page of roles sorted by name, and the total count
+func (s *PostgresStore) ListRoles(ctx context.Context, opts ListOptions) ([]*Role, int, error) {
+	tenant := authz.PartitionFromContext(ctx)
+	where := `tenant_id = $1 AND ($2 = '' OR name ILIKE '%' || $2 || '%')`
+
+	var roles []*Role
+	var total int
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		if err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, s.roles, where),
+			tenant, opts.Search).Scan(&total); err != nil {
+			return err
+		}
+
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT r.name, r.description, r.created_at, r.updated_at,
+	COALESCE(array_to_string(ARRAY(SELECT permission FROM %s p WHERE p.tenant_id = r.tenant_id AND p.role = r.name ORDER BY permission), E'\n'), '')
+FROM %s r WHERE %s ORDER BY r.name%s`, s.rolePermissions, s.roles, where, pageClause(opts)), tenant, opts.Search)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		roles = make([]*Role, 0)
+		for rows.Next() {
+			role := &Role{}
+			var permissions string
+			if err := rows.Scan(&role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt, &permissions); err != nil {
+				return err
+			}
+			role.Permissions = splitLines(permissions)
+			roles = append(roles, role)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return roles, total, nil
+}
+
+// CreatePermission adds a permission to the catalog
+func (s *PostgresStore) CreatePermission(ctx context.Context, perm *Permission) error {
+	if err := ValidateName(perm.Name); err != nil {
+		return err
+	}
+
+	var inserted int64
+	err := s.db.Write(ctx, func(ctx context.Context, db *sql.DB) error {
+		result, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, name, description) VALUES ($1, $2, $3)
+ON CONFLICT (tenant_id, name) DO NOTHING`, s.permissions), authz.PartitionFromContext(ctx), perm.Name, perm.Description)
+		if err != nil {
+			return err
+		}
+		inserted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return fmt.Errorf("%w: %s", ErrPermissionExists, perm.Name)
+	}
+	return nil
+}
+
+// GetPermission returns a permission of the catalog
+func (s *PostgresStore) GetPermission(ctx context.Context, name string) (*Permission, error) {
+	perm := &Permission{Name: name}
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		return db.QueryRowContext(ctx, fmt.Sprintf(`SELECT description, created_at FROM %s WHERE tenant_id = $1 AND name = $2`, s.permissions),
+			authz.PartitionFromContext(ctx), name).Scan(&perm.Description, &perm.CreatedAt)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrPermissionNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return perm, nil
+}
+
+// DeletePermission removes a permission from the catalog and every role
+func (s *PostgresStore) DeletePermission(ctx context.Context, name string) error {
+	return s.inTx(ctx, func(ctx context.Context, tx *sql.Tx, tenant string) error {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND name = $2`, s.permissions), tenant, name)
+		if err := rowsAffected(result, err, ErrPermissionNotFound, name); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND permission = $2`, s.rolePermissions), tenant, name)
+		return err
+	})
+}
+
+// ListPermissions returns a page of the catalog sorted by name, and the
+// total count
+func (s *PostgresStore) ListPermissions(ctx context.Context, opts ListOptions) ([]*Permission, int, error) {
+	tenant := authz.PartitionFromContext(ctx)
+	where := `tenant_id = $1 AND ($2 = '' OR name ILIKE '%' || $2 || '%')`
+
+	var permissions []*Permission
+	var total int
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		if err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, s.permissions, where),
+			tenant, opts.Search).Scan(&total); err != nil {
+			return err
+		}
+
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT name, description, created_at FROM %s WHERE %s ORDER BY name%s`,
+			s.permissions, where, pageClause(opts)), tenant, opts.Search)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		permissions = make([]*Permission, 0)
+		for rows.Next() {
+			perm := &Permission{}
+			if err := rows.Scan(&perm.Name, &perm.Description, &perm.CreatedAt); err != nil {
+				return err
+			}
+			permissions = append(permissions, perm)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return permissions, total, nil
+}
+
+// GrantPermission grants a permission to a role
+func (s *PostgresStore) GrantPermission(ctx context.Context, role, perm string) error {
+	return s.inTx(ctx, func(ctx context.Context, tx *sql.Tx, tenant string) error {
+		if err := s.touchRole(ctx, tx, tenant, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, role, permission) VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING`, s.rolePermissions), tenant, role, perm)
+		return err
+	})
+}
+
+// RevokePermission revokes a permission from a role
+func (s *PostgresStore) RevokePermission(ctx context.Context, role, perm string) error {
+	return s.inTx(ctx, func(ctx context.Context, tx *sql.Tx, tenant string) error {
+		if err := s.touchRole(ctx, tx, tenant, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND role = $2 AND permission = $3`,
+			s.rolePermissions), tenant, role, perm)
+		return err
+	})
+}
+
+// RolePermissions returns the permissions of every role
+func (s *PostgresStore) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	var result map[string][]string
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT r.name, p.permission FROM %s r
+LEFT JOIN %s p ON p.tenant_id = r.tenant_id AND p.role = r.name
+WHERE r.tenant_id = $1 ORDER BY r.name, p.permission`, s.roles, s.rolePermissions), authz.PartitionFromContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		result = make(map[string][]string)
+		for rows.Next() {
+			var role string
+			var perm sql.NullString
+			if err := rows.Scan(&role, &perm); err != nil {
+				return err
+			}
+			if _, ok := result[role]; !ok {
+				result[role] = []string{}
+			}
+			if perm.Valid {
+				result[role] = append(result[role], perm.String)
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AssignRole assigns a role to a subject
+func (s *PostgresStore) AssignRole(ctx context.Context, subjectID, role string) error {
+	return s.inTx(ctx, func(ctx context.Context, tx *sql.Tx, tenant string) error {
+		if err := s.roleExists(ctx, tx, tenant, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, subject_id, role) VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING`, s.subjectRoles), tenant, subjectID, role)
+		return err
+	})
+}
+
+// UnassignRole removes a role from a subject
+func (s *PostgresStore) UnassignRole(ctx context.Context, subjectID, role string) error {
+	return s.inTx(ctx, func(ctx context.Context, tx *sql.Tx, tenant string) error {
+		if err := s.roleExists(ctx, tx, tenant, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND subject_id = $2 AND role = $3`,
+			s.subjectRoles), tenant, subjectID, role)
+		return err
+	})
+}
+
+// ListSubjectRoles returns the roles of a subject, sorted
+func (s *PostgresStore) ListSubjectRoles(ctx context.Context, subjectID string) ([]string, error) {
+	var roles []string
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) (err error) {
+		roles, err = queryStrings(ctx, db, fmt.Sprintf(`SELECT role FROM %s WHERE tenant_id = $1 AND subject_id = $2 ORDER BY role`, s.subjectRoles),
+			authz.PartitionFromContext(ctx), subjectID)
+		return err
+	})
+	return roles, err
+}
+
+// ListRoleSubjects returns a page of the subjects of a role sorted by ID,
+// and the total count
+func (s *PostgresStore) ListRoleSubjects(ctx context.Context, role string, opts ListOptions) ([]string, int, error) {
+	tenant := authz.PartitionFromContext(ctx)
+	where := `tenant_id = $1 AND role = $2 AND ($3 = '' OR subject_id ILIKE '%' || $3 || '%')`
+
+	var subjects []string
+	var total int
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) (err error) {
+		if err := s.roleExists(ctx, db, tenant, role); err != nil {
+			return err
+		}
+		if err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, s.subjectRoles, where),
+			tenant, role, opts.Search).Scan(&total); err != nil {
+			return err
+		}
+		subjects, err = queryStrings(ctx, db, fmt.Sprintf(`SELECT subject_id FROM %s WHERE %s ORDER BY subject_id%s`, s.subjectRoles, where, pageClause(opts)),
+			tenant, role, opts.Search)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return subjects, total, nil
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// GrantSubjectPermission grants a permission (or wildcard pattern) directly
+// to a subject, in one app or, with an empty appID, in every app
+func (s *PostgresStore) GrantSubjectPermission(ctx context.Context, subjectID, appID, perm string) error {
+	return s.db.Write(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, subject_id, app_id, permission) VALUES ($1, $2, $3, $4)
+ON CONFLICT DO NOTHING`, s.subjectPermissions), authz.PartitionFromContext(ctx), subjectID, appID, perm)
+		return err
+	})
+}
+
+// RevokeSubjectPermission revokes a direct permission of a subject
+func (s *PostgresStore) RevokeSubjectPermission(ctx context.Context, subjectID, appID, perm string) error {
+	return s.db.Write(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND subject_id = $2 AND app_id = $3 AND permission = $4`,
+			s.subjectPermissions), authz.PartitionFromContext(ctx), subjectID, appID, perm)
+		return err
+	})
+}
+
+// AddSubjectGroup adds a subject to a group
+func (s *PostgresStore) AddSubjectGroup(ctx context.Context, subjectID, group string) error {
+	if err := ValidateName(group); err != nil {
+		return err
+	}
+	return s.db.Write(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, subject_id, group_name) VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING`, s.subjectGroups), authz.PartitionFromContext(ctx), subjectID, group)
+		return err
+	})
+}
+
+// RemoveSubjectGroup removes a subject from a group
+func (s *PostgresStore) RemoveSubjectGroup(ctx context.Context, subjectID, group string) error {
+	return s.db.Write(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND subject_id = $2 AND group_name = $3`,
+			s.subjectGroups), authz.PartitionFromContext(ctx), subjectID, group)
+		return err
+	})
+}
+
+// GetEffectiveAccess returns the roles, direct and role permissions, and
+// groups of a subject in one query. tenantID is a partition (see
+// AccessScope); direct permissions granted in every app apply to appID too.
+func (s *PostgresStore) GetEffectiveAccess(ctx context.Context, tenantID, appID, userID string) (*subject.EffectiveAccess, error) {
+	query := fmt.Sprintf(`WITH roles AS (
+	SELECT role FROM %[1]s WHERE tenant_id = $1 AND subject_id = $3
+), role_permissions AS (
+	SELECT p.permission FROM %[2]s p JOIN roles r ON p.role = r.role WHERE p.tenant_id = $1
+), direct AS (
+	SELECT permission FROM %[3]s WHERE tenant_id = $1 AND subject_id = $3 AND app_id IN ('', $2)
+), groups AS (
+	SELECT group_name FROM %[4]s WHERE tenant_id = $1 AND subject_id = $3
+)
+SELECT 'role', role FROM roles
+UNION ALL SELECT 'role_permission', permission FROM role_permissions
+UNION ALL SELECT 'direct', permission FROM direct
+UNION ALL SELECT 'group', group_name FROM groups`, s.subjectRoles, s.rolePermissions, s.subjectPermissions, s.subjectGroups)
+
+	var roles, rolePermissions, direct, groups []string
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		roles, rolePermissions, direct, groups = nil, nil, nil, nil
+		rows, err := db.QueryContext(ctx, query, tenantID, appID, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var kind, value string
+			if err := rows.Scan(&kind, &value); err != nil {
+				return err
+			}
+			switch kind {
+			case "role":
+				roles = append(roles, value)
+			case "role_permission":
+				rolePermissions = append(rolePermissions, value)
+			case "direct":
+				direct = append(direct, value)
+			case "group":
+				groups = append(groups, value)
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	direct = uniqueSorted(direct)
+	return &subject.EffectiveAccess{
+		Roles:             uniqueSorted(roles),
+		DirectPermissions: direct,
+		Permissions:       uniqueSorted(append(rolePermissions, direct...)),
+		Groups:            uniqueSorted(groups),
+	}, nil
+}
+
+// roleExists returns ErrRoleNotFound when the role does not exist
+func (s *PostgresStore) roleExists(ctx context.Context, q queryer, tenant, role string) error {
+	var exists bool
+	if err := q.QueryRowContext(ctx, fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE tenant_id = $1 AND name = $2)`, s.roles),
+		tenant, role).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, role)
+	}
+	return nil
+}
+
+// touchRole updates the modification time of a role, locking it until the
+// transaction ends
+func (s *PostgresStore) touchRole(ctx context.Context, tx *sql.Tx, tenant, role string) error {
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET updated_at = now() WHERE tenant_id = $1 AND name = $2`, s.roles), tenant, role)
+	return rowsAffected(result, err, ErrRoleNotFound, role)
+}
+
+// inTx runs fn in a transaction on the primary for the context tenant
+func (s *PostgresStore) inTx(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx, tenant string) error) error {
+	return s.db.Tx(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		return fn(ctx, tx, authz.PartitionFromContext(ctx))
+	})
+}
+
+// exec runs a statement on the primary; notFound is returned when it
+// changed no row
+func (s *PostgresStore) exec(ctx context.Context, notFound error, name, query string, args ...any) error {
+	var affected int64
+	err := s.db.Write(ctx, func(ctx context.Context, db *sql.DB) error {
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		affected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", notFound, name)
+	}
+	return nil
+}
+
+// queryStrings runs a query returning one string column
+func queryStrings(ctx context.Context, q queryer, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// rowsAffected returns notFound when a statement changed no row
+func rowsAffected(result sql.Result, err error, notFound error, name string) error {
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", notFound, name)
+	}
+	return nil
+}
+
+// pageClause returns the LIMIT/OFFSET clause of opts
+func pageClause(opts ListOptions) string {
+	clause := ""
+	if opts.Limit > 0 {
+		clause += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+	if opts.Offset > 0 {
+		clause += fmt.Sprintf(" OFFSET %d", opts.Offset)
+	}
+	return clause
+}
+
+// splitLines splits a newline-joined list
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,84 @@
+package rbac
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"sort"
+	"sync"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// StoreReloader rebuilds an RBAC evaluator from the role permissions of a
+// store when they change and swaps it into a SwappableAuthorizer, e.g. as a
+// reload source of lokstraauth.ConfigWatcher. Role permissions are read for
+// the tenant of the context.
+type StoreReloader struct {
+	store     Store
+	target    *authz.SwappableAuthorizer
+	configure func(*Evaluator)
+
+	mu      sync.Mutex
+	pending map[string][]string // role permissions read by Version
+}
+
+// NewStoreReloader creates a store reloader. configure is called on each new
+// evaluator, e.g. to set a permission syntax or role hierarchy (optional).
+func NewStoreReloader(store Store, target *authz.SwappableAuthorizer, configure func(*Evaluator)) *StoreReloader {
+	return &StoreReloader{store: store, target: target, configure: configure}
+}
+
+// Version returns a digest of the role permissions
+func (r *StoreReloader) Version(ctx context.Context) (string, error) {
+	rolePermissions, err := r.store.RolePermissions(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	roles := make([]string, 0, len(rolePermissions))
+	for role := range rolePermissions {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	hash := sha256.New()
+	for _, role := range roles {
+		permissions := slices.Clone(rolePermissions[role])
+		sort.Strings(permissions)
+		hash.Write([]byte(role))
+		for _, perm := range permissions {
+			hash.Write([]byte{0})
+			hash.Write([]byte(perm))
+		}
+		hash.Write([]byte{'\n'})
+	}
+
+	r.mu.Lock()
+	r.pending = rolePermissions
+	r.mu.Unlock()
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Reload builds an evaluator from the role permissions and swaps it in
+func (r *StoreReloader) Reload(ctx context.Context) error {
+	r.mu.Lock()
+	rolePermissions := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	if rolePermissions == nil {
+		var err error
+		if rolePermissions, err = r.store.RolePermissions(ctx); err != nil {
+			return err
+		}
+	}
+
+	evaluator := NewEvaluator(rolePermissions)
+	if r.configure != nil {
+		r.configure(evaluator)
+	}
+	r.target.Swap(evaluator)
+	return nil
+}
@@ -0,0 +1,501 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrRoleNotFound       = autherrors.New(autherrors.ErrNotFound, "role not found")
+	ErrRoleExists         = autherrors.New(autherrors.ErrConflict, "role already exists")
+	ErrPermissionNotFound = autherrors.New(autherrors.ErrNotFound, "permission not found")
+	ErrPermissionExists   = autherrors.New(autherrors.ErrConflict, "permission already exists")
+	ErrInvalidName        = autherrors.New(autherrors.ErrInvalidRequest, "invalid name")
+)
+
+// Role is a managed role with its granted permissions
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Permission is an entry of the permission catalog
+type Permission struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListOptions pages and filters a list
+type ListOptions struct {
+	// Offset is the number of items to skip
+	Offset int
+
+	// Limit is the maximum number of items to return (0: all)
+	Limit int
+
+	// Search keeps the items whose name contains the text (case-insensitive)
+	Search string
+}
+
+// Store persists roles, the permission catalog, role permissions and subject
+// role assignments. Data is partitioned per tenant (see authz.WithTenant).
+type Store interface {
+	// CreateRole creates a role (ErrRoleExists if it exists)
+	CreateRole(ctx context.Context, role *Role) error
+
+	// GetRole returns a role with its permissions
+	GetRole(ctx context.Context, name string) (*Role, error)
+
+	// UpdateRole updates the description of a role
+	UpdateRole(ctx context.Context, role *Role) error
+
+	// DeleteRole deletes a role, its permissions and its assignments
+	DeleteRole(ctx context.Context, name string) error
+
+	// ListRoles returns a page of roles sorted by name, and the total count
+	ListRoles(ctx context.Context, opts ListOptions) ([]*Role, int, error)
+
+	// CreatePermission adds a permission to the catalog (ErrPermissionExists
+	// if it exists)
+	CreatePermission(ctx context.Context, permission *Permission) error
+
+	// GetPermission returns a permission of the catalog
+	GetPermission(ctx context.Context, name string) (*Permission, error)
+
+	// DeletePermission removes a permission from the catalog and every role
+	DeletePermission(ctx context.Context, name string) error
+
+	// ListPermissions returns a page of the catalog sorted by name, and the
+	// total count
+	ListPermissions(ctx context.Context, opts ListOptions) ([]*Permission, int, error)
+
+	// GrantPermission grants a permission (or wildcard pattern) to a role
+	GrantPermission(ctx context.Context, role, permission string) error
+
+	// RevokePermission revokes a permission from a role
+	RevokePermission(ctx context.Context, role, permission string) error
+
+	// RolePermissions returns the permissions of every role (for NewEvaluator)
+	RolePermissions(ctx context.Context) (map[string][]string, error)
+
+	// AssignRole assigns a role to a subject
+	AssignRole(ctx context.Context, subjectID, role string) error
+
+	// UnassignRole removes a role from a subject
+	UnassignRole(ctx context.Context, subjectID, role string) error
+
+	// ListSubjectRoles returns the roles of a subject, sorted
+	ListSubjectRoles(ctx context.Context, subjectID string) ([]string, error)
+
+	// ListRoleSubjects returns a page of the subjects of a role sorted by ID,
+	// and the total count
+	ListRoleSubjects(ctx context.Context, role string, opts ListOptions) ([]string, int, error)
+}
+
+// ValidateName checks a role or permission name: not empty, at most 128
+// characters and without whitespace
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidName)
+	}
+	if len(name) > 128 {
+		return fmt.Errorf("%w: %q is longer than 128 characters", ErrInvalidName, name)
+	}
+	if strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("%w: %q contains whitespace", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// InMemoryStore is an in-memory implementation of Store
+type InMemoryStore struct {
+	mu         sync.RWMutex
+	partitions map[string]*storePartition
+}
+
+// storePartition is the RBAC data of one tenant
+type storePartition struct {
+	roles       map[string]*Role
+	permissions map[string]*Permission
+	subjects    map[string][]string // subjectID -> roles
+}
+
+// NewInMemoryStore creates a new in-memory RBAC store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		partitions: make(map[string]*storePartition),
+	}
+}
+
+// partition returns the partition of the context tenant. Caller must hold
+// the lock; create requires the write lock.
+func (s *InMemoryStore) partition(ctx context.Context, create bool) *storePartition {
+	key := authz.PartitionFromContext(ctx)
+	p, ok := s.partitions[key]
+	if !ok && create {
+		p = &storePartition{
+			roles:       make(map[string]*Role),
+			permissions: make(map[string]*Permission),
+			subjects:    make(map[string][]string),
+		}
+		s.partitions[key] = p
+	}
+	return p
+}
+
+// CreateRole creates a role
+func (s *InMemoryStore) CreateRole(ctx context.Context, role *Role) error {
+	if err := ValidateName(role.Name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, true)
+	if _, ok := p.roles[role.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrRoleExists, role.Name)
+	}
+
+	now := time.Now()
+	stored := role.clone()
+	stored.Permissions = uniqueSorted(stored.Permissions)
+	stored.CreatedAt, stored.UpdatedAt = now, now
+	p.roles[role.Name] = stored
+	return nil
+}
+
+// GetRole returns a role with its permissions
+func (s *InMemoryStore) GetRole(ctx context.Context, name string) (*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.roles[name] == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	return p.roles[name].clone(), nil
+}
+
+// UpdateRole updates the description of a role
+func (s *InMemoryStore) UpdateRole(ctx context.Context, role *Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.roles[role.Name] == nil {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, role.Name)
+	}
+	stored := p.roles[role.Name]
+	stored.Description = role.Description
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteRole deletes a role, its permissions and its assignments
+func (s *InMemoryStore) DeleteRole(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.roles[name] == nil {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	delete(p.roles, name)
+	for subjectID, roles := range p.subjects {
+		p.setSubjectRoles(subjectID, slices.DeleteFunc(slices.Clone(roles), func(r string) bool { return r == name }))
+	}
+	return nil
+}
+
+// ListRoles returns a page of roles sorted by name, and the total count
+func (s *InMemoryStore) ListRoles(ctx context.Context, opts ListOptions) ([]*Role, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p := s.partition(ctx, false)
+	if p == nil {
+		return []*Role{}, 0, nil
+	}
+
+	roles := make([]*Role, 0, len(p.roles))
+	for name, role := range p.roles {
+		if matchesSearch(name, opts.Search) {
+			roles = append(roles, role.clone())
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return paginate(roles, opts), len(roles), nil
+}
+
+// CreatePermission adds a permission to the catalog
+func (s *InMemoryStore) CreatePermission(ctx context.Context, perm *Permission) error {
+	if err := ValidateName(perm.Name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, true)
+	if _, ok := p.permissions[perm.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrPermissionExists, perm.Name)
+	}
+
+	stored := *perm
+	stored.CreatedAt = time.Now()
+	p.permissions[perm.Name] = &stored
+	return nil
+}
+
+// GetPermission returns a permission of the catalog
+func (s *InMemoryStore) GetPermission(ctx context.Context, name string) (*Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.permissions[name] == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPermissionNotFound, name)
+	}
+	perm := *p.permissions[name]
+	return &perm, nil
+}
+
+// DeletePermission removes a permission from the catalog and every role
+func (s *InMemoryStore) DeletePermission(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.permissions[name] == nil {
+		return fmt.Errorf("%w: %s", ErrPermissionNotFound, name)
+	}
+	delete(p.permissions, name)
+
+	now := time.Now()
+	for _, role := range p.roles {
+		if i := slices.Index(role.Permissions, name); i >= 0 {
+			role.Permissions = slices.Delete(slices.Clone(role.Permissions), i, i+1)
+			role.UpdatedAt = now
+		}
+	}
+	return nil
+}
+
+// ListPermissions returns a page of the catalog sorted by name, and the
+// total count
+func (s *InMemoryStore) ListPermissions(ctx context.Context, opts ListOptions) ([]*Permission, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p := s.partition(ctx, false)
+	if p == nil {
+		return []*Permission{}, 0, nil
+	}
+
+	permissions := make([]*Permission, 0, len(p.permissions))
+	for name, perm := range p.permissions {
+		if matchesSearch(name, opts.Search) {
+			clone := *perm
+			permissions = append(permissions, &clone)
+		}
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+	return paginate(permissions, opts), len(permissions), nil
+}
+
+// GrantPermission grants a permission to a role
+func (s *InMemoryStore) GrantPermission(ctx context.Context, roleName, perm string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.roles[roleName] == nil {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+	}
+	role := p.roles[roleName]
+	if !slices.Contains(role.Permissions, perm) {
+		role.Permissions = uniqueSorted(append(slices.Clone(role.Permissions), perm))
+		role.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// RevokePermission revokes a permission from a role
+func (s *InMemoryStore) RevokePermission(ctx context.Context, roleName, perm string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.roles[roleName] == nil {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+	}
+	role := p.roles[roleName]
+	if i := slices.Index(role.Permissions, perm); i >= 0 {
+		role.Permissions = slices.Delete(slices.Clone(role.Permissions), i, i+1)
+		role.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// RolePermissions returns the permissions of every role
+func (s *InMemoryStore) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string][]string)
+	if p := s.partition(ctx, false); p != nil {
+		for name, role := range p.roles {
+			result[name] = slices.Clone(role.Permissions)
+		}
+	}
+	return result, nil
+}
+
+// AssignRole assigns a role to a subject
+func (s *InMemoryStore) AssignRole(ctx context.Context, subjectID, roleName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.roles[roleName] == nil {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+	}
+	if !slices.Contains(p.subjects[subjectID], roleName) {
+		p.setSubjectRoles(subjectID, uniqueSorted(append(slices.Clone(p.subjects[subjectID]), roleName)))
+	}
+	return nil
+}
+
+// UnassignRole removes a role from a subject
+func (s *InMemoryStore) UnassignRole(ctx context.Context, subjectID, roleName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.roles[roleName] == nil {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+	}
+	p.setSubjectRoles(subjectID, slices.DeleteFunc(slices.Clone(p.subjects[subjectID]), func(r string) bool { return r == roleName }))
+	return nil
+}
+
+// ListSubjectRoles returns the roles of a subject, sorted
+func (s *InMemoryStore) ListSubjectRoles(ctx context.Context, subjectID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p := s.partition(ctx, false)
+	if p == nil {
+		return []string{}, nil
+	}
+	return append([]string{}, p.subjects[subjectID]...), nil
+}
+
+// ListRoleSubjects returns a page of the subjects of a role sorted by ID,
+// and the total count
+func (s *InMemoryStore) ListRoleSubjects(ctx context.Context, roleName string, opts ListOptions) ([]string, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p := s.partition(ctx, false)
+	if p == nil || p.roles[roleName] == nil {
+		return nil, 0, fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+	}
+
+	subjects := make([]string, 0)
+	for subjectID, roles := range p.subjects {
+		if slices.Contains(roles, roleName) && matchesSearch(subjectID, opts.Search) {
+			subjects = append(subjects, subjectID)
+		}
+	}
+	sort.Strings(subjects)
+	return paginate(subjects, opts), len(subjects), nil
+}
+
+// setSubjectRoles replaces the roles of a subject, dropping subjects
+// without roles
+func (p *storePartition) setSubjectRoles(subjectID string, roles []string) {
+	if len(roles) == 0 {
+		delete(p.subjects, subjectID)
+		return
+	}
+	p.subjects[subjectID] = roles
+}
+
+// StoreRoleProvider provides the roles assigned in a Store to the subject
+// resolver (subject.RoleProvider)
+type StoreRoleProvider struct {
+	store Store
+}
+
+// NewStoreRoleProvider creates a role provider reading assignments from a
+// store
+func NewStoreRoleProvider(store Store) *StoreRoleProvider {
+	return &StoreRoleProvider{store: store}
+}
+
+// GetRoles retrieves the assigned roles of a subject
+func (p *StoreRoleProvider) GetRoles(ctx context.Context, sub *subject.Subject) ([]string, error) {
+	return p.store.ListSubjectRoles(ctx, sub.ID)
+}
+
+// AccessScope returns the partition and app of the context (see
+// authz.WithTenant, authz.WithApp), the scope of
+// PostgresStore.GetEffectiveAccess
+func AccessScope(ctx context.Context) (tenantID, appID string) {
+	return authz.PartitionFromContext(ctx), authz.AppFromContext(ctx)
+}
+
+// LoadEvaluator creates an evaluator with the role permissions of a store
+func LoadEvaluator(ctx context.Context, store Store) (*Evaluator, error) {
+	rolePermissions, err := store.RolePermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load role permissions: %w", err)
+	}
+	return NewEvaluator(rolePermissions), nil
+}
+
+func (r *Role) clone() *Role {
+	clone := *r
+	clone.Permissions = slices.Clone(r.Permissions)
+	if clone.Permissions == nil {
+		clone.Permissions = []string{}
+	}
+	return &clone
+}
+
+// uniqueSorted sorts values and removes duplicates
+func uniqueSorted(values []string) []string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+// matchesSearch reports whether name contains search (case-insensitive)
+func matchesSearch(name, search string) bool {
+	return search == "" || strings.Contains(strings.ToLower(name), strings.ToLower(search))
+}
+
+// paginate returns the page of items selected by opts
+func paginate[T any](items []T, opts ListOptions) []T {
+	start := min(max(opts.Offset, 0), len(items))
+	end := len(items)
+	if opts.Limit > 0 {
+		end = min(start+opts.Limit, len(items))
+	}
+	return items[start:end]
+}
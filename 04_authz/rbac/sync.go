@@ -0,0 +1,121 @@
+package rbac
+
+import (
+	"context"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+// SyncedStore keeps an evaluator in step with a store: role permission
+// changes are mirrored into the evaluator, and assignment changes are
+// published on an invalidation bus so cached identities are rebuilt. The
+// evaluator holds a single set of roles, so use it for single-tenant
+// deployments (or one evaluator per tenant).
+type SyncedStore struct {
+	Store
+	evaluator *Evaluator
+	bus       subject.InvalidationBus
+}
+
+// NewSyncedStore wraps a store. evaluator and bus are optional.
+func NewSyncedStore(store Store, evaluator *Evaluator, bus subject.InvalidationBus) *SyncedStore {
+	return &SyncedStore{Store: store, evaluator: evaluator, bus: bus}
+}
+
+// CreateRole creates a role and adds its permissions to the evaluator
+func (s *SyncedStore) CreateRole(ctx context.Context, role *Role) error {
+	if err := s.Store.CreateRole(ctx, role); err != nil {
+		return err
+	}
+	if s.evaluator != nil {
+		for _, perm := range role.Permissions {
+			s.evaluator.AddRolePermission(role.Name, perm)
+		}
+	}
+	return nil
+}
+
+// DeleteRole deletes a role and removes its permissions from the evaluator
+func (s *SyncedStore) DeleteRole(ctx context.Context, name string) error {
+	subjects, _, err := s.Store.ListRoleSubjects(ctx, name, ListOptions{})
+	if err != nil {
+		return err
+	}
+	if err := s.Store.DeleteRole(ctx, name); err != nil {
+		return err
+	}
+	if s.evaluator != nil {
+		for _, perm := range s.evaluator.GetRolePermissions(name) {
+			s.evaluator.RemoveRolePermission(name, perm)
+		}
+	}
+	for _, subjectID := range subjects {
+		s.publish(ctx, subjectID, "role_revoked")
+	}
+	return nil
+}
+
+// DeletePermission removes a permission from the catalog, every role and the
+// evaluator
+func (s *SyncedStore) DeletePermission(ctx context.Context, name string) error {
+	if err := s.Store.DeletePermission(ctx, name); err != nil {
+		return err
+	}
+	if s.evaluator != nil {
+		for role := range s.evaluator.rolePermissions {
+			s.evaluator.RemoveRolePermission(role, name)
+		}
+	}
+	return nil
+}
+
+// GrantPermission grants a permission to a role and the evaluator
+func (s *SyncedStore) GrantPermission(ctx context.Context, role, perm string) error {
+	if err := s.Store.GrantPermission(ctx, role, perm); err != nil {
+		return err
+	}
+	if s.evaluator != nil {
+		s.evaluator.AddRolePermission(role, perm)
+	}
+	return nil
+}
+
+// RevokePermission revokes a permission from a role and the evaluator
+func (s *SyncedStore) RevokePermission(ctx context.Context, role, perm string) error {
+	if err := s.Store.RevokePermission(ctx, role, perm); err != nil {
+		return err
+	}
+	if s.evaluator != nil {
+		s.evaluator.RemoveRolePermission(role, perm)
+	}
+	return nil
+}
+
+// AssignRole assigns a role and announces the change of the subject
+func (s *SyncedStore) AssignRole(ctx context.Context, subjectID, role string) error {
+	if err := s.Store.AssignRole(ctx, subjectID, role); err != nil {
+		return err
+	}
+	s.publish(ctx, subjectID, "role_assigned")
+	return nil
+}
+
+// UnassignRole removes a role and announces the change of the subject
+func (s *SyncedStore) UnassignRole(ctx context.Context, subjectID, role string) error {
+	if err := s.Store.UnassignRole(ctx, subjectID, role); err != nil {
+		return err
+	}
+	s.publish(ctx, subjectID, "role_revoked")
+	return nil
+}
+
+func (s *SyncedStore) publish(ctx context.Context, subjectID, reason string) {
+	if s.bus == nil {
+		return
+	}
+	s.bus.Publish(ctx, subject.ChangeEvent{
+		Kind:      subject.SubjectChanged,
+		SubjectID: subjectID,
+		Reason:    reason,
+	})
+}
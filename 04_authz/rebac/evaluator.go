@@ -0,0 +1,463 @@
+package rebac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+var (
+	ErrDepthExceeded = errors.New("relation check depth exceeded")
+)
+
+// Wildcard as a subject ID grants a relation to every subject of the type,
+// e.g., document:doc1#viewer@user:* ("anyone with the link")
+const Wildcard = "*"
+
+// DefaultMaxDepth is the default limit of nested usersets followed by a check
+const DefaultMaxDepth = 25
+
+// Evaluator is a ReBAC (Relationship-Based Access Control) evaluator in the
+// style of Zanzibar: access is a relation between an object and a subject,
+// stored as relation tuples and expanded through the userset rewrites of the
+// schema (owner ⇒ editor ⇒ viewer, folder viewer ⇒ document viewer).
+// Tuples are partitioned per tenant by the store (see authz.WithTenant).
+type Evaluator struct {
+	store  TupleStore
+	schema *Schema
+
+	mu              sync.RWMutex
+	maxDepth        int
+	subjectType     string
+	parentRelation  string
+	actionRelations map[authz.Action]string
+}
+
+// NewEvaluator creates a new ReBAC evaluator. schema may be nil (relations
+// without rewrites).
+func NewEvaluator(store TupleStore, schema *Schema) *Evaluator {
+	return &Evaluator{
+		store:           store,
+		schema:          schema,
+		maxDepth:        DefaultMaxDepth,
+		subjectType:     "user",
+		parentRelation:  DefaultParentRelation,
+		actionRelations: make(map[authz.Action]string),
+	}
+}
+
+// SetMaxDepth sets the limit of nested usersets followed by a check
+func (e *Evaluator) SetMaxDepth(depth int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if depth > 0 {
+		e.maxDepth = depth
+	}
+}
+
+// SetSubjectType sets the object type of authenticated subjects in tuples
+// (default: "user")
+func (e *Evaluator) SetSubjectType(subjectType string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subjectType = subjectType
+}
+
+// MapAction maps an action to the relation checked by Evaluate, e.g.,
+// ActionRead -> "viewer". Unmapped actions are checked as relations of the
+// same name.
+func (e *Evaluator) MapAction(action authz.Action, relation string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.actionRelations[action] = relation
+}
+
+// Write stores tuples, after checking their relations against the schema
+func (e *Evaluator) Write(ctx context.Context, tuples ...Tuple) error {
+	for _, tuple := range tuples {
+		if err := e.schema.validate(tuple); err != nil {
+			return err
+		}
+	}
+	return e.store.Write(ctx, tuples...)
+}
+
+// Delete removes tuples
+func (e *Evaluator) Delete(ctx context.Context, tuples ...Tuple) error {
+	return e.store.Delete(ctx, tuples...)
+}
+
+// Check reports whether subject has relation on object, directly or through
+// usersets and rewrites
+func (e *Evaluator) Check(ctx context.Context, object Object, relation string, sub Subject) (bool, error) {
+	c := &checker{evaluator: e, subject: sub, maxDepth: e.getMaxDepth(), path: make(map[string]bool)}
+	return c.check(ctx, object, relation, 0)
+}
+
+// checker holds the state of one Check
+type checker struct {
+	evaluator *Evaluator
+	subject   Subject
+	maxDepth  int
+	path      map[string]bool // usersets being checked, to stop on cycles
+}
+
+func (c *checker) check(ctx context.Context, object Object, relation string, depth int) (bool, error) {
+	if depth > c.maxDepth {
+		return false, fmt.Errorf("%w: %s#%s", ErrDepthExceeded, object, relation)
+	}
+
+	userset := object.String() + "#" + relation
+	if c.path[userset] {
+		return false, nil
+	}
+	c.path[userset] = true
+	defer delete(c.path, userset)
+
+	// A userset subject holds its own relation
+	if c.subject.IsUserset() && c.subject.Object() == object && c.subject.Relation == relation {
+		return true, nil
+	}
+
+	// Direct tuples and usersets
+	tuples, err := c.evaluator.store.Read(ctx, TupleFilter{
+		ObjectType: object.Type,
+		ObjectID:   object.ID,
+		Relation:   relation,
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, tuple := range tuples {
+		if c.matches(tuple.Subject) {
+			return true, nil
+		}
+	}
+	for _, tuple := range tuples {
+		if !tuple.Subject.IsUserset() {
+			continue
+		}
+		if ok, err := c.check(ctx, tuple.Subject.Object(), tuple.Subject.Relation, depth+1); ok || err != nil {
+			return ok, err
+		}
+	}
+
+	rewrite := c.evaluator.schema.relation(object.Type, relation)
+	if rewrite == nil {
+		return false, nil
+	}
+
+	// Computed usersets: relations implying this one
+	for _, implied := range rewrite.ImpliedBy {
+		if ok, err := c.check(ctx, object, implied, depth+1); ok || err != nil {
+			return ok, err
+		}
+	}
+
+	// Tuple to userset: the relation on parent objects, unless the object
+	// stops inheritance
+	if len(rewrite.FromParents) == 0 {
+		return false, nil
+	}
+	if stopped, err := c.evaluator.inheritanceStopped(ctx, object); stopped || err != nil {
+		return false, err
+	}
+	for _, parent := range rewrite.FromParents {
+		parents, err := c.evaluator.store.Read(ctx, TupleFilter{
+			ObjectType: object.Type,
+			ObjectID:   object.ID,
+			Relation:   parent.Tupleset,
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, tuple := range parents {
+			if ok, err := c.check(ctx, tuple.Subject.Object(), parent.Relation, depth+1); ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// matches reports whether a tuple subject is the checked subject
+func (c *checker) matches(sub Subject) bool {
+	if sub == c.subject {
+		return true
+	}
+	return !sub.IsUserset() && !c.subject.IsUserset() &&
+		sub.ID == Wildcard && sub.Type == c.subject.Type
+}
+
+// UsersetTree is the expansion of a userset: its direct subjects and the
+// expansion of every userset that contributes to it
+type UsersetTree struct {
+	Object   Object
+	Relation string
+
+	// Subjects are the subjects of the relation's own tuples
+	Subjects []Subject
+
+	// Children are the expanded usersets, implied relations and parent
+	// relations
+	Children []*UsersetTree
+}
+
+// Leaves returns the subjects of the tree, each once
+func (t *UsersetTree) Leaves() []Subject {
+	seen := make(map[Subject]bool)
+	leaves := make([]Subject, 0)
+
+	var collect func(node *UsersetTree)
+	collect = func(node *UsersetTree) {
+		for _, sub := range node.Subjects {
+			if !seen[sub] {
+				seen[sub] = true
+				leaves = append(leaves, sub)
+			}
+		}
+		for _, child := range node.Children {
+			collect(child)
+		}
+	}
+	collect(t)
+	return leaves
+}
+
+// Expand returns the userset tree of a relation on an object: who holds the
+// relation and why (e.g., to render a "shared with" dialog)
+func (e *Evaluator) Expand(ctx context.Context, object Object, relation string) (*UsersetTree, error) {
+	return e.expand(ctx, object, relation, 0, e.getMaxDepth(), make(map[string]bool))
+}
+
+// usersetRef is a relation on an object to expand
+type usersetRef struct {
+	object   Object
+	relation string
+}
+
+func (e *Evaluator) expand(ctx context.Context, object Object, relation string, depth, maxDepth int, path map[string]bool) (*UsersetTree, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: %s#%s", ErrDepthExceeded, object, relation)
+	}
+
+	tree := &UsersetTree{Object: object, Relation: relation, Subjects: make([]Subject, 0)}
+	userset := object.String() + "#" + relation
+	if path[userset] {
+		return tree, nil
+	}
+	path[userset] = true
+	defer delete(path, userset)
+
+	tuples, err := e.store.Read(ctx, TupleFilter{
+		ObjectType: object.Type,
+		ObjectID:   object.ID,
+		Relation:   relation,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	children := make([]usersetRef, 0)
+	for _, tuple := range tuples {
+		if tuple.Subject.IsUserset() {
+			children = append(children, usersetRef{tuple.Subject.Object(), tuple.Subject.Relation})
+		} else {
+			tree.Subjects = append(tree.Subjects, tuple.Subject)
+		}
+	}
+
+	if rewrite := e.schema.relation(object.Type, relation); rewrite != nil {
+		for _, implied := range rewrite.ImpliedBy {
+			children = append(children, usersetRef{object, implied})
+		}
+		parentRewrites := rewrite.FromParents
+		if len(parentRewrites) > 0 {
+			stopped, err := e.inheritanceStopped(ctx, object)
+			if err != nil {
+				return nil, err
+			}
+			if stopped {
+				parentRewrites = nil
+			}
+		}
+		for _, parent := range parentRewrites {
+			parents, err := e.store.Read(ctx, TupleFilter{
+				ObjectType: object.Type,
+				ObjectID:   object.ID,
+				Relation:   parent.Tupleset,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, tuple := range parents {
+				children = append(children, usersetRef{tuple.Subject.Object(), parent.Relation})
+			}
+		}
+	}
+
+	for _, child := range children {
+		node, err := e.expand(ctx, child.object, child.relation, depth+1, maxDepth, path)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = append(tree.Children, node)
+	}
+	return tree, nil
+}
+
+// ListObjects returns the objects of a type on which subject has relation,
+// e.g., every document alice can view
+func (e *Evaluator) ListObjects(ctx context.Context, objectType, relation string, sub Subject) ([]Object, error) {
+	tuples, err := e.store.Read(ctx, TupleFilter{ObjectType: objectType})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[Object]bool)
+	objects := make([]Object, 0)
+	for _, tuple := range tuples {
+		if seen[tuple.Object] {
+			continue
+		}
+		seen[tuple.Object] = true
+
+		ok, err := e.Check(ctx, tuple.Object, relation, sub)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			objects = append(objects, tuple.Object)
+		}
+	}
+	return objects, nil
+}
+
+// ListAuthorizedResources returns the IDs of the objects of a type on which
+// the subject has the relation mapped from the action
+func (e *Evaluator) ListAuthorizedResources(ctx context.Context, identity *subject.IdentityContext, action authz.Action, resourceType string) (*authz.ResourceFilter, error) {
+	filter := authz.NoResources(resourceType)
+	if identity == nil || identity.Subject == nil {
+		return filter, nil
+	}
+
+	e.mu.RLock()
+	relation, ok := e.actionRelations[action]
+	sub := Subject{Type: e.subjectType, ID: identity.Subject.ID}
+	e.mu.RUnlock()
+	if !ok {
+		relation = string(action)
+	}
+
+	objects, err := e.ListObjects(ctx, resourceType, relation, sub)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		filter.IDs = append(filter.IDs, object.ID)
+	}
+	return filter, nil
+}
+
+// Evaluate checks the relation mapped from the request action between the
+// request resource and subject
+func (e *Evaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
+	if request.Subject == nil || request.Subject.Subject == nil {
+		return &authz.AuthorizationDecision{Allowed: false, Reason: "no subject"}, nil
+	}
+
+	e.mu.RLock()
+	relation, ok := e.actionRelations[request.Action]
+	subjectType := e.subjectType
+	e.mu.RUnlock()
+	if !ok {
+		relation = string(request.Action)
+	}
+
+	object := Object{Type: request.Resource.Type, ID: request.Resource.ID}
+	sub := Subject{Type: subjectType, ID: request.Subject.Subject.ID}
+
+	allowed, err := e.Check(ctx, object, relation, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	tuple := Tuple{Object: object, Relation: relation, Subject: sub}.String()
+	authz.RecordTrace(ctx, authz.TraceStep{Evaluator: "rebac", Kind: "relation", ID: tuple, Result: authz.MatchResult(allowed)})
+	decision := &authz.AuthorizationDecision{
+		Allowed: allowed,
+		Metadata: map[string]any{
+			"relation": relation,
+			"tuple":    tuple,
+		},
+	}
+	if allowed {
+		decision.Reason = fmt.Sprintf("relation %s granted", tuple)
+	} else {
+		decision.Reason = fmt.Sprintf("relation %s not found", tuple)
+	}
+	return decision, nil
+}
+
+// HasPermission checks a relation written as "type:id#relation", e.g.,
+// "document:doc1#viewer"
+func (e *Evaluator) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	if identity == nil || identity.Subject == nil {
+		return false, nil
+	}
+
+	userset, err := ParseSubject(permission)
+	if err != nil {
+		return false, err
+	}
+	if !userset.IsUserset() {
+		return false, fmt.Errorf("%w: permission %q is not type:id#relation", ErrInvalidTuple, permission)
+	}
+
+	e.mu.RLock()
+	sub := Subject{Type: e.subjectType, ID: identity.Subject.ID}
+	e.mu.RUnlock()
+
+	return e.Check(ctx, userset.Object(), userset.Relation, sub)
+}
+
+// HasAnyPermission checks if the subject has any of the specified relations
+func (e *Evaluator) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, permission := range permissions {
+		ok, err := e.HasPermission(ctx, identity, permission)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// HasAllPermissions checks if the subject has all of the specified relations
+func (e *Evaluator) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, permission := range permissions {
+		ok, err := e.HasPermission(ctx, identity, permission)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// HasRole checks if the subject has a specific role
+func (e *Evaluator) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return identity.HasRole(role), nil
+}
+
+// HasAnyRole checks if the subject has any of the specified roles
+func (e *Evaluator) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return identity.HasAnyRole(roles...), nil
+}
+
+// HasAllRoles checks if the subject has all of the specified roles
+func (e *Evaluator) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return identity.HasAllRoles(roles...), nil
+}
@@ -0,0 +1,126 @@
+package rebac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrObjectCycle = errors.New("object hierarchy cycle")
+)
+
+// StopInheritance is the reserved relation that disables the inheritance of
+// an object (object#stop_inheritance@object): relations are no longer
+// inherited from its parents (tuple-to-userset), only granted by its own
+// tuples. It is accepted on every namespace.
+const StopInheritance = "stop_inheritance"
+
+// DefaultParentRelation is the relation linking an object to its parent
+const DefaultParentRelation = "parent"
+
+// SetParentRelation sets the relation written by SetParent (default:
+// "parent"); use it as the Tupleset of the schema's FromParents rewrites
+func (e *Evaluator) SetParentRelation(relation string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.parentRelation = relation
+}
+
+// SetParent makes parent the only parent of child (document → folder),
+// replacing its current parent. It fails with ErrObjectCycle when parent is
+// a descendant of child.
+func (e *Evaluator) SetParent(ctx context.Context, child, parent Object) error {
+	relation := e.getParentRelation()
+
+	for object, depth := parent, 0; ; depth++ {
+		if object == child {
+			return fmt.Errorf("%w: %s → %s", ErrObjectCycle, child, parent)
+		}
+		if depth > e.getMaxDepth() {
+			return fmt.Errorf("%w: %s", ErrDepthExceeded, parent)
+		}
+		parents, err := e.store.Read(ctx, TupleFilter{
+			ObjectType: object.Type,
+			ObjectID:   object.ID,
+			Relation:   relation,
+		})
+		if err != nil {
+			return err
+		}
+		if len(parents) == 0 {
+			break
+		}
+		object = parents[0].Subject.Object()
+	}
+
+	if err := e.RemoveParent(ctx, child); err != nil {
+		return err
+	}
+	return e.Write(ctx, Tuple{
+		Object:   child,
+		Relation: relation,
+		Subject:  Subject{Type: parent.Type, ID: parent.ID},
+	})
+}
+
+// RemoveParent detaches an object from its parents
+func (e *Evaluator) RemoveParent(ctx context.Context, child Object) error {
+	parents, err := e.store.Read(ctx, TupleFilter{
+		ObjectType: child.Type,
+		ObjectID:   child.ID,
+		Relation:   e.getParentRelation(),
+	})
+	if err != nil {
+		return err
+	}
+	return e.store.Delete(ctx, parents...)
+}
+
+// SetInheritance enables or disables inheritance for an object. An object
+// with inheritance disabled (e.g., a private document in a shared folder)
+// only grants relations through its own tuples; its children still inherit
+// from it.
+func (e *Evaluator) SetInheritance(ctx context.Context, object Object, inherit bool) error {
+	tuple := stopInheritanceTuple(object)
+	if inherit {
+		return e.store.Delete(ctx, tuple)
+	}
+	return e.store.Write(ctx, tuple)
+}
+
+// InheritsFrom reports whether an object inherits relations from its parents
+func (e *Evaluator) InheritsFrom(ctx context.Context, object Object) (bool, error) {
+	stopped, err := e.inheritanceStopped(ctx, object)
+	return !stopped, err
+}
+
+// inheritanceStopped reports whether an object has inheritance disabled
+func (e *Evaluator) inheritanceStopped(ctx context.Context, object Object) (bool, error) {
+	tuples, err := e.store.Read(ctx, TupleFilter{
+		ObjectType: object.Type,
+		ObjectID:   object.ID,
+		Relation:   StopInheritance,
+	})
+	return len(tuples) > 0, err
+}
+
+func stopInheritanceTuple(object Object) Tuple {
+	return Tuple{
+		Object:   object,
+		Relation: StopInheritance,
+		Subject:  Subject{Type: object.Type, ID: object.ID},
+	}
+}
+
+func (e *Evaluator) getParentRelation() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.parentRelation
+}
+
+func (e *Evaluator) getMaxDepth() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.maxDepth
+}
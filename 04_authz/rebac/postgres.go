@@ -0,0 +1,163 @@
+package rebac
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/dbpool"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// PostgresTupleStore stores tuples in a PostgreSQL table. It works with any
+// database/sql PostgreSQL driver (pgx stdlib, lib/pq); open the *sql.DB with
+// the driver of your choice.
+type PostgresTupleStore struct {
+	db    *dbpool.Pool
+	table string
+}
+
+// NewPostgresTupleStore creates a tuple store on a table (default:
+// "rebac_tuples"). Call Migrate to create the table.
+func NewPostgresTupleStore(db *sql.DB, table string) (*PostgresTupleStore, error) {
+	return NewPostgresTupleStoreOnPool(dbpool.New(db, nil), table)
+}
+
+// NewPostgresTupleStoreOnPool creates a tuple store whose reads (relation
+// checks, expansions) go to the read replicas of a pool
+func NewPostgresTupleStoreOnPool(db *dbpool.Pool, table string) (*PostgresTupleStore, error) {
+	if table == "" {
+		table = "rebac_tuples"
+	}
+	if !tableNamePattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %q", table)
+	}
+	return &PostgresTupleStore{db: db, table: table}, nil
+}
+
+// Migrate creates the tuple table and its indexes if they do not exist
+func (s *PostgresTupleStore) Migrate(ctx context.Context) error {
+	index := strings.ReplaceAll(s.table, ".", "_")
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id        TEXT NOT NULL DEFAULT '',
+	object_type      TEXT NOT NULL,
+	object_id        TEXT NOT NULL,
+	relation         TEXT NOT NULL,
+	subject_type     TEXT NOT NULL,
+	subject_id       TEXT NOT NULL,
+	subject_relation TEXT NOT NULL DEFAULT '',
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+)`, s.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_subject_idx ON %s (tenant_id, subject_type, subject_id, subject_relation)`, index, s.table),
+	}
+
+	for _, statement := range statements {
+		if _, err := s.db.Primary().ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", s.table, err)
+		}
+	}
+	return nil
+}
+
+// Write stores tuples in one transaction
+func (s *PostgresTupleStore) Write(ctx context.Context, tuples ...Tuple) error {
+	query := fmt.Sprintf(`INSERT INTO %s
+	(tenant_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT DO NOTHING`, s.table)
+	return s.exec(ctx, query, tuples)
+}
+
+// Delete removes tuples in one transaction
+func (s *PostgresTupleStore) Delete(ctx context.Context, tuples ...Tuple) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1 AND object_type = $2 AND object_id = $3
+	AND relation = $4 AND subject_type = $5 AND subject_id = $6 AND subject_relation = $7`, s.table)
+	return s.exec(ctx, query, tuples)
+}
+
+func (s *PostgresTupleStore) exec(ctx context.Context, query string, tuples []Tuple) error {
+	if len(tuples) == 0 {
+		return nil
+	}
+
+	return s.db.Tx(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		partition := authz.PartitionFromContext(ctx)
+		for _, t := range tuples {
+			if _, err := stmt.ExecContext(ctx, partition, t.Object.Type, t.Object.ID, t.Relation,
+				t.Subject.Type, t.Subject.ID, t.Subject.Relation); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Read returns the tuples matching a filter
+func (s *PostgresTupleStore) Read(ctx context.Context, filter TupleFilter) ([]Tuple, error) {
+	conditions := []string{"tenant_id = $1"}
+	args := []any{authz.PartitionFromContext(ctx)}
+
+	for _, c := range []struct{ column, value string }{
+		{"object_type", filter.ObjectType},
+		{"object_id", filter.ObjectID},
+		{"relation", filter.Relation},
+		{"subject_type", filter.SubjectType},
+		{"subject_id", filter.SubjectID},
+		{"subject_relation", filter.SubjectRelation},
+	} {
+		if c.value == "" {
+			continue
+		}
+		args = append(args, c.value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", c.column, len(args)))
+	}
+
+	query := fmt.Sprintf(`SELECT object_type, object_id, relation, subject_type, subject_id, subject_relation
+	FROM %s WHERE %s
+	ORDER BY object_type, object_id, relation, subject_type, subject_id, subject_relation`,
+		s.table, strings.Join(conditions, " AND "))
+
+	var tuples []Tuple
+	err := s.db.Read(ctx, func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		tuples = make([]Tuple, 0)
+		for rows.Next() {
+			var t Tuple
+			if err := rows.Scan(&t.Object.Type, &t.Object.ID, &t.Relation,
+				&t.Subject.Type, &t.Subject.ID, &t.Subject.Relation); err != nil {
+				return err
+			}
+			tuples = append(tuples, t)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tuples, nil
+}
+
+// DeleteTenant removes every tuple of a tenant
+func (s *PostgresTupleStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	return s.db.Write(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = $1`, s.table), tenantID)
+		return err
+	})
+}
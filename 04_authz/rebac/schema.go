@@ -0,0 +1,129 @@
+package rebac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrUnknownRelation = errors.New("unknown relation")
+)
+
+// Relation is a relation of a namespace and its userset rewrite: who holds
+// the relation besides the subjects of its own tuples
+type Relation struct {
+	Name string
+
+	// ImpliedBy lists relations on the same object that imply this one
+	// (computed userset): viewer is implied by editor, editor by owner
+	ImpliedBy []string
+
+	// FromParents inherits the relation from related objects
+	// (tuple-to-userset): a viewer of a document's parent folder is a viewer
+	// of the document
+	FromParents []TupleToUserset
+}
+
+// TupleToUserset grants a relation to the holders of Relation on the objects
+// referenced by the Tupleset relation, e.g., {Tupleset: "parent", Relation:
+// "viewer"} with tuple document:doc1#parent@folder:f1 grants viewer on doc1
+// to every viewer of folder:f1
+type TupleToUserset struct {
+	Tupleset string
+	Relation string
+}
+
+// Namespace is an object type and its relations
+type Namespace struct {
+	Name      string
+	Relations []*Relation
+}
+
+// Schema holds the namespaces of an evaluator. Object types without a
+// namespace accept any relation, with no rewrites.
+type Schema struct {
+	namespaces map[string]map[string]*Relation // namespace -> relation name -> relation
+}
+
+// NewSchema creates a schema from namespaces
+func NewSchema(namespaces ...*Namespace) (*Schema, error) {
+	schema := &Schema{
+		namespaces: make(map[string]map[string]*Relation),
+	}
+	for _, namespace := range namespaces {
+		if err := schema.AddNamespace(namespace); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+// MustNewSchema is like NewSchema but panics on an invalid schema
+func MustNewSchema(namespaces ...*Namespace) *Schema {
+	schema, err := NewSchema(namespaces...)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// AddNamespace adds or replaces a namespace. Implied relations must be
+// relations of the namespace.
+func (s *Schema) AddNamespace(namespace *Namespace) error {
+	relations := make(map[string]*Relation, len(namespace.Relations))
+	for _, relation := range namespace.Relations {
+		relations[relation.Name] = relation
+	}
+
+	for _, relation := range namespace.Relations {
+		for _, implied := range relation.ImpliedBy {
+			if _, ok := relations[implied]; !ok {
+				return fmt.Errorf("%w: %s#%s is implied by undefined relation %q",
+					ErrUnknownRelation, namespace.Name, relation.Name, implied)
+			}
+		}
+		for _, parent := range relation.FromParents {
+			if _, ok := relations[parent.Tupleset]; !ok {
+				return fmt.Errorf("%w: %s#%s inherits through undefined relation %q",
+					ErrUnknownRelation, namespace.Name, relation.Name, parent.Tupleset)
+			}
+		}
+	}
+
+	s.namespaces[namespace.Name] = relations
+	return nil
+}
+
+// Namespaces returns the names of the namespaces, sorted
+func (s *Schema) Namespaces() []string {
+	names := make([]string, 0, len(s.namespaces))
+	for name := range s.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// relation returns the rewrite of a relation (nil: no rewrite)
+func (s *Schema) relation(objectType, relation string) *Relation {
+	if s == nil {
+		return nil
+	}
+	return s.namespaces[objectType][relation]
+}
+
+// validate checks that a tuple uses a relation defined by the schema
+func (s *Schema) validate(tuple Tuple) error {
+	if s == nil {
+		return nil
+	}
+	relations, ok := s.namespaces[tuple.Object.Type]
+	if !ok {
+		return nil
+	}
+	if _, ok := relations[tuple.Relation]; !ok && tuple.Relation != StopInheritance {
+		return fmt.Errorf("%w: %s#%s", ErrUnknownRelation, tuple.Object.Type, tuple.Relation)
+	}
+	return nil
+}
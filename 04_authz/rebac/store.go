@@ -0,0 +1,111 @@
+package rebac
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// TupleFilter selects tuples; empty fields match anything
+type TupleFilter struct {
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
+// Matches reports whether a tuple matches the filter
+func (f TupleFilter) Matches(t Tuple) bool {
+	return match(f.ObjectType, t.Object.Type) &&
+		match(f.ObjectID, t.Object.ID) &&
+		match(f.Relation, t.Relation) &&
+		match(f.SubjectType, t.Subject.Type) &&
+		match(f.SubjectID, t.Subject.ID) &&
+		match(f.SubjectRelation, t.Subject.Relation)
+}
+
+func match(want, got string) bool {
+	return want == "" || want == got
+}
+
+// TupleStore persists relation tuples. Stores are partitioned by the tenant
+// of the context (authz.PartitionFromContext), like the other engines.
+type TupleStore interface {
+	// Write stores tuples (existing tuples are kept)
+	Write(ctx context.Context, tuples ...Tuple) error
+
+	// Delete removes tuples
+	Delete(ctx context.Context, tuples ...Tuple) error
+
+	// Read returns the tuples matching a filter
+	Read(ctx context.Context, filter TupleFilter) ([]Tuple, error)
+}
+
+// InMemoryTupleStore is an in-memory implementation of TupleStore
+type InMemoryTupleStore struct {
+	mu         sync.RWMutex
+	partitions map[string]map[Tuple]struct{} // partition -> tuples
+}
+
+// NewInMemoryTupleStore creates a new in-memory tuple store
+func NewInMemoryTupleStore() *InMemoryTupleStore {
+	return &InMemoryTupleStore{
+		partitions: make(map[string]map[Tuple]struct{}),
+	}
+}
+
+// Write stores tuples
+func (s *InMemoryTupleStore) Write(ctx context.Context, tuples ...Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	partition := authz.PartitionFromContext(ctx)
+	if s.partitions[partition] == nil {
+		s.partitions[partition] = make(map[Tuple]struct{})
+	}
+	for _, tuple := range tuples {
+		s.partitions[partition][tuple] = struct{}{}
+	}
+	return nil
+}
+
+// Delete removes tuples
+func (s *InMemoryTupleStore) Delete(ctx context.Context, tuples ...Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	partition := s.partitions[authz.PartitionFromContext(ctx)]
+	for _, tuple := range tuples {
+		delete(partition, tuple)
+	}
+	return nil
+}
+
+// Read returns the tuples matching a filter, sorted
+func (s *InMemoryTupleStore) Read(ctx context.Context, filter TupleFilter) ([]Tuple, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tuples := make([]Tuple, 0)
+	for tuple := range s.partitions[authz.PartitionFromContext(ctx)] {
+		if filter.Matches(tuple) {
+			tuples = append(tuples, tuple)
+		}
+	}
+
+	sort.Slice(tuples, func(i, j int) bool {
+		return tuples[i].String() < tuples[j].String()
+	})
+	return tuples, nil
+}
+
+// DeleteTenant removes every tuple of a tenant
+func (s *InMemoryTupleStore) DeleteTenant(tenantID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.partitions, tenantID)
+}
@@ -0,0 +1,133 @@
+package rebac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidTuple = errors.New("invalid relation tuple")
+)
+
+// Object is an object of a namespace, e.g., document:doc1
+type Object struct {
+	Type string
+	ID   string
+}
+
+// String formats the object as "type:id"
+func (o Object) String() string {
+	return o.Type + ":" + o.ID
+}
+
+// Subject is the subject of a tuple: an object (user:alice), or the userset
+// of a relation on an object (group:eng#member = every member of group eng)
+type Subject struct {
+	Type     string
+	ID       string
+	Relation string // optional, for usersets
+}
+
+// String formats the subject as "type:id" or "type:id#relation"
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Type + ":" + s.ID
+	}
+	return s.Type + ":" + s.ID + "#" + s.Relation
+}
+
+// IsUserset reports whether the subject is a userset
+func (s Subject) IsUserset() bool {
+	return s.Relation != ""
+}
+
+// Object returns the object the subject refers to
+func (s Subject) Object() Object {
+	return Object{Type: s.Type, ID: s.ID}
+}
+
+// Tuple is a relation tuple: Subject has Relation on Object
+// (document:doc1#viewer@user:alice)
+type Tuple struct {
+	Object   Object
+	Relation string
+	Subject  Subject
+}
+
+// String formats the tuple as "type:id#relation@subject"
+func (t Tuple) String() string {
+	return t.Object.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+// NewTuple creates a tuple granting relation on object to subject
+func NewTuple(objectType, objectID, relation string, subject Subject) Tuple {
+	return Tuple{
+		Object:   Object{Type: objectType, ID: objectID},
+		Relation: relation,
+		Subject:  subject,
+	}
+}
+
+// User returns the subject of a user
+func User(id string) Subject {
+	return Subject{Type: "user", ID: id}
+}
+
+// Userset returns the subject of every member of relation on an object
+func Userset(objectType, objectID, relation string) Subject {
+	return Subject{Type: objectType, ID: objectID, Relation: relation}
+}
+
+// ParseTuple parses a tuple in Zanzibar notation, e.g.,
+// "document:doc1#viewer@user:alice" or "folder:f1#viewer@group:eng#member"
+func ParseTuple(s string) (Tuple, error) {
+	objectRelation, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return Tuple{}, fmt.Errorf("%w: %q: missing @subject", ErrInvalidTuple, s)
+	}
+
+	object, relation, ok := strings.Cut(objectRelation, "#")
+	if !ok || relation == "" {
+		return Tuple{}, fmt.Errorf("%w: %q: missing #relation", ErrInvalidTuple, s)
+	}
+
+	obj, err := ParseObject(object)
+	if err != nil {
+		return Tuple{}, fmt.Errorf("%w: %q", err, s)
+	}
+	sub, err := ParseSubject(subject)
+	if err != nil {
+		return Tuple{}, fmt.Errorf("%w: %q", err, s)
+	}
+
+	return Tuple{Object: obj, Relation: relation, Subject: sub}, nil
+}
+
+// MustParseTuple is like ParseTuple but panics on an invalid tuple
+func MustParseTuple(s string) Tuple {
+	tuple, err := ParseTuple(s)
+	if err != nil {
+		panic(err)
+	}
+	return tuple
+}
+
+// ParseObject parses "type:id"
+func ParseObject(s string) (Object, error) {
+	objectType, id, ok := strings.Cut(s, ":")
+	if !ok || objectType == "" || id == "" {
+		return Object{}, fmt.Errorf("%w: object %q is not type:id", ErrInvalidTuple, s)
+	}
+	return Object{Type: objectType, ID: id}, nil
+}
+
+// ParseSubject parses "type:id" or "type:id#relation"
+func ParseSubject(s string) (Subject, error) {
+	object, relation, _ := strings.Cut(s, "#")
+	obj, err := ParseObject(object)
+	if err != nil {
+		return Subject{}, err
+	}
+	return Subject{Type: obj.Type, ID: obj.ID, Relation: relation}, nil
+}
@@ -0,0 +1,235 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+// Authorization that cannot complete fails closed: the request is denied
+var (
+	ErrRecursionDepthExceeded = autherrors.New(autherrors.ErrPermissionDenied, "authorization recursion depth exceeded")
+	ErrReentrantAuthorization = autherrors.New(autherrors.ErrPermissionDenied, "re-entrant authorization of a check already in progress")
+)
+
+// DefaultMaxDepth is the default limit of nested authorization calls
+const DefaultMaxDepth = 4
+
+// authzFrame is an authorization call in progress. Frames form an immutable
+// stack carried by the context, so concurrent requests never share state.
+type authzFrame struct {
+	parent *authzFrame
+	key    string
+	depth  int
+}
+
+type authzFrameContextKey struct{}
+
+// systemContext marks internal calls that bypass authorization
+type systemContext struct {
+	reason string
+}
+
+type systemContextKey struct{}
+
+// WithSystemContext returns a context for internal calls that must not be
+// authorized, e.g., an evaluator reading role data through a store that is
+// itself guarded by authorization (admin API). Authorization in a system
+// context is allowed without evaluation, which breaks the cycle. Never derive
+// a system context from request input.
+func WithSystemContext(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, systemContextKey{}, &systemContext{reason: reason})
+}
+
+// IsSystemContext reports whether the context is a system context
+func IsSystemContext(ctx context.Context) bool {
+	_, ok := systemReason(ctx)
+	return ok
+}
+
+// systemReason returns the reason of a system context
+func systemReason(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	system, ok := ctx.Value(systemContextKey{}).(*systemContext)
+	if !ok {
+		return "", false
+	}
+	return system.reason, true
+}
+
+// SystemDecision returns the allow decision of a system context, or nil when
+// ctx is not a system context
+func SystemDecision(ctx context.Context) *AuthorizationDecision {
+	reason, ok := systemReason(ctx)
+	if !ok {
+		return nil
+	}
+	return &AuthorizationDecision{
+		Allowed:  true,
+		Reason:   "system context: " + reason,
+		Metadata: map[string]any{"system": true},
+	}
+}
+
+// DepthFromContext returns the number of authorization calls in progress
+// in the context
+func DepthFromContext(ctx context.Context) int {
+	if frame := frameFromContext(ctx); frame != nil {
+		return frame.depth
+	}
+	return 0
+}
+
+// Enter records an authorization call identified by key (see RequestKey)
+// and returns the context to evaluate it with. It fails when the call is
+// nested deeper than maxDepth (DefaultMaxDepth if <= 0), or when the same
+// check is already in progress further up the stack, which would otherwise
+// recurse forever.
+func Enter(ctx context.Context, key string, maxDepth int) (context.Context, error) {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	parent := frameFromContext(ctx)
+	for frame := parent; frame != nil; frame = frame.parent {
+		if frame.key == key {
+			return ctx, fmt.Errorf("%w: %s", ErrReentrantAuthorization, key)
+		}
+	}
+
+	depth := 1
+	if parent != nil {
+		depth = parent.depth + 1
+	}
+	if depth > maxDepth {
+		return ctx, fmt.Errorf("%w: %d nested calls (limit %d)", ErrRecursionDepthExceeded, depth, maxDepth)
+	}
+
+	return context.WithValue(ctx, authzFrameContextKey{}, &authzFrame{
+		parent: parent,
+		key:    key,
+		depth:  depth,
+	}), nil
+}
+
+// RequestKey identifies an authorization request for re-entrancy detection
+func RequestKey(ctx context.Context, request *AuthorizationRequest) string {
+	resource := ""
+	if request.Resource != nil {
+		resource = request.Resource.Type + "/" + request.Resource.ID
+	}
+	return strings.Join([]string{"evaluate", PartitionFromContext(ctx), identityID(request.Subject), string(request.Action), resource}, "|")
+}
+
+// CheckKey identifies a permission or role check for re-entrancy detection
+func CheckKey(ctx context.Context, kind string, identity *subject.IdentityContext, values ...string) string {
+	return strings.Join(append([]string{kind, PartitionFromContext(ctx), identityID(identity)}, values...), "|")
+}
+
+func frameFromContext(ctx context.Context) *authzFrame {
+	if ctx == nil {
+		return nil
+	}
+	frame, _ := ctx.Value(authzFrameContextKey{}).(*authzFrame)
+	return frame
+}
+
+func identityID(identity *subject.IdentityContext) string {
+	if identity == nil || identity.Subject == nil {
+		return ""
+	}
+	return identity.Subject.ID
+}
+
+// GuardedAuthorizer wraps an Authorizer with the recursion guard: system
+// contexts are allowed without evaluation, nested calls are limited to
+// MaxDepth, and re-entrant checks fail instead of recursing forever.
+type GuardedAuthorizer struct {
+	inner    Authorizer
+	maxDepth int
+}
+
+// NewGuardedAuthorizer wraps an authorizer with the recursion guard
+// (maxDepth <= 0: DefaultMaxDepth)
+func NewGuardedAuthorizer(inner Authorizer, maxDepth int) *GuardedAuthorizer {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	return &GuardedAuthorizer{inner: inner, maxDepth: maxDepth}
+}
+
+// Unwrap returns the wrapped authorizer
+func (g *GuardedAuthorizer) Unwrap() Authorizer {
+	return g.inner
+}
+
+// Evaluate evaluates an authorization request
+func (g *GuardedAuthorizer) Evaluate(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	if decision := SystemDecision(ctx); decision != nil {
+		return decision, nil
+	}
+	ctx, err := Enter(ctx, RequestKey(ctx, request), g.maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	return g.inner.Evaluate(ctx, request)
+}
+
+// HasPermission checks a permission
+func (g *GuardedAuthorizer) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	return g.check(ctx, CheckKey(ctx, "permission", identity, permission), func(ctx context.Context) (bool, error) {
+		return g.inner.HasPermission(ctx, identity, permission)
+	})
+}
+
+// HasAnyPermission checks if the identity has any of the permissions
+func (g *GuardedAuthorizer) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return g.check(ctx, CheckKey(ctx, "any-permission", identity, permissions...), func(ctx context.Context) (bool, error) {
+		return g.inner.HasAnyPermission(ctx, identity, permissions...)
+	})
+}
+
+// HasAllPermissions checks if the identity has all of the permissions
+func (g *GuardedAuthorizer) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return g.check(ctx, CheckKey(ctx, "all-permissions", identity, permissions...), func(ctx context.Context) (bool, error) {
+		return g.inner.HasAllPermissions(ctx, identity, permissions...)
+	})
+}
+
+// HasRole checks a role
+func (g *GuardedAuthorizer) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return g.check(ctx, CheckKey(ctx, "role", identity, role), func(ctx context.Context) (bool, error) {
+		return g.inner.HasRole(ctx, identity, role)
+	})
+}
+
+// HasAnyRole checks if the identity has any of the roles
+func (g *GuardedAuthorizer) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return g.check(ctx, CheckKey(ctx, "any-role", identity, roles...), func(ctx context.Context) (bool, error) {
+		return g.inner.HasAnyRole(ctx, identity, roles...)
+	})
+}
+
+// HasAllRoles checks if the identity has all of the roles
+func (g *GuardedAuthorizer) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return g.check(ctx, CheckKey(ctx, "all-roles", identity, roles...), func(ctx context.Context) (bool, error) {
+		return g.inner.HasAllRoles(ctx, identity, roles...)
+	})
+}
+
+// check runs a permission or role check under the guard
+func (g *GuardedAuthorizer) check(ctx context.Context, key string, fn func(ctx context.Context) (bool, error)) (bool, error) {
+	if IsSystemContext(ctx) {
+		return true, nil
+	}
+	ctx, err := Enter(ctx, key, g.maxDepth)
+	if err != nil {
+		return false, err
+	}
+	return fn(ctx)
+}
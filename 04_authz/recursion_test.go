@@ -0,0 +1,245 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+// callbackAuthorizer is an Authorizer whose checks run callbacks, so tests
+// can nest authorization calls
+type callbackAuthorizer struct {
+	evaluate func(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error)
+	check    func(ctx context.Context) (bool, error)
+	calls    int
+}
+
+func (a *callbackAuthorizer) Evaluate(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	a.calls++
+	return a.evaluate(ctx, request)
+}
+
+func (a *callbackAuthorizer) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	a.calls++
+	return a.check(ctx)
+}
+
+func (a *callbackAuthorizer) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	a.calls++
+	return a.check(ctx)
+}
+
+func (a *callbackAuthorizer) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	a.calls++
+	return a.check(ctx)
+}
+
+func (a *callbackAuthorizer) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	a.calls++
+	return a.check(ctx)
+}
+
+func (a *callbackAuthorizer) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	a.calls++
+	return a.check(ctx)
+}
+
+func (a *callbackAuthorizer) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	a.calls++
+	return a.check(ctx)
+}
+
+func testRequest(resourceID string) *AuthorizationRequest {
+	return &AuthorizationRequest{
+		Subject:  &subject.IdentityContext{Subject: &subject.Subject{ID: "user-1"}},
+		Resource: &Resource{Type: "document", ID: resourceID},
+		Action:   ActionRead,
+	}
+}
+
+func TestEnterDepthLimit(t *testing.T) {
+	tests := []struct {
+		maxDepth int
+		allowed  int
+	}{
+		{1, 1},
+		{3, 3},
+		{0, DefaultMaxDepth},
+		{-1, DefaultMaxDepth},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		for depth := 1; depth <= tt.allowed; depth++ {
+			var err error
+			ctx, err = Enter(ctx, fmt.Sprintf("key-%d", depth), tt.maxDepth)
+			if err != nil {
+				t.Fatalf("maxDepth %d: Enter at depth %d: %v", tt.maxDepth, depth, err)
+			}
+			if got := DepthFromContext(ctx); got != depth {
+				t.Fatalf("maxDepth %d: DepthFromContext = %d, want %d", tt.maxDepth, got, depth)
+			}
+		}
+
+		next, err := Enter(ctx, "key-over", tt.maxDepth)
+		if !errors.Is(err, ErrRecursionDepthExceeded) {
+			t.Fatalf("maxDepth %d: Enter over the limit: err = %v, want ErrRecursionDepthExceeded", tt.maxDepth, err)
+		}
+		if next != ctx {
+			t.Errorf("maxDepth %d: a failed Enter returned a new context", tt.maxDepth)
+		}
+	}
+}
+
+func TestEnterReentrant(t *testing.T) {
+	ctx, err := Enter(context.Background(), "outer", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err = Enter(ctx, "inner", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"outer", "inner"} {
+		if _, err := Enter(ctx, key, 0); !errors.Is(err, ErrReentrantAuthorization) {
+			t.Errorf("Enter(%q): err = %v, want ErrReentrantAuthorization", key, err)
+		}
+	}
+	if _, err := Enter(ctx, "other", 0); err != nil {
+		t.Errorf("Enter(other): %v", err)
+	}
+}
+
+func TestGuardedAuthorizerDepthLimit(t *testing.T) {
+	const maxDepth = 3
+
+	inner := &callbackAuthorizer{}
+	guard := NewGuardedAuthorizer(inner, maxDepth)
+	level := 0
+	inner.evaluate = func(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+		// Every level authorizes another resource, forever
+		level++
+		return guard.Evaluate(ctx, testRequest(fmt.Sprintf("doc-%d", level)))
+	}
+
+	decision, err := guard.Evaluate(context.Background(), testRequest("doc-0"))
+	if !errors.Is(err, ErrRecursionDepthExceeded) {
+		t.Fatalf("err = %v, want ErrRecursionDepthExceeded", err)
+	}
+	if decision != nil {
+		t.Errorf("decision = %+v, want nil", decision)
+	}
+	if inner.calls != maxDepth {
+		t.Errorf("inner evaluated %d times, want %d", inner.calls, maxDepth)
+	}
+}
+
+func TestGuardedAuthorizerSystemContext(t *testing.T) {
+	inner := &callbackAuthorizer{
+		evaluate: func(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+			return &AuthorizationDecision{Allowed: false}, nil
+		},
+		check: func(ctx context.Context) (bool, error) { return false, nil },
+	}
+	guard := NewGuardedAuthorizer(inner, 1)
+
+	// A system context at the depth limit, re-entering its own check
+	ctx, err := Enter(context.Background(), RequestKey(context.Background(), testRequest("doc-1")), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = WithSystemContext(ctx, "role sync")
+
+	decision, err := guard.Evaluate(ctx, testRequest("doc-1"))
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if !decision.Allowed || decision.Reason != "system context: role sync" {
+		t.Errorf("decision = %+v, want the system allow decision", decision)
+	}
+
+	identity := testRequest("").Subject
+	checks := map[string]func() (bool, error){
+		"HasPermission":     func() (bool, error) { return guard.HasPermission(ctx, identity, "document:read") },
+		"HasAnyPermission":  func() (bool, error) { return guard.HasAnyPermission(ctx, identity, "document:read") },
+		"HasAllPermissions": func() (bool, error) { return guard.HasAllPermissions(ctx, identity, "document:read") },
+		"HasRole":           func() (bool, error) { return guard.HasRole(ctx, identity, "admin") },
+		"HasAnyRole":        func() (bool, error) { return guard.HasAnyRole(ctx, identity, "admin") },
+		"HasAllRoles":       func() (bool, error) { return guard.HasAllRoles(ctx, identity, "admin") },
+	}
+	for name, check := range checks {
+		if allowed, err := check(); !allowed || err != nil {
+			t.Errorf("%s = %v, %v; want true, nil", name, allowed, err)
+		}
+	}
+
+	if inner.calls != 0 {
+		t.Errorf("inner called %d times in a system context, want 0", inner.calls)
+	}
+	if IsSystemContext(context.Background()) || SystemDecision(context.Background()) != nil {
+		t.Error("a plain context is a system context")
+	}
+}
+
+func TestGuardedAuthorizerReentrant(t *testing.T) {
+	inner := &callbackAuthorizer{}
+	guard := NewGuardedAuthorizer(inner, 0)
+
+	var nestedErr error
+	var siblingErrs []error
+	inner.evaluate = func(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+		if request.Resource.ID != "doc-1" {
+			// Nested checks of other resources are allowed
+			return &AuthorizationDecision{Allowed: true}, nil
+		}
+
+		// Re-entering the check in progress fails instead of recursing
+		_, nestedErr = guard.Evaluate(ctx, request)
+
+		// Sibling calls from the same frame each unwind before the next
+		for range 2 {
+			_, err := guard.Evaluate(ctx, testRequest("doc-2"))
+			siblingErrs = append(siblingErrs, err)
+		}
+		return &AuthorizationDecision{Allowed: true}, nil
+	}
+
+	ctx := context.Background()
+	decision, err := guard.Evaluate(ctx, testRequest("doc-1"))
+	if err != nil || !decision.Allowed {
+		t.Fatalf("Evaluate = %+v, %v; want allowed", decision, err)
+	}
+	if !errors.Is(nestedErr, ErrReentrantAuthorization) {
+		t.Errorf("nested err = %v, want ErrReentrantAuthorization", nestedErr)
+	}
+	for i, err := range siblingErrs {
+		if err != nil {
+			t.Errorf("sibling call %d: %v", i, err)
+		}
+	}
+
+	// Nothing is left on the stack of the caller: the same check runs again
+	if got := DepthFromContext(ctx); got != 0 {
+		t.Errorf("DepthFromContext = %d after unwinding, want 0", got)
+	}
+	nestedErr = nil
+	if _, err := guard.Evaluate(ctx, testRequest("doc-1")); err != nil {
+		t.Errorf("second Evaluate: %v", err)
+	}
+	if !errors.Is(nestedErr, ErrReentrantAuthorization) {
+		t.Errorf("second nested err = %v, want ErrReentrantAuthorization", nestedErr)
+	}
+
+	// Permission checks are guarded the same way
+	identity := testRequest("").Subject
+	inner.check = func(ctx context.Context) (bool, error) {
+		return guard.HasPermission(ctx, identity, "document:read")
+	}
+	if allowed, err := guard.HasPermission(ctx, identity, "document:read"); allowed || !errors.Is(err, ErrReentrantAuthorization) {
+		t.Errorf("re-entrant HasPermission = %v, %v; want false, ErrReentrantAuthorization", allowed, err)
+	}
+}
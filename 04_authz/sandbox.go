@@ -0,0 +1,59 @@
+package authz
+
+import (
+	"context"
+	"strings"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrSandboxToken = autherrors.New(autherrors.ErrPermissionDenied, "sandbox tokens are not accepted on this route")
+)
+
+// SandboxClaim is the token claim marking tokens issued to sandbox tenants
+// or apps
+const SandboxClaim = "sandbox"
+
+// sandboxSuffix separates the sandbox partition of a tenant from its
+// production partition
+const sandboxSuffix = "~sandbox"
+
+type sandboxContextKey struct{}
+
+// WithSandbox returns a context whose authorization runs against the sandbox
+// partition of its tenant
+func WithSandbox(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sandboxContextKey{}, true)
+}
+
+// IsSandbox reports whether the context is in sandbox mode
+func IsSandbox(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	sandbox, _ := ctx.Value(sandboxContextKey{}).(bool)
+	return sandbox
+}
+
+// SandboxPartition returns the partition holding the sandbox data of a
+// tenant, e.g., to seed it with AddTenantRule or reset it with DeleteTenant
+func SandboxPartition(tenantID string) string {
+	return tenantID + sandboxSuffix
+}
+
+// IsSandboxPartition reports whether a partition is a sandbox partition
+func IsSandboxPartition(partition string) bool {
+	return strings.HasSuffix(partition, sandboxSuffix)
+}
+
+// PartitionFromContext returns the data partition of the context: the
+// tenant, or its sandbox partition in sandbox mode. Sandbox requests never
+// see production data and vice versa.
+func PartitionFromContext(ctx context.Context) string {
+	tenantID := TenantFromContext(ctx)
+	if IsSandbox(ctx) {
+		return SandboxPartition(tenantID)
+	}
+	return tenantID
+}
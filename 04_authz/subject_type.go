@@ -0,0 +1,215 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/permission"
+)
+
+// SubjectTypeAuthorizer routes authorization by subject type, so machine
+// identities are authorized by their own rules instead of the role maps of
+// users. Subjects of types without an authorizer use the fallback.
+type SubjectTypeAuthorizer struct {
+	fallback Authorizer
+	byType   map[string]Authorizer
+}
+
+// NewSubjectTypeAuthorizer creates an authorizer routing subjects of the
+// types of byType to their authorizer, and others to fallback
+func NewSubjectTypeAuthorizer(fallback Authorizer, byType map[string]Authorizer) *SubjectTypeAuthorizer {
+	routes := make(map[string]Authorizer, len(byType))
+	for subjectType, authorizer := range byType {
+		routes[subjectType] = authorizer
+	}
+	return &SubjectTypeAuthorizer{fallback: fallback, byType: routes}
+}
+
+// NewMachineAuthorizer creates the default authorizer of a deployment with
+// machine identities: users keep the users authorizer, while service
+// accounts and apps are authorized by the scopes of their tokens only
+// (ScopeAuthorizer), so they are denied anything they were not granted
+func NewMachineAuthorizer(users Authorizer) *SubjectTypeAuthorizer {
+	scopes := NewScopeAuthorizer()
+	return NewSubjectTypeAuthorizer(users, map[string]Authorizer{
+		subject.SubjectTypeService: scopes,
+		subject.SubjectTypeApp:     scopes,
+	})
+}
+
+// authorizer returns the authorizer of the subject type of an identity
+func (a *SubjectTypeAuthorizer) authorizer(identity *subject.IdentityContext) Authorizer {
+	if identity != nil && identity.Subject != nil {
+		if authorizer, ok := a.byType[identity.Subject.Type]; ok {
+			return authorizer
+		}
+	}
+	return a.fallback
+}
+
+// Evaluate evaluates the request with the authorizer of the subject type
+func (a *SubjectTypeAuthorizer) Evaluate(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	return a.authorizer(request.Subject).Evaluate(ctx, request)
+}
+
+// HasPermission checks a permission with the authorizer of the subject type
+func (a *SubjectTypeAuthorizer) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	return a.authorizer(identity).HasPermission(ctx, identity, permission)
+}
+
+// HasAnyPermission checks permissions with the authorizer of the subject type
+func (a *SubjectTypeAuthorizer) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return a.authorizer(identity).HasAnyPermission(ctx, identity, permissions...)
+}
+
+// HasAllPermissions checks permissions with the authorizer of the subject type
+func (a *SubjectTypeAuthorizer) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return a.authorizer(identity).HasAllPermissions(ctx, identity, permissions...)
+}
+
+// HasRole checks a role with the authorizer of the subject type
+func (a *SubjectTypeAuthorizer) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return a.authorizer(identity).HasRole(ctx, identity, role)
+}
+
+// HasAnyRole checks roles with the authorizer of the subject type
+func (a *SubjectTypeAuthorizer) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return a.authorizer(identity).HasAnyRole(ctx, identity, roles...)
+}
+
+// HasAllRoles checks roles with the authorizer of the subject type
+func (a *SubjectTypeAuthorizer) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return a.authorizer(identity).HasAllRoles(ctx, identity, roles...)
+}
+
+// ScopeAuthorizer authorizes subjects by the scopes of their token, read as
+// permissions ("report:read", "report:*"). It grants no roles: subjects are
+// denied everything their scopes do not grant.
+type ScopeAuthorizer struct{}
+
+// NewScopeAuthorizer creates a scope authorizer
+func NewScopeAuthorizer() *ScopeAuthorizer {
+	return &ScopeAuthorizer{}
+}
+
+// SubjectScopes returns the token scopes of an identity, from the "scopes"
+// or space-delimited "scope" subject attribute
+func SubjectScopes(identity *subject.IdentityContext) []string {
+	if identity == nil || identity.Subject == nil {
+		return nil
+	}
+
+	if scopes, ok := stringList(identity.Subject.Attributes["scopes"]); ok {
+		return scopes
+	}
+	if scope, ok := identity.Subject.Attributes["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	return nil
+}
+
+// Evaluate allows the request if a scope grants the action on the resource
+// ("type:id:action", "type:action" or "action:type")
+func (a *ScopeAuthorizer) Evaluate(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	if request.Resource == nil {
+		return &AuthorizationDecision{Allowed: false, Reason: "no resource"}, nil
+	}
+
+	for _, scope := range SubjectScopes(request.Subject) {
+		for _, permission := range requestPermissions(request) {
+			if matchScope(scope, permission) {
+				RecordTrace(ctx, TraceStep{Evaluator: "scope", Kind: "scope", ID: scope, Result: TraceMatched})
+				return &AuthorizationDecision{
+					Allowed: true,
+					Reason:  fmt.Sprintf("scope %s grants %s", scope, permission),
+				}, nil
+			}
+		}
+	}
+
+	return &AuthorizationDecision{
+		Allowed: false,
+		Reason:  "no scope grants the action",
+	}, nil
+}
+
+// HasPermission checks if a scope of the subject grants a permission
+func (a *ScopeAuthorizer) HasPermission(ctx context.Context, identity *subject.IdentityContext, required string) (bool, error) {
+	for _, scope := range SubjectScopes(identity) {
+		if matchScope(scope, required) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasAnyPermission checks if the scopes grant any of the permissions
+func (a *ScopeAuthorizer) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, permission := range permissions {
+		if has, _ := a.HasPermission(ctx, identity, permission); has {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasAllPermissions checks if the scopes grant all of the permissions
+func (a *ScopeAuthorizer) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	for _, permission := range permissions {
+		if has, _ := a.HasPermission(ctx, identity, permission); !has {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HasRole always returns false: scope-authorized subjects hold no roles
+func (a *ScopeAuthorizer) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return false, nil
+}
+
+// HasAnyRole always returns false
+func (a *ScopeAuthorizer) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return false, nil
+}
+
+// HasAllRoles always returns false
+func (a *ScopeAuthorizer) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return false, nil
+}
+
+// requestPermissions returns the permissions granting the action of a
+// request on its resource ("type:id:action", "type:action" or "action:type")
+func requestPermissions(request *AuthorizationRequest) []string {
+	return []string{
+		fmt.Sprintf("%s:%s:%s", request.Resource.Type, request.Resource.ID, request.Action),
+		fmt.Sprintf("%s:%s", request.Resource.Type, request.Action),
+		fmt.Sprintf("%s:%s", request.Action, request.Resource.Type),
+	}
+}
+
+// stringList converts a string list attribute ([]string, or []any once
+// decoded from a token)
+func stringList(value any) ([]string, bool) {
+	switch list := value.(type) {
+	case []string:
+		return list, true
+	case []any:
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// matchScope reports whether a scope grants a permission. Scopes are OAuth
+// scopes, so only those written as permissions can match.
+func matchScope(scope, required string) bool {
+	return strings.Contains(scope, ":") && permission.Match(scope, required)
+}
@@ -0,0 +1,97 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+// SwappableAuthorizer delegates to an authorizer that can be replaced at
+// runtime (e.g., on configuration reload). A swap is atomic: each call uses
+// the authorizer current when it started, so in-flight requests finish with
+// the old one.
+type SwappableAuthorizer struct {
+	current atomic.Pointer[authorizerHolder]
+}
+
+type authorizerHolder struct {
+	authorizer Authorizer
+}
+
+// NewSwappableAuthorizer creates a swappable authorizer
+func NewSwappableAuthorizer(authorizer Authorizer) *SwappableAuthorizer {
+	s := &SwappableAuthorizer{}
+	s.Swap(authorizer)
+	return s
+}
+
+// Swap replaces the authorizer and returns the previous one
+func (s *SwappableAuthorizer) Swap(authorizer Authorizer) Authorizer {
+	previous := s.current.Swap(&authorizerHolder{authorizer: authorizer})
+	if previous == nil {
+		return nil
+	}
+	return previous.authorizer
+}
+
+// Current returns the current authorizer
+func (s *SwappableAuthorizer) Current() Authorizer {
+	return s.current.Load().authorizer
+}
+
+// Evaluate evaluates the request with the current authorizer
+func (s *SwappableAuthorizer) Evaluate(ctx context.Context, request *AuthorizationRequest) (*AuthorizationDecision, error) {
+	return s.Current().Evaluate(ctx, request)
+}
+
+// HasPermission checks a permission with the current authorizer
+func (s *SwappableAuthorizer) HasPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
+	return s.Current().HasPermission(ctx, identity, permission)
+}
+
+// HasAnyPermission checks permissions with the current authorizer
+func (s *SwappableAuthorizer) HasAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return s.Current().HasAnyPermission(ctx, identity, permissions...)
+}
+
+// HasAllPermissions checks permissions with the current authorizer
+func (s *SwappableAuthorizer) HasAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return s.Current().HasAllPermissions(ctx, identity, permissions...)
+}
+
+// HasRole checks a role with the current authorizer
+func (s *SwappableAuthorizer) HasRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return s.Current().HasRole(ctx, identity, role)
+}
+
+// HasAnyRole checks roles with the current authorizer
+func (s *SwappableAuthorizer) HasAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return s.Current().HasAnyRole(ctx, identity, roles...)
+}
+
+// HasAllRoles checks roles with the current authorizer
+func (s *SwappableAuthorizer) HasAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return s.Current().HasAllRoles(ctx, identity, roles...)
+}
+
+// ListAuthorizedResources lists with the current authorizer when it is a
+// ResourceLister
+func (s *SwappableAuthorizer) ListAuthorizedResources(ctx context.Context, identity *subject.IdentityContext, action Action, resourceType string) (*ResourceFilter, error) {
+	current := s.Current()
+	lister, ok := current.(ResourceLister)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrFilterNotSupported, current)
+	}
+	return lister.ListAuthorizedResources(ctx, identity, action, resourceType)
+}
+
+// ContributeGraph contributes the graph of the current authorizer when it is
+// a GraphContributor
+func (s *SwappableAuthorizer) ContributeGraph(ctx context.Context, graph *AccessGraph) error {
+	if contributor, ok := s.Current().(GraphContributor); ok {
+		return contributor.ContributeGraph(ctx, graph)
+	}
+	return nil
+}
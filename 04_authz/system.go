@@ -0,0 +1,39 @@
+package authz
+
+import (
+	"context"
+	"slices"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrCrossTenant = autherrors.New(autherrors.ErrTenantMismatch, "cross-tenant access requires a system token allowed in the tenant")
+)
+
+// AllTenants in the allowed tenants of a system token allows every tenant
+const AllTenants = "*"
+
+type systemScopeContextKey struct{}
+
+// WithSystemScope returns a context of a system subject, a platform service
+// allowed to act in some tenants (e.g., from a verified system token). Only
+// such contexts may switch tenant with AuthorizationRequest.TenantID.
+func WithSystemScope(ctx context.Context, allowedTenants []string) context.Context {
+	return context.WithValue(ctx, systemScopeContextKey{}, slices.Clone(allowedTenants))
+}
+
+// SystemScopeFromContext returns the allowed tenants of a system subject
+// context (false for other contexts)
+func SystemScopeFromContext(ctx context.Context) ([]string, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	allowedTenants, ok := ctx.Value(systemScopeContextKey{}).([]string)
+	return allowedTenants, ok
+}
+
+// TenantAllowed reports whether allowed tenants include a tenant
+func TenantAllowed(allowedTenants []string, tenantID string) bool {
+	return slices.Contains(allowedTenants, AllTenants) || slices.Contains(allowedTenants, tenantID)
+}
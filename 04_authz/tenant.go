@@ -0,0 +1,100 @@
+package authz
+
+import (
+	"context"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrTenantQuotaExceeded   = autherrors.New(autherrors.ErrRateLimited, "tenant memory quota exceeded")
+	ErrSubjectTenantMismatch = autherrors.New(autherrors.ErrTenantMismatch, "subject belongs to another tenant")
+)
+
+// DefaultTenant is the partition used when neither the context nor the
+// subject has a tenant
+const DefaultTenant = ""
+
+// SubjectTenantAttribute is the subject attribute holding the tenant of the
+// subject (the "tenant_id" claim of its token)
+const SubjectTenantAttribute = "tenant_id"
+
+type tenantContextKey struct{}
+
+// WithTenant returns a context scoped to a tenant. In-memory engines (abac,
+// acl) store and evaluate data in the partition of the context tenant (see
+// RequestPartition).
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant of the context (DefaultTenant if none)
+func TenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return DefaultTenant
+	}
+	tenantID, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenantID
+}
+
+// SubjectTenant returns the tenant of the subject of an identity ("" if
+// none)
+func SubjectTenant(identity *subject.IdentityContext) string {
+	if identity == nil || identity.Subject == nil {
+		return ""
+	}
+	tenantID, _ := identity.Subject.Attributes[SubjectTenantAttribute].(string)
+	return tenantID
+}
+
+// RequestPartition returns the data partition an authorization of an
+// identity reads: the partition of the context (see PartitionFromContext)
+// or, without a context tenant, of the tenant of the subject. Subjects of
+// another tenant than the context tenant fail with ErrSubjectTenantMismatch
+// rather than reading its data; system subjects act in any tenant (their
+// allowed tenants are enforced when the context is scoped).
+func RequestPartition(ctx context.Context, identity *subject.IdentityContext) (string, error) {
+	tenantID := TenantFromContext(ctx)
+	subjectTenant := SubjectTenant(identity)
+	if tenantID == DefaultTenant {
+		tenantID = subjectTenant
+	} else if subjectTenant != "" && subjectTenant != tenantID && identity.Subject.Type != subject.SubjectTypeSystem {
+		return "", ErrSubjectTenantMismatch
+	}
+
+	if IsSandbox(ctx) {
+		return SandboxPartition(tenantID), nil
+	}
+	return tenantID, nil
+}
+
+type appContextKey struct{}
+
+// WithApp returns a context scoped to an app of the tenant
+func WithApp(ctx context.Context, appID string) context.Context {
+	return context.WithValue(ctx, appContextKey{}, appID)
+}
+
+// AppFromContext returns the app of the context ("" if none)
+func AppFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	appID, _ := ctx.Value(appContextKey{}).(string)
+	return appID
+}
+
+// TenantStats are the memory accounting metrics of a tenant partition
+type TenantStats struct {
+	TenantID string
+
+	// Keys is the number of resources (acl) or rules (abac)
+	Keys int
+
+	// Entries is the number of ACL entries or rule conditions
+	Entries int
+
+	// Bytes is the estimated memory used by the partition
+	Bytes int64
+}
@@ -0,0 +1,95 @@
+package authz
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrVersionNotFound = autherrors.New(autherrors.ErrNotFound, "policy version not found")
+)
+
+// PolicyOperation is the change that created a policy version
+type PolicyOperation string
+
+const (
+	PolicyCreated    PolicyOperation = "create"
+	PolicyUpdated    PolicyOperation = "update"
+	PolicyDeleted    PolicyOperation = "delete"
+	PolicyRolledBack PolicyOperation = "rollback"
+)
+
+// PolicyVersion is an immutable revision of a policy
+type PolicyVersion struct {
+	PolicyID string
+
+	// Version numbers the revisions of a policy, starting at 1
+	Version int
+
+	Operation PolicyOperation
+
+	// Policy is the content of the revision (for a deletion, the content
+	// that was deleted)
+	Policy *Policy
+
+	// Author is the actor who made the change (see WithActor)
+	Author string
+
+	// RollbackOf is the version restored by a rollback
+	RollbackOf int
+
+	CreatedAt time.Time
+}
+
+// VersionedPolicyStore is a PolicyStore that keeps the history of every
+// policy: each Create, Update and Delete records a new version
+type VersionedPolicyStore interface {
+	PolicyStore
+
+	// ListVersions returns the versions of a policy, oldest first
+	ListVersions(ctx context.Context, policyID string) ([]*PolicyVersion, error)
+
+	// GetVersion returns one version of a policy
+	GetVersion(ctx context.Context, policyID string, version int) (*PolicyVersion, error)
+
+	// Rollback atomically restores the content of a prior version (also of
+	// a deleted policy), recorded as a new version
+	Rollback(ctx context.Context, policyID string, version int) (*PolicyVersion, error)
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context carrying the actor making changes (e.g., the
+// admin user ID), recorded as the author of policy versions
+func WithActor(ctx context.Context, actorID string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actorID)
+}
+
+// ActorFromContext returns the actor of the context ("" if none)
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actorID, _ := ctx.Value(actorContextKey{}).(string)
+	return actorID
+}
+
+// Clone returns a deep copy of the policy (Conditions are copied one level
+// deep)
+func (p *Policy) Clone() *Policy {
+	if p == nil {
+		return nil
+	}
+	clone := *p
+	clone.Subjects = slices.Clone(p.Subjects)
+	clone.Resources = slices.Clone(p.Resources)
+	clone.Actions = slices.Clone(p.Actions)
+	clone.Conditions = maps.Clone(p.Conditions)
+	clone.Obligations = slices.Clone(p.Obligations)
+	clone.Advice = slices.Clone(p.Advice)
+	return &clone
+}
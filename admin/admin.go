@@ -0,0 +1,210 @@
+// Package admin provides management REST APIs as Lokstra router services
+// (@RouterService). Every endpoint requires an authenticated caller (register
+// the auth middleware under the name "lokstra-auth") and an admin permission,
+// checked with the Authorizer of the injected Auth runtime.
+//
+// Mount a service by importing the package and declaring the service and its
+// dependencies in the deployment config, or by registering them in code:
+//
+//	lokstra_registry.RegisterMiddleware("lokstra-auth", middleware.NewAuthMiddleware(config).Handler())
+//	lokstra_registry.RegisterService("lokstra-auth", auth)
+//	lokstra_registry.RegisterService("rbac-store", rbac.NewSyncedStore(store, evaluator, bus))
+//
+// Outside the registry, create a service with service.Value:
+//
+//	svc := &admin.RBACService{Auth: service.Value(auth), Store: service.Value[rbac.Store](store)}
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/policy"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/middleware"
+	"github.com/primadi/lokstra-auth/tenant"
+	"github.com/primadi/lokstra/core/request"
+	"github.com/primadi/lokstra/core/response/api_formatter"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("permission denied")
+	ErrInvalidRequest  = errors.New("invalid request")
+)
+
+// Default and maximum page sizes of list endpoints
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Page is a page of a list endpoint
+type Page[T any] struct {
+	Items    []T `json:"items"`
+	Total    int `json:"total"`
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// newPage builds a page of items
+func newPage[T any](items []T, total, page, pageSize int) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return &Page[T]{Items: items, Total: total, Page: page, PageSize: pageSize}
+}
+
+// pageOptions converts page parameters (1-based page, page size) to list
+// options, applying the defaults
+func pageOptions(page, pageSize int, search string) (rbac.ListOptions, int, int) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	pageSize = min(pageSize, MaxPageSize)
+	return rbac.ListOptions{Offset: (page - 1) * pageSize, Limit: pageSize, Search: search}, page, pageSize
+}
+
+// nonEmpty drops the empty values of a bound list (an absent list is bound
+// as a single empty value)
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Metadata is a JSON object of a request body. The binder binds body fields
+// as path values (an empty string) before decoding the body, so it implements
+// json.Unmarshaler to accept the empty string as no metadata.
+type Metadata map[string]any
+
+// UnmarshalJSON decodes a JSON object, null or the empty string
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if string(data) == `""` || string(data) == "null" {
+		*m = nil
+		return nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidRequest)
+	}
+	*m = values
+	return nil
+}
+
+// guard returns the caller after checking it has the permission
+func guard(c *request.Context, auth *lokstraauth.Auth, perm string) (*subject.IdentityContext, error) {
+	identity, ok := middleware.GetIdentity(c)
+	if !ok {
+		return nil, fail(c, ErrUnauthenticated)
+	}
+	allowed, err := auth.CheckPermission(c, identity, perm)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	if !allowed {
+		return nil, fail(c, fmt.Errorf("%w: requires %s", ErrForbidden, perm))
+	}
+	return identity, nil
+}
+
+// record writes the audit entry of a change made through a management API
+func record(c *request.Context, auth *lokstraauth.Auth, identity *subject.IdentityContext, eventType, resource string, metadata map[string]any) {
+	var actorID string
+	if identity.Subject != nil {
+		actorID = identity.Subject.ID
+	}
+	auth.Audit(c, &audit.AuditLog{
+		EventType: eventType,
+		ActorID:   actorID,
+		Resource:  resource,
+		Action:    c.R.Method + " " + c.R.URL.Path,
+		Result:    audit.ResultSuccess,
+		UserAgent: c.R.UserAgent(),
+		Metadata:  metadata,
+	})
+}
+
+// fail writes the error response of err and returns it
+func fail(c *request.Context, err error) error {
+	var violations *policy.ValidationError
+	if errors.As(err, &violations) {
+		fields := make([]api_formatter.FieldError, len(violations.Errors))
+		for i, violation := range violations.Errors {
+			fields[i] = api_formatter.FieldError{Field: violation.Field, Code: violation.Code, Message: violation.Message}
+		}
+		_ = c.Api.ValidationError(policy.ErrInvalidPolicy.Error(), fields)
+		return err
+	}
+
+	switch status := statusOf(err); status {
+	case http.StatusBadRequest:
+		_ = c.Api.BadRequest("INVALID_REQUEST", err.Error())
+	case http.StatusUnauthorized:
+		_ = c.Api.Unauthorized(err.Error())
+	case http.StatusForbidden:
+		_ = c.Api.Forbidden(err.Error())
+	case http.StatusNotFound:
+		_ = c.Api.NotFound(err.Error())
+	case http.StatusConflict:
+		_ = c.Api.Error(status, "CONFLICT", err.Error())
+	default:
+		_ = c.Api.InternalError(err.Error())
+	}
+	return err
+}
+
+// statusOf maps an error to an HTTP status
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidRequest),
+		errors.Is(err, rbac.ErrInvalidName),
+		errors.Is(err, authz.ErrInvalidPermission),
+		errors.Is(err, tenant.ErrInvalidID),
+		errors.Is(err, tenant.ErrInvalidStatus),
+		errors.Is(err, policy.ErrInvalidPolicy),
+		errors.Is(err, audit.ErrInvalidQuery),
+		errors.Is(err, audit.ErrInvalidCursor),
+		errors.Is(err, audit.ErrUnsupportedFormat):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, rbac.ErrRoleNotFound),
+		errors.Is(err, rbac.ErrPermissionNotFound),
+		errors.Is(err, tenant.ErrTenantNotFound),
+		errors.Is(err, tenant.ErrAppNotFound),
+		errors.Is(err, tenant.ErrBranchNotFound),
+		errors.Is(err, tenant.ErrUserNotFound),
+		errors.Is(err, policy.ErrPolicyNotFound),
+		errors.Is(err, apikey.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, rbac.ErrRoleExists),
+		errors.Is(err, rbac.ErrPermissionExists),
+		errors.Is(err, tenant.ErrTenantExists),
+		errors.Is(err, tenant.ErrAppExists),
+		errors.Is(err, tenant.ErrBranchExists),
+		errors.Is(err, tenant.ErrUserExists),
+		errors.Is(err, tenant.ErrNotDeleted),
+		errors.Is(err, tenant.ErrInvalidTransition),
+		errors.Is(err, policy.ErrPolicyExists):
+		return http.StatusConflict
+	}
+	return autherrors.HTTPStatus(err)
+}
@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra/core/request"
+	"github.com/primadi/lokstra/core/service"
+)
+
+// Permissions required by the API key admin API ("apikey:*" grants them all)
+const (
+	PermissionAPIKeyRead  = "apikey:key:read"
+	PermissionAPIKeyWrite = "apikey:key:write"
+)
+
+// ListAPIKeysRequest lists the API keys of a user
+type ListAPIKeysRequest struct {
+	UserID string `path:"user_id" validate:"required"`
+}
+
+// CreateAPIKeyRequest creates an API key for a user. ExpiresIn is a Go
+// duration ("720h"); keys without it never expire.
+type CreateAPIKeyRequest struct {
+	UserID    string   `path:"user_id" json:"-" validate:"required"`
+	Name      string   `json:"name" validate:"required,max=128"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in"`
+}
+
+// RevokeAPIKeyRequest revokes an API key
+type RevokeAPIKeyRequest struct {
+	KeyID string `path:"key_id" validate:"required"`
+}
+
+// APIKeyInfo is an API key without its hash
+type APIKeyInfo struct {
+	ID        string     `json:"id"`
+	Prefix    string     `json:"prefix"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	Revoked   bool       `json:"revoked"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreatedAPIKey is a new API key. Key is only returned once.
+type CreatedAPIKey struct {
+	Key    string      `json:"key"`
+	APIKey *APIKeyInfo `json:"api_key"`
+}
+
+// APIKeyService is the API key management API over the apikey.KeyStore of
+// the deployment. Listing keys requires a store that implements
+// apikey.KeyLister.
+//
+// @RouterService name="apikey-admin", prefix="/admin/apikeys", middlewares=["lokstra-auth"]
+type APIKeyService struct {
+	// @Inject "lokstra-auth"
+	Auth *service.Cached[*lokstraauth.Auth]
+
+	// @Inject "apikey-store"
+	Store *service.Cached[apikey.KeyStore]
+}
+
+// ListAPIKeys returns the API keys of a user
+// @Route "GET /users/{user_id}/keys"
+func (s *APIKeyService) ListAPIKeys(c *request.Context, p *ListAPIKeysRequest) ([]*APIKeyInfo, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionAPIKeyRead); err != nil {
+		return nil, err
+	}
+
+	lister, ok := s.Store.MustGet().(apikey.KeyLister)
+	if !ok {
+		return nil, fail(c, fmt.Errorf("%w: the key store cannot list keys", ErrInvalidRequest))
+	}
+	keys, err := lister.ListByUser(c, p.UserID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+
+	infos := make([]*APIKeyInfo, len(keys))
+	for i, key := range keys {
+		infos[i] = apiKeyInfo(key)
+	}
+	return infos, nil
+}
+
+// CreateAPIKey generates an API key for a user
+// @Route "POST /users/{user_id}/keys"
+func (s *APIKeyService) CreateAPIKey(c *request.Context, p *CreateAPIKeyRequest) (*CreatedAPIKey, error) {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionAPIKeyWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresIn *time.Duration
+	if p.ExpiresIn != "" {
+		duration, err := time.ParseDuration(p.ExpiresIn)
+		if err != nil || duration <= 0 {
+			return nil, fail(c, fmt.Errorf("%w: expires_in must be a positive duration", ErrInvalidRequest))
+		}
+		expiresIn = &duration
+	}
+
+	generator := apikey.NewAuthenticator(&apikey.Config{KeyStore: s.Store.MustGet()})
+	key, created, err := generator.GenerateKey(c, p.UserID, p.Name, nonEmpty(p.Scopes), expiresIn)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	record(c, auth, identity, audit.EventAPIKeyCreated, "apikey:"+created.ID, map[string]any{"user_id": p.UserID, "name": p.Name})
+	return &CreatedAPIKey{Key: key, APIKey: apiKeyInfo(created)}, nil
+}
+
+// RevokeAPIKey revokes an API key
+// @Route "DELETE /keys/{key_id}"
+func (s *APIKeyService) RevokeAPIKey(c *request.Context, p *RevokeAPIKeyRequest) error {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionAPIKeyWrite)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.MustGet().Revoke(c, p.KeyID); err != nil {
+		return fail(c, err)
+	}
+	record(c, auth, identity, audit.EventAPIKeyRevoked, "apikey:"+p.KeyID, nil)
+	return nil
+}
+
+// apiKeyInfo returns the view of an API key
+func apiKeyInfo(key *apikey.APIKey) *APIKeyInfo {
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &APIKeyInfo{
+		ID:        key.ID,
+		Prefix:    key.Prefix,
+		UserID:    key.UserID,
+		Name:      key.Name,
+		Scopes:    scopes,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+		LastUsed:  key.LastUsed,
+		Revoked:   key.Revoked,
+		RevokedAt: key.RevokedAt,
+	}
+}
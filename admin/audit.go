@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra/core/request"
+	"github.com/primadi/lokstra/core/service"
+)
+
+// Permissions required by the audit admin API ("audit:*" grants them all)
+const (
+	PermissionAuditRead   = "audit:log:read"
+	PermissionAuditExport = "audit:log:export"
+)
+
+// SearchLogsRequest selects audit log entries of the caller's tenant. Since
+// and Until are RFC 3339 timestamps; event types ending in "*" match a
+// prefix ("rbac.*").
+type SearchLogsRequest struct {
+	AppID      string   `query:"app_id"`
+	ActorID    string   `query:"actor_id"`
+	SubjectID  string   `query:"subject_id"`
+	EventTypes []string `query:"event_type"`
+	Result     string   `query:"result"`
+	Since      string   `query:"since"`
+	Until      string   `query:"until"`
+	Cursor     string   `query:"cursor"`
+	Limit      int      `query:"limit" validate:"max=1000"`
+}
+
+// ExportLogsRequest exports the audit log entries selected by the filters
+// of SearchLogsRequest as CSV or JSON (default: csv)
+type ExportLogsRequest struct {
+	SearchLogsRequest
+	Format string `query:"format"`
+}
+
+// AuditService is the audit log API for compliance reviews: searching and
+// exporting the audit log of the caller's tenant, backed by an
+// audit.AuditLogStore registered as "audit-store".
+//
+// @RouterService name="audit-admin", prefix="/admin/audit", middlewares=["lokstra-auth"]
+type AuditService struct {
+	// @Inject "lokstra-auth"
+	Auth *service.Cached[*lokstraauth.Auth]
+
+	// @Inject "audit-store"
+	Store *service.Cached[audit.AuditLogStore]
+}
+
+// SearchLogs returns a page of audit log entries; pass next_cursor as the
+// cursor of the next request to continue
+// @Route "GET /logs"
+func (s *AuditService) SearchLogs(c *request.Context, p *SearchLogsRequest) (*audit.QueryResult, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionAuditRead); err != nil {
+		return nil, err
+	}
+
+	query, err := p.query(c)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	result, err := audit.Search(c, s.Store.MustGet(), query)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return result, nil
+}
+
+// ExportLogs streams every selected audit log entry as a CSV or JSON
+// attachment, starting at the cursor
+// @Route "GET /logs/export"
+func (s *AuditService) ExportLogs(c *request.Context, p *ExportLogsRequest) error {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionAuditExport); err != nil {
+		return err
+	}
+
+	format, contentType := p.Format, "text/csv; charset=utf-8"
+	switch format {
+	case "", audit.FormatCSV:
+		format = audit.FormatCSV
+	case audit.FormatJSON:
+		contentType = "application/json"
+	default:
+		return fail(c, fmt.Errorf("%w: %q", audit.ErrUnsupportedFormat, p.Format))
+	}
+
+	query, err := p.query(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	// Validate the query before the response starts
+	probe := *query
+	probe.Limit = 1
+	if _, err := audit.Search(c, s.Store.MustGet(), &probe); err != nil {
+		return fail(c, err)
+	}
+
+	filename := fmt.Sprintf("audit-log-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Resp.RespHeaders = map[string][]string{
+		"Content-Disposition": {fmt.Sprintf("attachment; filename=%q", filename)},
+	}
+	return c.Resp.Stream(contentType, func(w http.ResponseWriter) error {
+		_, err := audit.ExportEntries(c, w, s.Store.MustGet(), query, format)
+		return err
+	})
+}
+
+// query converts the request to an audit query of the caller's tenant
+func (p *SearchLogsRequest) query(c *request.Context) (*audit.Query, error) {
+	query := &audit.Query{
+		TenantID:   authz.TenantFromContext(c),
+		AppID:      p.AppID,
+		ActorID:    p.ActorID,
+		SubjectID:  p.SubjectID,
+		EventTypes: nonEmpty(p.EventTypes),
+		Result:     p.Result,
+		Cursor:     p.Cursor,
+		Limit:      p.Limit,
+	}
+
+	var err error
+	if p.Since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, p.Since); err != nil {
+			return nil, fmt.Errorf("%w: since must be an RFC 3339 timestamp", ErrInvalidRequest)
+		}
+	}
+	if p.Until != "" {
+		if query.Until, err = time.Parse(time.RFC3339, p.Until); err != nil {
+			return nil, fmt.Errorf("%w: until must be an RFC 3339 timestamp", ErrInvalidRequest)
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,405 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/policy"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra/core/request"
+	"github.com/primadi/lokstra/core/service"
+)
+
+// Permissions required by the policy admin API ("policy:*" grants them all)
+const (
+	PermissionPolicyRead     = "policy:read"
+	PermissionPolicyWrite    = "policy:write"
+	PermissionPolicySimulate = "policy:simulate"
+)
+
+// ListPoliciesRequest lists policies
+type ListPoliciesRequest struct {
+	Page     int    `query:"page"`
+	PageSize int    `query:"page_size" validate:"max=100"`
+	Search   string `query:"search"`
+}
+
+// PolicyRequest selects a policy
+type PolicyRequest struct {
+	ID string `path:"id" validate:"required"`
+}
+
+// PolicyDocumentRequest carries a policy document (see policy.Schema) as the
+// request body
+type PolicyDocumentRequest struct {
+	Document map[string]any `json:"*"`
+}
+
+// UpdatePolicyRequest replaces a policy. The document ID defaults to the
+// path ID and must match it.
+type UpdatePolicyRequest struct {
+	ID       string         `path:"id" json:"-" validate:"required"`
+	Document map[string]any `json:"*"`
+}
+
+// SimulatePolicyRequest carries a simulation (see SimulationInput) as the
+// request body
+type SimulatePolicyRequest struct {
+	Body map[string]any `json:"*"`
+}
+
+// SimulationInput are the proposed changes and the requests to evaluate
+// before and after them
+type SimulationInput struct {
+	Changes  []SimulationChange  `json:"changes"`
+	Requests []SimulationRequest `json:"requests"`
+}
+
+// SimulationChange is a proposed change: "create" or "update" with a policy
+// document, or "delete" with an ID
+type SimulationChange struct {
+	Op     string          `json:"op"`
+	Policy json.RawMessage `json:"policy,omitempty"`
+	ID     string          `json:"id,omitempty"`
+}
+
+// SimulationRequest is an authorization request to evaluate
+type SimulationRequest struct {
+	SubjectID          string         `json:"subject_id"`
+	Roles              []string       `json:"roles,omitempty"`
+	ResourceType       string         `json:"resource_type"`
+	ResourceID         string         `json:"resource_id"`
+	ResourceAttributes map[string]any `json:"resource_attributes,omitempty"`
+	Action             string         `json:"action"`
+	Context            map[string]any `json:"context,omitempty"`
+}
+
+// SimulationDecision is a decision of a simulated request
+type SimulationDecision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// SimulationDiff is a request whose decision changes
+type SimulationDiff struct {
+	Request SimulationRequest  `json:"request"`
+	Before  SimulationDecision `json:"before"`
+	After   SimulationDecision `json:"after"`
+}
+
+// SimulationFailure is a request that failed to evaluate
+type SimulationFailure struct {
+	Request SimulationRequest `json:"request"`
+	Error   string            `json:"error"`
+}
+
+// SimulationResult is the outcome of a simulation
+type SimulationResult struct {
+	Total        int                 `json:"total"`
+	Unchanged    int                 `json:"unchanged"`
+	NewlyAllowed []SimulationDiff    `json:"newly_allowed"`
+	NewlyDenied  []SimulationDiff    `json:"newly_denied"`
+	Errors       []SimulationFailure `json:"errors"`
+}
+
+// PolicyValidation is the result of a valid policy document
+type PolicyValidation struct {
+	Valid  bool             `json:"valid"`
+	Policy *policy.Document `json:"policy"`
+}
+
+// PolicyService is the policy management API over the policy store of the
+// deployment. Policy documents are validated against policy.Schema;
+// malformed documents are rejected with a 400 listing every violation
+// (field, code and message).
+//
+// @RouterService name="policy-admin", prefix="/admin/policy", middlewares=["lokstra-auth"]
+type PolicyService struct {
+	// @Inject "lokstra-auth"
+	Auth *service.Cached[*lokstraauth.Auth]
+
+	// @Inject "policy-store"
+	Store *service.Cached[authz.PolicyStore]
+}
+
+// ListPolicies returns a page of policies sorted by ID
+// @Route "GET /policies"
+func (s *PolicyService) ListPolicies(c *request.Context, p *ListPoliciesRequest) (*Page[*policy.Document], error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionPolicyRead); err != nil {
+		return nil, err
+	}
+
+	policies, err := s.Store.MustGet().List(c)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	opts, page, pageSize := pageOptions(p.Page, p.PageSize, p.Search)
+	documents := make([]*policy.Document, 0, len(policies))
+	for _, found := range policies {
+		if matchesPolicy(found, opts.Search) {
+			documents = append(documents, policy.DocumentOf(found))
+		}
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].ID < documents[j].ID })
+
+	start := min(opts.Offset, len(documents))
+	end := min(start+opts.Limit, len(documents))
+	return newPage(documents[start:end], len(documents), page, pageSize), nil
+}
+
+// GetPolicy returns a policy document
+// @Route "GET /policies/{id}"
+func (s *PolicyService) GetPolicy(c *request.Context, p *PolicyRequest) (*policy.Document, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionPolicyRead); err != nil {
+		return nil, err
+	}
+	return s.document(c, p.ID)
+}
+
+// CreatePolicy validates and creates a policy
+// @Route "POST /policies"
+func (s *PolicyService) CreatePolicy(c *request.Context, p *PolicyDocumentRequest) (*policy.Document, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionPolicyWrite); err != nil {
+		return nil, err
+	}
+
+	created, err := parsePolicy(p.Document)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	if err := s.Store.MustGet().Create(c, created); err != nil {
+		return nil, fail(c, err)
+	}
+	s.policyChanged(c, created.ID, "created")
+	return s.document(c, created.ID)
+}
+
+// UpdatePolicy validates and replaces a policy
+// @Route "PUT /policies/{id}"
+func (s *PolicyService) UpdatePolicy(c *request.Context, p *UpdatePolicyRequest) (*policy.Document, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionPolicyWrite); err != nil {
+		return nil, err
+	}
+
+	document := p.Document
+	if document == nil {
+		document = map[string]any{}
+	}
+	if id, ok := document["id"]; !ok {
+		document["id"] = p.ID
+	} else if id != p.ID {
+		return nil, fail(c, fmt.Errorf("%w: policy id %v does not match the path", ErrInvalidRequest, id))
+	}
+	updated, err := parsePolicy(document)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	if err := s.Store.MustGet().Update(c, updated); err != nil {
+		return nil, fail(c, err)
+	}
+	s.policyChanged(c, p.ID, "updated")
+	return s.document(c, p.ID)
+}
+
+// DeletePolicy deletes a policy
+// @Route "DELETE /policies/{id}"
+func (s *PolicyService) DeletePolicy(c *request.Context, p *PolicyRequest) error {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionPolicyWrite); err != nil {
+		return err
+	}
+
+	if err := s.Store.MustGet().Delete(c, p.ID); err != nil {
+		return fail(c, err)
+	}
+	s.policyChanged(c, p.ID, "deleted")
+	return nil
+}
+
+// policyChanged publishes a policy change
+func (s *PolicyService) policyChanged(c *request.Context, policyID, change string) {
+	s.Auth.MustGet().Publish(c, &events.Event{
+		Type: events.PolicyChanged,
+		Data: map[string]any{"policy_id": policyID, "change": change},
+	})
+}
+
+// ValidatePolicy validates a policy document without storing it
+// @Route "POST /validate"
+func (s *PolicyService) ValidatePolicy(c *request.Context, p *PolicyDocumentRequest) (*PolicyValidation, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionPolicyRead); err != nil {
+		return nil, err
+	}
+
+	validated, err := parsePolicy(p.Document)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return &PolicyValidation{Valid: true, Policy: policy.DocumentOf(validated)}, nil
+}
+
+// Schema returns the JSON schema of policy documents
+// @Route "GET /schema"
+func (s *PolicyService) Schema(c *request.Context) (json.RawMessage, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionPolicyRead); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(policy.Schema), nil
+}
+
+// SimulatePolicies reports the decisions that proposed changes would change,
+// without modifying the store
+// @Route "POST /simulate"
+func (s *PolicyService) SimulatePolicies(c *request.Context, p *SimulatePolicyRequest) (*SimulationResult, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionPolicySimulate); err != nil {
+		return nil, err
+	}
+
+	var input SimulationInput
+	if err := remarshal(p.Body, &input); err != nil {
+		return nil, fail(c, err)
+	}
+	changes := make([]policy.Change, len(input.Changes))
+	for i, change := range input.Changes {
+		parsed, err := parseChange(change)
+		if err != nil {
+			return nil, fail(c, prefixFields(err, fmt.Sprintf("changes.%d", i)))
+		}
+		changes[i] = parsed
+	}
+	requests := make([]*authz.AuthorizationRequest, len(input.Requests))
+	for i, simulated := range input.Requests {
+		requests[i] = simulated.authorizationRequest()
+	}
+
+	report, err := policy.NewSimulator(s.Store.MustGet(), nil).Simulate(c, changes, requests)
+	if err != nil {
+		return nil, fail(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+	}
+	return simulationResult(report, input.Requests, requests), nil
+}
+
+func (s *PolicyService) document(c *request.Context, policyID string) (*policy.Document, error) {
+	found, err := s.Store.MustGet().Get(c, policyID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return policy.DocumentOf(found), nil
+}
+
+// parsePolicy validates a bound policy document
+func parsePolicy(document map[string]any) (*authz.Policy, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return policy.ParseDocument(data)
+}
+
+// parseChange validates a proposed change
+func parseChange(change SimulationChange) (policy.Change, error) {
+	switch policy.ChangeOp(change.Op) {
+	case policy.ChangeCreate, policy.ChangeUpdate:
+		parsed, err := policy.ParseDocument(change.Policy)
+		if err != nil {
+			return policy.Change{}, prefixFields(err, "policy")
+		}
+		if policy.ChangeOp(change.Op) == policy.ChangeCreate {
+			return policy.CreatePolicy(parsed), nil
+		}
+		return policy.UpdatePolicy(parsed), nil
+	case policy.ChangeDelete:
+		if change.ID == "" {
+			return policy.Change{}, fmt.Errorf("%w: delete requires an id", ErrInvalidRequest)
+		}
+		return policy.DeletePolicy(change.ID), nil
+	}
+	return policy.Change{}, fmt.Errorf("%w: unknown op %q (create, update or delete)", ErrInvalidRequest, change.Op)
+}
+
+// prefixFields prefixes the fields of a policy validation error with the
+// path of the document in the request
+func prefixFields(err error, prefix string) error {
+	violations, ok := err.(*policy.ValidationError)
+	if !ok {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+	prefixed := &policy.ValidationError{Errors: make([]policy.FieldError, len(violations.Errors))}
+	for i, fieldError := range violations.Errors {
+		if fieldError.Field == policy.RootField {
+			fieldError.Field = prefix
+		} else {
+			fieldError.Field = prefix + "." + fieldError.Field
+		}
+		prefixed.Errors[i] = fieldError
+	}
+	return prefixed
+}
+
+// remarshal decodes a bound JSON body into v
+func remarshal(body map[string]any, v any) error {
+	data, err := json.Marshal(body)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return nil
+}
+
+// matchesPolicy reports whether the ID or name of a policy contains search
+// (case-insensitive)
+func matchesPolicy(found *authz.Policy, search string) bool {
+	search = strings.ToLower(search)
+	return strings.Contains(strings.ToLower(found.ID), search) || strings.Contains(strings.ToLower(found.Name), search)
+}
+
+// authorizationRequest converts a simulated request
+func (r SimulationRequest) authorizationRequest() *authz.AuthorizationRequest {
+	return &authz.AuthorizationRequest{
+		Subject: &subject.IdentityContext{
+			Subject: &subject.Subject{ID: r.SubjectID},
+			Roles:   r.Roles,
+		},
+		Resource: &authz.Resource{Type: r.ResourceType, ID: r.ResourceID, Attributes: r.ResourceAttributes},
+		Action:   authz.Action(r.Action),
+		Context:  r.Context,
+	}
+}
+
+// simulationResult converts a simulation report, reporting the requests as
+// they were submitted
+func simulationResult(report *policy.SimulationReport, inputs []SimulationRequest, requests []*authz.AuthorizationRequest) *SimulationResult {
+	inputOf := make(map[*authz.AuthorizationRequest]SimulationRequest, len(requests))
+	for i, request := range requests {
+		inputOf[request] = inputs[i]
+	}
+	diffs := func(diffs []policy.DecisionDiff) []SimulationDiff {
+		result := make([]SimulationDiff, len(diffs))
+		for i, diff := range diffs {
+			result[i] = SimulationDiff{
+				Request: inputOf[diff.Request],
+				Before:  SimulationDecision{Allowed: diff.Before.Allowed, Reason: diff.Before.Reason},
+				After:   SimulationDecision{Allowed: diff.After.Allowed, Reason: diff.After.Reason},
+			}
+		}
+		return result
+	}
+
+	result := &SimulationResult{
+		Total:        report.Total,
+		Unchanged:    report.Unchanged,
+		NewlyAllowed: diffs(report.NewlyAllowed),
+		NewlyDenied:  diffs(report.NewlyDenied),
+		Errors:       make([]SimulationFailure, len(report.Errors)),
+	}
+	for i, failure := range report.Errors {
+		result.Errors[i] = SimulationFailure{Request: inputOf[failure.Request], Error: failure.Err.Error()}
+	}
+	return result
+}
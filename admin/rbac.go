@@ -0,0 +1,451 @@
+package admin
+
+import (
+	"fmt"
+	"strings"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/permission"
+	"github.com/primadi/lokstra/core/request"
+	"github.com/primadi/lokstra/core/service"
+)
+
+// Permissions required by the RBAC admin API ("rbac:*" grants them all)
+const (
+	PermissionRBACRoleRead        = "rbac:role:read"
+	PermissionRBACRoleWrite       = "rbac:role:write"
+	PermissionRBACPermissionRead  = "rbac:permission:read"
+	PermissionRBACPermissionWrite = "rbac:permission:write"
+	PermissionRBACAssignmentRead  = "rbac:assignment:read"
+	PermissionRBACAssignmentWrite = "rbac:assignment:write"
+)
+
+// ListRolesRequest lists roles
+type ListRolesRequest struct {
+	Page     int    `query:"page"`
+	PageSize int    `query:"page_size" validate:"max=100"`
+	Search   string `query:"search"`
+}
+
+// GetRoleRequest selects a role
+type GetRoleRequest struct {
+	Name string `path:"name" validate:"required"`
+}
+
+// CreateRoleRequest creates a role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required,max=128"`
+	Description string   `json:"description" validate:"max=1024"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest updates a role
+type UpdateRoleRequest struct {
+	Name        string `path:"name" json:"-" validate:"required"`
+	Description string `json:"description" validate:"max=1024"`
+}
+
+// GrantPermissionsRequest grants permissions to a role
+type GrantPermissionsRequest struct {
+	Name        string   `path:"name" json:"-" validate:"required"`
+	Permissions []string `json:"permissions" validate:"required"`
+}
+
+// RevokePermissionRequest revokes a permission from a role
+type RevokePermissionRequest struct {
+	Name       string `path:"name" validate:"required"`
+	Permission string `path:"permission" validate:"required"`
+}
+
+// ListRoleSubjectsRequest lists the subjects of a role
+type ListRoleSubjectsRequest struct {
+	Name     string `path:"name" validate:"required"`
+	Page     int    `query:"page"`
+	PageSize int    `query:"page_size" validate:"max=100"`
+	Search   string `query:"search"`
+}
+
+// ListPermissionsRequest lists the permission catalog
+type ListPermissionsRequest struct {
+	Page     int    `query:"page"`
+	PageSize int    `query:"page_size" validate:"max=100"`
+	Search   string `query:"search"`
+}
+
+// GetPermissionRequest selects a permission of the catalog
+type GetPermissionRequest struct {
+	Name string `path:"name" validate:"required"`
+}
+
+// CreatePermissionRequest adds a permission to the catalog
+type CreatePermissionRequest struct {
+	Name        string `json:"name" validate:"required,max=128"`
+	Description string `json:"description" validate:"max=1024"`
+}
+
+// SubjectRolesRequest selects the roles of a subject
+type SubjectRolesRequest struct {
+	SubjectID string `path:"subject_id" validate:"required"`
+}
+
+// AssignRoleRequest assigns a role to a subject
+type AssignRoleRequest struct {
+	SubjectID string `path:"subject_id" validate:"required"`
+	Role      string `json:"role" validate:"required"`
+}
+
+// UnassignRoleRequest removes a role from a subject
+type UnassignRoleRequest struct {
+	SubjectID string `path:"subject_id" validate:"required"`
+	Role      string `path:"role" validate:"required"`
+}
+
+// SubjectRoles are the roles of a subject
+type SubjectRoles struct {
+	SubjectID string   `json:"subject_id"`
+	Roles     []string `json:"roles"`
+}
+
+// RBACService is the RBAC management API: roles, the permission catalog,
+// role permissions and subject role assignments of the caller's tenant.
+//
+// Callers cannot grant more than they have: granting a permission requires
+// holding it, and assigning a role requires holding every permission of the
+// role. Permissions granted to roles must be in the catalog unless they are
+// wildcard patterns.
+//
+// @RouterService name="rbac-admin", prefix="/admin/rbac", middlewares=["lokstra-auth"]
+type RBACService struct {
+	// @Inject "lokstra-auth"
+	Auth *service.Cached[*lokstraauth.Auth]
+
+	// @Inject "rbac-store"
+	Store *service.Cached[rbac.Store]
+}
+
+// ListRoles returns a page of roles
+// @Route "GET /roles"
+func (s *RBACService) ListRoles(c *request.Context, p *ListRolesRequest) (*Page[*rbac.Role], error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionRBACRoleRead); err != nil {
+		return nil, err
+	}
+
+	opts, page, pageSize := pageOptions(p.Page, p.PageSize, p.Search)
+	roles, total, err := s.Store.MustGet().ListRoles(c, opts)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return newPage(roles, total, page, pageSize), nil
+}
+
+// GetRole returns a role with its permissions
+// @Route "GET /roles/{name}"
+func (s *RBACService) GetRole(c *request.Context, p *GetRoleRequest) (*rbac.Role, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionRBACRoleRead); err != nil {
+		return nil, err
+	}
+
+	role, err := s.Store.MustGet().GetRole(c, p.Name)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return role, nil
+}
+
+// CreateRole creates a role, optionally with permissions
+// @Route "POST /roles"
+func (s *RBACService) CreateRole(c *request.Context, p *CreateRoleRequest) (*rbac.Role, error) {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACRoleWrite)
+	if err != nil {
+		return nil, err
+	}
+	permissions := nonEmpty(p.Permissions)
+	if err := s.checkGrantable(c, identity, permissions); err != nil {
+		return nil, fail(c, err)
+	}
+
+	store := s.Store.MustGet()
+	if err := store.CreateRole(c, &rbac.Role{Name: p.Name, Description: p.Description, Permissions: permissions}); err != nil {
+		return nil, fail(c, err)
+	}
+	record(c, auth, identity, audit.EventRoleCreated, "role:"+p.Name, map[string]any{"permissions": permissions})
+
+	role, err := store.GetRole(c, p.Name)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return role, nil
+}
+
+// UpdateRole updates the description of a role
+// @Route "PUT /roles/{name}"
+func (s *RBACService) UpdateRole(c *request.Context, p *UpdateRoleRequest) (*rbac.Role, error) {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACRoleWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	store := s.Store.MustGet()
+	if err := store.UpdateRole(c, &rbac.Role{Name: p.Name, Description: p.Description}); err != nil {
+		return nil, fail(c, err)
+	}
+	record(c, auth, identity, audit.EventRoleUpdated, "role:"+p.Name, nil)
+
+	role, err := store.GetRole(c, p.Name)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return role, nil
+}
+
+// DeleteRole deletes a role and its assignments
+// @Route "DELETE /roles/{name}"
+func (s *RBACService) DeleteRole(c *request.Context, p *GetRoleRequest) error {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACRoleWrite)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.MustGet().DeleteRole(c, p.Name); err != nil {
+		return fail(c, err)
+	}
+	record(c, auth, identity, audit.EventRoleDeleted, "role:"+p.Name, nil)
+	return nil
+}
+
+// GrantPermissions grants permissions to a role
+// @Route "POST /roles/{name}/permissions"
+func (s *RBACService) GrantPermissions(c *request.Context, p *GrantPermissionsRequest) (*rbac.Role, error) {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACRoleWrite)
+	if err != nil {
+		return nil, err
+	}
+	permissions := nonEmpty(p.Permissions)
+	if len(permissions) == 0 {
+		return nil, fail(c, fmt.Errorf("%w: no permissions", ErrInvalidRequest))
+	}
+	if err := s.checkGrantable(c, identity, permissions); err != nil {
+		return nil, fail(c, err)
+	}
+
+	store := s.Store.MustGet()
+	for _, perm := range permissions {
+		if err := store.GrantPermission(c, p.Name, perm); err != nil {
+			return nil, fail(c, err)
+		}
+	}
+	record(c, auth, identity, audit.EventPermissionGranted, "role:"+p.Name, map[string]any{"permissions": permissions})
+
+	role, err := store.GetRole(c, p.Name)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return role, nil
+}
+
+// RevokePermission revokes a permission from a role
+// @Route "DELETE /roles/{name}/permissions/{permission}"
+func (s *RBACService) RevokePermission(c *request.Context, p *RevokePermissionRequest) (*rbac.Role, error) {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACRoleWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	store := s.Store.MustGet()
+	if err := store.RevokePermission(c, p.Name, p.Permission); err != nil {
+		return nil, fail(c, err)
+	}
+	record(c, auth, identity, audit.EventPermissionRevoked, "role:"+p.Name, map[string]any{"permission": p.Permission})
+
+	role, err := store.GetRole(c, p.Name)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return role, nil
+}
+
+// ListRoleSubjects returns a page of the subjects assigned to a role
+// @Route "GET /roles/{name}/subjects"
+func (s *RBACService) ListRoleSubjects(c *request.Context, p *ListRoleSubjectsRequest) (*Page[string], error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionRBACAssignmentRead); err != nil {
+		return nil, err
+	}
+
+	opts, page, pageSize := pageOptions(p.Page, p.PageSize, p.Search)
+	subjects, total, err := s.Store.MustGet().ListRoleSubjects(c, p.Name, opts)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return newPage(subjects, total, page, pageSize), nil
+}
+
+// ListPermissions returns a page of the permission catalog
+// @Route "GET /permissions"
+func (s *RBACService) ListPermissions(c *request.Context, p *ListPermissionsRequest) (*Page[*rbac.Permission], error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionRBACPermissionRead); err != nil {
+		return nil, err
+	}
+
+	opts, page, pageSize := pageOptions(p.Page, p.PageSize, p.Search)
+	permissions, total, err := s.Store.MustGet().ListPermissions(c, opts)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return newPage(permissions, total, page, pageSize), nil
+}
+
+// GetPermission returns a permission of the catalog
+// @Route "GET /permissions/{name}"
+func (s *RBACService) GetPermission(c *request.Context, p *GetPermissionRequest) (*rbac.Permission, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionRBACPermissionRead); err != nil {
+		return nil, err
+	}
+
+	perm, err := s.Store.MustGet().GetPermission(c, p.Name)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return perm, nil
+}
+
+// CreatePermission adds a permission to the catalog
+// @Route "POST /permissions"
+func (s *RBACService) CreatePermission(c *request.Context, p *CreatePermissionRequest) (*rbac.Permission, error) {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACPermissionWrite)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(p.Name, permission.Wildcard) {
+		return nil, fail(c, fmt.Errorf("%w: catalog permissions cannot contain wildcards", ErrInvalidRequest))
+	}
+
+	store := s.Store.MustGet()
+	if err := store.CreatePermission(c, &rbac.Permission{Name: p.Name, Description: p.Description}); err != nil {
+		return nil, fail(c, err)
+	}
+	record(c, auth, identity, audit.EventPermissionCreated, "permission:"+p.Name, nil)
+
+	perm, err := store.GetPermission(c, p.Name)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return perm, nil
+}
+
+// DeletePermission removes a permission from the catalog and every role
+// @Route "DELETE /permissions/{name}"
+func (s *RBACService) DeletePermission(c *request.Context, p *GetPermissionRequest) error {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACPermissionWrite)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.MustGet().DeletePermission(c, p.Name); err != nil {
+		return fail(c, err)
+	}
+	record(c, auth, identity, audit.EventPermissionDeleted, "permission:"+p.Name, nil)
+	return nil
+}
+
+// ListSubjectRoles returns the roles assigned to a subject
+// @Route "GET /subjects/{subject_id}/roles"
+func (s *RBACService) ListSubjectRoles(c *request.Context, p *SubjectRolesRequest) (*SubjectRoles, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionRBACAssignmentRead); err != nil {
+		return nil, err
+	}
+	return s.subjectRoles(c, p.SubjectID)
+}
+
+// AssignRole assigns a role to a subject
+// @Route "POST /subjects/{subject_id}/roles"
+func (s *RBACService) AssignRole(c *request.Context, p *AssignRoleRequest) (*SubjectRoles, error) {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACAssignmentWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	store := s.Store.MustGet()
+	role, err := store.GetRole(c, p.Role)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	if err := s.checkHeld(c, identity, role.Permissions); err != nil {
+		return nil, fail(c, err)
+	}
+	if err := store.AssignRole(c, p.SubjectID, p.Role); err != nil {
+		return nil, fail(c, err)
+	}
+	record(c, auth, identity, audit.EventRoleAssigned, "subject:"+p.SubjectID, map[string]any{"role": p.Role})
+	auth.Publish(c, &events.Event{Type: events.RoleAssigned, SubjectID: p.SubjectID, Data: map[string]any{"role": p.Role}})
+	return s.subjectRoles(c, p.SubjectID)
+}
+
+// UnassignRole removes a role from a subject
+// @Route "DELETE /subjects/{subject_id}/roles/{role}"
+func (s *RBACService) UnassignRole(c *request.Context, p *UnassignRoleRequest) (*SubjectRoles, error) {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, PermissionRBACAssignmentWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Store.MustGet().UnassignRole(c, p.SubjectID, p.Role); err != nil {
+		return nil, fail(c, err)
+	}
+	record(c, auth, identity, audit.EventRoleUnassigned, "subject:"+p.SubjectID, map[string]any{"role": p.Role})
+	return s.subjectRoles(c, p.SubjectID)
+}
+
+// subjectRoles returns the roles of a subject
+func (s *RBACService) subjectRoles(c *request.Context, subjectID string) (*SubjectRoles, error) {
+	roles, err := s.Store.MustGet().ListSubjectRoles(c, subjectID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return &SubjectRoles{SubjectID: subjectID, Roles: roles}, nil
+}
+
+// checkGrantable checks that permissions are valid, in the catalog (unless
+// wildcard patterns), and held by the caller
+func (s *RBACService) checkGrantable(c *request.Context, identity *subject.IdentityContext, permissions []string) error {
+	store := s.Store.MustGet()
+	for _, perm := range permissions {
+		if err := rbac.ValidateName(perm); err != nil {
+			return err
+		}
+		if !strings.Contains(perm, permission.Wildcard) {
+			if _, err := store.GetPermission(c, perm); err != nil {
+				return err
+			}
+		}
+	}
+	return s.checkHeld(c, identity, permissions)
+}
+
+// checkHeld checks that the caller holds every permission, so it cannot
+// grant more than it has
+func (s *RBACService) checkHeld(c *request.Context, identity *subject.IdentityContext, permissions []string) error {
+	auth := s.Auth.MustGet()
+	for _, perm := range permissions {
+		held, err := auth.CheckPermission(c, identity, perm)
+		if err != nil {
+			return err
+		}
+		if !held {
+			return fmt.Errorf("%w: cannot grant %s, which the caller does not hold", ErrForbidden, perm)
+		}
+	}
+	return nil
+}
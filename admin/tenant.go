@@ -0,0 +1,806 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	"github.com/primadi/lokstra-auth/01_credential/basic"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/identitychange"
+	"github.com/primadi/lokstra-auth/middleware"
+	"github.com/primadi/lokstra-auth/tenant"
+	"github.com/primadi/lokstra/core/request"
+	"github.com/primadi/lokstra/core/service"
+)
+
+// Permissions required by the tenant admin API ("tenant:*" grants them all).
+// Tenant read/write are platform permissions: they manage tenants and
+// administer the apps, branches and users of any tenant. The other
+// permissions administer the caller's own tenant.
+const (
+	PermissionTenantRead  = "tenant:tenant:read"
+	PermissionTenantWrite = "tenant:tenant:write"
+	PermissionAppRead     = "tenant:app:read"
+	PermissionAppWrite    = "tenant:app:write"
+	PermissionBranchRead  = "tenant:branch:read"
+	PermissionBranchWrite = "tenant:branch:write"
+	PermissionUserRead    = "tenant:user:read"
+	PermissionUserWrite   = "tenant:user:write"
+)
+
+// ListTenantsRequest lists tenants
+type ListTenantsRequest struct {
+	Page           int    `query:"page"`
+	PageSize       int    `query:"page_size" validate:"max=100"`
+	Search         string `query:"search"`
+	IncludeDeleted bool   `query:"include_deleted"`
+}
+
+// TenantRequest selects a tenant
+type TenantRequest struct {
+	TenantID string `path:"tenant_id" validate:"required"`
+}
+
+// CreateTenantRequest creates a tenant (an empty ID is generated)
+type CreateTenantRequest struct {
+	ID       string   `json:"id" validate:"max=64"`
+	Name     string   `json:"name" validate:"required,max=256"`
+	Status   string   `json:"status" validate:"oneof=active suspended"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// UpdateTenantRequest updates a tenant (an empty status is kept)
+type UpdateTenantRequest struct {
+	TenantID string   `path:"tenant_id" validate:"required"`
+	Name     string   `json:"name" validate:"required,max=256"`
+	Status   string   `json:"status" validate:"oneof=active suspended"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// ListAppsRequest lists the apps of a tenant
+type ListAppsRequest struct {
+	TenantID       string `path:"tenant_id" validate:"required"`
+	Page           int    `query:"page"`
+	PageSize       int    `query:"page_size" validate:"max=100"`
+	Search         string `query:"search"`
+	IncludeDeleted bool   `query:"include_deleted"`
+}
+
+// AppRequest selects an app
+type AppRequest struct {
+	TenantID string `path:"tenant_id" validate:"required"`
+	AppID    string `path:"app_id" validate:"required"`
+}
+
+// CreateAppRequest creates an app (an empty ID is generated)
+type CreateAppRequest struct {
+	TenantID string   `path:"tenant_id" validate:"required"`
+	ID       string   `json:"id" validate:"max=64"`
+	Name     string   `json:"name" validate:"required,max=256"`
+	Status   string   `json:"status" validate:"oneof=active suspended"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// UpdateAppRequest updates an app (an empty status is kept)
+type UpdateAppRequest struct {
+	TenantID string   `path:"tenant_id" validate:"required"`
+	AppID    string   `path:"app_id" validate:"required"`
+	Name     string   `json:"name" validate:"required,max=256"`
+	Status   string   `json:"status" validate:"oneof=active suspended"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// ListBranchesRequest lists the branches of an app
+type ListBranchesRequest struct {
+	TenantID       string `path:"tenant_id" validate:"required"`
+	AppID          string `path:"app_id" validate:"required"`
+	Page           int    `query:"page"`
+	PageSize       int    `query:"page_size" validate:"max=100"`
+	Search         string `query:"search"`
+	IncludeDeleted bool   `query:"include_deleted"`
+}
+
+// BranchRequest selects a branch
+type BranchRequest struct {
+	TenantID string `path:"tenant_id" validate:"required"`
+	AppID    string `path:"app_id" validate:"required"`
+	BranchID string `path:"branch_id" validate:"required"`
+}
+
+// CreateBranchRequest creates a branch (an empty ID is generated)
+type CreateBranchRequest struct {
+	TenantID string   `path:"tenant_id" validate:"required"`
+	AppID    string   `path:"app_id" validate:"required"`
+	ID       string   `json:"id" validate:"max=64"`
+	Name     string   `json:"name" validate:"required,max=256"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// UpdateBranchRequest updates a branch
+type UpdateBranchRequest struct {
+	TenantID string   `path:"tenant_id" validate:"required"`
+	AppID    string   `path:"app_id" validate:"required"`
+	BranchID string   `path:"branch_id" validate:"required"`
+	Name     string   `json:"name" validate:"required,max=256"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// ListUsersRequest lists the users of a tenant
+type ListUsersRequest struct {
+	TenantID       string `path:"tenant_id" validate:"required"`
+	Page           int    `query:"page"`
+	PageSize       int    `query:"page_size" validate:"max=100"`
+	Search         string `query:"search"`
+	IncludeDeleted bool   `query:"include_deleted"`
+}
+
+// UserRequest selects a user
+type UserRequest struct {
+	TenantID string `path:"tenant_id" validate:"required"`
+	UserID   string `path:"user_id" validate:"required"`
+}
+
+// CreateUserRequest creates a user (an empty ID is generated). The password
+// is optional for users that sign in without one. The status defaults to
+// active, or suspended when disabled.
+type CreateUserRequest struct {
+	TenantID string   `path:"tenant_id" validate:"required"`
+	ID       string   `json:"id" validate:"max=64"`
+	Username string   `json:"username" validate:"required,max=128"`
+	Email    string   `json:"email" validate:"email,max=256"`
+	Password string   `json:"password" validate:"max=256"`
+	Status   string   `json:"status" validate:"oneof=pending active"`
+	Disabled bool     `json:"disabled"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// UpdateUserRequest updates a user (an empty password is kept). The status
+// changes through SetUserStatus.
+type UpdateUserRequest struct {
+	TenantID string   `path:"tenant_id" validate:"required"`
+	UserID   string   `path:"user_id" validate:"required"`
+	Username string   `json:"username" validate:"required,max=128"`
+	Email    string   `json:"email" validate:"email,max=256"`
+	Password string   `json:"password" validate:"max=256"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// SetUserStatusRequest moves a user to a lifecycle status
+type SetUserStatusRequest struct {
+	TenantID string `path:"tenant_id" validate:"required"`
+	UserID   string `path:"user_id" validate:"required"`
+	Status   string `json:"status" validate:"required,oneof=pending active suspended deactivated"`
+	Reason   string `json:"reason" validate:"max=512"`
+}
+
+// RecoverUserRequest starts the recovery of the account of a user who lost
+// their sign-in factor
+type RecoverUserRequest struct {
+	TenantID string `path:"tenant_id" validate:"required"`
+	UserID   string `path:"user_id" validate:"required"`
+	Reason   string `json:"reason" validate:"required,max=512"`
+}
+
+// ChangeUserIdentityRequest starts a change of the email address or
+// username of a user, applied once the user confirms it
+type ChangeUserIdentityRequest struct {
+	TenantID string `path:"tenant_id" validate:"required"`
+	UserID   string `path:"user_id" validate:"required"`
+	Field    string `json:"field" validate:"required,oneof=email username"`
+	Value    string `json:"value" validate:"required,max=256"`
+}
+
+// UserIdentityChangeRequest addresses the pending change of a field of a
+// user
+type UserIdentityChangeRequest struct {
+	TenantID string `path:"tenant_id" validate:"required"`
+	UserID   string `path:"user_id" validate:"required"`
+	Field    string `path:"field" validate:"required,oneof=email username"`
+}
+
+// TenantService is the multi-tenant control plane API: tenants, their apps,
+// the branches of apps and the users of tenants. Deletes are soft (see
+// package tenant); deleted records are listed with include_deleted=true and
+// brought back with the restore endpoints.
+//
+// Tenant admins administer their own tenant (the tenant of the request
+// context); platform admins holding tenant:tenant:read/write administer any
+// tenant.
+//
+// @RouterService name="tenant-admin", prefix="/admin", middlewares=["lokstra-auth"]
+type TenantService struct {
+	// @Inject "lokstra-auth"
+	Auth *service.Cached[*lokstraauth.Auth]
+
+	// @Inject "tenant-store"
+	Tenants *service.Cached[tenant.TenantStore]
+
+	// @Inject "app-store"
+	Apps *service.Cached[tenant.AppStore]
+
+	// @Inject "branch-store"
+	Branches *service.Cached[tenant.BranchStore]
+
+	// @Inject "user-store"
+	Users *service.Cached[tenant.UserStore]
+}
+
+// ListTenants returns a page of tenants
+// @Route "GET /tenants"
+func (s *TenantService) ListTenants(c *request.Context, p *ListTenantsRequest) (*Page[*tenant.Tenant], error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionTenantRead); err != nil {
+		return nil, err
+	}
+
+	opts, page, pageSize := tenantListOptions(p.Page, p.PageSize, p.Search, p.IncludeDeleted)
+	tenants, total, err := s.Tenants.MustGet().ListTenants(c, opts)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return newPage(tenants, total, page, pageSize), nil
+}
+
+// GetTenant returns a tenant
+// @Route "GET /tenants/{tenant_id}"
+func (s *TenantService) GetTenant(c *request.Context, p *TenantRequest) (*tenant.Tenant, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionTenantRead); err != nil {
+		return nil, err
+	}
+	return s.tenant(c, p.TenantID)
+}
+
+// CreateTenant creates a tenant
+// @Route "POST /tenants"
+func (s *TenantService) CreateTenant(c *request.Context, p *CreateTenantRequest) (*tenant.Tenant, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	created := &tenant.Tenant{ID: p.ID, Name: p.Name, Status: tenant.Status(p.Status), Metadata: p.Metadata}
+	if err := s.Tenants.MustGet().CreateTenant(c, created); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.tenant(c, created.ID)
+}
+
+// UpdateTenant updates the name, status and metadata of a tenant
+// @Route "PUT /tenants/{tenant_id}"
+func (s *TenantService) UpdateTenant(c *request.Context, p *UpdateTenantRequest) (*tenant.Tenant, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	updated := &tenant.Tenant{ID: p.TenantID, Name: p.Name, Status: tenant.Status(p.Status), Metadata: p.Metadata}
+	if err := s.Tenants.MustGet().UpdateTenant(c, updated); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.tenant(c, p.TenantID)
+}
+
+// DeleteTenant soft-deletes a tenant
+// @Route "DELETE /tenants/{tenant_id}"
+func (s *TenantService) DeleteTenant(c *request.Context, p *TenantRequest) error {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionTenantWrite); err != nil {
+		return err
+	}
+
+	if err := s.Tenants.MustGet().DeleteTenant(c, p.TenantID); err != nil {
+		return fail(c, err)
+	}
+	return nil
+}
+
+// RestoreTenant restores a soft-deleted tenant
+// @Route "POST /tenants/{tenant_id}/restore"
+func (s *TenantService) RestoreTenant(c *request.Context, p *TenantRequest) (*tenant.Tenant, error) {
+	if _, err := guard(c, s.Auth.MustGet(), PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	if err := s.Tenants.MustGet().RestoreTenant(c, p.TenantID); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.tenant(c, p.TenantID)
+}
+
+// ListApps returns a page of the apps of a tenant
+// @Route "GET /tenants/{tenant_id}/apps"
+func (s *TenantService) ListApps(c *request.Context, p *ListAppsRequest) (*Page[*tenant.App], error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionAppRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+
+	opts, page, pageSize := tenantListOptions(p.Page, p.PageSize, p.Search, p.IncludeDeleted)
+	apps, total, err := s.Apps.MustGet().ListApps(c, p.TenantID, opts)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return newPage(apps, total, page, pageSize), nil
+}
+
+// GetApp returns an app
+// @Route "GET /tenants/{tenant_id}/apps/{app_id}"
+func (s *TenantService) GetApp(c *request.Context, p *AppRequest) (*tenant.App, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionAppRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+	return s.app(c, p.TenantID, p.AppID)
+}
+
+// CreateApp creates an app
+// @Route "POST /tenants/{tenant_id}/apps"
+func (s *TenantService) CreateApp(c *request.Context, p *CreateAppRequest) (*tenant.App, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionAppWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	created := &tenant.App{ID: p.ID, TenantID: p.TenantID, Name: p.Name, Status: tenant.Status(p.Status), Metadata: p.Metadata}
+	if err := s.Apps.MustGet().CreateApp(c, created); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.app(c, p.TenantID, created.ID)
+}
+
+// UpdateApp updates the name, status and metadata of an app
+// @Route "PUT /tenants/{tenant_id}/apps/{app_id}"
+func (s *TenantService) UpdateApp(c *request.Context, p *UpdateAppRequest) (*tenant.App, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionAppWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	updated := &tenant.App{ID: p.AppID, TenantID: p.TenantID, Name: p.Name, Status: tenant.Status(p.Status), Metadata: p.Metadata}
+	if err := s.Apps.MustGet().UpdateApp(c, updated); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.app(c, p.TenantID, p.AppID)
+}
+
+// DeleteApp soft-deletes an app
+// @Route "DELETE /tenants/{tenant_id}/apps/{app_id}"
+func (s *TenantService) DeleteApp(c *request.Context, p *AppRequest) error {
+	if err := s.guardTenant(c, p.TenantID, PermissionAppWrite, PermissionTenantWrite); err != nil {
+		return err
+	}
+
+	if err := s.Apps.MustGet().DeleteApp(c, p.TenantID, p.AppID); err != nil {
+		return fail(c, err)
+	}
+	return nil
+}
+
+// RestoreApp restores a soft-deleted app
+// @Route "POST /tenants/{tenant_id}/apps/{app_id}/restore"
+func (s *TenantService) RestoreApp(c *request.Context, p *AppRequest) (*tenant.App, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionAppWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	if err := s.Apps.MustGet().RestoreApp(c, p.TenantID, p.AppID); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.app(c, p.TenantID, p.AppID)
+}
+
+// ListBranches returns a page of the branches of an app
+// @Route "GET /tenants/{tenant_id}/apps/{app_id}/branches"
+func (s *TenantService) ListBranches(c *request.Context, p *ListBranchesRequest) (*Page[*tenant.Branch], error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionBranchRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+
+	opts, page, pageSize := tenantListOptions(p.Page, p.PageSize, p.Search, p.IncludeDeleted)
+	branches, total, err := s.Branches.MustGet().ListBranches(c, p.TenantID, p.AppID, opts)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return newPage(branches, total, page, pageSize), nil
+}
+
+// GetBranch returns a branch
+// @Route "GET /tenants/{tenant_id}/apps/{app_id}/branches/{branch_id}"
+func (s *TenantService) GetBranch(c *request.Context, p *BranchRequest) (*tenant.Branch, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionBranchRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+	return s.branch(c, p.TenantID, p.AppID, p.BranchID)
+}
+
+// CreateBranch creates a branch
+// @Route "POST /tenants/{tenant_id}/apps/{app_id}/branches"
+func (s *TenantService) CreateBranch(c *request.Context, p *CreateBranchRequest) (*tenant.Branch, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionBranchWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	created := &tenant.Branch{ID: p.ID, TenantID: p.TenantID, AppID: p.AppID, Name: p.Name, Metadata: p.Metadata}
+	if err := s.Branches.MustGet().CreateBranch(c, created); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.branch(c, p.TenantID, p.AppID, created.ID)
+}
+
+// UpdateBranch updates the name and metadata of a branch
+// @Route "PUT /tenants/{tenant_id}/apps/{app_id}/branches/{branch_id}"
+func (s *TenantService) UpdateBranch(c *request.Context, p *UpdateBranchRequest) (*tenant.Branch, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionBranchWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	updated := &tenant.Branch{ID: p.BranchID, TenantID: p.TenantID, AppID: p.AppID, Name: p.Name, Metadata: p.Metadata}
+	if err := s.Branches.MustGet().UpdateBranch(c, updated); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.branch(c, p.TenantID, p.AppID, p.BranchID)
+}
+
+// DeleteBranch soft-deletes a branch
+// @Route "DELETE /tenants/{tenant_id}/apps/{app_id}/branches/{branch_id}"
+func (s *TenantService) DeleteBranch(c *request.Context, p *BranchRequest) error {
+	if err := s.guardTenant(c, p.TenantID, PermissionBranchWrite, PermissionTenantWrite); err != nil {
+		return err
+	}
+
+	if err := s.Branches.MustGet().DeleteBranch(c, p.TenantID, p.AppID, p.BranchID); err != nil {
+		return fail(c, err)
+	}
+	return nil
+}
+
+// RestoreBranch restores a soft-deleted branch
+// @Route "POST /tenants/{tenant_id}/apps/{app_id}/branches/{branch_id}/restore"
+func (s *TenantService) RestoreBranch(c *request.Context, p *BranchRequest) (*tenant.Branch, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionBranchWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	if err := s.Branches.MustGet().RestoreBranch(c, p.TenantID, p.AppID, p.BranchID); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.branch(c, p.TenantID, p.AppID, p.BranchID)
+}
+
+// ListUsers returns a page of the users of a tenant
+// @Route "GET /tenants/{tenant_id}/users"
+func (s *TenantService) ListUsers(c *request.Context, p *ListUsersRequest) (*Page[*tenant.User], error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+
+	opts, page, pageSize := tenantListOptions(p.Page, p.PageSize, p.Search, p.IncludeDeleted)
+	users, total, err := s.Users.MustGet().ListUsers(c, p.TenantID, opts)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return newPage(users, total, page, pageSize), nil
+}
+
+// GetUser returns a user
+// @Route "GET /tenants/{tenant_id}/users/{user_id}"
+func (s *TenantService) GetUser(c *request.Context, p *UserRequest) (*tenant.User, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+	return s.user(c, p.TenantID, p.UserID)
+}
+
+// CreateUser creates a user
+// @Route "POST /tenants/{tenant_id}/users"
+func (s *TenantService) CreateUser(c *request.Context, p *CreateUserRequest) (*tenant.User, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	created := &tenant.User{
+		ID:       p.ID,
+		TenantID: p.TenantID,
+		Username: p.Username,
+		Email:    p.Email,
+		Status:   tenant.UserStatus(p.Status),
+		Disabled: p.Disabled,
+		Metadata: p.Metadata,
+	}
+	if p.Password != "" {
+		hash, err := basic.HashPassword(p.Password)
+		if err != nil {
+			return nil, fail(c, err)
+		}
+		created.PasswordHash = hash
+	}
+	if err := s.Users.MustGet().CreateUser(c, created); err != nil {
+		return nil, fail(c, err)
+	}
+	s.Auth.MustGet().Publish(c, &events.Event{
+		Type:      events.UserCreated,
+		TenantID:  p.TenantID,
+		SubjectID: created.ID,
+		Data:      map[string]any{"username": created.Username},
+	})
+	return s.user(c, p.TenantID, created.ID)
+}
+
+// UpdateUser updates a user, and its password when one is given
+// @Route "PUT /tenants/{tenant_id}/users/{user_id}"
+func (s *TenantService) UpdateUser(c *request.Context, p *UpdateUserRequest) (*tenant.User, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	users := s.Users.MustGet()
+	updated, err := users.GetUser(c, p.TenantID, p.UserID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	updated.Username = p.Username
+	updated.Email = p.Email
+	updated.Metadata = p.Metadata
+	if p.Password != "" {
+		hash, err := basic.HashPassword(p.Password)
+		if err != nil {
+			return nil, fail(c, err)
+		}
+		updated.PasswordHash = hash
+	}
+	if err := users.UpdateUser(c, updated); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.user(c, p.TenantID, p.UserID)
+}
+
+// SetUserStatus activates, suspends or deactivates a user (409 if its
+// current status cannot move to the new one). Suspended and deactivated
+// users no longer sign in, and their tokens stop working.
+// @Route "POST /tenants/{tenant_id}/users/{user_id}/status"
+func (s *TenantService) SetUserStatus(c *request.Context, p *SetUserStatusRequest) (*tenant.User, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	var actorID string
+	if identity, ok := middleware.GetIdentity(c); ok && identity.Subject != nil {
+		actorID = identity.Subject.ID
+	}
+	updated, err := s.Auth.MustGet().SetUserStatus(c, &lokstraauth.UserStatusChange{
+		TenantID: p.TenantID,
+		UserID:   p.UserID,
+		Status:   tenant.UserStatus(p.Status),
+		Reason:   p.Reason,
+		ActorID:  actorID,
+	})
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return updated, nil
+}
+
+// DeleteUser soft-deletes a user
+// @Route "DELETE /tenants/{tenant_id}/users/{user_id}"
+func (s *TenantService) DeleteUser(c *request.Context, p *UserRequest) error {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return err
+	}
+
+	if err := s.Users.MustGet().DeleteUser(c, p.TenantID, p.UserID); err != nil {
+		return fail(c, err)
+	}
+	return nil
+}
+
+// RestoreUser restores a soft-deleted user
+// @Route "POST /tenants/{tenant_id}/users/{user_id}/restore"
+func (s *TenantService) RestoreUser(c *request.Context, p *UserRequest) (*tenant.User, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	if err := s.Users.MustGet().RestoreUser(c, p.TenantID, p.UserID); err != nil {
+		return nil, fail(c, err)
+	}
+	return s.user(c, p.TenantID, p.UserID)
+}
+
+// AnonymizeUser erases the personal data of a user, deleted or not: the
+// user is scrubbed and deleted, and its identities, sessions, devices, API
+// keys and consents are removed (see lokstraauth.Auth.Anonymize). It cannot
+// be undone.
+// @Route "POST /tenants/{tenant_id}/users/{user_id}/anonymize"
+func (s *TenantService) AnonymizeUser(c *request.Context, p *UserRequest) (*lokstraauth.ErasureResult, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	result, err := s.Auth.MustGet().Anonymize(withActor(c), p.TenantID, p.UserID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return result, nil
+}
+
+// ExportUserData returns the personal data held about a user, deleted or
+// not, as a portable JSON document
+// @Route "GET /tenants/{tenant_id}/users/{user_id}/export"
+func (s *TenantService) ExportUserData(c *request.Context, p *UserRequest) (*lokstraauth.UserDataExport, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+
+	export, err := s.Auth.MustGet().ExportUserData(withActor(c), p.TenantID, p.UserID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return export, nil
+}
+
+// GetUserRecovery returns the recovery setup of a user: remaining backup
+// codes, contacts, pending admin recovery and cooldown
+// @Route "GET /tenants/{tenant_id}/users/{user_id}/recovery"
+func (s *TenantService) GetUserRecovery(c *request.Context, p *UserRequest) (*lokstraauth.RecoveryStatus, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+
+	status, err := s.Auth.MustGet().RecoveryStatus(c, p.TenantID, p.UserID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return status, nil
+}
+
+// RecoverUser starts the recovery of the account of a user by the caller
+// (see lokstraauth.Auth.InitiateAdminRecovery). The returned token is
+// handed to the user out of band and can be redeemed once the delay passed;
+// the user is notified and can cancel it meanwhile.
+// @Route "POST /tenants/{tenant_id}/users/{user_id}/recovery"
+func (s *TenantService) RecoverUser(c *request.Context, p *RecoverUserRequest) (*lokstraauth.AdminRecovery, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	ticket, err := s.Auth.MustGet().InitiateAdminRecovery(withActor(c), &lokstraauth.AdminRecoveryRequest{
+		TenantID: p.TenantID,
+		UserID:   p.UserID,
+		Reason:   p.Reason,
+	})
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return ticket, nil
+}
+
+// CancelUserRecovery cancels the pending admin recovery of a user
+// @Route "DELETE /tenants/{tenant_id}/users/{user_id}/recovery"
+func (s *TenantService) CancelUserRecovery(c *request.Context, p *UserRequest) error {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return err
+	}
+
+	if err := s.Auth.MustGet().CancelAdminRecovery(withActor(c), p.TenantID, p.UserID); err != nil {
+		return fail(c, err)
+	}
+	return nil
+}
+
+// ListUserIdentityChanges returns the pending email and username changes of
+// a user
+// @Route "GET /tenants/{tenant_id}/users/{user_id}/identity-changes"
+func (s *TenantService) ListUserIdentityChanges(c *request.Context, p *UserRequest) ([]*identitychange.Change, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserRead, PermissionTenantRead); err != nil {
+		return nil, err
+	}
+
+	changes, err := s.Auth.MustGet().PendingIdentityChanges(c, p.TenantID, p.UserID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return changes, nil
+}
+
+// ChangeUserIdentity starts a change of the email address or username of a
+// user (see lokstraauth.Auth.RequestEmailChange). The confirmation is sent
+// to the user, who keeps the current value until confirming it.
+// @Route "POST /tenants/{tenant_id}/users/{user_id}/identity-changes"
+func (s *TenantService) ChangeUserIdentity(c *request.Context, p *ChangeUserIdentityRequest) (*identitychange.Change, error) {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return nil, err
+	}
+
+	auth := s.Auth.MustGet()
+	var change *identitychange.Change
+	var err error
+	if identitychange.Field(p.Field) == identitychange.FieldEmail {
+		change, err = auth.RequestEmailChange(withActor(c), p.TenantID, p.UserID, p.Value)
+	} else {
+		change, err = auth.RequestUsernameChange(withActor(c), p.TenantID, p.UserID, p.Value)
+	}
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return change, nil
+}
+
+// CancelUserIdentityChange cancels the pending change of a field of a user
+// @Route "DELETE /tenants/{tenant_id}/users/{user_id}/identity-changes/{field}"
+func (s *TenantService) CancelUserIdentityChange(c *request.Context, p *UserIdentityChangeRequest) error {
+	if err := s.guardTenant(c, p.TenantID, PermissionUserWrite, PermissionTenantWrite); err != nil {
+		return err
+	}
+
+	err := s.Auth.MustGet().CancelIdentityChange(withActor(c), p.TenantID, p.UserID, identitychange.Field(p.Field))
+	if err != nil {
+		return fail(c, err)
+	}
+	return nil
+}
+
+// withActor returns the request context carrying the caller as the actor
+func withActor(c *request.Context) context.Context {
+	if identity, ok := middleware.GetIdentity(c); ok && identity.Subject != nil {
+		return authz.WithActor(c, identity.Subject.ID)
+	}
+	return c
+}
+
+// guardTenant checks that the caller has the permission and may administer
+// the tenant: its own tenant, or any tenant with the platform permission
+func (s *TenantService) guardTenant(c *request.Context, tenantID, perm, platformPerm string) error {
+	auth := s.Auth.MustGet()
+	identity, err := guard(c, auth, perm)
+	if err != nil {
+		return err
+	}
+	if authz.TenantFromContext(c) == tenantID {
+		return nil
+	}
+	allowed, err := auth.CheckPermission(c, identity, platformPerm)
+	if err != nil {
+		return fail(c, err)
+	}
+	if !allowed {
+		return fail(c, fmt.Errorf("%w: cannot administer tenant %s", ErrForbidden, tenantID))
+	}
+	return nil
+}
+
+func (s *TenantService) tenant(c *request.Context, tenantID string) (*tenant.Tenant, error) {
+	found, err := s.Tenants.MustGet().GetTenant(c, tenantID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return found, nil
+}
+
+func (s *TenantService) app(c *request.Context, tenantID, appID string) (*tenant.App, error) {
+	found, err := s.Apps.MustGet().GetApp(c, tenantID, appID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return found, nil
+}
+
+func (s *TenantService) branch(c *request.Context, tenantID, appID, branchID string) (*tenant.Branch, error) {
+	found, err := s.Branches.MustGet().GetBranch(c, tenantID, appID, branchID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return found, nil
+}
+
+func (s *TenantService) user(c *request.Context, tenantID, userID string) (*tenant.User, error) {
+	found, err := s.Users.MustGet().GetUser(c, tenantID, userID)
+	if err != nil {
+		return nil, fail(c, err)
+	}
+	return found, nil
+}
+
+// tenantListOptions converts page parameters to tenant list options
+func tenantListOptions(page, pageSize int, search string, includeDeleted bool) (tenant.ListOptions, int, int) {
+	opts, page, pageSize := pageOptions(page, pageSize, search)
+	return tenant.ListOptions{
+		Offset:         opts.Offset,
+		Limit:          opts.Limit,
+		Search:         opts.Search,
+		IncludeDeleted: includeDeleted,
+	}, page, pageSize
+}
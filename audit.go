@@ -0,0 +1,141 @@
+package lokstraauth
+
+import (
+	"context"
+	"fmt"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrNoAuditEmitter = autherrors.New(autherrors.ErrNotImplemented, "no audit emitter configured")
+)
+
+// SetAuditEmitter sets the emitter of audit events: logins, logouts, token
+// refresh and revocation, MFA, device trust and authorization denials
+func (a *Auth) SetAuditEmitter(emitter *audit.Emitter) {
+	a.audit = emitter
+}
+
+// Audit writes an audit entry through the audit emitter (no-op without
+// one), e.g. for application events. The tenant, app and client IP default
+// to those of the context.
+func (a *Auth) Audit(ctx context.Context, entry *audit.AuditLog) {
+	if a.audit == nil {
+		return
+	}
+
+	withRequest(ctx, entry)
+	a.audit.Emit(ctx, entry)
+}
+
+// auditRequired writes an audit entry an operation must not proceed
+// without, on the caller's goroutine (see audit.Emitter.EmitRequired).
+// It fails with ErrNoAuditEmitter without an emitter.
+func (a *Auth) auditRequired(ctx context.Context, entry *audit.AuditLog) error {
+	if a.audit == nil {
+		return ErrNoAuditEmitter
+	}
+
+	withRequest(ctx, entry)
+	if err := a.audit.EmitRequired(ctx, entry); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// withRequest defaults the tenant, app and client IP of an entry to those of
+// the context
+func withRequest(ctx context.Context, entry *audit.AuditLog) {
+	if entry.TenantID == "" {
+		entry.TenantID = authz.TenantFromContext(ctx)
+	}
+	if entry.AppID == "" {
+		entry.AppID = authz.AppFromContext(ctx)
+	}
+	if entry.IPAddress == "" {
+		entry.IPAddress = subject.ClientIPFromContext(ctx)
+	}
+}
+
+// AuditMFA records the outcome of a second-factor verification of a
+// subject, e.g. an OTP or passkey step (method "otp", "passkey")
+func (a *Auth) AuditMFA(ctx context.Context, subjectID, method string, err error) {
+	eventType := audit.EventMFAVerified
+	if err != nil {
+		eventType = audit.EventMFAFailed
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: eventType,
+		ActorID:   subjectID,
+		SubjectID: subjectID,
+		Result:    auditResult(err),
+		Metadata:  auditMetadata(err, "method", method),
+	})
+}
+
+// auditLogin records a login attempt
+func (a *Auth) auditLogin(ctx context.Context, request *LoginRequest, subjectID string, err error) {
+	if a.audit == nil {
+		return
+	}
+
+	eventType := audit.EventLoginSucceeded
+	if err != nil {
+		eventType = audit.EventLoginFailed
+	}
+	ip, _ := request.Metadata["ip_address"].(string)
+	userAgent, _ := request.Metadata["user_agent"].(string)
+
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: eventType,
+		ActorID:   subjectID,
+		SubjectID: subjectID,
+		Action:    "login",
+		Result:    auditResult(err),
+		IPAddress: ip,
+		UserAgent: userAgent,
+		Metadata:  auditMetadata(err, "authenticator", request.Credentials.Type()),
+	})
+}
+
+// auditDenied records a denied authorization check
+func (a *Auth) auditDenied(ctx context.Context, identity *subject.IdentityContext, resource, action string, metadata map[string]any) {
+	if a.audit == nil {
+		return
+	}
+
+	var subjectID string
+	if identity != nil && identity.Subject != nil {
+		subjectID = identity.Subject.ID
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventAuthorizationDenied,
+		ActorID:   subjectID,
+		SubjectID: subjectID,
+		Resource:  resource,
+		Action:    action,
+		Result:    audit.ResultDenied,
+		Metadata:  metadata,
+	})
+}
+
+// auditResult returns the audit result of an error
+func auditResult(err error) string {
+	if err != nil {
+		return audit.ResultFailure
+	}
+	return audit.ResultSuccess
+}
+
+// auditMetadata returns entry metadata with the error code of a failure
+func auditMetadata(err error, key string, value any) map[string]any {
+	metadata := map[string]any{key: value}
+	if err != nil {
+		metadata["code"] = string(autherrors.CodeOf(err))
+	}
+	return metadata
+}
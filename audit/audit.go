@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"time"
+)
+
+var (
+	ErrSequenceConflict = errors.New("audit log sequence conflict")
+	ErrInvalidEntry     = errors.New("invalid audit log entry")
+)
+
+// Result values of an audit log entry
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDenied  = "denied"
+)
+
+// AuditLog is a single audit log entry.
+//
+// With hash chaining enabled every entry carries its position in the tenant
+// chain (Sequence), the hash of the previous entry of the same tenant
+// (PrevHash) and its own hash (Hash), so a modified, removed or reordered
+// entry breaks the chain. Metadata values must be JSON-serializable.
+type AuditLog struct {
+	ID        string         `json:"id"`
+	TenantID  string         `json:"tenant_id"`
+	AppID     string         `json:"app_id,omitempty"`
+	Sequence  uint64         `json:"sequence,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
+	EventType string         `json:"event_type"`
+	ActorID   string         `json:"actor_id,omitempty"`   // who performed the action
+	SubjectID string         `json:"subject_id,omitempty"` // who the action was performed on
+	Resource  string         `json:"resource,omitempty"`
+	Action    string         `json:"action,omitempty"`
+	Result    string         `json:"result,omitempty"` // success, failure, denied
+	IPAddress string         `json:"ip_address,omitempty"`
+	UserAgent string         `json:"user_agent,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	PrevHash  string         `json:"prev_hash,omitempty"`
+	Hash      string         `json:"hash,omitempty"`
+
+	// Pseudonymized marks an entry rewritten by an erasure request (see
+	// Pseudonymization). It no longer matches Hash, which still links it to
+	// its neighbors, but RedactedHash: the hash of its rewritten form, which
+	// an EventAuditPseudonymized entry later in the chain records.
+	Pseudonymized bool   `json:"pseudonymized,omitempty"`
+	RedactedHash  string `json:"redacted_hash,omitempty"`
+}
+
+func (l *AuditLog) clone() *AuditLog {
+	copied := *l
+	copied.Metadata = maps.Clone(l.Metadata)
+	return &copied
+}
+
+// Filter selects audit log entries
+type Filter struct {
+	// TenantID selects the entries of one tenant (required)
+	TenantID string
+
+	// AfterSequence skips entries up to and including this sequence
+	AfterSequence uint64
+
+	// Limit is the maximum number of entries (0: no limit)
+	Limit int
+}
+
+// AuditLogStore persists audit log entries
+type AuditLogStore interface {
+	// Append stores an entry. A chained entry (Sequence > 0) must directly
+	// follow the last entry of its tenant; otherwise ErrSequenceConflict
+	// is returned, e.g., when another node appended first.
+	Append(ctx context.Context, entry *AuditLog) error
+
+	// List returns the entries of a tenant ordered by sequence
+	// (insertion order for unchained entries)
+	List(ctx context.Context, filter *Filter) ([]*AuditLog, error)
+
+	// Last returns the last entry of a tenant, or nil when there is none
+	Last(ctx context.Context, tenantID string) (*AuditLog, error)
+
+	// CleanupOld deletes entries older than before and returns how many
+	// were deleted. The oldest retained entry of a chain keeps its PrevHash,
+	// so the rest of the chain can still be verified; the last entry of a
+	// chain is never deleted.
+	CleanupOld(ctx context.Context, before time.Time) (int, error)
+}
+
+// CheckpointStore persists signed checkpoints of tenant chains
+type CheckpointStore interface {
+	// SaveCheckpoint stores a checkpoint
+	SaveCheckpoint(ctx context.Context, checkpoint *Checkpoint) error
+
+	// ListCheckpoints returns the checkpoints of a tenant ordered by sequence
+	ListCheckpoints(ctx context.Context, tenantID string) ([]*Checkpoint, error)
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid checkpoint signature")
+	ErrUnknownKey       = errors.New("unknown checkpoint signing key")
+)
+
+// Checkpoint is a signed statement of the head of a tenant chain: the hash
+// of the entry at Sequence. Entries up to a checkpoint cannot be rewritten
+// (even by someone able to recompute every hash) without the signing key.
+type Checkpoint struct {
+	TenantID  string    `json:"tenant_id"`
+	Sequence  uint64    `json:"sequence"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	KeyID     string    `json:"key_id"`
+	Signature []byte    `json:"signature"`
+}
+
+// signedPayload returns the bytes covered by the checkpoint signature
+func (c *Checkpoint) signedPayload() ([]byte, error) {
+	return json.Marshal(struct {
+		TenantID  string    `json:"tenant_id"`
+		Sequence  uint64    `json:"sequence"`
+		Hash      string    `json:"hash"`
+		Timestamp time.Time `json:"timestamp"`
+		KeyID     string    `json:"key_id"`
+	}{c.TenantID, c.Sequence, c.Hash, c.Timestamp, c.KeyID})
+}
+
+// CheckpointSigner signs checkpoints
+type CheckpointSigner interface {
+	// KeyID identifies the signing key in checkpoints
+	KeyID() string
+
+	// Sign signs a checkpoint payload
+	Sign(payload []byte) ([]byte, error)
+}
+
+// CheckpointVerifier verifies checkpoint signatures
+type CheckpointVerifier interface {
+	// Verify returns ErrInvalidSignature (or ErrUnknownKey) when the
+	// signature of payload does not match
+	Verify(keyID string, payload, signature []byte) error
+}
+
+// Ed25519Signer signs checkpoints with an Ed25519 key. Auditors only need
+// the public key to verify them.
+type Ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates an Ed25519 checkpoint signer
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{keyID: keyID, key: key}
+}
+
+// KeyID returns the signing key ID
+func (s *Ed25519Signer) KeyID() string { return s.keyID }
+
+// Sign signs a checkpoint payload
+func (s *Ed25519Signer) Sign(payload []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, payload), nil
+}
+
+// Verify verifies with the public half of the signing key
+func (s *Ed25519Signer) Verify(keyID string, payload, signature []byte) error {
+	return Ed25519Verifier{s.keyID: s.key.Public().(ed25519.PublicKey)}.Verify(keyID, payload, signature)
+}
+
+// Ed25519Verifier verifies Ed25519 checkpoint signatures by key ID, so
+// checkpoints signed with rotated keys stay verifiable
+type Ed25519Verifier map[string]ed25519.PublicKey
+
+// Verify verifies a checkpoint signature
+func (v Ed25519Verifier) Verify(keyID string, payload, signature []byte) error {
+	key, ok := v[keyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// HMACSigner signs and verifies checkpoints with a shared HMAC-SHA256 key.
+// Prefer Ed25519Signer when auditors must not be able to sign.
+type HMACSigner struct {
+	keyID string
+	key   []byte
+}
+
+// NewHMACSigner creates an HMAC-SHA256 checkpoint signer
+func NewHMACSigner(keyID string, key []byte) *HMACSigner {
+	return &HMACSigner{keyID: keyID, key: key}
+}
+
+// KeyID returns the signing key ID
+func (s *HMACSigner) KeyID() string { return s.keyID }
+
+// Sign signs a checkpoint payload
+func (s *HMACSigner) Sign(payload []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
+
+// Verify verifies a checkpoint signature
+func (s *HMACSigner) Verify(keyID string, payload, signature []byte) error {
+	if keyID != s.keyID {
+		return ErrUnknownKey
+	}
+	expected, _ := s.Sign(payload)
+	if !hmac.Equal(expected, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
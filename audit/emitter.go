@@ -0,0 +1,254 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Redacted replaces redacted metadata values
+const Redacted = "[REDACTED]"
+
+// Redaction removes personal data from entries before they are written
+type Redaction struct {
+	// MaskIP keeps only the network part of IP addresses (IPv4 /24,
+	// IPv6 /48)
+	MaskIP bool
+
+	// OmitUserAgent drops user agents
+	OmitUserAgent bool
+
+	// MetadataKeys are metadata keys whose values are replaced with
+	// Redacted (e.g. "email", "username")
+	MetadataKeys []string
+
+	// PseudonymizeKey replaces ActorID and SubjectID with a keyed hash
+	// (see Pseudonym), so entries of one subject can still be correlated
+	// (optional)
+	PseudonymizeKey []byte
+}
+
+// Pseudonym returns the pseudonym of an ID, e.g. to query the entries of a
+// subject ("" stays "")
+func (r *Redaction) Pseudonym(id string) string {
+	if id == "" || len(r.PseudonymizeKey) == 0 {
+		return id
+	}
+	mac := hmac.New(sha256.New, r.PseudonymizeKey)
+	mac.Write([]byte(id))
+	return "p:" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// apply redacts an entry in place
+func (r *Redaction) apply(entry *AuditLog) {
+	if r.MaskIP && entry.IPAddress != "" {
+		entry.IPAddress = maskIP(entry.IPAddress)
+	}
+	if r.OmitUserAgent {
+		entry.UserAgent = ""
+	}
+	for key := range entry.Metadata {
+		if slices.Contains(r.MetadataKeys, key) {
+			entry.Metadata[key] = Redacted
+		}
+	}
+	entry.ActorID = r.Pseudonym(entry.ActorID)
+	entry.SubjectID = r.Pseudonym(entry.SubjectID)
+}
+
+// maskIP zeroes the host part of an IP address
+func maskIP(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return Redacted
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// EmitterConfig holds emitter configuration
+type EmitterConfig struct {
+	// Logger writes the entries (required)
+	Logger *Logger
+
+	// Sync writes entries on the caller's goroutine. By default entries are
+	// queued and written by a background goroutine.
+	Sync bool
+
+	// BufferSize is the size of the async queue (default: 1024). When the
+	// queue is full, entries are dropped (and counted) rather than blocking
+	// the request.
+	BufferSize int
+
+	// Redaction removes personal data before entries are written (optional)
+	Redaction *Redaction
+
+	// OnError is called when an entry cannot be written (optional)
+	OnError func(entry *AuditLog, err error)
+}
+
+// Emitter writes the audit events of the Auth runtime: logins, logouts,
+// token refresh and revocation, MFA and device trust, role and permission
+// changes and authorization denials. Event types are the Event* constants.
+// A nil *Emitter is valid and drops every entry.
+type Emitter struct {
+	config *EmitterConfig
+
+	mu      sync.RWMutex
+	queue   chan queuedEntry
+	done    chan struct{}
+	closed  bool
+	dropped uint64
+}
+
+// queuedEntry is an entry waiting for the async writer
+type queuedEntry struct {
+	ctx   context.Context
+	entry *AuditLog
+}
+
+// NewEmitter creates an emitter; an async emitter starts its writer
+func NewEmitter(config *EmitterConfig) *Emitter {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1024
+	}
+
+	e := &Emitter{config: config}
+	if !config.Sync {
+		e.queue = make(chan queuedEntry, config.BufferSize)
+		e.done = make(chan struct{})
+		go e.run()
+	}
+	return e
+}
+
+// Emit redacts and writes an entry. The timestamp defaults to now.
+func (e *Emitter) Emit(ctx context.Context, entry *AuditLog) {
+	if e == nil {
+		return
+	}
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if e.config.Redaction != nil {
+		e.config.Redaction.apply(entry)
+	}
+
+	if e.queue == nil {
+		e.write(ctx, entry)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		e.dropped++
+		return
+	}
+
+	// Detach from request cancellation; the entry outlives the call
+	select {
+	case e.queue <- queuedEntry{ctx: context.WithoutCancel(ctx), entry: entry}:
+	default:
+		e.dropped++
+	}
+}
+
+// EmitRequired redacts and writes an entry on the caller's goroutine, even
+// for an async emitter, and returns the write error: for entries an
+// operation must not proceed without (e.g., an admin recovering the account
+// of a user). The timestamp defaults to now.
+func (e *Emitter) EmitRequired(ctx context.Context, entry *AuditLog) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if e.config.Redaction != nil {
+		e.config.Redaction.apply(entry)
+	}
+
+	err := e.config.Logger.Log(ctx, entry)
+	if err != nil && e.config.OnError != nil {
+		e.config.OnError(entry, err)
+	}
+	return err
+}
+
+// Store returns the store the emitter writes to (nil for a nil emitter)
+func (e *Emitter) Store() AuditLogStore {
+	if e == nil {
+		return nil
+	}
+	return e.config.Logger.Store()
+}
+
+// Pseudonymize pseudonymizes the entries of a tenant in the store the
+// emitter writes to (see Logger.Pseudonymize)
+func (e *Emitter) Pseudonymize(ctx context.Context, p *Pseudonymization) (int, error) {
+	if e == nil {
+		return 0, nil
+	}
+	return e.config.Logger.Pseudonymize(ctx, p)
+}
+
+// Pseudonym returns the ID the emitter writes for an ID: its pseudonym with
+// redaction pseudonymizing IDs, else the ID itself
+func (e *Emitter) Pseudonym(id string) string {
+	if e == nil || e.config.Redaction == nil {
+		return id
+	}
+	return e.config.Redaction.Pseudonym(id)
+}
+
+// Dropped returns the number of entries dropped by an async emitter
+func (e *Emitter) Dropped() uint64 {
+	if e == nil {
+		return 0
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.dropped
+}
+
+// Close stops an async emitter after writing queued entries
+func (e *Emitter) Close() {
+	if e == nil || e.queue == nil {
+		return
+	}
+
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.queue)
+	e.mu.Unlock()
+
+	<-e.done
+}
+
+// run writes queued entries (async emitters only)
+func (e *Emitter) run() {
+	defer close(e.done)
+
+	for item := range e.queue {
+		e.write(item.ctx, item.entry)
+	}
+}
+
+// write writes an entry, reporting failures to OnError
+func (e *Emitter) write(ctx context.Context, entry *AuditLog) {
+	if err := e.config.Logger.Log(ctx, entry); err != nil && e.config.OnError != nil {
+		e.config.OnError(entry, err)
+	}
+}
@@ -0,0 +1,69 @@
+package audit
+
+// Event types written by the Auth runtime (see Emitter)
+const (
+	// Authentication
+	EventLoginSucceeded  = "auth.login.succeeded"
+	EventLoginFailed     = "auth.login.failed"
+	EventLogout          = "auth.logout"
+	EventLogoutAll       = "auth.logout_all"
+	EventSuspiciousLogin = "auth.login.suspicious"
+
+	// Tokens
+	EventTokenRefreshed    = "token.refreshed"
+	EventTokenRevoked      = "token.revoked"
+	EventSystemTokenIssued = "token.system_issued"
+	EventTokenDownscoped   = "token.downscoped"
+	EventTokenSteppedUp    = "token.stepped_up"
+
+	// Multi-factor authentication and devices
+	EventMFAVerified     = "mfa.verified"
+	EventMFAFailed       = "mfa.failed"
+	EventDeviceTrusted   = "device.trusted"
+	EventDeviceUntrusted = "device.untrusted"
+
+	// Roles and permissions
+	EventRoleCreated       = "rbac.role.created"
+	EventRoleUpdated       = "rbac.role.updated"
+	EventRoleDeleted       = "rbac.role.deleted"
+	EventPermissionCreated = "rbac.permission.created"
+	EventPermissionDeleted = "rbac.permission.deleted"
+	EventPermissionGranted = "rbac.permission.granted"
+	EventPermissionRevoked = "rbac.permission.revoked"
+	EventRoleAssigned      = "rbac.role.assigned"
+	EventRoleUnassigned    = "rbac.role.unassigned"
+
+	// Users
+	EventUserStatusChanged = "user.status_changed"
+	EventUserErased        = "user.erased"
+	EventUserDataExported  = "user.data_exported"
+
+	// Email and username changes
+	EventIdentityChangeRequested = "user.identity_change_requested"
+	EventIdentityChangeCancelled = "user.identity_change_cancelled"
+	EventIdentityChanged         = "user.identity_changed"
+
+	// Profile self-service
+	EventProfileUpdated = "user.profile_updated"
+
+	// Account recovery
+	EventRecoveryCodesGenerated  = "recovery.codes_generated"
+	EventRecoveryContactAdded    = "recovery.contact_added"
+	EventRecoveryContactVerified = "recovery.contact_verified"
+	EventRecoveryContactRemoved  = "recovery.contact_removed"
+	EventRecoveryInitiated       = "recovery.initiated"
+	EventRecoveryCancelled       = "recovery.cancelled"
+	EventRecoverySucceeded       = "recovery.succeeded"
+	EventRecoveryFailed          = "recovery.failed"
+
+	// API keys
+	EventAPIKeyCreated = "apikey.created"
+	EventAPIKeyRevoked = "apikey.revoked"
+
+	// Authorization
+	EventAuthorizationDenied = "authz.denied"
+	EventCrossTenantAccess   = "authz.cross_tenant"
+
+	// Audit log
+	EventAuditPseudonymized = "audit.pseudonymized"
+)
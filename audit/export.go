@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported export format")
+)
+
+// Export formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// csvHeader are the columns of a CSV export
+var csvHeader = []string{
+	"id", "tenant_id", "app_id", "sequence", "timestamp", "event_type",
+	"actor_id", "subject_id", "resource", "action", "result",
+	"ip_address", "user_agent", "metadata", "prev_hash", "hash",
+}
+
+// ExportEntries writes every entry selected by a query (all pages, starting at
+// its cursor) as CSV or as a JSON array and returns how many were written.
+// Entries are streamed page by page, so large exports use little memory.
+func ExportEntries(ctx context.Context, w io.Writer, store AuditLogStore, query *Query, format string) (int, error) {
+	var writer exportWriter
+	switch format {
+	case FormatCSV:
+		writer = &csvExport{w: csv.NewWriter(w)}
+	case FormatJSON:
+		writer = &jsonExport{w: bufio.NewWriter(w)}
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+
+	page := *query
+	page.Limit = MaxQueryLimit
+	if err := writer.begin(); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		result, err := Search(ctx, store, &page)
+		if err != nil {
+			return written, err
+		}
+		for _, entry := range result.Entries {
+			if err := writer.write(entry); err != nil {
+				return written, err
+			}
+			written++
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		page.Cursor = result.NextCursor
+	}
+	return written, writer.end()
+}
+
+// exportWriter writes entries in an export format
+type exportWriter interface {
+	begin() error
+	write(entry *AuditLog) error
+	end() error
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+func (e *csvExport) begin() error {
+	return e.w.Write(csvHeader)
+}
+
+func (e *csvExport) write(entry *AuditLog) error {
+	var metadata string
+	if len(entry.Metadata) > 0 {
+		encoded, err := json.Marshal(entry.Metadata)
+		if err != nil {
+			return err
+		}
+		metadata = string(encoded)
+	}
+
+	var sequence string
+	if entry.Sequence > 0 {
+		sequence = strconv.FormatUint(entry.Sequence, 10)
+	}
+
+	return e.w.Write([]string{
+		entry.ID, entry.TenantID, entry.AppID, sequence,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano), entry.EventType,
+		entry.ActorID, entry.SubjectID, entry.Resource, entry.Action, entry.Result,
+		entry.IPAddress, entry.UserAgent, metadata, entry.PrevHash, entry.Hash,
+	})
+}
+
+func (e *csvExport) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonExport struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (e *jsonExport) begin() error {
+	_, err := e.w.WriteString("[")
+	return err
+}
+
+func (e *jsonExport) write(entry *AuditLog) error {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		e.w.WriteString(",")
+	}
+	e.count++
+	e.w.WriteString("\n")
+	_, err = e.w.Write(encoded)
+	return err
+}
+
+func (e *jsonExport) end() error {
+	if e.count > 0 {
+		e.w.WriteString("\n")
+	}
+	e.w.WriteString("]\n")
+	return e.w.Flush()
+}
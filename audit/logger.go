@@ -0,0 +1,310 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoCheckpointStore = errors.New("checkpoint store not configured")
+	ErrLoggerRunning     = errors.New("audit checkpointing already running")
+)
+
+// Config holds audit logger configuration
+type Config struct {
+	// Store persists entries (default: in-memory)
+	Store AuditLogStore
+
+	// HashChain links every entry to the previous entry of its tenant
+	// (default: false). Entries of a tenant are then appended one at a time.
+	HashChain bool
+
+	// Signer signs periodic checkpoints of hash chains (optional)
+	Signer CheckpointSigner
+
+	// Checkpoints persists checkpoints (default: Store, when it implements
+	// CheckpointStore)
+	Checkpoints CheckpointStore
+
+	// CheckpointEvery signs a checkpoint every N entries of a tenant
+	// (default: 1000 when Signer is set)
+	CheckpointEvery uint64
+
+	// CheckpointInterval is how often Start signs a checkpoint of every
+	// tenant with new entries (default: 1 hour)
+	CheckpointInterval time.Duration
+}
+
+// Logger writes audit log entries, optionally hash chained per tenant and
+// anchored by signed checkpoints
+type Logger struct {
+	config *Config
+	store  AuditLogStore
+
+	mu      sync.Mutex
+	tenants map[string]*sync.Mutex
+	dirty   map[string]bool // tenants with entries after their last checkpoint
+	stop    chan struct{}
+}
+
+// NewLogger creates a new audit logger
+func NewLogger(config *Config) *Logger {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.Store == nil {
+		config.Store = NewInMemoryAuditLogStore()
+	}
+	if config.Checkpoints == nil {
+		if checkpoints, ok := config.Store.(CheckpointStore); ok {
+			config.Checkpoints = checkpoints
+		}
+	}
+	if config.Signer != nil && config.CheckpointEvery == 0 {
+		config.CheckpointEvery = 1000
+	}
+	if config.CheckpointInterval <= 0 {
+		config.CheckpointInterval = time.Hour
+	}
+
+	return &Logger{
+		config:  config,
+		store:   config.Store,
+		tenants: make(map[string]*sync.Mutex),
+		dirty:   make(map[string]bool),
+	}
+}
+
+// Store returns the audit log store
+func (l *Logger) Store() AuditLogStore {
+	return l.store
+}
+
+// Log appends an entry. ID and Timestamp are filled when empty; with hash
+// chaining, Sequence, PrevHash and Hash are set.
+func (l *Logger) Log(ctx context.Context, entry *AuditLog) error {
+	if entry.EventType == "" {
+		return fmt.Errorf("%w: event type is required", ErrInvalidEntry)
+	}
+	if entry.ID == "" {
+		entry.ID = newID()
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	// Microsecond UTC timestamps survive a round trip through SQL stores
+	// unchanged, so the hash stays reproducible
+	entry.Timestamp = entry.Timestamp.UTC().Truncate(time.Microsecond)
+
+	if !l.config.HashChain {
+		return l.store.Append(ctx, entry)
+	}
+
+	lock := l.tenantLock(entry.TenantID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Another node may append to the same chain: retry on conflict
+	var err error
+	for range 3 {
+		if err = l.chain(ctx, entry); err != nil {
+			return err
+		}
+		err = l.store.Append(ctx, entry)
+		if !errors.Is(err, ErrSequenceConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.dirty[entry.TenantID] = true
+	l.mu.Unlock()
+
+	if l.config.Signer != nil && entry.Sequence%l.config.CheckpointEvery == 0 {
+		_, err = l.checkpoint(ctx, entry.TenantID, entry.Sequence, entry.Hash)
+	}
+	return err
+}
+
+// Checkpoint signs a checkpoint of the current head of a tenant chain.
+// It returns nil without a checkpoint when the chain is empty.
+func (l *Logger) Checkpoint(ctx context.Context, tenantID string) (*Checkpoint, error) {
+	if l.config.Signer == nil || l.config.Checkpoints == nil {
+		return nil, ErrNoCheckpointStore
+	}
+
+	lock := l.tenantLock(tenantID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	last, err := l.store.Last(ctx, tenantID)
+	if err != nil || last == nil || last.Sequence == 0 {
+		return nil, err
+	}
+	return l.checkpoint(ctx, tenantID, last.Sequence, last.Hash)
+}
+
+// Start signs checkpoints of tenants with new entries every
+// CheckpointInterval until ctx is cancelled or Stop is called
+func (l *Logger) Start(ctx context.Context) error {
+	if l.config.Signer == nil || l.config.Checkpoints == nil {
+		return ErrNoCheckpointStore
+	}
+
+	l.mu.Lock()
+	if l.stop != nil {
+		l.mu.Unlock()
+		return ErrLoggerRunning
+	}
+	stop := make(chan struct{})
+	l.stop = stop
+	l.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(l.config.CheckpointInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				l.checkpointDirty(ctx)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops periodic checkpoints
+func (l *Logger) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+}
+
+// checkpointDirty checkpoints every tenant with entries after its last checkpoint
+func (l *Logger) checkpointDirty(ctx context.Context) {
+	l.mu.Lock()
+	tenants := make([]string, 0, len(l.dirty))
+	for tenantID := range l.dirty {
+		tenants = append(tenants, tenantID)
+	}
+	l.mu.Unlock()
+
+	for _, tenantID := range tenants {
+		// A failed checkpoint stays dirty and is retried on the next tick
+		_, _ = l.Checkpoint(ctx, tenantID)
+	}
+}
+
+// chain links an entry to the current head of its tenant chain
+func (l *Logger) chain(ctx context.Context, entry *AuditLog) error {
+	last, err := l.store.Last(ctx, entry.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to read audit chain head: %w", err)
+	}
+
+	entry.Sequence = 1
+	entry.PrevHash = ""
+	if last != nil && last.Sequence > 0 {
+		entry.Sequence = last.Sequence + 1
+		entry.PrevHash = last.Hash
+	}
+
+	entry.Hash, err = HashEntry(entry)
+	return err
+}
+
+// checkpoint signs and saves a checkpoint (the tenant lock is held)
+func (l *Logger) checkpoint(ctx context.Context, tenantID string, sequence uint64, hash string) (*Checkpoint, error) {
+	if l.config.Checkpoints == nil {
+		return nil, ErrNoCheckpointStore
+	}
+
+	checkpoint, err := l.sign(tenantID, sequence, hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.config.Checkpoints.SaveCheckpoint(ctx, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	l.mu.Lock()
+	delete(l.dirty, tenantID)
+	l.mu.Unlock()
+	return checkpoint, nil
+}
+
+func (l *Logger) sign(tenantID string, sequence uint64, hash string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{
+		TenantID:  tenantID,
+		Sequence:  sequence,
+		Hash:      hash,
+		Timestamp: time.Now().UTC().Truncate(time.Microsecond),
+		KeyID:     l.config.Signer.KeyID(),
+	}
+
+	payload, err := checkpoint.signedPayload()
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.Signature, err = l.config.Signer.Sign(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+func (l *Logger) tenantLock(tenantID string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, ok := l.tenants[tenantID]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.tenants[tenantID] = lock
+	}
+	return lock
+}
+
+// HashEntry returns the hex SHA-256 hash of an entry: its JSON encoding
+// without the Hash and RedactedHash fields. PrevHash is included, linking
+// the entry to its predecessor.
+func HashEntry(entry *AuditLog) (string, error) {
+	unhashed := *entry
+	unhashed.Hash = ""
+	unhashed.RedactedHash = ""
+
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit log entry: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// newID returns a random entry ID
+func newID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrPseudonymizationNotSupported = errors.New("audit log store does not support pseudonymization")
+
+// Pseudonymization replaces the identifiers of a subject in the entries of a
+// tenant, e.g. to honor an erasure request. Entries keep their hash and
+// links and get the hash of their rewritten form (RedactedHash), which
+// Logger.Pseudonymize records in a chained EventAuditPseudonymized entry,
+// so Verify still checks every entry.
+type Pseudonymization struct {
+	// TenantID selects the entries of one tenant (required)
+	TenantID string
+
+	// IDs are the identifiers of the subject in entries: its ID and, with
+	// redaction, its pseudonym (see Redaction.Pseudonym)
+	IDs []string
+
+	// Pseudonym replaces the IDs in actor and subject IDs, resources
+	// ("user:<id>") and metadata values
+	Pseudonym string
+
+	// Values are personal data of the subject, e.g. its username and email;
+	// metadata values equal to one of them (case-insensitive) are replaced
+	// with Redacted
+	Values []string
+}
+
+// Pseudonymizer is an AuditLogStore that rewrites entries in place
+type Pseudonymizer interface {
+	// Pseudonymize pseudonymizes the entries of a tenant (see
+	// Pseudonymization.Apply) and returns the rewritten entries
+	Pseudonymize(ctx context.Context, p *Pseudonymization) ([]*AuditLog, error)
+}
+
+// Pseudonymize pseudonymizes the entries of a tenant and returns how many
+// were rewritten (ErrPseudonymizationNotSupported unless the store
+// implements Pseudonymizer). The redacted hashes of the rewritten chained
+// entries are recorded by an EventAuditPseudonymized entry appended to the
+// chain, and with a signer a checkpoint of the new head is signed, so the
+// rewritten entries are anchored like any other.
+func (l *Logger) Pseudonymize(ctx context.Context, p *Pseudonymization) (int, error) {
+	pseudonymizer, ok := l.store.(Pseudonymizer)
+	if !ok {
+		return 0, ErrPseudonymizationNotSupported
+	}
+	entries, err := pseudonymizer.Pseudonymize(ctx, p)
+	if err != nil || len(entries) == 0 {
+		return len(entries), err
+	}
+
+	// Keyed by sequence as text, so the metadata hashes the same after a
+	// JSON round trip through a store
+	redacted := make(map[string]any, len(entries))
+	for _, entry := range entries {
+		if entry.Sequence > 0 {
+			redacted[strconv.FormatUint(entry.Sequence, 10)] = entry.RedactedHash
+		}
+	}
+	if len(redacted) == 0 {
+		return len(entries), nil
+	}
+
+	err = l.Log(ctx, &AuditLog{
+		TenantID:  p.TenantID,
+		EventType: EventAuditPseudonymized,
+		Action:    "pseudonymize",
+		Result:    ResultSuccess,
+		Metadata:  map[string]any{"entries": redacted},
+	})
+	if err != nil {
+		return len(entries), fmt.Errorf("failed to record pseudonymization: %w", err)
+	}
+	if l.config.Signer != nil && l.config.Checkpoints != nil {
+		if _, err := l.Checkpoint(ctx, p.TenantID); err != nil {
+			return len(entries), err
+		}
+	}
+	return len(entries), nil
+}
+
+// Apply pseudonymizes an entry in place and reports whether it concerned
+// the subject. Entries the subject acted in also lose their IP address and
+// user agent; rewritten entries get the hash of their new form
+// (RedactedHash).
+func (p *Pseudonymization) Apply(entry *AuditLog) bool {
+	changed := false
+	if p.isID(entry.ActorID) {
+		entry.ActorID = p.Pseudonym
+		entry.IPAddress = ""
+		entry.UserAgent = ""
+		changed = true
+	}
+	if p.isID(entry.SubjectID) {
+		entry.SubjectID = p.Pseudonym
+		changed = true
+	}
+
+	if entry.Resource != "" {
+		parts := strings.Split(entry.Resource, ":")
+		for i, part := range parts {
+			if p.isID(part) {
+				parts[i] = p.Pseudonym
+				changed = true
+			}
+		}
+		entry.Resource = strings.Join(parts, ":")
+	}
+
+	for key, value := range entry.Metadata {
+		text, ok := value.(string)
+		switch {
+		case !ok:
+		case p.isID(text):
+			entry.Metadata[key] = p.Pseudonym
+			changed = true
+		case slices.ContainsFunc(p.Values, func(v string) bool { return v != "" && strings.EqualFold(v, text) }):
+			entry.Metadata[key] = Redacted
+			changed = true
+		}
+	}
+
+	if changed {
+		entry.Pseudonymized = true
+		entry.RedactedHash, _ = HashEntry(entry)
+	}
+	return changed
+}
+
+// redactedHashes returns the redacted hashes an EventAuditPseudonymized
+// entry records, by sequence
+func redactedHashes(entry *AuditLog) map[uint64]string {
+	recorded, _ := entry.Metadata["entries"].(map[string]any)
+	hashes := make(map[uint64]string, len(recorded))
+	for key, value := range recorded {
+		sequence, err := strconv.ParseUint(key, 10, 64)
+		hash, ok := value.(string)
+		if err == nil && ok {
+			hashes[sequence] = hash
+		}
+	}
+	return hashes
+}
+
+// isID reports whether a value is one of the identifiers of the subject
+func (p *Pseudonymization) isID(value string) bool {
+	return value != "" && slices.Contains(p.IDs, value)
+}
+
+// Pseudonymize pseudonymizes the entries of a tenant
+func (s *InMemoryAuditLogStore) Pseudonymize(ctx context.Context, p *Pseudonymization) ([]*AuditLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rewritten []*AuditLog
+	for _, entry := range s.entries[p.TenantID] {
+		if p.Apply(entry) {
+			rewritten = append(rewritten, entry.clone())
+		}
+	}
+	return rewritten, nil
+}
@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidQuery  = errors.New("invalid audit log query")
+	ErrInvalidCursor = errors.New("invalid audit log cursor")
+)
+
+// Page sizes of audit log queries
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+)
+
+// Query selects audit log entries for review. Empty fields match every
+// entry; entries are returned in log order (oldest first).
+type Query struct {
+	// TenantID selects the entries of one tenant; queries never span
+	// tenants
+	TenantID string
+
+	// AppID, ActorID and SubjectID select entries by app, actor or subject
+	AppID     string
+	ActorID   string
+	SubjectID string
+
+	// EventTypes selects entries of any of these event types; a trailing
+	// "*" matches a prefix, e.g. "rbac.*"
+	EventTypes []string
+
+	// Result selects entries by result (success, failure, denied)
+	Result string
+
+	// Since and Until select entries with Since <= Timestamp < Until
+	Since time.Time
+	Until time.Time
+
+	// Cursor continues after the last entry of a previous page
+	// (QueryResult.NextCursor)
+	Cursor string
+
+	// Limit is the page size (default: DefaultQueryLimit, at most
+	// MaxQueryLimit)
+	Limit int
+}
+
+// QueryResult is a page of audit log entries
+type QueryResult struct {
+	Entries []*AuditLog `json:"entries"`
+
+	// NextCursor continues with the next page ("" on the last page)
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// QueryStore is an AuditLogStore that filters entries itself, e.g. with
+// indexed SQL queries. Stores without it are queried through List.
+type QueryStore interface {
+	Query(ctx context.Context, query *Query) (*QueryResult, error)
+}
+
+// Search returns a page of the entries selected by a query
+func Search(ctx context.Context, store AuditLogStore, query *Query) (*QueryResult, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+	if queryStore, ok := store.(QueryStore); ok {
+		return queryStore.Query(ctx, query)
+	}
+
+	entries, err := store.List(ctx, &Filter{TenantID: query.TenantID})
+	if err != nil {
+		return nil, err
+	}
+	return query.page(entries)
+}
+
+// normalize validates a query and applies the defaults
+func (q *Query) normalize() error {
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return fmt.Errorf("%w: since must be before until", ErrInvalidQuery)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	q.Limit = min(q.Limit, MaxQueryLimit)
+	return nil
+}
+
+// Matches reports whether an entry matches the query filters (the cursor
+// and limit aside)
+func (q *Query) Matches(entry *AuditLog) bool {
+	switch {
+	case entry.TenantID != q.TenantID,
+		q.AppID != "" && entry.AppID != q.AppID,
+		q.ActorID != "" && entry.ActorID != q.ActorID,
+		q.SubjectID != "" && entry.SubjectID != q.SubjectID,
+		q.Result != "" && entry.Result != q.Result,
+		!q.Since.IsZero() && entry.Timestamp.Before(q.Since),
+		!q.Until.IsZero() && !entry.Timestamp.Before(q.Until):
+		return false
+	}
+
+	if len(q.EventTypes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(q.EventTypes, func(eventType string) bool {
+		if prefix, ok := strings.CutSuffix(eventType, "*"); ok {
+			return strings.HasPrefix(entry.EventType, prefix)
+		}
+		return entry.EventType == eventType
+	})
+}
+
+// page selects a page of the matching entries of a tenant log
+func (q *Query) page(entries []*AuditLog) (*QueryResult, error) {
+	start := 0
+	if q.Cursor != "" {
+		afterID, err := DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		index := slices.IndexFunc(entries, func(entry *AuditLog) bool { return entry.ID == afterID })
+		if index < 0 {
+			return nil, fmt.Errorf("%w: entry no longer exists", ErrInvalidCursor)
+		}
+		start = index + 1
+	}
+
+	result := &QueryResult{Entries: []*AuditLog{}}
+	for _, entry := range entries[start:] {
+		if !q.Matches(entry) {
+			continue
+		}
+		if len(result.Entries) == q.Limit {
+			result.NextCursor = EncodeCursor(result.Entries[len(result.Entries)-1].ID)
+			break
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	return result, nil
+}
+
+// EncodeCursor returns the cursor continuing after an entry, for QueryStore
+// implementations
+func EncodeCursor(entryID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(entryID))
+}
+
+// DecodeCursor returns the entry ID of a cursor
+func DecodeCursor(cursor string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(id) == 0 {
+		return "", ErrInvalidCursor
+	}
+	return string(id), nil
+}
+
+// Query returns a page of the entries selected by a query
+func (s *InMemoryAuditLogStore) Query(ctx context.Context, query *Query) (*QueryResult, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, err := query.page(s.entries[query.TenantID])
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range result.Entries {
+		result.Entries[i] = entry.clone()
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidRetention = errors.New("invalid audit log retention")
+)
+
+// RetentionConfig holds retention job configuration
+type RetentionConfig struct {
+	// MaxAge is how long entries are kept (required)
+	MaxAge time.Duration
+
+	// Interval is how often old entries are deleted (default: 24 hours)
+	Interval time.Duration
+
+	// OnCleanup is called with the number of deleted entries (optional)
+	OnCleanup func(deleted int)
+
+	// OnError is called when a cleanup fails (optional)
+	OnError func(err error)
+
+	// Now returns the current time (default: time.Now)
+	Now func() time.Time
+}
+
+// RetentionJob deletes audit log entries older than the retention period
+// with CleanupOld. The last entry of each chain is kept, so chains can
+// continue and be verified from the oldest retained entry.
+type RetentionJob struct {
+	store  AuditLogStore
+	config *RetentionConfig
+}
+
+// NewRetentionJob creates a retention job. Call Run to start it.
+func NewRetentionJob(store AuditLogStore, config *RetentionConfig) (*RetentionJob, error) {
+	if config == nil || config.MaxAge <= 0 {
+		return nil, fmt.Errorf("%w: max age is required", ErrInvalidRetention)
+	}
+	if config.Interval <= 0 {
+		config.Interval = 24 * time.Hour
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &RetentionJob{store: store, config: config}, nil
+}
+
+// Run deletes old entries now and then every interval until the context
+// is done. Errors are reported to OnError.
+func (j *RetentionJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.Cleanup(ctx); err != nil && j.config.OnError != nil {
+			j.config.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup deletes the entries older than the retention period and returns
+// how many were deleted
+func (j *RetentionJob) Cleanup(ctx context.Context) (int, error) {
+	deleted, err := j.store.CleanupOld(ctx, j.config.Now().Add(-j.config.MaxAge))
+	if err != nil {
+		return deleted, err
+	}
+	if j.config.OnCleanup != nil {
+		j.config.OnCleanup(deleted)
+	}
+	return deleted, nil
+}
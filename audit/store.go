@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// InMemoryAuditLogStore is an in-memory AuditLogStore and CheckpointStore
+type InMemoryAuditLogStore struct {
+	mu          sync.RWMutex
+	entries     map[string][]*AuditLog   // tenantID -> entries
+	checkpoints map[string][]*Checkpoint // tenantID -> checkpoints
+}
+
+// NewInMemoryAuditLogStore creates a new in-memory audit log store
+func NewInMemoryAuditLogStore() *InMemoryAuditLogStore {
+	return &InMemoryAuditLogStore{
+		entries:     make(map[string][]*AuditLog),
+		checkpoints: make(map[string][]*Checkpoint),
+	}
+}
+
+// Append stores an entry
+func (s *InMemoryAuditLogStore) Append(ctx context.Context, entry *AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.entries[entry.TenantID]
+	if entry.Sequence > 0 {
+		var last uint64
+		if len(entries) > 0 {
+			last = entries[len(entries)-1].Sequence
+		}
+		if entry.Sequence != last+1 {
+			return ErrSequenceConflict
+		}
+	}
+
+	s.entries[entry.TenantID] = append(entries, entry.clone())
+	return nil
+}
+
+// List returns the entries of a tenant
+func (s *InMemoryAuditLogStore) List(ctx context.Context, filter *Filter) ([]*AuditLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.entries[filter.TenantID]
+	result := make([]*AuditLog, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Sequence > 0 && entry.Sequence <= filter.AfterSequence {
+			continue
+		}
+		result = append(result, entry.clone())
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// Last returns the last entry of a tenant
+func (s *InMemoryAuditLogStore) Last(ctx context.Context, tenantID string) (*AuditLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.entries[tenantID]
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return entries[len(entries)-1].clone(), nil
+}
+
+// CleanupOld deletes entries older than before
+func (s *InMemoryAuditLogStore) CleanupOld(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for tenantID, entries := range s.entries {
+		kept := entries[:0]
+		for i, entry := range entries {
+			// The last entry of a chain is kept so the chain can continue
+			if entry.Timestamp.Before(before) && (entry.Sequence == 0 || i < len(entries)-1) {
+				deleted++
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		s.entries[tenantID] = kept
+	}
+	return deleted, nil
+}
+
+// SaveCheckpoint stores a checkpoint
+func (s *InMemoryAuditLogStore) SaveCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *checkpoint
+	copied.Signature = append([]byte(nil), checkpoint.Signature...)
+	s.checkpoints[checkpoint.TenantID] = append(s.checkpoints[checkpoint.TenantID], &copied)
+	return nil
+}
+
+// ListCheckpoints returns the checkpoints of a tenant
+func (s *InMemoryAuditLogStore) ListCheckpoints(ctx context.Context, tenantID string) ([]*Checkpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	checkpoints := make([]*Checkpoint, 0, len(s.checkpoints[tenantID]))
+	for _, checkpoint := range s.checkpoints[tenantID] {
+		copied := *checkpoint
+		copied.Signature = append([]byte(nil), checkpoint.Signature...)
+		checkpoints = append(checkpoints, &copied)
+	}
+	return checkpoints, nil
+}
+
+// Tenants returns the tenants that have entries
+func (s *InMemoryAuditLogStore) Tenants() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenants := make([]string, 0, len(s.entries))
+	for tenantID := range s.entries {
+		tenants = append(tenants, tenantID)
+	}
+	return tenants
+}
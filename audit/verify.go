@@ -0,0 +1,268 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ProblemKind classifies an integrity problem found by Verify
+type ProblemKind string
+
+const (
+	// ProblemHashMismatch: the entry does not match its hash (modified)
+	ProblemHashMismatch ProblemKind = "hash_mismatch"
+	// ProblemBrokenLink: PrevHash is not the hash of the previous entry
+	ProblemBrokenLink ProblemKind = "broken_link"
+	// ProblemSequenceGap: entries are missing between two sequences (removed)
+	ProblemSequenceGap ProblemKind = "sequence_gap"
+	// ProblemReordered: the entry is out of sequence order
+	ProblemReordered ProblemKind = "reordered"
+	// ProblemUnchained: the entry has no sequence or hash
+	ProblemUnchained ProblemKind = "unchained"
+	// ProblemBadSignature: the checkpoint signature is invalid
+	ProblemBadSignature ProblemKind = "bad_signature"
+	// ProblemCheckpointMismatch: the entry at a checkpoint has a different hash (rewritten chain)
+	ProblemCheckpointMismatch ProblemKind = "checkpoint_mismatch"
+	// ProblemTruncated: a checkpoint covers entries that no longer exist (tail removed)
+	ProblemTruncated ProblemKind = "truncated"
+	// ProblemUnrecordedPseudonymization: a pseudonymized entry is not recorded
+	// by a later EventAuditPseudonymized entry (modified or falsely flagged)
+	ProblemUnrecordedPseudonymization ProblemKind = "unrecorded_pseudonymization"
+)
+
+// Problem is an integrity problem at a sequence of a tenant chain
+type Problem struct {
+	Sequence uint64      `json:"sequence"`
+	EntryID  string      `json:"entry_id,omitempty"`
+	Kind     ProblemKind `json:"kind"`
+	Message  string      `json:"message"`
+}
+
+// Report is the result of verifying a tenant chain
+type Report struct {
+	TenantID      string    `json:"tenant_id"`
+	Entries       int       `json:"entries"`
+	FirstSequence uint64    `json:"first_sequence"`
+	LastSequence  uint64    `json:"last_sequence"`
+	Checkpoints   int       `json:"checkpoints"`
+	Verified      uint64    `json:"verified_sequence"`       // last sequence anchored by a valid checkpoint
+	Pseudonymized int       `json:"pseudonymized,omitempty"` // entries checked against their redacted hash (see Pseudonymization)
+	Problems      []Problem `json:"problems,omitempty"`
+}
+
+// Valid reports whether no integrity problem was found
+func (r *Report) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) add(entry *AuditLog, sequence uint64, kind ProblemKind, format string, args ...any) {
+	problem := Problem{Sequence: sequence, Kind: kind, Message: fmt.Sprintf(format, args...)}
+	if entry != nil {
+		problem.EntryID = entry.ID
+	}
+	r.Problems = append(r.Problems, problem)
+}
+
+// Verify checks the hash chain of a tenant: every entry must match its hash
+// and link to its predecessor without gaps. With checkpoints (optional) the
+// signature of every checkpoint is checked with verifier, and the entry at
+// each checkpoint must carry the signed hash, so a chain rewritten with
+// recomputed hashes is detected as well.
+//
+// Entries pseudonymized by an erasure request no longer match their hash:
+// they must match their redacted hash instead, which an
+// EventAuditPseudonymized entry later in the chain must record, and still
+// link to their neighbors. Report.Pseudonymized counts them.
+//
+// A chain may start after sequence 1 when old entries were removed with
+// CleanupOld; checkpoints before the first entry are then skipped.
+func Verify(ctx context.Context, store AuditLogStore, checkpoints CheckpointStore, verifier CheckpointVerifier, tenantID string) (*Report, error) {
+	entries, err := store.List(ctx, &Filter{TenantID: tenantID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+
+	report := &Report{TenantID: tenantID, Entries: len(entries)}
+	hashes := make(map[uint64]string, len(entries))
+
+	// Redacted hashes recorded by pseudonymization entries, the latest for
+	// entries pseudonymized more than once
+	redacted := make(map[uint64]string)
+	for _, entry := range entries {
+		if entry.EventType != EventAuditPseudonymized || entry.Sequence == 0 {
+			continue
+		}
+		for sequence, hash := range redactedHashes(entry) {
+			if sequence < entry.Sequence {
+				redacted[sequence] = hash
+			}
+		}
+	}
+
+	var prev *AuditLog
+	for _, entry := range entries {
+		if entry.Sequence == 0 || entry.Hash == "" {
+			report.add(entry, entry.Sequence, ProblemUnchained, "entry %s is not hash chained", entry.ID)
+			continue
+		}
+
+		hash, err := HashEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Pseudonymized {
+			report.Pseudonymized++
+		}
+		switch {
+		case !entry.Pseudonymized && hash != entry.Hash:
+			report.add(entry, entry.Sequence, ProblemHashMismatch, "entry %s does not match its hash", entry.ID)
+		case entry.Pseudonymized && hash != entry.RedactedHash:
+			report.add(entry, entry.Sequence, ProblemHashMismatch, "pseudonymized entry %s does not match its redacted hash", entry.ID)
+		case entry.Pseudonymized && redacted[entry.Sequence] != entry.RedactedHash:
+			report.add(entry, entry.Sequence, ProblemUnrecordedPseudonymization, "pseudonymization of entry %s is not recorded in the chain", entry.ID)
+		}
+
+		switch {
+		case prev == nil:
+			report.FirstSequence = entry.Sequence
+			if entry.Sequence == 1 && entry.PrevHash != "" {
+				report.add(entry, entry.Sequence, ProblemBrokenLink, "first entry links to a previous entry")
+			}
+		case entry.Sequence <= prev.Sequence:
+			report.add(entry, entry.Sequence, ProblemReordered, "entry %s follows entry %d", entry.ID, prev.Sequence)
+		case entry.Sequence == prev.Sequence+2:
+			report.add(entry, entry.Sequence, ProblemSequenceGap, "entry %d is missing", prev.Sequence+1)
+		case entry.Sequence != prev.Sequence+1:
+			report.add(entry, entry.Sequence, ProblemSequenceGap, "entries %d to %d are missing", prev.Sequence+1, entry.Sequence-1)
+		case entry.PrevHash != prev.Hash:
+			report.add(entry, entry.Sequence, ProblemBrokenLink, "entry %s does not link to entry %d", entry.ID, prev.Sequence)
+		}
+
+		hashes[entry.Sequence] = entry.Hash
+		report.LastSequence = entry.Sequence
+		prev = entry
+	}
+
+	if checkpoints == nil {
+		return report, nil
+	}
+
+	list, err := checkpoints.ListCheckpoints(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	report.Checkpoints = len(list)
+
+	for _, checkpoint := range list {
+		if verifier != nil {
+			payload, err := checkpoint.signedPayload()
+			if err != nil {
+				return nil, err
+			}
+			if err := verifier.Verify(checkpoint.KeyID, payload, checkpoint.Signature); err != nil {
+				report.add(nil, checkpoint.Sequence, ProblemBadSignature, "checkpoint %d: %v", checkpoint.Sequence, err)
+				continue
+			}
+		}
+
+		if checkpoint.Sequence < report.FirstSequence {
+			continue
+		}
+		if checkpoint.Sequence > report.LastSequence {
+			report.add(nil, checkpoint.Sequence, ProblemTruncated, "checkpoint %d is after the last entry %d", checkpoint.Sequence, report.LastSequence)
+			continue
+		}
+
+		hash, ok := hashes[checkpoint.Sequence]
+		if !ok {
+			// Reported as a sequence gap
+			continue
+		}
+		if hash != checkpoint.Hash {
+			report.add(nil, checkpoint.Sequence, ProblemCheckpointMismatch, "entry %d does not match its signed checkpoint", checkpoint.Sequence)
+			continue
+		}
+		if verifier != nil && checkpoint.Sequence > report.Verified {
+			report.Verified = checkpoint.Sequence
+		}
+	}
+
+	return report, nil
+}
+
+// exportRecord is a line of an exported audit log
+type exportRecord struct {
+	Entry      *AuditLog   `json:"entry,omitempty"`
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// Export writes the chain and checkpoints of a tenant as JSON lines, for
+// verification outside the system (see cmd/lokstra-audit-verify)
+func Export(ctx context.Context, store AuditLogStore, checkpoints CheckpointStore, tenantID string, w io.Writer) error {
+	entries, err := store.List(ctx, &Filter{TenantID: tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to list audit log: %w", err)
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(exportRecord{Entry: entry}); err != nil {
+			return err
+		}
+	}
+
+	if checkpoints == nil {
+		return nil
+	}
+	list, err := checkpoints.ListCheckpoints(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	for _, checkpoint := range list {
+		if err := encoder.Encode(exportRecord{Checkpoint: checkpoint}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import reads an export written by Export into an in-memory store.
+// Entries are stored as exported (integrity is checked by Verify, not here).
+func Import(r io.Reader) (*InMemoryAuditLogStore, error) {
+	store := NewInMemoryAuditLogStore()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record exportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch {
+		case record.Entry != nil:
+			store.mu.Lock()
+			store.entries[record.Entry.TenantID] = append(store.entries[record.Entry.TenantID], record.Entry)
+			store.mu.Unlock()
+		case record.Checkpoint != nil:
+			_ = store.SaveCheckpoint(context.Background(), record.Checkpoint)
+		default:
+			return nil, fmt.Errorf("line %d: empty record", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
@@ -4,23 +4,37 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	credential "github.com/primadi/lokstra-auth/01_credential"
 	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/device"
 	subject "github.com/primadi/lokstra-auth/03_subject"
 	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/loginattempt"
+	"github.com/primadi/lokstra-auth/metrics"
+	"github.com/primadi/lokstra-auth/secrets"
+	"github.com/primadi/lokstra-auth/tenant"
+	"github.com/primadi/lokstra-auth/tracing"
 )
 
 var (
-	ErrNoAuthenticator         = errors.New("no authenticator configured")
+	ErrNoAuthenticator         = autherrors.New(autherrors.ErrInvalidRequest, "no authenticator configured")
 	ErrNoTokenManager          = errors.New("no token manager configured")
 	ErrNoSubjectResolver       = errors.New("no subject resolver configured")
 	ErrNoContextBuilder        = errors.New("no identity context builder configured")
 	ErrNoAuthorizer            = errors.New("no authorizer configured")
-	ErrAuthenticationFailed    = errors.New("authentication failed")
+	ErrAuthenticationFailed    = autherrors.New(autherrors.ErrInvalidCredentials, "authentication failed")
 	ErrTokenGenerationFailed   = errors.New("token generation failed")
 	ErrSubjectResolutionFailed = errors.New("subject resolution failed")
-	ErrAuthorizationFailed     = errors.New("authorization check failed")
+	ErrAuthorizationFailed     = autherrors.New(autherrors.ErrPermissionDenied, "authorization check failed")
+	ErrRevocationNotSupported  = autherrors.New(autherrors.ErrNotImplemented, "token manager does not support revocation")
+	ErrMissingSubject          = autherrors.New(autherrors.ErrInvalidRequest, "subject ID is required")
+	ErrRefreshNotSupported     = autherrors.New(autherrors.ErrNotImplemented, "token manager does not support refresh tokens")
 )
 
 // Auth is the main runtime object for Lokstra Auth framework
@@ -28,19 +42,36 @@ var (
 type Auth struct {
 	// Layer 1: Credential Input
 	authenticators map[string]credential.Authenticator
+	resolver       credential.AuthenticatorResolver
+	parsers        *credential.Registry
 
 	// Layer 2: Token Management
 	tokenManager token.TokenManager
+	tokenStore   token.TokenStore
+	events       *token.EventDispatcher
+	deviceTokens *device.Manager
 
 	// Layer 3: Subject Resolution
 	subjectResolver subject.SubjectResolver
 	contextBuilder  subject.IdentityContextBuilder
+	identityStore   subject.IdentityStore
+	deviceStore     subject.DeviceStore
+	userIdentities  subject.UserIdentityStore
 
 	// Layer 4: Authorization
 	authorizer authz.Authorizer
 
 	// Configuration
-	config *Config
+	config         *Config
+	secretResolver secrets.SecretResolver
+	metrics        metrics.Recorder
+	tracer         tracing.Tracer
+	audit          *audit.Emitter
+	bus            *events.Bus
+	lockouts       loginLockouts
+	recoveryLocks  loginLockouts
+	attempts       loginattempt.Store
+	users          tenant.UserStore
 }
 
 // Config holds the configuration for Auth runtime
@@ -52,8 +83,62 @@ type Config struct {
 	IssueRefreshToken bool
 
 	// SessionManagement indicates whether to manage sessions
+	// (Login creates a server-side session in the identity store)
 	SessionManagement bool
 
+	// SessionPolicy is the default session policy (default: DefaultSessionPolicy)
+	SessionPolicy *SessionPolicy
+
+	// SessionPolicyResolver selects a session policy per identity (optional)
+	SessionPolicyResolver SessionPolicyResolver
+
+	// AccountLinking configures login-time account linking (optional, used
+	// with a user identity store)
+	AccountLinking *AccountLinkingConfig
+
+	// LoginNotifications notifies subjects of logins from a device or
+	// location never seen for them (optional)
+	LoginNotifications *LoginNotificationConfig
+
+	// Challenge requires a CAPTCHA or proof of work from risky logins
+	// (optional)
+	Challenge *ChallengeConfig
+
+	// Erasure gives Anonymize and ExportUserData the stores of user data
+	// the runtime does not hold otherwise (optional)
+	Erasure *ErasureConfig
+
+	// Recovery configures account recovery with backup codes, recovery
+	// contacts and admin-initiated recoveries (optional, requires a user
+	// store)
+	Recovery *RecoveryConfig
+
+	// IdentityChange configures email and username changes confirmed by
+	// the user (optional, requires a user store)
+	IdentityChange *IdentityChangeConfig
+
+	// Profile configures profile self-service (optional: by default, users
+	// edit DefaultProfileFields of their profile in the user store)
+	Profile *ProfileConfig
+
+	// MaxAuthorizationDepth limits nested Authorize / CheckPermission /
+	// CheckRole calls, e.g., an evaluator calling a store guarded by
+	// authorization (default: authz.DefaultMaxDepth)
+	MaxAuthorizationDepth int
+
+	// Sandbox marks tokens of sandboxed tenants or apps (optional). The
+	// tenant and app are taken from the login context (authz.WithTenant,
+	// authz.WithApp).
+	Sandbox SandboxPolicy
+
+	// AuthSettings supplies per-tenant and per-app auth settings overriding
+	// this configuration (optional, e.g., a tenant.AuthSettingsCache)
+	AuthSettings AuthSettingsSource
+
+	// Timeouts are per-layer latency budgets (optional, e.g., DefaultTimeouts()).
+	// A layer exceeding its budget fails the call with a *TimeoutError.
+	Timeouts *Timeouts
+
 	// Metadata contains additional runtime metadata
 	Metadata map[string]any
 }
@@ -76,6 +161,7 @@ func New(config *Config) *Auth {
 
 	return &Auth{
 		authenticators: make(map[string]credential.Authenticator),
+		parsers:        credential.NewRegistry(),
 		config:         config,
 	}
 }
@@ -85,11 +171,102 @@ func (a *Auth) RegisterAuthenticator(authType string, authenticator credential.A
 	a.authenticators[authType] = authenticator
 }
 
+// SetAuthenticatorResolver sets the resolver of per-tenant authenticators
+// (e.g., tenant.AuthenticatorFactory), consulted before the registered ones
+func (a *Auth) SetAuthenticatorResolver(resolver credential.AuthenticatorResolver) {
+	a.resolver = resolver
+}
+
+// RegisterCredentialParser sets the parser of a credential type, used by
+// ParseCredentials instead of the authenticator's own parser
+func (a *Auth) RegisterCredentialParser(credType string, parser credential.CredentialParser) {
+	a.parsers.Register(credType, parser)
+}
+
+// ParseCredentials parses credentials from a JSON payload, selecting the
+// parser by the "type" discriminator (default: the default authenticator
+// type): a registered parser, else the authenticator of that type when it
+// is a credential.CredentialParser. It lets a single login endpoint accept
+// every configured credential type.
+func (a *Auth) ParseCredentials(ctx context.Context, payload []byte) (credential.Credentials, error) {
+	credType, err := credential.PayloadType(payload)
+	if err != nil {
+		return nil, err
+	}
+	if credType == "" {
+		credType = a.config.DefaultAuthenticatorType
+	}
+
+	if parser, ok := a.parsers.Parser(credType); ok {
+		return parser.ParseCredentials(payload)
+	}
+
+	authenticator, err := a.authenticator(ctx, credType)
+	if errors.Is(err, ErrNoAuthenticator) {
+		return nil, fmt.Errorf("%w: %s", credential.ErrUnknownCredentialType, credType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	parser, ok := authenticator.(credential.CredentialParser)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no credential parser", credential.ErrUnknownCredentialType, credType)
+	}
+	return parser.ParseCredentials(payload)
+}
+
+// authenticator returns the authenticator of a credential type: the one
+// resolved for the context (tenant / app) or else the registered one
+func (a *Auth) authenticator(ctx context.Context, credType string) (credential.Authenticator, error) {
+	if a.resolver != nil {
+		authenticator, err := a.resolver.ResolveAuthenticator(ctx, credType)
+		if err != nil {
+			return nil, err
+		}
+		if authenticator != nil {
+			return authenticator, nil
+		}
+	}
+
+	authenticator, ok := a.authenticators[credType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoAuthenticator, credType)
+	}
+	return authenticator, nil
+}
+
 // SetTokenManager sets the token manager
 func (a *Auth) SetTokenManager(manager token.TokenManager) {
 	a.tokenManager = manager
 }
 
+// SetTokenStore sets the token store used to track issued tokens
+func (a *Auth) SetTokenStore(store token.TokenStore) {
+	a.tokenStore = store
+}
+
+// SetEventDispatcher sets the dispatcher that receives token lifecycle events
+// emitted by the runtime (login, refresh, logout, verification failures).
+// Attach observers either here or on the token manager, not both, to avoid
+// receiving every event twice.
+func (a *Auth) SetEventDispatcher(dispatcher *token.EventDispatcher) {
+	a.events = dispatcher
+}
+
+// Subscribe registers a token lifecycle observer
+// (creates a synchronous dispatcher if none is set)
+func (a *Auth) Subscribe(observer token.TokenObserver) {
+	if a.events == nil {
+		a.events = token.NewEventDispatcher()
+	}
+	a.events.Subscribe(observer)
+}
+
+// GetTokenStore returns the configured token store
+func (a *Auth) GetTokenStore() token.TokenStore {
+	return a.tokenStore
+}
+
 // SetSubjectResolver sets the subject resolver
 func (a *Auth) SetSubjectResolver(resolver subject.SubjectResolver) {
 	a.subjectResolver = resolver
@@ -100,11 +277,34 @@ func (a *Auth) SetIdentityContextBuilder(builder subject.IdentityContextBuilder)
 	a.contextBuilder = builder
 }
 
+// SetIdentityStore sets the identity store holding session identities
+func (a *Auth) SetIdentityStore(store subject.IdentityStore) {
+	a.identityStore = store
+}
+
 // SetAuthorizer sets the authorizer
 func (a *Auth) SetAuthorizer(authorizer authz.Authorizer) {
 	a.authorizer = authorizer
 }
 
+// SetSecretResolver sets the resolver used for secret references in configuration
+func (a *Auth) SetSecretResolver(resolver secrets.SecretResolver) {
+	a.secretResolver = resolver
+}
+
+// GetSecretResolver returns the configured secret resolver
+func (a *Auth) GetSecretResolver() secrets.SecretResolver {
+	return a.secretResolver
+}
+
+// ResolveSecret resolves a secret reference using the configured resolver
+func (a *Auth) ResolveSecret(ctx context.Context, ref secrets.Ref) (string, error) {
+	if a.secretResolver == nil {
+		return "", secrets.ErrResolverNotConfigured
+	}
+	return a.secretResolver.Resolve(ctx, ref)
+}
+
 // GetAuthorizer returns the configured authorizer
 func (a *Auth) GetAuthorizer() authz.Authorizer {
 	return a.authorizer
@@ -117,6 +317,13 @@ type LoginRequest struct {
 
 	// Metadata contains additional request metadata
 	Metadata map[string]any
+
+	// Device registers the device in the device store (optional)
+	Device *DeviceRegistration
+
+	// RememberDevice issues a long-lived device token for this device
+	// (requires a device token manager)
+	RememberDevice *device.Info
 }
 
 // LoginResponse represents a login response
@@ -130,6 +337,25 @@ type LoginResponse struct {
 	// Identity is the resolved identity context
 	Identity *subject.IdentityContext
 
+	// Session is the created server-side session (if session management is enabled)
+	Session *subject.SessionInfo
+
+	// DeviceToken is the remember-me device token (if requested)
+	DeviceToken *token.Token
+
+	// Device is the registered device (if a device store is configured)
+	Device *subject.DeviceInfo
+
+	// Sandbox indicates the tokens were issued in sandbox mode
+	Sandbox bool
+
+	// MFARequired indicates the auth settings of the tenant or app require
+	// a second factor the login did not provide: AccessToken is an
+	// MFA-pending token, which is no bearer credential, and there is no
+	// refresh token. The application verifies the second factor and
+	// exchanges the token with CompleteMFA.
+	MFARequired bool
+
 	// Metadata contains additional response metadata
 	Metadata map[string]any
 }
@@ -137,20 +363,168 @@ type LoginResponse struct {
 // Login performs the complete authentication flow
 // Layer 1 -> Layer 2 -> Layer 3
 func (a *Auth) Login(ctx context.Context, request *LoginRequest) (*LoginResponse, error) {
+	start := time.Now()
+	ctx, span := a.startSpan(ctx, "Login", tracing.String(tracing.AttrAuthenticator, request.Credentials.Type()))
+	response, subjectID, err := a.login(ctx, request)
+	tracing.End(span, err)
+	if a.metrics != nil {
+		a.metrics.ObserveLogin(request.Credentials.Type(), time.Since(start), err)
+	}
+	a.auditLogin(ctx, request, subjectID, err)
+	a.recordAttempt(ctx, request, response, subjectID, err)
+	a.publishLogin(ctx, request, subjectID, err)
+	return response, err
+}
+
+// login performs the authentication flow of Login and returns the
+// authenticated subject
+func (a *Auth) login(ctx context.Context, request *LoginRequest) (*LoginResponse, string, error) {
 	// Layer 1: Authenticate credentials
 	credType := request.Credentials.Type()
-	authenticator, ok := a.authenticators[credType]
-	if !ok {
-		return nil, fmt.Errorf("%w: %s", ErrNoAuthenticator, credType)
+	settings, err := a.authSettings(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	lockoutKey, err := a.checkLogin(ctx, settings, request.Credentials)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := a.checkChallenge(ctx, request); err != nil {
+		return nil, "", err
+	}
+
+	authenticator, err := a.authenticator(ctx, credType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The client IP address is available to authenticators (e.g., IP
+	// velocity limits) and enrichers
+	ip, _ := request.Metadata["ip_address"].(string)
+	userAgent, _ := request.Metadata["user_agent"].(string)
+	if ip != "" {
+		ctx = subject.WithClientIP(ctx, ip)
+	}
+
+	ctx, cancel := a.withRequestTimeout(ctx)
+	defer cancel()
+
+	authResult, err := inLayer(ctx, a, LayerAuthenticator, "authenticate "+credType,
+		func(ctx context.Context) (*credential.AuthenticationResult, error) {
+			return authenticator.Authenticate(ctx, request.Credentials)
+		})
+	if lockoutKey != "" {
+		if isCredentialFailure(authResult, err) {
+			window, duration := lockoutPolicy(settings)
+			a.lockouts.fail(lockoutKey, settings.LockoutThreshold, window, duration)
+		} else {
+			a.lockouts.reset(lockoutKey)
+		}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("authentication error: %w", err)
+	}
+
+	// Map the provider identity to the user it is linked to
+	authResult, err = a.resolveLinkedUser(ctx, credType, authResult)
+	if err != nil {
+		return nil, "", err
+	}
+
+	response, err := a.CompleteLogin(ctx, withAuthMethod(authResult, credType))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Remember this device (if requested)
+	if request.RememberDevice != nil {
+		if a.deviceTokens == nil {
+			return nil, "", ErrDeviceTokensNotSupported
+		}
+
+		deviceToken, _, err := a.deviceTokens.Issue(ctx, authResult.Subject, authResult.Claims, request.RememberDevice)
+		if err != nil {
+			return nil, "", err
+		}
+		response.DeviceToken = deviceToken
+	}
+
+	registration := request.Device
+	if registration == nil && request.RememberDevice != nil {
+		registration = &DeviceRegistration{
+			Fingerprint: request.RememberDevice.Fingerprint,
+			Name:        request.RememberDevice.Name,
+		}
+	}
+	if registration != nil {
+		if registration.IPAddress == "" {
+			registration.IPAddress = ip
+		}
+		if registration.UserAgent == "" {
+			registration.UserAgent = userAgent
+		}
+	}
+
+	newDevice := a.isNewDevice(ctx, authResult.Subject, registration)
+	if err := a.finishLogin(ctx, response, registration, ip, userAgent); err != nil {
+		return nil, "", err
+	}
+	if a.config.LoginNotifications != nil {
+		a.notifySuspiciousLogin(ctx, response, newDevice, ip, userAgent)
+	}
+
+	return response, authResult.Subject, nil
+}
+
+// finishLogin registers the device (if a device store is configured) and
+// creates a server-side session (if enabled) for a login response
+func (a *Auth) finishLogin(ctx context.Context, response *LoginResponse, registration *DeviceRegistration, ip, userAgent string) error {
+	if registration != nil && a.deviceStore != nil && response.Identity != nil && response.Identity.Subject != nil {
+		dev, err := a.RegisterDevice(ctx, response.Identity.Subject.ID, registration)
+		if err != nil {
+			return err
+		}
+		response.Device = dev
+	}
+
+	if !a.config.SessionManagement || response.Identity == nil || a.identityStore == nil {
+		// Surface the device without a server-side session
+		if response.Device != nil {
+			if response.Identity.Session == nil {
+				response.Identity.Session = &subject.SessionInfo{}
+			}
+			response.Identity.Session.IPAddress = ip
+			response.Identity.Session.UserAgent = userAgent
+			response.Identity.Session.Device = response.Device
+		}
+		return nil
 	}
 
-	authResult, err := authenticator.Authenticate(ctx, request.Credentials)
+	session, err := a.CreateSession(ctx, response.Identity, &SessionRequest{
+		IPAddress: ip,
+		UserAgent: userAgent,
+		Device:    response.Device,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("authentication error: %w", err)
+		return err
 	}
 
-	if !authResult.Success {
-		return nil, fmt.Errorf("%w: %v", ErrAuthenticationFailed, authResult.Error)
+	response.Session = session
+	response.Identity.Session = session
+	return nil
+}
+
+// CompleteLogin issues tokens and builds the identity context for an
+// already authenticated subject. It is used by flows that authenticate
+// outside of a credential.Authenticator (e.g., passkey ceremonies).
+// Layer 2 -> Layer 3
+func (a *Auth) CompleteLogin(ctx context.Context, authResult *credential.AuthenticationResult) (*LoginResponse, error) {
+	if authResult == nil || !authResult.Success {
+		var cause error
+		if authResult != nil {
+			cause = authResult.Error
+		}
+		return nil, fmt.Errorf("%w: %v", ErrAuthenticationFailed, cause)
 	}
 
 	// Layer 2: Generate tokens
@@ -158,45 +532,180 @@ func (a *Auth) Login(ctx context.Context, request *LoginRequest) (*LoginResponse
 		return nil, ErrNoTokenManager
 	}
 
-	accessToken, err := a.tokenManager.Generate(ctx, authResult.Claims)
+	if err := checkLoginClaims(authResult.Claims); err != nil {
+		return nil, err
+	}
+	ctx, err := bindTokenTenant(ctx, authResult.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only active users sign in, whatever the authenticator
+	if err := a.checkUserStatus(ctx, authz.TenantFromContext(ctx), authResult.Subject); err != nil {
+		return nil, err
+	}
+
+	ctx, claims, err := a.markSandbox(ctx, authResult.Claims)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox policy error: %w", err)
+	}
+	claims = authenticationClaims(claims, time.Now())
+
+	settings, err := a.authSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = withTokenLifetimes(ctx, settings)
+
+	// Logins still owing the second factor the settings require get an
+	// MFA-pending token only
+	mfaPending := requiresSecondFactor(settings, claims)
+	if mfaPending {
+		ctx, claims = mfaPendingLogin(ctx, claims)
+	}
+	return a.issueLogin(ctx, authResult.Subject, claims, mfaPending)
+}
+
+// issueLogin issues the tokens of a login and builds its identity context.
+// MFA-pending logins get no refresh token.
+// Layer 2 -> Layer 3
+func (a *Auth) issueLogin(ctx context.Context, subjectID string, claims map[string]any, mfaPending bool) (*LoginResponse, error) {
+	start := time.Now()
+	accessToken, err := inLayer(ctx, a, LayerToken, "generate access token",
+		func(ctx context.Context) (*token.Token, error) {
+			return a.tokenManager.Generate(ctx, claims)
+		})
+	a.observeIssue(token.TokenTypeAccess, start, err)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrTokenGenerationFailed, err)
+		return nil, fmt.Errorf("%w: %w", ErrTokenGenerationFailed, err)
 	}
 
 	response := &LoginResponse{
 		AccessToken: accessToken,
+		Sandbox:     authz.IsSandbox(ctx),
+		MFARequired: mfaPending,
 		Metadata:    make(map[string]any),
 	}
+	a.emit(ctx, token.EventIssued, subjectID, token.TokenTypeAccess, accessToken, nil)
 
 	// Generate refresh token if enabled
-	if a.config.IssueRefreshToken {
+	if a.config.IssueRefreshToken && !mfaPending {
 		// Check if token manager supports refresh tokens
 		if rtHandler, ok := a.tokenManager.(interface {
 			GenerateRefreshToken(ctx context.Context, claims token.Claims) (*token.Token, error)
 		}); ok {
-			refreshToken, err := rtHandler.GenerateRefreshToken(ctx, authResult.Claims)
+			start := time.Now()
+			refreshToken, err := inLayer(ctx, a, LayerToken, "generate refresh token",
+				func(ctx context.Context) (*token.Token, error) {
+					return rtHandler.GenerateRefreshToken(ctx, claims)
+				})
+			a.observeIssue(token.TokenTypeRefresh, start, err)
 			if err == nil {
 				response.RefreshToken = refreshToken
+				a.emit(ctx, token.EventIssued, subjectID, token.TokenTypeRefresh, refreshToken, nil)
 			}
 		}
 	}
 
+	// Track issued access token (if a token store is configured)
+	if a.tokenStore != nil && subjectID != "" {
+		if err := a.exec(ctx, "token", "store token", func(ctx context.Context) error {
+			return a.tokenStore.Store(ctx, subjectID, accessToken)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to store token: %w", err)
+		}
+	}
+
 	// Layer 3: Resolve subject and build identity context (optional)
 	if a.subjectResolver != nil && a.contextBuilder != nil {
-		sub, err := a.subjectResolver.Resolve(ctx, authResult.Claims)
+		identity, err := a.buildIdentity(ctx, claims)
 		if err != nil {
-			return nil, fmt.Errorf("%w: %v", ErrSubjectResolutionFailed, err)
+			return nil, err
 		}
+		response.Identity = identity
+	}
 
-		identity, err := a.contextBuilder.Build(ctx, sub)
-		if err != nil {
-			return nil, fmt.Errorf("identity context building error: %w", err)
+	return response, nil
+}
+
+// Refresh issues a new access token from a refresh token
+// Layer 2
+func (a *Auth) Refresh(ctx context.Context, refreshToken string) (*token.Token, error) {
+	if a.tokenManager == nil {
+		return nil, ErrNoTokenManager
+	}
+
+	refresher, ok := a.tokenManager.(interface {
+		Refresh(ctx context.Context, refreshToken string) (*token.Token, error)
+	})
+	if !ok {
+		return nil, ErrRefreshNotSupported
+	}
+
+	start := time.Now()
+	accessToken, err := inLayer(ctx, a, LayerToken, "refresh token",
+		func(ctx context.Context) (*token.Token, error) {
+			return refresher.Refresh(ctx, refreshToken)
+		})
+	a.observeIssue(token.TokenTypeAccess, start, err)
+	if err == nil && a.users != nil {
+		if err := a.checkRefreshedUser(ctx, accessToken); err != nil {
+			a.Audit(ctx, &audit.AuditLog{
+				EventType: audit.EventTokenRefreshed,
+				Result:    audit.ResultFailure,
+				Metadata:  auditMetadata(err, "token_type", token.TokenTypeRefresh),
+			})
+			return nil, err
 		}
+	}
+	if err != nil {
+		a.emit(ctx, token.EventVerificationFailed, "", token.TokenTypeRefresh, nil, err)
+		a.Audit(ctx, &audit.AuditLog{
+			EventType: audit.EventTokenRefreshed,
+			Result:    audit.ResultFailure,
+			Metadata:  auditMetadata(err, "token_type", token.TokenTypeRefresh),
+		})
+		return nil, fmt.Errorf("%w: %w", ErrAuthenticationFailed, err)
+	}
 
-		response.Identity = identity
+	a.emit(ctx, token.EventRefreshed, "", token.TokenTypeAccess, accessToken, nil)
+	a.Audit(ctx, &audit.AuditLog{EventType: audit.EventTokenRefreshed, Result: audit.ResultSuccess})
+	return accessToken, nil
+}
+
+// Logout revokes a single access or refresh token
+// Layer 2
+func (a *Auth) Logout(ctx context.Context, tokenValue string) error {
+	if a.tokenManager == nil {
+		return ErrNoTokenManager
 	}
 
-	return response, nil
+	revoker, ok := a.tokenManager.(interface {
+		Revoke(ctx context.Context, tokenValue string) error
+	})
+	if !ok {
+		return ErrRevocationNotSupported
+	}
+
+	if err := a.call(ctx, LayerToken, "revoke token", func(ctx context.Context) error {
+		return revoker.Revoke(ctx, tokenValue)
+	}); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	// Mark the token as revoked in the token store (if any)
+	if a.tokenStore != nil {
+		if err := a.exec(ctx, "token", "revoke stored token", func(ctx context.Context) error {
+			return a.tokenStore.Revoke(ctx, tokenValue)
+		}); err != nil {
+			return fmt.Errorf("failed to revoke stored token: %w", err)
+		}
+	}
+
+	a.emit(ctx, token.EventRevoked, "", "", nil, nil)
+	a.Audit(ctx, &audit.AuditLog{EventType: audit.EventLogout, Action: "logout", Result: audit.ResultSuccess})
+	a.publishRevoked(ctx, "", "logout")
+	return nil
 }
 
 // VerifyRequest represents a token verification request
@@ -207,6 +716,9 @@ type VerifyRequest struct {
 	// BuildIdentityContext indicates whether to build full identity context
 	BuildIdentityContext bool
 
+	// Options are per-call verification requirements (audience, scopes, token type)
+	Options *token.VerifyOptions
+
 	// Metadata contains additional request metadata
 	Metadata map[string]any
 }
@@ -219,6 +731,20 @@ type VerifyResponse struct {
 	// Claims contains the extracted claims
 	Claims token.Claims
 
+	// Sandbox indicates a sandbox token: authorize the request with
+	// authz.WithSandbox so it runs against the tenant's sandbox data
+	Sandbox bool
+
+	// TenantID and AppID are the tenant and app of the token (tenant_id /
+	// app_id claims, or the request context when the token has none)
+	TenantID string
+	AppID    string
+
+	// System indicates a system token, allowed to act in AllowedTenants:
+	// scope the request with authz.WithSystemScope
+	System         bool
+	AllowedTenants []string
+
 	// Identity is the resolved identity context (if requested)
 	Identity *subject.IdentityContext
 
@@ -229,54 +755,207 @@ type VerifyResponse struct {
 // Verify verifies a token and optionally builds identity context
 // Layer 2 -> Layer 3
 func (a *Auth) Verify(ctx context.Context, request *VerifyRequest) (*VerifyResponse, error) {
+	ctx, span := a.startSpan(ctx, "Verify")
+	response, err := a.verify(ctx, request)
+	if response != nil {
+		span.SetAttributes(tracing.Bool(tracing.AttrTokenValid, response.Valid))
+		if response.TenantID != "" {
+			span.SetAttributes(tracing.String(tracing.AttrTenant, response.TenantID))
+		}
+		if response.AppID != "" {
+			span.SetAttributes(tracing.String(tracing.AttrApp, response.AppID))
+		}
+	}
+	tracing.End(span, err)
+	return response, err
+}
+
+// verify performs the verification of Verify
+func (a *Auth) verify(ctx context.Context, request *VerifyRequest) (*VerifyResponse, error) {
 	// Layer 2: Verify token
 	if a.tokenManager == nil {
 		return nil, ErrNoTokenManager
 	}
 
-	verifyResult, err := a.tokenManager.Verify(ctx, request.Token)
+	ctx, cancel := a.withRequestTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	verifyResult, err := inLayer(ctx, a, LayerToken, "verify token",
+		func(ctx context.Context) (*token.VerificationResult, error) {
+			return a.verifyToken(ctx, request.Token, request.Options)
+		})
+	a.observeVerify(start, verifyResult, err)
 	if err != nil {
 		return nil, fmt.Errorf("token verification error: %w", err)
 	}
 
+	// Tokens never cross tenants, except system tokens into allowed tenants,
+	// and scope the context to their tenant and app
+	if verifyResult.Valid {
+		var err error
+		if ctx, err = bindTokenTenant(ctx, verifyResult.Claims); err != nil {
+			verifyResult = &token.VerificationResult{Valid: false, Claims: verifyResult.Claims, Error: err}
+		}
+	}
+
+	// MFA-pending tokens only verify when asked for
+	if verifyResult.Valid && verifyResult.Claims.TokenType() == token.TokenTypeMFAPending &&
+		(request.Options == nil || request.Options.TokenType != token.TokenTypeMFAPending) {
+		verifyResult = &token.VerificationResult{Valid: false, Claims: verifyResult.Claims, Error: ErrMFAPending}
+	}
+
 	response := &VerifyResponse{
 		Valid:    verifyResult.Valid,
 		Claims:   verifyResult.Claims,
+		Sandbox:  verifyResult.Valid && isSandboxToken(verifyResult.Claims),
+		System:   verifyResult.Valid && verifyResult.Claims.IsSystem(),
 		Metadata: make(map[string]any),
 	}
 
 	if !verifyResult.Valid {
+		sub, _ := verifyResult.Claims.GetString("sub")
+		a.emit(ctx, token.EventVerificationFailed, sub, "", nil, verifyResult.Error)
 		return response, nil
 	}
 
+	response.TenantID = authz.TenantFromContext(ctx)
+	response.AppID = authz.AppFromContext(ctx)
+	if response.System {
+		response.AllowedTenants = verifyResult.Claims.AllowedTenants()
+		ctx = authz.WithSystemScope(ctx, response.AllowedTenants)
+	}
+
 	// Layer 3: Build identity context if requested
 	if request.BuildIdentityContext && a.subjectResolver != nil && a.contextBuilder != nil {
-		sub, err := a.subjectResolver.Resolve(ctx, verifyResult.Claims)
-		if err != nil {
-			return nil, fmt.Errorf("%w: %v", ErrSubjectResolutionFailed, err)
+		if ip, ok := request.Metadata["ip_address"].(string); ok && ip != "" {
+			ctx = subject.WithClientIP(ctx, ip)
+		}
+		if response.Sandbox {
+			ctx = authz.WithSandbox(ctx)
 		}
 
-		identity, err := a.contextBuilder.Build(ctx, sub)
+		identity, err := a.buildIdentity(ctx, verifyResult.Claims)
 		if err != nil {
-			return nil, fmt.Errorf("identity context building error: %w", err)
+			return nil, err
 		}
-
 		response.Identity = identity
 	}
 
 	return response, nil
 }
 
-// Authorize checks if a subject is authorized to perform an action on a resource
+// inferTenant scopes the context to the tenant and app of verified claims,
+// unless the context already has them
+func inferTenant(ctx context.Context, claims token.Claims) context.Context {
+	tenantID, appID := claims.Tenant()
+	if tenantID != "" && authz.TenantFromContext(ctx) == "" {
+		ctx = authz.WithTenant(ctx, tenantID)
+	}
+	if appID != "" && authz.AppFromContext(ctx) == "" {
+		ctx = authz.WithApp(ctx, appID)
+	}
+	return ctx
+}
+
+// verifyToken verifies a token, enforcing verify options when provided and
+// the status of the user of the token (see SetUserStore)
+func (a *Auth) verifyToken(ctx context.Context, tokenValue string, opts *token.VerifyOptions) (*token.VerificationResult, error) {
+	result, err := a.verifyTokenOptions(ctx, tokenValue, opts)
+	if err != nil || !result.Valid {
+		return result, err
+	}
+
+	// The tokens of users that are no longer active stop working
+	if err := a.checkTokenUser(ctx, result.Claims); err != nil {
+		if !errors.Is(err, autherrors.ErrAccountDisabled) {
+			return nil, err
+		}
+		return &token.VerificationResult{Valid: false, Claims: result.Claims, Error: err}, nil
+	}
+	return result, nil
+}
+
+// checkRefreshedUser checks the status of the user of a refreshed access
+// token: users that are no longer active get no new tokens
+func (a *Auth) checkRefreshedUser(ctx context.Context, accessToken *token.Token) error {
+	result, err := a.verifyToken(ctx, accessToken.Value, nil)
+	if err != nil {
+		return fmt.Errorf("token verification error: %w", err)
+	}
+	if !result.Valid && errors.Is(result.Error, autherrors.ErrAccountDisabled) {
+		return result.Error
+	}
+	return nil
+}
+
+// verifyTokenOptions verifies a token, enforcing verify options when
+// provided
+func (a *Auth) verifyTokenOptions(ctx context.Context, tokenValue string, opts *token.VerifyOptions) (*token.VerificationResult, error) {
+	if opts == nil {
+		return a.tokenManager.Verify(ctx, tokenValue)
+	}
+
+	if verifier, ok := a.tokenManager.(token.OptionsVerifier); ok {
+		return verifier.VerifyWithOptions(ctx, tokenValue, opts)
+	}
+
+	result, err := a.tokenManager.Verify(ctx, tokenValue)
+	if err != nil || !result.Valid {
+		return result, err
+	}
+
+	if err := opts.Check(result.Claims); err != nil {
+		return &token.VerificationResult{
+			Valid:  false,
+			Claims: result.Claims,
+			Error:  err,
+		}, nil
+	}
+
+	return result, nil
+}
+
+// Authorize checks if a subject is authorized to perform an action on a
+// resource, in the tenant of the request (TenantID) or else of the context
 // Layer 4
 func (a *Auth) Authorize(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
 	if a.authorizer == nil {
 		return nil, ErrNoAuthorizer
 	}
 
-	decision, err := a.authorizer.Evaluate(ctx, request)
+	ctx, err := a.overrideTenant(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := a.withRequestTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	ctx, span := a.startSpan(ctx, "Authorize")
+	decision, err := inLayer(ctx, a, LayerAuthorizer, "evaluate",
+		func(ctx context.Context) (*authz.AuthorizationDecision, error) {
+			return a.guardedAuthorizer().Evaluate(ctx, request)
+		})
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrAuthorizationFailed, err)
+		tracing.End(span, err)
+		return nil, fmt.Errorf("%w: %w", ErrAuthorizationFailed, err)
+	}
+	allowed := decision != nil && decision.Allowed
+	span.SetAttributes(a.decisionAttrs(allowed)...)
+	span.End()
+	a.observeDecision(start, allowed, nil)
+	if !allowed {
+		var resource string
+		if request.Resource != nil {
+			resource = request.Resource.Type + ":" + request.Resource.ID
+		}
+		var metadata map[string]any
+		if decision != nil && decision.Reason != "" {
+			metadata = map[string]any{"reason": decision.Reason}
+		}
+		a.auditDenied(ctx, request.Subject, resource, string(request.Action), metadata)
 	}
 
 	return decision, nil
@@ -284,28 +963,230 @@ func (a *Auth) Authorize(ctx context.Context, request *authz.AuthorizationReques
 
 // CheckPermission is a convenience method to check a simple permission
 func (a *Auth) CheckPermission(ctx context.Context, identity *subject.IdentityContext, permission string) (bool, error) {
-	if a.authorizer == nil {
-		return false, ErrNoAuthorizer
-	}
+	return a.check(ctx, identity, "CheckPermission", "check_permission", map[string]any{"permission": permission},
+		func(ctx context.Context, checker authz.Authorizer) (bool, error) {
+			return checker.HasPermission(ctx, identity, permission)
+		})
+}
 
-	checker, ok := a.authorizer.(authz.PermissionChecker)
-	if !ok {
-		return false, errors.New("authorizer does not support permission checking")
-	}
+// CheckAnyPermission checks if identity has any of the permissions
+func (a *Auth) CheckAnyPermission(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return a.check(ctx, identity, "CheckAnyPermission", "check_any_permission", map[string]any{"permissions": permissions},
+		func(ctx context.Context, checker authz.Authorizer) (bool, error) {
+			return checker.HasAnyPermission(ctx, identity, permissions...)
+		})
+}
 
-	return checker.HasPermission(ctx, identity, permission)
+// CheckAllPermissions checks if identity has all of the permissions
+func (a *Auth) CheckAllPermissions(ctx context.Context, identity *subject.IdentityContext, permissions ...string) (bool, error) {
+	return a.check(ctx, identity, "CheckAllPermissions", "check_all_permissions", map[string]any{"permissions": permissions},
+		func(ctx context.Context, checker authz.Authorizer) (bool, error) {
+			return checker.HasAllPermissions(ctx, identity, permissions...)
+		})
 }
 
 // CheckRole is a convenience method to check if identity has a role
 func (a *Auth) CheckRole(ctx context.Context, identity *subject.IdentityContext, role string) (bool, error) {
+	return a.check(ctx, identity, "CheckRole", "check_role", map[string]any{"role": role},
+		func(ctx context.Context, checker authz.Authorizer) (bool, error) {
+			return checker.HasRole(ctx, identity, role)
+		})
+}
+
+// CheckAnyRole checks if identity has any of the roles
+func (a *Auth) CheckAnyRole(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return a.check(ctx, identity, "CheckAnyRole", "check_any_role", map[string]any{"roles": roles},
+		func(ctx context.Context, checker authz.Authorizer) (bool, error) {
+			return checker.HasAnyRole(ctx, identity, roles...)
+		})
+}
+
+// CheckAllRoles checks if identity has all of the roles
+func (a *Auth) CheckAllRoles(ctx context.Context, identity *subject.IdentityContext, roles ...string) (bool, error) {
+	return a.check(ctx, identity, "CheckAllRoles", "check_all_roles", map[string]any{"roles": roles},
+		func(ctx context.Context, checker authz.Authorizer) (bool, error) {
+			return checker.HasAllRoles(ctx, identity, roles...)
+		})
+}
+
+// check runs a permission or role check against the guarded authorizer,
+// tracing, measuring and auditing denials as action
+func (a *Auth) check(ctx context.Context, identity *subject.IdentityContext, name, action string, metadata map[string]any,
+	fn func(ctx context.Context, checker authz.Authorizer) (bool, error)) (bool, error) {
 	if a.authorizer == nil {
 		return false, ErrNoAuthorizer
 	}
 
-	checker, ok := a.authorizer.(authz.RoleChecker)
+	start := time.Now()
+	ctx, span := a.startSpan(ctx, name)
+	allowed, err := inLayer(ctx, a, LayerAuthorizer, strings.ReplaceAll(action, "_", " "),
+		func(ctx context.Context) (bool, error) {
+			return fn(ctx, a.guardedAuthorizer())
+		})
+	if err == nil {
+		span.SetAttributes(a.decisionAttrs(allowed)...)
+	}
+	tracing.End(span, err)
+	a.observeDecision(start, allowed, err)
+	if err == nil && !allowed {
+		a.auditDenied(ctx, identity, "", action, metadata)
+	}
+	return allowed, err
+}
+
+// guardedAuthorizer returns the authorizer behind the recursion guard:
+// system contexts are allowed, and nested or re-entrant calls are limited
+func (a *Auth) guardedAuthorizer() authz.Authorizer {
+	guarded, ok := a.authorizer.(*authz.GuardedAuthorizer)
 	if !ok {
-		return false, errors.New("authorizer does not support role checking")
+		guarded = authz.NewGuardedAuthorizer(a.authorizer, a.config.MaxAuthorizationDepth)
+	}
+	// Down-scoped tokens are restricted whatever the configured authorizer
+	return authz.Restrict(guarded)
+}
+
+// LogoutAll revokes all access and refresh tokens, remembered devices and
+// sessions of a subject of a tenant across every device (global logout).
+// The same subject ID in other tenants stays signed in.
+func (a *Auth) LogoutAll(ctx context.Context, tenantID, subjectID string) error {
+	if subjectID == "" {
+		return ErrMissingSubject
+	}
+
+	if a.tokenManager == nil {
+		return ErrNoTokenManager
+	}
+
+	if _, ok := a.tokenManager.(token.SubjectRevoker); !ok {
+		return ErrRevocationNotSupported
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+	if err := a.revokeSubject(ctx, tenantID, subjectID); err != nil {
+		return err
+	}
+
+	a.emit(ctx, token.EventRevoked, subjectID, "", nil, nil)
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventLogoutAll,
+		SubjectID: subjectID,
+		Action:    "logout_all",
+		Result:    audit.ResultSuccess,
+	})
+	a.publishRevoked(ctx, subjectID, "logout_all")
+	return nil
+}
+
+// revokeSubject revokes the tokens, remembered devices and sessions of a
+// subject of a tenant in every store that supports it. A failing step does
+// not stop the others; their errors are joined.
+func (a *Auth) revokeSubject(ctx context.Context, tenantID, subjectID string) error {
+	var errs []error
+
+	// Layer 2: Revoke every token issued by the token manager
+	if revoker, ok := a.tokenManager.(token.SubjectRevoker); ok {
+		if err := revoker.RevokeAllForSubject(ctx, tenantID, subjectID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to revoke tokens: %w", err))
+		}
+	}
+
+	// Revoke tokens tracked in the token store (if any)
+	if storeRevoker, ok := a.tokenStore.(token.SubjectRevoker); ok {
+		if err := storeRevoker.RevokeAllForSubject(ctx, tenantID, subjectID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to revoke stored tokens: %w", err))
+		}
+	}
+
+	// Forget remembered devices (if any)
+	if a.deviceTokens != nil {
+		if err := a.deviceTokens.RevokeAllForSubject(ctx, tenantID, subjectID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to revoke devices: %w", err))
+		}
+	}
+
+	// Layer 3: Remove the sessions of the tenant (if supported)
+	if sessionStore, ok := a.identityStore.(subject.SubjectSessionStore); ok {
+		if err := deleteTenantSessions(ctx, sessionStore, tenantID, subjectID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete sessions: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteTenantSessions deletes the sessions of a subject of a tenant.
+// Sessions whose subject has no tenant_id attribute cannot be told apart and
+// are deleted too.
+func deleteTenantSessions(ctx context.Context, store subject.SubjectSessionStore, tenantID, subjectID string) error {
+	identities, err := store.ListBySubject(ctx, subjectID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, identity := range identities {
+		if identity.Session == nil {
+			continue
+		}
+		if identity.Subject != nil {
+			if sessionTenant, ok := identity.Subject.Attributes[token.ClaimTenantID].(string); ok && sessionTenant != tenantID {
+				continue
+			}
+		}
+		if err := store.Delete(ctx, identity.Session.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// buildIdentity resolves the subject of claims and builds its identity context
+// Layer 3
+func (a *Auth) buildIdentity(ctx context.Context, claims token.Claims) (*subject.IdentityContext, error) {
+	sub, err := inLayer(ctx, a, LayerSubject, "resolve subject",
+		func(ctx context.Context) (*subject.Subject, error) {
+			return a.subjectResolver.Resolve(ctx, claims)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSubjectResolutionFailed, err)
+	}
+
+	identity, err := inLayer(ctx, a, LayerSubject, "build identity",
+		func(ctx context.Context) (*subject.IdentityContext, error) {
+			return a.contextBuilder.Build(ctx, sub)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("identity context building error: %w", err)
+	}
+
+	// Down-scoped tokens stay restricted whatever the subject resolver and
+	// the identity context builder keep
+	identity = scopedIdentity(identity, claims)
+	return withAuthentication(identity, claims), nil
+}
+
+// call runs a layer call without result under the layer's timeout
+func (a *Auth) call(ctx context.Context, layer Layer, operation string, fn func(ctx context.Context) error) error {
+	_, err := inLayer(ctx, a, layer, operation, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// emit dispatches a runtime token event (no-op without a dispatcher)
+func (a *Auth) emit(ctx context.Context, eventType token.EventType, subjectID, tokenType string, tok *token.Token, cause error) {
+	if a.events == nil {
+		return
+	}
+
+	event := &token.TokenEvent{
+		Type:      eventType,
+		Subject:   subjectID,
+		TokenType: tokenType,
+		Manager:   a.tokenManager.Type(),
+		Error:     cause,
+	}
+	if tok != nil {
+		event.ExpiresAt = tok.ExpiresAt
 	}
 
-	return checker.HasRole(ctx, identity, role)
+	a.events.Dispatch(ctx, event)
 }
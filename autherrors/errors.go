@@ -0,0 +1,201 @@
+// Package autherrors is the error taxonomy shared by all layers: errors
+// carry a stable code, an HTTP status and a message that is safe to show
+// to end users, independently of the package that returned them.
+//
+// Each layer keeps its own sentinels (basic.ErrInvalidCredentials,
+// jwt.ErrExpiredToken, ...) and declares their kind with New, so callers
+// can match either the precise error or its kind:
+//
+//	errors.Is(err, jwt.ErrExpiredToken)          // precise
+//	errors.Is(err, autherrors.ErrTokenExpired)   // any expired token
+//	autherrors.HTTPStatus(err)                   // 401
+//	autherrors.SafeMessage(err)                  // "token has expired"
+package autherrors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Code is a stable, machine-readable error code
+type Code string
+
+// Error codes
+const (
+	CodeInvalidRequest         Code = "invalid_request"
+	CodeUnauthenticated        Code = "unauthenticated"
+	CodeInvalidCredentials     Code = "invalid_credentials"
+	CodeAccountDisabled        Code = "account_disabled"
+	CodeTokenInvalid           Code = "token_invalid"
+	CodeTokenExpired           Code = "token_expired"
+	CodeTokenRevoked           Code = "token_revoked"
+	CodeTenantMismatch         Code = "tenant_mismatch"
+	CodeInsufficientScope      Code = "insufficient_scope"
+	CodePermissionDenied       Code = "permission_denied"
+	CodeReauthenticationNeeded Code = "reauthentication_required"
+	CodeNotFound               Code = "not_found"
+	CodeConflict               Code = "conflict"
+	CodeRateLimited            Code = "rate_limited"
+	CodeNotImplemented         Code = "not_implemented"
+	CodeUnavailable            Code = "unavailable"
+	CodeTimeout                Code = "timeout"
+	CodeInternal               Code = "internal"
+)
+
+// Error kinds. Match them with errors.Is; package errors declared with New
+// match the kind they were declared with.
+var (
+	ErrInvalidRequest         = kind(CodeInvalidRequest, http.StatusBadRequest, "invalid request", true)
+	ErrUnauthenticated        = kind(CodeUnauthenticated, http.StatusUnauthorized, "authentication required", false)
+	ErrInvalidCredentials     = kind(CodeInvalidCredentials, http.StatusUnauthorized, "invalid credentials", false)
+	ErrAccountDisabled        = kind(CodeAccountDisabled, http.StatusForbidden, "account is disabled", false)
+	ErrTokenInvalid           = kind(CodeTokenInvalid, http.StatusUnauthorized, "invalid token", false)
+	ErrTokenExpired           = kind(CodeTokenExpired, http.StatusUnauthorized, "token has expired", false)
+	ErrTokenRevoked           = kind(CodeTokenRevoked, http.StatusUnauthorized, "token has been revoked", false)
+	ErrTenantMismatch         = kind(CodeTenantMismatch, http.StatusForbidden, "token is not valid for this tenant", false)
+	ErrInsufficientScope      = kind(CodeInsufficientScope, http.StatusForbidden, "insufficient scope", false)
+	ErrPermissionDenied       = kind(CodePermissionDenied, http.StatusForbidden, "permission denied", false)
+	ErrReauthenticationNeeded = kind(CodeReauthenticationNeeded, http.StatusUnauthorized, "recent authentication required", false)
+	ErrNotFound               = kind(CodeNotFound, http.StatusNotFound, "not found", false)
+	ErrConflict               = kind(CodeConflict, http.StatusConflict, "conflict", true)
+	ErrRateLimited            = kind(CodeRateLimited, http.StatusTooManyRequests, "too many requests", false)
+	ErrNotImplemented         = kind(CodeNotImplemented, http.StatusNotImplemented, "not implemented", false)
+	ErrUnavailable            = kind(CodeUnavailable, http.StatusServiceUnavailable, "service unavailable", false)
+	ErrTimeout                = kind(CodeTimeout, http.StatusGatewayTimeout, "request timed out", false)
+	ErrInternal               = kind(CodeInternal, http.StatusInternalServerError, "internal error", false)
+)
+
+// Error is a coded error: either a kind (ErrInvalidCredentials, ...) or a
+// package error of a kind
+type Error struct {
+	// Code is the code of the kind
+	Code Code
+
+	// Status is the HTTP status of the kind
+	Status int
+
+	// Message is the safe, user-facing message of the kind
+	Message string
+
+	detail string // message of a package error
+	kind   *Error // nil for kinds
+	cause  error  // wrapped error (Wrap)
+	expose bool   // the detail is safe to show (validation errors)
+}
+
+func kind(code Code, status int, message string, expose bool) *Error {
+	return &Error{Code: code, Status: status, Message: message, expose: expose}
+}
+
+// New declares a package error of a kind, e.g.
+// ErrInvalidCredentials = autherrors.New(autherrors.ErrInvalidCredentials, "invalid credentials")
+func New(kind *Error, message string) error {
+	return newError(kind, message)
+}
+
+// Wrap attaches a kind to an error, e.g. a storage failure as ErrUnavailable
+func Wrap(kind *Error, err error) error {
+	if err == nil {
+		return nil
+	}
+	wrapped := newError(kind, err.Error())
+	wrapped.cause = err
+	return wrapped
+}
+
+func newError(kind *Error, message string) *Error {
+	kind = kind.Kind()
+	return &Error{Code: kind.Code, Status: kind.Status, Message: kind.Message, detail: message, kind: kind, expose: kind.expose}
+}
+
+// Error returns the detailed message
+func (e *Error) Error() string {
+	if e.detail != "" {
+		return e.detail
+	}
+	return e.Message
+}
+
+// Unwrap returns the wrapped error
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is matches the kind of a package error
+func (e *Error) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
+// Kind returns the kind of the error
+func (e *Error) Kind() *Error {
+	if e.kind != nil {
+		return e.kind
+	}
+	return e
+}
+
+// KindOf returns the kind of an error: the most specific coded error of its
+// chain (the innermost, or the last of errors joined with several %w, as in
+// "%w: %w" of a generic and a specific error); deadline errors are
+// ErrTimeout. It reports false for errors without a kind.
+func KindOf(err error) (*Error, bool) {
+	if err == nil {
+		return nil, false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout, true
+	}
+
+	var found *Error
+	var walk func(err error)
+	walk = func(err error) {
+		if coded, ok := err.(*Error); ok {
+			found = coded.Kind()
+		}
+		switch wrapped := err.(type) {
+		case interface{ Unwrap() error }:
+			if next := wrapped.Unwrap(); next != nil {
+				walk(next)
+			}
+		case interface{ Unwrap() []error }:
+			for _, next := range wrapped.Unwrap() {
+				if next != nil {
+					walk(next)
+				}
+			}
+		}
+	}
+	walk(err)
+	return found, found != nil
+}
+
+// CodeOf returns the code of an error (CodeInternal without a kind)
+func CodeOf(err error) Code {
+	if kind, ok := KindOf(err); ok {
+		return kind.Code
+	}
+	return CodeInternal
+}
+
+// HTTPStatus returns the HTTP status of an error (500 without a kind)
+func HTTPStatus(err error) int {
+	if kind, ok := KindOf(err); ok {
+		return kind.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// SafeMessage returns a message that can be shown to end users: the message
+// of the kind, or the error itself for validation errors. Errors without a
+// kind are "internal error", as their message may expose internals.
+func SafeMessage(err error) string {
+	kind, ok := KindOf(err)
+	if !ok {
+		return ErrInternal.Message
+	}
+	if kind.expose {
+		return err.Error()
+	}
+	return kind.Message
+}
@@ -3,8 +3,16 @@ package lokstraauth
 import (
 	credential "github.com/primadi/lokstra-auth/01_credential"
 	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/device"
 	subject "github.com/primadi/lokstra-auth/03_subject"
 	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/loginattempt"
+	"github.com/primadi/lokstra-auth/metrics"
+	"github.com/primadi/lokstra-auth/secrets"
+	"github.com/primadi/lokstra-auth/tenant"
+	"github.com/primadi/lokstra-auth/tracing"
 )
 
 // Builder provides a fluent API for building Auth runtime
@@ -31,12 +39,48 @@ func (b *Builder) WithAuthenticator(authType string, authenticator credential.Au
 	return b
 }
 
+// WithAuthenticatorResolver sets the resolver of per-tenant authenticators
+func (b *Builder) WithAuthenticatorResolver(resolver credential.AuthenticatorResolver) *Builder {
+	b.auth.SetAuthenticatorResolver(resolver)
+	return b
+}
+
+// WithCredentialParser sets the parser of a credential type
+func (b *Builder) WithCredentialParser(credType string, parser credential.CredentialParser) *Builder {
+	b.auth.RegisterCredentialParser(credType, parser)
+	return b
+}
+
 // WithTokenManager sets the token manager
 func (b *Builder) WithTokenManager(manager token.TokenManager) *Builder {
 	b.auth.SetTokenManager(manager)
 	return b
 }
 
+// WithTokenStore sets the token store
+func (b *Builder) WithTokenStore(store token.TokenStore) *Builder {
+	b.auth.SetTokenStore(store)
+	return b
+}
+
+// WithTokenObserver subscribes a token lifecycle observer
+func (b *Builder) WithTokenObserver(observer token.TokenObserver) *Builder {
+	b.auth.Subscribe(observer)
+	return b
+}
+
+// WithEventDispatcher sets the token event dispatcher (e.g., an async dispatcher)
+func (b *Builder) WithEventDispatcher(dispatcher *token.EventDispatcher) *Builder {
+	b.auth.SetEventDispatcher(dispatcher)
+	return b
+}
+
+// WithDeviceTokens sets the remember-me device token manager
+func (b *Builder) WithDeviceTokens(manager *device.Manager) *Builder {
+	b.auth.SetDeviceTokenManager(manager)
+	return b
+}
+
 // WithSubjectResolver sets the subject resolver
 func (b *Builder) WithSubjectResolver(resolver subject.SubjectResolver) *Builder {
 	b.auth.SetSubjectResolver(resolver)
@@ -49,12 +93,126 @@ func (b *Builder) WithIdentityContextBuilder(builder subject.IdentityContextBuil
 	return b
 }
 
+// WithIdentityStore sets the identity store used for sessions
+func (b *Builder) WithIdentityStore(store subject.IdentityStore) *Builder {
+	b.auth.SetIdentityStore(store)
+	return b
+}
+
+// WithDeviceStore sets the device registry store
+func (b *Builder) WithDeviceStore(store subject.DeviceStore) *Builder {
+	b.auth.SetDeviceStore(store)
+	return b
+}
+
+// WithUserIdentityStore sets the store of identities linked to users
+// (enables account linking)
+func (b *Builder) WithUserIdentityStore(store subject.UserIdentityStore) *Builder {
+	b.auth.userIdentities = store
+	return b
+}
+
+// WithAccountLinking configures login-time account linking
+func (b *Builder) WithAccountLinking(config *AccountLinkingConfig) *Builder {
+	b.auth.config.AccountLinking = config
+	return b
+}
+
+// WithLoginNotifications notifies subjects of logins from a new device or
+// location
+func (b *Builder) WithLoginNotifications(config *LoginNotificationConfig) *Builder {
+	b.auth.config.LoginNotifications = config
+	return b
+}
+
+// WithChallenge requires a challenge (CAPTCHA, proof of work) from logins
+// flagged by risk or lockout heuristics
+func (b *Builder) WithChallenge(config *ChallengeConfig) *Builder {
+	b.auth.config.Challenge = config
+	return b
+}
+
+// WithErasure gives Anonymize and ExportUserData the API key and consent
+// stores of users
+func (b *Builder) WithErasure(config *ErasureConfig) *Builder {
+	b.auth.config.Erasure = config
+	return b
+}
+
+// WithRecovery enables account recovery for users who lost their sign-in
+// factor: backup codes, recovery contacts and admin-initiated recoveries
+func (b *Builder) WithRecovery(config *RecoveryConfig) *Builder {
+	b.auth.config.Recovery = config
+	return b
+}
+
+// WithIdentityChange enables email and username changes that apply once the
+// user confirms them
+func (b *Builder) WithIdentityChange(config *IdentityChangeConfig) *Builder {
+	b.auth.config.IdentityChange = config
+	return b
+}
+
+// WithProfile configures profile self-service: the profile store, the
+// attributes users can edit and their validation
+func (b *Builder) WithProfile(config *ProfileConfig) *Builder {
+	b.auth.config.Profile = config
+	return b
+}
+
 // WithAuthorizer sets the authorizer
 func (b *Builder) WithAuthorizer(authorizer authz.Authorizer) *Builder {
 	b.auth.SetAuthorizer(authorizer)
 	return b
 }
 
+// WithSecretResolver sets the resolver for secret references (JWT keys,
+// database passwords, OAuth client secrets, SMTP credentials)
+func (b *Builder) WithSecretResolver(resolver secrets.SecretResolver) *Builder {
+	b.auth.SetSecretResolver(resolver)
+	return b
+}
+
+// WithMetrics sets the recorder of runtime metrics (e.g., a
+// metrics.Collector)
+func (b *Builder) WithMetrics(recorder metrics.Recorder) *Builder {
+	b.auth.SetMetrics(recorder)
+	return b
+}
+
+// WithTracer sets the tracer of the runtime (e.g., an OpenTelemetry
+// adapter)
+func (b *Builder) WithTracer(tracer tracing.Tracer) *Builder {
+	b.auth.SetTracer(tracer)
+	return b
+}
+
+// WithAuditEmitter sets the emitter of runtime audit events
+func (b *Builder) WithAuditEmitter(emitter *audit.Emitter) *Builder {
+	b.auth.SetAuditEmitter(emitter)
+	return b
+}
+
+// WithLoginAttemptStore sets the store of login attempts, which also backs
+// the account lockout
+func (b *Builder) WithLoginAttemptStore(store loginattempt.Store) *Builder {
+	b.auth.SetLoginAttemptStore(store)
+	return b
+}
+
+// WithUserStore sets the store of tenant users, whose lifecycle status
+// login and token verification enforce
+func (b *Builder) WithUserStore(store tenant.UserStore) *Builder {
+	b.auth.SetUserStore(store)
+	return b
+}
+
+// WithEventBus sets the bus of auth lifecycle events
+func (b *Builder) WithEventBus(bus *events.Bus) *Builder {
+	b.auth.SetEventBus(bus)
+	return b
+}
+
 // EnableRefreshToken enables refresh token generation
 func (b *Builder) EnableRefreshToken() *Builder {
 	b.auth.config.IssueRefreshToken = true
@@ -73,6 +231,38 @@ func (b *Builder) EnableSessionManagement() *Builder {
 	return b
 }
 
+// WithSessionPolicy sets the default session policy
+func (b *Builder) WithSessionPolicy(policy *SessionPolicy) *Builder {
+	b.auth.config.SessionPolicy = policy
+	return b
+}
+
+// WithSessionPolicyResolver sets a per-identity session policy resolver
+// (e.g., per tenant)
+func (b *Builder) WithSessionPolicyResolver(resolver SessionPolicyResolver) *Builder {
+	b.auth.config.SessionPolicyResolver = resolver
+	return b
+}
+
+// WithAuthSettings sets the source of per-tenant and per-app auth settings
+// (e.g., a tenant.AuthSettingsCache)
+func (b *Builder) WithAuthSettings(source AuthSettingsSource) *Builder {
+	b.auth.config.AuthSettings = source
+	return b
+}
+
+// WithTimeouts sets per-layer latency budgets (e.g., DefaultTimeouts())
+func (b *Builder) WithTimeouts(timeouts *Timeouts) *Builder {
+	b.auth.config.Timeouts = timeouts
+	return b
+}
+
+// WithSandboxPolicy sets the policy marking tokens of sandboxed tenants or apps
+func (b *Builder) WithSandboxPolicy(policy SandboxPolicy) *Builder {
+	b.auth.config.Sandbox = policy
+	return b
+}
+
 // DisableSessionManagement disables session management
 func (b *Builder) DisableSessionManagement() *Builder {
 	b.auth.config.SessionManagement = false
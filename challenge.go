@@ -0,0 +1,194 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/challenge"
+	"github.com/primadi/lokstra-auth/loginattempt"
+)
+
+var (
+	ErrChallengeRequired = autherrors.New(autherrors.ErrUnauthenticated, "challenge required")
+)
+
+// Login metadata of challenges
+const (
+	// MetadataChallengeResponse is the solution of the challenge submitted
+	// by the client (e.g., the CAPTCHA response token)
+	MetadataChallengeResponse = "challenge_response"
+
+	// MetadataChallengeVerified is set to true by Login once the solution
+	// is verified, for authenticators and hooks
+	MetadataChallengeVerified = "challenge_verified"
+)
+
+// ChallengeProvider presents challenges (CAPTCHA, proof of work) to the
+// clients of risky logins and verifies their solutions server-side. See the
+// challenge package for hCaptcha, reCAPTCHA, Turnstile and proof-of-work
+// providers.
+type ChallengeProvider interface {
+	// Challenge returns a challenge to present to a client
+	Challenge(ctx context.Context) (*challenge.Challenge, error)
+
+	// Verify verifies the solution of a challenge submitted from ip. It
+	// returns an error matching challenge.ErrInvalidSolution for rejected
+	// solutions.
+	Verify(ctx context.Context, solution, ip string) error
+}
+
+// ChallengeConfig configures when logins require a challenge
+type ChallengeConfig struct {
+	// Provider presents and verifies the challenges (required)
+	Provider ChallengeProvider
+
+	// AccountFailures requires a challenge after this many failed logins
+	// with invalid credentials of an account, since its last successful
+	// login within Window (default: 3; requires the login attempt store)
+	AccountFailures int
+
+	// IPFailures requires a challenge after this many failed logins with
+	// invalid credentials from the client IP address within Window, across
+	// accounts (0 disables; requires the login attempt store)
+	IPFailures int
+
+	// Window is the period of the failures counted (default: 1 hour)
+	Window time.Duration
+
+	// Required requires a challenge for other risk signals (optional), e.g.
+	// for every login of a tenant under attack
+	Required func(ctx context.Context, request *LoginRequest) bool
+}
+
+// ChallengeRequiredError is returned by Login when the login requires a
+// challenge that was not solved: the client solves Challenge and retries
+// with the solution in the MetadataChallengeResponse metadata.
+// errors.Is(err, ErrChallengeRequired) is true.
+type ChallengeRequiredError struct {
+	Challenge *challenge.Challenge
+
+	// Reason is the heuristic requiring the challenge ("account_failures",
+	// "ip_failures", "required")
+	Reason string
+
+	// Rejected is the verification error of a submitted solution (nil when
+	// none was submitted)
+	Rejected error
+}
+
+func (e *ChallengeRequiredError) Error() string {
+	if e.Rejected != nil {
+		return fmt.Sprintf("%s (%s): %v", ErrChallengeRequired, e.Reason, e.Rejected)
+	}
+	return fmt.Sprintf("%s (%s)", ErrChallengeRequired, e.Reason)
+}
+
+func (e *ChallengeRequiredError) Unwrap() error {
+	return ErrChallengeRequired
+}
+
+// checkChallenge requires the solution of a challenge from a login the
+// heuristics of the challenge configuration flag, before its credentials
+// are authenticated. Verification errors other than rejected solutions
+// (e.g., an unreachable CAPTCHA provider) fail the login.
+func (a *Auth) checkChallenge(ctx context.Context, request *LoginRequest) error {
+	config := a.config.Challenge
+	if config == nil || config.Provider == nil {
+		return nil
+	}
+
+	reason, err := a.challengeReason(ctx, config, request)
+	if err != nil || reason == "" {
+		return err
+	}
+
+	ip, _ := request.Metadata["ip_address"].(string)
+	solution, _ := request.Metadata[MetadataChallengeResponse].(string)
+	var rejected error
+	if solution != "" {
+		err := config.Provider.Verify(ctx, solution, ip)
+		if err == nil {
+			request.Metadata[MetadataChallengeVerified] = true
+			return nil
+		}
+		if !errors.Is(err, challenge.ErrInvalidSolution) {
+			return fmt.Errorf("failed to verify challenge: %w", err)
+		}
+		rejected = err
+	}
+
+	next, err := config.Provider.Challenge(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create challenge: %w", err)
+	}
+	return &ChallengeRequiredError{Challenge: next, Reason: reason, Rejected: rejected}
+}
+
+// challengeReason returns the heuristic requiring a challenge from a login
+// ("" if none)
+func (a *Auth) challengeReason(ctx context.Context, config *ChallengeConfig, request *LoginRequest) (string, error) {
+	if config.Required != nil && config.Required(ctx, request) {
+		return "required", nil
+	}
+	if a.attempts == nil {
+		return "", nil
+	}
+
+	window := config.Window
+	if window <= 0 {
+		window = time.Hour
+	}
+	since := time.Now().Add(-window)
+
+	threshold := config.AccountFailures
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if account, ok := request.Credentials.(credential.AccountCredentials); ok && account.Account() != "" {
+		attempts, err := a.attempts.List(ctx, &loginattempt.Query{
+			TenantID: authz.TenantFromContext(ctx),
+			AppID:    authz.AppFromContext(ctx),
+			Account:  account.Account(),
+			Since:    since,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to load login attempts: %w", err)
+		}
+
+		// Attempts are listed newest first
+		failures := 0
+		for _, attempt := range attempts {
+			if attempt.Success {
+				break
+			}
+			if attempt.FailureReason == string(autherrors.CodeInvalidCredentials) {
+				failures++
+			}
+		}
+		if failures >= threshold {
+			return "account_failures", nil
+		}
+	}
+
+	ip, _ := request.Metadata["ip_address"].(string)
+	if config.IPFailures > 0 && ip != "" {
+		failures, err := a.attempts.Count(ctx, &loginattempt.Query{
+			TenantID:      authz.TenantFromContext(ctx),
+			IPAddress:     ip,
+			FailureReason: string(autherrors.CodeInvalidCredentials),
+			Since:         since,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to count login attempts: %w", err)
+		}
+		if failures >= config.IPFailures {
+			return "ip_failures", nil
+		}
+	}
+	return "", nil
+}
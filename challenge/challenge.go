@@ -0,0 +1,42 @@
+// Package challenge presents challenges to clients before risky logins and
+// verifies their solutions server-side: CAPTCHAs (hCaptcha, reCAPTCHA,
+// Cloudflare Turnstile) verified with the siteverify API of the provider,
+// and a self-hosted proof of work that needs no third party.
+package challenge
+
+import (
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrMissingSolution = autherrors.New(autherrors.ErrInvalidRequest, "challenge solution is missing")
+	ErrInvalidSolution = autherrors.New(autherrors.ErrUnauthenticated, "challenge solution is invalid")
+	ErrUnavailable     = autherrors.New(autherrors.ErrUnavailable, "challenge verification is unavailable")
+)
+
+// Challenge types
+const (
+	TypeHCaptcha    = "hcaptcha"
+	TypeReCAPTCHA   = "recaptcha"
+	TypeTurnstile   = "turnstile"
+	TypeProofOfWork = "pow"
+)
+
+// Challenge is a challenge presented to a client: the widget of a CAPTCHA
+// (Type and SiteKey), or a proof-of-work puzzle
+type Challenge struct {
+	Type string `json:"type"`
+
+	// SiteKey is the public key of the CAPTCHA widget
+	SiteKey string `json:"site_key,omitempty"`
+
+	// Puzzle is the proof-of-work puzzle, and Difficulty the number of
+	// leading zero bits of the hash of its solution
+	Puzzle     string `json:"puzzle,omitempty"`
+	Difficulty int    `json:"difficulty,omitempty"`
+
+	// ExpiresAt is when the puzzle can no longer be solved
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
@@ -0,0 +1,162 @@
+package challenge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProofOfWorkConfig holds proof-of-work configuration
+type ProofOfWorkConfig struct {
+	// Secret signs the puzzles (required, at least 32 bytes)
+	Secret []byte
+
+	// Difficulty is the number of leading zero bits of the SHA-256 hash of
+	// a solution (default: 20, about a million hashes)
+	Difficulty int
+
+	// TTL is how long a puzzle can be solved (default: 5 minutes)
+	TTL time.Duration
+}
+
+// ProofOfWork is a self-hosted challenge: the client finds a counter such
+// that SHA-256("<puzzle>:<counter>") starts with Difficulty zero bits, and
+// submits "<puzzle>:<counter>". Puzzles are signed and stateless; solved
+// puzzles are remembered until they expire so they cannot be replayed on
+// this instance.
+type ProofOfWork struct {
+	config *ProofOfWorkConfig
+
+	mu   sync.Mutex
+	used map[string]time.Time // puzzle -> expiry
+}
+
+// NewProofOfWork creates a new proof-of-work challenge
+func NewProofOfWork(config *ProofOfWorkConfig) (*ProofOfWork, error) {
+	if len(config.Secret) < 32 {
+		return nil, errors.New("proof-of-work secret must be at least 32 bytes")
+	}
+	if config.Difficulty <= 0 {
+		config.Difficulty = 20
+	}
+	if config.Difficulty > 64 {
+		return nil, errors.New("proof-of-work difficulty must be at most 64 bits")
+	}
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+	return &ProofOfWork{
+		config: config,
+		used:   make(map[string]time.Time),
+	}, nil
+}
+
+// Challenge returns a new puzzle
+func (p *ProofOfWork) Challenge(ctx context.Context) (*Challenge, error) {
+	// payload: nonce (16) | expiry (8) | difficulty (1)
+	payload := make([]byte, 25)
+	if _, err := rand.Read(payload[:16]); err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(p.config.TTL).Truncate(time.Second)
+	binary.BigEndian.PutUint64(payload[16:24], uint64(expiresAt.Unix()))
+	payload[24] = byte(p.config.Difficulty)
+
+	encoding := base64.RawURLEncoding
+	return &Challenge{
+		Type:       TypeProofOfWork,
+		Puzzle:     encoding.EncodeToString(payload) + "." + encoding.EncodeToString(p.sign(payload)),
+		Difficulty: p.config.Difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Verify verifies a "<puzzle>:<counter>" solution
+func (p *ProofOfWork) Verify(ctx context.Context, solution, ip string) error {
+	if solution == "" {
+		return ErrMissingSolution
+	}
+	puzzle, counter, ok := strings.Cut(solution, ":")
+	if !ok || counter == "" {
+		return fmt.Errorf("%w: malformed solution", ErrInvalidSolution)
+	}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(puzzle, ".")
+	if !ok {
+		return fmt.Errorf("%w: malformed puzzle", ErrInvalidSolution)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload) != 25 {
+		return fmt.Errorf("%w: malformed puzzle", ErrInvalidSolution)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, p.sign(payload)) {
+		return fmt.Errorf("%w: puzzle signature mismatch", ErrInvalidSolution)
+	}
+
+	now := time.Now()
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload[16:24])), 0)
+	if !now.Before(expiresAt) {
+		return fmt.Errorf("%w: puzzle expired", ErrInvalidSolution)
+	}
+
+	hash := sha256.Sum256([]byte(solution))
+	if leadingZeroBits(hash[:]) < int(payload[24]) {
+		return fmt.Errorf("%w: insufficient work", ErrInvalidSolution)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for used, expiry := range p.used {
+		if !now.Before(expiry) {
+			delete(p.used, used)
+		}
+	}
+	if _, replayed := p.used[puzzle]; replayed {
+		return fmt.Errorf("%w: puzzle already solved", ErrInvalidSolution)
+	}
+	p.used[puzzle] = expiresAt
+	return nil
+}
+
+// Solve finds the solution of a puzzle (for clients written in Go and for
+// tests; browsers solve puzzles in JavaScript)
+func Solve(ctx context.Context, challenge *Challenge) (string, error) {
+	for counter := uint64(0); ; counter++ {
+		if counter%65536 == 0 && ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		solution := fmt.Sprintf("%s:%d", challenge.Puzzle, counter)
+		hash := sha256.Sum256([]byte(solution))
+		if leadingZeroBits(hash[:]) >= challenge.Difficulty {
+			return solution, nil
+		}
+	}
+}
+
+func (p *ProofOfWork) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.config.Secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// leadingZeroBits counts the leading zero bits of a hash
+func leadingZeroBits(hash []byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,153 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Verification endpoints of the CAPTCHA providers
+const (
+	HCaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+	ReCAPTCHAVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+	TurnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+// SiteVerifyConfig holds the configuration of a CAPTCHA provider
+type SiteVerifyConfig struct {
+	// SiteKey is the public key of the widget (required)
+	SiteKey string
+
+	// Secret is the server-side secret key (required)
+	Secret string
+
+	// Hostnames, when set, are the only site hostnames accepted
+	Hostnames []string
+
+	// Action, when set, is the only widget action accepted (reCAPTCHA v3,
+	// Turnstile)
+	Action string
+
+	// MinScore is the minimum score accepted (reCAPTCHA v3: 0.0 is a bot,
+	// 1.0 a human; default: 0.5 when the response has a score)
+	MinScore float64
+
+	// VerifyURL overrides the verification endpoint (e.g., a proxy or the
+	// reCAPTCHA Enterprise compatible endpoint)
+	VerifyURL string
+
+	// HTTPClient is the HTTP client (default: 5 second timeout)
+	HTTPClient *http.Client
+}
+
+// SiteVerifier verifies CAPTCHA responses with the siteverify API shared by
+// hCaptcha, reCAPTCHA and Turnstile: the response token of the widget is
+// posted with the secret key and the client IP address.
+type SiteVerifier struct {
+	challengeType string
+	verifyURL     string
+	config        *SiteVerifyConfig
+}
+
+// NewHCaptcha creates a verifier of hCaptcha responses
+func NewHCaptcha(config *SiteVerifyConfig) *SiteVerifier {
+	return newSiteVerifier(TypeHCaptcha, HCaptchaVerifyURL, config)
+}
+
+// NewReCAPTCHA creates a verifier of reCAPTCHA (v2 and v3) responses
+func NewReCAPTCHA(config *SiteVerifyConfig) *SiteVerifier {
+	return newSiteVerifier(TypeReCAPTCHA, ReCAPTCHAVerifyURL, config)
+}
+
+// NewTurnstile creates a verifier of Cloudflare Turnstile responses
+func NewTurnstile(config *SiteVerifyConfig) *SiteVerifier {
+	return newSiteVerifier(TypeTurnstile, TurnstileVerifyURL, config)
+}
+
+func newSiteVerifier(challengeType, verifyURL string, config *SiteVerifyConfig) *SiteVerifier {
+	if config.VerifyURL != "" {
+		verifyURL = config.VerifyURL
+	}
+	if config.MinScore <= 0 {
+		config.MinScore = 0.5
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &SiteVerifier{
+		challengeType: challengeType,
+		verifyURL:     verifyURL,
+		config:        config,
+	}
+}
+
+// Challenge returns the widget to present to the client
+func (v *SiteVerifier) Challenge(ctx context.Context) (*Challenge, error) {
+	return &Challenge{
+		Type:    v.challengeType,
+		SiteKey: v.config.SiteKey,
+	}, nil
+}
+
+// siteVerifyResponse is the response of the siteverify API
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Hostname   string   `json:"hostname"`
+	Action     string   `json:"action"`
+	Score      *float64 `json:"score"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify verifies the response token of the widget solved from ip
+func (v *SiteVerifier) Verify(ctx context.Context, solution, ip string) error {
+	if solution == "" {
+		return ErrMissingSolution
+	}
+
+	form := url.Values{
+		"secret":   {v.config.Secret},
+		"response": {solution},
+		"sitekey":  {v.config.SiteKey},
+	}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.config.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", ErrUnavailable, v.challengeType, resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	switch {
+	case !result.Success:
+		return fmt.Errorf("%w: %s", ErrInvalidSolution, strings.Join(result.ErrorCodes, ", "))
+	case len(v.config.Hostnames) > 0 && !slices.Contains(v.config.Hostnames, result.Hostname):
+		return fmt.Errorf("%w: unexpected hostname %q", ErrInvalidSolution, result.Hostname)
+	case v.config.Action != "" && result.Action != v.config.Action:
+		return fmt.Errorf("%w: unexpected action %q", ErrInvalidSolution, result.Action)
+	case result.Score != nil && *result.Score < v.config.MinScore:
+		return fmt.Errorf("%w: score %.2f below %.2f", ErrInvalidSolution, *result.Score, v.config.MinScore)
+	}
+	return nil
+}
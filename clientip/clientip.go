@@ -0,0 +1,75 @@
+// Package clientip resolves the client IP address of HTTP requests.
+//
+// The X-Forwarded-For header is only believed as far as it was written by
+// trusted proxies: starting from the peer address of the connection, each
+// trusted proxy vouches for the hop it appended, and the client is the
+// rightmost hop that is not a trusted proxy. Without trusted proxies, the
+// header is ignored and the client is the peer of the connection, so
+// clients cannot spoof their address (e.g., to evade per-IP lockouts or IP
+// policies).
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// FromRequest returns the client IP address of a request received from
+// trustedProxies (e.g., netip.MustParsePrefix("10.0.0.0/8") for the load
+// balancers of a private network)
+func FromRequest(r *http.Request, trustedProxies []netip.Prefix) string {
+	peer, ok := parseHop(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+
+	hops := forwardedFor(r)
+	client := peer
+	for i := len(hops) - 1; i >= 0 && trusted(client, trustedProxies); i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			// The proxy is the last address known to be genuine
+			break
+		}
+		client = hop
+	}
+	return client.String()
+}
+
+// forwardedFor returns the hops of the X-Forwarded-For headers of a
+// request, from the client to the nearest proxy
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for hop := range strings.SplitSeq(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseHop parses an address with an optional port ("192.0.2.1",
+// "192.0.2.1:8080", "2001:db8::1", "[2001:db8::1]:8080"). IPv4-mapped IPv6
+// addresses are unmapped.
+func parseHop(value string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// trusted reports whether an address is one of the trusted proxies
+func trusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package clientip
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		trusted    []netip.Prefix
+		want       string
+	}{
+		// Without trusted proxies the header is ignored
+		{"direct", "198.51.100.7:4711", nil, nil, "198.51.100.7"},
+		{"spoofed without proxies", "198.51.100.7:4711", []string{"1.2.3.4"}, nil, "198.51.100.7"},
+		{"spoofed from an untrusted peer", "198.51.100.7:4711", []string{"1.2.3.4"}, proxies, "198.51.100.7"},
+
+		// Bracketed and bare peer addresses
+		{"ipv6 peer", "[2001:db8::1]:4711", nil, nil, "2001:db8::1"},
+		{"ipv4-mapped peer", "[::ffff:198.51.100.7]:4711", nil, nil, "198.51.100.7"},
+		{"peer without port", "198.51.100.7", nil, nil, "198.51.100.7"},
+		{"unparsable peer", "pipe", nil, nil, "pipe"},
+
+		// Rightmost hop that is not a trusted proxy
+		{"one proxy", "10.0.0.1:4711", []string{"198.51.100.7"}, proxies, "198.51.100.7"},
+		{"client-supplied prefix", "10.0.0.1:4711", []string{"1.2.3.4, 198.51.100.7"}, proxies, "198.51.100.7"},
+		{"proxy chain", "10.0.0.1:4711", []string{"1.2.3.4, 198.51.100.7, 10.0.0.2"}, proxies, "198.51.100.7"},
+		{"several headers", "10.0.0.1:4711", []string{"1.2.3.4", "198.51.100.7, 10.0.0.2"}, proxies, "198.51.100.7"},
+		{"ipv6 proxy", "[2001:db8:ffff::1]:4711", []string{"2001:db8::7"}, proxies, "2001:db8::7"},
+		{"hop with port", "10.0.0.1:4711", []string{"[2001:db8::7]:8080"}, proxies, "2001:db8::7"},
+		{"only proxies", "10.0.0.1:4711", []string{"10.0.0.3, 10.0.0.2"}, proxies, "10.0.0.3"},
+		{"no header", "10.0.0.1:4711", nil, proxies, "10.0.0.1"},
+		{"garbage hop", "10.0.0.1:4711", []string{"198.51.100.7, garbage"}, proxies, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := FromRequest(r, tt.trusted); got != tt.want {
+			t.Errorf("%s: FromRequest = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Command lokstra-audit-verify verifies the integrity of an audit log
+// exported with audit.Export: the hash chain of every tenant and, when keys
+// are given, the signatures of its checkpoints.
+//
+// Usage:
+//
+//	lokstra-audit-verify -pubkey audit-2025=<base64 ed25519 public key> audit.jsonl
+//	lokstra-audit-verify -hmac-key audit-2025=<secret> -tenant acme < audit.jsonl
+//
+// The exit code is 1 when an integrity problem is found.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/primadi/lokstra-auth/audit"
+)
+
+// keyFlags collects repeated "<key-id>=<value>" flags
+type keyFlags map[string]string
+
+func (k keyFlags) String() string { return "" }
+
+func (k keyFlags) Set(value string) error {
+	keyID, key, ok := strings.Cut(value, "=")
+	if !ok || keyID == "" || key == "" {
+		return fmt.Errorf("expected <key-id>=<key>")
+	}
+	k[keyID] = key
+	return nil
+}
+
+func main() {
+	pubkeys := keyFlags{}
+	hmacKeys := keyFlags{}
+	flag.Var(pubkeys, "pubkey", "Ed25519 checkpoint public key as <key-id>=<base64> (repeatable)")
+	flag.Var(hmacKeys, "hmac-key", "HMAC checkpoint key as <key-id>=<secret>")
+	tenant := flag.String("tenant", "", "verify only this tenant (default: every tenant in the export)")
+	jsonOutput := flag.Bool("json", false, "print reports as JSON")
+	flag.Parse()
+
+	valid, err := run(pubkeys, hmacKeys, *tenant, *jsonOutput, flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+// run verifies an export and reports whether every chain is intact
+func run(pubkeys, hmacKeys keyFlags, tenant string, jsonOutput bool, path string) (bool, error) {
+	verifier, err := buildVerifier(pubkeys, hmacKeys)
+	if err != nil {
+		return false, err
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return false, err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	store, err := audit.Import(input)
+	if err != nil {
+		return false, fmt.Errorf("failed to read export: %w", err)
+	}
+
+	tenants := store.Tenants()
+	if tenant != "" {
+		tenants = []string{tenant}
+	}
+	slices.Sort(tenants)
+
+	valid := true
+	reports := make([]*audit.Report, 0, len(tenants))
+	for _, tenantID := range tenants {
+		report, err := audit.Verify(context.Background(), store, store, verifier, tenantID)
+		if err != nil {
+			return false, err
+		}
+		valid = valid && report.Valid()
+		reports = append(reports, report)
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reports); err != nil {
+			return false, err
+		}
+	} else {
+		for _, report := range reports {
+			printReport(report, verifier != nil)
+		}
+	}
+
+	return valid, nil
+}
+
+// buildVerifier returns the checkpoint verifier of the given keys (nil without keys)
+func buildVerifier(pubkeys, hmacKeys keyFlags) (audit.CheckpointVerifier, error) {
+	if len(pubkeys) > 0 && len(hmacKeys) > 0 {
+		return nil, fmt.Errorf("use either -pubkey or -hmac-key")
+	}
+	if len(hmacKeys) > 1 {
+		return nil, fmt.Errorf("only one -hmac-key is supported")
+	}
+
+	for keyID, secret := range hmacKeys {
+		return audit.NewHMACSigner(keyID, []byte(secret)), nil
+	}
+
+	if len(pubkeys) == 0 {
+		return nil, nil
+	}
+	verifier := audit.Ed25519Verifier{}
+	for keyID, encoded := range pubkeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key %q", keyID)
+		}
+		verifier[keyID] = ed25519.PublicKey(key)
+	}
+	return verifier, nil
+}
+
+func printReport(report *audit.Report, signed bool) {
+	status := "OK"
+	if !report.Valid() {
+		status = "TAMPERED"
+	}
+
+	tenant := report.TenantID
+	if tenant == "" {
+		tenant = "(default)"
+	}
+	fmt.Printf("tenant %s: %s\n", tenant, status)
+	fmt.Printf("  entries:     %d (sequence %d..%d)\n", report.Entries, report.FirstSequence, report.LastSequence)
+	fmt.Printf("  checkpoints: %d\n", report.Checkpoints)
+	if report.Pseudonymized > 0 {
+		fmt.Printf("  pseudonymized: %d (checked against their redacted hashes)\n", report.Pseudonymized)
+	}
+	if signed {
+		fmt.Printf("  verified up to sequence %d by signed checkpoints\n", report.Verified)
+	} else {
+		fmt.Println("  checkpoint signatures not checked (no key given)")
+	}
+	for _, problem := range report.Problems {
+		fmt.Printf("  [%s] sequence %d: %s\n", problem.Kind, problem.Sequence, problem.Message)
+	}
+}
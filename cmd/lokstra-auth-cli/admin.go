@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// newFlags creates the flag set of an action
+func newFlags(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+// required returns an error naming the first empty flag of names
+func required(fs *flag.FlagSet, names ...string) error {
+	for _, name := range names {
+		if fs.Lookup(name).Value.String() == "" {
+			return fmt.Errorf("%s: -%s is required", fs.Name(), name)
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// searchQuery returns the query of a list action
+func searchQuery(search string) url.Values {
+	query := url.Values{"page_size": {"100"}}
+	if search != "" {
+		query.Set("search", search)
+	}
+	return query
+}
+
+func tenantCreate(cli *CLI, args []string) error {
+	fs := newFlags("tenant create")
+	id := fs.String("id", "", "tenant ID (generated when empty)")
+	name := fs.String("name", "", "tenant name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "name"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodPost, "/admin/tenants", nil, map[string]any{"id": *id, "name": *name})
+}
+
+func tenantList(cli *CLI, args []string) error {
+	fs := newFlags("tenant list")
+	search := fs.String("search", "", "filter by name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return cli.show(http.MethodGet, "/admin/tenants", searchQuery(*search), nil)
+}
+
+func tenantGet(cli *CLI, args []string) error {
+	fs := newFlags("tenant get")
+	id := fs.String("id", "", "tenant ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "id"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodGet, "/admin/tenants/"+url.PathEscape(*id), nil, nil)
+}
+
+func appCreate(cli *CLI, args []string) error {
+	fs := newFlags("app create")
+	tenantID := fs.String("tenant", "", "tenant ID")
+	id := fs.String("id", "", "app ID (generated when empty)")
+	name := fs.String("name", "", "app name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "tenant", "name"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodPost, "/admin/tenants/"+url.PathEscape(*tenantID)+"/apps", nil,
+		map[string]any{"id": *id, "name": *name})
+}
+
+func appList(cli *CLI, args []string) error {
+	fs := newFlags("app list")
+	tenantID := fs.String("tenant", "", "tenant ID")
+	search := fs.String("search", "", "filter by name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "tenant"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodGet, "/admin/tenants/"+url.PathEscape(*tenantID)+"/apps", searchQuery(*search), nil)
+}
+
+func userCreate(cli *CLI, args []string) error {
+	fs := newFlags("user create")
+	tenantID := fs.String("tenant", "", "tenant ID")
+	id := fs.String("id", "", "user ID (generated when empty)")
+	username := fs.String("username", "", "username")
+	email := fs.String("email", "", "email address")
+	password := fs.String("password", "", "password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "tenant", "username"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodPost, "/admin/tenants/"+url.PathEscape(*tenantID)+"/users", nil, map[string]any{
+		"id": *id, "username": *username, "email": *email, "password": *password,
+	})
+}
+
+func userList(cli *CLI, args []string) error {
+	fs := newFlags("user list")
+	tenantID := fs.String("tenant", "", "tenant ID")
+	search := fs.String("search", "", "filter by username or email")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "tenant"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodGet, "/admin/tenants/"+url.PathEscape(*tenantID)+"/users", searchQuery(*search), nil)
+}
+
+func roleCreate(cli *CLI, args []string) error {
+	fs := newFlags("role create")
+	name := fs.String("name", "", "role name")
+	description := fs.String("description", "", "role description")
+	permissions := fs.String("permissions", "", "comma-separated permissions")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "name"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodPost, "/admin/rbac/roles", nil, map[string]any{
+		"name": *name, "description": *description, "permissions": splitList(*permissions),
+	})
+}
+
+func roleList(cli *CLI, args []string) error {
+	fs := newFlags("role list")
+	search := fs.String("search", "", "filter by name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return cli.show(http.MethodGet, "/admin/rbac/roles", searchQuery(*search), nil)
+}
+
+func roleAssign(cli *CLI, args []string) error {
+	fs := newFlags("role assign")
+	subjectID := fs.String("subject", "", "subject ID")
+	role := fs.String("role", "", "role name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "subject", "role"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodPost, "/admin/rbac/subjects/"+url.PathEscape(*subjectID)+"/roles", nil,
+		map[string]any{"role": *role})
+}
+
+func roleUnassign(cli *CLI, args []string) error {
+	fs := newFlags("role unassign")
+	subjectID := fs.String("subject", "", "subject ID")
+	role := fs.String("role", "", "role name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "subject", "role"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodDelete, "/admin/rbac/subjects/"+url.PathEscape(*subjectID)+"/roles/"+url.PathEscape(*role), nil, nil)
+}
+
+func apiKeyCreate(cli *CLI, args []string) error {
+	fs := newFlags("apikey create")
+	userID := fs.String("user", "", "owner user ID")
+	name := fs.String("name", "", "key name")
+	scopes := fs.String("scopes", "", "comma-separated scopes")
+	expiresIn := fs.String("expires-in", "", "lifetime, e.g. 720h (default: never expires)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "user", "name"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodPost, "/admin/apikeys/users/"+url.PathEscape(*userID)+"/keys", nil, map[string]any{
+		"name": *name, "scopes": splitList(*scopes), "expires_in": *expiresIn,
+	})
+}
+
+func apiKeyList(cli *CLI, args []string) error {
+	fs := newFlags("apikey list")
+	userID := fs.String("user", "", "owner user ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "user"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodGet, "/admin/apikeys/users/"+url.PathEscape(*userID)+"/keys", nil, nil)
+}
+
+func apiKeyRevoke(cli *CLI, args []string) error {
+	fs := newFlags("apikey revoke")
+	id := fs.String("id", "", "key ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "id"); err != nil {
+		return err
+	}
+	return cli.show(http.MethodDelete, "/admin/apikeys/keys/"+url.PathEscape(*id), nil, nil)
+}
+
+func policySimulate(cli *CLI, args []string) error {
+	fs := newFlags("policy simulate")
+	file := fs.String("file", "", `simulation file: {"changes": [...], "requests": [...]} ("-" for stdin)`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "file"); err != nil {
+		return err
+	}
+
+	var raw []byte
+	var err error
+	if *file == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+
+	var simulation map[string]any
+	if err := json.Unmarshal(raw, &simulation); err != nil {
+		return fmt.Errorf("invalid simulation file: %w", err)
+	}
+	return cli.show(http.MethodPost, "/admin/policy/simulate", nil, simulation)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// CLI calls the admin APIs
+type CLI struct {
+	Server string
+	Token  string
+
+	client *http.Client
+}
+
+// APIError is an error response of an admin API
+type APIError struct {
+	Method  string
+	Path    string
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Message)
+}
+
+// apiResponse is the response envelope of the admin APIs
+type apiResponse struct {
+	Status string          `json:"status"`
+	Data   json.RawMessage `json:"data"`
+	Error  *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Fields  []struct {
+			Field   string `json:"field"`
+			Message string `json:"message"`
+		} `json:"fields"`
+	} `json:"error"`
+}
+
+// call sends a request to an admin API and decodes the data of the
+// response into out (when not nil)
+func (c *CLI) call(method, path string, query url.Values, body, out any) error {
+	if c.client == nil {
+		c.client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	target := strings.TrimSuffix(c.Server, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var payload io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, target, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope apiResponse
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &envelope); err != nil {
+			return fmt.Errorf("%s %s: %s: unexpected response: %s", method, path, resp.Status, bytes.TrimSpace(raw))
+		}
+	}
+	if resp.StatusCode >= 300 || envelope.Status == "error" {
+		apiErr := &APIError{Method: method, Path: path, Status: resp.StatusCode, Message: resp.Status}
+		if envelope.Error != nil {
+			apiErr.Message = envelope.Error.Message
+			for _, field := range envelope.Error.Fields {
+				apiErr.Message += fmt.Sprintf("\n  %s: %s", field.Field, field.Message)
+			}
+		}
+		return apiErr
+	}
+
+	if out != nil && len(envelope.Data) > 0 {
+		return json.Unmarshal(envelope.Data, out)
+	}
+	return nil
+}
+
+// show calls an admin API and prints the data of the response
+func (c *CLI) show(method, path string, query url.Values, body any) error {
+	var data json.RawMessage
+	if err := c.call(method, path, query, body, &data); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		fmt.Println("ok")
+		return nil
+	}
+	return printJSON(data)
+}
+
+// printJSON prints a value as indented JSON
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
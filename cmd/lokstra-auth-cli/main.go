@@ -0,0 +1,138 @@
+// Command lokstra-auth-cli administers a lokstra-auth deployment through its
+// admin APIs (package admin): tenants, apps, users, role assignments, API
+// keys and policy simulations. It also mints and inspects JWTs locally,
+// seeds demo data and prints the database migrations.
+//
+// Usage:
+//
+//	lokstra-auth-cli [-server URL] [-token TOKEN] <command> <action> [flags]
+//
+//	lokstra-auth-cli tenant create -id acme -name "Acme Corp"
+//	lokstra-auth-cli user create -tenant acme -username alice -password s3cret
+//	lokstra-auth-cli role assign -subject alice -role editor
+//	lokstra-auth-cli apikey create -user alice -name ci -expires-in 720h
+//	lokstra-auth-cli policy simulate -file simulation.json
+//	lokstra-auth-cli token mint -secret $JWT_SECRET -subject alice -tenant acme
+//	lokstra-auth-cli token inspect -secret $JWT_SECRET $TOKEN
+//	lokstra-auth-cli seed
+//	lokstra-auth-cli migrate sql | psql "$DATABASE_URL"
+//
+// The server and the bearer token of the admin APIs default to the
+// LOKSTRA_AUTH_SERVER and LOKSTRA_AUTH_TOKEN environment variables. Role,
+// API key and policy commands act on the tenant of the token.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is an action of a command
+type command struct {
+	usage string
+	run   func(cli *CLI, args []string) error
+}
+
+// commands are the actions by command
+var commands = map[string]map[string]command{
+	"tenant": {
+		"create": {"-id ID -name NAME", tenantCreate},
+		"list":   {"[-search TEXT]", tenantList},
+		"get":    {"-id ID", tenantGet},
+	},
+	"app": {
+		"create": {"-tenant ID -id ID -name NAME", appCreate},
+		"list":   {"-tenant ID", appList},
+	},
+	"user": {
+		"create": {"-tenant ID -username NAME [-email EMAIL] [-password PASSWORD]", userCreate},
+		"list":   {"-tenant ID [-search TEXT]", userList},
+	},
+	"role": {
+		"create":   {"-name NAME [-permissions a,b]", roleCreate},
+		"list":     {"[-search TEXT]", roleList},
+		"assign":   {"-subject ID -role NAME", roleAssign},
+		"unassign": {"-subject ID -role NAME", roleUnassign},
+	},
+	"apikey": {
+		"create": {"-user ID -name NAME [-scopes a,b] [-expires-in 720h]", apiKeyCreate},
+		"list":   {"-user ID", apiKeyList},
+		"revoke": {"-id KEY_ID", apiKeyRevoke},
+	},
+	"policy": {
+		"simulate": {"-file FILE ({\"changes\": [...], \"requests\": [...]})", policySimulate},
+	},
+	"token": {
+		"mint":    {"-secret SECRET -subject ID [-tenant ID] [-roles a,b] [-ttl 15m]", tokenMint},
+		"inspect": {"[-secret SECRET] TOKEN", tokenInspect},
+	},
+	"seed": {
+		"": {"[-tenant demo]", seed},
+	},
+	"migrate": {
+		"list": {"", migrateList},
+		"sql":  {"[-from VERSION] (pipe into psql)", migrateSQL},
+	},
+}
+
+func main() {
+	server := flag.String("server", envOr("LOKSTRA_AUTH_SERVER", "http://localhost:8080"), "base URL of the admin APIs")
+	token := flag.String("token", os.Getenv("LOKSTRA_AUTH_TOKEN"), "bearer token of the admin APIs")
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := run(&CLI{Server: *server, Token: *token}, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// run dispatches a command line
+func run(cli *CLI, args []string) error {
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	actions, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q (see -help)", args[0])
+	}
+	if action, ok := actions[""]; ok {
+		return action.run(cli, args[1:])
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("%s: missing action (see -help)", args[0])
+	}
+	action, ok := actions[args[1]]
+	if !ok {
+		return fmt.Errorf("%s: unknown action %q (see -help)", args[0], args[1])
+	}
+	return action.run(cli, args[2:])
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: lokstra-auth-cli [-server URL] [-token TOKEN] <command> <action> [flags]")
+	fmt.Fprintln(out)
+	for _, name := range []string{"tenant", "app", "user", "role", "apikey", "policy", "token", "seed", "migrate"} {
+		for _, action := range []string{"", "create", "list", "get", "assign", "unassign", "revoke", "simulate", "mint", "inspect", "sql"} {
+			if cmd, ok := commands[name][action]; ok {
+				fmt.Fprintln(out, " ", strings.Join(strings.Fields(name+" "+action+" "+cmd.usage), " "))
+			}
+		}
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Global flags:")
+	flag.PrintDefaults()
+}
+
+// envOr returns an environment variable or a default
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
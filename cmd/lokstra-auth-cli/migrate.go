@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/primadi/lokstra-auth/migrations"
+)
+
+func migrateList(cli *CLI, args []string) error {
+	fs := newFlags("migrate list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	bundle, err := migrations.Load(migrations.Postgres)
+	if err != nil {
+		return err
+	}
+	for _, m := range bundle {
+		fmt.Printf("%04d_%s  %s\n", m.Version, m.Name, m.Checksum[:12])
+	}
+	return nil
+}
+
+func migrateSQL(cli *CLI, args []string) error {
+	fs := newFlags("migrate sql")
+	from := fs.Int("from", 1, "first migration version")
+	table := fs.String("table", migrations.DefaultTable, "version table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	bundle, err := migrations.Load(migrations.Postgres)
+	if err != nil {
+		return err
+	}
+	fmt.Print(migrations.Script(bundle, *table, *from))
+	return nil
+}
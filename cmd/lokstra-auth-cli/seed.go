@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// demoRoles are the roles of the demo data and their permissions
+var demoRoles = []struct {
+	name        string
+	permissions []string
+}{
+	{"admin", []string{"*"}},
+	{"editor", []string{"document:read", "document:write"}},
+	{"viewer", []string{"document:read"}},
+}
+
+// demoUsers are the users of the demo data and their roles
+var demoUsers = []struct {
+	username string
+	role     string
+}{
+	{"alice", "admin"},
+	{"bob", "editor"},
+	{"carol", "viewer"},
+}
+
+// seedStep creates one record of the demo data
+type seedStep struct {
+	name string
+	run  func() error
+}
+
+func seed(cli *CLI, args []string) error {
+	fs := newFlags("seed")
+	tenantID := fs.String("tenant", "demo", "tenant ID")
+	appID := fs.String("app", "web", "app ID")
+	password := fs.String("password", "demo-password", "password of the demo users")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	steps := []seedStep{
+		{"tenant " + *tenantID, func() error {
+			return cli.call(http.MethodPost, "/admin/tenants", nil, map[string]any{"id": *tenantID, "name": "Demo"}, nil)
+		}},
+		{"app " + *appID, func() error {
+			return cli.call(http.MethodPost, "/admin/tenants/"+url.PathEscape(*tenantID)+"/apps", nil,
+				map[string]any{"id": *appID, "name": "Demo Web"}, nil)
+		}},
+	}
+	for _, permission := range []string{"document:read", "document:write"} {
+		steps = append(steps, seedStep{"permission " + permission, func() error {
+			return cli.call(http.MethodPost, "/admin/rbac/permissions", nil, map[string]any{"name": permission}, nil)
+		}})
+	}
+	for _, role := range demoRoles {
+		steps = append(steps, seedStep{"role " + role.name, func() error {
+			return cli.call(http.MethodPost, "/admin/rbac/roles", nil,
+				map[string]any{"name": role.name, "permissions": role.permissions}, nil)
+		}})
+	}
+	for _, user := range demoUsers {
+		steps = append(steps, seedStep{"user " + user.username, func() error {
+			return cli.call(http.MethodPost, "/admin/tenants/"+url.PathEscape(*tenantID)+"/users", nil, map[string]any{
+				"id":       user.username,
+				"username": user.username,
+				"email":    user.username + "@demo.example",
+				"password": *password,
+			}, nil)
+		}}, seedStep{"role " + user.role + " for " + user.username, func() error {
+			return cli.call(http.MethodPost, "/admin/rbac/subjects/"+url.PathEscape(user.username)+"/roles", nil,
+				map[string]any{"role": user.role}, nil)
+		}})
+	}
+
+	// Seeding is idempotent: existing records are kept
+	for _, step := range steps {
+		err := step.run()
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			fmt.Println("created", step.name)
+		case errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict:
+			fmt.Println("exists ", step.name)
+		default:
+			return fmt.Errorf("seed %s: %w", step.name, err)
+		}
+	}
+	return nil
+}
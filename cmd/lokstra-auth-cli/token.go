@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/jwt"
+)
+
+// jwtFlags are the HS256 settings shared by token mint and inspect
+type jwtFlags struct {
+	secret   *string
+	issuer   *string
+	audience *string
+}
+
+// addJWTFlags defines the JWT flags of an action
+func addJWTFlags(fs *flag.FlagSet) *jwtFlags {
+	return &jwtFlags{
+		secret:   fs.String("secret", os.Getenv("LOKSTRA_AUTH_JWT_SECRET"), "HS256 secret (default: $LOKSTRA_AUTH_JWT_SECRET)"),
+		issuer:   fs.String("issuer", "lokstra-auth", "token issuer"),
+		audience: fs.String("audience", "lokstra", "comma-separated token audience"),
+	}
+}
+
+// manager returns the JWT manager of the flags
+func (f *jwtFlags) manager(ttl time.Duration) *jwt.Manager {
+	config := jwt.DefaultConfig(*f.secret)
+	config.Issuer = *f.issuer
+	config.Audience = splitList(*f.audience)
+	if ttl > 0 {
+		config.AccessTokenDuration = ttl
+	}
+	return jwt.NewManager(config)
+}
+
+func tokenMint(cli *CLI, args []string) error {
+	fs := newFlags("token mint")
+	settings := addJWTFlags(fs)
+	subjectID := fs.String("subject", "", "subject (sub claim)")
+	tenantID := fs.String("tenant", "", "tenant ID")
+	appID := fs.String("app", "", "app ID")
+	roles := fs.String("roles", "", "comma-separated roles")
+	permissions := fs.String("permissions", "", "comma-separated permissions")
+	scopes := fs.String("scopes", "", "comma-separated scopes")
+	ttl := fs.Duration("ttl", 15*time.Minute, "token lifetime")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := required(fs, "secret", "subject"); err != nil {
+		return err
+	}
+
+	claims := token.Claims{"sub": *subjectID}
+	if *tenantID != "" {
+		claims[token.ClaimTenantID] = *tenantID
+	}
+	if *appID != "" {
+		claims[token.ClaimAppID] = *appID
+	}
+	for name, value := range map[string]string{"roles": *roles, "permissions": *permissions, "scopes": *scopes} {
+		if list := splitList(value); len(list) > 0 {
+			claims[name] = list
+		}
+	}
+
+	minted, err := settings.manager(*ttl).Generate(context.Background(), claims)
+	if err != nil {
+		return err
+	}
+	fmt.Println(minted.Value)
+	return nil
+}
+
+func tokenInspect(cli *CLI, args []string) error {
+	fs := newFlags("token inspect")
+	settings := addJWTFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("token inspect: expected one token")
+	}
+	value := fs.Arg(0)
+
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("token inspect: not a JWT")
+	}
+	header, err := decodeSegment(parts[0])
+	if err != nil {
+		return fmt.Errorf("token inspect: invalid header: %w", err)
+	}
+	claims, err := decodeSegment(parts[1])
+	if err != nil {
+		return fmt.Errorf("token inspect: invalid claims: %w", err)
+	}
+
+	report := map[string]any{"header": header, "claims": claims}
+	for _, name := range []string{"iat", "nbf", "exp"} {
+		if seconds, ok := claims[name].(float64); ok {
+			report[name] = time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+		}
+	}
+
+	if *settings.secret != "" {
+		result, err := settings.manager(0).Verify(context.Background(), value)
+		switch {
+		case err != nil:
+			report["valid"], report["error"] = false, err.Error()
+		case !result.Valid:
+			report["valid"] = false
+			if result.Error != nil {
+				report["error"] = result.Error.Error()
+			}
+		default:
+			report["valid"] = true
+		}
+	} else {
+		report["valid"] = "not verified (no -secret)"
+	}
+	return printJSON(report)
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT
+func decodeSegment(segment string) (map[string]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,207 @@
+// Command lokstra-bench benchmarks the authorization hot paths (RBAC, ABAC
+// and ACL evaluation, identity build, token verification, middleware
+// overhead) and compares the results against a committed baseline. It exits
+// with 1 when a benchmark regressed beyond the threshold, so it can gate
+// commits and CI:
+//
+//	go run ./cmd/lokstra-bench                  # compare against baseline.json
+//	go run ./cmd/lokstra-bench -update          # record a new baseline
+//	go run ./cmd/lokstra-bench -run 'rbac|abac' -threshold 0.3
+//
+// Timings are compared with a relative threshold; allocations per operation
+// do not depend on the machine and must not grow at all.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"testing"
+	"text/tabwriter"
+	"time"
+)
+
+// Result is the measurement of one benchmark
+type Result struct {
+	NsPerOp     float64 `json:"ns_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+}
+
+// Baseline is a recorded set of results
+type Baseline struct {
+	GoVersion  string            `json:"go_version"`
+	GOOS       string            `json:"goos"`
+	GOARCH     string            `json:"goarch"`
+	RecordedAt time.Time         `json:"recorded_at"`
+	Results    map[string]Result `json:"results"`
+}
+
+func main() {
+	baselinePath := flag.String("baseline", "cmd/lokstra-bench/baseline.json", "baseline file")
+	update := flag.Bool("update", false, "record the results as the new baseline instead of comparing")
+	threshold := flag.Float64("threshold", 0.3, "allowed ns/op regression as a fraction of the baseline (0.3 = 30%)")
+	run := flag.String("run", "", "only run benchmarks matching this regular expression")
+	count := flag.Int("count", 5, "runs per benchmark; the fastest run is kept")
+	benchtime := flag.String("benchtime", "1s", "duration or iterations (e.g., 100x) per run")
+	flag.Parse()
+
+	ok, err := benchAndCompare(*baselinePath, *update, *threshold, *run, *count, *benchtime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// benchAndCompare runs the suite and reports whether it passed the gate
+func benchAndCompare(baselinePath string, update bool, threshold float64, run string, count int, benchtime string) (bool, error) {
+	filter, err := regexp.Compile(run)
+	if err != nil {
+		return false, fmt.Errorf("invalid -run: %w", err)
+	}
+
+	// testing.Benchmark reads its duration from the test flags
+	testing.Init()
+	if err := flag.Set("test.benchtime", benchtime); err != nil {
+		return false, fmt.Errorf("invalid -benchtime: %w", err)
+	}
+
+	results := make(map[string]Result)
+	for _, bench := range suite() {
+		if !filter.MatchString(bench.name) {
+			continue
+		}
+		results[bench.name] = measure(bench, max(count, 1))
+	}
+	if len(results) == 0 {
+		return false, fmt.Errorf("no benchmark matches %q", run)
+	}
+
+	if update {
+		return true, writeBaseline(baselinePath, results)
+	}
+
+	baseline, err := readBaseline(baselinePath)
+	if err != nil {
+		return false, err
+	}
+	return report(baseline, results, threshold), nil
+}
+
+// measure runs a benchmark count times and keeps the fastest run, which is
+// the least disturbed by other load on the machine
+func measure(bench benchmark, count int) Result {
+	var best Result
+	for i := range count {
+		r := testing.Benchmark(bench.fn)
+		result := Result{
+			NsPerOp:     math.Round(float64(r.T.Nanoseconds())/float64(max(r.N, 1))*10) / 10,
+			BytesPerOp:  r.AllocedBytesPerOp(),
+			AllocsPerOp: r.AllocsPerOp(),
+		}
+		if i == 0 || result.NsPerOp < best.NsPerOp {
+			best = result
+		}
+	}
+	return best
+}
+
+// report prints the comparison and reports whether no benchmark regressed
+func report(baseline *Baseline, results map[string]Result, threshold float64) bool {
+	if baseline.GOOS != runtime.GOOS || baseline.GOARCH != runtime.GOARCH {
+		fmt.Printf("note: baseline recorded on %s/%s, running on %s/%s\n\n",
+			baseline.GOOS, baseline.GOARCH, runtime.GOOS, runtime.GOARCH)
+	}
+
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BENCHMARK\tNS/OP\tBASELINE\tDELTA\tALLOCS/OP\tBASELINE\tSTATUS")
+
+	passed := true
+	for _, name := range names {
+		result := results[name]
+		base, ok := baseline.Results[name]
+		if !ok {
+			fmt.Fprintf(w, "%s\t%.0f\t-\t-\t%d\t-\tnew\n", name, result.NsPerOp, result.AllocsPerOp)
+			continue
+		}
+
+		delta := 0.0
+		if base.NsPerOp > 0 {
+			delta = result.NsPerOp/base.NsPerOp - 1
+		}
+
+		status := "ok"
+		switch {
+		case delta > threshold:
+			status = "REGRESSED (time)"
+			passed = false
+		case result.AllocsPerOp > base.AllocsPerOp:
+			status = "REGRESSED (allocs)"
+			passed = false
+		}
+
+		fmt.Fprintf(w, "%s\t%.0f\t%.0f\t%+.1f%%\t%d\t%d\t%s\n",
+			name, result.NsPerOp, base.NsPerOp, delta*100, result.AllocsPerOp, base.AllocsPerOp, status)
+	}
+	w.Flush()
+
+	if !passed {
+		fmt.Printf("\nperformance regression beyond %.0f%% (or more allocations); run with -update if intended\n", threshold*100)
+	}
+	return passed
+}
+
+func readBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline (record one with -update): %w", err)
+	}
+
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid baseline: %w", err)
+	}
+	return &baseline, nil
+}
+
+// writeBaseline records results, keeping baseline entries of benchmarks
+// that were not run
+func writeBaseline(path string, results map[string]Result) error {
+	baseline, err := readBaseline(path)
+	if err != nil {
+		baseline = &Baseline{Results: make(map[string]Result)}
+	}
+
+	baseline.GoVersion = runtime.Version()
+	baseline.GOOS = runtime.GOOS
+	baseline.GOARCH = runtime.GOARCH
+	baseline.RecordedAt = time.Now().UTC().Truncate(time.Second)
+	for name, result := range results {
+		baseline.Results[name] = result
+	}
+
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("recorded %d benchmarks in %s\n", len(results), path)
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/jwt"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/03_subject/simple"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/abac"
+	"github.com/primadi/lokstra-auth/04_authz/acl"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+	"github.com/primadi/lokstra-auth/middleware"
+	"github.com/primadi/lokstra/core/request"
+)
+
+// benchmark is a hot path measured by the suite
+type benchmark struct {
+	name string
+	fn   func(b *testing.B)
+}
+
+// suite returns the benchmarks of the hot paths: policy evaluation,
+// identity build, token verification and middleware overhead
+func suite() []benchmark {
+	return []benchmark{
+		{"rbac/evaluate", benchRBACEvaluate},
+		{"rbac/evaluate-wildcard", benchRBACEvaluateWildcard},
+		{"abac/evaluate-20-rules", benchABACEvaluate},
+		{"acl/check-role", benchACLCheck},
+		{"subject/resolve-and-build", benchIdentityBuild},
+		{"token/jwt-verify", benchJWTVerify},
+		{"middleware/auth-and-permission", benchMiddleware},
+	}
+}
+
+var benchIdentity = &subject.IdentityContext{
+	Subject: &subject.Subject{
+		ID:        "user-1",
+		Type:      "user",
+		Principal: "alice",
+		Attributes: map[string]any{
+			"department": "engineering",
+			"level":      5,
+		},
+	},
+	Roles:       []string{"viewer", "editor"},
+	Permissions: []string{"read:document", "write:document"},
+}
+
+var benchRolePermissions = map[string][]string{
+	"viewer": {"read:document", "read:folder", "read:report"},
+	"editor": {"write:document", "write:folder", "delete:draft"},
+	"admin":  {"*"},
+}
+
+func benchRBACEvaluate(b *testing.B) {
+	evaluator := rbac.NewEvaluator(benchRolePermissions)
+	request := &authz.AuthorizationRequest{
+		Subject:  benchIdentity,
+		Resource: &authz.Resource{Type: "document", ID: "doc-1"},
+		Action:   "write",
+	}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := evaluator.Evaluate(ctx, request); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchRBACEvaluateWildcard(b *testing.B) {
+	evaluator := rbac.NewEvaluator(map[string][]string{
+		"editor": {"document:*", "folder:*:read"},
+	})
+	request := &authz.AuthorizationRequest{
+		Subject:  benchIdentity,
+		Resource: &authz.Resource{Type: "document", ID: "doc-1"},
+		Action:   "write",
+	}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := evaluator.Evaluate(ctx, request); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchABACEvaluate(b *testing.B) {
+	evaluator := abac.NewEvaluator(nil, false)
+	// 19 rules that do not match, then the one that does
+	for i := range 19 {
+		evaluator.AddRule(&abac.Rule{
+			ID:       fmt.Sprintf("miss-%d", i),
+			Effect:   "allow",
+			Priority: 100 - i,
+			Conditions: []abac.Condition{
+				{Type: "subject", Key: "department", Operator: "eq", Value: fmt.Sprintf("dept-%d", i)},
+			},
+		})
+	}
+	evaluator.AddRule(&abac.Rule{
+		ID:       "engineering-documents",
+		Effect:   "allow",
+		Priority: 1,
+		Conditions: []abac.Condition{
+			{Type: "subject", Key: "department", Operator: "eq", Value: "engineering"},
+			{Type: "subject", Key: "level", Operator: "gt", Value: 3},
+			{Type: "resource", Key: "type", Operator: "eq", Value: "document"},
+		},
+	})
+
+	request := &authz.AuthorizationRequest{
+		Subject:  benchIdentity,
+		Resource: &authz.Resource{Type: "document", ID: "doc-1", Attributes: map[string]any{}},
+		Action:   "read",
+	}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		decision, err := evaluator.Evaluate(ctx, request)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !decision.Allowed {
+			b.Fatal("expected allow")
+		}
+	}
+}
+
+func benchACLCheck(b *testing.B) {
+	ctx := context.Background()
+	manager := acl.NewManager()
+	for i := range 50 {
+		if err := manager.Grant(ctx, "document", "doc-1", fmt.Sprintf("user-%d", i+100), "user", "read"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := manager.Grant(ctx, "document", "doc-1", "editor", "role", "read", "write"); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		allowed, err := manager.Check(ctx, "document", "doc-1", "user-1", "write", benchIdentity)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !allowed {
+			b.Fatal("expected allow")
+		}
+	}
+}
+
+func benchIdentityBuild(b *testing.B) {
+	resolver := simple.NewResolver()
+	builder := newBenchContextBuilder()
+	claims := map[string]any{
+		"sub":      "user-1",
+		"username": "alice",
+		"email":    "alice@example.com",
+	}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		sub, err := resolver.Resolve(ctx, claims)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := builder.Build(ctx, sub); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchJWTVerify(b *testing.B) {
+	ctx := context.Background()
+	manager := jwt.NewManager(jwt.DefaultConfig("bench-secret"))
+	tok, err := manager.Generate(ctx, token.Claims{"sub": "user-1", "username": "alice"})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		result, err := manager.Verify(ctx, tok.Value)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !result.Valid {
+			b.Fatal(result.Error)
+		}
+	}
+}
+
+func benchMiddleware(b *testing.B) {
+	ctx := context.Background()
+	manager := jwt.NewManager(jwt.DefaultConfig("bench-secret"))
+	auth := lokstraauth.NewBuilder().
+		WithTokenManager(manager).
+		WithSubjectResolver(simple.NewResolver()).
+		WithIdentityContextBuilder(newBenchContextBuilder()).
+		WithAuthorizer(rbac.NewEvaluator(benchRolePermissions)).
+		Build()
+
+	tok, err := manager.Generate(ctx, token.Claims{"sub": "user-1", "username": "alice"})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	handlers := []request.HandlerFunc{
+		middleware.NewAuthMiddleware(middleware.AuthMiddlewareConfig{Auth: auth}).Handler(),
+		middleware.NewPermissionMiddleware(middleware.PermissionMiddlewareConfig{
+			Auth:       auth,
+			Permission: "write:document",
+		}).Handler(),
+		func(c *request.Context) error { return nil },
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/documents/doc-1", nil)
+	r.Header.Set("Authorization", "Bearer "+tok.Value)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		c := request.NewContext(httptest.NewRecorder(), r, handlers)
+		if err := c.Next(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func newBenchContextBuilder() subject.IdentityContextBuilder {
+	return simple.NewContextBuilder(
+		simple.NewStaticRoleProvider(map[string][]string{"user-1": {"viewer", "editor"}}),
+		simple.NewStaticPermissionProvider(map[string][]string{"user-1": {"read:document", "write:document"}}),
+		simple.NewStaticGroupProvider(map[string][]string{"user-1": {"engineering"}}),
+		nil,
+	)
+}
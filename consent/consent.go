@@ -0,0 +1,157 @@
+// Package consent records the scopes users granted to third-party clients:
+// OAuth2 clients of the oidc provider, and clients holding API keys issued
+// on behalf of users. A client requesting scopes beyond its consent must
+// send the user back to the consent prompt.
+package consent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrConsentNotFound = autherrors.New(autherrors.ErrNotFound, "consent not found")
+)
+
+// Consent records the scopes a user granted to a client
+type Consent struct {
+	SubjectID string    `json:"subject_id"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// Covers reports whether the consent includes every scope
+func (c *Consent) Covers(scopes []string) bool {
+	return len(c.Missing(scopes)) == 0
+}
+
+// Missing returns the scopes the consent does not include, which the user
+// must be prompted for
+func (c *Consent) Missing(scopes []string) []string {
+	var missing []string
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) && !slices.Contains(missing, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// Store stores the consents of users to clients
+type Store interface {
+	// Get retrieves the consent of a user to a client
+	Get(ctx context.Context, subjectID, clientID string) (*Consent, error)
+
+	// Grant adds scopes to the consent of a user to a client
+	Grant(ctx context.Context, subjectID, clientID string, scopes []string) (*Consent, error)
+
+	// Revoke removes the consent of a user to a client
+	Revoke(ctx context.Context, subjectID, clientID string) error
+
+	// List returns the consents of a user
+	List(ctx context.Context, subjectID string) ([]*Consent, error)
+}
+
+// Missing returns the scopes a user has not granted to a client (all of
+// them without a consent)
+func Missing(ctx context.Context, store Store, subjectID, clientID string, scopes []string) ([]string, error) {
+	consent, err := store.Get(ctx, subjectID, clientID)
+	if errors.Is(err, ErrConsentNotFound) {
+		return (&Consent{}).Missing(scopes), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return consent.Missing(scopes), nil
+}
+
+// InMemoryStore is an in-memory implementation of Store
+type InMemoryStore struct {
+	mu       sync.Mutex
+	consents map[string]*Consent // subjectID + "/" + clientID -> consent
+}
+
+// NewInMemoryStore creates a new in-memory consent store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		consents: make(map[string]*Consent),
+	}
+}
+
+// Get retrieves the consent of a user to a client
+func (s *InMemoryStore) Get(ctx context.Context, subjectID, clientID string) (*Consent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	consent, ok := s.consents[consentKey(subjectID, clientID)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConsentNotFound, clientID)
+	}
+	return cloneConsent(consent), nil
+}
+
+// Grant adds scopes to the consent of a user to a client
+func (s *InMemoryStore) Grant(ctx context.Context, subjectID, clientID string, scopes []string) (*Consent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := consentKey(subjectID, clientID)
+	consent, ok := s.consents[key]
+	if !ok {
+		consent = &Consent{SubjectID: subjectID, ClientID: clientID}
+		s.consents[key] = consent
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			consent.Scopes = append(consent.Scopes, scope)
+		}
+	}
+	consent.GrantedAt = time.Now()
+	return cloneConsent(consent), nil
+}
+
+// Revoke removes the consent of a user to a client
+func (s *InMemoryStore) Revoke(ctx context.Context, subjectID, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := consentKey(subjectID, clientID)
+	if _, ok := s.consents[key]; !ok {
+		return fmt.Errorf("%w: %s", ErrConsentNotFound, clientID)
+	}
+	delete(s.consents, key)
+	return nil
+}
+
+// List returns the consents of a user ordered by client
+func (s *InMemoryStore) List(ctx context.Context, subjectID string) ([]*Consent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var consents []*Consent
+	for _, consent := range s.consents {
+		if consent.SubjectID == subjectID {
+			consents = append(consents, cloneConsent(consent))
+		}
+	}
+	sort.Slice(consents, func(i, j int) bool { return consents[i].ClientID < consents[j].ClientID })
+	return consents, nil
+}
+
+func consentKey(subjectID, clientID string) string {
+	return subjectID + "/" + clientID
+}
+
+func cloneConsent(consent *Consent) *Consent {
+	copied := *consent
+	copied.Scopes = slices.Clone(consent.Scopes)
+	return &copied
+}
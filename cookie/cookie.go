@@ -0,0 +1,276 @@
+package cookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrMissingCookie    = errors.New("missing cookie")
+	ErrInvalidCookie    = errors.New("invalid cookie")
+	ErrInvalidKey       = errors.New("encryption key must be 16, 24 or 32 bytes")
+	ErrCSRFTokenMissing = errors.New("missing CSRF token")
+	ErrCSRFTokenInvalid = errors.New("invalid CSRF token")
+)
+
+// Config holds session cookie configuration
+type Config struct {
+	// Name is the session cookie name (default: "lokstra_session")
+	Name string
+
+	// CSRFCookieName is the CSRF cookie name (default: "lokstra_csrf")
+	CSRFCookieName string
+
+	// DeviceCookieName is the remember-me device cookie name (default: "lokstra_device")
+	DeviceCookieName string
+
+	// CSRFHeaderName is the header carrying the CSRF token (default: "X-CSRF-Token")
+	CSRFHeaderName string
+
+	// CSRFFormField is the form field carrying the CSRF token (default: "csrf_token")
+	CSRFFormField string
+
+	// Domain is the cookie domain (optional)
+	Domain string
+
+	// Path is the cookie path (default: "/")
+	Path string
+
+	// Insecure allows cookies over plain HTTP (development only; default: false)
+	Insecure bool
+
+	// SameSite is the SameSite mode (default: http.SameSiteLaxMode)
+	SameSite http.SameSite
+
+	// MaxAge caps the cookie lifetime; the token expiry is used when shorter (0 = token expiry)
+	MaxAge time.Duration
+
+	// EncryptionKey encrypts the cookie value with AES-GCM (optional, 16/24/32 bytes)
+	EncryptionKey []byte
+}
+
+// DefaultConfig returns a secure default cookie configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Name:             "lokstra_session",
+		CSRFCookieName:   "lokstra_csrf",
+		DeviceCookieName: "lokstra_device",
+		CSRFHeaderName:   "X-CSRF-Token",
+		CSRFFormField:    "csrf_token",
+		Path:             "/",
+		SameSite:         http.SameSiteLaxMode,
+	}
+}
+
+// Manager issues and reads session and CSRF cookies
+type Manager struct {
+	config *Config
+	aead   cipher.AEAD
+}
+
+// NewManager creates a new cookie manager
+func NewManager(config *Config) (*Manager, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	defaults := DefaultConfig()
+	if config.Name == "" {
+		config.Name = defaults.Name
+	}
+	if config.CSRFCookieName == "" {
+		config.CSRFCookieName = defaults.CSRFCookieName
+	}
+	if config.DeviceCookieName == "" {
+		config.DeviceCookieName = defaults.DeviceCookieName
+	}
+	if config.CSRFHeaderName == "" {
+		config.CSRFHeaderName = defaults.CSRFHeaderName
+	}
+	if config.CSRFFormField == "" {
+		config.CSRFFormField = defaults.CSRFFormField
+	}
+	if config.Path == "" {
+		config.Path = defaults.Path
+	}
+	if config.SameSite == 0 {
+		config.SameSite = defaults.SameSite
+	}
+
+	m := &Manager{config: config}
+
+	if len(config.EncryptionKey) > 0 {
+		block, err := aes.NewCipher(config.EncryptionKey)
+		if err != nil {
+			return nil, ErrInvalidKey
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %w", err)
+		}
+		m.aead = aead
+	}
+
+	return m, nil
+}
+
+// SetSession writes the session cookie carrying a token value
+func (m *Manager) SetSession(w http.ResponseWriter, tokenValue string, expiresAt time.Time) error {
+	return m.set(w, m.config.Name, tokenValue, expiresAt)
+}
+
+// ReadSession reads the token value from the session cookie
+func (m *Manager) ReadSession(r *http.Request) (string, error) {
+	return m.read(r, m.config.Name)
+}
+
+// SetDevice writes the remember-me device cookie carrying a device token
+func (m *Manager) SetDevice(w http.ResponseWriter, deviceToken string, expiresAt time.Time) error {
+	return m.set(w, m.config.DeviceCookieName, deviceToken, expiresAt)
+}
+
+// ReadDevice reads the device token from the remember-me device cookie
+func (m *Manager) ReadDevice(r *http.Request) (string, error) {
+	return m.read(r, m.config.DeviceCookieName)
+}
+
+// Clear removes the session, CSRF and device cookies
+func (m *Manager) Clear(w http.ResponseWriter) {
+	for _, name := range []string{m.config.Name, m.config.CSRFCookieName, m.config.DeviceCookieName} {
+		c := m.newCookie(name, "", time.Time{}, true)
+		c.MaxAge = -1
+		c.Expires = time.Unix(0, 0)
+		http.SetCookie(w, c)
+	}
+}
+
+// IssueCSRF writes a new CSRF cookie (readable by scripts) and returns the
+// token, which clients send back in the CSRF header or form field
+func (m *Manager) IssueCSRF(w http.ResponseWriter, expiresAt time.Time) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
+
+	csrfToken := base64.RawURLEncoding.EncodeToString(buf)
+	http.SetCookie(w, m.newCookie(m.config.CSRFCookieName, csrfToken, expiresAt, false))
+
+	return csrfToken, nil
+}
+
+// VerifyCSRF checks the double-submit CSRF token of state-changing requests
+// (safe methods GET, HEAD, OPTIONS and TRACE are always accepted)
+func (m *Manager) VerifyCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil
+	}
+
+	c, err := r.Cookie(m.config.CSRFCookieName)
+	if err != nil || c.Value == "" {
+		return ErrCSRFTokenMissing
+	}
+
+	submitted := r.Header.Get(m.config.CSRFHeaderName)
+	if submitted == "" {
+		submitted = r.PostFormValue(m.config.CSRFFormField)
+	}
+	if submitted == "" {
+		return ErrCSRFTokenMissing
+	}
+
+	if subtle.ConstantTimeCompare([]byte(submitted), []byte(c.Value)) != 1 {
+		return ErrCSRFTokenInvalid
+	}
+
+	return nil
+}
+
+// set writes an HttpOnly cookie with an (optionally encrypted) value
+func (m *Manager) set(w http.ResponseWriter, name, value string, expiresAt time.Time) error {
+	encoded, err := m.encode(name, value)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, m.newCookie(name, encoded, expiresAt, true))
+	return nil
+}
+
+// read reads and decodes an HttpOnly cookie
+func (m *Manager) read(r *http.Request, name string) (string, error) {
+	c, err := r.Cookie(name)
+	if err != nil || c.Value == "" {
+		return "", ErrMissingCookie
+	}
+
+	return m.decode(name, c.Value)
+}
+
+// newCookie builds a cookie with the configured attributes
+func (m *Manager) newCookie(name, value string, expiresAt time.Time, httpOnly bool) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   m.config.Domain,
+		Path:     m.config.Path,
+		Secure:   !m.config.Insecure,
+		HttpOnly: httpOnly,
+		SameSite: m.config.SameSite,
+	}
+
+	if !expiresAt.IsZero() {
+		if m.config.MaxAge > 0 && time.Until(expiresAt) > m.config.MaxAge {
+			expiresAt = time.Now().Add(m.config.MaxAge)
+		}
+		c.Expires = expiresAt
+		c.MaxAge = int(time.Until(expiresAt).Seconds())
+	} else if m.config.MaxAge > 0 {
+		c.MaxAge = int(m.config.MaxAge.Seconds())
+	}
+
+	return c
+}
+
+// encode encrypts (if configured) and encodes a cookie value
+func (m *Manager) encode(name, value string) (string, error) {
+	if m.aead == nil {
+		return value, nil
+	}
+
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// Bind the ciphertext to the cookie name
+	sealed := m.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decode decodes and decrypts (if configured) a cookie value
+func (m *Manager) decode(name, value string) (string, error) {
+	if m.aead == nil {
+		return value, nil
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(sealed) < m.aead.NonceSize() {
+		return "", ErrInvalidCookie
+	}
+
+	nonce, ciphertext := sealed[:m.aead.NonceSize()], sealed[m.aead.NonceSize():]
+	plain, err := m.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	return string(plain), nil
+}
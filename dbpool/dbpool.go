@@ -0,0 +1,217 @@
+// Package dbpool routes the queries of the Postgres stores (rbac, policy,
+// rebac, jwt keys): writes and transactions to the primary, reads to read
+// replicas, each with a query timeout and retries with backoff on transient
+// errors.
+//
+//	pool := dbpool.New(primary, &dbpool.Config{
+//		Replicas:     []*sql.DB{replica1, replica2},
+//		QueryTimeout: 2 * time.Second,
+//	})
+//	store, err := rbac.NewPostgresStoreOnPool(pool, "auth")
+package dbpool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds pool configuration
+type Config struct {
+	// Replicas serve reads, in turn (default: none, reads go to the primary)
+	Replicas []*sql.DB
+
+	// QueryTimeout bounds each attempt of a query or transaction (default:
+	// 0, only the context deadline applies)
+	QueryTimeout time.Duration
+
+	// MaxAttempts is the number of attempts of an operation failing with a
+	// transient error (default: 3; 1 disables retries)
+	MaxAttempts int
+
+	// Backoff is the wait before the first retry, doubled for each retry
+	// with jitter (default: 50ms)
+	Backoff time.Duration
+
+	// MaxBackoff caps the wait between retries (default: 1s)
+	MaxBackoff time.Duration
+
+	// Transient reports whether a failed read or transaction can be retried
+	// (default: IsTransient)
+	Transient func(err error) bool
+}
+
+// Pool routes queries to a primary and read replicas
+type Pool struct {
+	primary  *sql.DB
+	replicas []*sql.DB
+	next     atomic.Uint64
+	config   *Config
+}
+
+// New creates a pool on a primary database
+func New(primary *sql.DB, config *Config) *Pool {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 50 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Second
+	}
+	if config.Transient == nil {
+		config.Transient = IsTransient
+	}
+	return &Pool{primary: primary, replicas: config.Replicas, config: config}
+}
+
+// Primary returns the primary database
+func (p *Pool) Primary() *sql.DB {
+	return p.primary
+}
+
+// Replica returns the database of the next read: a replica in turn, or the
+// primary without replicas or for a context of WithPrimary
+func (p *Pool) Replica(ctx context.Context) *sql.DB {
+	if len(p.replicas) == 0 || ReadsFromPrimary(ctx) {
+		return p.primary
+	}
+	return p.replicas[(p.next.Add(1)-1)%uint64(len(p.replicas))]
+}
+
+// Read runs a read on a replica. fn must consume its rows before returning;
+// it is retried, on the next replica, after a transient error.
+func (p *Pool) Read(ctx context.Context, fn func(ctx context.Context, db *sql.DB) error) error {
+	return p.retry(ctx, p.config.Transient, func(ctx context.Context) error {
+		return fn(ctx, p.Replica(ctx))
+	})
+}
+
+// Write runs a statement on the primary. It is retried only after errors
+// raised before the statement ran (see IsNotExecuted), since a statement
+// interrupted by a lost connection may have been committed.
+func (p *Pool) Write(ctx context.Context, fn func(ctx context.Context, db *sql.DB) error) error {
+	return p.retry(ctx, IsNotExecuted, func(ctx context.Context) error {
+		return fn(ctx, p.primary)
+	})
+}
+
+// Tx runs fn in a transaction on the primary, committed if fn succeeds. The
+// whole transaction is retried after a transient error (e.g., a
+// serialization failure or deadlock), so fn must not have side effects
+// outside the transaction.
+func (p *Pool) Tx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	return p.retry(ctx, p.config.Transient, func(ctx context.Context) error {
+		tx, err := p.primary.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// retry runs an attempt with the query timeout until it succeeds, fails
+// with an error that is not retryable, or runs out of attempts
+func (p *Pool) retry(ctx context.Context, retryable func(error) bool, attempt func(ctx context.Context) error) error {
+	backoff := p.config.Backoff
+	for i := 1; ; i++ {
+		err := p.attempt(ctx, attempt)
+		if err == nil || i >= p.config.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		wait := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, p.config.MaxBackoff)
+	}
+}
+
+// attempt runs one attempt with the query timeout
+func (p *Pool) attempt(ctx context.Context, attempt func(ctx context.Context) error) error {
+	if p.config.QueryTimeout <= 0 {
+		return attempt(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.config.QueryTimeout)
+	defer cancel()
+	return attempt(ctx)
+}
+
+type primaryContextKey struct{}
+
+// WithPrimary returns a context whose reads go to the primary, to read
+// writes that replicas may not have applied yet
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// ReadsFromPrimary reports whether reads of the context go to the primary
+func ReadsFromPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
+
+// sqlState is implemented by the errors of PostgreSQL drivers (pgx, lib/pq)
+type sqlState interface {
+	SQLState() string
+}
+
+// IsTransient reports whether an error is worth retrying: lost connections,
+// attempt timeouts (not those of the caller's context), serialization
+// failures, deadlocks, server shutdowns and connection limits
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsNotExecuted(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if code, ok := errorCode(err); ok {
+		return strings.HasPrefix(code, "08") || // connection exception
+			code == "57P01" || code == "57P02" // admin or crash shutdown
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// IsNotExecuted reports whether an error guarantees that a statement did not
+// take effect: a bad connection before it was sent, a serialization failure
+// or deadlock (rolled back), or a refused connection
+func IsNotExecuted(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	code, ok := errorCode(err)
+	return ok && (code == "40001" || // serialization_failure
+		code == "40P01" || // deadlock_detected
+		code == "53300" || // too_many_connections
+		code == "57P03") // cannot_connect_now
+}
+
+// errorCode returns the SQLSTATE of a driver error
+func errorCode(err error) (string, bool) {
+	var state sqlState
+	if errors.As(err, &state) {
+		return state.SQLState(), true
+	}
+	return "", false
+}
@@ -0,0 +1,705 @@
+package lokstraauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+	"github.com/primadi/lokstra-auth/01_credential/basic"
+	"github.com/primadi/lokstra-auth/01_credential/oauth2"
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/jwt"
+	"github.com/primadi/lokstra-auth/02_token/simple"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	simplesubject "github.com/primadi/lokstra-auth/03_subject/simple"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/abac"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+	"github.com/primadi/lokstra-auth/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid configuration")
+)
+
+// ConfigError is a configuration error at a key, e.g.
+// "token.jwt.secret: is required"
+type ConfigError struct {
+	// Key is the dotted path of the offending key
+	Key string
+
+	// Err is the error
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrInvalidConfig, e.Key, e.Err)
+}
+
+func (e *ConfigError) Unwrap() []error {
+	return []error{ErrInvalidConfig, e.Err}
+}
+
+// Spec is the declarative configuration of an Auth runtime, loaded from a
+// YAML or JSON file by NewFromConfig. String values may reference
+// environment variables (${NAME} or ${NAME:-default}) and secrets
+// ("env:NAME", "vault:path#key", see package secrets).
+//
+//	default_authenticator: basic
+//	refresh_tokens: true
+//	token:
+//	  type: jwt
+//	  jwt:
+//	    secret: vault:secret/data/auth#jwt_key
+//	    issuer: https://auth.example.com
+//	    access_token_ttl: 15m
+//	authenticators:
+//	  basic:
+//	    users:
+//	      - {id: u1, username: alice, password_hash: "$2a$10$...", roles: [admin]}
+//	  oauth2:
+//	    providers: [google]
+//	authorization:
+//	  rbac:
+//	    role_permissions:
+//	      admin: ["*"]
+type Spec struct {
+	DefaultAuthenticator string `yaml:"default_authenticator" json:"default_authenticator"`
+	RefreshTokens        *bool  `yaml:"refresh_tokens" json:"refresh_tokens"`
+	SessionManagement    bool   `yaml:"session_management" json:"session_management"`
+
+	Secrets        SecretsSpec        `yaml:"secrets" json:"secrets"`
+	Token          TokenSpec          `yaml:"token" json:"token"`
+	Authenticators AuthenticatorsSpec `yaml:"authenticators" json:"authenticators"`
+	Subjects       SubjectsSpec       `yaml:"subjects" json:"subjects"`
+	Authorization  AuthorizationSpec  `yaml:"authorization" json:"authorization"`
+}
+
+// SecretsSpec configures the secret resolvers (env, file and envfile are
+// always registered)
+type SecretsSpec struct {
+	Vault *VaultSpec `yaml:"vault" json:"vault"`
+}
+
+// VaultSpec configures the "vault:" secret scheme
+type VaultSpec struct {
+	Address   string `yaml:"address" json:"address"`
+	Token     string `yaml:"token" json:"token"`
+	Namespace string `yaml:"namespace" json:"namespace"`
+}
+
+// TokenSpec configures the token manager
+type TokenSpec struct {
+	// Type is "jwt" (default) or "simple"
+	Type   string      `yaml:"type" json:"type"`
+	JWT    *JWTSpec    `yaml:"jwt" json:"jwt"`
+	Simple *SimpleSpec `yaml:"simple" json:"simple"`
+}
+
+// JWTSpec configures the JWT token manager
+type JWTSpec struct {
+	// Algorithm is the signing algorithm (default: HS256)
+	Algorithm string `yaml:"algorithm" json:"algorithm"`
+
+	// Secret is the HMAC secret (HS*)
+	Secret string `yaml:"secret" json:"secret"`
+
+	// PrivateKey and PublicKey are PEM keys or "@<path>" of PEM files
+	// (RS*, PS*, ES*, EdDSA)
+	PrivateKey string `yaml:"private_key" json:"private_key"`
+	PublicKey  string `yaml:"public_key" json:"public_key"`
+
+	Issuer          string        `yaml:"issuer" json:"issuer"`
+	Audience        []string      `yaml:"audience" json:"audience"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" json:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" json:"refresh_token_ttl"`
+	Leeway          time.Duration `yaml:"leeway" json:"leeway"`
+	Revocation      bool          `yaml:"revocation" json:"revocation"`
+}
+
+// SimpleSpec configures the opaque token manager
+type SimpleSpec struct {
+	TokenTTL   time.Duration `yaml:"token_ttl" json:"token_ttl"`
+	Revocation bool          `yaml:"revocation" json:"revocation"`
+}
+
+// AuthenticatorsSpec configures the authenticators
+type AuthenticatorsSpec struct {
+	Basic  *BasicSpec  `yaml:"basic" json:"basic"`
+	APIKey *APIKeySpec `yaml:"apikey" json:"apikey"`
+	OAuth2 *OAuth2Spec `yaml:"oauth2" json:"oauth2"`
+}
+
+// BasicSpec configures username / password authentication
+type BasicSpec struct {
+	Users          []UserSpec          `yaml:"users" json:"users"`
+	PasswordPolicy *PasswordPolicySpec `yaml:"password_policy" json:"password_policy"`
+}
+
+// UserSpec is a user of the basic authenticator. Prefer PasswordHash
+// (bcrypt); Password is hashed at startup.
+type UserSpec struct {
+	ID           string         `yaml:"id" json:"id"`
+	Username     string         `yaml:"username" json:"username"`
+	Email        string         `yaml:"email" json:"email"`
+	Password     string         `yaml:"password" json:"password"`
+	PasswordHash string         `yaml:"password_hash" json:"password_hash"`
+	Disabled     bool           `yaml:"disabled" json:"disabled"`
+	Roles        []string       `yaml:"roles" json:"roles"`
+	Groups       []string       `yaml:"groups" json:"groups"`
+	Profile      map[string]any `yaml:"profile" json:"profile"`
+}
+
+// PasswordPolicySpec configures the password rules of basic credentials
+// (unset fields keep basic.DefaultValidatorConfig)
+type PasswordPolicySpec struct {
+	MinUsernameLength *int  `yaml:"min_username_length" json:"min_username_length"`
+	MinPasswordLength *int  `yaml:"min_password_length" json:"min_password_length"`
+	RequireUppercase  *bool `yaml:"require_uppercase" json:"require_uppercase"`
+	RequireLowercase  *bool `yaml:"require_lowercase" json:"require_lowercase"`
+	RequireDigit      *bool `yaml:"require_digit" json:"require_digit"`
+	RequireSpecial    *bool `yaml:"require_special" json:"require_special"`
+}
+
+// APIKeySpec enables API key authentication (keys are managed at runtime)
+type APIKeySpec struct{}
+
+// OAuth2Spec configures OAuth2 authentication
+type OAuth2Spec struct {
+	// Providers are the accepted built-in providers (empty: all)
+	Providers []string      `yaml:"providers" json:"providers"`
+	Timeout   time.Duration `yaml:"timeout" json:"timeout"`
+}
+
+// SubjectsSpec configures static roles, permissions and groups per subject
+// ID (in addition to those of basic users)
+type SubjectsSpec struct {
+	Roles       map[string][]string `yaml:"roles" json:"roles"`
+	Permissions map[string][]string `yaml:"permissions" json:"permissions"`
+	Groups      map[string][]string `yaml:"groups" json:"groups"`
+}
+
+// AuthorizationSpec configures the authorizer
+type AuthorizationSpec struct {
+	RBAC *RBACSpec `yaml:"rbac" json:"rbac"`
+	ABAC *ABACSpec `yaml:"abac" json:"abac"`
+
+	// Combining combines RBAC and ABAC when both are configured
+	// (default: deny-overrides)
+	Combining string `yaml:"combining" json:"combining"`
+}
+
+// ABACSpec configures attribute-based access control
+type ABACSpec struct {
+	// DefaultDecision is the decision when no rule matches
+	DefaultDecision bool           `yaml:"default_decision" json:"default_decision"`
+	Rules           []ABACRuleSpec `yaml:"rules" json:"rules"`
+}
+
+// ABACRuleSpec is an ABAC rule (see abac.Rule)
+type ABACRuleSpec struct {
+	ID          string              `yaml:"id" json:"id"`
+	Description string              `yaml:"description" json:"description"`
+	Effect      string              `yaml:"effect" json:"effect"`
+	Priority    int                 `yaml:"priority" json:"priority"`
+	Conditions  []ABACConditionSpec `yaml:"conditions" json:"conditions"`
+}
+
+// ABACConditionSpec is a condition of an ABAC rule (see abac.Condition)
+type ABACConditionSpec struct {
+	Type     string `yaml:"type" json:"type"`
+	Key      string `yaml:"key" json:"key"`
+	Operator string `yaml:"operator" json:"operator"`
+	Value    any    `yaml:"value" json:"value"`
+}
+
+// RBACSpec configures role-based access control
+type RBACSpec struct {
+	RolePermissions map[string][]string `yaml:"role_permissions" json:"role_permissions"`
+}
+
+// LoadSpec reads a YAML or JSON configuration file
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpec(data)
+}
+
+// ParseSpec parses a YAML or JSON configuration, expanding environment
+// variables in values. Unknown keys are errors.
+func ParseSpec(data []byte) (*Spec, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if err := expandNode(&root, ""); err != nil {
+		return nil, err
+	}
+
+	expanded, err := yaml.Marshal(&root)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(expanded))
+	decoder.KnownFields(true)
+
+	var spec Spec
+	if err := decoder.Decode(&spec); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return &spec, nil
+}
+
+// envPattern matches ${NAME} and ${NAME:-default}
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandNode expands environment variables in the scalar values of a node
+func expandNode(node *yaml.Node, key string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := expandNode(child, key); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := expandNode(node.Content[i+1], joinKey(key, node.Content[i].Value)); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := expandNode(child, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		var missing string
+		node.Value = envPattern.ReplaceAllStringFunc(node.Value, func(match string) string {
+			groups := envPattern.FindStringSubmatch(match)
+			if value, ok := os.LookupEnv(groups[1]); ok {
+				return value
+			}
+			if groups[2] != "" {
+				return groups[3]
+			}
+			missing = groups[1]
+			return match
+		})
+		if missing != "" {
+			return &ConfigError{Key: key, Err: fmt.Errorf("environment variable %s is not set", missing)}
+		}
+	}
+	return nil
+}
+
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// NewFromConfig builds an Auth runtime from a configuration file path, a
+// Spec or a *Spec
+func NewFromConfig(source any) (*Auth, error) {
+	var spec *Spec
+	switch source := source.(type) {
+	case string:
+		loaded, err := LoadSpec(source)
+		if err != nil {
+			return nil, err
+		}
+		spec = loaded
+	case *Spec:
+		spec = source
+	case Spec:
+		spec = &source
+	default:
+		return nil, fmt.Errorf("%w: unsupported source %T", ErrInvalidConfig, source)
+	}
+	return spec.Build(context.Background())
+}
+
+// Build builds an Auth runtime from the configuration
+func (s *Spec) Build(ctx context.Context) (*Auth, error) {
+	registry, err := s.Secrets.registry()
+	if err != nil {
+		return nil, err
+	}
+	manager, err := s.Token.build(ctx, registry)
+	if err != nil {
+		return nil, err
+	}
+	authenticators, err := s.authenticators()
+	if err != nil {
+		return nil, err
+	}
+	authorizer, err := s.Authorization.build()
+	if err != nil {
+		return nil, err
+	}
+
+	builder := s.builder(registry, manager).WithIdentityContextBuilder(s.contextBuilder())
+	for authType, authenticator := range authenticators {
+		builder.WithAuthenticator(authType, authenticator)
+	}
+	if authorizer != nil {
+		builder.WithAuthorizer(authorizer)
+	}
+	return builder.Build(), nil
+}
+
+// builder returns a builder with the runtime settings of the configuration
+func (s *Spec) builder(resolver secrets.SecretResolver, manager token.TokenManager) *Builder {
+	builder := NewBuilder().
+		WithSecretResolver(resolver).
+		WithTokenManager(manager).
+		WithTokenStore(token.NewInMemoryTokenStore()).
+		WithSubjectResolver(simplesubject.NewResolver())
+	if s.DefaultAuthenticator != "" {
+		builder.SetDefaultAuthenticator(s.DefaultAuthenticator)
+	}
+	if s.RefreshTokens != nil && !*s.RefreshTokens {
+		builder.DisableRefreshToken()
+	}
+	if s.SessionManagement {
+		builder.EnableSessionManagement().WithIdentityStore(subject.NewInMemoryIdentityStore())
+	}
+	return builder
+}
+
+// registry creates the secret resolver registry
+func (s *SecretsSpec) registry() (*secrets.Registry, error) {
+	registry := secrets.NewRegistry()
+	if vault := s.Vault; vault != nil {
+		if vault.Address == "" {
+			return nil, &ConfigError{Key: "secrets.vault.address", Err: errors.New("is required")}
+		}
+		registry.Register("vault", secrets.NewVaultResolver(&secrets.VaultConfig{
+			Address:   vault.Address,
+			Token:     vault.Token,
+			Namespace: vault.Namespace,
+		}))
+	}
+	return registry, nil
+}
+
+// authenticators creates the authenticators and checks the default one
+func (s *Spec) authenticators() (map[string]credential.Authenticator, error) {
+	authenticators, err := s.Authenticators.build()
+	if err != nil {
+		return nil, err
+	}
+	if len(authenticators) == 0 {
+		return nil, &ConfigError{Key: "authenticators", Err: errors.New("at least one authenticator is required")}
+	}
+
+	defaultType := s.DefaultAuthenticator
+	if defaultType == "" {
+		defaultType = DefaultConfig().DefaultAuthenticatorType
+	}
+	if _, ok := authenticators[defaultType]; !ok {
+		return nil, &ConfigError{Key: "default_authenticator", Err: fmt.Errorf("%q is not configured", defaultType)}
+	}
+	return authenticators, nil
+}
+
+// build creates the authorizer (nil when none is configured)
+func (a *AuthorizationSpec) build() (authz.Authorizer, error) {
+	var members []authz.CompositeMember
+	if a.RBAC != nil {
+		members = append(members, authz.CompositeMember{Name: "rbac", Evaluator: rbac.NewEvaluator(cloneLists(a.RBAC.RolePermissions))})
+	}
+	if a.ABAC != nil {
+		evaluator, err := a.ABAC.build()
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, authz.CompositeMember{Name: "abac", Evaluator: evaluator})
+	}
+
+	switch len(members) {
+	case 0:
+		return nil, nil
+	case 1:
+		return members[0].Evaluator.(authz.Authorizer), nil
+	}
+
+	algorithm := authz.CombiningAlgorithm(a.Combining)
+	if algorithm == "" {
+		algorithm = authz.DenyOverrides
+	}
+	composite, err := authz.NewCompositeEvaluator(algorithm, members...)
+	if err != nil {
+		return nil, &ConfigError{Key: "authorization.combining", Err: err}
+	}
+	return composite, nil
+}
+
+// build creates the ABAC evaluator
+func (a *ABACSpec) build() (*abac.Evaluator, error) {
+	evaluator := abac.NewEvaluator(nil, a.DefaultDecision)
+	for i, r := range a.Rules {
+		key := fmt.Sprintf("authorization.abac.rules[%d]", i)
+		if r.ID == "" {
+			return nil, &ConfigError{Key: key + ".id", Err: errors.New("is required")}
+		}
+		if r.Effect != "allow" && r.Effect != "deny" {
+			return nil, &ConfigError{Key: key + ".effect", Err: fmt.Errorf("must be allow or deny, got %q", r.Effect)}
+		}
+
+		rule := &abac.Rule{ID: r.ID, Description: r.Description, Effect: r.Effect, Priority: r.Priority}
+		for j, c := range r.Conditions {
+			switch c.Type {
+			case "subject", "resource", "environment", "action":
+			default:
+				return nil, &ConfigError{Key: fmt.Sprintf("%s.conditions[%d].type", key, j), Err: fmt.Errorf("unknown condition type %q", c.Type)}
+			}
+			rule.Conditions = append(rule.Conditions, abac.Condition{Type: c.Type, Key: c.Key, Operator: c.Operator, Value: c.Value})
+		}
+		evaluator.AddRule(rule)
+	}
+	return evaluator, nil
+}
+
+// build creates the token manager
+func (t *TokenSpec) build(ctx context.Context, resolver secrets.SecretResolver) (token.TokenManager, error) {
+	switch t.Type {
+	case "", "jwt":
+		if t.JWT == nil {
+			return nil, &ConfigError{Key: "token.jwt", Err: errors.New("is required")}
+		}
+		return t.JWT.build(ctx, resolver)
+	case "simple":
+		config := simple.DefaultConfig()
+		if t.Simple != nil {
+			if t.Simple.TokenTTL > 0 {
+				config.TokenDuration = t.Simple.TokenTTL
+			}
+			config.EnableRevocation = t.Simple.Revocation
+		}
+		return simple.NewManager(config), nil
+	}
+	return nil, &ConfigError{Key: "token.type", Err: fmt.Errorf("unknown token type %q", t.Type)}
+}
+
+// build creates the JWT manager
+func (j *JWTSpec) build(ctx context.Context, resolver secrets.SecretResolver) (*jwt.Manager, error) {
+	config := jwt.DefaultConfig("")
+
+	var err error
+	config.SigningMethod, config.SigningKey, config.VerifyingKey, err = j.keys(ctx, resolver)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.Issuer != "" {
+		config.Issuer = j.Issuer
+	}
+	if len(j.Audience) > 0 {
+		config.Audience = j.Audience
+	}
+	if j.AccessTokenTTL > 0 {
+		config.AccessTokenDuration = j.AccessTokenTTL
+	}
+	if j.RefreshTokenTTL > 0 {
+		config.RefreshTokenDuration = j.RefreshTokenTTL
+	}
+	config.Leeway = j.Leeway
+	config.EnableRevocation = j.Revocation
+
+	return jwt.NewManager(config), nil
+}
+
+// keys returns the signing method and keys
+func (j *JWTSpec) keys(ctx context.Context, resolver secrets.SecretResolver) (method gojwt.SigningMethod, signingKey, verifyingKey any, err error) {
+	algorithm := j.Algorithm
+	if algorithm == "" {
+		algorithm = "HS256"
+	}
+	method = gojwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return nil, nil, nil, &ConfigError{Key: "token.jwt.algorithm", Err: fmt.Errorf("unknown algorithm %q", algorithm)}
+	}
+
+	if strings.HasPrefix(algorithm, "HS") {
+		if j.Secret == "" {
+			return nil, nil, nil, &ConfigError{Key: "token.jwt.secret", Err: errors.New("is required for " + algorithm)}
+		}
+		secret, err := resolver.Resolve(ctx, secrets.Ref(j.Secret))
+		if err != nil {
+			return nil, nil, nil, &ConfigError{Key: "token.jwt.secret", Err: err}
+		}
+		return method, []byte(secret), []byte(secret), nil
+	}
+
+	if j.PrivateKey == "" {
+		return nil, nil, nil, &ConfigError{Key: "token.jwt.private_key", Err: errors.New("is required for " + algorithm)}
+	}
+	privateKey, err := loadPEMKey(ctx, resolver, j.PrivateKey, x509.ParsePKCS8PrivateKey)
+	if err != nil {
+		return nil, nil, nil, &ConfigError{Key: "token.jwt.private_key", Err: err}
+	}
+
+	if j.PublicKey != "" {
+		if verifyingKey, err = loadPEMKey(ctx, resolver, j.PublicKey, x509.ParsePKIXPublicKey); err != nil {
+			return nil, nil, nil, &ConfigError{Key: "token.jwt.public_key", Err: err}
+		}
+	} else if signer, ok := privateKey.(crypto.Signer); ok {
+		verifyingKey = signer.Public()
+	}
+	return method, privateKey, verifyingKey, nil
+}
+
+// loadPEMKey loads a PEM key given inline, as "@<path>", or as a secret
+// reference
+func loadPEMKey(ctx context.Context, resolver secrets.SecretResolver, value string, parse func([]byte) (any, error)) (any, error) {
+	var data []byte
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		read, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = read
+	} else {
+		resolved, err := resolver.Resolve(ctx, secrets.Ref(value))
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(resolved)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("not a PEM key")
+	}
+	return parse(block.Bytes)
+}
+
+// build creates the authenticators by type
+func (a *AuthenticatorsSpec) build() (map[string]credential.Authenticator, error) {
+	authenticators := make(map[string]credential.Authenticator)
+
+	if a.Basic != nil {
+		users := basic.NewInMemoryUserProvider()
+		for i, u := range a.Basic.Users {
+			key := fmt.Sprintf("authenticators.basic.users[%d]", i)
+			if u.ID == "" || u.Username == "" {
+				return nil, &ConfigError{Key: key, Err: errors.New("id and username are required")}
+			}
+			hash := u.PasswordHash
+			if hash == "" {
+				if u.Password == "" {
+					return nil, &ConfigError{Key: key, Err: errors.New("password or password_hash is required")}
+				}
+				hashed, err := basic.HashPassword(u.Password)
+				if err != nil {
+					return nil, &ConfigError{Key: key + ".password", Err: err}
+				}
+				hash = hashed
+			}
+			users.AddUser(&basic.User{
+				ID:           u.ID,
+				Username:     u.Username,
+				Email:        u.Email,
+				PasswordHash: hash,
+				Disabled:     u.Disabled,
+			})
+		}
+		authenticators["basic"] = basic.NewAuthenticator(users, basic.NewValidator(a.Basic.PasswordPolicy.validatorConfig()))
+	}
+
+	if a.APIKey != nil {
+		authenticators["apikey"] = apikey.NewAuthenticator(nil)
+	}
+
+	if a.OAuth2 != nil {
+		config := oauth2.DefaultConfig()
+		for _, provider := range a.OAuth2.Providers {
+			config.Providers = append(config.Providers, oauth2.Provider(provider))
+		}
+		if a.OAuth2.Timeout > 0 {
+			config.Timeout = a.OAuth2.Timeout
+			config.HTTPClient.Timeout = a.OAuth2.Timeout
+		}
+		authenticators["oauth2"] = oauth2.NewAuthenticator(config)
+	}
+
+	return authenticators, nil
+}
+
+// validatorConfig returns the validator configuration of the policy
+func (p *PasswordPolicySpec) validatorConfig() *basic.ValidatorConfig {
+	config := basic.DefaultValidatorConfig()
+	if p == nil {
+		return config
+	}
+	setIfSet(&config.MinUsernameLength, p.MinUsernameLength)
+	setIfSet(&config.MinPasswordLength, p.MinPasswordLength)
+	setIfSet(&config.RequireUppercase, p.RequireUppercase)
+	setIfSet(&config.RequireLowercase, p.RequireLowercase)
+	setIfSet(&config.RequireDigit, p.RequireDigit)
+	setIfSet(&config.RequireSpecial, p.RequireSpecial)
+	return config
+}
+
+func setIfSet[T any](target *T, value *T) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+// contextBuilder creates the identity context builder from the static
+// subjects and the basic users
+func (s *Spec) contextBuilder() subject.IdentityContextBuilder {
+	roles := cloneLists(s.Subjects.Roles)
+	groups := cloneLists(s.Subjects.Groups)
+	profiles := make(map[string]map[string]any)
+
+	if s.Authenticators.Basic != nil {
+		for _, u := range s.Authenticators.Basic.Users {
+			roles[u.ID] = append(roles[u.ID], u.Roles...)
+			groups[u.ID] = append(groups[u.ID], u.Groups...)
+			profile := map[string]any{"username": u.Username}
+			if u.Email != "" {
+				profile["email"] = u.Email
+			}
+			for k, v := range u.Profile {
+				profile[k] = v
+			}
+			profiles[u.ID] = profile
+		}
+	}
+
+	return simplesubject.NewContextBuilder(
+		simplesubject.NewStaticRoleProvider(roles),
+		simplesubject.NewStaticPermissionProvider(cloneLists(s.Subjects.Permissions)),
+		simplesubject.NewStaticGroupProvider(groups),
+		simplesubject.NewStaticProfileProvider(profiles),
+	)
+}
+
+func cloneLists(lists map[string][]string) map[string][]string {
+	cloned := make(map[string][]string, len(lists))
+	for key, values := range lists {
+		cloned[key] = append([]string{}, values...)
+	}
+	return cloned
+}
@@ -0,0 +1,172 @@
+package lokstraauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+	"github.com/primadi/lokstra-auth/01_credential/basic"
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/device"
+	"github.com/primadi/lokstra-auth/02_token/jwt"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/03_subject/simple"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+)
+
+// DevUser is a seeded user of the development runtime
+type DevUser struct {
+	ID       string
+	Username string
+	Password string
+	Email    string
+	Roles    []string
+}
+
+// DevUsers are the users seeded by NewDevRuntime
+var DevUsers = []DevUser{
+	{ID: "user-admin", Username: "admin", Password: "admin123", Email: "admin@example.com", Roles: []string{"admin"}},
+	{ID: "user-editor", Username: "editor", Password: "editor123", Email: "editor@example.com", Roles: []string{"editor"}},
+	{ID: "user-viewer", Username: "viewer", Password: "viewer123", Email: "viewer@example.com", Roles: []string{"viewer"}},
+}
+
+// DevRolePermissions are the role permissions seeded by NewDevRuntime
+var DevRolePermissions = map[string][]string{
+	"admin":  {"*"},
+	"editor": {"read:document", "write:document", "create:document"},
+	"viewer": {"read:document"},
+}
+
+// DevRuntime is a fully wired, in-memory Auth runtime with seeded sample data.
+// It is intended for examples, tests and local development only.
+type DevRuntime struct {
+	*Auth
+
+	// Users holds the seeded basic-auth users
+	Users *basic.InMemoryUserProvider
+
+	// APIKeys is the API key authenticator (no keys are seeded)
+	APIKeys *apikey.Authenticator
+
+	// TokenManager is the JWT manager (random secret, revocation enabled)
+	TokenManager *jwt.Manager
+
+	// TokenStore tracks issued tokens
+	TokenStore *token.InMemoryTokenStore
+
+	// Devices issues remember-me device tokens
+	Devices *device.Manager
+
+	// IdentityStore holds session identities
+	IdentityStore *subject.InMemoryIdentityStore
+
+	// DeviceStore is the device registry
+	DeviceStore *subject.InMemoryDeviceStore
+
+	// Roles maps user IDs to roles
+	Roles *simple.StaticRoleProvider
+
+	// Profiles holds the user profiles, editable through the profile
+	// self-service (see Auth.UpdateProfile)
+	Profiles *simple.StaticProfileProvider
+
+	// RBAC is the authorizer
+	RBAC *rbac.Evaluator
+}
+
+// NewDevRuntime wires in-memory implementations of every layer (users, tokens,
+// sessions, RBAC) with seeded sample data (see DevUsers and DevRolePermissions).
+// Never use it in production: the signing secret is random per process and
+// passwords are well known.
+func NewDevRuntime() *DevRuntime {
+	// Layer 1: Users and authenticators
+	users := basic.NewInMemoryUserProvider()
+	userRoles := make(map[string][]string, len(DevUsers))
+	profiles := make(map[string]map[string]any, len(DevUsers))
+
+	for _, u := range DevUsers {
+		hash, err := basic.HashPassword(u.Password)
+		if err != nil {
+			panic(err)
+		}
+		users.AddUser(&basic.User{
+			ID:           u.ID,
+			Username:     u.Username,
+			PasswordHash: hash,
+			Email:        u.Email,
+		})
+		userRoles[u.ID] = u.Roles
+		profiles[u.ID] = map[string]any{
+			"username": u.Username,
+			"email":    u.Email,
+		}
+	}
+
+	apiKeys := apikey.NewAuthenticator(nil)
+
+	// Layer 2: Tokens
+	jwtConfig := jwt.DefaultConfig(randomSecret())
+	jwtConfig.Issuer = "lokstra-auth-dev"
+	jwtConfig.EnableRevocation = true
+	tokenManager := jwt.NewManager(jwtConfig)
+	tokenStore := token.NewInMemoryTokenStore()
+	devices := device.NewManager(nil)
+
+	// Layer 3: Subjects
+	roles := simple.NewStaticRoleProvider(userRoles)
+	profileProvider := simple.NewStaticProfileProvider(profiles)
+	identityStore := subject.NewInMemoryIdentityStore()
+	deviceStore := subject.NewInMemoryDeviceStore()
+
+	rolePermissions := make(map[string][]string, len(DevRolePermissions))
+	for role, permissions := range DevRolePermissions {
+		rolePermissions[role] = append([]string{}, permissions...)
+	}
+
+	// Layer 4: Authorization
+	rbacEvaluator := rbac.NewEvaluator(rolePermissions)
+
+	auth := NewBuilder().
+		WithAuthenticator("basic", basic.NewAuthenticator(users, nil)).
+		WithAuthenticator("apikey", apiKeys).
+		WithTokenManager(tokenManager).
+		WithTokenStore(tokenStore).
+		WithDeviceTokens(devices).
+		WithSubjectResolver(simple.NewResolver()).
+		WithIdentityContextBuilder(simple.NewContextBuilder(
+			roles,
+			simple.NewStaticPermissionProvider(map[string][]string{}),
+			simple.NewStaticGroupProvider(map[string][]string{}),
+			profileProvider,
+		)).
+		WithIdentityStore(identityStore).
+		WithDeviceStore(deviceStore).
+		WithProfile(&ProfileConfig{Store: profileProvider}).
+		WithAuthorizer(rbacEvaluator).
+		EnableRefreshToken().
+		EnableSessionManagement().
+		Build()
+
+	return &DevRuntime{
+		Auth:          auth,
+		Users:         users,
+		APIKeys:       apiKeys,
+		TokenManager:  tokenManager,
+		TokenStore:    tokenStore,
+		Devices:       devices,
+		IdentityStore: identityStore,
+		DeviceStore:   deviceStore,
+		Roles:         roles,
+		Profiles:      profileProvider,
+		RBAC:          rbacEvaluator,
+	}
+}
+
+// randomSecret generates a random per-process signing secret
+func randomSecret() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,230 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/primadi/lokstra-auth/02_token/device"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/audit"
+)
+
+var (
+	ErrNoDeviceStore            = errors.New("no device store configured")
+	ErrMissingDeviceFingerprint = errors.New("device fingerprint is required")
+)
+
+// DeviceRegistration describes the device a subject logs in from
+type DeviceRegistration struct {
+	// Fingerprint identifies the device (e.g., a client-generated device ID
+	// combined with the user agent). Only its hash is stored.
+	Fingerprint string
+
+	// Platform is the device platform (e.g., "ios", "android", "web")
+	Platform string
+
+	// Name is a display name (e.g., "Chrome on macOS")
+	Name string
+
+	// IPAddress is the client IP address
+	IPAddress string
+
+	// UserAgent is the client user agent
+	UserAgent string
+
+	// Metadata contains additional device metadata
+	Metadata map[string]any
+}
+
+// SetDeviceStore sets the device registry store
+func (a *Auth) SetDeviceStore(store subject.DeviceStore) {
+	a.deviceStore = store
+}
+
+// GetDeviceStore returns the device registry store (nil if not configured)
+func (a *Auth) GetDeviceStore() subject.DeviceStore {
+	return a.deviceStore
+}
+
+// RegisterDevice registers a device of a subject, or updates the last-seen
+// information of an already registered device with the same fingerprint.
+// Login calls it automatically when LoginRequest.Device is set.
+func (a *Auth) RegisterDevice(ctx context.Context, subjectID string, registration *DeviceRegistration) (*subject.DeviceInfo, error) {
+	if a.deviceStore == nil {
+		return nil, ErrNoDeviceStore
+	}
+	if subjectID == "" {
+		return nil, ErrMissingSubject
+	}
+	if registration == nil || registration.Fingerprint == "" {
+		return nil, ErrMissingDeviceFingerprint
+	}
+
+	now := time.Now().Unix()
+	fingerprintHash := device.HashFingerprint(registration.Fingerprint)
+
+	dev, err := query(ctx, a, "device", "find device",
+		func(ctx context.Context) (*subject.DeviceInfo, error) {
+			return a.deviceStore.FindDevice(ctx, subjectID, fingerprintHash)
+		})
+	if err != nil {
+		if !errors.Is(err, subject.ErrDeviceNotFound) {
+			return nil, err
+		}
+
+		deviceID, err := newSessionID()
+		if err != nil {
+			return nil, err
+		}
+
+		dev = &subject.DeviceInfo{
+			ID:              deviceID,
+			SubjectID:       subjectID,
+			FingerprintHash: fingerprintHash,
+			FirstSeenAt:     now,
+		}
+	}
+
+	dev.LastSeenAt = now
+	dev.LastIPAddress = registration.IPAddress
+	dev.LastUserAgent = registration.UserAgent
+	if registration.Platform != "" {
+		dev.Platform = registration.Platform
+	}
+	if registration.Name != "" {
+		dev.Name = registration.Name
+	}
+	if len(registration.Metadata) > 0 {
+		if dev.Metadata == nil {
+			dev.Metadata = make(map[string]any, len(registration.Metadata))
+		}
+		maps.Copy(dev.Metadata, registration.Metadata)
+	}
+
+	if err := a.exec(ctx, "device", "save device", func(ctx context.Context) error {
+		return a.deviceStore.SaveDevice(ctx, dev)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save device: %w", err)
+	}
+
+	return dev, nil
+}
+
+// ListDevices returns the devices of a subject with last-seen information.
+// Without a device store, the remembered devices (device tokens) are listed.
+func (a *Auth) ListDevices(ctx context.Context, subjectID string) ([]*subject.DeviceInfo, error) {
+	if subjectID == "" {
+		return nil, ErrMissingSubject
+	}
+
+	if a.deviceStore != nil {
+		return a.deviceStore.ListDevices(ctx, subjectID)
+	}
+
+	remembered, err := a.ListRememberedDevices(ctx, subjectID)
+	if err != nil {
+		if errors.Is(err, ErrDeviceTokensNotSupported) {
+			return nil, ErrNoDeviceStore
+		}
+		return nil, err
+	}
+
+	devices := make([]*subject.DeviceInfo, 0, len(remembered))
+	for _, d := range remembered {
+		devices = append(devices, &subject.DeviceInfo{
+			ID:              d.SeriesID,
+			SubjectID:       d.SubjectID,
+			FingerprintHash: d.FingerprintHash,
+			Name:            d.Name,
+			FirstSeenAt:     d.CreatedAt.Unix(),
+			LastSeenAt:      d.LastUsedAt.Unix(),
+			LastIPAddress:   d.IPAddress,
+			LastUserAgent:   d.UserAgent,
+		})
+	}
+
+	return devices, nil
+}
+
+// TrustDevice marks a device of a subject as trusted (may skip MFA) or untrusted
+func (a *Auth) TrustDevice(ctx context.Context, subjectID, deviceID string, trusted bool) error {
+	if a.deviceStore == nil {
+		return ErrNoDeviceStore
+	}
+
+	dev, err := a.deviceStore.GetDevice(ctx, subjectID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	dev.Trusted = trusted
+	dev.TrustedAt = 0
+	if trusted {
+		dev.TrustedAt = time.Now().Unix()
+	}
+
+	if err := a.deviceStore.SaveDevice(ctx, dev); err != nil {
+		return err
+	}
+
+	eventType := audit.EventDeviceUntrusted
+	if trusted {
+		eventType = audit.EventDeviceTrusted
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: eventType,
+		SubjectID: subjectID,
+		Resource:  "device:" + deviceID,
+		Result:    audit.ResultSuccess,
+	})
+	return nil
+}
+
+// IsTrustedDevice reports whether a subject logs in from a trusted device
+// (e.g., to decide whether MFA can be skipped)
+func (a *Auth) IsTrustedDevice(ctx context.Context, subjectID, fingerprint string) (bool, error) {
+	if a.deviceStore == nil {
+		return false, ErrNoDeviceStore
+	}
+
+	dev, err := a.deviceStore.FindDevice(ctx, subjectID, device.HashFingerprint(fingerprint))
+	if err != nil {
+		if errors.Is(err, subject.ErrDeviceNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return dev.Trusted, nil
+}
+
+// RevokeDevice removes a device of a subject and forgets its remember-me
+// device tokens. Without a device store, deviceID is a remembered device ID.
+func (a *Auth) RevokeDevice(ctx context.Context, subjectID, deviceID string) error {
+	if subjectID == "" {
+		return ErrMissingSubject
+	}
+
+	if a.deviceStore == nil {
+		if a.deviceTokens == nil {
+			return ErrNoDeviceStore
+		}
+		return a.ForgetDevice(ctx, subjectID, deviceID)
+	}
+
+	dev, err := a.deviceStore.GetDevice(ctx, subjectID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	if a.deviceTokens != nil {
+		if err := a.deviceTokens.RevokeByFingerprint(ctx, subjectID, dev.FingerprintHash); err != nil {
+			return fmt.Errorf("failed to revoke device tokens: %w", err)
+		}
+	}
+
+	return a.deviceStore.DeleteDevice(ctx, subjectID, deviceID)
+}
@@ -0,0 +1,204 @@
+package lokstraauth
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/permission"
+)
+
+// DefaultDownscopeLifetime is the lifetime of down-scoped tokens when the
+// request sets none
+const DefaultDownscopeLifetime = 5 * time.Minute
+
+var (
+	ErrNothingToDownscope   = autherrors.New(autherrors.ErrInvalidRequest, "down-scoping requires scopes or permissions")
+	ErrDownscopeEscalation  = autherrors.New(autherrors.ErrInsufficientScope, "down-scoped token cannot exceed the original token")
+	ErrDownscopeInvalid     = autherrors.New(autherrors.ErrTokenInvalid, "token cannot be down-scoped")
+	ErrDownscopeTokenExpiry = autherrors.New(autherrors.ErrTokenInvalid, "token expires too soon to be down-scoped")
+)
+
+// DownscopeRequest describes the restriction of a down-scoped token
+type DownscopeRequest struct {
+	// Scopes are the scopes of the down-scoped token, a subset of the scopes
+	// of the original token (optional; the original scopes by default)
+	Scopes []string
+
+	// Permissions restricts the down-scoped token to these permissions
+	// (e.g., "document:read", "report:*"). Authorizers deny anything else,
+	// even what the subject is otherwise allowed. They must be covered by the
+	// permissions of an original token that is already down-scoped.
+	Permissions []string
+
+	// ExpiresIn is the lifetime of the down-scoped token (optional,
+	// DefaultDownscopeLifetime by default). It never outlives the original.
+	ExpiresIn time.Duration
+}
+
+// DownscopeToken issues a short-lived derivative of a valid access token,
+// restricted to narrower scopes and permissions, to hand to less-trusted
+// subsystems instead of the original. The derivative keeps the subject and
+// claims of the original, records the restriction in the
+// "allowed_permissions" claim (enforced by the runtime authorizer and the
+// middleware, see authz.RestrictedAuthorizer) and can be narrowed again but
+// never widened.
+func (a *Auth) DownscopeToken(ctx context.Context, tokenValue string, request *DownscopeRequest) (*token.Token, error) {
+	if a.tokenManager == nil {
+		return nil, ErrNoTokenManager
+	}
+	if len(request.Scopes) == 0 && len(request.Permissions) == 0 {
+		return nil, ErrNothingToDownscope
+	}
+
+	verifyResult, err := inLayer(ctx, a, LayerToken, "verify token",
+		func(ctx context.Context) (*token.VerificationResult, error) {
+			return a.verifyToken(ctx, tokenValue, nil)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("token verification error: %w", err)
+	}
+	if !verifyResult.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrDownscopeInvalid, verifyResult.Error)
+	}
+	original := verifyResult.Claims
+	switch original.TokenType() {
+	case token.TokenTypeRefresh, token.TokenTypeMFAPending:
+		return nil, fmt.Errorf("%w: %s token", ErrDownscopeInvalid, original.TokenType())
+	}
+	ctx, err = bindTokenTenant(ctx, original)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDownscopeInvalid, err)
+	}
+	subjectID, _ := original.GetString("sub")
+
+	claims, err := downscopeClaims(original, request)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime, err := downscopeLifetime(original, request.ExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	tok, err := inLayer(token.WithLifetimes(ctx, token.Lifetimes{Access: lifetime}), a, LayerToken, "generate down-scoped token",
+		func(ctx context.Context) (*token.Token, error) {
+			return a.tokenManager.Generate(ctx, claims)
+		})
+	a.observeIssue(token.TokenTypeAccess, start, err)
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventTokenDownscoped,
+		SubjectID: subjectID,
+		Action:    "downscope_token",
+		Result:    auditResult(err),
+		Metadata:  auditMetadata(err, "permissions", request.Permissions),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenGenerationFailed, err)
+	}
+
+	a.emit(ctx, token.EventIssued, subjectID, token.TokenTypeAccess, tok, nil)
+	return tok, nil
+}
+
+// downscopeClaims returns the claims of a down-scoped token: the claims of
+// the original without its registered times and ID, restricted by the
+// request
+func downscopeClaims(original token.Claims, request *DownscopeRequest) (map[string]any, error) {
+	scopes := original.Scopes()
+	for _, scope := range request.Scopes {
+		if !permission.CoversAny(scopes, scope) {
+			return nil, fmt.Errorf("%w: scope %s", ErrDownscopeEscalation, scope)
+		}
+	}
+
+	allowed, restricted := original.AllowedPermissions()
+	if restricted {
+		for _, required := range request.Permissions {
+			if !permission.CoversAny(allowed, required) {
+				return nil, fmt.Errorf("%w: permission %s", ErrDownscopeEscalation, required)
+			}
+		}
+	}
+
+	claims := make(map[string]any, len(original)+2)
+	maps.Copy(claims, original)
+	// The token manager sets the times and ID of the derivative
+	for _, claim := range []string{"exp", "iat", "nbf", "jti"} {
+		delete(claims, claim)
+	}
+
+	if len(request.Scopes) > 0 {
+		delete(claims, "scope")
+		claims["scopes"] = request.Scopes
+	}
+	if len(request.Permissions) > 0 {
+		claims[token.ClaimAllowedPermissions] = request.Permissions
+	}
+	if jti, ok := original.GetString("jti"); ok && jti != "" {
+		claims[token.ClaimDownscopedFrom] = jti
+	}
+	return claims, nil
+}
+
+// downscopeLifetime returns the lifetime of a down-scoped token, capped by
+// the remaining lifetime of the original
+func downscopeLifetime(original token.Claims, requested time.Duration) (time.Duration, error) {
+	lifetime := requested
+	if lifetime <= 0 {
+		lifetime = DefaultDownscopeLifetime
+	}
+
+	if exp, ok := original.GetInt64("exp"); ok {
+		remaining := time.Until(time.Unix(exp, 0)).Truncate(time.Second)
+		if remaining <= 0 {
+			return 0, ErrDownscopeTokenExpiry
+		}
+		lifetime = min(lifetime, remaining)
+	}
+	return lifetime, nil
+}
+
+// scopedIdentity returns the identity restricted exactly as verified claims
+// are: to their allowed permissions, or not at all. The subject resolver and
+// the identity context builder may share their results across the tokens of
+// a subject (e.g., cached.Resolver, cached.ContextBuilder), and resolvers
+// may copy the claim of the token that filled the cache, so the restriction
+// is set on a copy and never written to their results.
+func scopedIdentity(identity *subject.IdentityContext, claims token.Claims) *subject.IdentityContext {
+	allowed, restricted := claims.AllowedPermissions()
+	var inherited bool
+	if identity.Subject != nil {
+		_, inherited = identity.Subject.Attributes[authz.AllowedPermissionsAttribute]
+	}
+	if !restricted && !inherited {
+		return identity
+	}
+
+	sub := &subject.Subject{}
+	if identity.Subject != nil {
+		copied := *identity.Subject
+		sub = &copied
+	}
+	sub.Attributes = maps.Clone(sub.Attributes)
+	if sub.Attributes == nil {
+		sub.Attributes = make(map[string]any)
+	}
+	if restricted {
+		sub.Attributes[authz.AllowedPermissionsAttribute] = allowed
+	} else {
+		delete(sub.Attributes, authz.AllowedPermissionsAttribute)
+	}
+
+	scoped := *identity
+	scoped.Subject = sub
+	return &scoped
+}
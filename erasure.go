@@ -0,0 +1,536 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/consent"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/identitychange"
+	"github.com/primadi/lokstra-auth/loginattempt"
+	"github.com/primadi/lokstra-auth/recovery"
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+var (
+	ErrAPIKeysNotErasable       = autherrors.New(autherrors.ErrNotImplemented, "API key store does not list keys by user")
+	ErrLoginAttemptsNotErasable = autherrors.New(autherrors.ErrNotImplemented, "login attempt store does not delete attempts")
+	ErrAuditNotErasable         = autherrors.New(autherrors.ErrNotImplemented, "audit log store does not support pseudonymization")
+)
+
+// ErasedPseudonymPrefix prefixes the pseudonyms replacing the IDs of erased
+// users in the audit log
+const ErasedPseudonymPrefix = "erased:"
+
+// ErasureConfig gives Anonymize and ExportUserData the stores of user data
+// the runtime does not hold otherwise
+type ErasureConfig struct {
+	// APIKeys stores the API keys of users; it must implement
+	// apikey.KeyLister (optional)
+	APIKeys apikey.KeyStore
+
+	// Consents stores the OAuth2 consents of users (optional)
+	Consents consent.Store
+}
+
+// ErasureResult reports what Anonymize erased
+type ErasureResult struct {
+	// Pseudonym replaces the ID of the user in the audit log
+	Pseudonym string `json:"pseudonym"`
+
+	Identities      int `json:"identities"`
+	Devices         int `json:"devices"`
+	APIKeys         int `json:"api_keys"`
+	Consents        int `json:"consents"`
+	LoginAttempts   int `json:"login_attempts"`
+	RecoveryData    int `json:"recovery_data"`
+	IdentityChanges int `json:"identity_changes"`
+	AuditEntries    int `json:"audit_entries"`
+}
+
+// Anonymize erases the personal data of a user of a tenant (right to
+// erasure), whether or not the user was deleted already:
+//
+//   - the user is anonymized and soft-deleted (see tenant.AnonymizeUser);
+//     its ID stays reserved
+//   - its linked identities, devices, API keys, consents, login attempts,
+//     recovery data (see RecoveryConfig) and pending email and username
+//     changes (see IdentityChangeConfig) are deleted
+//   - its tokens, remembered devices and sessions are revoked (best
+//     effort: with a token manager that does not revoke, issued tokens
+//     stay valid until they expire)
+//   - its audit log entries are pseudonymized with a random pseudonym (see
+//     audit.Logger.Pseudonymize), recorded by an audit.pseudonymized entry
+//     so the chain still verifies
+//
+// Anonymize fails before erasing anything when a configured store cannot
+// erase its part (ErrAPIKeysNotErasable, ErrLoginAttemptsNotErasable,
+// ErrAuditNotErasable). The erasure is recorded in the audit log and
+// published under the pseudonym, with the actor of the context (see
+// authz.WithActor). Entries still queued by an async audit emitter are not
+// pseudonymized.
+func (a *Auth) Anonymize(ctx context.Context, tenantID, userID string) (*ErasureResult, error) {
+	if a.users == nil {
+		return nil, ErrNoUserStore
+	}
+	if userID == "" {
+		return nil, ErrMissingSubject
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	apiKeys := a.erasureAPIKeyStore()
+	keyLister, ok := apiKeys.(apikey.KeyLister)
+	if apiKeys != nil && !ok {
+		return nil, ErrAPIKeysNotErasable
+	}
+	attempts, ok := a.attempts.(loginattempt.Deleter)
+	if a.attempts != nil && !ok {
+		return nil, ErrLoginAttemptsNotErasable
+	}
+	auditStore := a.audit.Store()
+	if _, ok := auditStore.(audit.Pseudonymizer); auditStore != nil && !ok {
+		return nil, ErrAuditNotErasable
+	}
+
+	user, err := a.findUser(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &ErasureResult{Pseudonym: ErasedPseudonymPrefix + tenant.NewID()}
+	values := []string{user.Username, user.Email}
+	ids := []string{userID, a.audit.Pseudonym(userID)}
+
+	// Linked identities (the last one too, unlike UnlinkIdentity)
+	if a.userIdentities != nil {
+		identities, err := a.userIdentities.ListByUser(ctx, tenantID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list identities: %w", err)
+		}
+		for _, identity := range identities {
+			if err := a.userIdentities.Unlink(ctx, tenantID, userID, identity.Provider, identity.ProviderSubject); err != nil {
+				return nil, fmt.Errorf("failed to unlink identity: %w", err)
+			}
+			values = append(values, identity.Email, identity.ProviderSubject)
+			result.Identities++
+		}
+	}
+
+	// Revocation is best effort, as in SetUserStatus: the token manager may
+	// not support it, and the tokens of the deleted user expire
+	_ = a.revokeSubject(ctx, tenantID, userID)
+
+	if a.deviceStore != nil {
+		devices, err := a.deviceStore.ListDevices(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list devices: %w", err)
+		}
+		for _, dev := range devices {
+			if err := a.deviceStore.DeleteDevice(ctx, userID, dev.ID); err != nil {
+				return nil, fmt.Errorf("failed to delete device: %w", err)
+			}
+			result.Devices++
+		}
+	}
+
+	if keyLister != nil {
+		keys, err := keyLister.ListByUser(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list API keys: %w", err)
+		}
+		for _, key := range keys {
+			if err := apiKeys.Delete(ctx, key.ID); err != nil {
+				return nil, fmt.Errorf("failed to delete API key: %w", err)
+			}
+			result.APIKeys++
+		}
+	}
+
+	if consents := a.erasureConsents(); consents != nil {
+		list, err := consents.List(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list consents: %w", err)
+		}
+		for _, granted := range list {
+			if err := consents.Revoke(ctx, userID, granted.ClientID); err != nil {
+				return nil, fmt.Errorf("failed to revoke consent: %w", err)
+			}
+			result.Consents++
+		}
+	}
+
+	if attempts != nil {
+		queries := []*loginattempt.Query{{TenantID: tenantID, SubjectID: userID}, {TenantID: tenantID, Account: user.Username}}
+		if user.Email != "" {
+			queries = append(queries, &loginattempt.Query{TenantID: tenantID, Account: user.Email})
+		}
+		for _, query := range queries {
+			n, err := attempts.Delete(ctx, query)
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete login attempts: %w", err)
+			}
+			result.LoginAttempts += n
+		}
+	}
+
+	if config := a.config.Recovery; config != nil && config.Store != nil {
+		contacts, err := config.Store.ListContacts(ctx, tenantID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recovery contacts: %w", err)
+		}
+		for _, contact := range contacts {
+			values = append(values, contact.Address)
+		}
+		if result.RecoveryData, err = config.Store.DeleteUser(ctx, tenantID, userID); err != nil {
+			return nil, fmt.Errorf("failed to delete recovery data: %w", err)
+		}
+	}
+
+	if config := a.config.IdentityChange; config != nil && config.Store != nil {
+		changes, err := config.Store.ListChanges(ctx, tenantID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list identity changes: %w", err)
+		}
+		for _, change := range changes {
+			values = append(values, change.NewValue)
+		}
+		if result.IdentityChanges, err = config.Store.DeleteUser(ctx, tenantID, userID); err != nil {
+			return nil, fmt.Errorf("failed to delete identity changes: %w", err)
+		}
+	}
+
+	if err := tenant.AnonymizeUser(ctx, a.users, tenantID, userID); err != nil {
+		return nil, err
+	}
+
+	if auditStore != nil {
+		result.AuditEntries, err = a.audit.Pseudonymize(ctx, &audit.Pseudonymization{
+			TenantID:  tenantID,
+			IDs:       slices.Compact(ids),
+			Pseudonym: result.Pseudonym,
+			Values:    values,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to pseudonymize audit log: %w", err)
+		}
+	}
+
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventUserErased,
+		ActorID:   authz.ActorFromContext(ctx),
+		SubjectID: result.Pseudonym,
+		Resource:  "user:" + result.Pseudonym,
+		Action:    "erase",
+		Result:    audit.ResultSuccess,
+		Metadata: map[string]any{
+			"identities":       result.Identities,
+			"devices":          result.Devices,
+			"api_keys":         result.APIKeys,
+			"consents":         result.Consents,
+			"login_attempts":   result.LoginAttempts,
+			"recovery_data":    result.RecoveryData,
+			"identity_changes": result.IdentityChanges,
+			"audit_entries":    result.AuditEntries,
+		},
+	})
+	a.Publish(ctx, &events.Event{
+		Type:      events.UserErased,
+		SubjectID: result.Pseudonym,
+	})
+	return result, nil
+}
+
+// UserDataExport is the personal data the runtime holds about a user (right
+// to data portability), as a portable JSON document
+type UserDataExport struct {
+	ExportedAt    time.Time               `json:"exported_at"`
+	TenantID      string                  `json:"tenant_id"`
+	User          *tenant.User            `json:"user"`
+	Identities    []*ExportedIdentity     `json:"identities,omitempty"`
+	Sessions      []*ExportedSession      `json:"sessions,omitempty"`
+	Devices       []*ExportedDevice       `json:"devices,omitempty"`
+	APIKeys       []*ExportedAPIKey       `json:"api_keys,omitempty"`
+	Consents      []*consent.Consent      `json:"consents,omitempty"`
+	LoginAttempts []*loginattempt.Attempt `json:"login_attempts,omitempty"`
+	Recovery      *ExportedRecovery       `json:"recovery,omitempty"`
+
+	// IdentityChanges are the pending email and username changes
+	IdentityChanges []*identitychange.Change `json:"identity_changes,omitempty"`
+
+	AuditLog []*audit.AuditLog `json:"audit_log,omitempty"`
+}
+
+// ExportedIdentity is an identity linked to the user
+type ExportedIdentity struct {
+	Provider        string         `json:"provider"`
+	ProviderSubject string         `json:"provider_subject"`
+	Email           string         `json:"email,omitempty"`
+	EmailVerified   bool           `json:"email_verified"`
+	LinkedAt        time.Time      `json:"linked_at"`
+	Metadata        map[string]any `json:"metadata,omitempty"`
+}
+
+// ExportedSession is an active session of the user
+type ExportedSession struct {
+	ID             string    `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at,omitzero"`
+	LastActivityAt time.Time `json:"last_activity_at,omitzero"`
+	IPAddress      string    `json:"ip_address,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	Country        string    `json:"country,omitempty"`
+	City           string    `json:"city,omitempty"`
+}
+
+// ExportedDevice is a registered device of the user
+type ExportedDevice struct {
+	ID            string    `json:"id"`
+	Platform      string    `json:"platform,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Trusted       bool      `json:"trusted"`
+	FirstSeenAt   time.Time `json:"first_seen_at,omitzero"`
+	LastSeenAt    time.Time `json:"last_seen_at,omitzero"`
+	LastIPAddress string    `json:"last_ip_address,omitempty"`
+	LastUserAgent string    `json:"last_user_agent,omitempty"`
+}
+
+// ExportedAPIKey is an API key of the user, without its hash
+type ExportedAPIKey struct {
+	ID        string         `json:"id"`
+	Prefix    string         `json:"prefix"`
+	Name      string         `json:"name,omitempty"`
+	Scopes    []string       `json:"scopes,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+	LastUsed  *time.Time     `json:"last_used,omitempty"`
+	Revoked   bool           `json:"revoked"`
+}
+
+// ExportedRecovery is the recovery setup of the user, without the hashes of
+// its backup codes and tickets
+type ExportedRecovery struct {
+	BackupCodes []*recovery.BackupCode `json:"backup_codes,omitempty"`
+	Contacts    []*recovery.Contact    `json:"contacts,omitempty"`
+	Tickets     []*recovery.Ticket     `json:"tickets,omitempty"`
+}
+
+// ExportUserData collects the personal data held about a user of a tenant,
+// deleted or not: the user (without its password hash), linked identities,
+// active sessions, devices, API keys (without their hashes), consents,
+// login attempts, recovery setup, pending email and username changes and
+// the audit log entries it acted in or was the subject of. Stores that are not configured or cannot list by user are skipped.
+// The export is recorded in the audit log.
+func (a *Auth) ExportUserData(ctx context.Context, tenantID, userID string) (*UserDataExport, error) {
+	if a.users == nil {
+		return nil, ErrNoUserStore
+	}
+	if userID == "" {
+		return nil, ErrMissingSubject
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	user, err := a.findUser(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &UserDataExport{ExportedAt: time.Now().UTC(), TenantID: tenantID, User: user}
+
+	if a.userIdentities != nil {
+		identities, err := a.userIdentities.ListByUser(ctx, tenantID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list identities: %w", err)
+		}
+		for _, identity := range identities {
+			export.Identities = append(export.Identities, &ExportedIdentity{
+				Provider:        identity.Provider,
+				ProviderSubject: identity.ProviderSubject,
+				Email:           identity.Email,
+				EmailVerified:   identity.EmailVerified,
+				LinkedAt:        identity.LinkedAt,
+				Metadata:        identity.Metadata,
+			})
+		}
+	}
+
+	sessions, err := a.ListSessions(ctx, userID)
+	if err != nil && !errors.Is(err, ErrNoIdentityStore) && !errors.Is(err, ErrSessionsNotSupported) {
+		return nil, err
+	}
+	for _, session := range sessions {
+		exported := &ExportedSession{
+			ID:             session.ID,
+			CreatedAt:      unixTime(session.CreatedAt),
+			ExpiresAt:      unixTime(session.ExpiresAt),
+			LastActivityAt: unixTime(session.LastActivityAt),
+			IPAddress:      session.IPAddress,
+			UserAgent:      session.UserAgent,
+		}
+		if session.Location != nil {
+			exported.Country, exported.City = session.Location.CountryCode, session.Location.City
+		}
+		export.Sessions = append(export.Sessions, exported)
+	}
+
+	if a.deviceStore != nil {
+		devices, err := a.deviceStore.ListDevices(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list devices: %w", err)
+		}
+		for _, dev := range devices {
+			export.Devices = append(export.Devices, &ExportedDevice{
+				ID:            dev.ID,
+				Platform:      dev.Platform,
+				Name:          dev.Name,
+				Trusted:       dev.Trusted,
+				FirstSeenAt:   unixTime(dev.FirstSeenAt),
+				LastSeenAt:    unixTime(dev.LastSeenAt),
+				LastIPAddress: dev.LastIPAddress,
+				LastUserAgent: dev.LastUserAgent,
+			})
+		}
+	}
+
+	if lister, ok := a.erasureAPIKeyStore().(apikey.KeyLister); ok {
+		keys, err := lister.ListByUser(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list API keys: %w", err)
+		}
+		for _, key := range keys {
+			export.APIKeys = append(export.APIKeys, &ExportedAPIKey{
+				ID:        key.ID,
+				Prefix:    key.Prefix,
+				Name:      key.Name,
+				Scopes:    key.Scopes,
+				Metadata:  key.Metadata,
+				CreatedAt: key.CreatedAt,
+				ExpiresAt: key.ExpiresAt,
+				LastUsed:  key.LastUsed,
+				Revoked:   key.Revoked,
+			})
+		}
+	}
+
+	if consents := a.erasureConsents(); consents != nil {
+		if export.Consents, err = consents.List(ctx, userID); err != nil {
+			return nil, fmt.Errorf("failed to list consents: %w", err)
+		}
+	}
+
+	if a.attempts != nil {
+		seen := make(map[string]bool)
+		queries := []*loginattempt.Query{{TenantID: tenantID, SubjectID: userID}, {TenantID: tenantID, Account: user.Username}}
+		if user.Email != "" {
+			queries = append(queries, &loginattempt.Query{TenantID: tenantID, Account: user.Email})
+		}
+		for _, query := range queries {
+			attempts, err := a.attempts.List(ctx, query)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list login attempts: %w", err)
+			}
+			for _, attempt := range attempts {
+				if !seen[attempt.ID] {
+					seen[attempt.ID] = true
+					export.LoginAttempts = append(export.LoginAttempts, attempt)
+				}
+			}
+		}
+		slices.SortFunc(export.LoginAttempts, func(x, y *loginattempt.Attempt) int {
+			return y.Timestamp.Compare(x.Timestamp)
+		})
+	}
+
+	if config := a.config.Recovery; config != nil && config.Store != nil {
+		exported := &ExportedRecovery{}
+		if exported.BackupCodes, err = config.Store.ListBackupCodes(ctx, tenantID, userID); err != nil {
+			return nil, fmt.Errorf("failed to list backup codes: %w", err)
+		}
+		if exported.Contacts, err = config.Store.ListContacts(ctx, tenantID, userID); err != nil {
+			return nil, fmt.Errorf("failed to list recovery contacts: %w", err)
+		}
+		if exported.Tickets, err = config.Store.ListTickets(ctx, tenantID, userID); err != nil {
+			return nil, fmt.Errorf("failed to list recovery tickets: %w", err)
+		}
+		if len(exported.BackupCodes) > 0 || len(exported.Contacts) > 0 || len(exported.Tickets) > 0 {
+			export.Recovery = exported
+		}
+	}
+
+	if config := a.config.IdentityChange; config != nil && config.Store != nil {
+		if export.IdentityChanges, err = config.Store.ListChanges(ctx, tenantID, userID); err != nil {
+			return nil, fmt.Errorf("failed to list identity changes: %w", err)
+		}
+	}
+
+	if store := a.audit.Store(); store != nil {
+		entries, err := store.List(ctx, &audit.Filter{TenantID: tenantID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list audit log: %w", err)
+		}
+		ids := []string{userID, a.audit.Pseudonym(userID)}
+		for _, entry := range entries {
+			if slices.Contains(ids, entry.ActorID) || slices.Contains(ids, entry.SubjectID) {
+				export.AuditLog = append(export.AuditLog, entry)
+			}
+		}
+	}
+
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventUserDataExported,
+		ActorID:   authz.ActorFromContext(ctx),
+		SubjectID: userID,
+		Resource:  "user:" + userID,
+		Action:    "export",
+		Result:    audit.ResultSuccess,
+	})
+	return export, nil
+}
+
+// findUser returns a user of a tenant, deleted or not
+func (a *Auth) findUser(ctx context.Context, tenantID, userID string) (*tenant.User, error) {
+	user, err := a.users.GetUser(ctx, tenantID, userID)
+	if !errors.Is(err, tenant.ErrUserNotFound) {
+		return user, err
+	}
+
+	users, _, err := a.users.ListUsers(ctx, tenantID, tenant.ListOptions{Search: userID, IncludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", tenant.ErrUserNotFound, userID)
+}
+
+// erasureAPIKeyStore returns the API key store of the erasure configuration
+func (a *Auth) erasureAPIKeyStore() apikey.KeyStore {
+	if a.config.Erasure == nil {
+		return nil
+	}
+	return a.config.Erasure.APIKeys
+}
+
+// erasureConsents returns the consent store of the erasure configuration
+func (a *Auth) erasureConsents() consent.Store {
+	if a.config.Erasure == nil {
+		return nil
+	}
+	return a.config.Erasure.Consents
+}
+
+// unixTime converts Unix seconds to a UTC time (zero for 0)
+func unixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
@@ -0,0 +1,59 @@
+package lokstraauth
+
+import (
+	"context"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/events"
+)
+
+// SetEventBus sets the bus of auth lifecycle events: logins and token
+// revocations, plus the changes published by the admin APIs
+func (a *Auth) SetEventBus(bus *events.Bus) {
+	a.bus = bus
+}
+
+// Publish publishes an event on the event bus (no-op without one), e.g.
+// for application events. The tenant and app default to those of the
+// context.
+func (a *Auth) Publish(ctx context.Context, event *events.Event) {
+	if a.bus == nil {
+		return
+	}
+
+	if event.TenantID == "" {
+		event.TenantID = authz.TenantFromContext(ctx)
+	}
+	if event.AppID == "" {
+		event.AppID = authz.AppFromContext(ctx)
+	}
+	a.bus.Publish(ctx, event)
+}
+
+// publishLogin publishes the outcome of a login attempt
+func (a *Auth) publishLogin(ctx context.Context, request *LoginRequest, subjectID string, err error) {
+	if a.bus == nil {
+		return
+	}
+
+	event := &events.Event{
+		Type:      events.LoginSucceeded,
+		SubjectID: subjectID,
+		Data:      map[string]any{"authenticator": request.Credentials.Type()},
+	}
+	if err != nil {
+		event.Type = events.LoginFailed
+		event.Data["code"] = string(autherrors.CodeOf(err))
+	}
+	a.Publish(ctx, event)
+}
+
+// publishRevoked publishes a token revocation
+func (a *Auth) publishRevoked(ctx context.Context, subjectID, reason string) {
+	a.Publish(ctx, &events.Event{
+		Type:      events.TokenRevoked,
+		SubjectID: subjectID,
+		Data:      map[string]any{"reason": reason},
+	})
+}
@@ -0,0 +1,175 @@
+// Package events publishes auth lifecycle events (users created, changing
+// status, email, username or profile, recovered or erased, logins, token
+// revocations, role assignments, policy changes) to in-process subscribers
+// and, through a WebhookDispatcher, to HTTP endpoints of downstream
+// systems.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Type identifies an auth lifecycle event
+type Type string
+
+const (
+	// UserCreated: a user was created
+	UserCreated Type = "user.created"
+
+	// UserStatusChanged: a user was activated, suspended or deactivated
+	UserStatusChanged Type = "user.status_changed"
+
+	// UserErased: the personal data of a user was erased (SubjectID is the
+	// pseudonym of the user)
+	UserErased Type = "user.erased"
+
+	// UserRecoveryInitiated: an admin initiated the recovery of the account
+	// of a user (with the actor and when the ticket can be redeemed)
+	UserRecoveryInitiated Type = "user.recovery_initiated"
+
+	// UserRecovered: a user who lost their sign-in factor recovered the
+	// account (with the recovery method)
+	UserRecovered Type = "user.recovered"
+
+	// UserIdentityChanged: the email address or username of a user changed
+	// after the user confirmed it (with the field, old and new values)
+	UserIdentityChanged Type = "user.identity_changed"
+
+	// UserProfileUpdated: the profile attributes of a user changed (with
+	// the updated fields)
+	UserProfileUpdated Type = "user.profile_updated"
+
+	// LoginSucceeded: a subject logged in
+	LoginSucceeded Type = "login.succeeded"
+
+	// LoginFailed: a login attempt failed
+	LoginFailed Type = "login.failed"
+
+	// TokenRevoked: a token, session or remembered device was revoked
+	TokenRevoked Type = "token.revoked"
+
+	// RoleAssigned: a role was assigned to a subject
+	RoleAssigned Type = "role.assigned"
+
+	// PolicyChanged: a policy was created, updated or deleted
+	PolicyChanged Type = "policy.changed"
+)
+
+// Event is an auth lifecycle event
+type Event struct {
+	// ID identifies the event; receivers use it to drop duplicate
+	// deliveries (default: random)
+	ID string `json:"id"`
+
+	// Type is the event type
+	Type Type `json:"type"`
+
+	// TenantID and AppID are the tenant and app the event occurred in
+	TenantID string `json:"tenant_id"`
+	AppID    string `json:"app_id,omitempty"`
+
+	// SubjectID is the subject the event is about (if any)
+	SubjectID string `json:"subject_id,omitempty"`
+
+	// Timestamp is when the event occurred (default: now)
+	Timestamp time.Time `json:"timestamp"`
+
+	// Data contains event-specific fields, e.g. the role of RoleAssigned
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// Subscriber receives published events
+type Subscriber interface {
+	// OnEvent is called for every event the subscriber subscribed to.
+	// Subscribers must not modify the event.
+	OnEvent(ctx context.Context, event *Event)
+}
+
+// SubscriberFunc adapts a function to a Subscriber
+type SubscriberFunc func(ctx context.Context, event *Event)
+
+// OnEvent calls f(ctx, event)
+func (f SubscriberFunc) OnEvent(ctx context.Context, event *Event) {
+	f(ctx, event)
+}
+
+// Bus delivers events to in-process subscribers. Subscribers run
+// synchronously in Publish, so they should hand slow work off (the
+// WebhookDispatcher only enqueues deliveries). A nil *Bus is valid and drops
+// every event.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions map[int]subscription
+	nextID        int
+}
+
+type subscription struct {
+	subscriber Subscriber
+	types      []Type
+}
+
+// NewBus creates an event bus
+func NewBus() *Bus {
+	return &Bus{
+		subscriptions: make(map[int]subscription),
+	}
+}
+
+// Subscribe registers a subscriber for events of the given types (every
+// event when none are given) and returns a function that removes it
+func (b *Bus) Subscribe(subscriber Subscriber, types ...Type) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subscriptions[id] = subscription{subscriber: subscriber, types: types}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscriptions, id)
+	}
+}
+
+// Publish delivers an event to its subscribers, isolating subscriber panics
+func (b *Bus) Publish(ctx context.Context, event *Event) {
+	if b == nil {
+		return
+	}
+
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	subscribers := make([]Subscriber, 0, len(b.subscriptions))
+	for _, sub := range b.subscriptions {
+		if len(sub.types) == 0 || slices.Contains(sub.types, event.Type) {
+			subscribers = append(subscribers, sub.subscriber)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		func() {
+			defer func() { _ = recover() }()
+			subscriber.OnEvent(ctx, event)
+		}()
+	}
+}
+
+// newID returns a random ID
+func newID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
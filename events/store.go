@@ -0,0 +1,254 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrEndpointNotFound = errors.New("webhook endpoint not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// Endpoint is a webhook endpoint of a tenant
+type Endpoint struct {
+	// ID identifies the endpoint (default: random)
+	ID string `json:"id"`
+
+	// TenantID is the tenant whose events are delivered
+	TenantID string `json:"tenant_id"`
+
+	// URL receives the events as JSON POST requests
+	URL string `json:"url"`
+
+	// Secret signs the deliveries (see Sign)
+	Secret string `json:"-"`
+
+	// EventTypes selects the delivered events (every event when empty)
+	EventTypes []Type `json:"event_types,omitempty"`
+
+	// Disabled stops deliveries to the endpoint
+	Disabled bool `json:"disabled"`
+}
+
+// Accepts reports whether events of a type are delivered to the endpoint
+func (e *Endpoint) Accepts(eventType Type) bool {
+	return !e.Disabled && (len(e.EventTypes) == 0 || slices.Contains(e.EventTypes, eventType))
+}
+
+// EndpointStore stores webhook endpoints
+type EndpointStore interface {
+	// ListEndpoints returns the endpoints of a tenant
+	ListEndpoints(ctx context.Context, tenantID string) ([]*Endpoint, error)
+
+	// GetEndpoint returns an endpoint (ErrEndpointNotFound if missing)
+	GetEndpoint(ctx context.Context, id string) (*Endpoint, error)
+}
+
+// DeliveryStatus is the state of a webhook delivery
+type DeliveryStatus string
+
+const (
+	// DeliveryPending: the delivery is waiting for its next attempt
+	DeliveryPending DeliveryStatus = "pending"
+
+	// DeliverySucceeded: the endpoint accepted the event (2xx)
+	DeliverySucceeded DeliveryStatus = "succeeded"
+
+	// DeliveryDead: every attempt failed; the delivery is dead-lettered
+	// until it is redelivered
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// Delivery is the delivery of an event to an endpoint
+type Delivery struct {
+	ID            string         `json:"id"`
+	EndpointID    string         `json:"endpoint_id"`
+	Event         *Event         `json:"event"`
+	Status        DeliveryStatus `json:"status"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	LastError     string         `json:"last_error,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// DeliveryStore persists webhook deliveries. Deliveries stay pending until
+// they succeed or are dead-lettered, so events survive restarts and are
+// delivered at least once.
+type DeliveryStore interface {
+	// Enqueue stores new pending deliveries
+	Enqueue(ctx context.Context, deliveries ...*Delivery) error
+
+	// Claim returns up to limit pending deliveries due at now and postpones
+	// their next attempt by lease, so concurrent dispatchers do not send
+	// them twice and deliveries of a crashed dispatcher become due again
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error)
+
+	// Update stores the outcome of an attempt
+	Update(ctx context.Context, delivery *Delivery) error
+
+	// GetDelivery returns a delivery (ErrDeliveryNotFound if missing)
+	GetDelivery(ctx context.Context, id string) (*Delivery, error)
+
+	// DeadLetters returns the dead-lettered deliveries of a tenant
+	DeadLetters(ctx context.Context, tenantID string) ([]*Delivery, error)
+}
+
+// InMemoryStore is an in-memory EndpointStore and DeliveryStore
+type InMemoryStore struct {
+	mu         sync.Mutex
+	endpoints  map[string]*Endpoint
+	deliveries map[string]*Delivery
+}
+
+var (
+	_ EndpointStore = (*InMemoryStore)(nil)
+	_ DeliveryStore = (*InMemoryStore)(nil)
+)
+
+// NewInMemoryStore creates an in-memory webhook store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		endpoints:  make(map[string]*Endpoint),
+		deliveries: make(map[string]*Delivery),
+	}
+}
+
+// SaveEndpoint creates or replaces an endpoint
+func (s *InMemoryStore) SaveEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	if endpoint.ID == "" {
+		endpoint.ID = newID()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *endpoint
+	stored.EventTypes = slices.Clone(endpoint.EventTypes)
+	s.endpoints[endpoint.ID] = &stored
+	return nil
+}
+
+// DeleteEndpoint removes an endpoint
+func (s *InMemoryStore) DeleteEndpoint(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[id]; !ok {
+		return ErrEndpointNotFound
+	}
+	delete(s.endpoints, id)
+	return nil
+}
+
+// ListEndpoints returns the endpoints of a tenant
+func (s *InMemoryStore) ListEndpoints(ctx context.Context, tenantID string) ([]*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var endpoints []*Endpoint
+	for _, endpoint := range s.endpoints {
+		if endpoint.TenantID == tenantID {
+			copied := *endpoint
+			endpoints = append(endpoints, &copied)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].ID < endpoints[j].ID })
+	return endpoints, nil
+}
+
+// GetEndpoint returns an endpoint
+func (s *InMemoryStore) GetEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint, ok := s.endpoints[id]
+	if !ok {
+		return nil, ErrEndpointNotFound
+	}
+	copied := *endpoint
+	return &copied, nil
+}
+
+// Enqueue stores new pending deliveries
+func (s *InMemoryStore) Enqueue(ctx context.Context, deliveries ...*Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, delivery := range deliveries {
+		copied := *delivery
+		s.deliveries[delivery.ID] = &copied
+	}
+	return nil
+}
+
+// Claim returns pending deliveries due at now, oldest first
+func (s *InMemoryStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*Delivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*Delivery, len(due))
+	for i, delivery := range due {
+		delivery.NextAttemptAt = now.Add(lease)
+		copied := *delivery
+		claimed[i] = &copied
+	}
+	return claimed, nil
+}
+
+// Update stores the outcome of an attempt. Succeeded deliveries are not
+// kept.
+func (s *InMemoryStore) Update(ctx context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deliveries[delivery.ID]; !ok {
+		return ErrDeliveryNotFound
+	}
+	if delivery.Status == DeliverySucceeded {
+		delete(s.deliveries, delivery.ID)
+		return nil
+	}
+	copied := *delivery
+	s.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+// GetDelivery returns a delivery
+func (s *InMemoryStore) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, ErrDeliveryNotFound
+	}
+	copied := *delivery
+	return &copied, nil
+}
+
+// DeadLetters returns the dead-lettered deliveries of a tenant, oldest first
+func (s *InMemoryStore) DeadLetters(ctx context.Context, tenantID string) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var dead []*Delivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == DeliveryDead && delivery.Event.TenantID == tenantID {
+			copied := *delivery
+			dead = append(dead, &copied)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool { return dead[i].CreatedAt.Before(dead[j].CreatedAt) })
+	return dead, nil
+}
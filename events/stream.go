@@ -0,0 +1,226 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidStreamConfig = errors.New("invalid event stream config")
+)
+
+// Schema of streamed event payloads. The version changes when fields are
+// removed or change meaning; new fields are added without a version change.
+const (
+	SchemaName    = "lokstra.auth.event"
+	SchemaVersion = 1
+)
+
+// Envelope is the payload of a streamed event
+type Envelope struct {
+	Schema  string `json:"schema"`
+	Version int    `json:"version"`
+	*Event
+}
+
+// Message is an event message for a broker topic (Kafka) or subject (NATS)
+type Message struct {
+	// Topic is the Kafka topic or NATS subject
+	Topic string
+
+	// Key keeps the events of a subject in order (Kafka partition key)
+	Key string
+
+	// ID is the event ID, for broker-side deduplication (e.g. the
+	// Nats-Msg-Id header of JetStream)
+	ID string
+
+	// Value is the JSON Envelope
+	Value []byte
+
+	// Headers are content-type, event-type and schema-version
+	Headers map[string]string
+}
+
+// Producer sends messages to a broker. Adapt the Kafka or NATS client of
+// the application (see README).
+type Producer interface {
+	Produce(ctx context.Context, message *Message) error
+}
+
+// ProducerFunc adapts a function to a Producer
+type ProducerFunc func(ctx context.Context, message *Message) error
+
+// Produce calls f(ctx, message)
+func (f ProducerFunc) Produce(ctx context.Context, message *Message) error {
+	return f(ctx, message)
+}
+
+// StreamConfig holds stream publisher configuration
+type StreamConfig struct {
+	// Producer sends the messages (required)
+	Producer Producer
+
+	// Topics maps event categories (the event type up to the first dot:
+	// "user", "login", "token", "role", "policy") to topics
+	Topics map[string]string
+
+	// DefaultTopic receives the events of unmapped categories
+	// (default: "lokstra.auth.events")
+	DefaultTopic string
+
+	// Key returns the message key of an event
+	// (default: "<tenant>/<subject>", or the tenant without a subject)
+	Key func(event *Event) string
+
+	// BufferSize is the size of the send queue (default: 1024)
+	BufferSize int
+
+	// OnError is called when an event cannot be encoded or sent (optional)
+	OnError func(event *Event, err error)
+}
+
+// StreamPublisher is a Subscriber that streams events to Kafka, NATS
+// JetStream or another broker as schema-versioned JSON. Events are queued
+// and sent by a background goroutine, so a slow broker does not slow down
+// logins; when the queue is full, events are dropped and counted.
+type StreamPublisher struct {
+	config *StreamConfig
+
+	mu      sync.RWMutex
+	queue   chan queuedMessage
+	done    chan struct{}
+	closed  bool
+	dropped uint64
+}
+
+type queuedMessage struct {
+	ctx   context.Context
+	event *Event
+}
+
+var _ Subscriber = (*StreamPublisher)(nil)
+
+// NewStreamPublisher creates a stream publisher. Subscribe it to a Bus;
+// Close it on shutdown to send queued events.
+func NewStreamPublisher(config *StreamConfig) (*StreamPublisher, error) {
+	if config == nil || config.Producer == nil {
+		return nil, fmt.Errorf("%w: producer is required", ErrInvalidStreamConfig)
+	}
+	if config.DefaultTopic == "" {
+		config.DefaultTopic = "lokstra.auth.events"
+	}
+	if config.Key == nil {
+		config.Key = defaultKey
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1024
+	}
+
+	p := &StreamPublisher{
+		config: config,
+		queue:  make(chan queuedMessage, config.BufferSize),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Category returns the category of an event type: the type up to the first
+// dot ("login" for "login.failed")
+func Category(eventType Type) string {
+	category, _, _ := strings.Cut(string(eventType), ".")
+	return category
+}
+
+// Topic returns the topic of an event type
+func (p *StreamPublisher) Topic(eventType Type) string {
+	if topic, ok := p.config.Topics[Category(eventType)]; ok {
+		return topic
+	}
+	return p.config.DefaultTopic
+}
+
+// OnEvent queues an event for sending
+func (p *StreamPublisher) OnEvent(ctx context.Context, event *Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		p.dropped++
+		return
+	}
+
+	// Detach from request cancellation; the event outlives the call
+	select {
+	case p.queue <- queuedMessage{ctx: context.WithoutCancel(ctx), event: event}:
+	default:
+		p.dropped++
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full
+// or the publisher closed
+func (p *StreamPublisher) Dropped() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.dropped
+}
+
+// Close stops the publisher after sending queued events
+func (p *StreamPublisher) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	<-p.done
+}
+
+// run sends queued events
+func (p *StreamPublisher) run() {
+	defer close(p.done)
+
+	for item := range p.queue {
+		if err := p.send(item.ctx, item.event); err != nil && p.config.OnError != nil {
+			p.config.OnError(item.event, err)
+		}
+	}
+}
+
+// send encodes and produces an event
+func (p *StreamPublisher) send(ctx context.Context, event *Event) error {
+	value, err := json.Marshal(&Envelope{Schema: SchemaName, Version: SchemaVersion, Event: event})
+	if err != nil {
+		return err
+	}
+
+	return p.config.Producer.Produce(ctx, &Message{
+		Topic: p.Topic(event.Type),
+		Key:   p.config.Key(event),
+		ID:    event.ID,
+		Value: value,
+		Headers: map[string]string{
+			"content-type":   "application/json",
+			"event-type":     string(event.Type),
+			"schema-version": strconv.Itoa(SchemaVersion),
+		},
+	})
+}
+
+// defaultKey keys events by tenant and subject
+func defaultKey(event *Event) string {
+	if event.SubjectID == "" {
+		return event.TenantID
+	}
+	return event.TenantID + "/" + event.SubjectID
+}
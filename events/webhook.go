@@ -0,0 +1,339 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidWebhookConfig = errors.New("invalid webhook config")
+	ErrInvalidSignature     = errors.New("invalid webhook signature")
+	ErrNotDeadLettered      = errors.New("webhook delivery is not dead-lettered")
+)
+
+// Headers of webhook requests
+const (
+	HeaderEvent     = "X-Lokstra-Event"
+	HeaderDelivery  = "X-Lokstra-Delivery"
+	HeaderSignature = "X-Lokstra-Signature"
+)
+
+// WebhookConfig holds webhook dispatcher configuration
+type WebhookConfig struct {
+	// Endpoints are the webhook endpoints of the tenants (required)
+	Endpoints EndpointStore
+
+	// Deliveries persists pending deliveries (required)
+	Deliveries DeliveryStore
+
+	// HTTPClient sends the requests (default: 10 second timeout)
+	HTTPClient *http.Client
+
+	// MaxAttempts dead-letters a delivery after this many failed attempts
+	// (default: 10)
+	MaxAttempts int
+
+	// Backoff returns the delay after a failed attempt (1-based)
+	// (default: 10s doubling per attempt, at most 6 hours)
+	Backoff func(attempt int) time.Duration
+
+	// PollInterval is how often Run sends due deliveries (default: 5 seconds)
+	PollInterval time.Duration
+
+	// BatchSize is the number of deliveries claimed per poll (default: 100)
+	BatchSize int
+
+	// Lease is how long a claimed delivery is reserved for an attempt
+	// (default: 1 minute)
+	Lease time.Duration
+
+	// OnDeadLetter is called when a delivery is dead-lettered (optional)
+	OnDeadLetter func(delivery *Delivery)
+
+	// OnError is called when deliveries cannot be enqueued or updated
+	// (optional)
+	OnError func(err error)
+
+	// Now returns the current time (default: time.Now)
+	Now func() time.Time
+}
+
+// WebhookDispatcher delivers events to the webhook endpoints of their
+// tenant. As a Subscriber it only stores a pending delivery per endpoint;
+// Run sends due deliveries as signed JSON POST requests and retries failed
+// ones with backoff until they succeed or are dead-lettered. Deliveries are
+// at least once: receivers drop duplicates by the X-Lokstra-Delivery header.
+type WebhookDispatcher struct {
+	config *WebhookConfig
+}
+
+var _ Subscriber = (*WebhookDispatcher)(nil)
+
+// NewWebhookDispatcher creates a webhook dispatcher. Subscribe it to a Bus
+// and call Run to start delivering.
+func NewWebhookDispatcher(config *WebhookConfig) (*WebhookDispatcher, error) {
+	if config == nil || config.Endpoints == nil || config.Deliveries == nil {
+		return nil, fmt.Errorf("%w: endpoint and delivery stores are required", ErrInvalidWebhookConfig)
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	if config.Backoff == nil {
+		config.Backoff = DefaultBackoff
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.Lease <= 0 {
+		config.Lease = time.Minute
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &WebhookDispatcher{config: config}, nil
+}
+
+// DefaultBackoff waits 10 seconds after the first failed attempt and doubles
+// the delay per attempt, up to 6 hours
+func DefaultBackoff(attempt int) time.Duration {
+	delay := 10 * time.Second
+	for range attempt - 1 {
+		delay *= 2
+		if delay >= 6*time.Hour {
+			return 6 * time.Hour
+		}
+	}
+	return delay
+}
+
+// OnEvent enqueues a delivery of the event to every endpoint of its tenant
+// that accepts it
+func (d *WebhookDispatcher) OnEvent(ctx context.Context, event *Event) {
+	endpoints, err := d.config.Endpoints.ListEndpoints(ctx, event.TenantID)
+	if err != nil {
+		d.fail(fmt.Errorf("list webhook endpoints: %w", err))
+		return
+	}
+
+	now := d.config.Now()
+	var deliveries []*Delivery
+	for _, endpoint := range endpoints {
+		if !endpoint.Accepts(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &Delivery{
+			ID:            newID(),
+			EndpointID:    endpoint.ID,
+			Event:         event,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := d.config.Deliveries.Enqueue(context.WithoutCancel(ctx), deliveries...); err != nil {
+		d.fail(fmt.Errorf("enqueue webhook deliveries: %w", err))
+	}
+}
+
+// Run sends due deliveries now and then every poll interval until the
+// context is done
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			sent, err := d.DeliverDue(ctx)
+			if err != nil {
+				d.fail(err)
+			}
+			// Keep going while full batches are due
+			if err != nil || sent < d.config.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends a batch of due deliveries and returns how many were
+// attempted
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := d.config.Deliveries.Claim(ctx, d.config.Now(), d.config.Lease, d.config.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("claim webhook deliveries: %w", err)
+	}
+
+	for i, delivery := range deliveries {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		d.attempt(ctx, delivery)
+	}
+	return len(deliveries), nil
+}
+
+// Redeliver moves a dead-lettered delivery back to the queue
+func (d *WebhookDispatcher) Redeliver(ctx context.Context, deliveryID string) error {
+	delivery, err := d.config.Deliveries.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery.Status != DeliveryDead {
+		return ErrNotDeadLettered
+	}
+
+	now := d.config.Now()
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	delivery.UpdatedAt = now
+	return d.config.Deliveries.Update(ctx, delivery)
+}
+
+// attempt sends a delivery and stores the outcome
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	endpoint, err := d.config.Endpoints.GetEndpoint(ctx, delivery.EndpointID)
+	switch {
+	case errors.Is(err, ErrEndpointNotFound):
+		// The endpoint was removed; there is nothing left to retry
+		delivery.Attempts = d.config.MaxAttempts
+	case err != nil:
+		d.fail(fmt.Errorf("get webhook endpoint: %w", err))
+		return
+	case endpoint.Disabled:
+		err = errors.New("endpoint disabled")
+		delivery.Attempts = d.config.MaxAttempts
+	default:
+		err = d.send(ctx, endpoint, delivery)
+		delivery.Attempts++
+	}
+
+	now := d.config.Now()
+	delivery.UpdatedAt = now
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySucceeded
+		delivery.LastError = ""
+	case delivery.Attempts >= d.config.MaxAttempts:
+		delivery.Status = DeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(d.config.Backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	if err := d.config.Deliveries.Update(ctx, delivery); err != nil {
+		d.fail(fmt.Errorf("update webhook delivery: %w", err))
+		return
+	}
+	if delivery.Status == DeliveryDead && d.config.OnDeadLetter != nil {
+		d.config.OnDeadLetter(delivery)
+	}
+}
+
+// send posts the event to the endpoint; non-2xx responses are failures
+func (d *WebhookDispatcher) send(ctx context.Context, endpoint *Endpoint, delivery *Delivery) error {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(delivery.Event.Type))
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, d.config.Now(), body))
+
+	resp, err := d.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// fail reports an error to OnError
+func (d *WebhookDispatcher) fail(err error) {
+	if d.config.OnError != nil {
+		d.config.OnError(err)
+	}
+}
+
+// Sign returns the X-Lokstra-Signature header of a request body:
+// "t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">"
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + signature(secret, unix, body)
+}
+
+// VerifySignature checks the X-Lokstra-Signature header of a received
+// webhook. Signatures older than tolerance are rejected to prevent replays
+// (no limit when tolerance is 0).
+func VerifySignature(secret, header string, body []byte, tolerance time.Duration) error {
+	var unix, mac string
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			mac = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || mac == "" {
+		return fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(mac), []byte(signature(secret, unix, body))) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(seconds, 0)) > tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// signature returns the hex HMAC-SHA256 of "<unix>.<body>"
+func signature(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
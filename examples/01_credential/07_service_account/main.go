@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	"github.com/primadi/lokstra-auth/01_credential/serviceaccount"
+	"github.com/primadi/lokstra-auth/handlers"
+)
+
+func main() {
+	fmt.Println("=== Service Account Key File Example ===")
+	fmt.Println()
+
+	ctx := context.Background()
+
+	// Auth server: /auth/token accepts private_key_jwt client assertions
+	dev := lokstraauth.NewDevRuntime()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tokenURI := server.URL + "/auth/token"
+	accounts := serviceaccount.NewAuthenticator(&serviceaccount.Config{
+		Audience: []string{tokenURI},
+	})
+	handlers.New(&handlers.Config{
+		Auth:            dev.Auth,
+		ServiceAccounts: accounts,
+	}).Register(mux)
+
+	// 1. Admin registers a service account key and hands out the key file
+	fmt.Println("1️⃣  Registering service account key...")
+	keyFile, key, err := accounts.RegisterKey(ctx, "billing-cron", tokenURI, []string{"read:invoices"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keyPath := filepath.Join(os.TempDir(), "billing-cron.json")
+	if err := keyFile.Save(keyPath); err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(keyPath)
+
+	fmt.Printf("✅ Key %s registered for %s\n", key.KeyID, key.ClientID)
+	fmt.Printf("   Key file: %s\n", keyPath)
+	fmt.Println()
+
+	// 2. The CLI / cron job loads the key file and gets an access token
+	fmt.Println("2️⃣  Exchanging key file for an access token (private_key_jwt)...")
+	loaded, err := serviceaccount.LoadKeyFile(keyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source := serviceaccount.NewTokenSource(loaded, nil)
+	tok, err := source.Token(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("✅ Access token issued (%s, expires in %ds)\n", tok.TokenType, tok.ExpiresIn)
+	fmt.Printf("   Token: %s...\n", tok.AccessToken[:24])
+	fmt.Println()
+
+	// 3. Authenticated HTTP client: tokens are attached and renewed automatically
+	fmt.Println("3️⃣  Calling an API with the authenticated client...")
+	resp, err := source.Client().Get(server.URL + "/auth/me")
+	if err != nil {
+		log.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	fmt.Printf("✅ GET /auth/me → %s\n", resp.Status)
+	fmt.Printf("   %s\n", body)
+	fmt.Println()
+
+	// 4. Replayed assertions and revoked keys are rejected
+	fmt.Println("4️⃣  Replay and revocation...")
+	assertion, _ := loaded.Assertion(tokenURI, 0)
+	for i := 1; i <= 2; i++ {
+		result, _ := accounts.Authenticate(ctx, &serviceaccount.Credentials{Assertion: assertion})
+		fmt.Printf("   Attempt %d with the same assertion: success=%v %v\n", i, result.Success, result.Error)
+	}
+
+	if err := accounts.KeyStore().Revoke(ctx, key.ClientID, key.KeyID); err != nil {
+		log.Fatal(err)
+	}
+	assertion, _ = loaded.Assertion(tokenURI, 0)
+	result, _ := accounts.Authenticate(ctx, &serviceaccount.Credentials{Assertion: assertion})
+	fmt.Printf("   After revocation: success=%v %v\n", result.Success, result.Error)
+}
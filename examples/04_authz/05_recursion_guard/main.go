@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+)
+
+// RoleStore is an admin store guarded by authorization: reading the members
+// of a role requires "read" on the role.
+type RoleStore struct {
+	authorizer authz.Authorizer
+	members    map[string][]string
+}
+
+func (s *RoleStore) Members(ctx context.Context, caller *subject.IdentityContext, role string) ([]string, error) {
+	decision, err := s.authorizer.Evaluate(ctx, &authz.AuthorizationRequest{
+		Subject:  caller,
+		Resource: &authz.Resource{Type: "role", ID: role},
+		Action:   authz.ActionRead,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !decision.Allowed {
+		return nil, errors.New("forbidden")
+	}
+	return s.members[role], nil
+}
+
+// MembershipEvaluator allows access to documents for members of the
+// "editors" role, which it reads from the guarded RoleStore
+type MembershipEvaluator struct {
+	*rbac.Evaluator
+	store        *RoleStore
+	systemLookup bool
+}
+
+func (e *MembershipEvaluator) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
+	if request.Resource.Type == "role" {
+		return e.Evaluator.Evaluate(ctx, request)
+	}
+
+	lookupCtx := ctx
+	if e.systemLookup {
+		// Internal read: the caller's access was not asked for
+		lookupCtx = authz.WithSystemContext(ctx, "membership lookup")
+	}
+
+	members, err := e.store.Members(lookupCtx, request.Subject, "editors")
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if member == request.Subject.Subject.ID {
+			return &authz.AuthorizationDecision{Allowed: true, Reason: "member of editors"}, nil
+		}
+	}
+	return &authz.AuthorizationDecision{Allowed: false, Reason: "not a member of editors"}, nil
+}
+
+func main() {
+	fmt.Printf("=== Authorization Recursion Guard Example ===\n\n")
+
+	alice := &subject.IdentityContext{
+		Subject: &subject.Subject{ID: "alice", Type: "user"},
+		Roles:   []string{"viewer"},
+	}
+	request := &authz.AuthorizationRequest{
+		Subject:  alice,
+		Resource: &authz.Resource{Type: "document", ID: "doc-1"},
+		Action:   authz.ActionWrite,
+	}
+
+	store := &RoleStore{members: map[string][]string{"editors": {"alice"}}}
+	evaluator := &MembershipEvaluator{
+		Evaluator: rbac.NewEvaluator(map[string][]string{"admin": {"role:read"}}),
+		store:     store,
+	}
+	guarded := authz.NewGuardedAuthorizer(evaluator, 0)
+	store.authorizer = guarded
+
+	// 1. The store authorizes with the caller's identity; alice cannot read
+	// roles, so the lookup is denied
+	decision, err := guarded.Evaluate(context.Background(), request)
+	fmt.Printf("1. caller-authorized lookup: decision=%v err=%v\n", allowed(decision), err)
+
+	// 2. The lookup runs in a system context: the store's authorization is
+	// skipped and the decision is made from the membership data
+	evaluator.systemLookup = true
+	decision, err = guarded.Evaluate(context.Background(), request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("2. system-context lookup:   decision=%v (%s)\n", allowed(decision), decision.Reason)
+
+	// 3. A check that calls itself is stopped instead of recursing forever
+	loop := &loopingAuthorizer{Evaluator: rbac.NewEvaluator(nil)}
+	loop.guarded = authz.NewGuardedAuthorizer(loop, 0)
+	_, err = loop.guarded.Evaluate(context.Background(), request)
+	fmt.Printf("3. self-recursive check:    reentrant=%v (%v)\n", errors.Is(err, authz.ErrReentrantAuthorization), err)
+
+	// 4. Distinct nested checks are limited to MaxDepth
+	chain := &chainAuthorizer{Evaluator: rbac.NewEvaluator(nil)}
+	chain.guarded = authz.NewGuardedAuthorizer(chain, 3)
+	_, err = chain.guarded.Evaluate(context.Background(), request)
+	fmt.Printf("4. nested chain:            depth exceeded=%v (%v)\n", errors.Is(err, authz.ErrRecursionDepthExceeded), err)
+}
+
+// loopingAuthorizer re-evaluates the same request
+type loopingAuthorizer struct {
+	*rbac.Evaluator
+	guarded authz.Authorizer
+}
+
+func (l *loopingAuthorizer) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
+	return l.guarded.Evaluate(ctx, request)
+}
+
+// chainAuthorizer evaluates a request for the parent of each resource
+type chainAuthorizer struct {
+	*rbac.Evaluator
+	guarded authz.Authorizer
+}
+
+func (c *chainAuthorizer) Evaluate(ctx context.Context, request *authz.AuthorizationRequest) (*authz.AuthorizationDecision, error) {
+	parent := *request
+	parent.Resource = &authz.Resource{Type: "folder", ID: fmt.Sprintf("level-%d", authz.DepthFromContext(ctx))}
+	return c.guarded.Evaluate(ctx, &parent)
+}
+
+func allowed(decision *authz.AuthorizationDecision) any {
+	if decision == nil {
+		return "none"
+	}
+	return decision.Allowed
+}
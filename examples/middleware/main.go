@@ -10,6 +10,7 @@ import (
 	"github.com/primadi/lokstra-auth/02_token/jwt"
 	"github.com/primadi/lokstra-auth/03_subject/simple"
 	"github.com/primadi/lokstra-auth/04_authz/rbac"
+	"github.com/primadi/lokstra-auth/handlers"
 	"github.com/primadi/lokstra-auth/middleware"
 	"github.com/primadi/lokstra/core/request"
 )
@@ -72,46 +73,9 @@ func main() {
 
 	// ========== Routes: Public (No Authentication) ==========
 
-	type loginRequest struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-
-	type userInfo struct {
-		ID    string   `json:"id"`
-		Email string   `json:"email"`
-		Roles []string `json:"roles"`
-	}
-
-	type loginResponse struct {
-		AccessToken  string   `json:"access_token"`
-		RefreshToken string   `json:"refresh_token"`
-		User         userInfo `json:"user"`
-	}
-
-	// Login endpoint
-	r.POST("/login", func(c *request.Context, r *loginRequest) error {
-		// Authenticate
-		loginResp, err := auth.Login(c, &lokstraauth.LoginRequest{
-			Credentials: &basic.BasicCredentials{
-				Username: r.Username,
-				Password: r.Password,
-			},
-		})
-		if err != nil {
-			return c.Api.Unauthorized(err.Error())
-		}
-
-		return c.Api.Ok(&loginResponse{
-			AccessToken:  loginResp.AccessToken.Value,
-			RefreshToken: loginResp.RefreshToken.Value,
-			User: userInfo{
-				ID:    loginResp.Identity.Subject.ID,
-				Email: loginResp.Identity.Subject.Principal,
-				Roles: loginResp.Identity.Roles,
-			},
-		})
-	})
+	// Login, refresh, logout, me and sessions endpoints under /auth
+	authHandlers := handlers.New(&handlers.Config{Auth: auth})
+	r.ANYPrefix(authHandlers.Prefix(), authHandlers.Handler())
 
 	// ========== Setup Middlewares ==========
 	authMiddleware := middleware.NewAuthMiddleware(middleware.AuthMiddlewareConfig{
@@ -254,8 +218,8 @@ func main() {
 	fmt.Println("✓ Server starting on http://localhost:3000")
 	fmt.Println()
 	fmt.Println("Test endpoints:")
-	fmt.Println("1. POST /login - Login with username/password")
-	fmt.Println("   {\"username\": \"admin\", \"password\": \"admin123\"}")
+	fmt.Println("1. POST /auth/login - Login with username/password")
+	fmt.Println("   {\"type\": \"basic\", \"username\": \"admin\", \"password\": \"admin123\"}")
 	fmt.Println()
 	fmt.Println("2. GET /profile - View your profile (requires auth)")
 	fmt.Println("   Header: Authorization: Bearer <token>")
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/01_credential/appkey"
+	"github.com/primadi/lokstra-auth/01_credential/passkey"
+	"github.com/primadi/lokstra-auth/01_credential/passwordless"
+	"github.com/primadi/lokstra-auth/01_credential/serviceaccount"
+)
+
+// PasswordlessInitiate sends a magic link or OTP.
+// Body: {"email", "method": "magic_link"|"otp", "user_id"}
+func (h *Handlers) PasswordlessInitiate(w http.ResponseWriter, r *http.Request) {
+	if h.config.Passwordless == nil {
+		writeError(w, r, ErrFeatureDisabled)
+		return
+	}
+
+	var req struct {
+		Email  string `json:"email"`
+		Method string `json:"method"`
+		UserID string `json:"user_id"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if req.Email == "" {
+		writeError(w, r, passwordless.ErrInvalidEmail)
+		return
+	}
+
+	ctx := r.Context()
+	userID := req.UserID
+	if h.config.UserIDResolver != nil {
+		resolved, err := h.config.UserIDResolver(ctx, req.Email)
+		if err != nil {
+			// Do not reveal whether the email is registered
+			writeResponse(w, r, http.StatusAccepted, map[string]any{"status": "sent"})
+			return
+		}
+		userID = resolved
+	}
+
+	var err error
+	switch passwordless.TokenType(req.Method) {
+	case passwordless.TokenTypeMagicLink:
+		err = h.config.Passwordless.InitiateMagicLink(ctx, req.Email, userID, h.config.PasswordlessBaseURL)
+	case "", passwordless.TokenTypeOTP:
+		err = h.config.Passwordless.InitiateOTP(ctx, req.Email, userID)
+	default:
+		err = badRequest("method must be magic_link or otp")
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusAccepted, map[string]any{"status": "sent"})
+}
+
+// passkeyRequest is the body of the passkey endpoints
+type passkeyRequest struct {
+	UserID      string          `json:"user_id"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"display_name"`
+	Response    json.RawMessage `json:"response"`
+}
+
+// decodePasskeyRequest decodes and validates a passkey request
+func (h *Handlers) decodePasskeyRequest(w http.ResponseWriter, r *http.Request, needResponse bool) (*passkeyRequest, bool) {
+	if h.config.Passkey == nil {
+		writeError(w, r, ErrFeatureDisabled)
+		return nil, false
+	}
+
+	var req passkeyRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return nil, false
+	}
+	if req.UserID == "" {
+		writeError(w, r, badRequest("user_id is required"))
+		return nil, false
+	}
+	if needResponse && len(req.Response) == 0 {
+		writeError(w, r, badRequest("response is required"))
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// PasskeyRegisterBegin starts a passkey registration ceremony.
+// Body: {"user_id", "name", "display_name"}
+func (h *Handlers) PasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodePasskeyRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = req.UserID
+	}
+	displayName := req.DisplayName
+	if displayName == "" {
+		displayName = name
+	}
+
+	options, err := h.config.Passkey.BeginRegistration(r.Context(), &passkey.User{
+		ID:          []byte(req.UserID),
+		Name:        name,
+		DisplayName: displayName,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, options)
+}
+
+// PasskeyRegisterFinish completes a passkey registration ceremony.
+// Body: {"user_id", "response": <PublicKeyCredential>}
+func (h *Handlers) PasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodePasskeyRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	if err := h.config.Passkey.FinishRegistration(r.Context(), req.UserID, string(req.Response)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusCreated, map[string]any{"status": "registered"})
+}
+
+// PasskeyLoginBegin starts a passkey login ceremony.
+// Body: {"user_id"}
+func (h *Handlers) PasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodePasskeyRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	options, err := h.config.Passkey.BeginLogin(r.Context(), req.UserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, options)
+}
+
+// PasskeyLoginFinish completes a passkey login ceremony and issues tokens.
+// Body: {"user_id", "response": <PublicKeyCredential>}
+func (h *Handlers) PasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodePasskeyRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	result, err := h.config.Passkey.FinishLogin(ctx, req.UserID, string(req.Response))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp, err := h.config.Auth.CompleteLogin(ctx, &credential.AuthenticationResult{
+		Success: true,
+		Subject: result.UserID,
+		Claims: map[string]any{
+			"sub":           result.UserID,
+			"auth_method":   "passkey",
+			"credential_id": result.CredentialID,
+		},
+		Metadata: map[string]any{
+			"auth_type": "passkey",
+		},
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	h.writeLogin(w, r, resp)
+}
+
+// tokenRequest is the body of POST /token (form-encoded per OAuth2)
+type tokenRequest struct {
+	GrantType           string `json:"grant_type"`
+	ClientID            string `json:"client_id"`
+	ClientSecret        string `json:"client_secret"`
+	ClientAssertionType string `json:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion"`
+	Scope               string `json:"scope"`
+}
+
+// Token issues an access token to a client (client credentials grant): a
+// service account with a private_key_jwt client assertion or a client
+// secret, or an app with the client secret of an app key (secrets in the
+// body or with HTTP Basic auth). No
+// refresh token or session is issued: clients request a new token when it
+// expires.
+// Body: grant_type=client_credentials, client_id, client_assertion_type,
+// client_assertion | client_secret, scope
+func (h *Handlers) Token(w http.ResponseWriter, r *http.Request) {
+	if h.config.ServiceAccounts == nil && h.config.AppKeys == nil {
+		writeError(w, r, ErrFeatureDisabled)
+		return
+	}
+
+	var req tokenRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if req.GrantType != "client_credentials" {
+		writeError(w, r, badRequest("grant_type must be client_credentials"))
+		return
+	}
+
+	ctx := r.Context()
+	result, err := h.authenticateClient(r, &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp, err := h.config.Auth.CompleteLogin(ctx, result)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	out := newTokenResponse(resp)
+	out.RefreshToken = ""
+	out.Identity = nil
+	if scopes, ok := result.Claims["scopes"].([]string); ok {
+		out.Scope = strings.Join(scopes, " ")
+	}
+
+	writeResponse(w, r, http.StatusOK, out)
+}
+
+// authenticateClient authenticates the client of a token request: a
+// service account by its client assertion or secret, or an app by its app
+// key (client IDs starting with appkey.KeyIDPrefix)
+func (h *Handlers) authenticateClient(r *http.Request, req *tokenRequest) (*credential.AuthenticationResult, error) {
+	ctx := r.Context()
+	scopes := strings.Fields(req.Scope)
+
+	if req.ClientAssertion == "" {
+		clientID, secret := req.ClientID, req.ClientSecret
+		if id, password, ok := r.BasicAuth(); ok {
+			clientID, secret = id, password
+		}
+
+		if h.config.AppKeys != nil && (h.config.ServiceAccounts == nil || strings.HasPrefix(clientID, appkey.KeyIDPrefix)) {
+			return h.config.AppKeys.Authenticate(ctx, &appkey.Credentials{
+				KeyID:  clientID,
+				Secret: secret,
+				Scopes: scopes,
+			})
+		}
+		if h.config.ServiceAccounts == nil || secret == "" {
+			return nil, badRequest("client_assertion is required")
+		}
+		return h.config.ServiceAccounts.Authenticate(ctx, &serviceaccount.Credentials{
+			ClientID: clientID,
+			Secret:   secret,
+			Scopes:   scopes,
+		})
+	}
+
+	if h.config.ServiceAccounts == nil {
+		return nil, badRequest("client assertions are not supported")
+	}
+	if req.ClientAssertionType != serviceaccount.ClientAssertionType {
+		return nil, badRequest("client_assertion_type must be " + serviceaccount.ClientAssertionType)
+	}
+	return h.config.ServiceAccounts.Authenticate(ctx, &serviceaccount.Credentials{
+		ClientID:  req.ClientID,
+		Assertion: req.ClientAssertion,
+		Scopes:    scopes,
+	})
+}
@@ -0,0 +1,669 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	"github.com/primadi/lokstra-auth/01_credential/appkey"
+	"github.com/primadi/lokstra-auth/01_credential/passkey"
+	"github.com/primadi/lokstra-auth/01_credential/passwordless"
+	"github.com/primadi/lokstra-auth/01_credential/serviceaccount"
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/device"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/clientip"
+	"github.com/primadi/lokstra-auth/cookie"
+)
+
+var (
+	ErrMissingToken        = autherrors.New(autherrors.ErrUnauthenticated, "missing authentication token")
+	ErrInvalidTokenFormat  = autherrors.New(autherrors.ErrUnauthenticated, "invalid token format, expected 'Bearer <token>'")
+	ErrUnsupportedCredType = autherrors.New(autherrors.ErrInvalidRequest, "unsupported credential type")
+	ErrFeatureDisabled     = autherrors.New(autherrors.ErrNotFound, "endpoint is not configured")
+	ErrBadRequest          = autherrors.New(autherrors.ErrInvalidRequest, "bad request")
+	ErrRestrictedToken     = autherrors.New(autherrors.ErrInsufficientScope, "down-scoped tokens cannot use the account endpoints")
+)
+
+// DefaultRecentAuthMaxAge is how long ago the subject must have
+// authenticated for sensitive self-service operations by default
+const DefaultRecentAuthMaxAge = 10 * time.Minute
+
+// TokenExtractor extracts the bearer token from a request
+type TokenExtractor func(r *http.Request) (string, error)
+
+// UserIDResolver resolves the user ID for an email (used by passwordless initiate)
+type UserIDResolver func(ctx context.Context, email string) (string, error)
+
+// Config holds configuration for auth HTTP handlers
+type Config struct {
+	// Auth is the Auth runtime instance (required)
+	Auth *lokstraauth.Auth
+
+	// Prefix is prepended to every route (default: "/auth")
+	Prefix string
+
+	// TokenExtractor extracts bearer tokens (default: from Authorization header)
+	TokenExtractor TokenExtractor
+
+	// Passwordless enables /passwordless/initiate (optional)
+	Passwordless *passwordless.Authenticator
+
+	// PasswordlessBaseURL is the base URL used to build magic links
+	PasswordlessBaseURL string
+
+	// UserIDResolver resolves user IDs for passwordless initiate
+	// (optional, falls back to the "user_id" field of the request)
+	UserIDResolver UserIDResolver
+
+	// Passkey enables /passkey/register and /passkey/login (optional)
+	Passkey *passkey.Authenticator
+
+	// ServiceAccounts enables /token, the client credentials grant with
+	// private_key_jwt client assertions from service account key files or
+	// service account client secrets (optional)
+	ServiceAccounts *serviceaccount.Authenticator
+
+	// AppKeys enables /token for apps, the client credentials grant with
+	// the key ID and secret of an app key (optional)
+	AppKeys *appkey.Authenticator
+
+	// Cookies enables cookie session mode (optional): login sets a session
+	// cookie and a CSRF cookie instead of returning tokens in the body, and
+	// tokens are also read from the session cookie
+	Cookies *cookie.Manager
+
+	// RecentAuthMaxAge is how long ago the subject must have authenticated
+	// to generate backup codes, add recovery contacts, change its email
+	// address, username or profile (default: DefaultRecentAuthMaxAge).
+	// Older logins step up first (see lokstraauth.Auth.StepUp).
+	RecentAuthMaxAge time.Duration
+
+	// TrustedProxies are the proxies (e.g., load balancers) whose
+	// X-Forwarded-For header is believed to find the client IP address of
+	// logins, recovery and sessions: the client is the rightmost hop that is
+	// not a trusted proxy. Without them the header is ignored (see package
+	// clientip).
+	TrustedProxies []netip.Prefix
+}
+
+// Handlers exposes the standard auth HTTP surface on top of the Auth runtime.
+// Handlers are plain net/http handlers and can be mounted on any router.
+type Handlers struct {
+	config *Config
+}
+
+// New creates auth HTTP handlers
+func New(config *Config) *Handlers {
+	if config.Prefix == "" {
+		config.Prefix = "/auth"
+	}
+	config.Prefix = strings.TrimRight(config.Prefix, "/")
+
+	if config.TokenExtractor == nil {
+		config.TokenExtractor = BearerTokenExtractor
+		if config.Cookies != nil {
+			config.TokenExtractor = firstTokenExtractor(BearerTokenExtractor, config.Cookies.ReadSession)
+		}
+	}
+
+	if config.RecentAuthMaxAge <= 0 {
+		config.RecentAuthMaxAge = DefaultRecentAuthMaxAge
+	}
+
+	return &Handlers{config: config}
+}
+
+// Register mounts all handlers on a ServeMux
+func (h *Handlers) Register(mux *http.ServeMux) {
+	p := h.config.Prefix
+	mux.HandleFunc("POST "+p+"/login", h.Login)
+	mux.HandleFunc("POST "+p+"/refresh", h.Refresh)
+	mux.HandleFunc("POST "+p+"/token/refresh", h.Refresh)
+	mux.HandleFunc("POST "+p+"/logout", h.Logout)
+	mux.HandleFunc("GET "+p+"/me", h.Me)
+	mux.HandleFunc("GET "+p+"/sessions", h.Sessions)
+	mux.HandleFunc("DELETE "+p+"/sessions/{id}", h.RevokeSession)
+	mux.HandleFunc("POST "+p+"/device/login", h.DeviceLogin)
+	mux.HandleFunc("GET "+p+"/devices", h.Devices)
+	mux.HandleFunc("DELETE "+p+"/devices/{id}", h.RevokeDevice)
+	mux.HandleFunc("POST "+p+"/devices/{id}/trust", h.TrustDevice)
+	mux.HandleFunc("POST "+p+"/passwordless/initiate", h.PasswordlessInitiate)
+	mux.HandleFunc("POST "+p+"/passkey/register/begin", h.PasskeyRegisterBegin)
+	mux.HandleFunc("POST "+p+"/passkey/register/finish", h.PasskeyRegisterFinish)
+	mux.HandleFunc("POST "+p+"/passkey/login/begin", h.PasskeyLoginBegin)
+	mux.HandleFunc("POST "+p+"/passkey/login/finish", h.PasskeyLoginFinish)
+	mux.HandleFunc("POST "+p+"/token", h.Token)
+	mux.HandleFunc("GET "+p+"/recovery", h.RecoveryStatus)
+	mux.HandleFunc("POST "+p+"/recovery/codes", h.RecoveryCodes)
+	mux.HandleFunc("POST "+p+"/recovery/contacts", h.AddRecoveryContact)
+	mux.HandleFunc("POST "+p+"/recovery/contacts/{id}/verify", h.VerifyRecoveryContact)
+	mux.HandleFunc("DELETE "+p+"/recovery/contacts/{id}", h.RemoveRecoveryContact)
+	mux.HandleFunc("DELETE "+p+"/recovery/admin", h.CancelAdminRecovery)
+	mux.HandleFunc("POST "+p+"/recovery/initiate", h.RecoveryInitiate)
+	mux.HandleFunc("POST "+p+"/recovery/login", h.RecoveryLogin)
+	mux.HandleFunc("GET "+p+"/identity-changes", h.IdentityChanges)
+	mux.HandleFunc("POST "+p+"/identity-changes/email", h.ChangeEmail)
+	mux.HandleFunc("POST "+p+"/identity-changes/username", h.ChangeUsername)
+	mux.HandleFunc("POST "+p+"/identity-changes/confirm", h.ConfirmIdentityChange)
+	mux.HandleFunc("DELETE "+p+"/identity-changes/{field}", h.CancelIdentityChange)
+	mux.HandleFunc("GET "+p+"/profile", h.Profile)
+	mux.HandleFunc("PATCH "+p+"/profile", h.UpdateProfile)
+}
+
+// Handler returns a ServeMux with all handlers mounted
+func (h *Handlers) Handler() http.Handler {
+	mux := http.NewServeMux()
+	h.Register(mux)
+	return mux
+}
+
+// Prefix returns the path prefix of the handlers, e.g., to mount Handler on
+// a Lokstra router: r.ANYPrefix(h.Prefix(), h.Handler())
+func (h *Handlers) Prefix() string {
+	return h.config.Prefix
+}
+
+// Login authenticates credentials and issues tokens. The "type" member
+// selects the authenticator (default: the default authenticator type), which
+// parses the rest of the body (see Auth.ParseCredentials), e.g.
+// {"type": "basic", "username", "password"} |
+// {"type": "apikey", "api_key"} |
+// {"type": "passwordless", "email", "token", "token_type"} |
+// {"type": "oauth2", "provider", "access_token", "id_token"}.
+// Add {"remember_device": true, "device_id", "device_name"} to remember the device.
+// A login requiring a challenge fails with the challenge in the "challenge"
+// member of the error; the client retries with its "challenge_response".
+func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	payload, err := decodePayload(r, &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	creds, err := h.config.Auth.ParseCredentials(r.Context(), payload)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	loginReq := &lokstraauth.LoginRequest{
+		Credentials: creds,
+		Metadata: map[string]any{
+			"ip_address": h.clientIP(r),
+			"user_agent": r.UserAgent(),
+		},
+	}
+	if req.ChallengeResponse != "" {
+		loginReq.Metadata[lokstraauth.MetadataChallengeResponse] = req.ChallengeResponse
+	}
+	if req.RememberDevice && req.DeviceID == "" {
+		writeError(w, r, badRequest("device_id is required to remember the device"))
+		return
+	}
+	if req.DeviceID != "" {
+		info := h.deviceInfo(r, req.DeviceID)
+		info.Name = req.DeviceName
+		loginReq.Device = &lokstraauth.DeviceRegistration{
+			Fingerprint: info.Fingerprint,
+			Platform:    req.DevicePlatform,
+			Name:        req.DeviceName,
+			IPAddress:   info.IPAddress,
+			UserAgent:   info.UserAgent,
+		}
+		if req.RememberDevice {
+			loginReq.RememberDevice = info
+		}
+	}
+
+	resp, err := h.config.Auth.Login(r.Context(), loginReq)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	h.writeLogin(w, r, resp)
+}
+
+// writeLogin writes a login response, as session cookies in cookie mode
+func (h *Handlers) writeLogin(w http.ResponseWriter, r *http.Request, resp *lokstraauth.LoginResponse) {
+	if h.config.Cookies == nil {
+		writeResponse(w, r, http.StatusOK, newTokenResponse(resp))
+		return
+	}
+
+	if err := h.config.Cookies.SetSession(w, resp.AccessToken.Value, resp.AccessToken.ExpiresAt); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	csrfToken, err := h.config.Cookies.IssueCSRF(w, resp.AccessToken.ExpiresAt)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if resp.DeviceToken != nil {
+		if err := h.config.Cookies.SetDevice(w, resp.DeviceToken.Value, resp.DeviceToken.ExpiresAt); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	body := newTokenResponse(resp)
+	body.AccessToken = ""
+	body.TokenType = "Cookie"
+	body.RefreshToken = ""
+	body.DeviceToken = ""
+	body.CSRFToken = csrfToken
+
+	writeResponse(w, r, http.StatusOK, body)
+}
+
+// Refresh issues a new access token from a refresh token.
+// Body: {"refresh_token"}
+func (h *Handlers) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if req.RefreshToken == "" {
+		writeError(w, r, badRequest("refresh_token is required"))
+		return
+	}
+
+	accessToken, err := h.config.Auth.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, newTokenResponse(&lokstraauth.LoginResponse{
+		AccessToken: accessToken,
+	}))
+}
+
+// Logout revokes the bearer token and, when given, the refresh token.
+// Body (optional): {"refresh_token", "all": true}
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	tokenValue, err := h.config.TokenExtractor(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if !h.verifyCSRF(w, r) {
+		return
+	}
+
+	verifyResp, err := h.config.Auth.Verify(r.Context(), &lokstraauth.VerifyRequest{Token: tokenValue})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !verifyResp.Valid {
+		writeError(w, r, lokstraauth.ErrAuthenticationFailed)
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+	if r.ContentLength != 0 {
+		if err := decodeRequest(r, &req); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	// A down-scoped token can revoke itself, not the sessions of the subject
+	if _, restricted := verifyResp.Claims.AllowedPermissions(); restricted && req.All {
+		writeError(w, r, ErrRestrictedToken)
+		return
+	}
+
+	ctx := r.Context()
+	if req.All {
+		sub, _ := verifyResp.Claims.GetString("sub")
+		tenantID, _ := verifyResp.Claims.Tenant()
+		err = h.config.Auth.LogoutAll(ctx, tenantID, sub)
+	} else {
+		err = h.config.Auth.Logout(ctx, tokenValue)
+		if err == nil && req.RefreshToken != "" {
+			err = h.config.Auth.Logout(ctx, req.RefreshToken)
+		}
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if h.config.Cookies != nil {
+		h.config.Cookies.Clear(w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeviceLogin silently re-authenticates a remembered device and rotates its
+// device token. Body: {"device_token", "device_id"} (in cookie mode the device
+// token is read from the device cookie when omitted)
+func (h *Handlers) DeviceLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DeviceToken string `json:"device_token"`
+		DeviceID    string `json:"device_id"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if req.DeviceToken == "" && h.config.Cookies != nil {
+		req.DeviceToken, _ = h.config.Cookies.ReadDevice(r)
+	}
+	if req.DeviceToken == "" || req.DeviceID == "" {
+		writeError(w, r, badRequest("device_token and device_id are required"))
+		return
+	}
+
+	resp, err := h.config.Auth.LoginWithDeviceToken(r.Context(), req.DeviceToken, h.deviceInfo(r, req.DeviceID))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	h.writeLogin(w, r, resp)
+}
+
+// Devices lists the devices of the bearer token's subject with last-seen info
+func (h *Handlers) Devices(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	sub, _ := claims.GetString("sub")
+	devices, err := h.config.Auth.ListDevices(r.Context(), sub)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	out := make([]*deviceResponse, 0, len(devices))
+	for _, d := range devices {
+		out = append(out, newDeviceResponse(d))
+	}
+
+	writeResponse(w, r, http.StatusOK, map[string]any{"devices": out})
+}
+
+// RevokeDevice revokes one of the bearer token subject's devices
+func (h *Handlers) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	sub, _ := claims.GetString("sub")
+	if err := h.config.Auth.RevokeDevice(r.Context(), sub, r.PathValue("id")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TrustDevice marks one of the bearer token subject's devices as trusted.
+// Body: {"trusted": true|false}
+func (h *Handlers) TrustDevice(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	var req struct {
+		Trusted bool `json:"trusted"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	sub, _ := claims.GetString("sub")
+	if err := h.config.Auth.TrustDevice(r.Context(), sub, r.PathValue("id"), req.Trusted); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me returns the identity of the bearer token
+func (h *Handlers) Me(w http.ResponseWriter, r *http.Request) {
+	identity, _, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, newIdentityResponse(identity))
+}
+
+// Sessions lists the sessions of the bearer token's subject. Server-side
+// sessions are listed when the identity store supports it, otherwise the
+// tokens tracked by the token store.
+func (h *Handlers) Sessions(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+
+	infos, err := h.config.Auth.ListSessions(ctx, sub)
+	if err == nil {
+		sessions := make([]sessionResponse, 0, len(infos))
+		for _, info := range infos {
+			sessions = append(sessions, newSessionInfoResponse(info))
+		}
+		writeResponse(w, r, http.StatusOK, map[string]any{"sessions": sessions})
+		return
+	}
+	if !errors.Is(err, lokstraauth.ErrNoIdentityStore) && !errors.Is(err, lokstraauth.ErrSessionsNotSupported) {
+		writeError(w, r, err)
+		return
+	}
+
+	store := h.config.Auth.GetTokenStore()
+	if store == nil {
+		writeError(w, r, ErrFeatureDisabled)
+		return
+	}
+
+	tokens, err := store.List(ctx, sub)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	sessions := make([]sessionResponse, 0, len(tokens))
+	for _, t := range tokens {
+		sessions = append(sessions, newSessionResponse(t))
+	}
+
+	writeResponse(w, r, http.StatusOK, map[string]any{"sessions": sessions})
+}
+
+// RevokeSession revokes one of the bearer token subject's server-side sessions
+func (h *Handlers) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	sessionID := r.PathValue("id")
+
+	sessions, err := h.config.Auth.ListSessions(ctx, sub)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			if err := h.config.Auth.RevokeSession(ctx, sessionID); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, r, lokstraauth.ErrSessionNotFound)
+}
+
+// verifyCSRF checks the CSRF token of cookie-authenticated requests.
+// It writes the error response and returns false on failure.
+func (h *Handlers) verifyCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if h.config.Cookies == nil || r.Header.Get("Authorization") != "" {
+		return true
+	}
+
+	if err := h.config.Cookies.VerifyCSRF(r); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// authenticate verifies the bearer token, which must be an access token,
+// and builds the identity context. Down-scoped tokens are rejected: they
+// are handed to less-trusted subsystems, which must not manage the
+// sessions, devices, recovery or identity of the subject. It writes the
+// error response and returns false on failure.
+func (h *Handlers) authenticate(w http.ResponseWriter, r *http.Request) (*subject.IdentityContext, token.Claims, bool) {
+	tokenValue, err := h.config.TokenExtractor(r)
+	if err != nil {
+		writeError(w, r, err)
+		return nil, nil, false
+	}
+
+	resp, err := h.config.Auth.Verify(r.Context(), &lokstraauth.VerifyRequest{
+		Token:                tokenValue,
+		BuildIdentityContext: true,
+		Options:              &token.VerifyOptions{TokenType: token.TokenTypeAccess},
+		Metadata: map[string]any{
+			"ip_address": h.clientIP(r),
+		},
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return nil, nil, false
+	}
+	if !resp.Valid {
+		writeError(w, r, lokstraauth.ErrAuthenticationFailed)
+		return nil, nil, false
+	}
+	if _, restricted := resp.Claims.AllowedPermissions(); restricted {
+		writeError(w, r, ErrRestrictedToken)
+		return nil, nil, false
+	}
+
+	if resp.Identity == nil {
+		sub, _ := resp.Claims.GetString("sub")
+		resp.Identity = &subject.IdentityContext{
+			Subject: &subject.Subject{ID: sub},
+		}
+	}
+
+	return resp.Identity, resp.Claims, true
+}
+
+// authenticateSensitive authenticates operations that change how the
+// account signs in or is recovered. They need an unrestricted access token
+// of a subject who authenticated within RecentAuthMaxAge, so a leaked,
+// refresh or down-scoped token cannot take the account over. It writes the
+// error response and returns false on failure.
+func (h *Handlers) authenticateSensitive(w http.ResponseWriter, r *http.Request) (*subject.IdentityContext, token.Claims, bool) {
+	identity, claims, ok := h.authenticate(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	authTime, ok := claims.AuthTime()
+	if !ok || time.Since(authTime) > h.config.RecentAuthMaxAge {
+		writeError(w, r, authz.ErrRecentAuthRequired)
+		return nil, nil, false
+	}
+
+	return identity, claims, true
+}
+
+// BearerTokenExtractor extracts token from Authorization header
+// Format: "Bearer <token>"
+func BearerTokenExtractor(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "", ErrMissingToken
+	}
+
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return "", ErrInvalidTokenFormat
+	}
+
+	return parts[1], nil
+}
+
+// firstTokenExtractor tries extractors in order and returns the first token found
+func firstTokenExtractor(extractors ...TokenExtractor) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		err := ErrMissingToken
+		for _, extract := range extractors {
+			tokenValue, extractErr := extract(r)
+			if extractErr == nil && tokenValue != "" {
+				return tokenValue, nil
+			}
+			if extractErr != nil && errors.Is(err, ErrMissingToken) {
+				err = extractErr
+			}
+		}
+		return "", err
+	}
+}
+
+// deviceInfo builds device info from the request. The fingerprint binds the
+// client-generated device ID to the user agent.
+func (h *Handlers) deviceInfo(r *http.Request, deviceID string) *device.Info {
+	return &device.Info{
+		Fingerprint: deviceID + "|" + r.UserAgent(),
+		IPAddress:   h.clientIP(r),
+		UserAgent:   r.UserAgent(),
+	}
+}
+
+// clientIP returns the client IP address of a request
+func (h *Handlers) clientIP(r *http.Request) string {
+	return clientip.FromRequest(r, h.config.TrustedProxies)
+}
+
+// unixOrZero converts a time to unix seconds (0 for zero time)
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/identitychange"
+)
+
+// identityChangeRequest is the body of the identity change endpoints
+type identityChangeRequest struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+// IdentityChanges returns the pending email and username changes of the
+// bearer token's subject
+func (h *Handlers) IdentityChanges(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	changes, err := h.config.Auth.PendingIdentityChanges(ctx, claimsTenant(ctx, claims), sub)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, map[string]any{"changes": changes})
+}
+
+// ChangeEmail asks to change the email address of the bearer token's
+// subject; a confirmation is sent to the new address. It requires an
+// unrestricted access token and a recent authentication.
+// Body: {"email"}
+func (h *Handlers) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticateSensitive(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	var req identityChangeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	change, err := h.config.Auth.RequestEmailChange(ctx, claimsTenant(ctx, claims), sub, req.Email)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusAccepted, change)
+}
+
+// ChangeUsername asks to change the username of the bearer token's
+// subject; a confirmation is sent to its email address. It requires an
+// unrestricted access token and a recent authentication.
+// Body: {"username"}
+func (h *Handlers) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticateSensitive(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	var req identityChangeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	change, err := h.config.Auth.RequestUsernameChange(ctx, claimsTenant(ctx, claims), sub, req.Username)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusAccepted, change)
+}
+
+// CancelIdentityChange cancels the pending change of a field ("email" or
+// "username") of the bearer token's subject. It requires an unrestricted
+// access token and a recent authentication.
+func (h *Handlers) CancelIdentityChange(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticateSensitive(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	field := identitychange.Field(r.PathValue("field"))
+	if err := h.config.Auth.CancelIdentityChange(ctx, claimsTenant(ctx, claims), sub, field); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ConfirmIdentityChange applies the email or username change confirmed by
+// the token sent for it, in the tenant of the request. It needs no bearer
+// token: the confirmation link may be opened on another device.
+// Body: {"token"}
+func (h *Handlers) ConfirmIdentityChange(w http.ResponseWriter, r *http.Request) {
+	var req identityChangeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if req.Token == "" {
+		writeError(w, r, badRequest("token is required"))
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.config.Auth.ConfirmIdentityChange(ctx, authz.TenantFromContext(ctx), req.Token)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, user)
+}
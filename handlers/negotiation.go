@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+	"github.com/primadi/lokstra-auth/01_credential/basic"
+	"github.com/primadi/lokstra-auth/01_credential/passkey"
+	"github.com/primadi/lokstra-auth/01_credential/passwordless"
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/device"
+	"github.com/primadi/lokstra-auth/02_token/jwt"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/challenge"
+	"github.com/primadi/lokstra-auth/cookie"
+)
+
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeProblem = "application/problem+json"
+	contentTypeForm    = "application/x-www-form-urlencoded"
+
+	// maxBodySize limits request bodies
+	maxBodySize = 1 << 20
+)
+
+// decodeRequest decodes a JSON or form-encoded request body into dst.
+// Form fields are matched against the json tags of dst.
+func decodeRequest(r *http.Request, dst any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case contentTypeForm, "multipart/form-data":
+		if err := r.ParseForm(); err != nil {
+			return badRequest(err.Error())
+		}
+		return decodeForm(r, dst)
+	default:
+		decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+		if err := decoder.Decode(dst); err != nil {
+			return badRequest("invalid JSON body")
+		}
+		return nil
+	}
+}
+
+// decodePayload decodes a request like decodeRequest and also returns the
+// body as a JSON object (form fields become string members), e.g. for
+// Auth.ParseCredentials
+func decodePayload(r *http.Request, dst any) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case contentTypeForm, "multipart/form-data":
+		if err := decodeRequest(r, dst); err != nil {
+			return nil, err
+		}
+		fields := make(map[string]string, len(r.Form))
+		for name := range r.Form {
+			fields[name] = r.Form.Get(name)
+		}
+		return json.Marshal(fields)
+	default:
+		body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+		if err != nil || json.Unmarshal(body, dst) != nil {
+			return nil, badRequest("invalid JSON body")
+		}
+		return body, nil
+	}
+}
+
+// decodeForm copies form values into the string/bool fields of dst
+func decodeForm(r *http.Request, dst any) error {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || !r.Form.Has(name) {
+			continue
+		}
+
+		value := r.Form.Get(name)
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return badRequest(fmt.Sprintf("invalid value for %s", name))
+			}
+			field.SetBool(b)
+		}
+	}
+
+	return nil
+}
+
+// writeResponse writes a successful response in the negotiated format
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, body any) {
+	if !accepts(r, contentTypeJSON) {
+		http.Error(w, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// problem is an RFC 7807 problem details body
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+
+	// Challenge is the challenge to solve before retrying a login
+	Challenge *challenge.Challenge `json:"challenge,omitempty"`
+}
+
+// writeError maps an error to its HTTP status and writes it either as
+// problem details (when the client accepts application/problem+json)
+// or as {"error", "message"} JSON, matching the middleware error format.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusCode(err)
+	title := http.StatusText(status)
+	code := autherrors.CodeOf(err)
+	message := errorMessage(err, status)
+
+	var required *lokstraauth.ChallengeRequiredError
+	errors.As(err, &required)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="lokstra-auth"`)
+	}
+
+	if prefersProblem(r) {
+		w.Header().Set("Content-Type", contentTypeProblem)
+		w.WriteHeader(status)
+		body := problem{
+			Type:   "about:blank",
+			Title:  title,
+			Status: status,
+			Detail: message,
+			Code:   string(code),
+		}
+		if required != nil {
+			body.Challenge = required.Challenge
+		}
+		_ = json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	body := map[string]any{
+		"error":   title,
+		"code":    code,
+		"message": message,
+	}
+	if required != nil {
+		body["challenge"] = required.Challenge
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// errorMessage returns the message of an error shown to clients: the safe
+// message of coded errors, and no details of other server errors
+func errorMessage(err error, status int) string {
+	if _, ok := autherrors.KindOf(err); ok {
+		return autherrors.SafeMessage(err)
+	}
+	if status >= http.StatusInternalServerError {
+		return http.StatusText(status)
+	}
+	return err.Error()
+}
+
+// StatusCode maps runtime and layer errors to HTTP status codes
+func StatusCode(err error) int {
+	switch {
+	// A dependency exceeded its latency budget (checked first: timeouts are
+	// wrapped by layer errors such as ErrAuthenticationFailed)
+	case errors.Is(err, lokstraauth.ErrTimeout):
+		return http.StatusGatewayTimeout
+
+	case errors.Is(err, ErrBadRequest),
+		errors.Is(err, ErrUnsupportedCredType),
+		errors.Is(err, credential.ErrUnknownCredentialType),
+		errors.Is(err, credential.ErrInvalidPayload),
+		errors.Is(err, basic.ErrEmptyUsername),
+		errors.Is(err, basic.ErrEmptyPassword),
+		errors.Is(err, passwordless.ErrInvalidEmail),
+		errors.Is(err, passkey.ErrRegistrationFailed),
+		errors.Is(err, lokstraauth.ErrMissingDeviceFingerprint):
+		return http.StatusBadRequest
+
+	case errors.Is(err, ErrMissingToken),
+		errors.Is(err, ErrInvalidTokenFormat),
+		errors.Is(err, lokstraauth.ErrAuthenticationFailed),
+		errors.Is(err, basic.ErrInvalidCredentials),
+		errors.Is(err, apikey.ErrInvalidAPIKey),
+		errors.Is(err, apikey.ErrAPIKeyExpired),
+		errors.Is(err, apikey.ErrAPIKeyRevoked),
+		errors.Is(err, passwordless.ErrInvalidToken),
+		errors.Is(err, passwordless.ErrTokenExpired),
+		errors.Is(err, passkey.ErrAuthenticationFailed),
+		errors.Is(err, lokstraauth.ErrSessionExpired),
+		errors.Is(err, cookie.ErrMissingCookie),
+		errors.Is(err, device.ErrInvalidDeviceToken),
+		errors.Is(err, device.ErrExpiredDeviceToken),
+		errors.Is(err, device.ErrFingerprintMismatch),
+		errors.Is(err, device.ErrTokenReuse),
+		errors.Is(err, cookie.ErrInvalidCookie),
+		errors.Is(err, jwt.ErrInvalidToken),
+		errors.Is(err, jwt.ErrExpiredToken),
+		errors.Is(err, jwt.ErrTokenRevoked):
+		return http.StatusUnauthorized
+
+	case errors.Is(err, token.ErrInsufficientScope),
+		errors.Is(err, token.ErrAudienceMismatch),
+		errors.Is(err, token.ErrTokenTypeMismatch),
+		errors.Is(err, token.ErrTenantMismatch),
+		errors.Is(err, cookie.ErrCSRFTokenMissing),
+		errors.Is(err, cookie.ErrCSRFTokenInvalid),
+		errors.Is(err, authz.ErrSandboxToken):
+		return http.StatusForbidden
+
+	case errors.Is(err, lokstraauth.ErrSessionLimitExceeded),
+		errors.Is(err, lokstraauth.ErrAccountLinkConflict),
+		errors.Is(err, lokstraauth.ErrLastIdentity),
+		errors.Is(err, subject.ErrIdentityLinked):
+		return http.StatusConflict
+
+	case errors.Is(err, lokstraauth.ErrNoAuthenticator),
+		errors.Is(err, lokstraauth.ErrSessionNotFound),
+		errors.Is(err, device.ErrDeviceNotFound),
+		errors.Is(err, subject.ErrDeviceNotFound),
+		errors.Is(err, subject.ErrUserIdentityNotFound),
+		errors.Is(err, ErrFeatureDisabled):
+		return http.StatusNotFound
+
+	case errors.Is(err, lokstraauth.ErrRefreshNotSupported),
+		errors.Is(err, lokstraauth.ErrRevocationNotSupported),
+		errors.Is(err, lokstraauth.ErrDeviceTokensNotSupported),
+		errors.Is(err, lokstraauth.ErrNoDeviceStore):
+		return http.StatusNotImplemented
+
+	default:
+		return autherrors.HTTPStatus(err)
+	}
+}
+
+// badRequest wraps a message as ErrBadRequest
+func badRequest(msg string) error {
+	return fmt.Errorf("%w: %s", ErrBadRequest, msg)
+}
+
+// accepts reports whether the Accept header allows the media type
+func accepts(r *http.Request, mediaType string) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+
+	major := strings.Split(mediaType, "/")[0]
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		if mt == "*/*" || mt == mediaType || mt == major+"/*" || strings.HasSuffix(mt, "+json") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prefersProblem reports whether the client explicitly accepts problem details
+func prefersProblem(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), contentTypeProblem)
+}
+
+// fingerprint returns a short, non-reversible identifier for a token value
+func fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
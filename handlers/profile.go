@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Profile returns the profile of the bearer token's subject, with the
+// attributes it can edit
+func (h *Handlers) Profile(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	profile, err := h.config.Auth.GetProfile(ctx, claimsTenant(ctx, claims), sub)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, profile)
+}
+
+// UpdateProfile changes profile attributes of the bearer token's subject;
+// null or "" values remove attributes. It requires an unrestricted access
+// token and a recent authentication.
+// Body: {"display_name", "avatar_url", "locale", "timezone", ...}
+func (h *Handlers) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticateSensitive(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	var changes map[string]any
+	body, err := decodePayload(r, &struct{}{})
+	if err == nil && json.Unmarshal(body, &changes) != nil {
+		err = badRequest("a JSON object is required")
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	profile, err := h.config.Auth.UpdateProfile(ctx, claimsTenant(ctx, claims), sub, changes)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, profile)
+}
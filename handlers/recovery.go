@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	token "github.com/primadi/lokstra-auth/02_token"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/recovery"
+)
+
+// recoveryRequest is the body of the recovery endpoints
+type recoveryRequest struct {
+	Method   string               `json:"method"`
+	Username string               `json:"username"`
+	Code     string               `json:"code"`
+	Kind     recovery.ContactKind `json:"kind"`
+	Address  string               `json:"address"`
+	Token    string               `json:"token"`
+}
+
+// RecoveryStatus returns the recovery setup of the bearer token's subject:
+// remaining backup codes, contacts, pending admin recovery and cooldown
+func (h *Handlers) RecoveryStatus(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	status, err := h.config.Auth.RecoveryStatus(ctx, claimsTenant(ctx, claims), sub)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, status)
+}
+
+// RecoveryCodes generates new backup codes for the bearer token's subject,
+// replacing the previous ones. The codes are returned once. It requires an
+// unrestricted access token and a recent authentication.
+func (h *Handlers) RecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticateSensitive(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	codes, err := h.config.Auth.GenerateBackupCodes(ctx, claimsTenant(ctx, claims), sub)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, map[string]any{"codes": codes})
+}
+
+// AddRecoveryContact adds a recovery contact to the bearer token's subject
+// and sends it a verification code. It requires an unrestricted access
+// token and a recent authentication.
+// Body: {"kind": "email"|"phone", "address"}
+func (h *Handlers) AddRecoveryContact(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticateSensitive(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	var req recoveryRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	contact, err := h.config.Auth.AddRecoveryContact(ctx, claimsTenant(ctx, claims), sub, req.Kind, req.Address)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusCreated, contact)
+}
+
+// VerifyRecoveryContact verifies a recovery contact of the bearer token's
+// subject with the code sent to it.
+// Body: {"code"}
+func (h *Handlers) VerifyRecoveryContact(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	var req recoveryRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	contact, err := h.config.Auth.VerifyRecoveryContact(ctx, claimsTenant(ctx, claims), sub, r.PathValue("id"), req.Code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, contact)
+}
+
+// RemoveRecoveryContact removes a recovery contact of the bearer token's
+// subject
+func (h *Handlers) RemoveRecoveryContact(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	if err := h.config.Auth.RemoveRecoveryContact(ctx, claimsTenant(ctx, claims), sub, r.PathValue("id")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CancelAdminRecovery cancels the pending admin recovery of the bearer
+// token's subject
+func (h *Handlers) CancelAdminRecovery(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.authenticate(w, r)
+	if !ok || !h.verifyCSRF(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	sub, _ := claims.GetString("sub")
+	if err := h.config.Auth.CancelAdminRecovery(ctx, claimsTenant(ctx, claims), sub); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RecoveryInitiate sends a recovery code to a verified recovery contact of
+// the tenant of the request. The response does not reveal whether the
+// address is a contact.
+// Body: {"kind": "email"|"phone", "address"}
+func (h *Handlers) RecoveryInitiate(w http.ResponseWriter, r *http.Request) {
+	var req recoveryRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.config.Auth.InitiateContactRecovery(ctx, authz.TenantFromContext(ctx), req.Kind, req.Address); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, r, http.StatusAccepted, map[string]any{"status": "sent"})
+}
+
+// RecoveryLogin signs in a user of the tenant of the request who lost their
+// sign-in factor, and issues tokens with the "recovery" auth method.
+// Body: {"method": "backup_code", "username", "code"} |
+// {"method": "contact", "kind", "address", "code"} |
+// {"method": "admin", "token"}
+func (h *Handlers) RecoveryLogin(w http.ResponseWriter, r *http.Request) {
+	var req recoveryRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Backup code failures are also counted per client IP address
+	ctx := subject.WithClientIP(r.Context(), h.clientIP(r))
+	tenantID := authz.TenantFromContext(ctx)
+	var resp *lokstraauth.LoginResponse
+	var err error
+	switch req.Method {
+	case lokstraauth.RecoveryBackupCode:
+		resp, err = h.config.Auth.RecoverWithBackupCode(ctx, tenantID, req.Username, req.Code)
+	case lokstraauth.RecoveryContact:
+		resp, err = h.config.Auth.RecoverWithContact(ctx, tenantID, req.Kind, req.Address, req.Code)
+	case lokstraauth.RecoveryAdmin:
+		resp, err = h.config.Auth.RecoverWithAdminTicket(ctx, tenantID, req.Token)
+	default:
+		err = badRequest("method must be backup_code, contact or admin")
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	h.writeLogin(w, r, resp)
+}
+
+// claimsTenant returns the tenant of verified claims, else of the context
+func claimsTenant(ctx context.Context, claims token.Claims) string {
+	if tenantID, _ := claims.Tenant(); tenantID != "" {
+		return tenantID
+	}
+	return authz.TenantFromContext(ctx)
+}
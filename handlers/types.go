@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	lokstraauth "github.com/primadi/lokstra-auth"
+	token "github.com/primadi/lokstra-auth/02_token"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+)
+
+// loginRequest holds the device members of the body of POST /login. The
+// credentials are parsed by Auth.ParseCredentials from the same body.
+type loginRequest struct {
+	// DeviceID is a stable, client-generated device identifier. It registers
+	// the device and is required by remember_device.
+	DeviceID       string `json:"device_id"`
+	DeviceName     string `json:"device_name"`
+	DevicePlatform string `json:"device_platform"`
+	RememberDevice bool   `json:"remember_device"`
+
+	// ChallengeResponse is the solution of the challenge returned by a
+	// previous attempt (see lokstraauth.ChallengeRequiredError)
+	ChallengeResponse string `json:"challenge_response"`
+}
+
+// tokenResponse is the body returned by /login, /refresh and /passkey/login
+type tokenResponse struct {
+	AccessToken  string            `json:"access_token,omitempty"`
+	TokenType    string            `json:"token_type"`
+	ExpiresIn    int64             `json:"expires_in,omitempty"`
+	ExpiresAt    int64             `json:"expires_at,omitempty"`
+	RefreshToken string            `json:"refresh_token,omitempty"`
+	SessionID    string            `json:"session_id,omitempty"`
+	DeviceToken  string            `json:"device_token,omitempty"`
+	CSRFToken    string            `json:"csrf_token,omitempty"`
+	Scope        string            `json:"scope,omitempty"`
+	Identity     *identityResponse `json:"identity,omitempty"`
+
+	// MFARequired marks an MFA-pending access token, which the application
+	// exchanges with lokstraauth.Auth.CompleteMFA once the second factor is
+	// verified
+	MFARequired bool `json:"mfa_required,omitempty"`
+}
+
+// newTokenResponse builds a token response from a login response
+func newTokenResponse(resp *lokstraauth.LoginResponse) *tokenResponse {
+	out := &tokenResponse{
+		AccessToken: resp.AccessToken.Value,
+		TokenType:   "Bearer",
+		ExpiresAt:   unixOrZero(resp.AccessToken.ExpiresAt),
+		MFARequired: resp.MFARequired,
+	}
+
+	if !resp.AccessToken.ExpiresAt.IsZero() && !resp.AccessToken.IssuedAt.IsZero() {
+		out.ExpiresIn = int64(resp.AccessToken.ExpiresAt.Sub(resp.AccessToken.IssuedAt).Seconds())
+	}
+
+	if resp.RefreshToken != nil {
+		out.RefreshToken = resp.RefreshToken.Value
+	}
+
+	if resp.Session != nil {
+		out.SessionID = resp.Session.ID
+	}
+
+	if resp.DeviceToken != nil {
+		out.DeviceToken = resp.DeviceToken.Value
+	}
+
+	if resp.Identity != nil {
+		out.Identity = newIdentityResponse(resp.Identity)
+	}
+
+	return out
+}
+
+// identityResponse is the body returned by /me
+type identityResponse struct {
+	ID          string         `json:"id"`
+	Type        string         `json:"type,omitempty"`
+	Principal   string         `json:"principal,omitempty"`
+	Roles       []string       `json:"roles"`
+	Permissions []string       `json:"permissions"`
+	Groups      []string       `json:"groups"`
+	Profile     map[string]any `json:"profile,omitempty"`
+}
+
+// newIdentityResponse builds an identity response from an identity context
+func newIdentityResponse(identity *subject.IdentityContext) *identityResponse {
+	out := &identityResponse{
+		Roles:       nonNil(identity.Roles),
+		Permissions: nonNil(identity.Permissions),
+		Groups:      nonNil(identity.Groups),
+		Profile:     identity.Profile,
+	}
+
+	if identity.Subject != nil {
+		out.ID = identity.Subject.ID
+		out.Type = identity.Subject.Type
+		out.Principal = identity.Subject.Principal
+	}
+
+	return out
+}
+
+// sessionResponse is a single entry returned by /sessions
+type sessionResponse struct {
+	ID             string `json:"id"`
+	IssuedAt       int64  `json:"issued_at,omitempty"`
+	ExpiresAt      int64  `json:"expires_at,omitempty"`
+	LastActivityAt int64  `json:"last_activity_at,omitempty"`
+	IPAddress      string `json:"ip_address,omitempty"`
+	UserAgent      string `json:"user_agent,omitempty"`
+}
+
+// newSessionInfoResponse builds a session entry from a server-side session
+func newSessionInfoResponse(info *subject.SessionInfo) sessionResponse {
+	return sessionResponse{
+		ID:             info.ID,
+		IssuedAt:       info.CreatedAt,
+		ExpiresAt:      info.ExpiresAt,
+		LastActivityAt: info.LastActivityAt,
+		IPAddress:      info.IPAddress,
+		UserAgent:      info.UserAgent,
+	}
+}
+
+// newSessionResponse builds a session entry from a stored token.
+// The raw token value is never exposed; a short fingerprint is used instead.
+func newSessionResponse(t *token.Token) sessionResponse {
+	id, ok := t.Metadata["token_id"].(string)
+	if !ok {
+		id = fingerprint(t.Value)
+	}
+
+	return sessionResponse{
+		ID:        id,
+		IssuedAt:  unixOrZero(t.IssuedAt),
+		ExpiresAt: unixOrZero(t.ExpiresAt),
+	}
+}
+
+// nonNil returns an empty slice instead of nil (renders as [] in JSON)
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// deviceResponse is an item of GET /devices
+type deviceResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Platform   string `json:"platform,omitempty"`
+	Trusted    bool   `json:"trusted"`
+	IPAddress  string `json:"ip_address,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	FirstSeen  int64  `json:"first_seen_at"`
+	LastSeenAt int64  `json:"last_seen_at"`
+}
+
+// newDeviceResponse builds a device response from a registered device
+func newDeviceResponse(d *subject.DeviceInfo) *deviceResponse {
+	return &deviceResponse{
+		ID:         d.ID,
+		Name:       d.Name,
+		Platform:   d.Platform,
+		Trusted:    d.Trusted,
+		IPAddress:  d.LastIPAddress,
+		UserAgent:  d.LastUserAgent,
+		FirstSeen:  d.FirstSeenAt,
+		LastSeenAt: d.LastSeenAt,
+	}
+}
@@ -0,0 +1,559 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/identitychange"
+	"github.com/primadi/lokstra-auth/notify"
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+var (
+	ErrIdentityChangeNotConfigured = autherrors.New(autherrors.ErrNotImplemented, "email and username changes are not configured")
+	ErrIdentityUnchanged           = autherrors.New(autherrors.ErrInvalidRequest, "the new value is the current one")
+	ErrIdentityTaken               = autherrors.New(autherrors.ErrConflict, "the new value is taken by another user")
+	ErrNoConfirmationAddress       = autherrors.New(autherrors.ErrConflict, "the user has no email address to confirm the change")
+	ErrIdentityChangeStale         = autherrors.New(autherrors.ErrConflict, "the user changed since the change was requested")
+	ErrNoPendingIdentityChange     = autherrors.New(autherrors.ErrNotFound, "no pending identity change")
+)
+
+// Notification types of email and username changes
+const (
+	NotificationConfirmEmailChange    = "email_change_confirmation"
+	NotificationConfirmUsernameChange = "username_change_confirmation"
+	NotificationEmailChangeRequested  = "email_change_requested"
+	NotificationIdentityChanged       = "identity_changed"
+)
+
+// RegisterIdentityChangeTemplates registers the default templates of email
+// and username change notifications in a registry and returns it. The data
+// has Field ("email" or "username"), Value (the new value) and Time;
+// confirmations have Token, Link (when IdentityChangeConfig.ConfirmURL is
+// set) and ExpiresAt.
+func RegisterIdentityChangeTemplates(registry *notify.Registry) *notify.Registry {
+	return registry.
+		Register(NotificationConfirmEmailChange, "", &notify.Template{
+			Subject: "Confirm your new email address",
+			Body: `Confirm {{.Value}} as the email address of your account{{if .Link}}: {{.Link}}{{else}} with this token: {{.Token}}{{end}}
+
+The confirmation expires on {{.ExpiresAt}}. Until then, your current email address keeps working.
+
+If you did not ask for this change, you can ignore this message.
+`,
+		}).
+		Register(NotificationConfirmUsernameChange, "", &notify.Template{
+			Subject: "Confirm your new username",
+			Body: `Confirm {{.Value}} as the username of your account{{if .Link}}: {{.Link}}{{else}} with this token: {{.Token}}{{end}}
+
+The confirmation expires on {{.ExpiresAt}}. Until then, sign in with your current username.
+
+If you did not ask for this change, sign in and cancel it, or contact your administrator.
+`,
+		}).
+		Register(NotificationEmailChangeRequested, "", &notify.Template{
+			Subject: "A change of your email address was requested",
+			Body: `A change of the email address of your account to {{.Value}} was requested on {{.Time}}. It applies once confirmed from the new address; until then, this address keeps working.
+
+If you did not ask for it, sign in and cancel the change, or contact your administrator.
+`,
+		}).
+		Register(NotificationIdentityChanged, "", &notify.Template{
+			Subject: "Your {{.Field}} was changed",
+			Body: `The {{.Field}} of your account was changed to {{.Value}} on {{.Time}}.
+
+If this was not you, contact your administrator right away.
+`,
+		})
+}
+
+// defaultIdentityChangeTemplates are the default templates of email and
+// username change notifications
+var defaultIdentityChangeTemplates = RegisterIdentityChangeTemplates(notify.NewRegistry(""))
+
+// IdentityChangeConfig configures email and username changes. A change is
+// applied once confirmed with the token sent to the new email address, or
+// to the current one for usernames; the old value keeps working until then.
+type IdentityChangeConfig struct {
+	// Store stores the pending changes (required)
+	Store identitychange.Store
+
+	// Sender delivers the confirmations and security notifications
+	// (required)
+	Sender notify.Sender
+
+	// Templates render the notifications (default: the templates of
+	// RegisterIdentityChangeTemplates)
+	Templates *notify.Registry
+
+	// ConfirmURL is the page confirming a change; the confirmation link is
+	// the URL with a "token" query parameter (optional: without it, the
+	// token itself is sent)
+	ConfirmURL string
+
+	// TokenTTL is the validity of a confirmation (default: 24 hours)
+	TokenTTL time.Duration
+
+	// Bus receives a SubjectChanged event for every applied change, so
+	// caches of other processes drop the identity of the user (optional)
+	Bus subject.InvalidationBus
+}
+
+func (c *IdentityChangeConfig) tokenTTL() time.Duration {
+	if c.TokenTTL <= 0 {
+		return 24 * time.Hour
+	}
+	return c.TokenTTL
+}
+
+func (c *IdentityChangeConfig) templates() *notify.Registry {
+	if c.Templates == nil {
+		return defaultIdentityChangeTemplates
+	}
+	return c.Templates
+}
+
+// link returns the confirmation link of a token ("" without ConfirmURL)
+func (c *IdentityChangeConfig) link(token string) (string, error) {
+	if c.ConfirmURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(c.ConfirmURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid confirmation URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// RequestEmailChange asks to change the email address of a user: a
+// confirmation is sent to the new address, and the current address is
+// notified. The user keeps its current address until the change is
+// confirmed (see ConfirmIdentityChange); a new request replaces the pending
+// one.
+func (a *Auth) RequestEmailChange(ctx context.Context, tenantID, userID, email string) (*identitychange.Change, error) {
+	return a.requestIdentityChange(ctx, tenantID, userID, identitychange.FieldEmail, email)
+}
+
+// RequestUsernameChange asks to change the username of a user: a
+// confirmation is sent to the email address of the user
+// (ErrNoConfirmationAddress if it has none). The user signs in with its
+// current username until the change is confirmed (see
+// ConfirmIdentityChange); a new request replaces the pending one.
+func (a *Auth) RequestUsernameChange(ctx context.Context, tenantID, userID, username string) (*identitychange.Change, error) {
+	return a.requestIdentityChange(ctx, tenantID, userID, identitychange.FieldUsername, username)
+}
+
+// PendingIdentityChanges returns the unexpired pending changes of a user
+func (a *Auth) PendingIdentityChanges(ctx context.Context, tenantID, userID string) ([]*identitychange.Change, error) {
+	config, err := a.identityChangeConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	changes, err := config.Store.ListChanges(ctx, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identity changes: %w", err)
+	}
+	now := time.Now()
+	pending := make([]*identitychange.Change, 0, len(changes))
+	for _, change := range changes {
+		if !change.Expired(now) {
+			pending = append(pending, change)
+		}
+	}
+	return pending, nil
+}
+
+// CancelIdentityChange cancels the pending change of a field of a user
+func (a *Auth) CancelIdentityChange(ctx context.Context, tenantID, userID string, field identitychange.Field) error {
+	config, err := a.identityChangeConfig()
+	if err != nil {
+		return err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	changes, err := a.PendingIdentityChanges(ctx, tenantID, userID)
+	if err != nil {
+		return err
+	}
+	err = fmt.Errorf("%w: %s", ErrNoPendingIdentityChange, field)
+	for _, change := range changes {
+		if change.Field == field {
+			err = config.Store.DeleteChange(ctx, tenantID, change.ID)
+		}
+	}
+	a.auditIdentityChange(ctx, audit.EventIdentityChangeCancelled, userID, "cancel_change", field, err)
+	return err
+}
+
+// ConfirmIdentityChange applies the pending change confirmed by a token and
+// returns the updated user. The token is single-use. In one step the user
+// is updated, its linked identities with the old email address get the new
+// one, and the cached identity contexts of the user are invalidated (the
+// identity context builder, the invalidation bus and the session
+// identities); if the linked identities cannot be updated, the user is
+// restored. Issued tokens keep the old claims until they are refreshed.
+func (a *Auth) ConfirmIdentityChange(ctx context.Context, tenantID, token string) (*tenant.User, error) {
+	config, err := a.identityChangeConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	change, err := config.Store.FindChange(ctx, tenantID, identitychange.Hash(token))
+	if err != nil {
+		return nil, err
+	}
+	if change.Expired(time.Now()) {
+		_ = config.Store.DeleteChange(ctx, tenantID, change.ID)
+		return nil, identitychange.ErrChangeExpired
+	}
+
+	// Deleting first makes the token single-use under concurrent calls
+	err = config.Store.DeleteChange(ctx, tenantID, change.ID)
+	var user *tenant.User
+	if err == nil {
+		user, err = a.applyIdentityChange(ctx, config, change)
+	}
+	a.auditIdentityChange(ctx, audit.EventIdentityChanged, change.UserID, "confirm_change", change.Field, err)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Publish(ctx, &events.Event{
+		Type:      events.UserIdentityChanged,
+		SubjectID: user.ID,
+		Data: map[string]any{
+			"field": string(change.Field),
+			"from":  change.OldValue,
+			"to":    change.NewValue,
+		},
+	})
+
+	// The old address (else the current one) learns of the change
+	notice := user.Email
+	if change.Field == identitychange.FieldEmail {
+		notice = change.OldValue
+	}
+	if notice != "" {
+		_ = a.sendIdentityChange(ctx, config, change, notice, NotificationIdentityChanged, nil)
+	}
+	return user, nil
+}
+
+// requestIdentityChange stores a pending change of a field of a user and
+// sends its confirmation
+func (a *Auth) requestIdentityChange(ctx context.Context, tenantID, userID string, field identitychange.Field, value string) (*identitychange.Change, error) {
+	config, err := a.identityChangeConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	user, err := a.users.GetUser(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	change, err := a.newIdentityChange(ctx, config, user, field, value)
+	if err == nil {
+		err = config.Store.SaveChange(ctx, change.Change)
+	}
+	if err == nil {
+		err = a.sendIdentityChange(ctx, config, change.Change, change.SentTo, change.notificationType, map[string]any{
+			"Token":     change.token,
+			"Link":      change.link,
+			"ExpiresAt": change.ExpiresAt.UTC().Format(time.RFC1123),
+		})
+		if err != nil {
+			_ = config.Store.DeleteChange(ctx, tenantID, change.ID)
+			err = fmt.Errorf("failed to send confirmation: %w", err)
+		}
+	}
+	a.auditIdentityChange(ctx, audit.EventIdentityChangeRequested, userID, "request_change", field, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// A failure to notify the current address does not fail the request
+	if field == identitychange.FieldEmail && user.Email != "" {
+		_ = a.sendIdentityChange(ctx, config, change.Change, user.Email, NotificationEmailChangeRequested, nil)
+	}
+	return change.Change, nil
+}
+
+// newChange is a change to store, with its token and where to send it
+type newChange struct {
+	*identitychange.Change
+	token            string
+	link             string
+	notificationType string
+}
+
+// newIdentityChange validates a new value of a field of a user and creates
+// the pending change
+func (a *Auth) newIdentityChange(ctx context.Context, config *IdentityChangeConfig, user *tenant.User, field identitychange.Field, value string) (*newChange, error) {
+	change := &newChange{Change: &identitychange.Change{
+		TenantID: user.TenantID,
+		UserID:   user.ID,
+		Field:    field,
+	}}
+
+	var err error
+	switch field {
+	case identitychange.FieldEmail:
+		value, err = identitychange.NormalizeEmail(value)
+		change.OldValue, change.SentTo = user.Email, value
+		change.notificationType = NotificationConfirmEmailChange
+	case identitychange.FieldUsername:
+		value, err = identitychange.NormalizeUsername(value)
+		change.OldValue, change.SentTo = user.Username, user.Email
+		change.notificationType = NotificationConfirmUsernameChange
+	default:
+		err = fmt.Errorf("%w: unknown field %q", identitychange.ErrInvalidValue, field)
+	}
+	switch {
+	case err != nil:
+		return nil, err
+	case value == change.OldValue:
+		return nil, ErrIdentityUnchanged
+	case change.SentTo == "":
+		return nil, ErrNoConfirmationAddress
+	}
+	if err := a.checkIdentityAvailable(ctx, user, field, value); err != nil {
+		return nil, err
+	}
+
+	if change.token, err = identitychange.NewToken(); err != nil {
+		return nil, err
+	}
+	if change.link, err = config.link(change.token); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	change.NewValue = value
+	change.Hash = identitychange.Hash(change.token)
+	change.CreatedAt = now
+	change.ExpiresAt = now.Add(config.tokenTTL())
+	if actorID := authz.ActorFromContext(ctx); actorID != user.ID {
+		change.ActorID = actorID
+	}
+	return change, nil
+}
+
+// checkIdentityAvailable rejects a new value of a field taken by another
+// user of the tenant. The store checks again when the change is applied.
+func (a *Auth) checkIdentityAvailable(ctx context.Context, user *tenant.User, field identitychange.Field, value string) error {
+	switch field {
+	case identitychange.FieldUsername:
+		other, err := a.users.GetUserByUsername(ctx, user.TenantID, value)
+		switch {
+		case errors.Is(err, tenant.ErrUserNotFound):
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed to look up username: %w", err)
+		case other.ID != user.ID:
+			return ErrIdentityTaken
+		}
+	case identitychange.FieldEmail:
+		users, _, err := a.users.ListUsers(ctx, user.TenantID, tenant.ListOptions{Search: value})
+		if err != nil {
+			return fmt.Errorf("failed to look up email: %w", err)
+		}
+		for _, other := range users {
+			if other.ID != user.ID && strings.EqualFold(other.Email, value) {
+				return ErrIdentityTaken
+			}
+		}
+	}
+	return nil
+}
+
+// applyIdentityChange updates the user and its linked identities, restoring
+// the user if the identities cannot be updated, then invalidates the cached
+// identity contexts of the user
+func (a *Auth) applyIdentityChange(ctx context.Context, config *IdentityChangeConfig, change *identitychange.Change) (*tenant.User, error) {
+	user, err := a.users.GetUser(ctx, change.TenantID, change.UserID)
+	if err != nil {
+		return nil, err
+	}
+	previous := *user
+
+	switch change.Field {
+	case identitychange.FieldEmail:
+		if user.Email != change.OldValue {
+			return nil, ErrIdentityChangeStale
+		}
+		user.Email = change.NewValue
+	case identitychange.FieldUsername:
+		if user.Username != change.OldValue {
+			return nil, ErrIdentityChangeStale
+		}
+		user.Username = change.NewValue
+	}
+	if err := a.users.UpdateUser(ctx, user); err != nil {
+		if errors.Is(err, tenant.ErrUserExists) {
+			return nil, fmt.Errorf("%w: %w", ErrIdentityTaken, err)
+		}
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := a.relinkIdentities(ctx, change); err != nil {
+		if restoreErr := a.users.UpdateUser(ctx, &previous); restoreErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to restore user: %w", restoreErr))
+		}
+		return nil, err
+	}
+
+	a.invalidateIdentity(ctx, config, change)
+	return a.users.GetUser(ctx, change.TenantID, change.UserID)
+}
+
+// relinkIdentities moves the linked identities of the user with the old
+// email address to the new one. On failure the identities already moved
+// are moved back.
+func (a *Auth) relinkIdentities(ctx context.Context, change *identitychange.Change) error {
+	if a.userIdentities == nil || change.Field != identitychange.FieldEmail || change.OldValue == "" {
+		return nil
+	}
+
+	identities, err := a.userIdentities.ListByUser(ctx, change.TenantID, change.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to list identities: %w", err)
+	}
+	var moved []*subject.UserIdentity
+	for _, identity := range identities {
+		if !strings.EqualFold(identity.Email, change.OldValue) {
+			continue
+		}
+		updated := *identity
+		updated.Email = change.NewValue
+		if err := a.userIdentities.Link(ctx, &updated); err != nil {
+			for _, original := range moved {
+				_ = a.userIdentities.Link(ctx, original)
+			}
+			return fmt.Errorf("failed to update identity: %w", err)
+		}
+		moved = append(moved, identity)
+	}
+	return nil
+}
+
+// invalidateSubject drops the cached identity contexts of a subject from
+// the cache of the identity context builder and, with a bus, from the
+// caches listening on it
+func (a *Auth) invalidateSubject(ctx context.Context, bus subject.InvalidationBus, subjectID, reason string) {
+	builder := a.contextBuilder
+	if swappable, ok := builder.(*subject.SwappableContextBuilder); ok {
+		builder = swappable.Current()
+	}
+	if cache, ok := builder.(interface {
+		Invalidate(ctx context.Context, subjectID string) error
+	}); ok {
+		_ = cache.Invalidate(ctx, subjectID)
+	}
+
+	if bus != nil {
+		bus.Publish(ctx, subject.ChangeEvent{
+			Kind:      subject.SubjectChanged,
+			SubjectID: subjectID,
+			Reason:    reason,
+		})
+	}
+}
+
+// invalidateIdentity drops the cached identity contexts of the user of an
+// applied change (see invalidateSubject), and updates the principal and
+// attribute of the field in its session identities
+func (a *Auth) invalidateIdentity(ctx context.Context, config *IdentityChangeConfig, change *identitychange.Change) {
+	a.invalidateSubject(ctx, config.Bus, change.UserID, string(change.Field)+"_changed")
+
+	// Session identities are refreshed best effort: sessions of stores that
+	// cannot list them pick the change up with their next token
+	if change.OldValue == "" {
+		return
+	}
+	identities, _ := a.listSessionIdentities(ctx, change.UserID)
+	for _, identity := range identities {
+		sub := identity.Subject
+		if sub == nil {
+			continue
+		}
+		updated := false
+		if sub.Principal == change.OldValue {
+			sub.Principal = change.NewValue
+			updated = true
+		}
+		if value, ok := sub.Attributes[string(change.Field)].(string); ok && value == change.OldValue {
+			sub.Attributes[string(change.Field)] = change.NewValue
+			updated = true
+		}
+		if updated {
+			_ = a.identityStore.Update(ctx, identity.Session.ID, identity)
+		}
+	}
+}
+
+// identityChangeConfig returns the identity change configuration, which
+// requires a user store
+func (a *Auth) identityChangeConfig() (*IdentityChangeConfig, error) {
+	config := a.config.IdentityChange
+	if config == nil || config.Store == nil || config.Sender == nil {
+		return nil, ErrIdentityChangeNotConfigured
+	}
+	if a.users == nil {
+		return nil, ErrNoUserStore
+	}
+	return config, nil
+}
+
+// sendIdentityChange renders and sends a notification of a change to an
+// email address
+func (a *Auth) sendIdentityChange(ctx context.Context, config *IdentityChangeConfig, change *identitychange.Change, address, notificationType string, data map[string]any) error {
+	message := make(map[string]any, len(data)+3)
+	for k, v := range data {
+		message[k] = v
+	}
+	message["Field"] = string(change.Field)
+	message["Value"] = change.NewValue
+	message["Time"] = time.Now().UTC().Format(time.RFC1123)
+
+	return notify.Notify(ctx, config.Sender, config.templates(), &notify.Notification{
+		Type:      notificationType,
+		TenantID:  change.TenantID,
+		Locale:    notify.LocaleFromContext(ctx),
+		SubjectID: change.UserID,
+		Recipient: address,
+		Data:      message,
+	})
+}
+
+// auditIdentityChange records an identity change operation of a user, by
+// the actor of the context (else the user)
+func (a *Auth) auditIdentityChange(ctx context.Context, eventType, userID, action string, field identitychange.Field, err error) {
+	actorID := authz.ActorFromContext(ctx)
+	if actorID == "" {
+		actorID = userID
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: eventType,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Resource:  "user:" + userID,
+		Action:    action,
+		Result:    auditResult(err),
+		Metadata:  auditMetadata(err, "field", string(field)),
+	})
+}
@@ -0,0 +1,131 @@
+// Package identitychange holds the pending changes of the email address or
+// username of users. A change is applied only once it is confirmed with the
+// token sent to the new address (to the current address for usernames), so
+// the old value keeps working until then. The Auth runtime drives the flow
+// (see lokstraauth.Auth.RequestEmailChange); tokens are stored hashed.
+package identitychange
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrChangeNotFound = autherrors.New(autherrors.ErrInvalidCredentials, "identity change not found")
+	ErrChangeExpired  = autherrors.New(autherrors.ErrInvalidCredentials, "identity change expired")
+	ErrInvalidValue   = autherrors.New(autherrors.ErrInvalidRequest, "invalid identity value")
+)
+
+// Field is the user field a change applies to
+type Field string
+
+const (
+	FieldEmail    Field = "email"
+	FieldUsername Field = "username"
+)
+
+// Change is a pending change of a user field. Only the hash of its token is
+// stored.
+type Change struct {
+	ID       string `json:"id"`
+	Hash     string `json:"-"`
+	TenantID string `json:"tenant_id"`
+	UserID   string `json:"user_id"`
+	Field    Field  `json:"field"`
+
+	// OldValue is the value when the change was requested; the change is
+	// not applied if the field changed meanwhile
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+
+	// SentTo is the address the confirmation token was sent to
+	SentTo string `json:"sent_to"`
+
+	// ActorID is who requested the change, when not the user (e.g., an
+	// admin)
+	ActorID string `json:"actor_id,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the change expired at a time
+func (c *Change) Expired(at time.Time) bool {
+	return !at.Before(c.ExpiresAt)
+}
+
+// Store stores the pending identity changes of users
+type Store interface {
+	// SaveChange stores a change, replacing the pending change of the user
+	// for the same field. An empty ID is generated.
+	SaveChange(ctx context.Context, change *Change) error
+
+	// FindChange returns the change with the hash of a token in a tenant
+	// (ErrChangeNotFound)
+	FindChange(ctx context.Context, tenantID, hash string) (*Change, error)
+
+	// ListChanges returns the pending changes of a user ordered by
+	// creation, expired or not
+	ListChanges(ctx context.Context, tenantID, userID string) ([]*Change, error)
+
+	// DeleteChange removes a change (ErrChangeNotFound). A change is
+	// deleted once, even by concurrent calls, which makes confirmation
+	// single-use.
+	DeleteChange(ctx context.Context, tenantID, changeID string) error
+
+	// DeleteUser removes the pending changes of a user and returns their
+	// number
+	DeleteUser(ctx context.Context, tenantID, userID string) (int, error)
+}
+
+// NewToken generates the confirmation token of a change
+func NewToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Hash returns the hash stored for a token
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeEmail validates an email address and returns it lowercase
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 || strings.ContainsAny(email, " \t\r\n") {
+		return "", fmt.Errorf("%w: invalid email address", ErrInvalidValue)
+	}
+	return email, nil
+}
+
+// NormalizeUsername validates a username and returns it trimmed: 1 to 128
+// characters without spaces or control characters
+func NormalizeUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || len(username) > 128 {
+		return "", fmt.Errorf("%w: usernames have 1 to 128 characters", ErrInvalidValue)
+	}
+	if strings.ContainsFunc(username, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return "", fmt.Errorf("%w: usernames cannot contain spaces", ErrInvalidValue)
+	}
+	return username, nil
+}
+
+func newID() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
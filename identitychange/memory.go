@@ -0,0 +1,103 @@
+package identitychange
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// InMemoryStore is an in-memory implementation of Store
+type InMemoryStore struct {
+	mu      sync.Mutex
+	changes map[string]*Change // tenantID + "/" + changeID -> change
+}
+
+var _ Store = (*InMemoryStore)(nil)
+
+// NewInMemoryStore creates a new in-memory identity change store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		changes: make(map[string]*Change),
+	}
+}
+
+// SaveChange stores a change, replacing the pending change of the user for
+// the same field
+func (s *InMemoryStore) SaveChange(ctx context.Context, change *Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, existing := range s.changes {
+		if existing.TenantID == change.TenantID && existing.UserID == change.UserID &&
+			existing.Field == change.Field && existing.ID != change.ID {
+			delete(s.changes, k)
+		}
+	}
+	if change.ID == "" {
+		change.ID = newID()
+	}
+	copied := *change
+	s.changes[key(change.TenantID, change.ID)] = &copied
+	return nil
+}
+
+// FindChange returns the change with the hash of a token in a tenant
+func (s *InMemoryStore) FindChange(ctx context.Context, tenantID, hash string) (*Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, change := range s.changes {
+		if change.TenantID == tenantID && change.Hash == hash {
+			copied := *change
+			return &copied, nil
+		}
+	}
+	return nil, ErrChangeNotFound
+}
+
+// ListChanges returns the pending changes of a user ordered by creation
+func (s *InMemoryStore) ListChanges(ctx context.Context, tenantID, userID string) ([]*Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []*Change
+	for _, change := range s.changes {
+		if change.TenantID == tenantID && change.UserID == userID {
+			copied := *change
+			changes = append(changes, &copied)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].CreatedAt.Before(changes[j].CreatedAt) })
+	return changes, nil
+}
+
+// DeleteChange removes a change
+func (s *InMemoryStore) DeleteChange(ctx context.Context, tenantID, changeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.changes[key(tenantID, changeID)]; !ok {
+		return ErrChangeNotFound
+	}
+	delete(s.changes, key(tenantID, changeID))
+	return nil
+}
+
+// DeleteUser removes the pending changes of a user
+func (s *InMemoryStore) DeleteUser(ctx context.Context, tenantID, userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for k, change := range s.changes {
+		if change.TenantID == tenantID && change.UserID == userID {
+			delete(s.changes, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func key(tenantID, id string) string {
+	return tenantID + "/" + id
+}
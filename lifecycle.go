@@ -0,0 +1,151 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+var (
+	ErrNoUserStore        = autherrors.New(autherrors.ErrNotImplemented, "no user store configured")
+	ErrAccountPending     = autherrors.New(autherrors.ErrAccountDisabled, "account is not activated")
+	ErrAccountSuspended   = autherrors.New(autherrors.ErrAccountDisabled, "account is suspended")
+	ErrAccountDeactivated = autherrors.New(autherrors.ErrAccountDisabled, "account is deactivated")
+)
+
+// SetUserStore sets the store of tenant users. Login and token
+// verification then enforce the lifecycle status of users (see
+// tenant.UserStatus): only active users sign in, whatever the
+// authenticator, and the tokens of users that are no longer active stop
+// working. Verification reads the user on every call; wrap the store with a
+// cache on hot paths.
+func (a *Auth) SetUserStore(store tenant.UserStore) {
+	a.users = store
+}
+
+// GetUserStore returns the store of tenant users (nil if not configured)
+func (a *Auth) GetUserStore() tenant.UserStore {
+	return a.users
+}
+
+// UserStatusChange moves a user to a lifecycle status (see SetUserStatus)
+type UserStatusChange struct {
+	// TenantID and UserID select the user
+	TenantID string
+	UserID   string
+
+	// Status is the new status
+	Status tenant.UserStatus
+
+	// Reason explains the change, e.g. to other admins (optional)
+	Reason string
+
+	// ActorID is who changes the status, e.g. an admin (optional, recorded
+	// in the audit log)
+	ActorID string
+}
+
+// SetUserStatus moves a user to a lifecycle status (tenant.ErrInvalidTransition
+// if its current status cannot move to it), records the change in the
+// audit log and publishes it. Suspending or deactivating a user also signs
+// it out everywhere (see LogoutAll) when the token manager supports
+// revocation.
+func (a *Auth) SetUserStatus(ctx context.Context, change *UserStatusChange) (*tenant.User, error) {
+	if a.users == nil {
+		return nil, ErrNoUserStore
+	}
+	ctx = authz.WithTenant(ctx, change.TenantID)
+
+	user, err := a.users.GetUser(ctx, change.TenantID, change.UserID)
+	if err != nil {
+		return nil, err
+	}
+	from := user.EffectiveStatus()
+	user, err = tenant.SetUserStatus(ctx, a.users, change.TenantID, change.UserID, change.Status, change.Reason)
+	switch {
+	case errors.Is(err, tenant.ErrInvalidStatus):
+		err = autherrors.Wrap(autherrors.ErrInvalidRequest, err)
+	case errors.Is(err, tenant.ErrInvalidTransition):
+		err = autherrors.Wrap(autherrors.ErrConflict, err)
+	}
+
+	metadata := auditMetadata(err, "from", string(from))
+	metadata["to"] = string(change.Status)
+	if change.Reason != "" {
+		metadata["reason"] = change.Reason
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventUserStatusChanged,
+		ActorID:   change.ActorID,
+		SubjectID: change.UserID,
+		Resource:  "user:" + change.UserID,
+		Action:    "set_status",
+		Result:    auditResult(err),
+		Metadata:  metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.Publish(ctx, &events.Event{
+		Type:      events.UserStatusChanged,
+		SubjectID: change.UserID,
+		Data:      map[string]any{"from": string(from), "to": string(change.Status), "reason": change.Reason},
+	})
+
+	// Signing out is best effort: verification rejects the tokens anyway
+	if !user.CanAuthenticate() {
+		_ = a.LogoutAll(ctx, change.TenantID, change.UserID)
+	}
+	return user, nil
+}
+
+// checkUserStatus rejects subjects that are users of the tenant not in the
+// active status. Subjects that are not users of the store (e.g., service
+// accounts) pass.
+func (a *Auth) checkUserStatus(ctx context.Context, tenantID, subjectID string) error {
+	if a.users == nil || tenantID == "" || subjectID == "" {
+		return nil
+	}
+
+	user, err := a.users.GetUser(ctx, tenantID, subjectID)
+	if errors.Is(err, tenant.ErrUserNotFound) || errors.Is(err, tenant.ErrTenantNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	switch user.EffectiveStatus() {
+	case tenant.UserActive:
+		return nil
+	case tenant.UserPending:
+		return ErrAccountPending
+	case tenant.UserDeactivated:
+		return ErrAccountDeactivated
+	default:
+		return ErrAccountSuspended
+	}
+}
+
+// checkTokenUser checks the status of the user of verified claims, in the
+// tenant of the claims or else of the context. System tokens have no user.
+func (a *Auth) checkTokenUser(ctx context.Context, claims token.Claims) error {
+	if a.users == nil || claims.IsSystem() {
+		return nil
+	}
+
+	tenantID, _ := claims.Tenant()
+	if tenantID == "" {
+		tenantID = authz.TenantFromContext(ctx)
+	}
+	subjectID, _ := claims.GetString("sub")
+	return a.checkUserStatus(ctx, tenantID, subjectID)
+}
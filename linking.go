@@ -0,0 +1,270 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+var (
+	ErrNoUserIdentityStore = errors.New("no user identity store configured")
+	ErrLastIdentity        = errors.New("cannot unlink the last identity of a user")
+	ErrAccountLinkConflict = errors.New("verified email matches a conflicting account")
+)
+
+// LinkConflictPolicy decides what happens when a login matches several
+// accounts by verified email
+type LinkConflictPolicy string
+
+const (
+	// LinkConflictReject fails the login with ErrAccountLinkConflict
+	LinkConflictReject LinkConflictPolicy = "reject"
+
+	// LinkConflictSeparate keeps the identity as a separate account
+	LinkConflictSeparate LinkConflictPolicy = "separate"
+)
+
+// AccountLinkingConfig configures login-time account linking
+type AccountLinkingConfig struct {
+	// AutoLinkVerifiedEmail links a new identity to the existing account with
+	// the same verified email address (both providers must have verified it)
+	AutoLinkVerifiedEmail bool
+
+	// OnConflict applies when the email matches several accounts, or an
+	// account that already has another identity of the same provider
+	// (default: LinkConflictReject)
+	OnConflict LinkConflictPolicy
+
+	// ProviderOf names the provider of an authentication result (default:
+	// the credential type, plus the "provider" claim, e.g., "oauth2:google")
+	ProviderOf func(credType string, result *credential.AuthenticationResult) string
+}
+
+// SetUserIdentityStore sets the store of identities linked to users
+func (a *Auth) SetUserIdentityStore(store subject.UserIdentityStore) {
+	a.userIdentities = store
+}
+
+// GetUserIdentityStore returns the user identity store (nil if not configured)
+func (a *Auth) GetUserIdentityStore() subject.UserIdentityStore {
+	return a.userIdentities
+}
+
+// LinkIdentity verifies a second credential (e.g., a Google OAuth2 token)
+// and links its identity to an existing user of a tenant, so the user can
+// log in with either. Linking an identity that is already linked to the user
+// is a no-op; an identity linked to another user of the tenant fails with
+// subject.ErrIdentityLinked.
+func (a *Auth) LinkIdentity(ctx context.Context, tenantID, userID string, creds credential.Credentials) (*subject.UserIdentity, error) {
+	if a.userIdentities == nil {
+		return nil, ErrNoUserIdentityStore
+	}
+	if userID == "" {
+		return nil, ErrMissingSubject
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	credType := creds.Type()
+	authenticator, err := a.authenticator(ctx, credType)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := inLayer(ctx, a, LayerAuthenticator, "authenticate "+credType,
+		func(ctx context.Context) (*credential.AuthenticationResult, error) {
+			return authenticator.Authenticate(ctx, creds)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("authentication error: %w", err)
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("%w: %v", ErrAuthenticationFailed, result.Error)
+	}
+
+	identity := a.userIdentity(tenantID, userID, credType, result)
+
+	existing, err := query(ctx, a, "user_identity", "find identity",
+		func(ctx context.Context) (*subject.UserIdentity, error) {
+			return a.userIdentities.Find(ctx, tenantID, identity.Provider, identity.ProviderSubject)
+		})
+	switch {
+	case err == nil && existing.UserID == userID:
+		return existing, nil
+	case err == nil:
+		return nil, subject.ErrIdentityLinked
+	case !errors.Is(err, subject.ErrUserIdentityNotFound):
+		return nil, err
+	}
+
+	if err := a.exec(ctx, "user_identity", "link identity", func(ctx context.Context) error {
+		return a.userIdentities.Link(ctx, identity)
+	}); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// UnlinkIdentity removes an identity of a user of a tenant. The last
+// identity of a user cannot be unlinked (ErrLastIdentity), so the account
+// stays reachable.
+func (a *Auth) UnlinkIdentity(ctx context.Context, tenantID, userID, provider, providerSubject string) error {
+	if a.userIdentities == nil {
+		return ErrNoUserIdentityStore
+	}
+
+	identities, err := a.LinkedIdentities(ctx, tenantID, userID)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, identity := range identities {
+		if identity.Provider == provider && identity.ProviderSubject == providerSubject {
+			found = true
+		}
+	}
+	if !found {
+		return subject.ErrUserIdentityNotFound
+	}
+	if len(identities) == 1 {
+		return ErrLastIdentity
+	}
+
+	return a.exec(ctx, "user_identity", "unlink identity", func(ctx context.Context) error {
+		return a.userIdentities.Unlink(ctx, tenantID, userID, provider, providerSubject)
+	})
+}
+
+// LinkedIdentities returns the identities linked to a user of a tenant
+func (a *Auth) LinkedIdentities(ctx context.Context, tenantID, userID string) ([]*subject.UserIdentity, error) {
+	if a.userIdentities == nil {
+		return nil, ErrNoUserIdentityStore
+	}
+	return query(ctx, a, "user_identity", "list identities",
+		func(ctx context.Context) ([]*subject.UserIdentity, error) {
+			return a.userIdentities.ListByUser(ctx, tenantID, userID)
+		})
+}
+
+// resolveLinkedUser maps the authenticated identity of a login to the user
+// of the login tenant (authz.WithTenant) it is linked to. Unknown identities
+// are linked to the account of the tenant with the same verified email (if
+// enabled) or recorded as their own account; identities of other tenants
+// are never considered.
+func (a *Auth) resolveLinkedUser(ctx context.Context, credType string, result *credential.AuthenticationResult) (*credential.AuthenticationResult, error) {
+	if a.userIdentities == nil || result == nil || !result.Success || result.Subject == "" {
+		return result, nil
+	}
+
+	tenantID := authz.TenantFromContext(ctx)
+	identity := a.userIdentity(tenantID, result.Subject, credType, result)
+
+	existing, err := query(ctx, a, "user_identity", "find identity",
+		func(ctx context.Context) (*subject.UserIdentity, error) {
+			return a.userIdentities.Find(ctx, tenantID, identity.Provider, identity.ProviderSubject)
+		})
+	if err == nil {
+		return asLinkedUser(result, existing), nil
+	}
+	if !errors.Is(err, subject.ErrUserIdentityNotFound) {
+		return nil, err
+	}
+
+	// First login with this identity
+	if userID, err := a.matchVerifiedEmail(ctx, identity); err != nil {
+		return nil, err
+	} else if userID != "" {
+		identity.UserID = userID
+	}
+
+	if err := a.exec(ctx, "user_identity", "link identity", func(ctx context.Context) error {
+		return a.userIdentities.Link(ctx, identity)
+	}); err != nil {
+		return nil, err
+	}
+	return asLinkedUser(result, identity), nil
+}
+
+// matchVerifiedEmail returns the account of the tenant of a new identity it
+// is linked to by verified email ("" for a separate account)
+func (a *Auth) matchVerifiedEmail(ctx context.Context, identity *subject.UserIdentity) (string, error) {
+	linking := a.config.AccountLinking
+	if linking == nil || !linking.AutoLinkVerifiedEmail || !identity.EmailVerified || identity.Email == "" {
+		return "", nil
+	}
+
+	matches, err := query(ctx, a, "user_identity", "find identities by email",
+		func(ctx context.Context) ([]*subject.UserIdentity, error) {
+			return a.userIdentities.FindByVerifiedEmail(ctx, identity.TenantID, identity.Email)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	userID := ""
+	conflict := false
+	for _, match := range matches {
+		if userID != "" && match.UserID != userID {
+			conflict = true
+		}
+		if match.Provider == identity.Provider {
+			// The account already has another identity of this provider
+			conflict = true
+		}
+		userID = match.UserID
+	}
+
+	if !conflict {
+		return userID, nil
+	}
+	if linking.OnConflict == LinkConflictSeparate {
+		return "", nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrAccountLinkConflict, identity.Email)
+}
+
+// userIdentity builds the identity of an authentication result in a tenant
+func (a *Auth) userIdentity(tenantID, userID, credType string, result *credential.AuthenticationResult) *subject.UserIdentity {
+	provider := credType
+	if a.config.AccountLinking != nil && a.config.AccountLinking.ProviderOf != nil {
+		provider = a.config.AccountLinking.ProviderOf(credType, result)
+	} else if name, ok := result.Claims["provider"].(string); ok && name != "" {
+		provider = credType + ":" + name
+	}
+
+	email, _ := result.Claims["email"].(string)
+	verified, _ := result.Claims["email_verified"].(bool)
+
+	return &subject.UserIdentity{
+		TenantID:        tenantID,
+		UserID:          userID,
+		Provider:        provider,
+		ProviderSubject: result.Subject,
+		Email:           email,
+		EmailVerified:   verified,
+		LinkedAt:        time.Now(),
+	}
+}
+
+// asLinkedUser returns the result with the linked user as subject. The
+// provider identity is kept in the "idp" and "idp_sub" claims.
+func asLinkedUser(result *credential.AuthenticationResult, identity *subject.UserIdentity) *credential.AuthenticationResult {
+	if identity.UserID == result.Subject {
+		return result
+	}
+
+	linked := *result
+	linked.Subject = identity.UserID
+	linked.Claims = make(map[string]any, len(result.Claims)+3)
+	maps.Copy(linked.Claims, result.Claims)
+	linked.Claims["sub"] = identity.UserID
+	linked.Claims["idp"] = identity.Provider
+	linked.Claims["idp_sub"] = identity.ProviderSubject
+	return &linked
+}
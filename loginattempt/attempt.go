@@ -0,0 +1,302 @@
+// Package loginattempt records login attempts (successful and failed, with
+// the client, the authenticator and the failure reason) and answers the
+// queries of the account lockout policy and of risk checks: recent
+// failures of an account or IP address, known addresses and clients, the
+// last successful login.
+package loginattempt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Attempt is a login attempt
+type Attempt struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id,omitempty"`
+	AppID    string `json:"app_id,omitempty"`
+
+	// Account is the account the credentials name (e.g., the username),
+	// when the credentials name one
+	Account string `json:"account,omitempty"`
+
+	// SubjectID is the authenticated subject (successful attempts)
+	SubjectID string `json:"subject_id,omitempty"`
+
+	// Authenticator is the credential type ("basic", "passwordless", ...)
+	Authenticator string `json:"authenticator"`
+
+	Success bool `json:"success"`
+
+	// FailureReason is the error code of a failed attempt (e.g.,
+	// "invalid_credentials", "rate_limited")
+	FailureReason string `json:"failure_reason,omitempty"`
+
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// Country (ISO 3166-1 alpha-2) and City are the resolved location of
+	// the client IP address of successful attempts, when known
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Outcome selects attempts by result
+type Outcome int
+
+const (
+	// OutcomeAny selects successful and failed attempts
+	OutcomeAny Outcome = iota
+	OutcomeSuccess
+	OutcomeFailure
+)
+
+// Query selects login attempts. Empty fields match any attempt.
+type Query struct {
+	TenantID  string
+	AppID     string
+	Account   string
+	SubjectID string
+	IPAddress string
+	Outcome   Outcome
+
+	// FailureReason selects failed attempts with this reason
+	FailureReason string
+
+	// Since and Until bound the attempt time (Since inclusive, Until
+	// exclusive)
+	Since time.Time
+	Until time.Time
+
+	// Limit is the maximum number of attempts returned (0 for all)
+	Limit int
+}
+
+// Matches reports whether an attempt is selected by the query
+func (q *Query) Matches(attempt *Attempt) bool {
+	switch {
+	case q.TenantID != "" && attempt.TenantID != q.TenantID,
+		q.AppID != "" && attempt.AppID != q.AppID,
+		q.Account != "" && attempt.Account != q.Account,
+		q.SubjectID != "" && attempt.SubjectID != q.SubjectID,
+		q.IPAddress != "" && attempt.IPAddress != q.IPAddress,
+		q.Outcome == OutcomeSuccess && !attempt.Success,
+		q.Outcome == OutcomeFailure && attempt.Success,
+		q.FailureReason != "" && attempt.FailureReason != q.FailureReason,
+		!q.Since.IsZero() && attempt.Timestamp.Before(q.Since),
+		!q.Until.IsZero() && !attempt.Timestamp.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// Store stores login attempts
+type Store interface {
+	// Record stores an attempt, with a new ID when it has none
+	Record(ctx context.Context, attempt *Attempt) error
+
+	// List returns the attempts selected by a query, newest first
+	List(ctx context.Context, query *Query) ([]*Attempt, error)
+
+	// Count returns the number of attempts selected by a query (ignoring
+	// its limit)
+	Count(ctx context.Context, query *Query) (int, error)
+
+	// CleanupOld deletes attempts older than before and returns how many
+	// were deleted
+	CleanupOld(ctx context.Context, before time.Time) (int, error)
+}
+
+// Deleter is a Store that deletes the attempts selected by a query, e.g.
+// the attempts of a user being erased
+type Deleter interface {
+	// Delete deletes the attempts selected by a query (ignoring its limit)
+	// and returns how many were deleted
+	Delete(ctx context.Context, query *Query) (int, error)
+}
+
+// Summary summarizes the login attempts selected by a query, as input to
+// risk checks (e.g., a login from an address never seen for the account,
+// or after many failures)
+type Summary struct {
+	Successes int
+	Failures  int
+
+	// ConsecutiveFailures counts the failures since the last success
+	ConsecutiveFailures int
+
+	LastSuccess *Attempt
+	LastFailure *Attempt
+
+	// IPAddresses, UserAgents and Countries are the distinct clients and
+	// locations of successful attempts
+	IPAddresses []string
+	UserAgents  []string
+	Countries   []string
+}
+
+// KnownIP reports whether an IP address logged in successfully before
+func (s *Summary) KnownIP(ip string) bool {
+	return slices.Contains(s.IPAddresses, ip)
+}
+
+// KnownUserAgent reports whether a user agent logged in successfully before
+func (s *Summary) KnownUserAgent(userAgent string) bool {
+	return slices.Contains(s.UserAgents, userAgent)
+}
+
+// KnownCountry reports whether a country logged in successfully before
+func (s *Summary) KnownCountry(country string) bool {
+	return slices.Contains(s.Countries, country)
+}
+
+// Summarize summarizes the attempts selected by a query
+func Summarize(ctx context.Context, store Store, query *Query) (*Summary, error) {
+	attempts, err := store.List(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{}
+	// Attempts are listed newest first
+	for _, attempt := range attempts {
+		if !attempt.Success {
+			summary.Failures++
+			if summary.LastFailure == nil {
+				summary.LastFailure = attempt
+			}
+			if summary.LastSuccess == nil {
+				summary.ConsecutiveFailures++
+			}
+			continue
+		}
+
+		summary.Successes++
+		if summary.LastSuccess == nil {
+			summary.LastSuccess = attempt
+		}
+		if attempt.IPAddress != "" && !slices.Contains(summary.IPAddresses, attempt.IPAddress) {
+			summary.IPAddresses = append(summary.IPAddresses, attempt.IPAddress)
+		}
+		if attempt.UserAgent != "" && !slices.Contains(summary.UserAgents, attempt.UserAgent) {
+			summary.UserAgents = append(summary.UserAgents, attempt.UserAgent)
+		}
+		if attempt.Country != "" && !slices.Contains(summary.Countries, attempt.Country) {
+			summary.Countries = append(summary.Countries, attempt.Country)
+		}
+	}
+	return summary, nil
+}
+
+// InMemoryStore is an in-memory implementation of Store
+type InMemoryStore struct {
+	mu       sync.RWMutex
+	attempts []*Attempt // oldest first
+}
+
+// NewInMemoryStore creates a new in-memory login attempt store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{}
+}
+
+// Record stores an attempt
+func (s *InMemoryStore) Record(ctx context.Context, attempt *Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *attempt
+	if copied.ID == "" {
+		copied.ID = newID()
+	}
+	s.attempts = append(s.attempts, &copied)
+	// Keep the attempts ordered when recorded out of order
+	if n := len(s.attempts); n > 1 && copied.Timestamp.Before(s.attempts[n-2].Timestamp) {
+		sort.SliceStable(s.attempts, func(i, j int) bool {
+			return s.attempts[i].Timestamp.Before(s.attempts[j].Timestamp)
+		})
+	}
+	return nil
+}
+
+// List returns the attempts selected by a query, newest first
+func (s *InMemoryStore) List(ctx context.Context, query *Query) ([]*Attempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var attempts []*Attempt
+	for i := len(s.attempts) - 1; i >= 0; i-- {
+		if !query.Matches(s.attempts[i]) {
+			continue
+		}
+		copied := *s.attempts[i]
+		attempts = append(attempts, &copied)
+		if query.Limit > 0 && len(attempts) == query.Limit {
+			break
+		}
+	}
+	return attempts, nil
+}
+
+// Count returns the number of attempts selected by a query
+func (s *InMemoryStore) Count(ctx context.Context, query *Query) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, attempt := range s.attempts {
+		if query.Matches(attempt) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CleanupOld deletes attempts older than before
+func (s *InMemoryStore) CleanupOld(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.attempts[:0]
+	for _, attempt := range s.attempts {
+		if attempt.Timestamp.Before(before) {
+			continue
+		}
+		kept = append(kept, attempt)
+	}
+	deleted := len(s.attempts) - len(kept)
+	clear(s.attempts[len(kept):])
+	s.attempts = kept
+	return deleted, nil
+}
+
+// Delete deletes the attempts selected by a query
+func (s *InMemoryStore) Delete(ctx context.Context, query *Query) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.attempts[:0]
+	for _, attempt := range s.attempts {
+		if query.Matches(attempt) {
+			continue
+		}
+		kept = append(kept, attempt)
+	}
+	deleted := len(s.attempts) - len(kept)
+	clear(s.attempts[len(kept):])
+	s.attempts = kept
+	return deleted, nil
+}
+
+// newID returns a random attempt ID
+func newID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,83 @@
+package loginattempt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidRetention = errors.New("invalid login attempt retention")
+)
+
+// RetentionConfig holds retention job configuration
+type RetentionConfig struct {
+	// MaxAge is how long attempts are kept (required). Keep it longer than
+	// the lockout window and the history risk checks look at.
+	MaxAge time.Duration
+
+	// Interval is how often old attempts are deleted (default: 1 hour)
+	Interval time.Duration
+
+	// OnCleanup is called with the number of deleted attempts (optional)
+	OnCleanup func(deleted int)
+
+	// OnError is called when a cleanup fails (optional)
+	OnError func(err error)
+
+	// Now returns the current time (default: time.Now)
+	Now func() time.Time
+}
+
+// RetentionJob deletes login attempts older than the retention period
+type RetentionJob struct {
+	store  Store
+	config *RetentionConfig
+}
+
+// NewRetentionJob creates a retention job. Call Run to start it.
+func NewRetentionJob(store Store, config *RetentionConfig) (*RetentionJob, error) {
+	if config == nil || config.MaxAge <= 0 {
+		return nil, fmt.Errorf("%w: max age is required", ErrInvalidRetention)
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &RetentionJob{store: store, config: config}, nil
+}
+
+// Run deletes old attempts now and then every interval until the context
+// is done. Errors are reported to OnError.
+func (j *RetentionJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.Cleanup(ctx); err != nil && j.config.OnError != nil {
+			j.config.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup deletes the attempts older than the retention period and returns
+// how many were deleted
+func (j *RetentionJob) Cleanup(ctx context.Context) (int, error) {
+	deleted, err := j.store.CleanupOld(ctx, j.config.Now().Add(-j.config.MaxAge))
+	if err != nil {
+		return deleted, err
+	}
+	if j.config.OnCleanup != nil {
+		j.config.OnCleanup(deleted)
+	}
+	return deleted, nil
+}
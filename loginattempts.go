@@ -0,0 +1,108 @@
+package lokstraauth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/loginattempt"
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+// SetLoginAttemptStore sets the store of login attempts. Login records
+// every attempt in it, and the account lockout of the auth settings counts
+// the failures it holds instead of per-instance counters, so lockouts hold
+// across instances sharing the store.
+func (a *Auth) SetLoginAttemptStore(store loginattempt.Store) {
+	a.attempts = store
+}
+
+// GetLoginAttemptStore returns the store of login attempts (nil if not
+// configured), e.g. to query the login history of an account in risk checks
+func (a *Auth) GetLoginAttemptStore() loginattempt.Store {
+	return a.attempts
+}
+
+// recordAttempt records a login attempt (no-op without a store). A failure
+// to record does not fail the login.
+func (a *Auth) recordAttempt(ctx context.Context, request *LoginRequest, response *LoginResponse, subjectID string, err error) {
+	if a.attempts == nil {
+		return
+	}
+
+	attempt := &loginattempt.Attempt{
+		TenantID:      authz.TenantFromContext(ctx),
+		AppID:         authz.AppFromContext(ctx),
+		SubjectID:     subjectID,
+		Authenticator: request.Credentials.Type(),
+		Success:       err == nil,
+		Timestamp:     time.Now(),
+	}
+	if account, ok := request.Credentials.(credential.AccountCredentials); ok {
+		attempt.Account = account.Account()
+	}
+	if err != nil {
+		attempt.FailureReason = string(autherrors.CodeOf(err))
+	}
+	attempt.IPAddress, _ = request.Metadata["ip_address"].(string)
+	attempt.UserAgent, _ = request.Metadata["user_agent"].(string)
+	if location := loginLocation(response); location != nil {
+		attempt.Country = location.CountryCode
+		attempt.City = location.City
+	}
+
+	_ = a.attempts.Record(ctx, attempt)
+}
+
+// storedLockout reports whether an account is locked by the failed logins
+// of the attempt store, and until when: the threshold of failures with
+// invalid credentials within the lockout window, since the last successful
+// login, locks the account for the lockout duration
+func (a *Auth) storedLockout(ctx context.Context, settings *tenant.TenantAuthSettings, account string) (time.Time, bool, error) {
+	window, duration := lockoutPolicy(settings)
+	now := time.Now()
+
+	attempts, err := a.attempts.List(ctx, &loginattempt.Query{
+		TenantID: authz.TenantFromContext(ctx),
+		AppID:    authz.AppFromContext(ctx),
+		Account:  account,
+		Since:    now.Add(-window - duration),
+	})
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to load login attempts: %w", err)
+	}
+
+	// Attempts are listed newest first; attempts refused while locked
+	// (rate_limited) do not extend the lockout
+	var failures []time.Time
+	for _, attempt := range attempts {
+		if attempt.Success {
+			break
+		}
+		if attempt.FailureReason == string(autherrors.CodeInvalidCredentials) {
+			failures = append(failures, attempt.Timestamp)
+		}
+	}
+
+	threshold := settings.LockoutThreshold
+	for i := 0; i+threshold-1 < len(failures); i++ {
+		if failures[i].Sub(failures[i+threshold-1]) <= window {
+			until := failures[i].Add(duration)
+			return until, now.Before(until), nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// loginLocation returns the resolved location of the client of a login
+// (see enriched.GeoIPEnricher), if known
+func loginLocation(response *LoginResponse) *subject.GeoLocation {
+	if response == nil || response.Identity == nil || response.Identity.Session == nil {
+		return nil
+	}
+	return response.Identity.Session.Location
+}
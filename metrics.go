@@ -0,0 +1,77 @@
+package lokstraauth
+
+import (
+	"context"
+	"time"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/metrics"
+)
+
+// SetMetrics sets the recorder of runtime metrics: logins, token issuance
+// and verification, authorization decisions and store calls (e.g., a
+// metrics.Collector)
+func (a *Auth) SetMetrics(recorder metrics.Recorder) {
+	a.metrics = recorder
+}
+
+// observeIssue records a token issuance started at start
+func (a *Auth) observeIssue(tokenType string, start time.Time, err error) {
+	if a.metrics != nil {
+		a.metrics.ObserveTokenIssue(tokenType, time.Since(start), err)
+	}
+}
+
+// observeVerify records a token verification started at start
+func (a *Auth) observeVerify(start time.Time, result *token.VerificationResult, err error) {
+	if a.metrics == nil {
+		return
+	}
+	if err == nil && !result.Valid {
+		err = result.Error
+		if err == nil {
+			err = autherrors.ErrTokenInvalid
+		}
+	}
+	a.metrics.ObserveTokenVerify(time.Since(start), err)
+}
+
+// observeDecision records an authorization decision started at start
+func (a *Auth) observeDecision(start time.Time, allowed bool, err error) {
+	if a.metrics != nil && err == nil {
+		a.metrics.ObserveAuthorization(evaluatorName(a.authorizer), allowed, time.Since(start))
+	}
+}
+
+// evaluatorName labels the evaluator behind an authorizer's wrappers
+func evaluatorName(authorizer authz.Authorizer) string {
+	for {
+		switch wrapper := authorizer.(type) {
+		case *authz.GuardedAuthorizer:
+			authorizer = wrapper.Unwrap()
+		case *authz.SwappableAuthorizer:
+			authorizer = wrapper.Current()
+		default:
+			return metrics.TypeName(authorizer)
+		}
+	}
+}
+
+// query runs a store call under the store timeout and records its duration
+func query[T any](ctx context.Context, a *Auth, store, operation string, fn func(ctx context.Context) (T, error)) (T, error) {
+	start := time.Now()
+	value, err := inLayer(ctx, a, LayerStore, operation, fn)
+	metrics.ObserveQuery(a.metrics, store, operation, start, err)
+	return value, err
+}
+
+// exec runs a store call without result under the store timeout and
+// records its duration
+func (a *Auth) exec(ctx context.Context, store, operation string, fn func(ctx context.Context) error) error {
+	_, err := query(ctx, a, store, operation, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
@@ -0,0 +1,303 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+// DefaultBuckets are the default latency buckets in seconds
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// CollectorConfig holds collector configuration
+type CollectorConfig struct {
+	// Namespace prefixes every metric name (default: "lokstra_auth")
+	Namespace string
+
+	// Buckets are the upper bounds of the latency histograms in seconds
+	// (default: DefaultBuckets)
+	Buckets []float64
+}
+
+// Collector is a Recorder that aggregates measurements in memory and
+// exposes them in the Prometheus text exposition format, so it can be
+// scraped without a Prometheus client dependency:
+//
+//	collector := metrics.NewCollector(nil)
+//	auth := lokstraauth.NewBuilder().WithMetrics(collector).Build()
+//	mux.Handle("/metrics", collector)
+//
+// Failures are labeled with their autherrors code, e.g.
+// lokstra_auth_logins_total{authenticator="basic",result="failure",code="invalid_credentials"}.
+type Collector struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	families []*family
+
+	logins           *family
+	loginDuration    *family
+	tokensIssued     *family
+	issueDuration    *family
+	verifications    *family
+	verifyDuration   *family
+	cacheLookups     *family
+	decisions        *family
+	decisionDuration *family
+	storeDuration    *family
+	storeErrors      *family
+}
+
+// family is a metric with its labeled series
+type family struct {
+	name   string
+	help   string
+	kind   string // "counter" or "histogram"
+	labels []string
+	series map[string]*series
+}
+
+// series is one labeled counter or histogram
+type series struct {
+	values []string
+	count  float64  // counter value or histogram count
+	sum    float64  // histogram sum
+	bucket []uint64 // histogram cumulative bucket counts
+}
+
+// NewCollector creates a collector
+func NewCollector(config *CollectorConfig) *Collector {
+	if config == nil {
+		config = &CollectorConfig{}
+	}
+	if config.Namespace == "" {
+		config.Namespace = "lokstra_auth"
+	}
+	if len(config.Buckets) == 0 {
+		config.Buckets = DefaultBuckets
+	}
+
+	c := &Collector{buckets: append([]float64(nil), config.Buckets...)}
+	sort.Float64s(c.buckets)
+
+	add := func(name, kind, help string, labels ...string) *family {
+		f := &family{
+			name:   config.Namespace + "_" + name,
+			help:   help,
+			kind:   kind,
+			labels: labels,
+			series: make(map[string]*series),
+		}
+		c.families = append(c.families, f)
+		return f
+	}
+	c.logins = add("logins_total", "counter", "Login attempts by authenticator and result.", "authenticator", "result", "code")
+	c.loginDuration = add("login_duration_seconds", "histogram", "Login latency by authenticator.", "authenticator")
+	c.tokensIssued = add("tokens_issued_total", "counter", "Token issuances by token type and result.", "type", "result", "code")
+	c.issueDuration = add("token_issue_duration_seconds", "histogram", "Token issuance latency by token type.", "type")
+	c.verifications = add("token_verifications_total", "counter", "Token verifications by result.", "result", "code")
+	c.verifyDuration = add("token_verify_duration_seconds", "histogram", "Token verification latency.")
+	c.cacheLookups = add("cache_lookups_total", "counter", "Cache lookups by cache and result (hit, miss).", "cache", "result")
+	c.decisions = add("authorization_decisions_total", "counter", "Authorization decisions by evaluator and decision (allow, deny).", "evaluator", "decision")
+	c.decisionDuration = add("authorization_duration_seconds", "histogram", "Authorization latency by evaluator.", "evaluator")
+	c.storeDuration = add("store_query_duration_seconds", "histogram", "Store call latency by store and operation.", "store", "operation")
+	c.storeErrors = add("store_errors_total", "counter", "Failed store calls by store and operation.", "store", "operation")
+	return c
+}
+
+// ObserveLogin records a login attempt
+func (c *Collector) ObserveLogin(authType string, duration time.Duration, err error) {
+	result, code := outcome(err)
+	c.inc(c.logins, authType, result, code)
+	c.observe(c.loginDuration, duration, authType)
+}
+
+// ObserveTokenIssue records a token issuance
+func (c *Collector) ObserveTokenIssue(tokenType string, duration time.Duration, err error) {
+	result, code := outcome(err)
+	c.inc(c.tokensIssued, tokenType, result, code)
+	c.observe(c.issueDuration, duration, tokenType)
+}
+
+// ObserveTokenVerify records a token verification
+func (c *Collector) ObserveTokenVerify(duration time.Duration, err error) {
+	result, code := outcome(err)
+	c.inc(c.verifications, result, code)
+	c.observe(c.verifyDuration, duration)
+}
+
+// ObserveCache records a cache lookup
+func (c *Collector) ObserveCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c.inc(c.cacheLookups, cache, result)
+}
+
+// ObserveAuthorization records an authorization decision
+func (c *Collector) ObserveAuthorization(evaluator string, allowed bool, duration time.Duration) {
+	decision := "deny"
+	if allowed {
+		decision = "allow"
+	}
+	c.inc(c.decisions, evaluator, decision)
+	c.observe(c.decisionDuration, duration, evaluator)
+}
+
+// ObserveStoreQuery records a store call
+func (c *Collector) ObserveStoreQuery(store, operation string, duration time.Duration, err error) {
+	c.observe(c.storeDuration, duration, store, operation)
+	if err != nil {
+		c.inc(c.storeErrors, store, operation)
+	}
+}
+
+// outcome returns the result and code labels of an error
+func outcome(err error) (string, string) {
+	if err == nil {
+		return "success", ""
+	}
+	return "failure", string(autherrors.CodeOf(err))
+}
+
+// inc increments a counter series
+func (c *Collector) inc(f *family, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series(f, values).count++
+}
+
+// observe adds a duration to a histogram series
+func (c *Collector) observe(f *family, duration time.Duration, values ...string) {
+	seconds := duration.Seconds()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.series(f, values)
+	s.count++
+	s.sum += seconds
+	for i, bound := range c.buckets {
+		if seconds <= bound {
+			s.bucket[i]++
+		}
+	}
+}
+
+// series returns the series of label values, creating it (c.mu held)
+func (c *Collector) series(f *family, values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: values}
+		if f.kind == "histogram" {
+			s.bucket = make([]uint64, len(c.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+// Metrics without observations are omitted.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	out := bufio.NewWriter(counter)
+
+	c.mu.Lock()
+	for _, f := range c.families {
+		if len(f.series) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind == "counter" {
+				fmt.Fprintf(out, "%s%s %s\n", f.name, labels(f.labels, s.values, ""), formatFloat(s.count))
+				continue
+			}
+			for i, bound := range c.buckets {
+				fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, labels(f.labels, s.values, formatFloat(bound)), s.bucket[i])
+			}
+			fmt.Fprintf(out, "%s_bucket%s %s\n", f.name, labels(f.labels, s.values, "+Inf"), formatFloat(s.count))
+			fmt.Fprintf(out, "%s_sum%s %s\n", f.name, labels(f.labels, s.values, ""), formatFloat(s.sum))
+			fmt.Fprintf(out, "%s_count%s %s\n", f.name, labels(f.labels, s.values, ""), formatFloat(s.count))
+		}
+	}
+	c.mu.Unlock()
+
+	err := out.Flush()
+	return counter.n, err
+}
+
+// labels formats a label set, with an "le" label when le is set
+func labels(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name + `="` + escapeLabel(values[i]) + `"`)
+	}
+	if le != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`le="` + le + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escapeLabel escapes a label value
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// formatFloat formats a sample value
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
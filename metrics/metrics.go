@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Recorder receives runtime measurements. Implementations must be safe for
+// concurrent use and must not block: they are called on the request path.
+// Collector exposes them in the Prometheus text format; adapters to other
+// metric systems implement Recorder directly.
+type Recorder interface {
+	// ObserveLogin records a login attempt by authenticator type; err is
+	// nil on success
+	ObserveLogin(authType string, duration time.Duration, err error)
+
+	// ObserveTokenIssue records a token issuance by token type ("access",
+	// "refresh")
+	ObserveTokenIssue(tokenType string, duration time.Duration, err error)
+
+	// ObserveTokenVerify records a token verification; err is the reason
+	// an invalid token was rejected
+	ObserveTokenVerify(duration time.Duration, err error)
+
+	// ObserveCache records a cache lookup, e.g. cache "decision", "subject"
+	// or "identity"
+	ObserveCache(cache string, hit bool)
+
+	// ObserveAuthorization records an authorization decision by evaluator
+	ObserveAuthorization(evaluator string, allowed bool, duration time.Duration)
+
+	// ObserveStoreQuery records a store call, e.g. store "token" and
+	// operation "get"
+	ObserveStoreQuery(store, operation string, duration time.Duration, err error)
+}
+
+// Nop is a Recorder that discards every measurement
+type Nop struct{}
+
+func (Nop) ObserveLogin(string, time.Duration, error)              {}
+func (Nop) ObserveTokenIssue(string, time.Duration, error)         {}
+func (Nop) ObserveTokenVerify(time.Duration, error)                {}
+func (Nop) ObserveCache(string, bool)                              {}
+func (Nop) ObserveAuthorization(string, bool, time.Duration)       {}
+func (Nop) ObserveStoreQuery(string, string, time.Duration, error) {}
+
+// ObserveQuery records a store call started at start, for stores that
+// instrument themselves:
+//
+//	defer func(start time.Time) { metrics.ObserveQuery(r, "rbac", "get_role", start, err) }(time.Now())
+func ObserveQuery(recorder Recorder, store, operation string, start time.Time, err error) {
+	if recorder != nil {
+		recorder.ObserveStoreQuery(store, operation, time.Since(start), err)
+	}
+}
+
+// TypeName returns a short label for the type of v: the package and type
+// name without pointer, e.g. "rbac.Evaluator"
+func TypeName(v any) string {
+	return strings.TrimLeft(fmt.Sprintf("%T", v), "*")
+}
@@ -0,0 +1,119 @@
+package lokstraauth
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+// DefaultMFAPendingLifetime is the lifetime of MFA-pending tokens: the time
+// a login has to provide its second factor
+const DefaultMFAPendingLifetime = 5 * time.Minute
+
+var (
+	ErrMFAPending          = autherrors.New(autherrors.ErrUnauthenticated, "second factor required")
+	ErrMFAPendingInvalid   = autherrors.New(autherrors.ErrTokenInvalid, "token is not a valid MFA-pending token")
+	ErrSecondFactorMissing = autherrors.New(autherrors.ErrInvalidRequest, "second factor must differ from the first")
+)
+
+// requiresSecondFactor reports whether the settings require a second factor
+// a login did not provide. Only logins of users are concerned: service and
+// app tokens carry a type of their own.
+func requiresSecondFactor(settings *tenant.TenantAuthSettings, claims token.Claims) bool {
+	return settings != nil && settings.MFARequired &&
+		claims.TokenType() == token.TokenTypeAccess && claims.ACR() != token.ACRMultiFactor
+}
+
+// mfaPendingLogin returns the claims of an MFA-pending token, restricted to
+// no permission at all, and a context generating it with the MFA-pending
+// lifetime
+func mfaPendingLogin(ctx context.Context, claims map[string]any) (context.Context, map[string]any) {
+	pending := make(map[string]any, len(claims)+2)
+	maps.Copy(pending, claims)
+	pending["type"] = token.TokenTypeMFAPending
+	pending[token.ClaimAllowedPermissions] = []string{}
+
+	lifetimes := token.LifetimesFromContext(ctx)
+	lifetimes.Access = DefaultMFAPendingLifetime
+	return token.WithLifetimes(ctx, lifetimes), pending
+}
+
+// CompleteMFA exchanges the MFA-pending token of a login (see
+// LoginResponse.MFARequired) for the access and refresh tokens of the login,
+// after the subject verified a second factor (method "otp", "passkey", ...).
+// The tokens record both methods and the multi-factor acr. The caller must
+// have verified the factor: CompleteMFA does not.
+// Layer 2 -> Layer 3
+func (a *Auth) CompleteMFA(ctx context.Context, pendingToken, method string) (*LoginResponse, error) {
+	if a.tokenManager == nil {
+		return nil, ErrNoTokenManager
+	}
+	if method == "" {
+		return nil, ErrMissingAuthMethod
+	}
+
+	verifyResult, err := inLayer(ctx, a, LayerToken, "verify token",
+		func(ctx context.Context) (*token.VerificationResult, error) {
+			return a.verifyToken(ctx, pendingToken, &token.VerifyOptions{TokenType: token.TokenTypeMFAPending})
+		})
+	if err != nil {
+		return nil, fmt.Errorf("token verification error: %w", err)
+	}
+	if !verifyResult.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrMFAPendingInvalid, verifyResult.Error)
+	}
+	pending := verifyResult.Claims
+	ctx, err = bindTokenTenant(ctx, pending)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMFAPendingInvalid, err)
+	}
+	subjectID, _ := pending.GetString("sub")
+
+	claims := make(map[string]any, len(pending)+3)
+	maps.Copy(claims, pending)
+	// The token manager sets the times and ID of the new tokens, which are
+	// no longer pending
+	for _, claim := range []string{"exp", "iat", "nbf", "jti", "type", token.ClaimAllowedPermissions} {
+		delete(claims, claim)
+	}
+	token.StampAuthentication(claims, time.Now(), method)
+
+	var response *LoginResponse
+	if token.Claims(claims).ACR() != token.ACRMultiFactor {
+		err = fmt.Errorf("%w: %s", ErrSecondFactorMissing, method)
+	} else {
+		response, err = a.completeMFA(ctx, subjectID, claims)
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventTokenSteppedUp,
+		ActorID:   subjectID,
+		SubjectID: subjectID,
+		Action:    "complete_mfa",
+		Result:    auditResult(err),
+		Metadata:  auditMetadata(err, "method", method),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// completeMFA issues the tokens of a login that provided its second factor
+func (a *Auth) completeMFA(ctx context.Context, subjectID string, claims map[string]any) (*LoginResponse, error) {
+	if isSandboxToken(claims) {
+		ctx = authz.WithSandbox(ctx)
+	}
+
+	settings, err := a.authSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.issueLogin(withTokenLifetimes(ctx, settings), subjectID, claims, false)
+}
@@ -1,11 +1,15 @@
 package middleware
 
 import (
-	"errors"
+	"net/netip"
 	"strings"
 
 	lokstraauth "github.com/primadi/lokstra-auth"
+	token "github.com/primadi/lokstra-auth/02_token"
 	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/clientip"
 	"github.com/primadi/lokstra/core/request"
 )
 
@@ -19,6 +23,9 @@ type AuthMiddleware struct {
 	tokenExtractor TokenExtractor
 	errorHandler   ErrorHandler
 	optional       bool
+	verifyOptions  *token.VerifyOptions
+	rejectSandbox  bool
+	trustedProxies []netip.Prefix
 }
 
 // TokenExtractor extracts token from request
@@ -41,6 +48,21 @@ type AuthMiddlewareConfig struct {
 	// Optional indicates if authentication is optional (default: false)
 	// If true, requests without token are allowed to proceed
 	Optional bool
+
+	// VerifyOptions are verification requirements for this route group
+	// (expected audience, required scopes, token type). The token type
+	// defaults to token.TokenTypeBearer, so refresh tokens are not bearer
+	// credentials.
+	VerifyOptions *token.VerifyOptions
+
+	// RejectSandbox rejects sandbox tokens (production routes)
+	RejectSandbox bool
+
+	// TrustedProxies are the proxies (e.g., load balancers) whose
+	// X-Forwarded-For header is believed to find the client IP address:
+	// the client is the rightmost hop that is not a trusted proxy. Without
+	// them the header is ignored (see package clientip).
+	TrustedProxies []netip.Prefix
 }
 
 // NewAuthMiddleware creates a new authentication middleware
@@ -58,12 +80,39 @@ func NewAuthMiddleware(config AuthMiddlewareConfig) *AuthMiddleware {
 		tokenExtractor: config.TokenExtractor,
 		errorHandler:   config.ErrorHandler,
 		optional:       config.Optional,
+		verifyOptions:  bearerOptions(config.VerifyOptions),
+		rejectSandbox:  config.RejectSandbox,
+		trustedProxies: config.TrustedProxies,
+	}
+}
+
+// bearerOptions returns verification options rejecting refresh tokens
+// unless they require a token type
+func bearerOptions(options *token.VerifyOptions) *token.VerifyOptions {
+	if options == nil {
+		return &token.VerifyOptions{TokenType: token.TokenTypeBearer}
 	}
+	if options.TokenType != "" {
+		return options
+	}
+	withType := *options
+	withType.TokenType = token.TokenTypeBearer
+	return &withType
 }
 
 // Handler returns the middleware handler function
 func (m *AuthMiddleware) Handler() func(c *request.Context) error {
 	return func(c *request.Context) error {
+		// Expose the request to environment attributes of authorization
+		ip := clientip.FromRequest(c.R, m.trustedProxies)
+		c.Context = authz.WithRequestInfo(c.Context, &authz.RequestInfo{
+			IPAddress: ip,
+			UserAgent: c.R.UserAgent(),
+			Method:    c.R.Method,
+			Path:      c.R.URL.Path,
+			RequestID: c.R.Header.Get("X-Request-ID"),
+		})
+
 		// Extract token from request
 		token, err := m.tokenExtractor(c)
 		if err != nil {
@@ -78,6 +127,10 @@ func (m *AuthMiddleware) Handler() func(c *request.Context) error {
 		verifyResp, err := m.auth.Verify(c, &lokstraauth.VerifyRequest{
 			Token:                token,
 			BuildIdentityContext: true,
+			Options:              m.verifyOptions,
+			Metadata: map[string]any{
+				"ip_address": ip,
+			},
 		})
 		if err != nil {
 			return m.errorHandler(c, err)
@@ -87,6 +140,27 @@ func (m *AuthMiddleware) Handler() func(c *request.Context) error {
 			return m.errorHandler(c, lokstraauth.ErrAuthenticationFailed)
 		}
 
+		// Scope the request to the tenant and app of the token
+		if verifyResp.TenantID != "" && authz.TenantFromContext(c.Context) == "" {
+			c.Context = authz.WithTenant(c.Context, verifyResp.TenantID)
+		}
+		if verifyResp.AppID != "" && authz.AppFromContext(c.Context) == "" {
+			c.Context = authz.WithApp(c.Context, verifyResp.AppID)
+		}
+
+		// System tokens may switch to their allowed tenants
+		if verifyResp.System {
+			c.Context = authz.WithSystemScope(c.Context, verifyResp.AllowedTenants)
+		}
+
+		// Sandbox tokens authorize against the sandbox data of the tenant
+		if verifyResp.Sandbox {
+			if m.rejectSandbox {
+				return m.errorHandler(c, authz.ErrSandboxToken)
+			}
+			c.Context = authz.WithSandbox(c.Context)
+		}
+
 		// Inject identity into context
 		if verifyResp.Identity != nil {
 			c.Set(IdentityContextKey, verifyResp.Identity)
@@ -97,6 +171,17 @@ func (m *AuthMiddleware) Handler() func(c *request.Context) error {
 	}
 }
 
+// RejectSandbox rejects requests authenticated with a sandbox token with 403
+// (use after AuthMiddleware on production routes)
+func RejectSandbox() func(c *request.Context) error {
+	return func(c *request.Context) error {
+		if authz.IsSandbox(c) {
+			return DefaultForbiddenHandler(c, authz.ErrSandboxToken)
+		}
+		return c.Next()
+	}
+}
+
 // DefaultTokenExtractor extracts token from Authorization header
 // Format: "Bearer <token>"
 func DefaultTokenExtractor(c *request.Context) (string, error) {
@@ -118,7 +203,8 @@ func DefaultErrorHandler(c *request.Context, err error) error {
 	c.Resp.WithStatus(401)
 	return c.Resp.Json(map[string]interface{}{
 		"error":   "Unauthorized",
-		"message": err.Error(),
+		"code":    autherrors.CodeOf(err),
+		"message": errorMessage(err),
 	})
 }
 
@@ -138,6 +224,6 @@ func MustGetIdentity(c *request.Context) *subject.IdentityContext {
 }
 
 var (
-	ErrMissingToken       = errors.New("missing authentication token")
-	ErrInvalidTokenFormat = errors.New("invalid token format, expected 'Bearer <token>'")
+	ErrMissingToken       = autherrors.New(autherrors.ErrUnauthenticated, "missing authentication token")
+	ErrInvalidTokenFormat = autherrors.New(autherrors.ErrUnauthenticated, "invalid token format, expected 'Bearer <token>'")
 )
@@ -0,0 +1,324 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra/core/request"
+)
+
+// DecisionContextKey is the key used to store the authorization decision in
+// context
+const DecisionContextKey = "lokstra_auth_decision"
+
+// ObligationHandler fulfils an obligation before the handler runs; an error
+// refuses access
+type ObligationHandler func(c *request.Context, identity *subject.IdentityContext, obligation authz.Obligation) error
+
+// AuditLogger records audit entries (e.g., *audit.Logger)
+type AuditLogger interface {
+	Log(ctx context.Context, entry *audit.AuditLog) error
+}
+
+// AuthorizeMiddleware authorizes the request against a resource and action
+// with the Authorizer of Auth, and enforces the obligations of the decision:
+//
+//   - require_recent_auth: refuses with 401 (insufficient_user_authentication)
+//     when the subject authenticated longer ago than max_age, or with none
+//     of the methods
+//   - mask_fields: masks the fields in the JSON response of the handler
+//   - audit: records an audit entry with the detail (requires AuditLogger)
+//
+// A decision carrying an obligation the middleware cannot fulfil is refused.
+// Advice is fulfilled when understood and otherwise ignored.
+type AuthorizeMiddleware struct {
+	config AuthorizeMiddlewareConfig
+}
+
+// AuthorizeMiddlewareConfig holds configuration for authorize middleware
+type AuthorizeMiddlewareConfig struct {
+	// Auth is the Auth runtime instance
+	Auth *lokstraauth.Auth
+
+	// ResourceType and Action of the request (e.g., "document", "read")
+	ResourceType string
+	Action       authz.Action
+
+	// ResourceIDParam is the path parameter holding the resource ID
+	// (default: "id")
+	ResourceIDParam string
+
+	// Resource builds the resource of the request (default: ResourceType
+	// and the ResourceIDParam path parameter)
+	Resource func(c *request.Context) (*authz.Resource, error)
+
+	// ErrorHandler handles authorization errors (default: return 403)
+	ErrorHandler ErrorHandler
+
+	// ReauthHandler handles require_recent_auth obligations that are not met
+	// (default: return 401 with a step-up WWW-Authenticate challenge)
+	ReauthHandler func(c *request.Context, maxAge time.Duration) error
+
+	// StepUpHandler handles require_recent_auth obligations with methods
+	// that are not met (default: DefaultStepUpHandler)
+	StepUpHandler StepUpHandler
+
+	// AuditLogger fulfils audit obligations
+	AuditLogger AuditLogger
+
+	// ObligationHandlers fulfil custom obligation types (and replace the
+	// built-in handling of a type)
+	ObligationHandlers map[string]ObligationHandler
+
+	// AuthTime returns when the subject authenticated (default: the session
+	// creation time, or the "auth_time" identity metadata in Unix seconds)
+	AuthTime func(identity *subject.IdentityContext) (time.Time, bool)
+
+	// Now returns the current time (default: time.Now)
+	Now func() time.Time
+}
+
+// NewAuthorizeMiddleware creates a new authorization middleware
+func NewAuthorizeMiddleware(config AuthorizeMiddlewareConfig) *AuthorizeMiddleware {
+	if config.ResourceIDParam == "" {
+		config.ResourceIDParam = "id"
+	}
+	if config.Resource == nil {
+		resourceType, param := config.ResourceType, config.ResourceIDParam
+		config.Resource = func(c *request.Context) (*authz.Resource, error) {
+			return &authz.Resource{Type: resourceType, ID: c.Req.PathParam(param, "")}, nil
+		}
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = DefaultForbiddenHandler
+	}
+	if config.ReauthHandler == nil {
+		config.ReauthHandler = DefaultReauthHandler
+	}
+	if config.StepUpHandler == nil {
+		config.StepUpHandler = DefaultStepUpHandler
+	}
+	if config.AuthTime == nil {
+		config.AuthTime = DefaultAuthTime
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	return &AuthorizeMiddleware{config: config}
+}
+
+// Handler returns the middleware handler function
+func (m *AuthorizeMiddleware) Handler() func(c *request.Context) error {
+	return func(c *request.Context) error {
+		// Get identity from context (should be set by AuthMiddleware)
+		identity, ok := GetIdentity(c)
+		if !ok {
+			return m.config.ErrorHandler(c, lokstraauth.ErrAuthenticationFailed)
+		}
+
+		resource, err := m.config.Resource(c)
+		if err != nil {
+			return m.config.ErrorHandler(c, err)
+		}
+
+		decision, err := m.config.Auth.Authorize(c, &authz.AuthorizationRequest{
+			Subject:  identity,
+			Resource: resource,
+			Action:   m.config.Action,
+		})
+		if err != nil {
+			return m.config.ErrorHandler(c, err)
+		}
+		if !decision.Allowed {
+			return m.config.ErrorHandler(c, lokstraauth.ErrAuthorizationFailed)
+		}
+		c.Set(DecisionContextKey, decision)
+
+		// Fulfil obligations before the handler runs; masks apply to its response
+		var masks []authz.Obligation
+		for _, obligation := range decision.Obligations {
+			if obligation.Type == authz.ObligationMaskFields && m.config.ObligationHandlers[obligation.Type] == nil {
+				masks = append(masks, obligation)
+				continue
+			}
+			if err := m.fulfil(c, identity, resource, obligation); err != nil {
+				return m.refuse(c, err)
+			}
+		}
+		for _, advice := range decision.Advice {
+			if advice.Type == authz.ObligationMaskFields && m.config.ObligationHandlers[advice.Type] == nil {
+				masks = append(masks, advice)
+				continue
+			}
+			if m.understands(advice.Type) {
+				_ = m.fulfil(c, identity, resource, advice)
+			}
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		return m.mask(c, masks)
+	}
+}
+
+// understands reports whether the middleware can fulfil an obligation type
+func (m *AuthorizeMiddleware) understands(obligationType string) bool {
+	switch obligationType {
+	case authz.ObligationMaskFields, authz.ObligationRequireRecentAuth:
+		return true
+	case authz.ObligationAudit:
+		return m.config.AuditLogger != nil
+	}
+	return m.config.ObligationHandlers[obligationType] != nil
+}
+
+// reauthError is an unmet require_recent_auth obligation
+type reauthError struct {
+	maxAge  time.Duration
+	methods []string
+}
+
+func (e *reauthError) Error() string { return authz.ErrRecentAuthRequired.Error() }
+func (e *reauthError) Unwrap() error { return authz.ErrRecentAuthRequired }
+
+// fulfil fulfils an obligation before the handler runs
+func (m *AuthorizeMiddleware) fulfil(c *request.Context, identity *subject.IdentityContext, resource *authz.Resource, obligation authz.Obligation) error {
+	if handler := m.config.ObligationHandlers[obligation.Type]; handler != nil {
+		return handler(c, identity, obligation)
+	}
+
+	switch obligation.Type {
+	case authz.ObligationRequireRecentAuth:
+		methods := obligation.Strings("methods")
+		var maxAge time.Duration
+		if _, ok := obligation.Params["max_age"]; ok || len(methods) == 0 {
+			var err error
+			if maxAge, err = obligation.Duration("max_age"); err != nil {
+				return fmt.Errorf("%w: %v", authz.ErrObligationUnfulfilled, err)
+			}
+		}
+		if err := checkRecentAuth(identity, m.config.AuthTime, m.config.Now(), maxAge, methods); err != nil {
+			return err
+		}
+		return nil
+
+	case authz.ObligationAudit:
+		if m.config.AuditLogger == nil {
+			return fmt.Errorf("%w: %s (no audit logger)", authz.ErrObligationUnfulfilled, obligation.Type)
+		}
+		detail, _ := obligation.Params["detail"].(map[string]any)
+		info := authz.RequestInfoFromContext(c)
+		if info == nil {
+			info = &authz.RequestInfo{}
+		}
+		if err := m.config.AuditLogger.Log(c, &audit.AuditLog{
+			TenantID:  authz.TenantFromContext(c),
+			AppID:     authz.AppFromContext(c),
+			EventType: "authz.access",
+			ActorID:   identity.Subject.ID,
+			Resource:  resource.Type + ":" + resource.ID,
+			Action:    string(m.config.Action),
+			Result:    "success",
+			IPAddress: info.IPAddress,
+			UserAgent: info.UserAgent,
+			Metadata:  detail,
+		}); err != nil {
+			return fmt.Errorf("%w: %s: %v", authz.ErrObligationUnfulfilled, obligation.Type, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", authz.ErrObligationUnfulfilled, obligation.Type)
+}
+
+// refuse writes the response of an unmet obligation
+func (m *AuthorizeMiddleware) refuse(c *request.Context, err error) error {
+	var reauth *reauthError
+	if errors.As(err, &reauth) {
+		if len(reauth.methods) > 0 {
+			return m.config.StepUpHandler(c, reauth.maxAge, reauth.methods)
+		}
+		return m.config.ReauthHandler(c, reauth.maxAge)
+	}
+	return m.config.ErrorHandler(c, err)
+}
+
+// mask masks the fields of the response. A response that cannot be masked
+// (streamed, not JSON, or not JSON-serializable) is replaced by an error.
+func (m *AuthorizeMiddleware) mask(c *request.Context, masks []authz.Obligation) error {
+	if len(masks) == 0 || c.W.ManualWritten() {
+		return nil
+	}
+	if c.Resp.WriterFunc != nil || (c.Resp.RespContentType != "" && !strings.Contains(c.Resp.RespContentType, "json")) {
+		c.Resp.WriterFunc = nil
+		c.Resp.RespContentType = ""
+		return m.config.ErrorHandler(c, fmt.Errorf("%w: %s (response is not JSON)", authz.ErrObligationUnfulfilled, authz.ObligationMaskFields))
+	}
+
+	data := c.Resp.RespData
+	for _, obligation := range masks {
+		replacement, ok := obligation.Params["replacement"]
+		if !ok {
+			replacement = "***"
+		}
+		masked, err := authz.ApplyMask(data, obligation.Strings("fields"), replacement)
+		if err != nil {
+			return m.config.ErrorHandler(c, fmt.Errorf("%w: %v", authz.ErrObligationUnfulfilled, err))
+		}
+		data = masked
+	}
+	c.Resp.RespData = data
+	return nil
+}
+
+// GetDecision retrieves the authorization decision from request context
+func GetDecision(c *request.Context) (*authz.AuthorizationDecision, bool) {
+	decision, ok := c.Get(DecisionContextKey).(*authz.AuthorizationDecision)
+	return decision, ok
+}
+
+// DefaultAuthTime returns the latest of the creation time of the session
+// and the "auth_time" identity metadata (the auth_time claim of the token,
+// renewed by a step-up)
+func DefaultAuthTime(identity *subject.IdentityContext) (time.Time, bool) {
+	var authTime time.Time
+	switch v := identity.Metadata["auth_time"].(type) {
+	case int64:
+		authTime = time.Unix(v, 0)
+	case float64:
+		authTime = time.Unix(int64(v), 0)
+	case time.Time:
+		authTime = v
+	}
+	if identity.Session != nil && identity.Session.CreatedAt > 0 {
+		if created := time.Unix(identity.Session.CreatedAt, 0); created.After(authTime) {
+			authTime = created
+		}
+	}
+	return authTime, !authTime.IsZero()
+}
+
+// DefaultReauthHandler returns 401 with a step-up challenge (RFC 9470)
+func DefaultReauthHandler(c *request.Context, maxAge time.Duration) error {
+	return DefaultStepUpHandler(c, maxAge, nil)
+}
+
+// RequireAccess creates an authorize middleware with shorthand; the resource
+// ID is the "id" path parameter
+func RequireAccess(auth *lokstraauth.Auth, resourceType string, action authz.Action) func(c *request.Context) error {
+	middleware := NewAuthorizeMiddleware(AuthorizeMiddlewareConfig{
+		Auth:         auth,
+		ResourceType: resourceType,
+		Action:       action,
+	})
+	return middleware.Handler()
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"github.com/primadi/lokstra-auth/cookie"
+	"github.com/primadi/lokstra/core/request"
+)
+
+// CookieTokenExtractor extracts the token from the session cookie
+// (decrypting it when the cookie manager has an encryption key)
+func CookieTokenExtractor(cookies *cookie.Manager) TokenExtractor {
+	return func(c *request.Context) (string, error) {
+		return cookies.ReadSession(c.R)
+	}
+}
+
+// FirstTokenExtractor tries extractors in order and returns the first token found
+// (e.g., session cookie for browsers, bearer header for API clients)
+func FirstTokenExtractor(extractors ...TokenExtractor) TokenExtractor {
+	return func(c *request.Context) (string, error) {
+		err := ErrMissingToken
+		for _, extract := range extractors {
+			token, extractErr := extract(c)
+			if extractErr == nil && token != "" {
+				return token, nil
+			}
+			if extractErr != nil {
+				err = extractErr
+			}
+		}
+		return "", err
+	}
+}
+
+// CSRFMiddleware verifies double-submit CSRF tokens on state-changing requests.
+// Use it on routes authenticated by session cookies.
+type CSRFMiddleware struct {
+	cookies      *cookie.Manager
+	errorHandler ErrorHandler
+}
+
+// CSRFMiddlewareConfig holds configuration for CSRF middleware
+type CSRFMiddlewareConfig struct {
+	// Cookies is the cookie manager that issued the CSRF cookie
+	Cookies *cookie.Manager
+
+	// ErrorHandler handles CSRF errors (default: return 403)
+	ErrorHandler ErrorHandler
+}
+
+// NewCSRFMiddleware creates a new CSRF middleware
+func NewCSRFMiddleware(config CSRFMiddlewareConfig) *CSRFMiddleware {
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = DefaultForbiddenHandler
+	}
+
+	return &CSRFMiddleware{
+		cookies:      config.Cookies,
+		errorHandler: config.ErrorHandler,
+	}
+}
+
+// Handler returns the middleware handler function
+func (m *CSRFMiddleware) Handler() func(c *request.Context) error {
+	return func(c *request.Context) error {
+		if err := m.cookies.VerifyCSRF(c.R); err != nil {
+			return m.errorHandler(c, err)
+		}
+
+		return c.Next()
+	}
+}
@@ -2,7 +2,7 @@ package middleware
 
 import (
 	lokstraauth "github.com/primadi/lokstra-auth"
-	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
 	"github.com/primadi/lokstra/core/request"
 )
 
@@ -76,10 +76,19 @@ func DefaultForbiddenHandler(c *request.Context, err error) error {
 	c.Resp.WithStatus(403)
 	return c.Resp.Json(map[string]interface{}{
 		"error":   "Forbidden",
-		"message": err.Error(),
+		"code":    autherrors.CodeOf(err),
+		"message": errorMessage(err),
 	})
 }
 
+// errorMessage returns the safe message of coded errors, else the error
+func errorMessage(err error) string {
+	if _, ok := autherrors.KindOf(err); ok {
+		return autherrors.SafeMessage(err)
+	}
+	return err.Error()
+}
+
 // AnyPermissionMiddleware checks if user has ANY of the specified permissions
 type AnyPermissionMiddleware struct {
 	auth         *lokstraauth.Auth
@@ -105,12 +114,7 @@ func (m *AnyPermissionMiddleware) Handler() func(c *request.Context) error {
 		}
 
 		// Check if user has any of the permissions
-		checker, ok := m.auth.GetAuthorizer().(authz.PermissionChecker)
-		if !ok {
-			return m.errorHandler(c, lokstraauth.ErrNoAuthorizer)
-		}
-
-		hasPermission, err := checker.HasAnyPermission(c, identity, m.permissions...)
+		hasPermission, err := m.auth.CheckAnyPermission(c, identity, m.permissions...)
 		if err != nil {
 			return m.errorHandler(c, err)
 		}
@@ -148,12 +152,7 @@ func (m *AllPermissionsMiddleware) Handler() func(c *request.Context) error {
 		}
 
 		// Check if user has all of the permissions
-		checker, ok := m.auth.GetAuthorizer().(authz.PermissionChecker)
-		if !ok {
-			return m.errorHandler(c, lokstraauth.ErrNoAuthorizer)
-		}
-
-		hasPermissions, err := checker.HasAllPermissions(c, identity, m.permissions...)
+		hasPermissions, err := m.auth.CheckAllPermissions(c, identity, m.permissions...)
 		if err != nil {
 			return m.errorHandler(c, err)
 		}
@@ -2,7 +2,6 @@ package middleware
 
 import (
 	lokstraauth "github.com/primadi/lokstra-auth"
-	authz "github.com/primadi/lokstra-auth/04_authz"
 	"github.com/primadi/lokstra/core/request"
 )
 
@@ -96,12 +95,7 @@ func (m *AnyRoleMiddleware) Handler() func(c *request.Context) error {
 		}
 
 		// Check if user has any of the roles
-		checker, ok := m.auth.GetAuthorizer().(authz.RoleChecker)
-		if !ok {
-			return m.errorHandler(c, lokstraauth.ErrNoAuthorizer)
-		}
-
-		hasRole, err := checker.HasAnyRole(c, identity, m.roles...)
+		hasRole, err := m.auth.CheckAnyRole(c, identity, m.roles...)
 		if err != nil {
 			return m.errorHandler(c, err)
 		}
@@ -139,12 +133,7 @@ func (m *AllRolesMiddleware) Handler() func(c *request.Context) error {
 		}
 
 		// Check if user has all of the roles
-		checker, ok := m.auth.GetAuthorizer().(authz.RoleChecker)
-		if !ok {
-			return m.errorHandler(c, lokstraauth.ErrNoAuthorizer)
-		}
-
-		hasRoles, err := checker.HasAllRoles(c, identity, m.roles...)
+		hasRoles, err := m.auth.CheckAllRoles(c, identity, m.roles...)
 		if err != nil {
 			return m.errorHandler(c, err)
 		}
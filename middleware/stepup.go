@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	token "github.com/primadi/lokstra-auth/02_token"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra/core/request"
+)
+
+// StepUpHandler handles requests whose authentication is too old or too
+// weak: the client must authenticate again within maxAge (0 for any time)
+// with one of the methods (if any)
+type StepUpHandler func(c *request.Context, maxAge time.Duration, methods []string) error
+
+// RecentAuthMiddleware requires the subject to have authenticated recently,
+// or with specific methods, before sensitive operations (payments, key
+// rotation, ...). Clients step up by authenticating again (see
+// lokstraauth.Auth.StepUp) and retrying with the new token.
+type RecentAuthMiddleware struct {
+	config RecentAuthMiddlewareConfig
+}
+
+// RecentAuthMiddlewareConfig holds configuration for recent authentication
+// middleware
+type RecentAuthMiddlewareConfig struct {
+	// MaxAge is how long ago the subject may have authenticated (0 for any
+	// time)
+	MaxAge time.Duration
+
+	// Methods are the authentication methods ("otp", "passkey") or classes
+	// ("aal2") any of which the subject must have used (optional)
+	Methods []string
+
+	// StepUpHandler handles requests that must step up (default: return 401
+	// with a step-up WWW-Authenticate challenge)
+	StepUpHandler StepUpHandler
+
+	// ErrorHandler handles requests without identity (default: return 401)
+	ErrorHandler ErrorHandler
+
+	// AuthTime returns when the subject authenticated (default:
+	// DefaultAuthTime)
+	AuthTime func(identity *subject.IdentityContext) (time.Time, bool)
+
+	// Now returns the current time (default: time.Now)
+	Now func() time.Time
+}
+
+// NewRecentAuthMiddleware creates a new recent authentication middleware
+func NewRecentAuthMiddleware(config RecentAuthMiddlewareConfig) *RecentAuthMiddleware {
+	if config.StepUpHandler == nil {
+		config.StepUpHandler = DefaultStepUpHandler
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = DefaultErrorHandler
+	}
+	if config.AuthTime == nil {
+		config.AuthTime = DefaultAuthTime
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	return &RecentAuthMiddleware{config: config}
+}
+
+// Handler returns the middleware handler function
+func (m *RecentAuthMiddleware) Handler() func(c *request.Context) error {
+	return func(c *request.Context) error {
+		// Get identity from context (should be set by AuthMiddleware)
+		identity, ok := GetIdentity(c)
+		if !ok {
+			return m.config.ErrorHandler(c, lokstraauth.ErrAuthenticationFailed)
+		}
+
+		if err := checkRecentAuth(identity, m.config.AuthTime, m.config.Now(), m.config.MaxAge, m.config.Methods); err != nil {
+			return m.config.StepUpHandler(c, err.maxAge, err.methods)
+		}
+		return c.Next()
+	}
+}
+
+// RequireRecentAuth creates a recent authentication middleware with
+// shorthand: the subject must have authenticated within maxAge (0 for any
+// time), with one of the methods when given
+func RequireRecentAuth(maxAge time.Duration, methods ...string) func(c *request.Context) error {
+	middleware := NewRecentAuthMiddleware(RecentAuthMiddlewareConfig{
+		MaxAge:  maxAge,
+		Methods: methods,
+	})
+	return middleware.Handler()
+}
+
+// AuthMethods returns the authentication methods and class of an identity
+// (the "amr" and "acr" identity metadata)
+func AuthMethods(identity *subject.IdentityContext) []string {
+	var methods []string
+	switch amr := identity.Metadata[token.ClaimAMR].(type) {
+	case []string:
+		methods = append(methods, amr...)
+	case []any:
+		for _, method := range amr {
+			if s, ok := method.(string); ok {
+				methods = append(methods, s)
+			}
+		}
+	}
+	if acr, ok := identity.Metadata[token.ClaimACR].(string); ok && acr != "" {
+		methods = append(methods, acr)
+	}
+	return methods
+}
+
+// checkRecentAuth returns a reauthError when the identity authenticated
+// longer ago than maxAge, or with none of the methods
+func checkRecentAuth(identity *subject.IdentityContext, authTimeOf func(*subject.IdentityContext) (time.Time, bool), now time.Time, maxAge time.Duration, methods []string) *reauthError {
+	if maxAge > 0 {
+		authTime, ok := authTimeOf(identity)
+		if !ok || now.Sub(authTime) > maxAge {
+			return &reauthError{maxAge: maxAge, methods: methods}
+		}
+	}
+	if len(methods) > 0 {
+		used := AuthMethods(identity)
+		if !slices.ContainsFunc(methods, func(method string) bool { return slices.Contains(used, method) }) {
+			return &reauthError{maxAge: maxAge, methods: methods}
+		}
+	}
+	return nil
+}
+
+// DefaultStepUpHandler returns 401 with a step-up challenge (RFC 9470)
+// carrying the max age and the accepted methods as acr_values
+func DefaultStepUpHandler(c *request.Context, maxAge time.Duration, methods []string) error {
+	challenge := fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="%s"`, authz.ErrRecentAuthRequired)
+	body := map[string]any{
+		"error":   "Unauthorized",
+		"message": authz.ErrRecentAuthRequired.Error(),
+	}
+	if maxAge > 0 {
+		seconds := int64(math.Ceil(maxAge.Seconds()))
+		challenge += fmt.Sprintf(", max_age=%d", seconds)
+		body["max_age"] = seconds
+	}
+	if len(methods) > 0 {
+		challenge += fmt.Sprintf(`, acr_values="%s"`, strings.Join(methods, " "))
+		body["methods"] = methods
+	}
+
+	if c.Resp.RespHeaders == nil {
+		c.Resp.RespHeaders = make(map[string][]string)
+	}
+	c.Resp.RespHeaders["WWW-Authenticate"] = []string{challenge}
+	c.Resp.WithStatus(401)
+	return c.Resp.Json(body)
+}
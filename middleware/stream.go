@@ -0,0 +1,468 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	token "github.com/primadi/lokstra-auth/02_token"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra/core/request"
+)
+
+// StreamSessionContextKey is the key used to store the stream session in context
+const StreamSessionContextKey = "lokstra_auth_stream_session"
+
+var (
+	ErrIdentityRevoked   = errors.New("identity revoked")
+	ErrStreamExpired     = errors.New("stream token expired")
+	ErrSubjectMismatch   = errors.New("refresh token belongs to another subject")
+	ErrInvalidAuthFrame  = errors.New("invalid auth message, expected {\"type\":\"auth\",\"token\":\"...\"}")
+	ErrStreamSessionDone = errors.New("stream session closed")
+)
+
+// QueryTokenExtractor extracts the token from a query parameter
+// (default "access_token"). Browsers cannot set headers on WebSocket and
+// EventSource requests, so they pass the token in the URL.
+func QueryTokenExtractor(param string) TokenExtractor {
+	if param == "" {
+		param = "access_token"
+	}
+	return func(c *request.Context) (string, error) {
+		token := c.R.URL.Query().Get(param)
+		if token == "" {
+			return "", ErrMissingToken
+		}
+		return token, nil
+	}
+}
+
+// SubprotocolTokenExtractor extracts the token from a Sec-WebSocket-Protocol
+// entry starting with prefix (default "bearer."), e.g.
+// new WebSocket(url, ["chat", "bearer." + token]). The upgrader must echo a
+// real subprotocol ("chat"), never the token entry.
+func SubprotocolTokenExtractor(prefix string) TokenExtractor {
+	if prefix == "" {
+		prefix = "bearer."
+	}
+	return func(c *request.Context) (string, error) {
+		for _, header := range c.R.Header.Values("Sec-WebSocket-Protocol") {
+			for protocol := range strings.SplitSeq(header, ",") {
+				protocol = strings.TrimSpace(protocol)
+				if token, ok := strings.CutPrefix(protocol, prefix); ok && token != "" {
+					return token, nil
+				}
+			}
+		}
+		return "", ErrMissingToken
+	}
+}
+
+// StreamAuth authenticates long-lived connections (WebSocket, Server-Sent
+// Events) and keeps checking their identity while they are open
+type StreamAuth struct {
+	auth              *lokstraauth.Auth
+	tokenExtractor    TokenExtractor
+	errorHandler      ErrorHandler
+	verifyOptions     *token.VerifyOptions
+	checkInterval     time.Duration
+	bus               subject.InvalidationBus
+	allowFirstMessage bool
+}
+
+// StreamAuthConfig holds configuration for stream authentication
+type StreamAuthConfig struct {
+	// Auth is the Auth runtime instance
+	Auth *lokstraauth.Auth
+
+	// TokenExtractor extracts the token from the upgrade or stream request
+	// (default: Authorization header, then subprotocol, then query parameter)
+	TokenExtractor TokenExtractor
+
+	// ErrorHandler handles auth errors (default: return 401)
+	ErrorHandler ErrorHandler
+
+	// VerifyOptions are verification requirements for the stream (token
+	// type: token.TokenTypeBearer by default)
+	VerifyOptions *token.VerifyOptions
+
+	// CheckInterval is how often open connections re-verify their token,
+	// catching revocation (default: 1 minute)
+	CheckInterval time.Duration
+
+	// Bus triggers an immediate check when the subject of a connection
+	// changes (optional)
+	Bus subject.InvalidationBus
+
+	// AllowFirstMessage lets requests without a token through Handler, so
+	// the connection authenticates with its first message
+	// (see AuthenticateMessage)
+	AllowFirstMessage bool
+}
+
+// NewStreamAuth creates stream authentication helpers
+func NewStreamAuth(config StreamAuthConfig) *StreamAuth {
+	if config.TokenExtractor == nil {
+		config.TokenExtractor = FirstTokenExtractor(
+			DefaultTokenExtractor,
+			SubprotocolTokenExtractor(""),
+			QueryTokenExtractor(""),
+		)
+	}
+
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = DefaultErrorHandler
+	}
+
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = time.Minute
+	}
+
+	return &StreamAuth{
+		auth:              config.Auth,
+		tokenExtractor:    config.TokenExtractor,
+		errorHandler:      config.ErrorHandler,
+		verifyOptions:     bearerOptions(config.VerifyOptions),
+		checkInterval:     config.CheckInterval,
+		bus:               config.Bus,
+		allowFirstMessage: config.AllowFirstMessage,
+	}
+}
+
+// Handler returns a middleware authenticating the upgrade or stream request.
+// It injects the identity (see GetIdentity) and the stream session
+// (see GetStreamSession).
+func (s *StreamAuth) Handler() func(c *request.Context) error {
+	return func(c *request.Context) error {
+		tokenValue, err := s.tokenExtractor(c)
+		if err != nil {
+			if s.allowFirstMessage && errors.Is(err, ErrMissingToken) {
+				// Authenticated by the first message of the connection
+				return c.Next()
+			}
+			return s.errorHandler(c, err)
+		}
+
+		session, err := s.Authenticate(c, tokenValue)
+		if err != nil {
+			return s.errorHandler(c, err)
+		}
+
+		if session.tenantID != "" && authz.TenantFromContext(c.Context) == "" {
+			c.Context = authz.WithTenant(c.Context, session.tenantID)
+		}
+		if session.appID != "" && authz.AppFromContext(c.Context) == "" {
+			c.Context = authz.WithApp(c.Context, session.appID)
+		}
+		if session.sandbox {
+			c.Context = authz.WithSandbox(c.Context)
+		}
+
+		if identity := session.Identity(); identity != nil {
+			c.Set(IdentityContextKey, identity)
+		}
+		c.Set(StreamSessionContextKey, session)
+
+		return c.Next()
+	}
+}
+
+// Authenticate verifies a token and opens a stream session
+func (s *StreamAuth) Authenticate(ctx context.Context, tokenValue string) (*StreamSession, error) {
+	resp, err := s.verify(ctx, tokenValue)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &StreamSession{
+		stream:   s,
+		tenantID: resp.TenantID,
+		appID:    resp.AppID,
+		sandbox:  resp.Sandbox,
+		changed:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	session.apply(tokenValue, resp)
+	return session, nil
+}
+
+// AuthMessage is the first message of a connection authenticating in-band
+type AuthMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// AuthenticateMessage authenticates a connection with its first message,
+// {"type":"auth","token":"..."}
+func (s *StreamAuth) AuthenticateMessage(ctx context.Context, data []byte) (*StreamSession, error) {
+	var msg AuthMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "auth" || msg.Token == "" {
+		return nil, ErrInvalidAuthFrame
+	}
+	return s.Authenticate(ctx, msg.Token)
+}
+
+// verify verifies a token and builds its identity
+func (s *StreamAuth) verify(ctx context.Context, tokenValue string) (*lokstraauth.VerifyResponse, error) {
+	resp, err := s.auth.Verify(ctx, &lokstraauth.VerifyRequest{
+		Token:                tokenValue,
+		BuildIdentityContext: true,
+		Options:              s.verifyOptions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Valid {
+		return nil, lokstraauth.ErrAuthenticationFailed
+	}
+	return resp, nil
+}
+
+// GetStreamSession retrieves the stream session from request context
+func GetStreamSession(c *request.Context) (*StreamSession, bool) {
+	session, ok := c.Get(StreamSessionContextKey).(*StreamSession)
+	return session, ok
+}
+
+// StreamSession is the authentication of one open connection. Watch it for
+// the lifetime of the connection and close the connection when it ends.
+type StreamSession struct {
+	stream   *StreamAuth
+	tenantID string
+	appID    string
+	sandbox  bool
+
+	mu        sync.RWMutex
+	token     string
+	identity  *subject.IdentityContext
+	subjectID string
+	expiresAt time.Time
+
+	changed   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// apply stores the token and identity of a verification
+func (s *StreamSession) apply(tokenValue string, resp *lokstraauth.VerifyResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = tokenValue
+	s.identity = resp.Identity
+	s.subjectID, _ = resp.Claims.GetString("sub")
+	s.expiresAt = time.Time{}
+	if exp, ok := resp.Claims.GetInt64("exp"); ok {
+		s.expiresAt = time.Unix(exp, 0)
+	}
+}
+
+// Identity returns the current identity of the connection
+func (s *StreamSession) Identity() *subject.IdentityContext {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.identity
+}
+
+// SubjectID returns the subject of the connection
+func (s *StreamSession) SubjectID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.subjectID
+}
+
+// ExpiresAt returns the expiry of the current token (zero if it has none)
+func (s *StreamSession) ExpiresAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.expiresAt
+}
+
+// Refresh replaces the token of the connection (e.g., sent by the client
+// before the current one expires). The new token must belong to the same
+// subject.
+func (s *StreamSession) Refresh(ctx context.Context, tokenValue string) error {
+	if s.Err() != nil {
+		return ErrStreamSessionDone
+	}
+
+	resp, err := s.stream.verify(s.scope(ctx), tokenValue)
+	if err != nil {
+		return err
+	}
+	if sub, _ := resp.Claims.GetString("sub"); sub != s.SubjectID() {
+		return ErrSubjectMismatch
+	}
+
+	s.apply(tokenValue, resp)
+	s.notify()
+	return nil
+}
+
+// Check re-verifies the token of the connection, rebuilding its identity.
+// A token that was revoked or expired, or an identity that can no longer
+// be built, closes the session.
+func (s *StreamSession) Check(ctx context.Context) error {
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	tokenValue, expiresAt := s.token, s.expiresAt
+	s.mu.RUnlock()
+
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		s.Close(ErrStreamExpired)
+		return s.Err()
+	}
+
+	resp, err := s.stream.verify(s.scope(ctx), tokenValue)
+	if err != nil {
+		s.Close(fmt.Errorf("%w: %v", ErrIdentityRevoked, err))
+		return s.Err()
+	}
+
+	s.apply(tokenValue, resp)
+	return nil
+}
+
+// Watch checks the connection every CheckInterval, when its token expires
+// and when its subject changes on the invalidation bus. It blocks until ctx
+// is done or the session closes, and returns the reason the session closed
+// (nil when ctx is done first).
+//
+//	go func() {
+//		if err := session.Watch(ctx); err != nil {
+//			conn.Close(websocket.StatusPolicyViolation, err.Error())
+//		}
+//	}()
+func (s *StreamSession) Watch(ctx context.Context) error {
+	if s.stream.bus != nil {
+		unsubscribe := s.stream.bus.Subscribe(func(eventCtx context.Context, event subject.ChangeEvent) {
+			if s.affectedBy(eventCtx, event) {
+				s.notify()
+			}
+		})
+		defer unsubscribe()
+	}
+
+	ticker := time.NewTicker(s.stream.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		expiry := s.expiryTimer()
+
+		select {
+		case <-ctx.Done():
+			expiry.Stop()
+			return nil
+		case <-s.done:
+			expiry.Stop()
+			return s.Err()
+		case <-ticker.C:
+		case <-s.changed:
+		case <-expiry.C:
+		}
+		expiry.Stop()
+
+		if err := s.Check(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Context returns a context canceled when the session closes, with the
+// close reason as its cause (see context.Cause). Use it for the stream loop
+// of a Server-Sent Events handler.
+func (s *StreamSession) Context(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-s.done:
+			cancel(s.Err())
+		case <-ctx.Done():
+		}
+	}()
+	return ctx
+}
+
+// Close closes the session with a reason
+func (s *StreamSession) Close(reason error) {
+	if reason == nil {
+		reason = ErrStreamSessionDone
+	}
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = reason
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// Done returns a channel closed when the session closes
+func (s *StreamSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason the session closed (nil while open)
+func (s *StreamSession) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// scope scopes a context to the tenant and app of the session
+func (s *StreamSession) scope(ctx context.Context) context.Context {
+	if s.tenantID != "" && authz.TenantFromContext(ctx) == "" {
+		ctx = authz.WithTenant(ctx, s.tenantID)
+	}
+	if s.appID != "" && authz.AppFromContext(ctx) == "" {
+		ctx = authz.WithApp(ctx, s.appID)
+	}
+	if s.sandbox {
+		ctx = authz.WithSandbox(ctx)
+	}
+	return ctx
+}
+
+// affectedBy reports whether a change event impacts the session
+func (s *StreamSession) affectedBy(ctx context.Context, event subject.ChangeEvent) bool {
+	if tenantID := authz.TenantFromContext(ctx); tenantID != "" && s.tenantID != "" && tenantID != s.tenantID {
+		return false
+	}
+	switch event.Kind {
+	case subject.SubjectChanged:
+		return event.SubjectID == s.SubjectID()
+	case subject.RoleChanged:
+		identity := s.Identity()
+		return identity != nil && identity.HasRole(event.Role)
+	}
+	return false
+}
+
+// notify wakes Watch for an immediate check
+func (s *StreamSession) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// expiryTimer returns a timer firing when the current token expires
+// (never, when it has no expiry)
+func (s *StreamSession) expiryTimer() *time.Timer {
+	expiresAt := s.ExpiresAt()
+	if expiresAt.IsZero() {
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		return timer
+	}
+	return time.NewTimer(time.Until(expiresAt))
+}
@@ -0,0 +1,115 @@
+// Package migrations holds the versioned SQL migrations of the PostgreSQL
+// stores (rbac.PostgresStore, policy.PostgresStore,
+// rebac.PostgresTupleStore, jwt.PostgresTenantKeys) and a migrator that
+// applies them at startup, or as a script through lokstra-auth-cli.
+package migrations
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+)
+
+//go:embed postgres/*.sql
+var bundle embed.FS
+
+// Postgres is the migration bundle of the PostgreSQL stores, with their
+// default table names
+var Postgres fs.FS = mustSub(bundle, "postgres")
+
+// fileNamePattern matches migration file names: "<version>_<name>.sql"
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_]+)\.sql$`)
+
+// Migration is a versioned SQL migration
+type Migration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string
+}
+
+// Load reads the migrations of a directory ("<version>_<name>.sql" files),
+// ordered by version
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*Migration
+	versions := make(map[int]string)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s: expected <version>_<name>.sql", ErrInvalidMigration, entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s: invalid version", ErrInvalidMigration, entry.Name())
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("%w: %s and %s have the same version", ErrInvalidMigration, other, entry.Name())
+		}
+		versions[version] = entry.Name()
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		migrations = append(migrations, &Migration{
+			Version:  version,
+			Name:     match[2],
+			SQL:      string(content),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Script returns the migrations from a version on as one SQL script for
+// psql. Each migration runs in a transaction and is recorded in the version
+// table, so the migrator skips it later.
+func Script(migrations []*Migration, table string, from int) string {
+	if table == "" {
+		table = DefaultTable
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s;\n", createTableStatement(table))
+	for _, m := range migrations {
+		if m.Version < from {
+			continue
+		}
+		fmt.Fprintf(&b, "\n-- %04d_%s\nBEGIN;\n\n%s\n", m.Version, m.Name, strings.TrimSpace(m.SQL))
+		fmt.Fprintf(&b, "\nINSERT INTO %s (version, name, checksum) VALUES (%d, '%s', '%s') ON CONFLICT (version) DO NOTHING;\nCOMMIT;\n",
+			table, m.Version, m.Name, m.Checksum)
+	}
+	return b.String()
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
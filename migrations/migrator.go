@@ -0,0 +1,207 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"time"
+)
+
+// DefaultTable is the default version table of the migrator
+const DefaultTable = "lokstra_auth_schema_migrations"
+
+// defaultLockID is the default advisory lock key ("lokstra" in ASCII)
+const defaultLockID int64 = 0x6c6f6b73747261
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Config holds migrator configuration
+type Config struct {
+	// Source is the migration directory (default: Postgres)
+	Source fs.FS
+
+	// Table records the applied migrations (default: DefaultTable)
+	Table string
+
+	// LockID is the key of the advisory lock that serializes migrators of
+	// concurrently starting instances (default: "lokstra" in ASCII)
+	LockID int64
+}
+
+// Status is a migration and when it was applied
+type Status struct {
+	*Migration
+
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time
+}
+
+// Migrator applies migrations to a PostgreSQL database. It works with any
+// database/sql PostgreSQL driver (pgx stdlib, lib/pq).
+type Migrator struct {
+	db         *sql.DB
+	config     *Config
+	migrations []*Migration
+}
+
+// New creates a migrator and loads its migrations
+func New(db *sql.DB, config *Config) (*Migrator, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.Source == nil {
+		config.Source = Postgres
+	}
+	if config.Table == "" {
+		config.Table = DefaultTable
+	}
+	if config.LockID == 0 {
+		config.LockID = defaultLockID
+	}
+	if !tableNamePattern.MatchString(config.Table) {
+		return nil, fmt.Errorf("invalid table name: %q", config.Table)
+	}
+
+	migrations, err := Load(config.Source)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, config: config, migrations: migrations}, nil
+}
+
+// Up applies the migrations of the default bundle; call it at startup
+func Up(ctx context.Context, db *sql.DB) error {
+	m, err := New(db, nil)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(ctx)
+	return err
+}
+
+// Migrations returns the migrations of the migrator, ordered by version
+func (m *Migrator) Migrations() []*Migration {
+	return m.migrations
+}
+
+// Up applies pending migrations in order, each in its own transaction, and
+// returns the applied ones. It fails without applying anything when an
+// applied migration was changed since.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []*Migration
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			continue
+		}
+		ok, err := m.apply(ctx, status.Migration)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, status.Migration)
+		}
+	}
+	return applied, nil
+}
+
+// Status returns every migration with when it was applied. It fails when an
+// applied migration was changed since.
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`SELECT version, checksum, applied_at FROM %s`, m.config.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type record struct {
+		checksum  string
+		appliedAt time.Time
+	}
+	records := make(map[int]record)
+	for rows.Next() {
+		var version int
+		var r record
+		if err := rows.Scan(&version, &r.checksum, &r.appliedAt); err != nil {
+			return nil, err
+		}
+		records[version] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := &Status{Migration: migration}
+		if r, ok := records[migration.Version]; ok {
+			if r.checksum != migration.Checksum {
+				return nil, fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, migration.Version, migration.Name)
+			}
+			appliedAt := r.appliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ensureTable creates the version table if it does not exist
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	if _, err := m.db.ExecContext(ctx, createTableStatement(m.config.Table)); err != nil {
+		return fmt.Errorf("failed to create %s: %w", m.config.Table, err)
+	}
+	return nil
+}
+
+// apply applies a migration under the advisory lock; it returns false when
+// another instance applied it first
+func (m *Migrator) apply(ctx context.Context, migration *Migration) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, m.config.LockID); err != nil {
+		return false, err
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE version = $1)`, m.config.Table),
+		migration.Version).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+		return false, fmt.Errorf("failed to apply migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (version, name, checksum) VALUES ($1, $2, $3)`, m.config.Table),
+		migration.Version, migration.Name, migration.Checksum); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// createTableStatement creates the version table if it does not exist
+func createTableStatement(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	checksum   TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, table)
+}
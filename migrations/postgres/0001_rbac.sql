@@ -0,0 +1,39 @@
+-- RBAC roles, permission catalog and role assignments (rbac.PostgresStore
+-- with the default "rbac" prefix)
+
+CREATE TABLE IF NOT EXISTS rbac_roles (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS rbac_permissions (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS rbac_role_permissions (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	role       TEXT NOT NULL,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (tenant_id, role, permission),
+	FOREIGN KEY (tenant_id, role) REFERENCES rbac_roles (tenant_id, name) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS rbac_subject_roles (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	subject_id TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, subject_id, role),
+	FOREIGN KEY (tenant_id, role) REFERENCES rbac_roles (tenant_id, name) ON DELETE CASCADE
+);
+
+-- ListRoleSubjects
+CREATE INDEX IF NOT EXISTS rbac_subject_roles_role_idx ON rbac_subject_roles (tenant_id, role);
@@ -0,0 +1,28 @@
+-- Policies and their version history (policy.PostgresStore with the default
+-- "authz_policies" table)
+
+CREATE TABLE IF NOT EXISTS authz_policies (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	id          TEXT NOT NULL,
+	policy      JSONB NOT NULL,
+	version     INTEGER NOT NULL,
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_by  TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (tenant_id, id)
+);
+
+-- FindBySubject and FindByResource (jsonb containment)
+CREATE INDEX IF NOT EXISTS authz_policies_subjects_idx ON authz_policies USING GIN ((policy->'Subjects'));
+CREATE INDEX IF NOT EXISTS authz_policies_resources_idx ON authz_policies USING GIN ((policy->'Resources'));
+
+CREATE TABLE IF NOT EXISTS authz_policies_versions (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	policy_id   TEXT NOT NULL,
+	version     INTEGER NOT NULL,
+	operation   TEXT NOT NULL,
+	policy      JSONB NOT NULL,
+	author      TEXT NOT NULL DEFAULT '',
+	rollback_of INTEGER NOT NULL DEFAULT 0,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, policy_id, version)
+);
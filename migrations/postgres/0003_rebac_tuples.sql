@@ -0,0 +1,17 @@
+-- Relationship tuples (rebac.PostgresTupleStore with the default
+-- "rebac_tuples" table)
+
+CREATE TABLE IF NOT EXISTS rebac_tuples (
+	tenant_id        TEXT NOT NULL DEFAULT '',
+	object_type      TEXT NOT NULL,
+	object_id        TEXT NOT NULL,
+	relation         TEXT NOT NULL,
+	subject_type     TEXT NOT NULL,
+	subject_id       TEXT NOT NULL,
+	subject_relation TEXT NOT NULL DEFAULT '',
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+);
+
+-- Reads by subject (reverse lookups); reads by object use the primary key
+CREATE INDEX IF NOT EXISTS rebac_tuples_subject_idx ON rebac_tuples (tenant_id, subject_type, subject_id, subject_relation);
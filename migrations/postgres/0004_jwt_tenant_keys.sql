@@ -0,0 +1,17 @@
+-- Signing keys of tenants (jwt.PostgresTenantKeys with the default
+-- "jwt_tenant_keys" table)
+
+CREATE TABLE IF NOT EXISTS jwt_tenant_keys (
+	tenant_id              TEXT NOT NULL,
+	key_id                 TEXT NOT NULL,
+	algorithm              TEXT NOT NULL DEFAULT '',
+	signing_key            BYTEA,
+	verifying_key          BYTEA,
+	issuer                 TEXT NOT NULL DEFAULT '',
+	audience               TEXT NOT NULL DEFAULT '[]',
+	access_token_duration  BIGINT NOT NULL DEFAULT 0,
+	refresh_token_duration BIGINT NOT NULL DEFAULT 0,
+	active                 BOOLEAN NOT NULL DEFAULT false,
+	created_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, key_id)
+);
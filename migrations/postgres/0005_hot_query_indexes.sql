@@ -0,0 +1,11 @@
+-- Indexes of hot queries not covered by primary keys
+
+-- DeletePermission removes the grants of a permission from every role
+CREATE INDEX IF NOT EXISTS rbac_role_permissions_permission_idx ON rbac_role_permissions (tenant_id, permission);
+
+-- SigningKey looks up the active key of a tenant on every token issued; at
+-- most one key per tenant is active (SetKey deactivates the others)
+CREATE UNIQUE INDEX IF NOT EXISTS jwt_tenant_keys_active_idx ON jwt_tenant_keys (tenant_id) WHERE active;
+
+-- RemoveKey activates the newest remaining key of a tenant
+CREATE INDEX IF NOT EXISTS jwt_tenant_keys_created_idx ON jwt_tenant_keys (tenant_id, created_at DESC);
@@ -0,0 +1,19 @@
+-- Direct permissions and groups of subjects, resolved with roles by
+-- rbac.PostgresStore.GetEffectiveAccess (default "rbac" prefix)
+
+CREATE TABLE IF NOT EXISTS rbac_subject_permissions (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	subject_id TEXT NOT NULL,
+	app_id     TEXT NOT NULL DEFAULT '',
+	permission TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, subject_id, app_id, permission)
+);
+
+CREATE TABLE IF NOT EXISTS rbac_subject_groups (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	subject_id TEXT NOT NULL,
+	group_name TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, subject_id, group_name)
+);
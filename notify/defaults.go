@@ -0,0 +1,91 @@
+package notify
+
+// DefaultTemplates returns a registry with the default templates of the
+// magic link, OTP, password reset and email verification messages, and
+// their messages in English ("en") and Indonesian ("id"). The data of the
+// messages has Email and Link (magic link, password reset, email
+// verification) or Code (OTP).
+func DefaultTemplates() *Registry {
+	registry := NewRegistry(DefaultLocale)
+
+	registry.Register(MessageMagicLink, "", &Template{
+		Subject: `{{t "magic_link.subject"}}`,
+		Body: `{{t "magic_link.body"}}
+
+{{.Link}}
+
+{{t "footer.ignore"}}
+`,
+		HTML: `<p>{{t "magic_link.body"}}</p>
+<p><a href="{{.Link}}">{{t "magic_link.action"}}</a></p>
+<p>{{t "footer.ignore"}}</p>
+`,
+	})
+	registry.Register(MessageOTP, "", &Template{
+		Subject: `{{t "otp.subject"}}`,
+		Body: `{{t "otp.body" .Code}}
+
+{{t "footer.ignore"}}
+`,
+		HTML: `<p>{{t "otp.body" .Code}}</p>
+<p>{{t "footer.ignore"}}</p>
+`,
+	})
+	registry.Register(MessagePasswordReset, "", &Template{
+		Subject: `{{t "password_reset.subject"}}`,
+		Body: `{{t "password_reset.body"}}
+
+{{.Link}}
+
+{{t "footer.ignore"}}
+`,
+		HTML: `<p>{{t "password_reset.body"}}</p>
+<p><a href="{{.Link}}">{{t "password_reset.action"}}</a></p>
+<p>{{t "footer.ignore"}}</p>
+`,
+	})
+	registry.Register(MessageEmailVerification, "", &Template{
+		Subject: `{{t "email_verification.subject"}}`,
+		Body: `{{t "email_verification.body" .Email}}
+
+{{.Link}}
+
+{{t "footer.ignore"}}
+`,
+		HTML: `<p>{{t "email_verification.body" .Email}}</p>
+<p><a href="{{.Link}}">{{t "email_verification.action"}}</a></p>
+<p>{{t "footer.ignore"}}</p>
+`,
+	})
+
+	registry.RegisterMessages("", "en", map[string]string{
+		"magic_link.subject":         "Your sign-in link",
+		"magic_link.body":            "Use the link below to sign in. It can be used once and expires soon.",
+		"magic_link.action":          "Sign in",
+		"otp.subject":                "Your verification code",
+		"otp.body":                   "Your verification code is %s. It can be used once and expires in a few minutes.",
+		"password_reset.subject":     "Reset your password",
+		"password_reset.body":        "We received a request to reset your password. Use the link below to choose a new one.",
+		"password_reset.action":      "Reset password",
+		"email_verification.subject": "Verify your email address",
+		"email_verification.body":    "Confirm that %s is your email address with the link below.",
+		"email_verification.action":  "Verify email",
+		"footer.ignore":              "If you did not request this, you can ignore this message.",
+	})
+	registry.RegisterMessages("", "id", map[string]string{
+		"magic_link.subject":         "Link masuk Anda",
+		"magic_link.body":            "Gunakan link di bawah untuk masuk. Link hanya dapat dipakai sekali dan segera kedaluwarsa.",
+		"magic_link.action":          "Masuk",
+		"otp.subject":                "Kode verifikasi Anda",
+		"otp.body":                   "Kode verifikasi Anda adalah %s. Kode hanya dapat dipakai sekali dan kedaluwarsa dalam beberapa menit.",
+		"password_reset.subject":     "Atur ulang password Anda",
+		"password_reset.body":        "Kami menerima permintaan untuk mengatur ulang password Anda. Gunakan link di bawah untuk membuat password baru.",
+		"password_reset.action":      "Atur ulang password",
+		"email_verification.subject": "Verifikasi alamat email Anda",
+		"email_verification.body":    "Konfirmasi bahwa %s adalah alamat email Anda melalui link di bawah.",
+		"email_verification.action":  "Verifikasi email",
+		"footer.ignore":              "Jika Anda tidak meminta pesan ini, abaikan saja.",
+	})
+
+	return registry
+}
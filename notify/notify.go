@@ -0,0 +1,102 @@
+// Package notify delivers messages to users over a channel (email, SMS,
+// push) through a Sender: passwordless magic links and OTP codes (see
+// TokenSender), password resets, email verifications and security alerts
+// such as a login from a new device or location. Messages are rendered
+// from the templates of a Registry, with per-tenant overrides, localized
+// messages and text and HTML parts. SMTPSender and SendGridSender are
+// reference email senders.
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNoTemplate  = errors.New("no notification template")
+	ErrNoRecipient = errors.New("notification has no recipient")
+)
+
+// Message types of the auth communications
+const (
+	MessageMagicLink         = "magic_link"
+	MessageOTP               = "otp"
+	MessagePasswordReset     = "password_reset"
+	MessageEmailVerification = "email_verification"
+)
+
+// Notification is a message to a user
+type Notification struct {
+	// Type is the notification type (e.g., "new_device_login")
+	Type string
+
+	// TenantID is the tenant of the user (optional), selecting the tenant
+	// overrides of the templates
+	TenantID string
+
+	// Locale is the locale of the user (e.g., "id-ID"; default: the default
+	// locale of the registry)
+	Locale string
+
+	// SubjectID is the user notified
+	SubjectID string
+
+	// Recipient is the address of the user on the channel (email address,
+	// phone number, device token)
+	Recipient string
+
+	// Subject, Body (text) and HTML are the rendered message. HTML is empty
+	// when the template has no HTML part.
+	Subject string
+	Body    string
+	HTML    string
+
+	// Data is the data the message was rendered from, for senders
+	// rendering their own (e.g., provider-side templates)
+	Data map[string]any
+}
+
+// Sender delivers notifications
+type Sender interface {
+	Send(ctx context.Context, notification *Notification) error
+}
+
+// SenderFunc adapts a function to a Sender
+type SenderFunc func(ctx context.Context, notification *Notification) error
+
+// Send calls f(ctx, notification)
+func (f SenderFunc) Send(ctx context.Context, notification *Notification) error {
+	return f(ctx, notification)
+}
+
+// ChannelSender is implemented by Senders that report their delivery
+// channel (e.g., "email", "sms")
+type ChannelSender interface {
+	Channel() string
+}
+
+// Notify renders a notification with the templates of its type, tenant and
+// locale, and sends it
+func Notify(ctx context.Context, sender Sender, templates *Registry, notification *Notification) error {
+	if notification.Recipient == "" {
+		return ErrNoRecipient
+	}
+	if err := templates.Render(notification); err != nil {
+		return err
+	}
+	return sender.Send(ctx, notification)
+}
+
+type localeKey struct{}
+
+// WithLocale returns a context carrying the locale of the user of a request
+// (e.g., from the Accept-Language header or the user profile)
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext returns the locale set by WithLocale ("" if none)
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey{}).(string)
+	return locale
+}
@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"time"
+)
+
+// SendGridURL is the SendGrid v3 mail send endpoint
+const SendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGridConfig holds SendGrid sender configuration
+type SendGridConfig struct {
+	// APIKey is the SendGrid API key (required)
+	APIKey string
+
+	// From is the sender address, e.g., "Acme <no-reply@acme.com>"
+	// (required)
+	From string
+
+	// URL overrides the mail send endpoint (e.g., the EU region endpoint)
+	URL string
+
+	// HTTPClient is the HTTP client (default: 10 second timeout)
+	HTTPClient *http.Client
+}
+
+// SendGridSender is a reference email Sender delivering notifications with
+// the SendGrid v3 mail send API. The notification type is sent as the
+// SendGrid category.
+type SendGridSender struct {
+	config *SendGridConfig
+	from   *mail.Address
+}
+
+// NewSendGridSender creates a new SendGrid sender
+func NewSendGridSender(config *SendGridConfig) (*SendGridSender, error) {
+	if config.APIKey == "" {
+		return nil, errors.New("sendgrid api key is required")
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sendgrid from address: %w", err)
+	}
+	if config.URL == "" {
+		config.URL = SendGridURL
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &SendGridSender{config: config, from: from}, nil
+}
+
+// Channel returns "email"
+func (s *SendGridSender) Channel() string {
+	return "email"
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Send delivers a notification to its recipient email address
+func (s *SendGridSender) Send(ctx context.Context, notification *Notification) error {
+	to, err := mail.ParseAddress(notification.Recipient)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	content := []sendGridContent{{Type: "text/plain", Value: notification.Body}}
+	if notification.HTML != "" {
+		content = append(content, sendGridContent{Type: "text/html", Value: notification.HTML})
+	}
+	request := map[string]any{
+		"personalizations": []map[string]any{{
+			"to": []sendGridAddress{{Email: to.Address, Name: to.Name}},
+		}},
+		"from":    sendGridAddress{Email: s.from.Address, Name: s.from.Name},
+		"subject": notification.Subject,
+		"content": content,
+	}
+	if notification.Type != "" {
+		request["categories"] = []string{notification.Type}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+
+	resp, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sendgrid returned status %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds SMTP sender configuration
+type SMTPConfig struct {
+	// Host and Port are the address of the SMTP server (Port default: 587)
+	Host string
+	Port int
+
+	// Username and Password authenticate with PLAIN auth (optional)
+	Username string
+	Password string
+
+	// From is the sender address, e.g., "Acme <no-reply@acme.com>"
+	// (required)
+	From string
+
+	// ImplicitTLS connects with TLS (port 465). Otherwise the connection is
+	// upgraded with STARTTLS when the server supports it.
+	ImplicitTLS bool
+
+	// TLSConfig configures TLS (default: verifying Host)
+	TLSConfig *tls.Config
+
+	// Timeout bounds the connection (default: 10 seconds)
+	Timeout time.Duration
+}
+
+// SMTPSender is a reference email Sender delivering notifications over
+// SMTP, as multipart/alternative messages when they have an HTML part
+type SMTPSender struct {
+	config *SMTPConfig
+	from   *mail.Address
+}
+
+// NewSMTPSender creates a new SMTP sender
+func NewSMTPSender(config *SMTPConfig) (*SMTPSender, error) {
+	if config.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp from address: %w", err)
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{ServerName: config.Host}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &SMTPSender{config: config, from: from}, nil
+}
+
+// Channel returns "email"
+func (s *SMTPSender) Channel() string {
+	return "email"
+}
+
+// Send delivers a notification to its recipient email address
+func (s *SMTPSender) Send(ctx context.Context, notification *Notification) error {
+	to, err := mail.ParseAddress(notification.Recipient)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	message, err := buildMessage(s.from, to, notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	address := net.JoinHostPort(s.config.Host, fmt.Sprint(s.config.Port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if s.config.ImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.config.TLSConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !s.config.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(s.config.TLSConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage builds the MIME message of a notification: text/plain, or
+// multipart/alternative with text and HTML parts
+func buildMessage(from, to *mail.Address, notification *Notification) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", notification.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+
+	if notification.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, notification.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", notification.Body},
+		{"text/html; charset=utf-8", notification.HTML},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(writer, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	writer := quotedprintable.NewWriter(w)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultLocale is the default locale of registries
+const DefaultLocale = "en"
+
+// Template is the template of a notification. Subject, Body (text part) and
+// HTML (optional HTML part) are template sources executed with the
+// notification data; HTML is executed with html/template, escaping the
+// data. Templates can use the localized messages of the registry with
+// {{t "key" args...}}.
+type Template struct {
+	Subject string
+	Body    string
+	HTML    string
+}
+
+// Registry holds notification templates by message type and locale, with
+// per-tenant overrides, and the localized messages the templates refer to
+// by key. A template or message is looked up in the requested locale, then
+// its language ("id" for "id-ID"), then the default locale; in each, the
+// tenant override comes before the global one.
+type Registry struct {
+	mu            sync.RWMutex
+	defaultLocale string
+	templates     map[templateKey]*Template
+	messages      map[catalogKey]map[string]string
+}
+
+type templateKey struct {
+	tenantID    string
+	messageType string
+	locale      string
+}
+
+type catalogKey struct {
+	tenantID string
+	locale   string
+}
+
+// NewRegistry creates a new template registry (defaultLocale defaults to
+// DefaultLocale)
+func NewRegistry(defaultLocale string) *Registry {
+	if defaultLocale == "" {
+		defaultLocale = DefaultLocale
+	}
+	return &Registry{
+		defaultLocale: defaultLocale,
+		templates:     make(map[templateKey]*Template),
+		messages:      make(map[catalogKey]map[string]string),
+	}
+}
+
+// Register sets the global template of a message type in a locale ("" for
+// the default locale)
+func (r *Registry) Register(messageType, locale string, tmpl *Template) *Registry {
+	return r.RegisterTenant("", messageType, locale, tmpl)
+}
+
+// RegisterTenant sets the template of a message type in a locale for a
+// tenant, overriding the global template
+func (r *Registry) RegisterTenant(tenantID, messageType, locale string, tmpl *Template) *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if locale == "" {
+		locale = r.defaultLocale
+	}
+	r.templates[templateKey{tenantID, messageType, locale}] = tmpl
+	return r
+}
+
+// RegisterMessages adds localized messages (key -> fmt format) of a locale
+// ("" for the default locale). tenantID overrides the global messages of a
+// tenant ("" for the global messages).
+func (r *Registry) RegisterMessages(tenantID, locale string, messages map[string]string) *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if locale == "" {
+		locale = r.defaultLocale
+	}
+	key := catalogKey{tenantID, locale}
+	if r.messages[key] == nil {
+		r.messages[key] = make(map[string]string, len(messages))
+	}
+	for k, v := range messages {
+		r.messages[key][k] = v
+	}
+	return r
+}
+
+// Lookup returns the template of a message type for a tenant and locale
+func (r *Registry) Lookup(tenantID, messageType, locale string) (*Template, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, candidate := range r.locales(locale) {
+		for _, tenant := range tenants(tenantID) {
+			if tmpl, ok := r.templates[templateKey{tenant, messageType, candidate}]; ok {
+				return tmpl, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Translate returns the localized message of a key for a tenant and locale,
+// formatted with args (the key itself when no locale has it)
+func (r *Registry) Translate(tenantID, locale, key string, args ...any) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, candidate := range r.locales(locale) {
+		for _, tenant := range tenants(tenantID) {
+			if format, ok := r.messages[catalogKey{tenant, candidate}][key]; ok {
+				if len(args) == 0 {
+					return format
+				}
+				return fmt.Sprintf(format, args...)
+			}
+		}
+	}
+	return key
+}
+
+// Render renders the subject, body and HTML of a notification with the
+// template of its type, tenant and locale
+func (r *Registry) Render(notification *Notification) error {
+	tmpl, ok := r.Lookup(notification.TenantID, notification.Type, notification.Locale)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoTemplate, notification.Type)
+	}
+
+	translate := func(key string, args ...any) string {
+		return r.Translate(notification.TenantID, notification.Locale, key, args...)
+	}
+	subject, body, html, err := tmpl.render(notification.Data, translate)
+	if err != nil {
+		return fmt.Errorf("failed to render notification %s: %w", notification.Type, err)
+	}
+	notification.Subject = subject
+	notification.Body = body
+	notification.HTML = html
+	return nil
+}
+
+// Render renders the subject, body and HTML of the template; {{t "key"}}
+// returns the key
+func (t *Template) Render(data map[string]any) (subject, body, html string, err error) {
+	return t.render(data, func(key string, args ...any) string { return key })
+}
+
+func (t *Template) render(data map[string]any, translate func(string, ...any) string) (subject, body, html string, err error) {
+	funcs := map[string]any{"t": translate}
+	if subject, err = renderText("subject", t.Subject, data, funcs); err != nil {
+		return "", "", "", err
+	}
+	// Subjects are single header lines
+	subject = strings.Join(strings.Fields(subject), " ")
+	if body, err = renderText("body", t.Body, data, funcs); err != nil {
+		return "", "", "", err
+	}
+	if t.HTML != "" {
+		if html, err = renderHTML("html", t.HTML, data, funcs); err != nil {
+			return "", "", "", err
+		}
+	}
+	return subject, body, html, nil
+}
+
+func renderText(name, source string, data map[string]any, funcs template.FuncMap) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Funcs(funcs).Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func renderHTML(name, source string, data map[string]any, funcs htmltemplate.FuncMap) (string, error) {
+	tmpl, err := htmltemplate.New(name).Option("missingkey=zero").Funcs(funcs).Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// locales returns the lookup order of a locale: the locale, its language
+// and the default locale
+func (r *Registry) locales(locale string) []string {
+	var locales []string
+	if locale != "" {
+		locales = append(locales, locale)
+		if language, _, ok := strings.Cut(locale, "-"); ok {
+			locales = append(locales, language)
+		}
+	}
+	return append(locales, r.defaultLocale)
+}
+
+// tenants returns the lookup order of a tenant: its overrides, then the
+// global entries
+func tenants(tenantID string) []string {
+	if tenantID == "" {
+		return []string{""}
+	}
+	return []string{tenantID, ""}
+}
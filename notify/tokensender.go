@@ -0,0 +1,92 @@
+package notify
+
+import "context"
+
+// TokenSenderConfig holds token sender configuration
+type TokenSenderConfig struct {
+	// Sender delivers the messages (required)
+	Sender Sender
+
+	// Templates render the messages (default: DefaultTemplates())
+	Templates *Registry
+
+	// Tenant returns the tenant of a request, selecting the tenant
+	// overrides of the templates (e.g., authz.TenantFromContext)
+	Tenant func(ctx context.Context) string
+
+	// Locale returns the locale of the user of a request (default:
+	// LocaleFromContext)
+	Locale func(ctx context.Context) string
+}
+
+// TokenSender sends the templated messages of the auth flows: passwordless
+// magic links and OTP codes (it implements passwordless.TokenSender),
+// password resets and email verifications
+type TokenSender struct {
+	config *TokenSenderConfig
+}
+
+// NewTokenSender creates a new token sender
+func NewTokenSender(config *TokenSenderConfig) *TokenSender {
+	if config.Templates == nil {
+		config.Templates = DefaultTemplates()
+	}
+	if config.Locale == nil {
+		config.Locale = LocaleFromContext
+	}
+	return &TokenSender{config: config}
+}
+
+// SendMagicLink sends a magic link
+func (s *TokenSender) SendMagicLink(ctx context.Context, email, token, link string) error {
+	return s.send(ctx, MessageMagicLink, email, map[string]any{
+		"Email": email,
+		"Token": token,
+		"Link":  link,
+	})
+}
+
+// SendOTP sends an OTP code
+func (s *TokenSender) SendOTP(ctx context.Context, email, code string) error {
+	return s.send(ctx, MessageOTP, email, map[string]any{
+		"Email": email,
+		"Code":  code,
+	})
+}
+
+// SendPasswordReset sends a password reset link
+func (s *TokenSender) SendPasswordReset(ctx context.Context, email, link string) error {
+	return s.send(ctx, MessagePasswordReset, email, map[string]any{
+		"Email": email,
+		"Link":  link,
+	})
+}
+
+// SendEmailVerification sends an email verification link
+func (s *TokenSender) SendEmailVerification(ctx context.Context, email, link string) error {
+	return s.send(ctx, MessageEmailVerification, email, map[string]any{
+		"Email": email,
+		"Link":  link,
+	})
+}
+
+// Channel returns the channel of the sender ("" if it does not report one)
+func (s *TokenSender) Channel() string {
+	if sender, ok := s.config.Sender.(ChannelSender); ok {
+		return sender.Channel()
+	}
+	return ""
+}
+
+func (s *TokenSender) send(ctx context.Context, messageType, recipient string, data map[string]any) error {
+	notification := &Notification{
+		Type:      messageType,
+		Locale:    s.config.Locale(ctx),
+		Recipient: recipient,
+		Data:      data,
+	}
+	if s.config.Tenant != nil {
+		notification.TenantID = s.config.Tenant(ctx)
+	}
+	return Notify(ctx, s.config.Sender, s.config.Templates, notification)
+}
@@ -0,0 +1,237 @@
+// Package oidc lets lokstra-auth act as an OAuth2 / OpenID Connect provider:
+// internal apps register as clients and sign users in against lokstra-auth
+// with the authorization code flow (PKCE), receiving ID tokens signed by the
+// provider key and access tokens issued by the token manager.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClientNotFound = errors.New("client not found")
+	ErrClientExists   = errors.New("client already exists")
+	ErrInvalidClient  = errors.New("invalid client")
+)
+
+// Grant types supported by the provider
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// Client is an application registered to sign users in with the provider
+type Client struct {
+	// ID is the client_id
+	ID string `json:"client_id"`
+
+	// SecretHash is the SHA-256 hash of the client secret (empty for
+	// public clients)
+	SecretHash string `json:"-"`
+
+	// Name is shown on the consent page
+	Name string `json:"client_name"`
+
+	// RedirectURIs are the exact redirect URIs the client may use
+	RedirectURIs []string `json:"redirect_uris"`
+
+	// Scopes are the scopes the client may request (empty = any supported scope)
+	Scopes []string `json:"scopes,omitempty"`
+
+	// GrantTypes are the grants the client may use
+	// (default: authorization_code and refresh_token)
+	GrantTypes []string `json:"grant_types,omitempty"`
+
+	// Public clients (SPAs, mobile apps) have no secret and must use PKCE
+	Public bool `json:"public"`
+
+	// FirstParty clients skip the consent page
+	FirstParty bool `json:"first_party"`
+
+	// TenantID restricts sign-in to users of one tenant (optional)
+	TenantID string `json:"tenant_id,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AllowsGrant reports whether the client may use a grant type
+func (c *Client) AllowsGrant(grantType string) bool {
+	if len(c.GrantTypes) == 0 {
+		return grantType == GrantAuthorizationCode || grantType == GrantRefreshToken
+	}
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsRedirectURI reports whether a redirect URI is registered (exact match)
+func (c *Client) AllowsRedirectURI(redirectURI string) bool {
+	return slices.Contains(c.RedirectURIs, redirectURI)
+}
+
+// AllowsScope reports whether the client may request a scope
+func (c *Client) AllowsScope(scope string) bool {
+	return len(c.Scopes) == 0 || slices.Contains(c.Scopes, scope)
+}
+
+// VerifySecret checks a client secret in constant time
+func (c *Client) VerifySecret(secret string) bool {
+	if c.Public || c.SecretHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(c.SecretHash)) == 1
+}
+
+// HashSecret returns the SHA-256 hash of a client secret. Secrets are
+// random, so a fast hash is sufficient.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientStore stores registered clients
+type ClientStore interface {
+	// Create registers a client
+	Create(ctx context.Context, client *Client) error
+
+	// Get retrieves a client
+	Get(ctx context.Context, clientID string) (*Client, error)
+
+	// Update replaces a client
+	Update(ctx context.Context, client *Client) error
+
+	// Delete removes a client
+	Delete(ctx context.Context, clientID string) error
+
+	// List returns all clients
+	List(ctx context.Context) ([]*Client, error)
+}
+
+// RegisterClient registers a client, generating its ID (when empty) and,
+// for confidential clients, a secret. The secret is returned once and only
+// its hash is stored.
+func RegisterClient(ctx context.Context, store ClientStore, client *Client) (secret string, err error) {
+	if len(client.RedirectURIs) == 0 {
+		return "", fmt.Errorf("%w: at least one redirect URI is required", ErrInvalidClient)
+	}
+
+	if client.ID == "" {
+		if client.ID, err = randomToken(16); err != nil {
+			return "", err
+		}
+	}
+	if !client.Public {
+		if secret, err = randomToken(32); err != nil {
+			return "", err
+		}
+		client.SecretHash = HashSecret(secret)
+	}
+	if client.CreatedAt.IsZero() {
+		client.CreatedAt = time.Now()
+	}
+
+	if err := store.Create(ctx, client); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// InMemoryClientStore is an in-memory implementation of ClientStore
+type InMemoryClientStore struct {
+	mu      sync.RWMutex
+	clients map[string]*Client
+}
+
+// NewInMemoryClientStore creates a new in-memory client store
+func NewInMemoryClientStore() *InMemoryClientStore {
+	return &InMemoryClientStore{
+		clients: make(map[string]*Client),
+	}
+}
+
+// Create registers a client
+func (s *InMemoryClientStore) Create(ctx context.Context, client *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.clients[client.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrClientExists, client.ID)
+	}
+	s.clients[client.ID] = cloneClient(client)
+	return nil
+}
+
+// Get retrieves a client
+func (s *InMemoryClientStore) Get(ctx context.Context, clientID string) (*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.clients[clientID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	return cloneClient(client), nil
+}
+
+// Update replaces a client
+func (s *InMemoryClientStore) Update(ctx context.Context, client *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[client.ID]; !ok {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, client.ID)
+	}
+	s.clients[client.ID] = cloneClient(client)
+	return nil
+}
+
+// Delete removes a client
+func (s *InMemoryClientStore) Delete(ctx context.Context, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[clientID]; !ok {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	delete(s.clients, clientID)
+	return nil
+}
+
+// List returns all clients ordered by ID
+func (s *InMemoryClientStore) List(ctx context.Context) ([]*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, cloneClient(client))
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients, nil
+}
+
+func cloneClient(client *Client) *Client {
+	copied := *client
+	copied.RedirectURIs = slices.Clone(client.RedirectURIs)
+	copied.Scopes = slices.Clone(client.Scopes)
+	copied.GrantTypes = slices.Clone(client.GrantTypes)
+	return &copied
+}
+
+// randomToken returns a random URL-safe token of n bytes
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,70 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// grantView is a consent of the user as listed by the grants API
+type grantView struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name,omitempty"`
+	Scopes     []string  `json:"scopes"`
+	GrantedAt  time.Time `json:"granted_at"`
+}
+
+// Consents lists the clients the signed-in user granted scopes to, so the
+// user can review them (GET {prefix}/consents)
+func (p *Provider) Consents(w http.ResponseWriter, r *http.Request) {
+	session, err := p.session(r)
+	if err != nil {
+		writeOAuthError(w, oauthError(http.StatusUnauthorized, "invalid_token", "the user is not signed in"))
+		return
+	}
+
+	ctx := r.Context()
+	subjectID, _ := session.Claims.GetString("sub")
+	consents, err := p.config.Consents.List(ctx, subjectID)
+	if err != nil {
+		writeOAuthError(w, oauthError(http.StatusInternalServerError, "server_error", err.Error()))
+		return
+	}
+
+	grants := make([]grantView, 0, len(consents))
+	for _, consent := range consents {
+		grant := grantView{ClientID: consent.ClientID, Scopes: consent.Scopes, GrantedAt: consent.GrantedAt}
+		// Clients of API keys are not registered OAuth2 clients
+		if client, err := p.config.Clients.Get(ctx, consent.ClientID); err == nil {
+			grant.ClientName = client.Name
+		}
+		grants = append(grants, grant)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"grants": grants})
+}
+
+// DeleteConsent revokes the consent of the signed-in user to a client and
+// the refresh tokens the client holds (DELETE {prefix}/consents/{client_id}).
+// The client must send the user through the consent prompt again.
+func (p *Provider) DeleteConsent(w http.ResponseWriter, r *http.Request) {
+	session, err := p.session(r)
+	if err != nil {
+		writeOAuthError(w, oauthError(http.StatusUnauthorized, "invalid_token", "the user is not signed in"))
+		return
+	}
+	if !p.verifyCSRF(w, r) {
+		return
+	}
+
+	subjectID, _ := session.Claims.GetString("sub")
+	err = p.RevokeConsent(r.Context(), subjectID, r.PathValue("client_id"))
+	if errors.Is(err, ErrConsentNotFound) {
+		writeOAuthError(w, oauthError(http.StatusNotFound, "invalid_request", err.Error()))
+		return
+	}
+	if err != nil {
+		writeOAuthError(w, oauthError(http.StatusInternalServerError, "server_error", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,684 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	lokstraauth "github.com/primadi/lokstra-auth"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/handlers"
+	"github.com/primadi/lokstra-auth/middleware"
+)
+
+// Error is an OAuth2 error response (RFC 6749 section 5.2)
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+// Error returns the error code and description
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(status int, code, description string) *Error {
+	return &Error{Code: code, Description: description, Status: status}
+}
+
+// scopeClaims are the userinfo claims released by each scope
+var scopeClaims = map[string][]string{
+	ScopeProfile: {"name", "given_name", "family_name", "middle_name", "nickname", "preferred_username",
+		"profile", "picture", "website", "gender", "birthdate", "zoneinfo", "locale", "updated_at"},
+	ScopeEmail:   {"email", "email_verified"},
+	ScopePhone:   {"phone_number", "phone_number_verified"},
+	ScopeAddress: {"address"},
+}
+
+// authorizeRequest is a validated authorization request
+type authorizeRequest struct {
+	client        *Client
+	redirectURI   string
+	scopes        []string
+	state         string
+	nonce         string
+	codeChallenge string
+	prompt        []string
+	maxAge        time.Duration
+	params        url.Values
+}
+
+// Authorize is the authorization endpoint (authorization code flow). It
+// sends users without a session to LoginURL and users who have not
+// consented to ConsentURL, then redirects to the client with a code.
+// The consent page posts its decision back to this endpoint.
+func (p *Provider) Authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+
+	req, oerr := p.parseAuthorize(r)
+	if oerr != nil {
+		if req == nil {
+			// The redirect URI is not trusted: report to the user agent
+			writeOAuthError(w, oerr)
+			return
+		}
+		p.redirectError(w, r, req, oerr)
+		return
+	}
+
+	// Authenticate the user
+	ctx := r.Context()
+	session, err := p.session(r)
+	reauth := slices.Contains(req.prompt, "login")
+	if err == nil && req.maxAge > 0 {
+		authTime, _ := sessionAuthTime(session)
+		reauth = reauth || time.Since(authTime) > req.maxAge
+	}
+	if err != nil || reauth {
+		if slices.Contains(req.prompt, "none") {
+			p.redirectError(w, r, req, oauthError(0, "login_required", "the user is not signed in"))
+			return
+		}
+		if p.config.LoginURL == "" {
+			writeOAuthError(w, oauthError(http.StatusUnauthorized, "login_required", "the user is not signed in"))
+			return
+		}
+		http.Redirect(w, r, withParams(p.config.LoginURL, url.Values{"return_to": {p.returnTo(req, "login")}}), http.StatusFound)
+		return
+	}
+
+	subjectID, _ := session.Claims.GetString("sub")
+	if req.client.TenantID != "" && session.TenantID != req.client.TenantID {
+		p.redirectError(w, r, req, oauthError(0, "access_denied", "the user does not belong to the tenant of the client"))
+		return
+	}
+
+	// Consent
+	if !req.client.FirstParty {
+		consented := false
+		missing := req.scopes
+		if consent, err := p.config.Consents.Get(ctx, subjectID, req.client.ID); err == nil {
+			missing = consent.Missing(req.scopes)
+			consented = len(missing) == 0 && !slices.Contains(req.prompt, "consent")
+		}
+
+		if !consented {
+			switch r.PostForm.Get("decision") {
+			case "allow":
+				if !p.verifyCSRF(w, r) {
+					return
+				}
+				if _, err := p.config.Consents.Grant(ctx, subjectID, req.client.ID, req.scopes); err != nil {
+					p.redirectError(w, r, req, oauthError(0, "server_error", err.Error()))
+					return
+				}
+			case "deny":
+				if !p.verifyCSRF(w, r) {
+					return
+				}
+				p.redirectError(w, r, req, oauthError(0, "access_denied", "the user denied the request"))
+				return
+			default:
+				if slices.Contains(req.prompt, "none") || p.config.ConsentURL == "" {
+					p.redirectError(w, r, req, oauthError(0, "consent_required", "the user has not consented to the requested scopes"))
+					return
+				}
+				http.Redirect(w, r, withParams(p.config.ConsentURL, url.Values{
+					"client_id":   {req.client.ID},
+					"client_name": {req.client.Name},
+					"scope":       {strings.Join(req.scopes, " ")},
+					"new_scope":   {strings.Join(missing, " ")},
+					"return_to":   {p.returnTo(req, "consent")},
+				}), http.StatusFound)
+				return
+			}
+		}
+	}
+
+	// Issue the code
+	code, err := randomToken(32)
+	if err != nil {
+		p.redirectError(w, r, req, oauthError(0, "server_error", err.Error()))
+		return
+	}
+	authTime, _ := sessionAuthTime(session)
+	if err := p.config.Grants.SaveCode(ctx, &AuthorizationCode{
+		CodeHash:      HashSecret(code),
+		ClientID:      req.client.ID,
+		RedirectURI:   req.params.Get("redirect_uri"),
+		SubjectID:     subjectID,
+		Scopes:        req.scopes,
+		Nonce:         req.nonce,
+		CodeChallenge: req.codeChallenge,
+		Claims:        tenantClaims(session.TenantID, session.AppID),
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(p.config.CodeTTL),
+	}); err != nil {
+		p.redirectError(w, r, req, oauthError(0, "server_error", err.Error()))
+		return
+	}
+
+	http.Redirect(w, r, withParams(req.redirectURI, url.Values{
+		"code":  {code},
+		"state": {req.state},
+		"iss":   {p.config.Issuer},
+	}), http.StatusFound)
+}
+
+// parseAuthorize validates an authorization request. A nil request is
+// returned when the error must not be redirected to the client.
+func (p *Provider) parseAuthorize(r *http.Request) (*authorizeRequest, *Error) {
+	params := r.Form
+	client, err := p.config.Clients.Get(r.Context(), params.Get("client_id"))
+	if err != nil {
+		return nil, oauthError(http.StatusBadRequest, "invalid_client", "unknown client_id")
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.AllowsRedirectURI(redirectURI) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for the client")
+	}
+
+	req := &authorizeRequest{
+		client:        client,
+		redirectURI:   redirectURI,
+		scopes:        strings.Fields(params.Get("scope")),
+		state:         params.Get("state"),
+		nonce:         params.Get("nonce"),
+		codeChallenge: params.Get("code_challenge"),
+		prompt:        strings.Fields(params.Get("prompt")),
+		params:        params,
+	}
+
+	if params.Get("response_type") != "code" {
+		return req, oauthError(0, "unsupported_response_type", "only response_type=code is supported")
+	}
+	if !client.AllowsGrant(GrantAuthorizationCode) {
+		return req, oauthError(0, "unauthorized_client", "the client may not use the authorization code grant")
+	}
+	for _, scope := range req.scopes {
+		if !slices.Contains(p.config.Scopes, scope) || !client.AllowsScope(scope) {
+			return req, oauthError(0, "invalid_scope", "scope not allowed: "+scope)
+		}
+	}
+	if req.codeChallenge != "" && params.Get("code_challenge_method") != "S256" {
+		return req, oauthError(0, "invalid_request", "code_challenge_method must be S256")
+	}
+	if req.codeChallenge == "" && client.Public {
+		return req, oauthError(0, "invalid_request", "public clients must use PKCE (code_challenge)")
+	}
+	if maxAge := params.Get("max_age"); maxAge != "" {
+		seconds, err := time.ParseDuration(maxAge + "s")
+		if err != nil || seconds < 0 {
+			return req, oauthError(0, "invalid_request", "invalid max_age")
+		}
+		req.maxAge = max(seconds, time.Second)
+	}
+	return req, nil
+}
+
+// tokenRequest is the body of the token endpoint
+type tokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+	ClientID     string
+	ClientSecret string
+}
+
+// tokenResponse is the response of the token endpoint
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// issuedGrant is what the token endpoint issues tokens for
+type issuedGrant struct {
+	client    *Client
+	subjectID string
+	scopes    []string
+	nonce     string
+
+	// grantScopes are the scopes of the rotated refresh token (the original
+	// grant, when the request narrowed scopes)
+	grantScopes []string
+	claims      map[string]any
+	authTime    time.Time
+}
+
+// Token is the token endpoint (authorization_code and refresh_token grants).
+// Confidential clients authenticate with client_secret_basic or
+// client_secret_post; public clients send their client_id and PKCE verifier.
+func (p *Provider) Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+	req := tokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+	}
+
+	client, oerr := p.authenticateClient(r, &req)
+	if oerr != nil {
+		writeOAuthError(w, oerr)
+		return
+	}
+	if !client.AllowsGrant(req.GrantType) {
+		writeOAuthError(w, oauthError(http.StatusBadRequest, "unauthorized_client", "the client may not use this grant type"))
+		return
+	}
+
+	var grant *issuedGrant
+	switch req.GrantType {
+	case GrantAuthorizationCode:
+		grant, oerr = p.redeemCode(r, client, &req)
+	case GrantRefreshToken:
+		grant, oerr = p.redeemRefreshToken(r, client, &req)
+	default:
+		oerr = oauthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+	if oerr != nil {
+		writeOAuthError(w, oerr)
+		return
+	}
+
+	resp, oerr := p.issueTokens(r, grant)
+	if oerr != nil {
+		writeOAuthError(w, oerr)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// authenticateClient authenticates the client of a token request
+func (p *Provider) authenticateClient(r *http.Request, req *tokenRequest) (*Client, *Error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = req.ClientID, req.ClientSecret
+	}
+
+	invalid := oauthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	client, err := p.config.Clients.Get(r.Context(), clientID)
+	if err != nil {
+		return nil, invalid
+	}
+	if client.Public {
+		if secret != "" {
+			return nil, invalid
+		}
+		return client, nil
+	}
+	if !client.VerifySecret(secret) {
+		return nil, invalid
+	}
+	return client, nil
+}
+
+// redeemCode redeems an authorization code
+func (p *Provider) redeemCode(r *http.Request, client *Client, req *tokenRequest) (*issuedGrant, *Error) {
+	invalid := oauthError(http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+
+	code, err := p.config.Grants.ConsumeCode(r.Context(), HashSecret(req.Code))
+	if err != nil || code.ClientID != client.ID {
+		return nil, invalid
+	}
+	// The token request must repeat the redirect_uri of the authorization
+	// request, when it had one (RFC 6749 section 4.1.3)
+	if code.RedirectURI != "" && req.RedirectURI != code.RedirectURI {
+		return nil, oauthError(http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if code.CodeChallenge != "" && !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+	}
+
+	return &issuedGrant{
+		client:      client,
+		subjectID:   code.SubjectID,
+		scopes:      code.Scopes,
+		nonce:       code.Nonce,
+		grantScopes: code.Scopes,
+		claims:      code.Claims,
+		authTime:    code.AuthTime,
+	}, nil
+}
+
+// redeemRefreshToken redeems (and rotates) a refresh token, optionally
+// narrowing its scopes
+func (p *Provider) redeemRefreshToken(r *http.Request, client *Client, req *tokenRequest) (*issuedGrant, *Error) {
+	ctx := r.Context()
+	invalid := oauthError(http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+
+	refresh, err := p.config.Grants.ConsumeRefreshToken(ctx, HashSecret(req.RefreshToken))
+	if err != nil || refresh.ClientID != client.ID {
+		return nil, invalid
+	}
+
+	// The user may have revoked the consent since
+	if !client.FirstParty {
+		consent, err := p.config.Consents.Get(ctx, refresh.SubjectID, client.ID)
+		if err != nil || !consent.Covers(refresh.Scopes) {
+			return nil, invalid
+		}
+	}
+
+	scopes := refresh.Scopes
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+		for _, scope := range scopes {
+			if !slices.Contains(refresh.Scopes, scope) {
+				return nil, oauthError(http.StatusBadRequest, "invalid_scope", "scope exceeds the original grant: "+scope)
+			}
+		}
+	}
+
+	return &issuedGrant{
+		client:      client,
+		subjectID:   refresh.SubjectID,
+		scopes:      scopes,
+		grantScopes: refresh.Scopes,
+		claims:      refresh.Claims,
+		authTime:    refresh.AuthTime,
+	}, nil
+}
+
+// issueTokens issues the access token, ID token (openid scope) and refresh
+// token (offline_access grant) of a grant
+func (p *Provider) issueTokens(r *http.Request, grant *issuedGrant) (*tokenResponse, *Error) {
+	ctx := r.Context()
+
+	claims := map[string]any{
+		"sub":       grant.subjectID,
+		"client_id": grant.client.ID,
+		"scope":     strings.Join(grant.scopes, " "),
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+
+	accessToken, err := p.config.Tokens.Generate(ctx, claims)
+	if err != nil {
+		return nil, oauthError(http.StatusInternalServerError, "server_error", err.Error())
+	}
+
+	resp := &tokenResponse{
+		AccessToken: accessToken.Value,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(accessToken.ExpiresAt).Seconds()),
+		Scope:       strings.Join(grant.scopes, " "),
+	}
+
+	if slices.Contains(grant.scopes, ScopeOpenID) {
+		// The identity is built from the new access token, so a subject
+		// that can no longer be resolved gets no tokens
+		verified, err := p.config.Auth.Verify(ctx, &lokstraauth.VerifyRequest{
+			Token:                accessToken.Value,
+			BuildIdentityContext: true,
+		})
+		if err != nil || !verified.Valid || verified.Identity == nil {
+			return nil, oauthError(http.StatusBadRequest, "invalid_grant", "the subject can no longer be resolved")
+		}
+
+		if resp.IDToken, err = p.idToken(grant, verified.Identity); err != nil {
+			return nil, oauthError(http.StatusInternalServerError, "server_error", err.Error())
+		}
+	}
+
+	if slices.Contains(grant.grantScopes, ScopeOfflineAccess) && grant.client.AllowsGrant(GrantRefreshToken) {
+		refreshToken, err := randomToken(32)
+		if err != nil {
+			return nil, oauthError(http.StatusInternalServerError, "server_error", err.Error())
+		}
+		if err := p.config.Grants.SaveRefreshToken(ctx, &RefreshGrant{
+			TokenHash: HashSecret(refreshToken),
+			ClientID:  grant.client.ID,
+			SubjectID: grant.subjectID,
+			Scopes:    grant.grantScopes,
+			Claims:    grant.claims,
+			AuthTime:  grant.authTime,
+			ExpiresAt: time.Now().Add(p.config.RefreshTokenDuration),
+		}); err != nil {
+			return nil, oauthError(http.StatusInternalServerError, "server_error", err.Error())
+		}
+		resp.RefreshToken = refreshToken
+	}
+
+	return resp, nil
+}
+
+// idToken signs the ID token of a grant
+func (p *Provider) idToken(grant *issuedGrant, identity *subject.IdentityContext) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range userClaims(identity, grant.scopes) {
+		claims[k] = v
+	}
+	claims["iss"] = p.config.Issuer
+	claims["sub"] = grant.subjectID
+	claims["aud"] = grant.client.ID
+	claims["azp"] = grant.client.ID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(p.config.IDTokenDuration).Unix()
+	if !grant.authTime.IsZero() {
+		claims["auth_time"] = grant.authTime.Unix()
+	}
+	if grant.nonce != "" {
+		claims["nonce"] = grant.nonce
+	}
+
+	idToken := jwt.NewWithClaims(p.method, claims)
+	idToken.Header["kid"] = p.config.KeyID
+	return idToken.SignedString(p.config.SigningKey)
+}
+
+// UserInfo returns the claims of the user of an access token, filtered by
+// the scopes of the token
+func (p *Provider) UserInfo(w http.ResponseWriter, r *http.Request) {
+	tokenValue, err := handlers.BearerTokenExtractor(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, oauthError(http.StatusUnauthorized, "invalid_token", err.Error()))
+		return
+	}
+
+	verified, err := p.config.Auth.Verify(r.Context(), &lokstraauth.VerifyRequest{
+		Token:                tokenValue,
+		BuildIdentityContext: true,
+	})
+	if err != nil || !verified.Valid || verified.Identity == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, oauthError(http.StatusUnauthorized, "invalid_token", "invalid or expired access token"))
+		return
+	}
+
+	scopes := verified.Claims.Scopes()
+	if !slices.Contains(scopes, ScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		writeOAuthError(w, oauthError(http.StatusForbidden, "insufficient_scope", "the openid scope is required"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userClaims(verified.Identity, scopes))
+}
+
+// userClaims returns the standard claims of an identity released by scopes,
+// read from the identity profile, then the subject attributes
+func userClaims(identity *subject.IdentityContext, scopes []string) map[string]any {
+	claims := map[string]any{"sub": identity.Subject.ID}
+	for _, scope := range scopes {
+		for _, claim := range scopeClaims[scope] {
+			if value, ok := identity.Profile[claim]; ok {
+				claims[claim] = value
+			} else if value, ok := identity.Subject.Attributes[claim]; ok {
+				claims[claim] = value
+			}
+		}
+	}
+	if slices.Contains(scopes, ScopeProfile) && claims["preferred_username"] == nil && identity.Subject.Principal != "" {
+		claims["preferred_username"] = identity.Subject.Principal
+	}
+	return claims
+}
+
+// session verifies the session of the user at the authorization endpoint
+func (p *Provider) session(r *http.Request) (*lokstraauth.VerifyResponse, error) {
+	tokenValue, err := p.config.TokenExtractor(r)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := p.config.Auth.Verify(r.Context(), &lokstraauth.VerifyRequest{
+		Token:                tokenValue,
+		BuildIdentityContext: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !verified.Valid {
+		return nil, lokstraauth.ErrAuthenticationFailed
+	}
+	return verified, nil
+}
+
+// sessionAuthTime returns when the user of a session authenticated: the
+// session creation time or "auth_time" metadata, else the token issue time
+func sessionAuthTime(session *lokstraauth.VerifyResponse) (time.Time, bool) {
+	if session.Identity != nil {
+		if authTime, ok := middleware.DefaultAuthTime(session.Identity); ok {
+			return authTime, true
+		}
+	}
+	if iat, ok := session.Claims.GetInt64("iat"); ok {
+		return time.Unix(iat, 0), true
+	}
+	return time.Time{}, false
+}
+
+// verifyCSRF verifies the CSRF token of a consent decision (cookie sessions)
+func (p *Provider) verifyCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if p.config.Cookies == nil || r.Header.Get("Authorization") != "" {
+		return true
+	}
+	if err := p.config.Cookies.VerifyCSRF(r); err != nil {
+		writeOAuthError(w, oauthError(http.StatusForbidden, "access_denied", err.Error()))
+		return false
+	}
+	return true
+}
+
+// returnTo returns the authorization URL to come back to after the login or
+// consent page, without the prompt that sent the user there
+func (p *Provider) returnTo(req *authorizeRequest, satisfied string) string {
+	params := url.Values{}
+	for key, values := range req.params {
+		switch key {
+		case "decision", "csrf_token":
+		case "prompt":
+			prompt := slices.DeleteFunc(slices.Clone(req.prompt), func(v string) bool { return v == satisfied })
+			if len(prompt) > 0 {
+				params.Set(key, strings.Join(prompt, " "))
+			}
+		default:
+			params[key] = values
+		}
+	}
+	return p.endpoint("/authorize") + "?" + params.Encode()
+}
+
+// redirectError redirects an authorization error to the client
+func (p *Provider) redirectError(w http.ResponseWriter, r *http.Request, req *authorizeRequest, oerr *Error) {
+	params := url.Values{"error": {oerr.Code}, "iss": {p.config.Issuer}}
+	if oerr.Description != "" {
+		params.Set("error_description", oerr.Description)
+	}
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+	http.Redirect(w, r, withParams(req.redirectURI, params), http.StatusFound)
+}
+
+// verifyPKCE checks an S256 code verifier against its challenge
+func verifyPKCE(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// tenantClaims returns the tenant and app claims carried into issued tokens
+func tenantClaims(tenantID, appID string) map[string]any {
+	claims := map[string]any{}
+	if tenantID != "" {
+		claims["tenant_id"] = tenantID
+	}
+	if appID != "" {
+		claims["app_id"] = appID
+	}
+	return claims
+}
+
+// withParams adds query parameters to a URL, dropping empty values
+func withParams(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query[key] = values
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func writeOAuthError(w http.ResponseWriter, oerr *Error) {
+	status := oerr.Status
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, oerr)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,274 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	lokstraauth "github.com/primadi/lokstra-auth"
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/cookie"
+	"github.com/primadi/lokstra-auth/handlers"
+)
+
+// Standard scopes
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopePhone         = "phone"
+	ScopeAddress       = "address"
+	ScopeOfflineAccess = "offline_access"
+)
+
+// DefaultScopes are the scopes supported when Config.Scopes is empty
+var DefaultScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone, ScopeAddress, ScopeOfflineAccess}
+
+// Config holds configuration for the OIDC provider
+type Config struct {
+	// Auth is the Auth runtime instance (required). It verifies the session
+	// of users at the authorization endpoint and access tokens at userinfo.
+	Auth *lokstraauth.Auth
+
+	// Tokens issues access tokens (required, the token manager of Auth so
+	// resource servers verify them with the auth middleware)
+	Tokens token.TokenManager
+
+	// Issuer is the issuer URL (required), e.g. "https://auth.example.com".
+	// Discovery is served at Issuer + "/.well-known/openid-configuration".
+	Issuer string
+
+	// Prefix is prepended to the endpoints, after the issuer path
+	// (default: "/oauth2")
+	Prefix string
+
+	// SigningKey signs ID tokens (required, RSA or ECDSA private key)
+	SigningKey crypto.Signer
+
+	// KeyID is the "kid" of the signing key (default: "oidc")
+	KeyID string
+
+	// Clients stores registered clients (required)
+	Clients ClientStore
+
+	// Grants stores authorization codes and refresh tokens (default: in-memory)
+	Grants GrantStore
+
+	// Consents stores the consents of users (default: in-memory)
+	Consents ConsentStore
+
+	// Scopes are the supported scopes (default: DefaultScopes)
+	Scopes []string
+
+	// TokenExtractor extracts the session token of the user at the
+	// authorization endpoint (default: Authorization header, then the
+	// session cookie when Cookies is set)
+	TokenExtractor handlers.TokenExtractor
+
+	// Cookies reads browser sessions and verifies the CSRF token of consent
+	// decisions (optional)
+	Cookies *cookie.Manager
+
+	// LoginURL is where users without a session are sent, with the
+	// authorization URL to return to in the "return_to" parameter
+	LoginURL string
+
+	// ConsentURL is the consent page. It receives "client_id",
+	// "client_name", "scope", "new_scope" (the scopes not granted yet, so
+	// expanding scopes can be highlighted) and "return_to", and posts the
+	// decision ("decision=allow" or "decision=deny") to the return_to URL.
+	ConsentURL string
+
+	// CodeTTL is the lifetime of authorization codes (default: 5 minutes)
+	CodeTTL time.Duration
+
+	// IDTokenDuration is the lifetime of ID tokens (default: 1 hour)
+	IDTokenDuration time.Duration
+
+	// RefreshTokenDuration is the lifetime of refresh tokens
+	// (default: 30 days)
+	RefreshTokenDuration time.Duration
+}
+
+// Provider serves the OAuth2 / OpenID Connect endpoints. Endpoints are plain
+// net/http handlers and can be mounted on any router.
+type Provider struct {
+	config   *Config
+	method   jwt.SigningMethod
+	basePath string // path of the issuer URL
+}
+
+// New creates an OIDC provider
+func New(config *Config) (*Provider, error) {
+	if config.Auth == nil || config.Tokens == nil || config.Clients == nil {
+		return nil, errors.New("oidc: Auth, Tokens and Clients are required")
+	}
+
+	issuer, err := url.Parse(config.Issuer)
+	if err != nil || issuer.Scheme == "" || issuer.Host == "" {
+		return nil, fmt.Errorf("oidc: invalid issuer %q", config.Issuer)
+	}
+	config.Issuer = strings.TrimRight(config.Issuer, "/")
+
+	method, err := signingMethod(config.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Prefix == "" {
+		config.Prefix = "/oauth2"
+	}
+	config.Prefix = strings.TrimRight(config.Prefix, "/")
+
+	if config.KeyID == "" {
+		config.KeyID = "oidc"
+	}
+
+	if config.Grants == nil || config.Consents == nil {
+		store := NewInMemoryStore()
+		if config.Grants == nil {
+			config.Grants = store
+		}
+		if config.Consents == nil {
+			config.Consents = store
+		}
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+
+	if config.TokenExtractor == nil {
+		config.TokenExtractor = handlers.BearerTokenExtractor
+		if config.Cookies != nil {
+			cookies := config.Cookies
+			config.TokenExtractor = func(r *http.Request) (string, error) {
+				if tokenValue, err := handlers.BearerTokenExtractor(r); err == nil {
+					return tokenValue, nil
+				}
+				return cookies.ReadSession(r)
+			}
+		}
+	}
+
+	if config.CodeTTL <= 0 {
+		config.CodeTTL = 5 * time.Minute
+	}
+	if config.IDTokenDuration <= 0 {
+		config.IDTokenDuration = time.Hour
+	}
+	if config.RefreshTokenDuration <= 0 {
+		config.RefreshTokenDuration = 30 * 24 * time.Hour
+	}
+
+	return &Provider{
+		config:   config,
+		method:   method,
+		basePath: strings.TrimRight(issuer.Path, "/"),
+	}, nil
+}
+
+// Register mounts the provider endpoints on a ServeMux
+func (p *Provider) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+p.basePath+"/.well-known/openid-configuration", p.Discovery)
+	mux.HandleFunc("GET "+p.path("/jwks"), p.JWKS)
+	mux.HandleFunc("GET "+p.path("/authorize"), p.Authorize)
+	mux.HandleFunc("POST "+p.path("/authorize"), p.Authorize)
+	mux.HandleFunc("POST "+p.path("/token"), p.Token)
+	mux.HandleFunc("GET "+p.path("/userinfo"), p.UserInfo)
+	mux.HandleFunc("POST "+p.path("/userinfo"), p.UserInfo)
+	mux.HandleFunc("GET "+p.path("/consents"), p.Consents)
+	mux.HandleFunc("DELETE "+p.path("/consents/{client_id}"), p.DeleteConsent)
+}
+
+// Handler returns a ServeMux with the provider endpoints mounted
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	p.Register(mux)
+	return mux
+}
+
+// Metadata is the OpenID provider metadata (discovery document)
+type Metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Metadata returns the discovery document
+func (p *Provider) Metadata() *Metadata {
+	claims := []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "azp"}
+	for _, scope := range p.config.Scopes {
+		claims = append(claims, scopeClaims[scope]...)
+	}
+
+	return &Metadata{
+		Issuer:                            p.config.Issuer,
+		AuthorizationEndpoint:             p.endpoint("/authorize"),
+		TokenEndpoint:                     p.endpoint("/token"),
+		UserInfoEndpoint:                  p.endpoint("/userinfo"),
+		JWKSURI:                           p.endpoint("/jwks"),
+		ScopesSupported:                   p.config.Scopes,
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode, GrantRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{p.method.Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   claims,
+	}
+}
+
+// JWKSet returns the public keys that verify ID tokens
+func (p *Provider) JWKSet() *JWKS {
+	return &JWKS{Keys: []JWK{publicJWK(p.config.SigningKey, p.config.KeyID, p.method)}}
+}
+
+// Discovery serves the discovery document
+func (p *Provider) Discovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, p.Metadata())
+}
+
+// JWKS serves the public keys that verify ID tokens
+func (p *Provider) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, p.JWKSet())
+}
+
+// RevokeConsent revokes the consent of a user to a client and the refresh
+// tokens the client holds for the user
+func (p *Provider) RevokeConsent(ctx context.Context, subjectID, clientID string) error {
+	if err := p.config.Grants.RevokeRefreshTokens(ctx, subjectID, clientID); err != nil {
+		return err
+	}
+	return p.config.Consents.Revoke(ctx, subjectID, clientID)
+}
+
+// path returns the mux path of an endpoint
+func (p *Provider) path(endpoint string) string {
+	return p.basePath + p.config.Prefix + endpoint
+}
+
+// endpoint returns the absolute URL of an endpoint
+func (p *Provider) endpoint(endpoint string) string {
+	return p.config.Issuer + p.config.Prefix + endpoint
+}
@@ -0,0 +1,168 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/primadi/lokstra-auth/consent"
+)
+
+var (
+	ErrGrantNotFound   = errors.New("grant not found or expired")
+	ErrConsentNotFound = consent.ErrConsentNotFound
+)
+
+// AuthorizationCode is an issued authorization code, redeemed once at the
+// token endpoint
+type AuthorizationCode struct {
+	// CodeHash is the SHA-256 hash of the code
+	CodeHash string
+
+	ClientID string
+
+	// RedirectURI is the redirect_uri of the authorization request (empty
+	// when it was omitted); the token request must repeat it
+	RedirectURI string
+
+	SubjectID string
+	Scopes    []string
+	Nonce     string
+
+	// CodeChallenge is the S256 PKCE challenge (empty without PKCE)
+	CodeChallenge string
+
+	// Claims are the tenant and app claims of the user's session, carried
+	// into the issued tokens
+	Claims map[string]any
+
+	// AuthTime is when the user authenticated
+	AuthTime time.Time
+
+	ExpiresAt time.Time
+}
+
+// RefreshGrant is an issued refresh token. Refresh tokens rotate: each one is
+// redeemed once and replaced.
+type RefreshGrant struct {
+	// TokenHash is the SHA-256 hash of the refresh token
+	TokenHash string
+
+	ClientID  string
+	SubjectID string
+	Scopes    []string
+	Claims    map[string]any
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
+
+// GrantStore stores authorization codes and refresh tokens
+type GrantStore interface {
+	// SaveCode stores an authorization code
+	SaveCode(ctx context.Context, code *AuthorizationCode) error
+
+	// ConsumeCode returns and deletes an unexpired authorization code
+	ConsumeCode(ctx context.Context, codeHash string) (*AuthorizationCode, error)
+
+	// SaveRefreshToken stores a refresh token
+	SaveRefreshToken(ctx context.Context, grant *RefreshGrant) error
+
+	// ConsumeRefreshToken returns and deletes an unexpired refresh token
+	ConsumeRefreshToken(ctx context.Context, tokenHash string) (*RefreshGrant, error)
+
+	// RevokeRefreshTokens deletes the refresh tokens of a subject for a client
+	// (all clients when clientID is empty)
+	RevokeRefreshTokens(ctx context.Context, subjectID, clientID string) error
+}
+
+// Consent records the scopes a user granted to a client
+type Consent = consent.Consent
+
+// ConsentStore stores the consents of users to clients
+type ConsentStore = consent.Store
+
+// InMemoryStore is an in-memory implementation of GrantStore and ConsentStore
+type InMemoryStore struct {
+	*consent.InMemoryStore
+
+	mu      sync.Mutex
+	codes   map[string]*AuthorizationCode
+	refresh map[string]*RefreshGrant
+}
+
+// NewInMemoryStore creates a new in-memory grant and consent store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		InMemoryStore: consent.NewInMemoryStore(),
+		codes:         make(map[string]*AuthorizationCode),
+		refresh:       make(map[string]*RefreshGrant),
+	}
+}
+
+// SaveCode stores an authorization code
+func (s *InMemoryStore) SaveCode(ctx context.Context, code *AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *code
+	s.codes[code.CodeHash] = &copied
+	return nil
+}
+
+// ConsumeCode returns and deletes an unexpired authorization code
+func (s *InMemoryStore) ConsumeCode(ctx context.Context, codeHash string) (*AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[codeHash]
+	if !ok {
+		return nil, ErrGrantNotFound
+	}
+	delete(s.codes, codeHash)
+
+	if time.Now().After(code.ExpiresAt) {
+		return nil, ErrGrantNotFound
+	}
+	return code, nil
+}
+
+// SaveRefreshToken stores a refresh token
+func (s *InMemoryStore) SaveRefreshToken(ctx context.Context, grant *RefreshGrant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *grant
+	s.refresh[grant.TokenHash] = &copied
+	return nil
+}
+
+// ConsumeRefreshToken returns and deletes an unexpired refresh token
+func (s *InMemoryStore) ConsumeRefreshToken(ctx context.Context, tokenHash string) (*RefreshGrant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, ok := s.refresh[tokenHash]
+	if !ok {
+		return nil, ErrGrantNotFound
+	}
+	delete(s.refresh, tokenHash)
+
+	if time.Now().After(grant.ExpiresAt) {
+		return nil, ErrGrantNotFound
+	}
+	return grant, nil
+}
+
+// RevokeRefreshTokens deletes the refresh tokens of a subject for a client
+func (s *InMemoryStore) RevokeRefreshTokens(ctx context.Context, subjectID, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, grant := range s.refresh {
+		if grant.SubjectID == subjectID && (clientID == "" || grant.ClientID == clientID) {
+			delete(s.refresh, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Package permission matches permissions against granted patterns. It is
+// the single matcher shared by RBAC permissions, ACL entries, policy actions,
+// identity permissions and token scopes.
+//
+// Permissions are segments separated by ":" (e.g., "document:read",
+// "document:doc-1:read", "billing:invoice:export"). A pattern grants a
+// permission when the segments match:
+//
+//	"*"                  everything
+//	"document:read"      exactly document:read
+//	"document:*"         every permission under document, at any depth
+//	                     (document:read, document:doc-1:read)
+//	"billing:invoice:*"  every permission under billing:invoice
+//	"*:read"             read of any resource (document:read, project:read)
+//	"document:*:read"    read of any single document (document:doc-1:read)
+//
+// A "*" segment matches exactly one segment, except as the last segment of
+// the pattern, where it matches one or more: "document:*" does not grant
+// "document" itself. Matching is exact otherwise;
+// normalize case and orientation before matching (authz.PermissionSyntax).
+package permission
+
+import "strings"
+
+const (
+	// Wildcard matches any segment (or, alone, any permission)
+	Wildcard = "*"
+
+	// Separator separates the segments of a permission
+	Separator = ":"
+)
+
+// Match reports whether a pattern grants the required permission
+func Match(pattern, required string) bool {
+	if pattern == required || pattern == Wildcard {
+		return true
+	}
+	if !strings.Contains(pattern, Wildcard) {
+		return false
+	}
+
+	patternParts := strings.Split(pattern, Separator)
+	requiredParts := strings.Split(required, Separator)
+	last := len(patternParts) - 1
+
+	for i, part := range patternParts {
+		if i >= len(requiredParts) {
+			return false
+		}
+		if part == Wildcard {
+			if i == last {
+				// Trailing wildcard: the rest of the hierarchy
+				return true
+			}
+			continue
+		}
+		if part != requiredParts[i] {
+			return false
+		}
+	}
+
+	return len(patternParts) == len(requiredParts)
+}
+
+// MatchAny reports whether any of the patterns grants the required permission
+func MatchAny(patterns []string, required string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether a pattern grants everything another pattern grants
+// (e.g., "document:*" covers "document:*:read" and "document:read", but not
+// "*:read"). Use it to check that a grant does not exceed the grantor's own
+// permissions.
+func Covers(pattern, other string) bool {
+	if pattern == other || pattern == Wildcard {
+		return true
+	}
+	if other == Wildcard {
+		return false
+	}
+
+	patternParts := strings.Split(pattern, Separator)
+	otherParts := strings.Split(other, Separator)
+	last := len(patternParts) - 1
+
+	for i, part := range patternParts {
+		if i >= len(otherParts) {
+			return false
+		}
+		if part == Wildcard {
+			if i == last {
+				return true
+			}
+			continue
+		}
+		if otherParts[i] == Wildcard || part != otherParts[i] {
+			return false
+		}
+	}
+
+	// A trailing wildcard of other reaches deeper than pattern
+	return len(patternParts) == len(otherParts)
+}
+
+// CoversAny reports whether any of the patterns covers another pattern
+func CoversAny(patterns []string, other string) bool {
+	for _, pattern := range patterns {
+		if Covers(pattern, other) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package permission
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, required string
+		want              bool
+	}{
+		// Exact
+		{"document:read", "document:read", true},
+		{"document:read", "document:write", false},
+		{"document", "document:read", false},
+		{"document:read", "document", false},
+
+		// Wildcard alone
+		{"*", "document", true},
+		{"*", "document:doc-1:read", true},
+
+		// Trailing wildcard: one or more segments
+		{"document:*", "document:read", true},
+		{"document:*", "document:doc-1:read", true},
+		{"document:*", "document", false},
+		{"document:*", "project:read", false},
+		{"billing:invoice:*", "billing:invoice:export", true},
+		{"billing:invoice:*", "billing:invoice", false},
+		{"billing:invoice:*", "billing:payment:export", false},
+
+		// Leading and inner wildcards: exactly one segment
+		{"*:read", "document:read", true},
+		{"*:read", "document:doc-1:read", false},
+		{"*:read", "read", false},
+		{"document:*:read", "document:doc-1:read", true},
+		{"document:*:read", "document:read", false},
+		{"document:*:read", "document:doc-1:write", false},
+		{"document:*:read", "document:doc-1:page-2:read", false},
+		{"*:*", "document:read", true},
+		{"*:*", "document", false},
+		{"*:*", "document:doc-1:read", true},
+
+		// Empty input
+		{"", "", true},
+		{"", "document:read", false},
+		{"document:read", "", false},
+		{"document:*", "", false},
+		{"*", "", true},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.required); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	patterns := []string{"document:read", "billing:*"}
+
+	tests := []struct {
+		required string
+		want     bool
+	}{
+		{"document:read", true},
+		{"billing:invoice:export", true},
+		{"billing", false},
+		{"document:write", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchAny(patterns, tt.required); got != tt.want {
+			t.Errorf("MatchAny(%q, %q) = %v, want %v", patterns, tt.required, got, tt.want)
+		}
+	}
+	if MatchAny(nil, "document:read") {
+		t.Error("MatchAny(nil) granted a permission")
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		pattern, other string
+		want           bool
+	}{
+		// Exact
+		{"document:read", "document:read", true},
+		{"document:read", "document:write", false},
+		{"document:read", "document:*", false},
+
+		// Wildcard alone
+		{"*", "document:*", true},
+		{"*", "*:read", true},
+		{"document:*", "*", false},
+		{"*:read", "*", false},
+
+		// Trailing wildcard
+		{"document:*", "document:read", true},
+		{"document:*", "document:*:read", true},
+		{"document:*", "document:doc-1:*", true},
+		{"document:*", "document", false},
+		{"document:*", "*:read", false},
+		{"billing:invoice:*", "billing:*", false},
+
+		// Leading and inner wildcards
+		{"*:read", "document:read", true},
+		{"*:read", "*:read", true},
+		{"*:read", "document:*", false},
+		{"*:read", "document:doc-1:read", false},
+		{"document:*:read", "document:doc-1:read", true},
+		{"document:*:read", "document:*:read", true},
+		{"document:*:read", "document:*", false},
+		{"document:*:read", "document:doc-1:*", false},
+
+		// Empty input
+		{"", "", true},
+		{"", "document:read", false},
+		{"document:read", "", false},
+		{"document:*", "", false},
+		{"*", "", true},
+	}
+
+	for _, tt := range tests {
+		if got := Covers(tt.pattern, tt.other); got != tt.want {
+			t.Errorf("Covers(%q, %q) = %v, want %v", tt.pattern, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestCoversAny(t *testing.T) {
+	patterns := []string{"document:*", "*:read"}
+
+	tests := []struct {
+		other string
+		want  bool
+	}{
+		{"document:*:read", true},
+		{"project:read", true},
+		{"project:*", false},
+		{"*", false},
+	}
+
+	for _, tt := range tests {
+		if got := CoversAny(patterns, tt.other); got != tt.want {
+			t.Errorf("CoversAny(%q, %q) = %v, want %v", patterns, tt.other, got, tt.want)
+		}
+	}
+}
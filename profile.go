@@ -0,0 +1,360 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/tenant"
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrProfileNotConfigured   = autherrors.New(autherrors.ErrNotImplemented, "profile self-service is not configured")
+	ErrProfileFieldNotAllowed = autherrors.New(autherrors.ErrPermissionDenied, "profile field cannot be edited")
+	ErrInvalidProfile         = autherrors.New(autherrors.ErrInvalidRequest, "invalid profile value")
+	ErrProfileNotFound        = autherrors.New(autherrors.ErrNotFound, "profile not found")
+)
+
+// Profile attributes users can edit by default
+const (
+	ProfileDisplayName = "display_name"
+	ProfileAvatarURL   = "avatar_url"
+	ProfileLocale      = "locale"
+	ProfileTimezone    = "timezone"
+)
+
+// DefaultProfileFields are the profile attributes users can edit when
+// ProfileConfig.Fields is not set
+var DefaultProfileFields = []string{ProfileDisplayName, ProfileAvatarURL, ProfileLocale, ProfileTimezone}
+
+// ProfileValidator validates the value of a profile attribute and returns it
+// normalized (e.g., trimmed). Values are never nil or "": those remove the
+// attribute.
+type ProfileValidator func(value any) (any, error)
+
+// defaultProfileValidators validate the default profile attributes
+var defaultProfileValidators = map[string]ProfileValidator{
+	ProfileDisplayName: ValidateDisplayName,
+	ProfileAvatarURL:   ValidateAvatarURL,
+	ProfileLocale:      ValidateLocale,
+	ProfileTimezone:    ValidateTimezone,
+}
+
+// ProfileConfig configures profile self-service: users reading and editing
+// their own profile attributes. Without it, the profiles are the user
+// store's (see tenant.ProfileProvider) and users edit DefaultProfileFields.
+type ProfileConfig struct {
+	// Store reads and updates the profiles (default: a
+	// tenant.ProfileProvider over the user store). Use the profile provider
+	// of the identity context builder, so identities carry the updates.
+	Store subject.ProfileStore
+
+	// Fields are the attributes users can edit (default:
+	// DefaultProfileFields). The auth settings of a tenant or app can
+	// restrict them further (tenant.TenantAuthSettings.ProfileFields).
+	Fields []string
+
+	// Validators validate attributes by name, in addition to the
+	// validators of the default attributes. Attributes without a validator
+	// accept text of up to 256 characters.
+	Validators map[string]ProfileValidator
+
+	// Bus receives a SubjectChanged event for every update, so caches of
+	// other processes drop the identity of the user (optional)
+	Bus subject.InvalidationBus
+}
+
+func (c *ProfileConfig) fields() []string {
+	if len(c.Fields) == 0 {
+		return DefaultProfileFields
+	}
+	return c.Fields
+}
+
+func (c *ProfileConfig) validator(field string) ProfileValidator {
+	if validate, ok := c.Validators[field]; ok {
+		return validate
+	}
+	if validate, ok := defaultProfileValidators[field]; ok {
+		return validate
+	}
+	return validateProfileText
+}
+
+// UserProfile is the profile of a user with the attributes the user can
+// edit
+type UserProfile struct {
+	UserID     string         `json:"user_id"`
+	Attributes map[string]any `json:"attributes"`
+	Editable   []string       `json:"editable"`
+}
+
+// GetProfile returns the profile of a user and the attributes the user can
+// edit, per the auth settings of the tenant (and of the app of the context)
+func (a *Auth) GetProfile(ctx context.Context, tenantID, userID string) (*UserProfile, error) {
+	config, store, err := a.profileConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	editable, err := a.editableProfileFields(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return a.loadProfile(ctx, store, userID, editable)
+}
+
+// UpdateProfile changes profile attributes of a user and returns the
+// updated profile. nil or "" values remove attributes, the others are
+// validated; attributes the user cannot edit are rejected
+// (ErrProfileFieldNotAllowed) and nothing is changed on any error. The
+// cached identity contexts of the user are invalidated (the identity
+// context builder, the invalidation bus and the session identities).
+func (a *Auth) UpdateProfile(ctx context.Context, tenantID, userID string, changes map[string]any) (*UserProfile, error) {
+	config, store, err := a.profileConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	editable, err := a.editableProfileFields(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	validated, err := validateProfile(config, editable, changes)
+	if err == nil {
+		err = store.UpdateProfile(ctx, &subject.Subject{ID: userID, Type: subject.SubjectTypeUser}, validated)
+		if errors.Is(err, tenant.ErrUserNotFound) || errors.Is(err, tenant.ErrTenantNotFound) {
+			err = fmt.Errorf("%w: %w", ErrProfileNotFound, err)
+		}
+	}
+
+	fields := make([]string, 0, len(changes))
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	a.auditProfileUpdate(ctx, userID, fields, err)
+	if err != nil {
+		return nil, err
+	}
+
+	a.invalidateSubject(ctx, config.Bus, userID, "profile_updated")
+	a.refreshSessionProfiles(ctx, userID, validated)
+	a.Publish(ctx, &events.Event{
+		Type:      events.UserProfileUpdated,
+		SubjectID: userID,
+		Data:      map[string]any{"fields": fields},
+	})
+	return a.loadProfile(ctx, store, userID, editable)
+}
+
+// loadProfile reads the profile of a user
+func (a *Auth) loadProfile(ctx context.Context, store subject.ProfileStore, userID string, editable []string) (*UserProfile, error) {
+	attributes, err := store.GetProfile(ctx, &subject.Subject{ID: userID, Type: subject.SubjectTypeUser})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+	if attributes == nil {
+		attributes = make(map[string]any)
+	}
+	return &UserProfile{UserID: userID, Attributes: attributes, Editable: editable}, nil
+}
+
+// editableProfileFields returns the configured fields the auth settings of
+// the context tenant and app allow
+func (a *Auth) editableProfileFields(ctx context.Context, config *ProfileConfig) ([]string, error) {
+	fields := config.fields()
+	settings, err := a.authSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil || len(settings.ProfileFields) == 0 {
+		return slices.Clone(fields), nil
+	}
+
+	editable := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if slices.Contains(settings.ProfileFields, field) {
+			editable = append(editable, field)
+		}
+	}
+	return editable, nil
+}
+
+// validateProfile checks that every changed attribute is editable and
+// returns the changes normalized, with nil for removed attributes
+func validateProfile(config *ProfileConfig, editable []string, changes map[string]any) (map[string]any, error) {
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("%w: no attributes to update", ErrInvalidProfile)
+	}
+
+	validated := make(map[string]any, len(changes))
+	for field, value := range changes {
+		if !slices.Contains(editable, field) {
+			return nil, fmt.Errorf("%w: %s", ErrProfileFieldNotAllowed, field)
+		}
+		if value == nil || value == "" {
+			validated[field] = nil
+			continue
+		}
+		normalized, err := config.validator(field)(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidProfile, field, err)
+		}
+		validated[field] = normalized
+	}
+	return validated, nil
+}
+
+// refreshSessionProfiles applies validated profile changes to the session
+// identities of a user, best effort: sessions of stores that cannot list
+// them pick the changes up with their next identity
+func (a *Auth) refreshSessionProfiles(ctx context.Context, userID string, changes map[string]any) {
+	identities, _ := a.listSessionIdentities(ctx, userID)
+	for _, identity := range identities {
+		profile := make(map[string]any, len(identity.Profile)+len(changes))
+		for k, v := range identity.Profile {
+			profile[k] = v
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(profile, k)
+			} else {
+				profile[k] = v
+			}
+		}
+		identity.Profile = profile
+		_ = a.identityStore.Update(ctx, identity.Session.ID, identity)
+	}
+}
+
+// profileConfig returns the profile configuration and store, by default
+// the profiles of the user store
+func (a *Auth) profileConfig() (*ProfileConfig, subject.ProfileStore, error) {
+	config := a.config.Profile
+	if config == nil {
+		config = &ProfileConfig{}
+	}
+	if config.Store != nil {
+		return config, config.Store, nil
+	}
+	if a.users == nil {
+		return nil, nil, ErrProfileNotConfigured
+	}
+	return config, tenant.NewProfileProvider(a.users), nil
+}
+
+// auditProfileUpdate records a profile update of a user, by the actor of
+// the context (else the user)
+func (a *Auth) auditProfileUpdate(ctx context.Context, userID string, fields []string, err error) {
+	actorID := authz.ActorFromContext(ctx)
+	if actorID == "" {
+		actorID = userID
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventProfileUpdated,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Resource:  "user:" + userID,
+		Action:    "update_profile",
+		Result:    auditResult(err),
+		Metadata:  auditMetadata(err, "fields", fields),
+	})
+}
+
+// ValidateDisplayName accepts a name of 1 to 128 characters without control
+// characters, trimmed
+func ValidateDisplayName(value any) (any, error) {
+	name, err := profileText(value, 128)
+	if err != nil {
+		return nil, err
+	}
+	return name, nil
+}
+
+// ValidateAvatarURL accepts an absolute https URL of up to 2048 characters
+func ValidateAvatarURL(value any) (any, error) {
+	raw, err := profileText(value, 2048)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("an absolute https URL is required")
+	}
+	return u.String(), nil
+}
+
+// ValidateLocale accepts a BCP 47 language tag (e.g., "en-US") and returns
+// it canonical
+func ValidateLocale(value any) (any, error) {
+	raw, err := profileText(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := language.Parse(raw)
+	if err != nil || tag == language.Und {
+		return nil, fmt.Errorf("a BCP 47 language tag is required")
+	}
+	return tag.String(), nil
+}
+
+// ValidateTimezone accepts an IANA time zone name (e.g., "Asia/Jakarta")
+func ValidateTimezone(value any) (any, error) {
+	raw, err := profileText(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	if raw == "Local" {
+		return nil, fmt.Errorf("an IANA time zone is required")
+	}
+	location, err := time.LoadLocation(raw)
+	if err != nil {
+		return nil, fmt.Errorf("an IANA time zone is required")
+	}
+	return location.String(), nil
+}
+
+// validateProfileText accepts text of up to 256 characters without control
+// characters, trimmed
+func validateProfileText(value any) (any, error) {
+	text, err := profileText(value, 256)
+	if err != nil {
+		return nil, err
+	}
+	return text, nil
+}
+
+// profileText returns a profile value as trimmed, non-empty text of up to
+// max characters without control characters
+func profileText(value any, max int) (string, error) {
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("text is required")
+	}
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return "", fmt.Errorf("text is required")
+	case utf8.RuneCountInString(text) > max:
+		return "", fmt.Errorf("at most %d characters are allowed", max)
+	case strings.ContainsFunc(text, unicode.IsControl):
+		return "", fmt.Errorf("control characters are not allowed")
+	}
+	return text, nil
+}
@@ -0,0 +1,1031 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/events"
+	"github.com/primadi/lokstra-auth/notify"
+	"github.com/primadi/lokstra-auth/recovery"
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+var (
+	ErrRecoveryNotConfigured  = autherrors.New(autherrors.ErrNotImplemented, "account recovery is not configured")
+	ErrRecoveryNoSender       = autherrors.New(autherrors.ErrNotImplemented, "account recovery has no notification sender")
+	ErrRecoveryCooldown       = autherrors.New(autherrors.ErrRateLimited, "account was recovered recently")
+	ErrRecoveryThrottled      = autherrors.New(autherrors.ErrRateLimited, "too many recovery codes were requested")
+	ErrRecoveryFailed         = autherrors.New(autherrors.ErrInvalidCredentials, "invalid username or backup code")
+	ErrRecoveryPending        = autherrors.New(autherrors.ErrConflict, "an admin recovery of the user is pending")
+	ErrNoPendingRecovery      = autherrors.New(autherrors.ErrNotFound, "no pending admin recovery")
+	ErrRecoveryReasonRequired = autherrors.New(autherrors.ErrInvalidRequest, "a reason is required to recover an account")
+	ErrRecoveryActorRequired  = autherrors.New(autherrors.ErrInvalidRequest, "admin recovery requires the actor")
+	ErrSelfRecovery           = autherrors.New(autherrors.ErrPermissionDenied, "admins cannot recover their own account")
+)
+
+// Recovery methods, in the "recovery_method" metadata of recovered logins
+const (
+	RecoveryBackupCode = "backup_code"
+	RecoveryContact    = "contact"
+	RecoveryAdmin      = "admin"
+)
+
+// Notification types of account recovery
+const (
+	NotificationRecoveryContactCode = "recovery_contact_verification"
+	NotificationRecoveryCode        = "recovery_code"
+	NotificationAdminRecovery       = "admin_recovery_initiated"
+	NotificationAccountRecovered    = "account_recovered"
+)
+
+// RegisterRecoveryTemplates registers the default templates of account
+// recovery notifications in a registry and returns it. The data has Kind
+// ("email" or "phone", to route the message) and Time; codes sent to
+// contacts have Code and Minutes (validity), admin recoveries NotBefore and
+// ExpiresAt, and recovered accounts Method and IPAddress.
+func RegisterRecoveryTemplates(registry *notify.Registry) *notify.Registry {
+	return registry.
+		Register(NotificationRecoveryContactCode, "", &notify.Template{
+			Subject: "Confirm your recovery contact",
+			Body: `Your code to confirm this recovery contact is {{.Code}}. It expires in {{.Minutes}} minutes.
+
+If you did not add this contact to an account, you can ignore this message.
+`,
+		}).
+		Register(NotificationRecoveryCode, "", &notify.Template{
+			Subject: "Your account recovery code",
+			Body: `Your account recovery code is {{.Code}}. It can be used once and expires in {{.Minutes}} minutes.
+
+If you did not try to recover your account, you can ignore this message.
+`,
+		}).
+		Register(NotificationAdminRecovery, "", &notify.Template{
+			Subject: "An administrator started the recovery of your account",
+			Body: `An administrator started the recovery of your account on {{.Time}}. The recovery can be completed from {{.NotBefore}} until {{.ExpiresAt}}.
+
+If you did not ask for it, sign in and cancel the recovery, or contact your administrator.
+`,
+		}).
+		Register(NotificationAccountRecovered, "", &notify.Template{
+			Subject: "Your account was recovered",
+			Body: `Your account was recovered on {{.Time}}{{if .IPAddress}} from {{.IPAddress}}{{end}}.
+
+If this was not you, contact your administrator right away.
+`,
+		})
+}
+
+// defaultRecoveryTemplates are the default templates of account recovery
+// notifications
+var defaultRecoveryTemplates = RegisterRecoveryTemplates(notify.NewRegistry(""))
+
+// RecoveryConfig configures account recovery, for users who lost their
+// sign-in factor
+type RecoveryConfig struct {
+	// Store stores the backup codes, contacts and tickets (required)
+	Store recovery.Store
+
+	// Sender delivers the codes sent to contacts and the security
+	// notifications, to email addresses and phone numbers (see the "Kind"
+	// data of the notifications). Without it, contacts cannot be added and
+	// users are not notified.
+	Sender notify.Sender
+
+	// Templates render the notifications (default: the templates of
+	// RegisterRecoveryTemplates)
+	Templates *notify.Registry
+
+	// BackupCodes is the number of backup codes generated (default: 10)
+	BackupCodes int
+
+	// CodeTTL is the validity of the codes sent to contacts (default: 15
+	// minutes)
+	CodeTTL time.Duration
+
+	// MaxAttempts is the number of wrong codes submitted for a code sent to
+	// a contact before it is invalidated (default: 5)
+	MaxAttempts int
+
+	// MaxCodes is the number of recovery codes sent to the contacts of a
+	// user per CodeWindow (default: 3), so requesting new codes cannot
+	// renew the MaxAttempts budget without limit
+	MaxCodes int
+
+	// CodeWindow is the window of MaxCodes (default: 1 hour)
+	CodeWindow time.Duration
+
+	// MaxFailures is the number of failed backup code recoveries of a
+	// username, or from a client IP address, within LockoutDuration after
+	// which backup codes of the username, or from the address, are refused
+	// for LockoutDuration (default: 5)
+	MaxFailures int
+
+	// LockoutDuration is the window and duration of the MaxFailures lockout
+	// (default: 15 minutes)
+	LockoutDuration time.Duration
+
+	// Cooldown is the time after a recovery during which the account cannot
+	// be recovered again (default: 24 hours)
+	Cooldown time.Duration
+
+	// AdminDelay is the time before an admin recovery can be redeemed,
+	// during which the user is notified and can cancel it (default: 24
+	// hours)
+	AdminDelay time.Duration
+
+	// AdminTicketTTL is the time an admin recovery can be redeemed once
+	// the delay passed (default: 72 hours)
+	AdminTicketTTL time.Duration
+}
+
+func (c *RecoveryConfig) backupCodes() int {
+	if c.BackupCodes <= 0 {
+		return 10
+	}
+	return c.BackupCodes
+}
+
+func (c *RecoveryConfig) codeTTL() time.Duration {
+	if c.CodeTTL <= 0 {
+		return 15 * time.Minute
+	}
+	return c.CodeTTL
+}
+
+func (c *RecoveryConfig) maxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return 5
+	}
+	return c.MaxAttempts
+}
+
+func (c *RecoveryConfig) maxCodes() int {
+	if c.MaxCodes <= 0 {
+		return 3
+	}
+	return c.MaxCodes
+}
+
+func (c *RecoveryConfig) codeWindow() time.Duration {
+	if c.CodeWindow <= 0 {
+		return time.Hour
+	}
+	return c.CodeWindow
+}
+
+func (c *RecoveryConfig) maxFailures() int {
+	if c.MaxFailures <= 0 {
+		return 5
+	}
+	return c.MaxFailures
+}
+
+func (c *RecoveryConfig) lockoutDuration() time.Duration {
+	if c.LockoutDuration <= 0 {
+		return 15 * time.Minute
+	}
+	return c.LockoutDuration
+}
+
+func (c *RecoveryConfig) cooldown() time.Duration {
+	if c.Cooldown <= 0 {
+		return 24 * time.Hour
+	}
+	return c.Cooldown
+}
+
+func (c *RecoveryConfig) adminDelay() time.Duration {
+	if c.AdminDelay <= 0 {
+		return 24 * time.Hour
+	}
+	return c.AdminDelay
+}
+
+func (c *RecoveryConfig) adminTicketTTL() time.Duration {
+	if c.AdminTicketTTL <= 0 {
+		return 72 * time.Hour
+	}
+	return c.AdminTicketTTL
+}
+
+func (c *RecoveryConfig) templates() *notify.Registry {
+	if c.Templates == nil {
+		return defaultRecoveryTemplates
+	}
+	return c.Templates
+}
+
+// RecoveryStatus is the recovery setup of a user
+type RecoveryStatus struct {
+	// BackupCodes is the number of unused backup codes
+	BackupCodes int `json:"backup_codes"`
+
+	Contacts []*recovery.Contact `json:"contacts"`
+
+	// AdminRecovery is the pending admin recovery (if any)
+	AdminRecovery *recovery.Ticket `json:"admin_recovery,omitempty"`
+
+	LastRecoveryAt time.Time `json:"last_recovery_at,omitzero"`
+
+	// CooldownUntil is when the account can be recovered again, while in
+	// the cooldown of its last recovery
+	CooldownUntil time.Time `json:"cooldown_until,omitzero"`
+}
+
+// AdminRecovery is a recovery initiated by an admin. The admin hands Token
+// to the user out of band (e.g., after checking their identity in person);
+// the user redeems it with RecoverWithAdminTicket between NotBefore and
+// ExpiresAt.
+type AdminRecovery struct {
+	TicketID  string    `json:"ticket_id"`
+	Token     string    `json:"token"`
+	NotBefore time.Time `json:"not_before"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AdminRecoveryRequest asks to recover the account of a user
+type AdminRecoveryRequest struct {
+	TenantID string
+	UserID   string
+
+	// Reason explains the recovery, e.g. the support ticket (required,
+	// recorded in the audit log)
+	Reason string
+}
+
+// GenerateBackupCodes generates new one-time backup codes for a user,
+// replacing the previous ones, and returns them: they are shown to the user
+// once and only their hashes are stored
+func (a *Auth) GenerateBackupCodes(ctx context.Context, tenantID, userID string) ([]string, error) {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+	if _, err := a.users.GetUser(ctx, tenantID, userID); err != nil {
+		return nil, err
+	}
+
+	codes, hashed, err := recovery.NewBackupCodes(config.backupCodes())
+	if err == nil {
+		err = config.Store.ReplaceBackupCodes(ctx, tenantID, userID, hashed)
+	}
+	a.auditRecovery(ctx, audit.EventRecoveryCodesGenerated, userID, "generate_codes", err, "count", len(codes))
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RecoveryStatus returns the recovery setup of a user: remaining backup
+// codes, contacts, pending admin recovery and cooldown
+func (a *Auth) RecoveryStatus(ctx context.Context, tenantID, userID string) (*RecoveryStatus, error) {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+	if _, err := a.users.GetUser(ctx, tenantID, userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := config.Store.ListBackupCodes(ctx, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup codes: %w", err)
+	}
+	status := &RecoveryStatus{BackupCodes: recovery.Remaining(codes)}
+	if status.Contacts, err = config.Store.ListContacts(ctx, tenantID, userID); err != nil {
+		return nil, fmt.Errorf("failed to list recovery contacts: %w", err)
+	}
+	if status.AdminRecovery, err = a.pendingAdminRecovery(ctx, config, tenantID, userID); err != nil {
+		return nil, err
+	}
+	if status.LastRecoveryAt, err = config.Store.LastRecovery(ctx, tenantID, userID); err != nil {
+		return nil, fmt.Errorf("failed to read last recovery: %w", err)
+	}
+	if until := status.LastRecoveryAt.Add(config.cooldown()); !status.LastRecoveryAt.IsZero() && time.Now().Before(until) {
+		status.CooldownUntil = until
+	}
+	return status, nil
+}
+
+// AddRecoveryContact adds a secondary email address or phone number to a
+// user and sends it a code to verify it (see VerifyRecoveryContact). Adding
+// a contact that is not verified yet sends a new code.
+func (a *Auth) AddRecoveryContact(ctx context.Context, tenantID, userID string, kind recovery.ContactKind, address string) (*recovery.Contact, error) {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.Sender == nil {
+		return nil, ErrRecoveryNoSender
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+	if _, err := a.users.GetUser(ctx, tenantID, userID); err != nil {
+		return nil, err
+	}
+	address, err = recovery.NormalizeAddress(kind, address)
+	if err != nil {
+		return nil, err
+	}
+
+	contact := &recovery.Contact{TenantID: tenantID, UserID: userID, Kind: kind, Address: address}
+	err = config.Store.CreateContact(ctx, contact)
+	if errors.Is(err, recovery.ErrContactExists) {
+		contact, err = a.unverifiedContact(ctx, config, tenantID, userID, kind, address)
+	}
+	if err == nil {
+		err = a.sendContactCode(ctx, config, contact, recovery.PurposeVerifyContact, NotificationRecoveryContactCode)
+	}
+	a.auditRecovery(ctx, audit.EventRecoveryContactAdded, userID, "add_contact", err, "kind", string(kind))
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// VerifyRecoveryContact verifies a contact of a user with the code sent to
+// it. Codes are invalidated after RecoveryConfig.MaxAttempts wrong codes.
+func (a *Auth) VerifyRecoveryContact(ctx context.Context, tenantID, userID, contactID, code string) (*recovery.Contact, error) {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	contact, err := config.Store.GetContact(ctx, tenantID, userID, contactID)
+	if err == nil {
+		err = a.redeemContactCode(ctx, config, contact, recovery.PurposeVerifyContact, code)
+	}
+	if err == nil {
+		err = config.Store.VerifyContact(ctx, tenantID, userID, contactID)
+	}
+	a.auditRecovery(ctx, audit.EventRecoveryContactVerified, userID, "verify_contact", err, "contact_id", contactID)
+	if err != nil {
+		return nil, err
+	}
+	return config.Store.GetContact(ctx, tenantID, userID, contactID)
+}
+
+// RemoveRecoveryContact removes a contact of a user
+func (a *Auth) RemoveRecoveryContact(ctx context.Context, tenantID, userID, contactID string) error {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	err = config.Store.DeleteContact(ctx, tenantID, userID, contactID)
+	a.auditRecovery(ctx, audit.EventRecoveryContactRemoved, userID, "remove_contact", err, "contact_id", contactID)
+	return err
+}
+
+// RecoverWithBackupCode signs in a user of a tenant with one of its backup
+// codes, which cannot be used again. Recovered logins have the "recovery"
+// auth method, so applications can ask the user to enroll a new factor.
+// Every failure returns ErrRecoveryFailed, whether the username is unknown,
+// the code is wrong or the account cannot be recovered now, so usernames
+// cannot be enumerated. After RecoveryConfig.MaxFailures failures of a
+// username, or from the client IP address of the context
+// (subject.WithClientIP), their backup codes are refused for
+// RecoveryConfig.LockoutDuration.
+func (a *Auth) RecoverWithBackupCode(ctx context.Context, tenantID, username, code string) (*LoginResponse, error) {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+	keys := backupCodeLockoutKeys(tenantID, username, subject.ClientIPFromContext(ctx))
+
+	var user *tenant.User
+	locked := a.recoveryLocks.anyLocked(keys)
+	if locked {
+		err = ErrAccountLocked
+	}
+	if err == nil {
+		user, err = a.users.GetUserByUsername(ctx, tenantID, username)
+		if errors.Is(err, tenant.ErrUserNotFound) {
+			err = recovery.ErrInvalidCode
+		}
+	}
+	if err == nil {
+		err = a.checkRecoveryCooldown(ctx, config, tenantID, user.ID)
+	}
+	if err == nil {
+		// Keep the code of a user who cannot sign in (e.g., suspended)
+		err = a.checkUserStatus(ctx, tenantID, user.ID)
+	}
+	if err == nil {
+		err = config.Store.UseBackupCode(ctx, tenantID, user.ID, recovery.HashBackupCode(code))
+	}
+	if err != nil {
+		var userID string
+		if user != nil {
+			userID = user.ID
+		}
+		a.auditRecoveryFailed(ctx, userID, RecoveryBackupCode, err)
+		if !isRecoveryFailure(err) {
+			return nil, err
+		}
+		if !locked {
+			for _, key := range keys {
+				a.recoveryLocks.fail(key, config.maxFailures(), config.lockoutDuration(), config.lockoutDuration())
+			}
+		}
+		return nil, ErrRecoveryFailed
+	}
+	a.recoveryLocks.reset(keys[0])
+	return a.completeRecovery(ctx, config, user, RecoveryBackupCode)
+}
+
+// backupCodeLockoutKeys returns the lockout keys of backup code recoveries
+// of a username, and from a client IP address (if known)
+func backupCodeLockoutKeys(tenantID, username, ip string) []string {
+	keys := []string{"backup_code/" + tenantID + "/user/" + username}
+	if ip != "" {
+		keys = append(keys, "backup_code/"+tenantID+"/ip/"+ip)
+	}
+	return keys
+}
+
+// isRecoveryFailure reports whether a recovery failed because of the
+// request (unknown user, wrong code, account that cannot be recovered now)
+// rather than of an unavailable store
+func isRecoveryFailure(err error) bool {
+	return errors.Is(err, autherrors.ErrInvalidCredentials) ||
+		errors.Is(err, autherrors.ErrAccountDisabled) ||
+		errors.Is(err, autherrors.ErrRateLimited)
+}
+
+// InitiateContactRecovery sends a recovery code to a verified contact of a
+// user of a tenant (see RecoverWithContact). At most RecoveryConfig.MaxCodes
+// codes are sent to the contacts of a user per RecoveryConfig.CodeWindow. It
+// does not reveal whether the address is a contact: unknown addresses,
+// accounts in their cooldown and throttled requests get no code, without an
+// error.
+func (a *Auth) InitiateContactRecovery(ctx context.Context, tenantID string, kind recovery.ContactKind, address string) error {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return err
+	}
+	if config.Sender == nil {
+		return ErrRecoveryNoSender
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+	address, err = recovery.NormalizeAddress(kind, address)
+	if err != nil {
+		return err
+	}
+
+	contact, err := config.Store.FindContact(ctx, tenantID, kind, address)
+	if errors.Is(err, recovery.ErrContactNotFound) {
+		return nil
+	}
+	if err == nil {
+		err = a.checkRecoveryCooldown(ctx, config, tenantID, contact.UserID)
+	}
+	if err == nil {
+		err = a.allowRecoveryCode(ctx, config, tenantID, contact.UserID)
+	}
+	if err == nil {
+		err = a.sendContactCode(ctx, config, contact, recovery.PurposeContactRecovery, NotificationRecoveryCode)
+	}
+
+	var userID string
+	if contact != nil {
+		userID = contact.UserID
+	}
+	metadata := auditMetadata(err, "method", RecoveryContact)
+	metadata["kind"] = string(kind)
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventRecoveryInitiated,
+		ActorID:   userID,
+		SubjectID: userID,
+		Resource:  "user:" + userID,
+		Action:    "initiate_recovery",
+		Result:    auditResult(err),
+		Metadata:  metadata,
+	})
+	if errors.Is(err, ErrRecoveryCooldown) || errors.Is(err, ErrRecoveryThrottled) {
+		return nil
+	}
+	return err
+}
+
+// RecoverWithContact signs in a user of a tenant with the recovery code
+// sent to its verified contact (see InitiateContactRecovery). Codes are
+// invalidated after RecoveryConfig.MaxAttempts wrong codes.
+func (a *Auth) RecoverWithContact(ctx context.Context, tenantID string, kind recovery.ContactKind, address, code string) (*LoginResponse, error) {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	var contact *recovery.Contact
+	var user *tenant.User
+	address, err = recovery.NormalizeAddress(kind, address)
+	if err == nil {
+		contact, err = config.Store.FindContact(ctx, tenantID, kind, address)
+		if errors.Is(err, recovery.ErrContactNotFound) {
+			err = recovery.ErrInvalidCode
+		}
+	}
+	if err == nil {
+		err = a.checkRecoveryCooldown(ctx, config, tenantID, contact.UserID)
+	}
+	if err == nil {
+		user, err = a.users.GetUser(ctx, tenantID, contact.UserID)
+	}
+	if err == nil {
+		// Keep the code of a user who cannot sign in (e.g., suspended)
+		err = a.checkUserStatus(ctx, tenantID, user.ID)
+	}
+	if err == nil {
+		err = a.redeemContactCode(ctx, config, contact, recovery.PurposeContactRecovery, code)
+	}
+	if err != nil {
+		var userID string
+		if contact != nil {
+			userID = contact.UserID
+		}
+		a.auditRecoveryFailed(ctx, userID, RecoveryContact, err)
+		return nil, err
+	}
+	return a.completeRecovery(ctx, config, user, RecoveryContact)
+}
+
+// InitiateAdminRecovery starts the recovery of the account of a user by an
+// admin, the actor of the context (see authz.WithActor), for users without
+// backup codes or contacts. The ceremony is guarded:
+//
+//   - the actor and a reason are required, and admins cannot recover their
+//     own account
+//   - the initiation is written to the audit log before anything else, and
+//     fails without an audit emitter or when the entry cannot be written
+//   - the returned token can only be redeemed after RecoveryConfig.AdminDelay,
+//     while the user is notified (email address and verified contacts) and
+//     can cancel it (see CancelAdminRecovery)
+//   - a user has at most one pending admin recovery, and none during the
+//     cooldown of its last recovery
+func (a *Auth) InitiateAdminRecovery(ctx context.Context, request *AdminRecoveryRequest) (*AdminRecovery, error) {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	actorID := authz.ActorFromContext(ctx)
+	switch {
+	case actorID == "":
+		return nil, ErrRecoveryActorRequired
+	case actorID == request.UserID:
+		return nil, ErrSelfRecovery
+	case request.Reason == "":
+		return nil, ErrRecoveryReasonRequired
+	case a.audit == nil:
+		return nil, ErrNoAuditEmitter
+	}
+	tenantID := request.TenantID
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	user, err := a.users.GetUser(ctx, tenantID, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkRecoveryCooldown(ctx, config, tenantID, user.ID); err != nil {
+		return nil, err
+	}
+	pending, err := a.pendingAdminRecovery(ctx, config, tenantID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("%w: ticket %s", ErrRecoveryPending, pending.ID)
+	}
+
+	secret, err := recovery.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	ticket := &recovery.Ticket{
+		Hash:      recovery.Hash(secret),
+		TenantID:  tenantID,
+		UserID:    user.ID,
+		Purpose:   recovery.PurposeAdminRecovery,
+		ActorID:   actorID,
+		Reason:    request.Reason,
+		CreatedAt: now,
+		NotBefore: now.Add(config.adminDelay()),
+	}
+	ticket.ExpiresAt = ticket.NotBefore.Add(config.adminTicketTTL())
+	if err := config.Store.SaveTicket(ctx, ticket); err != nil {
+		return nil, fmt.Errorf("failed to save recovery ticket: %w", err)
+	}
+
+	err = a.auditRequired(ctx, &audit.AuditLog{
+		EventType: audit.EventRecoveryInitiated,
+		ActorID:   actorID,
+		SubjectID: user.ID,
+		Resource:  "user:" + user.ID,
+		Action:    "initiate_recovery",
+		Result:    audit.ResultSuccess,
+		Metadata: map[string]any{
+			"method":     RecoveryAdmin,
+			"reason":     request.Reason,
+			"ticket_id":  ticket.ID,
+			"not_before": ticket.NotBefore.UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		_ = config.Store.DeleteTicket(ctx, tenantID, ticket.ID)
+		return nil, err
+	}
+
+	a.notifyRecovery(ctx, config, user, NotificationAdminRecovery, map[string]any{
+		"NotBefore": ticket.NotBefore.UTC().Format(time.RFC1123),
+		"ExpiresAt": ticket.ExpiresAt.UTC().Format(time.RFC1123),
+	})
+	a.Publish(ctx, &events.Event{
+		Type:      events.UserRecoveryInitiated,
+		SubjectID: user.ID,
+		Data:      map[string]any{"actor_id": actorID, "not_before": ticket.NotBefore},
+	})
+	return &AdminRecovery{
+		TicketID:  ticket.ID,
+		Token:     secret,
+		NotBefore: ticket.NotBefore,
+		ExpiresAt: ticket.ExpiresAt,
+	}, nil
+}
+
+// CancelAdminRecovery cancels the pending admin recovery of a user, by the
+// user or an admin (the actor of the context, else the user)
+func (a *Auth) CancelAdminRecovery(ctx context.Context, tenantID, userID string) error {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	pending, err := a.pendingAdminRecovery(ctx, config, tenantID, userID)
+	if err == nil && pending == nil {
+		err = ErrNoPendingRecovery
+	}
+	if err == nil {
+		err = config.Store.DeleteTicket(ctx, tenantID, pending.ID)
+	}
+	a.auditRecovery(ctx, audit.EventRecoveryCancelled, userID, "cancel_recovery", err, "method", RecoveryAdmin)
+	return err
+}
+
+// RecoverWithAdminTicket signs in the user of an admin recovery with its
+// token (see InitiateAdminRecovery), once its delay passed. The redemption
+// is written to the audit log before the user is signed in, and fails when
+// the entry cannot be written.
+func (a *Auth) RecoverWithAdminTicket(ctx context.Context, tenantID, secret string) (*LoginResponse, error) {
+	config, err := a.recoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx = authz.WithTenant(ctx, tenantID)
+
+	var user *tenant.User
+	ticket, err := config.Store.FindTicket(ctx, tenantID, recovery.Hash(secret))
+	switch {
+	case err != nil:
+	case ticket.Purpose != recovery.PurposeAdminRecovery:
+		err = recovery.ErrTicketNotFound
+	case ticket.Expired(time.Now()):
+		_ = config.Store.DeleteTicket(ctx, tenantID, ticket.ID)
+		err = recovery.ErrTicketExpired
+	case !ticket.Ready(time.Now()):
+		err = fmt.Errorf("%w: not before %s", recovery.ErrTicketNotReady, ticket.NotBefore.UTC().Format(time.RFC3339))
+	default:
+		err = a.checkRecoveryCooldown(ctx, config, tenantID, ticket.UserID)
+	}
+	if err == nil {
+		user, err = a.users.GetUser(ctx, tenantID, ticket.UserID)
+	}
+	if err == nil {
+		// Keep the ticket of a user who cannot sign in (e.g., suspended)
+		err = a.checkUserStatus(ctx, tenantID, user.ID)
+	}
+	if err == nil {
+		err = a.auditRequired(ctx, &audit.AuditLog{
+			EventType: audit.EventRecoverySucceeded,
+			ActorID:   ticket.UserID,
+			SubjectID: ticket.UserID,
+			Resource:  "user:" + ticket.UserID,
+			Action:    "redeem_recovery",
+			Result:    audit.ResultSuccess,
+			Metadata: map[string]any{
+				"method":    RecoveryAdmin,
+				"ticket_id": ticket.ID,
+				"initiator": ticket.ActorID,
+			},
+		})
+	}
+	if err == nil {
+		err = config.Store.DeleteTicket(ctx, tenantID, ticket.ID)
+	}
+	if err != nil {
+		var userID string
+		if ticket != nil {
+			userID = ticket.UserID
+		}
+		a.auditRecoveryFailed(ctx, userID, RecoveryAdmin, err)
+		return nil, err
+	}
+	return a.completeRecovery(ctx, config, user, RecoveryAdmin)
+}
+
+// completeRecovery signs in a recovered user, records the recovery for the
+// cooldown, and notifies the user
+func (a *Auth) completeRecovery(ctx context.Context, config *RecoveryConfig, user *tenant.User, method string) (*LoginResponse, error) {
+	claims := map[string]any{
+		"sub":         user.ID,
+		"tenant_id":   user.TenantID,
+		"username":    user.Username,
+		"auth_method": "recovery",
+	}
+	if user.Email != "" {
+		claims["email"] = user.Email
+	}
+
+	response, err := a.CompleteLogin(ctx, &credential.AuthenticationResult{
+		Success: true,
+		Subject: user.ID,
+		Claims:  claims,
+		Metadata: map[string]any{
+			"auth_type":       "recovery",
+			"recovery_method": method,
+		},
+	})
+	if err != nil {
+		a.auditRecoveryFailed(ctx, user.ID, method, err)
+		return nil, err
+	}
+	response.Metadata["recovery_method"] = method
+
+	now := time.Now()
+	if err := config.Store.RecordRecovery(ctx, user.TenantID, user.ID, now); err != nil {
+		return nil, fmt.Errorf("failed to record recovery: %w", err)
+	}
+	if method != RecoveryAdmin {
+		// Admin recoveries were recorded before the user signed in
+		a.auditRecovery(ctx, audit.EventRecoverySucceeded, user.ID, "recover", nil, "method", method)
+	}
+	a.Publish(ctx, &events.Event{
+		Type:      events.UserRecovered,
+		SubjectID: user.ID,
+		Data:      map[string]any{"method": method},
+	})
+	a.notifyRecovery(ctx, config, user, NotificationAccountRecovered, map[string]any{
+		"Method": method,
+	})
+	return response, nil
+}
+
+// recoveryConfig returns the recovery configuration, which requires a user
+// store
+func (a *Auth) recoveryConfig() (*RecoveryConfig, error) {
+	if a.config.Recovery == nil || a.config.Recovery.Store == nil {
+		return nil, ErrRecoveryNotConfigured
+	}
+	if a.users == nil {
+		return nil, ErrNoUserStore
+	}
+	return a.config.Recovery, nil
+}
+
+// checkRecoveryCooldown rejects the recovery of a user recovered within the
+// cooldown
+func (a *Auth) checkRecoveryCooldown(ctx context.Context, config *RecoveryConfig, tenantID, userID string) error {
+	last, err := config.Store.LastRecovery(ctx, tenantID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to read last recovery: %w", err)
+	}
+	if until := last.Add(config.cooldown()); !last.IsZero() && time.Now().Before(until) {
+		return fmt.Errorf("%w: until %s", ErrRecoveryCooldown, until.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// allowRecoveryCode records a recovery code sent to a user, within
+// RecoveryConfig.MaxCodes per RecoveryConfig.CodeWindow
+func (a *Auth) allowRecoveryCode(ctx context.Context, config *RecoveryConfig, tenantID, userID string) error {
+	allowed, err := config.Store.AllowCode(ctx, tenantID, userID, time.Now(), config.codeWindow(), config.maxCodes())
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to record recovery code: %w", err)
+	case !allowed:
+		return ErrRecoveryThrottled
+	}
+	return nil
+}
+
+// pendingAdminRecovery returns the unexpired admin recovery ticket of a user
+// (nil if none)
+func (a *Auth) pendingAdminRecovery(ctx context.Context, config *RecoveryConfig, tenantID, userID string) (*recovery.Ticket, error) {
+	tickets, err := config.Store.ListTickets(ctx, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recovery tickets: %w", err)
+	}
+	now := time.Now()
+	for _, ticket := range tickets {
+		if ticket.Purpose == recovery.PurposeAdminRecovery && !ticket.Expired(now) {
+			return ticket, nil
+		}
+	}
+	return nil, nil
+}
+
+// unverifiedContact returns the contact of a user with an address, which
+// must not be verified yet
+func (a *Auth) unverifiedContact(ctx context.Context, config *RecoveryConfig, tenantID, userID string, kind recovery.ContactKind, address string) (*recovery.Contact, error) {
+	contacts, err := config.Store.ListContacts(ctx, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recovery contacts: %w", err)
+	}
+	for _, contact := range contacts {
+		if contact.Kind == kind && contact.Address == address {
+			if contact.Verified {
+				return nil, fmt.Errorf("%w: %s", recovery.ErrContactExists, address)
+			}
+			return contact, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", recovery.ErrContactNotFound, address)
+}
+
+// sendContactCode sends a new code for a purpose to a contact, replacing
+// the pending codes of the contact for that purpose
+func (a *Auth) sendContactCode(ctx context.Context, config *RecoveryConfig, contact *recovery.Contact, purpose recovery.Purpose, notificationType string) error {
+	tickets, err := a.contactTickets(ctx, config, contact, purpose)
+	if err != nil {
+		return err
+	}
+	for _, ticket := range tickets {
+		_ = config.Store.DeleteTicket(ctx, contact.TenantID, ticket.ID)
+	}
+
+	code, err := recovery.NewCode()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	ticket := &recovery.Ticket{
+		Hash:      recovery.Hash(code),
+		TenantID:  contact.TenantID,
+		UserID:    contact.UserID,
+		Purpose:   purpose,
+		ContactID: contact.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.codeTTL()),
+	}
+	if err := config.Store.SaveTicket(ctx, ticket); err != nil {
+		return fmt.Errorf("failed to save recovery ticket: %w", err)
+	}
+
+	err = a.sendRecovery(ctx, config, contact.UserID, contact.Kind, contact.Address, notificationType, map[string]any{
+		"Code":    code,
+		"Minutes": int(config.codeTTL().Minutes()),
+	})
+	if err != nil {
+		_ = config.Store.DeleteTicket(ctx, contact.TenantID, ticket.ID)
+		return fmt.Errorf("failed to send recovery code: %w", err)
+	}
+	return nil
+}
+
+// redeemContactCode checks a code sent to a contact for a purpose. The
+// ticket is deleted when the code matches, expired or was guessed wrong too
+// many times.
+func (a *Auth) redeemContactCode(ctx context.Context, config *RecoveryConfig, contact *recovery.Contact, purpose recovery.Purpose, code string) error {
+	tickets, err := a.contactTickets(ctx, config, contact, purpose)
+	if err != nil {
+		return err
+	}
+	if len(tickets) == 0 {
+		return recovery.ErrInvalidCode
+	}
+	ticket := tickets[len(tickets)-1]
+
+	switch {
+	case ticket.Expired(time.Now()):
+		_ = config.Store.DeleteTicket(ctx, ticket.TenantID, ticket.ID)
+		return recovery.ErrTicketExpired
+	case ticket.Matches(code):
+		return config.Store.DeleteTicket(ctx, ticket.TenantID, ticket.ID)
+	}
+
+	attempts, err := config.Store.IncrementAttempts(ctx, ticket.TenantID, ticket.ID)
+	if err != nil {
+		return fmt.Errorf("failed to count recovery attempts: %w", err)
+	}
+	if attempts >= config.maxAttempts() {
+		_ = config.Store.DeleteTicket(ctx, ticket.TenantID, ticket.ID)
+		return recovery.ErrTooManyAttempts
+	}
+	return recovery.ErrInvalidCode
+}
+
+// contactTickets returns the tickets of a contact for a purpose, oldest
+// first
+func (a *Auth) contactTickets(ctx context.Context, config *RecoveryConfig, contact *recovery.Contact, purpose recovery.Purpose) ([]*recovery.Ticket, error) {
+	tickets, err := config.Store.ListTickets(ctx, contact.TenantID, contact.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recovery tickets: %w", err)
+	}
+	return slices.DeleteFunc(tickets, func(ticket *recovery.Ticket) bool {
+		return ticket.Purpose != purpose || ticket.ContactID != contact.ID
+	}), nil
+}
+
+// notifyRecovery sends a security notification to the email address and
+// verified contacts of a user. A failure to notify does not fail the
+// recovery.
+func (a *Auth) notifyRecovery(ctx context.Context, config *RecoveryConfig, user *tenant.User, notificationType string, data map[string]any) {
+	if config.Sender == nil {
+		return
+	}
+
+	type recipient struct {
+		kind    recovery.ContactKind
+		address string
+	}
+	var recipients []recipient
+	if user.Email != "" {
+		recipients = append(recipients, recipient{recovery.ContactEmail, user.Email})
+	}
+	contacts, _ := config.Store.ListContacts(ctx, user.TenantID, user.ID)
+	for _, contact := range contacts {
+		r := recipient{contact.Kind, contact.Address}
+		if contact.Verified && !slices.Contains(recipients, r) {
+			recipients = append(recipients, r)
+		}
+	}
+
+	data["IPAddress"] = subject.ClientIPFromContext(ctx)
+	for _, r := range recipients {
+		_ = a.sendRecovery(ctx, config, user.ID, r.kind, r.address, notificationType, data)
+	}
+}
+
+// sendRecovery renders and sends a recovery notification to an address
+func (a *Auth) sendRecovery(ctx context.Context, config *RecoveryConfig, userID string, kind recovery.ContactKind, address, notificationType string, data map[string]any) error {
+	message := make(map[string]any, len(data)+2)
+	for k, v := range data {
+		message[k] = v
+	}
+	message["Kind"] = string(kind)
+	message["Time"] = time.Now().UTC().Format(time.RFC1123)
+
+	return notify.Notify(ctx, config.Sender, config.templates(), &notify.Notification{
+		Type:      notificationType,
+		TenantID:  authz.TenantFromContext(ctx),
+		Locale:    notify.LocaleFromContext(ctx),
+		SubjectID: userID,
+		Recipient: address,
+		Data:      message,
+	})
+}
+
+// auditRecovery records a recovery operation of a user, by the actor of the
+// context (else the user)
+func (a *Auth) auditRecovery(ctx context.Context, eventType, userID, action string, err error, key string, value any) {
+	actorID := authz.ActorFromContext(ctx)
+	if actorID == "" {
+		actorID = userID
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: eventType,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Resource:  "user:" + userID,
+		Action:    action,
+		Result:    auditResult(err),
+		Metadata:  auditMetadata(err, key, value),
+	})
+}
+
+// auditRecoveryFailed records a failed recovery (userID is empty when the
+// user is unknown)
+func (a *Auth) auditRecoveryFailed(ctx context.Context, userID, method string, err error) {
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventRecoveryFailed,
+		ActorID:   userID,
+		SubjectID: userID,
+		Action:    "recover",
+		Result:    audit.ResultFailure,
+		Metadata:  auditMetadata(err, "method", method),
+	})
+}
@@ -0,0 +1,318 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InMemoryStore is an in-memory implementation of Store
+type InMemoryStore struct {
+	mu         sync.Mutex
+	codes      map[string][]*BackupCode // tenantID + "/" + userID -> codes
+	contacts   map[string]*Contact      // tenantID + "/" + contactID -> contact
+	tickets    map[string]*Ticket       // tenantID + "/" + ticketID -> ticket
+	recoveries map[string]time.Time     // tenantID + "/" + userID -> last recovery
+	sent       map[string][]time.Time   // tenantID + "/" + userID -> codes sent
+}
+
+var _ Store = (*InMemoryStore)(nil)
+
+// NewInMemoryStore creates a new in-memory recovery store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		codes:      make(map[string][]*BackupCode),
+		contacts:   make(map[string]*Contact),
+		tickets:    make(map[string]*Ticket),
+		recoveries: make(map[string]time.Time),
+		sent:       make(map[string][]time.Time),
+	}
+}
+
+// ReplaceBackupCodes replaces the backup codes of a user
+func (s *InMemoryStore) ReplaceBackupCodes(ctx context.Context, tenantID, userID string, codes []*BackupCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := make([]*BackupCode, len(codes))
+	for i, code := range codes {
+		copied := *code
+		stored[i] = &copied
+	}
+	s.codes[key(tenantID, userID)] = stored
+	return nil
+}
+
+// ListBackupCodes returns the backup codes of a user, used or not
+func (s *InMemoryStore) ListBackupCodes(ctx context.Context, tenantID, userID string) ([]*BackupCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := make([]*BackupCode, 0, len(s.codes[key(tenantID, userID)]))
+	for _, code := range s.codes[key(tenantID, userID)] {
+		copied := *code
+		codes = append(codes, &copied)
+	}
+	return codes, nil
+}
+
+// UseBackupCode marks the unused backup code of a user with a hash as used
+func (s *InMemoryStore) UseBackupCode(ctx context.Context, tenantID, userID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, code := range s.codes[key(tenantID, userID)] {
+		if code.Hash == hash && !code.Used() {
+			code.UsedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrInvalidCode
+}
+
+// CreateContact adds a contact of a user
+func (s *InMemoryStore) CreateContact(ctx context.Context, contact *Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.contacts {
+		if existing.TenantID == contact.TenantID && existing.UserID == contact.UserID &&
+			existing.Kind == contact.Kind && existing.Address == contact.Address {
+			return fmt.Errorf("%w: %s", ErrContactExists, contact.Address)
+		}
+	}
+	if contact.ID == "" {
+		contact.ID = newID()
+	}
+	if contact.CreatedAt.IsZero() {
+		contact.CreatedAt = time.Now()
+	}
+	copied := *contact
+	s.contacts[key(contact.TenantID, contact.ID)] = &copied
+	return nil
+}
+
+// GetContact returns a contact of a user
+func (s *InMemoryStore) GetContact(ctx context.Context, tenantID, userID, contactID string) (*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contact, err := s.contact(tenantID, userID, contactID)
+	if err != nil {
+		return nil, err
+	}
+	copied := *contact
+	return &copied, nil
+}
+
+// FindContact returns the verified contact with an address in a tenant
+func (s *InMemoryStore) FindContact(ctx context.Context, tenantID string, kind ContactKind, address string) (*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, contact := range s.contacts {
+		if contact.TenantID == tenantID && contact.Kind == kind && contact.Address == address && contact.Verified {
+			copied := *contact
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrContactNotFound, address)
+}
+
+// ListContacts returns the contacts of a user ordered by creation
+func (s *InMemoryStore) ListContacts(ctx context.Context, tenantID, userID string) ([]*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var contacts []*Contact
+	for _, contact := range s.contacts {
+		if contact.TenantID == tenantID && contact.UserID == userID {
+			copied := *contact
+			contacts = append(contacts, &copied)
+		}
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		if !contacts[i].CreatedAt.Equal(contacts[j].CreatedAt) {
+			return contacts[i].CreatedAt.Before(contacts[j].CreatedAt)
+		}
+		return contacts[i].ID < contacts[j].ID
+	})
+	return contacts, nil
+}
+
+// VerifyContact marks a contact as verified
+func (s *InMemoryStore) VerifyContact(ctx context.Context, tenantID, userID, contactID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contact, err := s.contact(tenantID, userID, contactID)
+	if err != nil {
+		return err
+	}
+	for _, other := range s.contacts {
+		if other.TenantID == tenantID && other.UserID != userID && other.Kind == contact.Kind &&
+			other.Address == contact.Address && other.Verified {
+			return fmt.Errorf("%w: %s is verified by another user", ErrContactExists, contact.Address)
+		}
+	}
+	contact.Verified = true
+	contact.VerifiedAt = time.Now()
+	return nil
+}
+
+// DeleteContact removes a contact of a user
+func (s *InMemoryStore) DeleteContact(ctx context.Context, tenantID, userID, contactID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.contact(tenantID, userID, contactID); err != nil {
+		return err
+	}
+	delete(s.contacts, key(tenantID, contactID))
+	return nil
+}
+
+// SaveTicket creates or replaces a ticket
+func (s *InMemoryStore) SaveTicket(ctx context.Context, ticket *Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ticket.ID == "" {
+		ticket.ID = newID()
+	}
+	copied := *ticket
+	s.tickets[key(ticket.TenantID, ticket.ID)] = &copied
+	return nil
+}
+
+// FindTicket returns the ticket with the hash of a secret in a tenant
+func (s *InMemoryStore) FindTicket(ctx context.Context, tenantID, hash string) (*Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ticket := range s.tickets {
+		if ticket.TenantID == tenantID && ticket.Hash == hash {
+			copied := *ticket
+			return &copied, nil
+		}
+	}
+	return nil, ErrTicketNotFound
+}
+
+// ListTickets returns the tickets of a user ordered by creation
+func (s *InMemoryStore) ListTickets(ctx context.Context, tenantID, userID string) ([]*Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tickets []*Ticket
+	for _, ticket := range s.tickets {
+		if ticket.TenantID == tenantID && ticket.UserID == userID {
+			copied := *ticket
+			tickets = append(tickets, &copied)
+		}
+	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].CreatedAt.Before(tickets[j].CreatedAt) })
+	return tickets, nil
+}
+
+// IncrementAttempts increments the wrong codes submitted for a ticket
+func (s *InMemoryStore) IncrementAttempts(ctx context.Context, tenantID, ticketID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ticket, ok := s.tickets[key(tenantID, ticketID)]
+	if !ok {
+		return 0, ErrTicketNotFound
+	}
+	ticket.Attempts++
+	return ticket.Attempts, nil
+}
+
+// DeleteTicket removes a ticket
+func (s *InMemoryStore) DeleteTicket(ctx context.Context, tenantID, ticketID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tickets[key(tenantID, ticketID)]; !ok {
+		return ErrTicketNotFound
+	}
+	delete(s.tickets, key(tenantID, ticketID))
+	return nil
+}
+
+// RecordRecovery records that a user recovered its account
+func (s *InMemoryStore) RecordRecovery(ctx context.Context, tenantID, userID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recoveries[key(tenantID, userID)] = at
+	return nil
+}
+
+// LastRecovery returns when a user last recovered its account
+func (s *InMemoryStore) LastRecovery(ctx context.Context, tenantID, userID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.recoveries[key(tenantID, userID)], nil
+}
+
+// AllowCode records that a recovery code is sent to a user, within the
+// limit of a window
+func (s *InMemoryStore) AllowCode(ctx context.Context, tenantID, userID string, at time.Time, window time.Duration, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key(tenantID, userID)
+	recent := s.sent[k][:0]
+	for _, sent := range s.sent[k] {
+		if sent.After(at.Add(-window)) {
+			recent = append(recent, sent)
+		}
+	}
+	if len(recent) >= limit {
+		s.sent[k] = recent
+		return false, nil
+	}
+	s.sent[k] = append(recent, at)
+	return true, nil
+}
+
+// DeleteUser removes the recovery data of a user
+func (s *InMemoryStore) DeleteUser(ctx context.Context, tenantID, userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.codes[key(tenantID, userID)])
+	delete(s.codes, key(tenantID, userID))
+	delete(s.recoveries, key(tenantID, userID))
+	delete(s.sent, key(tenantID, userID))
+	for k, contact := range s.contacts {
+		if contact.TenantID == tenantID && contact.UserID == userID {
+			delete(s.contacts, k)
+			n++
+		}
+	}
+	for k, ticket := range s.tickets {
+		if ticket.TenantID == tenantID && ticket.UserID == userID {
+			delete(s.tickets, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// contact returns the stored contact of a user; the caller holds the lock
+func (s *InMemoryStore) contact(tenantID, userID, contactID string) (*Contact, error) {
+	contact, ok := s.contacts[key(tenantID, contactID)]
+	if !ok || contact.UserID != userID {
+		return nil, fmt.Errorf("%w: %s", ErrContactNotFound, contactID)
+	}
+	return contact, nil
+}
+
+func key(tenantID, id string) string {
+	return tenantID + "/" + id
+}
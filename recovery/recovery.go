@@ -0,0 +1,314 @@
+// Package recovery holds the data of account recovery, for users who lost
+// their sign-in factor (a passkey, the inbox of passwordless logins):
+// one-time backup codes, secondary email addresses and phone numbers the
+// user verified, and the tickets of pending recoveries, including the ones
+// initiated by an admin. The Auth runtime drives the flows (see
+// lokstraauth.Auth.RecoverWithBackupCode); secrets are stored hashed.
+package recovery
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrInvalidCode        = autherrors.New(autherrors.ErrInvalidCredentials, "invalid recovery code")
+	ErrTicketNotFound     = autherrors.New(autherrors.ErrInvalidCredentials, "recovery ticket not found")
+	ErrTicketExpired      = autherrors.New(autherrors.ErrInvalidCredentials, "recovery ticket expired")
+	ErrTicketNotReady     = autherrors.New(autherrors.ErrConflict, "recovery ticket cannot be redeemed yet")
+	ErrTooManyAttempts    = autherrors.New(autherrors.ErrRateLimited, "too many recovery attempts")
+	ErrContactNotFound    = autherrors.New(autherrors.ErrNotFound, "recovery contact not found")
+	ErrContactExists      = autherrors.New(autherrors.ErrConflict, "recovery contact already exists")
+	ErrContactNotVerified = autherrors.New(autherrors.ErrConflict, "recovery contact is not verified")
+	ErrInvalidContact     = autherrors.New(autherrors.ErrInvalidRequest, "invalid recovery contact")
+)
+
+// ContactKind is the channel of a recovery contact
+type ContactKind string
+
+const (
+	ContactEmail ContactKind = "email"
+	ContactPhone ContactKind = "phone"
+)
+
+// Contact is a secondary email address or phone number of a user. Once the
+// user verified it, recovery codes can be sent to it.
+type Contact struct {
+	ID         string      `json:"id"`
+	TenantID   string      `json:"tenant_id"`
+	UserID     string      `json:"user_id"`
+	Kind       ContactKind `json:"kind"`
+	Address    string      `json:"address"`
+	Verified   bool        `json:"verified"`
+	CreatedAt  time.Time   `json:"created_at"`
+	VerifiedAt time.Time   `json:"verified_at,omitzero"`
+}
+
+// BackupCode is a one-time backup code of a user. Only its hash is stored.
+type BackupCode struct {
+	Hash      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UsedAt    time.Time `json:"used_at,omitzero"`
+}
+
+// Used reports whether the code was used
+func (c *BackupCode) Used() bool {
+	return !c.UsedAt.IsZero()
+}
+
+// Remaining returns the number of unused backup codes
+func Remaining(codes []*BackupCode) int {
+	n := 0
+	for _, code := range codes {
+		if !code.Used() {
+			n++
+		}
+	}
+	return n
+}
+
+// Purpose is what a ticket is for
+type Purpose string
+
+const (
+	// PurposeVerifyContact: the code sent to a new contact, proving the user
+	// receives it
+	PurposeVerifyContact Purpose = "verify_contact"
+
+	// PurposeContactRecovery: the code sent to a verified contact of a user
+	// who lost their factor
+	PurposeContactRecovery Purpose = "contact_recovery"
+
+	// PurposeAdminRecovery: the token of a recovery initiated by an admin,
+	// handed to the user out of band
+	PurposeAdminRecovery Purpose = "admin_recovery"
+)
+
+// Ticket is a pending recovery step. Only the hash of its secret is stored.
+type Ticket struct {
+	ID       string  `json:"id"`
+	Hash     string  `json:"-"`
+	TenantID string  `json:"tenant_id"`
+	UserID   string  `json:"user_id"`
+	Purpose  Purpose `json:"purpose"`
+
+	// ContactID is the contact the code was sent to (contact tickets)
+	ContactID string `json:"contact_id,omitempty"`
+
+	// ActorID and Reason are the admin who initiated the recovery and why
+	// (admin tickets)
+	ActorID string `json:"actor_id,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	// NotBefore is when the ticket can be redeemed (zero: right away)
+	NotBefore time.Time `json:"not_before,omitzero"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Attempts counts the wrong codes submitted for the ticket
+	Attempts int `json:"attempts"`
+}
+
+// Expired reports whether the ticket expired at a time
+func (t *Ticket) Expired(at time.Time) bool {
+	return !at.Before(t.ExpiresAt)
+}
+
+// Ready reports whether the ticket can be redeemed at a time
+func (t *Ticket) Ready(at time.Time) bool {
+	return !at.Before(t.NotBefore)
+}
+
+// Matches reports whether a secret is the one of the ticket, in constant
+// time
+func (t *Ticket) Matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(t.Hash), []byte(Hash(secret))) == 1
+}
+
+// Store stores the recovery data of users
+type Store interface {
+	// ReplaceBackupCodes replaces the backup codes of a user
+	ReplaceBackupCodes(ctx context.Context, tenantID, userID string, codes []*BackupCode) error
+
+	// ListBackupCodes returns the backup codes of a user, used or not
+	ListBackupCodes(ctx context.Context, tenantID, userID string) ([]*BackupCode, error)
+
+	// UseBackupCode marks the unused backup code of a user with a hash as
+	// used (ErrInvalidCode if there is none). A code is used once, even by
+	// concurrent calls.
+	UseBackupCode(ctx context.Context, tenantID, userID, hash string) error
+
+	// CreateContact adds a contact of a user (ErrContactExists if the user
+	// has the address already). An empty ID is generated.
+	CreateContact(ctx context.Context, contact *Contact) error
+
+	// GetContact returns a contact of a user
+	GetContact(ctx context.Context, tenantID, userID, contactID string) (*Contact, error)
+
+	// FindContact returns the verified contact with an address in a tenant
+	FindContact(ctx context.Context, tenantID string, kind ContactKind, address string) (*Contact, error)
+
+	// ListContacts returns the contacts of a user ordered by creation
+	ListContacts(ctx context.Context, tenantID, userID string) ([]*Contact, error)
+
+	// VerifyContact marks a contact as verified (ErrContactExists if another
+	// user of the tenant verified the address)
+	VerifyContact(ctx context.Context, tenantID, userID, contactID string) error
+
+	// DeleteContact removes a contact of a user
+	DeleteContact(ctx context.Context, tenantID, userID, contactID string) error
+
+	// SaveTicket creates or replaces a ticket. An empty ID is generated.
+	SaveTicket(ctx context.Context, ticket *Ticket) error
+
+	// FindTicket returns the ticket with the hash of a secret in a tenant
+	// (ErrTicketNotFound)
+	FindTicket(ctx context.Context, tenantID, hash string) (*Ticket, error)
+
+	// ListTickets returns the tickets of a user, expired or not
+	ListTickets(ctx context.Context, tenantID, userID string) ([]*Ticket, error)
+
+	// IncrementAttempts increments the wrong codes submitted for a ticket
+	// and returns them
+	IncrementAttempts(ctx context.Context, tenantID, ticketID string) (int, error)
+
+	// DeleteTicket removes a ticket (ErrTicketNotFound)
+	DeleteTicket(ctx context.Context, tenantID, ticketID string) error
+
+	// RecordRecovery records that a user recovered its account
+	RecordRecovery(ctx context.Context, tenantID, userID string, at time.Time) error
+
+	// LastRecovery returns when a user last recovered its account (zero if
+	// never)
+	LastRecovery(ctx context.Context, tenantID, userID string) (time.Time, error)
+
+	// AllowCode records that a recovery code is sent to a user at a time,
+	// unless limit codes were recorded for the user within window before
+	// it, and reports whether it was recorded. Concurrent calls never
+	// record more than limit codes in a window.
+	AllowCode(ctx context.Context, tenantID, userID string, at time.Time, window time.Duration, limit int) (bool, error)
+
+	// DeleteUser removes the recovery data of a user and returns the number
+	// of codes, contacts and tickets removed (the codes recorded by
+	// AllowCode are removed too, without being counted)
+	DeleteUser(ctx context.Context, tenantID, userID string) (int, error)
+}
+
+// backupCodeAlphabet leaves out characters that are easily confused
+const backupCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// NewBackupCodes generates n backup codes, formatted "xxxxx-xxxxx", and
+// their hashes to store
+func NewBackupCodes(n int) ([]string, []*BackupCode, error) {
+	codes := make([]string, n)
+	hashed := make([]*BackupCode, n)
+	now := time.Now()
+	for i := range codes {
+		code, err := randomString(backupCodeAlphabet, 10)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code[:5] + "-" + code[5:]
+		hashed[i] = &BackupCode{Hash: HashBackupCode(codes[i]), CreatedAt: now}
+	}
+	return codes, hashed, nil
+}
+
+// NewCode generates the 8-digit code sent to a contact
+func NewCode() (string, error) {
+	return randomString("0123456789", 8)
+}
+
+// NewToken generates the token of an admin recovery
+func NewToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate recovery token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Hash returns the hash stored for the secret of a ticket: a code sent to a
+// contact or the token of an admin recovery, hashed verbatim (tokens are
+// case-sensitive base64url)
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashBackupCode returns the hash stored for a backup code. Backup codes are
+// compared without case, spaces and dashes, as users type them.
+func HashBackupCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	return Hash(normalized)
+}
+
+// NormalizeAddress validates the address of a contact and returns it
+// normalized: lowercase email addresses, and phone numbers in E.164 format
+// ("+" and 8 to 15 digits) without separators
+func NormalizeAddress(kind ContactKind, address string) (string, error) {
+	address = strings.TrimSpace(address)
+	switch kind {
+	case ContactEmail:
+		address = strings.ToLower(address)
+		at := strings.LastIndex(address, "@")
+		if at < 1 || at == len(address)-1 || strings.ContainsAny(address, " \t\r\n") {
+			return "", fmt.Errorf("%w: invalid email address", ErrInvalidContact)
+		}
+		return address, nil
+	case ContactPhone:
+		phone := strings.Map(func(r rune) rune {
+			switch r {
+			case ' ', '-', '(', ')', '.':
+				return -1
+			}
+			return r
+		}, address)
+		digits := strings.TrimPrefix(phone, "+")
+		if len(phone) == len(digits) || len(digits) < 8 || len(digits) > 15 || strings.Trim(digits, "0123456789") != "" {
+			return "", fmt.Errorf("%w: phone numbers must be in E.164 format", ErrInvalidContact)
+		}
+		return phone, nil
+	default:
+		return "", fmt.Errorf("%w: unknown kind %q", ErrInvalidContact, kind)
+	}
+}
+
+// randomString returns n characters drawn uniformly from alphabet
+func randomString(alphabet string, n int) (string, error) {
+	buf := make([]byte, 0, n)
+	random := make([]byte, 1)
+	// Reject bytes above the largest multiple of the alphabet size to avoid
+	// modulo bias
+	limit := 256 - 256%len(alphabet)
+	for len(buf) < n {
+		if _, err := rand.Read(random); err != nil {
+			return "", fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		if int(random[0]) < limit {
+			buf = append(buf, alphabet[int(random[0])%len(alphabet)])
+		}
+	}
+	return string(buf), nil
+}
+
+func newID() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,332 @@
+package lokstraauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/02_token/jwt"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/secrets"
+)
+
+var (
+	ErrRestartRequired = errors.New("configuration change requires a restart")
+)
+
+// ReloadSource is an external source of runtime components polled by the
+// ConfigWatcher, e.g. role permissions stored in a database (see
+// rbac.StoreReloader)
+type ReloadSource interface {
+	// Version identifies the current state of the source; Reload is called
+	// when it changes
+	Version(ctx context.Context) (string, error)
+
+	// Reload rebuilds the components of the source and swaps them in
+	Reload(ctx context.Context) error
+}
+
+// ConfigWatcherConfig holds configuration for the config watcher
+type ConfigWatcherConfig struct {
+	// Interval is how often the file and the sources are checked
+	// (default: 10 seconds)
+	Interval time.Duration
+
+	// Sources are additional reload sources (optional)
+	Sources []ReloadSource
+
+	// OnReload is called with the top-level keys applied by a reload
+	// (optional)
+	OnReload func(keys []string)
+
+	// OnError is called when a reload fails or changes keys that need a
+	// restart (ErrRestartRequired); the running components stay in effect
+	// (optional)
+	OnError func(err error)
+}
+
+// ConfigWatcher builds an Auth runtime from a configuration file (see
+// NewFromConfig) and rebuilds the affected components when the file
+// changes: authenticators (including OAuth2 providers), subjects and the
+// authorizer (RBAC role permissions, ABAC rules) are swapped atomically, and
+// a changed JWT key rotates the token manager key. In-flight requests finish
+// with the components they started with. Other changes (token type and
+// settings, secrets, runtime flags) need a restart.
+type ConfigWatcher struct {
+	path   string
+	config *ConfigWatcherConfig
+
+	auth           *Auth
+	registry       *secrets.Registry
+	authenticators atomic.Pointer[map[string]credential.Authenticator]
+	contextBuilder *subject.SwappableContextBuilder
+	authorizer     *authz.SwappableAuthorizer
+
+	mu       sync.Mutex // serializes checks
+	spec     *Spec      // the applied configuration
+	digest   [sha256.Size]byte
+	versions []string
+}
+
+// NewConfigWatcher builds the runtime of a configuration file and loads
+// the sources. Call Run to start watching.
+func NewConfigWatcher(path string, config *ConfigWatcherConfig) (*ConfigWatcher, error) {
+	if config == nil {
+		config = &ConfigWatcherConfig{}
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := spec.Secrets.registry()
+	if err != nil {
+		return nil, err
+	}
+	manager, err := spec.Token.build(context.Background(), registry)
+	if err != nil {
+		return nil, err
+	}
+	authenticators, err := spec.authenticators()
+	if err != nil {
+		return nil, err
+	}
+	authorizer, err := spec.Authorization.build()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &ConfigWatcher{
+		path:           path,
+		config:         config,
+		registry:       registry,
+		contextBuilder: subject.NewSwappableContextBuilder(spec.contextBuilder()),
+		spec:           spec,
+		digest:         sha256.Sum256(data),
+		versions:       make([]string, len(config.Sources)),
+	}
+	w.authenticators.Store(&authenticators)
+
+	builder := spec.builder(registry, manager).
+		WithAuthenticatorResolver(w).
+		WithIdentityContextBuilder(w.contextBuilder)
+	if authorizer != nil {
+		w.authorizer = authz.NewSwappableAuthorizer(authorizer)
+		builder.WithAuthorizer(w.authorizer)
+	}
+	w.auth = builder.Build()
+
+	if err := w.checkSources(context.Background()); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Auth returns the runtime
+func (w *ConfigWatcher) Auth() *Auth {
+	return w.auth
+}
+
+// ResolveAuthenticator returns the configured authenticator of a type
+func (w *ConfigWatcher) ResolveAuthenticator(ctx context.Context, authType string) (credential.Authenticator, error) {
+	return (*w.authenticators.Load())[authType], nil
+}
+
+// Run checks the file and the sources every interval until the context is
+// done
+func (w *ConfigWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Check reloads the file and the sources now if they changed, e.g. on
+// SIGHUP. Errors are reported to OnError.
+func (w *ConfigWatcher) Check(ctx context.Context) {
+	if err := w.checkFile(ctx); err != nil {
+		w.report(err)
+	}
+	if err := w.checkSources(ctx); err != nil {
+		w.report(err)
+	}
+}
+
+// checkFile reloads the file if its content changed
+func (w *ConfigWatcher) checkFile(ctx context.Context) error {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	digest := sha256.Sum256(data)
+	if digest == w.digest {
+		return nil
+	}
+	w.digest = digest
+
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return err
+	}
+	return w.apply(ctx, spec)
+}
+
+// apply rebuilds the changed components of a configuration and swaps them
+// in. Nothing is swapped if a component fails to build.
+func (w *ConfigWatcher) apply(ctx context.Context, spec *Spec) error {
+	current := w.spec
+	var restart, applied []string
+	var swaps []func()
+
+	// Runtime settings are read without synchronization: keep them
+	if spec.DefaultAuthenticator != current.DefaultAuthenticator ||
+		!reflect.DeepEqual(spec.RefreshTokens, current.RefreshTokens) ||
+		spec.SessionManagement != current.SessionManagement {
+		restart = append(restart, "runtime settings")
+		spec.DefaultAuthenticator = current.DefaultAuthenticator
+		spec.RefreshTokens = current.RefreshTokens
+		spec.SessionManagement = current.SessionManagement
+	}
+	if !reflect.DeepEqual(spec.Secrets, current.Secrets) {
+		restart = append(restart, "secrets")
+		spec.Secrets = current.Secrets
+	}
+
+	if !reflect.DeepEqual(spec.Token, current.Token) {
+		rotate, err := w.tokenRotation(ctx, current.Token, spec.Token)
+		if err != nil {
+			return err
+		}
+		if rotate == nil {
+			restart = append(restart, "token")
+			spec.Token = current.Token
+		} else {
+			swaps = append(swaps, rotate)
+			applied = append(applied, "token")
+		}
+	}
+
+	if !reflect.DeepEqual(spec.Authenticators, current.Authenticators) ||
+		!reflect.DeepEqual(spec.Subjects, current.Subjects) {
+		authenticators, err := spec.authenticators()
+		if err != nil {
+			return err
+		}
+		contextBuilder := spec.contextBuilder()
+		swaps = append(swaps, func() {
+			w.authenticators.Store(&authenticators)
+			w.contextBuilder.Swap(contextBuilder)
+		})
+		applied = append(applied, "authenticators", "subjects")
+	}
+
+	if !reflect.DeepEqual(spec.Authorization, current.Authorization) {
+		authorizer, err := spec.Authorization.build()
+		if err != nil {
+			return err
+		}
+		if w.authorizer == nil || authorizer == nil {
+			restart = append(restart, "authorization")
+			spec.Authorization = current.Authorization
+		} else {
+			swaps = append(swaps, func() { w.authorizer.Swap(authorizer) })
+			applied = append(applied, "authorization")
+		}
+	}
+
+	for _, swap := range swaps {
+		swap()
+	}
+	w.spec = spec
+
+	if len(applied) > 0 && w.config.OnReload != nil {
+		w.config.OnReload(applied)
+	}
+	if len(restart) > 0 {
+		return fmt.Errorf("%w: %s", ErrRestartRequired, strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+// tokenRotation returns the swap that rotates the JWT key when only the
+// keys changed, else nil
+func (w *ConfigWatcher) tokenRotation(ctx context.Context, current, next TokenSpec) (func(), error) {
+	manager, ok := w.auth.tokenManager.(*jwt.Manager)
+	if !ok || current.JWT == nil || next.JWT == nil || current.Type != next.Type {
+		return nil, nil
+	}
+
+	// Only the key material may differ
+	keyless := func(spec JWTSpec) JWTSpec {
+		spec.Secret, spec.PrivateKey, spec.PublicKey = "", "", ""
+		return spec
+	}
+	if !reflect.DeepEqual(keyless(*current.JWT), keyless(*next.JWT)) ||
+		!reflect.DeepEqual(current.Simple, next.Simple) {
+		return nil, nil
+	}
+
+	_, signingKey, verifyingKey, err := next.JWT.keys(ctx, w.registry)
+	if err != nil {
+		return nil, err
+	}
+	return func() { manager.RotateKey(signingKey, verifyingKey) }, nil
+}
+
+// checkSources reloads the sources whose version changed
+func (w *ConfigWatcher) checkSources(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var errs []error
+	for i, source := range w.config.Sources {
+		version, err := source.Version(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("source %d: %w", i, err))
+			continue
+		}
+		if version == w.versions[i] {
+			continue
+		}
+		if err := source.Reload(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("source %d: %w", i, err))
+			continue
+		}
+		w.versions[i] = version
+	}
+	return errors.Join(errs...)
+}
+
+func (w *ConfigWatcher) report(err error) {
+	if w.config.OnError != nil {
+		w.config.OnError(err)
+	}
+}
@@ -0,0 +1,114 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	token "github.com/primadi/lokstra-auth/02_token"
+	"github.com/primadi/lokstra-auth/02_token/device"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/audit"
+)
+
+var (
+	ErrDeviceTokensNotSupported = errors.New("no device token manager configured")
+)
+
+// SetDeviceTokenManager sets the remember-me device token manager
+func (a *Auth) SetDeviceTokenManager(manager *device.Manager) {
+	a.deviceTokens = manager
+}
+
+// GetDeviceTokenManager returns the device token manager (nil if not configured)
+func (a *Auth) GetDeviceTokenManager() *device.Manager {
+	return a.deviceTokens
+}
+
+// LoginWithDeviceToken silently re-authenticates a remembered device.
+// The device token is rotated: the response carries the new device token,
+// which replaces the presented one, plus a fresh short-lived access token.
+// Layer 2 -> Layer 3
+func (a *Auth) LoginWithDeviceToken(ctx context.Context, deviceToken string, info *device.Info) (*LoginResponse, error) {
+	if a.deviceTokens == nil {
+		return nil, ErrDeviceTokensNotSupported
+	}
+
+	rotated, dev, err := a.deviceTokens.Rotate(ctx, deviceToken, info)
+	if err != nil {
+		a.emit(ctx, token.EventVerificationFailed, "", device.TokenType, nil, err)
+		return nil, err
+	}
+
+	claims := make(token.Claims, len(dev.Claims)+1)
+	for k, v := range dev.Claims {
+		claims[k] = v
+	}
+	claims["auth_method"] = "device"
+
+	if info != nil && info.IPAddress != "" {
+		ctx = subject.WithClientIP(ctx, info.IPAddress)
+	}
+
+	response, err := a.CompleteLogin(ctx, &credential.AuthenticationResult{
+		Success: true,
+		Subject: dev.SubjectID,
+		Claims:  claims,
+		Metadata: map[string]any{
+			"auth_type": "device",
+			"device_id": dev.SeriesID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	response.DeviceToken = rotated
+
+	registration := &DeviceRegistration{
+		Fingerprint: info.Fingerprint,
+		Name:        dev.Name,
+		IPAddress:   dev.IPAddress,
+		UserAgent:   dev.UserAgent,
+	}
+	if err := a.finishLogin(ctx, response, registration, dev.IPAddress, dev.UserAgent); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// ListRememberedDevices returns the remembered devices (device token series) of a subject
+func (a *Auth) ListRememberedDevices(ctx context.Context, subjectID string) ([]*device.Device, error) {
+	if a.deviceTokens == nil {
+		return nil, ErrDeviceTokensNotSupported
+	}
+	if subjectID == "" {
+		return nil, ErrMissingSubject
+	}
+
+	return a.deviceTokens.List(ctx, subjectID)
+}
+
+// ForgetDevice revokes one remembered device (device token series) of a subject
+func (a *Auth) ForgetDevice(ctx context.Context, subjectID, seriesID string) error {
+	if a.deviceTokens == nil {
+		return ErrDeviceTokensNotSupported
+	}
+	if subjectID == "" {
+		return ErrMissingSubject
+	}
+
+	if err := a.deviceTokens.Revoke(ctx, subjectID, seriesID); err != nil {
+		return err
+	}
+
+	a.emit(ctx, token.EventRevoked, subjectID, device.TokenType, nil, nil)
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventTokenRevoked,
+		SubjectID: subjectID,
+		Resource:  "device_token:" + seriesID,
+		Result:    audit.ResultSuccess,
+	})
+	a.publishRevoked(ctx, subjectID, "device_forgotten")
+	return nil
+}
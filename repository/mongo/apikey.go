@@ -0,0 +1,161 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+)
+
+// APIKeyStore stores API keys (apikey.KeyStore and apikey.KeyLister)
+type APIKeyStore struct {
+	keys *mongo.Collection
+}
+
+var (
+	_ apikey.KeyStore  = (*APIKeyStore)(nil)
+	_ apikey.KeyLister = (*APIKeyStore)(nil)
+)
+
+// NewAPIKeyStore creates an API key store on a collection (default:
+// "api_keys"). Call Migrate to create the indexes.
+func NewAPIKeyStore(db *mongo.Database, collection string) (*APIKeyStore, error) {
+	if collection == "" {
+		collection = "api_keys"
+	}
+	if err := checkCollectionName(collection); err != nil {
+		return nil, err
+	}
+	return &APIKeyStore{keys: db.Collection(collection)}, nil
+}
+
+// Migrate creates the indexes of the API key collection if they do not exist
+func (s *APIKeyStore) Migrate(ctx context.Context) error {
+	return migrate(ctx, s.keys, []index{
+		{keys: bson.D{{Key: "id", Value: 1}}, unique: true},
+		{keys: bson.D{{Key: "key_hash", Value: 1}}, unique: true},
+		{keys: bson.D{{Key: "prefix", Value: 1}}},
+		{keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+}
+
+// GetByHash retrieves an API key by its hash
+func (s *APIKeyStore) GetByHash(ctx context.Context, hash string) (*apikey.APIKey, error) {
+	var doc apiKeyDoc
+	err := s.keys.FindOne(ctx, bson.D{{Key: "key_hash", Value: hash}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.apiKey()
+}
+
+// GetByPrefix retrieves all API keys with the given prefix
+func (s *APIKeyStore) GetByPrefix(ctx context.Context, prefix string) ([]*apikey.APIKey, error) {
+	return s.query(ctx, bson.D{{Key: "prefix", Value: prefix}})
+}
+
+// ListByUser returns the API keys of a user, oldest first
+func (s *APIKeyStore) ListByUser(ctx context.Context, userID string) ([]*apikey.APIKey, error) {
+	return s.query(ctx, bson.D{{Key: "user_id", Value: userID}})
+}
+
+// Store saves an API key, replacing the key with the same ID
+func (s *APIKeyStore) Store(ctx context.Context, key *apikey.APIKey) error {
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	metadata, err := encodeMetadata(key.Metadata)
+	if err != nil {
+		return err
+	}
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	_, err = s.keys.ReplaceOne(ctx, bson.D{{Key: "id", Value: key.ID}}, &apiKeyDoc{ID: key.ID, KeyHash: key.KeyHash, Prefix: key.Prefix,
+		UserID: key.UserID, Name: key.Name, Scopes: scopes, Metadata: metadata, CreatedAt: key.CreatedAt, ExpiresAt: key.ExpiresAt,
+		LastUsed: key.LastUsed, Revoked: key.Revoked, RevokedAt: key.RevokedAt}, options.Replace().SetUpsert(true))
+	return err
+}
+
+// UpdateLastUsed updates the last used timestamp
+func (s *APIKeyStore) UpdateLastUsed(ctx context.Context, keyID string, timestamp time.Time) error {
+	return s.update(ctx, keyID, bson.D{{Key: "last_used", Value: timestamp}})
+}
+
+// Revoke marks an API key as revoked
+func (s *APIKeyStore) Revoke(ctx context.Context, keyID string) error {
+	return s.update(ctx, keyID, bson.D{{Key: "revoked", Value: true}, {Key: "revoked_at", Value: time.Now()}})
+}
+
+// Delete removes an API key
+func (s *APIKeyStore) Delete(ctx context.Context, keyID string) error {
+	result, err := s.keys.DeleteOne(ctx, bson.D{{Key: "id", Value: keyID}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return apikey.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// update sets fields of a key
+func (s *APIKeyStore) update(ctx context.Context, keyID string, fields bson.D) error {
+	result, err := s.keys.UpdateOne(ctx, bson.D{{Key: "id", Value: keyID}}, bson.D{{Key: "$set", Value: fields}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return apikey.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// query returns the keys matching a filter, oldest first
+func (s *APIKeyStore) query(ctx context.Context, filter bson.D) ([]*apikey.APIKey, error) {
+	docs, err := findAll[apiKeyDoc](ctx, s.keys, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*apikey.APIKey
+	for i := range docs {
+		key, err := docs[i].apiKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+type apiKeyDoc struct {
+	ID        string     `bson:"id"`
+	KeyHash   string     `bson:"key_hash"`
+	Prefix    string     `bson:"prefix"`
+	UserID    string     `bson:"user_id"`
+	Name      string     `bson:"name"`
+	Scopes    []string   `bson:"scopes"`
+	Metadata  bson.Raw   `bson:"metadata,omitempty"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt *time.Time `bson:"expires_at"`
+	LastUsed  *time.Time `bson:"last_used"`
+	Revoked   bool       `bson:"revoked"`
+	RevokedAt *time.Time `bson:"revoked_at"`
+}
+
+func (d *apiKeyDoc) apiKey() (*apikey.APIKey, error) {
+	key := &apikey.APIKey{ID: d.ID, KeyHash: d.KeyHash, Prefix: d.Prefix, UserID: d.UserID, Name: d.Name, Scopes: d.Scopes,
+		CreatedAt: d.CreatedAt, ExpiresAt: d.ExpiresAt, LastUsed: d.LastUsed, Revoked: d.Revoked, RevokedAt: d.RevokedAt}
+	return key, decodeMetadata(d.Metadata, &key.Metadata)
+}
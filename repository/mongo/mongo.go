@@ -0,0 +1,229 @@
+// Package mongo implements the store contracts of lokstra-auth on MongoDB:
+// tenants, apps, branches and users (tenant), roles and permissions (rbac),
+// versioned policies (policy), relationship tuples (rebac) and API keys
+// (apikey), with the semantics of the PostgreSQL and SQLite stores.
+//
+// Changes spanning several documents run in a transaction when the
+// deployment supports them (replica set or sharded cluster). On a standalone
+// server they run without one; unique indexes still keep names, usernames
+// and keys unique.
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// transactions runs functions in a transaction when the deployment supports
+// them. Support is detected on first use with the hello command.
+type transactions struct {
+	db *mongo.Database
+
+	mu        sync.Mutex
+	detected  bool
+	supported bool
+}
+
+func newTransactions(db *mongo.Database) *transactions {
+	return &transactions{db: db}
+}
+
+// run runs fn in a transaction, or directly on a standalone server. fn uses
+// the context it receives and may run more than once on transient errors.
+func (t *transactions) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	supported, err := t.detect(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fn(ctx)
+	}
+
+	session, err := t.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// detect reports whether the deployment is a replica set or a sharded
+// cluster
+func (t *transactions) detect(ctx context.Context) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.detected {
+		return t.supported, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := t.db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, fmt.Errorf("failed to detect transaction support: %w", err)
+	}
+	t.detected = true
+	t.supported = hello.SetName != "" || hello.Msg == "isdbgrid"
+	return t.supported, nil
+}
+
+// index is an index of a collection
+type index struct {
+	keys    bson.D
+	unique  bool
+	partial bson.D
+}
+
+// migrate creates the indexes of a collection
+func migrate(ctx context.Context, collection *mongo.Collection, indexes []index) error {
+	models := make([]mongo.IndexModel, len(indexes))
+	for i, idx := range indexes {
+		opts := options.Index()
+		if idx.unique {
+			opts.SetUnique(true)
+		}
+		if idx.partial != nil {
+			opts.SetPartialFilterExpression(idx.partial)
+		}
+		models[i] = mongo.IndexModel{Keys: idx.keys, Options: opts}
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", collection.Name(), err)
+	}
+	return nil
+}
+
+// checkCollectionName validates a collection name or prefix
+func checkCollectionName(name string) error {
+	if !collectionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid collection name: %q", name)
+	}
+	return nil
+}
+
+// exists reports whether a document matches a filter
+func exists(ctx context.Context, collection *mongo.Collection, filter bson.D) (bool, error) {
+	err := collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.D{{Key: "_id", Value: 1}})).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// findAll decodes the documents matching a filter
+func findAll[T any](ctx context.Context, collection *mongo.Collection, filter bson.D, opts *options.FindOptionsBuilder) ([]T, error) {
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]T, 0)
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// matched returns notFound when an update or delete matched no document
+func matched(n int64, err error, notFound error, name string) error {
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", notFound, name)
+	}
+	return nil
+}
+
+// page applies the offset and limit of a page to find options
+func page(opts *options.FindOptionsBuilder, offset, limit int) *options.FindOptionsBuilder {
+	if offset > 0 {
+		opts.SetSkip(int64(offset))
+	}
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return opts
+}
+
+// search is the condition of a case-insensitive search of a text in fields
+// (none when the text is empty)
+func search(text string, fields ...string) bson.E {
+	if text == "" {
+		return bson.E{}
+	}
+	pattern := bson.Regex{Pattern: regexp.QuoteMeta(text), Options: "i"}
+	conditions := make(bson.A, len(fields))
+	for i, field := range fields {
+		conditions[i] = bson.D{{Key: field, Value: pattern}}
+	}
+	return bson.E{Key: "$or", Value: conditions}
+}
+
+// where builds a filter from conditions, skipping empty ones
+func where(elements ...bson.E) bson.D {
+	d := bson.D{}
+	for _, e := range elements {
+		if e.Key != "" {
+			d = append(d, e)
+		}
+	}
+	return d
+}
+
+// fold normalizes a name, username or email for uniqueness checks
+func fold(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// encodeMetadata encodes metadata as a document (nil when empty)
+func encodeMetadata(metadata map[string]any) (bson.Raw, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	raw, err := bson.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return raw, nil
+}
+
+// duplicate returns exists when err is a unique index violation
+func duplicate(err error, exists error, name string) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", exists, name)
+	}
+	return err
+}
+
+// decodeMetadata decodes a metadata document through relaxed extended
+// JSON, so values have the types of the JSON-backed stores (numbers as
+// float64, nested documents as map[string]any)
+func decodeMetadata(raw bson.Raw, metadata *map[string]any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	data, err := bson.MarshalExtJSON(raw, false, false)
+	if err == nil {
+		err = json.Unmarshal(data, metadata)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return nil
+}
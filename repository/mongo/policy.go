@@ -0,0 +1,328 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/policy"
+)
+
+// changeAttempts bounds the retries of a policy change that lost a race for
+// its version number
+const changeAttempts = 5
+
+// PolicyStore stores policies with their version history
+// (authz.VersionedPolicyStore). Policies are partitioned per tenant (see
+// authz.WithTenant).
+//
+// A policy is kept as its JSON encoding, like in the SQL stores, next to its
+// subjects and resources for FindBySubject and FindByResource.
+type PolicyStore struct {
+	tx       *transactions
+	policies *mongo.Collection
+	versions *mongo.Collection
+}
+
+var _ authz.VersionedPolicyStore = (*PolicyStore)(nil)
+
+// NewPolicyStore creates a policy store on a collection (default:
+// "authz_policies"); versions are kept in "<collection>_versions". Call
+// Migrate to create the indexes.
+func NewPolicyStore(db *mongo.Database, collection string) (*PolicyStore, error) {
+	if collection == "" {
+		collection = "authz_policies"
+	}
+	if err := checkCollectionName(collection); err != nil {
+		return nil, err
+	}
+	return &PolicyStore{
+		tx:       newTransactions(db),
+		policies: db.Collection(collection),
+		versions: db.Collection(collection + "_versions"),
+	}, nil
+}
+
+// Migrate creates the indexes of the policy and version collections if they
+// do not exist
+func (s *PolicyStore) Migrate(ctx context.Context) error {
+	if err := migrate(ctx, s.policies, []index{
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "id", Value: 1}}, unique: true},
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "subjects", Value: 1}}},
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "resources", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+	return migrate(ctx, s.versions, []index{
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "policy_id", Value: 1}, {Key: "version", Value: 1}}, unique: true},
+	})
+}
+
+// Create creates a new policy (version 1)
+func (s *PolicyStore) Create(ctx context.Context, p *authz.Policy) error {
+	_, err := s.change(ctx, p.ID, func(ctx context.Context, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current != nil {
+			return nil, fmt.Errorf("%w: %s", policy.ErrPolicyExists, p.ID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyCreated, Policy: p}, nil
+	})
+	return err
+}
+
+// Get retrieves a policy by ID
+func (s *PolicyStore) Get(ctx context.Context, policyID string) (*authz.Policy, error) {
+	doc, err := findOne[policyDoc](ctx, s.policies, policyFilter(ctx, policyID), policy.ErrPolicyNotFound, policyID)
+	if err != nil {
+		return nil, err
+	}
+	return decodePolicy(doc.Policy)
+}
+
+// Update updates an existing policy, recording a new version
+func (s *PolicyStore) Update(ctx context.Context, p *authz.Policy) error {
+	_, err := s.change(ctx, p.ID, func(ctx context.Context, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current == nil {
+			return nil, fmt.Errorf("%w: %s", policy.ErrPolicyNotFound, p.ID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyUpdated, Policy: p}, nil
+	})
+	return err
+}
+
+// Delete deletes a policy; its history is kept
+func (s *PolicyStore) Delete(ctx context.Context, policyID string) error {
+	_, err := s.change(ctx, policyID, func(ctx context.Context, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current == nil {
+			return nil, fmt.Errorf("%w: %s", policy.ErrPolicyNotFound, policyID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyDeleted, Policy: current}, nil
+	})
+	return err
+}
+
+// List lists all policies of the context tenant
+func (s *PolicyStore) List(ctx context.Context) ([]*authz.Policy, error) {
+	return s.query(ctx, bson.E{})
+}
+
+// FindBySubject finds policies for a subject
+func (s *PolicyStore) FindBySubject(ctx context.Context, subjectID string) ([]*authz.Policy, error) {
+	return s.query(ctx, bson.E{Key: "subjects", Value: bson.D{{Key: "$in", Value: bson.A{subjectID, "*"}}}})
+}
+
+// FindByResource finds policies for a resource
+func (s *PolicyStore) FindByResource(ctx context.Context, resourceType string, resourceID string) ([]*authz.Policy, error) {
+	return s.query(ctx, bson.E{Key: "resources", Value: bson.D{{Key: "$in", Value: bson.A{
+		fmt.Sprintf("%s:%s", resourceType, resourceID), fmt.Sprintf("%s:*", resourceType), "*"}}}})
+}
+
+// ListVersions returns the versions of a policy, oldest first
+func (s *PolicyStore) ListVersions(ctx context.Context, policyID string) ([]*authz.PolicyVersion, error) {
+	docs, err := findAll[versionDoc](ctx, s.versions, versionFilter(ctx, policyID),
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("%w: %s", policy.ErrPolicyNotFound, policyID)
+	}
+
+	versions := make([]*authz.PolicyVersion, len(docs))
+	for i := range docs {
+		if versions[i], err = docs[i].version(); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// GetVersion returns one version of a policy
+func (s *PolicyStore) GetVersion(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	doc, err := findOne[versionDoc](ctx, s.versions, append(versionFilter(ctx, policyID), bson.E{Key: "version", Value: version}),
+		authz.ErrVersionNotFound, fmt.Sprintf("%s v%d", policyID, version))
+	if err != nil {
+		return nil, err
+	}
+	return doc.version()
+}
+
+// Rollback restores the content of a prior version as a new version, in one
+// transaction
+func (s *PolicyStore) Rollback(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	return s.change(ctx, policyID, func(ctx context.Context, current *authz.Policy) (*authz.PolicyVersion, error) {
+		doc, err := findOne[versionDoc](ctx, s.versions, append(versionFilter(ctx, policyID), bson.E{Key: "version", Value: version}),
+			authz.ErrVersionNotFound, fmt.Sprintf("%s v%d", policyID, version))
+		if err != nil {
+			return nil, err
+		}
+		restored, err := decodePolicy(doc.Policy)
+		if err != nil {
+			return nil, err
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyRolledBack, Policy: restored, RollbackOf: version}, nil
+	})
+}
+
+// DeleteTenant removes every policy and version of a tenant
+func (s *PolicyStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		for _, collection := range []*mongo.Collection{s.policies, s.versions} {
+			if _, err := collection.DeleteMany(ctx, bson.D{{Key: "tenant_id", Value: tenantID}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mutation decides the change of a policy given its current content (nil if
+// absent), as a version draft with Operation, Policy and RollbackOf
+type mutation func(ctx context.Context, current *authz.Policy) (*authz.PolicyVersion, error)
+
+// change applies a mutation and records its version, in a transaction where
+// available. The unique index of versions serializes concurrent changes: the
+// loser of a race for a version number starts over.
+func (s *PolicyStore) change(ctx context.Context, policyID string, mutate mutation) (*authz.PolicyVersion, error) {
+	for attempt := 1; ; attempt++ {
+		var version *authz.PolicyVersion
+		err := s.tx.run(ctx, func(ctx context.Context) error {
+			var err error
+			version, err = s.apply(ctx, policyID, mutate)
+			return err
+		})
+		if mongo.IsDuplicateKeyError(err) && attempt < changeAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return version, nil
+	}
+}
+
+// apply runs one attempt of a change
+func (s *PolicyStore) apply(ctx context.Context, policyID string, mutate mutation) (*authz.PolicyVersion, error) {
+	tenant := authz.PartitionFromContext(ctx)
+
+	var current *authz.Policy
+	doc, err := findOne[policyDoc](ctx, s.policies, policyFilter(ctx, policyID), policy.ErrPolicyNotFound, policyID)
+	switch {
+	case errors.Is(err, policy.ErrPolicyNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		if current, err = decodePolicy(doc.Policy); err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := mutate(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+
+	var last versionDoc
+	err = s.versions.FindOne(ctx, versionFilter(ctx, policyID), options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	version.Version = last.Version + 1
+	version.PolicyID = policyID
+	version.Author = authz.ActorFromContext(ctx)
+	version.CreatedAt = time.Now()
+
+	data, err := json.Marshal(version.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy: %w", err)
+	}
+
+	if _, err := s.versions.InsertOne(ctx, &versionDoc{TenantID: tenant, PolicyID: policyID, Version: version.Version,
+		Operation: string(version.Operation), Policy: string(data), Author: version.Author, RollbackOf: version.RollbackOf,
+		CreatedAt: version.CreatedAt}); err != nil {
+		return nil, err
+	}
+
+	if version.Operation == authz.PolicyDeleted {
+		_, err = s.policies.DeleteOne(ctx, policyFilter(ctx, policyID))
+	} else {
+		_, err = s.policies.ReplaceOne(ctx, policyFilter(ctx, policyID), &policyDoc{TenantID: tenant, ID: policyID, Policy: string(data),
+			Subjects: version.Policy.Subjects, Resources: version.Policy.Resources, Version: version.Version,
+			UpdatedAt: version.CreatedAt, UpdatedBy: version.Author}, options.Replace().SetUpsert(true))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// query returns the policies of the context tenant matching a condition,
+// sorted by ID
+func (s *PolicyStore) query(ctx context.Context, condition bson.E) ([]*authz.Policy, error) {
+	docs, err := findAll[policyDoc](ctx, s.policies, where(bson.E{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}, condition),
+		options.Find().SetSort(bson.D{{Key: "id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]*authz.Policy, len(docs))
+	for i := range docs {
+		if policies[i], err = decodePolicy(docs[i].Policy); err != nil {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+func policyFilter(ctx context.Context, policyID string) bson.D {
+	return bson.D{{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}, {Key: "id", Value: policyID}}
+}
+
+func versionFilter(ctx context.Context, policyID string) bson.D {
+	return bson.D{{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}, {Key: "policy_id", Value: policyID}}
+}
+
+func decodePolicy(data string) (*authz.Policy, error) {
+	p := &authz.Policy{}
+	if err := json.Unmarshal([]byte(data), p); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %w", err)
+	}
+	return p, nil
+}
+
+type policyDoc struct {
+	TenantID  string    `bson:"tenant_id"`
+	ID        string    `bson:"id"`
+	Policy    string    `bson:"policy"`
+	Subjects  []string  `bson:"subjects"`
+	Resources []string  `bson:"resources"`
+	Version   int       `bson:"version"`
+	UpdatedAt time.Time `bson:"updated_at"`
+	UpdatedBy string    `bson:"updated_by"`
+}
+
+type versionDoc struct {
+	TenantID   string    `bson:"tenant_id"`
+	PolicyID   string    `bson:"policy_id"`
+	Version    int       `bson:"version"`
+	Operation  string    `bson:"operation"`
+	Policy     string    `bson:"policy"`
+	Author     string    `bson:"author"`
+	RollbackOf int       `bson:"rollback_of"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+func (d *versionDoc) version() (*authz.PolicyVersion, error) {
+	p, err := decodePolicy(d.Policy)
+	if err != nil {
+		return nil, err
+	}
+	return &authz.PolicyVersion{PolicyID: d.PolicyID, Version: d.Version, Operation: authz.PolicyOperation(d.Operation), Policy: p,
+		Author: d.Author, RollbackOf: d.RollbackOf, CreatedAt: d.CreatedAt}, nil
+}
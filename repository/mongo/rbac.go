@@ -0,0 +1,358 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+)
+
+// RBACStore stores roles, the permission catalog and role assignments
+// (rbac.Store). Data is partitioned per tenant (see authz.WithTenant). The
+// permissions of a role are kept in the role document.
+type RBACStore struct {
+	tx           *transactions
+	roles        *mongo.Collection
+	permissions  *mongo.Collection
+	subjectRoles *mongo.Collection
+}
+
+var _ rbac.Store = (*RBACStore)(nil)
+
+// NewRBACStore creates an RBAC store on collections named after a prefix
+// (default: "rbac"): <prefix>_roles, <prefix>_permissions and
+// <prefix>_subject_roles. Call Migrate to create the indexes.
+func NewRBACStore(db *mongo.Database, prefix string) (*RBACStore, error) {
+	if prefix == "" {
+		prefix = "rbac"
+	}
+	if err := checkCollectionName(prefix); err != nil {
+		return nil, err
+	}
+	return &RBACStore{
+		tx:           newTransactions(db),
+		roles:        db.Collection(prefix + "_roles"),
+		permissions:  db.Collection(prefix + "_permissions"),
+		subjectRoles: db.Collection(prefix + "_subject_roles"),
+	}, nil
+}
+
+// Migrate creates the indexes of the RBAC collections if they do not exist
+func (s *RBACStore) Migrate(ctx context.Context) error {
+	if err := migrate(ctx, s.roles, []index{
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}}, unique: true},
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "permissions", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+	if err := migrate(ctx, s.permissions, []index{
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}}, unique: true},
+	}); err != nil {
+		return err
+	}
+	return migrate(ctx, s.subjectRoles, []index{
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "subject_id", Value: 1}, {Key: "role", Value: 1}}, unique: true},
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "role", Value: 1}, {Key: "subject_id", Value: 1}}},
+	})
+}
+
+// CreateRole creates a role
+func (s *RBACStore) CreateRole(ctx context.Context, role *rbac.Role) error {
+	if err := rbac.ValidateName(role.Name); err != nil {
+		return err
+	}
+
+	// An empty array rather than null, for $addToSet
+	permissions := append([]string{}, role.Permissions...)
+	slices.Sort(permissions)
+	now := time.Now()
+	_, err := s.roles.InsertOne(ctx, &roleDoc{TenantID: authz.PartitionFromContext(ctx), Name: role.Name, Description: role.Description,
+		Permissions: slices.Compact(permissions), CreatedAt: now, UpdatedAt: now})
+	return duplicate(err, rbac.ErrRoleExists, role.Name)
+}
+
+// GetRole returns a role with its permissions
+func (s *RBACStore) GetRole(ctx context.Context, name string) (*rbac.Role, error) {
+	doc, err := findOne[roleDoc](ctx, s.roles, roleFilter(ctx, name), rbac.ErrRoleNotFound, name)
+	if err != nil {
+		return nil, err
+	}
+	return doc.role(), nil
+}
+
+// UpdateRole updates the description of a role
+func (s *RBACStore) UpdateRole(ctx context.Context, role *rbac.Role) error {
+	result, err := s.roles.UpdateOne(ctx, roleFilter(ctx, role.Name), bson.D{{Key: "$set", Value: bson.D{
+		{Key: "description", Value: role.Description}, {Key: "updated_at", Value: time.Now()}}}})
+	return matched(matchedCount(result), err, rbac.ErrRoleNotFound, role.Name)
+}
+
+// DeleteRole deletes a role, its permissions and its assignments
+func (s *RBACStore) DeleteRole(ctx context.Context, name string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		result, err := s.roles.DeleteOne(ctx, roleFilter(ctx, name))
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return fmt.Errorf("%w: %s", rbac.ErrRoleNotFound, name)
+		}
+		_, err = s.subjectRoles.DeleteMany(ctx, bson.D{{Key: "tenant_id", Value: tenant}, {Key: "role", Value: name}})
+		return err
+	})
+}
+
+// ListRoles returns a page of roles sorted by name, and the total count
+func (s *RBACStore) ListRoles(ctx context.Context, opts rbac.ListOptions) ([]*rbac.Role, int, error) {
+	filter := where(bson.E{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}, search(opts.Search, "name"))
+	total, err := s.roles.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	docs, err := findAll[roleDoc](ctx, s.roles, filter, page(options.Find().SetSort(bson.D{{Key: "name", Value: 1}}), opts.Offset, opts.Limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	roles := make([]*rbac.Role, len(docs))
+	for i := range docs {
+		roles[i] = docs[i].role()
+	}
+	return roles, int(total), nil
+}
+
+// CreatePermission adds a permission to the catalog
+func (s *RBACStore) CreatePermission(ctx context.Context, perm *rbac.Permission) error {
+	if err := rbac.ValidateName(perm.Name); err != nil {
+		return err
+	}
+
+	_, err := s.permissions.InsertOne(ctx, &permissionDoc{TenantID: authz.PartitionFromContext(ctx), Name: perm.Name,
+		Description: perm.Description, CreatedAt: time.Now()})
+	return duplicate(err, rbac.ErrPermissionExists, perm.Name)
+}
+
+// GetPermission returns a permission of the catalog
+func (s *RBACStore) GetPermission(ctx context.Context, name string) (*rbac.Permission, error) {
+	doc, err := findOne[permissionDoc](ctx, s.permissions, roleFilter(ctx, name), rbac.ErrPermissionNotFound, name)
+	if err != nil {
+		return nil, err
+	}
+	return doc.permission(), nil
+}
+
+// DeletePermission removes a permission from the catalog and every role
+func (s *RBACStore) DeletePermission(ctx context.Context, name string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		result, err := s.permissions.DeleteOne(ctx, roleFilter(ctx, name))
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return fmt.Errorf("%w: %s", rbac.ErrPermissionNotFound, name)
+		}
+		_, err = s.roles.UpdateMany(ctx, bson.D{{Key: "tenant_id", Value: tenant}, {Key: "permissions", Value: name}},
+			bson.D{{Key: "$pull", Value: bson.D{{Key: "permissions", Value: name}}}})
+		return err
+	})
+}
+
+// ListPermissions returns a page of the catalog sorted by name, and the
+// total count
+func (s *RBACStore) ListPermissions(ctx context.Context, opts rbac.ListOptions) ([]*rbac.Permission, int, error) {
+	filter := where(bson.E{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}, search(opts.Search, "name"))
+	total, err := s.permissions.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	docs, err := findAll[permissionDoc](ctx, s.permissions, filter,
+		page(options.Find().SetSort(bson.D{{Key: "name", Value: 1}}), opts.Offset, opts.Limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	permissions := make([]*rbac.Permission, len(docs))
+	for i := range docs {
+		permissions[i] = docs[i].permission()
+	}
+	return permissions, int(total), nil
+}
+
+// GrantPermission grants a permission to a role
+func (s *RBACStore) GrantPermission(ctx context.Context, role, perm string) error {
+	result, err := s.roles.UpdateOne(ctx, roleFilter(ctx, role), bson.D{
+		{Key: "$addToSet", Value: bson.D{{Key: "permissions", Value: perm}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+	})
+	return matched(matchedCount(result), err, rbac.ErrRoleNotFound, role)
+}
+
+// RevokePermission revokes a permission from a role
+func (s *RBACStore) RevokePermission(ctx context.Context, role, perm string) error {
+	result, err := s.roles.UpdateOne(ctx, roleFilter(ctx, role), bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "permissions", Value: perm}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+	})
+	return matched(matchedCount(result), err, rbac.ErrRoleNotFound, role)
+}
+
+// RolePermissions returns the permissions of every role
+func (s *RBACStore) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	docs, err := findAll[roleDoc](ctx, s.roles, bson.D{{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}},
+		options.Find().SetProjection(bson.D{{Key: "name", Value: 1}, {Key: "permissions", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]string, len(docs))
+	for i := range docs {
+		result[docs[i].Name] = docs[i].role().Permissions
+	}
+	return result, nil
+}
+
+// AssignRole assigns a role to a subject
+func (s *RBACStore) AssignRole(ctx context.Context, subjectID, role string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	err := s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.roleExists(ctx, role); err != nil {
+			return err
+		}
+		_, err := s.subjectRoles.UpdateOne(ctx, bson.D{{Key: "tenant_id", Value: tenant}, {Key: "subject_id", Value: subjectID},
+			{Key: "role", Value: role}}, bson.D{{Key: "$setOnInsert", Value: bson.D{{Key: "created_at", Value: time.Now()}}}},
+			options.UpdateOne().SetUpsert(true))
+		return err
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent upsert assigned the role first
+		return nil
+	}
+	return err
+}
+
+// UnassignRole removes a role from a subject
+func (s *RBACStore) UnassignRole(ctx context.Context, subjectID, role string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.roleExists(ctx, role); err != nil {
+			return err
+		}
+		_, err := s.subjectRoles.DeleteOne(ctx, bson.D{{Key: "tenant_id", Value: tenant}, {Key: "subject_id", Value: subjectID},
+			{Key: "role", Value: role}})
+		return err
+	})
+}
+
+// ListSubjectRoles returns the roles of a subject, sorted
+func (s *RBACStore) ListSubjectRoles(ctx context.Context, subjectID string) ([]string, error) {
+	docs, err := findAll[subjectRoleDoc](ctx, s.subjectRoles, bson.D{{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)},
+		{Key: "subject_id", Value: subjectID}}, options.Find().SetSort(bson.D{{Key: "role", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]string, len(docs))
+	for i := range docs {
+		roles[i] = docs[i].Role
+	}
+	return roles, nil
+}
+
+// ListRoleSubjects returns a page of the subjects of a role sorted by ID,
+// and the total count
+func (s *RBACStore) ListRoleSubjects(ctx context.Context, role string, opts rbac.ListOptions) ([]string, int, error) {
+	if err := s.roleExists(ctx, role); err != nil {
+		return nil, 0, err
+	}
+
+	filter := where(bson.E{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}, bson.E{Key: "role", Value: role},
+		search(opts.Search, "subject_id"))
+	total, err := s.subjectRoles.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	docs, err := findAll[subjectRoleDoc](ctx, s.subjectRoles, filter,
+		page(options.Find().SetSort(bson.D{{Key: "subject_id", Value: 1}}), opts.Offset, opts.Limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	subjects := make([]string, len(docs))
+	for i := range docs {
+		subjects[i] = docs[i].SubjectID
+	}
+	return subjects, int(total), nil
+}
+
+// DeleteTenant removes the roles, permissions and assignments of a tenant
+func (s *RBACStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		for _, collection := range []*mongo.Collection{s.subjectRoles, s.roles, s.permissions} {
+			if _, err := collection.DeleteMany(ctx, bson.D{{Key: "tenant_id", Value: tenantID}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// roleExists returns rbac.ErrRoleNotFound when the role does not exist
+func (s *RBACStore) roleExists(ctx context.Context, role string) error {
+	found, err := exists(ctx, s.roles, roleFilter(ctx, role))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", rbac.ErrRoleNotFound, role)
+	}
+	return nil
+}
+
+// roleFilter selects a role or permission of the context tenant by name
+func roleFilter(ctx context.Context, name string) bson.D {
+	return bson.D{{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}, {Key: "name", Value: name}}
+}
+
+type roleDoc struct {
+	TenantID    string    `bson:"tenant_id"`
+	Name        string    `bson:"name"`
+	Description string    `bson:"description"`
+	Permissions []string  `bson:"permissions"`
+	CreatedAt   time.Time `bson:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+func (d *roleDoc) role() *rbac.Role {
+	permissions := slices.Clone(d.Permissions)
+	if permissions == nil {
+		permissions = []string{}
+	}
+	slices.Sort(permissions)
+	return &rbac.Role{Name: d.Name, Description: d.Description, Permissions: permissions, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt}
+}
+
+type permissionDoc struct {
+	TenantID    string    `bson:"tenant_id"`
+	Name        string    `bson:"name"`
+	Description string    `bson:"description"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
+
+func (d *permissionDoc) permission() *rbac.Permission {
+	return &rbac.Permission{Name: d.Name, Description: d.Description, CreatedAt: d.CreatedAt}
+}
+
+type subjectRoleDoc struct {
+	TenantID  string    `bson:"tenant_id"`
+	SubjectID string    `bson:"subject_id"`
+	Role      string    `bson:"role"`
+	CreatedAt time.Time `bson:"created_at"`
+}
@@ -0,0 +1,138 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/rebac"
+)
+
+// TupleStore stores relationship tuples (rebac.TupleStore), the ACLs of
+// relationship-based authorization. Tuples are partitioned per tenant (see
+// authz.WithTenant).
+type TupleStore struct {
+	tx     *transactions
+	tuples *mongo.Collection
+}
+
+var _ rebac.TupleStore = (*TupleStore)(nil)
+
+// NewTupleStore creates a tuple store on a collection (default:
+// "rebac_tuples"). Call Migrate to create the indexes.
+func NewTupleStore(db *mongo.Database, collection string) (*TupleStore, error) {
+	if collection == "" {
+		collection = "rebac_tuples"
+	}
+	if err := checkCollectionName(collection); err != nil {
+		return nil, err
+	}
+	return &TupleStore{tx: newTransactions(db), tuples: db.Collection(collection)}, nil
+}
+
+// Migrate creates the indexes of the tuple collection if they do not exist
+func (s *TupleStore) Migrate(ctx context.Context) error {
+	return migrate(ctx, s.tuples, []index{
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "object_type", Value: 1}, {Key: "object_id", Value: 1},
+			{Key: "relation", Value: 1}, {Key: "subject_type", Value: 1}, {Key: "subject_id", Value: 1},
+			{Key: "subject_relation", Value: 1}}, unique: true},
+		{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "subject_type", Value: 1}, {Key: "subject_id", Value: 1},
+			{Key: "subject_relation", Value: 1}}},
+	})
+}
+
+// Write stores tuples in one transaction where available
+func (s *TupleStore) Write(ctx context.Context, tuples ...rebac.Tuple) error {
+	now := time.Now()
+	return s.bulk(ctx, tuples, func(filter bson.D) mongo.WriteModel {
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpsert(true).
+			SetUpdate(bson.D{{Key: "$setOnInsert", Value: bson.D{{Key: "created_at", Value: now}}}})
+	})
+}
+
+// Delete removes tuples in one transaction where available
+func (s *TupleStore) Delete(ctx context.Context, tuples ...rebac.Tuple) error {
+	return s.bulk(ctx, tuples, func(filter bson.D) mongo.WriteModel {
+		return mongo.NewDeleteOneModel().SetFilter(filter)
+	})
+}
+
+// bulk runs a write for each tuple, given the filter selecting the tuple
+func (s *TupleStore) bulk(ctx context.Context, tuples []rebac.Tuple, model func(filter bson.D) mongo.WriteModel) error {
+	if len(tuples) == 0 {
+		return nil
+	}
+
+	partition := authz.PartitionFromContext(ctx)
+	models := make([]mongo.WriteModel, len(tuples))
+	for i, t := range tuples {
+		models[i] = model(bson.D{{Key: "tenant_id", Value: partition}, {Key: "object_type", Value: t.Object.Type},
+			{Key: "object_id", Value: t.Object.ID}, {Key: "relation", Value: t.Relation}, {Key: "subject_type", Value: t.Subject.Type},
+			{Key: "subject_id", Value: t.Subject.ID}, {Key: "subject_relation", Value: t.Subject.Relation}})
+	}
+	write := func(ctx context.Context) error {
+		_, err := s.tuples.BulkWrite(ctx, models)
+		return err
+	}
+	err := s.tx.run(ctx, write)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent upsert inserted a tuple first; it is matched now
+		err = s.tx.run(ctx, write)
+	}
+	return err
+}
+
+// Read returns the tuples matching a filter
+func (s *TupleStore) Read(ctx context.Context, filter rebac.TupleFilter) ([]rebac.Tuple, error) {
+	conditions := []bson.E{{Key: "tenant_id", Value: authz.PartitionFromContext(ctx)}}
+	for _, c := range []struct{ field, value string }{
+		{"object_type", filter.ObjectType},
+		{"object_id", filter.ObjectID},
+		{"relation", filter.Relation},
+		{"subject_type", filter.SubjectType},
+		{"subject_id", filter.SubjectID},
+		{"subject_relation", filter.SubjectRelation},
+	} {
+		if c.value != "" {
+			conditions = append(conditions, bson.E{Key: c.field, Value: c.value})
+		}
+	}
+
+	docs, err := findAll[tupleDoc](ctx, s.tuples, where(conditions...), options.Find().SetSort(bson.D{
+		{Key: "object_type", Value: 1}, {Key: "object_id", Value: 1}, {Key: "relation", Value: 1},
+		{Key: "subject_type", Value: 1}, {Key: "subject_id", Value: 1}, {Key: "subject_relation", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	tuples := make([]rebac.Tuple, len(docs))
+	for i, d := range docs {
+		tuples[i] = rebac.Tuple{
+			Object:   rebac.Object{Type: d.ObjectType, ID: d.ObjectID},
+			Relation: d.Relation,
+			Subject:  rebac.Subject{Type: d.SubjectType, ID: d.SubjectID, Relation: d.SubjectRelation},
+		}
+	}
+	return tuples, nil
+}
+
+// DeleteTenant removes every tuple of a tenant
+func (s *TupleStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	_, err := s.tuples.DeleteMany(ctx, bson.D{{Key: "tenant_id", Value: tenantID}})
+	return err
+}
+
+type tupleDoc struct {
+	TenantID        string    `bson:"tenant_id"`
+	ObjectType      string    `bson:"object_type"`
+	ObjectID        string    `bson:"object_id"`
+	Relation        string    `bson:"relation"`
+	SubjectType     string    `bson:"subject_type"`
+	SubjectID       string    `bson:"subject_id"`
+	SubjectRelation string    `bson:"subject_relation"`
+	CreatedAt       time.Time `bson:"created_at"`
+}
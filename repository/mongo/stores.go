@@ -0,0 +1,55 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Stores are the stores of a database, on their default collections
+type Stores struct {
+	DB       *mongo.Database
+	Tenants  *TenantStore
+	RBAC     *RBACStore
+	Policies *PolicyStore
+	Tuples   *TupleStore
+	APIKeys  *APIKeyStore
+}
+
+// NewStores creates every store on a database with the default collection
+// names. Call Migrate to create the indexes.
+//
+//	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://localhost:27017/?replicaSet=rs0"))
+//	stores, err := lokstramongo.NewStores(client.Database("auth"))
+func NewStores(db *mongo.Database) (*Stores, error) {
+	s := &Stores{DB: db}
+	var err error
+	if s.Tenants, err = NewTenantStore(db, ""); err != nil {
+		return nil, err
+	}
+	if s.RBAC, err = NewRBACStore(db, ""); err != nil {
+		return nil, err
+	}
+	if s.Policies, err = NewPolicyStore(db, ""); err != nil {
+		return nil, err
+	}
+	if s.Tuples, err = NewTupleStore(db, ""); err != nil {
+		return nil, err
+	}
+	if s.APIKeys, err = NewAPIKeyStore(db, ""); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Migrate creates the indexes of every store if they do not exist
+func (s *Stores) Migrate(ctx context.Context) error {
+	for _, store := range []interface{ Migrate(context.Context) error }{
+		s.Tenants, s.RBAC, s.Policies, s.Tuples, s.APIKeys,
+	} {
+		if err := store.Migrate(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
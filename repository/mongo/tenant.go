@@ -0,0 +1,850 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+// TenantStore stores tenants, apps, branches and users (tenant.TenantStore,
+// tenant.AppStore, tenant.BranchStore and tenant.UserStore) with the
+// semantics of tenant.InMemoryStore: deletes are soft, and apps and users
+// require a tenant that is not deleted, and branches an app that is not
+// deleted.
+type TenantStore struct {
+	tx       *transactions
+	tenants  *mongo.Collection
+	apps     *mongo.Collection
+	branches *mongo.Collection
+	users    *mongo.Collection
+}
+
+var (
+	_ tenant.TenantStore = (*TenantStore)(nil)
+	_ tenant.AppStore    = (*TenantStore)(nil)
+	_ tenant.BranchStore = (*TenantStore)(nil)
+	_ tenant.UserStore   = (*TenantStore)(nil)
+
+	_ tenant.UserAnonymizer = (*TenantStore)(nil)
+)
+
+// NewTenantStore creates a tenant store on collections named after a prefix
+// (default: "auth"): <prefix>_tenants, <prefix>_apps, <prefix>_branches and
+// <prefix>_users. Call Migrate to create the indexes.
+func NewTenantStore(db *mongo.Database, prefix string) (*TenantStore, error) {
+	if prefix == "" {
+		prefix = "auth"
+	}
+	if err := checkCollectionName(prefix); err != nil {
+		return nil, err
+	}
+	return &TenantStore{
+		tx:       newTransactions(db),
+		tenants:  db.Collection(prefix + "_tenants"),
+		apps:     db.Collection(prefix + "_apps"),
+		branches: db.Collection(prefix + "_branches"),
+		users:    db.Collection(prefix + "_users"),
+	}, nil
+}
+
+// Migrate creates the indexes of the tenant collections if they do not
+// exist. Names, usernames and emails are unique among documents that are not
+// deleted.
+func (s *TenantStore) Migrate(ctx context.Context) error {
+	live := bson.D{{Key: "deleted", Value: false}}
+	for _, c := range []struct {
+		collection *mongo.Collection
+		indexes    []index
+	}{
+		{s.tenants, []index{
+			{keys: bson.D{{Key: "id", Value: 1}}, unique: true},
+			{keys: bson.D{{Key: "name_key", Value: 1}}, unique: true, partial: live},
+		}},
+		{s.apps, []index{
+			{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "id", Value: 1}}, unique: true},
+			{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "name_key", Value: 1}}, unique: true, partial: live},
+		}},
+		{s.branches, []index{
+			{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "app_id", Value: 1}, {Key: "id", Value: 1}}, unique: true},
+			{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "app_id", Value: 1}, {Key: "name_key", Value: 1}}, unique: true, partial: live},
+		}},
+		{s.users, []index{
+			{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "id", Value: 1}}, unique: true},
+			{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "username_key", Value: 1}}, unique: true, partial: live},
+			{keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "email_key", Value: 1}}, unique: true,
+				partial: bson.D{{Key: "deleted", Value: false}, {Key: "email_key", Value: bson.D{{Key: "$gt", Value: ""}}}}},
+		}},
+	} {
+		if err := migrate(ctx, c.collection, c.indexes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateTenant creates a tenant
+func (s *TenantStore) CreateTenant(ctx context.Context, t *tenant.Tenant) error {
+	if t.ID == "" {
+		t.ID = tenant.NewID()
+	}
+	if err := tenant.ValidateID(t.ID); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(t.Metadata)
+	if err != nil {
+		return err
+	}
+
+	status := t.Status
+	if status == "" {
+		status = tenant.StatusActive
+	}
+	now := time.Now()
+	doc := &tenantDoc{ID: t.ID, Name: t.Name, NameKey: fold(t.Name), Status: string(status), Metadata: metadata,
+		CreatedAt: now, UpdatedAt: now}
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if found, err := exists(ctx, s.tenants, bson.D{{Key: "id", Value: t.ID}}); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("%w: %s", tenant.ErrTenantExists, t.ID)
+		}
+		if err := s.checkTenantName(ctx, t.ID, t.Name); err != nil {
+			return err
+		}
+		_, err := s.tenants.InsertOne(ctx, doc)
+		return duplicate(err, tenant.ErrTenantExists, t.ID)
+	})
+}
+
+// GetTenant returns a tenant that is not deleted
+func (s *TenantStore) GetTenant(ctx context.Context, tenantID string) (*tenant.Tenant, error) {
+	doc, err := findOne[tenantDoc](ctx, s.tenants, liveTenant(tenantID), tenant.ErrTenantNotFound, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return doc.tenant()
+}
+
+// UpdateTenant updates the name, status and metadata of a tenant
+func (s *TenantStore) UpdateTenant(ctx context.Context, t *tenant.Tenant) error {
+	metadata, err := encodeMetadata(t.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		doc, err := findOne[tenantDoc](ctx, s.tenants, liveTenant(t.ID), tenant.ErrTenantNotFound, t.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkTenantName(ctx, t.ID, t.Name); err != nil {
+			return err
+		}
+		doc.Name, doc.NameKey, doc.Metadata, doc.UpdatedAt = t.Name, fold(t.Name), metadata, time.Now()
+		if t.Status != "" {
+			doc.Status = string(t.Status)
+		}
+		_, err = s.tenants.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, doc)
+		return duplicate(err, tenant.ErrTenantExists, t.Name)
+	})
+}
+
+// DeleteTenant soft-deletes a tenant
+func (s *TenantStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	result, err := s.tenants.UpdateOne(ctx, liveTenant(tenantID), softDelete(time.Now()))
+	return matched(matchedCount(result), err, tenant.ErrTenantNotFound, tenantID)
+}
+
+// RestoreTenant restores a soft-deleted tenant
+func (s *TenantStore) RestoreTenant(ctx context.Context, tenantID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		doc, err := findOne[tenantDoc](ctx, s.tenants, bson.D{{Key: "id", Value: tenantID}}, tenant.ErrTenantNotFound, tenantID)
+		if err != nil {
+			return err
+		}
+		if !doc.Deleted {
+			return fmt.Errorf("%w: tenant %s", tenant.ErrNotDeleted, tenantID)
+		}
+		if err := s.checkTenantName(ctx, tenantID, doc.Name); err != nil {
+			return err
+		}
+		_, err = s.tenants.UpdateOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, restore(time.Now()))
+		return duplicate(err, tenant.ErrTenantExists, doc.Name)
+	})
+}
+
+// ListTenants returns a page of tenants sorted by ID, and the total count
+func (s *TenantStore) ListTenants(ctx context.Context, opts tenant.ListOptions) ([]*tenant.Tenant, int, error) {
+	return list(ctx, s.tenants, where(liveCondition(opts.IncludeDeleted), search(opts.Search, "id", "name")), opts,
+		(*tenantDoc).tenant)
+}
+
+// CreateApp creates an app
+func (s *TenantStore) CreateApp(ctx context.Context, app *tenant.App) error {
+	if app.ID == "" {
+		app.ID = tenant.NewID()
+	}
+	if err := tenant.ValidateID(app.ID); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(app.Metadata)
+	if err != nil {
+		return err
+	}
+
+	status := app.Status
+	if status == "" {
+		status = tenant.StatusActive
+	}
+	now := time.Now()
+	doc := &appDoc{TenantID: app.TenantID, ID: app.ID, Name: app.Name, NameKey: fold(app.Name), Status: string(status),
+		Metadata: metadata, CreatedAt: now, UpdatedAt: now}
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, app.TenantID); err != nil {
+			return err
+		}
+		if found, err := exists(ctx, s.apps, bson.D{{Key: "tenant_id", Value: app.TenantID}, {Key: "id", Value: app.ID}}); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("%w: %s", tenant.ErrAppExists, app.ID)
+		}
+		if err := s.checkAppName(ctx, app.TenantID, app.ID, app.Name); err != nil {
+			return err
+		}
+		_, err := s.apps.InsertOne(ctx, doc)
+		return duplicate(err, tenant.ErrAppExists, app.ID)
+	})
+}
+
+// GetApp returns an app that is not deleted
+func (s *TenantStore) GetApp(ctx context.Context, tenantID, appID string) (*tenant.App, error) {
+	if err := s.liveTenant(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	doc, err := findOne[appDoc](ctx, s.apps, liveApp(tenantID, appID), tenant.ErrAppNotFound, appID)
+	if err != nil {
+		return nil, err
+	}
+	return doc.app()
+}
+
+// UpdateApp updates the name, status and metadata of an app
+func (s *TenantStore) UpdateApp(ctx context.Context, app *tenant.App) error {
+	metadata, err := encodeMetadata(app.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, app.TenantID); err != nil {
+			return err
+		}
+		doc, err := findOne[appDoc](ctx, s.apps, liveApp(app.TenantID, app.ID), tenant.ErrAppNotFound, app.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkAppName(ctx, app.TenantID, app.ID, app.Name); err != nil {
+			return err
+		}
+		doc.Name, doc.NameKey, doc.Metadata, doc.UpdatedAt = app.Name, fold(app.Name), metadata, time.Now()
+		if app.Status != "" {
+			doc.Status = string(app.Status)
+		}
+		_, err = s.apps.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, doc)
+		return duplicate(err, tenant.ErrAppExists, app.Name)
+	})
+}
+
+// DeleteApp soft-deletes an app
+func (s *TenantStore) DeleteApp(ctx context.Context, tenantID, appID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, tenantID); err != nil {
+			return err
+		}
+		result, err := s.apps.UpdateOne(ctx, liveApp(tenantID, appID), softDelete(time.Now()))
+		return matched(matchedCount(result), err, tenant.ErrAppNotFound, appID)
+	})
+}
+
+// RestoreApp restores a soft-deleted app
+func (s *TenantStore) RestoreApp(ctx context.Context, tenantID, appID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, tenantID); err != nil {
+			return err
+		}
+		doc, err := findOne[appDoc](ctx, s.apps, bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "id", Value: appID}},
+			tenant.ErrAppNotFound, appID)
+		if err != nil {
+			return err
+		}
+		if !doc.Deleted {
+			return fmt.Errorf("%w: app %s", tenant.ErrNotDeleted, appID)
+		}
+		if err := s.checkAppName(ctx, tenantID, appID, doc.Name); err != nil {
+			return err
+		}
+		_, err = s.apps.UpdateOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, restore(time.Now()))
+		return duplicate(err, tenant.ErrAppExists, doc.Name)
+	})
+}
+
+// ListApps returns a page of the apps of a tenant sorted by ID, and the
+// total count
+func (s *TenantStore) ListApps(ctx context.Context, tenantID string, opts tenant.ListOptions) ([]*tenant.App, int, error) {
+	if err := s.liveTenant(ctx, tenantID); err != nil {
+		return nil, 0, err
+	}
+	return list(ctx, s.apps, where(bson.E{Key: "tenant_id", Value: tenantID}, liveCondition(opts.IncludeDeleted),
+		search(opts.Search, "id", "name")), opts, (*appDoc).app)
+}
+
+// CreateBranch creates a branch
+func (s *TenantStore) CreateBranch(ctx context.Context, branch *tenant.Branch) error {
+	if branch.ID == "" {
+		branch.ID = tenant.NewID()
+	}
+	if err := tenant.ValidateID(branch.ID); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(branch.Metadata)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	doc := &branchDoc{TenantID: branch.TenantID, AppID: branch.AppID, ID: branch.ID, Name: branch.Name, NameKey: fold(branch.Name),
+		Metadata: metadata, CreatedAt: now, UpdatedAt: now}
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveApp(ctx, branch.TenantID, branch.AppID); err != nil {
+			return err
+		}
+		if found, err := exists(ctx, s.branches, bson.D{{Key: "tenant_id", Value: branch.TenantID}, {Key: "app_id", Value: branch.AppID},
+			{Key: "id", Value: branch.ID}}); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("%w: %s", tenant.ErrBranchExists, branch.ID)
+		}
+		if err := s.checkBranchName(ctx, branch.TenantID, branch.AppID, branch.ID, branch.Name); err != nil {
+			return err
+		}
+		_, err := s.branches.InsertOne(ctx, doc)
+		return duplicate(err, tenant.ErrBranchExists, branch.ID)
+	})
+}
+
+// GetBranch returns a branch that is not deleted
+func (s *TenantStore) GetBranch(ctx context.Context, tenantID, appID, branchID string) (*tenant.Branch, error) {
+	if err := s.liveApp(ctx, tenantID, appID); err != nil {
+		return nil, err
+	}
+	doc, err := findOne[branchDoc](ctx, s.branches, liveBranch(tenantID, appID, branchID), tenant.ErrBranchNotFound, branchID)
+	if err != nil {
+		return nil, err
+	}
+	return doc.branch()
+}
+
+// UpdateBranch updates the name and metadata of a branch
+func (s *TenantStore) UpdateBranch(ctx context.Context, branch *tenant.Branch) error {
+	metadata, err := encodeMetadata(branch.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveApp(ctx, branch.TenantID, branch.AppID); err != nil {
+			return err
+		}
+		doc, err := findOne[branchDoc](ctx, s.branches, liveBranch(branch.TenantID, branch.AppID, branch.ID),
+			tenant.ErrBranchNotFound, branch.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkBranchName(ctx, branch.TenantID, branch.AppID, branch.ID, branch.Name); err != nil {
+			return err
+		}
+		doc.Name, doc.NameKey, doc.Metadata, doc.UpdatedAt = branch.Name, fold(branch.Name), metadata, time.Now()
+		_, err = s.branches.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, doc)
+		return duplicate(err, tenant.ErrBranchExists, branch.Name)
+	})
+}
+
+// DeleteBranch soft-deletes a branch
+func (s *TenantStore) DeleteBranch(ctx context.Context, tenantID, appID, branchID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveApp(ctx, tenantID, appID); err != nil {
+			return err
+		}
+		result, err := s.branches.UpdateOne(ctx, liveBranch(tenantID, appID, branchID), softDelete(time.Now()))
+		return matched(matchedCount(result), err, tenant.ErrBranchNotFound, branchID)
+	})
+}
+
+// RestoreBranch restores a soft-deleted branch
+func (s *TenantStore) RestoreBranch(ctx context.Context, tenantID, appID, branchID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveApp(ctx, tenantID, appID); err != nil {
+			return err
+		}
+		doc, err := findOne[branchDoc](ctx, s.branches, bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "app_id", Value: appID},
+			{Key: "id", Value: branchID}}, tenant.ErrBranchNotFound, branchID)
+		if err != nil {
+			return err
+		}
+		if !doc.Deleted {
+			return fmt.Errorf("%w: branch %s", tenant.ErrNotDeleted, branchID)
+		}
+		if err := s.checkBranchName(ctx, tenantID, appID, branchID, doc.Name); err != nil {
+			return err
+		}
+		_, err = s.branches.UpdateOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, restore(time.Now()))
+		return duplicate(err, tenant.ErrBranchExists, doc.Name)
+	})
+}
+
+// ListBranches returns a page of the branches of an app sorted by ID, and the
+// total count
+func (s *TenantStore) ListBranches(ctx context.Context, tenantID, appID string, opts tenant.ListOptions) ([]*tenant.Branch, int, error) {
+	if err := s.liveApp(ctx, tenantID, appID); err != nil {
+		return nil, 0, err
+	}
+	return list(ctx, s.branches, where(bson.E{Key: "tenant_id", Value: tenantID}, bson.E{Key: "app_id", Value: appID},
+		liveCondition(opts.IncludeDeleted), search(opts.Search, "id", "name")), opts, (*branchDoc).branch)
+}
+
+// CreateUser creates a user
+func (s *TenantStore) CreateUser(ctx context.Context, user *tenant.User) error {
+	if user.ID == "" {
+		user.ID = tenant.NewID()
+	}
+	if err := tenant.ValidateID(user.ID); err != nil {
+		return err
+	}
+	if err := user.NormalizeStatus(); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(user.Metadata)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	doc := &userDoc{TenantID: user.TenantID, ID: user.ID, Username: user.Username, UsernameKey: fold(user.Username),
+		Email: user.Email, EmailKey: fold(user.Email), PasswordHash: user.PasswordHash, Status: string(user.Status),
+		StatusReason: user.StatusReason, StatusChangedAt: user.StatusChangedAt, Disabled: user.Disabled,
+		Metadata: metadata, CreatedAt: now, UpdatedAt: now}
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, user.TenantID); err != nil {
+			return err
+		}
+		if found, err := exists(ctx, s.users, bson.D{{Key: "tenant_id", Value: user.TenantID}, {Key: "id", Value: user.ID}}); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("%w: %s", tenant.ErrUserExists, user.ID)
+		}
+		if err := s.checkUserIdentifiers(ctx, user.TenantID, user.ID, user.Username, user.Email); err != nil {
+			return err
+		}
+		_, err := s.users.InsertOne(ctx, doc)
+		return duplicate(err, tenant.ErrUserExists, user.ID)
+	})
+}
+
+// GetUser returns a user that is not deleted
+func (s *TenantStore) GetUser(ctx context.Context, tenantID, userID string) (*tenant.User, error) {
+	return s.getUser(ctx, tenantID, bson.E{Key: "id", Value: userID}, userID)
+}
+
+// GetUserByUsername returns a user that is not deleted by username
+func (s *TenantStore) GetUserByUsername(ctx context.Context, tenantID, username string) (*tenant.User, error) {
+	return s.getUser(ctx, tenantID, bson.E{Key: "username_key", Value: fold(username)}, fold(username))
+}
+
+// UpdateUser updates the username, email, password hash, status and
+// metadata of a user
+func (s *TenantStore) UpdateUser(ctx context.Context, user *tenant.User) error {
+	if err := user.NormalizeStatus(); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(user.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, user.TenantID); err != nil {
+			return err
+		}
+		doc, err := findOne[userDoc](ctx, s.users, liveUser(user.TenantID, bson.E{Key: "id", Value: user.ID}), tenant.ErrUserNotFound, user.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkUserIdentifiers(ctx, user.TenantID, user.ID, user.Username, user.Email); err != nil {
+			return err
+		}
+		doc.Username, doc.UsernameKey, doc.Email, doc.EmailKey = user.Username, fold(user.Username), user.Email, fold(user.Email)
+		doc.Status, doc.StatusReason, doc.StatusChangedAt = string(user.Status), user.StatusReason, user.StatusChangedAt
+		doc.PasswordHash, doc.Disabled, doc.Metadata, doc.UpdatedAt = user.PasswordHash, user.Disabled, metadata, time.Now()
+		_, err = s.users.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, doc)
+		return duplicate(err, tenant.ErrUserExists, user.Username)
+	})
+}
+
+// DeleteUser soft-deletes a user
+func (s *TenantStore) DeleteUser(ctx context.Context, tenantID, userID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, tenantID); err != nil {
+			return err
+		}
+		result, err := s.users.UpdateOne(ctx, liveUser(tenantID, bson.E{Key: "id", Value: userID}), softDelete(time.Now()))
+		return matched(matchedCount(result), err, tenant.ErrUserNotFound, userID)
+	})
+}
+
+// RestoreUser restores a soft-deleted user
+func (s *TenantStore) RestoreUser(ctx context.Context, tenantID, userID string) error {
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, tenantID); err != nil {
+			return err
+		}
+		doc, err := findOne[userDoc](ctx, s.users, bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "id", Value: userID}},
+			tenant.ErrUserNotFound, userID)
+		if err != nil {
+			return err
+		}
+		if !doc.Deleted {
+			return fmt.Errorf("%w: user %s", tenant.ErrNotDeleted, userID)
+		}
+		if err := s.checkUserIdentifiers(ctx, tenantID, userID, doc.Username, doc.Email); err != nil {
+			return err
+		}
+		_, err = s.users.UpdateOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, restore(time.Now()))
+		return duplicate(err, tenant.ErrUserExists, doc.Username)
+	})
+}
+
+// AnonymizeUser scrubs the personal data of a user and soft-deletes it
+// unless it is deleted already
+func (s *TenantStore) AnonymizeUser(ctx context.Context, tenantID, userID string) error {
+	user := &tenant.User{}
+	user.Anonymize()
+
+	return s.tx.run(ctx, func(ctx context.Context) error {
+		if err := s.liveTenant(ctx, tenantID); err != nil {
+			return err
+		}
+		doc, err := findOne[userDoc](ctx, s.users, bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "id", Value: userID}},
+			tenant.ErrUserNotFound, userID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		doc.Username, doc.UsernameKey, doc.Email, doc.EmailKey = user.Username, fold(user.Username), "", ""
+		doc.Status, doc.StatusReason, doc.StatusChangedAt = string(user.Status), user.StatusReason, user.StatusChangedAt
+		doc.PasswordHash, doc.Disabled, doc.Metadata, doc.UpdatedAt = "", true, nil, now
+		if !doc.Deleted {
+			doc.Deleted, doc.DeletedAt = true, &now
+		}
+		_, err = s.users.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ObjectID}}, doc)
+		return err
+	})
+}
+
+// ListUsers returns a page of the users of a tenant sorted by ID, and the
+// total count
+func (s *TenantStore) ListUsers(ctx context.Context, tenantID string, opts tenant.ListOptions) ([]*tenant.User, int, error) {
+	if err := s.liveTenant(ctx, tenantID); err != nil {
+		return nil, 0, err
+	}
+	return list(ctx, s.users, where(bson.E{Key: "tenant_id", Value: tenantID}, liveCondition(opts.IncludeDeleted),
+		search(opts.Search, "id", "username", "email")), opts, (*userDoc).user)
+}
+
+// getUser returns a live user of a live tenant matching a condition
+func (s *TenantStore) getUser(ctx context.Context, tenantID string, condition bson.E, name string) (*tenant.User, error) {
+	if err := s.liveTenant(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	doc, err := findOne[userDoc](ctx, s.users, liveUser(tenantID, condition), tenant.ErrUserNotFound, name)
+	if err != nil {
+		return nil, err
+	}
+	return doc.user()
+}
+
+// liveTenant returns tenant.ErrTenantNotFound unless the tenant exists and
+// is not deleted
+func (s *TenantStore) liveTenant(ctx context.Context, tenantID string) error {
+	found, err := exists(ctx, s.tenants, liveTenant(tenantID))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", tenant.ErrTenantNotFound, tenantID)
+	}
+	return nil
+}
+
+// liveApp returns a not found error unless the app and its tenant exist and
+// are not deleted
+func (s *TenantStore) liveApp(ctx context.Context, tenantID, appID string) error {
+	if err := s.liveTenant(ctx, tenantID); err != nil {
+		return err
+	}
+	found, err := exists(ctx, s.apps, liveApp(tenantID, appID))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", tenant.ErrAppNotFound, appID)
+	}
+	return nil
+}
+
+// checkTenantName checks that no other live tenant has the name
+func (s *TenantStore) checkTenantName(ctx context.Context, tenantID, name string) error {
+	found, err := exists(ctx, s.tenants, bson.D{{Key: "id", Value: bson.D{{Key: "$ne", Value: tenantID}}},
+		{Key: "name_key", Value: fold(name)}, {Key: "deleted", Value: false}})
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: name %q is taken", tenant.ErrTenantExists, name)
+	}
+	return nil
+}
+
+// checkAppName checks that no other live app of the tenant has the name
+func (s *TenantStore) checkAppName(ctx context.Context, tenantID, appID, name string) error {
+	found, err := exists(ctx, s.apps, bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "id", Value: bson.D{{Key: "$ne", Value: appID}}},
+		{Key: "name_key", Value: fold(name)}, {Key: "deleted", Value: false}})
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: name %q is taken", tenant.ErrAppExists, name)
+	}
+	return nil
+}
+
+// checkBranchName checks that no other live branch of the app has the name
+func (s *TenantStore) checkBranchName(ctx context.Context, tenantID, appID, branchID, name string) error {
+	found, err := exists(ctx, s.branches, bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "app_id", Value: appID},
+		{Key: "id", Value: bson.D{{Key: "$ne", Value: branchID}}}, {Key: "name_key", Value: fold(name)}, {Key: "deleted", Value: false}})
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: name %q is taken", tenant.ErrBranchExists, name)
+	}
+	return nil
+}
+
+// checkUserIdentifiers checks that no other live user of the tenant has the
+// username or email
+func (s *TenantStore) checkUserIdentifiers(ctx context.Context, tenantID, userID, username, email string) error {
+	other := func(field, value string) bson.D {
+		return bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "id", Value: bson.D{{Key: "$ne", Value: userID}}},
+			{Key: "deleted", Value: false}, {Key: field, Value: fold(value)}}
+	}
+
+	found, err := exists(ctx, s.users, other("username_key", username))
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: username %q is taken", tenant.ErrUserExists, username)
+	}
+
+	if email == "" {
+		return nil
+	}
+	found, err = exists(ctx, s.users, other("email_key", email))
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: email %q is taken", tenant.ErrUserExists, email)
+	}
+	return nil
+}
+
+func liveTenant(tenantID string) bson.D {
+	return bson.D{{Key: "id", Value: tenantID}, {Key: "deleted", Value: false}}
+}
+
+func liveApp(tenantID, appID string) bson.D {
+	return bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "id", Value: appID}, {Key: "deleted", Value: false}}
+}
+
+func liveBranch(tenantID, appID, branchID string) bson.D {
+	return bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "app_id", Value: appID}, {Key: "id", Value: branchID},
+		{Key: "deleted", Value: false}}
+}
+
+func liveUser(tenantID string, condition bson.E) bson.D {
+	return bson.D{{Key: "tenant_id", Value: tenantID}, condition, {Key: "deleted", Value: false}}
+}
+
+// liveCondition is the soft-delete condition of a list (none when deleted
+// documents are included)
+func liveCondition(includeDeleted bool) bson.E {
+	if includeDeleted {
+		return bson.E{}
+	}
+	return bson.E{Key: "deleted", Value: false}
+}
+
+// softDelete is the update marking a document deleted
+func softDelete(now time.Time) bson.D {
+	return bson.D{{Key: "$set", Value: bson.D{{Key: "deleted", Value: true}, {Key: "deleted_at", Value: now}, {Key: "updated_at", Value: now}}}}
+}
+
+// restore is the update clearing the deletion of a document
+func restore(now time.Time) bson.D {
+	return bson.D{{Key: "$set", Value: bson.D{{Key: "deleted", Value: false}, {Key: "deleted_at", Value: nil}, {Key: "updated_at", Value: now}}}}
+}
+
+func matchedCount(result *mongo.UpdateResult) int64 {
+	if result == nil {
+		return 0
+	}
+	return result.MatchedCount
+}
+
+// findOne decodes the document matching a filter, or returns notFound
+func findOne[T any](ctx context.Context, collection *mongo.Collection, filter bson.D, notFound error, name string) (*T, error) {
+	doc := new(T)
+	err := collection.FindOne(ctx, filter).Decode(doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", notFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// list returns a page of the documents matching a filter sorted by ID, and
+// the total count
+func list[D any, T any](ctx context.Context, collection *mongo.Collection, filter bson.D, opts tenant.ListOptions,
+	convert func(*D) (T, error)) ([]T, int, error) {
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	docs, err := findAll[D](ctx, collection, filter, page(options.Find().SetSort(bson.D{{Key: "id", Value: 1}}), opts.Offset, opts.Limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	items := make([]T, 0, len(docs))
+	for i := range docs {
+		item, err := convert(&docs[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, int(total), nil
+}
+
+// Documents of the tenant collections. ObjectID is the generated _id; the
+// records are keyed by their IDs, unique per parent.
+
+type tenantDoc struct {
+	ObjectID  bson.ObjectID `bson:"_id,omitempty"`
+	ID        string        `bson:"id"`
+	Name      string        `bson:"name"`
+	NameKey   string        `bson:"name_key"`
+	Status    string        `bson:"status"`
+	Metadata  bson.Raw      `bson:"metadata,omitempty"`
+	CreatedAt time.Time     `bson:"created_at"`
+	UpdatedAt time.Time     `bson:"updated_at"`
+	Deleted   bool          `bson:"deleted"`
+	DeletedAt *time.Time    `bson:"deleted_at"`
+}
+
+func (d *tenantDoc) tenant() (*tenant.Tenant, error) {
+	t := &tenant.Tenant{ID: d.ID, Name: d.Name, Status: tenant.Status(d.Status), CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt,
+		DeletedAt: d.DeletedAt}
+	return t, decodeMetadata(d.Metadata, &t.Metadata)
+}
+
+type appDoc struct {
+	ObjectID  bson.ObjectID `bson:"_id,omitempty"`
+	TenantID  string        `bson:"tenant_id"`
+	ID        string        `bson:"id"`
+	Name      string        `bson:"name"`
+	NameKey   string        `bson:"name_key"`
+	Status    string        `bson:"status"`
+	Metadata  bson.Raw      `bson:"metadata,omitempty"`
+	CreatedAt time.Time     `bson:"created_at"`
+	UpdatedAt time.Time     `bson:"updated_at"`
+	Deleted   bool          `bson:"deleted"`
+	DeletedAt *time.Time    `bson:"deleted_at"`
+}
+
+func (d *appDoc) app() (*tenant.App, error) {
+	app := &tenant.App{ID: d.ID, TenantID: d.TenantID, Name: d.Name, Status: tenant.Status(d.Status), CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt, DeletedAt: d.DeletedAt}
+	return app, decodeMetadata(d.Metadata, &app.Metadata)
+}
+
+type branchDoc struct {
+	ObjectID  bson.ObjectID `bson:"_id,omitempty"`
+	TenantID  string        `bson:"tenant_id"`
+	AppID     string        `bson:"app_id"`
+	ID        string        `bson:"id"`
+	Name      string        `bson:"name"`
+	NameKey   string        `bson:"name_key"`
+	Metadata  bson.Raw      `bson:"metadata,omitempty"`
+	CreatedAt time.Time     `bson:"created_at"`
+	UpdatedAt time.Time     `bson:"updated_at"`
+	Deleted   bool          `bson:"deleted"`
+	DeletedAt *time.Time    `bson:"deleted_at"`
+}
+
+func (d *branchDoc) branch() (*tenant.Branch, error) {
+	branch := &tenant.Branch{ID: d.ID, TenantID: d.TenantID, AppID: d.AppID, Name: d.Name, CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt, DeletedAt: d.DeletedAt}
+	return branch, decodeMetadata(d.Metadata, &branch.Metadata)
+}
+
+type userDoc struct {
+	ObjectID        bson.ObjectID `bson:"_id,omitempty"`
+	TenantID        string        `bson:"tenant_id"`
+	ID              string        `bson:"id"`
+	Username        string        `bson:"username"`
+	UsernameKey     string        `bson:"username_key"`
+	Email           string        `bson:"email"`
+	EmailKey        string        `bson:"email_key"`
+	PasswordHash    string        `bson:"password_hash"`
+	Status          string        `bson:"status"`
+	StatusReason    string        `bson:"status_reason"`
+	StatusChangedAt time.Time     `bson:"status_changed_at"`
+	Disabled        bool          `bson:"disabled"`
+	Metadata        bson.Raw      `bson:"metadata,omitempty"`
+	CreatedAt       time.Time     `bson:"created_at"`
+	UpdatedAt       time.Time     `bson:"updated_at"`
+	Deleted         bool          `bson:"deleted"`
+	DeletedAt       *time.Time    `bson:"deleted_at"`
+}
+
+func (d *userDoc) user() (*tenant.User, error) {
+	user := &tenant.User{ID: d.ID, TenantID: d.TenantID, Username: d.Username, Email: d.Email, PasswordHash: d.PasswordHash,
+		Status: tenant.UserStatus(d.Status), StatusReason: d.StatusReason, StatusChangedAt: d.StatusChangedAt,
+		Disabled: d.Disabled, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt, DeletedAt: d.DeletedAt}
+	return user, decodeMetadata(d.Metadata, &user.Metadata)
+}
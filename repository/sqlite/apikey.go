@@ -0,0 +1,174 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+)
+
+// APIKeyStore stores API keys (apikey.KeyStore and apikey.KeyLister)
+type APIKeyStore struct {
+	db    *sql.DB
+	table string
+}
+
+var (
+	_ apikey.KeyStore  = (*APIKeyStore)(nil)
+	_ apikey.KeyLister = (*APIKeyStore)(nil)
+)
+
+// NewAPIKeyStore creates an API key store on a table (default: "api_keys").
+// Call Migrate to create the table.
+func NewAPIKeyStore(db *sql.DB, table string) (*APIKeyStore, error) {
+	if table == "" {
+		table = "api_keys"
+	}
+	if err := checkTableName(table); err != nil {
+		return nil, err
+	}
+	return &APIKeyStore{db: db, table: table}, nil
+}
+
+// Migrate creates the API key table if it does not exist
+func (s *APIKeyStore) Migrate(ctx context.Context) error {
+	return migrate(ctx, s.db, s.table, []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id         TEXT NOT NULL PRIMARY KEY,
+	key_hash   TEXT NOT NULL UNIQUE,
+	prefix     TEXT NOT NULL DEFAULT '',
+	user_id    TEXT NOT NULL DEFAULT '',
+	name       TEXT NOT NULL DEFAULT '',
+	scopes     TEXT NOT NULL DEFAULT '[]',
+	metadata   TEXT,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER,
+	last_used  INTEGER,
+	revoked    INTEGER NOT NULL DEFAULT 0,
+	revoked_at INTEGER
+)`, s.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_prefix_idx ON %[1]s (prefix)`, s.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_user_idx ON %[1]s (user_id, created_at)`, s.table),
+	})
+}
+
+// GetByHash retrieves an API key by its hash
+func (s *APIKeyStore) GetByHash(ctx context.Context, hash string) (*apikey.APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE key_hash = ?1`, apiKeyColumns, s.table), hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// GetByPrefix retrieves all API keys with the given prefix
+func (s *APIKeyStore) GetByPrefix(ctx context.Context, prefix string) ([]*apikey.APIKey, error) {
+	return s.query(ctx, `prefix = ?1 ORDER BY created_at`, prefix)
+}
+
+// ListByUser returns the API keys of a user, oldest first
+func (s *APIKeyStore) ListByUser(ctx context.Context, userID string) ([]*apikey.APIKey, error) {
+	return s.query(ctx, `user_id = ?1 ORDER BY created_at`, userID)
+}
+
+// Store saves an API key, replacing the key with the same ID
+func (s *APIKeyStore) Store(ctx context.Context, key *apikey.APIKey) error {
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(key.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+	(id, key_hash, prefix, user_id, name, scopes, metadata, created_at, expires_at, last_used, revoked, revoked_at)
+	VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12)
+	ON CONFLICT (id) DO UPDATE SET key_hash = excluded.key_hash, prefix = excluded.prefix, user_id = excluded.user_id,
+		name = excluded.name, scopes = excluded.scopes, metadata = excluded.metadata, created_at = excluded.created_at,
+		expires_at = excluded.expires_at, last_used = excluded.last_used, revoked = excluded.revoked,
+		revoked_at = excluded.revoked_at`, s.table),
+		key.ID, key.KeyHash, key.Prefix, key.UserID, key.Name, string(scopes), metadata, unixNano(key.CreatedAt),
+		nullUnixNano(key.ExpiresAt), nullUnixNano(key.LastUsed), key.Revoked, nullUnixNano(key.RevokedAt))
+	return err
+}
+
+// UpdateLastUsed updates the last used timestamp
+func (s *APIKeyStore) UpdateLastUsed(ctx context.Context, keyID string, timestamp time.Time) error {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET last_used = ?2 WHERE id = ?1`, s.table), keyID, unixNano(timestamp))
+	return keyAffected(result, err)
+}
+
+// Revoke marks an API key as revoked
+func (s *APIKeyStore) Revoke(ctx context.Context, keyID string) error {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET revoked = 1, revoked_at = ?2 WHERE id = ?1`, s.table),
+		keyID, unixNano(time.Now()))
+	return keyAffected(result, err)
+}
+
+// Delete removes an API key
+func (s *APIKeyStore) Delete(ctx context.Context, keyID string) error {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?1`, s.table), keyID)
+	return keyAffected(result, err)
+}
+
+// query returns the keys matching a condition
+func (s *APIKeyStore) query(ctx context.Context, condition string, args ...any) ([]*apikey.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, apiKeyColumns, s.table, condition), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*apikey.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+const apiKeyColumns = `id, key_hash, prefix, user_id, name, scopes, metadata, created_at, expires_at, last_used, revoked, revoked_at`
+
+func scanAPIKey(row scanner) (*apikey.APIKey, error) {
+	key := &apikey.APIKey{}
+	var scopes string
+	var metadata sql.NullString
+	var createdAt int64
+	var expiresAt, lastUsed, revokedAt sql.NullInt64
+	if err := row.Scan(&key.ID, &key.KeyHash, &key.Prefix, &key.UserID, &key.Name, &scopes, &metadata,
+		&createdAt, &expiresAt, &lastUsed, &key.Revoked, &revokedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, fmt.Errorf("key %s: invalid scopes: %w", key.ID, err)
+	}
+	key.CreatedAt = fromUnixNano(createdAt)
+	key.ExpiresAt, key.LastUsed, key.RevokedAt = fromNullUnixNano(expiresAt), fromNullUnixNano(lastUsed), fromNullUnixNano(revokedAt)
+	return key, decodeMetadata(metadata, &key.Metadata)
+}
+
+// keyAffected returns apikey.ErrAPIKeyNotFound when a statement changed no
+// key
+func keyAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return apikey.ErrAPIKeyNotFound
+	}
+	return nil
+}
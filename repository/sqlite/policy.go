@@ -0,0 +1,327 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/policy"
+)
+
+// PolicyStore stores policies with their version history
+// (authz.VersionedPolicyStore). Policies are partitioned per tenant (see
+// authz.WithTenant).
+type PolicyStore struct {
+	db       *sql.DB
+	table    string
+	versions string
+}
+
+var _ authz.VersionedPolicyStore = (*PolicyStore)(nil)
+
+// NewPolicyStore creates a policy store on a table (default:
+// "authz_policies"); versions are kept in "<table>_versions". Call Migrate to
+// create the tables.
+func NewPolicyStore(db *sql.DB, table string) (*PolicyStore, error) {
+	if table == "" {
+		table = "authz_policies"
+	}
+	if err := checkTableName(table); err != nil {
+		return nil, err
+	}
+	return &PolicyStore{db: db, table: table, versions: table + "_versions"}, nil
+}
+
+// Migrate creates the policy and version tables if they do not exist
+func (s *PolicyStore) Migrate(ctx context.Context) error {
+	return migrate(ctx, s.db, s.table, []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	id          TEXT NOT NULL,
+	policy      TEXT NOT NULL,
+	version     INTEGER NOT NULL,
+	updated_at  INTEGER NOT NULL,
+	updated_by  TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (tenant_id, id)
+)`, s.table),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	policy_id   TEXT NOT NULL,
+	version     INTEGER NOT NULL,
+	operation   TEXT NOT NULL,
+	policy      TEXT NOT NULL,
+	author      TEXT NOT NULL DEFAULT '',
+	rollback_of INTEGER NOT NULL DEFAULT 0,
+	created_at  INTEGER NOT NULL,
+	PRIMARY KEY (tenant_id, policy_id, version)
+)`, s.versions),
+	})
+}
+
+// Create creates a new policy (version 1)
+func (s *PolicyStore) Create(ctx context.Context, p *authz.Policy) error {
+	_, err := s.change(ctx, p.ID, func(tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current != nil {
+			return nil, fmt.Errorf("%w: %s", policy.ErrPolicyExists, p.ID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyCreated, Policy: p}, nil
+	})
+	return err
+}
+
+// Get retrieves a policy by ID
+func (s *PolicyStore) Get(ctx context.Context, policyID string) (*authz.Policy, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT policy FROM %s WHERE tenant_id = ?1 AND id = ?2`, s.table),
+		authz.PartitionFromContext(ctx), policyID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", policy.ErrPolicyNotFound, policyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodePolicy(data)
+}
+
+// Update updates an existing policy, recording a new version
+func (s *PolicyStore) Update(ctx context.Context, p *authz.Policy) error {
+	_, err := s.change(ctx, p.ID, func(tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current == nil {
+			return nil, fmt.Errorf("%w: %s", policy.ErrPolicyNotFound, p.ID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyUpdated, Policy: p}, nil
+	})
+	return err
+}
+
+// Delete deletes a policy; its history is kept
+func (s *PolicyStore) Delete(ctx context.Context, policyID string) error {
+	_, err := s.change(ctx, policyID, func(tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error) {
+		if current == nil {
+			return nil, fmt.Errorf("%w: %s", policy.ErrPolicyNotFound, policyID)
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyDeleted, Policy: current}, nil
+	})
+	return err
+}
+
+// List lists all policies of the context tenant
+func (s *PolicyStore) List(ctx context.Context) ([]*authz.Policy, error) {
+	return s.query(ctx, `1`)
+}
+
+// FindBySubject finds policies for a subject
+func (s *PolicyStore) FindBySubject(ctx context.Context, subjectID string) ([]*authz.Policy, error) {
+	return s.query(ctx, `EXISTS (SELECT 1 FROM json_each(policy, '$.Subjects') WHERE value IN (?2, '*'))`, subjectID)
+}
+
+// FindByResource finds policies for a resource
+func (s *PolicyStore) FindByResource(ctx context.Context, resourceType string, resourceID string) ([]*authz.Policy, error) {
+	return s.query(ctx, `EXISTS (SELECT 1 FROM json_each(policy, '$.Resources') WHERE value IN (?2, ?3, '*'))`,
+		fmt.Sprintf("%s:%s", resourceType, resourceID), fmt.Sprintf("%s:*", resourceType))
+}
+
+// ListVersions returns the versions of a policy, oldest first
+func (s *PolicyStore) ListVersions(ctx context.Context, policyID string) ([]*authz.PolicyVersion, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT version, operation, policy, author, rollback_of, created_at
+	FROM %s WHERE tenant_id = ?1 AND policy_id = ?2 ORDER BY version`, s.versions),
+		authz.PartitionFromContext(ctx), policyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]*authz.PolicyVersion, 0)
+	for rows.Next() {
+		version, err := scanVersion(rows, policyID)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", policy.ErrPolicyNotFound, policyID)
+	}
+	return versions, nil
+}
+
+// GetVersion returns one version of a policy
+func (s *PolicyStore) GetVersion(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT version, operation, policy, author, rollback_of, created_at
+	FROM %s WHERE tenant_id = ?1 AND policy_id = ?2 AND version = ?3`, s.versions),
+		authz.PartitionFromContext(ctx), policyID, version)
+	result, err := scanVersion(row, policyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s v%d", authz.ErrVersionNotFound, policyID, version)
+	}
+	return result, err
+}
+
+// Rollback restores the content of a prior version as a new version, in one
+// transaction
+func (s *PolicyStore) Rollback(ctx context.Context, policyID string, version int) (*authz.PolicyVersion, error) {
+	return s.change(ctx, policyID, func(tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error) {
+		var data []byte
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT policy FROM %s WHERE tenant_id = ?1 AND policy_id = ?2 AND version = ?3`, s.versions),
+			authz.PartitionFromContext(ctx), policyID, version).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s v%d", authz.ErrVersionNotFound, policyID, version)
+		}
+		if err != nil {
+			return nil, err
+		}
+		restored, err := decodePolicy(data)
+		if err != nil {
+			return nil, err
+		}
+		return &authz.PolicyVersion{Operation: authz.PolicyRolledBack, Policy: restored, RollbackOf: version}, nil
+	})
+}
+
+// DeleteTenant removes every policy and version of a tenant
+func (s *PolicyStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		for _, table := range []string{s.table, s.versions} {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1`, table), tenantID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mutation decides the change of a policy given its current content (nil if
+// absent), as a version draft with Operation, Policy and RollbackOf
+type mutation func(tx *sql.Tx, current *authz.Policy) (*authz.PolicyVersion, error)
+
+// change applies a mutation and records its version in one transaction.
+// The transaction takes the write lock of the database before reading, so
+// concurrent changes are serialized.
+func (s *PolicyStore) change(ctx context.Context, policyID string, mutate mutation) (*authz.PolicyVersion, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// A write statement takes the write lock, even when it changes nothing
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET version = version WHERE 0`, s.table)); err != nil {
+		return nil, err
+	}
+
+	tenant := authz.PartitionFromContext(ctx)
+
+	var current *authz.Policy
+	var data []byte
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT policy FROM %s WHERE tenant_id = ?1 AND id = ?2`, s.table),
+		tenant, policyID).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, err
+	default:
+		if current, err = decodePolicy(data); err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := mutate(tx, current)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(version), 0) + 1 FROM %s WHERE tenant_id = ?1 AND policy_id = ?2`, s.versions),
+		tenant, policyID).Scan(&version.Version); err != nil {
+		return nil, err
+	}
+	version.PolicyID = policyID
+	version.Author = authz.ActorFromContext(ctx)
+	version.CreatedAt = time.Now()
+
+	data, err = json.Marshal(version.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy: %w", err)
+	}
+
+	if version.Operation == authz.PolicyDeleted {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1 AND id = ?2`, s.table), tenant, policyID)
+	} else {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, id, policy, version, updated_at, updated_by)
+	VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+	ON CONFLICT (tenant_id, id) DO UPDATE SET policy = excluded.policy, version = excluded.version,
+		updated_at = excluded.updated_at, updated_by = excluded.updated_by`, s.table),
+			tenant, policyID, string(data), version.Version, unixNano(version.CreatedAt), version.Author)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, policy_id, version, operation, policy, author, rollback_of, created_at)
+	VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)`, s.versions),
+		tenant, policyID, version.Version, string(version.Operation), string(data), version.Author, version.RollbackOf,
+		unixNano(version.CreatedAt)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// query returns the policies of the context tenant matching a condition
+// whose arguments start at ?2
+func (s *PolicyStore) query(ctx context.Context, condition string, args ...any) ([]*authz.Policy, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT policy FROM %s WHERE tenant_id = ?1 AND %s ORDER BY id`, s.table, condition),
+		append([]any{authz.PartitionFromContext(ctx)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make([]*authz.Policy, 0)
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		p, err := decodePolicy(data)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+func decodePolicy(data []byte) (*authz.Policy, error) {
+	p := &authz.Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %w", err)
+	}
+	return p, nil
+}
+
+func scanVersion(row interface{ Scan(...any) error }, policyID string) (*authz.PolicyVersion, error) {
+	version := &authz.PolicyVersion{PolicyID: policyID}
+	var operation string
+	var data []byte
+	var createdAt int64
+	if err := row.Scan(&version.Version, &operation, &data, &version.Author, &version.RollbackOf, &createdAt); err != nil {
+		return nil, err
+	}
+	version.Operation = authz.PolicyOperation(operation)
+	version.CreatedAt = fromUnixNano(createdAt)
+
+	p, err := decodePolicy(data)
+	if err != nil {
+		return nil, err
+	}
+	version.Policy = p
+	return version, nil
+}
@@ -0,0 +1,411 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+)
+
+// RBACStore stores roles, the permission catalog and role assignments
+// (rbac.Store). Data is partitioned per tenant (see authz.WithTenant).
+type RBACStore struct {
+	db              *sql.DB
+	roles           string
+	permissions     string
+	rolePermissions string
+	subjectRoles    string
+}
+
+var _ rbac.Store = (*RBACStore)(nil)
+
+// NewRBACStore creates an RBAC store on tables named after a prefix
+// (default: "rbac"): <prefix>_roles, <prefix>_permissions,
+// <prefix>_role_permissions and <prefix>_subject_roles. Call Migrate to
+// create the tables.
+func NewRBACStore(db *sql.DB, prefix string) (*RBACStore, error) {
+	if prefix == "" {
+		prefix = "rbac"
+	}
+	if err := checkTableName(prefix); err != nil {
+		return nil, err
+	}
+	return &RBACStore{
+		db:              db,
+		roles:           prefix + "_roles",
+		permissions:     prefix + "_permissions",
+		rolePermissions: prefix + "_role_permissions",
+		subjectRoles:    prefix + "_subject_roles",
+	}, nil
+}
+
+// Migrate creates the RBAC tables if they do not exist
+func (s *RBACStore) Migrate(ctx context.Context) error {
+	return migrate(ctx, s.db, s.roles, []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at  INTEGER NOT NULL,
+	updated_at  INTEGER NOT NULL,
+	PRIMARY KEY (tenant_id, name)
+)`, s.roles),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id   TEXT NOT NULL DEFAULT '',
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at  INTEGER NOT NULL,
+	PRIMARY KEY (tenant_id, name)
+)`, s.permissions),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	role       TEXT NOT NULL,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (tenant_id, role, permission),
+	FOREIGN KEY (tenant_id, role) REFERENCES %s (tenant_id, name) ON DELETE CASCADE
+)`, s.rolePermissions, s.roles),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id  TEXT NOT NULL DEFAULT '',
+	subject_id TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (tenant_id, subject_id, role),
+	FOREIGN KEY (tenant_id, role) REFERENCES %s (tenant_id, name) ON DELETE CASCADE
+)`, s.subjectRoles, s.roles),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_role_idx ON %[1]s (tenant_id, role)`, s.subjectRoles),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_permission_idx ON %[1]s (tenant_id, permission)`, s.rolePermissions),
+	})
+}
+
+// CreateRole creates a role
+func (s *RBACStore) CreateRole(ctx context.Context, role *rbac.Role) error {
+	if err := rbac.ValidateName(role.Name); err != nil {
+		return err
+	}
+
+	tenant := authz.PartitionFromContext(ctx)
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		now := unixNano(time.Now())
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, name, description, created_at, updated_at)
+VALUES (?1, ?2, ?3, ?4, ?4) ON CONFLICT (tenant_id, name) DO NOTHING`, s.roles), tenant, role.Name, role.Description, now)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("%w: %s", rbac.ErrRoleExists, role.Name)
+		}
+		permissions := slices.Clone(role.Permissions)
+		slices.Sort(permissions)
+		for _, perm := range slices.Compact(permissions) {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, role, permission) VALUES (?1, ?2, ?3)`,
+				s.rolePermissions), tenant, role.Name, perm); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRole returns a role with its permissions
+func (s *RBACStore) GetRole(ctx context.Context, name string) (*rbac.Role, error) {
+	tenant := authz.PartitionFromContext(ctx)
+
+	role := &rbac.Role{Name: name}
+	var createdAt, updatedAt int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT description, created_at, updated_at FROM %s WHERE tenant_id = ?1 AND name = ?2`, s.roles),
+		tenant, name).Scan(&role.Description, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", rbac.ErrRoleNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	role.CreatedAt, role.UpdatedAt = fromUnixNano(createdAt), fromUnixNano(updatedAt)
+
+	role.Permissions, err = queryStrings(ctx, s.db, fmt.Sprintf(`SELECT permission FROM %s WHERE tenant_id = ?1 AND role = ?2 ORDER BY permission`,
+		s.rolePermissions), tenant, name)
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRole updates the description of a role
+func (s *RBACStore) UpdateRole(ctx context.Context, role *rbac.Role) error {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET description = ?3, updated_at = ?4 WHERE tenant_id = ?1 AND name = ?2`, s.roles),
+		authz.PartitionFromContext(ctx), role.Name, role.Description, unixNano(time.Now()))
+	return rowsAffected(result, err, rbac.ErrRoleNotFound, role.Name)
+}
+
+// DeleteRole deletes a role, its permissions and its assignments
+func (s *RBACStore) DeleteRole(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1 AND name = ?2`, s.roles),
+		authz.PartitionFromContext(ctx), name)
+	return rowsAffected(result, err, rbac.ErrRoleNotFound, name)
+}
+
+// ListRoles returns a page of roles sorted by name, and the total count
+func (s *RBACStore) ListRoles(ctx context.Context, opts rbac.ListOptions) ([]*rbac.Role, int, error) {
+	tenant := authz.PartitionFromContext(ctx)
+	where := `tenant_id = ?1 AND ` + likeSearch("?2", "name")
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, s.roles, where),
+		tenant, opts.Search).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT name, description, created_at, updated_at FROM %s WHERE %s ORDER BY name%s`,
+		s.roles, where, pageClause(opts.Offset, opts.Limit)), tenant, opts.Search)
+	if err != nil {
+		return nil, 0, err
+	}
+	roles := make([]*rbac.Role, 0)
+	for rows.Next() {
+		role := &rbac.Role{}
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&role.Name, &role.Description, &createdAt, &updatedAt); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		role.CreatedAt, role.UpdatedAt = fromUnixNano(createdAt), fromUnixNano(updatedAt)
+		roles = append(roles, role)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Permissions are read once the role rows are closed: the pool may have
+	// a single connection
+	for _, role := range roles {
+		if role.Permissions, err = queryStrings(ctx, s.db, fmt.Sprintf(`SELECT permission FROM %s WHERE tenant_id = ?1 AND role = ?2 ORDER BY permission`,
+			s.rolePermissions), tenant, role.Name); err != nil {
+			return nil, 0, err
+		}
+	}
+	return roles, total, nil
+}
+
+// CreatePermission adds a permission to the catalog
+func (s *RBACStore) CreatePermission(ctx context.Context, perm *rbac.Permission) error {
+	if err := rbac.ValidateName(perm.Name); err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, name, description, created_at) VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT (tenant_id, name) DO NOTHING`, s.permissions), authz.PartitionFromContext(ctx), perm.Name, perm.Description, unixNano(time.Now()))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", rbac.ErrPermissionExists, perm.Name)
+	}
+	return nil
+}
+
+// GetPermission returns a permission of the catalog
+func (s *RBACStore) GetPermission(ctx context.Context, name string) (*rbac.Permission, error) {
+	perm := &rbac.Permission{Name: name}
+	var createdAt int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT description, created_at FROM %s WHERE tenant_id = ?1 AND name = ?2`, s.permissions),
+		authz.PartitionFromContext(ctx), name).Scan(&perm.Description, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", rbac.ErrPermissionNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	perm.CreatedAt = fromUnixNano(createdAt)
+	return perm, nil
+}
+
+// DeletePermission removes a permission from the catalog and every role
+func (s *RBACStore) DeletePermission(ctx context.Context, name string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1 AND name = ?2`, s.permissions), tenant, name)
+		if err := rowsAffected(result, err, rbac.ErrPermissionNotFound, name); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1 AND permission = ?2`, s.rolePermissions), tenant, name)
+		return err
+	})
+}
+
+// ListPermissions returns a page of the catalog sorted by name, and the
+// total count
+func (s *RBACStore) ListPermissions(ctx context.Context, opts rbac.ListOptions) ([]*rbac.Permission, int, error) {
+	tenant := authz.PartitionFromContext(ctx)
+	where := `tenant_id = ?1 AND ` + likeSearch("?2", "name")
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, s.permissions, where),
+		tenant, opts.Search).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT name, description, created_at FROM %s WHERE %s ORDER BY name%s`,
+		s.permissions, where, pageClause(opts.Offset, opts.Limit)), tenant, opts.Search)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	permissions := make([]*rbac.Permission, 0)
+	for rows.Next() {
+		perm := &rbac.Permission{}
+		var createdAt int64
+		if err := rows.Scan(&perm.Name, &perm.Description, &createdAt); err != nil {
+			return nil, 0, err
+		}
+		perm.CreatedAt = fromUnixNano(createdAt)
+		permissions = append(permissions, perm)
+	}
+	return permissions, total, rows.Err()
+}
+
+// GrantPermission grants a permission to a role
+func (s *RBACStore) GrantPermission(ctx context.Context, role, perm string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.touchRole(ctx, tx, tenant, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, role, permission) VALUES (?1, ?2, ?3)
+ON CONFLICT DO NOTHING`, s.rolePermissions), tenant, role, perm)
+		return err
+	})
+}
+
+// RevokePermission revokes a permission from a role
+func (s *RBACStore) RevokePermission(ctx context.Context, role, perm string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.touchRole(ctx, tx, tenant, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1 AND role = ?2 AND permission = ?3`,
+			s.rolePermissions), tenant, role, perm)
+		return err
+	})
+}
+
+// RolePermissions returns the permissions of every role
+func (s *RBACStore) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT r.name, p.permission FROM %s r
+LEFT JOIN %s p ON p.tenant_id = r.tenant_id AND p.role = r.name
+WHERE r.tenant_id = ?1 ORDER BY r.name, p.permission`, s.roles, s.rolePermissions), authz.PartitionFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string][]string)
+	for rows.Next() {
+		var role string
+		var perm sql.NullString
+		if err := rows.Scan(&role, &perm); err != nil {
+			return nil, err
+		}
+		if _, ok := result[role]; !ok {
+			result[role] = []string{}
+		}
+		if perm.Valid {
+			result[role] = append(result[role], perm.String)
+		}
+	}
+	return result, rows.Err()
+}
+
+// AssignRole assigns a role to a subject
+func (s *RBACStore) AssignRole(ctx context.Context, subjectID, role string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.roleExists(ctx, tx, tenant, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, subject_id, role, created_at) VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT DO NOTHING`, s.subjectRoles), tenant, subjectID, role, unixNano(time.Now()))
+		return err
+	})
+}
+
+// UnassignRole removes a role from a subject
+func (s *RBACStore) UnassignRole(ctx context.Context, subjectID, role string) error {
+	tenant := authz.PartitionFromContext(ctx)
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.roleExists(ctx, tx, tenant, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1 AND subject_id = ?2 AND role = ?3`,
+			s.subjectRoles), tenant, subjectID, role)
+		return err
+	})
+}
+
+// ListSubjectRoles returns the roles of a subject, sorted
+func (s *RBACStore) ListSubjectRoles(ctx context.Context, subjectID string) ([]string, error) {
+	return queryStrings(ctx, s.db, fmt.Sprintf(`SELECT role FROM %s WHERE tenant_id = ?1 AND subject_id = ?2 ORDER BY role`, s.subjectRoles),
+		authz.PartitionFromContext(ctx), subjectID)
+}
+
+// ListRoleSubjects returns a page of the subjects of a role sorted by ID,
+// and the total count
+func (s *RBACStore) ListRoleSubjects(ctx context.Context, role string, opts rbac.ListOptions) ([]string, int, error) {
+	tenant := authz.PartitionFromContext(ctx)
+	if err := s.roleExists(ctx, s.db, tenant, role); err != nil {
+		return nil, 0, err
+	}
+	where := `tenant_id = ?1 AND role = ?2 AND ` + likeSearch("?3", "subject_id")
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, s.subjectRoles, where),
+		tenant, role, opts.Search).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	subjects, err := queryStrings(ctx, s.db, fmt.Sprintf(`SELECT subject_id FROM %s WHERE %s ORDER BY subject_id%s`,
+		s.subjectRoles, where, pageClause(opts.Offset, opts.Limit)), tenant, role, opts.Search)
+	if err != nil {
+		return nil, 0, err
+	}
+	return subjects, total, nil
+}
+
+// DeleteTenant removes the roles, permissions and assignments of a tenant
+func (s *RBACStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		for _, table := range []string{s.subjectRoles, s.rolePermissions, s.roles, s.permissions} {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1`, table), tenantID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// roleExists returns rbac.ErrRoleNotFound when the role does not exist
+func (s *RBACStore) roleExists(ctx context.Context, q queryer, tenant, role string) error {
+	found, err := exists(ctx, q, fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND name = ?2`, s.roles), tenant, role)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", rbac.ErrRoleNotFound, role)
+	}
+	return nil
+}
+
+// touchRole updates the modification time of a role, taking the write lock
+// of the database until the transaction ends
+func (s *RBACStore) touchRole(ctx context.Context, tx *sql.Tx, tenant, role string) error {
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET updated_at = ?3 WHERE tenant_id = ?1 AND name = ?2`, s.roles),
+		tenant, role, unixNano(time.Now()))
+	return rowsAffected(result, err, rbac.ErrRoleNotFound, role)
+}
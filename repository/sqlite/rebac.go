@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/rebac"
+)
+
+// TupleStore stores relationship tuples (rebac.TupleStore). Tuples are
+// partitioned per tenant (see authz.WithTenant).
+type TupleStore struct {
+	db    *sql.DB
+	table string
+}
+
+var _ rebac.TupleStore = (*TupleStore)(nil)
+
+// NewTupleStore creates a tuple store on a table (default: "rebac_tuples").
+// Call Migrate to create the table.
+func NewTupleStore(db *sql.DB, table string) (*TupleStore, error) {
+	if table == "" {
+		table = "rebac_tuples"
+	}
+	if err := checkTableName(table); err != nil {
+		return nil, err
+	}
+	return &TupleStore{db: db, table: table}, nil
+}
+
+// Migrate creates the tuple table and its indexes if they do not exist
+func (s *TupleStore) Migrate(ctx context.Context) error {
+	return migrate(ctx, s.db, s.table, []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id        TEXT NOT NULL DEFAULT '',
+	object_type      TEXT NOT NULL,
+	object_id        TEXT NOT NULL,
+	relation         TEXT NOT NULL,
+	subject_type     TEXT NOT NULL,
+	subject_id       TEXT NOT NULL,
+	subject_relation TEXT NOT NULL DEFAULT '',
+	created_at       INTEGER NOT NULL,
+	PRIMARY KEY (tenant_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+)`, s.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_subject_idx ON %[1]s (tenant_id, subject_type, subject_id, subject_relation)`, s.table),
+	})
+}
+
+// Write stores tuples in one transaction
+func (s *TupleStore) Write(ctx context.Context, tuples ...rebac.Tuple) error {
+	query := fmt.Sprintf(`INSERT INTO %s
+	(tenant_id, object_type, object_id, relation, subject_type, subject_id, subject_relation, created_at)
+	VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+	ON CONFLICT DO NOTHING`, s.table)
+	return s.exec(ctx, query, tuples, unixNano(time.Now()))
+}
+
+// Delete removes tuples in one transaction
+func (s *TupleStore) Delete(ctx context.Context, tuples ...rebac.Tuple) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1 AND object_type = ?2 AND object_id = ?3
+	AND relation = ?4 AND subject_type = ?5 AND subject_id = ?6 AND subject_relation = ?7`, s.table)
+	return s.exec(ctx, query, tuples)
+}
+
+// exec runs a statement for each tuple, with the tuple columns as ?1-?7 and
+// extra arguments from ?8
+func (s *TupleStore) exec(ctx context.Context, query string, tuples []rebac.Tuple, extra ...any) error {
+	if len(tuples) == 0 {
+		return nil
+	}
+
+	partition := authz.PartitionFromContext(ctx)
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, t := range tuples {
+			args := append([]any{partition, t.Object.Type, t.Object.ID, t.Relation,
+				t.Subject.Type, t.Subject.ID, t.Subject.Relation}, extra...)
+			if _, err := stmt.ExecContext(ctx, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Read returns the tuples matching a filter
+func (s *TupleStore) Read(ctx context.Context, filter rebac.TupleFilter) ([]rebac.Tuple, error) {
+	conditions := []string{"tenant_id = ?1"}
+	args := []any{authz.PartitionFromContext(ctx)}
+
+	for _, c := range []struct{ column, value string }{
+		{"object_type", filter.ObjectType},
+		{"object_id", filter.ObjectID},
+		{"relation", filter.Relation},
+		{"subject_type", filter.SubjectType},
+		{"subject_id", filter.SubjectID},
+		{"subject_relation", filter.SubjectRelation},
+	} {
+		if c.value == "" {
+			continue
+		}
+		args = append(args, c.value)
+		conditions = append(conditions, fmt.Sprintf("%s = ?%d", c.column, len(args)))
+	}
+
+	query := fmt.Sprintf(`SELECT object_type, object_id, relation, subject_type, subject_id, subject_relation
+	FROM %s WHERE %s
+	ORDER BY object_type, object_id, relation, subject_type, subject_id, subject_relation`,
+		s.table, strings.Join(conditions, " AND "))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tuples := make([]rebac.Tuple, 0)
+	for rows.Next() {
+		var t rebac.Tuple
+		if err := rows.Scan(&t.Object.Type, &t.Object.ID, &t.Relation,
+			&t.Subject.Type, &t.Subject.ID, &t.Subject.Relation); err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, t)
+	}
+	return tuples, rows.Err()
+}
+
+// DeleteTenant removes every tuple of a tenant
+func (s *TupleStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = ?1`, s.table), tenantID)
+	return err
+}
@@ -0,0 +1,301 @@
+// Package sqlite implements the store contracts of lokstra-auth on SQLite, so
+// the runtime can run fully embedded (desktop apps, edge gateways, tests):
+// tenants, apps, branches and users (tenant), roles and permissions (rbac),
+// versioned policies (policy), relationship tuples (rebac) and API keys
+// (apikey).
+//
+// It works with any database/sql SQLite driver (modernc.org/sqlite,
+// github.com/mattn/go-sqlite3) of SQLite 3.38 or later (built-in JSON
+// functions); import the driver of your choice and pass its name to Open.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Config holds database configuration
+type Config struct {
+	// BusyTimeout is how long a connection waits for a lock held by another
+	// connection before failing (default: 5s)
+	BusyTimeout time.Duration
+
+	// MaxOpenConns is the size of the connection pool (default: 1). SQLite
+	// has a single writer: with more connections, reads run concurrently
+	// (WAL mode) but writes wait for each other up to BusyTimeout.
+	MaxOpenConns int
+
+	// Pragmas are further PRAGMA statements run on every connection, e.g.
+	// "synchronous = FULL"
+	Pragmas []string
+}
+
+// Open opens a SQLite database with a driver registered under driverName.
+// Every connection runs in WAL mode, with foreign keys enforced and
+// synchronous = NORMAL.
+//
+//	import _ "modernc.org/sqlite"
+//
+//	db, err := sqlite.Open("sqlite", "auth.db", nil)
+func Open(driverName, dsn string, config *Config) (*sql.DB, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.BusyTimeout <= 0 {
+		config.BusyTimeout = 5 * time.Second
+	}
+	if config.MaxOpenConns <= 0 {
+		config.MaxOpenConns = 1
+	}
+
+	probe, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := probe.Driver()
+	probe.Close()
+
+	pragmas := []string{
+		"journal_mode = WAL",
+		fmt.Sprintf("busy_timeout = %d", config.BusyTimeout.Milliseconds()),
+		"foreign_keys = ON",
+		"synchronous = NORMAL",
+	}
+	pragmas = append(pragmas, config.Pragmas...)
+
+	db := sql.OpenDB(&connector{dsn: dsn, driver: d, pragmas: pragmas})
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	return db, nil
+}
+
+// OpenMemory opens a private in-memory database, for tests. The database
+// lives as long as the returned *sql.DB: it has one connection that is
+// never closed while the DB is open.
+func OpenMemory(driverName string) (*sql.DB, error) {
+	db, err := Open(driverName, ":memory:", &Config{MaxOpenConns: 1})
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	return db, nil
+}
+
+// connector opens connections of a driver and runs the pragmas on each
+type connector struct {
+	dsn     string
+	driver  driver.Driver
+	pragmas []string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, pragma := range c.pragmas {
+		if err := execConn(ctx, conn, "PRAGMA "+pragma); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("PRAGMA %s: %w", pragma, err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// execConn runs a statement without arguments on a driver connection
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		return err
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if s, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = s.ExecContext(ctx, nil)
+	} else {
+		_, err = stmt.Exec(nil)
+	}
+	return err
+}
+
+// migrate runs the statements of a schema
+func migrate(ctx context.Context, db *sql.DB, name string, statements []string) error {
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// addColumns adds the columns missing from a table created by an earlier
+// schema (ALTER TABLE has no IF NOT EXISTS). Columns are name and
+// definition pairs.
+func addColumns(ctx context.Context, db *sql.DB, table string, columns [][2]string) error {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info(?1)`, table)
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", table, err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to migrate %s: %w", table, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", table, err)
+	}
+
+	for _, column := range columns {
+		if existing[column[0]] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column[0], column[1])); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// checkTableName validates a table name or prefix
+func checkTableName(name string) error {
+	if !tableNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid table name: %q", name)
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// exists runs a query selecting rows and reports whether there is one
+func exists(ctx context.Context, q queryer, query string, args ...any) (bool, error) {
+	var found bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS ("+query+")", args...).Scan(&found)
+	return found, err
+}
+
+// queryStrings runs a query returning one string column
+func queryStrings(ctx context.Context, q queryer, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// rowsAffected returns notFound when a statement changed no row
+func rowsAffected(result sql.Result, err error, notFound error, name string) error {
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", notFound, name)
+	}
+	return nil
+}
+
+// pageClause returns the LIMIT/OFFSET clause of a page (SQLite requires a
+// LIMIT with an OFFSET)
+func pageClause(offset, limit int) string {
+	switch {
+	case limit > 0 && offset > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	case offset > 0:
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+	}
+	return ""
+}
+
+// Times are stored as Unix nanoseconds, which every driver scans the same
+// way and which sort correctly
+
+func unixNano(t time.Time) int64 {
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	return time.Unix(0, n)
+}
+
+func nullUnixNano(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func fromNullUnixNano(n sql.NullInt64) *time.Time {
+	if !n.Valid {
+		return nil
+	}
+	t := time.Unix(0, n.Int64)
+	return &t
+}
+
+// fold normalizes a name, username or email for uniqueness checks
+func fold(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// likeSearch is the condition of a case-insensitive search of a parameter
+// in columns
+func likeSearch(param string, columns ...string) string {
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("%s LIKE '%%' || %s || '%%'", column, param)
+	}
+	return fmt.Sprintf("(%s = '' OR %s)", param, strings.Join(conditions, " OR "))
+}
@@ -0,0 +1,77 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Stores are the stores of a database, on their default tables
+type Stores struct {
+	DB       *sql.DB
+	Tenants  *TenantStore
+	RBAC     *RBACStore
+	Policies *PolicyStore
+	Tuples   *TupleStore
+	APIKeys  *APIKeyStore
+}
+
+// NewStores creates every store on a database with the default table names.
+// Call Migrate to create the tables.
+func NewStores(db *sql.DB) (*Stores, error) {
+	s := &Stores{DB: db}
+	var err error
+	if s.Tenants, err = NewTenantStore(db, ""); err != nil {
+		return nil, err
+	}
+	if s.RBAC, err = NewRBACStore(db, ""); err != nil {
+		return nil, err
+	}
+	if s.Policies, err = NewPolicyStore(db, ""); err != nil {
+		return nil, err
+	}
+	if s.Tuples, err = NewTupleStore(db, ""); err != nil {
+		return nil, err
+	}
+	if s.APIKeys, err = NewAPIKeyStore(db, ""); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Migrate creates the tables of every store if they do not exist
+func (s *Stores) Migrate(ctx context.Context) error {
+	for _, store := range []interface{ Migrate(context.Context) error }{
+		s.Tenants, s.RBAC, s.Policies, s.Tuples, s.APIKeys,
+	} {
+		if err := store.Migrate(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Stores) Close() error {
+	return s.DB.Close()
+}
+
+// NewMemoryStores opens a private in-memory database and creates every
+// store on it, migrated; for tests:
+//
+//	stores, err := sqlite.NewMemoryStores(ctx, "sqlite")
+//	defer stores.Close()
+func NewMemoryStores(ctx context.Context, driverName string) (*Stores, error) {
+	db, err := OpenMemory(driverName)
+	if err != nil {
+		return nil, err
+	}
+	stores, err := NewStores(db)
+	if err == nil {
+		err = stores.Migrate(ctx)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return stores, nil
+}
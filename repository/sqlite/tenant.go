@@ -0,0 +1,885 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+// TenantStore stores tenants, apps, branches and users (tenant.TenantStore,
+// tenant.AppStore, tenant.BranchStore and tenant.UserStore) with the
+// semantics of tenant.InMemoryStore: deletes are soft, and apps and users
+// require a tenant that is not deleted, and branches an app that is not
+// deleted.
+type TenantStore struct {
+	db       *sql.DB
+	tenants  string
+	apps     string
+	branches string
+	users    string
+}
+
+var (
+	_ tenant.TenantStore = (*TenantStore)(nil)
+	_ tenant.AppStore    = (*TenantStore)(nil)
+	_ tenant.BranchStore = (*TenantStore)(nil)
+	_ tenant.UserStore   = (*TenantStore)(nil)
+
+	_ tenant.UserAnonymizer = (*TenantStore)(nil)
+)
+
+// NewTenantStore creates a tenant store on tables named after a prefix
+// (default: "auth"): <prefix>_tenants, <prefix>_apps, <prefix>_branches and
+// <prefix>_users. Call Migrate to create the tables.
+func NewTenantStore(db *sql.DB, prefix string) (*TenantStore, error) {
+	if prefix == "" {
+		prefix = "auth"
+	}
+	if err := checkTableName(prefix); err != nil {
+		return nil, err
+	}
+	return &TenantStore{
+		db:       db,
+		tenants:  prefix + "_tenants",
+		apps:     prefix + "_apps",
+		branches: prefix + "_branches",
+		users:    prefix + "_users",
+	}, nil
+}
+
+// Migrate creates the tenant tables if they do not exist, and adds the
+// columns of user statuses to tables created without them. Names, usernames
+// and emails are unique among records that are not deleted.
+func (s *TenantStore) Migrate(ctx context.Context) error {
+	err := migrate(ctx, s.db, s.tenants, []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id         TEXT NOT NULL PRIMARY KEY,
+	name       TEXT NOT NULL,
+	name_key   TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	metadata   TEXT,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	deleted_at INTEGER
+)`, s.tenants),
+		fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_name_idx ON %[1]s (name_key) WHERE deleted_at IS NULL`, s.tenants),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id  TEXT NOT NULL,
+	id         TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	name_key   TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	metadata   TEXT,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	deleted_at INTEGER,
+	PRIMARY KEY (tenant_id, id)
+)`, s.apps),
+		fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_name_idx ON %[1]s (tenant_id, name_key) WHERE deleted_at IS NULL`, s.apps),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id  TEXT NOT NULL,
+	app_id     TEXT NOT NULL,
+	id         TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	name_key   TEXT NOT NULL,
+	metadata   TEXT,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	deleted_at INTEGER,
+	PRIMARY KEY (tenant_id, app_id, id)
+)`, s.branches),
+		fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_name_idx ON %[1]s (tenant_id, app_id, name_key) WHERE deleted_at IS NULL`, s.branches),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id         TEXT NOT NULL,
+	id                TEXT NOT NULL,
+	username          TEXT NOT NULL,
+	username_key      TEXT NOT NULL,
+	email             TEXT NOT NULL DEFAULT '',
+	email_key         TEXT NOT NULL DEFAULT '',
+	password_hash     TEXT NOT NULL DEFAULT '',
+	status            TEXT NOT NULL DEFAULT '',
+	status_reason     TEXT NOT NULL DEFAULT '',
+	status_changed_at INTEGER,
+	disabled          INTEGER NOT NULL DEFAULT 0,
+	metadata          TEXT,
+	created_at        INTEGER NOT NULL,
+	updated_at        INTEGER NOT NULL,
+	deleted_at        INTEGER,
+	PRIMARY KEY (tenant_id, id)
+)`, s.users),
+		fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_username_idx ON %[1]s (tenant_id, username_key) WHERE deleted_at IS NULL`, s.users),
+		fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_email_idx ON %[1]s (tenant_id, email_key) WHERE deleted_at IS NULL AND email_key <> ''`, s.users),
+	})
+	if err != nil {
+		return err
+	}
+	return addColumns(ctx, s.db, s.users, [][2]string{
+		{"status", "TEXT NOT NULL DEFAULT ''"},
+		{"status_reason", "TEXT NOT NULL DEFAULT ''"},
+		{"status_changed_at", "INTEGER"},
+	})
+}
+
+// CreateTenant creates a tenant
+func (s *TenantStore) CreateTenant(ctx context.Context, t *tenant.Tenant) error {
+	if t.ID == "" {
+		t.ID = tenant.NewID()
+	}
+	if err := tenant.ValidateID(t.ID); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(t.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, fmt.Sprintf(`SELECT 1 FROM %s WHERE id = ?1`, s.tenants), t.ID); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("%w: %s", tenant.ErrTenantExists, t.ID)
+		}
+		if err := s.checkTenantName(ctx, tx, t.ID, t.Name); err != nil {
+			return err
+		}
+
+		status := t.Status
+		if status == "" {
+			status = tenant.StatusActive
+		}
+		now := unixNano(time.Now())
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, name, name_key, status, metadata, created_at, updated_at)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?6)`, s.tenants), t.ID, t.Name, fold(t.Name), string(status), metadata, now)
+		return err
+	})
+}
+
+// GetTenant returns a tenant that is not deleted
+func (s *TenantStore) GetTenant(ctx context.Context, tenantID string) (*tenant.Tenant, error) {
+	t, err := scanTenant(s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE id = ?1 AND deleted_at IS NULL`,
+		tenantColumns, s.tenants), tenantID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", tenant.ErrTenantNotFound, tenantID)
+	}
+	return t, err
+}
+
+// UpdateTenant updates the name, status and metadata of a tenant
+func (s *TenantStore) UpdateTenant(ctx context.Context, t *tenant.Tenant) error {
+	metadata, err := encodeMetadata(t.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveTenant(ctx, tx, t.ID); err != nil {
+			return err
+		}
+		if err := s.checkTenantName(ctx, tx, t.ID, t.Name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET name = ?2, name_key = ?3,
+	status = CASE WHEN ?4 = '' THEN status ELSE ?4 END, metadata = ?5, updated_at = ?6 WHERE id = ?1`, s.tenants),
+			t.ID, t.Name, fold(t.Name), string(t.Status), metadata, unixNano(time.Now()))
+		return err
+	})
+}
+
+// DeleteTenant soft-deletes a tenant
+func (s *TenantStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	now := unixNano(time.Now())
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = ?2, updated_at = ?2 WHERE id = ?1 AND deleted_at IS NULL`, s.tenants),
+		tenantID, now)
+	return rowsAffected(result, err, tenant.ErrTenantNotFound, tenantID)
+}
+
+// RestoreTenant restores a soft-deleted tenant
+func (s *TenantStore) RestoreTenant(ctx context.Context, tenantID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		var name string
+		var deletedAt sql.NullInt64
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT name, deleted_at FROM %s WHERE id = ?1`, s.tenants), tenantID).Scan(&name, &deletedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", tenant.ErrTenantNotFound, tenantID)
+		}
+		if err != nil {
+			return err
+		}
+		if !deletedAt.Valid {
+			return fmt.Errorf("%w: tenant %s", tenant.ErrNotDeleted, tenantID)
+		}
+		if err := s.checkTenantName(ctx, tx, tenantID, name); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = NULL, updated_at = ?2 WHERE id = ?1`, s.tenants),
+			tenantID, unixNano(time.Now()))
+		return err
+	})
+}
+
+// ListTenants returns a page of tenants sorted by ID, and the total count
+func (s *TenantStore) ListTenants(ctx context.Context, opts tenant.ListOptions) ([]*tenant.Tenant, int, error) {
+	where := liveCondition("?1") + ` AND ` + likeSearch("?2", "id", "name")
+	return list(ctx, s.db, s.tenants, tenantColumns, where, opts, scanTenant, opts.IncludeDeleted, opts.Search)
+}
+
+// CreateApp creates an app
+func (s *TenantStore) CreateApp(ctx context.Context, app *tenant.App) error {
+	if app.ID == "" {
+		app.ID = tenant.NewID()
+	}
+	if err := tenant.ValidateID(app.ID); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(app.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveTenant(ctx, tx, app.TenantID); err != nil {
+			return err
+		}
+		if found, err := exists(ctx, tx, fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND id = ?2`, s.apps),
+			app.TenantID, app.ID); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("%w: %s", tenant.ErrAppExists, app.ID)
+		}
+		if err := s.checkAppName(ctx, tx, app.TenantID, app.ID, app.Name); err != nil {
+			return err
+		}
+
+		status := app.Status
+		if status == "" {
+			status = tenant.StatusActive
+		}
+		now := unixNano(time.Now())
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, id, name, name_key, status, metadata, created_at, updated_at)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?7)`, s.apps), app.TenantID, app.ID, app.Name, fold(app.Name), string(status), metadata, now)
+		return err
+	})
+}
+
+// GetApp returns an app that is not deleted
+func (s *TenantStore) GetApp(ctx context.Context, tenantID, appID string) (*tenant.App, error) {
+	if err := s.liveTenant(ctx, s.db, tenantID); err != nil {
+		return nil, err
+	}
+	app, err := scanApp(s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE tenant_id = ?1 AND id = ?2 AND deleted_at IS NULL`,
+		appColumns, s.apps), tenantID, appID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", tenant.ErrAppNotFound, appID)
+	}
+	return app, err
+}
+
+// UpdateApp updates the name, status and metadata of an app
+func (s *TenantStore) UpdateApp(ctx context.Context, app *tenant.App) error {
+	metadata, err := encodeMetadata(app.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveApp(ctx, tx, app.TenantID, app.ID); err != nil {
+			return err
+		}
+		if err := s.checkAppName(ctx, tx, app.TenantID, app.ID, app.Name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET name = ?3, name_key = ?4,
+	status = CASE WHEN ?5 = '' THEN status ELSE ?5 END, metadata = ?6, updated_at = ?7 WHERE tenant_id = ?1 AND id = ?2`, s.apps),
+			app.TenantID, app.ID, app.Name, fold(app.Name), string(app.Status), metadata, unixNano(time.Now()))
+		return err
+	})
+}
+
+// DeleteApp soft-deletes an app
+func (s *TenantStore) DeleteApp(ctx context.Context, tenantID, appID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveApp(ctx, tx, tenantID, appID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = ?3, updated_at = ?3 WHERE tenant_id = ?1 AND id = ?2`, s.apps),
+			tenantID, appID, unixNano(time.Now()))
+		return err
+	})
+}
+
+// RestoreApp restores a soft-deleted app
+func (s *TenantStore) RestoreApp(ctx context.Context, tenantID, appID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveTenant(ctx, tx, tenantID); err != nil {
+			return err
+		}
+		var name string
+		var deletedAt sql.NullInt64
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT name, deleted_at FROM %s WHERE tenant_id = ?1 AND id = ?2`, s.apps),
+			tenantID, appID).Scan(&name, &deletedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", tenant.ErrAppNotFound, appID)
+		}
+		if err != nil {
+			return err
+		}
+		if !deletedAt.Valid {
+			return fmt.Errorf("%w: app %s", tenant.ErrNotDeleted, appID)
+		}
+		if err := s.checkAppName(ctx, tx, tenantID, appID, name); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = NULL, updated_at = ?3 WHERE tenant_id = ?1 AND id = ?2`, s.apps),
+			tenantID, appID, unixNano(time.Now()))
+		return err
+	})
+}
+
+// ListApps returns a page of the apps of a tenant sorted by ID, and the
+// total count
+func (s *TenantStore) ListApps(ctx context.Context, tenantID string, opts tenant.ListOptions) ([]*tenant.App, int, error) {
+	if err := s.liveTenant(ctx, s.db, tenantID); err != nil {
+		return nil, 0, err
+	}
+	where := `tenant_id = ?3 AND ` + liveCondition("?1") + ` AND ` + likeSearch("?2", "id", "name")
+	return list(ctx, s.db, s.apps, appColumns, where, opts, scanApp, opts.IncludeDeleted, opts.Search, tenantID)
+}
+
+// CreateBranch creates a branch
+func (s *TenantStore) CreateBranch(ctx context.Context, branch *tenant.Branch) error {
+	if branch.ID == "" {
+		branch.ID = tenant.NewID()
+	}
+	if err := tenant.ValidateID(branch.ID); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(branch.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveApp(ctx, tx, branch.TenantID, branch.AppID); err != nil {
+			return err
+		}
+		if found, err := exists(ctx, tx, fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND app_id = ?2 AND id = ?3`, s.branches),
+			branch.TenantID, branch.AppID, branch.ID); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("%w: %s", tenant.ErrBranchExists, branch.ID)
+		}
+		if err := s.checkBranchName(ctx, tx, branch.TenantID, branch.AppID, branch.ID, branch.Name); err != nil {
+			return err
+		}
+
+		now := unixNano(time.Now())
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (tenant_id, app_id, id, name, name_key, metadata, created_at, updated_at)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?7)`, s.branches),
+			branch.TenantID, branch.AppID, branch.ID, branch.Name, fold(branch.Name), metadata, now)
+		return err
+	})
+}
+
+// GetBranch returns a branch that is not deleted
+func (s *TenantStore) GetBranch(ctx context.Context, tenantID, appID, branchID string) (*tenant.Branch, error) {
+	if err := s.liveApp(ctx, s.db, tenantID, appID); err != nil {
+		return nil, err
+	}
+	branch, err := scanBranch(s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s
+	WHERE tenant_id = ?1 AND app_id = ?2 AND id = ?3 AND deleted_at IS NULL`, branchColumns, s.branches), tenantID, appID, branchID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", tenant.ErrBranchNotFound, branchID)
+	}
+	return branch, err
+}
+
+// UpdateBranch updates the name and metadata of a branch
+func (s *TenantStore) UpdateBranch(ctx context.Context, branch *tenant.Branch) error {
+	metadata, err := encodeMetadata(branch.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveBranch(ctx, tx, branch.TenantID, branch.AppID, branch.ID); err != nil {
+			return err
+		}
+		if err := s.checkBranchName(ctx, tx, branch.TenantID, branch.AppID, branch.ID, branch.Name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET name = ?4, name_key = ?5, metadata = ?6, updated_at = ?7
+	WHERE tenant_id = ?1 AND app_id = ?2 AND id = ?3`, s.branches),
+			branch.TenantID, branch.AppID, branch.ID, branch.Name, fold(branch.Name), metadata, unixNano(time.Now()))
+		return err
+	})
+}
+
+// DeleteBranch soft-deletes a branch
+func (s *TenantStore) DeleteBranch(ctx context.Context, tenantID, appID, branchID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveBranch(ctx, tx, tenantID, appID, branchID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = ?4, updated_at = ?4
+	WHERE tenant_id = ?1 AND app_id = ?2 AND id = ?3`, s.branches), tenantID, appID, branchID, unixNano(time.Now()))
+		return err
+	})
+}
+
+// RestoreBranch restores a soft-deleted branch
+func (s *TenantStore) RestoreBranch(ctx context.Context, tenantID, appID, branchID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveApp(ctx, tx, tenantID, appID); err != nil {
+			return err
+		}
+		var name string
+		var deletedAt sql.NullInt64
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT name, deleted_at FROM %s WHERE tenant_id = ?1 AND app_id = ?2 AND id = ?3`, s.branches),
+			tenantID, appID, branchID).Scan(&name, &deletedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", tenant.ErrBranchNotFound, branchID)
+		}
+		if err != nil {
+			return err
+		}
+		if !deletedAt.Valid {
+			return fmt.Errorf("%w: branch %s", tenant.ErrNotDeleted, branchID)
+		}
+		if err := s.checkBranchName(ctx, tx, tenantID, appID, branchID, name); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = NULL, updated_at = ?4
+	WHERE tenant_id = ?1 AND app_id = ?2 AND id = ?3`, s.branches), tenantID, appID, branchID, unixNano(time.Now()))
+		return err
+	})
+}
+
+// ListBranches returns a page of the branches of an app sorted by ID, and the
+// total count
+func (s *TenantStore) ListBranches(ctx context.Context, tenantID, appID string, opts tenant.ListOptions) ([]*tenant.Branch, int, error) {
+	if err := s.liveApp(ctx, s.db, tenantID, appID); err != nil {
+		return nil, 0, err
+	}
+	where := `tenant_id = ?3 AND app_id = ?4 AND ` + liveCondition("?1") + ` AND ` + likeSearch("?2", "id", "name")
+	return list(ctx, s.db, s.branches, branchColumns, where, opts, scanBranch, opts.IncludeDeleted, opts.Search, tenantID, appID)
+}
+
+// CreateUser creates a user
+func (s *TenantStore) CreateUser(ctx context.Context, user *tenant.User) error {
+	if user.ID == "" {
+		user.ID = tenant.NewID()
+	}
+	if err := tenant.ValidateID(user.ID); err != nil {
+		return err
+	}
+	if err := user.NormalizeStatus(); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(user.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveTenant(ctx, tx, user.TenantID); err != nil {
+			return err
+		}
+		if found, err := exists(ctx, tx, fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND id = ?2`, s.users),
+			user.TenantID, user.ID); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("%w: %s", tenant.ErrUserExists, user.ID)
+		}
+		if err := s.checkUserIdentifiers(ctx, tx, user.TenantID, user.ID, user.Username, user.Email); err != nil {
+			return err
+		}
+
+		now := unixNano(time.Now())
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+	(tenant_id, id, username, username_key, email, email_key, password_hash, status, status_reason, status_changed_at,
+	disabled, metadata, created_at, updated_at)
+	VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?13)`, s.users),
+			user.TenantID, user.ID, user.Username, fold(user.Username), user.Email, fold(user.Email),
+			user.PasswordHash, user.Status, user.StatusReason, unixNano(user.StatusChangedAt), user.Disabled, metadata, now)
+		return err
+	})
+}
+
+// GetUser returns a user that is not deleted
+func (s *TenantStore) GetUser(ctx context.Context, tenantID, userID string) (*tenant.User, error) {
+	return s.getUser(ctx, tenantID, "id = ?2", userID)
+}
+
+// GetUserByUsername returns a user that is not deleted by username
+func (s *TenantStore) GetUserByUsername(ctx context.Context, tenantID, username string) (*tenant.User, error) {
+	return s.getUser(ctx, tenantID, "username_key = ?2", fold(username))
+}
+
+// UpdateUser updates the username, email, password hash, status and
+// metadata of a user
+func (s *TenantStore) UpdateUser(ctx context.Context, user *tenant.User) error {
+	if err := user.NormalizeStatus(); err != nil {
+		return err
+	}
+	metadata, err := encodeMetadata(user.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveUser(ctx, tx, user.TenantID, user.ID); err != nil {
+			return err
+		}
+		if err := s.checkUserIdentifiers(ctx, tx, user.TenantID, user.ID, user.Username, user.Email); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET username = ?3, username_key = ?4, email = ?5, email_key = ?6,
+	password_hash = ?7, status = ?8, status_reason = ?9, status_changed_at = ?10, disabled = ?11, metadata = ?12,
+	updated_at = ?13 WHERE tenant_id = ?1 AND id = ?2`, s.users),
+			user.TenantID, user.ID, user.Username, fold(user.Username), user.Email, fold(user.Email),
+			user.PasswordHash, user.Status, user.StatusReason, unixNano(user.StatusChangedAt), user.Disabled, metadata,
+			unixNano(time.Now()))
+		return err
+	})
+}
+
+// DeleteUser soft-deletes a user
+func (s *TenantStore) DeleteUser(ctx context.Context, tenantID, userID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveUser(ctx, tx, tenantID, userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = ?3, updated_at = ?3 WHERE tenant_id = ?1 AND id = ?2`, s.users),
+			tenantID, userID, unixNano(time.Now()))
+		return err
+	})
+}
+
+// RestoreUser restores a soft-deleted user
+func (s *TenantStore) RestoreUser(ctx context.Context, tenantID, userID string) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveTenant(ctx, tx, tenantID); err != nil {
+			return err
+		}
+		var username, email string
+		var deletedAt sql.NullInt64
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT username, email, deleted_at FROM %s WHERE tenant_id = ?1 AND id = ?2`, s.users),
+			tenantID, userID).Scan(&username, &email, &deletedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", tenant.ErrUserNotFound, userID)
+		}
+		if err != nil {
+			return err
+		}
+		if !deletedAt.Valid {
+			return fmt.Errorf("%w: user %s", tenant.ErrNotDeleted, userID)
+		}
+		if err := s.checkUserIdentifiers(ctx, tx, tenantID, userID, username, email); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = NULL, updated_at = ?3 WHERE tenant_id = ?1 AND id = ?2`, s.users),
+			tenantID, userID, unixNano(time.Now()))
+		return err
+	})
+}
+
+// AnonymizeUser scrubs the personal data of a user and soft-deletes it
+// unless it is deleted already
+func (s *TenantStore) AnonymizeUser(ctx context.Context, tenantID, userID string) error {
+	user := &tenant.User{}
+	user.Anonymize()
+	now := unixNano(time.Now())
+
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.liveTenant(ctx, tx, tenantID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET username = ?3, username_key = ?4, email = '', email_key = '',
+	password_hash = '', status = ?5, status_reason = ?6, status_changed_at = ?7, disabled = 1, metadata = NULL,
+	deleted_at = COALESCE(deleted_at, ?7), updated_at = ?7 WHERE tenant_id = ?1 AND id = ?2`, s.users),
+			tenantID, userID, user.Username, fold(user.Username), user.Status, user.StatusReason, now)
+		return rowsAffected(result, err, tenant.ErrUserNotFound, userID)
+	})
+}
+
+// ListUsers returns a page of the users of a tenant sorted by ID, and the
+// total count
+func (s *TenantStore) ListUsers(ctx context.Context, tenantID string, opts tenant.ListOptions) ([]*tenant.User, int, error) {
+	if err := s.liveTenant(ctx, s.db, tenantID); err != nil {
+		return nil, 0, err
+	}
+	where := `tenant_id = ?3 AND ` + liveCondition("?1") + ` AND ` + likeSearch("?2", "id", "username", "email")
+	return list(ctx, s.db, s.users, userColumns, where, opts, scanUser, opts.IncludeDeleted, opts.Search, tenantID)
+}
+
+// getUser returns a live user of a live tenant matching a condition on ?2
+func (s *TenantStore) getUser(ctx context.Context, tenantID, condition string, value string) (*tenant.User, error) {
+	if err := s.liveTenant(ctx, s.db, tenantID); err != nil {
+		return nil, err
+	}
+	user, err := scanUser(s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE tenant_id = ?1 AND %s AND deleted_at IS NULL`,
+		userColumns, s.users, condition), tenantID, value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", tenant.ErrUserNotFound, value)
+	}
+	return user, err
+}
+
+// liveTenant returns tenant.ErrTenantNotFound unless the tenant exists and
+// is not deleted
+func (s *TenantStore) liveTenant(ctx context.Context, q queryer, tenantID string) error {
+	found, err := exists(ctx, q, fmt.Sprintf(`SELECT 1 FROM %s WHERE id = ?1 AND deleted_at IS NULL`, s.tenants), tenantID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", tenant.ErrTenantNotFound, tenantID)
+	}
+	return nil
+}
+
+// liveApp returns a not found error unless the app and its tenant exist and
+// are not deleted
+func (s *TenantStore) liveApp(ctx context.Context, q queryer, tenantID, appID string) error {
+	if err := s.liveTenant(ctx, q, tenantID); err != nil {
+		return err
+	}
+	found, err := exists(ctx, q, fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND id = ?2 AND deleted_at IS NULL`, s.apps),
+		tenantID, appID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", tenant.ErrAppNotFound, appID)
+	}
+	return nil
+}
+
+// liveBranch returns a not found error unless the branch, its app and its
+// tenant exist and are not deleted
+func (s *TenantStore) liveBranch(ctx context.Context, q queryer, tenantID, appID, branchID string) error {
+	if err := s.liveApp(ctx, q, tenantID, appID); err != nil {
+		return err
+	}
+	found, err := exists(ctx, q, fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND app_id = ?2 AND id = ?3 AND deleted_at IS NULL`,
+		s.branches), tenantID, appID, branchID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", tenant.ErrBranchNotFound, branchID)
+	}
+	return nil
+}
+
+// liveUser returns a not found error unless the user and its tenant exist
+// and are not deleted
+func (s *TenantStore) liveUser(ctx context.Context, q queryer, tenantID, userID string) error {
+	if err := s.liveTenant(ctx, q, tenantID); err != nil {
+		return err
+	}
+	found, err := exists(ctx, q, fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND id = ?2 AND deleted_at IS NULL`, s.users),
+		tenantID, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", tenant.ErrUserNotFound, userID)
+	}
+	return nil
+}
+
+// checkTenantName checks that no other live tenant has the name
+func (s *TenantStore) checkTenantName(ctx context.Context, q queryer, tenantID, name string) error {
+	found, err := exists(ctx, q, fmt.Sprintf(`SELECT 1 FROM %s WHERE id <> ?1 AND name_key = ?2 AND deleted_at IS NULL`, s.tenants),
+		tenantID, fold(name))
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: name %q is taken", tenant.ErrTenantExists, name)
+	}
+	return nil
+}
+
+// checkAppName checks that no other live app of the tenant has the name
+func (s *TenantStore) checkAppName(ctx context.Context, q queryer, tenantID, appID, name string) error {
+	found, err := exists(ctx, q, fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND id <> ?2 AND name_key = ?3 AND deleted_at IS NULL`,
+		s.apps), tenantID, appID, fold(name))
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: name %q is taken", tenant.ErrAppExists, name)
+	}
+	return nil
+}
+
+// checkBranchName checks that no other live branch of the app has the name
+func (s *TenantStore) checkBranchName(ctx context.Context, q queryer, tenantID, appID, branchID, name string) error {
+	found, err := exists(ctx, q, fmt.Sprintf(`SELECT 1 FROM %s
+	WHERE tenant_id = ?1 AND app_id = ?2 AND id <> ?3 AND name_key = ?4 AND deleted_at IS NULL`, s.branches),
+		tenantID, appID, branchID, fold(name))
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: name %q is taken", tenant.ErrBranchExists, name)
+	}
+	return nil
+}
+
+// checkUserIdentifiers checks that no other live user of the tenant has the
+// username or email
+func (s *TenantStore) checkUserIdentifiers(ctx context.Context, q queryer, tenantID, userID, username, email string) error {
+	other := fmt.Sprintf(`SELECT 1 FROM %s WHERE tenant_id = ?1 AND id <> ?2 AND deleted_at IS NULL AND `, s.users)
+
+	found, err := exists(ctx, q, other+`username_key = ?3`, tenantID, userID, fold(username))
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: username %q is taken", tenant.ErrUserExists, username)
+	}
+
+	if email == "" {
+		return nil
+	}
+	found, err = exists(ctx, q, other+`email_key = ?3`, tenantID, userID, fold(email))
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("%w: email %q is taken", tenant.ErrUserExists, email)
+	}
+	return nil
+}
+
+// liveCondition is the soft-delete condition of a list, whose parameter is
+// ListOptions.IncludeDeleted
+func liveCondition(param string) string {
+	return fmt.Sprintf("(%s OR deleted_at IS NULL)", param)
+}
+
+// list returns a page of the rows of a table sorted by ID, and the total
+// count. The where clause takes args from ?1.
+func list[T any](ctx context.Context, db *sql.DB, table, columns, where string, opts tenant.ListOptions,
+	scan func(row scanner) (T, error), args ...any) ([]T, int, error) {
+	var total int
+	if err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, table, where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY id%s`,
+		columns, table, where, pageClause(opts.Offset, opts.Limit)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := make([]T, 0)
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+const (
+	tenantColumns = `id, name, status, metadata, created_at, updated_at, deleted_at`
+	appColumns    = `tenant_id, id, name, status, metadata, created_at, updated_at, deleted_at`
+	branchColumns = `tenant_id, app_id, id, name, metadata, created_at, updated_at, deleted_at`
+	userColumns   = `tenant_id, id, username, email, password_hash, status, status_reason, status_changed_at, disabled, metadata, created_at, updated_at, deleted_at`
+)
+
+func scanTenant(row scanner) (*tenant.Tenant, error) {
+	t := &tenant.Tenant{}
+	var status string
+	var metadata sql.NullString
+	var createdAt, updatedAt int64
+	var deletedAt sql.NullInt64
+	if err := row.Scan(&t.ID, &t.Name, &status, &metadata, &createdAt, &updatedAt, &deletedAt); err != nil {
+		return nil, err
+	}
+	t.Status = tenant.Status(status)
+	t.CreatedAt, t.UpdatedAt, t.DeletedAt = fromUnixNano(createdAt), fromUnixNano(updatedAt), fromNullUnixNano(deletedAt)
+	return t, decodeMetadata(metadata, &t.Metadata)
+}
+
+func scanApp(row scanner) (*tenant.App, error) {
+	app := &tenant.App{}
+	var status string
+	var metadata sql.NullString
+	var createdAt, updatedAt int64
+	var deletedAt sql.NullInt64
+	if err := row.Scan(&app.TenantID, &app.ID, &app.Name, &status, &metadata, &createdAt, &updatedAt, &deletedAt); err != nil {
+		return nil, err
+	}
+	app.Status = tenant.Status(status)
+	app.CreatedAt, app.UpdatedAt, app.DeletedAt = fromUnixNano(createdAt), fromUnixNano(updatedAt), fromNullUnixNano(deletedAt)
+	return app, decodeMetadata(metadata, &app.Metadata)
+}
+
+func scanBranch(row scanner) (*tenant.Branch, error) {
+	branch := &tenant.Branch{}
+	var metadata sql.NullString
+	var createdAt, updatedAt int64
+	var deletedAt sql.NullInt64
+	if err := row.Scan(&branch.TenantID, &branch.AppID, &branch.ID, &branch.Name, &metadata, &createdAt, &updatedAt, &deletedAt); err != nil {
+		return nil, err
+	}
+	branch.CreatedAt, branch.UpdatedAt, branch.DeletedAt = fromUnixNano(createdAt), fromUnixNano(updatedAt), fromNullUnixNano(deletedAt)
+	return branch, decodeMetadata(metadata, &branch.Metadata)
+}
+
+func scanUser(row scanner) (*tenant.User, error) {
+	user := &tenant.User{}
+	var metadata sql.NullString
+	var createdAt, updatedAt int64
+	var statusChangedAt, deletedAt sql.NullInt64
+	if err := row.Scan(&user.TenantID, &user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Status,
+		&user.StatusReason, &statusChangedAt, &user.Disabled, &metadata, &createdAt, &updatedAt, &deletedAt); err != nil {
+		return nil, err
+	}
+	if changedAt := fromNullUnixNano(statusChangedAt); changedAt != nil {
+		user.StatusChangedAt = *changedAt
+	}
+	user.CreatedAt, user.UpdatedAt, user.DeletedAt = fromUnixNano(createdAt), fromUnixNano(updatedAt), fromNullUnixNano(deletedAt)
+	return user, decodeMetadata(metadata, &user.Metadata)
+}
+
+// encodeMetadata encodes metadata as JSON (NULL when empty)
+func encodeMetadata(metadata map[string]any) (sql.NullString, error) {
+	if len(metadata) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// decodeMetadata decodes metadata encoded by encodeMetadata
+func decodeMetadata(data sql.NullString, metadata *map[string]any) error {
+	if !data.Valid {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data.String), metadata); err != nil {
+		return fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package storetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/primadi/lokstra-auth/01_credential/apikey"
+)
+
+// TestAPIKeyStore runs the conformance suite of apikey.KeyStore, and of
+// apikey.KeyLister if the store lists keys. newStore returns an empty store.
+func TestAPIKeyStore(t *testing.T, newStore func(t *testing.T) apikey.KeyStore, opts ...Option) {
+	o := newOptions(opts)
+
+	t.Run("CRUD", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		expires := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+		must(t, s.Store(ctx, &apikey.APIKey{ID: "k1", KeyHash: "hash-1", Prefix: "sk_live", UserID: "alice", Name: "CI",
+			Scopes: []string{"read", "write"}, Metadata: map[string]any{"env": "ci"}, ExpiresAt: &expires}), "store key")
+		must(t, s.Store(ctx, &apikey.APIKey{ID: "k2", KeyHash: "hash-2", Prefix: "sk_live", UserID: "bob"}), "store key")
+		must(t, s.Store(ctx, &apikey.APIKey{ID: "k3", KeyHash: "hash-3", Prefix: "sk_test", UserID: "alice"}), "store key")
+
+		got, err := s.GetByHash(ctx, "hash-1")
+		must(t, err, "get key by hash")
+		if got.ID != "k1" || got.Prefix != "sk_live" || got.UserID != "alice" || got.Name != "CI" || got.Metadata["env"] != "ci" ||
+			fmt.Sprint(got.Scopes) != "[read write]" || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) || got.Revoked {
+			t.Fatalf("get key by hash: got %+v", got)
+		}
+		_, err = s.GetByHash(ctx, "missing")
+		mustFail(t, err, apikey.ErrAPIKeyNotFound, "get missing key by hash")
+
+		keys, err := s.GetByPrefix(ctx, "sk_live")
+		must(t, err, "get keys by prefix")
+		sameSet(t, ids(keys, keyID), []string{"k1", "k2"}, "keys with prefix sk_live")
+		keys, err = s.GetByPrefix(ctx, "missing")
+		must(t, err, "get keys by missing prefix")
+		sameSet(t, ids(keys, keyID), nil, "keys with a missing prefix")
+
+		must(t, s.Store(ctx, &apikey.APIKey{ID: "k2", KeyHash: "hash-2", Prefix: "sk_live", UserID: "bob", Name: "renamed"}), "store existing key")
+		got, err = s.GetByHash(ctx, "hash-2")
+		must(t, err, "get replaced key")
+		if got.Name != "renamed" {
+			t.Fatalf("get replaced key: got %+v", got)
+		}
+
+		used := time.Now().Truncate(time.Millisecond)
+		must(t, s.UpdateLastUsed(ctx, "k1", used), "update last used")
+		got, err = s.GetByHash(ctx, "hash-1")
+		must(t, err, "get key")
+		if got.LastUsed == nil || !got.LastUsed.Equal(used) {
+			t.Fatalf("last used: got %v, want %v", got.LastUsed, used)
+		}
+		mustFail(t, s.UpdateLastUsed(ctx, "missing", used), apikey.ErrAPIKeyNotFound, "update last used of missing key")
+
+		must(t, s.Delete(ctx, "k1"), "delete key")
+		_, err = s.GetByHash(ctx, "hash-1")
+		mustFail(t, err, apikey.ErrAPIKeyNotFound, "get deleted key")
+		mustFail(t, s.Delete(ctx, "k1"), apikey.ErrAPIKeyNotFound, "delete deleted key")
+	})
+
+	t.Run("Revocation", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		must(t, s.Store(ctx, &apikey.APIKey{ID: "k1", KeyHash: "hash-1", Prefix: "sk", UserID: "alice"}), "store key")
+		must(t, s.Store(ctx, &apikey.APIKey{ID: "k2", KeyHash: "hash-2", Prefix: "sk", UserID: "alice"}), "store key")
+		must(t, s.Revoke(ctx, "k1"), "revoke key")
+		mustFail(t, s.Revoke(ctx, "missing"), apikey.ErrAPIKeyNotFound, "revoke missing key")
+
+		got, err := s.GetByHash(ctx, "hash-1")
+		must(t, err, "get revoked key")
+		if !got.Revoked || got.RevokedAt == nil {
+			t.Fatalf("get revoked key: got %+v", got)
+		}
+		got, err = s.GetByHash(ctx, "hash-2")
+		must(t, err, "get key")
+		if got.Revoked || got.RevokedAt != nil {
+			t.Fatalf("revoking a key revoked another key: got %+v", got)
+		}
+		must(t, s.UpdateLastUsed(ctx, "k1", time.Now()), "update last used of revoked key")
+		got, err = s.GetByHash(ctx, "hash-1")
+		must(t, err, "get revoked key")
+		if !got.Revoked {
+			t.Fatal("updating the last use of a revoked key restored it")
+		}
+	})
+
+	t.Run("ListByUser", func(t *testing.T) {
+		s := newStore(t)
+		lister, ok := s.(apikey.KeyLister)
+		if !ok {
+			t.Skip("the store does not list keys")
+		}
+		ctx := t.Context()
+
+		now := time.Now().Truncate(time.Millisecond)
+		for _, k := range []struct {
+			id  string
+			age time.Duration
+		}{{"newest", 0}, {"oldest", 2 * time.Minute}, {"middle", time.Minute}} {
+			must(t, s.Store(ctx, &apikey.APIKey{ID: k.id, KeyHash: "hash-" + k.id, Prefix: "sk", UserID: "alice",
+				CreatedAt: now.Add(-k.age)}), "store key")
+		}
+		must(t, s.Store(ctx, &apikey.APIKey{ID: "other", KeyHash: "hash-other", Prefix: "sk", UserID: "bob", CreatedAt: now}), "store key")
+
+		keys, err := lister.ListByUser(ctx, "alice")
+		must(t, err, "list keys of user")
+		if got := fmt.Sprint(ids(keys, keyID)); got != "[oldest middle newest]" {
+			t.Fatalf("list keys of user: got %s, want [oldest middle newest]", got)
+		}
+		keys, err = lister.ListByUser(ctx, "nobody")
+		must(t, err, "list keys of unknown user")
+		sameSet(t, ids(keys, keyID), nil, "keys of an unknown user")
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.Store(ctx, &apikey.APIKey{ID: fmt.Sprintf("k%d", i), KeyHash: fmt.Sprintf("hash-%d", i), Prefix: "sk", UserID: "alice"})
+		}), "store key")
+		keys, err := s.GetByPrefix(ctx, "sk")
+		must(t, err, "get keys by prefix")
+		if len(keys) != o.workers {
+			t.Fatalf("keys after concurrent stores: got %d, want %d", len(keys), o.workers)
+		}
+
+		noErrors(t, parallel(o.workers, func(i int) error {
+			if i%2 == 0 {
+				return s.Revoke(ctx, "k0")
+			}
+			return s.UpdateLastUsed(ctx, "k0", time.Now())
+		}), "revoke and use key")
+		got, err := s.GetByHash(ctx, "hash-0")
+		must(t, err, "get key")
+		if !got.Revoked || got.LastUsed == nil {
+			t.Fatalf("key after concurrent revocations and uses: got %+v", got)
+		}
+	})
+}
+
+func keyID(k *apikey.APIKey) string { return k.ID }
@@ -0,0 +1,211 @@
+package storetest
+
+import (
+	"fmt"
+	"testing"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/policy"
+)
+
+// TestPolicyStore runs the conformance suite of authz.PolicyStore, and of
+// authz.VersionedPolicyStore if the store keeps versions. newStore returns
+// an empty store.
+func TestPolicyStore(t *testing.T, newStore func(t *testing.T) authz.PolicyStore, opts ...Option) {
+	o := newOptions(opts)
+
+	t.Run("CRUD", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		p := &authz.Policy{ID: "p1", Name: "Readers", Effect: "allow", Subjects: []string{"alice"},
+			Resources: []string{"doc:1"}, Actions: []authz.Action{authz.ActionRead}}
+		must(t, s.Create(ctx, p), "create policy")
+		mustFail(t, s.Create(ctx, &authz.Policy{ID: "p1", Effect: "deny"}), policy.ErrPolicyExists, "create existing policy")
+
+		got, err := s.Get(ctx, "p1")
+		must(t, err, "get policy")
+		if got.Name != "Readers" || got.Effect != "allow" || fmt.Sprint(got.Subjects, got.Resources, got.Actions) != "[alice] [doc:1] [read]" {
+			t.Fatalf("get policy: got %+v", got)
+		}
+		_, err = s.Get(ctx, "missing")
+		mustFail(t, err, policy.ErrPolicyNotFound, "get missing policy")
+
+		must(t, s.Update(ctx, &authz.Policy{ID: "p1", Name: "Writers", Effect: "deny", Subjects: []string{"bob"},
+			Resources: []string{"doc:2"}, Actions: []authz.Action{authz.ActionWrite}}), "update policy")
+		got, err = s.Get(ctx, "p1")
+		must(t, err, "get updated policy")
+		if got.Name != "Writers" || got.Effect != "deny" || fmt.Sprint(got.Subjects, got.Resources, got.Actions) != "[bob] [doc:2] [write]" {
+			t.Fatalf("get updated policy: got %+v", got)
+		}
+		mustFail(t, s.Update(ctx, &authz.Policy{ID: "missing"}), policy.ErrPolicyNotFound, "update missing policy")
+
+		must(t, s.Create(ctx, &authz.Policy{ID: "p2", Effect: "allow"}), "create policy")
+		all, err := s.List(ctx)
+		must(t, err, "list policies")
+		sameSet(t, ids(all, policyID), []string{"p1", "p2"}, "list policies")
+
+		must(t, s.Delete(ctx, "p1"), "delete policy")
+		_, err = s.Get(ctx, "p1")
+		mustFail(t, err, policy.ErrPolicyNotFound, "get deleted policy")
+		mustFail(t, s.Delete(ctx, "p1"), policy.ErrPolicyNotFound, "delete deleted policy")
+		all, err = s.List(ctx)
+		must(t, err, "list policies")
+		sameSet(t, ids(all, policyID), []string{"p2"}, "list policies after delete")
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+		for _, p := range []*authz.Policy{
+			{ID: "alice-doc1", Effect: "allow", Subjects: []string{"alice"}, Resources: []string{"doc:1"}},
+			{ID: "bob-docs", Effect: "allow", Subjects: []string{"bob", "carol"}, Resources: []string{"doc:*"}},
+			{ID: "anyone-anything", Effect: "deny", Subjects: []string{"*"}, Resources: []string{"*"}},
+			{ID: "alice-file", Effect: "allow", Subjects: []string{"alice"}, Resources: []string{"file:1"}},
+		} {
+			must(t, s.Create(ctx, p), "create policy %s", p.ID)
+		}
+
+		found, err := s.FindBySubject(ctx, "alice")
+		must(t, err, "find by subject")
+		sameSet(t, ids(found, policyID), []string{"alice-doc1", "anyone-anything", "alice-file"}, "policies of subject alice")
+		found, err = s.FindBySubject(ctx, "carol")
+		must(t, err, "find by subject")
+		sameSet(t, ids(found, policyID), []string{"bob-docs", "anyone-anything"}, "policies of subject carol")
+
+		found, err = s.FindByResource(ctx, "doc", "1")
+		must(t, err, "find by resource")
+		sameSet(t, ids(found, policyID), []string{"alice-doc1", "bob-docs", "anyone-anything"}, "policies of resource doc:1")
+		found, err = s.FindByResource(ctx, "doc", "2")
+		must(t, err, "find by resource")
+		sameSet(t, ids(found, policyID), []string{"bob-docs", "anyone-anything"}, "policies of resource doc:2")
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		s, ok := newStore(t).(authz.VersionedPolicyStore)
+		if !ok {
+			t.Skip("the store does not keep versions")
+		}
+		ctx := authz.WithActor(t.Context(), "admin")
+
+		must(t, s.Create(ctx, &authz.Policy{ID: "p1", Name: "v1", Effect: "allow"}), "create policy")
+		must(t, s.Update(ctx, &authz.Policy{ID: "p1", Name: "v2", Effect: "allow"}), "update policy")
+		must(t, s.Delete(ctx, "p1"), "delete policy")
+
+		versions, err := s.ListVersions(ctx, "p1")
+		must(t, err, "list versions")
+		if got := versionSummary(versions); got != "[1:create:v1 2:update:v2 3:delete:v2]" {
+			t.Fatalf("list versions: got %s", got)
+		}
+		if versions[0].Author != "admin" || versions[0].PolicyID != "p1" || versions[0].CreatedAt.IsZero() {
+			t.Fatalf("list versions: got %+v", versions[0])
+		}
+		_, err = s.ListVersions(ctx, "missing")
+		mustFail(t, err, policy.ErrPolicyNotFound, "list versions of missing policy")
+
+		version, err := s.GetVersion(ctx, "p1", 1)
+		must(t, err, "get version")
+		if version.Policy.Name != "v1" || version.Operation != authz.PolicyCreated {
+			t.Fatalf("get version: got %+v", version)
+		}
+		for _, v := range []int{0, 4} {
+			_, err = s.GetVersion(ctx, "p1", v)
+			mustFail(t, err, authz.ErrVersionNotFound, "get missing version %d", v)
+		}
+
+		rollback, err := s.Rollback(ctx, "p1", 1)
+		must(t, err, "rollback deleted policy")
+		if rollback.Version != 4 || rollback.Operation != authz.PolicyRolledBack || rollback.RollbackOf != 1 || rollback.Policy.Name != "v1" {
+			t.Fatalf("rollback: got %+v", rollback)
+		}
+		got, err := s.Get(ctx, "p1")
+		must(t, err, "get rolled back policy")
+		if got.Name != "v1" {
+			t.Fatalf("get rolled back policy: got %+v", got)
+		}
+		_, err = s.Rollback(ctx, "p1", 9)
+		mustFail(t, err, authz.ErrVersionNotFound, "rollback to missing version")
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		if o.skipIsolation {
+			t.Skip("the store is not partitioned per tenant")
+		}
+		s := newStore(t)
+		acme := authz.WithTenant(t.Context(), "acme")
+		globex := authz.WithTenant(t.Context(), "globex")
+
+		must(t, s.Create(acme, &authz.Policy{ID: "p1", Name: "acme", Effect: "allow", Subjects: []string{"alice"}, Resources: []string{"*"}}), "create policy in tenant acme")
+		must(t, s.Create(globex, &authz.Policy{ID: "p1", Name: "globex", Effect: "deny", Subjects: []string{"bob"}}), "create policy with the same ID in tenant globex")
+		must(t, s.Create(acme, &authz.Policy{ID: "only-acme", Effect: "allow"}), "create policy in tenant acme")
+
+		got, err := s.Get(globex, "p1")
+		must(t, err, "get policy")
+		if got.Name != "globex" {
+			t.Fatalf("get policy of tenant globex: got %+v", got)
+		}
+		_, err = s.Get(globex, "only-acme")
+		mustFail(t, err, policy.ErrPolicyNotFound, "get policy of another tenant")
+		_, err = s.Get(t.Context(), "p1")
+		mustFail(t, err, policy.ErrPolicyNotFound, "get policy of a tenant without tenant")
+
+		all, err := s.List(globex)
+		must(t, err, "list policies")
+		sameSet(t, ids(all, policyID), []string{"p1"}, "policies of tenant globex")
+		found, err := s.FindBySubject(globex, "alice")
+		must(t, err, "find by subject")
+		sameSet(t, ids(found, policyID), nil, "policies of a subject of another tenant")
+		found, err = s.FindByResource(globex, "doc", "1")
+		must(t, err, "find by resource")
+		sameSet(t, ids(found, policyID), nil, "policies of a resource of another tenant")
+
+		must(t, s.Delete(globex, "p1"), "delete policy in tenant globex")
+		_, err = s.Get(acme, "p1")
+		must(t, err, "get policy after the policy with the same ID of another tenant is deleted")
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		oneWinner(t, parallel(o.workers, func(i int) error {
+			return s.Create(ctx, &authz.Policy{ID: "contended", Name: fmt.Sprint(i), Effect: "allow"})
+		}), policy.ErrPolicyExists)
+
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.Update(ctx, &authz.Policy{ID: "contended", Name: fmt.Sprint(i), Effect: "allow"})
+		}), "update policy")
+		if versioned, ok := s.(authz.VersionedPolicyStore); ok {
+			versions, err := versioned.ListVersions(ctx, "contended")
+			must(t, err, "list versions")
+			if len(versions) != o.workers+1 {
+				t.Fatalf("versions after concurrent updates: got %d, want %d", len(versions), o.workers+1)
+			}
+			for i, v := range versions {
+				if v.Version != i+1 {
+					t.Fatalf("versions after concurrent updates: got %s", versionSummary(versions))
+				}
+			}
+		}
+
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.Create(ctx, &authz.Policy{ID: fmt.Sprintf("p%d", i), Effect: "allow"})
+		}), "create policy")
+		all, err := s.List(ctx)
+		must(t, err, "list policies")
+		if len(all) != o.workers+1 {
+			t.Fatalf("list policies after concurrent creates: got %d, want %d", len(all), o.workers+1)
+		}
+	})
+}
+
+func policyID(p *authz.Policy) string { return p.ID }
+
+// versionSummary formats versions as "[version:operation:name ...]"
+func versionSummary(versions []*authz.PolicyVersion) string {
+	summary := make([]string, len(versions))
+	for i, v := range versions {
+		summary[i] = fmt.Sprintf("%d:%s:%s", v.Version, v.Operation, v.Policy.Name)
+	}
+	return fmt.Sprint(summary)
+}
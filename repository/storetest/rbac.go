@@ -0,0 +1,231 @@
+package storetest
+
+import (
+	"fmt"
+	"testing"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/rbac"
+)
+
+// TestRBACStore runs the conformance suite of rbac.Store. newStore returns
+// an empty store.
+func TestRBACStore(t *testing.T, newStore func(t *testing.T) rbac.Store, opts ...Option) {
+	o := newOptions(opts)
+
+	t.Run("Roles", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		must(t, s.CreateRole(ctx, &rbac.Role{Name: "editor", Description: "Edits", Permissions: []string{"doc:write", "doc:read", "doc:read"}}), "create role")
+		mustFail(t, s.CreateRole(ctx, &rbac.Role{Name: "editor"}), rbac.ErrRoleExists, "create existing role")
+		mustFail(t, s.CreateRole(ctx, &rbac.Role{Name: "bad name"}), rbac.ErrInvalidName, "create role with invalid name")
+
+		role, err := s.GetRole(ctx, "editor")
+		must(t, err, "get role")
+		if role.Description != "Edits" || role.CreatedAt.IsZero() {
+			t.Fatalf("get role: got %+v", role)
+		}
+		sameSet(t, role.Permissions, []string{"doc:read", "doc:write"}, "permissions of a created role")
+		_, err = s.GetRole(ctx, "missing")
+		mustFail(t, err, rbac.ErrRoleNotFound, "get missing role")
+
+		must(t, s.UpdateRole(ctx, &rbac.Role{Name: "editor", Description: "Edits documents"}), "update role")
+		role, err = s.GetRole(ctx, "editor")
+		must(t, err, "get updated role")
+		if role.Description != "Edits documents" || len(role.Permissions) != 2 {
+			t.Fatalf("get updated role: got %+v", role)
+		}
+		mustFail(t, s.UpdateRole(ctx, &rbac.Role{Name: "missing"}), rbac.ErrRoleNotFound, "update missing role")
+
+		for _, name := range []string{"viewer", "admin"} {
+			must(t, s.CreateRole(ctx, &rbac.Role{Name: name}), "create role")
+		}
+		roles, total, err := s.ListRoles(ctx, rbac.ListOptions{})
+		must(t, err, "list roles")
+		if got := ids(roles, roleName); total != 3 || fmt.Sprint(got) != "[admin editor viewer]" {
+			t.Fatalf("list roles: got %v of %d, want [admin editor viewer] of 3", got, total)
+		}
+		roles, total, err = s.ListRoles(ctx, rbac.ListOptions{Search: "I", Offset: 1, Limit: 1})
+		must(t, err, "search roles")
+		if got := ids(roles, roleName); total != 3 || fmt.Sprint(got) != "[editor]" {
+			t.Fatalf("search roles: got %v of %d, want [editor] of 3", got, total)
+		}
+
+		must(t, s.AssignRole(ctx, "alice", "editor"), "assign role")
+		must(t, s.DeleteRole(ctx, "editor"), "delete role")
+		_, err = s.GetRole(ctx, "editor")
+		mustFail(t, err, rbac.ErrRoleNotFound, "get deleted role")
+		mustFail(t, s.DeleteRole(ctx, "editor"), rbac.ErrRoleNotFound, "delete deleted role")
+		assigned, err := s.ListSubjectRoles(ctx, "alice")
+		must(t, err, "list subject roles")
+		sameSet(t, assigned, nil, "roles of a subject after the role is deleted")
+
+		must(t, s.CreateRole(ctx, &rbac.Role{Name: "editor"}), "recreate deleted role")
+		role, err = s.GetRole(ctx, "editor")
+		must(t, err, "get recreated role")
+		sameSet(t, role.Permissions, nil, "permissions of a recreated role")
+	})
+
+	t.Run("Permissions", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		must(t, s.CreatePermission(ctx, &rbac.Permission{Name: "doc:read", Description: "Read documents"}), "create permission")
+		mustFail(t, s.CreatePermission(ctx, &rbac.Permission{Name: "doc:read"}), rbac.ErrPermissionExists, "create existing permission")
+		mustFail(t, s.CreatePermission(ctx, &rbac.Permission{Name: ""}), rbac.ErrInvalidName, "create permission with invalid name")
+		perm, err := s.GetPermission(ctx, "doc:read")
+		must(t, err, "get permission")
+		if perm.Description != "Read documents" {
+			t.Fatalf("get permission: got %+v", perm)
+		}
+		_, err = s.GetPermission(ctx, "missing")
+		mustFail(t, err, rbac.ErrPermissionNotFound, "get missing permission")
+
+		must(t, s.CreatePermission(ctx, &rbac.Permission{Name: "doc:write"}), "create permission")
+		perms, total, err := s.ListPermissions(ctx, rbac.ListOptions{Search: "DOC"})
+		must(t, err, "list permissions")
+		if got := ids(perms, permissionName); total != 2 || fmt.Sprint(got) != "[doc:read doc:write]" {
+			t.Fatalf("list permissions: got %v of %d, want [doc:read doc:write] of 2", got, total)
+		}
+
+		must(t, s.CreateRole(ctx, &rbac.Role{Name: "editor", Permissions: []string{"doc:read", "doc:write"}}), "create role")
+		must(t, s.DeletePermission(ctx, "doc:read"), "delete permission")
+		mustFail(t, s.DeletePermission(ctx, "doc:read"), rbac.ErrPermissionNotFound, "delete deleted permission")
+		role, err := s.GetRole(ctx, "editor")
+		must(t, err, "get role")
+		sameSet(t, role.Permissions, []string{"doc:write"}, "permissions of a role after a permission is deleted")
+	})
+
+	t.Run("Grants", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+		must(t, s.CreateRole(ctx, &rbac.Role{Name: "editor"}), "create role")
+		must(t, s.CreateRole(ctx, &rbac.Role{Name: "viewer", Permissions: []string{"doc:read"}}), "create role")
+
+		for range 2 {
+			must(t, s.GrantPermission(ctx, "editor", "doc:*"), "grant permission")
+		}
+		must(t, s.GrantPermission(ctx, "editor", "doc:read"), "grant permission")
+		mustFail(t, s.GrantPermission(ctx, "missing", "doc:read"), rbac.ErrRoleNotFound, "grant permission to missing role")
+		must(t, s.RevokePermission(ctx, "editor", "doc:read"), "revoke permission")
+		must(t, s.RevokePermission(ctx, "editor", "doc:read"), "revoke revoked permission")
+		mustFail(t, s.RevokePermission(ctx, "missing", "doc:read"), rbac.ErrRoleNotFound, "revoke permission of missing role")
+
+		all, err := s.RolePermissions(ctx)
+		must(t, err, "role permissions")
+		sameSet(t, all["editor"], []string{"doc:*"}, "permissions of role editor")
+		sameSet(t, all["viewer"], []string{"doc:read"}, "permissions of role viewer")
+	})
+
+	t.Run("Assignments", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+		for _, name := range []string{"editor", "viewer"} {
+			must(t, s.CreateRole(ctx, &rbac.Role{Name: name}), "create role")
+		}
+
+		for range 2 {
+			must(t, s.AssignRole(ctx, "alice", "viewer"), "assign role")
+		}
+		must(t, s.AssignRole(ctx, "alice", "editor"), "assign role")
+		must(t, s.AssignRole(ctx, "bob", "viewer"), "assign role")
+		mustFail(t, s.AssignRole(ctx, "alice", "missing"), rbac.ErrRoleNotFound, "assign missing role")
+
+		roles, err := s.ListSubjectRoles(ctx, "alice")
+		must(t, err, "list subject roles")
+		if fmt.Sprint(roles) != "[editor viewer]" {
+			t.Fatalf("list subject roles: got %v, want [editor viewer]", roles)
+		}
+		roles, err = s.ListSubjectRoles(ctx, "nobody")
+		must(t, err, "list roles of unknown subject")
+		sameSet(t, roles, nil, "roles of an unknown subject")
+
+		subjects, total, err := s.ListRoleSubjects(ctx, "viewer", rbac.ListOptions{Limit: 1})
+		must(t, err, "list role subjects")
+		if total != 2 || fmt.Sprint(subjects) != "[alice]" {
+			t.Fatalf("list role subjects: got %v of %d, want [alice] of 2", subjects, total)
+		}
+		_, _, err = s.ListRoleSubjects(ctx, "missing", rbac.ListOptions{})
+		mustFail(t, err, rbac.ErrRoleNotFound, "list subjects of missing role")
+
+		must(t, s.UnassignRole(ctx, "alice", "viewer"), "unassign role")
+		must(t, s.UnassignRole(ctx, "alice", "viewer"), "unassign unassigned role")
+		roles, err = s.ListSubjectRoles(ctx, "alice")
+		must(t, err, "list subject roles")
+		sameSet(t, roles, []string{"editor"}, "roles of a subject after unassign")
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		s := newStore(t)
+		acme := authz.WithTenant(t.Context(), "acme")
+		globex := authz.WithTenant(t.Context(), "globex")
+
+		must(t, s.CreateRole(acme, &rbac.Role{Name: "admin", Permissions: []string{"*"}}), "create role in tenant acme")
+		must(t, s.CreateRole(globex, &rbac.Role{Name: "admin", Permissions: []string{"doc:read"}}), "create role with the same name in tenant globex")
+		must(t, s.CreateRole(acme, &rbac.Role{Name: "only-acme"}), "create role in tenant acme")
+		must(t, s.CreatePermission(acme, &rbac.Permission{Name: "doc:read"}), "create permission in tenant acme")
+		must(t, s.CreatePermission(globex, &rbac.Permission{Name: "doc:read"}), "create permission with the same name in tenant globex")
+		must(t, s.AssignRole(acme, "alice", "admin"), "assign role in tenant acme")
+
+		_, err := s.GetRole(globex, "only-acme")
+		mustFail(t, err, rbac.ErrRoleNotFound, "get role of another tenant")
+		_, err = s.GetRole(t.Context(), "admin")
+		mustFail(t, err, rbac.ErrRoleNotFound, "get role of a tenant without tenant")
+		mustFail(t, s.AssignRole(globex, "alice", "only-acme"), rbac.ErrRoleNotFound, "assign role of another tenant")
+
+		all, err := s.RolePermissions(globex)
+		must(t, err, "role permissions")
+		sameSet(t, all["admin"], []string{"doc:read"}, "permissions of role admin in tenant globex")
+		if _, ok := all["only-acme"]; ok {
+			t.Fatal("role permissions of tenant globex include a role of tenant acme")
+		}
+		roles, err := s.ListSubjectRoles(globex, "alice")
+		must(t, err, "list subject roles")
+		sameSet(t, roles, nil, "roles of a subject assigned in another tenant")
+
+		must(t, s.DeleteRole(globex, "admin"), "delete role in tenant globex")
+		roles, err = s.ListSubjectRoles(acme, "alice")
+		must(t, err, "list subject roles")
+		sameSet(t, roles, []string{"admin"}, "roles of a subject after a role of another tenant is deleted")
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		oneWinner(t, parallel(o.workers, func(int) error {
+			return s.CreateRole(ctx, &rbac.Role{Name: "contended"})
+		}), rbac.ErrRoleExists)
+
+		var want []string
+		for i := range o.workers {
+			want = append(want, fmt.Sprintf("perm:%d", i))
+		}
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.GrantPermission(ctx, "contended", want[i])
+		}), "grant permission")
+		role, err := s.GetRole(ctx, "contended")
+		must(t, err, "get role")
+		sameSet(t, role.Permissions, want, "permissions after concurrent grants")
+
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.AssignRole(ctx, "alice", "contended")
+		}), "assign role")
+		roles, err := s.ListSubjectRoles(ctx, "alice")
+		must(t, err, "list subject roles")
+		sameSet(t, roles, []string{"contended"}, "roles after concurrent assignments of one role")
+
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.AssignRole(ctx, fmt.Sprintf("subject-%d", i), "contended")
+		}), "assign role")
+		_, total, err := s.ListRoleSubjects(ctx, "contended", rbac.ListOptions{})
+		must(t, err, "list role subjects")
+		if total != o.workers+1 {
+			t.Fatalf("list role subjects after concurrent assignments: total %d, want %d", total, o.workers+1)
+		}
+	})
+}
+
+func roleName(r *rbac.Role) string             { return r.Name }
+func permissionName(p *rbac.Permission) string { return p.Name }
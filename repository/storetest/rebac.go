@@ -0,0 +1,113 @@
+package storetest
+
+import (
+	"fmt"
+	"testing"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/04_authz/rebac"
+)
+
+// TestTupleStore runs the conformance suite of rebac.TupleStore. newStore
+// returns an empty store.
+func TestTupleStore(t *testing.T, newStore func(t *testing.T) rebac.TupleStore, opts ...Option) {
+	o := newOptions(opts)
+
+	t.Run("ReadWrite", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		tuples := mustParseTuples(t, "doc:1#owner@user:alice", "doc:1#viewer@group:eng#member", "doc:2#viewer@user:alice",
+			"group:eng#member@user:bob")
+		must(t, s.Write(ctx, tuples...), "write tuples")
+		must(t, s.Write(ctx, tuples[0]), "write existing tuple")
+		must(t, s.Write(ctx), "write no tuple")
+
+		for _, c := range []struct {
+			filter rebac.TupleFilter
+			want   []string
+		}{
+			{rebac.TupleFilter{}, []string{"doc:1#owner@user:alice", "doc:1#viewer@group:eng#member", "doc:2#viewer@user:alice", "group:eng#member@user:bob"}},
+			{rebac.TupleFilter{ObjectType: "doc", ObjectID: "1"}, []string{"doc:1#owner@user:alice", "doc:1#viewer@group:eng#member"}},
+			{rebac.TupleFilter{Relation: "viewer"}, []string{"doc:1#viewer@group:eng#member", "doc:2#viewer@user:alice"}},
+			{rebac.TupleFilter{SubjectType: "user", SubjectID: "alice"}, []string{"doc:1#owner@user:alice", "doc:2#viewer@user:alice"}},
+			{rebac.TupleFilter{SubjectType: "group", SubjectID: "eng", SubjectRelation: "member"}, []string{"doc:1#viewer@group:eng#member"}},
+			{rebac.TupleFilter{ObjectType: "folder"}, nil},
+		} {
+			got, err := s.Read(ctx, c.filter)
+			must(t, err, "read tuples")
+			sameSet(t, tupleStrings(got), c.want, fmt.Sprintf("read %+v", c.filter))
+		}
+
+		missing := mustParseTuples(t, "doc:9#owner@user:nobody")
+		must(t, s.Delete(ctx, append(missing, tuples[0], tuples[1])...), "delete tuples")
+		must(t, s.Delete(ctx), "delete no tuple")
+		got, err := s.Read(ctx, rebac.TupleFilter{})
+		must(t, err, "read tuples")
+		sameSet(t, tupleStrings(got), []string{"doc:2#viewer@user:alice", "group:eng#member@user:bob"}, "tuples after delete")
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		s := newStore(t)
+		acme := authz.WithTenant(t.Context(), "acme")
+		globex := authz.WithTenant(t.Context(), "globex")
+
+		shared := mustParseTuples(t, "doc:1#owner@user:alice")
+		must(t, s.Write(acme, shared...), "write tuple in tenant acme")
+		must(t, s.Write(globex, shared...), "write the same tuple in tenant globex")
+		must(t, s.Write(acme, mustParseTuples(t, "doc:2#owner@user:alice")...), "write tuple in tenant acme")
+
+		got, err := s.Read(globex, rebac.TupleFilter{SubjectID: "alice"})
+		must(t, err, "read tuples")
+		sameSet(t, tupleStrings(got), []string{"doc:1#owner@user:alice"}, "tuples of tenant globex")
+		got, err = s.Read(t.Context(), rebac.TupleFilter{})
+		must(t, err, "read tuples")
+		sameSet(t, tupleStrings(got), nil, "tuples without tenant")
+
+		must(t, s.Delete(globex, shared...), "delete tuple in tenant globex")
+		got, err = s.Read(acme, rebac.TupleFilter{})
+		must(t, err, "read tuples")
+		sameSet(t, tupleStrings(got), []string{"doc:1#owner@user:alice", "doc:2#owner@user:alice"}, "tuples of tenant acme after a delete in tenant globex")
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		contended := mustParseTuples(t, "doc:1#owner@user:alice")
+		noErrors(t, parallel(o.workers, func(int) error {
+			return s.Write(ctx, contended...)
+		}), "write the same tuple")
+		got, err := s.Read(ctx, rebac.TupleFilter{ObjectID: "1"})
+		must(t, err, "read tuples")
+		sameSet(t, tupleStrings(got), []string{"doc:1#owner@user:alice"}, "tuples after concurrent writes of one tuple")
+
+		var want []string
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.Write(ctx, rebac.Tuple{Object: rebac.Object{Type: "doc", ID: "2"}, Relation: "viewer",
+				Subject: rebac.Subject{Type: "user", ID: fmt.Sprintf("u%d", i)}})
+		}), "write tuples")
+		for i := range o.workers {
+			want = append(want, fmt.Sprintf("doc:2#viewer@user:u%d", i))
+		}
+		got, err = s.Read(ctx, rebac.TupleFilter{ObjectID: "2"})
+		must(t, err, "read tuples")
+		sameSet(t, tupleStrings(got), want, "tuples after concurrent writes")
+	})
+}
+
+// mustParseTuples parses tuples in the "type:id#relation@subject" notation
+func mustParseTuples(t *testing.T, notations ...string) []rebac.Tuple {
+	t.Helper()
+	tuples := make([]rebac.Tuple, len(notations))
+	for i, notation := range notations {
+		tuple, err := rebac.ParseTuple(notation)
+		must(t, err, "parse tuple %q", notation)
+		tuples[i] = tuple
+	}
+	return tuples
+}
+
+func tupleStrings(tuples []rebac.Tuple) []string {
+	return ids(tuples, rebac.Tuple.String)
+}
@@ -0,0 +1,134 @@
+// Package storetest is a conformance suite for the store contracts. A store
+// implementation is verified with one call from a test of its own package:
+//
+//	func TestTenantStores(t *testing.T) {
+//		storetest.TestTenantStores(t, func(t *testing.T) storetest.TenantStores {
+//			return newEmptyStore(t)
+//		})
+//	}
+//
+// Each suite runs subtests for CRUD, uniqueness, tenant isolation,
+// concurrency and revocation semantics. The factory is called once per
+// subtest and must return an empty store (e.g., on a fresh database or
+// schema); use t.Cleanup to release it.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Option tunes a suite to the documented limits of a store
+type Option func(*options)
+
+type options struct {
+	workers       int
+	skipIsolation bool
+}
+
+// WithWorkers sets the number of goroutines of the concurrency subtests
+// (default: 16)
+func WithWorkers(n int) Option {
+	return func(o *options) { o.workers = n }
+}
+
+// WithoutTenantIsolation skips the tenant isolation subtest, for stores that
+// are not partitioned per tenant (e.g., the single-tenant
+// policy.InMemoryStore)
+func WithoutTenantIsolation() Option {
+	return func(o *options) { o.skipIsolation = true }
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{workers: 16}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.workers < 2 {
+		o.workers = 2
+	}
+	return o
+}
+
+// must fails the test on an error
+func must(t *testing.T, err error, format string, args ...any) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", fmt.Sprintf(format, args...), err)
+	}
+}
+
+// mustFail fails the test unless err wraps target
+func mustFail(t *testing.T, err, target error, format string, args ...any) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("%s: got error %v, want %v", fmt.Sprintf(format, args...), err, target)
+	}
+}
+
+// parallel runs fn in n goroutines started at once and returns their errors
+func parallel(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+// oneWinner checks that exactly one of concurrent creations succeeded and
+// the others failed with target
+func oneWinner(t *testing.T, errs []error, target error) {
+	t.Helper()
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, target):
+			t.Fatalf("concurrent create: got error %v, want %v", err, target)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("concurrent create: %d succeeded, want 1", succeeded)
+	}
+}
+
+// noErrors checks that every concurrent operation succeeded
+func noErrors(t *testing.T, errs []error, operation string) {
+	t.Helper()
+	for _, err := range errs {
+		must(t, err, "concurrent %s", operation)
+	}
+}
+
+// sameSet checks that got holds the wanted values, in any order
+func sameSet(t *testing.T, got, want []string, what string) {
+	t.Helper()
+	got, want = slices.Clone(got), slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+// ids returns the IDs of items
+func ids[T any](items []T, id func(T) string) []string {
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = id(item)
+	}
+	return result
+}
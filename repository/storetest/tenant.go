@@ -0,0 +1,340 @@
+package storetest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+// TenantStores is the tenant control plane: the tenant, app, branch and user
+// stores, implemented together since apps, branches and users belong to
+// tenants
+type TenantStores interface {
+	tenant.TenantStore
+	tenant.AppStore
+	tenant.BranchStore
+	tenant.UserStore
+}
+
+// TestTenantStores runs the conformance suite of the tenant control plane.
+// newStore returns an empty store.
+func TestTenantStores(t *testing.T, newStore func(t *testing.T) TenantStores, opts ...Option) {
+	o := newOptions(opts)
+
+	t.Run("Tenants", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		generated := &tenant.Tenant{Name: "Generated"}
+		must(t, s.CreateTenant(ctx, generated), "create tenant without ID")
+		if generated.ID == "" {
+			t.Fatal("create tenant without ID: no ID generated")
+		}
+
+		acme := &tenant.Tenant{ID: "acme", Name: "Acme", Metadata: map[string]any{"plan": "pro"}}
+		must(t, s.CreateTenant(ctx, acme), "create tenant")
+		got, err := s.GetTenant(ctx, "acme")
+		must(t, err, "get tenant")
+		if got.Name != "Acme" || got.Status != tenant.StatusActive || got.Metadata["plan"] != "pro" || got.CreatedAt.IsZero() {
+			t.Fatalf("get tenant: got %+v", got)
+		}
+
+		mustFail(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "acme", Name: "Other"}), tenant.ErrTenantExists, "create tenant with taken ID")
+		mustFail(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "acme2", Name: " ACME "}), tenant.ErrTenantExists, "create tenant with taken name")
+		mustFail(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "bad id", Name: "Bad"}), tenant.ErrInvalidID, "create tenant with invalid ID")
+		_, err = s.GetTenant(ctx, "missing")
+		mustFail(t, err, tenant.ErrTenantNotFound, "get missing tenant")
+
+		must(t, s.UpdateTenant(ctx, &tenant.Tenant{ID: "acme", Name: "Acme Corp", Status: tenant.StatusSuspended,
+			Metadata: map[string]any{"plan": "enterprise"}}), "update tenant")
+		got, err = s.GetTenant(ctx, "acme")
+		must(t, err, "get updated tenant")
+		if got.Name != "Acme Corp" || got.Status != tenant.StatusSuspended || got.Metadata["plan"] != "enterprise" {
+			t.Fatalf("get updated tenant: got %+v", got)
+		}
+		mustFail(t, s.UpdateTenant(ctx, &tenant.Tenant{ID: "acme", Name: "generated"}), tenant.ErrTenantExists, "rename tenant to a taken name")
+		mustFail(t, s.UpdateTenant(ctx, &tenant.Tenant{ID: "missing", Name: "Missing"}), tenant.ErrTenantNotFound, "update missing tenant")
+
+		for i := range 3 {
+			must(t, s.CreateTenant(ctx, &tenant.Tenant{ID: fmt.Sprintf("page-%d", i), Name: fmt.Sprintf("Page %d", i)}), "create tenant")
+		}
+		page, total, err := s.ListTenants(ctx, tenant.ListOptions{Search: "PAGE", Offset: 1, Limit: 1})
+		must(t, err, "list tenants")
+		if total != 3 || len(page) != 1 || page[0].ID != "page-1" {
+			t.Fatalf("list tenants: got %v of %d, want [page-1] of 3", ids(page, tenantID), total)
+		}
+	})
+
+	t.Run("SoftDelete", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		must(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "old", Name: "Acme"}), "create tenant")
+		must(t, s.DeleteTenant(ctx, "old"), "delete tenant")
+		_, err := s.GetTenant(ctx, "old")
+		mustFail(t, err, tenant.ErrTenantNotFound, "get deleted tenant")
+		mustFail(t, s.DeleteTenant(ctx, "old"), tenant.ErrTenantNotFound, "delete deleted tenant")
+		mustFail(t, s.UpdateTenant(ctx, &tenant.Tenant{ID: "old", Name: "Acme"}), tenant.ErrTenantNotFound, "update deleted tenant")
+
+		live, _, err := s.ListTenants(ctx, tenant.ListOptions{})
+		must(t, err, "list tenants")
+		sameSet(t, ids(live, tenantID), nil, "list tenants without deleted")
+		all, _, err := s.ListTenants(ctx, tenant.ListOptions{IncludeDeleted: true})
+		must(t, err, "list tenants with deleted")
+		if len(all) != 1 || all[0].DeletedAt == nil {
+			t.Fatalf("list tenants with deleted: got %+v", all)
+		}
+
+		mustFail(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "old", Name: "Reused"}), tenant.ErrTenantExists, "reuse ID of deleted tenant")
+		must(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "new", Name: "acme"}), "reuse name of deleted tenant")
+		mustFail(t, s.RestoreTenant(ctx, "old"), tenant.ErrTenantExists, "restore tenant whose name is taken")
+		mustFail(t, s.RestoreTenant(ctx, "new"), tenant.ErrNotDeleted, "restore live tenant")
+		mustFail(t, s.RestoreTenant(ctx, "missing"), tenant.ErrTenantNotFound, "restore missing tenant")
+
+		must(t, s.DeleteTenant(ctx, "new"), "delete tenant")
+		must(t, s.RestoreTenant(ctx, "old"), "restore tenant")
+		got, err := s.GetTenant(ctx, "old")
+		must(t, err, "get restored tenant")
+		if got.DeletedAt != nil {
+			t.Fatalf("get restored tenant: deleted at %v", got.DeletedAt)
+		}
+	})
+
+	t.Run("Apps", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+		must(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "acme", Name: "Acme"}), "create tenant")
+
+		mustFail(t, s.CreateApp(ctx, &tenant.App{ID: "web", TenantID: "missing", Name: "Web"}), tenant.ErrTenantNotFound, "create app of missing tenant")
+		must(t, s.CreateApp(ctx, &tenant.App{ID: "web", TenantID: "acme", Name: "Web"}), "create app")
+		mustFail(t, s.CreateApp(ctx, &tenant.App{ID: "web", TenantID: "acme", Name: "Other"}), tenant.ErrAppExists, "create app with taken ID")
+		mustFail(t, s.CreateApp(ctx, &tenant.App{ID: "web2", TenantID: "acme", Name: "WEB"}), tenant.ErrAppExists, "create app with taken name")
+
+		got, err := s.GetApp(ctx, "acme", "web")
+		must(t, err, "get app")
+		if got.TenantID != "acme" || got.Name != "Web" || got.Status != tenant.StatusActive {
+			t.Fatalf("get app: got %+v", got)
+		}
+		must(t, s.UpdateApp(ctx, &tenant.App{ID: "web", TenantID: "acme", Name: "Website", Metadata: map[string]any{"url": "https://acme.test"}}), "update app")
+		got, err = s.GetApp(ctx, "acme", "web")
+		must(t, err, "get updated app")
+		if got.Name != "Website" || got.Metadata["url"] != "https://acme.test" {
+			t.Fatalf("get updated app: got %+v", got)
+		}
+
+		must(t, s.CreateApp(ctx, &tenant.App{ID: "mobile", TenantID: "acme", Name: "Mobile"}), "create app")
+		apps, total, err := s.ListApps(ctx, "acme", tenant.ListOptions{})
+		must(t, err, "list apps")
+		if total != 2 || len(apps) != 2 || apps[0].ID != "mobile" || apps[1].ID != "web" {
+			t.Fatalf("list apps: got %v of %d, want [mobile web] of 2", ids(apps, appID), total)
+		}
+
+		must(t, s.DeleteApp(ctx, "acme", "web"), "delete app")
+		_, err = s.GetApp(ctx, "acme", "web")
+		mustFail(t, err, tenant.ErrAppNotFound, "get deleted app")
+		must(t, s.CreateApp(ctx, &tenant.App{ID: "web2", TenantID: "acme", Name: "website"}), "reuse name of deleted app")
+		mustFail(t, s.RestoreApp(ctx, "acme", "web"), tenant.ErrAppExists, "restore app whose name is taken")
+		mustFail(t, s.RestoreApp(ctx, "acme", "mobile"), tenant.ErrNotDeleted, "restore live app")
+		must(t, s.DeleteApp(ctx, "acme", "web2"), "delete app")
+		must(t, s.RestoreApp(ctx, "acme", "web"), "restore app")
+	})
+
+	t.Run("Branches", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+		must(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "acme", Name: "Acme"}), "create tenant")
+		must(t, s.CreateApp(ctx, &tenant.App{ID: "web", TenantID: "acme", Name: "Web"}), "create app")
+		must(t, s.CreateApp(ctx, &tenant.App{ID: "pos", TenantID: "acme", Name: "POS"}), "create app")
+
+		mustFail(t, s.CreateBranch(ctx, &tenant.Branch{ID: "hq", TenantID: "acme", AppID: "missing", Name: "HQ"}), tenant.ErrAppNotFound, "create branch of missing app")
+		must(t, s.CreateBranch(ctx, &tenant.Branch{ID: "hq", TenantID: "acme", AppID: "web", Name: "HQ"}), "create branch")
+		mustFail(t, s.CreateBranch(ctx, &tenant.Branch{ID: "hq", TenantID: "acme", AppID: "web", Name: "Other"}), tenant.ErrBranchExists, "create branch with taken ID")
+		mustFail(t, s.CreateBranch(ctx, &tenant.Branch{ID: "hq2", TenantID: "acme", AppID: "web", Name: "hq"}), tenant.ErrBranchExists, "create branch with taken name")
+		must(t, s.CreateBranch(ctx, &tenant.Branch{ID: "hq", TenantID: "acme", AppID: "pos", Name: "HQ"}), "create branch with the same ID and name in another app")
+
+		must(t, s.UpdateBranch(ctx, &tenant.Branch{ID: "hq", TenantID: "acme", AppID: "web", Name: "Head Office"}), "update branch")
+		got, err := s.GetBranch(ctx, "acme", "web", "hq")
+		must(t, err, "get branch")
+		if got.AppID != "web" || got.Name != "Head Office" {
+			t.Fatalf("get branch: got %+v", got)
+		}
+		got, err = s.GetBranch(ctx, "acme", "pos", "hq")
+		must(t, err, "get branch of another app")
+		if got.Name != "HQ" {
+			t.Fatalf("get branch of another app: got %+v", got)
+		}
+
+		must(t, s.DeleteBranch(ctx, "acme", "web", "hq"), "delete branch")
+		_, err = s.GetBranch(ctx, "acme", "web", "hq")
+		mustFail(t, err, tenant.ErrBranchNotFound, "get deleted branch")
+		branches, total, err := s.ListBranches(ctx, "acme", "web", tenant.ListOptions{IncludeDeleted: true})
+		must(t, err, "list branches with deleted")
+		if total != 1 || len(branches) != 1 || branches[0].DeletedAt == nil {
+			t.Fatalf("list branches with deleted: got %+v", branches)
+		}
+		must(t, s.RestoreBranch(ctx, "acme", "web", "hq"), "restore branch")
+		mustFail(t, s.RestoreBranch(ctx, "acme", "web", "hq"), tenant.ErrNotDeleted, "restore live branch")
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+		must(t, s.CreateTenant(ctx, &tenant.Tenant{ID: "acme", Name: "Acme"}), "create tenant")
+
+		alice := &tenant.User{TenantID: "acme", Username: "Alice", Email: "alice@acme.test", PasswordHash: "hash"}
+		must(t, s.CreateUser(ctx, alice), "create user without ID")
+		if alice.ID == "" {
+			t.Fatal("create user without ID: no ID generated")
+		}
+		mustFail(t, s.CreateUser(ctx, &tenant.User{ID: alice.ID, TenantID: "acme", Username: "other"}), tenant.ErrUserExists, "create user with taken ID")
+		mustFail(t, s.CreateUser(ctx, &tenant.User{TenantID: "acme", Username: "ALICE"}), tenant.ErrUserExists, "create user with taken username")
+		mustFail(t, s.CreateUser(ctx, &tenant.User{TenantID: "acme", Username: "alice2", Email: "Alice@Acme.test"}), tenant.ErrUserExists, "create user with taken email")
+		must(t, s.CreateUser(ctx, &tenant.User{ID: "bob", TenantID: "acme", Username: "bob"}), "create user without email")
+		must(t, s.CreateUser(ctx, &tenant.User{ID: "carol", TenantID: "acme", Username: "carol"}), "create another user without email")
+		mustFail(t, s.CreateUser(ctx, &tenant.User{TenantID: "missing", Username: "dave"}), tenant.ErrTenantNotFound, "create user of missing tenant")
+
+		got, err := s.GetUserByUsername(ctx, "acme", "aLiCe")
+		must(t, err, "get user by username")
+		if got.ID != alice.ID || got.Email != "alice@acme.test" || got.PasswordHash != "hash" {
+			t.Fatalf("get user by username: got %+v", got)
+		}
+		_, err = s.GetUserByUsername(ctx, "acme", "nobody")
+		mustFail(t, err, tenant.ErrUserNotFound, "get missing user by username")
+
+		mustFail(t, s.UpdateUser(ctx, &tenant.User{ID: "bob", TenantID: "acme", Username: "alice"}), tenant.ErrUserExists, "rename user to a taken username")
+		must(t, s.UpdateUser(ctx, &tenant.User{ID: "bob", TenantID: "acme", Username: "robert", Email: "bob@acme.test",
+			PasswordHash: "new-hash", Disabled: true}), "update user")
+		got, err = s.GetUser(ctx, "acme", "bob")
+		must(t, err, "get updated user")
+		if got.Username != "robert" || got.Email != "bob@acme.test" || got.PasswordHash != "new-hash" || !got.Disabled {
+			t.Fatalf("get updated user: got %+v", got)
+		}
+		if got.Status != tenant.UserSuspended {
+			t.Fatalf("get user updated as disabled: status %q, want %q", got.Status, tenant.UserSuspended)
+		}
+
+		got, err = s.GetUser(ctx, "acme", "carol")
+		must(t, err, "get new user")
+		if got.Status != tenant.UserActive || got.Disabled || got.StatusChangedAt.IsZero() {
+			t.Fatalf("get new user: status %q, disabled %v, changed at %v", got.Status, got.Disabled, got.StatusChangedAt)
+		}
+		got, err = tenant.SetUserStatus(ctx, s, "acme", "carol", tenant.UserDeactivated, "closed by user")
+		must(t, err, "deactivate user")
+		if got.Status != tenant.UserDeactivated || got.StatusReason != "closed by user" || !got.Disabled {
+			t.Fatalf("deactivate user: got %+v", got)
+		}
+		_, err = tenant.SetUserStatus(ctx, s, "acme", "carol", tenant.UserSuspended, "")
+		mustFail(t, err, tenant.ErrInvalidTransition, "suspend deactivated user")
+		mustFail(t, s.CreateUser(ctx, &tenant.User{TenantID: "acme", Username: "erin", Status: "banned"}), tenant.ErrInvalidStatus, "create user with unknown status")
+		must(t, s.CreateUser(ctx, &tenant.User{ID: "frank", TenantID: "acme", Username: "frank", Status: tenant.UserPending}), "create pending user")
+		got, err = tenant.SetUserStatus(ctx, s, "acme", "frank", tenant.UserActive, "email verified")
+		must(t, err, "activate pending user")
+		if got.Status != tenant.UserActive || got.Disabled {
+			t.Fatalf("activate pending user: got %+v", got)
+		}
+
+		must(t, s.DeleteUser(ctx, "acme", alice.ID), "delete user")
+		_, err = s.GetUserByUsername(ctx, "acme", "alice")
+		mustFail(t, err, tenant.ErrUserNotFound, "get deleted user by username")
+		must(t, s.CreateUser(ctx, &tenant.User{ID: "alice2", TenantID: "acme", Username: "alice", Email: "alice@acme.test"}), "reuse username of deleted user")
+		mustFail(t, s.RestoreUser(ctx, "acme", alice.ID), tenant.ErrUserExists, "restore user whose username is taken")
+		must(t, s.DeleteUser(ctx, "acme", "alice2"), "delete user")
+		must(t, s.RestoreUser(ctx, "acme", alice.ID), "restore user")
+
+		users, total, err := s.ListUsers(ctx, "acme", tenant.ListOptions{Search: "acme.test"})
+		must(t, err, "search users")
+		sameSet(t, ids(users, userID), []string{alice.ID, "bob"}, "search users by email")
+		if total != 2 {
+			t.Fatalf("search users: total %d, want 2", total)
+		}
+
+		must(t, tenant.AnonymizeUser(ctx, s, "acme", "bob"), "anonymize user")
+		_, err = s.GetUser(ctx, "acme", "bob")
+		mustFail(t, err, tenant.ErrUserNotFound, "get anonymized user")
+		must(t, s.CreateUser(ctx, &tenant.User{ID: "bob2", TenantID: "acme", Username: "robert", Email: "bob@acme.test"}),
+			"reuse username and email of anonymized user")
+		must(t, tenant.AnonymizeUser(ctx, s, "acme", "alice2"), "anonymize deleted user")
+		mustFail(t, tenant.AnonymizeUser(ctx, s, "acme", "nobody"), tenant.ErrUserNotFound, "anonymize missing user")
+		users, _, err = s.ListUsers(ctx, "acme", tenant.ListOptions{IncludeDeleted: true})
+		must(t, err, "list deleted users")
+		for _, user := range users {
+			if user.ID != "bob" && user.ID != "alice2" {
+				continue
+			}
+			if !strings.HasPrefix(user.Username, tenant.ErasedUsernamePrefix) || user.Email != "" || user.PasswordHash != "" ||
+				user.Metadata != nil || user.Status != tenant.UserDeactivated || user.DeletedAt == nil {
+				t.Fatalf("list anonymized user: got %+v", user)
+			}
+		}
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+		for _, id := range []string{"acme", "globex"} {
+			must(t, s.CreateTenant(ctx, &tenant.Tenant{ID: id, Name: id}), "create tenant")
+			must(t, s.CreateApp(ctx, &tenant.App{ID: "web", TenantID: id, Name: "Web"}), "create app with the same ID and name in tenant %s", id)
+			must(t, s.CreateBranch(ctx, &tenant.Branch{ID: "hq", TenantID: id, AppID: "web", Name: "HQ"}), "create branch in tenant %s", id)
+			must(t, s.CreateUser(ctx, &tenant.User{ID: "admin", TenantID: id, Username: "admin", Email: "admin@example.test"}),
+				"create user with the same ID, username and email in tenant %s", id)
+		}
+		must(t, s.CreateUser(ctx, &tenant.User{ID: "only-acme", TenantID: "acme", Username: "only"}), "create user")
+
+		_, err := s.GetUser(ctx, "globex", "only-acme")
+		mustFail(t, err, tenant.ErrUserNotFound, "get user of another tenant")
+		_, err = s.GetUserByUsername(ctx, "globex", "only")
+		mustFail(t, err, tenant.ErrUserNotFound, "get user of another tenant by username")
+		mustFail(t, s.DeleteUser(ctx, "globex", "only-acme"), tenant.ErrUserNotFound, "delete user of another tenant")
+		users, _, err := s.ListUsers(ctx, "globex", tenant.ListOptions{})
+		must(t, err, "list users")
+		sameSet(t, ids(users, userID), []string{"admin"}, "list users of tenant globex")
+
+		must(t, s.UpdateApp(ctx, &tenant.App{ID: "web", TenantID: "acme", Name: "Acme Web"}), "update app")
+		got, err := s.GetApp(ctx, "globex", "web")
+		must(t, err, "get app")
+		if got.Name != "Web" {
+			t.Fatalf("update of the app of tenant acme changed tenant globex: got %+v", got)
+		}
+
+		must(t, s.DeleteTenant(ctx, "acme"), "delete tenant")
+		_, err = s.GetUser(ctx, "acme", "admin")
+		mustFail(t, err, tenant.ErrTenantNotFound, "get user of deleted tenant")
+		_, err = s.GetUser(ctx, "globex", "admin")
+		must(t, err, "get user of live tenant")
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		oneWinner(t, parallel(o.workers, func(i int) error {
+			return s.CreateTenant(ctx, &tenant.Tenant{ID: fmt.Sprintf("t%d", i), Name: "Contended"})
+		}), tenant.ErrTenantExists)
+		oneWinner(t, parallel(o.workers, func(i int) error {
+			return s.CreateTenant(ctx, &tenant.Tenant{ID: "same", Name: fmt.Sprintf("Same %d", i)})
+		}), tenant.ErrTenantExists)
+
+		oneWinner(t, parallel(o.workers, func(i int) error {
+			return s.CreateUser(ctx, &tenant.User{ID: fmt.Sprintf("u%d", i), TenantID: "same", Username: "contended"})
+		}), tenant.ErrUserExists)
+		oneWinner(t, parallel(o.workers, func(i int) error {
+			return s.CreateUser(ctx, &tenant.User{ID: fmt.Sprintf("e%d", i), TenantID: "same", Username: fmt.Sprintf("e%d", i),
+				Email: "contended@example.test"})
+		}), tenant.ErrUserExists)
+
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.CreateUser(ctx, &tenant.User{ID: fmt.Sprintf("par-%d", i), TenantID: "same", Username: fmt.Sprintf("par-%d", i)})
+		}), "create user")
+		_, total, err := s.ListUsers(ctx, "same", tenant.ListOptions{Search: "par-"})
+		must(t, err, "list users")
+		if total != o.workers {
+			t.Fatalf("list users after concurrent creates: total %d, want %d", total, o.workers)
+		}
+	})
+}
+
+func tenantID(t *tenant.Tenant) string { return t.ID }
+func appID(a *tenant.App) string       { return a.ID }
+func userID(u *tenant.User) string     { return u.ID }
@@ -0,0 +1,143 @@
+package storetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+)
+
+// TestTokenStore runs the conformance suite of token.TokenStore. Tokens are
+// identified by Metadata["token_id"], falling back to Value (the suite sets
+// both). newStore returns an empty store.
+func TestTokenStore(t *testing.T, newStore func(t *testing.T) token.TokenStore, opts ...Option) {
+	o := newOptions(opts)
+
+	t.Run("CRUD", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		must(t, s.Store(ctx, "alice", newToken("t1", time.Hour)), "store token")
+		must(t, s.Store(ctx, "alice", newToken("t2", time.Hour)), "store token")
+
+		got, err := s.Get(ctx, "alice", "t1")
+		must(t, err, "get token")
+		if got.Value != "t1" || got.Type != "Bearer" {
+			t.Fatalf("get token: got %+v", got)
+		}
+		_, err = s.Get(ctx, "alice", "missing")
+		mustFail(t, err, token.ErrTokenNotFound, "get missing token")
+
+		tokens, err := s.List(ctx, "alice")
+		must(t, err, "list tokens")
+		sameSet(t, ids(tokens, tokenValue), []string{"t1", "t2"}, "tokens of subject alice")
+		tokens, err = s.List(ctx, "nobody")
+		must(t, err, "list tokens of unknown subject")
+		sameSet(t, ids(tokens, tokenValue), nil, "tokens of an unknown subject")
+
+		must(t, s.Delete(ctx, "alice", "t1"), "delete token")
+		_, err = s.Get(ctx, "alice", "t1")
+		mustFail(t, err, token.ErrTokenNotFound, "get deleted token")
+		tokens, err = s.List(ctx, "alice")
+		must(t, err, "list tokens")
+		sameSet(t, ids(tokens, tokenValue), []string{"t2"}, "tokens of subject alice after delete")
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		must(t, s.Store(ctx, "alice", newToken("expired", -time.Minute)), "store expired token")
+		must(t, s.Store(ctx, "alice", newToken("live", time.Hour)), "store token")
+
+		if _, err := s.Get(ctx, "alice", "expired"); err == nil {
+			t.Fatal("get expired token: no error")
+		}
+		tokens, err := s.List(ctx, "alice")
+		must(t, err, "list tokens")
+		sameSet(t, ids(tokens, tokenValue), []string{"live"}, "tokens of subject alice without expired")
+	})
+
+	t.Run("Revocation", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		must(t, s.Store(ctx, "alice", newToken("t1", time.Hour)), "store token")
+		revoked, err := s.IsRevoked(ctx, "t1")
+		must(t, err, "is revoked")
+		if revoked {
+			t.Fatal("stored token is revoked")
+		}
+
+		must(t, s.Revoke(ctx, "t1"), "revoke token")
+		must(t, s.Revoke(ctx, "t1"), "revoke revoked token")
+		must(t, s.Revoke(ctx, "never-stored"), "revoke token that is not stored")
+		for _, id := range []string{"t1", "never-stored"} {
+			revoked, err = s.IsRevoked(ctx, id)
+			must(t, err, "is revoked")
+			if !revoked {
+				t.Fatalf("revoked token %s is not revoked", id)
+			}
+		}
+		revoked, err = s.IsRevoked(ctx, "other")
+		must(t, err, "is revoked")
+		if revoked {
+			t.Fatal("token that was not revoked is revoked")
+		}
+	})
+
+	t.Run("SubjectIsolation", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		must(t, s.Store(ctx, "alice", newToken("alice-token", time.Hour)), "store token")
+		must(t, s.Store(ctx, "bob", newToken("bob-token", time.Hour)), "store token")
+
+		_, err := s.Get(ctx, "bob", "alice-token")
+		mustFail(t, err, token.ErrTokenNotFound, "get token of another subject")
+		tokens, err := s.List(ctx, "bob")
+		must(t, err, "list tokens")
+		sameSet(t, ids(tokens, tokenValue), []string{"bob-token"}, "tokens of subject bob")
+
+		_ = s.Delete(ctx, "bob", "alice-token")
+		_, err = s.Get(ctx, "alice", "alice-token")
+		must(t, err, "get token after a delete by another subject")
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		s := newStore(t)
+		ctx := t.Context()
+
+		var want []string
+		for i := range o.workers {
+			want = append(want, fmt.Sprintf("t%d", i))
+		}
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.Store(ctx, "alice", newToken(want[i], time.Hour))
+		}), "store token")
+		tokens, err := s.List(ctx, "alice")
+		must(t, err, "list tokens")
+		sameSet(t, ids(tokens, tokenValue), want, "tokens after concurrent stores")
+
+		noErrors(t, parallel(o.workers, func(i int) error {
+			return s.Revoke(ctx, want[i])
+		}), "revoke token")
+		for _, id := range want {
+			revoked, err := s.IsRevoked(ctx, id)
+			must(t, err, "is revoked")
+			if !revoked {
+				t.Fatalf("token %s is not revoked after concurrent revocations", id)
+			}
+		}
+	})
+}
+
+// newToken returns a bearer token identified by id, expiring after ttl
+func newToken(id string, ttl time.Duration) *token.Token {
+	now := time.Now()
+	return &token.Token{Value: id, Type: "Bearer", IssuedAt: now, ExpiresAt: now.Add(ttl),
+		Metadata: map[string]any{"token_id": id}}
+}
+
+func tokenValue(t *token.Token) string { return t.Value }
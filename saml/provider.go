@@ -0,0 +1,560 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	lokstraauth "github.com/primadi/lokstra-auth"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/cookie"
+	"github.com/primadi/lokstra-auth/handlers"
+)
+
+var (
+	ErrUnsupportedKeyType = errors.New("SAML signing key must be an RSA private key")
+	ErrInvalidRequest     = errors.New("invalid SAML request")
+)
+
+// maxRequestSize limits the size of inflated authentication requests
+const maxRequestSize = 64 << 10
+
+// AttributeMapper builds the assertion attributes of an identity
+type AttributeMapper func(identity *subject.IdentityContext, sp *ServiceProvider) map[string][]string
+
+// Config holds configuration for the SAML identity provider
+type Config struct {
+	// Auth is the Auth runtime instance (required). It verifies the session
+	// of users at the SSO endpoint.
+	Auth *lokstraauth.Auth
+
+	// BaseURL is the external URL the endpoints are served under (required),
+	// e.g. "https://auth.example.com"
+	BaseURL string
+
+	// Prefix is prepended to the endpoints (default: "/saml")
+	Prefix string
+
+	// EntityID identifies the identity provider
+	// (default: BaseURL + Prefix + "/metadata")
+	EntityID string
+
+	// SigningKey signs assertions (required, RSA private key)
+	SigningKey crypto.Signer
+
+	// Certificate is the certificate of SigningKey, published in metadata
+	// and assertions (required)
+	Certificate *x509.Certificate
+
+	// ServiceProviders stores registered service providers (required)
+	ServiceProviders ServiceProviderStore
+
+	// TokenExtractor extracts the session token of the user (default:
+	// Authorization header, then the session cookie when Cookies is set)
+	TokenExtractor handlers.TokenExtractor
+
+	// Cookies reads browser sessions (optional)
+	Cookies *cookie.Manager
+
+	// LoginURL is where users without a session are sent, with the SSO URL
+	// to return to in the "return_to" parameter
+	LoginURL string
+
+	// AttributeMapper builds assertion attributes (default: DefaultAttributes)
+	AttributeMapper AttributeMapper
+
+	// AssertionDuration is how long assertions are valid (default: 5 minutes)
+	AssertionDuration time.Duration
+}
+
+// IdentityProvider serves the SAML metadata and SSO endpoints. Endpoints
+// are plain net/http handlers and can be mounted on any router.
+type IdentityProvider struct {
+	config *Config
+}
+
+// New creates a SAML identity provider
+func New(config *Config) (*IdentityProvider, error) {
+	if config.Auth == nil || config.ServiceProviders == nil || config.Certificate == nil {
+		return nil, errors.New("saml: Auth, ServiceProviders and Certificate are required")
+	}
+	if config.SigningKey == nil {
+		return nil, ErrUnsupportedKeyType
+	}
+	if _, ok := config.SigningKey.Public().(*rsa.PublicKey); !ok {
+		return nil, ErrUnsupportedKeyType
+	}
+
+	base, err := url.Parse(config.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("saml: invalid base URL %q", config.BaseURL)
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	if config.Prefix == "" {
+		config.Prefix = "/saml"
+	}
+	config.Prefix = strings.TrimRight(config.Prefix, "/")
+
+	if config.EntityID == "" {
+		config.EntityID = config.BaseURL + config.Prefix + "/metadata"
+	}
+
+	if config.TokenExtractor == nil {
+		config.TokenExtractor = handlers.BearerTokenExtractor
+		if config.Cookies != nil {
+			cookies := config.Cookies
+			config.TokenExtractor = func(r *http.Request) (string, error) {
+				if tokenValue, err := handlers.BearerTokenExtractor(r); err == nil {
+					return tokenValue, nil
+				}
+				return cookies.ReadSession(r)
+			}
+		}
+	}
+
+	if config.AttributeMapper == nil {
+		config.AttributeMapper = DefaultAttributes
+	}
+
+	if config.AssertionDuration <= 0 {
+		config.AssertionDuration = 5 * time.Minute
+	}
+
+	return &IdentityProvider{config: config}, nil
+}
+
+// Register mounts the identity provider endpoints on a ServeMux
+func (idp *IdentityProvider) Register(mux *http.ServeMux) {
+	path := strings.TrimRight(mustPath(idp.config.BaseURL), "/") + idp.config.Prefix
+	mux.HandleFunc("GET "+path+"/metadata", idp.Metadata)
+	mux.HandleFunc("GET "+path+"/sso", idp.SSO)
+	mux.HandleFunc("POST "+path+"/sso", idp.SSO)
+}
+
+// Handler returns a ServeMux with the identity provider endpoints mounted
+func (idp *IdentityProvider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	idp.Register(mux)
+	return mux
+}
+
+// EntityID returns the entity ID of the identity provider
+func (idp *IdentityProvider) EntityID() string {
+	return idp.config.EntityID
+}
+
+// MetadataXML returns the IdP metadata (EntityDescriptor) document
+func (idp *IdentityProvider) MetadataXML() string {
+	ssoURL := idp.endpoint("/sso")
+	return xml.Header + element("md:EntityDescriptor", []attr{{"xmlns:md", nsMetadata}, {"entityID", idp.config.EntityID}},
+		element("md:IDPSSODescriptor", []attr{
+			{"WantAuthnRequestsSigned", "false"},
+			{"protocolSupportEnumeration", nsProtocol},
+		},
+			element("md:KeyDescriptor", []attr{{"use", "signing"}},
+				element("ds:KeyInfo", []attr{{"xmlns:ds", nsDSig}},
+					element("ds:X509Data", nil,
+						element("ds:X509Certificate", nil, base64.StdEncoding.EncodeToString(idp.config.Certificate.Raw)),
+					),
+				),
+			),
+			element("md:NameIDFormat", nil, NameIDFormatUnspecified),
+			element("md:NameIDFormat", nil, NameIDFormatEmail),
+			element("md:NameIDFormat", nil, NameIDFormatPersistent),
+			element("md:NameIDFormat", nil, NameIDFormatTransient),
+			element("md:SingleSignOnService", []attr{{"Binding", bindingRedirect}, {"Location", ssoURL}}),
+			element("md:SingleSignOnService", []attr{{"Binding", bindingPOST}, {"Location", ssoURL}}),
+		),
+	)
+}
+
+// Metadata serves the IdP metadata
+func (idp *IdentityProvider) Metadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	io.WriteString(w, idp.MetadataXML())
+}
+
+// authnRequest is a parsed AuthnRequest
+type authnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	Issuer                      string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                struct {
+		Format string `xml:"Format,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+
+	raw []byte
+}
+
+// SSO is the single sign-on endpoint. It accepts AuthnRequests with the
+// HTTP-Redirect and HTTP-POST bindings, and IdP-initiated sign-on with
+// ?sp=<entity ID>. Users without a session are sent to LoginURL; signed-in
+// users are posted back to the service provider with a signed assertion.
+func (idp *IdentityProvider) SSO(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	relayState := r.Form.Get("RelayState")
+
+	req, err := parseAuthnRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entityID := r.Form.Get("sp")
+	if req != nil {
+		entityID = req.Issuer
+	}
+	sp, err := idp.config.ServiceProviders.Get(ctx, entityID)
+	if err != nil || len(sp.ACSURLs) == 0 {
+		http.Error(w, "unknown service provider", http.StatusBadRequest)
+		return
+	}
+
+	acsURL := sp.ACSURLs[0]
+	if req != nil && req.AssertionConsumerServiceURL != "" {
+		if !sp.AllowsACSURL(req.AssertionConsumerServiceURL) {
+			http.Error(w, "AssertionConsumerServiceURL is not registered for the service provider", http.StatusBadRequest)
+			return
+		}
+		acsURL = req.AssertionConsumerServiceURL
+	}
+
+	// Authenticate the user
+	session, err := idp.session(r)
+	if err != nil {
+		if idp.config.LoginURL == "" {
+			http.Error(w, "the user is not signed in", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, withParams(idp.config.LoginURL, url.Values{
+			"return_to": {idp.returnTo(req, entityID, relayState)},
+		}), http.StatusFound)
+		return
+	}
+
+	var response string
+	if sp.TenantID != "" && session.TenantID != sp.TenantID {
+		response, err = idp.denied(req, acsURL)
+	} else {
+		response, err = idp.response(req, sp, acsURL, session)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	postForm.Execute(w, map[string]string{
+		"URL":          acsURL,
+		"SAMLResponse": base64.StdEncoding.EncodeToString([]byte(response)),
+		"RelayState":   relayState,
+	})
+}
+
+// response builds a Response with a signed assertion for the user of a session
+func (idp *IdentityProvider) response(req *authnRequest, sp *ServiceProvider, acsURL string, session *lokstraauth.VerifyResponse) (string, error) {
+	identity := session.Identity
+	if identity == nil || identity.Subject == nil {
+		return "", errors.New("the session has no identity")
+	}
+
+	responseID, err := newID()
+	if err != nil {
+		return "", err
+	}
+	assertionID, err := newID()
+	if err != nil {
+		return "", err
+	}
+	inResponseTo := ""
+	if req != nil {
+		inResponseTo = req.ID
+	}
+
+	attributes := idp.config.AttributeMapper(identity, sp)
+	if session.TenantID != "" {
+		attributes["tenant_id"] = []string{session.TenantID}
+	}
+
+	nameIDFormat := sp.NameIDFormat
+	if nameIDFormat == "" && req != nil {
+		nameIDFormat = req.NameIDPolicy.Format
+	}
+	nameID := identity.Subject.ID
+	switch nameIDFormat {
+	case NameIDFormatEmail:
+		if emails := attributes["email"]; len(emails) > 0 {
+			nameID = emails[0]
+		} else {
+			nameIDFormat = NameIDFormatUnspecified
+		}
+	case NameIDFormatTransient:
+		if nameID, err = newID(); err != nil {
+			return "", err
+		}
+	case NameIDFormatPersistent:
+	default:
+		nameIDFormat = NameIDFormatUnspecified
+	}
+
+	sessionIndex := assertionID
+	if identity.Session != nil && identity.Session.ID != "" {
+		sessionIndex = identity.Session.ID
+	}
+
+	now := time.Now()
+	notOnOrAfter := instant(now.Add(idp.config.AssertionDuration))
+	authnInstant := now
+	if iat, ok := session.Claims.GetInt64("iat"); ok {
+		authnInstant = time.Unix(iat, 0)
+	}
+
+	assertion := element("saml:Assertion", []attr{
+		{"xmlns:saml", nsAssertion}, {"ID", assertionID}, {"IssueInstant", instant(now)}, {"Version", "2.0"},
+	},
+		element("saml:Issuer", nil, text(idp.config.EntityID)),
+		element("saml:Subject", nil,
+			element("saml:NameID", []attr{{"Format", nameIDFormat}}, text(nameID)),
+			element("saml:SubjectConfirmation", []attr{{"Method", "urn:oasis:names:tc:SAML:2.0:cm:bearer"}},
+				element("saml:SubjectConfirmationData", []attr{
+					{"InResponseTo", inResponseTo}, {"NotOnOrAfter", notOnOrAfter}, {"Recipient", acsURL},
+				}),
+			),
+		),
+		element("saml:Conditions", []attr{{"NotBefore", instant(now.Add(-time.Minute))}, {"NotOnOrAfter", notOnOrAfter}},
+			element("saml:AudienceRestriction", nil,
+				element("saml:Audience", nil, text(sp.EntityID)),
+			),
+		),
+		element("saml:AuthnStatement", []attr{{"AuthnInstant", instant(authnInstant)}, {"SessionIndex", sessionIndex}},
+			element("saml:AuthnContext", nil,
+				element("saml:AuthnContextClassRef", nil, "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"),
+			),
+		),
+		attributeStatement(attributes, sp.Attributes),
+	)
+
+	signed, err := sign(assertion, assertionID, idp.config.SigningKey, idp.config.Certificate.Raw)
+	if err != nil {
+		return "", err
+	}
+
+	return element("samlp:Response", []attr{
+		{"xmlns:samlp", nsProtocol}, {"xmlns:saml", nsAssertion},
+		{"Destination", acsURL}, {"ID", responseID}, {"InResponseTo", inResponseTo},
+		{"IssueInstant", instant(now)}, {"Version", "2.0"},
+	},
+		element("saml:Issuer", nil, text(idp.config.EntityID)),
+		element("samlp:Status", nil,
+			element("samlp:StatusCode", []attr{{"Value", "urn:oasis:names:tc:SAML:2.0:status:Success"}}),
+		),
+		signed,
+	), nil
+}
+
+// denied builds a Response refusing the request (user of another tenant)
+func (idp *IdentityProvider) denied(req *authnRequest, acsURL string) (string, error) {
+	responseID, err := newID()
+	if err != nil {
+		return "", err
+	}
+	inResponseTo := ""
+	if req != nil {
+		inResponseTo = req.ID
+	}
+
+	return element("samlp:Response", []attr{
+		{"xmlns:samlp", nsProtocol}, {"xmlns:saml", nsAssertion},
+		{"Destination", acsURL}, {"ID", responseID}, {"InResponseTo", inResponseTo},
+		{"IssueInstant", instant(time.Now())}, {"Version", "2.0"},
+	},
+		element("saml:Issuer", nil, text(idp.config.EntityID)),
+		element("samlp:Status", nil,
+			element("samlp:StatusCode", []attr{{"Value", "urn:oasis:names:tc:SAML:2.0:status:Responder"}},
+				element("samlp:StatusCode", []attr{{"Value", "urn:oasis:names:tc:SAML:2.0:status:RequestDenied"}}),
+			),
+			element("samlp:StatusMessage", nil, "the user does not belong to the tenant of the service provider"),
+		),
+	), nil
+}
+
+// attributeStatement builds the AttributeStatement of released attributes
+func attributeStatement(attributes map[string][]string, released []string) string {
+	names := make([]string, 0, len(attributes))
+	for name, values := range attributes {
+		if len(values) > 0 && (len(released) == 0 || slices.Contains(released, name)) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	slices.Sort(names)
+
+	statements := make([]string, 0, len(names))
+	for _, name := range names {
+		values := make([]string, len(attributes[name]))
+		for i, value := range attributes[name] {
+			values[i] = element("saml:AttributeValue", nil, text(value))
+		}
+		statements = append(statements, element("saml:Attribute", []attr{{"Name", name}, {"NameFormat", attrNameFormat}}, values...))
+	}
+	return element("saml:AttributeStatement", nil, statements...)
+}
+
+// DefaultAttributes maps the identity to the attributes email, name,
+// username, roles and groups (email and name are read from the identity
+// profile, then the subject attributes)
+func DefaultAttributes(identity *subject.IdentityContext, sp *ServiceProvider) map[string][]string {
+	attributes := map[string][]string{
+		"username": {identity.Subject.Principal},
+		"roles":    identity.Roles,
+		"groups":   identity.Groups,
+	}
+	for _, name := range []string{"email", "name"} {
+		value, ok := identity.Profile[name]
+		if !ok {
+			value, ok = identity.Subject.Attributes[name]
+		}
+		if s, isString := value.(string); ok && isString && s != "" {
+			attributes[name] = []string{s}
+		}
+	}
+	return attributes
+}
+
+// parseAuthnRequest parses the AuthnRequest of the HTTP-Redirect (deflated)
+// or HTTP-POST binding. It returns nil for IdP-initiated sign-on.
+func parseAuthnRequest(r *http.Request) (*authnRequest, error) {
+	encoded := r.Form.Get("SAMLRequest")
+	if encoded == "" {
+		if r.Form.Get("sp") == "" {
+			return nil, fmt.Errorf("%w: SAMLRequest or sp is required", ErrInvalidRequest)
+		}
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if r.Method == http.MethodGet {
+		if data, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), maxRequestSize)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+	}
+
+	var req authnRequest
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if req.ID == "" || req.Issuer == "" {
+		return nil, fmt.Errorf("%w: ID and Issuer are required", ErrInvalidRequest)
+	}
+	req.raw = data
+	return &req, nil
+}
+
+// returnTo returns the SSO URL to come back to after the login page, with
+// the request in the HTTP-Redirect binding
+func (idp *IdentityProvider) returnTo(req *authnRequest, entityID, relayState string) string {
+	params := url.Values{}
+	if req != nil {
+		var deflated bytes.Buffer
+		writer, _ := flate.NewWriter(&deflated, flate.BestCompression)
+		writer.Write(req.raw)
+		writer.Close()
+		params.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	} else {
+		params.Set("sp", entityID)
+	}
+	if relayState != "" {
+		params.Set("RelayState", relayState)
+	}
+	return idp.endpoint("/sso") + "?" + params.Encode()
+}
+
+// session verifies the session of the user at the SSO endpoint
+func (idp *IdentityProvider) session(r *http.Request) (*lokstraauth.VerifyResponse, error) {
+	tokenValue, err := idp.config.TokenExtractor(r)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := idp.config.Auth.Verify(r.Context(), &lokstraauth.VerifyRequest{
+		Token:                tokenValue,
+		BuildIdentityContext: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !verified.Valid {
+		return nil, lokstraauth.ErrAuthenticationFailed
+	}
+	return verified, nil
+}
+
+// RegisterServiceProvider registers a service provider
+func (idp *IdentityProvider) RegisterServiceProvider(ctx context.Context, sp *ServiceProvider) error {
+	if sp.EntityID == "" || len(sp.ACSURLs) == 0 {
+		return fmt.Errorf("%w: entity ID and at least one ACS URL are required", ErrInvalidRequest)
+	}
+	return idp.config.ServiceProviders.Create(ctx, sp)
+}
+
+// endpoint returns the absolute URL of an endpoint
+func (idp *IdentityProvider) endpoint(endpoint string) string {
+	return idp.config.BaseURL + idp.config.Prefix + endpoint
+}
+
+// withParams adds query parameters to a URL
+func withParams(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// mustPath returns the path of a validated URL
+func mustPath(rawURL string) string {
+	u, _ := url.Parse(rawURL)
+	return u.Path
+}
+
+// postForm posts the SAML response to the service provider (HTTP-POST binding)
+var postForm = template.Must(template.New("saml-post").Parse(`<!DOCTYPE html>
+<html>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.URL}}">
+<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}">
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">{{end}}
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>`))
@@ -0,0 +1,158 @@
+// Package saml lets lokstra-auth act as a SAML 2.0 identity provider for
+// service providers that do not speak OpenID Connect: it publishes IdP
+// metadata and answers authentication requests at the SSO endpoint with
+// signed assertions built from the user's IdentityContext.
+package saml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrServiceProviderNotFound = errors.New("service provider not found")
+	ErrServiceProviderExists   = errors.New("service provider already exists")
+)
+
+// Name ID formats
+const (
+	NameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatTransient   = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+)
+
+// ServiceProvider is a SAML service provider registered to federate with
+// the identity provider
+type ServiceProvider struct {
+	// EntityID identifies the service provider (the Issuer of its
+	// authentication requests)
+	EntityID string `json:"entity_id"`
+
+	// Name is a display name
+	Name string `json:"name,omitempty"`
+
+	// ACSURLs are the assertion consumer service URLs (HTTP-POST binding).
+	// Requests may only name one of them; the first is the default.
+	ACSURLs []string `json:"acs_urls"`
+
+	// NameIDFormat is the name ID format of assertions
+	// (default: the format requested, else unspecified = subject ID)
+	NameIDFormat string `json:"name_id_format,omitempty"`
+
+	// Attributes are the attribute names released to the service provider
+	// (empty = all)
+	Attributes []string `json:"attributes,omitempty"`
+
+	// TenantID restricts sign-in to users of one tenant (optional)
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// AllowsACSURL reports whether an assertion consumer service URL is registered
+func (sp *ServiceProvider) AllowsACSURL(acsURL string) bool {
+	return slices.Contains(sp.ACSURLs, acsURL)
+}
+
+// ServiceProviderStore stores registered service providers
+type ServiceProviderStore interface {
+	// Create registers a service provider
+	Create(ctx context.Context, sp *ServiceProvider) error
+
+	// Get retrieves a service provider by entity ID
+	Get(ctx context.Context, entityID string) (*ServiceProvider, error)
+
+	// Update replaces a service provider
+	Update(ctx context.Context, sp *ServiceProvider) error
+
+	// Delete removes a service provider
+	Delete(ctx context.Context, entityID string) error
+
+	// List returns all service providers
+	List(ctx context.Context) ([]*ServiceProvider, error)
+}
+
+// InMemoryServiceProviderStore is an in-memory implementation of
+// ServiceProviderStore
+type InMemoryServiceProviderStore struct {
+	mu        sync.RWMutex
+	providers map[string]*ServiceProvider
+}
+
+// NewInMemoryServiceProviderStore creates a new in-memory service provider store
+func NewInMemoryServiceProviderStore() *InMemoryServiceProviderStore {
+	return &InMemoryServiceProviderStore{
+		providers: make(map[string]*ServiceProvider),
+	}
+}
+
+// Create registers a service provider
+func (s *InMemoryServiceProviderStore) Create(ctx context.Context, sp *ServiceProvider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.providers[sp.EntityID]; exists {
+		return fmt.Errorf("%w: %s", ErrServiceProviderExists, sp.EntityID)
+	}
+	s.providers[sp.EntityID] = cloneServiceProvider(sp)
+	return nil
+}
+
+// Get retrieves a service provider by entity ID
+func (s *InMemoryServiceProviderStore) Get(ctx context.Context, entityID string) (*ServiceProvider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp, ok := s.providers[entityID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrServiceProviderNotFound, entityID)
+	}
+	return cloneServiceProvider(sp), nil
+}
+
+// Update replaces a service provider
+func (s *InMemoryServiceProviderStore) Update(ctx context.Context, sp *ServiceProvider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.providers[sp.EntityID]; !ok {
+		return fmt.Errorf("%w: %s", ErrServiceProviderNotFound, sp.EntityID)
+	}
+	s.providers[sp.EntityID] = cloneServiceProvider(sp)
+	return nil
+}
+
+// Delete removes a service provider
+func (s *InMemoryServiceProviderStore) Delete(ctx context.Context, entityID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.providers[entityID]; !ok {
+		return fmt.Errorf("%w: %s", ErrServiceProviderNotFound, entityID)
+	}
+	delete(s.providers, entityID)
+	return nil
+}
+
+// List returns all service providers ordered by entity ID
+func (s *InMemoryServiceProviderStore) List(ctx context.Context) ([]*ServiceProvider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	providers := make([]*ServiceProvider, 0, len(s.providers))
+	for _, sp := range s.providers {
+		providers = append(providers, cloneServiceProvider(sp))
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].EntityID < providers[j].EntityID })
+	return providers, nil
+}
+
+func cloneServiceProvider(sp *ServiceProvider) *ServiceProvider {
+	copied := *sp
+	copied.ACSURLs = slices.Clone(sp.ACSURLs)
+	copied.Attributes = slices.Clone(sp.Attributes)
+	return &copied
+}
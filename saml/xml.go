@@ -0,0 +1,135 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// XML namespaces and algorithms
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsDSig      = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N     = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algSHA256      = "http://www.w3.org/2001/04/xmlenc#sha256"
+	attrNameFormat = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+
+	bindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+)
+
+// attr is an XML attribute
+type attr struct {
+	name, value string
+}
+
+// element writes an element in exclusive canonical form (C14N): namespace
+// declarations first, attributes sorted, no empty-element tags. Elements
+// built this way are signed as written, so attributes must be unprefixed
+// (or namespace declarations) and prefixes declared on the signed element.
+func element(name string, attrs []attr, content ...string) string {
+	sorted := make([]attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a.value != "" || strings.HasPrefix(a.name, "xmlns") {
+			sorted = append(sorted, a)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		iNS, jNS := strings.HasPrefix(sorted[i].name, "xmlns"), strings.HasPrefix(sorted[j].name, "xmlns")
+		if iNS != jNS {
+			return iNS
+		}
+		return sorted[i].name < sorted[j].name
+	})
+
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for _, a := range sorted {
+		b.WriteString(" " + a.name + `="` + escapeAttr(a.value) + `"`)
+	}
+	b.WriteString(">")
+	for _, c := range content {
+		b.WriteString(c)
+	}
+	b.WriteString("</" + name + ">")
+	return b.String()
+}
+
+// text escapes character data as C14N does
+func text(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;").Replace(s)
+}
+
+// escapeAttr escapes an attribute value as C14N does
+func escapeAttr(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;").Replace(s)
+}
+
+// sign returns an assertion with an enveloped XML signature inserted after
+// its Issuer. The assertion must be in canonical form (see element).
+func sign(assertion, id string, signer crypto.Signer, certificate []byte) (string, error) {
+	digest := sha256.Sum256([]byte(assertion))
+
+	signedInfo := element("ds:SignedInfo", []attr{{"xmlns:ds", nsDSig}},
+		element("ds:CanonicalizationMethod", []attr{{"Algorithm", algExcC14N}}),
+		element("ds:SignatureMethod", []attr{{"Algorithm", algRSASHA256}}),
+		element("ds:Reference", []attr{{"URI", "#" + id}},
+			element("ds:Transforms", nil,
+				element("ds:Transform", []attr{{"Algorithm", algEnveloped}}),
+				element("ds:Transform", []attr{{"Algorithm", algExcC14N}}),
+			),
+			element("ds:DigestMethod", []attr{{"Algorithm", algSHA256}}),
+			element("ds:DigestValue", nil, base64.StdEncoding.EncodeToString(digest[:])),
+		),
+	)
+
+	hashed := sha256.Sum256([]byte(signedInfo))
+	signature, err := signer.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign assertion: %w", err)
+	}
+
+	signatureElement := element("ds:Signature", []attr{{"xmlns:ds", nsDSig}},
+		signedInfo,
+		element("ds:SignatureValue", nil, base64.StdEncoding.EncodeToString(signature)),
+		element("ds:KeyInfo", nil,
+			element("ds:X509Data", nil,
+				element("ds:X509Certificate", nil, base64.StdEncoding.EncodeToString(certificate)),
+			),
+		),
+	)
+
+	// The signature follows the Issuer (schema order)
+	issuerEnd := strings.Index(assertion, "</saml:Issuer>")
+	if issuerEnd < 0 {
+		return "", fmt.Errorf("assertion %s has no Issuer", id)
+	}
+	issuerEnd += len("</saml:Issuer>")
+	return assertion[:issuerEnd] + signatureElement + assertion[issuerEnd:], nil
+}
+
+// newID returns a random XML ID (IDs must not start with a digit)
+func newID() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return "_" + hex.EncodeToString(buf), nil
+}
+
+// instant formats a SAML timestamp
+func instant(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
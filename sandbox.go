@@ -0,0 +1,94 @@
+package lokstraauth
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// SandboxPolicy decides whether logins of a tenant or app are sandboxed.
+// Tokens issued in sandbox mode carry the authz.SandboxClaim, and requests
+// verified with them authorize against the sandbox partition of the tenant.
+type SandboxPolicy interface {
+	IsSandbox(ctx context.Context, tenantID, appID string) (bool, error)
+}
+
+// SandboxPolicyFunc adapts a function to a SandboxPolicy
+type SandboxPolicyFunc func(ctx context.Context, tenantID, appID string) (bool, error)
+
+// IsSandbox calls f(ctx, tenantID, appID)
+func (f SandboxPolicyFunc) IsSandbox(ctx context.Context, tenantID, appID string) (bool, error) {
+	return f(ctx, tenantID, appID)
+}
+
+// StaticSandboxPolicy flags tenants and apps as sandboxed in memory
+type StaticSandboxPolicy struct {
+	mu      sync.RWMutex
+	tenants map[string]bool
+	apps    map[string]bool // tenantID + "/" + appID -> sandbox
+}
+
+// NewStaticSandboxPolicy creates a new in-memory sandbox policy
+func NewStaticSandboxPolicy() *StaticSandboxPolicy {
+	return &StaticSandboxPolicy{
+		tenants: make(map[string]bool),
+		apps:    make(map[string]bool),
+	}
+}
+
+// SetTenant flags every app of a tenant as sandboxed (or not)
+func (p *StaticSandboxPolicy) SetTenant(tenantID string, sandbox bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tenants[tenantID] = sandbox
+}
+
+// SetApp flags an app of a tenant as sandboxed (or not). An app flag
+// overrides the tenant flag.
+func (p *StaticSandboxPolicy) SetApp(tenantID, appID string, sandbox bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.apps[tenantID+"/"+appID] = sandbox
+}
+
+// IsSandbox reports whether an app of a tenant is sandboxed
+func (p *StaticSandboxPolicy) IsSandbox(ctx context.Context, tenantID, appID string) (bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if appID != "" {
+		if sandbox, ok := p.apps[tenantID+"/"+appID]; ok {
+			return sandbox, nil
+		}
+	}
+	return p.tenants[tenantID], nil
+}
+
+// markSandbox returns the claims to issue and the login context: in sandbox
+// mode the claims are copied with the sandbox marker and the context is
+// switched to the sandbox partition
+func (a *Auth) markSandbox(ctx context.Context, claims map[string]any) (context.Context, map[string]any, error) {
+	if a.config.Sandbox == nil {
+		return ctx, claims, nil
+	}
+
+	sandbox, err := a.config.Sandbox.IsSandbox(ctx, authz.TenantFromContext(ctx), authz.AppFromContext(ctx))
+	if err != nil || !sandbox {
+		return ctx, claims, err
+	}
+
+	marked := make(map[string]any, len(claims)+1)
+	maps.Copy(marked, claims)
+	marked[authz.SandboxClaim] = true
+
+	return authz.WithSandbox(ctx), marked, nil
+}
+
+// isSandboxToken reports whether verified claims carry the sandbox marker
+func isSandboxToken(claims token.Claims) bool {
+	sandbox, _ := claims.GetBool(authz.SandboxClaim)
+	return sandbox
+}
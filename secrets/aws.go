@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// AWSSecretsManagerClient fetches a secret string by ID.
+// It is satisfied by a thin adapter over the AWS SDK GetSecretValue call,
+// keeping the SDK out of this module's dependencies.
+type AWSSecretsManagerClient interface {
+	// GetSecretString returns the SecretString of the secret
+	GetSecretString(ctx context.Context, secretID string) (string, error)
+}
+
+// AWSSecretsManagerResolver resolves "aws-sm:<secret-id>[#key]" references.
+// With a key the secret string is parsed as a JSON object.
+type AWSSecretsManagerResolver struct {
+	client AWSSecretsManagerClient
+}
+
+// NewAWSSecretsManagerResolver creates a new AWS Secrets Manager resolver
+func NewAWSSecretsManagerResolver(client AWSSecretsManagerClient) *AWSSecretsManagerResolver {
+	return &AWSSecretsManagerResolver{client: client}
+}
+
+// Resolve returns the secret string or the JSON field named by the key
+func (r *AWSSecretsManagerResolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	if r.client == nil {
+		return "", ErrResolverNotConfigured
+	}
+
+	secret, err := r.client.GetSecretString(ctx, ref.Path())
+	if err != nil {
+		return "", err
+	}
+
+	if ref.Key() == "" {
+		return secret, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("%w: secret is not a JSON object", ErrInvalidSecretRef)
+	}
+
+	return lookupKey(fields, ref.Key())
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvResolver resolves "env:NAME" references from environment variables
+type EnvResolver struct{}
+
+// NewEnvResolver creates a new environment variable resolver
+func NewEnvResolver() *EnvResolver {
+	return &EnvResolver{}
+}
+
+// Resolve returns the value of the environment variable
+func (r *EnvResolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	value, ok := os.LookupEnv(ref.Path())
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// FileResolver resolves "file:/path" references from files (e.g., Docker/Kubernetes secrets).
+// With a key ("file:/path#key") the file is parsed as a JSON object.
+type FileResolver struct{}
+
+// NewFileResolver creates a new file resolver
+func NewFileResolver() *FileResolver {
+	return &FileResolver{}
+}
+
+// Resolve returns the trimmed file content or the JSON field named by the key
+func (r *FileResolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	data, err := os.ReadFile(ref.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrSecretNotFound
+		}
+		return "", err
+	}
+
+	if ref.Key() == "" {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("%w: file is not a JSON object", ErrInvalidSecretRef)
+	}
+
+	return lookupKey(fields, ref.Key())
+}
+
+// lookupKey returns a field of a secret document as a string
+func lookupKey(fields map[string]any, key string) (string, error) {
+	value, ok := fields[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvFileResolver resolves "envfile:/path/.env#NAME" references from
+// dotenv files. The file is read on every resolve, so edits (and
+// rotations) are picked up without a restart.
+//
+// Lines are NAME=value; blank lines, "#" comments and an "export " prefix
+// are ignored. Values may be single-quoted (literal) or double-quoted
+// (with \n, \t, \" and \\ escapes).
+type EnvFileResolver struct{}
+
+// NewEnvFileResolver creates a new dotenv file resolver
+func NewEnvFileResolver() *EnvFileResolver {
+	return &EnvFileResolver{}
+}
+
+// Resolve returns the value of the variable named by the key
+func (r *EnvFileResolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	if ref.Key() == "" {
+		return "", fmt.Errorf("%w: envfile reference requires a #NAME", ErrInvalidSecretRef)
+	}
+
+	data, err := os.ReadFile(ref.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrSecretNotFound
+		}
+		return "", err
+	}
+
+	values, err := ParseEnvFile(data)
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[ref.Key()]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// ParseEnvFile parses the content of a dotenv file
+func ParseEnvFile(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%w: envfile line %d is not NAME=value", ErrInvalidSecretRef, lineNumber)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: envfile line %d has an invalid quoted value", ErrInvalidSecretRef, lineNumber)
+			}
+			value = unquoted
+		default:
+			// Unquoted values end at an inline comment
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		values[name] = value
+	}
+	return values, scanner.Err()
+}
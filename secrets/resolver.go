@@ -0,0 +1,117 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrSecretNotFound        = errors.New("secret not found")
+	ErrUnknownScheme         = errors.New("unknown secret scheme")
+	ErrInvalidSecretRef      = errors.New("invalid secret reference")
+	ErrResolverNotConfigured = errors.New("secret resolver not configured")
+)
+
+// Ref is a reference to a secret in the form "<scheme>:<path>[#<key>]",
+// e.g. "env:JWT_SECRET", "file:/run/secrets/jwt",
+// "envfile:/etc/auth/.env#SMTP_PASSWORD", "vault:secret/data/auth#jwt_key",
+// "aws-sm:prod/auth#smtp_password". A value without a known scheme is a literal.
+type Ref string
+
+// Scheme returns the scheme part of the reference
+func (r Ref) Scheme() string {
+	scheme, _, ok := strings.Cut(string(r), ":")
+	if !ok {
+		return ""
+	}
+	return scheme
+}
+
+// Path returns the path part of the reference (without scheme and key)
+func (r Ref) Path() string {
+	_, rest, ok := strings.Cut(string(r), ":")
+	if !ok {
+		return string(r)
+	}
+	path, _, _ := strings.Cut(rest, "#")
+	return path
+}
+
+// Key returns the key part of the reference (after '#'), if any
+func (r Ref) Key() string {
+	_, key, _ := strings.Cut(string(r), "#")
+	return key
+}
+
+// SecretResolver resolves secret references into secret values
+type SecretResolver interface {
+	// Resolve returns the secret value for a reference
+	Resolve(ctx context.Context, ref Ref) (string, error)
+}
+
+// ResolverFunc adapts a function to SecretResolver
+type ResolverFunc func(ctx context.Context, ref Ref) (string, error)
+
+// Resolve calls the function
+func (f ResolverFunc) Resolve(ctx context.Context, ref Ref) (string, error) {
+	return f(ctx, ref)
+}
+
+// Registry dispatches references to resolvers by scheme.
+// References with an unregistered scheme are returned as literals.
+type Registry struct {
+	mu        sync.RWMutex
+	resolvers map[string]SecretResolver
+}
+
+// NewRegistry creates a registry with the env, file and envfile resolvers
+// registered
+func NewRegistry() *Registry {
+	r := &Registry{
+		resolvers: make(map[string]SecretResolver),
+	}
+	r.Register("env", NewEnvResolver())
+	r.Register("file", NewFileResolver())
+	r.Register("envfile", NewEnvFileResolver())
+	return r
+}
+
+// Register registers a resolver for a scheme
+func (r *Registry) Register(scheme string, resolver SecretResolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolvers[scheme] = resolver
+}
+
+// Resolve resolves a reference using the resolver registered for its scheme
+func (r *Registry) Resolve(ctx context.Context, ref Ref) (string, error) {
+	scheme := ref.Scheme()
+
+	r.mu.RLock()
+	resolver, ok := r.resolvers[scheme]
+	r.mu.RUnlock()
+
+	if !ok {
+		// Not a secret reference, treat as literal value
+		return string(ref), nil
+	}
+
+	value, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s secret %q: %w", scheme, ref.Path(), err)
+	}
+
+	return value, nil
+}
+
+// MustResolve resolves a reference or panics (for use during startup)
+func MustResolve(ctx context.Context, resolver SecretResolver, ref Ref) string {
+	value, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
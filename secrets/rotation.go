@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RotationFunc is called with the new value of a rotated secret
+type RotationFunc func(ctx context.Context, ref Ref, value string)
+
+// WatcherConfig holds configuration for the secret watcher
+type WatcherConfig struct {
+	// Resolver resolves the watched references (required)
+	Resolver SecretResolver
+
+	// Interval is how often references are re-resolved (default: 5 minutes)
+	Interval time.Duration
+
+	// OnError is called when a reference fails to resolve; the previous
+	// value stays in effect (optional)
+	OnError func(ref Ref, err error)
+}
+
+// Watcher re-resolves secret references periodically and calls the
+// rotation callbacks of a reference when its value changes, e.g. to swap a
+// JWT HMAC key, an OAuth2 client secret or SMTP credentials at runtime.
+type Watcher struct {
+	config *WatcherConfig
+
+	mu      sync.Mutex
+	watches map[Ref]*watch
+	nextID  int
+}
+
+// watch is a watched reference
+type watch struct {
+	value     string
+	callbacks map[int]RotationFunc
+}
+
+// NewWatcher creates a secret watcher. Call Run to start polling.
+func NewWatcher(config *WatcherConfig) *Watcher {
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+	return &Watcher{
+		config:  config,
+		watches: make(map[Ref]*watch),
+	}
+}
+
+// Watch resolves a reference, returns its current value and calls fn with
+// each new value. The returned function stops the callback.
+func (w *Watcher) Watch(ctx context.Context, ref Ref, fn RotationFunc) (string, func(), error) {
+	value, err := w.config.Resolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	watched, ok := w.watches[ref]
+	if !ok {
+		watched = &watch{value: value, callbacks: make(map[int]RotationFunc)}
+		w.watches[ref] = watched
+	}
+	w.nextID++
+	id := w.nextID
+	watched.callbacks[id] = fn
+
+	unsubscribe := func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(watched.callbacks, id)
+		if len(watched.callbacks) == 0 && w.watches[ref] == watched {
+			delete(w.watches, ref)
+		}
+	}
+	return watched.value, unsubscribe, nil
+}
+
+// Run re-resolves the watched references every interval until the context
+// is done
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Check re-resolves the watched references now, e.g. when a secret manager
+// announces a rotation
+func (w *Watcher) Check(ctx context.Context) {
+	w.mu.Lock()
+	refs := make([]Ref, 0, len(w.watches))
+	for ref := range w.watches {
+		refs = append(refs, ref)
+	}
+	w.mu.Unlock()
+
+	for _, ref := range refs {
+		value, err := w.config.Resolver.Resolve(ctx, ref)
+		if err != nil {
+			if w.config.OnError != nil {
+				w.config.OnError(ref, err)
+			}
+			continue
+		}
+
+		w.mu.Lock()
+		watched, ok := w.watches[ref]
+		if !ok || watched.value == value {
+			w.mu.Unlock()
+			continue
+		}
+		watched.value = value
+		callbacks := make([]RotationFunc, 0, len(watched.callbacks))
+		for _, fn := range watched.callbacks {
+			callbacks = append(callbacks, fn)
+		}
+		w.mu.Unlock()
+
+		for _, fn := range callbacks {
+			fn(ctx, ref, value)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultConfig holds configuration for the HashiCorp Vault resolver
+type VaultConfig struct {
+	// Address is the Vault server address (e.g., "https://vault:8200")
+	Address string
+
+	// Token is the Vault token used for requests
+	Token string
+
+	// Namespace is the Vault Enterprise namespace (optional)
+	Namespace string
+
+	// HTTPClient is the HTTP client (default: 10 second timeout)
+	HTTPClient *http.Client
+}
+
+// VaultResolver resolves "vault:<path>#<key>" references from Vault KV
+// (v1 or v2) using the HTTP API, e.g. "vault:secret/data/auth#jwt_key"
+type VaultResolver struct {
+	config *VaultConfig
+}
+
+// NewVaultResolver creates a new Vault resolver
+func NewVaultResolver(config *VaultConfig) *VaultResolver {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &VaultResolver{config: config}
+}
+
+// Resolve reads the secret at the path and returns the field named by the key
+func (r *VaultResolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	if ref.Key() == "" {
+		return "", fmt.Errorf("%w: vault reference requires a #key", ErrInvalidSecretRef)
+	}
+
+	url := strings.TrimRight(r.config.Address, "/") + "/v1/" + strings.TrimLeft(ref.Path(), "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", r.config.Token)
+	if r.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.config.Namespace)
+	}
+
+	resp, err := r.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	fields := body.Data
+	// KV v2 nests the secret under data.data
+	if nested, ok := fields["data"].(map[string]any); ok {
+		if _, hasMeta := fields["metadata"]; hasMeta {
+			fields = nested
+		}
+	}
+
+	return lookupKey(fields, ref.Key())
+}
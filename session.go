@@ -0,0 +1,320 @@
+package lokstraauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/audit"
+)
+
+var (
+	ErrNoIdentityStore      = errors.New("no identity store configured")
+	ErrSessionsNotSupported = errors.New("identity store does not support listing sessions")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrSessionExpired       = errors.New("session expired")
+	ErrSessionLimitExceeded = errors.New("concurrent session limit exceeded")
+)
+
+// SessionPolicy controls server-side session lifetime and limits
+type SessionPolicy struct {
+	// IdleTimeout expires sessions not used for this long (0 = disabled)
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout expires sessions this long after creation (default: 24h)
+	AbsoluteTimeout time.Duration
+
+	// MaxConcurrent limits active sessions per subject (0 = unlimited)
+	MaxConcurrent int
+
+	// EvictOldest removes the oldest session when MaxConcurrent is reached,
+	// instead of rejecting the new session
+	EvictOldest bool
+}
+
+// DefaultSessionPolicy returns the default session policy
+func DefaultSessionPolicy() *SessionPolicy {
+	return &SessionPolicy{
+		IdleTimeout:     30 * time.Minute,
+		AbsoluteTimeout: 24 * time.Hour,
+	}
+}
+
+// SessionPolicyResolver selects the session policy for an identity
+// (e.g., per tenant or per role). Returning nil uses Config.SessionPolicy.
+type SessionPolicyResolver func(ctx context.Context, identity *subject.IdentityContext) *SessionPolicy
+
+// SessionRequest carries client information captured when creating a session
+type SessionRequest struct {
+	// IPAddress is the client IP address
+	IPAddress string
+
+	// UserAgent is the client user agent
+	UserAgent string
+
+	// Device is the registered device the session is created from (optional)
+	Device *subject.DeviceInfo
+
+	// Metadata contains additional session metadata
+	Metadata map[string]any
+}
+
+// CreateSession creates a server-side session for an identity, enforcing the
+// concurrent-session limit of the identity's session policy
+func (a *Auth) CreateSession(ctx context.Context, identity *subject.IdentityContext, request *SessionRequest) (*subject.SessionInfo, error) {
+	if a.identityStore == nil {
+		return nil, ErrNoIdentityStore
+	}
+	if identity == nil || identity.Subject == nil || identity.Subject.ID == "" {
+		return nil, ErrMissingSubject
+	}
+	if request == nil {
+		request = &SessionRequest{}
+	}
+
+	policy := a.sessionPolicy(ctx, identity)
+
+	// Enforce concurrent session limit
+	if policy.MaxConcurrent > 0 {
+		if err := a.enforceSessionLimit(ctx, identity.Subject.ID, policy); err != nil {
+			return nil, err
+		}
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	absolute := policy.AbsoluteTimeout
+	if absolute <= 0 {
+		absolute = 24 * time.Hour
+	}
+
+	info := &subject.SessionInfo{
+		ID:             sessionID,
+		CreatedAt:      now.Unix(),
+		ExpiresAt:      now.Add(absolute).Unix(),
+		IPAddress:      request.IPAddress,
+		UserAgent:      request.UserAgent,
+		LastActivityAt: now.Unix(),
+		Device:         request.Device,
+		Metadata:       maps.Clone(request.Metadata),
+	}
+
+	// Keep the location resolved by enrichers (e.g., enriched.GeoIPEnricher)
+	if identity.Session != nil {
+		info.Location = identity.Session.Location
+		info.IPReputation = identity.Session.IPReputation
+	}
+
+	// Store a copy so the caller's identity is not modified
+	sessionIdentity := *identity
+	sessionIdentity.Session = info
+
+	if err := a.exec(ctx, "identity", "store session", func(ctx context.Context) error {
+		return a.identityStore.Store(ctx, sessionID, &sessionIdentity)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+
+	return info, nil
+}
+
+// GetSession returns the identity of an active session and records activity.
+// Sessions past their idle or absolute timeout are removed.
+func (a *Auth) GetSession(ctx context.Context, sessionID string) (*subject.IdentityContext, error) {
+	if a.identityStore == nil {
+		return nil, ErrNoIdentityStore
+	}
+
+	identity, err := query(ctx, a, "identity", "get session",
+		func(ctx context.Context) (*subject.IdentityContext, error) {
+			return a.identityStore.Get(ctx, sessionID)
+		})
+	if errors.Is(err, ErrTimeout) {
+		return nil, err
+	}
+	if err != nil || identity == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	now := time.Now()
+	if a.isSessionExpired(ctx, identity, now) {
+		_ = a.identityStore.Delete(ctx, sessionID)
+		return nil, fmt.Errorf("%w: %s", ErrSessionExpired, sessionID)
+	}
+
+	// Record activity (copy to avoid racing readers of the stored identity)
+	if identity.Session != nil {
+		touched := *identity
+		session := *identity.Session
+		session.LastActivityAt = now.Unix()
+		touched.Session = &session
+
+		if err := a.exec(ctx, "identity", "update session", func(ctx context.Context) error {
+			return a.identityStore.Update(ctx, sessionID, &touched)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to update session: %w", err)
+		}
+		identity = &touched
+	}
+
+	return identity, nil
+}
+
+// ListSessions lists the active sessions of a subject, newest first
+func (a *Auth) ListSessions(ctx context.Context, subjectID string) ([]*subject.SessionInfo, error) {
+	identities, err := a.listSessionIdentities(ctx, subjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*subject.SessionInfo, 0, len(identities))
+	for _, identity := range identities {
+		sessions = append(sessions, identity.Session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt > sessions[j].CreatedAt
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession removes a session
+func (a *Auth) RevokeSession(ctx context.Context, sessionID string) error {
+	if a.identityStore == nil {
+		return ErrNoIdentityStore
+	}
+
+	if err := a.identityStore.Delete(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventTokenRevoked,
+		Resource:  "session:" + sessionID,
+		Result:    audit.ResultSuccess,
+	})
+	a.publishRevoked(ctx, "", "session_revoked")
+	return nil
+}
+
+// listSessionIdentities returns the active (non-expired) session identities of a subject
+func (a *Auth) listSessionIdentities(ctx context.Context, subjectID string) ([]*subject.IdentityContext, error) {
+	if a.identityStore == nil {
+		return nil, ErrNoIdentityStore
+	}
+	if subjectID == "" {
+		return nil, ErrMissingSubject
+	}
+
+	store, ok := a.identityStore.(subject.SubjectSessionStore)
+	if !ok {
+		return nil, ErrSessionsNotSupported
+	}
+
+	identities, err := store.ListBySubject(ctx, subjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	now := time.Now()
+	active := make([]*subject.IdentityContext, 0, len(identities))
+	for _, identity := range identities {
+		if identity.Session == nil {
+			continue
+		}
+		if a.isSessionExpired(ctx, identity, now) {
+			_ = a.identityStore.Delete(ctx, identity.Session.ID)
+			continue
+		}
+		active = append(active, identity)
+	}
+
+	return active, nil
+}
+
+// enforceSessionLimit makes room for a new session or rejects it
+func (a *Auth) enforceSessionLimit(ctx context.Context, subjectID string, policy *SessionPolicy) error {
+	identities, err := a.listSessionIdentities(ctx, subjectID)
+	if err != nil {
+		return err
+	}
+
+	excess := len(identities) - policy.MaxConcurrent + 1
+	if excess <= 0 {
+		return nil
+	}
+
+	if !policy.EvictOldest {
+		return fmt.Errorf("%w: maximum %d sessions", ErrSessionLimitExceeded, policy.MaxConcurrent)
+	}
+
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].Session.CreatedAt < identities[j].Session.CreatedAt
+	})
+
+	for _, identity := range identities[:excess] {
+		if err := a.identityStore.Delete(ctx, identity.Session.ID); err != nil {
+			return fmt.Errorf("failed to evict session: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// isSessionExpired checks the absolute and idle timeouts of a session
+func (a *Auth) isSessionExpired(ctx context.Context, identity *subject.IdentityContext, now time.Time) bool {
+	session := identity.Session
+	if session == nil {
+		return false
+	}
+
+	if session.ExpiresAt > 0 && now.Unix() >= session.ExpiresAt {
+		return true
+	}
+
+	policy := a.sessionPolicy(ctx, identity)
+	if policy.IdleTimeout > 0 && session.LastActivityAt > 0 {
+		idleSince := time.Unix(session.LastActivityAt, 0)
+		if now.Sub(idleSince) > policy.IdleTimeout {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sessionPolicy returns the session policy for an identity, with the
+// session settings of the context tenant and app applied
+func (a *Auth) sessionPolicy(ctx context.Context, identity *subject.IdentityContext) *SessionPolicy {
+	policy := a.config.SessionPolicy
+	if a.config.SessionPolicyResolver != nil {
+		if resolved := a.config.SessionPolicyResolver(ctx, identity); resolved != nil {
+			policy = resolved
+		}
+	}
+	if policy == nil {
+		policy = DefaultSessionPolicy()
+	}
+
+	return a.applySessionSettings(ctx, policy)
+}
+
+// newSessionID generates a random session identifier
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
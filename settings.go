@@ -0,0 +1,230 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	token "github.com/primadi/lokstra-auth/02_token"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/autherrors"
+	"github.com/primadi/lokstra-auth/tenant"
+)
+
+var (
+	ErrAuthenticatorNotAllowed = autherrors.New(autherrors.ErrPermissionDenied, "authenticator is not allowed for this tenant")
+	ErrAccountLocked           = autherrors.New(autherrors.ErrRateLimited, "account is temporarily locked")
+)
+
+// AuthSettingsSource supplies the auth settings of tenants and apps (e.g., a
+// tenant.AuthSettingsCache). The runtime consults the settings of the tenant
+// and app of the login context (authz.WithTenant, authz.WithApp) for the
+// allowed authenticators, account lockout, session policy, token lifetimes
+// and the MFA requirement; unset settings keep the runtime configuration.
+type AuthSettingsSource interface {
+	EffectiveAuthSettings(ctx context.Context, tenantID, appID string) (*tenant.TenantAuthSettings, error)
+}
+
+// authSettings returns the auth settings of the context tenant and app (nil
+// without a settings source or tenant)
+func (a *Auth) authSettings(ctx context.Context) (*tenant.TenantAuthSettings, error) {
+	tenantID := authz.TenantFromContext(ctx)
+	if a.config.AuthSettings == nil || tenantID == "" {
+		return nil, nil
+	}
+
+	settings, err := a.config.AuthSettings.EffectiveAuthSettings(ctx, tenantID, authz.AppFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load auth settings: %w", err)
+	}
+	return settings, nil
+}
+
+// checkLogin rejects logins with a credential type the settings do not allow
+// or to a locked account. It returns the lockout key of the account ("" if
+// failed logins are not counted).
+func (a *Auth) checkLogin(ctx context.Context, settings *tenant.TenantAuthSettings, credentials credential.Credentials) (string, error) {
+	if settings == nil {
+		return "", nil
+	}
+	if !settings.AllowsAuthenticator(credentials.Type()) {
+		return "", fmt.Errorf("%w: %s", ErrAuthenticatorNotAllowed, credentials.Type())
+	}
+
+	account, ok := credentials.(credential.AccountCredentials)
+	if !ok || settings.LockoutThreshold <= 0 || account.Account() == "" {
+		return "", nil
+	}
+
+	// Failures recorded in the attempt store lock accounts across instances
+	if a.attempts != nil {
+		until, locked, err := a.storedLockout(ctx, settings, account.Account())
+		if err != nil {
+			return "", err
+		}
+		if locked {
+			return "", fmt.Errorf("%w until %s", ErrAccountLocked, until.Format(time.RFC3339))
+		}
+		return "", nil
+	}
+
+	key := settings.TenantID + "/" + settings.AppID + "/" + account.Account()
+	if until, locked := a.lockouts.lockedUntil(key); locked {
+		return "", fmt.Errorf("%w until %s", ErrAccountLocked, until.Format(time.RFC3339))
+	}
+	return key, nil
+}
+
+// isCredentialFailure reports whether an authentication failed because of
+// the credentials, rather than of an unavailable authenticator
+func isCredentialFailure(result *credential.AuthenticationResult, err error) bool {
+	if err != nil {
+		return errors.Is(err, autherrors.ErrInvalidCredentials)
+	}
+	return result == nil || !result.Success
+}
+
+// withTokenLifetimes returns a context generating tokens with the lifetimes
+// of the settings (if set)
+func withTokenLifetimes(ctx context.Context, settings *tenant.TenantAuthSettings) context.Context {
+	if settings == nil || settings.AccessTokenTTL <= 0 && settings.RefreshTokenTTL <= 0 {
+		return ctx
+	}
+	return token.WithLifetimes(ctx, token.Lifetimes{
+		Access:  settings.AccessTokenTTL,
+		Refresh: settings.RefreshTokenTTL,
+	})
+}
+
+// applySessionSettings returns the policy with the session settings of the
+// context tenant and app applied. Settings that fail to load leave the
+// policy unchanged.
+func (a *Auth) applySessionSettings(ctx context.Context, policy *SessionPolicy) *SessionPolicy {
+	settings, err := a.authSettings(ctx)
+	if err != nil || settings == nil {
+		return policy
+	}
+
+	applied := *policy
+	if settings.SessionIdleTimeout > 0 {
+		applied.IdleTimeout = settings.SessionIdleTimeout
+	}
+	if settings.SessionAbsoluteTimeout > 0 {
+		applied.AbsoluteTimeout = settings.SessionAbsoluteTimeout
+	}
+	if settings.MaxConcurrentSessions > 0 {
+		applied.MaxConcurrent = settings.MaxConcurrentSessions
+	}
+	return &applied
+}
+
+// lockoutPruneInterval is how often failed login counts are swept for
+// expired entries
+const lockoutPruneInterval = time.Minute
+
+// loginLockouts counts the failed logins of accounts and locks accounts
+// reaching the lockout threshold of their settings. Counts are dropped once
+// their window and lockout are over, so failures for many accounts (e.g.,
+// usernames sprayed by an attacker) do not accumulate.
+type loginLockouts struct {
+	mu       sync.Mutex
+	accounts map[string]*lockoutState // tenantID/appID/account -> state
+	pruned   time.Time
+}
+
+type lockoutState struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+	expiresAt   time.Time // end of the window or lockout, whichever is later
+}
+
+// lockedUntil reports whether an account is locked, and until when
+func (l *loginLockouts) lockedUntil(key string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.accounts[key]
+	if !ok || state.lockedUntil.IsZero() {
+		return time.Time{}, false
+	}
+	if time.Now().After(state.lockedUntil) {
+		delete(l.accounts, key)
+		return time.Time{}, false
+	}
+	return state.lockedUntil, true
+}
+
+// anyLocked reports whether any of the keys is locked
+func (l *loginLockouts) anyLocked(keys []string) bool {
+	for _, key := range keys {
+		if _, locked := l.lockedUntil(key); locked {
+			return true
+		}
+	}
+	return false
+}
+
+// lockoutPolicy returns the lockout window and duration of the settings
+// (default: a 15 minute lockout, counting failures over the same window)
+func lockoutPolicy(settings *tenant.TenantAuthSettings) (window, duration time.Duration) {
+	duration = settings.LockoutDuration
+	if duration <= 0 {
+		duration = 15 * time.Minute
+	}
+	window = settings.LockoutWindow
+	if window <= 0 {
+		window = duration
+	}
+	return window, duration
+}
+
+// fail records a failed login, locking the account for duration once
+// threshold failures happened within window
+func (l *loginLockouts) fail(key string, threshold int, window, duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	state, ok := l.accounts[key]
+	if !ok || now.Sub(state.windowStart) > window {
+		state = &lockoutState{windowStart: now, expiresAt: now.Add(window)}
+		if l.accounts == nil {
+			l.accounts = make(map[string]*lockoutState)
+		}
+		l.accounts[key] = state
+	}
+
+	state.failures++
+	if state.failures >= threshold {
+		state.lockedUntil = now.Add(duration)
+		if state.lockedUntil.After(state.expiresAt) {
+			state.expiresAt = state.lockedUntil
+		}
+	}
+}
+
+// prune drops the expired counts, at most once per lockoutPruneInterval.
+// The caller holds the lock.
+func (l *loginLockouts) prune(now time.Time) {
+	if now.Sub(l.pruned) < lockoutPruneInterval {
+		return
+	}
+	l.pruned = now
+	for key, state := range l.accounts {
+		if now.After(state.expiresAt) {
+			delete(l.accounts, key)
+		}
+	}
+}
+
+// reset clears the failed logins of an account after a successful login
+func (l *loginLockouts) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.accounts, key)
+}
@@ -0,0 +1,159 @@
+package lokstraauth
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	token "github.com/primadi/lokstra-auth/02_token"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrMissingAuthMethod = autherrors.New(autherrors.ErrInvalidRequest, "authentication method is required")
+	ErrStepUpInvalid     = autherrors.New(autherrors.ErrTokenInvalid, "token cannot be stepped up")
+)
+
+// StepUp reissues a valid access token after the subject authenticated
+// again, typically by verifying a second factor (method "otp", "passkey",
+// ...), so endpoints requiring recent or stronger authentication accept it
+// (see middleware.RequireRecentAuth). The new token has a fresh auth_time,
+// the method added to amr, and the multi-factor acr once two methods were
+// used. The caller must have verified the factor: StepUp does not.
+func (a *Auth) StepUp(ctx context.Context, tokenValue, method string) (*token.Token, error) {
+	if a.tokenManager == nil {
+		return nil, ErrNoTokenManager
+	}
+	if method == "" {
+		return nil, ErrMissingAuthMethod
+	}
+
+	verifyResult, err := inLayer(ctx, a, LayerToken, "verify token",
+		func(ctx context.Context) (*token.VerificationResult, error) {
+			return a.verifyToken(ctx, tokenValue, nil)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("token verification error: %w", err)
+	}
+	if !verifyResult.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrStepUpInvalid, verifyResult.Error)
+	}
+	original := verifyResult.Claims
+	switch original.TokenType() {
+	case token.TokenTypeRefresh, token.TokenTypeMFAPending:
+		return nil, fmt.Errorf("%w: %s token", ErrStepUpInvalid, original.TokenType())
+	}
+	ctx, err = bindTokenTenant(ctx, original)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStepUpInvalid, err)
+	}
+	subjectID, _ := original.GetString("sub")
+
+	claims := make(map[string]any, len(original)+3)
+	maps.Copy(claims, original)
+	// The token manager sets the times and ID of the new token
+	for _, claim := range []string{"exp", "iat", "nbf", "jti"} {
+		delete(claims, claim)
+	}
+	token.StampAuthentication(claims, time.Now(), method)
+
+	settings, err := a.authSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	tok, err := inLayer(withTokenLifetimes(ctx, settings), a, LayerToken, "generate stepped-up token",
+		func(ctx context.Context) (*token.Token, error) {
+			return a.tokenManager.Generate(ctx, claims)
+		})
+	a.observeIssue(token.TokenTypeAccess, start, err)
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventTokenSteppedUp,
+		ActorID:   subjectID,
+		SubjectID: subjectID,
+		Action:    "step_up",
+		Result:    auditResult(err),
+		Metadata:  auditMetadata(err, "method", method),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenGenerationFailed, err)
+	}
+
+	a.emit(ctx, token.EventIssued, subjectID, token.TokenTypeAccess, tok, nil)
+	return tok, nil
+}
+
+// withAuthMethod returns the authentication result with the credential type
+// as its "auth_method" claim, unless the authenticator set one
+func withAuthMethod(authResult *credential.AuthenticationResult, credType string) *credential.AuthenticationResult {
+	if authResult == nil || !authResult.Success {
+		return authResult
+	}
+	if method, _ := authResult.Claims["auth_method"].(string); method != "" {
+		return authResult
+	}
+
+	result := *authResult
+	result.Claims = make(map[string]any, len(authResult.Claims)+1)
+	maps.Copy(result.Claims, authResult.Claims)
+	result.Claims["auth_method"] = credType
+	return &result
+}
+
+// authenticationClaims returns the login claims with the authentication
+// recorded: auth_time, acr and the "auth_method" claim as amr
+func authenticationClaims(claims map[string]any, at time.Time) map[string]any {
+	stamped := make(map[string]any, len(claims)+3)
+	maps.Copy(stamped, claims)
+	method, _ := claims["auth_method"].(string)
+	token.StampAuthentication(stamped, at, method)
+	return stamped
+}
+
+// withAuthentication returns the identity with how and when the subject
+// authenticated, copied from verified claims to its metadata (see
+// middleware.DefaultAuthTime). Identities may be cached and shared across
+// tokens, so the data is stamped on a copy, and data of other tokens is
+// dropped: a token without auth_time never passes for a recent
+// authentication.
+func withAuthentication(identity *subject.IdentityContext, claims token.Claims) *subject.IdentityContext {
+	authTime, ok := claims.AuthTime()
+	if !ok && !hasAuthentication(identity.Metadata) {
+		return identity
+	}
+
+	stamped := *identity
+	stamped.Metadata = make(map[string]any, len(identity.Metadata)+3)
+	maps.Copy(stamped.Metadata, identity.Metadata)
+	delete(stamped.Metadata, token.ClaimAuthTime)
+	delete(stamped.Metadata, token.ClaimACR)
+	delete(stamped.Metadata, token.ClaimAMR)
+	if !ok {
+		return &stamped
+	}
+
+	stamped.Metadata[token.ClaimAuthTime] = authTime.Unix()
+	if acr := claims.ACR(); acr != "" {
+		stamped.Metadata[token.ClaimACR] = acr
+	}
+	if amr := claims.AuthMethods(); len(amr) > 0 {
+		stamped.Metadata[token.ClaimAMR] = amr
+	}
+	return &stamped
+}
+
+// hasAuthentication reports whether identity metadata holds authentication
+// data
+func hasAuthentication(metadata map[string]any) bool {
+	for _, key := range []string{token.ClaimAuthTime, token.ClaimACR, token.ClaimAMR} {
+		if _, ok := metadata[key]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/primadi/lokstra-auth/02_token/device"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/loginattempt"
+	"github.com/primadi/lokstra-auth/notify"
+)
+
+// Notification types of suspicious logins
+const (
+	NotificationNewDevice   = "new_device_login"
+	NotificationNewLocation = "new_location_login"
+)
+
+// RegisterLoginNotificationTemplates registers the default templates of
+// suspicious login notifications in a registry and returns it, e.g., to
+// share one registry with a notify.TokenSender. The data has SubjectID,
+// TenantID, Time, IPAddress, UserAgent, Device (name), Country, City,
+// NewDevice and NewLocation.
+func RegisterLoginNotificationTemplates(registry *notify.Registry) *notify.Registry {
+	return registry.
+		Register(NotificationNewDevice, "", &notify.Template{
+			Subject: "New sign-in to your account",
+			Body: `Your account was signed in to from a new device{{if .Device}} ({{.Device}}){{end}} on {{.Time}}{{if .IPAddress}} from {{.IPAddress}}{{end}}.
+
+If this was you, you can ignore this message. Otherwise, change your password and sign out of your other sessions.
+`,
+		}).
+		Register(NotificationNewLocation, "", &notify.Template{
+			Subject: "Sign-in to your account from a new location",
+			Body: `Your account was signed in to from {{if .City}}{{.City}}, {{end}}{{.Country}}{{if .NewDevice}} on a new device{{if .Device}} ({{.Device}}){{end}}{{end}} on {{.Time}}{{if .IPAddress}} from {{.IPAddress}}{{end}}.
+
+If this was you, you can ignore this message. Otherwise, change your password and sign out of your other sessions.
+`,
+		})
+}
+
+// defaultLoginTemplates are the default templates of suspicious login
+// notifications
+var defaultLoginTemplates = RegisterLoginNotificationTemplates(notify.NewRegistry(""))
+
+// LoginNotificationConfig configures the notification of logins from a
+// device or location never seen for the subject
+type LoginNotificationConfig struct {
+	// Sender delivers the notifications (required)
+	Sender notify.Sender
+
+	// Templates render the notifications (default: the templates of
+	// RegisterLoginNotificationTemplates)
+	Templates *notify.Registry
+
+	// Recipient returns the address of the subject on the channel of the
+	// sender (default: the "email" profile field or subject attribute)
+	Recipient func(identity *subject.IdentityContext) string
+}
+
+// isNewDevice reports whether a login registers a device unseen for the
+// subject. The first device of a subject is not new: there is nothing to
+// compare with.
+func (a *Auth) isNewDevice(ctx context.Context, subjectID string, registration *DeviceRegistration) bool {
+	if a.config.LoginNotifications == nil || a.deviceStore == nil || registration == nil || registration.Fingerprint == "" {
+		return false
+	}
+
+	_, err := a.deviceStore.FindDevice(ctx, subjectID, device.HashFingerprint(registration.Fingerprint))
+	if !errors.Is(err, subject.ErrDeviceNotFound) {
+		return false
+	}
+	devices, err := a.deviceStore.ListDevices(ctx, subjectID)
+	return err == nil && len(devices) > 0
+}
+
+// isNewLocation reports whether a login comes from a country unseen in the
+// successful logins of the subject (requires a login attempt store and a
+// GeoIP enricher). The first login of a subject is not new.
+func (a *Auth) isNewLocation(ctx context.Context, subjectID string, location *subject.GeoLocation) bool {
+	if a.config.LoginNotifications == nil || a.attempts == nil || location == nil || location.CountryCode == "" {
+		return false
+	}
+
+	summary, err := loginattempt.Summarize(ctx, a.attempts, &loginattempt.Query{
+		TenantID:  authz.TenantFromContext(ctx),
+		SubjectID: subjectID,
+		Outcome:   loginattempt.OutcomeSuccess,
+	})
+	return err == nil && summary.Successes > 0 && !summary.KnownCountry(location.CountryCode)
+}
+
+// notifySuspiciousLogin notifies the subject of a login from a new device
+// or location, and records it in the audit log. A failure to notify does
+// not fail the login.
+func (a *Auth) notifySuspiciousLogin(ctx context.Context, response *LoginResponse, newDevice bool, ip, userAgent string) {
+	identity := response.Identity
+	if identity == nil || identity.Subject == nil {
+		return
+	}
+	location := loginLocation(response)
+	newLocation := a.isNewLocation(ctx, identity.Subject.ID, location)
+	if !newDevice && !newLocation {
+		return
+	}
+
+	config := a.config.LoginNotifications
+	data := map[string]any{
+		"SubjectID":   identity.Subject.ID,
+		"TenantID":    authz.TenantFromContext(ctx),
+		"Time":        time.Now().UTC().Format(time.RFC1123),
+		"IPAddress":   ip,
+		"UserAgent":   userAgent,
+		"NewDevice":   newDevice,
+		"NewLocation": newLocation,
+	}
+	if response.Device != nil {
+		data["Device"] = response.Device.Name
+	}
+	if location != nil {
+		data["Country"] = location.CountryName
+		if data["Country"] == "" {
+			data["Country"] = location.CountryCode
+		}
+		data["City"] = location.City
+	}
+
+	notification := &notify.Notification{
+		Type:      NotificationNewDevice,
+		TenantID:  authz.TenantFromContext(ctx),
+		Locale:    notify.LocaleFromContext(ctx),
+		SubjectID: identity.Subject.ID,
+		Data:      data,
+	}
+	if locale, ok := identity.Profile["locale"].(string); ok && locale != "" {
+		notification.Locale = locale
+	}
+	if newLocation {
+		notification.Type = NotificationNewLocation
+	}
+	if config.Recipient != nil {
+		notification.Recipient = config.Recipient(identity)
+	} else {
+		notification.Recipient = identityEmail(identity)
+	}
+	templates := config.Templates
+	if templates == nil {
+		templates = defaultLoginTemplates
+	}
+
+	err := notify.Notify(ctx, config.Sender, templates, notification)
+
+	metadata := auditMetadata(err, "notification", notification.Type)
+	metadata["new_device"] = newDevice
+	metadata["new_location"] = newLocation
+	if location != nil {
+		metadata["country"] = location.CountryCode
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventSuspiciousLogin,
+		ActorID:   identity.Subject.ID,
+		SubjectID: identity.Subject.ID,
+		Action:    "notify_login",
+		Result:    auditResult(err),
+		IPAddress: ip,
+		UserAgent: userAgent,
+		Metadata:  metadata,
+	})
+}
+
+// identityEmail returns the email address of an identity: the "email"
+// profile field or subject attribute
+func identityEmail(identity *subject.IdentityContext) string {
+	if email, ok := identity.Profile["email"].(string); ok && email != "" {
+		return email
+	}
+	email, _ := identity.Subject.Attributes["email"].(string)
+	return email
+}
@@ -0,0 +1,156 @@
+package lokstraauth
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	token "github.com/primadi/lokstra-auth/02_token"
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/audit"
+	"github.com/primadi/lokstra-auth/autherrors"
+)
+
+var (
+	ErrNoAllowedTenants = autherrors.New(autherrors.ErrInvalidRequest, "system tokens require allowed tenants")
+	ErrReservedClaim    = autherrors.New(autherrors.ErrInvalidRequest, "claim is reserved to system tokens")
+	ErrSystemTokenScope = autherrors.New(autherrors.ErrInvalidRequest, "system tokens cannot carry tenant or app claims")
+)
+
+// SystemTokenRequest describes a system token: a token of a platform
+// service acting across tenants
+type SystemTokenRequest struct {
+	// ServiceID is the subject of the token (e.g., "billing-worker")
+	ServiceID string
+
+	// AllowedTenants are the tenants the service may act in (required;
+	// authz.AllTenants allows every tenant)
+	AllowedTenants []string
+
+	// Claims are additional claims (optional). System tokens belong to no
+	// tenant: tenant_id and app_id are not allowed.
+	Claims map[string]any
+}
+
+// IssueSystemToken issues a system token. Its subject has the type
+// "system" and may act in the allowed tenants only: requests are scoped to
+// one of them by the request context, or by AuthorizationRequest.TenantID.
+// Ordinary tokens never cross tenants (see Verify).
+func (a *Auth) IssueSystemToken(ctx context.Context, request *SystemTokenRequest) (*token.Token, error) {
+	if a.tokenManager == nil {
+		return nil, ErrNoTokenManager
+	}
+	if request.ServiceID == "" {
+		return nil, ErrMissingSubject
+	}
+	if len(request.AllowedTenants) == 0 {
+		return nil, ErrNoAllowedTenants
+	}
+	for _, claim := range []string{token.ClaimTenantID, token.ClaimAppID} {
+		if _, ok := request.Claims[claim]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrSystemTokenScope, claim)
+		}
+	}
+
+	claims := make(map[string]any, len(request.Claims)+3)
+	maps.Copy(claims, request.Claims)
+	claims["sub"] = request.ServiceID
+	claims["type"] = token.TokenTypeSystem
+	claims[token.ClaimAllowedTenants] = request.AllowedTenants
+
+	start := time.Now()
+	tok, err := inLayer(ctx, a, LayerToken, "generate system token",
+		func(ctx context.Context) (*token.Token, error) {
+			return a.tokenManager.Generate(ctx, claims)
+		})
+	a.observeIssue(token.TokenTypeSystem, start, err)
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventSystemTokenIssued,
+		SubjectID: request.ServiceID,
+		Action:    "issue_system_token",
+		Result:    auditResult(err),
+		Metadata:  auditMetadata(err, "allowed_tenants", request.AllowedTenants),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenGenerationFailed, err)
+	}
+
+	a.emit(ctx, token.EventIssued, request.ServiceID, token.TokenTypeSystem, tok, nil)
+	return tok, nil
+}
+
+// checkLoginClaims rejects login claims that would mark the issued tokens
+// as system or MFA-pending tokens, so logins can never mint them
+func checkLoginClaims(claims token.Claims) error {
+	if claims.IsSystem() || claims.TokenType() == token.TokenTypeMFAPending {
+		return fmt.Errorf("%w: type", ErrReservedClaim)
+	}
+	if _, ok := claims[token.ClaimAllowedTenants]; ok {
+		return fmt.Errorf("%w: %s", ErrReservedClaim, token.ClaimAllowedTenants)
+	}
+	return nil
+}
+
+// bindTokenTenant rejects verified claims used in another tenant than
+// theirs: ordinary tokens of another tenant than the context tenant, and
+// system tokens not allowed in the context tenant. It returns the context
+// scoped to the tenant and app of an ordinary token when the context has
+// none, so the checks and data that follow are those of the token's tenant
+// rather than of the default tenant.
+func bindTokenTenant(ctx context.Context, claims token.Claims) (context.Context, error) {
+	tenantID := authz.TenantFromContext(ctx)
+	if claims.IsSystem() {
+		if tenantID != "" && !authz.TenantAllowed(claims.AllowedTenants(), tenantID) {
+			return ctx, fmt.Errorf("%w: system token not allowed in tenant %q", token.ErrTenantMismatch, tenantID)
+		}
+		return ctx, nil
+	}
+
+	if claimed, _ := claims.Tenant(); claimed != "" && tenantID != "" && claimed != tenantID {
+		return ctx, fmt.Errorf("%w: token of tenant %q used in tenant %q", token.ErrTenantMismatch, claimed, tenantID)
+	}
+	return inferTenant(ctx, claims), nil
+}
+
+// overrideTenant scopes the context to the tenant of an authorization
+// request (AuthorizationRequest.TenantID), which only system subjects
+// allowed in the tenant may set. The app of the context is dropped.
+func (a *Auth) overrideTenant(ctx context.Context, request *authz.AuthorizationRequest) (context.Context, error) {
+	if request.TenantID == "" || request.TenantID == authz.TenantFromContext(ctx) {
+		return ctx, nil
+	}
+
+	allowedTenants, system := authz.SystemScopeFromContext(ctx)
+	allowed := system && authz.TenantAllowed(allowedTenants, request.TenantID)
+	a.auditCrossTenant(ctx, request.Subject, request.TenantID, allowed)
+	if !allowed {
+		return nil, fmt.Errorf("%w: %s", authz.ErrCrossTenant, request.TenantID)
+	}
+	return authz.WithApp(authz.WithTenant(ctx, request.TenantID), ""), nil
+}
+
+// auditCrossTenant records a tenant override of an authorization request
+func (a *Auth) auditCrossTenant(ctx context.Context, identity *subject.IdentityContext, tenantID string, allowed bool) {
+	if a.audit == nil {
+		return
+	}
+
+	var subjectID string
+	if identity != nil && identity.Subject != nil {
+		subjectID = identity.Subject.ID
+	}
+	result := audit.ResultSuccess
+	if !allowed {
+		result = audit.ResultDenied
+	}
+	a.Audit(ctx, &audit.AuditLog{
+		EventType: audit.EventCrossTenantAccess,
+		ActorID:   subjectID,
+		SubjectID: subjectID,
+		Action:    "override_tenant",
+		Result:    result,
+		Metadata:  map[string]any{"target_tenant": tenantID},
+	})
+}
@@ -0,0 +1,310 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAuthSettingsNotFound = errors.New("auth settings not found")
+)
+
+// TenantAuthSettings are the auth tunables of a tenant, or of one app of the
+// tenant, consulted by the runtime (see lokstraauth.Config.AuthSettings) in
+// place of its static configuration. Zero fields are unset: app settings
+// override the tenant settings field by field, and unset fields fall back
+// to the runtime configuration.
+type TenantAuthSettings struct {
+	TenantID string `json:"tenant_id"`
+
+	// AppID scopes the settings to an app (empty: the tenant settings)
+	AppID string `json:"app_id,omitempty"`
+
+	// MFARequired requires a second factor at login. An app cannot lift the
+	// requirement of its tenant.
+	MFARequired bool `json:"mfa_required,omitempty"`
+
+	// AllowedAuthenticators restricts the credential types accepted at login
+	// (e.g., ["basic", "passkey"]; empty: all)
+	AllowedAuthenticators []string `json:"allowed_authenticators,omitempty"`
+
+	// SessionIdleTimeout expires sessions not used for this long
+	SessionIdleTimeout time.Duration `json:"session_idle_timeout,omitempty"`
+
+	// SessionAbsoluteTimeout expires sessions this long after creation
+	SessionAbsoluteTimeout time.Duration `json:"session_absolute_timeout,omitempty"`
+
+	// MaxConcurrentSessions limits the active sessions of a user
+	MaxConcurrentSessions int `json:"max_concurrent_sessions,omitempty"`
+
+	// LockoutThreshold locks an account after this many failed logins
+	// within LockoutWindow
+	LockoutThreshold int `json:"lockout_threshold,omitempty"`
+
+	// LockoutWindow is the period failed logins are counted in (default:
+	// LockoutDuration)
+	LockoutWindow time.Duration `json:"lockout_window,omitempty"`
+
+	// LockoutDuration is how long a locked account stays locked (default:
+	// 15 minutes)
+	LockoutDuration time.Duration `json:"lockout_duration,omitempty"`
+
+	// AccessTokenTTL is how long access tokens are valid
+	AccessTokenTTL time.Duration `json:"access_token_ttl,omitempty"`
+
+	// RefreshTokenTTL is how long refresh tokens are valid
+	RefreshTokenTTL time.Duration `json:"refresh_token_ttl,omitempty"`
+
+	// Password is the password policy of "basic" credential providers
+	// (overrides the policy of their config)
+	Password *PasswordPolicy `json:"password,omitempty"`
+
+	// ProfileFields restricts the profile attributes users can edit
+	// themselves (e.g., ["display_name", "locale"]; empty: the fields of
+	// the runtime configuration)
+	ProfileFields []string `json:"profile_fields,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PasswordPolicy is the password policy of a tenant or app
+type PasswordPolicy struct {
+	MinLength        int  `json:"min_length,omitempty"`
+	RequireUppercase bool `json:"require_uppercase,omitempty"`
+	RequireLowercase bool `json:"require_lowercase,omitempty"`
+	RequireDigit     bool `json:"require_digit,omitempty"`
+	RequireSpecial   bool `json:"require_special,omitempty"`
+}
+
+// AllowsAuthenticator reports whether logins with a credential type are
+// accepted
+func (s *TenantAuthSettings) AllowsAuthenticator(authType string) bool {
+	return len(s.AllowedAuthenticators) == 0 || slices.Contains(s.AllowedAuthenticators, authType)
+}
+
+// Merge returns the settings with the set fields of app settings applied
+// on top (app may be nil)
+func (s *TenantAuthSettings) Merge(app *TenantAuthSettings) *TenantAuthSettings {
+	merged := s.clone()
+	if app == nil {
+		return merged
+	}
+
+	merged.AppID = app.AppID
+	merged.MFARequired = s.MFARequired || app.MFARequired
+	if len(app.AllowedAuthenticators) > 0 {
+		merged.AllowedAuthenticators = slices.Clone(app.AllowedAuthenticators)
+	}
+	for _, field := range []struct{ merged, app *time.Duration }{
+		{&merged.SessionIdleTimeout, &app.SessionIdleTimeout},
+		{&merged.SessionAbsoluteTimeout, &app.SessionAbsoluteTimeout},
+		{&merged.LockoutWindow, &app.LockoutWindow},
+		{&merged.LockoutDuration, &app.LockoutDuration},
+		{&merged.AccessTokenTTL, &app.AccessTokenTTL},
+		{&merged.RefreshTokenTTL, &app.RefreshTokenTTL},
+	} {
+		if *field.app > 0 {
+			*field.merged = *field.app
+		}
+	}
+	if app.MaxConcurrentSessions > 0 {
+		merged.MaxConcurrentSessions = app.MaxConcurrentSessions
+	}
+	if app.LockoutThreshold > 0 {
+		merged.LockoutThreshold = app.LockoutThreshold
+	}
+	if app.Password != nil {
+		password := *app.Password
+		merged.Password = &password
+	}
+	if len(app.ProfileFields) > 0 {
+		merged.ProfileFields = slices.Clone(app.ProfileFields)
+	}
+	if app.UpdatedAt.After(merged.UpdatedAt) {
+		merged.UpdatedAt = app.UpdatedAt
+	}
+	return merged
+}
+
+func (s *TenantAuthSettings) clone() *TenantAuthSettings {
+	clone := *s
+	clone.AllowedAuthenticators = slices.Clone(s.AllowedAuthenticators)
+	clone.ProfileFields = slices.Clone(s.ProfileFields)
+	if s.Password != nil {
+		password := *s.Password
+		clone.Password = &password
+	}
+	return &clone
+}
+
+// AuthSettingsStore persists the auth settings of tenants and apps.
+// Settings are configuration: deletes are permanent.
+type AuthSettingsStore interface {
+	// GetAuthSettings returns the settings of a tenant (empty appID) or of
+	// an app (ErrAuthSettingsNotFound if none are set)
+	GetAuthSettings(ctx context.Context, tenantID, appID string) (*TenantAuthSettings, error)
+
+	// SetAuthSettings creates or replaces the settings of a tenant or app
+	SetAuthSettings(ctx context.Context, settings *TenantAuthSettings) error
+
+	// DeleteAuthSettings deletes the settings of a tenant or app
+	DeleteAuthSettings(ctx context.Context, tenantID, appID string) error
+}
+
+var _ AuthSettingsStore = (*InMemoryStore)(nil)
+
+// GetAuthSettings returns the auth settings of a tenant or app
+func (s *InMemoryStore) GetAuthSettings(ctx context.Context, tenantID, appID string) (*TenantAuthSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.checkSettingsScope(tenantID, appID); err != nil {
+		return nil, err
+	}
+	settings, ok := s.settings[settingsName(tenantID, appID)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAuthSettingsNotFound, settingsName(tenantID, appID))
+	}
+	return settings.clone(), nil
+}
+
+// SetAuthSettings creates or replaces the auth settings of a tenant or app
+func (s *InMemoryStore) SetAuthSettings(ctx context.Context, settings *TenantAuthSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkSettingsScope(settings.TenantID, settings.AppID); err != nil {
+		return err
+	}
+	stored := settings.clone()
+	stored.UpdatedAt = time.Now()
+	s.settings[settingsName(settings.TenantID, settings.AppID)] = stored
+	return nil
+}
+
+// DeleteAuthSettings deletes the auth settings of a tenant or app
+func (s *InMemoryStore) DeleteAuthSettings(ctx context.Context, tenantID, appID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := settingsName(tenantID, appID)
+	if _, ok := s.settings[key]; !ok {
+		return fmt.Errorf("%w: %s", ErrAuthSettingsNotFound, settingsName(tenantID, appID))
+	}
+	delete(s.settings, key)
+	return nil
+}
+
+// checkSettingsScope checks that the tenant (and app) of settings are not
+// deleted. Caller must hold the lock.
+func (s *InMemoryStore) checkSettingsScope(tenantID, appID string) error {
+	if appID != "" {
+		_, err := s.liveApp(tenantID, appID)
+		return err
+	}
+	_, err := s.liveTenant(tenantID)
+	return err
+}
+
+func settingsName(tenantID, appID string) string {
+	if appID == "" {
+		return tenantID
+	}
+	return tenantID + "/" + appID
+}
+
+// AuthSettingsCache serves the effective settings of apps, the app
+// settings merged over the tenant settings, from a store. Entries are
+// reloaded after a refresh interval, or at once after Invalidate.
+type AuthSettingsCache struct {
+	store           AuthSettingsStore
+	refreshInterval time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*settingsEntry // tenantID/appID -> effective settings
+}
+
+type settingsEntry struct {
+	loadedAt time.Time
+	settings *TenantAuthSettings
+}
+
+// NewAuthSettingsCache creates a cache of the settings of a store (default
+// refresh interval: 1 minute)
+func NewAuthSettingsCache(store AuthSettingsStore, refreshInterval time.Duration) *AuthSettingsCache {
+	if refreshInterval <= 0 {
+		refreshInterval = time.Minute
+	}
+	return &AuthSettingsCache{
+		store:           store,
+		refreshInterval: refreshInterval,
+		entries:         make(map[string]*settingsEntry),
+	}
+}
+
+// EffectiveAuthSettings returns the settings of an app of a tenant (empty
+// appID: the tenant settings). Tenants and apps without settings get empty
+// settings, so the runtime configuration applies. The settings are shared:
+// do not modify them.
+func (c *AuthSettingsCache) EffectiveAuthSettings(ctx context.Context, tenantID, appID string) (*TenantAuthSettings, error) {
+	key := settingsName(tenantID, appID)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < c.refreshInterval {
+		return entry.settings, nil
+	}
+
+	settings, err := c.load(ctx, tenantID, "")
+	if err != nil {
+		return nil, err
+	}
+	if appID != "" {
+		app, err := c.load(ctx, tenantID, appID)
+		if err != nil {
+			return nil, err
+		}
+		settings = settings.Merge(app)
+	}
+
+	c.mu.Lock()
+	c.entries[key] = &settingsEntry{loadedAt: time.Now(), settings: settings}
+	c.mu.Unlock()
+	return settings, nil
+}
+
+// load returns the stored settings of a tenant or app, or empty settings
+func (c *AuthSettingsCache) load(ctx context.Context, tenantID, appID string) (*TenantAuthSettings, error) {
+	settings, err := c.store.GetAuthSettings(ctx, tenantID, appID)
+	if errors.Is(err, ErrAuthSettingsNotFound) || errors.Is(err, ErrTenantNotFound) || errors.Is(err, ErrAppNotFound) {
+		return &TenantAuthSettings{TenantID: tenantID, AppID: appID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load auth settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Invalidate drops the cached settings of a tenant and its apps, e.g.,
+// after they were changed, so the next request reloads them
+func (c *AuthSettingsCache) Invalidate(tenantID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if key == tenantID || strings.HasPrefix(key, tenantID+"/") {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// InvalidateAll drops the cached settings of every tenant
+func (c *AuthSettingsCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
@@ -0,0 +1,370 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	credential "github.com/primadi/lokstra-auth/01_credential"
+	"github.com/primadi/lokstra-auth/01_credential/basic"
+	"github.com/primadi/lokstra-auth/01_credential/oauth2"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+var (
+	ErrCredentialProviderDisabled = errors.New("credential provider is disabled")
+	ErrUnknownProviderType        = errors.New("unknown credential provider type")
+	ErrInvalidProviderConfig      = errors.New("invalid credential provider config")
+)
+
+// AuthenticatorBuilder instantiates the authenticator of a credential
+// provider from its config
+type AuthenticatorBuilder func(ctx context.Context, provider *CredentialProvider) (credential.Authenticator, error)
+
+// AuthenticatorFactoryConfig holds configuration for the authenticator factory
+type AuthenticatorFactoryConfig struct {
+	// Providers stores the credential providers of tenants (required)
+	Providers CredentialProviderStore
+
+	// Users looks up the users of "basic" providers (required for "basic")
+	Users UserStore
+
+	// Builders add or replace builders per provider type, e.g. "ldap"
+	// (built in: "basic" and "oauth2")
+	Builders map[string]AuthenticatorBuilder
+
+	// RefreshInterval is how long the providers of a tenant are cached
+	// before they are reloaded; only changed providers are rebuilt
+	// (default: 1 minute)
+	RefreshInterval time.Duration
+
+	// Settings supplies the auth settings of tenants and apps (optional).
+	// Their password policy overrides the policy of "basic" providers, which
+	// are rebuilt when the settings change.
+	Settings *AuthSettingsCache
+}
+
+// AuthenticatorFactory instantiates authenticators from the credential
+// providers of the tenant (and app) in the context. It implements
+// credential.AuthenticatorResolver: set it on the Auth runtime with
+// Builder.WithAuthenticatorResolver. Requests without a tenant, or whose
+// tenant has no provider of the credential type, use the authenticators
+// registered on the runtime.
+//
+// Built-in provider types and their config:
+//
+//	basic:  min_username_length, min_password_length (numbers),
+//	        require_uppercase, require_lowercase, require_digit,
+//	        require_special (booleans); the password policy of the auth
+//	        settings, if set, takes precedence
+//	oauth2: providers (list of accepted providers, e.g. ["google"]),
+//	        timeout (duration, e.g. "10s")
+type AuthenticatorFactory struct {
+	config   *AuthenticatorFactoryConfig
+	builders map[string]AuthenticatorBuilder
+
+	mu      sync.Mutex
+	tenants map[string]*tenantAuthenticators
+}
+
+// tenantAuthenticators are the cached authenticators of a tenant
+type tenantAuthenticators struct {
+	loadedAt time.Time
+	entries  map[string]*authenticatorEntry // appID/type -> entry
+}
+
+// authenticatorEntry is the authenticator built from a provider revision
+type authenticatorEntry struct {
+	providerID    string
+	updatedAt     time.Time
+	settingsAt    time.Time // revision of the auth settings applied
+	enabled       bool
+	authenticator credential.Authenticator
+	err           error
+}
+
+// NewAuthenticatorFactory creates an authenticator factory
+func NewAuthenticatorFactory(config *AuthenticatorFactoryConfig) *AuthenticatorFactory {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Minute
+	}
+
+	f := &AuthenticatorFactory{
+		config:  config,
+		tenants: make(map[string]*tenantAuthenticators),
+	}
+	f.builders = map[string]AuthenticatorBuilder{
+		"basic":  f.buildBasic,
+		"oauth2": buildOAuth2,
+	}
+	for providerType, builder := range config.Builders {
+		f.builders[providerType] = builder
+	}
+	return f
+}
+
+// ResolveAuthenticator returns the authenticator of the context tenant and
+// app for a credential type: the app provider, else the tenant-wide one, else
+// nil. A disabled provider fails with ErrCredentialProviderDisabled.
+func (f *AuthenticatorFactory) ResolveAuthenticator(ctx context.Context, authType string) (credential.Authenticator, error) {
+	tenantID := authz.TenantFromContext(ctx)
+	if tenantID == "" {
+		return nil, nil
+	}
+
+	cached, err := f.load(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := cached.entries[entryKey(authz.AppFromContext(ctx), authType)]
+	if !ok {
+		entry, ok = cached.entries[entryKey("", authType)]
+	}
+	switch {
+	case !ok:
+		return nil, nil
+	case !entry.enabled:
+		return nil, fmt.Errorf("%w: %s", ErrCredentialProviderDisabled, entry.providerID)
+	case entry.err != nil:
+		return nil, entry.err
+	}
+	return entry.authenticator, nil
+}
+
+// Invalidate drops the cached authenticators of a tenant, e.g. after its
+// providers were changed, so the next login reloads them
+func (f *AuthenticatorFactory) Invalidate(tenantID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if cached, ok := f.tenants[tenantID]; ok {
+		cached.loadedAt = time.Time{}
+	}
+}
+
+// InvalidateAll drops the cached authenticators of every tenant
+func (f *AuthenticatorFactory) InvalidateAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, cached := range f.tenants {
+		cached.loadedAt = time.Time{}
+	}
+}
+
+// load returns the authenticators of a tenant, reloading its providers when
+// the cache is stale. Authenticators of unchanged providers are kept, so
+// in-flight logins are unaffected by a reload.
+func (f *AuthenticatorFactory) load(ctx context.Context, tenantID string) (*tenantAuthenticators, error) {
+	f.mu.Lock()
+	previous := f.tenants[tenantID]
+	f.mu.Unlock()
+
+	if previous != nil && time.Since(previous.loadedAt) < f.config.RefreshInterval {
+		return previous, nil
+	}
+
+	providers, err := f.config.Providers.ListCredentialProviders(ctx, tenantID)
+	if errors.Is(err, ErrTenantNotFound) {
+		providers, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credential providers: %w", err)
+	}
+
+	loaded := &tenantAuthenticators{
+		loadedAt: time.Now(),
+		entries:  make(map[string]*authenticatorEntry, len(providers)),
+	}
+	for _, provider := range providers {
+		settings, err := f.settings(ctx, provider)
+		if err != nil {
+			return nil, err
+		}
+
+		key := entryKey(provider.AppID, provider.Type)
+		if previous != nil {
+			if entry, ok := previous.entries[key]; ok && entry.providerID == provider.ID &&
+				entry.updatedAt.Equal(provider.UpdatedAt) && entry.settingsAt.Equal(settings.UpdatedAt) &&
+				entry.err == nil {
+				loaded.entries[key] = entry
+				continue
+			}
+		}
+		entry := f.build(ctx, provider)
+		entry.settingsAt = settings.UpdatedAt
+		loaded.entries[key] = entry
+	}
+
+	f.mu.Lock()
+	f.tenants[tenantID] = loaded
+	f.mu.Unlock()
+	return loaded, nil
+}
+
+// build instantiates the authenticator of a provider
+func (f *AuthenticatorFactory) build(ctx context.Context, provider *CredentialProvider) *authenticatorEntry {
+	entry := &authenticatorEntry{
+		providerID: provider.ID,
+		updatedAt:  provider.UpdatedAt,
+		enabled:    provider.Enabled,
+	}
+	if !provider.Enabled {
+		return entry
+	}
+
+	builder, ok := f.builders[provider.Type]
+	if !ok {
+		entry.err = fmt.Errorf("%w: %s", ErrUnknownProviderType, provider.Type)
+		return entry
+	}
+	entry.authenticator, entry.err = builder(ctx, provider)
+	if entry.err != nil {
+		entry.err = fmt.Errorf("credential provider %s: %w", provider.ID, entry.err)
+	}
+	return entry
+}
+
+// buildBasic builds a username / password authenticator with the password
+// policy of the provider
+func (f *AuthenticatorFactory) buildBasic(ctx context.Context, provider *CredentialProvider) (credential.Authenticator, error) {
+	if f.config.Users == nil {
+		return nil, errors.New("basic providers require a user store")
+	}
+
+	policy := basic.DefaultValidatorConfig()
+	cfg := providerConfig(provider.Config)
+	var err error
+	if policy.MinUsernameLength, err = cfg.int("min_username_length", policy.MinUsernameLength); err != nil {
+		return nil, err
+	}
+	if policy.MinPasswordLength, err = cfg.int("min_password_length", policy.MinPasswordLength); err != nil {
+		return nil, err
+	}
+	for key, value := range map[string]*bool{
+		"require_uppercase": &policy.RequireUppercase,
+		"require_lowercase": &policy.RequireLowercase,
+		"require_digit":     &policy.RequireDigit,
+		"require_special":   &policy.RequireSpecial,
+	} {
+		if *value, err = cfg.bool(key, *value); err != nil {
+			return nil, err
+		}
+	}
+
+	settings, err := f.settings(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	if password := settings.Password; password != nil {
+		if password.MinLength > 0 {
+			policy.MinPasswordLength = password.MinLength
+		}
+		policy.RequireUppercase = password.RequireUppercase
+		policy.RequireLowercase = password.RequireLowercase
+		policy.RequireDigit = password.RequireDigit
+		policy.RequireSpecial = password.RequireSpecial
+	}
+
+	return basic.NewAuthenticator(NewUserProvider(f.config.Users), basic.NewValidator(policy)), nil
+}
+
+// settings returns the auth settings applying to a provider (empty without
+// a settings cache)
+func (f *AuthenticatorFactory) settings(ctx context.Context, provider *CredentialProvider) (*TenantAuthSettings, error) {
+	if f.config.Settings == nil {
+		return &TenantAuthSettings{}, nil
+	}
+	return f.config.Settings.EffectiveAuthSettings(ctx, provider.TenantID, provider.AppID)
+}
+
+// buildOAuth2 builds an OAuth2 authenticator accepting the providers of the
+// config
+func buildOAuth2(ctx context.Context, provider *CredentialProvider) (credential.Authenticator, error) {
+	config := oauth2.DefaultConfig()
+	cfg := providerConfig(provider.Config)
+
+	names, err := cfg.strings("providers")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		config.Providers = append(config.Providers, oauth2.Provider(name))
+	}
+
+	if config.Timeout, err = cfg.duration("timeout", config.Timeout); err != nil {
+		return nil, err
+	}
+	config.HTTPClient.Timeout = config.Timeout
+
+	return oauth2.NewAuthenticator(config), nil
+}
+
+func entryKey(appID, authType string) string {
+	return appID + "/" + authType
+}
+
+// providerConfig reads the settings of a provider config. Numbers decoded
+// from JSON are float64.
+type providerConfig map[string]any
+
+func (c providerConfig) int(key string, def int) (int, error) {
+	switch value := c[key].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return value, nil
+	case int64:
+		return int(value), nil
+	case float64:
+		if value == float64(int(value)) {
+			return int(value), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s must be an integer", ErrInvalidProviderConfig, key)
+}
+
+func (c providerConfig) bool(key string, def bool) (bool, error) {
+	switch value := c[key].(type) {
+	case nil:
+		return def, nil
+	case bool:
+		return value, nil
+	}
+	return false, fmt.Errorf("%w: %s must be a boolean", ErrInvalidProviderConfig, key)
+}
+
+func (c providerConfig) strings(key string) ([]string, error) {
+	switch value := c[key].(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return value, nil
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s must be a list of strings", ErrInvalidProviderConfig, key)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%w: %s must be a list of strings", ErrInvalidProviderConfig, key)
+}
+
+func (c providerConfig) duration(key string, def time.Duration) (time.Duration, error) {
+	switch value := c[key].(type) {
+	case nil:
+		return def, nil
+	case time.Duration:
+		return value, nil
+	case string:
+		if d, err := time.ParseDuration(value); err == nil {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s must be a duration", ErrInvalidProviderConfig, key)
+}
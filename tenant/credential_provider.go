@@ -0,0 +1,185 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+)
+
+var (
+	ErrCredentialProviderNotFound = errors.New("credential provider not found")
+	ErrCredentialProviderExists   = errors.New("credential provider already exists")
+)
+
+// CredentialProvider configures an authenticator for the users of a tenant,
+// or of one app of the tenant (e.g., the OAuth2 providers accepted or the
+// password policy). A tenant has at most one provider per app and type.
+type CredentialProvider struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+
+	// AppID restricts the provider to an app (empty: all apps of the tenant;
+	// an app provider overrides the tenant provider of the same type)
+	AppID string `json:"app_id,omitempty"`
+
+	// Type is the authenticator type (credential type), e.g. "basic",
+	// "oauth2" or "ldap"
+	Type string `json:"type"`
+
+	Name    string `json:"name,omitempty"`
+	Enabled bool   `json:"enabled"`
+
+	// Config holds the settings of the authenticator (see AuthenticatorFactory)
+	Config map[string]any `json:"config,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CredentialProviderStore persists the credential providers of tenants.
+// Providers are configuration: deletes are permanent.
+type CredentialProviderStore interface {
+	// CreateCredentialProvider creates a provider (ErrCredentialProviderExists
+	// if the ID or the app and type are taken in the tenant). An empty ID is
+	// generated.
+	CreateCredentialProvider(ctx context.Context, provider *CredentialProvider) error
+
+	// GetCredentialProvider returns a provider
+	GetCredentialProvider(ctx context.Context, tenantID, providerID string) (*CredentialProvider, error)
+
+	// UpdateCredentialProvider updates the name, enabled flag and config of a
+	// provider
+	UpdateCredentialProvider(ctx context.Context, provider *CredentialProvider) error
+
+	// DeleteCredentialProvider deletes a provider
+	DeleteCredentialProvider(ctx context.Context, tenantID, providerID string) error
+
+	// ListCredentialProviders returns the providers of a tenant sorted by ID
+	ListCredentialProviders(ctx context.Context, tenantID string) ([]*CredentialProvider, error)
+}
+
+var _ CredentialProviderStore = (*InMemoryStore)(nil)
+
+// CreateCredentialProvider creates a credential provider
+func (s *InMemoryStore) CreateCredentialProvider(ctx context.Context, provider *CredentialProvider) error {
+	if provider.ID == "" {
+		provider.ID = NewID()
+	}
+	if err := ValidateID(provider.ID); err != nil {
+		return err
+	}
+	if provider.Type == "" {
+		return errors.New("credential provider type is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.liveTenant(provider.TenantID); err != nil {
+		return err
+	}
+	if provider.AppID != "" {
+		if _, err := s.liveApp(provider.TenantID, provider.AppID); err != nil {
+			return err
+		}
+	}
+	providers := s.providers[provider.TenantID]
+	if providers == nil {
+		providers = make(map[string]*CredentialProvider)
+		s.providers[provider.TenantID] = providers
+	}
+	if _, ok := providers[provider.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrCredentialProviderExists, provider.ID)
+	}
+	for _, existing := range providers {
+		if existing.AppID == provider.AppID && existing.Type == provider.Type {
+			return fmt.Errorf("%w: %s", ErrCredentialProviderExists, provider.Type)
+		}
+	}
+
+	now := time.Now()
+	stored := provider.clone()
+	stored.CreatedAt, stored.UpdatedAt = now, now
+	providers[provider.ID] = stored
+	return nil
+}
+
+// GetCredentialProvider returns a credential provider
+func (s *InMemoryStore) GetCredentialProvider(ctx context.Context, tenantID, providerID string) (*CredentialProvider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := s.credentialProvider(tenantID, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return stored.clone(), nil
+}
+
+// UpdateCredentialProvider updates the name, enabled flag and config of a
+// credential provider
+func (s *InMemoryStore) UpdateCredentialProvider(ctx context.Context, provider *CredentialProvider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.credentialProvider(provider.TenantID, provider.ID)
+	if err != nil {
+		return err
+	}
+	stored.Name = provider.Name
+	stored.Enabled = provider.Enabled
+	stored.Config = maps.Clone(provider.Config)
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteCredentialProvider deletes a credential provider
+func (s *InMemoryStore) DeleteCredentialProvider(ctx context.Context, tenantID, providerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.credentialProvider(tenantID, providerID); err != nil {
+		return err
+	}
+	delete(s.providers[tenantID], providerID)
+	return nil
+}
+
+// ListCredentialProviders returns the credential providers of a tenant
+// sorted by ID
+func (s *InMemoryStore) ListCredentialProviders(ctx context.Context, tenantID string) ([]*CredentialProvider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return nil, err
+	}
+	providers := make([]*CredentialProvider, 0, len(s.providers[tenantID]))
+	for _, provider := range s.providers[tenantID] {
+		providers = append(providers, provider.clone())
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].ID < providers[j].ID })
+	return providers, nil
+}
+
+// credentialProvider returns a provider of a tenant that is not deleted.
+// Caller must hold the lock.
+func (s *InMemoryStore) credentialProvider(tenantID, providerID string) (*CredentialProvider, error) {
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return nil, err
+	}
+	provider, ok := s.providers[tenantID][providerID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCredentialProviderNotFound, providerID)
+	}
+	return provider, nil
+}
+
+func (p *CredentialProvider) clone() *CredentialProvider {
+	clone := *p
+	clone.Config = maps.Clone(p.Config)
+	return &clone
+}
@@ -0,0 +1,64 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErasedUsernamePrefix prefixes the random usernames of anonymized users
+const ErasedUsernamePrefix = "erased-"
+
+// ErasedReason is the status reason of anonymized users
+const ErasedReason = "erased"
+
+// UserAnonymizer is a UserStore that anonymizes users in place, whether or
+// not they are deleted (see AnonymizeUser)
+type UserAnonymizer interface {
+	// AnonymizeUser scrubs the personal data of a user (see User.Anonymize)
+	// and soft-deletes it unless it is deleted already
+	AnonymizeUser(ctx context.Context, tenantID, userID string) error
+}
+
+// Anonymize scrubs the personal data of the user: the username is replaced
+// with a random one, the email, password hash and metadata are cleared, and
+// the user is deactivated. The ID is kept so references to the user stay
+// valid. It does not persist the user.
+func (u *User) Anonymize() {
+	u.Username = ErasedUsernamePrefix + NewID()
+	u.Email = ""
+	u.PasswordHash = ""
+	u.Metadata = nil
+	u.Status = UserDeactivated
+	u.StatusReason = ErasedReason
+	u.StatusChangedAt = time.Now()
+	u.Disabled = true
+}
+
+// AnonymizeUser anonymizes a user of a store (see User.Anonymize) and
+// soft-deletes it, whether or not it was deleted already. Stores that
+// implement UserAnonymizer do it in place; with other stores a deleted user
+// is restored first, which fails with ErrUserExists if another user took
+// its username or email meanwhile.
+func AnonymizeUser(ctx context.Context, store UserStore, tenantID, userID string) error {
+	if anonymizer, ok := store.(UserAnonymizer); ok {
+		return anonymizer.AnonymizeUser(ctx, tenantID, userID)
+	}
+
+	user, err := store.GetUser(ctx, tenantID, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		if err := store.RestoreUser(ctx, tenantID, userID); err != nil {
+			return err
+		}
+		user, err = store.GetUser(ctx, tenantID, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	user.Anonymize()
+	if err := store.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	return store.DeleteUser(ctx, tenantID, userID)
+}
@@ -0,0 +1,125 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var (
+	ErrInvalidStatus     = errors.New("invalid user status")
+	ErrInvalidTransition = errors.New("invalid user status transition")
+)
+
+// UserStatus is the lifecycle status of a user
+type UserStatus string
+
+const (
+	// UserPending: created but not activated yet (e.g., until its email is
+	// verified or an admin approves it)
+	UserPending UserStatus = "pending"
+
+	// UserActive: the user signs in and its tokens are valid
+	UserActive UserStatus = "active"
+
+	// UserSuspended: temporarily blocked, e.g. during an investigation
+	UserSuspended UserStatus = "suspended"
+
+	// UserDeactivated: closed by the user or an admin; only an admin can
+	// reactivate it
+	UserDeactivated UserStatus = "deactivated"
+)
+
+// userTransitions are the statuses each status can move to
+var userTransitions = map[UserStatus][]UserStatus{
+	UserPending:     {UserActive, UserDeactivated},
+	UserActive:      {UserSuspended, UserDeactivated},
+	UserSuspended:   {UserActive, UserDeactivated},
+	UserDeactivated: {UserActive},
+}
+
+// Valid reports whether the status is a known user status
+func (s UserStatus) Valid() bool {
+	_, ok := userTransitions[s]
+	return ok
+}
+
+// CanTransition reports whether a user in the status can move to another
+// status
+func (s UserStatus) CanTransition(to UserStatus) bool {
+	return slices.Contains(userTransitions[s], to)
+}
+
+// EffectiveStatus returns the status of the user. Users stored before
+// statuses existed have none: they are suspended if disabled, else active.
+func (u *User) EffectiveStatus() UserStatus {
+	switch {
+	case u.Status != "":
+		return u.Status
+	case u.Disabled:
+		return UserSuspended
+	default:
+		return UserActive
+	}
+}
+
+// CanAuthenticate reports whether the user may sign in and use its tokens:
+// only active users can
+func (u *User) CanAuthenticate() bool {
+	return u.DeletedAt == nil && u.EffectiveStatus() == UserActive
+}
+
+// Transition moves the user to a status, recording the reason and time of
+// the change (ErrInvalidTransition if the current status cannot move to
+// it). It does not persist the user.
+func (u *User) Transition(to UserStatus, reason string) error {
+	if !to.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, to)
+	}
+	from := u.EffectiveStatus()
+	if !from.CanTransition(to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	u.Status = to
+	u.StatusReason = reason
+	u.StatusChangedAt = time.Now()
+	u.Disabled = to != UserActive
+	return nil
+}
+
+// NormalizeStatus validates the status of a user being stored and keeps
+// Disabled in line with it: a user without a status takes the one of its
+// Disabled flag, and Disabled is set unless the user is active. Stores call
+// it on create and update.
+func (u *User) NormalizeStatus() error {
+	if u.Status == "" {
+		u.Status = u.EffectiveStatus()
+	}
+	if !u.Status.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, u.Status)
+	}
+	u.Disabled = u.Status != UserActive
+	if u.StatusChangedAt.IsZero() {
+		u.StatusChangedAt = time.Now()
+	}
+	return nil
+}
+
+// SetUserStatus moves a user of a store to a status (see User.Transition)
+// and returns the updated user
+func SetUserStatus(ctx context.Context, store UserStore, tenantID, userID string, status UserStatus, reason string) (*User, error) {
+	user, err := store.GetUser(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.Transition(status, reason); err != nil {
+		return nil, err
+	}
+	if err := store.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return store.GetUser(ctx, tenantID, userID)
+}
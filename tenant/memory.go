@@ -0,0 +1,717 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InMemoryStore is an in-memory implementation of TenantStore, AppStore,
+// BranchStore, UserStore, CredentialProviderStore and AuthSettingsStore.
+// Apps, users, credential providers and auth settings require a tenant that
+// is not deleted, and branches an app that is not deleted.
+type InMemoryStore struct {
+	mu       sync.RWMutex
+	tenants  map[string]*Tenant
+	apps     map[string]map[string]*App    // tenantID -> appID -> app
+	branches map[string]map[string]*Branch // tenantID/appID -> branchID -> branch
+	users    map[string]map[string]*User   // tenantID -> userID -> user
+	// tenantID -> providerID -> credential provider
+	providers map[string]map[string]*CredentialProvider
+	settings  map[string]*TenantAuthSettings // tenantID[/appID] -> settings
+}
+
+// NewInMemoryStore creates a new in-memory tenant store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		tenants:   make(map[string]*Tenant),
+		apps:      make(map[string]map[string]*App),
+		branches:  make(map[string]map[string]*Branch),
+		users:     make(map[string]map[string]*User),
+		providers: make(map[string]map[string]*CredentialProvider),
+		settings:  make(map[string]*TenantAuthSettings),
+	}
+}
+
+var (
+	_ TenantStore = (*InMemoryStore)(nil)
+	_ AppStore    = (*InMemoryStore)(nil)
+	_ BranchStore = (*InMemoryStore)(nil)
+	_ UserStore   = (*InMemoryStore)(nil)
+
+	_ UserAnonymizer = (*InMemoryStore)(nil)
+)
+
+// CreateTenant creates a tenant
+func (s *InMemoryStore) CreateTenant(ctx context.Context, tenant *Tenant) error {
+	if tenant.ID == "" {
+		tenant.ID = NewID()
+	}
+	if err := ValidateID(tenant.ID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenant.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrTenantExists, tenant.ID)
+	}
+	if err := s.checkTenantName(tenant.ID, tenant.Name); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	stored := tenant.clone()
+	if stored.Status == "" {
+		stored.Status = StatusActive
+	}
+	stored.CreatedAt, stored.UpdatedAt, stored.DeletedAt = now, now, nil
+	s.tenants[tenant.ID] = stored
+	return nil
+}
+
+// GetTenant returns a tenant that is not deleted
+func (s *InMemoryStore) GetTenant(ctx context.Context, tenantID string) (*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := s.liveTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return stored.clone(), nil
+}
+
+// UpdateTenant updates the name, status and metadata of a tenant
+func (s *InMemoryStore) UpdateTenant(ctx context.Context, tenant *Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.liveTenant(tenant.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkTenantName(tenant.ID, tenant.Name); err != nil {
+		return err
+	}
+	stored.Name = tenant.Name
+	if tenant.Status != "" {
+		stored.Status = tenant.Status
+	}
+	stored.Metadata = maps.Clone(tenant.Metadata)
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteTenant soft-deletes a tenant
+func (s *InMemoryStore) DeleteTenant(ctx context.Context, tenantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.liveTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	stored.DeletedAt = deletedNow(&stored.UpdatedAt)
+	return nil
+}
+
+// RestoreTenant restores a soft-deleted tenant
+func (s *InMemoryStore) RestoreTenant(ctx context.Context, tenantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tenants[tenantID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	if stored.DeletedAt == nil {
+		return fmt.Errorf("%w: tenant %s", ErrNotDeleted, tenantID)
+	}
+	if err := s.checkTenantName(tenantID, stored.Name); err != nil {
+		return err
+	}
+	stored.DeletedAt, stored.UpdatedAt = nil, time.Now()
+	return nil
+}
+
+// ListTenants returns a page of tenants sorted by ID, and the total count
+func (s *InMemoryStore) ListTenants(ctx context.Context, opts ListOptions) ([]*Tenant, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenants := make([]*Tenant, 0, len(s.tenants))
+	for _, tenant := range s.tenants {
+		if (opts.IncludeDeleted || tenant.DeletedAt == nil) && matchesSearch(opts.Search, tenant.ID, tenant.Name) {
+			tenants = append(tenants, tenant.clone())
+		}
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return paginate(tenants, opts), len(tenants), nil
+}
+
+// CreateApp creates an app
+func (s *InMemoryStore) CreateApp(ctx context.Context, app *App) error {
+	if app.ID == "" {
+		app.ID = NewID()
+	}
+	if err := ValidateID(app.ID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.liveTenant(app.TenantID); err != nil {
+		return err
+	}
+	apps := s.apps[app.TenantID]
+	if apps == nil {
+		apps = make(map[string]*App)
+		s.apps[app.TenantID] = apps
+	}
+	if _, ok := apps[app.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrAppExists, app.ID)
+	}
+	if err := s.checkAppName(app.TenantID, app.ID, app.Name); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	stored := app.clone()
+	if stored.Status == "" {
+		stored.Status = StatusActive
+	}
+	stored.CreatedAt, stored.UpdatedAt, stored.DeletedAt = now, now, nil
+	apps[app.ID] = stored
+	return nil
+}
+
+// GetApp returns an app that is not deleted
+func (s *InMemoryStore) GetApp(ctx context.Context, tenantID, appID string) (*App, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := s.liveApp(tenantID, appID)
+	if err != nil {
+		return nil, err
+	}
+	return stored.clone(), nil
+}
+
+// UpdateApp updates the name, status and metadata of an app
+func (s *InMemoryStore) UpdateApp(ctx context.Context, app *App) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.liveApp(app.TenantID, app.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkAppName(app.TenantID, app.ID, app.Name); err != nil {
+		return err
+	}
+	stored.Name = app.Name
+	if app.Status != "" {
+		stored.Status = app.Status
+	}
+	stored.Metadata = maps.Clone(app.Metadata)
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteApp soft-deletes an app
+func (s *InMemoryStore) DeleteApp(ctx context.Context, tenantID, appID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.liveApp(tenantID, appID)
+	if err != nil {
+		return err
+	}
+	stored.DeletedAt = deletedNow(&stored.UpdatedAt)
+	return nil
+}
+
+// RestoreApp restores a soft-deleted app
+func (s *InMemoryStore) RestoreApp(ctx context.Context, tenantID, appID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return err
+	}
+	stored, ok := s.apps[tenantID][appID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	if stored.DeletedAt == nil {
+		return fmt.Errorf("%w: app %s", ErrNotDeleted, appID)
+	}
+	if err := s.checkAppName(tenantID, appID, stored.Name); err != nil {
+		return err
+	}
+	stored.DeletedAt, stored.UpdatedAt = nil, time.Now()
+	return nil
+}
+
+// ListApps returns a page of the apps of a tenant sorted by ID, and the
+// total count
+func (s *InMemoryStore) ListApps(ctx context.Context, tenantID string, opts ListOptions) ([]*App, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return nil, 0, err
+	}
+	apps := make([]*App, 0, len(s.apps[tenantID]))
+	for _, app := range s.apps[tenantID] {
+		if (opts.IncludeDeleted || app.DeletedAt == nil) && matchesSearch(opts.Search, app.ID, app.Name) {
+			apps = append(apps, app.clone())
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].ID < apps[j].ID })
+	return paginate(apps, opts), len(apps), nil
+}
+
+// CreateBranch creates a branch
+func (s *InMemoryStore) CreateBranch(ctx context.Context, branch *Branch) error {
+	if branch.ID == "" {
+		branch.ID = NewID()
+	}
+	if err := ValidateID(branch.ID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.liveApp(branch.TenantID, branch.AppID); err != nil {
+		return err
+	}
+	key := branchKey(branch.TenantID, branch.AppID)
+	branches := s.branches[key]
+	if branches == nil {
+		branches = make(map[string]*Branch)
+		s.branches[key] = branches
+	}
+	if _, ok := branches[branch.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrBranchExists, branch.ID)
+	}
+	if err := s.checkBranchName(key, branch.ID, branch.Name); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	stored := branch.clone()
+	stored.CreatedAt, stored.UpdatedAt, stored.DeletedAt = now, now, nil
+	branches[branch.ID] = stored
+	return nil
+}
+
+// GetBranch returns a branch that is not deleted
+func (s *InMemoryStore) GetBranch(ctx context.Context, tenantID, appID, branchID string) (*Branch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := s.liveBranch(tenantID, appID, branchID)
+	if err != nil {
+		return nil, err
+	}
+	return stored.clone(), nil
+}
+
+// UpdateBranch updates the name and metadata of a branch
+func (s *InMemoryStore) UpdateBranch(ctx context.Context, branch *Branch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.liveBranch(branch.TenantID, branch.AppID, branch.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkBranchName(branchKey(branch.TenantID, branch.AppID), branch.ID, branch.Name); err != nil {
+		return err
+	}
+	stored.Name = branch.Name
+	stored.Metadata = maps.Clone(branch.Metadata)
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteBranch soft-deletes a branch
+func (s *InMemoryStore) DeleteBranch(ctx context.Context, tenantID, appID, branchID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.liveBranch(tenantID, appID, branchID)
+	if err != nil {
+		return err
+	}
+	stored.DeletedAt = deletedNow(&stored.UpdatedAt)
+	return nil
+}
+
+// RestoreBranch restores a soft-deleted branch
+func (s *InMemoryStore) RestoreBranch(ctx context.Context, tenantID, appID, branchID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.liveApp(tenantID, appID); err != nil {
+		return err
+	}
+	key := branchKey(tenantID, appID)
+	stored, ok := s.branches[key][branchID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrBranchNotFound, branchID)
+	}
+	if stored.DeletedAt == nil {
+		return fmt.Errorf("%w: branch %s", ErrNotDeleted, branchID)
+	}
+	if err := s.checkBranchName(key, branchID, stored.Name); err != nil {
+		return err
+	}
+	stored.DeletedAt, stored.UpdatedAt = nil, time.Now()
+	return nil
+}
+
+// ListBranches returns a page of the branches of an app sorted by ID, and the
+// total count
+func (s *InMemoryStore) ListBranches(ctx context.Context, tenantID, appID string, opts ListOptions) ([]*Branch, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.liveApp(tenantID, appID); err != nil {
+		return nil, 0, err
+	}
+	stored := s.branches[branchKey(tenantID, appID)]
+	branches := make([]*Branch, 0, len(stored))
+	for _, branch := range stored {
+		if (opts.IncludeDeleted || branch.DeletedAt == nil) && matchesSearch(opts.Search, branch.ID, branch.Name) {
+			branches = append(branches, branch.clone())
+		}
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].ID < branches[j].ID })
+	return paginate(branches, opts), len(branches), nil
+}
+
+// CreateUser creates a user
+func (s *InMemoryStore) CreateUser(ctx context.Context, user *User) error {
+	if user.ID == "" {
+		user.ID = NewID()
+	}
+	if err := ValidateID(user.ID); err != nil {
+		return err
+	}
+	if err := user.NormalizeStatus(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.liveTenant(user.TenantID); err != nil {
+		return err
+	}
+	users := s.users[user.TenantID]
+	if users == nil {
+		users = make(map[string]*User)
+		s.users[user.TenantID] = users
+	}
+	if _, ok := users[user.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrUserExists, user.ID)
+	}
+	if err := s.checkUserIdentifiers(user.TenantID, user.ID, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	stored := user.clone()
+	stored.CreatedAt, stored.UpdatedAt, stored.DeletedAt = now, now, nil
+	users[user.ID] = stored
+	return nil
+}
+
+// GetUser returns a user that is not deleted
+func (s *InMemoryStore) GetUser(ctx context.Context, tenantID, userID string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := s.liveUser(tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return stored.clone(), nil
+}
+
+// GetUserByUsername returns a user that is not deleted by username
+func (s *InMemoryStore) GetUserByUsername(ctx context.Context, tenantID, username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return nil, err
+	}
+	for _, user := range s.users[tenantID] {
+		if user.DeletedAt == nil && fold(user.Username) == fold(username) {
+			return user.clone(), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+}
+
+// UpdateUser updates the username, email, password hash, status and
+// metadata of a user
+func (s *InMemoryStore) UpdateUser(ctx context.Context, user *User) error {
+	if err := user.NormalizeStatus(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.liveUser(user.TenantID, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkUserIdentifiers(user.TenantID, user.ID, user.Username, user.Email); err != nil {
+		return err
+	}
+	stored.Username = user.Username
+	stored.Email = user.Email
+	stored.PasswordHash = user.PasswordHash
+	stored.Status = user.Status
+	stored.StatusReason = user.StatusReason
+	stored.StatusChangedAt = user.StatusChangedAt
+	stored.Disabled = user.Disabled
+	stored.Metadata = maps.Clone(user.Metadata)
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteUser soft-deletes a user
+func (s *InMemoryStore) DeleteUser(ctx context.Context, tenantID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.liveUser(tenantID, userID)
+	if err != nil {
+		return err
+	}
+	stored.DeletedAt = deletedNow(&stored.UpdatedAt)
+	return nil
+}
+
+// RestoreUser restores a soft-deleted user
+func (s *InMemoryStore) RestoreUser(ctx context.Context, tenantID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return err
+	}
+	stored, ok := s.users[tenantID][userID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+	if stored.DeletedAt == nil {
+		return fmt.Errorf("%w: user %s", ErrNotDeleted, userID)
+	}
+	if err := s.checkUserIdentifiers(tenantID, userID, stored.Username, stored.Email); err != nil {
+		return err
+	}
+	stored.DeletedAt, stored.UpdatedAt = nil, time.Now()
+	return nil
+}
+
+// AnonymizeUser scrubs the personal data of a user and soft-deletes it
+// unless it is deleted already
+func (s *InMemoryStore) AnonymizeUser(ctx context.Context, tenantID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return err
+	}
+	stored, ok := s.users[tenantID][userID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+	stored.Anonymize()
+	if stored.DeletedAt == nil {
+		stored.DeletedAt = deletedNow(&stored.UpdatedAt)
+	} else {
+		stored.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// ListUsers returns a page of the users of a tenant sorted by ID, and the
+// total count
+func (s *InMemoryStore) ListUsers(ctx context.Context, tenantID string, opts ListOptions) ([]*User, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return nil, 0, err
+	}
+	users := make([]*User, 0, len(s.users[tenantID]))
+	for _, user := range s.users[tenantID] {
+		if (opts.IncludeDeleted || user.DeletedAt == nil) && matchesSearch(opts.Search, user.ID, user.Username, user.Email) {
+			users = append(users, user.clone())
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return paginate(users, opts), len(users), nil
+}
+
+// liveTenant returns a tenant that is not deleted. Caller must hold the lock.
+func (s *InMemoryStore) liveTenant(tenantID string) (*Tenant, error) {
+	tenant, ok := s.tenants[tenantID]
+	if !ok || tenant.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	return tenant, nil
+}
+
+// liveApp returns an app that is not deleted, of a tenant that is not
+// deleted. Caller must hold the lock.
+func (s *InMemoryStore) liveApp(tenantID, appID string) (*App, error) {
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return nil, err
+	}
+	app, ok := s.apps[tenantID][appID]
+	if !ok || app.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	return app, nil
+}
+
+// liveBranch returns a branch that is not deleted, of an app that is not
+// deleted. Caller must hold the lock.
+func (s *InMemoryStore) liveBranch(tenantID, appID, branchID string) (*Branch, error) {
+	if _, err := s.liveApp(tenantID, appID); err != nil {
+		return nil, err
+	}
+	branch, ok := s.branches[branchKey(tenantID, appID)][branchID]
+	if !ok || branch.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBranchNotFound, branchID)
+	}
+	return branch, nil
+}
+
+// liveUser returns a user that is not deleted, of a tenant that is not
+// deleted. Caller must hold the lock.
+func (s *InMemoryStore) liveUser(tenantID, userID string) (*User, error) {
+	if _, err := s.liveTenant(tenantID); err != nil {
+		return nil, err
+	}
+	user, ok := s.users[tenantID][userID]
+	if !ok || user.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+	return user, nil
+}
+
+// checkTenantName checks that no other live tenant has the name
+func (s *InMemoryStore) checkTenantName(tenantID, name string) error {
+	for id, tenant := range s.tenants {
+		if id != tenantID && tenant.DeletedAt == nil && fold(tenant.Name) == fold(name) {
+			return fmt.Errorf("%w: name %q is taken", ErrTenantExists, name)
+		}
+	}
+	return nil
+}
+
+// checkAppName checks that no other live app of the tenant has the name
+func (s *InMemoryStore) checkAppName(tenantID, appID, name string) error {
+	for id, app := range s.apps[tenantID] {
+		if id != appID && app.DeletedAt == nil && fold(app.Name) == fold(name) {
+			return fmt.Errorf("%w: name %q is taken", ErrAppExists, name)
+		}
+	}
+	return nil
+}
+
+// checkBranchName checks that no other live branch of the app has the name
+func (s *InMemoryStore) checkBranchName(key, branchID, name string) error {
+	for id, branch := range s.branches[key] {
+		if id != branchID && branch.DeletedAt == nil && fold(branch.Name) == fold(name) {
+			return fmt.Errorf("%w: name %q is taken", ErrBranchExists, name)
+		}
+	}
+	return nil
+}
+
+// checkUserIdentifiers checks that no other live user of the tenant has the
+// username or email
+func (s *InMemoryStore) checkUserIdentifiers(tenantID, userID, username, email string) error {
+	for id, user := range s.users[tenantID] {
+		if id == userID || user.DeletedAt != nil {
+			continue
+		}
+		if fold(user.Username) == fold(username) {
+			return fmt.Errorf("%w: username %q is taken", ErrUserExists, username)
+		}
+		if email != "" && fold(user.Email) == fold(email) {
+			return fmt.Errorf("%w: email %q is taken", ErrUserExists, email)
+		}
+	}
+	return nil
+}
+
+// branchKey is the key of the branches of an app
+func branchKey(tenantID, appID string) string {
+	return tenantID + "/" + appID
+}
+
+// deletedNow returns the deletion time and sets updatedAt to it
+func deletedNow(updatedAt *time.Time) *time.Time {
+	now := time.Now()
+	*updatedAt = now
+	return &now
+}
+
+func (t *Tenant) clone() *Tenant {
+	clone := *t
+	clone.Metadata = maps.Clone(t.Metadata)
+	if t.DeletedAt != nil {
+		deletedAt := *t.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	return &clone
+}
+
+func (a *App) clone() *App {
+	clone := *a
+	clone.Metadata = maps.Clone(a.Metadata)
+	if a.DeletedAt != nil {
+		deletedAt := *a.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	return &clone
+}
+
+func (b *Branch) clone() *Branch {
+	clone := *b
+	clone.Metadata = maps.Clone(b.Metadata)
+	if b.DeletedAt != nil {
+		deletedAt := *b.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	return &clone
+}
+
+func (u *User) clone() *User {
+	clone := *u
+	clone.Metadata = maps.Clone(u.Metadata)
+	if u.DeletedAt != nil {
+		deletedAt := *u.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	return &clone
+}
@@ -0,0 +1,99 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	subject "github.com/primadi/lokstra-auth/03_subject"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// ProfileMetadataKey is the metadata key holding the profile attributes of
+// a user (e.g., display name, locale)
+const ProfileMetadataKey = "profile"
+
+// Profile returns a copy of the profile attributes of the user
+func (u *User) Profile() map[string]any {
+	profile := make(map[string]any)
+	switch stored := u.Metadata[ProfileMetadataKey].(type) {
+	case map[string]any:
+		for k, v := range stored {
+			profile[k] = v
+		}
+	case map[string]string:
+		for k, v := range stored {
+			profile[k] = v
+		}
+	}
+	return profile
+}
+
+// SetProfile replaces the profile attributes of the user (empty: removed).
+// The metadata map is copied, so users read from a store are not changed in
+// place.
+func (u *User) SetProfile(profile map[string]any) {
+	metadata := make(map[string]any, len(u.Metadata)+1)
+	for k, v := range u.Metadata {
+		metadata[k] = v
+	}
+	if len(profile) == 0 {
+		delete(metadata, ProfileMetadataKey)
+	} else {
+		metadata[ProfileMetadataKey] = profile
+	}
+	u.Metadata = metadata
+}
+
+// ProfileProvider adapts a UserStore to subject.ProfileStore, reading and
+// writing the users of the tenant of the context (see authz.WithTenant).
+// Profiles have the username and email of the user, and its profile
+// attributes; only the attributes can be updated.
+type ProfileProvider struct {
+	store UserStore
+}
+
+var _ subject.ProfileStore = (*ProfileProvider)(nil)
+
+// NewProfileProvider creates a profile provider backed by a user store
+func NewProfileProvider(store UserStore) *ProfileProvider {
+	return &ProfileProvider{store: store}
+}
+
+// GetProfile returns the profile of a user of the context tenant (empty for
+// unknown users, e.g., service accounts)
+func (p *ProfileProvider) GetProfile(ctx context.Context, sub *subject.Subject) (map[string]any, error) {
+	user, err := p.store.GetUser(ctx, authz.TenantFromContext(ctx), sub.ID)
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrTenantNotFound) {
+		return make(map[string]any), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile := user.Profile()
+	profile["username"] = user.Username
+	if user.Email != "" {
+		profile["email"] = user.Email
+	}
+	return profile, nil
+}
+
+// UpdateProfile sets the profile attributes of a user of the context tenant;
+// nil values remove attributes
+func (p *ProfileProvider) UpdateProfile(ctx context.Context, sub *subject.Subject, changes map[string]any) error {
+	user, err := p.store.GetUser(ctx, authz.TenantFromContext(ctx), sub.ID)
+	if err != nil {
+		return err
+	}
+
+	profile := user.Profile()
+	for k, v := range changes {
+		if v == nil {
+			delete(profile, k)
+		} else {
+			profile[k] = v
+		}
+	}
+	user.SetProfile(profile)
+	return p.store.UpdateUser(ctx, user)
+}
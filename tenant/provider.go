@@ -0,0 +1,40 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/primadi/lokstra-auth/01_credential/basic"
+	authz "github.com/primadi/lokstra-auth/04_authz"
+)
+
+// UserProvider adapts a UserStore to basic.UserProvider, looking users up in
+// the tenant of the context (see authz.WithTenant)
+type UserProvider struct {
+	store UserStore
+}
+
+// NewUserProvider creates a basic user provider backed by a user store
+func NewUserProvider(store UserStore) *UserProvider {
+	return &UserProvider{store: store}
+}
+
+// GetUserByUsername returns the user of the context tenant. Users that are
+// not active are disabled.
+func (p *UserProvider) GetUserByUsername(ctx context.Context, username string) (*basic.User, error) {
+	user, err := p.store.GetUserByUsername(ctx, authz.TenantFromContext(ctx), username)
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrTenantNotFound) {
+		return nil, basic.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &basic.User{
+		ID:           user.ID,
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Email:        user.Email,
+		Disabled:     !user.CanAuthenticate(),
+		Metadata:     user.Metadata,
+	}, nil
+}
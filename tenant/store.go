@@ -0,0 +1,265 @@
+// Package tenant holds the multi-tenant control plane domain: tenants, the
+// apps of a tenant, the branches of an app and the users of a tenant.
+//
+// Deletes are soft: a deleted record keeps its ID (which cannot be reused) and
+// can be restored, but is hidden from Get and List (unless
+// ListOptions.IncludeDeleted) and frees its name, username or email for new
+// records.
+package tenant
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantExists   = errors.New("tenant already exists")
+	ErrAppNotFound    = errors.New("app not found")
+	ErrAppExists      = errors.New("app already exists")
+	ErrBranchNotFound = errors.New("branch not found")
+	ErrBranchExists   = errors.New("branch already exists")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrUserExists     = errors.New("user already exists")
+	ErrInvalidID      = errors.New("invalid id")
+	ErrNotDeleted     = errors.New("record is not deleted")
+)
+
+// Status is the status of a tenant or app
+type Status string
+
+const (
+	StatusActive    Status = "active"
+	StatusSuspended Status = "suspended"
+)
+
+// Tenant is an isolated customer of the platform
+type Tenant struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Status    Status         `json:"status"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt *time.Time     `json:"deleted_at,omitempty"`
+}
+
+// App is an application of a tenant
+type App struct {
+	ID        string         `json:"id"`
+	TenantID  string         `json:"tenant_id"`
+	Name      string         `json:"name"`
+	Status    Status         `json:"status"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt *time.Time     `json:"deleted_at,omitempty"`
+}
+
+// Branch is a branch (office, store, region...) of an app
+type Branch struct {
+	ID        string         `json:"id"`
+	TenantID  string         `json:"tenant_id"`
+	AppID     string         `json:"app_id"`
+	Name      string         `json:"name"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt *time.Time     `json:"deleted_at,omitempty"`
+}
+
+// User is a user of a tenant. Usernames and emails are unique per tenant
+// (case-insensitive).
+//
+// Status is the lifecycle status of the user (see User.Transition), with the
+// reason and time of its last change. Disabled mirrors it (set unless the
+// user is active) for readers of the flag; stores derive the status of users
+// created with only Disabled.
+type User struct {
+	ID              string         `json:"id"`
+	TenantID        string         `json:"tenant_id"`
+	Username        string         `json:"username"`
+	Email           string         `json:"email,omitempty"`
+	PasswordHash    string         `json:"-"`
+	Status          UserStatus     `json:"status"`
+	StatusReason    string         `json:"status_reason,omitempty"`
+	StatusChangedAt time.Time      `json:"status_changed_at,omitzero"`
+	Disabled        bool           `json:"disabled"`
+	Metadata        map[string]any `json:"metadata,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       *time.Time     `json:"deleted_at,omitempty"`
+}
+
+// ListOptions pages and filters a list
+type ListOptions struct {
+	// Offset is the number of items to skip
+	Offset int
+
+	// Limit is the maximum number of items to return (0: all)
+	Limit int
+
+	// Search keeps the items whose ID or name (username or email for users)
+	// contains the text (case-insensitive)
+	Search string
+
+	// IncludeDeleted also returns soft-deleted items
+	IncludeDeleted bool
+}
+
+// TenantStore persists tenants
+type TenantStore interface {
+	// CreateTenant creates a tenant (ErrTenantExists if the ID or name is
+	// taken). An empty ID is generated.
+	CreateTenant(ctx context.Context, tenant *Tenant) error
+
+	// GetTenant returns a tenant that is not deleted
+	GetTenant(ctx context.Context, tenantID string) (*Tenant, error)
+
+	// UpdateTenant updates the name, status and metadata of a tenant
+	UpdateTenant(ctx context.Context, tenant *Tenant) error
+
+	// DeleteTenant soft-deletes a tenant
+	DeleteTenant(ctx context.Context, tenantID string) error
+
+	// RestoreTenant restores a soft-deleted tenant
+	RestoreTenant(ctx context.Context, tenantID string) error
+
+	// ListTenants returns a page of tenants sorted by ID, and the total count
+	ListTenants(ctx context.Context, opts ListOptions) ([]*Tenant, int, error)
+}
+
+// AppStore persists the apps of tenants
+type AppStore interface {
+	// CreateApp creates an app (ErrAppExists if the ID or name is taken in
+	// the tenant). An empty ID is generated.
+	CreateApp(ctx context.Context, app *App) error
+
+	// GetApp returns an app that is not deleted
+	GetApp(ctx context.Context, tenantID, appID string) (*App, error)
+
+	// UpdateApp updates the name, status and metadata of an app
+	UpdateApp(ctx context.Context, app *App) error
+
+	// DeleteApp soft-deletes an app
+	DeleteApp(ctx context.Context, tenantID, appID string) error
+
+	// RestoreApp restores a soft-deleted app
+	RestoreApp(ctx context.Context, tenantID, appID string) error
+
+	// ListApps returns a page of the apps of a tenant sorted by ID, and the
+	// total count
+	ListApps(ctx context.Context, tenantID string, opts ListOptions) ([]*App, int, error)
+}
+
+// BranchStore persists the branches of apps
+type BranchStore interface {
+	// CreateBranch creates a branch (ErrBranchExists if the ID or name is
+	// taken in the app). An empty ID is generated.
+	CreateBranch(ctx context.Context, branch *Branch) error
+
+	// GetBranch returns a branch that is not deleted
+	GetBranch(ctx context.Context, tenantID, appID, branchID string) (*Branch, error)
+
+	// UpdateBranch updates the name and metadata of a branch
+	UpdateBranch(ctx context.Context, branch *Branch) error
+
+	// DeleteBranch soft-deletes a branch
+	DeleteBranch(ctx context.Context, tenantID, appID, branchID string) error
+
+	// RestoreBranch restores a soft-deleted branch
+	RestoreBranch(ctx context.Context, tenantID, appID, branchID string) error
+
+	// ListBranches returns a page of the branches of an app sorted by ID, and
+	// the total count
+	ListBranches(ctx context.Context, tenantID, appID string, opts ListOptions) ([]*Branch, int, error)
+}
+
+// UserStore persists the users of tenants
+type UserStore interface {
+	// CreateUser creates a user (ErrUserExists if the ID, username or email
+	// is taken in the tenant). An empty ID is generated.
+	CreateUser(ctx context.Context, user *User) error
+
+	// GetUser returns a user that is not deleted
+	GetUser(ctx context.Context, tenantID, userID string) (*User, error)
+
+	// GetUserByUsername returns a user that is not deleted by username
+	// (case-insensitive)
+	GetUserByUsername(ctx context.Context, tenantID, username string) (*User, error)
+
+	// UpdateUser updates the username, email, password hash, status and
+	// metadata of a user
+	UpdateUser(ctx context.Context, user *User) error
+
+	// DeleteUser soft-deletes a user
+	DeleteUser(ctx context.Context, tenantID, userID string) error
+
+	// RestoreUser restores a soft-deleted user
+	RestoreUser(ctx context.Context, tenantID, userID string) error
+
+	// ListUsers returns a page of the users of a tenant sorted by ID, and the
+	// total count
+	ListUsers(ctx context.Context, tenantID string, opts ListOptions) ([]*User, int, error)
+}
+
+// ValidateID checks a tenant, app, branch or user ID: not empty, at most 64
+// characters of letters, digits, '-', '_' and '.'
+func ValidateID(id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidID)
+	}
+	if len(id) > 64 {
+		return fmt.Errorf("%w: %q is longer than 64 characters", ErrInvalidID, id)
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return fmt.Errorf("%w: %q contains %q", ErrInvalidID, id, r)
+		}
+	}
+	return nil
+}
+
+// NewID returns a random ID
+func NewID() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// fold normalizes a name, username or email for uniqueness checks
+func fold(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// matchesSearch reports whether any of the values contains search
+// (case-insensitive)
+func matchesSearch(search string, values ...string) bool {
+	if search == "" {
+		return true
+	}
+	search = strings.ToLower(search)
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// paginate returns the page of items selected by opts
+func paginate[T any](items []T, opts ListOptions) []T {
+	start := min(max(opts.Offset, 0), len(items))
+	end := len(items)
+	if opts.Limit > 0 {
+		end = min(start+opts.Limit, len(items))
+	}
+	return items[start:end]
+}
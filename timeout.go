@@ -0,0 +1,163 @@
+package lokstraauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is matched (errors.Is) by every *TimeoutError
+var ErrTimeout = errors.New("operation timed out")
+
+// Layer identifies the dependency a timeout applies to
+type Layer string
+
+const (
+	LayerAuthenticator Layer = "authenticator" // credential.Authenticator
+	LayerToken         Layer = "token"         // token manager: generate, verify, refresh, revoke
+	LayerSubject       Layer = "subject"       // subject resolver and identity context builder (provider fetches)
+	LayerStore         Layer = "store"         // token, identity (session) and device store queries
+	LayerAuthorizer    Layer = "authorizer"    // authorization evaluation
+	LayerRequest       Layer = "request"       // whole Login / Verify / Authorize call
+)
+
+// Timeouts are per-layer latency budgets. A zero duration disables the
+// timeout of that layer.
+type Timeouts struct {
+	// Authenticator bounds credential authentication (e.g., an LDAP bind)
+	Authenticator time.Duration
+
+	// Token bounds token manager calls
+	Token time.Duration
+
+	// Subject bounds subject resolution and identity context building,
+	// including role/permission/profile provider fetches
+	Subject time.Duration
+
+	// Store bounds each token, session and device store query
+	Store time.Duration
+
+	// Authorizer bounds authorization evaluation
+	Authorizer time.Duration
+
+	// Request bounds a whole Login, Verify or Authorize call
+	Request time.Duration
+}
+
+// DefaultTimeouts returns timeouts suitable for interactive logins
+func DefaultTimeouts() *Timeouts {
+	return &Timeouts{
+		Authenticator: 5 * time.Second,
+		Token:         2 * time.Second,
+		Subject:       2 * time.Second,
+		Store:         1 * time.Second,
+		Authorizer:    1 * time.Second,
+		Request:       10 * time.Second,
+	}
+}
+
+// of returns the timeout of a layer
+func (t *Timeouts) of(layer Layer) time.Duration {
+	if t == nil {
+		return 0
+	}
+	switch layer {
+	case LayerAuthenticator:
+		return t.Authenticator
+	case LayerToken:
+		return t.Token
+	case LayerSubject:
+		return t.Subject
+	case LayerStore:
+		return t.Store
+	case LayerAuthorizer:
+		return t.Authorizer
+	case LayerRequest:
+		return t.Request
+	}
+	return 0
+}
+
+// TimeoutError reports the layer whose latency budget was exceeded.
+// errors.Is matches ErrTimeout and context.DeadlineExceeded.
+type TimeoutError struct {
+	Layer     Layer
+	Operation string // e.g., "authenticate basic", "build identity"
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s (%s)", e.Layer, e.Timeout, e.Operation)
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout || target == context.DeadlineExceeded
+}
+
+// withRequestTimeout bounds a whole runtime call with Timeouts.Request
+func (a *Auth) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := a.config.Timeouts.of(LayerRequest)
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithDeadlineCause(ctx, time.Now().Add(timeout), &TimeoutError{
+		Layer:     LayerRequest,
+		Operation: "request",
+		Timeout:   timeout,
+	})
+}
+
+// within runs a layer call under the layer's timeout. The call gets a context
+// with the deadline; a call that ignores its context is abandoned when the
+// deadline passes, so a slow dependency cannot hold up the caller. Without
+// timeouts configured, fn is called directly.
+func within[T any](ctx context.Context, timeouts *Timeouts, layer Layer, operation string, fn func(ctx context.Context) (T, error)) (T, error) {
+	timeout := timeouts.of(layer)
+	if timeout <= 0 && (timeouts == nil || timeouts.Request <= 0) {
+		return fn(ctx)
+	}
+
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithDeadlineCause(ctx, time.Now().Add(timeout), &TimeoutError{
+			Layer:     layer,
+			Operation: operation,
+			Timeout:   timeout,
+		})
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn(ctx)
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() != nil {
+			return r.value, timeoutCause(ctx, r.err)
+		}
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, timeoutCause(ctx, ctx.Err())
+	}
+}
+
+// timeoutCause returns the *TimeoutError that cancelled ctx, or err when ctx
+// was cancelled for another reason (e.g., the client went away)
+func timeoutCause(ctx context.Context, err error) error {
+	var timeoutErr *TimeoutError
+	if errors.As(context.Cause(ctx), &timeoutErr) {
+		return timeoutErr
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package lokstraauth
+
+import (
+	"context"
+
+	authz "github.com/primadi/lokstra-auth/04_authz"
+	"github.com/primadi/lokstra-auth/tracing"
+)
+
+// SetTracer sets the tracer of the runtime (e.g., an OpenTelemetry adapter,
+// see tracing/README.md). Login, Verify, Authorize, CheckPermission and
+// CheckRole start a span, with a child span per layer call
+// (authenticator, token manager, subject resolver and identity builder,
+// authorizer, stores).
+func (a *Auth) SetTracer(tracer tracing.Tracer) {
+	a.tracer = tracer
+}
+
+// startSpan starts a runtime span carrying the tenant and app of the context
+func (a *Auth) startSpan(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	if a.tracer == nil {
+		return tracing.Start(ctx, nil, name)
+	}
+	if tenantID := authz.TenantFromContext(ctx); tenantID != "" {
+		attrs = append(attrs, tracing.String(tracing.AttrTenant, tenantID))
+	}
+	if appID := authz.AppFromContext(ctx); appID != "" {
+		attrs = append(attrs, tracing.String(tracing.AttrApp, appID))
+	}
+	return a.tracer.Start(ctx, "lokstra."+name, attrs...)
+}
+
+// inLayer runs a layer call in a span under the layer's timeout
+func inLayer[T any](ctx context.Context, a *Auth, layer Layer, operation string, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, span := a.startSpan(ctx, string(layer)+" "+operation,
+		tracing.String(tracing.AttrLayer, string(layer)),
+		tracing.String(tracing.AttrOperation, operation))
+	value, err := within(ctx, a.config.Timeouts, layer, operation, fn)
+	tracing.End(span, err)
+	return value, err
+}
+
+// decisionAttrs returns the span attributes of an authorization decision
+func (a *Auth) decisionAttrs(allowed bool) []tracing.Attribute {
+	decision := "deny"
+	if allowed {
+		decision = "allow"
+	}
+	return []tracing.Attribute{
+		tracing.String(tracing.AttrDecision, decision),
+		tracing.String(tracing.AttrEvaluator, evaluatorName(a.authorizer)),
+	}
+}
@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+)
+
+// OpenDB opens a database whose queries are traced, for the Postgres stores
+// (rbac, policy, rebac, jwt keys) and other database/sql users:
+//
+//	db := tracing.OpenDB(stdlib.GetDefaultDriver(), dsn, tracer, "postgresql")
+//	store, err := rbac.NewPostgresStore(db, "auth_")
+//
+// Every query, exec and transaction is a span carrying db.system and
+// db.statement, a child of the span in the context of the call.
+func OpenDB(d driver.Driver, dsn string, tracer Tracer, system string) *sql.DB {
+	var connector driver.Connector = dsnConnector{dsn: dsn, driver: d}
+	if dc, ok := d.(driver.DriverContext); ok {
+		if c, err := dc.OpenConnector(dsn); err == nil {
+			connector = c
+		}
+	}
+	return sql.OpenDB(WrapConnector(connector, tracer, system))
+}
+
+// WrapConnector returns a connector whose connections trace their queries
+func WrapConnector(connector driver.Connector, tracer Tracer, system string) driver.Connector {
+	return &tracedConnector{Connector: connector, tracer: tracer, system: system}
+}
+
+// dsnConnector opens connections of a driver without DriverContext
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type tracedConnector struct {
+	driver.Connector
+	tracer Tracer
+	system string
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, connector: c}, nil
+}
+
+// start starts a database span
+func (c *tracedConnector) start(ctx context.Context, name, statement string) (context.Context, Span) {
+	attrs := []Attribute{String(AttrDBSystem, c.system)}
+	if statement != "" {
+		attrs = append(attrs, String(AttrDBStatement, statement))
+	}
+	return Start(ctx, c.tracer, name, attrs...)
+}
+
+// tracedConn traces the context-aware calls of a connection. Calls the
+// wrapped connection does not support return driver.ErrSkip, so
+// database/sql falls back to prepared statements.
+type tracedConn struct {
+	driver.Conn
+	connector *tracedConnector
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := c.connector.start(ctx, "db.query", query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	End(span, skipless(err))
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := c.connector.start(ctx, "db.exec", query)
+	result, err := execer.ExecContext(ctx, query, args)
+	End(span, skipless(err))
+	return result, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	ctx, span := c.connector.start(ctx, "db.prepare", query)
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	End(span, err)
+	return stmt, err
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	ctx, span := c.connector.start(ctx, "db.transaction", "")
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, span: span}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// tracedTx ends the transaction span on commit or rollback
+type tracedTx struct {
+	driver.Tx
+	span Span
+}
+
+func (t *tracedTx) Commit() error {
+	err := t.Tx.Commit()
+	End(t.span, err)
+	return err
+}
+
+func (t *tracedTx) Rollback() error {
+	err := t.Tx.Rollback()
+	t.span.SetAttributes(Bool("db.rollback", true))
+	End(t.span, err)
+	return err
+}
+
+// skipless drops driver.ErrSkip, which is a fallback signal, not a failure
+func skipless(err error) error {
+	if err == driver.ErrSkip {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+)
+
+// Attribute keys set by the runtime
+const (
+	AttrTenant        = "lokstra.tenant_id"
+	AttrApp           = "lokstra.app_id"
+	AttrAuthenticator = "lokstra.authenticator"
+	AttrLayer         = "lokstra.layer"
+	AttrOperation     = "lokstra.operation"
+	AttrDecision      = "lokstra.decision"
+	AttrEvaluator     = "lokstra.evaluator"
+	AttrTokenValid    = "lokstra.token.valid"
+	AttrDBSystem      = "db.system"
+	AttrDBStatement   = "db.statement"
+)
+
+// Attribute is a span attribute. Values are strings, bools, ints or
+// float64s.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a bool attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an int attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer starts spans. Implementations adapt a tracing SDK, e.g. an
+// OpenTelemetry trace.Tracer (see README); the span is carried by the
+// returned context, so spans started from it become its children and
+// outgoing requests made with it propagate the trace.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a started span
+type Span interface {
+	// SetAttributes adds attributes to the span
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError records an error and marks the span as failed
+	RecordError(err error)
+
+	// End ends the span
+	End()
+}
+
+// Start starts a span with tracer, or returns a no-op span when tracer is
+// nil
+func Start(ctx context.Context, tracer Tracer, name string, attrs ...Attribute) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, nopSpan{}
+	}
+	return tracer.Start(ctx, name, attrs...)
+}
+
+// End records err (if any) and ends the span
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// nopSpan discards everything
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...Attribute) {}
+func (nopSpan) RecordError(error)          {}
+func (nopSpan) End()                       {}